@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
@@ -122,6 +123,7 @@ func handleCreateAPIKey(authService *auth.Service) gin.HandlerFunc {
 		var req struct {
 			Name        string   `json:"name" binding:"required"`
 			Permissions []string `json:"permissions"`
+			Scopes      []string `json:"scopes"`
 		}
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, types.APIResponse{
@@ -131,7 +133,14 @@ func handleCreateAPIKey(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
-		apiKey, keyValue, err := authService.CreateAPIKey(c.Request.Context(), user.ID, req.Name, req.Permissions)
+		apiKey, keyValue, err := authService.CreateAPIKey(c.Request.Context(), user.ID, req.Name, req.Permissions, req.Scopes)
+		if errors.Is(err, auth.ErrInvalidAPIKeyScope) {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, types.APIResponse{
 				Success: false,
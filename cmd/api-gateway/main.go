@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
@@ -10,11 +17,18 @@ import (
 
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/cmd/api-gateway/routes"
+	"github.com/lgulliver/lodestone/internal/audit"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/metadata"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/retention"
+	"github.com/lgulliver/lodestone/internal/scanning"
 	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/internal/webhooks"
 	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/metrics"
+	"github.com/lgulliver/lodestone/pkg/version"
 
 	_ "github.com/lgulliver/lodestone/docs" // Import for swagger docs
 )
@@ -24,6 +38,10 @@ func main() {
 	cfg := config.LoadFromEnv()
 	cfg.Logging.SetupLogging()
 
+	// Stop serving, and the background workers, on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Initialize database connection
 	database, err := common.NewDatabase(&cfg.Database)
 	if err != nil {
@@ -40,6 +58,14 @@ func main() {
 	if err != nil {
 		log.Warn().Err(err).Msg("Failed to connect to Redis cache, continuing without cache")
 		cache = nil // Optional component
+	} else {
+		defer cache.Close()
+	}
+
+	// Initialize metrics collection, left nil when disabled
+	var collector *metrics.Collector
+	if cfg.Metrics.Enabled {
+		collector = metrics.NewCollector()
 	}
 
 	// Initialize storage backend using factory
@@ -48,55 +74,175 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to initialize storage")
 	}
+	storageBackend = storage.NewInstrumentedStorage(storageBackend, collector)
 
 	// Initialize services with database connections
 	authService := auth.NewService(database, cache, &cfg.Auth)
+	authService.SetMetrics(collector)
 	registryService := registry.NewService(database, storageBackend)
+	registryService.Configure(cfg.Registry)
+	pathLayout, err := registry.NewPathLayout(cfg.Storage.PathLayout)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid storage path layout")
+	}
+	registryService.SetPathLayout(pathLayout)
+	registryService.SetMetrics(collector)
+	if cache != nil {
+		// Share OCI upload sessions so their chunks can reach any instance
+		registryService.SetUploadSessionCache(cache)
+	}
+
+	// Scan published artifacts in the background when a scanner is configured
+	var scanner scanning.Scanner
+	if cfg.Scanning.ScannerURL != "" {
+		scanner = scanning.NewTrivyScanner(cfg.Scanning.ScannerURL)
+	}
+	scanService := scanning.NewService(database.DB, storageBackend, scanner)
+	scanService.SetTimeout(cfg.Scanning.Timeout)
+	if err := scanService.SetPolicy(cfg.Scanning.Policy); err != nil {
+		log.Fatal().Err(err).Msg("Invalid vulnerability scan policy")
+	}
+	webhookService := webhooks.NewService(database.DB)
+	registryService.SetEventNotifier(registry.EventNotifiers{webhookService, scanService})
+	registryService.SetApprovalNotifier(webhookService)
+	registryService.SetDownloadPolicy(scanService)
+	auditLog := audit.NewService(database.DB)
+	authService.SetAuditLog(auditLog)
+	registryService.SetAuditLog(auditLog)
+	metadataService := metadata.NewService(database.DB, cfg)
 
 	// Initialize registry settings service for runtime control
 	registrySettingsService := registry.NewRegistrySettingsService(database.DB)
 
-	// Set up Gin router
+	// Apply retention policies in the background
+	retentionService := retention.NewService(database.DB, registryService)
+	retentionService.SetAuditLog(auditLog)
+	retention.NewWorker(retentionService, cfg.Registry.RetentionInterval).Start(ctx)
+
+	// Purge deleted artifacts once their grace period is over, checking at
+	// least hourly; without a grace period there is nothing to purge
+	registry.NewPurgeWorker(registryService, min(cfg.Registry.DeleteGracePeriod, time.Hour)).Start(ctx)
+
+	// Cross-check stored content against artifacts periodically
+	registry.NewReconcileWorker(registryService, cfg.Registry.ReconcileInterval, cfg.Registry.ReconcileDeleteOrphans).Start(ctx)
+
+	// Write batched download counts and events periodically
+	registry.NewDownloadFlushWorker(registryService, cfg.Registry.DownloadFlushInterval).Start(ctx)
+
+	// Set up Gin router. Forwarded headers, both the client addresses rate
+	// limits and audit entries use and the scheme and host URLs are built
+	// from, are only honored from trusted proxies.
+	trustedProxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
+	router.Use(middleware.ForwardedHeaders(trustedProxies))
 
-	// CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, X-API-Key")
+	// Tag each request, and every log entry written while handling it, with a request ID
+	router.Use(middleware.RequestID())
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+	// CORS middleware - preflights advertise the methods each route serves
+	router.Use(middleware.CORSMiddleware(router, cfg.CORS))
+
+	// Identify the client of each request so downloads can be throttled per client
+	router.Use(middleware.DownloadClientMiddleware())
+
+	// Identify the user of each request so restricted packages are only read by those allowed to
+	router.Use(middleware.PackageReaderMiddleware())
+
+	// Attribute audited writes to the client they came from
+	router.Use(middleware.AuditSourceMiddleware())
+
+	// Pass signatures supplied with uploads to the registry service for verification
+	router.Use(middleware.ArtifactSignatureMiddleware())
 
-		c.Next()
-	})
+	// Reject uploads that do not match the checksums supplied with them
+	router.Use(middleware.UploadChecksumMiddleware())
 
-	// Health check endpoint - support both GET and HEAD for Docker health checks
-	healthHandler := func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "healthy",
-			"service": "lodestone-api-gateway",
-		})
+	// Liveness and readiness probes; Redis is only checked when it was
+	// available at startup, since the service runs without it
+	healthChecks := []routes.HealthCheck{
+		routes.DatabaseHealthCheck(database),
+		routes.StorageHealthCheck(storageBackend),
+	}
+	if cache != nil {
+		healthChecks = append(healthChecks, routes.CacheHealthCheck(cache))
+	}
+	routes.HealthRoutes(router, healthChecks...)
+
+	// Prometheus metrics endpoint
+	if collector != nil {
+		router.GET(cfg.Metrics.Path, gin.WrapH(collector.Handler()))
 	}
-	router.GET("/health", healthHandler)
-	router.HEAD("/health", healthHandler)
 
 	// Swagger documentation endpoint
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Per-client rate limits, counted in Redis when it is available
+	var rateLimiter *middleware.RateLimiter
+	if cfg.RateLimit.Enabled {
+		if cache != nil {
+			rateLimiter = middleware.NewRateLimiter(cache)
+		} else {
+			log.Warn().Msg("Rate limiting enabled but Redis is unavailable, requests will not be limited")
+		}
+	}
+
+	apiRule := middleware.RateLimitRule{
+		Name:   "api",
+		Limit:  cfg.RateLimit.Requests,
+		Window: cfg.RateLimit.Window,
+	}
+	publishRule := middleware.RateLimitRule{
+		Name:    "publish",
+		Limit:   cfg.RateLimit.PublishRequests,
+		Window:  cfg.RateLimit.Window,
+		Methods: []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+	}
+	downloadRule := middleware.RateLimitRule{
+		Name:    "download",
+		Limit:   cfg.RateLimit.DownloadRequests,
+		Window:  cfg.RateLimit.Window,
+		Methods: []string{http.MethodGet, http.MethodHead},
+	}
+
+	// An OCI push is one publish however many blob upload requests it makes
+	ociPublishRule := publishRule
+	ociPublishRule.Match = routes.OCIPublishRequest
+
 	// API routes
 	api := router.Group("/api/v1")
+	api.Use(middleware.RateLimit(rateLimiter, apiRule))
 
 	// Add registry validation middleware to all package format routes
 	packageRoutes := api.Group("")
 	packageRoutes.Use(middleware.RegistryValidationMiddleware(registrySettingsService))
 
+	// Publishing is limited more strictly than downloading
+	packageRoutes.Use(middleware.RateLimit(rateLimiter, publishRule, downloadRule))
+
+	// Package management routes naming a registry are refused while it is
+	// disabled, and their writes while it is read-only
+	registryRoutes := api.Group("")
+	registryRoutes.Use(middleware.RegistryValidationMiddleware(registrySettingsService))
+
 	// Set up all package format routes with registry validation
 	routes.AuthRoutes(api, authService)
-	routes.AdminRoutes(api, registryService, authService) // Admin routes without registry validation
-	routes.PackageOwnershipRoutes(api, registryService, authService)
+	routes.AdminRoutes(api, registryService, metadataService, authService) // Admin routes without registry validation
+	routes.PackageOwnershipRoutes(registryRoutes, registryService, authService)
+	routes.PackageReadmeRoutes(registryRoutes, registryService, authService)
+	routes.PackageLabelRoutes(registryRoutes, registryService, authService)
+	routes.OrganizationRoutes(api, registryService, authService)
+	routes.PackageStatsRoutes(registryRoutes, registryService, metadataService, authService)
+	routes.VulnerabilityRoutes(registryRoutes, registryService, scanService, authService)
+	routes.SearchRoutes(api, metadataService, registryService, authService)
+	routes.ArtifactRoutes(registryRoutes, registryService, authService)
+	routes.BrowseRoutes(registryRoutes, registryService, authService)
+	routes.ApprovalRoutes(registryRoutes, registryService, authService)
 	routes.NuGetRoutes(packageRoutes, registryService, authService)
 	routes.NPMRoutes(packageRoutes, registryService, authService)
 	routes.MavenRoutes(packageRoutes, registryService, authService)
@@ -105,12 +251,14 @@ func main() {
 	routes.CargoRoutes(packageRoutes, registryService, authService)
 	routes.RubyGemsRoutes(packageRoutes, registryService, authService)
 	routes.OPARoutes(packageRoutes, registryService, authService)
+	routes.DebianRoutes(packageRoutes, registryService, authService)
+	routes.RPMRoutes(packageRoutes, registryService, authService)
 
 	// OCI/Docker registry routes - add both specific routes for Swagger and catch-all for compatibility
-	routes.OCIRoutes(api, registryService, authService)
+	routes.OCIRoutes(api.Group("", middleware.RateLimit(rateLimiter, ociPublishRule, downloadRule)), registryService, authService)
 
 	// OCI/Docker registry routes need to be at root level for Docker CLI compatibility
-	routes.OCIRootRoutes(router, registryService, authService)
+	routes.OCIRootRoutes(router.Group("", middleware.RateLimit(rateLimiter, apiRule, ociPublishRule, downloadRule)), registryService, authService)
 
 	// Start server
 	serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
@@ -119,9 +267,33 @@ func main() {
 		Str("host", cfg.Server.Host).
 		Int("port", cfg.Server.Port).
 		Str("address", serverAddr).
+		Str("version", version.Version).
+		Str("commit", version.Commit).
 		Msg("Starting Lodestone API Gateway")
 
-	if err := router.Run(serverAddr); err != nil {
+	listener, err := net.Listen("tcp", serverAddr)
+	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to start server")
 	}
+
+	// Only headers are read under a deadline; a whole-request read or write
+	// deadline would cut off large uploads and downloads
+	server := &http.Server{
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+
+	// In-flight requests are drained before the deferred closes of the
+	// database and cache run; storage backends hold nothing to close
+	if err := serve(ctx, server, listener, cfg.Server.ShutdownTimeout); err != nil {
+		log.Error().Err(err).Msg("Server did not shut down cleanly")
+	}
+
+	// Downloads batched since the last flush, including those of the drained
+	// requests, are written before the database closes
+	if err := registryService.FlushDownloads(context.Background()); err != nil {
+		log.Error().Err(err).Msg("Failed to flush downloads, counts since the last flush are lost")
+	}
+	log.Info().Msg("Lodestone API Gateway stopped")
 }
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// packageNameParams are the route parameters that name a package, in the
+// order they are looked for
+var packageNameParams = []string{"name", "package", "id", "crate", "chart"}
+
+// requestRegistryType returns the registry a request is for, from the route's
+// registry parameter or the first segment of its path, or "" if the request
+// is not for a registry
+func requestRegistryType(c *gin.Context) string {
+	if registryType := c.Param("registry"); utils.IsValidRegistryType(registryType) {
+		return registryType
+	}
+
+	path := strings.TrimPrefix(c.Request.URL.Path, "/api/v1")
+	segment, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if segment == "v2" {
+		return "oci"
+	}
+	if utils.IsValidRegistryType(segment) {
+		return segment
+	}
+	return ""
+}
+
+// requestPackageName returns the package named by the route's parameters, or
+// "" if the route does not name one
+func requestPackageName(c *gin.Context) string {
+	if scope := c.Param("scope"); scope != "" {
+		return "@" + scope + "/" + c.Param("name")
+	}
+	for _, param := range packageNameParams {
+		if name := c.Param(param); name != "" {
+			return strings.TrimPrefix(name, "/")
+		}
+	}
+	return ""
+}
+
+// apiKeyScopeAllows reports whether the API key's scopes permit the request.
+// Unscoped keys permit every request; scoped keys only those for a package
+// their scopes include, so they are refused on endpoints outside registries.
+func apiKeyScopeAllows(c *gin.Context, apiKey *types.APIKey) bool {
+	if apiKey == nil || len(apiKey.Scopes) == 0 {
+		return true
+	}
+	registryType := requestRegistryType(c)
+	if registryType == "" {
+		return false
+	}
+	return auth.APIKeyScopesAllow(apiKey.Scopes, registryType, requestPackageName(c))
+}
+
+// setAPIKeyUser authenticates the request as the API key's user, passing the
+// key's scopes on in the request context for services to check packages that
+// are only named in the request body
+func setAPIKeyUser(c *gin.Context, user *types.User, apiKey *types.APIKey) {
+	if apiKey != nil {
+		c.Request = c.Request.WithContext(auth.WithAPIKeyScopes(c.Request.Context(), apiKey.Scopes))
+	}
+	c.Set("user", user)
+}
+
+// admitAPIKey authenticates a request by a valid API key, responding 403 and
+// aborting if the request is outside the key's scopes. It reports whether the
+// request was admitted.
+func admitAPIKey(c *gin.Context, user *types.User, apiKey *types.APIKey) bool {
+	if !apiKeyScopeAllows(c, apiKey) {
+		Logger(c).Warn().
+			Str("path", c.Request.URL.Path).
+			Str("username", user.Username).
+			Strs("scopes", apiKey.Scopes).
+			Msg("API key used outside its scopes")
+		c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrAPIKeyScopeForbidden.Error()})
+		c.Abort()
+		return false
+	}
+	setAPIKeyUser(c, user, apiKey)
+	return true
+}
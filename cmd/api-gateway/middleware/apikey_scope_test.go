@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthMiddleware_ScopedAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &types.User{ID: uuid.New(), Username: "ci"}
+	mockAuth := new(MockAuthService)
+	mockAuth.On("ValidateToken", mock.Anything, mock.Anything).Return(nil, assert.AnError)
+	mockAuth.On("ValidateAPIKey", mock.Anything, "scoped-key").Return(user, &types.APIKey{UserID: user.ID, Scopes: []string{"npm:@myorg/*"}}, nil)
+	mockAuth.On("ValidateAPIKey", mock.Anything, "unscoped-key").Return(user, &types.APIKey{UserID: user.ID}, nil)
+
+	var scopeErr error
+	handler := func(c *gin.Context) {
+		// Services see the key's scopes for packages named in request bodies
+		scopeErr = auth.CheckAPIKeyScope(c.Request.Context(), "npm", "left-pad")
+		c.Status(http.StatusOK)
+	}
+	router := gin.New()
+	api := router.Group("/api/v1", authMiddlewareWithInterface(mockAuth))
+	api.PUT("/npm/:name", handler)
+	api.PUT("/npm/@:scope/:name", handler)
+	api.PUT("/nuget/v2/package", handler)
+	api.GET("/approvals", handler)
+	api.GET("/packages/:registry/:package/owners", handler)
+
+	serve := func(method, path, key, header string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if header == "Bearer" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		} else {
+			req.Header.Set(header, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, header := range []string{"X-API-Key", "X-NuGet-ApiKey", "Bearer"} {
+		assert.Equal(t, http.StatusOK, serve("PUT", "/api/v1/npm/@myorg/pkg", "scoped-key", header), header)
+		assert.ErrorIs(t, scopeErr, auth.ErrAPIKeyScopeForbidden)
+
+		assert.Equal(t, http.StatusForbidden, serve("PUT", "/api/v1/npm/left-pad", "scoped-key", header), header)
+		assert.Equal(t, http.StatusForbidden, serve("PUT", "/api/v1/npm/@other/pkg", "scoped-key", header), header)
+		assert.Equal(t, http.StatusForbidden, serve("PUT", "/api/v1/nuget/v2/package", "scoped-key", header), header)
+		assert.Equal(t, http.StatusForbidden, serve("GET", "/api/v1/approvals", "scoped-key", header), header)
+		assert.Equal(t, http.StatusForbidden, serve("GET", "/api/v1/packages/npm/left-pad/owners", "scoped-key", header), header)
+
+		// Unscoped keys keep access to everything
+		assert.Equal(t, http.StatusOK, serve("PUT", "/api/v1/npm/left-pad", "unscoped-key", header), header)
+		assert.NoError(t, scopeErr)
+		assert.Equal(t, http.StatusOK, serve("PUT", "/api/v1/nuget/v2/package", "unscoped-key", header), header)
+	}
+}
+
+func TestOptionalAuthMiddleware_ScopedAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	user := &types.User{ID: uuid.New(), Username: "ci"}
+	mockAuth := new(MockAuthService)
+	mockAuth.On("ValidateAPIKey", mock.Anything, "scoped-key").Return(user, &types.APIKey{UserID: user.ID, Scopes: []string{"npm:@myorg/*"}}, nil)
+
+	var authenticated bool
+	router := gin.New()
+	router.GET("/api/v1/npm/:name", optionalAuthMiddlewareWithInterface(mockAuth), func(c *gin.Context) {
+		_, authenticated = GetUserFromContext(c)
+		c.Status(http.StatusOK)
+	})
+
+	// A key outside its scopes is treated as no credentials
+	req := httptest.NewRequest("GET", "/api/v1/npm/left-pad", nil)
+	req.Header.Set("X-API-Key", "scoped-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, authenticated)
+}
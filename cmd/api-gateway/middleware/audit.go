@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/audit"
+)
+
+// AuditSourceMiddleware records the client IP address of each request in the
+// request context, where the audit trail attributes writes to it
+func AuditSourceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(audit.WithSourceIP(c.Request.Context(), c.ClientIP()))
+		c.Next()
+	}
+}
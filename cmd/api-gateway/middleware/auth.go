@@ -8,7 +8,6 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/pkg/types"
-	"github.com/rs/zerolog/log"
 )
 
 // AuthMiddleware validates JWT tokens and API keys
@@ -34,19 +33,20 @@ func authMiddlewareWithInterface(authService AuthServiceInterface) gin.HandlerFu
 					return
 				}
 
-				log.Debug().Err(err).Str("path", c.Request.URL.Path).Msg("JWT token validation failed, trying API key")
+				Logger(c).Debug().Err(err).Str("path", c.Request.URL.Path).Msg("JWT token validation failed, trying API key")
 
 				// Fall back to API key validation for Bearer tokens (Docker CLI compatibility)
 				ctx = context.WithValue(c.Request.Context(), "api_key", token)
-				user, _, err = authService.ValidateAPIKey(ctx, token)
+				user, key, err := authService.ValidateAPIKey(ctx, token)
 				if err == nil {
-					log.Debug().Str("username", user.Username).Msg("API key validation successful")
-					c.Set("user", user)
-					c.Next()
+					Logger(c).Debug().Str("username", user.Username).Msg("API key validation successful")
+					if admitAPIKey(c, user, key) {
+						c.Next()
+					}
 					return
 				}
 
-				log.Warn().Err(err).Str("path", c.Request.URL.Path).Msg("Both JWT and API key validation failed")
+				Logger(c).Warn().Err(err).Str("path", c.Request.URL.Path).Msg("Both JWT and API key validation failed")
 
 				// For OCI/Docker endpoints, return proper WWW-Authenticate header
 				if strings.HasPrefix(c.Request.URL.Path, "/v2/") {
@@ -57,56 +57,74 @@ func authMiddlewareWithInterface(authService AuthServiceInterface) gin.HandlerFu
 				c.Abort()
 				return
 			}
+
+			// Basic credentials carry an API key as the password (apt and similar clients)
+			if _, password, ok := c.Request.BasicAuth(); ok && password != "" {
+				Logger(c).Debug().Str("path", c.Request.URL.Path).Msg("Validating API key from basic auth")
+				ctx := context.WithValue(c.Request.Context(), "api_key", password)
+
+				user, key, err := authService.ValidateAPIKey(ctx, password)
+				if err == nil {
+					if admitAPIKey(c, user, key) {
+						c.Next()
+					}
+					return
+				}
+				Logger(c).Warn().Err(err).Msg("Basic auth API key validation failed")
+			}
 		}
 
 		// Check for API key in X-API-Key header
 		apiKey := c.GetHeader("X-API-Key")
 		if apiKey != "" {
-			log.Debug().Str("path", c.Request.URL.Path).Msg("Validating API key from header")
+			Logger(c).Debug().Str("path", c.Request.URL.Path).Msg("Validating API key from header")
 			ctx := context.WithValue(c.Request.Context(), "api_key", apiKey)
 
-			user, _, err := authService.ValidateAPIKey(ctx, apiKey)
+			user, key, err := authService.ValidateAPIKey(ctx, apiKey)
 			if err == nil {
-				log.Debug().Str("username", user.Username).Msg("API key validation successful")
-				c.Set("user", user)
-				c.Next()
+				Logger(c).Debug().Str("username", user.Username).Msg("API key validation successful")
+				if admitAPIKey(c, user, key) {
+					c.Next()
+				}
 				return
 			}
-			log.Warn().Err(err).Msg("API key validation failed")
+			Logger(c).Warn().Err(err).Msg("API key validation failed")
 		}
 
 		// Check for API key in X-NuGet-ApiKey header (NuGet specific)
 		nugetApiKey := c.GetHeader("X-NuGet-ApiKey")
 		if nugetApiKey != "" {
-			log.Debug().Str("path", c.Request.URL.Path).Msg("Validating NuGet API key from header")
+			Logger(c).Debug().Str("path", c.Request.URL.Path).Msg("Validating NuGet API key from header")
 			ctx := context.WithValue(c.Request.Context(), "api_key", nugetApiKey)
 
-			user, _, err := authService.ValidateAPIKey(ctx, nugetApiKey)
+			user, key, err := authService.ValidateAPIKey(ctx, nugetApiKey)
 			if err == nil {
-				log.Debug().Str("username", user.Username).Msg("NuGet API key validation successful")
-				c.Set("user", user)
-				c.Next()
+				Logger(c).Debug().Str("username", user.Username).Msg("NuGet API key validation successful")
+				if admitAPIKey(c, user, key) {
+					c.Next()
+				}
 				return
 			}
-			log.Warn().Err(err).Msg("NuGet API key validation failed")
+			Logger(c).Warn().Err(err).Msg("NuGet API key validation failed")
 		}
 
 		// Check for API key in query parameter (for some package managers)
 		if apiKey := c.Query("api_key"); apiKey != "" {
-			log.Debug().Str("path", c.Request.URL.Path).Msg("Validating API key from query parameter")
+			Logger(c).Debug().Str("path", c.Request.URL.Path).Msg("Validating API key from query parameter")
 			ctx := context.WithValue(c.Request.Context(), "api_key", apiKey)
 
-			user, _, err := authService.ValidateAPIKey(ctx, apiKey)
+			user, key, err := authService.ValidateAPIKey(ctx, apiKey)
 			if err == nil {
-				log.Debug().Str("username", user.Username).Msg("API key validation successful")
-				c.Set("user", user)
-				c.Next()
+				Logger(c).Debug().Str("username", user.Username).Msg("API key validation successful")
+				if admitAPIKey(c, user, key) {
+					c.Next()
+				}
 				return
 			}
-			log.Warn().Err(err).Msg("API key validation failed")
+			Logger(c).Warn().Err(err).Msg("API key validation failed")
 		}
 
-		log.Warn().
+		Logger(c).Warn().
 			Str("path", c.Request.URL.Path).
 			Str("client_ip", c.ClientIP()).
 			Msg("Unauthorized access attempt")
@@ -121,6 +139,50 @@ func authMiddlewareWithInterface(authService AuthServiceInterface) gin.HandlerFu
 	}
 }
 
+// registryAccessKey is the context key of the access granted by a registry token
+const registryAccessKey = "registry_access"
+
+// OCIAuthMiddleware authenticates OCI registry requests. Scoped bearer tokens
+// from the registry token endpoint are accepted here, and only here, with
+// their grants stored for the handler to enforce; other credentials are
+// handled as by AuthMiddleware.
+func OCIAuthMiddleware(authService *auth.Service) gin.HandlerFunc {
+	return ociAuthMiddlewareWithInterface(authService)
+}
+
+// ociAuthMiddlewareWithInterface is the testable version that accepts an interface
+func ociAuthMiddlewareWithInterface(authService RegistryAuthServiceInterface) gin.HandlerFunc {
+	fallback := authMiddlewareWithInterface(authService)
+	return func(c *gin.Context) {
+		if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			user, access, scopes, err := authService.ValidateRegistryToken(c.Request.Context(), token)
+			if err == nil {
+				// The scopes of the API key the token was issued for still apply
+				c.Request = c.Request.WithContext(auth.WithAPIKeyScopes(c.Request.Context(), scopes))
+				c.Set("user", user)
+				c.Set(registryAccessKey, access)
+				c.Next()
+				return
+			}
+			Logger(c).Debug().Err(err).Str("path", c.Request.URL.Path).Msg("Registry token validation failed, trying other credentials")
+		}
+
+		fallback(c)
+	}
+}
+
+// RegistryAccess returns the grants of the registry token that authenticated
+// the request. scoped is false when the request was authenticated by
+// credentials that are not limited to scopes, such as an API key.
+func RegistryAccess(c *gin.Context) (access []auth.RegistryAccess, scoped bool) {
+	value, exists := c.Get(registryAccessKey)
+	if !exists {
+		return nil, false
+	}
+	access, _ = value.([]auth.RegistryAccess)
+	return access, true
+}
+
 // OptionalAuthMiddleware allows both authenticated and anonymous access
 func OptionalAuthMiddleware(authService *auth.Service) gin.HandlerFunc {
 	return optionalAuthMiddlewareWithInterface(authService)
@@ -141,28 +203,28 @@ func optionalAuthMiddlewareWithInterface(authService AuthServiceInterface) gin.H
 			} else {
 				// Fall back to API key validation for Bearer tokens (Docker CLI compatibility)
 				ctx := context.WithValue(c.Request.Context(), "api_key", token)
-				if user, _, err := authService.ValidateAPIKey(ctx, token); err == nil {
-					c.Set("user", user)
+				if user, key, err := authService.ValidateAPIKey(ctx, token); err == nil && apiKeyScopeAllows(c, key) {
+					setAPIKeyUser(c, user, key)
 				}
 			}
 			// For optional auth, we continue even if JWT validation fails
 		} else if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
 			ctx := context.WithValue(c.Request.Context(), "api_key", apiKey)
 
-			if user, _, err := authService.ValidateAPIKey(ctx, apiKey); err == nil {
-				c.Set("user", user)
+			if user, key, err := authService.ValidateAPIKey(ctx, apiKey); err == nil && apiKeyScopeAllows(c, key) {
+				setAPIKeyUser(c, user, key)
 			}
 		} else if apiKey := c.GetHeader("X-NuGet-ApiKey"); apiKey != "" {
 			ctx := context.WithValue(c.Request.Context(), "api_key", apiKey)
 
-			if user, _, err := authService.ValidateAPIKey(ctx, apiKey); err == nil {
-				c.Set("user", user)
+			if user, key, err := authService.ValidateAPIKey(ctx, apiKey); err == nil && apiKeyScopeAllows(c, key) {
+				setAPIKeyUser(c, user, key)
 			}
 		} else if apiKey := c.Query("api_key"); apiKey != "" {
 			ctx := context.WithValue(c.Request.Context(), "api_key", apiKey)
 
-			if user, _, err := authService.ValidateAPIKey(ctx, apiKey); err == nil {
-				c.Set("user", user)
+			if user, key, err := authService.ValidateAPIKey(ctx, apiKey); err == nil && apiKeyScopeAllows(c, key) {
+				setAPIKeyUser(c, user, key)
 			}
 		}
 
@@ -9,6 +9,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -42,6 +43,15 @@ func (m *MockAuthService) ValidateAPIKey(ctx context.Context, apiKey string) (*t
 	return user, key, args.Error(2)
 }
 
+func (m *MockAuthService) ValidateRegistryToken(ctx context.Context, token string) (*types.User, []auth.RegistryAccess, []string, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, nil, nil, args.Error(3)
+	}
+	scopes, _ := args.Get(2).([]string)
+	return args.Get(0).(*types.User), args.Get(1).([]auth.RegistryAccess), scopes, args.Error(3)
+}
+
 func TestAuthMiddleware_ValidBearerToken(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -189,6 +199,53 @@ func TestAuthMiddleware_ValidAPIKeyQuery(t *testing.T) {
 	mockAuth.AssertExpectations(t)
 }
 
+func TestAuthMiddleware_BasicAuthAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAuth := new(MockAuthService)
+	user := &types.User{
+		ID:       uuid.New(),
+		Username: "testuser",
+		Email:    "test@example.com",
+	}
+	apiKey := &types.APIKey{
+		ID:     uuid.New(),
+		UserID: user.ID,
+		Name:   "apt-key",
+	}
+
+	mockAuth.On("ValidateAPIKey", mock.Anything, "valid-api-key").Return(user, apiKey, nil)
+	mockAuth.On("ValidateAPIKey", mock.Anything, "wrong-key").Return(nil, nil, errors.New("invalid API key"))
+
+	var capturedUser *types.User
+
+	router := gin.New()
+	router.Use(authMiddlewareWithInterface(mockAuth))
+	router.GET("/test", func(c *gin.Context) {
+		userFromContext, exists := c.Get("user")
+		if exists {
+			capturedUser = userFromContext.(*types.User)
+		}
+		c.JSON(200, gin.H{"status": "success"})
+	})
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.SetBasicAuth("testuser", "valid-api-key")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, user, capturedUser)
+
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.SetBasicAuth("testuser", "wrong-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	mockAuth.AssertExpectations(t)
+}
+
 func TestAuthMiddleware_NoAuth(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -341,3 +398,45 @@ func TestGetUserFromContext_WrongType(t *testing.T) {
 	assert.False(t, exists)
 	assert.Nil(t, contextUser)
 }
+
+func TestOCIAuthMiddleware_RegistryToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockAuth := new(MockAuthService)
+	user := &types.User{ID: uuid.New(), Username: "testuser"}
+	access := []auth.RegistryAccess{{Type: "repository", Name: "myorg/app", Actions: []string{"pull"}}}
+
+	mockAuth.On("ValidateRegistryToken", mock.Anything, "registry-token").Return(user, access, nil, nil)
+	mockAuth.On("ValidateRegistryToken", mock.Anything, "api-key").Return(nil, nil, nil, errors.New("invalid registry token"))
+	mockAuth.On("ValidateToken", mock.Anything, "api-key").Return(nil, errors.New("invalid token"))
+	mockAuth.On("ValidateAPIKey", mock.Anything, "api-key").Return(user, &types.APIKey{}, nil)
+
+	var capturedAccess []auth.RegistryAccess
+	var capturedScoped bool
+
+	router := gin.New()
+	router.Use(ociAuthMiddlewareWithInterface(mockAuth))
+	router.GET("/v2/myorg/app/tags/list", func(c *gin.Context) {
+		capturedAccess, capturedScoped = RegistryAccess(c)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("GET", "/v2/myorg/app/tags/list", nil)
+	req.Header.Set("Authorization", "Bearer registry-token")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, capturedScoped)
+	assert.Equal(t, access, capturedAccess)
+
+	// Other bearer credentials fall back to the standard checks and are not scoped
+	req = httptest.NewRequest("GET", "/v2/myorg/app/tags/list", nil)
+	req.Header.Set("Authorization", "Bearer api-key")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, capturedScoped)
+	mockAuth.AssertExpectations(t)
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/pkg/checksum"
+)
+
+// Checksum headers clients may send with uploads
+const (
+	// ContentDigestHeader carries digests of the request body (RFC 9530)
+	ContentDigestHeader = "Content-Digest"
+
+	// ChecksumSHA256Header carries the hex-encoded SHA256 of the uploaded
+	// artifact, as Artifactory clients send it
+	ChecksumSHA256Header = "X-Checksum-Sha256"
+)
+
+// UploadChecksumMiddleware verifies the checksums supplied with uploads. A
+// Content-Digest is checked against the request body as it is read, so
+// reading a corrupted body to the end fails with checksum.ErrMismatch. An
+// X-Checksum-Sha256 is recorded in the request context, where the registry
+// service checks it against the artifact. Requests without either header are
+// not checked.
+func UploadChecksumMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method != http.MethodPost && method != http.MethodPut && method != http.MethodPatch {
+			c.Next()
+			return
+		}
+
+		if header := c.GetHeader(ContentDigestHeader); header != "" && c.Request.Body != nil {
+			digest, ok, err := checksum.ParseContentDigest(header)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			if ok {
+				c.Request.Body = checksum.NewVerifyingReader(c.Request.Body, digest)
+			}
+		}
+
+		if header := c.GetHeader(ChecksumSHA256Header); header != "" {
+			sum, err := checksum.ParseSHA256(header)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid " + ChecksumSHA256Header + " header: " + err.Error()})
+				return
+			}
+			c.Request = c.Request.WithContext(checksum.WithExpectedSHA256(c.Request.Context(), sum))
+		}
+		c.Next()
+	}
+}
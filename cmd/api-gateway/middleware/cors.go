@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/rs/zerolog/log"
+)
+
+// methodOrder is the order methods are advertised in
+var methodOrder = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// routePattern is a registered route path split into segments
+type routePattern struct {
+	segments []string
+	method   string
+}
+
+// matches reports whether the path segments match the route, treating :param
+// as any single segment and *param as the remainder of the path
+func (r routePattern) matches(segments []string) bool {
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if !strings.HasPrefix(segment, ":") && segment != segments[i] {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") && segments[i] == "" {
+			return false
+		}
+	}
+	return len(r.segments) == len(segments)
+}
+
+// splitPath splits a URL path into its segments
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// corsPolicy is the parsed form of a CORS configuration
+type corsPolicy struct {
+	anyOrigin        bool
+	origins          map[string]bool
+	subdomains       []subdomainPattern
+	methods          map[string]bool
+	anyHeader        bool
+	headers          map[string]bool
+	defaultHeaders   string
+	allowCredentials bool
+}
+
+// subdomainPattern matches the origins of any subdomain of a host, from a
+// pattern such as "https://*.example.com"
+type subdomainPattern struct {
+	scheme string // "https://"
+	suffix string // ".example.com", with any port
+}
+
+// matches reports whether an origin is a subdomain matched by the pattern
+func (p subdomainPattern) matches(origin string) bool {
+	rest, ok := strings.CutPrefix(origin, p.scheme)
+	if !ok {
+		return false
+	}
+	label, ok := strings.CutSuffix(rest, p.suffix)
+	return ok && label != "" && !strings.ContainsAny(label, "/:@")
+}
+
+// newCORSPolicy parses a CORS configuration. Origins and headers are matched
+// case-insensitively.
+func newCORSPolicy(cfg config.CORSConfig) *corsPolicy {
+	policy := &corsPolicy{
+		origins:          make(map[string]bool),
+		headers:          make(map[string]bool),
+		defaultHeaders:   strings.Join(cfg.AllowedHeaders, ", "),
+		allowCredentials: cfg.AllowCredentials,
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		if origin == "*" {
+			policy.anyOrigin = true
+		} else if scheme, suffix, ok := strings.Cut(origin, "://*."); ok {
+			policy.subdomains = append(policy.subdomains, subdomainPattern{scheme: scheme + "://", suffix: "." + suffix})
+		} else if origin != "" {
+			policy.origins[origin] = true
+		}
+	}
+	if policy.anyOrigin && policy.allowCredentials {
+		// Credentialed requests are never allowed from any origin at all
+		log.Warn().Msg("CORS credentials are not allowed with the \"*\" origin; allowing credentials only from the listed origins")
+	}
+
+	if len(cfg.AllowedMethods) > 0 {
+		policy.methods = make(map[string]bool)
+		for _, method := range cfg.AllowedMethods {
+			policy.methods[strings.ToUpper(strings.TrimSpace(method))] = true
+		}
+	}
+
+	for _, header := range cfg.AllowedHeaders {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header == "*" {
+			policy.anyHeader = true
+		} else if header != "" {
+			policy.headers[header] = true
+		}
+	}
+	return policy
+}
+
+// listed reports whether an origin is allowed by name or subdomain pattern
+func (p *corsPolicy) listed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.subdomains {
+		if pattern.matches(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// setOriginHeaders sets the headers allowing a request from an origin, and
+// reports whether the origin is allowed
+func (p *corsPolicy) setOriginHeaders(c *gin.Context, origin string) bool {
+	c.Header("Vary", "Origin")
+	switch {
+	case p.listed(origin):
+		c.Header("Access-Control-Allow-Origin", origin)
+		if p.allowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+	case p.anyOrigin:
+		c.Header("Access-Control-Allow-Origin", "*")
+	default:
+		return false
+	}
+	return true
+}
+
+// allowedMethods filters the methods a route serves to those allowed
+// cross-origin
+func (p *corsPolicy) allowedMethods(methods []string) string {
+	if p.methods == nil {
+		return strings.Join(methods, ", ")
+	}
+	allowed := make([]string, 0, len(methods))
+	for _, method := range methods {
+		if p.methods[method] {
+			allowed = append(allowed, method)
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// allowedHeaders returns the headers a preflight asked for that are allowed,
+// or the allowed headers if it asked for none
+func (p *corsPolicy) allowedHeaders(requested string) string {
+	if requested == "" {
+		return p.defaultHeaders
+	}
+	var allowed []string
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && (p.anyHeader || p.headers[strings.ToLower(header)]) {
+			allowed = append(allowed, header)
+		}
+	}
+	return strings.Join(allowed, ", ")
+}
+
+// CORSMiddleware handles cross-origin requests from the configured origins.
+// Listed origins, exact or matched by subdomain, are echoed back and may send
+// credentials if configured; other origins are only allowed by "*", without
+// credentials. Preflight requests are answered with the methods the router
+// actually serves for the requested path and an Access-Control-Max-Age so
+// browsers can cache the answer; paths with no routes get 404 and origins
+// that are not allowed get 403. The route table is read from the engine on
+// first use, so the middleware can be installed before routes are registered.
+func CORSMiddleware(engine *gin.Engine, cfg config.CORSConfig) gin.HandlerFunc {
+	var (
+		once   sync.Once
+		routes []routePattern
+	)
+	policy := newCORSPolicy(cfg)
+
+	routeMethods := func(path string) []string {
+		once.Do(func() {
+			for _, route := range engine.Routes() {
+				routes = append(routes, routePattern{segments: splitPath(route.Path), method: route.Method})
+			}
+		})
+
+		segments := splitPath(path)
+		allowed := make(map[string]bool)
+		for _, route := range routes {
+			if route.matches(segments) {
+				allowed[route.method] = true
+			}
+		}
+		if len(allowed) == 0 {
+			return nil
+		}
+
+		methods := make([]string, 0, len(methodOrder))
+		for _, method := range methodOrder {
+			if allowed[method] || method == http.MethodOptions {
+				methods = append(methods, method)
+			}
+		}
+		return methods
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		originAllowed := origin != "" && policy.setOriginHeaders(c, origin)
+
+		if c.Request.Method != http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		methods := routeMethods(c.Request.URL.Path)
+		if methods == nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		c.Header("Allow", strings.Join(methods, ", "))
+
+		// A preflight names the method and headers of the request it precedes
+		if origin != "" && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+			if !originAllowed {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+
+			c.Header("Access-Control-Allow-Methods", policy.allowedMethods(methods))
+			if headers := policy.allowedHeaders(c.GetHeader("Access-Control-Request-Headers")); headers != "" {
+				c.Header("Access-Control-Allow-Headers", headers)
+			}
+
+			if cfg.MaxAge > 0 {
+				c.Header("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+		}
+
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCORSHeaders are the request headers allowed cross-origin in tests
+var testCORSHeaders = []string{"Origin", "Content-Type", "Authorization", "X-API-Key"}
+
+func setupCORSRouter(maxAge time.Duration) *gin.Engine {
+	return setupCORSRouterWithConfig(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: testCORSHeaders, MaxAge: maxAge})
+}
+
+func setupCORSRouterWithConfig(cfg config.CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	handler := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	router := gin.New()
+	router.Use(CORSMiddleware(router, cfg))
+	router.GET("/api/v1/npm/:package", handler)
+	router.PUT("/api/v1/npm/:package", handler)
+	router.DELETE("/api/v1/npm/:package/-rev/:rev", handler)
+	router.GET("/api/v1/search", handler)
+	router.Any("/v2/*path", handler)
+	return router
+}
+
+func preflight(router *gin.Engine, path, method, headers string) *httptest.ResponseRecorder {
+	return preflightFrom(router, "https://ui.example.com", path, method, headers)
+}
+
+func preflightFrom(router *gin.Engine, origin, path, method, headers string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodOptions, path, nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSMiddleware_PreflightAdvertisesRouteMethods(t *testing.T) {
+	router := setupCORSRouter(10 * time.Minute)
+
+	tests := []struct {
+		name    string
+		path    string
+		methods string
+	}{
+		{"parameterised route", "/api/v1/npm/lodash", "GET, PUT, OPTIONS"},
+		{"nested route", "/api/v1/npm/lodash/-rev/1", "DELETE, OPTIONS"},
+		{"static route", "/api/v1/search", "GET, OPTIONS"},
+		{"catch-all route", "/v2/library/alpine/manifests/latest", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := preflight(router, tt.path, http.MethodGet, "")
+
+			assert.Equal(t, http.StatusNoContent, w.Code)
+			assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.methods, w.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, tt.methods, w.Header().Get("Allow"))
+		})
+	}
+}
+
+func TestCORSMiddleware_PreflightMaxAge(t *testing.T) {
+	w := preflight(setupCORSRouter(10*time.Minute), "/api/v1/search", http.MethodGet, "")
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, w.Header().Get("Vary"), "Access-Control-Request-Method")
+
+	w = preflight(setupCORSRouter(0), "/api/v1/search", http.MethodGet, "")
+	assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSMiddleware_PreflightHeaders(t *testing.T) {
+	router := setupCORSRouter(time.Minute)
+
+	// Only the requested headers that are allowed are echoed
+	w := preflight(router, "/api/v1/npm/lodash", http.MethodPut, "authorization, content-type, npm-otp")
+	assert.Equal(t, "authorization, content-type", w.Header().Get("Access-Control-Allow-Headers"))
+
+	w = preflight(router, "/api/v1/npm/lodash", http.MethodPut, "")
+	assert.Equal(t, "Origin, Content-Type, Authorization, X-API-Key", w.Header().Get("Access-Control-Allow-Headers"))
+
+	w = preflight(router, "/api/v1/npm/lodash", http.MethodPut, "npm-otp")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Headers"))
+
+	router = setupCORSRouterWithConfig(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}})
+	w = preflight(router, "/api/v1/npm/lodash", http.MethodPut, "authorization, npm-otp")
+	assert.Equal(t, "authorization, npm-otp", w.Header().Get("Access-Control-Allow-Headers"))
+}
+
+func TestCORSMiddleware_UnknownPath(t *testing.T) {
+	w := preflight(setupCORSRouter(time.Minute), "/api/v1/unknown", http.MethodGet, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func TestCORSMiddleware_SimpleRequest(t *testing.T) {
+	router := setupCORSRouter(time.Minute)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/search", nil)
+	req.Header.Set("Origin", "https://ui.example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Empty(t, w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSMiddleware_AllowedOrigins(t *testing.T) {
+	router := setupCORSRouterWithConfig(config.CORSConfig{
+		AllowedOrigins:   []string{"https://ui.example.com", "https://*.corp.example.com"},
+		AllowedHeaders:   testCORSHeaders,
+		AllowCredentials: true,
+	})
+
+	get := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/search", nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("allowed origins are echoed with credentials", func(t *testing.T) {
+		for _, origin := range []string{"https://ui.example.com", "https://builds.corp.example.com", "https://a.b.corp.example.com"} {
+			w := get(origin)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"), origin)
+			assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"), origin)
+			assert.Equal(t, "Origin", w.Header().Get("Vary"))
+		}
+	})
+
+	t.Run("other origins get no CORS headers", func(t *testing.T) {
+		for _, origin := range []string{
+			"https://evil.example.com",
+			"http://ui.example.com",
+			"https://corp.example.com",
+			"https://evil.com/.corp.example.com",
+			"https://ui.example.com.evil.com",
+		} {
+			w := get(origin)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), origin)
+			assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"), origin)
+		}
+	})
+
+	t.Run("preflight from an allowed origin", func(t *testing.T) {
+		w := preflightFrom(router, "https://builds.corp.example.com", "/api/v1/npm/lodash", http.MethodPut, "Authorization, X-Custom")
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://builds.corp.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "Authorization", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "GET, PUT, OPTIONS", w.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("preflight from a disallowed origin", func(t *testing.T) {
+		w := preflightFrom(router, "https://evil.example.com", "/api/v1/npm/lodash", http.MethodPut, "Authorization")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Headers"))
+	})
+}
+
+func TestCORSMiddleware_NoCredentialsWithWildcard(t *testing.T) {
+	router := setupCORSRouterWithConfig(config.CORSConfig{
+		AllowedOrigins:   []string{"*", "https://ui.example.com"},
+		AllowCredentials: true,
+	})
+
+	w := preflightFrom(router, "https://other.example.com", "/api/v1/search", http.MethodGet, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	// Listed origins may still send credentials
+	w = preflightFrom(router, "https://ui.example.com", "/api/v1/search", http.MethodGet, "")
+	assert.Equal(t, "https://ui.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+}
+
+func TestCORSMiddleware_AllowedMethods(t *testing.T) {
+	router := setupCORSRouterWithConfig(config.CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"get", "HEAD"}})
+
+	w := preflight(router, "/api/v1/npm/lodash", http.MethodGet, "")
+	assert.Equal(t, "GET", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "GET, PUT, OPTIONS", w.Header().Get("Allow"))
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 
+	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/pkg/types"
 )
 
@@ -11,3 +12,9 @@ type AuthServiceInterface interface {
 	ValidateToken(ctx context.Context, token string) (*types.User, error)
 	ValidateAPIKey(ctx context.Context, apiKey string) (*types.User, *types.APIKey, error)
 }
+
+// RegistryAuthServiceInterface adds validation of scoped registry bearer tokens
+type RegistryAuthServiceInterface interface {
+	AuthServiceInterface
+	ValidateRegistryToken(ctx context.Context, token string) (*types.User, []auth.RegistryAccess, []string, error)
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validForwardedHost limits hosts taken from X-Forwarded-Host to a host name
+// or IP address with an optional port
+var validForwardedHost = regexp.MustCompile(`^(\[[0-9A-Fa-f:.]+\]|[A-Za-z0-9.-]+)(:[0-9]{1,5})?$`)
+
+type baseURLKey struct{}
+
+// ParseTrustedProxies parses the addresses and CIDR ranges of reverse
+// proxies, as configured in TRUSTED_PROXIES. A bare address trusts that
+// address alone.
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// ForwardedHeaders derives the base URL clients reach the gateway at, which
+// URLs in responses are built from. The X-Forwarded-Proto and
+// X-Forwarded-Host headers are only honored on requests from trusted
+// proxies, since any client can send them; otherwise the scheme and host of
+// the connection itself are used.
+func ForwardedHeaders(trusted []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		baseURL := connectionBaseURL(c)
+		if isTrustedProxy(c.RemoteIP(), trusted) {
+			baseURL = forwardedBaseURL(c)
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), baseURLKey{}, baseURL))
+		c.Next()
+	}
+}
+
+// BaseURL returns the scheme and host clients reach the gateway at, such as
+// https://registry.example.com, without a trailing slash. Requests that did
+// not pass through ForwardedHeaders get the scheme and host of their
+// connection.
+func BaseURL(c *gin.Context) string {
+	if baseURL, ok := c.Request.Context().Value(baseURLKey{}).(string); ok {
+		return baseURL
+	}
+	return connectionBaseURL(c)
+}
+
+// connectionBaseURL returns the base URL of the connection a request arrived
+// on, ignoring forwarded headers
+func connectionBaseURL(c *gin.Context) string {
+	return connectionScheme(c) + "://" + c.Request.Host
+}
+
+// connectionScheme returns the scheme of the connection a request arrived on
+func connectionScheme(c *gin.Context) string {
+	if c.Request.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// forwardedBaseURL returns the base URL a trusted proxy reports the client
+// requested, falling back to the connection's scheme or host for headers
+// that are missing or invalid
+func forwardedBaseURL(c *gin.Context) string {
+	scheme := connectionScheme(c)
+	if proto := strings.ToLower(lastHeaderValue(c.GetHeader("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	host := c.Request.Host
+	if forwarded := lastHeaderValue(c.GetHeader("X-Forwarded-Host")); validForwardedHost.MatchString(forwarded) {
+		host = forwarded
+	}
+	return scheme + "://" + host
+}
+
+// lastHeaderValue returns the last of the comma-separated values of a
+// forwarded header, the one appended by the trusted proxy the request came
+// from. Earlier values were passed on from the client or proxies in front of
+// it, and may have been made up by the client.
+func lastHeaderValue(value string) string {
+	if idx := strings.LastIndex(value, ","); idx != -1 {
+		value = value[idx+1:]
+	}
+	return strings.TrimSpace(value)
+}
+
+// isTrustedProxy reports whether a remote address is a trusted proxy
+func isTrustedProxy(remoteIP string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+	for _, network := range trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
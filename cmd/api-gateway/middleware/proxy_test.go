@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	networks, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::1", "fd00::/8"})
+	require.NoError(t, err)
+	require.Len(t, networks, 4)
+	assert.Equal(t, "192.0.2.1/32", networks[1].String())
+	assert.Equal(t, "2001:db8::1/128", networks[2].String())
+
+	for _, invalid := range []string{"proxy.internal", "10.0.0.0/33", ""} {
+		_, err := ParseTrustedProxies([]string{invalid})
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	router := gin.New()
+	router.Use(ForwardedHeaders(trusted))
+	router.GET("/base", func(c *gin.Context) {
+		c.String(http.StatusOK, BaseURL(c))
+	})
+
+	baseURL := func(remoteAddr string, tlsConn bool, headers map[string]string) string {
+		req := httptest.NewRequest("GET", "http://registry.internal:8080/base", nil)
+		req.RemoteAddr = remoteAddr
+		if tlsConn {
+			req.TLS = &tls.ConnectionState{}
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+	forwarded := map[string]string{
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "registry.example.com",
+	}
+
+	t.Run("trusted proxy", func(t *testing.T) {
+		assert.Equal(t, "https://registry.example.com", baseURL("10.1.2.3:4567", false, forwarded))
+
+		// The values appended by the trusted proxy are used, not those the
+		// client sent ahead of them
+		assert.Equal(t, "https://registry.example.com", baseURL("10.1.2.3:4567", false, map[string]string{
+			"X-Forwarded-Proto": "http, https",
+			"X-Forwarded-Host":  "evil.example.com, registry.example.com",
+		}))
+
+		// Missing or invalid headers fall back to the connection
+		assert.Equal(t, "http://registry.internal:8080", baseURL("10.1.2.3:4567", false, nil))
+		assert.Equal(t, "https://registry.internal:8080", baseURL("10.1.2.3:4567", true, map[string]string{
+			"X-Forwarded-Proto": "javascript",
+			"X-Forwarded-Host":  "evil.example.com/phish?",
+		}))
+	})
+
+	t.Run("untrusted client", func(t *testing.T) {
+		assert.Equal(t, "http://registry.internal:8080", baseURL("203.0.113.7:4567", false, forwarded))
+		assert.Equal(t, "https://registry.internal:8080", baseURL("203.0.113.7:4567", true, forwarded))
+	})
+
+	t.Run("no trusted proxies", func(t *testing.T) {
+		router := gin.New()
+		router.Use(ForwardedHeaders(nil))
+		router.GET("/base", func(c *gin.Context) {
+			c.String(http.StatusOK, BaseURL(c))
+		})
+		req := httptest.NewRequest("GET", "http://registry.internal/base", nil)
+		req.RemoteAddr = "10.1.2.3:4567"
+		req.Header.Set("X-Forwarded-Proto", "https")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, "http://registry.internal", w.Body.String())
+	})
+}
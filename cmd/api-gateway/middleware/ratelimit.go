@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// rateLimitClientKey is the context key of the client a request is counted
+// for, so it is identified once however many limits apply
+const rateLimitClientKey = "rate_limit_client"
+
+// storeWarningInterval bounds how often an unavailable store is logged, since
+// every request would otherwise log it
+const storeWarningInterval = time.Minute
+
+// RateLimitStore holds request counters shared by every gateway instance. It
+// is implemented by common.Cache.
+type RateLimitStore interface {
+	// Increment adds one to a counter that expires after expiration, returning the new count
+	Increment(ctx context.Context, key string, expiration time.Duration) (int64, error)
+
+	// GetInt returns a counter, or 0 if it does not exist
+	GetInt(ctx context.Context, key string) (int64, error)
+}
+
+// RateLimitRule limits how many requests of one kind a client may make
+type RateLimitRule struct {
+	Name    string                    // distinguishes the counters of different rules
+	Limit   int                       // requests allowed per window, 0 for unlimited
+	Window  time.Duration             // length of the sliding window
+	Methods []string                  // request methods the rule applies to, all when empty
+	Match   func(c *gin.Context) bool // further narrows the requests the rule applies to, all when nil
+}
+
+// applies reports whether the rule limits a request
+func (r RateLimitRule) applies(c *gin.Context) bool {
+	return r.Limit > 0 && r.Window > 0 &&
+		(len(r.Methods) == 0 || slices.Contains(r.Methods, c.Request.Method)) &&
+		(r.Match == nil || r.Match(c))
+}
+
+// RateLimiter counts requests per client in a sliding window approximated
+// from the counts of the current and previous fixed windows
+type RateLimiter struct {
+	store RateLimitStore
+	now   func() time.Time
+
+	mu          sync.Mutex
+	lastWarning time.Time
+}
+
+// NewRateLimiter creates a limiter keeping its counters in store. With a nil
+// store every request is allowed.
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	return &RateLimiter{store: store, now: time.Now}
+}
+
+// RateLimit rejects requests from clients that exceed any of the rules that
+// apply to them with 429 Too Many Requests and a Retry-After header. Clients
+// are identified by the credentials they present, or otherwise by IP
+// address. Requests presenting credentials that do not end up authenticated,
+// whether refused or served anonymously, are also counted against their IP
+// address, and requests presenting credentials are refused while that count
+// is over the limit, so making up new credentials does not earn a new limit.
+// If the store is unavailable requests are allowed.
+func RateLimit(limiter *RateLimiter, rules ...RateLimitRule) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || limiter.store == nil {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		var client string
+		var applied []RateLimitRule
+		for _, rule := range rules {
+			if !rule.applies(c) {
+				continue
+			}
+			if client == "" {
+				client = limiter.client(c)
+			}
+			applied = append(applied, rule)
+
+			allowed, retryAfter, err := limiter.allow(ctx, rule, client, true)
+			if err == nil && allowed && credentialed(client) {
+				allowed, retryAfter, err = limiter.allow(ctx, rule, refusedClient(c), false)
+			}
+			if err != nil {
+				limiter.warnUnavailable(err)
+				continue
+			}
+			if !allowed {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+				return
+			}
+		}
+		c.Next()
+
+		if !credentialed(client) {
+			return
+		}
+		if _, ok := GetUserFromContext(c); ok {
+			return
+		}
+		now := limiter.now()
+		for _, rule := range applied {
+			if _, err := limiter.store.Increment(ctx, windowKey(rule, refusedClient(c), now, 0), 2*rule.Window); err != nil {
+				limiter.warnUnavailable(err)
+				return
+			}
+		}
+	}
+}
+
+// windowKey returns the key of the counter of client's requests against rule
+// in the window offset windows from the one containing now
+func windowKey(rule RateLimitRule, client string, now time.Time, offset int64) string {
+	index := now.UnixNano()/int64(rule.Window) + offset
+	return fmt.Sprintf("ratelimit:%s:%s:%d", rule.Name, client, index)
+}
+
+// allow reports whether a request from client is within the limit of rule
+// and, if not, how long until it would be. With count the request is counted
+// against client; otherwise its counters are only read.
+func (l *RateLimiter) allow(ctx context.Context, rule RateLimitRule, client string, count bool) (bool, time.Duration, error) {
+	now := l.now()
+	elapsed := time.Duration(now.UnixNano() % int64(rule.Window))
+
+	var current int64
+	var err error
+	if count {
+		current, err = l.store.Increment(ctx, windowKey(rule, client, now, 0), 2*rule.Window)
+	} else {
+		current, err = l.store.GetInt(ctx, windowKey(rule, client, now, 0))
+		current++
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	previous, err := l.store.GetInt(ctx, windowKey(rule, client, now, -1))
+	if err != nil {
+		return false, 0, err
+	}
+
+	// The previous window counts for the part of it still inside the sliding window
+	remaining := 1 - float64(elapsed)/float64(rule.Window)
+	limit := float64(rule.Limit)
+	if float64(previous)*remaining+float64(current) <= limit {
+		return true, 0, nil
+	}
+
+	// Wait for the previous window's share to decay enough, or failing that
+	// for the current window to become the previous one
+	retryAfter := rule.Window - elapsed
+	if previous > 0 && float64(current) <= limit {
+		decayed := time.Duration(float64(rule.Window)*(1-(limit-float64(current))/float64(previous))) - elapsed
+		if decayed < retryAfter {
+			retryAfter = decayed
+		}
+	}
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return false, retryAfter, nil
+}
+
+// warnUnavailable logs that requests are allowed unchecked, at most once per
+// storeWarningInterval
+func (l *RateLimiter) warnUnavailable(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastWarning) < storeWarningInterval {
+		return
+	}
+	l.lastWarning = now
+	log.Warn().Err(err).Msg("Rate limit store unavailable, allowing requests")
+}
+
+// credentialed reports whether a client is identified by the credentials it
+// presents
+func credentialed(client string) bool {
+	return strings.HasPrefix(client, "credential:")
+}
+
+// ipClient identifies the client of a request by its IP address
+func ipClient(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// refusedClient identifies the requests from an IP address whose credentials
+// were not accepted
+func refusedClient(c *gin.Context) string {
+	return "refused:" + c.ClientIP()
+}
+
+// client identifies the client of a request by a digest of the credentials
+// it presents, or its IP address. Requests are limited before routes
+// authenticate them, and credentials are not validated here since that
+// would cost every request a second lookup; clients are only told apart.
+func (l *RateLimiter) client(c *gin.Context) string {
+	if client := c.GetString(rateLimitClientKey); client != "" {
+		return client
+	}
+
+	client := ipClient(c)
+	if user, ok := GetUserFromContext(c); ok {
+		client = "user:" + user.ID.String()
+	} else if credential := presentedCredential(c); credential != "" {
+		digest := sha256.Sum256([]byte(credential))
+		client = "credential:" + hex.EncodeToString(digest[:16])
+	}
+	c.Set(rateLimitClientKey, client)
+	return client
+}
+
+// presentedCredential returns the token or API key a request presents,
+// taken from the same places as by the authentication middleware
+func presentedCredential(c *gin.Context) string {
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return token
+	}
+	if _, password, ok := c.Request.BasicAuth(); ok && password != "" {
+		return password
+	}
+	for _, apiKey := range []string{c.GetHeader("X-API-Key"), c.GetHeader("X-NuGet-ApiKey"), c.Query("api_key")} {
+		if apiKey != "" {
+			return apiKey
+		}
+	}
+	return ""
+}
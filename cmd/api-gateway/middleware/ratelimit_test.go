@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockRateLimitStore keeps counters in memory, ignoring expiration
+type mockRateLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]int64
+	err      error
+}
+
+func newMockRateLimitStore() *mockRateLimitStore {
+	return &mockRateLimitStore{counters: make(map[string]int64)}
+}
+
+func (m *mockRateLimitStore) Increment(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return 0, m.err
+	}
+	m.counters[key]++
+	return m.counters[key], nil
+}
+
+func (m *mockRateLimitStore) GetInt(ctx context.Context, key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return 0, m.err
+	}
+	return m.counters[key], nil
+}
+
+func setupRateLimitRouter(limiter *RateLimiter, rules ...RateLimitRule) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	// Made-up keys are refused as the authentication middleware refuses
+	// them; other keys authenticate a user
+	handler := func(c *gin.Context) {
+		apiKey := c.GetHeader("X-API-Key")
+		if strings.HasPrefix(apiKey, "made-up") {
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		if apiKey != "" {
+			c.Set("user", &types.User{ID: uuid.NewSHA1(uuid.Nil, []byte(apiKey))})
+		}
+		c.Status(http.StatusOK)
+	}
+
+	// Made-up keys are ignored as the optional authentication middleware
+	// ignores them, serving the request anonymously
+	optionalHandler := func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" && !strings.HasPrefix(apiKey, "made-up") {
+			c.Set("user", &types.User{ID: uuid.NewSHA1(uuid.Nil, []byte(apiKey))})
+		}
+		c.Status(http.StatusOK)
+	}
+
+	router := gin.New()
+	router.Use(RateLimit(limiter, rules...))
+	router.GET("/package", handler)
+	router.PUT("/package", handler)
+	router.GET("/search", optionalHandler)
+	return router
+}
+
+func rateLimitedRequest(router *gin.Engine, method, apiKey string) *httptest.ResponseRecorder {
+	return rateLimitedPathRequest(router, method, "/package", apiKey)
+}
+
+func rateLimitedPathRequest(router *gin.Engine, method, path, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_SlidingWindow(t *testing.T) {
+	// Start halfway through a window
+	now := time.Unix(0, 0).Add(30 * time.Second)
+	limiter := NewRateLimiter(newMockRateLimitStore())
+	limiter.now = func() time.Time { return now }
+
+	router := setupRateLimitRouter(limiter, RateLimitRule{Name: "api", Limit: 4, Window: time.Minute})
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "").Code)
+	}
+	w := rateLimitedRequest(router, http.MethodGet, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"), "the limit resets when the window ends")
+
+	// Other clients have their own counters
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "key-a").Code)
+
+	// Early in the next window most of the previous window still counts:
+	// 5 * 0.75 + 1 > 4
+	now = now.Add(45 * time.Second)
+	w = rateLimitedRequest(router, http.MethodGet, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "9", w.Header().Get("Retry-After"), "retry once the previous window has decayed to 5 * 0.6 + 1")
+
+	// Later only a fraction does: 5 * 0.25 + 2 <= 4
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "").Code)
+}
+
+func TestRateLimit_RulesApplyByMethod(t *testing.T) {
+	now := time.Unix(0, 0)
+	limiter := NewRateLimiter(newMockRateLimitStore())
+	limiter.now = func() time.Time { return now }
+
+	router := setupRateLimitRouter(limiter,
+		RateLimitRule{Name: "publish", Limit: 1, Window: time.Minute, Methods: []string{http.MethodPut}},
+		RateLimitRule{Name: "download", Limit: 3, Window: time.Minute, Methods: []string{http.MethodGet}},
+	)
+
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodPut, "key-a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitedRequest(router, http.MethodPut, "key-a").Code)
+
+	// Downloads are counted separately with their own limit
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "key-a").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitedRequest(router, http.MethodGet, "key-a").Code)
+
+	// Requests a rule does not match are not counted against it
+	router = setupRateLimitRouter(limiter, RateLimitRule{
+		Name:   "publish",
+		Limit:  1,
+		Window: time.Minute,
+		Match:  func(c *gin.Context) bool { return c.Request.Method == http.MethodPut },
+	})
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "key-c").Code)
+	}
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodPut, "key-c").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitedRequest(router, http.MethodPut, "key-c").Code)
+}
+
+func TestRateLimit_ClientsByCredentials(t *testing.T) {
+	limiter := NewRateLimiter(newMockRateLimitStore())
+	router := setupRateLimitRouter(limiter, RateLimitRule{Name: "api", Limit: 2, Window: time.Minute})
+
+	// Each credential has its own limit
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "key-a").Code)
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "key-a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitedRequest(router, http.MethodGet, "key-a").Code)
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "key-b").Code)
+
+	// Refused credentials are also counted against the client's IP address,
+	// so new made-up ones do not get a limit of their own
+	assert.Equal(t, http.StatusUnauthorized, rateLimitedRequest(router, http.MethodGet, "made-up-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, rateLimitedRequest(router, http.MethodGet, "made-up-2").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitedRequest(router, http.MethodGet, "made-up-3").Code)
+
+	// Anonymous requests are counted by IP address alone
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitedRequest(router, http.MethodGet, "").Code)
+}
+
+func TestRateLimit_IgnoredCredentials(t *testing.T) {
+	limiter := NewRateLimiter(newMockRateLimitStore())
+	router := setupRateLimitRouter(limiter, RateLimitRule{Name: "api", Limit: 2, Window: time.Minute})
+
+	// Accepted credentials keep their own limit and are not counted against the IP address
+	assert.Equal(t, http.StatusOK, rateLimitedPathRequest(router, http.MethodGet, "/search", "key-a").Code)
+	assert.Equal(t, http.StatusOK, rateLimitedPathRequest(router, http.MethodGet, "/search", "key-a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitedPathRequest(router, http.MethodGet, "/search", "key-a").Code)
+
+	// Routes with optional authentication serve made-up credentials
+	// anonymously, and those requests are counted against the IP address
+	assert.Equal(t, http.StatusOK, rateLimitedPathRequest(router, http.MethodGet, "/search", "made-up-1").Code)
+	assert.Equal(t, http.StatusOK, rateLimitedPathRequest(router, http.MethodGet, "/search", "made-up-2").Code)
+	assert.Equal(t, http.StatusTooManyRequests, rateLimitedPathRequest(router, http.MethodGet, "/search", "made-up-3").Code)
+}
+
+func TestRateLimit_FailsOpen(t *testing.T) {
+	store := newMockRateLimitStore()
+	store.err = errors.New("connection refused")
+
+	router := setupRateLimitRouter(NewRateLimiter(store), RateLimitRule{Name: "api", Limit: 1, Window: time.Minute})
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "").Code)
+	}
+
+	// Without a store, or a limiter, nothing is limited
+	for _, limiter := range []*RateLimiter{NewRateLimiter(nil), nil} {
+		router := setupRateLimitRouter(limiter, RateLimitRule{Name: "api", Limit: 1, Window: time.Minute})
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, rateLimitedRequest(router, http.MethodGet, "").Code)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// PackageReaderMiddleware records who each request is for in the request
+// context, so the registry service only downloads and lists the packages
+// they can read. The user is resolved when packages are read, after any
+// route-level authentication has run; anonymous requests read only public
+// packages.
+func PackageReaderMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := registry.WithReader(c.Request.Context(), func() *types.User {
+			user, _ := GetUserFromContext(c)
+			return user
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
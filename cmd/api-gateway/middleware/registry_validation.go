@@ -2,19 +2,21 @@ package middleware
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lgulliver/lodestone/internal/registry"
-	"github.com/rs/zerolog/log"
 )
 
-// RegistryValidationMiddleware checks if a registry is enabled before processing requests
+// RegistryValidationMiddleware checks if a registry is enabled before processing requests,
+// and refuses changes to registries in read-only mode. A nil settings service
+// disables the checks.
 func RegistryValidationMiddleware(settingsService *registry.RegistrySettingsService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Extract registry type from the request path or parameters
 		registryType := extractRegistryType(c)
 
-		if registryType == "" {
+		if registryType == "" || settingsService == nil {
 			// If we can't determine the registry type, continue
 			c.Next()
 			return
@@ -23,7 +25,7 @@ func RegistryValidationMiddleware(settingsService *registry.RegistrySettingsServ
 		// Check if the registry is enabled
 		enabled, err := settingsService.IsRegistryEnabled(c.Request.Context(), registryType)
 		if err != nil {
-			log.Error().
+			Logger(c).Error().
 				Err(err).
 				Str("registry", registryType).
 				Msg("failed to check registry status")
@@ -35,7 +37,7 @@ func RegistryValidationMiddleware(settingsService *registry.RegistrySettingsServ
 		}
 
 		if !enabled {
-			log.Warn().
+			Logger(c).Warn().
 				Str("registry", registryType).
 				Str("path", c.Request.URL.Path).
 				Msg("request to disabled registry")
@@ -47,11 +49,83 @@ func RegistryValidationMiddleware(settingsService *registry.RegistrySettingsServ
 			return
 		}
 
+		if isWriteRequest(c.Request) {
+			readOnly, err := settingsService.IsReadOnly(c.Request.Context(), registryType)
+			if err != nil {
+				Logger(c).Error().
+					Err(err).
+					Str("registry", registryType).
+					Msg("failed to check registry read-only mode")
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": "Internal server error",
+				})
+				c.Abort()
+				return
+			}
+
+			if readOnly {
+				Logger(c).Warn().
+					Str("registry", registryType).
+					Str("method", c.Request.Method).
+					Str("path", c.Request.URL.Path).
+					Msg("write to read-only registry")
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"error":    "Registry is currently read-only",
+					"registry": registryType,
+				})
+				c.Abort()
+				return
+			}
+		}
+
 		// Registry is enabled, continue with the request
 		c.Next()
 	}
 }
 
+// readOnlyExemptPaths end the paths of requests that use a write method
+// without changing any package: logins, token exchanges and advisory lookups
+var readOnlyExemptPaths = []string{
+	"/-/npm/v1/security/advisories/bulk",
+	"/v2/auth",
+	"/v2/token",
+}
+
+// isWriteRequest reports whether a request may change a registry's packages
+func isWriteRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+
+	path := req.URL.Path
+	if strings.Contains(path, "/-/user/") {
+		return false
+	}
+	for _, suffix := range readOnlyExemptPaths {
+		if strings.HasSuffix(path, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// registryPathSegments maps the first path segment under /api/v1 to the
+// registry its routes serve
+var registryPathSegments = map[string]string{
+	"nuget":  "nuget",
+	"npm":    "npm",
+	"maven":  "maven",
+	"go":     "go",
+	"helm":   "helm",
+	"cargo":  "cargo",
+	"gems":   "rubygems",
+	"opa":    "opa",
+	"debian": "debian",
+	"rpm":    "rpm",
+	"v2":     "oci",
+}
+
 // extractRegistryType extracts the registry type from the request
 func extractRegistryType(c *gin.Context) string {
 	// Check if registry is specified as a URL parameter
@@ -59,38 +133,16 @@ func extractRegistryType(c *gin.Context) string {
 		return registry
 	}
 
-	// Check if registry is specified as a query parameter
-	if registry := c.Query("registry"); registry != "" {
-		return registry
-	}
-
-	// Extract from path patterns
+	// The Docker registry v2 API is also served at the root
 	path := c.Request.URL.Path
-
-	// Common registry path patterns
-	patterns := map[string]string{
-		"/v1/nuget":    "nuget",
-		"/v1/npm":      "npm",
-		"/v1/maven":    "maven",
-		"/v1/cargo":    "cargo",
-		"/v1/docker":   "docker",
-		"/v1/helm":     "helm",
-		"/v1/rubygems": "rubygems",
-		"/v1/opa":      "opa",
-		"/v1/go":       "go",
-		"/v2/":         "docker", // Docker registry v2 API
+	if path == "/v2" || strings.HasPrefix(path, "/v2/") {
+		return "oci"
 	}
 
-	for pattern, registryType := range patterns {
-		if containsPath(path, pattern) {
-			return registryType
-		}
+	rest, ok := strings.CutPrefix(path, "/api/v1/")
+	if !ok {
+		return ""
 	}
-
-	return ""
-}
-
-// containsPath checks if the path contains the pattern
-func containsPath(path, pattern string) bool {
-	return len(path) >= len(pattern) && path[:len(pattern)] == pattern
+	segment, _, _ := strings.Cut(rest, "/")
+	return registryPathSegments[segment]
 }
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupRegistryValidationRouter(t *testing.T) (*gin.Engine, *registry.RegistrySettingsService) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&types.User{}, &types.RegistrySetting{}))
+	for _, name := range []string{"npm", "go", "oci"} {
+		require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: name, Enabled: true}).Error)
+	}
+	settingsService := registry.NewRegistrySettingsService(db)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+	api.Use(RegistryValidationMiddleware(settingsService))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.GET("/npm/:name", ok)
+	api.PUT("/npm/:name", ok)
+	api.PUT("/npm/-/user/:user", ok)
+	api.GET("/go/*path", ok)
+	api.PUT("/go/*path", ok)
+	api.GET("/artifacts", ok)
+	router.Any("/v2/*path", RegistryValidationMiddleware(settingsService), ok)
+
+	return router, settingsService
+}
+
+func serveRegistryRequest(router *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestRegistryValidationMiddleware_Disabled(t *testing.T) {
+	router, settingsService := setupRegistryValidationRouter(t)
+	require.NoError(t, settingsService.DisableRegistry(context.Background(), "npm", uuid.New()))
+
+	for _, method := range []string{http.MethodGet, http.MethodPut} {
+		w := serveRegistryRequest(router, method, "/api/v1/npm/left-pad")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, method)
+		assert.Contains(t, w.Body.String(), "Registry is currently disabled")
+	}
+
+	// Other registries and routes outside any registry keep working
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodGet, "/api/v1/go/example.com/mod/@v/list").Code)
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodPut, "/api/v1/go/example.com/mod/@v/v1.0.0.zip").Code)
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodGet, "/api/v1/artifacts").Code)
+
+	require.NoError(t, settingsService.EnableRegistry(context.Background(), "npm", uuid.New()))
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodGet, "/api/v1/npm/left-pad").Code)
+}
+
+func TestRegistryValidationMiddleware_ReadOnly(t *testing.T) {
+	router, settingsService := setupRegistryValidationRouter(t)
+	require.NoError(t, settingsService.SetReadOnly(context.Background(), "npm", true, uuid.New()))
+
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodGet, "/api/v1/npm/left-pad").Code)
+
+	w := serveRegistryRequest(router, http.MethodPut, "/api/v1/npm/left-pad")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "Registry is currently read-only")
+
+	// Logging in changes no package
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodPut, "/api/v1/npm/-/user/org.couchdb.user:alice").Code)
+
+	// Other registries still accept writes
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodPut, "/api/v1/go/example.com/mod/@v/v1.0.0.zip").Code)
+}
+
+func TestRegistryValidationMiddleware_OCIRootRoutes(t *testing.T) {
+	router, settingsService := setupRegistryValidationRouter(t)
+	require.NoError(t, settingsService.SetReadOnly(context.Background(), "oci", true, uuid.New()))
+
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodGet, "/v2/myorg/app/manifests/latest").Code)
+	assert.Equal(t, http.StatusOK, serveRegistryRequest(router, http.MethodPost, "/v2/token").Code)
+	assert.Equal(t, http.StatusServiceUnavailable, serveRegistryRequest(router, http.MethodPut, "/v2/myorg/app/manifests/latest").Code)
+
+	require.NoError(t, settingsService.DisableRegistry(context.Background(), "oci", uuid.New()))
+	assert.Equal(t, http.StatusServiceUnavailable, serveRegistryRequest(router, http.MethodGet, "/v2/myorg/app/manifests/latest").Code)
+}
+
+func TestExtractRegistryType(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/npm/left-pad":                 "npm",
+		"/api/v1/gems/api/v1/gems":             "rubygems",
+		"/api/v1/v2/myorg/app/manifests/1.0":   "oci",
+		"/v2/":                                 "oci",
+		"/api/v1/artifacts":                    "",
+		"/api/v1/npmjs/left-pad":               "",
+		"/health":                              "",
+		"/api/v1/maven/com/example/lib/1.0/ok": "maven",
+	}
+	for path, expected := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, path, nil)
+		assert.Equal(t, expected, extractRegistryType(c), path)
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestIDHeader carries the request ID, both on requests from clients or
+// proxies that already assigned one and on every response
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits request IDs taken from clients to a reasonable length
+// of characters that are safe to log and echo in a header
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestIDKey struct{}
+type loggerKey struct{}
+
+// RequestID assigns each request an ID, taken from its X-Request-ID header
+// when it has a valid one and generated otherwise. The ID is returned in the
+// response header and added to every entry of the request-scoped logger, so
+// the log entries of one request can be correlated.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		logger := log.Logger.With().Str("request_id", requestID).Logger()
+		ctx := context.WithValue(c.Request.Context(), requestIDKey{}, requestID)
+		ctx = context.WithValue(ctx, loggerKey{}, &logger)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Header(RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
+// RequestIDFromContext returns the ID of the request a context belongs to, or
+// "" outside of a request
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// LoggerFromContext returns the logger of the request a context belongs to,
+// or the global logger outside of a request
+func LoggerFromContext(ctx context.Context) *zerolog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*zerolog.Logger); ok {
+		return logger
+	}
+	return &log.Logger
+}
+
+// Logger returns the request-scoped logger of a request, which tags every
+// entry with the request ID. Handlers log through it rather than the global
+// logger.
+func Logger(c *gin.Context) *zerolog.Logger {
+	return LoggerFromContext(c.Request.Context())
+}
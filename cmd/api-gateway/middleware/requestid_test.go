@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs sends the global logger's output to a buffer for the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = previous })
+	return &buf
+}
+
+func setupRequestIDRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/ping", func(c *gin.Context) {
+		Logger(c).Info().Msg("handling ping")
+		LoggerFromContext(c.Request.Context()).Info().Msg("still handling ping")
+		c.String(http.StatusOK, RequestIDFromContext(c.Request.Context()))
+	})
+	return router
+}
+
+func TestRequestID(t *testing.T) {
+	logs := captureLogs(t)
+	router := setupRequestIDRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/ping", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	requestID := w.Header().Get(RequestIDHeader)
+	require.NotEmpty(t, requestID)
+	assert.Equal(t, requestID, w.Body.String(), "the request ID is in the request context")
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		assert.Equal(t, requestID, entry["request_id"], "every log entry of the request carries its ID")
+	}
+
+	// Another request gets another ID
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/ping", nil))
+	assert.NotEqual(t, requestID, w.Header().Get(RequestIDHeader))
+}
+
+func TestRequestID_FromHeader(t *testing.T) {
+	logs := captureLogs(t)
+	router := setupRequestIDRouter()
+
+	req := httptest.NewRequest("GET", "/ping", nil)
+	req.Header.Set(RequestIDHeader, "lb-7f3a9c")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "lb-7f3a9c", w.Header().Get(RequestIDHeader))
+	assert.Contains(t, logs.String(), `"request_id":"lb-7f3a9c"`)
+
+	// IDs that are unsafe to log or echo are replaced
+	req = httptest.NewRequest("GET", "/ping", nil)
+	req.Header.Set(RequestIDHeader, "bad id\r\n"+strings.Repeat("x", 200))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Regexp(t, `^[0-9a-f-]{36}$`, w.Header().Get(RequestIDHeader))
+}
+
+func TestLoggerFromContext_OutsideRequest(t *testing.T) {
+	assert.Same(t, &log.Logger, LoggerFromContext(context.Background()))
+	assert.Empty(t, RequestIDFromContext(context.Background()))
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/pkg/signing"
+)
+
+// SignatureHeader carries the base64-encoded detached signature of an
+// uploaded artifact
+const SignatureHeader = "X-Artifact-Signature"
+
+// SignatureFormField is the multipart field a detached signature may be
+// uploaded in alongside the artifact
+const SignatureFormField = "signature"
+
+// maxSignatureSize bounds the signature read from a multipart upload
+const maxSignatureSize = 64 << 10
+
+// ArtifactSignatureMiddleware records the detached signature supplied with an
+// upload in the request context, where the registry service verifies it on
+// registries requiring signatures. The signature is read from the
+// X-Artifact-Signature header or, for multipart uploads, from a "signature"
+// file sent alongside the artifact.
+func ArtifactSignatureMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		if method != http.MethodPost && method != http.MethodPut {
+			c.Next()
+			return
+		}
+
+		var signature []byte
+		if header := c.GetHeader(SignatureHeader); header != "" {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header))
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid " + SignatureHeader + " header: expected base64"})
+				return
+			}
+			signature = decoded
+		} else if strings.HasPrefix(c.ContentType(), "multipart/") {
+			if file, err := c.FormFile(SignatureFormField); err == nil {
+				signature, err = readSignatureFile(file)
+				if err != nil {
+					c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid signature file: " + err.Error()})
+					return
+				}
+			}
+		}
+
+		if signature != nil {
+			c.Request = c.Request.WithContext(signing.WithSignature(c.Request.Context(), signature))
+		}
+		c.Next()
+	}
+}
+
+// readSignatureFile reads an uploaded signature file, rejecting ones too large
+// to be a signature
+func readSignatureFile(header *multipart.FileHeader) ([]byte, error) {
+	if header.Size > maxSignatureSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxSignatureSize)
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/pkg/throttle"
+)
+
+// DownloadClientMiddleware records who each request is for in the request
+// context, so the registry service can apply per-client download limits.
+// The client is resolved when the download starts, after any route-level
+// authentication has run: authenticated users are limited per user, and
+// anonymous clients per IP address.
+func DownloadClientMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := throttle.WithClient(c.Request.Context(), func() throttle.Client {
+			if user, ok := GetUserFromContext(c); ok {
+				return throttle.Client{ID: user.ID.String(), Authenticated: true}
+			}
+			return throttle.Client{ID: c.ClientIP()}
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxUploadSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var handled bool
+	newRouter := func(limit int64) *gin.Engine {
+		router := gin.New()
+		router.Use(MaxUploadSize(limit))
+		router.PUT("/upload", func(c *gin.Context) {
+			handled = true
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				assert.ErrorAs(t, err, &maxBytesErr)
+				c.Status(http.StatusRequestEntityTooLarge)
+				return
+			}
+			c.String(http.StatusOK, "%d", len(body))
+		})
+		return router
+	}
+	upload := func(router *gin.Engine, size int, chunked bool) *httptest.ResponseRecorder {
+		handled = false
+		body := strings.Repeat("x", size)
+		req := httptest.NewRequest("PUT", "/upload", strings.NewReader(body))
+		if chunked {
+			req.Body = io.NopCloser(bytes.NewBufferString(body))
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	router := newRouter(1024)
+
+	t.Run("declared length above the limit is rejected unread", func(t *testing.T) {
+		w := upload(router, 1025, false)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), "maximum upload size of 1024 bytes")
+		assert.False(t, handled)
+	})
+
+	t.Run("undeclared length above the limit fails to read", func(t *testing.T) {
+		w := upload(router, 4096, true)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.True(t, handled)
+	})
+
+	t.Run("bodies within the limit are read", func(t *testing.T) {
+		w := upload(router, 1024, false)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1024", w.Body.String())
+
+		w = upload(router, 1024, true)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1024", w.Body.String())
+	})
+
+	t.Run("zero disables the limit", func(t *testing.T) {
+		w := upload(newRouter(0), 1<<20, false)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
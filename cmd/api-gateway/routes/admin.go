@@ -1,20 +1,28 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/advisories"
 	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/metadata"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/internal/retention"
+	"github.com/lgulliver/lodestone/internal/webhooks"
 	"github.com/lgulliver/lodestone/pkg/types"
-	"github.com/rs/zerolog/log"
 )
 
 // AdminRoutes sets up the admin API routes for registry management
-func AdminRoutes(r *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
-	// Create settings service
-	settingsService := registry.NewRegistrySettingsService(registryService.DB.DB)
+func AdminRoutes(r *gin.RouterGroup, registryService *registry.Service, metadataService *metadata.Service, authService *auth.Service) {
+	// Settings changes go through the registry service's settings so they are audited
+	settingsService := registryService.Settings
+	auditLog := registryService.AuditLog()
 
 	admin := r.Group("/admin")
 	admin.Use(middleware.AuthMiddleware(authService))
@@ -28,7 +36,88 @@ func AdminRoutes(r *gin.RouterGroup, registryService *registry.Service, authServ
 		registries.PUT("/:registry/enable", enableRegistry(settingsService))
 		registries.PUT("/:registry/disable", disableRegistry(settingsService))
 		registries.PUT("/:registry/description", updateRegistryDescription(settingsService))
+		registries.PUT("/:registry/approval", updateRegistryApproval(settingsService))
+		registries.PUT("/:registry/signature", updateRegistrySignature(settingsService))
+		registries.PUT("/:registry/immutable", updateRegistryImmutable(settingsService))
+		registries.PUT("/:registry/read-only", updateRegistryReadOnly(settingsService))
 	}
+
+	// User management endpoints
+	users := admin.Group("/users")
+	{
+		users.GET("/", listUsers(authService))
+		users.POST("/", createUser(authService))
+		users.PUT("/:user_id/enable", enableUser(authService))
+		users.PUT("/:user_id/disable", disableUser(authService))
+		users.PUT("/:user_id/admin", updateUserAdmin(authService))
+		users.POST("/:user_id/password", resetUserPassword(authService))
+		users.POST("/:user_id/revoke-tokens", revokeUserTokens(authService))
+	}
+
+	// Retention policy endpoints
+	retentionService := retention.NewService(registryService.DB.DB, registryService)
+	retentionService.SetAuditLog(auditLog)
+	policies := admin.Group("/retention")
+	{
+		policies.GET("/", getRetentionPolicies(retentionService))
+		policies.GET("/:registry", getRetentionPolicy(retentionService))
+		policies.PUT("/:registry", setRetentionPolicy(registryService, retentionService))
+		policies.POST("/:registry/dry-run", dryRunRetentionPolicy(registryService, retentionService))
+	}
+
+	// Quota endpoints
+	quotas := admin.Group("/quotas")
+	{
+		quotas.GET("/:user_id", getUserQuotas(registryService))
+		quotas.PUT("/:user_id", setUserQuota(registryService))
+		quotas.DELETE("/:user_id", deleteUserQuota(registryService))
+	}
+
+	// Webhook subscription endpoints
+	webhookService := webhooks.NewService(registryService.DB.DB)
+	webhookService.SetAuditLog(auditLog)
+	subscriptions := admin.Group("/webhooks")
+	{
+		subscriptions.GET("/", getWebhookSubscriptions(webhookService))
+		subscriptions.POST("/", createWebhookSubscription(registryService, webhookService))
+		subscriptions.GET("/:id", getWebhookSubscription(webhookService))
+		subscriptions.PUT("/:id", updateWebhookSubscription(registryService, webhookService))
+		subscriptions.DELETE("/:id", deleteWebhookSubscription(webhookService))
+	}
+
+	// Security advisory endpoints
+	advisoryService := advisories.NewService(registryService.DB.DB)
+	advisoryService.SetAuditLog(auditLog)
+	advisoryRoutes := admin.Group("/advisories")
+	{
+		advisoryRoutes.GET("/", getAdvisories(advisoryService))
+		advisoryRoutes.POST("/", createAdvisory(registryService, advisoryService))
+		advisoryRoutes.GET("/:id", getAdvisory(advisoryService))
+		advisoryRoutes.DELETE("/:id", deleteAdvisory(advisoryService))
+	}
+
+	// Permission introspection and deleted artifact endpoints
+	artifacts := admin.Group("/artifacts")
+	{
+		artifacts.GET("/:registry/:name/access", getArtifactAccess(registryService))
+		artifacts.GET("/deleted", getDeletedArtifacts(registryService))
+		artifacts.POST("/deleted/restore", restoreArtifact(registryService))
+	}
+
+	// OCI garbage collection endpoint
+	admin.POST("/oci/gc", collectOCIGarbage(registryService))
+
+	// Storage reconciliation endpoint
+	admin.POST("/storage/reconcile", reconcileStorage(registryService))
+
+	// Published version ledger verification endpoint
+	admin.GET("/published-versions/verify", verifyPublishedVersions(registryService))
+
+	// Search index rebuild endpoint
+	admin.POST("/search/reindex", reindexSearch(registryService, metadataService))
+
+	// Audit trail endpoint
+	admin.GET("/audit", getAuditEntries(auditLog))
 }
 
 // adminOnlyMiddleware ensures only admin users can access admin endpoints
@@ -73,7 +162,7 @@ func getRegistrySettings(settingsService *registry.RegistrySettingsService) gin.
 	return func(c *gin.Context) {
 		settings, err := settingsService.GetRegistrySettings(c.Request.Context())
 		if err != nil {
-			log.Error().Err(err).Msg("failed to get registry settings")
+			middleware.Logger(c).Error().Err(err).Msg("failed to get registry settings")
 			c.JSON(http.StatusInternalServerError, types.APIResponse{
 				Success: false,
 				Error:   "Failed to retrieve registry settings",
@@ -107,7 +196,7 @@ func getRegistrySetting(settingsService *registry.RegistrySettingsService) gin.H
 
 		setting, err := settingsService.GetRegistrySetting(c.Request.Context(), registryName)
 		if err != nil {
-			log.Error().Err(err).Str("registry", registryName).Msg("failed to get registry setting")
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to get registry setting")
 			c.JSON(http.StatusNotFound, types.APIResponse{
 				Success: false,
 				Error:   "Registry not found",
@@ -122,6 +211,492 @@ func getRegistrySetting(settingsService *registry.RegistrySettingsService) gin.H
 	}
 }
 
+// GetArtifactAccess godoc
+//
+//	@Summary		Get effective package access
+//	@Description	Report who can download, publish, delete, manage owners of or approve a package, and why
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry name (e.g., npm, nuget, maven)"
+//	@Param			name		path		string	true	"Package name"
+//	@Success		200			{object}	types.APIResponse{data=registry.ArtifactAccess}	"Effective access retrieved successfully"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404			{object}	types.APIResponse	"Package not found"
+//	@Failure		500			{object}	types.APIResponse	"Failed to compute package access"
+//	@Security		BearerAuth
+//	@Router			/admin/artifacts/{registry}/{name}/access [get]
+func getArtifactAccess(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Param("registry")
+		name := c.Param("name")
+
+		access, err := registryService.GetArtifactAccess(c.Request.Context(), registryName, name)
+		if err != nil {
+			if errors.Is(err, registry.ErrPackageNotFound) {
+				c.JSON(http.StatusNotFound, types.APIResponse{
+					Success: false,
+					Error:   "Package not found",
+				})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Str("name", name).Msg("failed to compute package access")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to compute package access",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    access,
+		})
+	}
+}
+
+// retentionPolicyRequest is the body of a retention policy update or dry run
+type retentionPolicyRequest struct {
+	Enabled              bool  `json:"enabled"`
+	KeepLastVersions     int   `json:"keep_last_versions"`
+	PrereleaseMaxAgeDays int   `json:"prerelease_max_age_days"`
+	KeepLatest           *bool `json:"keep_latest"` // defaults to true
+	KeepSnapshotBuilds   int   `json:"keep_snapshot_builds"`
+}
+
+// policy converts the request to a retention policy for a registry
+func (r retentionPolicyRequest) policy(registryName string) *types.RetentionPolicy {
+	keepLatest := true
+	if r.KeepLatest != nil {
+		keepLatest = *r.KeepLatest
+	}
+	return &types.RetentionPolicy{
+		RegistryName:         registryName,
+		Enabled:              r.Enabled,
+		KeepLastVersions:     r.KeepLastVersions,
+		PrereleaseMaxAgeDays: r.PrereleaseMaxAgeDays,
+		KeepLatest:           keepLatest,
+		KeepSnapshotBuilds:   r.KeepSnapshotBuilds,
+	}
+}
+
+// GetRetentionPolicies godoc
+//
+//	@Summary		List retention policies
+//	@Description	Retrieve the retention policy of every registry that has one
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{object}	types.APIResponse{data=[]types.RetentionPolicy}	"Retention policies retrieved successfully"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403	{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		500	{object}	types.APIResponse	"Failed to retrieve retention policies"
+//	@Security		BearerAuth
+//	@Router			/admin/retention [get]
+func getRetentionPolicies(retentionService *retention.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policies, err := retentionService.GetPolicies(c.Request.Context())
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("failed to get retention policies")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to retrieve retention policies",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    policies,
+		})
+	}
+}
+
+// GetRetentionPolicy godoc
+//
+//	@Summary		Get a registry's retention policy
+//	@Description	Retrieve the retention policy of a registry format
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry name (e.g., npm, nuget, maven)"
+//	@Success		200			{object}	types.APIResponse{data=types.RetentionPolicy}	"Retention policy retrieved successfully"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404			{object}	types.APIResponse	"Retention policy not found"
+//	@Security		BearerAuth
+//	@Router			/admin/retention/{registry} [get]
+func getRetentionPolicy(retentionService *retention.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Param("registry")
+
+		policy, err := retentionService.GetPolicy(c.Request.Context(), registryName)
+		if err != nil {
+			status := http.StatusInternalServerError
+			message := "Failed to retrieve retention policy"
+			if errors.Is(err, retention.ErrPolicyNotFound) {
+				status = http.StatusNotFound
+				message = "Retention policy not found"
+			} else {
+				middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to get retention policy")
+			}
+			c.JSON(status, types.APIResponse{
+				Success: false,
+				Error:   message,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    policy,
+		})
+	}
+}
+
+// SetRetentionPolicy godoc
+//
+//	@Summary		Set a registry's retention policy
+//	@Description	Create or replace the retention policy of a registry format. Enabled policies are applied periodically with the permissions of the admin who set them. On the Maven registry, keep_snapshot_builds limits the timestamped builds kept per -SNAPSHOT version, which then do not count towards keep_last_versions.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			registry	path		string					true	"Registry name (e.g., npm, nuget, maven)"
+//	@Param			policy		body		retentionPolicyRequest	true	"Retention policy"
+//	@Success		200			{object}	types.APIResponse{data=types.RetentionPolicy}	"Retention policy saved successfully"
+//	@Failure		400			{object}	types.APIResponse	"Invalid retention policy"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404			{object}	types.APIResponse	"Unknown registry"
+//	@Security		BearerAuth
+//	@Router			/admin/retention/{registry} [put]
+func setRetentionPolicy(registryService *registry.Service, retentionService *retention.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Param("registry")
+		user, _ := middleware.GetUserFromContext(c)
+
+		if _, err := registryService.GetRegistry(registryName); err != nil {
+			c.JSON(http.StatusNotFound, types.APIResponse{
+				Success: false,
+				Error:   "Unknown registry",
+			})
+			return
+		}
+
+		var request retentionPolicyRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		policy := request.policy(registryName)
+		if err := retentionService.SetPolicy(c.Request.Context(), policy, user.ID); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to set retention policy")
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Retention policy saved successfully",
+			Data:    policy,
+		})
+	}
+}
+
+// DryRunRetentionPolicy godoc
+//
+//	@Summary		Dry-run a retention policy
+//	@Description	List the artifacts a retention policy would remove now, without removing them. Evaluates the policy in the body if one is given, otherwise the registry's saved policy.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			registry	path		string					true	"Registry name (e.g., npm, nuget, maven)"
+//	@Param			policy		body		retentionPolicyRequest	false	"Policy to evaluate instead of the saved one"
+//	@Success		200			{object}	types.APIResponse{data=[]retention.Candidate}	"Artifacts that would be removed"
+//	@Failure		400			{object}	types.APIResponse	"Invalid request body"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404			{object}	types.APIResponse	"Unknown registry or retention policy not found"
+//	@Failure		500			{object}	types.APIResponse	"Failed to evaluate retention policy"
+//	@Security		BearerAuth
+//	@Router			/admin/retention/{registry}/dry-run [post]
+func dryRunRetentionPolicy(registryService *registry.Service, retentionService *retention.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Param("registry")
+
+		if _, err := registryService.GetRegistry(registryName); err != nil {
+			c.JSON(http.StatusNotFound, types.APIResponse{
+				Success: false,
+				Error:   "Unknown registry",
+			})
+			return
+		}
+
+		var policy *types.RetentionPolicy
+		if c.Request.ContentLength != 0 {
+			var request retentionPolicyRequest
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, types.APIResponse{
+					Success: false,
+					Error:   "Invalid request body",
+				})
+				return
+			}
+			policy = request.policy(registryName)
+		} else {
+			saved, err := retentionService.GetPolicy(c.Request.Context(), registryName)
+			if err != nil {
+				status := http.StatusInternalServerError
+				message := "Failed to evaluate retention policy"
+				if errors.Is(err, retention.ErrPolicyNotFound) {
+					status = http.StatusNotFound
+					message = "Retention policy not found"
+				}
+				c.JSON(status, types.APIResponse{
+					Success: false,
+					Error:   message,
+				})
+				return
+			}
+			policy = saved
+		}
+
+		candidates, err := retentionService.DryRun(c.Request.Context(), policy)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to dry-run retention policy")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to evaluate retention policy",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    candidates,
+		})
+	}
+}
+
+// CollectOCIGarbage godoc
+//
+//	@Summary		Garbage collect OCI blobs
+//	@Description	Remove OCI blobs no manifest refers to, including the configs and layers of images only reachable through a deleted index. Blobs uploaded or mounted within the grace period are kept, so pushes in progress are not broken.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			dry_run			query		bool	false	"Report what would be removed without removing it"
+//	@Param			delete_untagged	query		bool	false	"Also remove manifests no tag refers to, directly or through an index"
+//	@Param			grace_period	query		string	false	"Keep blobs younger than this duration (default 1h)"
+//	@Success		200				{object}	types.APIResponse{data=oci.GCResult}	"Garbage collection completed"
+//	@Failure		400				{object}	types.APIResponse	"Invalid parameters"
+//	@Failure		401				{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403				{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404				{object}	types.APIResponse	"OCI registry not available"
+//	@Failure		500				{object}	types.APIResponse	"Garbage collection failed"
+//	@Security		BearerAuth
+//	@Router			/admin/oci/gc [post]
+func collectOCIGarbage(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		opts := oci.GCOptions{GracePeriod: oci.DefaultGCGracePeriod}
+		var err error
+		if value := c.Query("grace_period"); value != "" {
+			opts.GracePeriod, err = time.ParseDuration(value)
+			if err != nil || opts.GracePeriod < 0 {
+				c.JSON(http.StatusBadRequest, types.APIResponse{
+					Success: false,
+					Error:   "Invalid grace_period",
+				})
+				return
+			}
+		}
+		if opts.DryRun, err = parseBoolQuery(c, "dry_run"); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid dry_run",
+			})
+			return
+		}
+		if opts.DeleteUntagged, err = parseBoolQuery(c, "delete_untagged"); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid delete_untagged",
+			})
+			return
+		}
+
+		result, err := registryService.CollectOCIGarbage(c.Request.Context(), opts, user.ID)
+		if err != nil {
+			if errors.Is(err, registry.ErrOCIRegistryUnavailable) {
+				c.JSON(http.StatusNotFound, types.APIResponse{
+					Success: false,
+					Error:   "OCI registry not available",
+				})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Msg("failed to garbage collect OCI blobs")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Garbage collection failed",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Garbage collection completed",
+			Data:    result,
+		})
+	}
+}
+
+// ReconcileStorage godoc
+//
+//	@Summary		Reconcile storage
+//	@Description	Cross-check stored content against the storage paths of artifacts, deleted ones included. Content no artifact refers to is reported and, unless this is a dry run, removed. Artifacts whose content is missing are only reported. OCI repositories are left to OCI garbage collection.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			dry_run	query		bool	false	"Report orphaned content without removing it"
+//	@Success		200		{object}	types.APIResponse{data=registry.ReconcileResult}	"Reconciliation completed"
+//	@Failure		400		{object}	types.APIResponse	"Invalid parameters"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		500		{object}	types.APIResponse	"Reconciliation failed"
+//	@Security		BearerAuth
+//	@Router			/admin/storage/reconcile [post]
+func reconcileStorage(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		dryRun, err := parseBoolQuery(c, "dry_run")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid dry_run",
+			})
+			return
+		}
+
+		result, err := registryService.ReconcileStorage(c.Request.Context(), registry.ReconcileOptions{DryRun: dryRun}, user.ID)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("failed to reconcile storage")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Reconciliation failed",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Reconciliation completed",
+			Data:    result,
+		})
+	}
+}
+
+// ReindexSearch godoc
+//
+//	@Summary		Rebuild the search index
+//	@Description	Recreate the search index entries of every published artifact, or of one registry's, and remove entries of artifacts that were deleted. Entries are rebuilt in place, so search keeps working while it runs, and running it again is harmless
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			registry	query		string	false	"Only reindex this registry (e.g., npm, nuget)"
+//	@Success		200			{object}	types.APIResponse{data=metadata.ReindexResult}	"Search index rebuilt"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404			{object}	types.APIResponse	"Unknown registry"
+//	@Failure		500			{object}	types.APIResponse	"Failed to rebuild search index"
+//	@Security		BearerAuth
+//	@Router			/admin/search/reindex [post]
+func reindexSearch(registryService *registry.Service, metadataService *metadata.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Query("registry")
+		if registryName != "" {
+			if _, err := registryService.GetRegistry(registryName); err != nil {
+				c.JSON(http.StatusNotFound, types.APIResponse{
+					Success: false,
+					Error:   "Unknown registry",
+				})
+				return
+			}
+		}
+
+		result, err := metadataService.Reindex(c.Request.Context(), metadata.ReindexOptions{Registry: registryName})
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to rebuild search index")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to rebuild search index",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Search index rebuilt",
+			Data:    result,
+		})
+	}
+}
+
+// VerifyPublishedVersions godoc
+//
+//	@Summary		Verify the published version ledger
+//	@Description	Check that no entry of the ledger of versions published to immutable registries has been changed or removed, by recomputing the hash chain linking its entries
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{object}	types.APIResponse{data=map[string]int}	"Ledger verified"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403	{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		409	{object}	types.APIResponse	"Ledger has been tampered with"
+//	@Failure		500	{object}	types.APIResponse	"Failed to verify ledger"
+//	@Security		BearerAuth
+//	@Router			/admin/published-versions/verify [get]
+func verifyPublishedVersions(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checked, err := registryService.VerifyPublishedVersions(c.Request.Context())
+		if errors.Is(err, registry.ErrLedgerTampered) {
+			middleware.Logger(c).Error().Err(err).Msg("published version ledger failed verification")
+			c.JSON(http.StatusConflict, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+				Data:    gin.H{"verified": checked},
+			})
+			return
+		}
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("failed to verify published version ledger")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to verify ledger",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Ledger verified",
+			Data:    gin.H{"verified": checked},
+		})
+	}
+}
+
+// parseBoolQuery parses an optional boolean query parameter
+func parseBoolQuery(c *gin.Context, name string) (bool, error) {
+	value := c.Query(name)
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
 // enableRegistry enables a registry format
 func enableRegistry(settingsService *registry.RegistrySettingsService) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -130,7 +705,7 @@ func enableRegistry(settingsService *registry.RegistrySettingsService) gin.Handl
 
 		err := settingsService.EnableRegistry(c.Request.Context(), registryName, user.ID)
 		if err != nil {
-			log.Error().Err(err).Str("registry", registryName).Msg("failed to enable registry")
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to enable registry")
 			c.JSON(http.StatusBadRequest, types.APIResponse{
 				Success: false,
 				Error:   err.Error(),
@@ -153,7 +728,7 @@ func disableRegistry(settingsService *registry.RegistrySettingsService) gin.Hand
 
 		err := settingsService.DisableRegistry(c.Request.Context(), registryName, user.ID)
 		if err != nil {
-			log.Error().Err(err).Str("registry", registryName).Msg("failed to disable registry")
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to disable registry")
 			c.JSON(http.StatusBadRequest, types.APIResponse{
 				Success: false,
 				Error:   err.Error(),
@@ -188,7 +763,7 @@ func updateRegistryDescription(settingsService *registry.RegistrySettingsService
 
 		err := settingsService.UpdateRegistryDescription(c.Request.Context(), registryName, request.Description, user.ID)
 		if err != nil {
-			log.Error().Err(err).Str("registry", registryName).Msg("failed to update registry description")
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to update registry description")
 			c.JSON(http.StatusBadRequest, types.APIResponse{
 				Success: false,
 				Error:   err.Error(),
@@ -202,3 +777,144 @@ func updateRegistryDescription(settingsService *registry.RegistrySettingsService
 		})
 	}
 }
+
+// updateRegistryApproval turns the publish approval workflow on or off for a registry
+func updateRegistryApproval(settingsService *registry.RegistrySettingsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Param("registry")
+		user, _ := middleware.GetUserFromContext(c)
+
+		var request struct {
+			RequireApproval *bool `json:"require_approval" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		err := settingsService.SetRequireApproval(c.Request.Context(), registryName, *request.RequireApproval, user.ID)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to update registry approval requirement")
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Registry approval requirement updated successfully",
+		})
+	}
+}
+
+// updateRegistrySignature turns upload signature verification on or off for a registry
+func updateRegistrySignature(settingsService *registry.RegistrySettingsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Param("registry")
+		user, _ := middleware.GetUserFromContext(c)
+
+		var request struct {
+			RequireSignature *bool `json:"require_signature" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		err := settingsService.SetRequireSignature(c.Request.Context(), registryName, *request.RequireSignature, user.ID)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to update registry signature requirement")
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Registry signature requirement updated successfully",
+		})
+	}
+}
+
+// updateRegistryImmutable turns publish-once enforcement on or off for a registry
+func updateRegistryImmutable(settingsService *registry.RegistrySettingsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Param("registry")
+		user, _ := middleware.GetUserFromContext(c)
+
+		var request struct {
+			Immutable *bool `json:"immutable" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		err := settingsService.SetImmutable(c.Request.Context(), registryName, *request.Immutable, user.ID)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to update registry immutability")
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Registry immutability updated successfully",
+		})
+	}
+}
+
+// updateRegistryReadOnly turns read-only mode on or off for a registry, in
+// which it serves packages but refuses changes to them
+func updateRegistryReadOnly(settingsService *registry.RegistrySettingsService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryName := c.Param("registry")
+		user, _ := middleware.GetUserFromContext(c)
+
+		var request struct {
+			ReadOnly *bool `json:"read_only" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		err := settingsService.SetReadOnly(c.Request.Context(), registryName, *request.ReadOnly, user.ID)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryName).Msg("failed to update registry read-only mode")
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Registry read-only mode updated successfully",
+		})
+	}
+}
@@ -0,0 +1,561 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/metadata"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/internal/retention"
+	"github.com/lgulliver/lodestone/internal/webhooks"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetentionPolicyHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	require.NoError(t, registryService.DB.AutoMigrate(&types.RetentionPolicy{}))
+	retentionService := retention.NewService(registryService.DB.DB, registryService)
+	ctx := context.Background()
+
+	for _, version := range []string{"1.0.0", "1.1.0", "1.2.0"} {
+		content := createNpmTarball(t, `{"name":"kept","version":"`+version+`"}`, nil)
+		_, err := registryService.Upload(ctx, "npm", "kept", version, bytes.NewReader(content), publisher.ID)
+		require.NoError(t, err)
+	}
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.PUT("/admin/retention/:registry", setRetentionPolicy(registryService, retentionService))
+	router.POST("/admin/retention/:registry/dry-run", dryRunRetentionPolicy(registryService, retentionService))
+
+	dryRun := func(body string) (int, []retention.Candidate) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/retention/npm/dry-run", strings.NewReader(body)))
+		var response struct {
+			Data []retention.Candidate `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response.Data
+	}
+
+	// Without a saved policy or a policy in the body there is nothing to evaluate
+	code, _ := dryRun("")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, candidates := dryRun(`{"keep_last_versions":1}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, candidates, 2)
+	assert.Equal(t, "1.1.0", candidates[0].Version)
+	assert.Equal(t, "1.0.0", candidates[1].Version)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/retention/npm", strings.NewReader(`{"enabled":true,"keep_last_versions":2}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	code, candidates = dryRun("")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, "1.0.0", candidates[0].Version)
+
+	// A dry run removes nothing
+	_, err := registryService.GetArtifact(ctx, "npm", "kept", "1.0.0")
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PUT", "/admin/retention/unknown", strings.NewReader(`{}`)))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestWebhookSubscriptionHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+	require.NoError(t, registryService.DB.AutoMigrate(&types.WebhookSubscription{}))
+	webhookService := webhooks.NewService(registryService.DB.DB)
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.GET("/admin/webhooks", getWebhookSubscriptions(webhookService))
+	router.POST("/admin/webhooks", createWebhookSubscription(registryService, webhookService))
+	router.GET("/admin/webhooks/:id", getWebhookSubscription(webhookService))
+	router.PUT("/admin/webhooks/:id", updateWebhookSubscription(registryService, webhookService))
+	router.DELETE("/admin/webhooks/:id", deleteWebhookSubscription(webhookService))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	w := request("POST", "/admin/webhooks", `{"url":"https://example.com/hook","secret":"s3cret","events":["package.published"],"registries":["npm"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "s3cret", "secrets are never returned")
+
+	var created struct {
+		Data types.WebhookSubscription `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.True(t, created.Data.Active)
+	assert.Equal(t, &admin.ID, created.Data.CreatedBy)
+	path := "/admin/webhooks/" + created.Data.ID.String()
+
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/admin/webhooks", `{"url":"https://example.com/hook","secret":"s","registries":["unknown"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/admin/webhooks", `{"url":"https://example.com/hook"}`).Code)
+
+	w = request("PUT", path, `{"url":"https://example.com/other","active":false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = request("GET", path, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var fetched struct {
+		Data types.WebhookSubscription `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fetched))
+	assert.Equal(t, "https://example.com/other", fetched.Data.URL)
+	assert.False(t, fetched.Data.Active)
+
+	w = request("GET", "/admin/webhooks", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		Data []types.WebhookSubscription `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	assert.Len(t, listed.Data, 1)
+
+	assert.Equal(t, http.StatusOK, request("DELETE", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", path, "").Code)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", path, "").Code)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/admin/webhooks/not-a-uuid", "").Code)
+}
+
+func TestUserQuotaHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.GET("/admin/quotas/:user_id", getUserQuotas(registryService))
+	router.PUT("/admin/quotas/:user_id", setUserQuota(registryService))
+	router.DELETE("/admin/quotas/:user_id", deleteUserQuota(registryService))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	path := "/admin/quotas/" + publisher.ID.String()
+
+	w := request("PUT", path, `{"registry_name":"npm","max_artifacts":1}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	content := createNpmTarball(t, `{"name":"limited","version":"1.0.0"}`, nil)
+	_, err := registryService.Upload(ctx, "npm", "limited", "1.0.0", bytes.NewReader(content), publisher.ID)
+	require.NoError(t, err)
+	content = createNpmTarball(t, `{"name":"limited","version":"1.1.0"}`, nil)
+	_, err = registryService.Upload(ctx, "npm", "limited", "1.1.0", bytes.NewReader(content), publisher.ID)
+	assert.ErrorIs(t, err, registry.ErrQuotaExceeded)
+
+	w = request("GET", path, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var fetched struct {
+		Data userQuotas `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fetched))
+	require.Len(t, fetched.Data.Quotas, 1)
+	assert.Equal(t, &admin.ID, fetched.Data.Quotas[0].UpdatedBy)
+	require.Len(t, fetched.Data.Usage, 2)
+	assert.Equal(t, "npm", fetched.Data.Usage[1].RegistryName)
+	assert.Equal(t, int64(1), fetched.Data.Usage[1].Artifacts)
+
+	assert.Equal(t, http.StatusBadRequest, request("PUT", path, `{"registry_name":"unknown","max_bytes":1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("PUT", path, `{"max_bytes":-1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/admin/quotas/not-a-uuid", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/admin/quotas/"+uuid.New().String(), "").Code)
+
+	assert.Equal(t, http.StatusOK, request("DELETE", path+"?registry=npm", "").Code)
+	assert.Equal(t, http.StatusNotFound, request("DELETE", path+"?registry=npm", "").Code)
+}
+
+func TestDeletedArtifactHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	registryService.Configure(config.RegistryConfig{DeleteGracePeriod: time.Hour})
+	ctx := context.Background()
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.GET("/admin/artifacts/:registry/:name/access", getArtifactAccess(registryService))
+	router.GET("/admin/artifacts/deleted", getDeletedArtifacts(registryService))
+	router.POST("/admin/artifacts/deleted/restore", restoreArtifact(registryService))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	content := createNpmTarball(t, `{"name":"@scope/undone","version":"1.0.0"}`, nil)
+	_, err := registryService.Upload(ctx, "npm", "@scope/undone", "1.0.0", bytes.NewReader(content), publisher.ID)
+	require.NoError(t, err)
+	require.NoError(t, registryService.Delete(ctx, "npm", "@scope/undone", "1.0.0", publisher.ID))
+
+	w := request("GET", "/admin/artifacts/deleted?registry=npm", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		Data []types.Artifact `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Data, 1)
+	assert.Equal(t, "@scope/undone", listed.Data[0].Name)
+	assert.True(t, listed.Data[0].DeletedAt.Valid)
+
+	body := `{"registry":"npm","name":"@scope/undone","version":"1.0.0"}`
+	w = request("POST", "/admin/artifacts/deleted/restore", body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	_, download, err := registryService.Download(ctx, "npm", "@scope/undone", "1.0.0")
+	require.NoError(t, err)
+	download.Close()
+
+	assert.Equal(t, http.StatusNotFound, request("POST", "/admin/artifacts/deleted/restore", body).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/admin/artifacts/deleted/restore", `{"registry":"npm"}`).Code)
+}
+
+func TestAuditEntriesHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	auditLog := audit.NewService(registryService.DB.DB)
+	registryService.SetAuditLog(auditLog)
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+
+	router := gin.New()
+	router.Use(middleware.AuditSourceMiddleware())
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.PUT("/admin/registries/:registry/approval", updateRegistryApproval(registryService.Settings))
+	router.GET("/admin/audit", getAuditEntries(auditLog))
+
+	type auditPage struct {
+		Data       []types.AuditEntry    `json:"data"`
+		Pagination *types.PaginationInfo `json:"pagination"`
+	}
+	query := func(path string) (int, auditPage) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var page auditPage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		return w.Code, page
+	}
+
+	// Writes made through the API are attributed to the client
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/admin/registries/npm/approval", strings.NewReader(`{"require_approval":true}`))
+	req.RemoteAddr = "203.0.113.5:4711"
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	ctx := context.Background()
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		content := createNpmTarball(t, `{"name":"audited","version":"`+version+`"}`, nil)
+		_, err := registryService.Upload(ctx, "npm", "audited", version, bytes.NewReader(content), publisher.ID)
+		require.NoError(t, err)
+	}
+
+	code, page := query("/admin/audit")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(3), page.Pagination.Total)
+
+	code, page = query("/admin/audit?action=registry.update&actor=" + admin.ID.String())
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, "npm", page.Data[0].Target)
+	assert.Equal(t, "203.0.113.5", page.Data[0].SourceIP)
+
+	code, page = query("/admin/audit?action=package.publish&per_page=1&page=2")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, page.Data, 1)
+	assert.Equal(t, 2, page.Pagination.TotalPages)
+
+	since := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	code, page = query("/admin/audit?since=" + since)
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, page.Data)
+
+	code, _ = query("/admin/audit?actor=nobody")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = query("/admin/audit?until=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestCollectOCIGarbageHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+	auditLog := audit.NewService(registryService.DB.DB)
+	registryService.SetAuditLog(auditLog)
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+
+	handler, err := registryService.GetRegistry("oci")
+	require.NoError(t, err)
+	ociRegistry := handler.(*oci.Registry)
+	ctx := context.Background()
+	const orphan = "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	_, _, err = ociRegistry.PutBlob(ctx, "myorg/app", orphan, strings.NewReader("test"))
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.POST("/admin/oci/gc", collectOCIGarbage(registryService))
+
+	collect := func(query string) (int, *oci.GCResult) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/oci/gc"+query, nil))
+		var response struct {
+			Data *oci.GCResult `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response.Data
+	}
+
+	code, _ := collect("?grace_period=soon")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = collect("?dry_run=maybe")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	// The blob was just pushed, so is kept by the default grace period
+	code, result := collect("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Empty(t, result.DeletedBlobs)
+
+	code, result = collect("?grace_period=0s&dry_run=true")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"myorg/app@" + orphan}, result.DeletedBlobs)
+	exists, _, err := ociRegistry.BlobExists(ctx, "myorg/app", orphan)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	code, result = collect("?grace_period=0s")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"myorg/app@" + orphan}, result.DeletedBlobs)
+	exists, _, err = ociRegistry.BlobExists(ctx, "myorg/app", orphan)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// Dry runs are not audited
+	entries, total, err := auditLog.Query(ctx, audit.Filter{Action: audit.ActionOCIGarbageCollect})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.NotEmpty(t, entries)
+	assert.Equal(t, admin.ID, *entries[0].ActorID)
+}
+
+func TestReconcileStorageHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+
+	ctx := context.Background()
+	const orphan = "blobs/sha256/9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	require.NoError(t, registryService.Storage.Store(ctx, orphan, strings.NewReader("test"), "application/octet-stream"))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.POST("/admin/storage/reconcile", reconcileStorage(registryService))
+
+	reconcile := func(query string) (int, *registry.ReconcileResult) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/storage/reconcile"+query, nil))
+		var response struct {
+			Data *registry.ReconcileResult `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response.Data
+	}
+
+	code, _ := reconcile("?dry_run=maybe")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, result := reconcile("?dry_run=true")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{orphan}, result.OrphanedBlobs)
+	assert.Empty(t, result.DeletedBlobs)
+
+	code, result = reconcile("")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{orphan}, result.DeletedBlobs)
+	exists, err := registryService.Storage.Exists(ctx, orphan)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestReindexSearchHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	require.NoError(t, registryService.DB.AutoMigrate(&metadata.ArtifactIndex{}))
+	metadataService := metadata.NewService(registryService.DB.DB, &config.Config{})
+
+	_, err := registryService.Upload(context.Background(), "npm", "left-pad", "1.0.0",
+		bytes.NewReader(createNpmTarball(t, `{"name":"left-pad","version":"1.0.0","keywords":["padding"]}`, nil)), publisher.ID)
+	require.NoError(t, err)
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", admin)
+		c.Next()
+	})
+	router.POST("/admin/search/reindex", reindexSearch(registryService, metadataService))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/search/reindex?registry=nope", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/search/reindex?registry=npm", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response struct {
+		Data metadata.ReindexResult `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, metadata.ReindexResult{Registry: "npm", Indexed: 1}, response.Data)
+
+	results, err := metadataService.SearchArtifacts(context.Background(), &metadata.SearchQuery{Query: "padding", Page: 1, PerPage: 10})
+	require.NoError(t, err)
+	require.Len(t, results.Artifacts, 1)
+	assert.Equal(t, "left-pad", results.Artifacts[0].Name)
+}
+
+func TestUserManagementHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+	require.NoError(t, registryService.DB.AutoMigrate(&types.APIKey{}, &types.RefreshToken{}))
+	authService := auth.NewService(registryService.DB, nil, &config.AuthConfig{JWTSecret: "test-secret", JWTExpiration: time.Hour, BCryptCost: 4})
+	ctx := context.Background()
+
+	login := func(username, password string) string {
+		token, err := authService.Login(ctx, &types.LoginRequest{Username: username, Password: password})
+		require.NoError(t, err)
+		return token.Token
+	}
+	adminUser, err := authService.CreateUser(ctx, uuid.Nil, &types.RegisterRequest{Username: "root", Email: "root@example.com", Password: "root-password"}, true)
+	require.NoError(t, err)
+	member, err := authService.Register(ctx, &types.RegisterRequest{Username: "member", Email: "member@example.com", Password: "member-password"})
+	require.NoError(t, err)
+	adminToken := login("root", "root-password")
+	memberToken := login("member", "member-password")
+
+	router := gin.New()
+	AdminRoutes(router.Group("/api/v1"), registryService, nil, authService)
+
+	request := func(token, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/v1/admin/users"+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	memberPath := "/" + member.ID.String()
+
+	// Users without admin privileges are refused every endpoint
+	assert.Equal(t, http.StatusForbidden, request(memberToken, "GET", "/", "").Code)
+	assert.Equal(t, http.StatusForbidden, request(memberToken, "PUT", memberPath+"/admin", `{"is_admin":true}`).Code)
+	assert.Equal(t, http.StatusForbidden, request(memberToken, "POST", memberPath+"/revoke-tokens", "").Code)
+
+	w := request(adminToken, "GET", "/?per_page=1", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var listed struct {
+		Data       []types.User         `json:"data"`
+		Pagination types.PaginationInfo `json:"pagination"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Data, 1)
+	assert.Equal(t, "member", listed.Data[0].Username)
+	assert.Equal(t, int64(3), listed.Pagination.Total)
+	assert.NotContains(t, w.Body.String(), "member-password")
+
+	w = request(adminToken, "POST", "/", `{"username":"ops","email":"ops@example.com","password":"ops-password","is_admin":true}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusConflict, request(adminToken, "POST", "/", `{"username":"ops","email":"ops2@example.com","password":"ops-password"}`).Code)
+
+	// A promoted member can administer users
+	require.Equal(t, http.StatusOK, request(adminToken, "PUT", memberPath+"/admin", `{"is_admin":true}`).Code)
+	assert.Equal(t, http.StatusOK, request(memberToken, "GET", "/", "").Code)
+	require.Equal(t, http.StatusOK, request(adminToken, "PUT", memberPath+"/admin", `{"is_admin":false}`).Code)
+	assert.Equal(t, http.StatusForbidden, request(memberToken, "GET", "/", "").Code)
+
+	// A disabled member can no longer log in or use their token
+	require.Equal(t, http.StatusOK, request(adminToken, "PUT", memberPath+"/disable", "").Code)
+	_, err = authService.Login(ctx, &types.LoginRequest{Username: "member", Password: "member-password"})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, request(memberToken, "GET", "/", "").Code)
+	require.Equal(t, http.StatusOK, request(adminToken, "PUT", memberPath+"/enable", "").Code)
+
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", memberPath+"/password", `{"new_password":"short"}`).Code)
+	require.Equal(t, http.StatusOK, request(adminToken, "POST", memberPath+"/password", `{"new_password":"replacement-password"}`).Code)
+	login("member", "replacement-password")
+
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "PUT", "/"+adminUser.ID.String()+"/disable", "").Code)
+	assert.Equal(t, http.StatusNotFound, request(adminToken, "PUT", "/"+uuid.New().String()+"/admin", `{"is_admin":true}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", "/not-a-uuid/revoke-tokens", "").Code)
+}
@@ -0,0 +1,218 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/advisories"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// advisoryRequest is the body of an advisory create request
+type advisoryRequest struct {
+	Registry           string   `json:"registry" binding:"required"`
+	PackageName        string   `json:"package_name" binding:"required"`
+	VulnerableVersions string   `json:"vulnerable_versions" binding:"required"` // semver range, e.g. ">=1.0.0 <1.2.3"
+	Title              string   `json:"title" binding:"required"`
+	Severity           string   `json:"severity" binding:"required"` // info, low, moderate, high or critical
+	URL                string   `json:"url"`
+	CWE                []string `json:"cwe"`
+	CVSSScore          float64  `json:"cvss_score"`
+	CVSSVector         string   `json:"cvss_vector"`
+}
+
+// parseAdvisoryID reads the advisory ID path parameter. It writes the error
+// response and returns false if the ID is invalid.
+func parseAdvisoryID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.APIResponse{
+			Success: false,
+			Error:   "Invalid advisory ID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// writeAdvisoryError maps advisory service errors to API responses
+func writeAdvisoryError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, advisories.ErrAdvisoryNotFound):
+		c.JSON(http.StatusNotFound, types.APIResponse{
+			Success: false,
+			Error:   "Advisory not found",
+		})
+	case errors.Is(err, advisories.ErrInvalidAdvisory):
+		c.JSON(http.StatusBadRequest, types.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	default:
+		middleware.Logger(c).Error().Err(err).Msg(message)
+		c.JSON(http.StatusInternalServerError, types.APIResponse{
+			Success: false,
+			Error:   message,
+		})
+	}
+}
+
+// GetAdvisories godoc
+//
+//	@Summary		List advisories
+//	@Description	Retrieve the recorded security advisories, optionally of one registry or package
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			registry	query		string	false	"Only advisories of this registry (e.g., npm)"
+//	@Param			package		query		string	false	"Only advisories of this package"
+//	@Success		200			{object}	types.APIResponse{data=[]types.Advisory}	"Advisories retrieved successfully"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		500			{object}	types.APIResponse	"Failed to retrieve advisories"
+//	@Security		BearerAuth
+//	@Router			/admin/advisories [get]
+func getAdvisories(advisoryService *advisories.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list, err := advisoryService.ListAdvisories(c.Request.Context(), c.Query("registry"), c.Query("package"))
+		if err != nil {
+			writeAdvisoryError(c, err, "Failed to retrieve advisories")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    list,
+		})
+	}
+}
+
+// GetAdvisory godoc
+//
+//	@Summary		Get an advisory
+//	@Description	Retrieve a security advisory by ID
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			id	path		string	true	"Advisory ID"
+//	@Success		200	{object}	types.APIResponse{data=types.Advisory}	"Advisory retrieved successfully"
+//	@Failure		400	{object}	types.APIResponse	"Invalid advisory ID"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403	{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404	{object}	types.APIResponse	"Advisory not found"
+//	@Security		BearerAuth
+//	@Router			/admin/advisories/{id} [get]
+func getAdvisory(advisoryService *advisories.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseAdvisoryID(c)
+		if !ok {
+			return
+		}
+
+		advisory, err := advisoryService.GetAdvisory(c.Request.Context(), id)
+		if err != nil {
+			writeAdvisoryError(c, err, "Failed to retrieve advisory")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    advisory,
+		})
+	}
+}
+
+// CreateAdvisory godoc
+//
+//	@Summary		Create an advisory
+//	@Description	Record a security advisory for the versions of a package in a semver range. Clients auditing their dependencies, such as npm audit, are told about it when they have a version in the range
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			advisory	body		advisoryRequest	true	"Advisory"
+//	@Success		201			{object}	types.APIResponse{data=types.Advisory}	"Advisory created successfully"
+//	@Failure		400			{object}	types.APIResponse	"Invalid advisory"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Security		BearerAuth
+//	@Router			/admin/advisories [post]
+func createAdvisory(registryService *registry.Service, advisoryService *advisories.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		var request advisoryRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+		if _, err := registryService.GetRegistry(request.Registry); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Unknown registry: " + request.Registry,
+			})
+			return
+		}
+
+		advisory := &types.Advisory{
+			Registry:           request.Registry,
+			PackageName:        request.PackageName,
+			VulnerableVersions: request.VulnerableVersions,
+			Title:              request.Title,
+			Severity:           request.Severity,
+			URL:                request.URL,
+			CWE:                request.CWE,
+			CVSSScore:          request.CVSSScore,
+			CVSSVector:         request.CVSSVector,
+		}
+		if err := advisoryService.CreateAdvisory(c.Request.Context(), advisory, user.ID); err != nil {
+			writeAdvisoryError(c, err, "Failed to create advisory")
+			return
+		}
+
+		c.JSON(http.StatusCreated, types.APIResponse{
+			Success: true,
+			Message: "Advisory created successfully",
+			Data:    advisory,
+		})
+	}
+}
+
+// DeleteAdvisory godoc
+//
+//	@Summary		Delete an advisory
+//	@Description	Stop reporting a security advisory
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			id	path		string	true	"Advisory ID"
+//	@Success		200	{object}	types.APIResponse	"Advisory deleted successfully"
+//	@Failure		400	{object}	types.APIResponse	"Invalid advisory ID"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403	{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404	{object}	types.APIResponse	"Advisory not found"
+//	@Security		BearerAuth
+//	@Router			/admin/advisories/{id} [delete]
+func deleteAdvisory(advisoryService *advisories.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		id, ok := parseAdvisoryID(c)
+		if !ok {
+			return
+		}
+
+		if err := advisoryService.DeleteAdvisory(c.Request.Context(), id, user.ID); err != nil {
+			writeAdvisoryError(c, err, "Failed to delete advisory")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Advisory deleted successfully",
+		})
+	}
+}
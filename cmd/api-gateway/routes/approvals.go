@@ -0,0 +1,178 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// ApprovalRoutes sets up the publish approval workflow routes
+func ApprovalRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
+	approvals := api.Group("/approvals")
+	approvals.Use(middleware.AuthMiddleware(authService))
+
+	approvals.GET("", handleListPendingApprovals(registryService))
+	approvals.POST("/:id/approve", handleApproveArtifact(registryService))
+	approvals.POST("/:id/reject", handleRejectArtifact(registryService))
+}
+
+// RejectArtifactRequest represents a request to reject a pending artifact
+type RejectArtifactRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ListPendingApprovals godoc
+//
+//	@Summary		List pending approvals
+//	@Description	List uploaded artifacts that are waiting for an approver before they become available
+//	@Tags			Approvals
+//	@Produce		json
+//	@Param			registry	query		string	false	"Only list artifacts for this registry"
+//	@Success		200			{object}	object{artifacts=[]object,total=int}	"Pending artifacts the user can review"
+//	@Failure		401			{object}	object{error=string}					"Unauthorized"
+//	@Failure		500			{object}	object{error=string}					"Failed to list pending artifacts"
+//	@Security		BearerAuth
+//	@Router			/approvals [get]
+func handleListPendingApprovals(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+		registryType := c.Query("registry")
+
+		artifacts, err := registryService.ListPendingApprovals(c.Request.Context(), registryType)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Msg("Failed to list pending approvals")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list pending artifacts"})
+			return
+		}
+
+		// Only show artifacts from registries the user can approve for
+		visible := make([]*types.Artifact, 0, len(artifacts))
+		approverFor := make(map[string]bool)
+		for _, artifact := range artifacts {
+			canApprove, checked := approverFor[artifact.Registry]
+			if !checked {
+				canApprove, err = registryService.CanUserApprove(c.Request.Context(), artifact.Registry, user.ID)
+				if err != nil {
+					middleware.Logger(c).Error().Err(err).Str("registry", artifact.Registry).Msg("Failed to check approver permission")
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list pending artifacts"})
+					return
+				}
+				approverFor[artifact.Registry] = canApprove
+			}
+			if canApprove {
+				visible = append(visible, artifact)
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"artifacts": visible,
+			"total":     len(visible),
+		})
+	}
+}
+
+// ApproveArtifact godoc
+//
+//	@Summary		Approve pending artifact
+//	@Description	Approve an artifact awaiting review so it becomes downloadable and listed
+//	@Tags			Approvals
+//	@Produce		json
+//	@Param			id	path		string	true	"Artifact ID"
+//	@Success		200	{object}	object{message=string,artifact=object}	"Artifact approved"
+//	@Failure		400	{object}	object{error=string}					"Invalid artifact ID"
+//	@Failure		401	{object}	object{error=string}					"Unauthorized"
+//	@Failure		403	{object}	object{error=string}					"Approver role required or self-approval"
+//	@Failure		404	{object}	object{error=string}					"Pending artifact not found"
+//	@Failure		500	{object}	object{error=string}					"Failed to approve artifact"
+//	@Failure		503	{object}	object{error=string}					"Registry is disabled or read-only"
+//	@Security		BearerAuth
+//	@Router			/approvals/{id}/approve [post]
+func handleApproveArtifact(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		artifactID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid artifact ID"})
+			return
+		}
+
+		artifact, err := registryService.ApproveArtifact(c.Request.Context(), artifactID, user.ID)
+		if err != nil {
+			writeApprovalError(c, err, "failed to approve artifact")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "artifact approved",
+			"artifact": artifact,
+		})
+	}
+}
+
+// RejectArtifact godoc
+//
+//	@Summary		Reject pending artifact
+//	@Description	Reject an artifact awaiting review, removing it from the registry
+//	@Tags			Approvals
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string					true	"Artifact ID"
+//	@Param			request	body		RejectArtifactRequest	false	"Rejection reason"
+//	@Success		200		{object}	object{message=string}	"Artifact rejected"
+//	@Failure		400		{object}	object{error=string}	"Invalid artifact ID"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		403		{object}	object{error=string}	"Approver role required or self-rejection"
+//	@Failure		404		{object}	object{error=string}	"Pending artifact not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to reject artifact"
+//	@Failure		503		{object}	object{error=string}	"Registry is disabled or read-only"
+//	@Security		BearerAuth
+//	@Router			/approvals/{id}/reject [post]
+func handleRejectArtifact(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		artifactID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid artifact ID"})
+			return
+		}
+
+		// The reason is optional, so an empty body is accepted
+		var req RejectArtifactRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+				return
+			}
+		}
+
+		if err := registryService.RejectArtifact(c.Request.Context(), artifactID, user.ID, req.Reason); err != nil {
+			writeApprovalError(c, err, "failed to reject artifact")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "artifact rejected"})
+	}
+}
+
+// writeApprovalError maps approval workflow errors to HTTP responses
+func writeApprovalError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, registry.ErrApprovalNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrApprovalForbidden), errors.Is(err, registry.ErrSelfApproval):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrApprovalRegistryUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		middleware.Logger(c).Error().Err(err).Str("artifact_id", c.Param("id")).Msg(message)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestApprovalRoutes_Setup verifies that approval routes can be registered without panicking
+func TestApprovalRoutes_Setup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+
+	assert.NotPanics(t, func() {
+		ApprovalRoutes(api, &registry.Service{}, &auth.Service{})
+	})
+}
+
+func TestApprovalHandlers_ApproveFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	db := registryService.DB.DB
+	ctx := context.Background()
+
+	require.NoError(t, db.Model(&types.RegistrySetting{}).
+		Where("registry_name = ?", "npm").
+		Update("require_approval", true).Error)
+
+	approver := &types.User{Username: "approver", Email: "approver@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, db.Create(approver).Error)
+	require.NoError(t, db.Create(&types.Permission{
+		UserID:    approver.ID,
+		Resource:  "registry:npm",
+		Action:    registry.PermissionActionApprove,
+		GrantedBy: approver.ID,
+	}).Error)
+
+	content := createNpmTarball(t, `{"name":"gated","version":"1.0.0"}`, nil)
+	artifact, err := registryService.Upload(ctx, "npm", "gated", "1.0.0", bytes.NewReader(content), publisher.ID)
+	require.NoError(t, err)
+
+	newRouter := func(user *types.User) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Next()
+		})
+		router.GET("/approvals", handleListPendingApprovals(registryService))
+		router.POST("/approvals/:id/approve", handleApproveArtifact(registryService))
+		router.POST("/approvals/:id/reject", handleRejectArtifact(registryService))
+		return router
+	}
+
+	// The publisher is not an approver and sees nothing to review
+	w := httptest.NewRecorder()
+	newRouter(publisher).ServeHTTP(w, httptest.NewRequest("GET", "/approvals", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var listing struct {
+		Artifacts []types.Artifact `json:"artifacts"`
+		Total     int              `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listing))
+	assert.Equal(t, 0, listing.Total)
+
+	w = httptest.NewRecorder()
+	newRouter(publisher).ServeHTTP(w, httptest.NewRequest("POST", "/approvals/"+artifact.ID.String()+"/approve", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// The approver sees the pending artifact and approves it
+	w = httptest.NewRecorder()
+	newRouter(approver).ServeHTTP(w, httptest.NewRequest("GET", "/approvals?registry=npm", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listing))
+	require.Equal(t, 1, listing.Total)
+	assert.Equal(t, artifact.ID, listing.Artifacts[0].ID)
+
+	_, _, err = registryService.Download(ctx, "npm", "gated", "1.0.0")
+	assert.Error(t, err)
+
+	// Reviews are refused while the registry is read-only
+	require.NoError(t, registryService.Settings.SetReadOnly(ctx, "npm", true, approver.ID))
+	w = httptest.NewRecorder()
+	newRouter(approver).ServeHTTP(w, httptest.NewRequest("POST", "/approvals/"+artifact.ID.String()+"/approve", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.NoError(t, registryService.Settings.SetReadOnly(ctx, "npm", false, approver.ID))
+
+	w = httptest.NewRecorder()
+	newRouter(approver).ServeHTTP(w, httptest.NewRequest("POST", "/approvals/"+artifact.ID.String()+"/approve", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	_, reader, err := registryService.Download(ctx, "npm", "gated", "1.0.0")
+	require.NoError(t, err)
+	reader.Close()
+
+	// Once approved the artifact can no longer be rejected
+	w = httptest.NewRecorder()
+	newRouter(approver).ServeHTTP(w, httptest.NewRequest("POST", "/approvals/"+artifact.ID.String()+"/reject", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	newRouter(approver).ServeHTTP(w, httptest.NewRequest("POST", "/approvals/not-a-uuid/approve", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
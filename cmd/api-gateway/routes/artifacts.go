@@ -0,0 +1,336 @@
+package routes
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// ArtifactRoutes sets up registry-agnostic artifact routes
+func ArtifactRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
+	artifacts := api.Group("/artifacts")
+
+	artifacts.GET("/:registry/:name/versions", middleware.AuthMiddleware(authService), handleArtifactVersions(registryService))
+	artifacts.GET("/:registry/:name/icon", middleware.AuthMiddleware(authService), handleArtifactIcon(registryService))
+	artifacts.GET("/:registry/:name/:version/dependency-audit", middleware.AuthMiddleware(authService), handleDependencyAudit(registryService))
+	artifacts.GET("/:registry/:name/:version/closure", middleware.AuthMiddleware(authService), handleArtifactClosure(registryService))
+}
+
+// GetArtifactVersions godoc
+//
+//	@Summary		List package versions
+//	@Description	List the published versions of a package, latest first, optionally filtered by a semver range such as ">=1.2 <2". Prereleases are excluded when a range is given unless prerelease=true, and then only match a range naming a prerelease of the same release, as in node-semver
+//	@Tags			Artifacts
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget)"
+//	@Param			name		path		string	true	"Package name"
+//	@Param			range		query		string	false	"Semver range the versions must satisfy"
+//	@Param			prerelease	query		bool	false	"Include prerelease versions (default true without a range, false with one)"
+//	@Success		200			{object}	object{registry=string,name=string,versions=[]string}	"Matching versions"
+//	@Failure		400			{object}	object{error=string}									"Invalid range or prerelease flag"
+//	@Failure		401			{object}	object{error=string}									"Unauthorized"
+//	@Failure		404			{object}	object{error=string}									"Package not found"
+//	@Failure		500			{object}	object{error=string}									"Failed to list versions"
+//	@Security		BearerAuth
+//	@Router			/artifacts/{registry}/{name}/versions [get]
+func handleArtifactVersions(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryType := c.Param("registry")
+		name := c.Param("name")
+		versionRange := c.Query("range")
+
+		includePrerelease := versionRange == ""
+		if value := c.Query("prerelease"); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "prerelease must be true or false"})
+				return
+			}
+			includePrerelease = parsed
+		}
+
+		artifacts, err := registryService.ListAll(c.Request.Context(), &types.ArtifactFilter{Registry: registryType, Name: name})
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to list package versions")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list versions"})
+			return
+		}
+
+		// The name filter is a substring match, so keep only this package
+		versions := make([]string, 0, len(artifacts))
+		for _, artifact := range artifacts {
+			if artifact.Name == name {
+				versions = append(versions, artifact.Version)
+			}
+		}
+		if len(versions) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+
+		versions, err = utils.FilterVersions(versions, versionRange, includePrerelease)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid version range: " + err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"registry": registryType,
+			"name":     name,
+			"versions": versions,
+		})
+	}
+}
+
+// GetArtifactIcon godoc
+//
+//	@Summary		Get package icon
+//	@Description	Serve the icon embedded in the latest version of a package the caller can read, or the configured default icon
+//	@Tags			Artifacts
+//	@Produce		image/png,image/jpeg,image/gif,image/webp
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget)"
+//	@Param			name		path		string	true	"Package name"
+//	@Success		200			{file}		file					"Package icon"
+//	@Failure		401			{object}	object{error=string}	"Unauthorized"
+//	@Failure		403			{object}	object{error=string}	"API key not scoped to the package"
+//	@Failure		404			{object}	object{error=string}	"Icon not found"
+//	@Failure		500			{object}	object{error=string}	"Failed to retrieve icon"
+//	@Security		BearerAuth
+//	@Router			/artifacts/{registry}/{name}/icon [get]
+func handleArtifactIcon(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryType := c.Param("registry")
+		name := c.Param("name")
+
+		reader, contentType, err := registryService.GetIcon(c.Request.Context(), registryType, name)
+		if err != nil {
+			if errors.Is(err, registry.ErrIconNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "icon not found"})
+				return
+			}
+			if errors.Is(err, auth.ErrAPIKeyScopeForbidden) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to retrieve package icon")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve icon"})
+			return
+		}
+		defer reader.Close()
+
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Cache-Control", "private, max-age=3600")
+		c.Status(http.StatusOK)
+
+		if _, err := io.Copy(c.Writer, reader); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to stream package icon")
+		}
+	}
+}
+
+// GetDependencyAudit godoc
+//
+//	@Summary		Get dependency audit
+//	@Description	Report drift between the dependencies an artifact declares and those actually bundled in it
+//	@Tags			Artifacts
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm)"
+//	@Param			name		path		string	true	"Package name"
+//	@Param			version		path		string	true	"Package version"
+//	@Success		200			{object}	object					"Dependency audit report"
+//	@Failure		401			{object}	object{error=string}	"Unauthorized"
+//	@Failure		403			{object}	object{error=string}	"Outside the API key's scope"
+//	@Failure		404			{object}	object{error=string}	"Artifact or audit not found"
+//	@Failure		500			{object}	object{error=string}	"Failed to retrieve artifact"
+//	@Security		BearerAuth
+//	@Router			/artifacts/{registry}/{name}/{version}/dependency-audit [get]
+func handleDependencyAudit(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryType := c.Param("registry")
+		name := c.Param("name")
+		version := c.Param("version")
+
+		artifact, err := registryService.GetPublishedArtifact(c.Request.Context(), registryType, name, version)
+		if err != nil {
+			if errors.Is(err, registry.ErrArtifactNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+				return
+			}
+			if errors.Is(err, auth.ErrAPIKeyScopeForbidden) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Str("version", version).Msg("Failed to find artifact")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve artifact"})
+			return
+		}
+
+		audit, ok := artifact.Metadata["dependencyAudit"]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "dependency audit not available for this artifact"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"registry": artifact.Registry,
+			"name":     artifact.Name,
+			"version":  artifact.Version,
+			"audit":    audit,
+		})
+	}
+}
+
+// GetArtifactClosure godoc
+//
+//	@Summary		Download dependency closure
+//	@Description	Stream a tar of a package and all of its transitive dependencies published in the same registry that the caller can read, for vendoring. The archive starts with manifest.json listing each artifact, its archive path and checksum, plus any dependencies that could not be resolved and any dependency cycles. The archive does not count as a download of its artifacts. If an artifact cannot be read once streaming has begun, the connection is closed without finishing the response.
+//	@Tags			Artifacts
+//	@Produce		application/x-tar
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget)"
+//	@Param			name		path		string	true	"Package name"
+//	@Param			version		path		string	true	"Package version"
+//	@Param			depth		query		int		false	"Maximum dependency depth (default and maximum 10)"
+//	@Success		200			{file}		file					"Closure archive"
+//	@Failure		400			{object}	object{error=string}	"Invalid depth"
+//	@Failure		401			{object}	object{error=string}	"Unauthorized"
+//	@Failure		403			{object}	object{error=string}	"Outside the API key's scope or download blocked"
+//	@Failure		404			{object}	object{error=string}	"Artifact not found"
+//	@Failure		413			{object}	object{error=string}	"Closure too large"
+//	@Failure		500			{object}	object{error=string}	"Failed to resolve closure"
+//	@Security		BearerAuth
+//	@Router			/artifacts/{registry}/{name}/{version}/closure [get]
+func handleArtifactClosure(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryType := c.Param("registry")
+		name := c.Param("name")
+		version := c.Param("version")
+
+		limits := registry.DefaultClosureLimits
+		if value := c.Query("depth"); value != "" {
+			depth, err := strconv.Atoi(value)
+			if err != nil || depth < 0 || depth > limits.MaxDepth {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("depth must be between 0 and %d", limits.MaxDepth)})
+				return
+			}
+			limits.MaxDepth = depth
+		}
+
+		closure, err := registryService.ResolveClosure(c.Request.Context(), registryType, name, version, limits)
+		if err != nil {
+			if errors.Is(err, registry.ErrClosureTooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+				return
+			}
+			if errors.Is(err, registry.ErrPackageNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+				return
+			}
+			if errors.Is(err, auth.ErrAPIKeyScopeForbidden) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			if downloadBlocked(c, err) {
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Str("version", version).Msg("Failed to resolve dependency closure")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve closure"})
+			return
+		}
+
+		manifest, err := json.MarshalIndent(closure, "", "  ")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build closure manifest"})
+			return
+		}
+
+		// Open every artifact before the response starts, so missing content
+		// fails the request rather than the archive
+		contents := make([]io.ReadCloser, 0, len(closure.Artifacts))
+		defer func() {
+			for _, content := range contents {
+				content.Close()
+			}
+		}()
+		for _, entry := range closure.Artifacts {
+			content, err := registryService.OpenClosureArtifact(c.Request.Context(), entry)
+			if err != nil {
+				middleware.Logger(c).Error().Err(err).Str("registry", entry.Registry).Str("name", entry.Name).Str("version", entry.Version).Msg("Failed to open closure artifact")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read closure artifact"})
+				return
+			}
+			contents = append(contents, content)
+		}
+
+		filename := strings.NewReplacer("/", "-", "@", "").Replace(name) + "-" + version + "-closure.tar"
+		c.Header("Content-Type", "application/x-tar")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+
+		// Headers are sent by now, so failures part way through abort the
+		// response instead of ending a truncated archive as if it were whole
+		tw := tar.NewWriter(c.Writer)
+		now := time.Now()
+		if err := tw.WriteHeader(&tar.Header{Name: "manifest.json", Mode: 0644, Size: int64(len(manifest)), ModTime: now}); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to write closure manifest")
+			abortResponse(c)
+			return
+		}
+		if _, err := tw.Write(manifest); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to write closure manifest")
+			abortResponse(c)
+			return
+		}
+
+		for i, entry := range closure.Artifacts {
+			if err := writeClosureEntry(tw, entry, contents[i]); err != nil {
+				middleware.Logger(c).Error().Err(err).Str("registry", entry.Registry).Str("name", entry.Name).Str("version", entry.Version).Msg("Failed to stream closure artifact")
+				abortResponse(c)
+				return
+			}
+		}
+
+		if err := tw.Close(); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to finish closure archive")
+			abortResponse(c)
+		}
+	}
+}
+
+// writeClosureEntry streams one artifact of a closure into the archive
+func writeClosureEntry(tw *tar.Writer, entry *registry.ClosureArtifact, content io.Reader) error {
+	if err := tw.WriteHeader(&tar.Header{Name: entry.Path, Mode: 0644, Size: entry.Size, ModTime: entry.Artifact.CreatedAt}); err != nil {
+		return err
+	}
+	_, err := io.Copy(tw, content)
+	return err
+}
+
+// abortResponse closes the client connection of a response whose headers are
+// already sent, so the client sees an incomplete response rather than a
+// complete but truncated body
+func abortResponse(c *gin.Context) {
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		// Writers that cannot be taken over are left with the archive
+		// unfinished, which tar readers report
+		return
+	}
+	conn.Close()
+}
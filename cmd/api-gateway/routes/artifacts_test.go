@@ -0,0 +1,502 @@
+package routes
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupRegistryTestService creates a registry service backed by SQLite and local storage
+func setupRegistryTestService(t *testing.T) (*registry.Service, *types.User) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.BlobRef{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{}, &types.RegistrySetting{}, &types.Quota{}, &types.Permission{}, &types.AuditEntry{}, &types.PackageMetadata{}, &types.OwnershipTransfer{}, &types.Advisory{}))
+
+	for _, name := range []string{"npm", "nuget", "maven", "go", "helm", "oci", "opa", "cargo", "rubygems", "debian", "rpm"} {
+		require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: name, Enabled: true}).Error)
+	}
+
+	user := &types.User{Username: "publisher", Email: "publisher@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	return registry.NewService(&common.Database{DB: db}, localStorage), user
+}
+
+// createNupkgWithIcon builds a minimal .nupkg that embeds an icon via the <icon> element
+func createNupkgWithIcon(t *testing.T, id, version string, icon []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	nuspec, err := w.Create(id + ".nuspec")
+	require.NoError(t, err)
+	fmt.Fprintf(nuspec, `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd">
+  <metadata>
+    <id>%s</id>
+    <version>%s</version>
+    <authors>Test</authors>
+    <description>Test package</description>
+    <icon>icon.png</icon>
+  </metadata>
+</package>`, id, version)
+
+	iconFile, err := w.Create("icon.png")
+	require.NoError(t, err)
+	_, err = iconFile.Write(icon)
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// TestArtifactRoutes_Setup verifies that artifact routes can be registered without panicking
+func TestArtifactRoutes_Setup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+
+	assert.NotPanics(t, func() {
+		ArtifactRoutes(api, &registry.Service{}, &auth.Service{})
+	})
+}
+
+func TestHandleArtifactIcon_EmbeddedNuGetIcon(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	icon := []byte("\x89PNG\r\n\x1a\nembedded icon")
+	_, err := registryService.Upload(context.Background(), "nuget", "Icon.Package", "1.0.0",
+		bytes.NewReader(createNupkgWithIcon(t, "Icon.Package", "1.0.0", icon)), user.ID)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/artifacts/:registry/:name/icon", handleArtifactIcon(registryService))
+
+	req := httptest.NewRequest("GET", "/artifacts/nuget/Icon.Package/icon", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, icon, w.Body.Bytes())
+
+	// NuGet package IDs are matched however they are cased
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/artifacts/nuget/icon.package/icon", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, icon, w.Body.Bytes())
+}
+
+func TestHandleArtifactIcon_SVGIgnored(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	// An SVG named as a PNG is still recognised from its content
+	icon := []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	_, err := registryService.Upload(context.Background(), "nuget", "Svg.Package", "1.0.0",
+		bytes.NewReader(createNupkgWithIcon(t, "Svg.Package", "1.0.0", icon)), user.ID)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/artifacts/:registry/:name/icon", handleArtifactIcon(registryService))
+
+	req := httptest.NewRequest("GET", "/artifacts/nuget/Svg.Package/icon", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleArtifactIcon_RestrictedPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	icon := []byte("\x89PNG\r\n\x1a\nrestricted icon")
+	_, err := registryService.Upload(context.Background(), "nuget", "Restricted.Package", "1.0.0",
+		bytes.NewReader(createNupkgWithIcon(t, "Restricted.Package", "1.0.0", icon)), publisher.ID)
+	require.NoError(t, err)
+
+	get := func(user *types.User) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/artifacts/:registry/:name/icon", handleArtifactIcon(registryService))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/artifacts/nuget/Restricted.Package/icon", nil))
+		return w
+	}
+
+	w := get(publisher)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, icon, w.Body.Bytes())
+
+	// Users who cannot read the package cannot see its icon either
+	assert.Equal(t, http.StatusNotFound, get(outsider).Code)
+}
+
+func TestHandleArtifactIcon_DefaultFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.GET("/artifacts/:registry/:name/icon", handleArtifactIcon(registryService))
+
+	// Without a configured default the icon is not found
+	req := httptest.NewRequest("GET", "/artifacts/npm/no-icon/icon", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	defaultIcon := filepath.Join(t.TempDir(), "default.png")
+	require.NoError(t, os.WriteFile(defaultIcon, []byte("\x89PNG\r\n\x1a\ndefault icon"), 0644))
+	registryService.Configure(config.RegistryConfig{OCIStrictNames: true, DefaultIconPath: defaultIcon})
+
+	req = httptest.NewRequest("GET", "/artifacts/npm/no-icon/icon", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "\x89PNG\r\n\x1a\ndefault icon", w.Body.String())
+
+	// A default icon that is not a supported image is not served
+	require.NoError(t, os.WriteFile(defaultIcon, []byte("<svg></svg>"), 0644))
+
+	req = httptest.NewRequest("GET", "/artifacts/npm/no-icon/icon", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// createNpmTarball builds a minimal npm tarball with the given package.json and extra files
+func createNpmTarball(t *testing.T, packageJSON string, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	entries := map[string]string{"package/package.json": packageJSON}
+	for name, data := range files {
+		entries["package/"+name] = data
+	}
+	for name, data := range entries {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}))
+		_, err := tw.Write([]byte(data))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestHandleDependencyAudit_ReportsDrift(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	content := createNpmTarball(t,
+		`{"name":"drifting","version":"1.0.0","dependencies":{"lodash":"^4.17.0"},"bundledDependencies":["lodash"]}`,
+		map[string]string{
+			"node_modules/lodash/package.json": `{"name":"lodash","version":"3.10.1"}`,
+			"node_modules/chalk/package.json":  `{"name":"chalk","version":"5.0.0"}`,
+		})
+	_, err := registryService.Upload(context.Background(), "npm", "drifting", "1.0.0", bytes.NewReader(content), user.ID)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/artifacts/:registry/:name/:version/dependency-audit", handleDependencyAudit(registryService))
+
+	req := httptest.NewRequest("GET", "/artifacts/npm/drifting/1.0.0/dependency-audit", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Audit struct {
+			Status            string   `json:"status"`
+			UndeclaredBundled []string `json:"undeclaredBundled"`
+			VersionMismatches []struct {
+				Name    string `json:"name"`
+				Bundled string `json:"bundled"`
+			} `json:"versionMismatches"`
+		} `json:"audit"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "drift", response.Audit.Status)
+	assert.Equal(t, []string{"chalk"}, response.Audit.UndeclaredBundled)
+	require.Len(t, response.Audit.VersionMismatches, 1)
+	assert.Equal(t, "lodash", response.Audit.VersionMismatches[0].Name)
+	assert.Equal(t, "3.10.1", response.Audit.VersionMismatches[0].Bundled)
+
+	req = httptest.NewRequest("GET", "/artifacts/npm/drifting/2.0.0/dependency-audit", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Versions that are not published are not audited
+	require.NoError(t, registryService.DB.Model(&types.Artifact{}).Where("name = ?", "drifting").
+		Update("status", types.ArtifactStatusPendingApproval).Error)
+	req = httptest.NewRequest("GET", "/artifacts/npm/drifting/1.0.0/dependency-audit", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Lookup failures are not reported as missing artifacts
+	sqlDB, err := registryService.DB.DB.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+	req = httptest.NewRequest("GET", "/artifacts/npm/drifting/1.0.0/dependency-audit", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestHandleArtifactVersions_Range(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	publish := func(name, version string) {
+		content := createNpmTarball(t, fmt.Sprintf(`{"name":%q,"version":%q}`, name, version), nil)
+		_, err := registryService.Upload(context.Background(), "npm", name, version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+	for _, version := range []string{"1.0.0", "1.2.0", "1.5.0-beta.1", "1.9.0", "2.0.0"} {
+		publish("ranged", version)
+	}
+	// A package whose name contains the other must not leak into its versions
+	publish("ranged-extra", "1.3.0")
+
+	router := gin.New()
+	router.GET("/artifacts/:registry/:name/versions", handleArtifactVersions(registryService))
+
+	versions := func(query string) (int, []string) {
+		req := httptest.NewRequest("GET", "/artifacts/npm/ranged/versions"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Versions []string `json:"versions"`
+		}
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		}
+		return w.Code, response.Versions
+	}
+
+	code, all := versions("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []string{"2.0.0", "1.9.0", "1.5.0-beta.1", "1.2.0", "1.0.0"}, all)
+
+	_, inRange := versions("?range=" + url.QueryEscape(">=1.2 <2"))
+	assert.Equal(t, []string{"1.9.0", "1.2.0"}, inRange)
+
+	// A prerelease only matches a range naming a prerelease of its release
+	_, withPrerelease := versions("?range=" + url.QueryEscape(">=1.2 <2") + "&prerelease=true")
+	assert.Equal(t, []string{"1.9.0", "1.2.0"}, withPrerelease)
+
+	_, namedPrerelease := versions("?range=" + url.QueryEscape(">=1.5.0-beta.0 <2") + "&prerelease=true")
+	assert.Equal(t, []string{"1.9.0", "1.5.0-beta.1"}, namedPrerelease)
+
+	_, releases := versions("?prerelease=false")
+	assert.Equal(t, []string{"2.0.0", "1.9.0", "1.2.0", "1.0.0"}, releases)
+
+	code, _ = versions("?range=" + url.QueryEscape(">=banana"))
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = versions("?prerelease=maybe")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	req := httptest.NewRequest("GET", "/artifacts/npm/missing/versions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleArtifactClosure_IncludesTransitiveDependencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	publish := func(name, dependencies string) {
+		content := createNpmTarball(t, fmt.Sprintf(`{"name":%q,"version":"1.0.0","dependencies":%s}`, name, dependencies), nil)
+		_, err := registryService.Upload(context.Background(), "npm", name, "1.0.0", bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+	publish("closure-a", `{"closure-b":"^1.0.0"}`)
+	publish("closure-b", `{"closure-c":"~1.0.0"}`)
+	publish("closure-c", `{"closure-a":"1.0.0","left-pad":"^1.3.0"}`)
+
+	router := gin.New()
+	router.GET("/artifacts/:registry/:name/:version/closure", handleArtifactClosure(registryService))
+
+	req := httptest.NewRequest("GET", "/artifacts/npm/closure-a/1.0.0/closure", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-tar", w.Header().Get("Content-Type"))
+
+	entries := make(map[string][]byte)
+	var names []string
+	tr := tar.NewReader(w.Body)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries[header.Name] = data
+		names = append(names, header.Name)
+	}
+	require.NotEmpty(t, names)
+	assert.Equal(t, "manifest.json", names[0])
+
+	var manifest registry.Closure
+	require.NoError(t, json.Unmarshal(entries["manifest.json"], &manifest))
+	assert.Equal(t, "closure-a@1.0.0", manifest.Root)
+	require.Len(t, manifest.Artifacts, 3)
+	for i, name := range []string{"closure-a", "closure-b", "closure-c"} {
+		artifact := manifest.Artifacts[i]
+		assert.Equal(t, name, artifact.Name)
+		assert.Equal(t, i, artifact.Depth)
+
+		data, ok := entries[artifact.Path]
+		require.True(t, ok, "archive is missing %s", artifact.Path)
+		assert.Equal(t, artifact.Size, int64(len(data)))
+		sum := sha256.Sum256(data)
+		assert.Equal(t, artifact.SHA256, hex.EncodeToString(sum[:]))
+	}
+	assert.Equal(t, [][]string{{"closure-a@1.0.0", "closure-b@1.0.0", "closure-c@1.0.0", "closure-a@1.0.0"}}, manifest.Cycles)
+	require.Len(t, manifest.Unresolved, 1)
+	assert.Equal(t, "left-pad", manifest.Unresolved[0].Name)
+
+	req = httptest.NewRequest("GET", "/artifacts/npm/closure-a/1.0.0/closure?depth=1", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest("GET", "/artifacts/npm/closure-a/1.0.0/closure?depth=99", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req = httptest.NewRequest("GET", "/artifacts/npm/closure-a/2.0.0/closure", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleArtifactClosure_ReadsAsCaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	publish := func(name, dependencies string, public bool) {
+		content := createNpmTarball(t, fmt.Sprintf(`{"name":%q,"version":"1.0.0","dependencies":%s}`, name, dependencies), nil)
+		_, err := registryService.Upload(ctx, "npm", name, "1.0.0", bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+		if public {
+			require.NoError(t, registryService.SetPackageVisibility(ctx, "npm", name, true, user.ID))
+		}
+	}
+	publish("reads-root", `{"reads-shared":"^1.0.0","reads-private":"^1.0.0"}`, true)
+	publish("reads-shared", `{}`, true)
+	publish("reads-private", `{}`, false)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(registry.WithReader(c.Request.Context(), func() *types.User { return outsider }))
+	})
+	router.GET("/artifacts/:registry/:name/:version/closure", handleArtifactClosure(registryService))
+
+	req := httptest.NewRequest("GET", "/artifacts/npm/reads-root/1.0.0/closure", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	tr := tar.NewReader(w.Body)
+	header, err := tr.Next()
+	require.NoError(t, err)
+	require.Equal(t, "manifest.json", header.Name)
+	var manifest registry.Closure
+	require.NoError(t, json.NewDecoder(tr).Decode(&manifest))
+
+	// Packages the caller cannot read are left out as if unpublished
+	require.Len(t, manifest.Artifacts, 2)
+	assert.Equal(t, "reads-shared", manifest.Artifacts[1].Name)
+	require.Len(t, manifest.Unresolved, 1)
+	assert.Equal(t, "reads-private", manifest.Unresolved[0].Name)
+	assert.Equal(t, "not published in this registry", manifest.Unresolved[0].Reason)
+
+	// The archive does not count as downloads of its artifacts
+	for _, name := range []string{"reads-root", "reads-shared"} {
+		artifact, err := registryService.GetArtifact(ctx, "npm", name, "1.0.0")
+		require.NoError(t, err)
+		assert.Zero(t, artifact.Downloads, name)
+	}
+
+	// Missing content fails the request before the archive starts
+	shared, err := registryService.GetArtifact(ctx, "npm", "reads-shared", "1.0.0")
+	require.NoError(t, err)
+	require.NoError(t, registryService.Storage.Delete(ctx, shared.StoragePath))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/artifacts/npm/reads-root/1.0.0/closure", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+
+	// A restricted root is not found
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/artifacts/npm/reads-private/1.0.0/closure", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
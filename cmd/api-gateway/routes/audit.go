@@ -0,0 +1,111 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// GetAuditEntries godoc
+//
+//	@Summary		Query the audit trail
+//	@Description	List audited writes newest first, optionally filtered by actor, action and time range
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			actor		query		string	false	"ID of the user who made the writes"
+//	@Param			action		query		string	false	"Audited action (e.g., package.publish, apikey.revoke)"
+//	@Param			since		query		string	false	"Earliest time to include (RFC 3339)"
+//	@Param			until		query		string	false	"Time to include writes up to, exclusive (RFC 3339)"
+//	@Param			page		query		int		false	"Page number"		default(1)
+//	@Param			per_page	query		int		false	"Items per page"	default(50)
+//	@Success		200			{object}	types.PaginatedResponse{data=[]types.AuditEntry}	"Audit entries retrieved successfully"
+//	@Failure		400			{object}	types.APIResponse	"Invalid filter"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		500			{object}	types.APIResponse	"Failed to query audit trail"
+//	@Failure		503			{object}	types.APIResponse	"Audit trail not enabled"
+//	@Security		BearerAuth
+//	@Router			/admin/audit [get]
+func getAuditEntries(auditLog *audit.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auditLog == nil {
+			c.JSON(http.StatusServiceUnavailable, types.APIResponse{
+				Success: false,
+				Error:   "Audit trail not enabled",
+			})
+			return
+		}
+
+		filter := audit.Filter{Action: c.Query("action")}
+		if actor := c.Query("actor"); actor != "" {
+			actorID, err := uuid.Parse(actor)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, types.APIResponse{
+					Success: false,
+					Error:   "Invalid actor ID",
+				})
+				return
+			}
+			filter.ActorID = &actorID
+		}
+		for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			value := c.Query(param)
+			if value == "" {
+				continue
+			}
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, types.APIResponse{
+					Success: false,
+					Error:   "Invalid " + param + " time: expected RFC 3339",
+				})
+				return
+			}
+			*t = parsed
+		}
+
+		page := 1
+		perPage := 50
+		if pageStr := c.Query("page"); pageStr != "" {
+			if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+				page = p
+			}
+		}
+		if perPageStr := c.Query("per_page"); perPageStr != "" {
+			if pp, err := strconv.Atoi(perPageStr); err == nil && pp > 0 && pp <= 100 {
+				perPage = pp
+			}
+		}
+		filter.Limit = perPage
+		filter.Offset = (page - 1) * perPage
+
+		entries, total, err := auditLog.Query(c.Request.Context(), filter)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("failed to query audit trail")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to query audit trail",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.PaginatedResponse{
+			APIResponse: types.APIResponse{
+				Success: true,
+				Data:    entries,
+			},
+			Pagination: &types.PaginationInfo{
+				Page:       page,
+				PerPage:    perPage,
+				Total:      total,
+				TotalPages: int((total + int64(perPage) - 1) / int64(perPage)),
+			},
+		})
+	}
+}
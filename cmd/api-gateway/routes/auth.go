@@ -2,6 +2,7 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,7 +10,6 @@ import (
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/pkg/types"
-	"github.com/rs/zerolog/log"
 )
 
 // AuthRoutes sets up authentication-related routes
@@ -19,10 +19,13 @@ func AuthRoutes(api *gin.RouterGroup, authService *auth.Service) {
 	// Public routes
 	auth.POST("/register", handleRegister(authService))
 	auth.POST("/login", handleLogin(authService))
+	auth.POST("/refresh", handleRefresh(authService))
+	auth.POST("/logout", handleLogout(authService))
 
 	// Protected routes
 	authenticated := auth.Group("/")
 	authenticated.Use(middleware.AuthMiddleware(authService))
+	authenticated.POST("/password", handleChangePassword(authService))
 	authenticated.POST("/api-keys", handleCreateAPIKey(authService))
 	authenticated.GET("/api-keys", handleListAPIKeys(authService))
 	authenticated.DELETE("/api-keys/:id", handleRevokeAPIKey(authService))
@@ -47,7 +50,7 @@ func handleRegister(authService *auth.Service) gin.HandlerFunc {
 			requestID = uuid.New().String()
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("endpoint", "POST /auth/register").
 			Str("client_ip", c.ClientIP()).
@@ -55,7 +58,7 @@ func handleRegister(authService *auth.Service) gin.HandlerFunc {
 
 		var req types.RegisterRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Warn().
+			middleware.Logger(c).Warn().
 				Str("request_id", requestID).
 				Err(err).
 				Msg("Invalid registration request body")
@@ -67,7 +70,7 @@ func handleRegister(authService *auth.Service) gin.HandlerFunc {
 
 		user, err := authService.Register(ctx, &req)
 		if err != nil {
-			log.Error().
+			middleware.Logger(c).Error().
 				Str("request_id", requestID).
 				Str("username", req.Username).
 				Err(err).
@@ -76,7 +79,7 @@ func handleRegister(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("username", user.Username).
 			Str("user_id", user.ID.String()).
@@ -95,12 +98,12 @@ func handleRegister(authService *auth.Service) gin.HandlerFunc {
 // Login godoc
 //
 //	@Summary		User login
-//	@Description	Authenticate user and return JWT token
+//	@Description	Authenticate user and return a short-lived JWT access token and a refresh token that renews it
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			credentials	body		types.LoginRequest	true	"User login credentials"
-//	@Success		200			{object}	object{token=string,user=object{id=string}}	"Login successful"
+//	@Success		200			{object}	object{token=string,expires_at=string,refresh_token=string,refresh_expires_at=string,user=object{id=string}}	"Login successful"
 //	@Failure		400			{object}	object{error=string}	"Invalid request body"
 //	@Failure		401			{object}	object{error=string}	"Invalid credentials"
 //	@Router			/auth/login [post]
@@ -121,7 +124,10 @@ func handleLogin(authService *auth.Service) gin.HandlerFunc {
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"token": authToken.Token,
+			"token":              authToken.Token,
+			"expires_at":         authToken.ExpiresAt,
+			"refresh_token":      authToken.RefreshToken,
+			"refresh_expires_at": authToken.RefreshExpiresAt,
 			"user": gin.H{
 				"id": authToken.UserID,
 			},
@@ -129,16 +135,140 @@ func handleLogin(authService *auth.Service) gin.HandlerFunc {
 	}
 }
 
+// Refresh godoc
+//
+//	@Summary		Refresh an access token
+//	@Description	Exchange a refresh token issued at login for a new JWT access token
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			refresh	body		types.RefreshRequest	true	"Refresh token"
+//	@Success		200		{object}	object{token=string,expires_at=string,user=object{id=string}}	"Access token refreshed"
+//	@Failure		400		{object}	object{error=string}	"Invalid request body"
+//	@Failure		401		{object}	object{error=string}	"Invalid, expired or revoked refresh token"
+//	@Router			/auth/refresh [post]
+func handleRefresh(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req types.RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		authToken, err := authService.Refresh(c.Request.Context(), req.RefreshToken)
+		if err != nil {
+			if !errors.Is(err, auth.ErrInvalidRefreshToken) {
+				middleware.Logger(c).Error().Err(err).Msg("Failed to refresh access token")
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"token":      authToken.Token,
+			"expires_at": authToken.ExpiresAt,
+			"user": gin.H{
+				"id": authToken.UserID,
+			},
+		})
+	}
+}
+
+// Logout godoc
+//
+//	@Summary		Log out
+//	@Description	Revoke a refresh token so it can no longer renew access tokens
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			refresh	body		types.RefreshRequest	true	"Refresh token"
+//	@Success		200		{object}	object{message=string}	"Logged out successfully"
+//	@Failure		400		{object}	object{error=string}	"Invalid request body"
+//	@Failure		401		{object}	object{error=string}	"Invalid or already revoked refresh token"
+//	@Failure		500		{object}	object{error=string}	"Failed to log out"
+//	@Router			/auth/logout [post]
+func handleLogout(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req types.RefreshRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := authService.Logout(c.Request.Context(), req.RefreshToken); err != nil {
+			if errors.Is(err, auth.ErrInvalidRefreshToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Msg("Failed to revoke refresh token")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to log out"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Logged out successfully",
+		})
+	}
+}
+
+// ChangePassword godoc
+//
+//	@Summary		Change password
+//	@Description	Replace the authenticated user's password and sign out all of their sessions. The current password must be supplied and the new one must satisfy the server's password policy
+//	@Tags			Authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			password	body		types.ChangePasswordRequest	true	"Current and new password"
+//	@Success		200			{object}	object{message=string}	"Password changed successfully"
+//	@Failure		400			{object}	object{error=string}	"Invalid request body or password rejected by policy"
+//	@Failure		401			{object}	object{error=string}	"Unauthorized or current password incorrect"
+//	@Failure		500			{object}	object{error=string}	"Failed to change password"
+//	@Security		BearerAuth
+//	@Router			/auth/password [post]
+func handleChangePassword(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req types.ChangePasswordRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := authService.ChangePassword(c.Request.Context(), user.ID, req.CurrentPassword, req.NewPassword)
+		switch {
+		case errors.Is(err, auth.ErrInvalidCurrentPassword):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		case auth.IsPasswordPolicyError(err):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			middleware.Logger(c).Error().Err(err).Msg("Failed to change password")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Password changed successfully",
+		})
+	}
+}
+
 // CreateAPIKey godoc
 //
 //	@Summary		Create a new API key
-//	@Description	Generate a new API key for the authenticated user
+//	@Description	Generate a new API key for the authenticated user. Scopes of the form "registry" or "registry:package-glob", such as "npm:@myorg/*", limit the key to those registries and packages; a key without scopes is unrestricted
 //	@Tags			Authentication
 //	@Accept			json
 //	@Produce		json
-//	@Param			api_key	body		object{name=string,permissions=[]string}	true	"API key creation request"
+//	@Param			api_key	body		object{name=string,permissions=[]string,scopes=[]string}	true	"API key creation request"
 //	@Success		201		{object}	object{api_key=object{},key=string}	"API key created successfully"
-//	@Failure		400		{object}	object{error=string}	"Invalid request body"
+//	@Failure		400		{object}	object{error=string}	"Invalid request body or scope"
 //	@Failure		401		{object}	object{error=string}	"Unauthorized"
 //	@Failure		500		{object}	object{error=string}	"Failed to create API key"
 //	@Security		BearerAuth
@@ -154,6 +284,7 @@ func handleCreateAPIKey(authService *auth.Service) gin.HandlerFunc {
 		var req struct {
 			Name        string   `json:"name" binding:"required"`
 			Permissions []string `json:"permissions"`
+			Scopes      []string `json:"scopes"`
 		}
 
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -163,7 +294,11 @@ func handleCreateAPIKey(authService *auth.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "user_id", user.ID)
 
-		apiKey, keyValue, err := authService.CreateAPIKey(ctx, user.ID, req.Name, req.Permissions)
+		apiKey, keyValue, err := authService.CreateAPIKey(ctx, user.ID, req.Name, req.Permissions, req.Scopes)
+		if errors.Is(err, auth.ErrInvalidAPIKeyScope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create API key"})
 			return
@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// BrowseRoutes sets up the format-agnostic package browsing routes used by
+// the web UI
+func BrowseRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
+	browse := api.Group("/browse")
+	browse.Use(middleware.AuthMiddleware(authService), middleware.PackageReaderMiddleware())
+
+	browse.GET("/registries", handleBrowseRegistries(registryService))
+	browse.GET("/registries/:registry/packages", handleBrowsePackages(registryService))
+	browse.GET("/registries/:registry/packages/:name", handleBrowsePackage(registryService))
+	browse.GET("/registries/:registry/packages/:name/versions/:version", handleBrowseVersion(registryService))
+}
+
+// BrowseRegistries godoc
+//
+//	@Summary		List registries
+//	@Description	List every registry format with whether it is enabled and how many packages it holds
+//	@Tags			Browse
+//	@Produce		json
+//	@Success		200	{object}	types.APIResponse{data=[]types.BrowseRegistry}	"Registries"
+//	@Failure		401	{object}	types.APIResponse								"Unauthorized"
+//	@Failure		500	{object}	types.APIResponse								"Failed to list registries"
+//	@Security		BearerAuth
+//	@Router			/browse/registries [get]
+func handleBrowseRegistries(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registries, err := registryService.ListRegistries(c.Request.Context())
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("Failed to list registries")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "failed to list registries",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    registries,
+		})
+	}
+}
+
+// BrowsePackages godoc
+//
+//	@Summary		List packages in a registry
+//	@Description	List the packages published to a registry, ordered by name, with their latest version and total downloads
+//	@Tags			Browse
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget)"
+//	@Param			q			query		string	false	"Only packages whose name contains this term"
+//	@Param			page		query		int		false	"Page number"
+//	@Param			per_page	query		int		false	"Results per page (max 100)"
+//	@Success		200			{object}	types.PaginatedResponse{data=[]types.BrowsePackage}	"Packages"
+//	@Failure		401			{object}	types.APIResponse									"Unauthorized"
+//	@Failure		404			{object}	types.APIResponse									"Unknown registry"
+//	@Failure		500			{object}	types.APIResponse									"Failed to list packages"
+//	@Security		BearerAuth
+//	@Router			/browse/registries/{registry}/packages [get]
+func handleBrowsePackages(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryType := c.Param("registry")
+		if _, err := registryService.GetRegistry(registryType); err != nil {
+			c.JSON(http.StatusNotFound, types.APIResponse{
+				Success: false,
+				Error:   "unknown registry",
+			})
+			return
+		}
+
+		page, perPage := 1, 20
+		if pageStr := c.Query("page"); pageStr != "" {
+			if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+				page = p
+			}
+		}
+		if perPageStr := c.Query("per_page"); perPageStr != "" {
+			if pp, err := strconv.Atoi(perPageStr); err == nil && pp > 0 && pp <= 100 {
+				perPage = pp
+			}
+		}
+
+		packages, total, err := registryService.ListPackages(c.Request.Context(), registryType, c.Query("q"), page, perPage)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Msg("Failed to list packages")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "failed to list packages",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.PaginatedResponse{
+			APIResponse: types.APIResponse{
+				Success: true,
+				Data:    packages,
+			},
+			Pagination: &types.PaginationInfo{
+				Page:       page,
+				PerPage:    perPage,
+				Total:      total,
+				TotalPages: int((total + int64(perPage) - 1) / int64(perPage)),
+			},
+		})
+	}
+}
+
+// BrowsePackage godoc
+//
+//	@Summary		Get package summary
+//	@Description	Summarise a package: description, latest version, all published versions, total downloads and owners
+//	@Tags			Browse
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget)"
+//	@Param			name		path		string	true	"Package name"
+//	@Success		200			{object}	types.APIResponse{data=types.BrowsePackageSummary}	"Package summary"
+//	@Failure		401			{object}	types.APIResponse									"Unauthorized"
+//	@Failure		404			{object}	types.APIResponse									"Package not found"
+//	@Failure		500			{object}	types.APIResponse									"Failed to get package"
+//	@Security		BearerAuth
+//	@Router			/browse/registries/{registry}/packages/{name} [get]
+func handleBrowsePackage(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryType := c.Param("registry")
+		name := c.Param("name")
+
+		summary, err := registryService.GetPackageSummary(c.Request.Context(), registryType, name)
+		if err != nil {
+			if errors.Is(err, registry.ErrPackageNotFound) {
+				c.JSON(http.StatusNotFound, types.APIResponse{
+					Success: false,
+					Error:   "package not found",
+				})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to get package summary")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "failed to get package",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    summary,
+		})
+	}
+}
+
+// BrowseVersion godoc
+//
+//	@Summary		Get package version detail
+//	@Description	Describe a published package version: metadata, stored files, declared dependencies and dates
+//	@Tags			Browse
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget)"
+//	@Param			name		path		string	true	"Package name"
+//	@Param			version		path		string	true	"Package version"
+//	@Success		200			{object}	types.APIResponse{data=types.BrowseVersionDetail}	"Version detail"
+//	@Failure		401			{object}	types.APIResponse									"Unauthorized"
+//	@Failure		404			{object}	types.APIResponse									"Version not found"
+//	@Security		BearerAuth
+//	@Router			/browse/registries/{registry}/packages/{name}/versions/{version} [get]
+func handleBrowseVersion(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		detail, err := registryService.GetVersionDetail(c.Request.Context(), c.Param("registry"), c.Param("name"), c.Param("version"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, types.APIResponse{
+				Success: false,
+				Error:   "version not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    detail,
+		})
+	}
+}
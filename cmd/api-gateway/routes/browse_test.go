@@ -0,0 +1,267 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBrowseRoutes_Setup verifies that browse routes can be registered without panicking
+func TestBrowseRoutes_Setup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+
+	assert.NotPanics(t, func() {
+		BrowseRoutes(api, &registry.Service{}, &auth.Service{})
+	})
+}
+
+// setupBrowseRouter seeds npm packages and returns a router serving the
+// browse handlers
+func setupBrowseRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	publish := func(name, version, dependencies string) {
+		content := createNpmTarball(t, fmt.Sprintf(`{"name":%q,"version":%q,"description":"The %s package","dependencies":%s}`, name, version, name, dependencies), nil)
+		_, err := registryService.Upload(ctx, "npm", name, version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+	publish("browse-app", "1.0.0", `{}`)
+	publish("browse-app", "1.1.0", `{"browse-lib":"^2.0.0","left-pad":"~1.3.0"}`)
+	publish("browse-app", "2.0.0-beta.1", `{}`)
+	publish("browse-lib", "2.0.0", `{}`)
+	publish("other", "0.1.0", `{}`)
+
+	// Versions awaiting approval are not browsable
+	require.NoError(t, registryService.DB.Create(&types.Artifact{
+		Name: "browse-app", Version: "3.0.0", Registry: "npm", StoragePath: "npm/browse-app/3.0.0",
+		PublishedBy: user.ID, Status: types.ArtifactStatusPendingApproval,
+	}).Error)
+	require.NoError(t, registryService.DB.Model(&types.Artifact{}).
+		Where("name = ? AND version = ?", "browse-app", "1.0.0").Update("downloads", 7).Error)
+
+	maintainer := &types.User{Username: "maintainer", Email: "maintainer@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(maintainer).Error)
+	require.NoError(t, registryService.DB.Create(&types.PackageOwnership{
+		PackageKey: "npm:browse-app", UserID: maintainer.ID, Role: registry.RoleMaintainer, GrantedBy: user.ID, GrantedAt: time.Now().Add(time.Hour),
+	}).Error)
+
+	router := gin.New()
+	browse := router.Group("/browse")
+	browse.GET("/registries", handleBrowseRegistries(registryService))
+	browse.GET("/registries/:registry/packages", handleBrowsePackages(registryService))
+	browse.GET("/registries/:registry/packages/:name", handleBrowsePackage(registryService))
+	browse.GET("/registries/:registry/packages/:name/versions/:version", handleBrowseVersion(registryService))
+	return router
+}
+
+// getBrowse performs a GET and decodes the data and pagination of the response
+func getBrowse(t *testing.T, router *gin.Engine, path string, data interface{}) (int, *types.PaginationInfo) {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	response := struct {
+		Success    bool                  `json:"success"`
+		Data       json.RawMessage       `json:"data"`
+		Pagination *types.PaginationInfo `json:"pagination"`
+	}{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if w.Code == http.StatusOK {
+		assert.True(t, response.Success)
+		require.NoError(t, json.Unmarshal(response.Data, data))
+	}
+	return w.Code, response.Pagination
+}
+
+func TestBrowse_Registries(t *testing.T) {
+	router := setupBrowseRouter(t)
+
+	var registries []types.BrowseRegistry
+	code, _ := getBrowse(t, router, "/browse/registries", &registries)
+	require.Equal(t, http.StatusOK, code)
+
+	counts := make(map[string]int64)
+	for _, reg := range registries {
+		assert.True(t, reg.Enabled, reg.Name)
+		counts[reg.Name] = reg.PackageCount
+	}
+	assert.Len(t, registries, 11)
+	assert.Equal(t, int64(3), counts["npm"])
+	assert.Equal(t, int64(0), counts["nuget"])
+}
+
+func TestBrowse_Packages(t *testing.T) {
+	router := setupBrowseRouter(t)
+
+	var packages []types.BrowsePackage
+	code, pagination := getBrowse(t, router, "/browse/registries/npm/packages", &packages)
+	require.Equal(t, http.StatusOK, code)
+	require.NotNil(t, pagination)
+	assert.Equal(t, int64(3), pagination.Total)
+	require.Len(t, packages, 3)
+	assert.Equal(t, "browse-app", packages[0].Name)
+	assert.Equal(t, "1.1.0", packages[0].LatestVersion)
+	assert.Equal(t, 3, packages[0].VersionCount)
+	assert.Equal(t, int64(7), packages[0].Downloads)
+	assert.Equal(t, "The browse-app package", packages[0].Description)
+
+	// Paging walks the name-ordered listing
+	code, pagination = getBrowse(t, router, "/browse/registries/npm/packages?per_page=2&page=2", &packages)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, pagination.TotalPages)
+	require.Len(t, packages, 1)
+	assert.Equal(t, "other", packages[0].Name)
+
+	code, pagination = getBrowse(t, router, "/browse/registries/npm/packages?q=BROWSE", &packages)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(2), pagination.Total)
+	require.Len(t, packages, 2)
+	assert.Equal(t, "browse-lib", packages[1].Name)
+
+	code, _ = getBrowse(t, router, "/browse/registries/unknown/packages", &packages)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestBrowse_PackageSummary(t *testing.T) {
+	router := setupBrowseRouter(t)
+
+	var summary types.BrowsePackageSummary
+	code, _ := getBrowse(t, router, "/browse/registries/npm/packages/browse-app", &summary)
+	require.Equal(t, http.StatusOK, code)
+
+	assert.Equal(t, "1.1.0", summary.LatestVersion)
+	assert.Equal(t, "The browse-app package", summary.Description)
+	assert.Equal(t, int64(7), summary.Downloads)
+
+	versions := make([]string, 0, len(summary.Versions))
+	for _, version := range summary.Versions {
+		versions = append(versions, version.Version)
+	}
+	assert.Equal(t, []string{"2.0.0-beta.1", "1.1.0", "1.0.0"}, versions)
+
+	assert.Equal(t, []types.BrowseOwner{
+		{Username: "publisher", Role: registry.RoleOwner},
+		{Username: "maintainer", Role: registry.RoleMaintainer},
+	}, summary.Owners)
+
+	code, _ = getBrowse(t, router, "/browse/registries/npm/packages/missing", &summary)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestBrowse_VersionDetail(t *testing.T) {
+	router := setupBrowseRouter(t)
+
+	var detail types.BrowseVersionDetail
+	code, _ := getBrowse(t, router, "/browse/registries/npm/packages/browse-app/versions/1.1.0", &detail)
+	require.Equal(t, http.StatusOK, code)
+
+	assert.Equal(t, "1.1.0", detail.Version)
+	assert.Equal(t, "publisher", detail.Publisher)
+	assert.False(t, detail.PublishedAt.IsZero())
+	assert.Equal(t, "The browse-app package", detail.Metadata["description"])
+	assert.Equal(t, []types.BrowseDependency{
+		{Name: "browse-lib", Constraint: "^2.0.0"},
+		{Name: "left-pad", Constraint: "~1.3.0"},
+	}, detail.Dependencies)
+	require.Len(t, detail.Files, 1)
+	assert.NotEmpty(t, detail.Files[0].SHA256)
+	assert.Positive(t, detail.Files[0].Size)
+
+	code, _ = getBrowse(t, router, "/browse/registries/npm/packages/browse-app/versions/3.0.0", &detail)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestBrowse_RestrictedPackages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	for _, name := range []string{"restricted", "shared"} {
+		content := createNpmTarball(t, fmt.Sprintf(`{"name":%q,"version":"1.0.0"}`, name), nil)
+		_, err := registryService.Upload(context.Background(), "npm", name, "1.0.0", bytes.NewReader(content), publisher.ID)
+		require.NoError(t, err)
+	}
+	require.NoError(t, registryService.SetPackageVisibility(context.Background(), "npm", "shared", true, publisher.ID))
+
+	routerFor := func(user *types.User) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+		}, middleware.PackageReaderMiddleware())
+		browse := router.Group("/browse")
+		browse.GET("/registries", handleBrowseRegistries(registryService))
+		browse.GET("/registries/:registry/packages", handleBrowsePackages(registryService))
+		browse.GET("/registries/:registry/packages/:name", handleBrowsePackage(registryService))
+		browse.GET("/registries/:registry/packages/:name/versions/:version", handleBrowseVersion(registryService))
+		return router
+	}
+
+	packageNames := func(router *gin.Engine) ([]string, int64) {
+		var packages []types.BrowsePackage
+		code, pagination := getBrowse(t, router, "/browse/registries/npm/packages", &packages)
+		require.Equal(t, http.StatusOK, code)
+		names := make([]string, 0, len(packages))
+		for _, pkg := range packages {
+			names = append(names, pkg.Name)
+		}
+		return names, pagination.Total
+	}
+	npmCount := func(router *gin.Engine) int64 {
+		var registries []types.BrowseRegistry
+		code, _ := getBrowse(t, router, "/browse/registries", &registries)
+		require.Equal(t, http.StatusOK, code)
+		for _, reg := range registries {
+			if reg.Name == "npm" {
+				return reg.PackageCount
+			}
+		}
+		return 0
+	}
+
+	router := routerFor(publisher)
+	names, total := packageNames(router)
+	assert.Equal(t, []string{"restricted", "shared"}, names)
+	assert.Equal(t, int64(2), total)
+	assert.Equal(t, int64(2), npmCount(router))
+	var summary types.BrowsePackageSummary
+	code, _ := getBrowse(t, router, "/browse/registries/npm/packages/restricted", &summary)
+	assert.Equal(t, http.StatusOK, code)
+
+	// Users who cannot read a package neither see it listed nor find it
+	router = routerFor(outsider)
+	names, total = packageNames(router)
+	assert.Equal(t, []string{"shared"}, names)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, int64(1), npmCount(router))
+	code, _ = getBrowse(t, router, "/browse/registries/npm/packages/restricted", &summary)
+	assert.Equal(t, http.StatusNotFound, code)
+	var detail types.BrowseVersionDetail
+	code, _ = getBrowse(t, router, "/browse/registries/npm/packages/restricted/versions/1.0.0", &detail)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = getBrowse(t, router, "/browse/registries/npm/packages/shared/versions/1.0.0", &detail)
+	assert.Equal(t, http.StatusOK, code)
+}
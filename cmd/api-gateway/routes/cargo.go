@@ -2,21 +2,29 @@ package routes
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/cargo"
 	"github.com/lgulliver/lodestone/pkg/types"
 )
 
 // CargoRoutes sets up Rust Cargo registry routes
 func CargoRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	cargo := api.Group("/cargo")
+	cargo.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("cargo")))
+
+	// Sparse index, which Cargo reads as sparse+<base URL>/cargo/index/
+	cargo.GET("/index/*path", middleware.AuthMiddleware(authService), handleCargoIndex(registryService))
 
 	// Cargo registry API - requires authentication
 	cargo.GET("/api/v1/crates", middleware.AuthMiddleware(authService), handleCargoSearch(registryService))
@@ -25,24 +33,123 @@ func CargoRoutes(api *gin.RouterGroup, registryService *registry.Service, authSe
 
 	// Crate publish (requires authentication)
 	cargo.PUT("/api/v1/crates/new", middleware.AuthMiddleware(authService), handleCargoPublish(registryService))
-	cargo.DELETE("/api/v1/crates/:crate/:version/yank", middleware.AuthMiddleware(authService), handleCargoYank(registryService))
+	cargo.DELETE("/api/v1/crates/:crate/:version/yank", middleware.AuthMiddleware(authService), handleCargoYank(registryService, true))
+	cargo.PUT("/api/v1/crates/:crate/:version/yank", middleware.AuthMiddleware(authService), handleCargoYank(registryService, true))
+	cargo.PUT("/api/v1/crates/:crate/:version/unyank", middleware.AuthMiddleware(authService), handleCargoYank(registryService, false))
+}
+
+// cargoRegistry returns the Cargo handler registered with the service
+func cargoRegistry(registryService *registry.Service) (*cargo.Registry, error) {
+	handler, err := registryService.GetRegistry("cargo")
+	if err != nil {
+		return nil, err
+	}
+	cargoHandler, ok := handler.(*cargo.Registry)
+	if !ok {
+		return nil, fmt.Errorf("cargo registry handler unavailable")
+	}
+	return cargoHandler, nil
+}
+
+// handleCargoIndex serves the sparse index: the registry's config.json, and
+// a file per crate at the path IndexPath buckets it under. Crates the request
+// cannot read are answered as not found. Clients revalidate their cached
+// index files with their entity tags.
+func handleCargoIndex(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file := strings.TrimPrefix(c.Param("path"), "/")
+		if file == "config.json" {
+			c.JSON(http.StatusOK, cargoIndexConfig(c))
+			return
+		}
+
+		crateName := path.Base(file)
+		if cargo.IndexPath(crateName) != strings.ToLower(file) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "crate not found"})
+			return
+		}
+
+		cargoHandler, err := cargoRegistry(registryService)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		readable, err := registryService.CanReadPackage(c.Request.Context(), "cargo", crateName)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("crate", crateName).Msg("Failed to check crate read access")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check crate access"})
+			return
+		}
+		if !readable {
+			c.JSON(http.StatusNotFound, gin.H{"error": "crate not found"})
+			return
+		}
+
+		index, err := cargoHandler.IndexFile(c.Request.Context(), crateName)
+		if errors.Is(err, cargo.ErrCrateNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "crate not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate index"})
+			return
+		}
+
+		etag := fmt.Sprintf(`"%x"`, sha256.Sum256(index))
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "no-cache")
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", index)
+	}
 }
 
+// cargoIndexConfig returns the config.json of the sparse index, pointing
+// Cargo at the API and crate downloads of the registry the index was
+// requested from
+func cargoIndexConfig(c *gin.Context) *cargo.CargoRegistryConfig {
+	base := middleware.BaseURL(c) + strings.TrimSuffix(c.Request.URL.Path, "/index/config.json")
+
+	// Cargo appends /{crate}/{version}/download to the download URL
+	return &cargo.CargoRegistryConfig{
+		DL:           base + "/api/v1/crates",
+		API:          base,
+		AuthRequired: true,
+	}
+}
+
+// maxCargoSearchPerPage caps the page size a search client may request, as
+// crates.io does
+const maxCargoSearchPerPage = 100
+
 func handleCargoSearch(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		query := c.Query("q")
 
+		perPage, err := strconv.Atoi(c.DefaultQuery("per_page", "10"))
+		if err != nil || perPage < 1 {
+			perPage = 10
+		}
+		if perPage > maxCargoSearchPerPage {
+			perPage = maxCargoSearchPerPage
+		}
+
 		ctx := context.WithValue(c.Request.Context(), "registry", "cargo")
 
 		filter := &types.ArtifactFilter{
 			Registry: "cargo",
+			Limit:    perPage,
 		}
 
 		if query != "" {
 			filter.Name = query
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, total, err := registryService.List(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
 			return
@@ -68,7 +175,7 @@ func handleCargoSearch(registryService *registry.Service) gin.HandlerFunc {
 		c.JSON(http.StatusOK, gin.H{
 			"crates": crates,
 			"meta": gin.H{
-				"total": len(crates),
+				"total": total,
 			},
 		})
 	}
@@ -89,7 +196,7 @@ func handleCargoInfo(registryService *registry.Service) gin.HandlerFunc {
 			Registry: "cargo",
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, err := registryService.ListAll(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get crate info"})
 			return
@@ -107,7 +214,7 @@ func handleCargoInfo(registryService *registry.Service) gin.HandlerFunc {
 				"num":        artifact.Version,
 				"dl_path":    fmt.Sprintf("/cargo/api/v1/crates/%s/%s/download", crateName, artifact.Version),
 				"created_at": artifact.CreatedAt,
-				"yanked":     false, // TODO: implement yanking
+				"yanked":     registry.IsYanked(artifact),
 			})
 		}
 
@@ -132,24 +239,22 @@ func handleCargoDownload(registryService *registry.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "cargo")
 
-		artifact, content, err := registryService.Download(ctx, "cargo", crateName, version)
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "cargo", crateName, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "crate not found"})
 			return
 		}
 
-		c.Header("Content-Type", "application/gzip")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.crate", crateName, version))
-
-		if artifact.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
-		}
-
 		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream crate"})
-			return
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("crate", crateName).Str("version", version).Msg("Failed to stream crate")
 		}
 	}
 }
@@ -164,6 +269,9 @@ func handleCargoPublish(registryService *registry.Service) gin.HandlerFunc {
 
 		// Cargo publish sends the crate as multipart form data
 		file, header, err := c.Request.FormFile("crate")
+		if requestTooLarge(c, err) {
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "crate file required"})
 			return
@@ -192,8 +300,7 @@ func handleCargoPublish(registryService *registry.Service) gin.HandlerFunc {
 		crateName := strings.Join(parts[:len(parts)-1], "-")
 
 		_, err = registryService.Upload(ctx, "cargo", crateName, version, file, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+		if _, ok := uploadStatus(c, err, http.StatusOK); !ok {
 			return
 		}
 
@@ -207,7 +314,9 @@ func handleCargoPublish(registryService *registry.Service) gin.HandlerFunc {
 	}
 }
 
-func handleCargoYank(registryService *registry.Service) gin.HandlerFunc {
+// handleCargoYank yanks a crate version, as cargo yank does, or unyanks it,
+// as cargo yank --undo does. Yanked versions stay downloadable.
+func handleCargoYank(registryService *registry.Service, yanked bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
@@ -226,11 +335,8 @@ func handleCargoYank(registryService *registry.Service) gin.HandlerFunc {
 		ctx := context.WithValue(c.Request.Context(), "registry", "cargo")
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 
-		// For now, yanking is equivalent to deletion
-		// In a real implementation, you'd mark the version as yanked instead
-		err := registryService.Delete(ctx, "cargo", crateName, version, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to yank crate"})
+		if _, err := registryService.Yank(ctx, "cargo", crateName, version, yanked, user.ID); err != nil {
+			yankErrorStatus(c, err)
 			return
 		}
 
@@ -239,3 +345,15 @@ func handleCargoYank(registryService *registry.Service) gin.HandlerFunc {
 		})
 	}
 }
+
+// yankErrorStatus responds to a failed yank or unyank
+func yankErrorStatus(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, registry.ErrArtifactNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrYankForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update yanked version"})
+	}
+}
@@ -0,0 +1,208 @@
+package routes
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry/registries/cargo"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createCrate builds a minimal .crate with the given normalized Cargo.toml
+func createCrate(t *testing.T, name, version, cargoToml string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name + "-" + version + "/Cargo.toml", Mode: 0644, Size: int64(len(cargoToml))}))
+	_, err := tw.Write([]byte(cargoToml))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestCargoSparseIndex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	for _, version := range []string{"1.0.0", "1.0.1"} {
+		content := createCrate(t, "serde", version, `[package]
+name = "serde"
+version = "`+version+`"
+
+[dependencies.serde_derive]
+version = "=`+version+`"
+optional = true
+
+[features]
+default = ["std"]
+std = []
+derive = ["serde_derive"]
+`)
+		_, err := registryService.Upload(context.Background(), "cargo", "serde", version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+
+	// httptest requests come from 192.0.2.1, the proxy in front of the gateway
+	trusted, err := middleware.ParseTrustedProxies([]string{"192.0.2.1"})
+	require.NoError(t, err)
+	router := gin.New()
+	router.Use(middleware.ForwardedHeaders(trusted))
+	router.GET("/api/v1/cargo/index/*path", handleCargoIndex(registryService))
+	get := func(path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/v1/cargo/index/config.json", "X-Forwarded-Proto", "https")
+	require.Equal(t, http.StatusOK, w.Code)
+	var config map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &config))
+	assert.Equal(t, "https://example.com/api/v1/cargo/api/v1/crates", config["dl"])
+	assert.Equal(t, "https://example.com/api/v1/cargo", config["api"])
+	assert.Equal(t, true, config["auth-required"])
+
+	w = get("/api/v1/cargo/index/se/rd/serde")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var entry cargo.CargoIndexEntry
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, "serde", entry.Name)
+	assert.Equal(t, "1.0.1", entry.Vers)
+	assert.Len(t, entry.Cksum, 64)
+	assert.False(t, entry.Yanked)
+	assert.Equal(t, []string{"serde_derive"}, entry.Features["derive"])
+	require.Len(t, entry.Deps, 1)
+	assert.Equal(t, "=1.0.1", entry.Deps[0].Req)
+	assert.True(t, entry.Deps[0].Optional)
+
+	// Unchanged index files are revalidated rather than downloaded again
+	assert.Equal(t, http.StatusNotModified, get("/api/v1/cargo/index/se/rd/serde", "If-None-Match", etag).Code)
+
+	// Crates are only found under the path their name is bucketed under
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/cargo/index/3/s/serde").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/v1/cargo/index/to/ki/tokio").Code)
+}
+
+func TestCargoSparseIndex_RestrictedCrate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	content := createCrate(t, "secret", "1.0.0", "[package]\nname = \"secret\"\nversion = \"1.0.0\"\n")
+	_, err := registryService.Upload(context.Background(), "cargo", "secret", "1.0.0", bytes.NewReader(content), publisher.ID)
+	require.NoError(t, err)
+
+	get := func(user *types.User) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if user != nil {
+				c.Set("user", user)
+			}
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/cargo/index/*path", handleCargoIndex(registryService))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/cargo/index/se/cr/secret", nil))
+		return w
+	}
+
+	w := get(publisher)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"vers":"1.0.0"`)
+
+	// Users who cannot read the crate cannot see its versions or checksums
+	assert.Equal(t, http.StatusNotFound, get(outsider).Code)
+	assert.Equal(t, http.StatusNotFound, get(nil).Code)
+}
+
+func TestCargoYank(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		content := createCrate(t, "anyhow", version, "[package]\nname = \"anyhow\"\nversion = \""+version+"\"\n")
+		_, err := registryService.Upload(ctx, "cargo", "anyhow", version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(other).Error)
+
+	actor := user
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", actor)
+		c.Next()
+	})
+	router.GET("/cargo/index/*path", handleCargoIndex(registryService))
+	router.GET("/cargo/api/v1/crates/:crate/:version/download", handleCargoDownload(registryService))
+	router.DELETE("/cargo/api/v1/crates/:crate/:version/yank", handleCargoYank(registryService, true))
+	router.PUT("/cargo/api/v1/crates/:crate/:version/unyank", handleCargoYank(registryService, false))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	yanked := func() map[string]bool {
+		w := serve("GET", "/cargo/index/an/yh/anyhow")
+		require.Equal(t, http.StatusOK, w.Code)
+		result := make(map[string]bool)
+		for _, line := range strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n") {
+			var entry cargo.CargoIndexEntry
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			result[entry.Vers] = entry.Yanked
+		}
+		return result
+	}
+	latest := func() string {
+		summary, err := registryService.GetPackageSummary(ctx, "cargo", "anyhow")
+		require.NoError(t, err)
+		return summary.LatestVersion
+	}
+
+	// Only owners can yank
+	actor = other
+	assert.Equal(t, http.StatusForbidden, serve("DELETE", "/cargo/api/v1/crates/anyhow/1.1.0/yank").Code)
+	actor = user
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/cargo/api/v1/crates/anyhow/9.9.9/yank").Code)
+
+	w := serve("DELETE", "/cargo/api/v1/crates/anyhow/1.1.0/yank")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, map[string]bool{"1.0.0": false, "1.1.0": true}, yanked())
+	assert.Equal(t, "1.0.0", latest(), "yanked versions are not the latest")
+
+	// Builds that locked the yanked version can still download it
+	w = serve("GET", "/cargo/api/v1/crates/anyhow/1.1.0/download")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Body.Bytes())
+
+	w = serve("PUT", "/cargo/api/v1/crates/anyhow/1.1.0/unyank")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, map[string]bool{"1.0.0": false, "1.1.0": false}, yanked())
+	assert.Equal(t, "1.1.0", latest())
+}
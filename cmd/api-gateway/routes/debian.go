@@ -0,0 +1,360 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/debian"
+	"github.com/lgulliver/lodestone/pkg/signing"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// maxDebianPackageSize bounds the size of an uploaded .deb read into memory
+const maxDebianPackageSize = 512 << 20
+
+// DebianRoutes sets up Debian APT repository routes. Clients use the
+// repository with: deb <base>/api/v1/debian stable main
+func DebianRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
+	deb := api.Group("/debian")
+	deb.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("debian")))
+
+	// APT repository layout - requires authentication (apt sends credentials from auth.conf)
+	deb.GET("/dists/*path", middleware.AuthMiddleware(authService), handleDebianDists(registryService))
+	deb.GET("/pool/*path", middleware.AuthMiddleware(authService), handleDebianPool(registryService))
+	deb.GET("/key.asc", middleware.AuthMiddleware(authService), handleDebianKey(registryService))
+
+	// Package management (requires authentication)
+	deb.POST("/api/packages", middleware.AuthMiddleware(authService), handleDebianUpload(registryService))
+	deb.DELETE("/api/packages/:package/:version", middleware.AuthMiddleware(authService), handleDebianDelete(registryService))
+}
+
+// debianRegistry returns the Debian handler registered with the service
+func debianRegistry(registryService *registry.Service) (*debian.Registry, error) {
+	handler, err := registryService.GetRegistry("debian")
+	if err != nil {
+		return nil, err
+	}
+	debianHandler, ok := handler.(*debian.Registry)
+	if !ok {
+		return nil, fmt.Errorf("debian registry handler unavailable")
+	}
+	return debianHandler, nil
+}
+
+// buildDebianRepository generates repository metadata from all published packages
+func buildDebianRepository(ctx context.Context, registryService *registry.Service) (*debian.Repository, error) {
+	artifacts, err := registryService.ListAll(ctx, &types.ArtifactFilter{Registry: "debian"})
+	if err != nil {
+		return nil, err
+	}
+	return debian.BuildRepository(artifacts), nil
+}
+
+// GetDebianDists godoc
+//
+//	@Summary		Get APT repository metadata
+//	@Description	Serve Release, InRelease, Release.gpg and Packages indexes for the stable distribution
+//	@Tags			Debian
+//	@Produce		plain
+//	@Param			path	path		string	true	"Path under dists/, e.g. stable/InRelease or stable/main/binary-amd64/Packages.gz"
+//	@Success		200		{file}		file					"Repository metadata file"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		404		{object}	object{error=string}	"File not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to generate repository metadata"
+//	@Security		BearerAuth
+//	@Router			/debian/dists/{path} [get]
+func handleDebianDists(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		distribution, file, found := strings.Cut(strings.TrimPrefix(c.Param("path"), "/"), "/")
+		if !found || distribution != debian.Distribution {
+			c.JSON(http.StatusNotFound, gin.H{"error": "distribution not found"})
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "debian")
+
+		repo, err := buildDebianRepository(ctx, registryService)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("Failed to generate Debian repository metadata")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate repository metadata"})
+			return
+		}
+
+		switch file {
+		case "InRelease", "Release.gpg":
+			debianHandler, err := debianRegistry(registryService)
+			if err != nil || debianHandler.SigningKey() == nil {
+				// apt falls back to Release when the repository is unsigned
+				c.JSON(http.StatusNotFound, gin.H{"error": "repository is not signed"})
+				return
+			}
+
+			sign := signing.ClearSign
+			if file == "Release.gpg" {
+				sign = signing.DetachSign
+			}
+			signed, err := sign(repo.Release, debianHandler.SigningKey())
+			if err != nil {
+				middleware.Logger(c).Error().Err(err).Str("file", file).Msg("Failed to sign Debian Release file")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign repository metadata"})
+				return
+			}
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", signed)
+		default:
+			content, ok := repo.Files[file]
+			if !ok {
+				c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+				return
+			}
+
+			contentType := "text/plain; charset=utf-8"
+			if strings.HasSuffix(file, ".gz") {
+				contentType = "application/gzip"
+			}
+			c.Data(http.StatusOK, contentType, content)
+		}
+	}
+}
+
+// GetDebianPool godoc
+//
+//	@Summary		Download Debian package
+//	@Description	Download a .deb from the repository pool, as referenced by the Filename field of a Packages index
+//	@Tags			Debian
+//	@Produce		application/vnd.debian.binary-package
+//	@Param			path	path		string	true	"Pool path, e.g. main/h/hello/hello_1.0-1_amd64.deb"
+//	@Param			Range	header		string	false	"Byte ranges to download (e.g., bytes=1024- or bytes=0-99,100-199); ranges that overlap or adjoin are served as one, others with the whole content"
+//	@Success		200		{file}		file					"Debian package"
+//	@Success		206		{file}		file					"Requested range of the Debian package"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		404		{object}	object{error=string}	"Package not found"
+//	@Failure		416		"Range not satisfiable"
+//	@Security		BearerAuth
+//	@Router			/debian/pool/{path} [get]
+func handleDebianPool(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requested := "pool" + c.Param("path")
+		segments := strings.Split(requested, "/")
+		if len(segments) != 5 || !strings.HasSuffix(requested, ".deb") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+		packageName := segments[3]
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "debian")
+
+		// File names drop the epoch, so match against each version's pool path
+		artifacts, err := registryService.ListAll(ctx, &types.ArtifactFilter{Registry: "debian", Name: packageName})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up package"})
+			return
+		}
+
+		var version string
+		for _, artifact := range artifacts {
+			entry, ok := debian.NewPackageEntry(artifact)
+			if ok && artifact.Name == packageName && entry.Filename == requested {
+				version = artifact.Version
+				break
+			}
+		}
+		if version == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "debian", packageName, version)
+		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+		defer content.Close()
+
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("package", packageName).Str("version", version).Msg("Failed to stream Debian package")
+		}
+	}
+}
+
+// GetDebianKey godoc
+//
+//	@Summary		Get repository signing key
+//	@Description	Download the armored public key that signs the repository's Release files
+//	@Tags			Debian
+//	@Produce		plain
+//	@Success		200	{string}	string					"Armored OpenPGP public key"
+//	@Failure		401	{object}	object{error=string}	"Unauthorized"
+//	@Failure		404	{object}	object{error=string}	"Repository is not signed"
+//	@Security		BearerAuth
+//	@Router			/debian/key.asc [get]
+func handleDebianKey(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		debianHandler, err := debianRegistry(registryService)
+		if err != nil || debianHandler.SigningKey() == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "repository is not signed"})
+			return
+		}
+
+		key, err := signing.PublicKey(debianHandler.SigningKey())
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("Failed to export Debian signing key")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export signing key"})
+			return
+		}
+
+		c.Data(http.StatusOK, "application/pgp-keys", key)
+	}
+}
+
+// UploadDebianPackage godoc
+//
+//	@Summary		Upload Debian package
+//	@Description	Upload a .deb; its name, version and architecture are read from the control file. Each architecture of a version is a separate package.
+//	@Tags			Debian
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			package	formData	file	true	".deb package file"
+//	@Success		201		{object}	object{message=string,package=string,version=string,architecture=string,filename=string}	"Package uploaded"
+//	@Failure		400		{object}	object{error=string}												"Invalid package"
+//	@Failure		401		{object}	object{error=string}												"Unauthorized"
+//	@Failure		500		{object}	object{error=string}												"Upload failed"
+//	@Security		BearerAuth
+//	@Router			/debian/api/packages [post]
+func handleDebianUpload(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		file, header, err := c.Request.FormFile("package")
+		if requestTooLarge(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "package file required"})
+			return
+		}
+		defer file.Close()
+
+		if !strings.HasSuffix(header.Filename, ".deb") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "package file must be .deb format"})
+			return
+		}
+
+		content, err := io.ReadAll(io.LimitReader(file, maxDebianPackageSize+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read package file"})
+			return
+		}
+		if len(content) > maxDebianPackageSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "package file too large"})
+			return
+		}
+
+		// The control file is authoritative for the package identity
+		control, err := debian.ExtractControl(content)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid Debian package: %v", err)})
+			return
+		}
+		packageName := control.Get("Package")
+		version := control.Get("Version")
+		architecture := control.Get("Architecture")
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "debian")
+		ctx = context.WithValue(ctx, "user_id", user.ID)
+
+		_, err = registryService.Upload(ctx, "debian", packageName, debian.ArtifactVersion(version, architecture), bytes.NewReader(content), user.ID)
+		status, ok := uploadStatus(c, err, http.StatusCreated)
+		if !ok {
+			return
+		}
+
+		c.JSON(status, gin.H{
+			"message":      "package uploaded successfully",
+			"package":      packageName,
+			"version":      version,
+			"architecture": architecture,
+			"filename":     debian.PoolFilename(packageName, version, architecture),
+		})
+	}
+}
+
+// DeleteDebianPackage godoc
+//
+//	@Summary		Delete Debian package
+//	@Description	Remove a package version from the repository, for one architecture or all of them
+//	@Tags			Debian
+//	@Produce		json
+//	@Param			package			path		string	true	"Package name"
+//	@Param			version			path		string	true	"Package version"
+//	@Param			architecture	query		string	false	"Architecture to remove (default all)"
+//	@Success		200				{object}	object{message=string}	"Package deleted"
+//	@Failure		401				{object}	object{error=string}	"Unauthorized"
+//	@Failure		404				{object}	object{error=string}	"Package not found"
+//	@Failure		500				{object}	object{error=string}	"Failed to delete package"
+//	@Security		BearerAuth
+//	@Router			/debian/api/packages/{package}/{version} [delete]
+func handleDebianDelete(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		packageName := c.Param("package")
+		version := c.Param("version")
+		architecture := c.Query("architecture")
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "debian")
+		ctx = context.WithValue(ctx, "user_id", user.ID)
+
+		artifacts, err := registryService.ListAll(ctx, &types.ArtifactFilter{Registry: "debian", Name: packageName})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up package"})
+			return
+		}
+
+		var artifactVersions []string
+		for _, artifact := range artifacts {
+			artifactVersion, artifactArchitecture := debian.SplitArtifactVersion(artifact.Version)
+			if artifact.Name == packageName && artifactVersion == version && (architecture == "" || artifactArchitecture == architecture) {
+				artifactVersions = append(artifactVersions, artifact.Version)
+			}
+		}
+		if len(artifactVersions) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+
+		for _, artifactVersion := range artifactVersions {
+			if err := registryService.Delete(ctx, "debian", packageName, artifactVersion, user.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete package"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "package deleted successfully",
+		})
+	}
+}
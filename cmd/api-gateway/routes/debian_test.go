@@ -0,0 +1,312 @@
+package routes
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/debian"
+	"github.com/lgulliver/lodestone/pkg/signing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createDeb builds a minimal .deb with the given control file
+func createDeb(t *testing.T, control string) []byte {
+	t.Helper()
+
+	tarGz := func(name, data string) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}))
+		_, err := tw.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		return buf.Bytes()
+	}
+
+	var deb bytes.Buffer
+	deb.WriteString("!<arch>\n")
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", tarGz("./control", control)},
+		{"data.tar.gz", tarGz("./usr/share/doc/README", "hello\n")},
+	} {
+		fmt.Fprintf(&deb, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		deb.Write(member.data)
+		if len(member.data)%2 == 1 {
+			deb.WriteString("\n")
+		}
+	}
+	return deb.Bytes()
+}
+
+// setupDebianRepository uploads packages through the upload handler and returns
+// a router serving the repository with the given signing key
+func setupDebianRepository(t *testing.T, key *openpgp.Entity, controls ...string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	handler, err := registryService.GetRegistry("debian")
+	require.NoError(t, err)
+	handler.(*debian.Registry).SetSigningKey(key)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	deb := router.Group("/debian")
+	deb.GET("/dists/*path", handleDebianDists(registryService))
+	deb.GET("/pool/*path", handleDebianPool(registryService))
+	deb.GET("/key.asc", handleDebianKey(registryService))
+	deb.POST("/api/packages", handleDebianUpload(registryService))
+	deb.DELETE("/api/packages/:package/:version", handleDebianDelete(registryService))
+
+	for _, control := range controls {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("package", "package.deb")
+		require.NoError(t, err)
+		_, err = part.Write(createDeb(t, control))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest("POST", "/debian/api/packages", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	return router
+}
+
+// parseStanzas splits a deb822 document into paragraphs of single-line fields
+func parseStanzas(data []byte) []map[string]string {
+	var stanzas []map[string]string
+	current := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(current) > 0 {
+				stanzas = append(stanzas, current)
+				current = map[string]string{}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		current[name] = strings.TrimSpace(value)
+	}
+	if len(current) > 0 {
+		stanzas = append(stanzas, current)
+	}
+	return stanzas
+}
+
+// TestDebianRoutes_Setup verifies that Debian routes can be registered without panicking
+func TestDebianRoutes_Setup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+
+	assert.NotPanics(t, func() {
+		DebianRoutes(api, &registry.Service{}, &auth.Service{})
+	})
+}
+
+// TestDebianRepository_ResolveLikeApt walks the repository the way apt does:
+// verify InRelease, fetch the Packages index it lists, resolve the package and
+// download it from the pool, checking every checksum on the way
+func TestDebianRepository_ResolveLikeApt(t *testing.T) {
+	key, err := openpgp.NewEntity("Lodestone", "test", "dev@example.com", nil)
+	require.NoError(t, err)
+
+	router := setupDebianRepository(t, key,
+		"Package: hello\nVersion: 1:2.10-3\nArchitecture: amd64\nMaintainer: Lodestone <dev@example.com>\nDescription: greeting\n example package\n",
+		"Package: hello-doc\nVersion: 1.0\nArchitecture: all\nDescription: docs\n",
+	)
+
+	get := func(path string) []byte {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, w.Code, path)
+		return w.Body.Bytes()
+	}
+
+	// InRelease must carry a valid signature
+	block, _ := clearsign.Decode(get("/debian/dists/stable/InRelease"))
+	require.NotNil(t, block)
+	_, err = openpgp.CheckDetachedSignature(openpgp.EntityList{key}, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body, nil)
+	require.NoError(t, err)
+	release := string(block.Plaintext)
+	assert.Contains(t, release, "Architectures: amd64 all\n")
+
+	// The Packages index must match the checksum listed in the Release file
+	packagesGz := get("/debian/dists/stable/main/binary-amd64/Packages.gz")
+	sum := sha256.Sum256(packagesGz)
+	assert.Contains(t, release, fmt.Sprintf(" %s %d main/binary-amd64/Packages.gz\n", hex.EncodeToString(sum[:]), len(packagesGz)))
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(packagesGz))
+	require.NoError(t, err)
+	packages, err := io.ReadAll(gzipReader)
+	require.NoError(t, err)
+
+	stanzas := parseStanzas(packages)
+	require.Len(t, stanzas, 2)
+	var hello map[string]string
+	for _, stanza := range stanzas {
+		if stanza["Package"] == "hello" {
+			hello = stanza
+		}
+	}
+	require.NotNil(t, hello)
+	assert.Equal(t, "1:2.10-3", hello["Version"])
+	assert.Equal(t, "pool/main/h/hello/hello_2.10-3_amd64.deb", hello["Filename"])
+
+	// The pool file must match the size and checksum in the index
+	deb := get("/debian/" + hello["Filename"])
+	assert.Equal(t, hello["Size"], strconv.Itoa(len(deb)))
+	debSum := sha256.Sum256(deb)
+	assert.Equal(t, hello["SHA256"], hex.EncodeToString(debSum[:]))
+
+	assert.Contains(t, string(get("/debian/key.asc")), "BEGIN PGP PUBLIC KEY BLOCK")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debian/dists/unknown/Release", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/debian/pool/main/h/hello/hello_9.9_amd64.deb", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestDebianRepository_ArchitecturesStoredApart uploads builds of the same
+// version for two architectures and checks that both are served and can be
+// deleted separately
+func TestDebianRepository_ArchitecturesStoredApart(t *testing.T) {
+	router := setupDebianRepository(t, nil,
+		"Package: hello\nVersion: 2.10-3\nArchitecture: amd64\nDescription: greeting\n",
+		"Package: hello\nVersion: 2.10-3\nArchitecture: arm64\nDescription: greeting\n",
+	)
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	amd64 := request("GET", "/debian/pool/main/h/hello/hello_2.10-3_amd64.deb")
+	require.Equal(t, http.StatusOK, amd64.Code)
+	arm64 := request("GET", "/debian/pool/main/h/hello/hello_2.10-3_arm64.deb")
+	require.Equal(t, http.StatusOK, arm64.Code)
+	assert.NotEqual(t, amd64.Body.Bytes(), arm64.Body.Bytes())
+
+	for _, arch := range []string{"amd64", "arm64"} {
+		w := request("GET", "/debian/dists/stable/main/binary-"+arch+"/Packages")
+		require.Equal(t, http.StatusOK, w.Code)
+		stanzas := parseStanzas(w.Body.Bytes())
+		require.Len(t, stanzas, 1, arch)
+		assert.Equal(t, "pool/main/h/hello/hello_2.10-3_"+arch+".deb", stanzas[0]["Filename"])
+	}
+
+	assert.Equal(t, http.StatusOK, request("DELETE", "/debian/api/packages/hello/2.10-3?architecture=arm64").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/debian/pool/main/h/hello/hello_2.10-3_arm64.deb").Code)
+	assert.Equal(t, http.StatusOK, request("GET", "/debian/pool/main/h/hello/hello_2.10-3_amd64.deb").Code)
+
+	assert.Equal(t, http.StatusNotFound, request("DELETE", "/debian/api/packages/hello/2.10-3?architecture=arm64").Code)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/debian/api/packages/hello/2.10-3").Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/debian/pool/main/h/hello/hello_2.10-3_amd64.deb").Code)
+}
+
+// TestDebianRepository_AptGetInstall points a real apt-get at the repository
+// and installs (download only) a package from it. Skipped where apt is unavailable.
+func TestDebianRepository_AptGetInstall(t *testing.T) {
+	if _, err := exec.LookPath("apt-get"); err != nil {
+		t.Skip("apt-get not available")
+	}
+	if _, err := exec.LookPath("gpgv"); err != nil {
+		t.Skip("gpgv not available")
+	}
+
+	key, err := openpgp.NewEntity("Lodestone", "test", "dev@example.com", nil)
+	require.NoError(t, err)
+
+	router := setupDebianRepository(t, key,
+		"Package: hello\nVersion: 2.10-3\nArchitecture: all\nMaintainer: Lodestone <dev@example.com>\nDepends: hello-data (>= 1.0)\nDescription: greeting\n",
+		"Package: hello-data\nVersion: 1.2\nArchitecture: all\nMaintainer: Lodestone <dev@example.com>\nDescription: greeting data\n",
+	)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	root := t.TempDir()
+	for _, dir := range []string{"etc/apt/preferences.d", "etc/apt/trusted.gpg.d", "state/lists/partial", "cache/archives/partial"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, dir), 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(root, "status"), nil, 0644))
+
+	publicKey, err := signing.PublicKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(root, "lodestone.asc")
+	require.NoError(t, os.WriteFile(keyPath, publicKey, 0644))
+
+	sourcesPath := filepath.Join(root, "sources.list")
+	require.NoError(t, os.WriteFile(sourcesPath,
+		[]byte(fmt.Sprintf("deb [signed-by=%s] %s/debian stable main\n", keyPath, server.URL)), 0644))
+
+	apt := func(args ...string) (string, error) {
+		options := []string{
+			"-o", "Dir::Etc=" + filepath.Join(root, "etc/apt"),
+			"-o", "Dir::Etc::SourceList=" + sourcesPath,
+			"-o", "Dir::Etc::SourceParts=-",
+			"-o", "Dir::State=" + filepath.Join(root, "state"),
+			"-o", "Dir::State::status=" + filepath.Join(root, "status"),
+			"-o", "Dir::Cache=" + filepath.Join(root, "cache"),
+			"-o", "APT::Architecture=amd64",
+			"-o", "APT::Sandbox::User=" + os.Getenv("USER"),
+			"-o", "Debug::NoLocking=1",
+		}
+		output, err := exec.Command("apt-get", append(options, args...)...).CombinedOutput()
+		return string(output), err
+	}
+
+	output, err := apt("update")
+	require.NoError(t, err, output)
+	require.NotContains(t, output, "NO_PUBKEY", output)
+
+	output, err = apt("install", "--download-only", "--yes", "hello")
+	require.NoError(t, err, output)
+
+	assert.FileExists(t, filepath.Join(root, "cache/archives/hello_2.10-3_all.deb"))
+	assert.FileExists(t, filepath.Join(root, "cache/archives/hello-data_1.2_all.deb"))
+}
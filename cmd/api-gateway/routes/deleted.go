@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// restoreRequest is the body of a request to restore a deleted artifact.
+// The artifact is named in the body since package names may contain slashes.
+type restoreRequest struct {
+	Registry string `json:"registry" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Version  string `json:"version" binding:"required"`
+}
+
+// GetDeletedArtifacts godoc
+//
+//	@Summary		List deleted artifacts
+//	@Description	List deleted artifacts that can still be restored, most recently deleted first
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			registry	query		string	false	"Registry name to list deleted artifacts of (e.g., npm, nuget, maven)"
+//	@Success		200			{object}	types.APIResponse{data=[]types.Artifact}	"Deleted artifacts retrieved successfully"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		500			{object}	types.APIResponse	"Failed to list deleted artifacts"
+//	@Security		BearerAuth
+//	@Router			/admin/artifacts/deleted [get]
+func getDeletedArtifacts(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		artifacts, err := registryService.ListDeleted(c.Request.Context(), c.Query("registry"))
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("failed to list deleted artifacts")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to list deleted artifacts",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    artifacts,
+		})
+	}
+}
+
+// RestoreArtifact godoc
+//
+//	@Summary		Restore a deleted artifact
+//	@Description	Restore a deleted artifact that has not been purged yet, making it downloadable and listed again
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			artifact	body		restoreRequest	true	"Artifact to restore"
+//	@Success		200			{object}	types.APIResponse{data=types.Artifact}	"Artifact restored successfully"
+//	@Failure		400			{object}	types.APIResponse	"Invalid request body"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404			{object}	types.APIResponse	"Deleted artifact not found"
+//	@Failure		500			{object}	types.APIResponse	"Failed to restore artifact"
+//	@Security		BearerAuth
+//	@Router			/admin/artifacts/deleted/restore [post]
+func restoreArtifact(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		var request restoreRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		artifact, err := registryService.Restore(c.Request.Context(), request.Registry, request.Name, request.Version, user.ID)
+		if err != nil {
+			if errors.Is(err, registry.ErrArtifactNotFound) {
+				c.JSON(http.StatusNotFound, types.APIResponse{
+					Success: false,
+					Error:   "Deleted artifact not found",
+				})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", request.Registry).Str("name", request.Name).Str("version", request.Version).Msg("failed to restore artifact")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to restore artifact",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Artifact restored successfully",
+			Data:    artifact,
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/debian"
+	"github.com/lgulliver/lodestone/internal/registry/registries/nuget"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rpm"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rubygems"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// errRangeNotSatisfiable is returned for a Range header asking for bytes
+// beyond the end of the content
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// byteRange is the part of some content a Range request asks for
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// parseByteRange parses a Range header asking for bytes of content of the
+// given size, clamping each range to the content. Several ranges are
+// coalesced when they overlap or adjoin, as a single range can be served
+// without a multipart body. It returns nil for a header that is absent or
+// malformed, or whose ranges cannot be coalesced into one, all of which are
+// answered with the whole content, and errRangeNotSatisfiable when none of
+// the ranges start before the end.
+func parseByteRange(header string, size int64) (*byteRange, error) {
+	unit, set, ok := strings.Cut(header, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, nil
+	}
+
+	var ranges []byteRange
+	specs := 0
+	for _, spec := range strings.Split(set, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		specs++
+		rng, satisfiable, ok := parseRangeSpec(spec, size)
+		if !ok {
+			return nil, nil
+		}
+		if satisfiable {
+			ranges = append(ranges, rng)
+		}
+	}
+	if specs == 0 {
+		return nil, nil
+	}
+	if len(ranges) == 0 {
+		return nil, errRangeNotSatisfiable
+	}
+
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].offset < ranges[j].offset })
+	merged := ranges[0]
+	for _, rng := range ranges[1:] {
+		if rng.offset > merged.offset+merged.length {
+			return nil, nil
+		}
+		merged.length = max(merged.length, rng.offset+rng.length-merged.offset)
+	}
+	return &merged, nil
+}
+
+// parseRangeSpec parses one range of a Range header, such as "2-5", "7-" or
+// "-3", for content of the given size. It reports whether the range was
+// well-formed and whether any of it lies within the content.
+func parseRangeSpec(spec string, size int64) (byteRange, bool, bool) {
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return byteRange{}, false, false
+	}
+	first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+	// A suffix range asks for the last bytes of the content
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return byteRange{}, false, false
+		}
+		if suffix == 0 || size == 0 {
+			return byteRange{}, false, true
+		}
+		suffix = min(suffix, size)
+		return byteRange{offset: size - suffix, length: suffix}, true, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, false
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, false, false
+		}
+	}
+	if start >= size {
+		return byteRange{}, false, true
+	}
+	end = min(end, size-1)
+	return byteRange{offset: start, length: end - start + 1}, true, true
+}
+
+// rangeNotSatisfiable responds 416 to a Range request for content of the
+// given size
+func rangeNotSatisfiable(c *gin.Context, size int64) {
+	c.Header("Content-Range", fmt.Sprintf("bytes */%d", size))
+	c.Status(http.StatusRequestedRangeNotSatisfiable)
+}
+
+// serveContent streams content of the given size as the response body: the
+// whole content, or the requested range of it as 206 Partial Content if rng
+// is not nil. Headers set before calling it are kept.
+func serveContent(c *gin.Context, content io.Reader, size int64, rng *byteRange) error {
+	c.Header("Accept-Ranges", "bytes")
+	if rng == nil {
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+		c.Status(http.StatusOK)
+	} else {
+		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.offset, rng.offset+rng.length-1, size))
+		c.Header("Content-Length", strconv.FormatInt(rng.length, 10))
+		c.Status(http.StatusPartialContent)
+	}
+	_, err := io.Copy(c.Writer, content)
+	return err
+}
+
+// genericContentType is what content of no more specific type is served as
+const genericContentType = "application/octet-stream"
+
+// downloadContentTypes are the content types each registry's artifacts are
+// served as when they were not stored with a more specific one
+var downloadContentTypes = map[string]string{
+	"npm":      "application/gzip",
+	"nuget":    "application/zip",
+	"maven":    "application/java-archive",
+	"go":       "application/zip",
+	"helm":     "application/gzip",
+	"cargo":    "application/gzip",
+	"rubygems": genericContentType,
+	"opa":      "application/gzip",
+	"debian":   "application/vnd.debian.binary-package",
+	"rpm":      "application/x-rpm",
+}
+
+// nugetSymbolPackageContentType is the content type of NuGet symbol packages
+const nugetSymbolPackageContentType = "application/vnd.nuget.symbolpackage"
+
+// downloadContentType returns the content type to serve an artifact as: the
+// one it was stored with, unless that says no more than that it is binary
+// content, or else the usual type of its registry's packages
+func downloadContentType(artifact *types.Artifact) string {
+	if artifact.ContentType != "" && artifact.ContentType != genericContentType {
+		return artifact.ContentType
+	}
+	if artifact.Registry == "nuget" && (&nuget.Registry{}).IsSymbolPackage(artifact) {
+		return nugetSymbolPackageContentType
+	}
+	if contentType, ok := downloadContentTypes[artifact.Registry]; ok {
+		return contentType
+	}
+	return genericContentType
+}
+
+// downloadFilename returns the file name an artifact is saved as, named the
+// way its ecosystem names package files
+func downloadFilename(artifact *types.Artifact) string {
+	name, version := artifact.Name, artifact.Version
+	switch artifact.Registry {
+	case "npm":
+		// Tarballs of scoped packages are named without the scope
+		if _, unscoped, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(name, "@") {
+			name = unscoped
+		}
+		return name + "-" + version + ".tgz"
+	case "nuget":
+		// Symbol packages are stored under their package's ID plus .symbols
+		if (&nuget.Registry{}).IsSymbolPackage(artifact) {
+			return strings.ToLower(strings.TrimSuffix(name, ".symbols")) + "." + strings.ToLower(version) + ".snupkg"
+		}
+		return strings.ToLower(name) + "." + strings.ToLower(version) + ".nupkg"
+	case "maven":
+		_, artifactID, _ := strings.Cut(name, ":")
+		if artifactID == "" {
+			artifactID = name
+		}
+		if artifact.ContentType == "application/xml" {
+			return artifactID + "-" + version + ".pom"
+		}
+		return artifactID + "-" + version + ".jar"
+	case "go":
+		return path.Base(name) + "@" + version + ".zip"
+	case "helm":
+		return name + "-" + version + ".tgz"
+	case "cargo":
+		return name + "-" + version + ".crate"
+	case "rubygems":
+		spec := rubygems.Specification{Name: name, Version: version}
+		spec.Platform, _ = artifact.Metadata["platform"].(string)
+		return spec.FullName() + ".gem"
+	case "opa":
+		return name + "-" + version + ".tar.gz"
+	case "debian":
+		if entry, ok := debian.NewPackageEntry(artifact); ok {
+			return path.Base(entry.Filename)
+		}
+		return name + "_" + version + ".deb"
+	case "rpm":
+		if pkg, ok := rpm.PackageFromArtifact(artifact); ok {
+			return path.Base(rpm.LocationHref(pkg))
+		}
+		return name + "-" + version + ".rpm"
+	default:
+		return path.Base(name) + "-" + version
+	}
+}
+
+// setDownloadHeaders sets the Content-Type and Content-Disposition of a
+// download of an artifact
+func setDownloadHeaders(c *gin.Context, artifact *types.Artifact) {
+	c.Header("Content-Type", downloadContentType(artifact))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadFilename(artifact)}))
+}
+
+// serveArtifact streams an artifact returned by downloadArtifact as the
+// response body, with the headers of a download of it and a Content-Length
+// of its size, or of the range of it requested
+func serveArtifact(c *gin.Context, artifact *types.Artifact, content io.Reader, rng *byteRange) error {
+	setDownloadHeaders(c, artifact)
+	return serveContent(c, content, artifact.Size, rng)
+}
+
+// downloadArtifact downloads an artifact for a request, only the range of it
+// asked for if the request has a Range header whose ranges can be served as
+// one. It returns the range downloaded, nil for the whole artifact, or
+// errRangeNotSatisfiable with the artifact if every range is past its end.
+func downloadArtifact(c *gin.Context, ctx context.Context, registryService *registry.Service, registryType, name, version string) (*types.Artifact, io.ReadCloser, *byteRange, error) {
+	if header := c.GetHeader("Range"); header != "" {
+		// Artifacts of unknown size are served in full. Only artifacts the
+		// request may download are looked up, so a range past the end of
+		// others does not reveal their size.
+		if artifact, err := registryService.GetPublishedArtifact(ctx, registryType, name, version); err == nil && artifact.Size > 0 {
+			rng, err := parseByteRange(header, artifact.Size)
+			if err != nil {
+				return artifact, nil, nil, err
+			}
+			if rng != nil {
+				ranged, content, err := registryService.DownloadRange(ctx, registryType, name, version, rng.offset, rng.length)
+				if errors.Is(err, storage.ErrInvalidRange) {
+					return artifact, nil, nil, errRangeNotSatisfiable
+				}
+				return ranged, content, rng, err
+			}
+		}
+	}
+
+	artifact, content, err := registryService.Download(ctx, registryType, name, version)
+	return artifact, content, nil, err
+}
+
+// downloadBlocked responds 403 if err is a download refused by the registry's
+// download policy, reporting whether it did
+func downloadBlocked(c *gin.Context, err error) bool {
+	if !errors.Is(err, registry.ErrDownloadBlocked) {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	return true
+}
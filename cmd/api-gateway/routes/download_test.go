@@ -0,0 +1,438 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rpm"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected *byteRange
+		err      error
+	}{
+		{name: "bounded", header: "bytes=2-5", expected: &byteRange{offset: 2, length: 4}},
+		{name: "open ended", header: "bytes=7-", expected: &byteRange{offset: 7, length: 3}},
+		{name: "end clamped", header: "bytes=8-100", expected: &byteRange{offset: 8, length: 2}},
+		{name: "suffix", header: "bytes=-3", expected: &byteRange{offset: 7, length: 3}},
+		{name: "suffix longer than content", header: "bytes=-30", expected: &byteRange{offset: 0, length: 10}},
+		{name: "start past end", header: "bytes=10-", err: errRangeNotSatisfiable},
+		{name: "empty suffix", header: "bytes=-0", err: errRangeNotSatisfiable},
+		{name: "several ranges", header: "bytes=0-1,4-5"},
+		{name: "adjoining ranges", header: "bytes=0-1,2-3", expected: &byteRange{offset: 0, length: 4}},
+		{name: "overlapping ranges out of order", header: "bytes=4-7, 2-5", expected: &byteRange{offset: 2, length: 6}},
+		{name: "unsatisfiable ranges dropped", header: "bytes=20-30,6-", expected: &byteRange{offset: 6, length: 4}},
+		{name: "no satisfiable range", header: "bytes=10-20,30-", err: errRangeNotSatisfiable},
+		{name: "malformed among several", header: "bytes=0-1,x-2"},
+		{name: "unit case", header: "Bytes=2-5", expected: &byteRange{offset: 2, length: 4}},
+		{name: "empty set", header: "bytes="},
+		{name: "other unit", header: "items=0-1"},
+		{name: "end before start", header: "bytes=5-2"},
+		{name: "malformed", header: "bytes=a-b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng, err := parseByteRange(tt.header, 10)
+			assert.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.expected, rng)
+		})
+	}
+}
+
+func TestNPMDownloadRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	tarball := createNpmTarball(t, `{"name":"resumable","version":"1.0.0"}`, nil)
+	_, err := registryService.Upload(context.Background(), "npm", "resumable", "1.0.0", bytes.NewReader(tarball), user.ID)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/npm/:name/-/:filename", handleNPMDownload(registryService))
+
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/npm/resumable/-/resumable-1.0.0.tgz", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bytes", w.Header().Get("Accept-Ranges"))
+	assert.Equal(t, tarball, w.Body.Bytes())
+
+	// Resuming after the first 10 bytes returns the rest
+	w = get("bytes=10-")
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, fmt.Sprintf("bytes 10-%d/%d", len(tarball)-1, len(tarball)), w.Header().Get("Content-Range"))
+	assert.Equal(t, fmt.Sprint(len(tarball)-10), w.Header().Get("Content-Length"))
+	assert.Equal(t, tarball[10:], w.Body.Bytes())
+
+	w = get("bytes=0-3")
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, tarball[:4], w.Body.Bytes())
+
+	w = get(fmt.Sprintf("bytes=%d-", len(tarball)))
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, fmt.Sprintf("bytes */%d", len(tarball)), w.Header().Get("Content-Range"))
+	assert.Empty(t, w.Body.Bytes())
+
+	// Only the downloads from the start are counted
+	artifact, err := registryService.GetArtifact(context.Background(), "npm", "resumable", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), artifact.Downloads)
+}
+
+func TestNPMDownloadRange_RestrictedPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	tarball := createNpmTarball(t, `{"name":"restricted","version":"1.0.0"}`, nil)
+	_, err := registryService.Upload(context.Background(), "npm", "restricted", "1.0.0", bytes.NewReader(tarball), publisher.ID)
+	require.NoError(t, err)
+
+	get := func(user *types.User) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/npm/:name/-/:filename", handleNPMDownload(registryService))
+
+		req := httptest.NewRequest("GET", "/npm/restricted/-/restricted-1.0.0.tgz", nil)
+		req.Header.Set("Range", "bytes=999999999-")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get(publisher)
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, fmt.Sprintf("bytes */%d", len(tarball)), w.Header().Get("Content-Range"))
+
+	// A range past the end does not reveal the package or its size to users
+	// who cannot read it
+	w = get(outsider)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Range"))
+}
+
+func TestNuGetDownloadRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	nupkg := createNupkg(t, "Resumable", "1.0.0", "Resumable package", "", "tester")
+	_, err := registryService.Upload(context.Background(), "nuget", "Resumable", "1.0.0", bytes.NewReader(nupkg), user.ID)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/nuget/v3-flatcontainer/:id/:version/:filename", handleNuGetDownload(registryService))
+
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/nuget/v3-flatcontainer/resumable/1.0.0/resumable.1.0.0.nupkg", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, nupkg, w.Body.Bytes())
+
+	w = get("bytes=4-9")
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, fmt.Sprintf("bytes 4-9/%d", len(nupkg)), w.Header().Get("Content-Range"))
+	assert.Equal(t, nupkg[4:10], w.Body.Bytes())
+
+	w = get(fmt.Sprintf("bytes=%d-", len(nupkg)+10))
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, fmt.Sprintf("bytes */%d", len(nupkg)), w.Header().Get("Content-Range"))
+
+	// Ranges that cannot be served as one fall back to the whole package
+	w = get("bytes=0-1,20-29")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, nupkg, w.Body.Bytes())
+}
+
+func TestOCIBlobRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.GET("/v2/*path", handleOCIBlobCatchAll(registryService))
+
+	content := []byte("0123456789")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	require.NoError(t, registryService.Storage.Store(context.Background(), "oci/myorg/app/blobs/"+digest, bytes.NewReader(content), "application/octet-stream"))
+
+	get := func(rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v2/myorg/app/blobs/"+digest, nil)
+		req.Header.Set("Range", rangeHeader)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("bytes=-4")
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 6-9/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, digest, w.Header().Get("Docker-Content-Digest"))
+	assert.Equal(t, "6789", w.Body.String())
+
+	// Ranges that cannot be served as one are answered with the whole blob
+	w = get("bytes=0-1,5-6")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+
+	// Overlapping ranges are served as the one range they cover
+	w = get("bytes=0-3,2-5")
+	require.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "bytes 0-5/10", w.Header().Get("Content-Range"))
+	assert.Equal(t, "012345", w.Body.String())
+
+	w = get("bytes=20-30")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, "bytes */10", w.Header().Get("Content-Range"))
+
+	w = get("bytes=20-30,40-")
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+	assert.Equal(t, "bytes */10", w.Header().Get("Content-Range"))
+
+	// Without a Range header the whole blob is served
+	w = get("")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Equal(t, "0123456789", w.Body.String())
+}
+
+func TestServeArtifact_Headers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		artifact    types.Artifact
+		contentType string
+		filename    string
+	}{
+		{
+			name:        "npm",
+			artifact:    types.Artifact{Registry: "npm", Name: "left-pad", Version: "1.3.0", ContentType: "application/octet-stream"},
+			contentType: "application/gzip",
+			filename:    "left-pad-1.3.0.tgz",
+		},
+		{
+			name:        "scoped npm",
+			artifact:    types.Artifact{Registry: "npm", Name: "@acme/widgets", Version: "2.0.0-beta.1", ContentType: "application/octet-stream"},
+			contentType: "application/gzip",
+			filename:    "widgets-2.0.0-beta.1.tgz",
+		},
+		{
+			name:        "nuget",
+			artifact:    types.Artifact{Registry: "nuget", Name: "Newtonsoft.Json", Version: "13.0.1-Beta", ContentType: "application/octet-stream"},
+			contentType: "application/zip",
+			filename:    "newtonsoft.json.13.0.1-beta.nupkg",
+		},
+		{
+			name: "nuget symbols",
+			artifact: types.Artifact{Registry: "nuget", Name: "Newtonsoft.Json.symbols", Version: "13.0.1", ContentType: "application/octet-stream",
+				Metadata: map[string]interface{}{"packageType": "symbols"}},
+			contentType: "application/vnd.nuget.symbolpackage",
+			filename:    "newtonsoft.json.13.0.1.snupkg",
+		},
+		{
+			name:        "maven jar",
+			artifact:    types.Artifact{Registry: "maven", Name: "com.example:library", Version: "1.0.0", ContentType: "application/java-archive"},
+			contentType: "application/java-archive",
+			filename:    "library-1.0.0.jar",
+		},
+		{
+			name:        "maven pom",
+			artifact:    types.Artifact{Registry: "maven", Name: "com.example:library", Version: "1.0.0", ContentType: "application/xml"},
+			contentType: "application/xml",
+			filename:    "library-1.0.0.pom",
+		},
+		{
+			name:        "go",
+			artifact:    types.Artifact{Registry: "go", Name: "github.com/acme/tool", Version: "v1.2.3", ContentType: "application/zip"},
+			contentType: "application/zip",
+			filename:    "tool@v1.2.3.zip",
+		},
+		{
+			name:        "helm",
+			artifact:    types.Artifact{Registry: "helm", Name: "mychart", Version: "0.1.0", ContentType: "application/gzip"},
+			contentType: "application/gzip",
+			filename:    "mychart-0.1.0.tgz",
+		},
+		{
+			name:        "cargo",
+			artifact:    types.Artifact{Registry: "cargo", Name: "serde", Version: "1.0.0", ContentType: "application/gzip"},
+			contentType: "application/gzip",
+			filename:    "serde-1.0.0.crate",
+		},
+		{
+			name:        "rubygems",
+			artifact:    types.Artifact{Registry: "rubygems", Name: "rails", Version: "7.1.0", ContentType: "application/octet-stream"},
+			contentType: "application/octet-stream",
+			filename:    "rails-7.1.0.gem",
+		},
+		{
+			name: "platform rubygems",
+			artifact: types.Artifact{Registry: "rubygems", Name: "nokogiri", Version: "1.15.0", ContentType: "application/octet-stream",
+				Metadata: map[string]interface{}{"platform": "x86_64-linux"}},
+			contentType: "application/octet-stream",
+			filename:    "nokogiri-1.15.0-x86_64-linux.gem",
+		},
+		{
+			name:        "opa",
+			artifact:    types.Artifact{Registry: "opa", Name: "authz", Version: "1.0.0", ContentType: "application/gzip"},
+			contentType: "application/gzip",
+			filename:    "authz-1.0.0.tar.gz",
+		},
+		{
+			name: "debian",
+			artifact: types.Artifact{Registry: "debian", Name: "hello", Version: "1:2.10-3", ContentType: "application/vnd.debian.binary-package",
+				Metadata: map[string]interface{}{"control": map[string]interface{}{"Package": "hello", "Architecture": "amd64"}}},
+			contentType: "application/vnd.debian.binary-package",
+			filename:    "hello_2.10-3_amd64.deb",
+		},
+		{
+			name: "rpm",
+			artifact: types.Artifact{Registry: "rpm", Name: "hello", Version: "1.0-1", ContentType: "application/x-rpm",
+				Metadata: map[string]interface{}{"package": &rpm.Package{Name: "hello", Version: "1.0", Release: "1", Arch: "x86_64"}}},
+			contentType: "application/x-rpm",
+			filename:    "hello-1.0-1.x86_64.rpm",
+		},
+		{
+			name:        "stored without a content type",
+			artifact:    types.Artifact{Registry: "cargo", Name: "serde", Version: "1.0.0"},
+			contentType: "application/gzip",
+			filename:    "serde-1.0.0.crate",
+		},
+		{
+			name:        "file name needing quotes",
+			artifact:    types.Artifact{Registry: "helm", Name: "my chart", Version: "0.1.0", ContentType: "application/gzip"},
+			contentType: "application/gzip",
+			filename:    "my chart-0.1.0.tgz",
+		},
+	}
+
+	content := []byte("package content")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.artifact.Size = int64(len(content))
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("GET", "/", nil)
+
+			require.NoError(t, serveArtifact(c, &tt.artifact, bytes.NewReader(content), nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, fmt.Sprint(len(content)), w.Header().Get("Content-Length"))
+
+			_, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+			require.NoError(t, err)
+			assert.True(t, strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment;"))
+			assert.Equal(t, tt.filename, params["filename"])
+			assert.Equal(t, content, w.Body.Bytes())
+		})
+	}
+}
+
+func TestNPMDownload_Headers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	tarball := createNpmTarball(t, `{"name":"@acme/widgets","version":"1.0.0"}`, nil)
+	_, err := registryService.Upload(context.Background(), "npm", "@acme/widgets", "1.0.0", bytes.NewReader(tarball), user.ID)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/npm/@:scope/:name/-/:filename", handleNPMScopedDownload(registryService))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/npm/@acme/widgets/-/widgets-1.0.0.tgz", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/gzip", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=widgets-1.0.0.tgz`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, fmt.Sprint(len(tarball)), w.Header().Get("Content-Length"))
+	assert.Equal(t, tarball, w.Body.Bytes())
+}
+
+func TestOCIBlob_MediaType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	handler, err := registryService.GetRegistry("oci")
+	require.NoError(t, err)
+	ociRegistry := handler.(*oci.Registry)
+
+	ctx := context.Background()
+	layer := []byte("layer content")
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	configDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(config))
+	for digest, content := range map[string][]byte{layerDigest: layer, configDigest: config} {
+		size, storagePath, err := ociRegistry.PutBlob(ctx, "myorg/app", digest, bytes.NewReader(content))
+		require.NoError(t, err)
+		recordOCIBlob(ctx, registryService, user, "myorg/app", digest, size, storagePath)
+	}
+
+	router := gin.New()
+	router.GET("/v2/*path", handleOCIBlobCatchAll(registryService))
+	router.HEAD("/v2/*path", handleOCIBlobCatchAll(registryService))
+
+	request := func(method, digest string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/v2/myorg/app/blobs/"+digest, nil))
+		return w
+	}
+
+	// Blobs no manifest has typed yet are served as binary content
+	w := request("GET", layerDigest)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, oci.BlobMediaType, w.Header().Get("Content-Type"))
+
+	manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":%q,"size":%d},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":%q,"size":%d}]}`,
+		oci.ImageManifestMediaType, configDigest, len(config), layerDigest, len(layer))
+	_, err = ociRegistry.PutManifest(ctx, "myorg/app", "latest", strings.NewReader(manifest), oci.ImageManifestMediaType)
+	require.NoError(t, err)
+
+	w = request("GET", layerDigest)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.oci.image.layer.v1.tar+gzip", w.Header().Get("Content-Type"))
+	assert.Equal(t, fmt.Sprint(len(layer)), w.Header().Get("Content-Length"))
+	assert.Equal(t, layer, w.Body.Bytes())
+
+	w = request("HEAD", configDigest)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.oci.image.config.v1+json", w.Header().Get("Content-Type"))
+	assert.Equal(t, fmt.Sprint(len(config)), w.Header().Get("Content-Length"))
+}
@@ -2,32 +2,106 @@ package routes
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"io"
 	"net/http"
+	"path"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
+	goregistry "github.com/lgulliver/lodestone/internal/registry/registries/go"
 	"github.com/lgulliver/lodestone/pkg/types"
 )
 
 // GoRoutes sets up Go module proxy routes
 func GoRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	goproxy := api.Group("/go")
+	goproxy.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("go")))
 
-	// Go module proxy protocol - requires authentication
-	goproxy.GET("/:module/@latest", middleware.AuthMiddleware(authService), handleGoLatest(registryService))
-	goproxy.GET("/:module/@v/list", middleware.AuthMiddleware(authService), handleGoVersionList(registryService))
-
-	// Handle versioned operations - this will detect file extensions like .info, .mod, .zip
-	goproxy.GET("/:module/@v/:version", middleware.AuthMiddleware(authService), handleGoVersionFile(registryService))
+	// Module paths contain slashes, so requests are routed by their path:
+	// /{module}/@latest, /{module}/@v/list and /{module}/@v/{version}.{info,mod,zip}
+	goproxy.GET("/*path", middleware.AuthMiddleware(authService), handleGoProxyCatchAll(registryService))
 
 	// Module upload and delete (custom extension to Go proxy protocol)
-	goproxy.PUT("/:module/@v/:version", middleware.AuthMiddleware(authService), handleGoModuleUpload(registryService))
-	goproxy.DELETE("/:module/@v/:version", middleware.AuthMiddleware(authService), handleGoModuleDelete(registryService))
+	goproxy.PUT("/*path", middleware.AuthMiddleware(authService), handleGoProxyCatchAll(registryService))
+	goproxy.DELETE("/*path", middleware.AuthMiddleware(authService), handleGoProxyCatchAll(registryService))
+}
+
+// parseGoProxyPath splits a Go module proxy request path into the unescaped
+// module path and what is requested of it: "@latest", or the file under @v/
+func parseGoProxyPath(path string) (string, string, bool) {
+	path = strings.TrimPrefix(path, "/")
+
+	escaped, file, ok := strings.Cut(path, "/@v/")
+	if !ok {
+		escaped, ok = strings.CutSuffix(path, "/@latest")
+		file = "@latest"
+	}
+	if !ok || escaped == "" || file == "" {
+		return "", "", false
+	}
+
+	module, err := goregistry.UnescapeModulePath(escaped)
+	if err != nil {
+		return "", "", false
+	}
+	return module, file, true
+}
+
+func handleGoProxyCatchAll(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		module, file, ok := parseGoProxyPath(c.Param("path"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not a Go module proxy path"})
+			return
+		}
+
+		// Set parameters for compatibility with existing handlers
+		c.Params = append(c.Params, gin.Param{Key: "module", Value: module})
+		if file != "@latest" && file != "list" {
+			version, err := goregistry.UnescapeModulePath(file)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "invalid version"})
+				return
+			}
+			c.Params = append(c.Params, gin.Param{Key: "version", Value: version})
+		}
+
+		switch {
+		case c.Request.Method == http.MethodGet && file == "@latest":
+			handleGoLatest(registryService)(c)
+		case c.Request.Method == http.MethodGet && file == "list":
+			handleGoVersionList(registryService)(c)
+		case c.Request.Method == http.MethodGet && c.Param("version") != "":
+			handleGoVersionFile(registryService)(c)
+		case c.Request.Method == http.MethodPut && c.Param("version") != "":
+			handleGoModuleUpload(registryService)(c)
+		case c.Request.Method == http.MethodDelete && c.Param("version") != "":
+			handleGoModuleDelete(registryService)(c)
+		default:
+			c.JSON(http.StatusMethodNotAllowed, gin.H{"error": "method not allowed"})
+		}
+	}
+}
+
+// goModuleVersions returns the published versions of exactly the module, not
+// of the modules whose paths merely contain it or differ from it in case
+func goModuleVersions(ctx context.Context, registryService *registry.Service, module string) ([]*types.Artifact, error) {
+	artifacts, err := registryService.ListAll(ctx, &types.ArtifactFilter{
+		Name:      module,
+		Registry:  "go",
+		ExactName: true,
+	})
+	return artifacts, err
+}
+
+// publishedGoModule returns a published version of a module the request may
+// read, or registry.ErrArtifactNotFound
+func publishedGoModule(ctx context.Context, registryService *registry.Service, module, version string) (*types.Artifact, error) {
+	return registryService.GetPublishedArtifact(ctx, "go", module, version)
 }
 
 func handleGoVersionList(registryService *registry.Service) gin.HandlerFunc {
@@ -40,12 +114,7 @@ func handleGoVersionList(registryService *registry.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "go")
 
-		filter := &types.ArtifactFilter{
-			Name:     module,
-			Registry: "go",
-		}
-
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, err := goModuleVersions(ctx, registryService, module)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list versions"})
 			return
@@ -57,8 +126,11 @@ func handleGoVersionList(registryService *registry.Service) gin.HandlerFunc {
 		}
 
 		// Return versions as plain text, one per line
-		c.Header("Content-Type", "text/plain")
-		c.String(http.StatusOK, strings.Join(versions, "\n"))
+		var body strings.Builder
+		for _, version := range goregistry.ListVersions(versions) {
+			body.WriteString(version + "\n")
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(body.String()))
 	}
 }
 
@@ -72,81 +144,66 @@ func handleGoVersionFile(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		// Parse version and file type from the parameter (e.g., "v1.0.0.info", "v1.0.0.mod", "v1.0.0.zip")
-		parts := strings.Split(versionParam, ".")
-		if len(parts) < 2 {
-			// If no file extension, treat as regular version download (.zip)
-			version := versionParam
+		// The file type is the extension of the parameter, e.g. "v1.0.0.info"
+		extension := path.Ext(versionParam)
+		version := strings.TrimSuffix(versionParam, extension)
 
-			// Handle .zip download
-			artifact, content, err := registryService.Download(c.Request.Context(), "go", module, version)
+		ctx := context.WithValue(c.Request.Context(), "registry", "go")
+
+		switch extension {
+		case ".info":
+			artifact, err := publishedGoModule(ctx, registryService, module, version)
 			if err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "module not found"})
+				c.JSON(http.StatusNotFound, gin.H{"error": "version not found"})
 				return
 			}
 
-			c.Header("Content-Type", "application/zip")
-			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s@%s.zip", module, version))
+			c.JSON(http.StatusOK, goregistry.NewModInfo(artifact.Version, artifact.CreatedAt))
 
-			if artifact.Size > 0 {
-				c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
+		case ".mod":
+			artifact, err := publishedGoModule(ctx, registryService, module, version)
+			if err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "version not found"})
+				return
 			}
 
-			defer content.Close()
-			_, err = io.Copy(c.Writer, content)
+			// Read the module zip directly so fetching go.mod is not counted as a download
+			reader, err := registryService.Storage.Retrieve(ctx, artifact.StoragePath)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream module"})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read module"})
 				return
 			}
-			return
-		}
-
-		version := strings.Join(parts[:len(parts)-1], ".") // Everything except the last part
-		fileType := parts[len(parts)-1]                    // The file extension
-
-		ctx := context.WithValue(c.Request.Context(), "registry", "go")
-
-		switch fileType {
-		case "info":
-			// Go module info format
-			artifact, _, err := registryService.Download(ctx, "go", module, version)
+			content, err := io.ReadAll(reader)
+			reader.Close()
 			if err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "version not found"})
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read module"})
 				return
 			}
 
-			info := fmt.Sprintf(`{
-	"Version": "%s",
-	"Time": "%s"
-}`, artifact.Version, artifact.CreatedAt.Format("2006-01-02T15:04:05Z"))
-
-			c.Header("Content-Type", "application/json")
-			c.String(http.StatusOK, info)
-
-		case "mod":
-			// For now, return a simple go.mod file
-			// In a real implementation, this would be extracted from the uploaded module
-			modContent := fmt.Sprintf("module %s\n\ngo 1.19\n", module)
-			c.Header("Content-Type", "text/plain")
-			c.String(http.StatusOK, modContent)
-
-		case "zip":
-			artifact, content, err := registryService.Download(ctx, "go", module, version)
+			modFile, err := goregistry.ModFile(artifact.Name, artifact.Version, content)
 			if err != nil {
-				c.JSON(http.StatusNotFound, gin.H{"error": "module not found"})
+				middleware.Logger(c).Error().Err(err).Str("module", module).Str("version", version).Msg("failed to read go.mod from module zip")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read go.mod"})
 				return
 			}
+			c.Data(http.StatusOK, "text/plain; charset=utf-8", modFile)
 
-			c.Header("Content-Type", "application/zip")
-			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s@%s.zip", module, version))
-
-			if artifact.Size > 0 {
-				c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
+		case ".zip":
+			artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "go", module, version)
+			if err != nil {
+				if downloadBlocked(c, err) {
+					return
+				}
+				if errors.Is(err, errRangeNotSatisfiable) {
+					rangeNotSatisfiable(c, artifact.Size)
+					return
+				}
+				c.JSON(http.StatusNotFound, gin.H{"error": "module not found"})
+				return
 			}
 
 			defer content.Close()
-			_, err = io.Copy(c.Writer, content)
-			if err != nil {
+			if err := serveArtifact(c, artifact, content, rng); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream module"})
 				return
 			}
@@ -167,13 +224,7 @@ func handleGoLatest(registryService *registry.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "go")
 
-		filter := &types.ArtifactFilter{
-			Name:     module,
-			Registry: "go",
-			Limit:    1, // Get the latest version
-		}
-
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, err := goModuleVersions(ctx, registryService, module)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get latest version"})
 			return
@@ -184,14 +235,19 @@ func handleGoLatest(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		latest := artifacts[0]
-		info := fmt.Sprintf(`{
-	"Version": "%s",
-	"Time": "%s"
-}`, latest.Version, latest.CreatedAt.Format("2006-01-02T15:04:05Z"))
+		versions := make([]string, 0, len(artifacts))
+		for _, artifact := range artifacts {
+			versions = append(versions, artifact.Version)
+		}
+		latest := goregistry.LatestVersion(versions)
 
-		c.Header("Content-Type", "application/json")
-		c.String(http.StatusOK, info)
+		for _, artifact := range artifacts {
+			if artifact.Version == latest {
+				c.JSON(http.StatusOK, goregistry.NewModInfo(artifact.Version, artifact.CreatedAt))
+				return
+			}
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "module not found"})
 	}
 }
 
@@ -215,12 +271,12 @@ func handleGoModuleUpload(registryService *registry.Service) gin.HandlerFunc {
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 
 		_, err := registryService.Upload(ctx, "go", module, version, c.Request.Body, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+		status, ok := uploadStatus(c, err, http.StatusCreated)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
+		c.JSON(status, gin.H{
 			"message": "module uploaded successfully",
 		})
 	}
@@ -1,13 +1,23 @@
 package routes
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGoRoutes_Setup(t *testing.T) {
@@ -36,3 +46,193 @@ func TestGoRoutes_Setup(t *testing.T) {
 	}
 	assert.True(t, found, "Go routes should be registered")
 }
+
+// createGoModuleZip builds a module zip as the go command lays it out
+func createGoModuleZip(t *testing.T, module, version, goMod string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	files := map[string]string{"hello.go": "package hello\n"}
+	if goMod != "" {
+		files["go.mod"] = goMod
+	}
+	for name, content := range files {
+		f, err := w.Create(module + "@" + version + "/" + name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestGoModuleProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	const module = "example.com/hello"
+	goMod := "module example.com/hello\n\ngo 1.22\n"
+	zips := map[string][]byte{}
+	for _, version := range []string{"v1.2.0", "v1.10.0", "v1.11.0-rc.1", "v1.10.1-0.20240102030405-abcdefabcdef"} {
+		zips[version] = createGoModuleZip(t, module, version, goMod)
+		_, err := registryService.Upload(ctx, "go", module, version, bytes.NewReader(zips[version]), user.ID)
+		require.NoError(t, err)
+	}
+	// Modules whose paths contain the module's are not its versions
+	_, err := registryService.Upload(ctx, "go", module+"/v2", "v2.0.0", bytes.NewReader(createGoModuleZip(t, module+"/v2", "v2.0.0", "")), user.ID)
+	require.NoError(t, err)
+	_, err = registryService.Upload(ctx, "go", "example.com/untagged", "v0.0.0-20240102030405-abcdefabcdef", bytes.NewReader(createGoModuleZip(t, "example.com/untagged", "v0.0.0-20240102030405-abcdefabcdef", "")), user.ID)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/go/*path", handleGoProxyCatchAll(registryService))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/go/"+path, nil))
+		return w
+	}
+	decodeInfo := func(w *httptest.ResponseRecorder) map[string]string {
+		var info map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+		_, err := time.Parse(time.RFC3339, info["Time"])
+		require.NoError(t, err, "Time must be RFC3339")
+		return info
+	}
+
+	// The version list is sorted by semver and leaves out pseudo-versions
+	w := get(module + "/@v/list")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "v1.2.0\nv1.10.0\nv1.11.0-rc.1\n", w.Body.String())
+
+	w = get(module + "/@latest")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, "v1.10.0", decodeInfo(w)["Version"])
+
+	// A module with only pseudo-versions resolves to one, timed by its commit
+	w = get("example.com/untagged/@latest")
+	require.Equal(t, http.StatusOK, w.Code)
+	info := decodeInfo(w)
+	assert.Equal(t, "v0.0.0-20240102030405-abcdefabcdef", info["Version"])
+	assert.Equal(t, "2024-01-02T03:04:05Z", info["Time"])
+
+	// go mod download fetches .info, .mod and .zip in turn
+	w = get(module + "/@v/v1.10.0.info")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1.10.0", decodeInfo(w)["Version"])
+
+	w = get(module + "/@v/v1.10.0.mod")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, goMod, w.Body.String())
+
+	w = get(module + "/@v/v1.10.0.zip")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/zip", w.Header().Get("Content-Type"))
+	assert.Equal(t, zips["v1.10.0"], w.Body.Bytes())
+
+	// Modules without a go.mod get a synthesized one
+	w = get(module + "/v2/@v/v2.0.0.mod")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "module example.com/hello/v2\n", w.Body.String())
+
+	w = get(module + "/v2/@v/list")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v2.0.0\n", w.Body.String())
+
+	// Only fetching the zip counts as a download
+	artifact, err := registryService.GetArtifact(ctx, "go", module, "v1.10.0")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), artifact.Downloads)
+
+	assert.Equal(t, http.StatusNotFound, get(module+"/@v/v9.9.9.info").Code)
+	assert.Equal(t, http.StatusNotFound, get(module+"/@v/v1.10.0.tar").Code)
+	assert.Equal(t, http.StatusNotFound, get("example.com/missing/@latest").Code)
+	assert.Equal(t, http.StatusNotFound, get("example.com/!Bad/@latest").Code)
+	assert.Equal(t, http.StatusNotFound, get(module).Code)
+}
+
+func TestGoModuleProxy_CaseSensitivePaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	// Module paths differing only in case are different modules
+	upper := createGoModuleZip(t, "GitHub.com/User/Repo", "v1.0.0", "module GitHub.com/User/Repo\n")
+	_, err := registryService.Upload(ctx, "go", "GitHub.com/User/Repo", "v1.0.0", bytes.NewReader(upper), user.ID)
+	require.NoError(t, err)
+	_, err = registryService.Upload(ctx, "go", "github.com/user/repo", "v1.1.0", bytes.NewReader(createGoModuleZip(t, "github.com/user/repo", "v1.1.0", "")), user.ID)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.GET("/go/*path", handleGoProxyCatchAll(registryService))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/go/"+path, nil))
+		return w
+	}
+
+	// The go command escapes upper-case letters in the paths it requests
+	w := get("!git!hub.com/!user/!repo/@v/list")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1.0.0\n", w.Body.String())
+
+	w = get("github.com/user/repo/@v/list")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "v1.1.0\n", w.Body.String())
+
+	w = get("!git!hub.com/!user/!repo/@v/v1.0.0.mod")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "module GitHub.com/User/Repo\n", w.Body.String())
+
+	w = get("!git!hub.com/!user/!repo/@v/v1.0.0.zip")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, upper, w.Body.Bytes())
+
+	assert.Equal(t, http.StatusNotFound, get("!git!hub.com/!user/!repo/@v/v1.1.0.info").Code)
+	assert.Equal(t, http.StatusNotFound, get("github.com/user/repo/@v/v1.0.0.info").Code)
+
+	// Module paths are stored as published
+	artifact, err := registryService.GetArtifact(ctx, "go", "GitHub.com/User/Repo", "v1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "GitHub.com/User/Repo", artifact.Name)
+}
+
+func TestGoModuleProxy_RestrictedModule(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	const module = "example.com/private"
+	goMod := "module example.com/private\n"
+	_, err := registryService.Upload(context.Background(), "go", module, "v1.0.0", bytes.NewReader(createGoModuleZip(t, module, "v1.0.0", goMod)), publisher.ID)
+	require.NoError(t, err)
+
+	get := func(user *types.User, path string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/go/*path", handleGoProxyCatchAll(registryService))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/go/"+module+path, nil))
+		return w
+	}
+
+	w := get(publisher, "/@v/v1.0.0.mod")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, goMod, w.Body.String())
+
+	// Users who cannot read the module cannot see its metadata either
+	assert.Equal(t, http.StatusNotFound, get(outsider, "/@v/v1.0.0.mod").Code)
+	assert.Equal(t, http.StatusNotFound, get(outsider, "/@v/v1.0.0.info").Code)
+}
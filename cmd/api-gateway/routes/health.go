@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/version"
+)
+
+// healthCheckTimeout bounds each readiness check, so the probe answers even
+// when a dependency hangs
+const healthCheckTimeout = 2 * time.Second
+
+// healthSentinelPath is the storage path the readiness probe looks up. It
+// need not exist; the lookup only has to succeed.
+const healthSentinelPath = ".health"
+
+// HealthCheck is a dependency the readiness probe checks
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// DatabaseHealthCheck checks that the database answers pings
+func DatabaseHealthCheck(database *common.Database) HealthCheck {
+	return HealthCheck{Name: "database", Check: database.Ping}
+}
+
+// StorageHealthCheck checks that the storage backend answers lookups
+func StorageHealthCheck(blobStorage storage.BlobStorage) HealthCheck {
+	return HealthCheck{Name: "storage", Check: func(ctx context.Context) error {
+		_, err := blobStorage.Exists(ctx, healthSentinelPath)
+		return err
+	}}
+}
+
+// CacheHealthCheck checks that Redis answers pings
+func CacheHealthCheck(cache *common.Cache) HealthCheck {
+	return HealthCheck{Name: "redis", Check: cache.Ping}
+}
+
+// HealthRoutes sets up the liveness probe, which reports the service is up
+// without checking anything, the readiness probe, which checks that the
+// service's dependencies are reachable, and the build metadata of the
+// running binary
+func HealthRoutes(router gin.IRoutes, checks ...HealthCheck) {
+	// GET and HEAD are both supported for Docker health checks
+	router.GET("/health", handleHealth())
+	router.HEAD("/health", handleHealth())
+	router.GET("/health/ready", handleHealthReady(checks))
+	router.HEAD("/health/ready", handleHealthReady(checks))
+	router.GET("/version", handleVersion())
+}
+
+func handleHealth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  "healthy",
+			"service": "lodestone-api-gateway",
+		})
+	}
+}
+
+// handleVersion responds with the version, commit and build time injected at
+// build time, and the Go version the binary was built with, to confirm which
+// build is deployed
+func handleVersion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, version.Get())
+	}
+}
+
+// handleHealthReady runs the readiness checks concurrently and responds 503
+// with the status of each dependency if any is unhealthy
+func handleHealthReady(checks []HealthCheck) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		results := make(map[string]string, len(checks))
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, check := range checks {
+			wg.Add(1)
+			go func(check HealthCheck) {
+				defer wg.Done()
+				status := "healthy"
+				if err := runHealthCheck(c.Request.Context(), check); err != nil {
+					middleware.Logger(c).Warn().Err(err).Str("dependency", check.Name).Msg("Readiness check failed")
+					status = "unhealthy: " + err.Error()
+				}
+				mu.Lock()
+				results[check.Name] = status
+				mu.Unlock()
+			}(check)
+		}
+		wg.Wait()
+
+		code, status := http.StatusOK, "ready"
+		for _, result := range results {
+			if result != "healthy" {
+				code, status = http.StatusServiceUnavailable, "not ready"
+				break
+			}
+		}
+		c.JSON(code, gin.H{
+			"status":       status,
+			"service":      "lodestone-api-gateway",
+			"dependencies": results,
+		})
+	}
+}
+
+// runHealthCheck runs a check with the check timeout. Checks that ignore
+// their context are abandoned once it expires.
+func runHealthCheck(ctx context.Context, check HealthCheck) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- check.Check(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/pkg/version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// failingStorage is a storage backend whose every operation fails
+type failingStorage struct{}
+
+var errStorageDown = errors.New("storage unreachable")
+
+func (failingStorage) Store(ctx context.Context, path string, content io.Reader, contentType string) error {
+	return errStorageDown
+}
+
+func (failingStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	return nil, errStorageDown
+}
+
+func (failingStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	return nil, errStorageDown
+}
+
+func (failingStorage) Delete(ctx context.Context, path string) error {
+	return errStorageDown
+}
+
+func (failingStorage) Exists(ctx context.Context, path string) (bool, error) {
+	return false, errStorageDown
+}
+
+func (failingStorage) GetSize(ctx context.Context, path string) (int64, error) {
+	return 0, errStorageDown
+}
+
+func (failingStorage) GetModTime(ctx context.Context, path string) (time.Time, error) {
+	return time.Time{}, errStorageDown
+}
+
+func (failingStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	return nil, errStorageDown
+}
+
+func TestHealthRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	database := &common.Database{DB: db}
+	registryService, _ := setupRegistryTestService(t)
+
+	probe := func(path string, checks ...HealthCheck) (int, map[string]interface{}) {
+		router := gin.New()
+		HealthRoutes(router, checks...)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := probe("/health/ready", DatabaseHealthCheck(database), StorageHealthCheck(registryService.Storage))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ready", body["status"])
+	assert.Equal(t, map[string]interface{}{"database": "healthy", "storage": "healthy"}, body["dependencies"])
+
+	code, body = probe("/health/ready", DatabaseHealthCheck(database), StorageHealthCheck(failingStorage{}))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "not ready", body["status"])
+	dependencies := body["dependencies"].(map[string]interface{})
+	assert.Equal(t, "healthy", dependencies["database"])
+	assert.Equal(t, "unhealthy: storage unreachable", dependencies["storage"])
+
+	// Liveness does not depend on anything
+	code, body = probe("/health", StorageHealthCheck(failingStorage{}))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "healthy", body["status"])
+
+	// A check that hangs is abandoned after the timeout
+	hang := make(chan struct{})
+	defer close(hang)
+	start := time.Now()
+	code, body = probe("/health/ready", HealthCheck{Name: "stuck", Check: func(ctx context.Context) error {
+		<-hang
+		return nil
+	}})
+	assert.Less(t, time.Since(start), healthCheckTimeout+time.Second)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "unhealthy: "+context.DeadlineExceeded.Error(), body["dependencies"].(map[string]interface{})["stuck"])
+}
+
+func TestVersionRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	HealthRoutes(router)
+	get := func() map[string]interface{} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	// Builds without injected metadata report dev
+	assert.Equal(t, map[string]interface{}{
+		"version":    "dev",
+		"commit":     "dev",
+		"build_time": "dev",
+		"go_version": runtime.Version(),
+	}, get())
+
+	defer func(v, commit, buildTime string) {
+		version.Version, version.Commit, version.BuildTime = v, commit, buildTime
+	}(version.Version, version.Commit, version.BuildTime)
+	version.Version, version.Commit, version.BuildTime = "v1.4.0", "0123abc", "2026-10-16T12:00:00Z"
+
+	body := get()
+	assert.Equal(t, "v1.4.0", body["version"])
+	assert.Equal(t, "0123abc", body["commit"])
+	assert.Equal(t, "2026-10-16T12:00:00Z", body["build_time"])
+}
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,12 +12,13 @@ import (
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
-	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/internal/registry/registries/helm"
 )
 
 // HelmRoutes sets up Helm chart repository routes
 func HelmRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	helm := api.Group("/helm")
+	helm.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("helm")))
 
 	// Helm repository API - requires authentication
 	helm.GET("/index.yaml", middleware.AuthMiddleware(authService), handleHelmIndex(registryService))
@@ -27,67 +29,52 @@ func HelmRoutes(api *gin.RouterGroup, registryService *registry.Service, authSer
 	helm.DELETE("/api/charts/:chart/:version", middleware.AuthMiddleware(authService), handleHelmDelete(registryService))
 }
 
+// helmRegistry returns the Helm handler registered with the service
+func helmRegistry(registryService *registry.Service) (*helm.Registry, error) {
+	handler, err := registryService.GetRegistry("helm")
+	if err != nil {
+		return nil, err
+	}
+	helmHandler, ok := handler.(*helm.Registry)
+	if !ok {
+		return nil, fmt.Errorf("helm registry handler unavailable")
+	}
+	return helmHandler, nil
+}
+
+// handleHelmIndex serves the repository's index.yaml, listing the chart
+// versions the request can read. The index is kept up to date as charts are
+// published and removed, and clients revalidate their cached copy with its
+// entity tag.
 func handleHelmIndex(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx := context.WithValue(c.Request.Context(), "registry", "helm")
-
-		filter := &types.ArtifactFilter{
-			Registry: "helm",
+		helmHandler, err := helmRegistry(registryService)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		readable, err := registryService.ReadableVersions(c.Request.Context(), "helm")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate index"})
+			middleware.Logger(c).Error().Err(err).Msg("Failed to check chart read access")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check chart access"})
 			return
 		}
 
-		// Build Helm index.yaml
-		entries := make(map[string][]map[string]interface{})
-
-		for _, artifact := range artifacts {
-			chartName := artifact.Name
-
-			var description, maintainer string
-			if artifact.Metadata != nil {
-				if desc, ok := artifact.Metadata["description"].(string); ok {
-					description = desc
-				}
-				if maint, ok := artifact.Metadata["maintainer"].(string); ok {
-					maintainer = maint
-				}
-			}
-
-			chartEntry := map[string]interface{}{
-				"name":        chartName,
-				"version":     artifact.Version,
-				"description": description,
-				"created":     artifact.CreatedAt.Format("2006-01-02T15:04:05.000000000Z"),
-				"digest":      artifact.SHA256,
-				"urls": []string{
-					fmt.Sprintf("/helm/%s/%s/%s-%s.tgz", chartName, artifact.Version, chartName, artifact.Version),
-				},
-			}
-
-			if maintainer != "" {
-				chartEntry["maintainers"] = []map[string]string{
-					{"name": maintainer},
-				}
-			}
-
-			if entries[chartName] == nil {
-				entries[chartName] = make([]map[string]interface{}, 0)
-			}
-			entries[chartName] = append(entries[chartName], chartEntry)
+		index, etag, err := helmHandler.Index(c.Request.Context(), readable)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate index"})
+			return
 		}
 
-		index := map[string]interface{}{
-			"apiVersion": "v1",
-			"entries":    entries,
-			"generated":  "2024-01-01T00:00:00Z", // TODO: Use current time
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "no-cache")
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
 		}
 
-		c.Header("Content-Type", "application/x-yaml")
-		c.JSON(http.StatusOK, index)
+		c.Data(http.StatusOK, "application/x-yaml", index)
 	}
 }
 
@@ -104,28 +91,59 @@ func handleHelmDownload(registryService *registry.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "helm")
 
-		artifact, content, err := registryService.Download(ctx, "helm", chart, version)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "chart not found"})
+		// Helm fetches a chart's provenance file from the chart URL with .prov appended
+		if strings.HasSuffix(filename, ".tgz.prov") {
+			serveHelmProvenance(c, registryService, chart, version)
 			return
 		}
 
-		c.Header("Content-Type", "application/gzip")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-		if artifact.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "helm", chart, version)
+		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "chart not found"})
+			return
 		}
 
 		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream chart"})
-			return
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("chart", chart).Str("version", version).Msg("Failed to stream chart")
 		}
 	}
 }
 
+// serveHelmProvenance serves the provenance file of a published chart the
+// request may read
+func serveHelmProvenance(c *gin.Context, registryService *registry.Service, chart, version string) {
+	artifact, err := registryService.GetPublishedArtifact(c.Request.Context(), "helm", chart, version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "chart not found"})
+		return
+	}
+
+	helmHandler, err := helmRegistry(registryService)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	content, err := helmHandler.GetProvenance(c.Request.Context(), artifact.Name, artifact.Version)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "provenance file not found"})
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", "application/pgp-signature")
+	c.Status(http.StatusOK)
+	io.Copy(c.Writer, content)
+}
+
 func handleHelmUpload(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := middleware.GetUserFromContext(c)
@@ -135,6 +153,9 @@ func handleHelmUpload(registryService *registry.Service) gin.HandlerFunc {
 		}
 
 		file, header, err := c.Request.FormFile("chart")
+		if requestTooLarge(c, err) {
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "chart file required"})
 			return
@@ -162,13 +183,35 @@ func handleHelmUpload(registryService *registry.Service) gin.HandlerFunc {
 		version := parts[len(parts)-1]
 		chartName := strings.Join(parts[:len(parts)-1], "-")
 
-		_, err = registryService.Upload(ctx, "helm", chartName, version, file, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+		// A provenance file may be uploaded with the chart
+		var provenance []byte
+		if provFile, _, err := c.Request.FormFile("prov"); err == nil {
+			provenance, err = io.ReadAll(provFile)
+			provFile.Close()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read provenance file"})
+				return
+			}
+		}
+
+		artifact, err := registryService.Upload(ctx, "helm", chartName, version, file, user.ID)
+		status, ok := uploadStatus(c, err, http.StatusCreated)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
+		if provenance != nil {
+			helmHandler, err := helmRegistry(registryService)
+			if err == nil {
+				err = helmHandler.StoreProvenance(ctx, artifact.Name, artifact.Version, provenance)
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store provenance file"})
+				return
+			}
+		}
+
+		c.JSON(status, gin.H{
 			"message": "chart uploaded successfully",
 		})
 	}
@@ -1,13 +1,24 @@
 package routes
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/helm"
+	"github.com/lgulliver/lodestone/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 func TestHelmRoutes_Setup(t *testing.T) {
@@ -36,3 +47,130 @@ func TestHelmRoutes_Setup(t *testing.T) {
 	}
 	assert.True(t, found, "Helm routes should be registered")
 }
+
+// createHelmChart packages a chart with the given Chart.yaml, the way helm
+// package does
+func createHelmChart(t *testing.T, name, chartYAML string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name + "/Chart.yaml", Mode: 0644, Size: int64(len(chartYAML))}))
+	_, err := tw.Write([]byte(chartYAML))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestHelmIndexAndProvenance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/helm/index.yaml", handleHelmIndex(registryService))
+	router.GET("/helm/:chart/:version/:filename", handleHelmDownload(registryService))
+	router.POST("/helm/api/charts", handleHelmUpload(registryService))
+	router.DELETE("/helm/api/charts/:chart/:version", handleHelmDelete(registryService))
+
+	upload := func(version string, provenance []byte) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("chart", "mychart-"+version+".tgz")
+		require.NoError(t, err)
+		_, err = part.Write(createHelmChart(t, "mychart", "apiVersion: v2\nname: mychart\nversion: "+version+"\nappVersion: \"2.0\"\n"))
+		require.NoError(t, err)
+		if provenance != nil {
+			part, err = writer.CreateFormFile("prov", "mychart-"+version+".tgz.prov")
+			require.NoError(t, err)
+			_, err = part.Write(provenance)
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest("POST", "/helm/api/charts", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	readIndex := func(w *httptest.ResponseRecorder) helm.IndexFile {
+		var index helm.IndexFile
+		require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &index))
+		return index
+	}
+
+	upload("1.0.0", []byte("-----BEGIN PGP SIGNED MESSAGE-----\n"))
+
+	w := get("/helm/index.yaml", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	index := readIndex(w)
+	require.Len(t, index.Entries["mychart"], 1)
+	assert.Equal(t, "2.0", index.Entries["mychart"][0].AppVersion)
+
+	// Clients revalidate their cached index
+	assert.Equal(t, http.StatusNotModified, get("/helm/index.yaml", etag).Code)
+
+	// Publishing a version changes the index
+	upload("1.1.0", nil)
+	w = get("/helm/index.yaml", etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	index = readIndex(w)
+	require.Len(t, index.Entries["mychart"], 2)
+	assert.Equal(t, "1.1.0", index.Entries["mychart"][0].Version)
+
+	// Provenance files are served next to the charts they were uploaded with
+	url := "/helm/" + index.Entries["mychart"][1].URLs[0]
+	assert.Equal(t, http.StatusOK, get(url, "").Code)
+	w = get(url+".prov", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "-----BEGIN PGP SIGNED MESSAGE-----\n", w.Body.String())
+	assert.Equal(t, http.StatusNotFound, get("/helm/"+index.Entries["mychart"][0].URLs[0]+".prov", "").Code)
+
+	// Nor are they served to users who cannot read the chart
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+	outsiderRouter := gin.New()
+	outsiderRouter.Use(func(c *gin.Context) {
+		c.Set("user", outsider)
+	}, middleware.PackageReaderMiddleware())
+	outsiderRouter.GET("/helm/index.yaml", handleHelmIndex(registryService))
+	outsiderRouter.GET("/helm/:chart/:version/:filename", handleHelmDownload(registryService))
+	w = httptest.NewRecorder()
+	outsiderRouter.ServeHTTP(w, httptest.NewRequest("GET", url+".prov", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Restricted charts are left out of the index of users who cannot read
+	// them, under an entity tag of its own
+	w = httptest.NewRecorder()
+	outsiderRouter.ServeHTTP(w, httptest.NewRequest("GET", "/helm/index.yaml", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, readIndex(w).Entries)
+	assert.NotEqual(t, get("/helm/index.yaml", "").Header().Get("ETag"), w.Header().Get("ETag"))
+
+	// Deleting a version removes it from the index
+	req := httptest.NewRequest("DELETE", "/helm/api/charts/mychart/1.1.0", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	index = readIndex(get("/helm/index.yaml", ""))
+	require.Len(t, index.Entries["mychart"], 1)
+	assert.Equal(t, "1.0.0", index.Entries["mychart"][0].Version)
+}
@@ -0,0 +1,132 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// setLabelsRequest is the body of a request to label a package
+type setLabelsRequest struct {
+	Labels map[string]string `json:"labels" binding:"required"`
+}
+
+// PackageLabelRoutes sets up the routes managing package labels
+func PackageLabelRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
+	packages := api.Group("/packages")
+	packages.Use(middleware.AuthMiddleware(authService))
+
+	packages.PUT("/:registry/:package/labels", handleSetPackageLabels(registryService))
+	packages.DELETE("/:registry/:package/labels/:key", handleRemovePackageLabel(registryService))
+}
+
+// SetPackageLabels godoc
+//
+//	@Summary		Label a package
+//	@Description	Add labels, such as team=payments, to a version of a package or to all of its versions, replacing the values of labels they already have. Only package owners and admins can change labels
+//	@Tags			Packages
+//	@Accept			json
+//	@Produce		json
+//	@Param			registry	path		string				true	"Registry type (e.g., npm, nuget, maven)"
+//	@Param			package		path		string				true	"Package name"
+//	@Param			version		query		string				false	"Version to label; all versions when omitted"
+//	@Param			labels		body		setLabelsRequest	true	"Labels to set"
+//	@Success		200			{object}	types.APIResponse{data=object{versions=int}}	"Labels set"
+//	@Failure		400			{object}	types.APIResponse	"Invalid request body or label"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Not an owner of the package"
+//	@Failure		404			{object}	types.APIResponse	"Package or version not found"
+//	@Failure		500			{object}	types.APIResponse	"Failed to set labels"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/labels [put]
+func handleSetPackageLabels(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{Success: false, Error: "unauthorized"})
+			return
+		}
+
+		var request setLabelsRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: "invalid request body: " + err.Error()})
+			return
+		}
+
+		versions, err := registryService.SetLabels(c.Request.Context(), c.Param("registry"), c.Param("package"), c.Query("version"), request.Labels, user.ID)
+		if err != nil {
+			respondLabelError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    gin.H{"versions": versions},
+		})
+	}
+}
+
+// RemovePackageLabel godoc
+//
+//	@Summary		Remove a package label
+//	@Description	Remove a label from a version of a package or from all of its versions. Only package owners and admins can change labels
+//	@Tags			Packages
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget, maven)"
+//	@Param			package		path		string	true	"Package name"
+//	@Param			key			path		string	true	"Label key"
+//	@Param			version		query		string	false	"Version to remove the label from; all versions when omitted"
+//	@Success		200			{object}	types.APIResponse{data=object{versions=int}}	"Label removed"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Not an owner of the package"
+//	@Failure		404			{object}	types.APIResponse	"Package, version or label not found"
+//	@Failure		500			{object}	types.APIResponse	"Failed to remove label"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/labels/{key} [delete]
+func handleRemovePackageLabel(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{Success: false, Error: "unauthorized"})
+			return
+		}
+
+		versions, err := registryService.RemoveLabel(c.Request.Context(), c.Param("registry"), c.Param("package"), c.Query("version"), c.Param("key"), user.ID)
+		if err != nil {
+			respondLabelError(c, err)
+			return
+		}
+		if versions == 0 {
+			c.JSON(http.StatusNotFound, types.APIResponse{Success: false, Error: "label not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    gin.H{"versions": versions},
+		})
+	}
+}
+
+// respondLabelError responds to a failure to change package labels
+func respondLabelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, registry.ErrInvalidLabel):
+		c.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: err.Error()})
+	case errors.Is(err, registry.ErrLabelForbidden):
+		c.JSON(http.StatusForbidden, types.APIResponse{Success: false, Error: err.Error()})
+	case errors.Is(err, registry.ErrArtifactNotFound):
+		c.JSON(http.StatusNotFound, types.APIResponse{Success: false, Error: err.Error()})
+	default:
+		middleware.Logger(c).Error().Err(err).
+			Str("registry", c.Param("registry")).
+			Str("package", c.Param("package")).
+			Msg("Failed to change package labels")
+		c.JSON(http.StatusInternalServerError, types.APIResponse{Success: false, Error: "failed to change labels"})
+	}
+}
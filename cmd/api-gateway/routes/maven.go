@@ -2,20 +2,29 @@ package routes
 
 import (
 	"context"
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/maven"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 )
 
 // MavenRoutes sets up Maven repository routes
 func MavenRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	maven := api.Group("/maven")
+	maven.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("maven")))
 
 	// Maven repository structure: groupId/artifactId/version/artifactId-version.jar - requires authentication
 	maven.GET("/*path", middleware.AuthMiddleware(authService), handleMavenDownload(registryService))
@@ -34,10 +43,18 @@ func handleMavenDownload(registryService *registry.Service) gin.HandlerFunc {
 
 		// Parse Maven path: groupId/artifactId/version/filename
 		parts := strings.Split(path, "/")
+		if strings.HasPrefix(parts[len(parts)-1], maven.MetadataFilename) {
+			serveMavenMetadata(c, registryService, parts)
+			return
+		}
 		if len(parts) < 4 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Maven path"})
 			return
 		}
+		if _, algorithm, ok := maven.ChecksumFile(parts[len(parts)-1]); ok {
+			serveMavenChecksum(c, registryService, parts, algorithm)
+			return
+		}
 
 		groupId := strings.Join(parts[:len(parts)-3], ".")
 		artifactId := parts[len(parts)-3]
@@ -48,25 +65,41 @@ func handleMavenDownload(registryService *registry.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "maven")
 
-		artifact, content, err := registryService.Download(ctx, "maven", packageName, version)
+		version, err := resolveMavenVersion(ctx, registryService, packageName, maven.ResolveSnapshotFile(artifactId, version, filename))
 		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get artifact versions"})
 			return
 		}
 
-		c.Header("Content-Type", "application/java-archive")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-		if artifact.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
+		// Only the artifact file of a version is stored, so its other files,
+		// such as its POM, are passed through from the upstream
+		if !isMavenArtifactFile(artifactId, version, filename) && mavenUpstreamServes(ctx, registryService, packageName, version) &&
+			serveMavenUpstreamFile(c, registryService, path, packageName, version, false) {
+			return
 		}
 
-		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "maven", packageName, version)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream artifact"})
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
+			if errors.Is(err, registry.ErrArtifactNotFound) && isMavenArtifactFile(artifactId, version, filename) &&
+				mavenUpstreamServes(ctx, registryService, packageName, version) &&
+				serveMavenUpstreamFile(c, registryService, path, packageName, version, true) {
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
 			return
 		}
+
+		defer content.Close()
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("artifact", packageName).Str("version", version).Msg("Failed to stream artifact")
+		}
 	}
 }
 
@@ -101,29 +134,51 @@ func handleMavenUpload(registryService *registry.Service) gin.HandlerFunc {
 		// Parse Maven path to extract groupId, artifactId, and version
 		// Format: com/example/artifact/1.0.0/artifact-1.0.0.jar
 		pathParts := strings.Split(path, "/")
+
+		// Repository metadata is generated from the stored versions, so
+		// metadata deployed by clients is accepted and discarded
+		if strings.HasPrefix(pathParts[len(pathParts)-1], maven.MetadataFilename) {
+			c.Status(http.StatusCreated)
+			return
+		}
+
+		// Checksums are generated from the stored files too
+		if _, _, ok := maven.ChecksumFile(pathParts[len(pathParts)-1]); ok {
+			c.Status(http.StatusCreated)
+			return
+		}
+
 		if len(pathParts) < 4 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Maven path format"})
 			return
 		}
 
-		// Extract version and filename
-		version := pathParts[len(pathParts)-2]
-		filename := pathParts[len(pathParts)-1]
-
-		// Extract artifact ID from filename (remove version and extension)
-		artifactID := strings.Split(filename, "-")[0]
+		// Extract groupId, artifactId and version the same way downloads do
+		groupId := strings.Join(pathParts[:len(pathParts)-3], ".")
+		artifactID := pathParts[len(pathParts)-3]
+		version := maven.ResolveSnapshotFile(artifactID, pathParts[len(pathParts)-2], pathParts[len(pathParts)-1])
 
 		// Construct full artifact name (groupId:artifactId)
-		groupId := strings.Join(pathParts[:len(pathParts)-2], ".")
 		fullName := fmt.Sprintf("%s:%s", groupId, artifactID)
 
+		// A plain -SNAPSHOT file is stored as the next timestamped build, as
+		// Maven itself names snapshot builds
+		if maven.IsSnapshot(version) && version == maven.SnapshotBaseVersion(version) {
+			artifacts, err := listMavenArtifacts(ctx, registryService, fullName)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get artifact versions"})
+				return
+			}
+			version = maven.NextSnapshotVersion(version, artifacts, time.Now())
+		}
+
 		_, err := registryService.Upload(ctx, "maven", fullName, version, c.Request.Body, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+		status, ok := uploadStatus(c, err, http.StatusCreated)
+		if !ok {
 			return
 		}
 
-		c.Status(http.StatusCreated)
+		c.Status(status)
 	}
 }
 
@@ -141,22 +196,35 @@ func handleMavenHead(registryService *registry.Service) gin.HandlerFunc {
 			c.Status(http.StatusBadRequest)
 			return
 		}
+		if _, algorithm, ok := maven.ChecksumFile(parts[len(parts)-1]); ok {
+			serveMavenChecksum(c, registryService, parts, algorithm)
+			return
+		}
 
 		groupId := strings.Join(parts[:len(parts)-3], ".")
 		artifactId := parts[len(parts)-3]
-		version := parts[len(parts)-2]
+		version := maven.ResolveSnapshotFile(artifactId, parts[len(parts)-2], parts[len(parts)-1])
 		packageName := fmt.Sprintf("%s:%s", groupId, artifactId)
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "maven")
 
+		version, err := resolveMavenVersion(ctx, registryService, packageName, version)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
 		artifact, _, err := registryService.Download(ctx, "maven", packageName, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
 			c.Status(http.StatusNotFound)
 			return
 		}
 
-		c.Header("Content-Type", "application/java-archive")
-		c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
+		setDownloadHeaders(c, artifact)
+		c.Header("Content-Length", strconv.FormatInt(artifact.Size, 10))
 		c.Status(http.StatusOK)
 	}
 }
@@ -199,3 +267,180 @@ func handleMavenDelete(registryService *registry.Service) gin.HandlerFunc {
 		c.Status(http.StatusNoContent)
 	}
 }
+
+// serveMavenMetadata generates maven-metadata.xml, or its .sha1 or .md5
+// checksum, from the stored versions of an artifact. The path is either
+// groupId/artifactId/maven-metadata.xml for the artifact's versions or
+// groupId/artifactId/version-SNAPSHOT/maven-metadata.xml for the builds of
+// a snapshot version.
+func serveMavenMetadata(c *gin.Context, registryService *registry.Service, parts []string) {
+	filename, checksum, _ := maven.ChecksumFile(parts[len(parts)-1])
+	if filename != maven.MetadataFilename {
+		c.JSON(http.StatusNotFound, gin.H{"error": "metadata not found"})
+		return
+	}
+
+	// The directory above the file is a snapshot version for snapshot metadata
+	var snapshotVersion string
+	coordinates := parts[:len(parts)-1]
+	if len(coordinates) > 0 && strings.HasSuffix(coordinates[len(coordinates)-1], "-SNAPSHOT") {
+		snapshotVersion = coordinates[len(coordinates)-1]
+		coordinates = coordinates[:len(coordinates)-1]
+	}
+	if len(coordinates) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Maven path"})
+		return
+	}
+
+	groupId := strings.Join(coordinates[:len(coordinates)-1], ".")
+	artifactId := coordinates[len(coordinates)-1]
+	packageName := fmt.Sprintf("%s:%s", groupId, artifactId)
+
+	ctx := context.WithValue(c.Request.Context(), "registry", "maven")
+
+	artifacts, err := listMavenArtifacts(ctx, registryService, packageName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get artifact versions"})
+		return
+	}
+	// Versions cached from the upstream are only some of those it has, so
+	// the upstream's own metadata is served while no version is published
+	// locally. Local versions count whoever can read them, so a caller who
+	// cannot see a private artifact is not handed the upstream's metadata for
+	// its coordinates.
+	local, err := registryService.IsPublishedLocally(ctx, "maven", packageName)
+	if err != nil {
+		middleware.Logger(c).Error().Err(err).Str("artifact", packageName).Msg("Failed to check for locally published Maven artifact")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get artifact versions"})
+		return
+	}
+	if !local && serveMavenUpstreamMetadata(c, registryService, strings.Join(parts, "/")) {
+		return
+	}
+	if len(artifacts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "metadata not found"})
+		return
+	}
+
+	var metadata *maven.Metadata
+	if snapshotVersion != "" {
+		metadata = maven.BuildSnapshotMetadata(groupId, artifactId, snapshotVersion, artifacts)
+	} else {
+		metadata = maven.BuildMetadata(groupId, artifactId, artifacts)
+	}
+	if metadata == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "metadata not found"})
+		return
+	}
+
+	body, err := metadata.Marshal()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate metadata"})
+		return
+	}
+
+	switch checksum {
+	case "":
+		c.Data(http.StatusOK, "application/xml", body)
+	case registry.ChecksumMD5:
+		sum := md5.Sum(body)
+		c.String(http.StatusOK, hex.EncodeToString(sum[:]))
+	case registry.ChecksumSHA1:
+		c.String(http.StatusOK, utils.ComputeSHA1(body))
+	case registry.ChecksumSHA256:
+		c.String(http.StatusOK, utils.ComputeSHA256(body))
+	case registry.ChecksumSHA512:
+		sum := sha512.Sum512(body)
+		c.String(http.StatusOK, hex.EncodeToString(sum[:]))
+	}
+}
+
+// serveMavenChecksum serves the checksum of the file at a Maven path with a
+// checksum extension as the bare hex digest, without the trailing newline
+// some clients reject. Checksums are computed from the stored file the first
+// time they are asked for and recorded with it.
+func serveMavenChecksum(c *gin.Context, registryService *registry.Service, parts []string, algorithm string) {
+	groupId := strings.Join(parts[:len(parts)-3], ".")
+	artifactId := parts[len(parts)-3]
+	filename, _, _ := maven.ChecksumFile(parts[len(parts)-1])
+	packageName := fmt.Sprintf("%s:%s", groupId, artifactId)
+
+	ctx := context.WithValue(c.Request.Context(), "registry", "maven")
+
+	version, err := resolveMavenVersion(ctx, registryService, packageName, maven.ResolveSnapshotFile(artifactId, parts[len(parts)-2], filename))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get artifact versions"})
+		return
+	}
+
+	// Checksums of files that are not stored, and of artifacts not yet
+	// cached, are passed through from the upstream
+	path := strings.Join(parts, "/")
+	if !isMavenArtifactFile(artifactId, version, filename) && mavenUpstreamServes(ctx, registryService, packageName, version) &&
+		serveMavenUpstreamFile(c, registryService, path, packageName, version, false) {
+		return
+	}
+
+	// Artifacts the caller cannot read are not found, and their checksums are
+	// neither served nor computed. The upstream is only asked for coordinates
+	// not published locally.
+	artifact, err := registryService.GetPublishedArtifact(ctx, "maven", packageName, version)
+	if errors.Is(err, registry.ErrArtifactNotFound) && mavenUpstreamServes(ctx, registryService, packageName, version) &&
+		serveMavenUpstreamFile(c, registryService, path, packageName, version, false) {
+		return
+	}
+	if errors.Is(err, registry.ErrArtifactNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "artifact not found"})
+		return
+	}
+	if errors.Is(err, auth.ErrAPIKeyScopeForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get artifact"})
+		return
+	}
+
+	sum, err := registryService.ArtifactChecksum(ctx, artifact, algorithm)
+	if err != nil {
+		middleware.Logger(c).Error().Err(err).Str("artifact", packageName).Str("version", version).Str("algorithm", algorithm).Msg("Failed to compute artifact checksum")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to compute checksum"})
+		return
+	}
+	c.String(http.StatusOK, sum)
+}
+
+// listMavenArtifacts returns the published versions of groupId:artifactId
+func listMavenArtifacts(ctx context.Context, registryService *registry.Service, packageName string) ([]*types.Artifact, error) {
+	listed, err := registryService.ListAll(ctx, &types.ArtifactFilter{Name: packageName, Registry: "maven"})
+	if err != nil {
+		return nil, err
+	}
+
+	// Name filters match substrings, so keep only this artifact's versions
+	artifacts := make([]*types.Artifact, 0, len(listed))
+	for _, artifact := range listed {
+		if strings.EqualFold(artifact.Name, packageName) {
+			artifacts = append(artifacts, artifact)
+		}
+	}
+	return artifacts, nil
+}
+
+// resolveMavenVersion resolves a plain -SNAPSHOT version, requested as
+// artifactId-1.0-SNAPSHOT.jar, to its newest timestamped build. Other
+// versions, and snapshots without builds, are returned unchanged.
+func resolveMavenVersion(ctx context.Context, registryService *registry.Service, packageName, version string) (string, error) {
+	if !maven.IsSnapshot(version) || version != maven.SnapshotBaseVersion(version) {
+		return version, nil
+	}
+	artifacts, err := listMavenArtifacts(ctx, registryService, packageName)
+	if err != nil {
+		return "", err
+	}
+	if newest := maven.NewestSnapshotBuild(version, artifacts); newest != nil {
+		return newest.Version, nil
+	}
+	return version, nil
+}
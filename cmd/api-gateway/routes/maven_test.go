@@ -0,0 +1,553 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/maven"
+	"github.com/lgulliver/lodestone/internal/retention"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMavenMetadata(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/maven/*path", handleMavenDownload(registryService))
+	router.PUT("/maven/*path", handleMavenUpload(registryService))
+
+	request := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{
+		"/maven/com/example/my-app/1.0.0/my-app-1.0.0.jar",
+		"/maven/com/example/my-app/1.1.0/my-app-1.1.0.jar",
+		"/maven/com/example/my-app/2.0-SNAPSHOT/my-app-2.0-20240301.150000-1.jar",
+		"/maven/com/example/my-app-extras/9.0.0/my-app-extras-9.0.0.jar",
+	} {
+		w := request("PUT", path, []byte("jar content "+path))
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	// Deployed metadata is discarded in favour of the generated document
+	assert.Equal(t, http.StatusCreated, request("PUT", "/maven/com/example/my-app/maven-metadata.xml", []byte("<metadata/>")).Code)
+
+	w := request("GET", "/maven/com/example/my-app/maven-metadata.xml", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+
+	var metadata maven.Metadata
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &metadata))
+	assert.Equal(t, "com.example", metadata.GroupID)
+	assert.Equal(t, "my-app", metadata.ArtifactID)
+	assert.Equal(t, []string{"1.0.0", "1.1.0", "2.0-SNAPSHOT"}, metadata.Versioning.Versions)
+	assert.Equal(t, "1.1.0", metadata.Versioning.Release)
+
+	checksum := request("GET", "/maven/com/example/my-app/maven-metadata.xml.sha1", nil)
+	require.Equal(t, http.StatusOK, checksum.Code)
+	assert.Equal(t, utils.ComputeSHA1(w.Body.Bytes()), checksum.Body.String())
+	checksum = request("GET", "/maven/com/example/my-app/maven-metadata.xml.sha256", nil)
+	require.Equal(t, http.StatusOK, checksum.Code)
+	assert.Equal(t, utils.ComputeSHA256(w.Body.Bytes()), checksum.Body.String())
+
+	w = request("GET", "/maven/com/example/my-app/2.0-SNAPSHOT/maven-metadata.xml", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var snapshot maven.Metadata
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &snapshot))
+	require.NotNil(t, snapshot.Versioning.Snapshot)
+	assert.Equal(t, "20240301.150000", snapshot.Versioning.Snapshot.Timestamp)
+	assert.Equal(t, 1, snapshot.Versioning.Snapshot.BuildNumber)
+
+	// The build named by the snapshot metadata downloads from the snapshot directory
+	w = request("GET", "/maven/com/example/my-app/2.0-SNAPSHOT/my-app-2.0-20240301.150000-1.jar", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "jar content /maven/com/example/my-app/2.0-SNAPSHOT/my-app-2.0-20240301.150000-1.jar", w.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, request("GET", "/maven/com/example/missing/maven-metadata.xml", nil).Code)
+
+	_, err := registryService.GetArtifact(context.Background(), "maven", "com.example:my-app", "1.0.0")
+	assert.NoError(t, err, "uploads are stored under groupId:artifactId")
+}
+
+func TestMavenSnapshotDeploys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/maven/*path", handleMavenDownload(registryService))
+	router.PUT("/maven/*path", handleMavenUpload(registryService))
+	router.HEAD("/maven/*path", handleMavenHead(registryService))
+
+	request := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	snapshotMetadata := func(version string) maven.Metadata {
+		w := request("GET", "/maven/com/example/my-app/"+version+"/maven-metadata.xml", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var metadata maven.Metadata
+		require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &metadata))
+		require.NotNil(t, metadata.Versioning.Snapshot)
+		return metadata
+	}
+
+	t.Run("timestamped by the client", func(t *testing.T) {
+		first := "/maven/com/example/my-app/2.0-SNAPSHOT/my-app-2.0-20240301.150000-1.jar"
+		second := "/maven/com/example/my-app/2.0-SNAPSHOT/my-app-2.0-20240302.090000-2.jar"
+		require.Equal(t, http.StatusCreated, request("PUT", first, []byte("first build")).Code)
+		require.Equal(t, http.StatusCreated, request("PUT", second, []byte("second build")).Code)
+
+		metadata := snapshotMetadata("2.0-SNAPSHOT")
+		assert.Equal(t, "20240302.090000", metadata.Versioning.Snapshot.Timestamp)
+		assert.Equal(t, 2, metadata.Versioning.Snapshot.BuildNumber)
+		assert.Equal(t, "2.0-20240302.090000-2", metadata.Versioning.SnapshotVersions[0].Value)
+
+		// The plain snapshot file resolves to the newest build, and earlier builds stay available
+		assert.Equal(t, "second build", request("GET", "/maven/com/example/my-app/2.0-SNAPSHOT/my-app-2.0-SNAPSHOT.jar", nil).Body.String())
+		assert.Equal(t, "first build", request("GET", first, nil).Body.String())
+	})
+
+	t.Run("timestamped on upload", func(t *testing.T) {
+		path := "/maven/com/example/my-app/3.0-SNAPSHOT/my-app-3.0-SNAPSHOT.jar"
+		require.Equal(t, http.StatusCreated, request("PUT", path, []byte("first build")).Code)
+		first := snapshotMetadata("3.0-SNAPSHOT")
+		assert.Equal(t, 1, first.Versioning.Snapshot.BuildNumber)
+
+		require.Equal(t, http.StatusCreated, request("PUT", path, []byte("second build")).Code)
+		second := snapshotMetadata("3.0-SNAPSHOT")
+		assert.Equal(t, 2, second.Versioning.Snapshot.BuildNumber)
+		build := second.Versioning.SnapshotVersions[0].Value
+		assert.Equal(t, "3.0-"+second.Versioning.Snapshot.Timestamp+"-2", build)
+
+		w := request("GET", path, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "second build", w.Body.String())
+
+		w = request("HEAD", path, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "12", w.Header().Get("Content-Length"))
+
+		// Each build is also served under the name its metadata gives it
+		assert.Equal(t, "second build", request("GET", "/maven/com/example/my-app/3.0-SNAPSHOT/my-app-"+build+".jar", nil).Body.String())
+	})
+
+	assert.Equal(t, http.StatusNotFound, request("GET", "/maven/com/example/my-app/4.0-SNAPSHOT/my-app-4.0-SNAPSHOT.jar", nil).Code)
+}
+
+func TestMavenChecksums(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/maven/*path", handleMavenDownload(registryService))
+	router.HEAD("/maven/*path", handleMavenHead(registryService))
+	router.PUT("/maven/*path", handleMavenUpload(registryService))
+
+	request := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	const jar = "/maven/com/example/checked/1.0.0/checked-1.0.0.jar"
+	require.Equal(t, http.StatusCreated, request("PUT", jar, []byte("hello world")).Code)
+
+	// Checksums deployed alongside the jar are discarded rather than stored
+	// in its place
+	assert.Equal(t, http.StatusCreated, request("PUT", jar+".sha1", []byte("0000")).Code)
+
+	expected := map[string]string{
+		"md5":    "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		"sha1":   "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed",
+		"sha256": "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		"sha512": "309ecc489c12d6eb4cc40f50c902f2b4d0ed77ee511a7c7a9bcd3ca86d4cd86f989dd35bc5ff499670da34255b45b0cfd830e81f605dcf7dc5542e93ae9cd76f",
+	}
+	for algorithm, sum := range expected {
+		w := request("GET", jar+"."+algorithm, nil)
+		require.Equal(t, http.StatusOK, w.Code, algorithm)
+		assert.Equal(t, sum, w.Body.String(), algorithm)
+	}
+
+	// The checksums are recorded with the artifact on first use
+	artifact, err := registryService.GetArtifact(context.Background(), "maven", "com.example:checked", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, expected["md5"], artifact.Metadata["md5"])
+	assert.Equal(t, expected["sha1"], artifact.Metadata["sha1"])
+	assert.Equal(t, expected["sha512"], artifact.Metadata["sha512"])
+
+	// The jar itself is unchanged
+	w := request("GET", jar, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello world", w.Body.String())
+
+	w = request("HEAD", jar+".sha1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, http.StatusNotFound, request("GET", "/maven/com/example/checked/2.0.0/checked-2.0.0.jar.sha1", nil).Code)
+	assert.Equal(t, http.StatusNotFound, request("GET", "/maven/com/example/missing/1.0.0/missing-1.0.0.jar.md5", nil).Code)
+	assert.Equal(t, http.StatusNotFound, request("HEAD", "/maven/com/example/missing/1.0.0/missing-1.0.0.jar.md5", nil).Code)
+}
+
+func TestMavenChecksums_RestrictedArtifact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	routerFor := func(user *types.User) *gin.Engine {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Next()
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/maven/*path", handleMavenDownload(registryService))
+		router.HEAD("/maven/*path", handleMavenHead(registryService))
+		router.PUT("/maven/*path", handleMavenUpload(registryService))
+		return router
+	}
+
+	const jar = "/maven/com/example/private-lib/1.0.0/private-lib-1.0.0.jar"
+	w := httptest.NewRecorder()
+	routerFor(publisher).ServeHTTP(w, httptest.NewRequest("PUT", jar, bytes.NewReader([]byte("hello world"))))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// Another user learns nothing about the private jar from its checksums
+	for _, method := range []string{"GET", "HEAD"} {
+		w = httptest.NewRecorder()
+		routerFor(outsider).ServeHTTP(w, httptest.NewRequest(method, jar+".sha1", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, method)
+		assert.NotContains(t, w.Body.String(), "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed", method)
+	}
+
+	artifact, err := registryService.GetArtifact(context.Background(), "maven", "com.example:private-lib", "1.0.0")
+	require.NoError(t, err)
+	assert.Empty(t, artifact.Metadata["sha1"])
+}
+
+func TestMavenSnapshotRetention(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/maven/*path", handleMavenDownload(registryService))
+	router.PUT("/maven/*path", handleMavenUpload(registryService))
+
+	request := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	const release = "/maven/com/example/nightly/1.0/nightly-1.0.jar"
+	require.Equal(t, http.StatusCreated, request("PUT", release, []byte("release")).Code)
+	builds := []string{
+		"/maven/com/example/nightly/2.0-SNAPSHOT/nightly-2.0-20240301.150000-1.jar",
+		"/maven/com/example/nightly/2.0-SNAPSHOT/nightly-2.0-20240302.150000-2.jar",
+		"/maven/com/example/nightly/2.0-SNAPSHOT/nightly-2.0-20240303.150000-3.jar",
+		"/maven/com/example/nightly/2.0-SNAPSHOT/nightly-2.0-20240304.150000-4.jar",
+		"/maven/com/example/nightly/2.0-SNAPSHOT/nightly-2.0-20240305.150000-5.jar",
+	}
+	for i, path := range builds {
+		require.Equal(t, http.StatusCreated, request("PUT", path, []byte(fmt.Sprintf("build %d", i+1))).Code)
+	}
+
+	retentionService := retention.NewService(registryService.DB.DB, registryService)
+	policy := &types.RetentionPolicy{RegistryName: "maven", Enabled: true, KeepLastVersions: 1, KeepSnapshotBuilds: 2, UpdatedBy: &user.ID}
+
+	// A dry run lists the older builds without removing them
+	candidates, err := retentionService.DryRun(ctx, policy)
+	require.NoError(t, err)
+	var listed []string
+	for _, candidate := range candidates {
+		listed = append(listed, candidate.Version)
+	}
+	assert.Equal(t, []string{"2.0-20240303.150000-3", "2.0-20240302.150000-2", "2.0-20240301.150000-1"}, listed)
+	for _, path := range builds {
+		assert.Equal(t, http.StatusOK, request("GET", path, nil).Code, path)
+	}
+
+	removed, err := retentionService.Apply(ctx, policy)
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	// Only the newest builds remain, with their checksums, and the release is kept
+	for i, path := range builds {
+		expected := http.StatusNotFound
+		if i >= len(builds)-2 {
+			expected = http.StatusOK
+		}
+		assert.Equal(t, expected, request("GET", path, nil).Code, path)
+		assert.Equal(t, expected, request("GET", path+".sha1", nil).Code, path)
+	}
+	assert.Equal(t, http.StatusOK, request("GET", release, nil).Code)
+
+	// The -SNAPSHOT version still resolves to its newest build
+	assert.Equal(t, "build 5", request("GET", "/maven/com/example/nightly/2.0-SNAPSHOT/nightly-2.0-SNAPSHOT.jar", nil).Body.String())
+	w := request("GET", "/maven/com/example/nightly/2.0-SNAPSHOT/maven-metadata.xml", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var metadata maven.Metadata
+	require.NoError(t, xml.Unmarshal(w.Body.Bytes(), &metadata))
+	require.NotNil(t, metadata.Versioning.Snapshot)
+	assert.Equal(t, 5, metadata.Versioning.Snapshot.BuildNumber)
+}
+
+func TestMavenUpstreamMirror(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+	// Jars are cached from a background goroutine, which must see the same
+	// in-memory database
+	sqlDB, err := registryService.DB.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	const (
+		jar      = "jar content"
+		snapshot = "snapshot jar content"
+		metadata = "<metadata><groupId>com.example</groupId><artifactId>lib</artifactId></metadata>"
+	)
+	var jarRequests, corruptChecksumRequests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/com/example/lib/1.0.0/lib-1.0.0.jar":
+			jarRequests.Add(1)
+			fmt.Fprint(w, jar)
+		case "/com/example/lib/1.0.0/lib-1.0.0.jar.sha1":
+			// Some repositories follow the digest with the file's name
+			fmt.Fprintf(w, "%s  lib-1.0.0.jar\n", utils.ComputeSHA1([]byte(jar)))
+		case "/com/example/lib/1.0.0/lib-1.0.0.pom":
+			fmt.Fprint(w, "<project/>")
+		case "/com/example/lib/maven-metadata.xml":
+			fmt.Fprint(w, metadata)
+		case "/com/example/lib/2.0-SNAPSHOT/lib-2.0-20240301.150000-1.jar":
+			fmt.Fprint(w, snapshot)
+		case "/com/example/lib/2.0-SNAPSHOT/lib-2.0-20240301.150000-1.jar.sha1":
+			fmt.Fprint(w, utils.ComputeSHA1([]byte(snapshot)))
+		case "/com/example/corrupt/1.0.0/corrupt-1.0.0.jar":
+			fmt.Fprint(w, jar)
+		case "/com/example/corrupt/1.0.0/corrupt-1.0.0.jar.sha1":
+			corruptChecksumRequests.Add(1)
+			fmt.Fprint(w, utils.ComputeSHA1([]byte("other content")))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	registryService.Configure(config.RegistryConfig{
+		UpstreamURLs:     map[string]string{"maven": upstream.URL},
+		UpstreamCacheTTL: time.Hour,
+	})
+
+	// Anonymous downloads are cached too, and served from the cache to
+	// readers limited to public packages
+	router := gin.New()
+	router.Use(middleware.PackageReaderMiddleware())
+	router.GET("/maven/*path", handleMavenDownload(registryService))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	cached := func(name, version string) bool {
+		artifact, err := registryService.GetArtifact(context.Background(), "maven", name, version)
+		return err == nil && registry.IsUpstreamCached(artifact)
+	}
+
+	// Files missing upstream too are still not found, and nothing is cached
+	assert.Equal(t, http.StatusNotFound, get("/maven/com/example/missing/1.0.0/missing-1.0.0.jar").Code)
+	assert.Equal(t, http.StatusNotFound, get("/maven/com/example/missing/1.0.0/missing-1.0.0.jar.sha1").Code)
+	assert.Equal(t, http.StatusNotFound, get("/maven/com/example/missing/maven-metadata.xml").Code)
+	_, err = registryService.GetArtifact(context.Background(), "maven", "com.example:missing", "1.0.0")
+	assert.ErrorIs(t, err, registry.ErrArtifactNotFound)
+
+	// Metadata and files other than the jar are passed through
+	w := get("/maven/com/example/lib/maven-metadata.xml")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, metadata, w.Body.String())
+	w = get("/maven/com/example/lib/1.0.0/lib-1.0.0.pom")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<project/>", w.Body.String())
+	assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+
+	// The jar is streamed from the upstream and cached in the background
+	w = get("/maven/com/example/lib/1.0.0/lib-1.0.0.jar")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, jar, w.Body.String())
+	assert.Equal(t, "application/java-archive", w.Header().Get("Content-Type"))
+	assert.Eventually(t, func() bool { return cached("com.example:lib", "1.0.0") }, 5*time.Second, 10*time.Millisecond)
+
+	// Its checksums are recorded with it
+	assert.Eventually(t, func() bool {
+		artifact, err := registryService.GetArtifact(context.Background(), "maven", "com.example:lib", "1.0.0")
+		return err == nil && artifact.Metadata["sha1"] == utils.ComputeSHA1([]byte(jar))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Snapshot builds are passed through without being cached
+	w = get("/maven/com/example/lib/2.0-SNAPSHOT/lib-2.0-20240301.150000-1.jar")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, snapshot, w.Body.String())
+	assert.False(t, cached("com.example:lib", "2.0-20240301.150000-1"))
+
+	// A jar that does not match its upstream checksum is not cached
+	w = get("/maven/com/example/corrupt/1.0.0/corrupt-1.0.0.jar")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Eventually(t, func() bool { return corruptChecksumRequests.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Never(t, func() bool { return cached("com.example:corrupt", "1.0.0") }, 200*time.Millisecond, 10*time.Millisecond)
+
+	// Once cached, the upstream is no longer needed for the jar or its checksum
+	upstream.Close()
+	w = get("/maven/com/example/lib/1.0.0/lib-1.0.0.jar")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, jar, w.Body.String())
+	assert.Equal(t, int32(1), jarRequests.Load())
+	w = get("/maven/com/example/lib/1.0.0/lib-1.0.0.jar.sha1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, utils.ComputeSHA1([]byte(jar)), w.Body.String())
+
+	// Metadata is still served from the upstream response cached for the TTL
+	w = get("/maven/com/example/lib/maven-metadata.xml")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, metadata, w.Body.String())
+}
+
+// TestMavenUpstreamLocalArtifact verifies that the metadata of an artifact
+// published locally, and files of its missing versions, are neither fetched
+// from the upstream nor cached, since the upstream's artifact at those
+// coordinates is a different one
+func TestMavenUpstreamLocalArtifact(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	var upstreamRequests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequests.Add(1)
+		fmt.Fprint(w, "upstream jar content")
+	}))
+	defer upstream.Close()
+	registryService.Configure(config.RegistryConfig{
+		UpstreamURLs:     map[string]string{"maven": upstream.URL},
+		UpstreamCacheTTL: time.Hour,
+	})
+
+	_, err := registryService.Upload(ctx, "maven", "com.example:internal", "1.0.0", bytes.NewReader([]byte("local jar content")), user.ID)
+	require.NoError(t, err)
+
+	// Anonymous callers, who cannot read the private artifact, are not handed
+	// the upstream's files or metadata for its coordinates either
+	router := gin.New()
+	router.Use(middleware.PackageReaderMiddleware())
+	router.GET("/maven/*path", handleMavenDownload(registryService))
+	for _, path := range []string{
+		"/maven/com/example/internal/2.0.0/internal-2.0.0.jar",
+		"/maven/com/example/internal/2.0.0/internal-2.0.0.pom",
+		"/maven/com/example/internal/maven-metadata.xml",
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+	assert.Equal(t, int32(0), upstreamRequests.Load())
+
+	_, err = registryService.CacheUpstream(ctx, "maven", "com.example:internal", "2.0.0", []byte("upstream jar content"))
+	assert.ErrorIs(t, err, registry.ErrPublishedLocally)
+	_, err = registryService.GetArtifact(ctx, "maven", "com.example:internal", "2.0.0")
+	assert.ErrorIs(t, err, registry.ErrArtifactNotFound)
+
+	// Nor can users publish under coordinates only cached from the mirror
+	_, err = registryService.CacheUpstream(ctx, "maven", "org.apache:commons", "1.0.0", []byte("upstream jar content"))
+	require.NoError(t, err)
+	_, err = registryService.Upload(ctx, "maven", "org.apache:commons", "99.0.0", bytes.NewReader([]byte("local jar content")), user.ID)
+	assert.ErrorIs(t, err, registry.ErrPublishForbidden)
+}
+
+func TestMavenUpstreamSnapshotCaching(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	sqlDB, err := registryService.DB.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/com/example/lib/2.0-SNAPSHOT/lib-2.0-20240301.150000-1.jar":
+			fmt.Fprint(w, "snapshot jar content")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	registryService.Configure(config.RegistryConfig{
+		UpstreamURLs:           map[string]string{"maven": upstream.URL},
+		UpstreamCacheTTL:       time.Hour,
+		UpstreamCacheSnapshots: true,
+	})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/maven/*path", handleMavenDownload(registryService))
+
+	// Timestamped builds never change, so they are cached when configured to
+	req := httptest.NewRequest("GET", "/maven/com/example/lib/2.0-SNAPSHOT/lib-2.0-20240301.150000-1.jar", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "snapshot jar content", w.Body.String())
+	assert.Eventually(t, func() bool {
+		artifact, err := registryService.GetArtifact(context.Background(), "maven", "com.example:lib", "2.0-20240301.150000-1")
+		return err == nil && registry.IsUpstreamCached(artifact)
+	}, 5*time.Second, 10*time.Millisecond)
+}
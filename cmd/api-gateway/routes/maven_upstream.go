@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/maven"
+	"github.com/lgulliver/lodestone/pkg/upstream"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// maxMavenChecksumSize bounds how much of an upstream checksum file is read
+const maxMavenChecksumSize = 1024
+
+// isMavenArtifactFile reports whether filename is the file a Maven version is
+// stored as, artifactId-version.jar. Each version holds that one file, so
+// its other files, such as its POM, are not stored locally.
+func isMavenArtifactFile(artifactID, version, filename string) bool {
+	return filename == artifactID+"-"+version+".jar"
+}
+
+// mavenUpstreamServes reports whether a request for a file of a version may
+// be answered from the Maven upstream: one is configured, and the version
+// was itself cached from the upstream, since then the upstream holds the
+// files the version does not, or is missing from an artifact not published
+// locally, since the upstream's artifact at a locally published artifact's
+// coordinates is a different one
+func mavenUpstreamServes(ctx context.Context, registryService *registry.Service, packageName, version string) bool {
+	if registryService.Upstream("maven") == nil {
+		return false
+	}
+	if artifact, err := registryService.GetArtifact(ctx, "maven", packageName, version); err == nil {
+		return registry.IsUpstreamCached(artifact)
+	}
+	local, err := registryService.IsPublishedLocally(ctx, "maven", packageName)
+	if err != nil {
+		middleware.LoggerFromContext(ctx).Error().Err(err).Str("artifact", packageName).Msg("failed to check for locally published Maven artifact")
+		return false
+	}
+	return !local
+}
+
+// serveMavenUpstreamFile streams the file at a Maven path from the upstream.
+// When cache is set the file is the version's artifact file, which is then
+// cached in the background along with its checksums, once it matches the
+// SHA1 the upstream lists for it, so later downloads are served locally.
+// Snapshot builds are only cached when the registry is configured to. It
+// returns false when the upstream does not have the file either.
+func serveMavenUpstreamFile(c *gin.Context, registryService *registry.Service, path, packageName, version string, cache bool) bool {
+	proxy := registryService.Upstream("maven")
+	if proxy == nil {
+		return false
+	}
+
+	content, size, err := proxy.Open(c.Request.Context(), "/"+path)
+	if err != nil {
+		if !upstream.IsNotFound(err) {
+			middleware.Logger(c).Warn().Err(err).Str("path", path).Str("upstream", proxy.URL()).Msg("failed to fetch Maven file from upstream")
+		}
+		return false
+	}
+	defer content.Close()
+
+	c.Header("Content-Type", mavenFileContentType(path))
+	if size >= 0 {
+		c.Header("Content-Length", fmt.Sprintf("%d", size))
+	}
+	c.Status(http.StatusOK)
+
+	if maven.IsSnapshot(version) && !(registryService.CachesUpstreamSnapshots() && maven.IsSnapshotBuild(version)) {
+		cache = false
+	}
+	if !cache {
+		if _, err := io.Copy(c.Writer, content); err != nil {
+			middleware.Logger(c).Warn().Err(err).Str("path", path).Msg("failed to stream Maven file from upstream")
+		}
+		return true
+	}
+
+	file := newUpstreamCacheBuffer(registryService.MaxUploadSize("maven"), size)
+	if _, err := io.Copy(c.Writer, io.TeeReader(content, file)); err != nil {
+		// The response has started, so the client sees a truncated body
+		middleware.Logger(c).Warn().Err(err).Str("path", path).Msg("failed to stream Maven file from upstream")
+		return true
+	}
+	if file.overflow {
+		middleware.Logger(c).Info().Str("path", path).Msg("Maven file from upstream exceeds the upload limit, not caching")
+		return true
+	}
+
+	// The gin context is reused once the handler returns, so the logger is
+	// taken from it first
+	logger := middleware.Logger(c)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), "registry", "maven"), upstreamCacheTimeout)
+		defer cancel()
+
+		// A file that does not match its upstream checksum is not kept, so a
+		// corrupted transfer is fetched again next time
+		expected, err := fetchMavenUpstreamChecksum(ctx, proxy, path+".sha1")
+		if err != nil && !upstream.IsNotFound(err) {
+			logger.Warn().Err(err).Str("path", path).Msg("failed to fetch Maven checksum from upstream, not caching")
+			return
+		}
+		if actual := utils.ComputeSHA1(file.Bytes()); expected != "" && !strings.EqualFold(expected, actual) {
+			logger.Warn().Str("path", path).Str("expected", expected).Str("actual", actual).Msg("Maven file from upstream does not match its checksum, not caching")
+			return
+		}
+
+		artifact, err := registryService.CacheUpstream(ctx, "maven", packageName, version, file.Bytes())
+		if err != nil {
+			logger.Warn().Err(err).Str("package", packageName).Str("version", version).Msg("failed to cache Maven file from upstream")
+			return
+		}
+		// Computing one checksum records them all with the artifact
+		if _, err := registryService.ArtifactChecksum(ctx, artifact, registry.ChecksumSHA1); err != nil {
+			logger.Warn().Err(err).Str("package", packageName).Str("version", version).Msg("failed to record checksums of Maven file from upstream")
+		}
+	}()
+	return true
+}
+
+// serveMavenUpstreamMetadata answers a request for maven-metadata.xml, or
+// one of its checksums, from the upstream, whose metadata responses are
+// reused for the upstream cache TTL. It returns false when the upstream does
+// not have the metadata either.
+func serveMavenUpstreamMetadata(c *gin.Context, registryService *registry.Service, path string) bool {
+	proxy := registryService.Upstream("maven")
+	if proxy == nil {
+		return false
+	}
+
+	body, err := proxy.FetchMetadata(c.Request.Context(), "/"+path)
+	if err != nil {
+		if !upstream.IsNotFound(err) {
+			middleware.Logger(c).Warn().Err(err).Str("path", path).Str("upstream", proxy.URL()).Msg("failed to fetch Maven metadata from upstream")
+		}
+		return false
+	}
+
+	c.Data(http.StatusOK, mavenFileContentType(path), body)
+	return true
+}
+
+// fetchMavenUpstreamChecksum returns the hex SHA1 digest in a .sha1 file on
+// the upstream, which may follow it with the file's name
+func fetchMavenUpstreamChecksum(ctx context.Context, proxy *upstream.Proxy, path string) (string, error) {
+	content, _, err := proxy.Open(ctx, "/"+path)
+	if err != nil {
+		return "", err
+	}
+	defer content.Close()
+
+	body, err := io.ReadAll(io.LimitReader(content, maxMavenChecksumSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to read upstream checksum: %w", err)
+	}
+	fields := strings.Fields(string(body))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty upstream checksum %s", path)
+	}
+	if _, err := hex.DecodeString(fields[0]); err != nil || len(fields[0]) != 2*sha1.Size {
+		return "", fmt.Errorf("invalid upstream checksum %s", path)
+	}
+	return fields[0], nil
+}
+
+// mavenFileContentType returns the content type to serve a Maven file
+// passed through from the upstream as, by its extension
+func mavenFileContentType(path string) string {
+	if _, _, ok := maven.ChecksumFile(path); ok {
+		return "text/plain"
+	}
+	switch {
+	case strings.HasSuffix(path, ".pom"), strings.HasSuffix(path, ".xml"):
+		return "application/xml"
+	case strings.HasSuffix(path, ".jar"), strings.HasSuffix(path, ".war"), strings.HasSuffix(path, ".aar"):
+		return "application/java-archive"
+	default:
+		return genericContentType
+	}
+}
@@ -1,31 +1,36 @@
 package routes
 
 import (
-	"archive/tar"
 	"bytes"
-	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/advisories"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/npm"
 	"github.com/lgulliver/lodestone/pkg/types"
 	"github.com/lgulliver/lodestone/pkg/utils"
-	"github.com/rs/zerolog/log"
 )
 
 // NPMRoutes sets up npm registry routes
 func NPMRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	npm := api.Group("/npm")
+	npm.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("npm")))
 
 	// Package metadata and download - requires authentication
 	npm.GET("/:name", middleware.AuthMiddleware(authService), handleNPMPackageInfo(registryService))
@@ -45,26 +50,34 @@ func NPMRoutes(api *gin.RouterGroup, registryService *registry.Service, authServ
 	npm.DELETE("/:name/-rev/:rev", middleware.AuthMiddleware(authService), handleNPMDelete(registryService))
 	npm.DELETE("/@:scope/:name/-rev/:rev", middleware.AuthMiddleware(authService), handleNPMScopedDelete(registryService))
 
+	// Legacy login and the logged in user, as used by npm login and npm whoami
+	npm.PUT("/-/user/:user", handleNPMLogin(authService))
+	npm.GET("/-/whoami", middleware.AuthMiddleware(authService), handleNPMWhoami())
+
 	// Search - requires authentication
 	npm.GET("/-/v1/search", middleware.AuthMiddleware(authService), handleNPMSearch(registryService))
-}
 
-// computeArtifactSHA1 computes the SHA1 hash of an artifact's content
-func computeArtifactSHA1(ctx context.Context, registryService *registry.Service, artifact *types.Artifact) (string, error) {
-	// Download the artifact content
-	_, content, err := registryService.Download(ctx, artifact.Registry, artifact.Name, artifact.Version)
-	if err != nil {
-		return "", fmt.Errorf("failed to download artifact for SHA1 computation: %w", err)
-	}
-	defer content.Close()
-
-	// Read all content and compute SHA1
-	contentBytes, err := io.ReadAll(content)
-	if err != nil {
-		return "", fmt.Errorf("failed to read artifact content: %w", err)
-	}
-
-	return utils.ComputeSHA1(contentBytes), nil
+	// Dist-tag management, as used by npm dist-tag (requires authentication)
+	npm.GET("/-/package/:name/dist-tags", middleware.AuthMiddleware(authService), handleNPMDistTags(registryService))
+	npm.GET("/-/package/@:scope/:name/dist-tags", middleware.AuthMiddleware(authService), handleNPMDistTags(registryService))
+	npm.PUT("/-/package/:name/dist-tags/:tag", middleware.AuthMiddleware(authService), handleNPMSetDistTag(registryService))
+	npm.PUT("/-/package/@:scope/:name/dist-tags/:tag", middleware.AuthMiddleware(authService), handleNPMSetDistTag(registryService))
+	npm.DELETE("/-/package/:name/dist-tags/:tag", middleware.AuthMiddleware(authService), handleNPMDeleteDistTag(registryService))
+	npm.DELETE("/-/package/@:scope/:name/dist-tags/:tag", middleware.AuthMiddleware(authService), handleNPMDeleteDistTag(registryService))
+
+	// Visibility and collaborator access, as used by npm access (requires authentication)
+	npm.GET("/-/package/:name/visibility", middleware.AuthMiddleware(authService), handleNPMVisibility(registryService))
+	npm.GET("/-/package/@:scope/:name/visibility", middleware.AuthMiddleware(authService), handleNPMVisibility(registryService))
+	npm.POST("/-/package/:name/access", middleware.AuthMiddleware(authService), handleNPMSetAccess(registryService))
+	npm.POST("/-/package/@:scope/:name/access", middleware.AuthMiddleware(authService), handleNPMSetAccess(registryService))
+	npm.GET("/-/package/:name/collaborators", middleware.AuthMiddleware(authService), handleNPMCollaborators(registryService))
+	npm.GET("/-/package/@:scope/:name/collaborators", middleware.AuthMiddleware(authService), handleNPMCollaborators(registryService))
+	npm.PUT("/-/team/:scope/:team/package", middleware.AuthMiddleware(authService), handleNPMGrantAccess(registryService))
+	npm.DELETE("/-/team/:scope/:team/package", middleware.AuthMiddleware(authService), handleNPMRevokeAccess(registryService))
+
+	// Advisories of installed versions, as used by npm audit (requires authentication)
+	advisoryService := advisories.NewService(registryService.DB.DB)
+	npm.POST("/-/npm/v1/security/advisories/bulk", middleware.AuthMiddleware(authService), handleNPMBulkAdvisories(advisoryService))
 }
 
 // generateTarballURL creates the correct URL for package tarballs
@@ -77,14 +90,14 @@ func generateTarballURL(c *gin.Context, packageName, version string) string {
 		if len(parts) == 2 {
 			scope := strings.TrimPrefix(parts[0], "@")
 			name := parts[1]
-			return fmt.Sprintf("http://%s/api/v1/npm/@%s/%s/-/%s-%s.tgz",
-				c.Request.Host, scope, name, name, version)
+			return fmt.Sprintf("%s/api/v1/npm/@%s/%s/-/%s-%s.tgz",
+				middleware.BaseURL(c), scope, name, name, version)
 		}
 	}
 
 	// Handle regular packages
-	return fmt.Sprintf("http://%s/api/v1/npm/%s/-/%s-%s.tgz",
-		c.Request.Host, packageName, packageName, version)
+	return fmt.Sprintf("%s/api/v1/npm/%s/-/%s-%s.tgz",
+		middleware.BaseURL(c), packageName, packageName, version)
 }
 
 // processTimes creates a standardized time map for NPM packages
@@ -130,67 +143,22 @@ func processTimes(artifacts []*types.Artifact) map[string]string {
 	return times
 }
 
-// processDistTags builds the dist-tags object based on artifact metadata and semver rules
-func processDistTags(artifacts []*types.Artifact, versionList []string) map[string]string {
-	distTags := make(map[string]string)
-	latestVersionIsTagged := false
-
-	// First pass: extract explicitly defined tags from artifact metadata
-	for _, artifact := range artifacts {
-		if artifact.Metadata != nil {
-			if dtags, ok := artifact.Metadata["dist-tags"].(map[string]interface{}); ok {
-				for tag, ver := range dtags {
-					if verStr, ok := ver.(string); ok {
-						distTags[tag] = verStr
-						if tag == "latest" {
-							latestVersionIsTagged = true
-						}
-					}
-				}
-			}
-		}
+// buildVersionObject creates a standardized version object for NPM package
+// responses. The integrity is left out when empty, leaving clients to verify
+// the shasum.
+func buildVersionObject(c *gin.Context, artifact *types.Artifact, shasum, integrity string) gin.H {
+	dist := gin.H{
+		"shasum":  shasum,
+		"tarball": generateTarballURL(c, artifact.Name, artifact.Version),
 	}
-
-	// Second pass: if no latest tag was set, determine it based on semver rules
-	if !latestVersionIsTagged && len(versionList) > 0 {
-		// Filter out prerelease versions for latest tag
-		stableVersions := make([]string, 0, len(versionList))
-		for _, v := range versionList {
-			if !utils.IsPrerelease(v) {
-				stableVersions = append(stableVersions, v)
-			}
-		}
-
-		latestVersion := ""
-		if len(stableVersions) > 0 {
-			// Use the latest stable version
-			latestVersion = utils.GetLatestVersion(stableVersions)
-		} else if len(versionList) > 0 {
-			// If no stable versions, use the latest prerelease
-			latestVersion = utils.GetLatestVersion(versionList)
-		}
-
-		if latestVersion != "" {
-			distTags["latest"] = latestVersion
-		}
-	} else if len(distTags) == 0 && len(versionList) > 0 {
-		// Fallback if no tags at all
-		distTags["latest"] = utils.GetLatestVersion(versionList)
+	if integrity != "" {
+		dist["integrity"] = integrity
 	}
-
-	return distTags
-}
-
-// buildVersionObject creates a standardized version object for NPM package responses
-func buildVersionObject(c *gin.Context, artifact *types.Artifact, shasum string) gin.H {
 	versionObj := gin.H{
 		"name":    artifact.Name,
 		"version": artifact.Version,
 		"_id":     artifact.Name + "@" + artifact.Version,
-		"dist": gin.H{
-			"shasum":  shasum,
-			"tarball": generateTarballURL(c, artifact.Name, artifact.Version),
-		},
+		"dist":    dist,
 	}
 
 	// Add fields from metadata if available
@@ -222,7 +190,7 @@ func addFieldIfExists(target gin.H, source map[string]interface{}, sourceKey, ta
 // GetNPMPackageInfo godoc
 //
 //	@Summary		Get npm package information
-//	@Description	Retrieve package metadata including all versions, dist-tags, and timing information
+//	@Description	Retrieve package metadata including all versions, dist-tags, and timing information. Packages missing locally are fetched from the npm upstream when one is configured.
 //	@Tags			npm
 //	@Produce		json
 //	@Param			name	path		string	true	"Package name"
@@ -240,66 +208,7 @@ func handleNPMPackageInfo(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		ctx := context.WithValue(c.Request.Context(), "registry", "npm")
-
-		filter := &types.ArtifactFilter{
-			Name:     packageName,
-			Registry: "npm",
-		}
-
-		artifacts, _, err := registryService.List(ctx, filter)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get package info"})
-			return
-		}
-
-		if len(artifacts) == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
-			return
-		}
-
-		// Process artifacts
-		versions := make(map[string]interface{})
-		versionList := make([]string, 0, len(artifacts))
-
-		// Get list of all versions
-		for _, artifact := range artifacts {
-			versionList = append(versionList, artifact.Version)
-		}
-
-		// Sort versions for consistent ordering
-		utils.SortSemver(versionList)
-
-		// Process time information for all artifacts
-		times := processTimes(artifacts)
-
-		// Process artifacts and build version objects
-		for _, artifact := range artifacts {
-			// Compute SHA1 hash for npm compatibility
-			shasum, err := computeArtifactSHA1(ctx, registryService, artifact)
-			if err != nil {
-				log.Error().Err(err).
-					Str("package", artifact.Name).
-					Str("version", artifact.Version).
-					Msg("failed to compute SHA1 hash, falling back to SHA256")
-				shasum = artifact.SHA256 // fallback to SHA256 if SHA1 computation fails
-			}
-
-			// Build standardized version object
-			versionObj := buildVersionObject(c, artifact, shasum)
-			versions[artifact.Version] = versionObj
-		}
-
-		// Process distribution tags
-		distTags := processDistTags(artifacts, versionList)
-
-		c.JSON(http.StatusOK, gin.H{
-			"name":      packageName,
-			"versions":  versions,
-			"dist-tags": distTags,
-			"time":      times,
-			"modified":  time.Now().Format(time.RFC3339),
-		})
+		serveNPMPackageInfo(c, registryService, packageName)
 	}
 }
 
@@ -317,22 +226,25 @@ func handleNPMPackageVersion(registryService *registry.Service) gin.HandlerFunc
 
 		artifact, _, err := registryService.Download(ctx, "npm", packageName, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "package version not found"})
 			return
 		}
 
-		// Compute SHA1 hash for npm compatibility
-		shasum, err := computeArtifactSHA1(ctx, registryService, artifact)
+		// SHA1 and SSRI checksums for npm compatibility, computed once per artifact
+		shasum, integrity, err := registryService.ArtifactNPMChecksums(ctx, artifact)
 		if err != nil {
-			log.Error().Err(err).
+			middleware.Logger(c).Error().Err(err).
 				Str("package", artifact.Name).
 				Str("version", artifact.Version).
-				Msg("failed to compute SHA1 hash, falling back to SHA256")
+				Msg("failed to compute npm checksums, falling back to SHA256")
 			shasum = artifact.SHA256 // fallback to SHA256 if SHA1 computation fails
 		}
 
 		// Build version response using our helper function
-		versionObj := buildVersionObject(c, artifact, shasum)
+		versionObj := buildVersionObject(c, artifact, shasum, integrity)
 
 		// Add time information
 		versionObj["time"] = artifact.CreatedAt.Format(time.RFC3339)
@@ -343,71 +255,114 @@ func handleNPMPackageVersion(registryService *registry.Service) gin.HandlerFunc
 
 func handleNPMScopedPackageInfo(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		scope := c.Param("scope")
-		name := c.Param("name")
-		packageName := fmt.Sprintf("@%s/%s", scope, name)
+		serveNPMPackageInfo(c, registryService, fmt.Sprintf("@%s/%s", c.Param("scope"), c.Param("name")))
+	}
+}
 
-		ctx := context.WithValue(c.Request.Context(), "registry", "npm")
+// serveNPMPackageInfo answers a package document request. The document
+// carries an entity tag derived from everything it is built from, so clients
+// revalidating an unchanged package get 304 Not Modified before the tarball
+// checksums are computed.
+func serveNPMPackageInfo(c *gin.Context, registryService *registry.Service, packageName string) {
+	ctx := context.WithValue(c.Request.Context(), "registry", "npm")
+
+	filter := &types.ArtifactFilter{
+		Name:      packageName,
+		Registry:  "npm",
+		ExactName: true,
+	}
 
-		filter := &types.ArtifactFilter{
-			Name:     packageName,
-			Registry: "npm",
-		}
+	artifacts, err := registryService.ListAll(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get package info"})
+		return
+	}
 
-		artifacts, _, err := registryService.List(ctx, filter)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get package info"})
-			return
-		}
+	if serveNPMUpstreamPackage(c, registryService, packageName) {
+		return
+	}
 
-		if len(artifacts) == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
-			return
-		}
+	if len(artifacts) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+		return
+	}
 
-		// Process artifacts
-		versions := make(map[string]interface{})
-		versionList := make([]string, 0, len(artifacts))
+	// Process distribution tags
+	distTags, err := registryService.GetDistTags(ctx, "npm", packageName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get package info"})
+		return
+	}
 
-		// Get list of all versions
-		for _, artifact := range artifacts {
-			versionList = append(versionList, artifact.Version)
-		}
+	etag := npmPackageETag(c, artifacts, distTags)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
 
-		// Sort versions for consistent ordering
-		utils.SortSemver(versionList)
+	// Process time information for all artifacts
+	times := processTimes(artifacts)
 
-		// Process time information for all artifacts
-		times := processTimes(artifacts)
+	// Process artifacts and build version objects
+	versions := make(map[string]interface{})
+	for _, artifact := range artifacts {
+		// SHA1 and SSRI checksums for npm compatibility, computed once per artifact
+		shasum, integrity, err := registryService.ArtifactNPMChecksums(ctx, artifact)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).
+				Str("package", artifact.Name).
+				Str("version", artifact.Version).
+				Msg("failed to compute npm checksums, falling back to SHA256")
+			shasum = artifact.SHA256 // fallback to SHA256 if SHA1 computation fails
+		}
 
-		// Process artifacts and build version objects
-		for _, artifact := range artifacts {
-			// Compute SHA1 hash for npm compatibility
-			shasum, err := computeArtifactSHA1(ctx, registryService, artifact)
-			if err != nil {
-				log.Error().Err(err).
-					Str("package", artifact.Name).
-					Str("version", artifact.Version).
-					Msg("failed to compute SHA1 hash, falling back to SHA256")
-				shasum = artifact.SHA256 // fallback to SHA256 if SHA1 computation fails
-			}
+		// Build standardized version object
+		versionObj := buildVersionObject(c, artifact, shasum, integrity)
+		versions[artifact.Version] = versionObj
+	}
 
-			// Build standardized version object
-			versionObj := buildVersionObject(c, artifact, shasum)
-			versions[artifact.Version] = versionObj
-		}
+	c.JSON(http.StatusOK, gin.H{
+		"name":      artifacts[0].Name,
+		"versions":  versions,
+		"dist-tags": distTags,
+		"time":      times,
+		"modified":  times["modified"],
+	})
+}
 
-		// Process distribution tags
-		distTags := processDistTags(artifacts, versionList)
+// npmPackageETag derives the entity tag of a package document from what it is
+// built from: the base URL its tarball URLs point at, each version's content
+// and metadata, which change its updated time, and the dist-tags
+func npmPackageETag(c *gin.Context, artifacts []*types.Artifact, distTags map[string]string) string {
+	sorted := slices.Clone(artifacts)
+	slices.SortFunc(sorted, func(a, b *types.Artifact) int {
+		return strings.Compare(a.Version, b.Version)
+	})
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "%s\n", middleware.BaseURL(c))
+	for _, artifact := range sorted {
+		metadata, _ := json.Marshal(artifact.Metadata)
+		fmt.Fprintf(hasher, "%s %s %s %d %s\n", artifact.Name, artifact.Version, artifact.SHA256, artifact.UpdatedAt.UnixNano(), metadata)
+	}
+	for _, tag := range slices.Sorted(maps.Keys(distTags)) {
+		fmt.Fprintf(hasher, "%s=%s\n", tag, distTags[tag])
+	}
+	return fmt.Sprintf(`"%x"`, hasher.Sum(nil))
+}
 
-		c.JSON(http.StatusOK, gin.H{
-			"name":      packageName,
-			"versions":  versions,
-			"dist-tags": distTags,
-			"time":      times,
-			"modified":  time.Now().Format(time.RFC3339),
-		})
+// etagMatches reports whether an If-None-Match header matches an entity tag,
+// comparing weakly as RFC 9110 requires for it
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
 	}
+	return false
 }
 
 func handleNPMScopedPackageVersion(registryService *registry.Service) gin.HandlerFunc {
@@ -421,22 +376,25 @@ func handleNPMScopedPackageVersion(registryService *registry.Service) gin.Handle
 
 		artifact, _, err := registryService.Download(ctx, "npm", packageName, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "package version not found"})
 			return
 		}
 
-		// Compute SHA1 hash for npm compatibility
-		shasum, err := computeArtifactSHA1(ctx, registryService, artifact)
+		// SHA1 and SSRI checksums for npm compatibility, computed once per artifact
+		shasum, integrity, err := registryService.ArtifactNPMChecksums(ctx, artifact)
 		if err != nil {
-			log.Error().Err(err).
+			middleware.Logger(c).Error().Err(err).
 				Str("package", artifact.Name).
 				Str("version", artifact.Version).
-				Msg("failed to compute SHA1 hash, falling back to SHA256")
+				Msg("failed to compute npm checksums, falling back to SHA256")
 			shasum = artifact.SHA256 // fallback to SHA256 if SHA1 computation fails
 		}
 
 		// Build version response using our helper function
-		versionObj := buildVersionObject(c, artifact, shasum)
+		versionObj := buildVersionObject(c, artifact, shasum, integrity)
 
 		// Add time information
 		versionObj["time"] = artifact.CreatedAt.Format(time.RFC3339)
@@ -454,7 +412,7 @@ func handleNPMDownload(registryService *registry.Service) gin.HandlerFunc {
 		version := strings.TrimPrefix(filename, packageName+"-")
 		version = strings.TrimSuffix(version, ".tgz")
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("package", packageName).
 			Str("version", version).
 			Str("filename", filename).
@@ -462,9 +420,19 @@ func handleNPMDownload(registryService *registry.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "npm")
 
-		artifact, content, err := registryService.Download(ctx, "npm", packageName, version)
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "npm", packageName, version)
 		if err != nil {
-			log.Error().Err(err).
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
+			if errors.Is(err, registry.ErrArtifactNotFound) && serveNPMUpstreamTarball(c, registryService, packageName, filename, version) {
+				return
+			}
+			middleware.Logger(c).Error().Err(err).
 				Str("package", packageName).
 				Str("version", version).
 				Msg("failed to download npm package")
@@ -472,16 +440,8 @@ func handleNPMDownload(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		c.Header("Content-Type", "application/gzip")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-		if artifact.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
-		}
-
 		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream package content"})
 			return
 		}
@@ -501,22 +461,24 @@ func handleNPMScopedDownload(registryService *registry.Service) gin.HandlerFunc
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "npm")
 
-		artifact, content, err := registryService.Download(ctx, "npm", packageName, version)
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "npm", packageName, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
+			if errors.Is(err, registry.ErrArtifactNotFound) && serveNPMUpstreamTarball(c, registryService, packageName, filename, version) {
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
 			return
 		}
 
-		c.Header("Content-Type", "application/gzip")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-		if artifact.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
-		}
-
 		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream package content"})
 			return
 		}
@@ -526,12 +488,13 @@ func handleNPMScopedDownload(registryService *registry.Service) gin.HandlerFunc
 // PublishNPMPackage godoc
 //
 //	@Summary		Publish npm package
-//	@Description	Upload a new npm package or new version of an existing package
+//	@Description	Upload a new npm package or new version of an existing package. A package document without attachments, as sent by npm deprecate, sets or clears the deprecation messages of its versions instead.
 //	@Tags			npm
 //	@Accept			json
 //	@Produce		json
 //	@Param			name	path		string	true	"Package name"
 //	@Param			package	body		object	true	"npm package data with _attachments containing base64-encoded tarball"
+//	@Success		200		{object}	object{ok=boolean,id=string}	"Versions deprecated successfully"
 //	@Success		201		{object}	object{ok=boolean,id=string,rev=string}	"Package published successfully"
 //	@Failure		400		{object}	object{error=string}	"Invalid request body or package data"
 //	@Failure		401		{object}	object{error=string}	"Unauthorized"
@@ -548,15 +511,23 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 
 		var publishData map[string]interface{}
 		if err := c.ShouldBindJSON(&publishData); err != nil {
+			if requestTooLarge(c, err) {
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
 			return
 		}
 
 		packageName := c.Param("name")
+		if messages, ok := npmDeprecations(publishData); ok {
+			applyNPMDeprecations(c, registryService, packageName, messages, user.ID)
+			return
+		}
+
 		ctx := context.WithValue(c.Request.Context(), "registry", "npm")
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("package_name", packageName).
 			Str("user_id", user.ID.String()).
 			Msg("Processing NPM publish request")
@@ -564,24 +535,24 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 		// Extract package.json and tarball from publish data
 		attachments, ok := publishData["_attachments"].(map[string]interface{})
 		if !ok {
-			log.Error().Msg("Missing _attachments in publish data")
+			middleware.Logger(c).Error().Msg("Missing _attachments in publish data")
 			c.JSON(http.StatusBadRequest, gin.H{"error": "missing package attachments"})
 			return
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Int("attachment_count", len(attachments)).
 			Msg("Found attachments in publish data")
 
 		// Process each attachment (tarball)
 		for filename, attachment := range attachments {
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("filename", filename).
 				Msg("Processing attachment")
 
 			attachmentData, ok := attachment.(map[string]interface{})
 			if !ok {
-				log.Warn().
+				middleware.Logger(c).Warn().
 					Str("filename", filename).
 					Msg("Attachment data is not a map, skipping")
 				continue
@@ -589,13 +560,13 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 
 			data, ok := attachmentData["data"].(string)
 			if !ok {
-				log.Warn().
+				middleware.Logger(c).Warn().
 					Str("filename", filename).
 					Msg("Attachment data field is not a string, skipping")
 				continue
 			}
 
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("filename", filename).
 				Int("base64_length", len(data)).
 				Msg("Found base64 data in attachment")
@@ -603,7 +574,7 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 			// Decode base64 tarball data
 			tarballData, err := base64.StdEncoding.DecodeString(data)
 			if err != nil {
-				log.Error().
+				middleware.Logger(c).Error().
 					Err(err).
 					Str("filename", filename).
 					Msg("Failed to decode base64 data")
@@ -611,15 +582,19 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 				return
 			}
 
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("filename", filename).
 				Int("tarball_size", len(tarballData)).
 				Msg("Successfully decoded tarball data")
 
-			// Extract package.json from tarball
-			packageJSON, version, err := extractPackageJSONFromTarball(tarballData)
+			// Extract the root package.json from the tarball, as the registry
+			// does when storing it
+			manifest, err := npm.ExtractPackageManifest(tarballData)
+			if err == nil && manifest.Version == "" {
+				err = fmt.Errorf("package.json missing version field")
+			}
 			if err != nil {
-				log.Error().
+				middleware.Logger(c).Error().
 					Err(err).
 					Str("filename", filename).
 					Msg("Failed to extract package.json from tarball")
@@ -627,17 +602,18 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 				return
 			}
 
-			log.Info().
+			version := manifest.Version
+			middleware.Logger(c).Info().
 				Str("filename", filename).
-				Str("extracted_name", packageJSON["name"].(string)).
+				Str("extracted_name", manifest.Name).
 				Str("extracted_version", version).
 				Msg("Successfully extracted package.json")
 
 			// Validate package name matches
-			if packageJSON["name"] != packageName {
-				log.Error().
+			if manifest.Name != packageName {
+				middleware.Logger(c).Error().
 					Str("expected_name", packageName).
-					Str("actual_name", packageJSON["name"].(string)).
+					Str("actual_name", manifest.Name).
 					Msg("Package name mismatch")
 				c.JSON(http.StatusBadRequest, gin.H{"error": "package name mismatch"})
 				return
@@ -649,7 +625,7 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 				for tag, ver := range publishDataDistTags {
 					if verStr, ok := ver.(string); ok {
 						distTags[tag] = verStr
-						log.Info().
+						middleware.Logger(c).Info().
 							Str("package", packageName).
 							Str("tag", tag).
 							Str("version", verStr).
@@ -665,7 +641,7 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 				if !utils.IsPrerelease(version) {
 					// Check if there's a current latest version in the registry
 					existingVersions := make([]string, 0)
-					existingArtifacts, _, _ := registryService.List(ctx, &types.ArtifactFilter{
+					existingArtifacts, _ := registryService.ListAll(ctx, &types.ArtifactFilter{
 						Registry: "npm",
 						Name:     packageName,
 					})
@@ -698,7 +674,7 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 						compareResult := utils.CompareVersions(version, latestVersion)
 						if compareResult > 0 { // New version is greater
 							distTags["latest"] = version
-							log.Info().
+							middleware.Logger(c).Info().
 								Str("package", packageName).
 								Str("version", version).
 								Str("previous_latest", latestVersion).
@@ -707,7 +683,7 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 					} else {
 						// No existing latest tag, set this as latest
 						distTags["latest"] = version
-						log.Info().
+						middleware.Logger(c).Info().
 							Str("package", packageName).
 							Str("version", version).
 							Msg("Setting as latest (first stable version)")
@@ -718,7 +694,7 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 					prereleaseId := getPrereleaseIdentifier(version)
 					if prereleaseId != "" {
 						distTags[prereleaseId] = version
-						log.Info().
+						middleware.Logger(c).Info().
 							Str("package", packageName).
 							Str("version", version).
 							Str("tag", prereleaseId).
@@ -727,49 +703,33 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 				}
 			}
 
-			// Store dist-tags in metadata
-			if packageJSON["metadata"] == nil {
-				packageJSON["metadata"] = make(map[string]interface{})
-			}
-
-			// Add distTags to metadata
-			if len(distTags) > 0 {
-				packageJSON["dist-tags"] = distTags
-			}
-
-			// Store time information in metadata
-			now := time.Now().Format(time.RFC3339)
-			timeInfo := map[string]string{
-				"created":  now,
-				"modified": now,
-				version:    now,
-			}
-			packageJSON["time"] = timeInfo
-
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("package_name", packageName).
 				Str("version", version).
 				Msg("Starting artifact upload to registry service")
 
 			// Upload the package with enhanced metadata
 			artifact, err := registryService.Upload(ctx, "npm", packageName, version, bytes.NewReader(tarballData), user.ID)
-			if err != nil {
-				log.Error().
+			status, ok := uploadStatus(c, err, http.StatusCreated)
+			if !ok {
+				middleware.Logger(c).Error().
 					Err(err).
 					Str("package_name", packageName).
 					Str("version", version).
 					Msg("Failed to upload package to registry service")
-				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to upload package: %v", err)})
 				return
 			}
 
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("package_name", packageName).
 				Str("version", version).
 				Str("artifact_id", artifact.ID.String()).
 				Msg("Successfully uploaded package to registry service")
 
-			c.JSON(http.StatusCreated, gin.H{
+			// Keep the tags the version was published with, such as beta
+			registryService.TagPublishedVersion(ctx, "npm", packageName, version, distTags)
+
+			c.JSON(status, gin.H{
 				"ok":  true,
 				"id":  packageName,
 				"rev": fmt.Sprintf("1-%s", version), // Simplified revision
@@ -780,11 +740,61 @@ func handleNPMPublish(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		log.Error().Msg("No valid package data found in attachments")
+		middleware.Logger(c).Error().Msg("No valid package data found in attachments")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no valid package data found"})
 	}
 }
 
+// npmDeprecations returns the deprecation messages of the versions in a
+// package document sent by npm deprecate, which puts the document it read back
+// without attachments. Versions without a deprecated field are left as they
+// are; an empty message undeprecates a version.
+func npmDeprecations(publishData map[string]interface{}) (map[string]string, bool) {
+	if attachments, ok := publishData["_attachments"].(map[string]interface{}); ok && len(attachments) > 0 {
+		return nil, false
+	}
+	versions, ok := publishData["versions"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	messages := make(map[string]string)
+	for version, data := range versions {
+		versionData, ok := data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if message, ok := versionData["deprecated"].(string); ok {
+			messages[version] = message
+		}
+	}
+	return messages, true
+}
+
+// applyNPMDeprecations sets the deprecation messages of a package's versions
+// and responds to npm deprecate
+func applyNPMDeprecations(c *gin.Context, registryService *registry.Service, packageName string, messages map[string]string, userID uuid.UUID) {
+	changed, err := registryService.Deprecate(c.Request.Context(), "npm", packageName, messages, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, registry.ErrDeprecationForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, registry.ErrArtifactNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to deprecate package: %v", err)})
+		}
+		return
+	}
+
+	middleware.Logger(c).Info().
+		Str("package_name", packageName).
+		Int("versions", changed).
+		Str("user_id", userID.String()).
+		Msg("Processed NPM deprecate request")
+	c.JSON(http.StatusOK, gin.H{"ok": true, "id": packageName})
+}
+
 func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := middleware.GetUserFromContext(c)
@@ -799,14 +809,21 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 
 		var publishData map[string]interface{}
 		if err := c.ShouldBindJSON(&publishData); err != nil {
+			if requestTooLarge(c, err) {
+				return
+			}
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON"})
 			return
 		}
+		if messages, ok := npmDeprecations(publishData); ok {
+			applyNPMDeprecations(c, registryService, packageName, messages, user.ID)
+			return
+		}
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "npm")
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("package_name", packageName).
 			Str("user_id", user.ID.String()).
 			Msg("Processing NPM scoped package publish request")
@@ -814,24 +831,24 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 		// Extract package.json and tarball from publish data
 		attachments, ok := publishData["_attachments"].(map[string]interface{})
 		if !ok {
-			log.Error().Msg("Missing _attachments in publish data")
+			middleware.Logger(c).Error().Msg("Missing _attachments in publish data")
 			c.JSON(http.StatusBadRequest, gin.H{"error": "missing package attachments"})
 			return
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Int("attachment_count", len(attachments)).
 			Msg("Found attachments in publish data")
 
 		// Process each attachment (tarball)
 		for filename, attachment := range attachments {
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("filename", filename).
 				Msg("Processing attachment")
 
 			attachmentData, ok := attachment.(map[string]interface{})
 			if !ok {
-				log.Warn().
+				middleware.Logger(c).Warn().
 					Str("filename", filename).
 					Msg("Attachment data is not a map, skipping")
 				continue
@@ -839,13 +856,13 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 
 			data, ok := attachmentData["data"].(string)
 			if !ok {
-				log.Warn().
+				middleware.Logger(c).Warn().
 					Str("filename", filename).
 					Msg("Attachment data field is not a string, skipping")
 				continue
 			}
 
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("filename", filename).
 				Int("base64_length", len(data)).
 				Msg("Found base64 data in attachment")
@@ -853,7 +870,7 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 			// Decode base64 tarball data
 			tarballData, err := base64.StdEncoding.DecodeString(data)
 			if err != nil {
-				log.Error().
+				middleware.Logger(c).Error().
 					Err(err).
 					Str("filename", filename).
 					Msg("Failed to decode base64 data")
@@ -861,15 +878,19 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 				return
 			}
 
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("filename", filename).
 				Int("tarball_size", len(tarballData)).
 				Msg("Successfully decoded tarball data")
 
-			// Extract package.json from tarball
-			packageJSON, version, err := extractPackageJSONFromTarball(tarballData)
+			// Extract the root package.json from the tarball, as the registry
+			// does when storing it
+			manifest, err := npm.ExtractPackageManifest(tarballData)
+			if err == nil && manifest.Version == "" {
+				err = fmt.Errorf("package.json missing version field")
+			}
 			if err != nil {
-				log.Error().
+				middleware.Logger(c).Error().
 					Err(err).
 					Str("filename", filename).
 					Msg("Failed to extract package.json from tarball")
@@ -877,17 +898,18 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 				return
 			}
 
-			log.Info().
+			version := manifest.Version
+			middleware.Logger(c).Info().
 				Str("filename", filename).
-				Str("extracted_name", packageJSON["name"].(string)).
+				Str("extracted_name", manifest.Name).
 				Str("extracted_version", version).
 				Msg("Successfully extracted package.json")
 
 			// Validate package name matches
-			if packageJSON["name"] != packageName {
-				log.Error().
+			if manifest.Name != packageName {
+				middleware.Logger(c).Error().
 					Str("expected_name", packageName).
-					Str("actual_name", packageJSON["name"].(string)).
+					Str("actual_name", manifest.Name).
 					Msg("Package name mismatch")
 				c.JSON(http.StatusBadRequest, gin.H{"error": "package name mismatch"})
 				return
@@ -899,7 +921,7 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 				for tag, ver := range publishDataDistTags {
 					if verStr, ok := ver.(string); ok {
 						distTags[tag] = verStr
-						log.Info().
+						middleware.Logger(c).Info().
 							Str("package", packageName).
 							Str("tag", tag).
 							Str("version", verStr).
@@ -915,7 +937,7 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 				if !utils.IsPrerelease(version) {
 					// Check if there's a current latest version in the registry
 					existingVersions := make([]string, 0)
-					existingArtifacts, _, _ := registryService.List(ctx, &types.ArtifactFilter{
+					existingArtifacts, _ := registryService.ListAll(ctx, &types.ArtifactFilter{
 						Registry: "npm",
 						Name:     packageName,
 					})
@@ -948,7 +970,7 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 						compareResult := utils.CompareVersions(version, latestVersion)
 						if compareResult > 0 { // New version is greater
 							distTags["latest"] = version
-							log.Info().
+							middleware.Logger(c).Info().
 								Str("package", packageName).
 								Str("version", version).
 								Str("previous_latest", latestVersion).
@@ -957,7 +979,7 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 					} else {
 						// No existing latest tag, set this as latest
 						distTags["latest"] = version
-						log.Info().
+						middleware.Logger(c).Info().
 							Str("package", packageName).
 							Str("version", version).
 							Msg("Setting as latest (first stable version)")
@@ -968,7 +990,7 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 					prereleaseId := getPrereleaseIdentifier(version)
 					if prereleaseId != "" {
 						distTags[prereleaseId] = version
-						log.Info().
+						middleware.Logger(c).Info().
 							Str("package", packageName).
 							Str("version", version).
 							Str("tag", prereleaseId).
@@ -977,49 +999,33 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 				}
 			}
 
-			// Store dist-tags in metadata
-			if packageJSON["metadata"] == nil {
-				packageJSON["metadata"] = make(map[string]interface{})
-			}
-
-			// Add distTags to metadata
-			if len(distTags) > 0 {
-				packageJSON["dist-tags"] = distTags
-			}
-
-			// Store time information in metadata
-			now := time.Now().Format(time.RFC3339)
-			timeInfo := map[string]string{
-				"created":  now,
-				"modified": now,
-				version:    now,
-			}
-			packageJSON["time"] = timeInfo
-
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("package_name", packageName).
 				Str("version", version).
 				Msg("Starting artifact upload to registry service")
 
 			// Upload the package with enhanced metadata
 			artifact, err := registryService.Upload(ctx, "npm", packageName, version, bytes.NewReader(tarballData), user.ID)
-			if err != nil {
-				log.Error().
+			status, ok := uploadStatus(c, err, http.StatusCreated)
+			if !ok {
+				middleware.Logger(c).Error().
 					Err(err).
 					Str("package_name", packageName).
 					Str("version", version).
 					Msg("Failed to upload package to registry service")
-				c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to upload package: %v", err)})
 				return
 			}
 
-			log.Info().
+			middleware.Logger(c).Info().
 				Str("package_name", packageName).
 				Str("version", version).
 				Str("artifact_id", artifact.ID.String()).
 				Msg("Successfully uploaded package to registry service")
 
-			c.JSON(http.StatusCreated, gin.H{
+			// Keep the tags the version was published with, such as beta
+			registryService.TagPublishedVersion(ctx, "npm", packageName, version, distTags)
+
+			c.JSON(status, gin.H{
 				"ok":  true,
 				"id":  packageName,
 				"rev": fmt.Sprintf("1-%s", version), // Simplified revision
@@ -1030,7 +1036,7 @@ func handleNPMScopedPublish(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		log.Error().Msg("No valid package data found in attachments")
+		middleware.Logger(c).Error().Msg("No valid package data found in attachments")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "no valid package data found"})
 	}
 }
@@ -1095,23 +1101,38 @@ func handleNPMScopedDelete(registryService *registry.Service) gin.HandlerFunc {
 	}
 }
 
+// maxNPMSearchSize caps the page size a search client may request
+const maxNPMSearchSize = 250
+
 func handleNPMSearch(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		text := c.Query("text")
-		_ = c.DefaultQuery("size", "20") // TODO: implement pagination
-		_ = c.DefaultQuery("from", "0")  // TODO: implement pagination
+
+		size, err := strconv.Atoi(c.DefaultQuery("size", "20"))
+		if err != nil || size < 1 {
+			size = 20
+		}
+		if size > maxNPMSearchSize {
+			size = maxNPMSearchSize
+		}
+		from, err := strconv.Atoi(c.DefaultQuery("from", "0"))
+		if err != nil || from < 0 {
+			from = 0
+		}
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "npm")
 
 		filter := &types.ArtifactFilter{
 			Registry: "npm",
+			Limit:    size,
+			Offset:   from,
 		}
 
 		if text != "" {
 			filter.Name = text // Simple name-based search
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, total, err := registryService.List(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
 			return
@@ -1146,61 +1167,12 @@ func handleNPMSearch(registryService *registry.Service) gin.HandlerFunc {
 
 		c.JSON(http.StatusOK, gin.H{
 			"objects": objects,
-			"total":   len(objects),
+			"total":   total,
 			"time":    "0ms",
 		})
 	}
 }
 
-// extractPackageJSONFromTarball extracts and parses package.json from an npm tarball
-func extractPackageJSONFromTarball(tarballData []byte) (map[string]interface{}, string, error) {
-	// Create a gzip reader
-	gzipReader, err := gzip.NewReader(bytes.NewReader(tarballData))
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to create gzip reader: %w", err)
-	}
-	defer gzipReader.Close()
-
-	// Create a tar reader
-	tarReader := tar.NewReader(gzipReader)
-
-	// Look for package.json in the tarball
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, "", fmt.Errorf("failed to read tar header: %w", err)
-		}
-
-		// Look for package.json file (could be in package/ directory)
-		if strings.HasSuffix(header.Name, "package.json") {
-			// Read the package.json content
-			packageJSONBytes, err := io.ReadAll(tarReader)
-			if err != nil {
-				return nil, "", fmt.Errorf("failed to read package.json: %w", err)
-			}
-
-			// Parse package.json
-			var packageJSON map[string]interface{}
-			if err := json.Unmarshal(packageJSONBytes, &packageJSON); err != nil {
-				return nil, "", fmt.Errorf("failed to parse package.json: %w", err)
-			}
-
-			// Extract version
-			version, ok := packageJSON["version"].(string)
-			if !ok {
-				return nil, "", fmt.Errorf("package.json missing version field")
-			}
-
-			return packageJSON, version, nil
-		}
-	}
-
-	return nil, "", fmt.Errorf("package.json not found in tarball")
-}
-
 // getPrereleaseIdentifier extracts the prerelease identifier from a semver version
 // For example:
 // - "1.0.0-beta.1" returns "beta"
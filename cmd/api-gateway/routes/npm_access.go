@@ -0,0 +1,235 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry"
+)
+
+// npmAccessRequest is the body of npm access set status
+type npmAccessRequest struct {
+	Access string `json:"access"` // public, or private ("restricted" in older npm)
+}
+
+// npmTeamPackageRequest is the body of npm access grant and revoke
+type npmTeamPackageRequest struct {
+	Package     string `json:"package" binding:"required"`
+	Permissions string `json:"permissions"` // read-only or read-write, only when granting
+}
+
+// GetNPMVisibility godoc
+//
+//	@Summary		Get npm package visibility
+//	@Description	Report whether a package is public, as used by npm access get status. Only owners and maintainers of the package may ask
+//	@Tags			npm
+//	@Produce		json
+//	@Param			name	path		string					true	"Package name"
+//	@Success		200		{object}	object{public=bool}		"Package visibility"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		403		{object}	object{error=string}	"Not an owner or maintainer of the package"
+//	@Failure		404		{object}	object{error=string}	"Package not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to get visibility"
+//	@Security		BearerAuth
+//	@Router			/npm/-/package/{name}/visibility [get]
+func handleNPMVisibility(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		packageName := npmPackageParam(c)
+
+		public, err := registryService.GetPackageVisibility(c.Request.Context(), "npm", packageName, user.ID)
+		if err != nil {
+			respondNPMAccessError(c, packageName, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"public": public})
+	}
+}
+
+// SetNPMAccess godoc
+//
+//	@Summary		Set npm package visibility
+//	@Description	Make every version of a package public or restricted, as used by npm access set status (and npm access public|restricted in older npm). Only owners of the package may change it
+//	@Tags			npm
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string					true	"Package name"
+//	@Param			request	body		npmAccessRequest		true	"public, private or restricted"
+//	@Success		200		{object}	object{ok=bool}			"Visibility changed"
+//	@Failure		400		{object}	object{error=string}	"Invalid access"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		403		{object}	object{error=string}	"Not an owner of the package"
+//	@Failure		404		{object}	object{error=string}	"Package not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to set visibility"
+//	@Security		BearerAuth
+//	@Router			/npm/-/package/{name}/access [post]
+func handleNPMSetAccess(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		packageName := npmPackageParam(c)
+
+		var req npmAccessRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+
+		var public bool
+		switch req.Access {
+		case "public":
+			public = true
+		case "private", "restricted":
+			public = false
+		case "":
+			// Two-factor requirements are sent to the same endpoint
+			c.JSON(http.StatusBadRequest, gin.H{"error": "only package visibility can be changed"})
+			return
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "access must be public, private or restricted"})
+			return
+		}
+
+		if err := registryService.SetPackageVisibility(c.Request.Context(), "npm", packageName, public, user.ID); err != nil {
+			respondNPMAccessError(c, packageName, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// GetNPMCollaborators godoc
+//
+//	@Summary		List npm package collaborators
+//	@Description	List the users with access to a package and whether they can publish it, as used by npm access list collaborators. Owners and maintainers have read-write access, contributors read-only access. Only owners and maintainers of the package may ask
+//	@Tags			npm
+//	@Produce		json
+//	@Param			name	path		string					true	"Package name"
+//	@Success		200		{object}	map[string]string		"Username to read-only or read-write"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		403		{object}	object{error=string}	"Not an owner or maintainer of the package"
+//	@Failure		404		{object}	object{error=string}	"Package not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to list collaborators"
+//	@Security		BearerAuth
+//	@Router			/npm/-/package/{name}/collaborators [get]
+func handleNPMCollaborators(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		packageName := npmPackageParam(c)
+
+		collaborators, err := registryService.GetCollaborators(c.Request.Context(), "npm", packageName, user.ID)
+		if err != nil {
+			respondNPMAccessError(c, packageName, err)
+			return
+		}
+		c.JSON(http.StatusOK, collaborators)
+	}
+}
+
+// GrantNPMAccess godoc
+//
+//	@Summary		Grant npm package access
+//	@Description	Give a user read-only or read-write access to a package, as used by npm access grant <permissions> <scope:user> <package>. Access is granted to users rather than organization teams, so the team names the user and the scope is ignored. Only owners of the package may grant access
+//	@Tags			npm
+//	@Accept			json
+//	@Produce		json
+//	@Param			scope	path		string					true	"Scope, ignored"
+//	@Param			team	path		string					true	"Username"
+//	@Param			request	body		npmTeamPackageRequest	true	"Package and permissions"
+//	@Success		200		{object}	object{ok=bool}			"Access granted"
+//	@Failure		400		{object}	object{error=string}	"Invalid permissions"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		403		{object}	object{error=string}	"Not an owner of the package"
+//	@Failure		404		{object}	object{error=string}	"User not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to grant access"
+//	@Security		BearerAuth
+//	@Router			/npm/-/team/{scope}/{team}/package [put]
+func handleNPMGrantAccess(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req npmTeamPackageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "package required"})
+			return
+		}
+
+		if err := registryService.GrantPackageAccess(c.Request.Context(), "npm", req.Package, c.Param("team"), req.Permissions, user.ID); err != nil {
+			respondNPMAccessError(c, req.Package, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// RevokeNPMAccess godoc
+//
+//	@Summary		Revoke npm package access
+//	@Description	Remove a user's access to a package, as used by npm access revoke <scope:user> <package>. The team names the user and the scope is ignored. Only owners of the package may revoke access
+//	@Tags			npm
+//	@Accept			json
+//	@Produce		json
+//	@Param			scope	path		string					true	"Scope, ignored"
+//	@Param			team	path		string					true	"Username"
+//	@Param			request	body		npmTeamPackageRequest	true	"Package"
+//	@Success		200		{object}	object{ok=bool}			"Access revoked"
+//	@Failure		400		{object}	object{error=string}	"The user cannot be removed"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		403		{object}	object{error=string}	"Not an owner of the package"
+//	@Failure		404		{object}	object{error=string}	"User not found or has no access"
+//	@Failure		500		{object}	object{error=string}	"Failed to revoke access"
+//	@Security		BearerAuth
+//	@Router			/npm/-/team/{scope}/{team}/package [delete]
+func handleNPMRevokeAccess(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		var req npmTeamPackageRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "package required"})
+			return
+		}
+
+		if err := registryService.RevokePackageAccess(c.Request.Context(), "npm", req.Package, c.Param("team"), user.ID); err != nil {
+			respondNPMAccessError(c, req.Package, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// respondNPMAccessError responds to a failed access request
+func respondNPMAccessError(c *gin.Context, packageName string, err error) {
+	switch {
+	case errors.Is(err, registry.ErrVisibilityForbidden), errors.Is(err, registry.ErrOwnershipForbidden), errors.Is(err, registry.ErrAccessForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrInvalidAccessLevel), errors.Is(err, registry.ErrLastOwner), errors.Is(err, registry.ErrPrimaryOwner):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrPackageNotFound), errors.Is(err, registry.ErrCollaboratorNotFound), errors.Is(err, registry.ErrOwnerNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		middleware.Logger(c).Error().Err(err).Str("package", packageName).Msg("Failed to manage npm package access")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to manage package access"})
+	}
+}
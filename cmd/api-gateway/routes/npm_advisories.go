@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/advisories"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// maxNPMBulkAdvisoryRequest caps the decompressed size of a bulk advisory
+// request, which lists every package of a dependency tree
+const maxNPMBulkAdvisoryRequest = 10 << 20
+
+// npmAdvisory is an advisory in the shape npm audit reads from the bulk
+// advisory endpoint
+type npmAdvisory struct {
+	ID                 string   `json:"id"`
+	URL                string   `json:"url"`
+	Title              string   `json:"title"`
+	Severity           string   `json:"severity"`
+	VulnerableVersions string   `json:"vulnerable_versions"`
+	CWE                []string `json:"cwe"`
+	CVSS               npmCVSS  `json:"cvss"`
+}
+
+// npmCVSS is the CVSS score of an npm advisory
+type npmCVSS struct {
+	Score        float64 `json:"score"`
+	VectorString string  `json:"vectorString"`
+}
+
+// newNPMAdvisory converts a recorded advisory to npm's shape
+func newNPMAdvisory(advisory types.Advisory) npmAdvisory {
+	cwe := advisory.CWE
+	if cwe == nil {
+		cwe = []string{}
+	}
+	return npmAdvisory{
+		ID:                 advisory.ID.String(),
+		URL:                advisory.URL,
+		Title:              advisory.Title,
+		Severity:           advisory.Severity,
+		VulnerableVersions: advisory.VulnerableVersions,
+		CWE:                cwe,
+		CVSS:               npmCVSS{Score: advisory.CVSSScore, VectorString: advisory.CVSSVector},
+	}
+}
+
+// NPMBulkAdvisories godoc
+//
+//	@Summary		Get npm advisories in bulk
+//	@Description	Match the package versions of a dependency tree against the advisories recorded for npm packages, as used by npm audit. The body maps package names to the versions installed and may be gzip-encoded. Every package asked about is in the response, with no advisories if none match
+//	@Tags			npm
+//	@Accept			json
+//	@Produce		json
+//	@Param			packages	body		map[string][]string		true	"Package name to installed versions"
+//	@Success		200			{object}	map[string][]npmAdvisory	"Package name to matching advisories"
+//	@Failure		400			{object}	object{error=string}		"Invalid request body"
+//	@Failure		401			{object}	object{error=string}		"Unauthorized"
+//	@Failure		500			{object}	object{error=string}		"Failed to match advisories"
+//	@Security		BearerAuth
+//	@Router			/npm/-/npm/v1/security/advisories/bulk [post]
+func handleNPMBulkAdvisories(advisoryService *advisories.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body io.Reader = c.Request.Body
+		if strings.EqualFold(c.GetHeader("Content-Encoding"), "gzip") {
+			reader, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid gzip body"})
+				return
+			}
+			defer reader.Close()
+			body = reader
+		}
+
+		content, err := io.ReadAll(io.LimitReader(body, maxNPMBulkAdvisoryRequest+1))
+		if requestTooLarge(c, err) {
+			return
+		}
+		if err != nil || len(content) > maxNPMBulkAdvisoryRequest {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+
+		var versions map[string][]string
+		if err := json.Unmarshal(content, &versions); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "request body must map package names to versions"})
+			return
+		}
+
+		matches, err := advisoryService.Match(c.Request.Context(), "npm", versions)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Int("packages", len(versions)).Msg("Failed to match advisories")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to match advisories"})
+			return
+		}
+
+		response := make(map[string][]npmAdvisory, len(matches))
+		for name, matched := range matches {
+			response[name] = make([]npmAdvisory, 0, len(matched))
+			for _, advisory := range matched {
+				response[name] = append(response[name], newNPMAdvisory(advisory))
+			}
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,151 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry"
+)
+
+// npmPackageParam returns the package name of a request to a route with a
+// name parameter and, for scoped packages, a scope parameter
+func npmPackageParam(c *gin.Context) string {
+	if scope := c.Param("scope"); scope != "" {
+		return fmt.Sprintf("@%s/%s", scope, c.Param("name"))
+	}
+	return c.Param("name")
+}
+
+// GetNPMDistTags godoc
+//
+//	@Summary		List npm dist-tags
+//	@Description	List the dist-tags of a package, as used by npm dist-tag ls. latest is the newest stable version unless it was set explicitly
+//	@Tags			npm
+//	@Produce		json
+//	@Param			name	path		string				true	"Package name"
+//	@Success		200		{object}	map[string]string	"Tag to version"
+//	@Failure		404		{object}	object{error=string}	"Package not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to get dist-tags"
+//	@Security		BearerAuth
+//	@Router			/npm/-/package/{name}/dist-tags [get]
+func handleNPMDistTags(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		packageName := npmPackageParam(c)
+
+		tags, err := registryService.GetDistTags(c.Request.Context(), "npm", packageName)
+		if err != nil {
+			respondNPMDistTagError(c, packageName, err)
+			return
+		}
+		c.JSON(http.StatusOK, tags)
+	}
+}
+
+// SetNPMDistTag godoc
+//
+//	@Summary		Set an npm dist-tag
+//	@Description	Point a dist-tag of a package at one of its versions, as used by npm dist-tag add. Only users who can publish the package may change its tags
+//	@Tags			npm
+//	@Accept			json
+//	@Produce		json
+//	@Param			name	path		string				true	"Package name"
+//	@Param			tag		path		string				true	"Tag name"
+//	@Param			version	body		string				true	"Version the tag points at, as a JSON string"
+//	@Success		200		{object}	map[string]string	"Tag to version, after the change"
+//	@Failure		400		{object}	object{error=string}	"Invalid tag or version"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		403		{object}	object{error=string}	"Not allowed to change the package's tags"
+//	@Failure		404		{object}	object{error=string}	"Package or version not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to set dist-tag"
+//	@Security		BearerAuth
+//	@Router			/npm/-/package/{name}/dist-tags/{tag} [put]
+func handleNPMSetDistTag(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		packageName := npmPackageParam(c)
+
+		body, err := io.ReadAll(c.Request.Body)
+		if requestTooLarge(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		// npm sends the version as a JSON string; a bare version is accepted too
+		var version string
+		if err := json.Unmarshal(body, &version); err != nil {
+			version = strings.TrimSpace(string(body))
+		}
+		if version == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "version required"})
+			return
+		}
+
+		tags, err := registryService.SetDistTag(c.Request.Context(), "npm", packageName, c.Param("tag"), version, user.ID)
+		if err != nil {
+			respondNPMDistTagError(c, packageName, err)
+			return
+		}
+		c.JSON(http.StatusOK, tags)
+	}
+}
+
+// DeleteNPMDistTag godoc
+//
+//	@Summary		Remove an npm dist-tag
+//	@Description	Remove a dist-tag of a package, as used by npm dist-tag rm. latest cannot be removed. Only users who can publish the package may change its tags
+//	@Tags			npm
+//	@Produce		json
+//	@Param			name	path		string				true	"Package name"
+//	@Param			tag		path		string				true	"Tag name"
+//	@Success		200		{object}	map[string]string	"Tag to version, after the change"
+//	@Failure		400		{object}	object{error=string}	"Tag cannot be removed"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		403		{object}	object{error=string}	"Not allowed to change the package's tags"
+//	@Failure		404		{object}	object{error=string}	"Package or tag not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to remove dist-tag"
+//	@Security		BearerAuth
+//	@Router			/npm/-/package/{name}/dist-tags/{tag} [delete]
+func handleNPMDeleteDistTag(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		packageName := npmPackageParam(c)
+
+		tags, err := registryService.RemoveDistTag(c.Request.Context(), "npm", packageName, c.Param("tag"), user.ID)
+		if err != nil {
+			respondNPMDistTagError(c, packageName, err)
+			return
+		}
+		c.JSON(http.StatusOK, tags)
+	}
+}
+
+// respondNPMDistTagError responds to a failed dist-tag request
+func respondNPMDistTagError(c *gin.Context, packageName string, err error) {
+	switch {
+	case errors.Is(err, registry.ErrDistTagForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrInvalidDistTag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrArtifactNotFound), errors.Is(err, registry.ErrDistTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		middleware.Logger(c).Error().Err(err).Str("package", packageName).Msg("Failed to manage npm dist-tags")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to manage dist-tags"})
+	}
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// npmUserPrefix prefixes user names in the CouchDB-style document IDs npm
+// logs in with
+const npmUserPrefix = "org.couchdb.user:"
+
+// npmLoginKeyName names the API keys issued by npm login, so users can tell
+// them apart when listing and revoking their keys
+const npmLoginKeyName = "npm login"
+
+// npmLoginClient marks the API keys issued by npm login
+const npmLoginClient = "npm"
+
+// npmLoginKeyLifetime is how long a token issued by npm login is valid, so
+// tokens of machines that never log in again do not stay live
+const npmLoginKeyLifetime = 90 * 24 * time.Hour
+
+// NPMLogin godoc
+//
+//	@Summary		Log in with npm
+//	@Description	Authenticate a user with their password, as used by npm login --auth-type=legacy, and return a token for npm to store. The token is an API key scoped to the npm registry, revocable like any other, that expires after 90 days. A token from an earlier npm login of the same user, presented as the bearer token as npm does when already logged in, is revoked
+//	@Tags			npm
+//	@Accept			json
+//	@Produce		json
+//	@Param			user	path		string											true	"org.couchdb.user: followed by the user name"
+//	@Param			login	body		object{name=string,password=string}				true	"User name and password"
+//	@Success		201		{object}	object{ok=bool,id=string,token=string}			"Logged in"
+//	@Failure		400		{object}	object{error=string}							"Invalid request body or user name"
+//	@Failure		401		{object}	object{error=string}							"Invalid credentials"
+//	@Failure		500		{object}	object{error=string}							"Failed to issue token"
+//	@Router			/npm/-/user/{user} [put]
+func handleNPMLogin(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := strings.CutPrefix(c.Param("user"), npmUserPrefix)
+		if !ok || username == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user"})
+			return
+		}
+
+		var req struct {
+			Name     string `json:"name" binding:"required"`
+			Password string `json:"password" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			if requestTooLarge(c, err) {
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if req.Name != username {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "user name does not match the document ID"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		user, err := authService.Authenticate(ctx, &types.LoginRequest{Username: req.Name, Password: req.Password})
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+			return
+		}
+
+		// Logging in again from a client that holds a token replaces it;
+		// tokens held by other machines stay valid until they expire
+		var previous string
+		if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+			previous = token
+		}
+		_, token, err := authService.IssueLoginKey(ctx, user.ID, npmLoginClient, npmLoginKeyName, []string{"npm"}, npmLoginKeyLifetime, previous)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("username", user.Username).Msg("Failed to issue npm login token")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue token"})
+			return
+		}
+
+		middleware.Logger(c).Info().Str("username", user.Username).Msg("npm login successful")
+		c.JSON(http.StatusCreated, gin.H{
+			"ok":    true,
+			"id":    npmUserPrefix + user.Username,
+			"token": token,
+		})
+	}
+}
+
+// NPMWhoami godoc
+//
+//	@Summary		Show the npm user
+//	@Description	Return the name of the authenticated user, as used by npm whoami
+//	@Tags			npm
+//	@Produce		json
+//	@Success		200	{object}	object{username=string}	"Authenticated user"
+//	@Failure		401	{object}	object{error=string}	"Unauthorized"
+//	@Security		BearerAuth
+//	@Router			/npm/-/whoami [get]
+func handleNPMWhoami() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"username": user.Username})
+	}
+}
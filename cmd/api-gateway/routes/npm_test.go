@@ -0,0 +1,1056 @@
+package routes
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/advisories"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/npm"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleNPMSearch_Pagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("paged-%d", i)
+		content := createNpmTarball(t, fmt.Sprintf(`{"name":%q,"version":"1.0.0"}`, name), nil)
+		_, err := registryService.Upload(context.Background(), "npm", name, "1.0.0", bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+
+	router := gin.New()
+	router.GET("/npm/-/v1/search", handleNPMSearch(registryService))
+
+	search := func(query string) ([]string, int64) {
+		req := httptest.NewRequest("GET", "/npm/-/v1/search"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Objects []struct {
+				Package struct {
+					Name string `json:"name"`
+				} `json:"package"`
+			} `json:"objects"`
+			Total int64 `json:"total"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		names := make([]string, 0, len(response.Objects))
+		for _, object := range response.Objects {
+			names = append(names, object.Package.Name)
+		}
+		return names, response.Total
+	}
+
+	names, total := search("?text=paged&size=2")
+	assert.Equal(t, []string{"paged-0", "paged-1"}, names)
+	assert.Equal(t, int64(5), total)
+
+	names, total = search("?text=paged&size=2&from=4")
+	assert.Equal(t, []string{"paged-4"}, names)
+	assert.Equal(t, int64(5), total)
+
+	// Oversized and invalid values fall back to the clamp and the defaults
+	names, _ = search("?text=paged&size=100000")
+	assert.Len(t, names, 5)
+	names, _ = search("?text=paged&size=-1&from=banana")
+	assert.Len(t, names, 5)
+}
+
+func TestNPMUpstreamProxy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	// The tarball is cached from a background goroutine, which must see the
+	// same in-memory database
+	sqlDB, err := registryService.DB.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	tarball := createNpmTarball(t, `{"name":"left-pad","version":"1.0.0"}`, map[string]string{"index.js": "module.exports = 1"})
+	// Hashes do not compress, so the tarball is larger than left-pad's
+	var filler strings.Builder
+	sum := sha512.Sum512(nil)
+	for i := 0; i < 64; i++ {
+		sum = sha512.Sum512(sum[:])
+		filler.WriteString(base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	large := createNpmTarball(t, `{"name":"big","version":"1.0.0"}`, map[string]string{"index.js": filler.String()})
+	require.Greater(t, len(large), len(tarball))
+	tarballSum := sha512.Sum512(tarball)
+	var tarballRequests, corruptRequests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/left-pad":
+			fmt.Fprintf(w, `{"name":"left-pad","dist-tags":{"latest":"1.0.0"},"versions":{"1.0.0":{"name":"left-pad","version":"1.0.0","dist":{"tarball":"%s/left-pad/-/left-pad-1.0.0.tgz","integrity":%q}}}}`, "http://"+r.Host, npm.Integrity(tarballSum[:]))
+		case "/left-pad/-/left-pad-1.0.0.tgz":
+			tarballRequests.Add(1)
+			w.Write(tarball)
+		case "/big/-/big-1.0.0.tgz":
+			w.Write(large)
+		case "/corrupt":
+			// Listed with the checksums of a different tarball
+			corruptRequests.Add(1)
+			fmt.Fprintf(w, `{"name":"corrupt","versions":{"1.0.0":{"name":"corrupt","version":"1.0.0","dist":{"integrity":%q,"shasum":%q}}}}`, npm.Integrity(tarballSum[:]), utils.ComputeSHA1(tarball))
+		case "/corrupt/-/corrupt-1.0.0.tgz":
+			w.Write(createNpmTarball(t, `{"name":"corrupt","version":"1.0.0"}`, nil))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+
+	registryService.Configure(config.RegistryConfig{
+		NPMVerifyTarballs: true,
+		UpstreamURLs:      map[string]string{"npm": upstream.URL},
+		UpstreamCacheTTL:  time.Hour,
+		MaxUploadSizes:    map[string]int64{"npm": int64(len(tarball))},
+	})
+
+	// Anonymous downloads are cached too, and served from the cache to
+	// readers limited to public packages
+	router := gin.New()
+	router.Use(middleware.PackageReaderMiddleware())
+	router.GET("/npm/:name", handleNPMPackageInfo(registryService))
+	router.GET("/npm/:name/-/:filename", handleNPMDownload(registryService))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Metadata comes from the upstream with tarballs pointing back here
+	w := get("/npm/left-pad")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var packument struct {
+		Versions map[string]struct {
+			Dist struct {
+				Tarball string `json:"tarball"`
+			} `json:"dist"`
+		} `json:"versions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &packument))
+	assert.Equal(t, "http://example.com/api/v1/npm/left-pad/-/left-pad-1.0.0.tgz", packument.Versions["1.0.0"].Dist.Tarball)
+
+	// Packages missing upstream too are still not found
+	assert.Equal(t, http.StatusNotFound, get("/npm/missing").Code)
+	assert.Equal(t, http.StatusNotFound, get("/npm/missing/-/missing-1.0.0.tgz").Code)
+
+	// The tarball is streamed from the upstream and cached in the background
+	w = get("/npm/left-pad/-/left-pad-1.0.0.tgz")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, tarball, w.Body.Bytes())
+	assert.Eventually(t, func() bool {
+		artifact, err := registryService.GetArtifact(ctx, "npm", "left-pad", "1.0.0")
+		return err == nil && registry.IsUpstreamCached(artifact)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Cached tarballs are attributed to the upstream, not the first requester
+	artifact, err := registryService.GetArtifact(ctx, "npm", "left-pad", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, registry.UpstreamPublisherID, artifact.PublishedBy)
+	assert.NotEqual(t, user.ID, artifact.PublishedBy)
+	assert.True(t, artifact.IsPublic)
+
+	// Tarballs larger than could be uploaded are served but not cached
+	w = get("/npm/big/-/big-1.0.0.tgz")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, large, w.Body.Bytes())
+	assert.Never(t, func() bool {
+		_, err := registryService.GetArtifact(ctx, "npm", "big", "1.0.0")
+		return err == nil
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	// A tarball that does not match the checksums its packument lists is
+	// served but not cached
+	w = get("/npm/corrupt/-/corrupt-1.0.0.tgz")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Eventually(t, func() bool { return corruptRequests.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Never(t, func() bool {
+		_, err := registryService.GetArtifact(ctx, "npm", "corrupt", "1.0.0")
+		return err == nil
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	// Once cached, the upstream is no longer needed
+	upstream.Close()
+	w = get("/npm/left-pad/-/left-pad-1.0.0.tgz")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, tarball, w.Body.Bytes())
+	assert.Equal(t, int32(1), tarballRequests.Load())
+
+	// Metadata is still served from the upstream response cached for the TTL
+	assert.Equal(t, http.StatusOK, get("/npm/left-pad").Code)
+}
+
+// TestNPMUpstreamLocalPackage verifies that versions missing from a package
+// published locally are neither fetched from the upstream nor cached, since
+// the upstream's package of that name is a different one
+func TestNPMUpstreamLocalPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	var upstreamRequests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequests.Add(1)
+		if r.URL.Path == "/internal-lib" {
+			fmt.Fprint(w, `{"name":"internal-lib","dist-tags":{"latest":"9.9.9"},"versions":{"9.9.9":{"name":"internal-lib","version":"9.9.9"}}}`)
+			return
+		}
+		w.Write(createNpmTarball(t, `{"name":"internal-lib","version":"9.9.9"}`, nil))
+	}))
+	defer upstream.Close()
+	registryService.Configure(config.RegistryConfig{
+		UpstreamURLs:     map[string]string{"npm": upstream.URL},
+		UpstreamCacheTTL: time.Hour,
+	})
+
+	content := createNpmTarball(t, `{"name":"internal-lib","version":"1.0.0"}`, nil)
+	_, err := registryService.Upload(ctx, "npm", "internal-lib", "1.0.0", bytes.NewReader(content), user.ID)
+	require.NoError(t, err)
+
+	// Anonymous callers, who cannot read the private package, are not handed
+	// the upstream's package of the same name either
+	router := gin.New()
+	router.Use(middleware.PackageReaderMiddleware())
+	router.GET("/npm/:name", handleNPMPackageInfo(registryService))
+	router.GET("/npm/:name/-/:filename", handleNPMDownload(registryService))
+	for _, path := range []string{"/npm/internal-lib", "/npm/internal-lib/-/internal-lib-9.9.9.tgz"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.NotContains(t, w.Body.String(), "9.9.9", path)
+	}
+	assert.Equal(t, int32(0), upstreamRequests.Load())
+
+	_, err = registryService.CacheUpstream(ctx, "npm", "internal-lib", "9.9.9", createNpmTarball(t, `{"name":"internal-lib","version":"9.9.9"}`, nil))
+	assert.ErrorIs(t, err, registry.ErrPublishedLocally)
+	_, err = registryService.GetArtifact(ctx, "npm", "internal-lib", "9.9.9")
+	assert.ErrorIs(t, err, registry.ErrArtifactNotFound)
+}
+
+// TestNPMUpstreamCachedPackagePublish verifies that users cannot take over a
+// package cached from the upstream by publishing a version of their own,
+// which would leave it without an owner and cut the upstream package off
+func TestNPMUpstreamCachedPackagePublish(t *testing.T) {
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	registryService.Configure(config.RegistryConfig{
+		UpstreamURLs:     map[string]string{"npm": "https://registry.npmjs.org"},
+		UpstreamCacheTTL: time.Hour,
+	})
+
+	_, err := registryService.CacheUpstream(ctx, "npm", "express", "4.18.2", createNpmTarball(t, `{"name":"express","version":"4.18.2"}`, nil))
+	require.NoError(t, err)
+
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(other).Error)
+	for _, publisher := range []*types.User{user, other} {
+		content := createNpmTarball(t, `{"name":"express","version":"99.0.0"}`, nil)
+		_, err := registryService.Upload(ctx, "npm", "express", "99.0.0", bytes.NewReader(content), publisher.ID)
+		assert.ErrorIs(t, err, registry.ErrPublishForbidden, publisher.Username)
+	}
+	owners, err := registryService.Ownership.GetPackageOwners(ctx, "npm", "express")
+	require.NoError(t, err)
+	assert.Empty(t, owners)
+	local, err := registryService.IsPublishedLocally(ctx, "npm", "express")
+	require.NoError(t, err)
+	assert.False(t, local, "the upstream still answers for the package")
+
+	// Administrators may still publish the package locally on purpose, and
+	// own it from then on
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+	content := createNpmTarball(t, `{"name":"express","version":"99.0.0"}`, nil)
+	_, err = registryService.Upload(ctx, "npm", "express", "99.0.0", bytes.NewReader(content), admin.ID)
+	require.NoError(t, err)
+	owners, err = registryService.Ownership.GetPackageOwners(ctx, "npm", "express")
+	require.NoError(t, err)
+	require.Len(t, owners, 1)
+	assert.Equal(t, admin.ID, owners[0].UserID)
+}
+
+func TestNPMDeprecate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	for _, version := range []string{"1.0.0", "1.1.0", "2.0.0"} {
+		content := createNpmTarball(t, `{"name":"left-pad","version":"`+version+`"}`, nil)
+		_, err := registryService.Upload(ctx, "npm", "left-pad", version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/npm/:name", handleNPMPackageInfo(registryService))
+	router.PUT("/npm/:name", handleNPMPublish(registryService))
+
+	deprecate := func(messages map[string]string) *httptest.ResponseRecorder {
+		versions := make(map[string]interface{})
+		for version, message := range messages {
+			versions[version] = map[string]interface{}{"name": "left-pad", "version": version, "deprecated": message}
+		}
+		// Versions npm deprecate leaves alone are sent back without a message
+		versions["2.0.0"] = map[string]interface{}{"name": "left-pad", "version": "2.0.0"}
+		body, err := json.Marshal(map[string]interface{}{"name": "left-pad", "versions": versions})
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("PUT", "/npm/left-pad", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	versions := func() map[string]map[string]interface{} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/npm/left-pad", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var info struct {
+			Versions map[string]map[string]interface{} `json:"versions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+		return info.Versions
+	}
+
+	// A range of versions is deprecated in one call
+	w := deprecate(map[string]string{"1.0.0": "use 2.x", "1.1.0": "use 2.x"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	info := versions()
+	require.Len(t, info, 3, "deprecated versions are kept")
+	assert.Equal(t, "use 2.x", info["1.0.0"]["deprecated"])
+	assert.Equal(t, "use 2.x", info["1.1.0"]["deprecated"])
+	assert.NotContains(t, info["2.0.0"], "deprecated")
+
+	// An empty message undeprecates a version
+	w = deprecate(map[string]string{"1.1.0": ""})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	info = versions()
+	require.Len(t, info, 3)
+	assert.Equal(t, "use 2.x", info["1.0.0"]["deprecated"])
+	assert.NotContains(t, info["1.1.0"], "deprecated")
+
+	assert.Equal(t, http.StatusNotFound, deprecate(map[string]string{"9.9.9": "gone"}).Code)
+
+	// Deprecating needs publish rights on the package
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(other).Error)
+	_, err := registryService.Deprecate(ctx, "npm", "left-pad", map[string]string{"1.0.0": "mine"}, other.ID)
+	assert.ErrorIs(t, err, registry.ErrDeprecationForbidden)
+}
+
+func TestNPMPackageInfo_ExactName(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	for name, version := range map[string]string{"lodash": "4.17.21", "lodash-es": "4.17.20", "@types/lodash": "4.14.0"} {
+		content := createNpmTarball(t, `{"name":"`+name+`","version":"`+version+`"}`, nil)
+		_, err := registryService.Upload(ctx, "npm", name, version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+
+	router := gin.New()
+	router.GET("/npm/:name", handleNPMPackageInfo(registryService))
+	router.GET("/npm/@:scope/:name", handleNPMScopedPackageInfo(registryService))
+	info := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	// Packages whose names contain the requested one are not its versions
+	code, body := info("/npm/lodash")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "lodash", body["name"])
+	assert.Len(t, body["versions"], 1)
+	assert.Contains(t, body["versions"], "4.17.21")
+
+	// Incidental case in the request still finds the package
+	code, body = info("/npm/Lodash")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "lodash", body["name"])
+
+	code, body = info("/npm/@Types/Lodash")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "@types/lodash", body["name"])
+	assert.Len(t, body["versions"], 1)
+
+	code, _ = info("/npm/lodas")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestNPMPackageInfo_ETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	publish := func(version string) {
+		content := createNpmTarball(t, `{"name":"@acme/widget","version":"`+version+`"}`, nil)
+		_, err := registryService.Upload(ctx, "npm", "@acme/widget", version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+	publish("1.0.0")
+
+	router := gin.New()
+	router.GET("/npm/@:scope/:name", handleNPMScopedPackageInfo(registryService))
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/npm/@acme/widget", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, etag, get("").Header().Get("ETag"), "the tag is stable while the package is unchanged")
+	assert.Equal(t, w.Body.String(), get("").Body.String(), "the document is stable while the package is unchanged")
+
+	t.Run("cache hit", func(t *testing.T) {
+		w := get(etag)
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+
+		assert.Equal(t, http.StatusNotModified, get(`"stale", W/`+etag).Code, "weak and listed tags match")
+	})
+
+	t.Run("cache miss", func(t *testing.T) {
+		w := get(`"stale"`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"1.0.0"`)
+	})
+
+	t.Run("changes invalidate the tag", func(t *testing.T) {
+		_, err := registryService.SetDistTag(ctx, "npm", "@acme/widget", "beta", "1.0.0", user.ID)
+		require.NoError(t, err)
+		w := get(etag)
+		require.Equal(t, http.StatusOK, w.Code)
+		tagged := w.Header().Get("ETag")
+		assert.NotEqual(t, etag, tagged)
+
+		publish("1.1.0")
+		w = get(tagged)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, tagged, w.Header().Get("ETag"))
+		assert.Contains(t, w.Body.String(), `"1.1.0"`)
+	})
+}
+
+func TestNPMPackageInfo_ChecksumsComputedOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	tarballs := make(map[string][]byte)
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		tarballs[version] = createNpmTarball(t, `{"name":"left-pad","version":"`+version+`"}`, nil)
+		_, err := registryService.Upload(ctx, "npm", "left-pad", version, bytes.NewReader(tarballs[version]), user.ID)
+		require.NoError(t, err)
+	}
+	integrity := func(tarball []byte) string {
+		sum := sha512.Sum512(tarball)
+		return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	// 1.0.0 was published before checksums were recorded
+	var legacy types.Artifact
+	require.NoError(t, registryService.DB.Where("name = ? AND version = ?", "left-pad", "1.0.0").First(&legacy).Error)
+	assert.Equal(t, utils.ComputeSHA1(tarballs["1.0.0"]), legacy.Metadata[npm.ShasumMetadataKey], "recorded at publish time")
+	assert.Equal(t, integrity(tarballs["1.0.0"]), legacy.Metadata[npm.IntegrityMetadataKey], "recorded at publish time")
+	delete(legacy.Metadata, npm.ShasumMetadataKey)
+	delete(legacy.Metadata, npm.IntegrityMetadataKey)
+	require.NoError(t, registryService.DB.Model(&legacy).UpdateColumn("metadata", legacy.Metadata).Error)
+
+	type dist struct {
+		Shasum    string `json:"shasum"`
+		Integrity string `json:"integrity"`
+	}
+	router := gin.New()
+	router.GET("/npm/:name", handleNPMPackageInfo(registryService))
+	router.GET("/npm/:name/:version", handleNPMPackageVersion(registryService))
+	dists := func() map[string]dist {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/npm/left-pad", nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var document struct {
+			Versions map[string]struct {
+				Dist dist `json:"dist"`
+			} `json:"versions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+		dists := make(map[string]dist)
+		for version, info := range document.Versions {
+			dists[version] = info.Dist
+		}
+		return dists
+	}
+	expected := map[string]dist{
+		"1.0.0": {Shasum: utils.ComputeSHA1(tarballs["1.0.0"]), Integrity: integrity(tarballs["1.0.0"])},
+		"1.1.0": {Shasum: utils.ComputeSHA1(tarballs["1.1.0"]), Integrity: integrity(tarballs["1.1.0"])},
+	}
+
+	// The missing checksums are computed on first use and recorded
+	assert.Equal(t, expected, dists())
+	require.NoError(t, registryService.DB.First(&legacy, "id = ?", legacy.ID).Error)
+	assert.Equal(t, expected["1.0.0"].Shasum, legacy.Metadata[npm.ShasumMetadataKey])
+	assert.Equal(t, expected["1.0.0"].Integrity, legacy.Metadata[npm.IntegrityMetadataKey])
+
+	// Single versions list the same checksums
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/npm/left-pad/1.1.0", nil))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var version struct {
+		Dist dist `json:"dist"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &version))
+	assert.Equal(t, expected["1.1.0"], version.Dist)
+
+	// The integrity is a valid SSRI string of the tarball's SHA-512
+	for version, tarball := range tarballs {
+		algorithm, digest, ok := strings.Cut(expected[version].Integrity, "-")
+		require.True(t, ok)
+		assert.Equal(t, "sha512", algorithm)
+		decoded, err := base64.StdEncoding.DecodeString(digest)
+		require.NoError(t, err)
+		sum := sha512.Sum512(tarball)
+		assert.Equal(t, sum[:], decoded)
+	}
+
+	// Later requests reuse the recorded checksums without reading the tarballs
+	var artifacts []types.Artifact
+	require.NoError(t, registryService.DB.Find(&artifacts).Error)
+	for _, artifact := range artifacts {
+		require.NoError(t, registryService.Storage.Delete(ctx, artifact.StoragePath))
+	}
+	assert.Equal(t, expected, dists())
+}
+
+func TestNPMDistTags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, owner := setupRegistryTestService(t)
+	ctx := context.Background()
+	for _, version := range []string{"1.0.0", "1.1.0", "2.0.0-beta.1"} {
+		content := createNpmTarball(t, fmt.Sprintf(`{"name":"@acme/widget","version":%q}`, version), nil)
+		_, err := registryService.Upload(ctx, "npm", "@acme/widget", version, bytes.NewReader(content), owner.ID)
+		require.NoError(t, err)
+	}
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(other).Error)
+
+	currentUser := owner
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", currentUser)
+		c.Next()
+	})
+	router.GET("/npm/@:scope/:name", handleNPMScopedPackageInfo(registryService))
+	router.GET("/npm/-/package/:name/dist-tags", handleNPMDistTags(registryService))
+	router.GET("/npm/-/package/@:scope/:name/dist-tags", handleNPMDistTags(registryService))
+	router.PUT("/npm/-/package/@:scope/:name/dist-tags/:tag", handleNPMSetDistTag(registryService))
+	router.DELETE("/npm/-/package/@:scope/:name/dist-tags/:tag", handleNPMDeleteDistTag(registryService))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	tags := func(w *httptest.ResponseRecorder) map[string]string {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var tags map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tags))
+		return tags
+	}
+	const path = "/npm/-/package/@acme/widget/dist-tags"
+
+	// latest follows the newest stable version until it is set
+	assert.Equal(t, map[string]string{"latest": "1.1.0"}, tags(request("GET", path, "")))
+	assert.Equal(t, http.StatusNotFound, request("GET", "/npm/-/package/missing/dist-tags", "").Code)
+
+	// npm dist-tag add
+	assert.Equal(t, map[string]string{"latest": "1.1.0", "beta": "2.0.0-beta.1"}, tags(request("PUT", path+"/beta", `"2.0.0-beta.1"`)))
+	assert.Equal(t, map[string]string{"latest": "1.0.0", "beta": "2.0.0-beta.1"}, tags(request("PUT", path+"/latest", `"1.0.0"`)))
+	assert.Equal(t, http.StatusNotFound, request("PUT", path+"/next", `"9.9.9"`).Code, "tags must point at existing versions")
+	assert.Equal(t, http.StatusBadRequest, request("PUT", path+"/1.x", `"1.0.0"`).Code, "tags cannot be version ranges")
+
+	// The package document serves the stored tags
+	w := request("GET", "/npm/@acme/widget", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var document struct {
+		DistTags map[string]string `json:"dist-tags"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &document))
+	assert.Equal(t, map[string]string{"latest": "1.0.0", "beta": "2.0.0-beta.1"}, document.DistTags)
+
+	// Only users who can publish the package may change its tags
+	currentUser = other
+	assert.Equal(t, http.StatusForbidden, request("PUT", path+"/beta", `"1.0.0"`).Code)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", path+"/beta", "").Code)
+	assert.Equal(t, http.StatusOK, request("GET", path, "").Code)
+	currentUser = owner
+
+	// npm dist-tag rm
+	assert.Equal(t, map[string]string{"latest": "1.0.0"}, tags(request("DELETE", path+"/beta", "")))
+	assert.Equal(t, http.StatusNotFound, request("DELETE", path+"/beta", "").Code)
+	assert.Equal(t, http.StatusBadRequest, request("DELETE", path+"/latest", "").Code)
+
+	// Publishing past an explicitly set latest lets it follow the newest version again
+	content := createNpmTarball(t, `{"name":"@acme/widget","version":"1.2.0"}`, nil)
+	_, err := registryService.Upload(ctx, "npm", "@acme/widget", "1.2.0", bytes.NewReader(content), owner.ID)
+	require.NoError(t, err)
+	registryService.TagPublishedVersion(ctx, "npm", "@acme/widget", "1.2.0", map[string]string{"latest": "1.2.0"})
+	assert.Equal(t, map[string]string{"latest": "1.2.0"}, tags(request("GET", path, "")))
+
+	// Tags of deleted versions are dropped
+	tags(request("PUT", path+"/legacy", `"1.0.0"`))
+	require.NoError(t, registryService.Delete(ctx, "npm", "@acme/widget", "1.0.0", owner.ID))
+	assert.Equal(t, map[string]string{"latest": "1.2.0"}, tags(request("GET", path, "")))
+}
+
+func TestNPMDistTags_RestrictedPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	content := createNpmTarball(t, `{"name":"restricted","version":"1.0.0"}`, nil)
+	_, err := registryService.Upload(context.Background(), "npm", "restricted", "1.0.0", bytes.NewReader(content), publisher.ID)
+	require.NoError(t, err)
+
+	get := func(user *types.User) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/npm/-/package/:name/dist-tags", handleNPMDistTags(registryService))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/npm/-/package/restricted/dist-tags", nil))
+		return w
+	}
+
+	w := get(publisher)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"latest":"1.0.0"}`, w.Body.String())
+
+	// Users who cannot read the package cannot list its tags or versions
+	w = get(outsider)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "1.0.0")
+}
+
+// TestNPMAccess verifies npm access: owners flip every version of a package
+// between public and restricted, and grant and revoke other users' access
+func TestNPMAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, owner := setupRegistryTestService(t)
+	ctx := context.Background()
+	publish := func(version string, user *types.User) error {
+		content := createNpmTarball(t, fmt.Sprintf(`{"name":"@acme/widget","version":%q}`, version), nil)
+		_, err := registryService.Upload(ctx, "npm", "@acme/widget", version, bytes.NewReader(content), user.ID)
+		return err
+	}
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		require.NoError(t, publish(version, owner))
+	}
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(other).Error)
+
+	currentUser := owner
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", currentUser)
+		c.Next()
+	})
+	router.GET("/npm/-/package/@:scope/:name/visibility", handleNPMVisibility(registryService))
+	router.POST("/npm/-/package/@:scope/:name/access", handleNPMSetAccess(registryService))
+	router.GET("/npm/-/package/@:scope/:name/collaborators", handleNPMCollaborators(registryService))
+	router.PUT("/npm/-/team/:scope/:team/package", handleNPMGrantAccess(registryService))
+	router.DELETE("/npm/-/team/:scope/:team/package", handleNPMRevokeAccess(registryService))
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	visibility := func() bool {
+		w := request("GET", "/npm/-/package/@acme/widget/visibility", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body struct {
+			Public bool `json:"public"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Public
+	}
+	publicVersions := func() int64 {
+		var count int64
+		require.NoError(t, registryService.DB.Model(&types.Artifact{}).Where("name = ? AND is_public = ?", "@acme/widget", true).Count(&count).Error)
+		return count
+	}
+	collaborators := func() map[string]string {
+		w := request("GET", "/npm/-/package/@acme/widget/collaborators", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+	const access = "/npm/-/package/@acme/widget/access"
+	const team = "/npm/-/team/acme/other/package"
+
+	// npm access set status=public applies to every version, and to versions
+	// published afterwards
+	assert.False(t, visibility())
+	require.Equal(t, http.StatusOK, request("POST", access, `{"access":"public"}`).Code)
+	assert.True(t, visibility())
+	assert.Equal(t, int64(2), publicVersions())
+	require.NoError(t, publish("1.2.0", owner))
+	assert.Equal(t, int64(3), publicVersions())
+
+	// npm access set status=private, and restricted from older npm
+	require.Equal(t, http.StatusOK, request("POST", access, `{"access":"private"}`).Code)
+	assert.False(t, visibility())
+	assert.Zero(t, publicVersions())
+	require.Equal(t, http.StatusOK, request("POST", access, `{"access":"restricted"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", access, `{"access":"everyone"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", access, `{"publish_requires_tfa":true}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/npm/-/package/@acme/missing/access", `{"access":"public"}`).Code, "nobody owns it")
+
+	// Only owners change visibility or grant access, and only owners and
+	// maintainers see them
+	currentUser = other
+	assert.Equal(t, http.StatusForbidden, request("POST", access, `{"access":"public"}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("PUT", team, `{"package":"@acme/widget","permissions":"read-write"}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/npm/-/package/@acme/widget/visibility", "").Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/npm/-/package/@acme/widget/collaborators", "").Code)
+	assert.Error(t, publish("1.3.0", other))
+	currentUser = owner
+
+	// npm access grant read-only lets the user download the restricted
+	// package, and read-write lets them publish
+	reader := registry.WithReader(ctx, func() *types.User { return other })
+	_, _, err := registryService.Download(reader, "npm", "@acme/widget", "1.2.0")
+	assert.ErrorIs(t, err, registry.ErrArtifactNotFound)
+	require.Equal(t, http.StatusOK, request("PUT", team, `{"package":"@acme/widget","permissions":"read-only"}`).Code)
+	assert.Equal(t, map[string]string{"publisher": "read-write", "other": "read-only"}, collaborators())
+	_, content, err := registryService.Download(reader, "npm", "@acme/widget", "1.2.0")
+	require.NoError(t, err)
+	content.Close()
+	currentUser = other
+	assert.Equal(t, http.StatusForbidden, request("GET", "/npm/-/package/@acme/widget/collaborators", "").Code)
+	currentUser = owner
+	assert.Error(t, publish("1.3.0", other))
+	require.Equal(t, http.StatusOK, request("PUT", team, `{"package":"@acme/widget","permissions":"read-write"}`).Code)
+	assert.Equal(t, map[string]string{"publisher": "read-write", "other": "read-write"}, collaborators())
+	require.NoError(t, publish("1.3.0", other))
+
+	// Granting to an owner does not demote them
+	require.Equal(t, http.StatusOK, request("PUT", "/npm/-/team/acme/publisher/package", `{"package":"@acme/widget","permissions":"read-only"}`).Code)
+	assert.Equal(t, "read-write", collaborators()["publisher"])
+
+	assert.Equal(t, http.StatusBadRequest, request("PUT", team, `{"package":"@acme/widget","permissions":"admin"}`).Code)
+	assert.Equal(t, http.StatusNotFound, request("PUT", "/npm/-/team/acme/nobody/package", `{"package":"@acme/widget","permissions":"read-only"}`).Code)
+
+	// npm access revoke
+	require.Equal(t, http.StatusOK, request("DELETE", team, `{"package":"@acme/widget"}`).Code)
+	assert.Equal(t, map[string]string{"publisher": "read-write"}, collaborators())
+	assert.Equal(t, http.StatusNotFound, request("DELETE", team, `{"package":"@acme/widget"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("DELETE", "/npm/-/team/acme/publisher/package", `{"package":"@acme/widget"}`).Code, "the last owner stays")
+}
+
+func TestNPMBulkAdvisories(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	advisoryService := advisories.NewService(registryService.DB.DB)
+	seeded := &types.Advisory{
+		Registry:           "npm",
+		PackageName:        "lodash",
+		VulnerableVersions: ">=4.0.0 <4.17.21",
+		Title:              "Command Injection in lodash",
+		Severity:           types.AdvisorySeverityHigh,
+		URL:                "https://github.com/advisories/GHSA-35jh-r3h4-6jhm",
+		CWE:                []string{"CWE-77"},
+		CVSSScore:          7.2,
+		CVSSVector:         "CVSS:3.1/AV:N/AC:L/PR:H/UI:N/S:U/C:H/I:H/A:H",
+	}
+	require.NoError(t, advisoryService.CreateAdvisory(context.Background(), seeded, user.ID))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.POST("/npm/-/npm/v1/security/advisories/bulk", handleNPMBulkAdvisories(advisoryService))
+
+	bulk := func(body []byte, gzipped bool) *httptest.ResponseRecorder {
+		if gzipped {
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			_, err := gw.Write(body)
+			require.NoError(t, err)
+			require.NoError(t, gw.Close())
+			body = buf.Bytes()
+		}
+		req := httptest.NewRequest("POST", "/npm/-/npm/v1/security/advisories/bulk", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("vulnerable version in range", func(t *testing.T) {
+		// npm audit sends the bulk request gzipped
+		w := bulk([]byte(`{"lodash":["4.17.20","4.17.21"],"left-pad":["1.3.0"]}`), true)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response map[string][]map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response["lodash"], 1)
+		advisory := response["lodash"][0]
+		assert.Equal(t, seeded.ID.String(), advisory["id"])
+		assert.Equal(t, "Command Injection in lodash", advisory["title"])
+		assert.Equal(t, "high", advisory["severity"])
+		assert.Equal(t, ">=4.0.0 <4.17.21", advisory["vulnerable_versions"])
+		assert.Equal(t, seeded.URL, advisory["url"])
+		assert.Equal(t, []interface{}{"CWE-77"}, advisory["cwe"])
+		assert.Equal(t, map[string]interface{}{"score": 7.2, "vectorString": seeded.CVSSVector}, advisory["cvss"])
+
+		// Packages without advisories are answered with none
+		assert.Contains(t, response, "left-pad")
+		assert.Empty(t, response["left-pad"])
+	})
+
+	t.Run("versions outside the range", func(t *testing.T) {
+		w := bulk([]byte(`{"lodash":["3.10.1","4.17.21"]}`), false)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"lodash":[]}`, w.Body.String())
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, bulk([]byte(`["lodash"]`), false).Code)
+
+		req := httptest.NewRequest("POST", "/npm/-/npm/v1/security/advisories/bulk", bytes.NewReader([]byte(`{"lodash":["4.17.20"]}`)))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestNPMLoginAndWhoami(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	require.NoError(t, registryService.DB.AutoMigrate(&types.APIKey{}))
+	password, err := utils.HashPassword("correct horse", 4)
+	require.NoError(t, err)
+	require.NoError(t, registryService.DB.Model(user).Update("password", password).Error)
+	authService := auth.NewService(registryService.DB, nil, &config.AuthConfig{JWTSecret: "test-secret", BCryptCost: 4})
+
+	router := gin.New()
+	NPMRoutes(router.Group("/api/v1"), registryService, authService)
+
+	login := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/v1/npm/-/user/"+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	whoami := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/npm/-/whoami", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("login returns a usable token", func(t *testing.T) {
+		w := login("org.couchdb.user:publisher", `{"_id":"org.couchdb.user:publisher","name":"publisher","password":"correct horse","type":"user","roles":[]}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var response struct {
+			OK    bool   `json:"ok"`
+			ID    string `json:"id"`
+			Token string `json:"token"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.True(t, response.OK)
+		assert.Equal(t, "org.couchdb.user:publisher", response.ID)
+		require.NotEmpty(t, response.Token)
+
+		w = whoami(response.Token)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"username":"publisher"}`, w.Body.String())
+
+		// The token is an API key limited to npm
+		keys, err := authService.ListAPIKeys(context.Background(), user.ID)
+		require.NoError(t, err)
+		require.Len(t, keys, 1)
+		assert.Equal(t, "npm login", keys[0].Name)
+		assert.Equal(t, []string{"npm"}, []string(keys[0].Scopes))
+	})
+
+	t.Run("logging in again replaces the token of the same client", func(t *testing.T) {
+		token := func(previous string) string {
+			req := httptest.NewRequest("PUT", "/api/v1/npm/-/user/org.couchdb.user:publisher", bytes.NewBufferString(`{"name":"publisher","password":"correct horse"}`))
+			req.Header.Set("Content-Type", "application/json")
+			if previous != "" {
+				req.Header.Set("Authorization", "Bearer "+previous)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+			var response struct {
+				Token string `json:"token"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			return response.Token
+		}
+		_, handMade, err := authService.CreateAPIKey(context.Background(), user.ID, "npm login", nil, []string{"npm"})
+		require.NoError(t, err)
+
+		// Logins from different machines each keep their token
+		laptop := token("")
+		ci := token("")
+		assert.Equal(t, http.StatusOK, whoami(laptop).Code)
+		assert.Equal(t, http.StatusOK, whoami(ci).Code)
+
+		// Logging in again with the token a login issued replaces it
+		replacement := token(laptop)
+		assert.Equal(t, http.StatusUnauthorized, whoami(laptop).Code)
+		assert.Equal(t, http.StatusOK, whoami(replacement).Code)
+		assert.Equal(t, http.StatusOK, whoami(ci).Code)
+
+		// Keys created by hand are never replaced, whatever their name
+		token(handMade)
+		assert.Equal(t, http.StatusOK, whoami(handMade).Code)
+
+		keys, err := authService.ListAPIKeys(context.Background(), user.ID)
+		require.NoError(t, err)
+		for _, key := range keys {
+			if key.LoginClient == "" {
+				continue
+			}
+			assert.Equal(t, "npm", key.LoginClient)
+			require.NotNil(t, key.ExpiresAt, "login tokens expire")
+			assert.WithinDuration(t, time.Now().Add(90*24*time.Hour), *key.ExpiresAt, time.Minute)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		w := login("org.couchdb.user:publisher", `{"name":"publisher","password":"wrong"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("name must match the document ID", func(t *testing.T) {
+		w := login("org.couchdb.user:someone-else", `{"name":"publisher","password":"correct horse"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("whoami requires authentication", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnauthorized, whoami("not-a-token").Code)
+	})
+}
+
+func TestNPMPublish_RootManifest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.PUT("/npm/:name", handleNPMPublish(registryService))
+
+	// tarball writes the entries in the order given
+	tarball := func(entries ...[2]string) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for _, entry := range entries {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: entry[0], Mode: 0644, Size: int64(len(entry[1]))}))
+			_, err := tw.Write([]byte(entry[1]))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		return buf.Bytes()
+	}
+	publish := func(content []byte) *httptest.ResponseRecorder {
+		body, err := json.Marshal(map[string]interface{}{
+			"name": "bundler",
+			"_attachments": map[string]interface{}{
+				"bundler-1.0.0.tgz": map[string]interface{}{"data": base64.StdEncoding.EncodeToString(content)},
+			},
+		})
+		require.NoError(t, err)
+		req := httptest.NewRequest("PUT", "/npm/bundler", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A manifest without a name is rejected rather than failing the handler
+	w := publish(tarball([2]string{"package/package.json", `{"version":"1.0.0"}`}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Manifests of bundled dependencies are not taken for the package's own
+	w = publish(tarball(
+		[2]string{"package/node_modules/dep/package.json", `{"name":"dep","version":"9.9.9"}`},
+		[2]string{"package/package.json", `{"name":"bundler","version":"1.0.0"}`},
+	))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	artifact, err := registryService.GetArtifact(context.Background(), "npm", "bundler", "1.0.0")
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", artifact.Version)
+}
@@ -0,0 +1,259 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/upstream"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// upstreamCacheTimeout bounds storing a tarball fetched from the upstream,
+// which happens after the client request has finished
+const upstreamCacheTimeout = 5 * time.Minute
+
+// upstreamCacheBuffer keeps a copy of a file streamed from an upstream so it
+// can be cached once the response is complete. It stops keeping the copy,
+// without failing the stream, once the file grows past limit, so a file
+// larger than could be uploaded is served but not cached; a limit of zero or
+// less is unlimited.
+type upstreamCacheBuffer struct {
+	bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+// newUpstreamCacheBuffer returns a buffer capped at limit for a file of the
+// given size, which is negative when the upstream did not report it
+func newUpstreamCacheBuffer(limit, size int64) *upstreamCacheBuffer {
+	return &upstreamCacheBuffer{limit: limit, overflow: limit > 0 && size > limit}
+}
+
+func (b *upstreamCacheBuffer) Write(p []byte) (int, error) {
+	if b.overflow {
+		return len(p), nil
+	}
+	if b.limit > 0 && int64(b.Len()+len(p)) > b.limit {
+		b.overflow = true
+		b.Reset()
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// serveNPMUpstreamPackage answers a package metadata request from the npm
+// upstream when the package has no local versions, or only versions cached
+// from the upstream, since those are a subset of what the upstream holds.
+// Local versions count whoever can read them, so a caller who cannot see a
+// private package is not handed the upstream's package of the same name.
+// Tarball URLs are rewritten to point here so downloads are cached. It
+// returns false when the request should be answered locally instead.
+func serveNPMUpstreamPackage(c *gin.Context, registryService *registry.Service, packageName string) bool {
+	proxy := registryService.Upstream("npm")
+	if proxy == nil {
+		return false
+	}
+	local, err := registryService.IsPublishedLocally(c.Request.Context(), "npm", packageName)
+	if err != nil {
+		middleware.Logger(c).Error().Err(err).Str("package", packageName).Msg("failed to check for locally published npm package")
+		return false
+	}
+	if local {
+		return false
+	}
+
+	body, err := proxy.FetchMetadata(c.Request.Context(), "/"+url.PathEscape(packageName))
+	if err != nil {
+		if !upstream.IsNotFound(err) {
+			middleware.Logger(c).Warn().Err(err).Str("package", packageName).Str("upstream", proxy.URL()).Msg("failed to fetch npm package from upstream")
+		}
+		return false
+	}
+
+	var packument map[string]interface{}
+	if err := json.Unmarshal(body, &packument); err != nil {
+		middleware.Logger(c).Warn().Err(err).Str("package", packageName).Str("upstream", proxy.URL()).Msg("invalid npm package metadata from upstream")
+		return false
+	}
+
+	if versions, ok := packument["versions"].(map[string]interface{}); ok {
+		for version, versionObj := range versions {
+			if obj, ok := versionObj.(map[string]interface{}); ok {
+				if dist, ok := obj["dist"].(map[string]interface{}); ok {
+					dist["tarball"] = generateTarballURL(c, packageName, version)
+				}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, packument)
+	return true
+}
+
+// serveNPMUpstreamTarball streams a tarball missing locally from the npm
+// upstream, then caches it in the background, once it matches the checksums
+// the upstream packument lists, so later downloads are served locally. It returns false when the upstream does not have it either, or
+// when the package is published locally, since the upstream's package of the
+// same name is a different one.
+func serveNPMUpstreamTarball(c *gin.Context, registryService *registry.Service, packageName, filename, version string) bool {
+	proxy := registryService.Upstream("npm")
+	if proxy == nil {
+		return false
+	}
+	local, err := registryService.IsPublishedLocally(c.Request.Context(), "npm", packageName)
+	if err != nil {
+		middleware.Logger(c).Error().Err(err).Str("package", packageName).Msg("failed to check for locally published npm package")
+		return false
+	}
+	if local {
+		return false
+	}
+
+	content, size, err := proxy.Open(c.Request.Context(), "/"+packageName+"/-/"+filename)
+	if err != nil {
+		if !upstream.IsNotFound(err) {
+			middleware.Logger(c).Warn().Err(err).Str("package", packageName).Str("version", version).Str("upstream", proxy.URL()).Msg("failed to fetch npm tarball from upstream")
+		}
+		return false
+	}
+	defer content.Close()
+
+	// Served like a tarball stored locally, since it is about to be
+	setDownloadHeaders(c, &types.Artifact{Registry: "npm", Name: packageName, Version: version})
+	if size >= 0 {
+		c.Header("Content-Length", fmt.Sprintf("%d", size))
+	}
+	c.Status(http.StatusOK)
+
+	tarball := newUpstreamCacheBuffer(registryService.MaxUploadSize("npm"), size)
+	if _, err := io.Copy(c.Writer, io.TeeReader(content, tarball)); err != nil {
+		// The response has started, so the client sees a truncated body
+		middleware.Logger(c).Warn().Err(err).Str("package", packageName).Str("version", version).Msg("failed to stream npm tarball from upstream")
+		return true
+	}
+
+	if tarball.overflow {
+		middleware.Logger(c).Info().Str("package", packageName).Str("version", version).Msg("npm tarball from upstream exceeds the upload limit, not caching")
+		return true
+	}
+
+	// The gin context is reused once the handler returns, so the logger is
+	// taken from it first
+	logger := middleware.Logger(c)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), "registry", "npm"), upstreamCacheTimeout)
+		defer cancel()
+
+		// A tarball that does not match the checksums its upstream packument
+		// lists is not kept, so a corrupted or tampered transfer is fetched
+		// again next time
+		integrity, shasum, err := fetchNPMUpstreamDist(ctx, proxy, packageName, version)
+		if err != nil {
+			logger.Warn().Err(err).Str("package", packageName).Str("version", version).Msg("failed to fetch npm tarball checksums from upstream, not caching")
+			return
+		}
+		if err := verifyNPMTarball(tarball.Bytes(), integrity, shasum); err != nil {
+			logger.Warn().Err(err).Str("package", packageName).Str("version", version).Msg("npm tarball from upstream does not match its checksums, not caching")
+			return
+		}
+
+		if _, err := registryService.CacheUpstream(ctx, "npm", packageName, version, tarball.Bytes()); err != nil {
+			logger.Warn().Err(err).Str("package", packageName).Str("version", version).Msg("failed to cache npm tarball from upstream")
+		}
+	}()
+	return true
+}
+
+// fetchNPMUpstreamDist returns the integrity string and shasum the upstream
+// packument lists for a version's tarball
+func fetchNPMUpstreamDist(ctx context.Context, proxy *upstream.Proxy, packageName, version string) (integrity, shasum string, err error) {
+	body, err := proxy.FetchMetadata(ctx, "/"+url.PathEscape(packageName))
+	if err != nil {
+		return "", "", err
+	}
+
+	var packument struct {
+		Versions map[string]struct {
+			Dist struct {
+				Integrity string `json:"integrity"`
+				Shasum    string `json:"shasum"`
+			} `json:"dist"`
+		} `json:"versions"`
+	}
+	if err := json.Unmarshal(body, &packument); err != nil {
+		return "", "", fmt.Errorf("invalid npm package metadata: %w", err)
+	}
+	listed, ok := packument.Versions[version]
+	if !ok {
+		return "", "", fmt.Errorf("version %s is not listed upstream", version)
+	}
+	return listed.Dist.Integrity, listed.Dist.Shasum, nil
+}
+
+// npmIntegrityAlgorithms are the hash algorithms of SSRI integrity strings,
+// strongest first
+var npmIntegrityAlgorithms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{"sha512", sha512.New},
+	{"sha384", sha512.New384},
+	{"sha256", sha256.New},
+	{"sha1", sha1.New},
+}
+
+// verifyNPMTarball checks a tarball against the integrity string and shasum
+// listed for it. As npm does, only the strongest algorithm in the integrity
+// string is checked, and the shasum only when the integrity string has none
+// it knows. A tarball listed with neither fails.
+func verifyNPMTarball(content []byte, integrity, shasum string) error {
+	entries := strings.Fields(integrity)
+	for _, algorithm := range npmIntegrityAlgorithms {
+		var digests []string
+		for _, entry := range entries {
+			if name, digest, ok := strings.Cut(entry, "-"); ok && name == algorithm.name {
+				// Options follow the digest after a ?
+				digest, _, _ = strings.Cut(digest, "?")
+				digests = append(digests, digest)
+			}
+		}
+		if len(digests) == 0 {
+			continue
+		}
+
+		h := algorithm.hash()
+		h.Write(content)
+		actual := base64.StdEncoding.EncodeToString(h.Sum(nil))
+		for _, digest := range digests {
+			if digest == actual {
+				return nil
+			}
+		}
+		return fmt.Errorf("tarball does not match its %s integrity", algorithm.name)
+	}
+
+	if shasum == "" {
+		return errors.New("no integrity or shasum is listed for the tarball")
+	}
+	if actual := utils.ComputeSHA1(content); !strings.EqualFold(shasum, actual) {
+		return fmt.Errorf("tarball does not match its shasum %s", shasum)
+	}
+	return nil
+}
@@ -1,15 +1,16 @@
 package routes
 
 import (
-	"archive/zip"
 	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -19,14 +20,16 @@ import (
 	"github.com/lgulliver/lodestone/internal/registry"
 	"github.com/lgulliver/lodestone/internal/registry/registries/nuget"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // extractNuGetPackageInfo extracts package name and version from .nupkg file contents
 func extractNuGetPackageInfo(fileContent []byte) (string, string, error) {
-	// Create a byte reader for the zip content
-	reader := bytes.NewReader(fileContent)
-	zipReader, err := zip.NewReader(reader, int64(len(fileContent)))
+	// Open the zip archive
+	zipReader, err := utils.NewZipReader(fileContent)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to read nupkg as zip: %w", err)
 	}
@@ -36,14 +39,8 @@ func extractNuGetPackageInfo(fileContent []byte) (string, string, error) {
 		if strings.HasSuffix(file.Name, ".nuspec") {
 			log.Info().Str("nuspec_file", file.Name).Msg("Found .nuspec file in package")
 
-			rc, err := file.Open()
-			if err != nil {
-				return "", "", fmt.Errorf("failed to open nuspec file: %w", err)
-			}
-			defer rc.Close()
-
 			// Read and parse the .nuspec XML
-			nuspecContent, err := io.ReadAll(rc)
+			nuspecContent, err := utils.ReadZipFile(file)
 			if err != nil {
 				return "", "", fmt.Errorf("failed to read nuspec content: %w", err)
 			}
@@ -73,6 +70,7 @@ func extractNuGetPackageInfo(fileContent []byte) (string, string, error) {
 // NuGetRoutes sets up NuGet package manager routes
 func NuGetRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	nuget := api.Group("/nuget")
+	nuget.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("nuget")))
 
 	// NuGet v3 Service Index (root metadata endpoint)
 	nuget.GET("/v3/index.json", handleNuGetServiceIndex())
@@ -85,7 +83,11 @@ func NuGetRoutes(api *gin.RouterGroup, registryService *registry.Service, authSe
 	// Package publish (requires authentication) - NuGet v2 API
 	nuget.PUT("/v2/package", middleware.AuthMiddleware(authService), handleNuGetUpload(registryService))
 	nuget.PUT("/v2/package/", middleware.AuthMiddleware(authService), handleNuGetUpload(registryService))
-	nuget.DELETE("/v2/package/:id/:version", middleware.AuthMiddleware(authService), handleNuGetDelete(registryService))
+	// Deleting a package unlists it, as on nuget.org; relisting is a POST, and
+	// only admins can remove a package outright
+	nuget.DELETE("/v2/package/:id/:version", middleware.AuthMiddleware(authService), handleNuGetListing(registryService, false))
+	nuget.POST("/v2/package/:id/:version", middleware.AuthMiddleware(authService), handleNuGetListing(registryService, true))
+	nuget.DELETE("/v2/package/:id/:version/purge", middleware.AuthMiddleware(authService), adminOnlyMiddleware(), handleNuGetDelete(registryService))
 
 	// Symbol package endpoints (requires authentication) - NuGet v2 API
 	nuget.PUT("/v2/symbolpackage", middleware.AuthMiddleware(authService), handleNuGetSymbolUpload(registryService))
@@ -109,15 +111,7 @@ func handleNuGetServiceIndex() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// NuGet v3 Service Index response
 		// This tells NuGet clients where to find various services
-		baseURL := fmt.Sprintf("%s://%s/api/v1/nuget",
-			c.Request.Header.Get("X-Forwarded-Proto"), c.Request.Host)
-		if baseURL[:4] != "http" {
-			if c.Request.TLS != nil {
-				baseURL = "https://" + c.Request.Host + "/api/v1/nuget"
-			} else {
-				baseURL = "http://" + c.Request.Host + "/api/v1/nuget"
-			}
-		}
+		baseURL := middleware.BaseURL(c) + "/api/v1/nuget"
 
 		serviceIndex := gin.H{
 			"version": "3.0.0",
@@ -190,19 +184,23 @@ func handleNuGetPackageVersions(registryService *registry.Service) gin.HandlerFu
 		ctx := context.WithValue(c.Request.Context(), "registry", "nuget")
 
 		filter := &types.ArtifactFilter{
-			Name:     packageID,
-			Registry: "nuget",
+			Name:      packageID,
+			Registry:  "nuget",
+			ExactName: true,
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, err := registryService.ListAll(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list packages"})
 			return
 		}
 
+		// Unlisted versions are left out but can still be downloaded
 		versions := make([]string, 0, len(artifacts))
 		for _, artifact := range artifacts {
-			versions = append(versions, artifact.Version)
+			if registry.IsListed(artifact) {
+				versions = append(versions, artifact.Version)
+			}
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -219,11 +217,14 @@ func handleNuGetPackageVersions(registryService *registry.Service) gin.HandlerFu
 // @Param id path string true "Package ID"
 // @Param version path string true "Package version"
 // @Param filename path string true "Package filename (typically {id}.{version}.nupkg)"
+// @Param Range header string false "Byte ranges to download (e.g., bytes=1024- or bytes=0-99,100-199); ranges that overlap or adjoin are served as one, others with the whole content"
 // @Router /api/v1/nuget/v3-flatcontainer/{id}/{version}/{filename} [get]
 // @Success 200 {file} file "NuGet package file (.nupkg)"
+// @Success 206 {file} file "Requested range of the package file"
 // @Failure 400 {object} types.APIResponse "Bad request - missing required parameters"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 404 {object} types.APIResponse "Package not found"
+// @Failure 416 "Range not satisfiable"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleNuGetDownload(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -238,24 +239,23 @@ func handleNuGetDownload(registryService *registry.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "nuget")
 
-		artifact, content, err := registryService.Download(ctx, "nuget", packageID, version)
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "nuget", packageID, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
 			return
 		}
 
-		c.Header("Content-Type", "application/zip")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-		if artifact.Size > 0 {
-			c.Header("Content-Length", strconv.FormatInt(artifact.Size, 10))
-		}
-
 		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
 			// Log error but don't send JSON response as headers are already sent
-			log.Error().Err(err).Msg("Failed to stream package content")
+			middleware.Logger(c).Error().Err(err).Msg("Failed to stream package content")
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
@@ -284,7 +284,7 @@ func handleNuGetUpload(registryService *registry.Service) gin.HandlerFunc {
 
 		// Log request details for debugging
 		contentType := c.GetHeader("Content-Type")
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("method", c.Request.Method).
 			Str("content_type", contentType).
 			Int64("content_length", c.Request.ContentLength).
@@ -301,8 +301,11 @@ func handleNuGetUpload(registryService *registry.Service) gin.HandlerFunc {
 		if strings.HasPrefix(contentType, "multipart/form-data") {
 			// Handle multipart form data (web uploads)
 			err := c.Request.ParseMultipartForm(32 << 20) // 32MB max
+			if requestTooLarge(c, err) {
+				return
+			}
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to parse multipart form")
+				middleware.Logger(c).Error().Err(err).Msg("Failed to parse multipart form")
 				c.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse multipart form", "details": err.Error()})
 				return
 			}
@@ -329,7 +332,7 @@ func handleNuGetUpload(registryService *registry.Service) gin.HandlerFunc {
 			}
 
 			if err != nil {
-				log.Error().Err(err).Msg("No package file found in upload")
+				middleware.Logger(c).Error().Err(err).Msg("No package file found in upload")
 				c.JSON(http.StatusBadRequest, gin.H{"error": "no package file found in upload"})
 				return
 			}
@@ -338,15 +341,18 @@ func handleNuGetUpload(registryService *registry.Service) gin.HandlerFunc {
 			filename = header.Filename
 			fileContent, err = io.ReadAll(file)
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to read package file content")
+				middleware.Logger(c).Error().Err(err).Msg("Failed to read package file content")
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read package file"})
 				return
 			}
 		} else {
 			// Handle raw binary upload (NuGet CLI)
 			fileContent, err = io.ReadAll(c.Request.Body)
+			if requestTooLarge(c, err) {
+				return
+			}
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to read request body")
+				middleware.Logger(c).Error().Err(err).Msg("Failed to read request body")
 				c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
 				return
 			}
@@ -356,7 +362,7 @@ func handleNuGetUpload(registryService *registry.Service) gin.HandlerFunc {
 			filename = "package.nupkg"
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("filename", filename).
 			Int("content_size", len(fileContent)).
 			Msg("Processing NuGet package")
@@ -370,12 +376,12 @@ func handleNuGetUpload(registryService *registry.Service) gin.HandlerFunc {
 		// Extract package name and version from .nupkg file contents
 		packageName, version, err := extractNuGetPackageInfo(fileContent)
 		if err != nil {
-			log.Error().Err(err).Str("filename", filename).Msg("Failed to extract package metadata from .nupkg file")
+			middleware.Logger(c).Error().Err(err).Str("filename", filename).Msg("Failed to extract package metadata from .nupkg file")
 			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid package format: %v", err)})
 			return
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("filename", filename).
 			Str("packageName", packageName).
 			Str("version", version).
@@ -385,31 +391,87 @@ func handleNuGetUpload(registryService *registry.Service) gin.HandlerFunc {
 		contentReader := bytes.NewReader(fileContent)
 
 		_, err = registryService.Upload(ctx, "nuget", packageName, version, contentReader, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+		status, ok := uploadStatus(c, err, http.StatusCreated)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
+		c.JSON(status, gin.H{
 			"message": "package uploaded successfully",
 		})
 	}
 }
 
-// @Summary Delete NuGet package
-// @Description Delete a specific version of a NuGet package from the registry
+// @Summary Unlist or relist NuGet package
+// @Description Unlist a version of a NuGet package (DELETE), hiding it from search and version listings, or list it again (POST). Unlisted versions stay downloadable by exact version.
 // @Tags NuGet
 // @Security BearerAuth
 // @Produce json
 // @Param id path string true "Package ID"
 // @Param version path string true "Package version"
 // @Router /api/v1/nuget/v2/package/{id}/{version} [delete]
-// @Success 200 {object} types.APIResponse "Package deleted successfully"
+// @Router /api/v1/nuget/v2/package/{id}/{version} [post]
+// @Success 200 {object} types.APIResponse "Package listing updated successfully"
 // @Failure 400 {object} types.APIResponse "Bad request - package ID and version required"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 403 {object} types.APIResponse "Forbidden - insufficient permissions"
 // @Failure 404 {object} types.APIResponse "Package not found"
 // @Failure 500 {object} types.APIResponse "Internal server error"
+func handleNuGetListing(registryService *registry.Service, listed bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		packageID := c.Param("id")
+		version := c.Param("version")
+
+		if packageID == "" || version == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "package ID and version required"})
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "nuget")
+		ctx = context.WithValue(ctx, "user_id", user.ID)
+
+		if _, err := registryService.SetListed(ctx, "nuget", packageID, version, listed, user.ID); err != nil {
+			switch {
+			case errors.Is(err, registry.ErrArtifactNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			case errors.Is(err, registry.ErrUnlistForbidden):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update package listing"})
+			}
+			return
+		}
+
+		message := "package unlisted successfully"
+		if listed {
+			message = "package relisted successfully"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": message,
+		})
+	}
+}
+
+// @Summary Delete NuGet package
+// @Description Delete a specific version of a NuGet package from the registry. Admin only; owners unlist versions instead.
+// @Tags NuGet
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Package ID"
+// @Param version path string true "Package version"
+// @Router /api/v1/nuget/v2/package/{id}/{version}/purge [delete]
+// @Success 200 {object} types.APIResponse "Package deleted successfully"
+// @Failure 400 {object} types.APIResponse "Bad request - package ID and version required"
+// @Failure 401 {object} types.APIResponse "Unauthorized"
+// @Failure 403 {object} types.APIResponse "Admin privileges required"
+// @Failure 404 {object} types.APIResponse "Package not found"
+// @Failure 500 {object} types.APIResponse "Internal server error"
 func handleNuGetDelete(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := middleware.GetUserFromContext(c)
@@ -430,6 +492,10 @@ func handleNuGetDelete(registryService *registry.Service) gin.HandlerFunc {
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 
 		err := registryService.Delete(ctx, "nuget", packageID, version, user.ID)
+		if errors.Is(err, registry.ErrArtifactNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete package"})
 			return
@@ -442,71 +508,214 @@ func handleNuGetDelete(registryService *registry.Service) gin.HandlerFunc {
 }
 
 // @Summary Search NuGet packages
-// @Description Search for NuGet packages in the registry with optional filtering
+// @Description Search for NuGet packages by id, title, description, tags and authors. Results are grouped by package id, showing the latest matching version of each, ordered by relevance.
 // @Tags NuGet
 // @Produce json
-// @Param q query string false "Search query (package name or keywords)"
+// @Param q query string false "Search terms, all of which must match"
 // @Param skip query int false "Number of results to skip (default: 0)"
 // @Param take query int false "Number of results to return (default: 20, max: 100)"
+// @Param prerelease query bool false "Include prerelease versions (default: false)"
 // @Router /api/v1/nuget/v3/search [get]
 // @Success 200 {object} map[string]interface{} "Search results with package list"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleNuGetSearch(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		query := c.Query("q")
-		skip := c.DefaultQuery("skip", "0")
-		take := c.DefaultQuery("take", "20")
-
-		skipInt, _ := strconv.Atoi(skip)
-		takeInt, _ := strconv.Atoi(take)
+		skip, err := strconv.Atoi(c.DefaultQuery("skip", "0"))
+		if err != nil || skip < 0 {
+			skip = 0
+		}
+		take, err := strconv.Atoi(c.DefaultQuery("take", "20"))
+		if err != nil || take < 1 {
+			take = 20
+		}
+		if take > maxNuGetSearchTake {
+			take = maxNuGetSearchTake
+		}
+		prerelease, _ := strconv.ParseBool(c.DefaultQuery("prerelease", "false"))
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "nuget")
 
-		filter := &types.ArtifactFilter{
+		// Packages are scored and paged by the database, so only the
+		// versions of the packages on this page are loaded
+		terms := strings.Fields(strings.ToLower(c.Query("q")))
+		page, totalHits, err := registryService.SearchPackages(ctx, &registry.PackageSearch{
 			Registry: "nuget",
-			Limit:    takeInt,
-			Offset:   skipInt,
-		}
-
-		if query != "" {
-			filter.Name = query // Simple name-based search for now
-		}
-
-		artifacts, _, err := registryService.List(ctx, filter)
+			Where:    nugetSearchConditions(terms, prerelease),
+			Score:    nugetSearchScore(terms),
+			Limit:    take,
+			Offset:   skip,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "search failed"})
 			return
 		}
 
+		packages := make([]*nugetSearchResult, 0, len(page))
+		for _, versions := range page {
+			packages = append(packages, newNuGetSearchResult(versions))
+		}
+
 		// Convert to NuGet search response format
-		results := make([]gin.H, 0, len(artifacts))
-		for _, artifact := range artifacts {
-			var description, author string
-			if artifact.Metadata != nil {
-				if desc, ok := artifact.Metadata["description"].(string); ok {
-					description = desc
-				}
-				if auth, ok := artifact.Metadata["author"].(string); ok {
-					author = auth
-				}
+		results := make([]gin.H, 0, len(packages))
+		for _, pkg := range packages {
+			latest := pkg.latest
+			versions := make([]gin.H, 0, len(pkg.versions))
+			for _, version := range pkg.versions {
+				versions = append(versions, gin.H{
+					"version":   version.Version,
+					"downloads": version.Downloads,
+				})
 			}
 
 			results = append(results, gin.H{
-				"id":             artifact.Name,
-				"version":        artifact.Version,
-				"description":    description,
-				"authors":        []string{author},
-				"totalDownloads": 0, // TODO: implement download counting
+				"id":             latest.Name,
+				"version":        latest.Version,
+				"title":          nugetMetadataString(latest.Metadata, "title"),
+				"description":    nugetMetadataString(latest.Metadata, "description"),
+				"summary":        nugetMetadataString(latest.Metadata, "summary"),
+				"authors":        nugetMetadataStrings(latest.Metadata, "authors"),
+				"tags":           nugetMetadataStrings(latest.Metadata, "tags"),
+				"totalDownloads": pkg.totalDownloads,
+				"versions":       versions,
 			})
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"totalHits": len(results),
+			"totalHits": totalHits,
 			"data":      results,
 		})
 	}
 }
 
+// maxNuGetSearchTake caps the page size a search client may request
+const maxNuGetSearchTake = 100
+
+// Relevance weights of a search term matching each part of a package
+const (
+	nugetScoreExactID     = 100
+	nugetScoreIDPrefix    = 40
+	nugetScoreID          = 20
+	nugetScoreTitle       = 10
+	nugetScoreTag         = 8
+	nugetScoreAuthor      = 5
+	nugetScoreDescription = 2
+)
+
+// nugetSearchResult is a package matching a search, with the versions that matched
+type nugetSearchResult struct {
+	latest         *types.Artifact
+	versions       []*types.Artifact
+	totalDownloads int64
+}
+
+// newNuGetSearchResult summarises the matching versions of a package,
+// listing them oldest first as nuget.org does
+func newNuGetSearchResult(versions []*types.Artifact) *nugetSearchResult {
+	result := &nugetSearchResult{versions: versions}
+	for _, version := range versions {
+		result.totalDownloads += version.Downloads
+		if result.latest == nil || nugetVersionNewer(version, result.latest) {
+			result.latest = version
+		}
+	}
+	sort.SliceStable(result.versions, func(i, j int) bool {
+		return nugetVersionNewer(result.versions[j], result.versions[i])
+	})
+	return result
+}
+
+// nugetSearchConditions returns the conditions a version meets to match a
+// search: it is listed, it is not a prerelease unless prerelease is set, and
+// every term matches its id, title, tags, authors or description. Versions
+// with a hyphen before any build metadata are taken to be prereleases.
+func nugetSearchConditions(terms []string, prerelease bool) []clause.Expr {
+	// Metadata booleans read back as 0 or 1 from SQLite's JSON
+	conditions := []clause.Expr{gorm.Expr("COALESCE(CAST(artifacts.metadata->>'listed' AS TEXT), '') NOT IN ('false', '0')")}
+	if !prerelease {
+		conditions = append(conditions, gorm.Expr("(artifacts.version NOT LIKE '%-%' OR artifacts.version LIKE '%+%-%' AND artifacts.version NOT LIKE '%-%+%')"))
+	}
+	for _, term := range terms {
+		conditions = append(conditions, gorm.Expr("? > 0", nugetTermScore(term)))
+	}
+	return conditions
+}
+
+// nugetSearchScore returns how relevant a version is to the search terms,
+// the sum of the weights of the parts of it each term matches
+func nugetSearchScore(terms []string) clause.Expr {
+	if len(terms) == 0 {
+		return clause.Expr{}
+	}
+	sql := make([]string, 0, len(terms))
+	vars := make([]interface{}, 0, len(terms))
+	for _, term := range terms {
+		sql = append(sql, "?")
+		vars = append(vars, nugetTermScore(term))
+	}
+	return gorm.Expr("("+strings.Join(sql, " + ")+")", vars...)
+}
+
+// nugetTermScore scores how relevant a version is to one lowercase search
+// term. Tags must equal the term, while the id, title, authors and
+// description need only contain it.
+func nugetTermScore(term string) clause.Expr {
+	contains := "%" + term + "%"
+	return gorm.Expr(`(CASE WHEN LOWER(artifacts.name) = ? THEN ? WHEN LOWER(artifacts.name) LIKE ? THEN ? WHEN LOWER(artifacts.name) LIKE ? THEN ? ELSE 0 END
+		+ CASE WHEN LOWER(COALESCE(artifacts.metadata->>'title', '')) LIKE ? THEN ? ELSE 0 END
+		+ CASE WHEN LOWER(COALESCE(artifacts.metadata->>'tags', '')) LIKE ? OR LOWER(COALESCE(artifacts.metadata->>'tags', '')) = ? THEN ? ELSE 0 END
+		+ CASE WHEN LOWER(COALESCE(artifacts.metadata->>'authors', '')) LIKE ? THEN ? ELSE 0 END
+		+ CASE WHEN LOWER(COALESCE(artifacts.metadata->>'description', '') || ' ' || COALESCE(artifacts.metadata->>'summary', '')) LIKE ? THEN ? ELSE 0 END)`,
+		term, nugetScoreExactID, term+"%", nugetScoreIDPrefix, contains, nugetScoreID,
+		contains, nugetScoreTitle,
+		`%"`+term+`"%`, term, nugetScoreTag,
+		contains, nugetScoreAuthor,
+		contains, nugetScoreDescription,
+	)
+}
+
+// nugetVersionNewer reports whether a is a newer version than b, falling
+// back to publish order for versions that are not semver
+func nugetVersionNewer(a, b *types.Artifact) bool {
+	switch utils.CompareVersions(a.Version, b.Version) {
+	case 1:
+		return true
+	case 2:
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return false
+}
+
+// nugetMetadataString reads a string field from package metadata
+func nugetMetadataString(metadata map[string]interface{}, key string) string {
+	value, _ := metadata[key].(string)
+	return value
+}
+
+// nugetMetadataStrings reads a list field from package metadata, which
+// holds a []string before storage and a []interface{} after
+func nugetMetadataStrings(metadata map[string]interface{}, key string) []string {
+	values := []string{}
+	switch list := metadata[key].(type) {
+	case []string:
+		for _, value := range list {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+	case []interface{}:
+		for _, item := range list {
+			if value, ok := item.(string); ok && strings.TrimSpace(value) != "" {
+				values = append(values, strings.TrimSpace(value))
+			}
+		}
+	case string:
+		if list = strings.TrimSpace(list); list != "" {
+			values = append(values, list)
+		}
+	}
+	return values
+}
+
 // @Summary Get package metadata
 // @Description Get detailed metadata and registration information for a NuGet package
 // @Tags NuGet
@@ -533,7 +742,7 @@ func handleNuGetPackageMetadata(registryService *registry.Service) gin.HandlerFu
 			Registry: "nuget",
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, err := registryService.ListAll(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get package metadata"})
 			return
@@ -546,15 +755,7 @@ func handleNuGetPackageMetadata(registryService *registry.Service) gin.HandlerFu
 
 		// Build NuGet registration response according to the official spec
 		// https://docs.microsoft.com/en-us/nuget/api/registration-base-url-resource
-		baseURL := fmt.Sprintf("%s://%s/api/v1/nuget",
-			c.Request.Header.Get("X-Forwarded-Proto"), c.Request.Host)
-		if baseURL[:4] != "http" {
-			if c.Request.TLS != nil {
-				baseURL = "https://" + c.Request.Host + "/api/v1/nuget"
-			} else {
-				baseURL = "http://" + c.Request.Host + "/api/v1/nuget"
-			}
-		}
+		baseURL := middleware.BaseURL(c) + "/api/v1/nuget"
 
 		catalogEntries := make([]gin.H, 0, len(artifacts))
 		for _, artifact := range artifacts {
@@ -586,6 +787,7 @@ func handleNuGetPackageMetadata(registryService *registry.Service) gin.HandlerFu
 					"id":          artifact.Name, // Use the original case-preserved name from the artifact
 					"version":     artifact.Version,
 					"published":   artifact.CreatedAt,
+					"listed":      registry.IsListed(artifact),
 					"packageContent": fmt.Sprintf("%s/v3-flatcontainer/%s/%s/%s.%s.nupkg",
 						baseURL, strings.ToLower(packageID), artifact.Version,
 						strings.ToLower(artifact.Name), artifact.Version),
@@ -643,7 +845,7 @@ func handleNuGetSymbolUpload(registryService *registry.Service) gin.HandlerFunc
 			return
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("method", c.Request.Method).
 			Str("content_type", c.GetHeader("Content-Type")).
 			Int64("content_length", c.Request.ContentLength).
@@ -656,40 +858,46 @@ func handleNuGetSymbolUpload(registryService *registry.Service) gin.HandlerFunc
 		contentType := c.GetHeader("Content-Type")
 		if strings.HasPrefix(contentType, "multipart/form-data") {
 			// Handle multipart form upload (web interface)
-			log.Info().Msg("Processing multipart form symbol upload")
+			middleware.Logger(c).Info().Msg("Processing multipart form symbol upload")
 			file, err := c.FormFile("package")
+			if requestTooLarge(c, err) {
+				return
+			}
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to get form file")
+				middleware.Logger(c).Error().Err(err).Msg("Failed to get form file")
 				c.JSON(http.StatusBadRequest, gin.H{"error": "no package file provided"})
 				return
 			}
 			filename = file.Filename
 			src, err := file.Open()
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to open uploaded file")
+				middleware.Logger(c).Error().Err(err).Msg("Failed to open uploaded file")
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to open uploaded file"})
 				return
 			}
 			defer src.Close()
 			content, err = io.ReadAll(src)
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to read uploaded file")
+				middleware.Logger(c).Error().Err(err).Msg("Failed to read uploaded file")
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read uploaded file"})
 				return
 			}
 		} else {
 			// Accept both application/octet-stream and other raw uploads (dotnet CLI)
-			log.Info().Msg("Processing raw binary symbol upload")
+			middleware.Logger(c).Info().Msg("Processing raw binary symbol upload")
 			content, err = io.ReadAll(c.Request.Body)
+			if requestTooLarge(c, err) {
+				return
+			}
 			if err != nil {
-				log.Error().Err(err).Msg("Failed to read request body")
+				middleware.Logger(c).Error().Err(err).Msg("Failed to read request body")
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read request body"})
 				return
 			}
 			filename = ""
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("filename", filename).
 			Int("content_size", len(content)).
 			Msg("Symbol package content processed")
@@ -697,7 +905,7 @@ func handleNuGetSymbolUpload(registryService *registry.Service) gin.HandlerFunc
 		// Always extract package name and version from content
 		packageName, version, err := extractSymbolPackageInfo(content)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to extract package info from symbol package")
+			middleware.Logger(c).Error().Err(err).Msg("Failed to extract package info from symbol package")
 			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to extract package information: %v", err)})
 			return
 		}
@@ -764,15 +972,18 @@ func handleNuGetSymbolUpload(registryService *registry.Service) gin.HandlerFunc
 // @Description Download a NuGet symbol package (.snupkg file) containing debugging symbols
 // @Tags NuGet
 // @Security BearerAuth
-// @Produce application/zip
+// @Produce application/vnd.nuget.symbolpackage
 // @Param id path string true "Package ID"
 // @Param version path string true "Package version"
 // @Param filename path string true "Symbol package filename (typically {id}.{version}.snupkg)"
+// @Param Range header string false "Byte ranges to download (e.g., bytes=1024- or bytes=0-99,100-199); ranges that overlap or adjoin are served as one, others with the whole content"
 // @Router /api/v1/nuget/symbols/{id}/{version}/{filename} [get]
 // @Success 200 {file} file "NuGet symbol package file (.snupkg)"
+// @Success 206 {file} file "Requested range of the symbol package file"
 // @Failure 400 {object} types.APIResponse "Bad request - not a symbol package file"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 404 {object} types.APIResponse "Symbol package not found"
+// @Failure 416 "Range not satisfiable"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 // handleNuGetSymbolDownload handles symbol package downloads
 func handleNuGetSymbolDownload(registryService *registry.Service) gin.HandlerFunc {
@@ -794,7 +1005,7 @@ func handleNuGetSymbolDownload(registryService *registry.Service) gin.HandlerFun
 			Registry: "nuget",
 		}
 
-		artifacts, _, err := registryService.List(c.Request.Context(), filter)
+		artifacts, err := registryService.ListAll(c.Request.Context(), filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search for symbol package"})
 			return
@@ -817,26 +1028,23 @@ func handleNuGetSymbolDownload(registryService *registry.Service) gin.HandlerFun
 		}
 
 		// Download the symbol package using the registry service to get proper metadata
-		_, content, err := registryService.Download(c.Request.Context(), "nuget", symbolArtifactName, version)
+		artifact, content, rng, err := downloadArtifact(c, c.Request.Context(), registryService, "nuget", symbolArtifactName, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "symbol package not found"})
 			return
 		}
 		defer content.Close()
 
-		// Set appropriate headers for symbol package download
-		c.Header("Content-Type", "application/vnd.nuget.symbolpackage")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-		// Set Content-Length from the artifact size
-		if symbolArtifact.Size > 0 {
-			c.Header("Content-Length", strconv.FormatInt(symbolArtifact.Size, 10))
-		}
-
-		// Stream the content
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
 			// Log error but don't send JSON response as headers are already sent
+			middleware.Logger(c).Error().Err(err).Msg("Failed to stream symbol package content")
 			c.AbortWithStatus(http.StatusInternalServerError)
 		}
 	}
@@ -846,7 +1054,7 @@ func handleNuGetSymbolDownload(registryService *registry.Service) gin.HandlerFun
 // by reading the ZIP file structure (symbol packages are ZIP files)
 func extractSymbolPackageFilename(content []byte) (string, error) {
 	// Read ZIP content to extract package information
-	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	reader, err := utils.NewZipReader(content)
 	if err != nil {
 		return "", fmt.Errorf("failed to read symbol package as ZIP: %w", err)
 	}
@@ -873,13 +1081,7 @@ func extractSymbolPackageFilename(content []byte) (string, error) {
 		for _, file := range reader.File {
 			if strings.HasSuffix(file.Name, ".nuspec") {
 				// Parse nuspec file
-				rc, err := file.Open()
-				if err != nil {
-					continue
-				}
-				defer rc.Close()
-
-				nuspecContent, err := io.ReadAll(rc)
+				nuspecContent, err := utils.ReadZipFile(file)
 				if err != nil {
 					continue
 				}
@@ -932,9 +1134,8 @@ func isValidVersion(version string) bool {
 
 // extractSymbolPackageInfo extracts package name and version from .snupkg file contents
 func extractSymbolPackageInfo(fileContent []byte) (string, string, error) {
-	// Create a byte reader for the zip content
-	reader := bytes.NewReader(fileContent)
-	zipReader, err := zip.NewReader(reader, int64(len(fileContent)))
+	// Open the zip archive
+	zipReader, err := utils.NewZipReader(fileContent)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to read snupkg as zip: %w", err)
 	}
@@ -944,14 +1145,8 @@ func extractSymbolPackageInfo(fileContent []byte) (string, string, error) {
 		if strings.HasSuffix(file.Name, ".nuspec") {
 			log.Info().Str("nuspec_file", file.Name).Msg("Found .nuspec file in symbol package")
 
-			rc, err := file.Open()
-			if err != nil {
-				return "", "", fmt.Errorf("failed to open nuspec file: %w", err)
-			}
-			defer rc.Close()
-
 			// Read and parse the .nuspec XML
-			nuspecContent, err := io.ReadAll(rc)
+			nuspecContent, err := utils.ReadZipFile(file)
 			if err != nil {
 				return "", "", fmt.Errorf("failed to read nuspec content: %w", err)
 			}
@@ -0,0 +1,288 @@
+package routes
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createNupkg builds a minimal .nupkg with the given searchable metadata
+func createNupkg(t *testing.T, id, version, description, tags, authors string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	nuspec, err := w.Create(id + ".nuspec")
+	require.NoError(t, err)
+	fmt.Fprintf(nuspec, `<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd">
+  <metadata>
+    <id>%s</id>
+    <version>%s</version>
+    <authors>%s</authors>
+    <description>%s</description>
+    <tags>%s</tags>
+  </metadata>
+</package>`, id, version, authors, description, tags)
+
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+type nugetSearchResponse struct {
+	TotalHits int `json:"totalHits"`
+	Data      []struct {
+		ID             string   `json:"id"`
+		Version        string   `json:"version"`
+		Authors        []string `json:"authors"`
+		Tags           []string `json:"tags"`
+		TotalDownloads int64    `json:"totalDownloads"`
+		Versions       []struct {
+			Version   string `json:"version"`
+			Downloads int64  `json:"downloads"`
+		} `json:"versions"`
+	} `json:"data"`
+}
+
+func TestHandleNuGetSearch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	packages := []struct {
+		id, version, description, tags, authors string
+		downloads                               int64
+	}{
+		{"Contoso.Json", "1.0.0", "Fast serializer", "json serialization", "Contoso", 10},
+		{"Contoso.Json", "1.2.0", "Fast serializer", "json serialization", "Contoso", 5},
+		{"Contoso.Json", "2.0.0-beta.1", "Fast serializer", "json serialization", "Contoso", 1},
+		{"Fabrikam.Logging", "3.1.0", "Structured logging with json output", "logging", "Fabrikam", 100},
+		{"Tailspin.Preview", "0.1.0-alpha", "Experimental json tools", "json", "Tailspin", 0},
+	}
+	for _, pkg := range packages {
+		content := createNupkg(t, pkg.id, pkg.version, pkg.description, pkg.tags, pkg.authors)
+		artifact, err := registryService.Upload(context.Background(), "nuget", pkg.id, pkg.version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+		require.NoError(t, registryService.DB.Model(&types.Artifact{}).Where("id = ?", artifact.ID).Update("downloads", pkg.downloads).Error)
+	}
+
+	router := gin.New()
+	router.GET("/nuget/v3/search", handleNuGetSearch(registryService))
+
+	search := func(query string) nugetSearchResponse {
+		req := httptest.NewRequest("GET", "/nuget/v3/search"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response nugetSearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	ids := func(response nugetSearchResponse) []string {
+		result := make([]string, 0, len(response.Data))
+		for _, pkg := range response.Data {
+			result = append(result, pkg.ID+"@"+pkg.Version)
+		}
+		return result
+	}
+
+	t.Run("groups versions by package", func(t *testing.T) {
+		response := search("?q=json")
+		// The id match outranks matches in the description only
+		assert.Equal(t, []string{"Contoso.Json@1.2.0", "Fabrikam.Logging@3.1.0"}, ids(response))
+		assert.Equal(t, 2, response.TotalHits)
+
+		contoso := response.Data[0]
+		assert.Equal(t, int64(15), contoso.TotalDownloads)
+		assert.Equal(t, []string{"Contoso"}, contoso.Authors)
+		assert.Equal(t, []string{"json", "serialization"}, contoso.Tags)
+		require.Len(t, contoso.Versions, 2)
+		assert.Equal(t, "1.0.0", contoso.Versions[0].Version, "versions are listed oldest first")
+		assert.Equal(t, "1.2.0", contoso.Versions[1].Version)
+		assert.Equal(t, int64(5), contoso.Versions[1].Downloads)
+	})
+
+	t.Run("includes prereleases on request", func(t *testing.T) {
+		response := search("?q=json&prerelease=true")
+		assert.Equal(t, []string{"Contoso.Json@2.0.0-beta.1", "Tailspin.Preview@0.1.0-alpha", "Fabrikam.Logging@3.1.0"}, ids(response))
+		assert.Len(t, response.Data[0].Versions, 3)
+	})
+
+	t.Run("matches tags and authors", func(t *testing.T) {
+		assert.Equal(t, []string{"Fabrikam.Logging@3.1.0"}, ids(search("?q=logging")))
+		assert.Equal(t, []string{"Fabrikam.Logging@3.1.0"}, ids(search("?q=fabrikam")))
+		assert.Equal(t, []string{"Contoso.Json@1.2.0"}, ids(search("?q=json+serialization")))
+		assert.Empty(t, ids(search("?q=nothing")))
+	})
+
+	t.Run("paginates packages", func(t *testing.T) {
+		all := search("")
+		assert.Equal(t, []string{"Fabrikam.Logging@3.1.0", "Contoso.Json@1.2.0"}, ids(all), "without terms packages are ordered by downloads")
+
+		page := search("?skip=1&take=1")
+		assert.Equal(t, []string{"Contoso.Json@1.2.0"}, ids(page))
+		assert.Equal(t, 2, page.TotalHits)
+	})
+}
+
+func TestNuGetUnlist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		content := createNupkg(t, "Contoso.Json", version, "Fast serializer", "json", "Contoso")
+		_, err := registryService.Upload(context.Background(), "nuget", "Contoso.Json", version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, registryService.DB.Create(admin).Error)
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(other).Error)
+
+	actor := user
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", actor)
+		c.Next()
+	})
+	router.GET("/nuget/v3/search", handleNuGetSearch(registryService))
+	router.GET("/nuget/v3-flatcontainer/:id/index.json", handleNuGetPackageVersions(registryService))
+	router.GET("/nuget/v3-flatcontainer/:id/:version/:filename", handleNuGetDownload(registryService))
+	router.DELETE("/nuget/v2/package/:id/:version", handleNuGetListing(registryService, false))
+	router.POST("/nuget/v2/package/:id/:version", handleNuGetListing(registryService, true))
+	router.DELETE("/nuget/v2/package/:id/:version/purge", adminOnlyMiddleware(), handleNuGetDelete(registryService))
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	listed := func() []string {
+		w := serve("GET", "/nuget/v3-flatcontainer/contoso.json/index.json")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Versions []string `json:"versions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Versions
+	}
+	searched := func() []string {
+		w := serve("GET", "/nuget/v3/search?q=contoso")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response nugetSearchResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		var versions []string
+		for _, pkg := range response.Data {
+			for _, version := range pkg.Versions {
+				versions = append(versions, version.Version)
+			}
+		}
+		return versions
+	}
+
+	// Only owners can unlist
+	actor = other
+	assert.Equal(t, http.StatusForbidden, serve("DELETE", "/nuget/v2/package/Contoso.Json/1.1.0").Code)
+	actor = user
+	assert.Equal(t, http.StatusNotFound, serve("DELETE", "/nuget/v2/package/Contoso.Json/9.9.9").Code)
+
+	// Deleting unlists the version, hiding it from search and listings
+	w := serve("DELETE", "/nuget/v2/package/Contoso.Json/1.1.0")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"1.0.0"}, listed())
+	assert.Equal(t, []string{"1.0.0"}, searched())
+
+	// Restores that pinned the version can still download it
+	w = serve("GET", "/nuget/v3-flatcontainer/contoso.json/1.1.0/contoso.json.1.1.0.nupkg")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Body.Bytes())
+
+	w = serve("POST", "/nuget/v2/package/Contoso.Json/1.1.0")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.ElementsMatch(t, []string{"1.0.0", "1.1.0"}, listed())
+	assert.Equal(t, []string{"1.0.0", "1.1.0"}, searched())
+
+	// Only admins can remove a version outright
+	assert.Equal(t, http.StatusForbidden, serve("DELETE", "/nuget/v2/package/Contoso.Json/1.1.0/purge").Code)
+	actor = admin
+	w = serve("DELETE", "/nuget/v2/package/Contoso.Json/1.1.0/purge")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"1.0.0"}, listed())
+	assert.Equal(t, http.StatusNotFound, serve("GET", "/nuget/v3-flatcontainer/contoso.json/1.1.0/contoso.json.1.1.0.nupkg").Code)
+}
+
+func TestNuGetServiceIndex_ForwardedHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	_, err := registryService.Upload(context.Background(), "npm", "left-pad", "1.0.0",
+		bytes.NewReader(createNpmTarball(t, `{"name":"left-pad","version":"1.0.0"}`, nil)), user.ID)
+	require.NoError(t, err)
+
+	trusted, err := middleware.ParseTrustedProxies([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+	router := gin.New()
+	router.Use(middleware.ForwardedHeaders(trusted))
+	router.GET("/api/v1/nuget/v3/index.json", handleNuGetServiceIndex())
+	router.GET("/api/v1/npm/:name", handleNPMPackageInfo(registryService))
+
+	get := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "http://registry.internal"+path, nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "registry.example.com")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		return w
+	}
+	resources := func(remoteAddr string) []string {
+		var index struct {
+			Resources []struct {
+				ID string `json:"@id"`
+			} `json:"resources"`
+		}
+		require.NoError(t, json.Unmarshal(get("/api/v1/nuget/v3/index.json", remoteAddr).Body.Bytes(), &index))
+		ids := make([]string, 0, len(index.Resources))
+		for _, resource := range index.Resources {
+			ids = append(ids, resource.ID)
+		}
+		require.NotEmpty(t, ids)
+		return ids
+	}
+	tarball := func(remoteAddr string) string {
+		var document struct {
+			Versions map[string]struct {
+				Dist struct {
+					Tarball string `json:"tarball"`
+				} `json:"dist"`
+			} `json:"versions"`
+		}
+		require.NoError(t, json.Unmarshal(get("/api/v1/npm/left-pad", remoteAddr).Body.Bytes(), &document))
+		return document.Versions["1.0.0"].Dist.Tarball
+	}
+
+	// Behind a trusted proxy, URLs point where clients reach the gateway
+	for _, id := range resources("10.0.0.5:1234") {
+		assert.Contains(t, id, "https://registry.example.com/api/v1/nuget")
+	}
+	assert.Equal(t, "https://registry.example.com/api/v1/npm/left-pad/-/left-pad-1.0.0.tgz", tarball("10.0.0.5:1234"))
+
+	// Forwarded headers sent by anyone else are ignored
+	for _, id := range resources("203.0.113.7:1234") {
+		assert.Contains(t, id, "http://registry.internal/api/v1/nuget")
+	}
+	assert.Equal(t, "http://registry.internal/api/v1/npm/left-pad/-/left-pad-1.0.0.tgz", tarball("203.0.113.7:1234"))
+}
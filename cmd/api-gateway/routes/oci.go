@@ -1,11 +1,18 @@
 package routes
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,10 +21,13 @@ import (
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
 	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/internal/storage"
 	"github.com/lgulliver/lodestone/pkg/types"
-	"github.com/rs/zerolog/log"
 )
 
+// ociDigestRegex matches the sha256 digests manifests are addressed by
+var ociDigestRegex = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
 // Custom context key types to avoid collisions
 type contextKey string
 
@@ -31,6 +41,8 @@ const (
 // OCIRoutes sets up OCI (Docker) registry routes
 func OCIRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	oci := api.Group("/v2")
+	oci.Use(middleware.RegistryValidationMiddleware(registryService.Settings))
+	oci.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("oci")))
 
 	// Docker authentication endpoints
 	oci.GET("/auth", handleDockerAuth(authService))
@@ -41,34 +53,55 @@ func OCIRoutes(api *gin.RouterGroup, registryService *registry.Service, authServ
 	// Note: Base endpoint (/v2/) is handled by OCIRootRoutes catch-all handler
 
 	// Image manifest operations - requires authentication
-	oci.GET("/:name/manifests/:reference", middleware.AuthMiddleware(authService), handleOCIManifestGet(registryService))
-	oci.PUT("/:name/manifests/:reference", middleware.AuthMiddleware(authService), handleOCIManifestPut(registryService))
-	oci.DELETE("/:name/manifests/:reference", middleware.AuthMiddleware(authService), handleOCIManifestDelete(registryService))
-	oci.HEAD("/:name/manifests/:reference", middleware.AuthMiddleware(authService), handleOCIManifestHead(registryService))
+	oci.GET("/:name/manifests/:reference", middleware.OCIAuthMiddleware(authService), requireOCIAccess("pull"), handleOCIManifestGet(registryService))
+	oci.PUT("/:name/manifests/:reference", middleware.OCIAuthMiddleware(authService), requireOCIAccess("push"), handleOCIManifestPut(registryService))
+	oci.DELETE("/:name/manifests/:reference", middleware.OCIAuthMiddleware(authService), requireOCIAccess("delete"), handleOCIManifestDelete(registryService))
+	oci.HEAD("/:name/manifests/:reference", middleware.OCIAuthMiddleware(authService), requireOCIAccess("pull"), handleOCIManifestHead(registryService))
 
 	// Blob operations - requires authentication
-	oci.GET("/:name/blobs/:digest", middleware.AuthMiddleware(authService), handleOCIBlobGet(registryService))
-	oci.HEAD("/:name/blobs/:digest", middleware.AuthMiddleware(authService), handleOCIBlobHead(registryService))
-	oci.DELETE("/:name/blobs/:digest", middleware.AuthMiddleware(authService), handleOCIBlobDelete(registryService))
+	oci.GET("/:name/blobs/:digest", middleware.OCIAuthMiddleware(authService), requireOCIAccess("pull"), handleOCIBlobGet(registryService))
+	oci.HEAD("/:name/blobs/:digest", middleware.OCIAuthMiddleware(authService), requireOCIAccess("pull"), handleOCIBlobHead(registryService))
+	oci.DELETE("/:name/blobs/:digest", middleware.OCIAuthMiddleware(authService), requireOCIAccess("delete"), handleOCIBlobDelete(registryService))
 
 	// Blob upload operations
-	oci.POST("/:name/blobs/uploads/", middleware.AuthMiddleware(authService), handleOCIBlobUploadStart(registryService))
-	oci.PATCH("/:name/blobs/uploads/:uuid", middleware.AuthMiddleware(authService), handleOCIBlobUploadChunk(registryService))
-	oci.PUT("/:name/blobs/uploads/:uuid", middleware.AuthMiddleware(authService), handleOCIBlobUploadComplete(registryService))
-	oci.DELETE("/:name/blobs/uploads/:uuid", middleware.AuthMiddleware(authService), handleOCIBlobUploadCancel(registryService))
-	oci.GET("/:name/blobs/uploads/:uuid", middleware.AuthMiddleware(authService), handleOCIBlobUploadStatus(registryService))
+	oci.POST("/:name/blobs/uploads/", middleware.OCIAuthMiddleware(authService), requireOCIAccess("push"), handleOCIBlobUploadStart(registryService))
+	oci.PATCH("/:name/blobs/uploads/:uuid", middleware.OCIAuthMiddleware(authService), requireOCIAccess("push"), handleOCIBlobUploadChunk(registryService))
+	oci.PUT("/:name/blobs/uploads/:uuid", middleware.OCIAuthMiddleware(authService), requireOCIAccess("push"), handleOCIBlobUploadComplete(registryService))
+	oci.DELETE("/:name/blobs/uploads/:uuid", middleware.OCIAuthMiddleware(authService), requireOCIAccess("push"), handleOCIBlobUploadCancel(registryService))
+	oci.GET("/:name/blobs/uploads/:uuid", middleware.OCIAuthMiddleware(authService), requireOCIAccess("push"), handleOCIBlobUploadStatus(registryService))
+
+	// Referrers of a manifest, such as signatures and SBOMs - requires authentication
+	oci.GET("/:name/referrers/:digest", middleware.OCIAuthMiddleware(authService), requireOCIAccess("pull"), handleOCIReferrers(registryService))
 
 	// Tag listing - requires authentication
-	oci.GET("/:name/tags/list", middleware.AuthMiddleware(authService), handleOCITagsList(registryService))
+	oci.GET("/:name/tags/list", middleware.OCIAuthMiddleware(authService), requireOCIAccess("pull"), handleOCITagsList(registryService))
 
 	// Catalog (repository listing) - requires authentication
-	oci.GET("/_catalog", middleware.AuthMiddleware(authService), handleOCICatalog(registryService))
+	oci.GET("/_catalog", middleware.OCIAuthMiddleware(authService), requireOCICatalogAccess(), handleOCICatalog(registryService))
+}
+
+// OCIPublishRequest reports whether a request publishes or deletes OCI
+// content. A push is counted once, when its manifest is put, rather than for
+// each of the many blob upload requests it makes.
+func OCIPublishRequest(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	switch c.Request.Method {
+	case http.MethodPut:
+		return strings.Contains(path, "/manifests/")
+	case http.MethodDelete:
+		return !strings.Contains(path, "/blobs/uploads/")
+	default:
+		return false
+	}
 }
 
 // OCIRootRoutes sets up OCI (Docker) registry routes at root level for Docker CLI compatibility
-func OCIRootRoutes(router *gin.Engine, registryService *registry.Service, authService *auth.Service) {
+func OCIRootRoutes(router gin.IRoutes, registryService *registry.Service, authService *auth.Service) {
 	// Use a catch-all route for all OCI operations including the base endpoint
-	router.Any("/v2/*path", handleOCIRequest(registryService, authService))
+	router.Any("/v2/*path",
+		middleware.RegistryValidationMiddleware(registryService.Settings),
+		middleware.MaxUploadSize(registryService.MaxUploadSize("oci")),
+		handleOCIRequest(registryService, authService))
 }
 
 // Helper function to extract repository name from wildcard parameter
@@ -78,6 +111,121 @@ func extractRepositoryName(c *gin.Context) string {
 	return strings.TrimPrefix(name, "/")
 }
 
+// writeOCIError writes an error response in the distribution spec error format
+func writeOCIError(c *gin.Context, status int, code, message string) {
+	c.JSON(status, gin.H{
+		"errors": []gin.H{
+			{
+				"code":    code,
+				"message": message,
+			},
+		},
+	})
+}
+
+// ociMethodAction returns the registry token action a request method needs
+func ociMethodAction(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return "pull"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return "push"
+	}
+}
+
+// ociTokenRealm returns the URL of the token endpoint clients should request
+// a new registry token from
+func ociTokenRealm(c *gin.Context) string {
+	return middleware.BaseURL(c) + "/v2/token"
+}
+
+// hasOCIAccess reports whether the request's credentials allow action on the
+// resource. Credentials without scopes, such as API keys, are not limited.
+func hasOCIAccess(c *gin.Context, resourceType, name, action string) bool {
+	access, scoped := middleware.RegistryAccess(c)
+	if !scoped {
+		return true
+	}
+	for _, grant := range access {
+		if grant.Allows(resourceType, name, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeOCIAccess rejects requests authenticated by a registry token that
+// does not grant action on the resource, challenging the client to request a
+// token with the missing scope, and requests by API keys not scoped for the
+// repository
+func authorizeOCIAccess(c *gin.Context, resourceType, name, action string) bool {
+	// Catch-all routes only name the repository here, after authentication
+	if resourceType == "repository" {
+		if err := auth.CheckAPIKeyScope(c.Request.Context(), "oci", name); err != nil {
+			writeOCIError(c, http.StatusForbidden, "DENIED", err.Error())
+			return false
+		}
+	}
+	if hasOCIAccess(c, resourceType, name, action) {
+		return true
+	}
+
+	scope := auth.RegistryAccess{Type: resourceType, Name: name, Actions: []string{action}}
+	c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="%s",scope="%s",error="insufficient_scope"`,
+		ociTokenRealm(c), auth.RegistryTokenAudience, scope))
+	writeOCIError(c, http.StatusUnauthorized, "UNAUTHORIZED", fmt.Sprintf("token does not grant %s access to %s", action, name))
+	return false
+}
+
+// requireOCIAccess rejects requests whose registry token does not grant
+// action on the repository named in the route
+func requireOCIAccess(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authorizeOCIAccess(c, "repository", extractRepositoryName(c), action) {
+			c.Abort()
+		}
+	}
+}
+
+// requireOCICatalogAccess rejects requests whose registry token does not
+// grant access to the repository catalog
+func requireOCICatalogAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authorizeOCIAccess(c, "registry", "catalog", "*") {
+			c.Abort()
+		}
+	}
+}
+
+// validateOCIRepositoryName rejects repository names that the registry's
+// name validation mode does not accept, responding with NAME_INVALID
+func validateOCIRepositoryName(c *gin.Context, ociRegistry *oci.Registry, name string) bool {
+	if err := ociRegistry.ValidateRepositoryName(name); err != nil {
+		writeOCIError(c, http.StatusBadRequest, "NAME_INVALID", err.Error())
+		return false
+	}
+	return true
+}
+
+// readableOCIRepository answers NAME_UNKNOWN, as for a repository that does
+// not exist, unless the request can read the repository, so private
+// repositories are neither served nor revealed to users who cannot read them
+func readableOCIRepository(c *gin.Context, registryService *registry.Service, name string) bool {
+	readable, err := registryService.CanReadPackage(c.Request.Context(), "oci", name)
+	if err != nil {
+		middleware.Logger(c).Error().Err(err).Str("repository", name).Msg("Failed to check repository read access")
+		writeOCIError(c, http.StatusInternalServerError, "UNKNOWN", "failed to check repository access")
+		return false
+	}
+	if !readable {
+		writeOCIError(c, http.StatusNotFound, "NAME_UNKNOWN", fmt.Sprintf("repository %s not found", name))
+		return false
+	}
+	return true
+}
+
 // @Summary OCI Registry Base Endpoint
 // @Description Docker Registry API v2 base endpoint - returns API version information
 // @Tags OCI/Docker
@@ -94,17 +242,19 @@ func handleOCIBase() gin.HandlerFunc {
 }
 
 // @Summary Get Image Manifest
-// @Description Retrieve a Docker/OCI image manifest by name and reference (tag or digest)
+// @Description Retrieve a Docker/OCI image manifest by name and reference (tag or digest). An image index is replaced by its linux/amd64 image, or its first image of an accepted type, for clients whose Accept header does not accept indexes
 // @Tags OCI/Docker
 // @Security BearerAuth
-// @Produce application/vnd.docker.distribution.manifest.v2+json,application/vnd.oci.image.manifest.v1+json
+// @Produce application/vnd.docker.distribution.manifest.v2+json,application/vnd.oci.image.manifest.v1+json,application/vnd.docker.distribution.manifest.list.v2+json,application/vnd.oci.image.index.v1+json
 // @Param name path string true "Repository name (e.g., library/nginx, myorg/myapp)"
 // @Param reference path string true "Image reference - tag (e.g., latest, v1.0) or digest (sha256:...)"
+// @Param Accept header string false "Manifest media types the client accepts"
 // @Router /v2/{name}/manifests/{reference} [get]
 // @Success 200 {object} map[string]interface{} "Image manifest"
 // @Failure 400 {object} types.APIResponse "Bad request - repository name and reference required"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 404 {object} types.APIResponse "Manifest not found"
+// @Failure 406 {object} object{errors=[]object} "The manifest's media type is not accepted"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCIManifestGet(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -129,8 +279,12 @@ func handleOCIManifestGet(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
+		if !validateOCIRepositoryName(c, ociRegistry, name) || !readableOCIRepository(c, registryService, name) {
+			return
+		}
+
 		// Get manifest using enhanced method
-		manifest, digest, size, err := ociRegistry.GetManifest(c.Request.Context(), name, reference)
+		manifest, digest, _, err := ociRegistry.GetManifest(c.Request.Context(), name, reference)
 		if err != nil {
 			if strings.Contains(err.Error(), "not found") {
 				c.JSON(http.StatusNotFound, gin.H{"error": "manifest not found"})
@@ -148,26 +302,25 @@ func handleOCIManifestGet(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		// Parse manifest to detect media type
-		var manifestObj map[string]interface{}
-		if err := json.Unmarshal(manifestContent, &manifestObj); err != nil {
+		if !json.Valid(manifestContent) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid manifest format"})
 			return
 		}
 
-		// Determine content type based on manifest mediaType
-		contentType := "application/vnd.docker.distribution.manifest.v2+json" // default
-		if mediaType, ok := manifestObj["mediaType"].(string); ok {
-			contentType = mediaType
+		// Indexes are served as they are so clients can select their platform,
+		// unless the client does not accept them
+		manifestContent, digest, contentType, ok := negotiateOCIManifest(c, ociRegistry, name, manifestContent, digest)
+		if !ok {
+			return
 		}
 
 		c.Header("Content-Type", contentType)
 		c.Header("Docker-Content-Digest", digest)
-		c.Header("Content-Length", fmt.Sprintf("%d", size))
+		c.Header("Content-Length", fmt.Sprintf("%d", len(manifestContent)))
 
 		c.Data(http.StatusOK, contentType, manifestContent)
 
-		log.Debug().
+		middleware.Logger(c).Debug().
 			Str("repository", name).
 			Str("reference", reference).
 			Str("digest", digest).
@@ -179,14 +332,16 @@ func handleOCIManifestGet(registryService *registry.Service) gin.HandlerFunc {
 // @Description Upload a Docker/OCI image manifest to the registry
 // @Tags OCI/Docker
 // @Security BearerAuth
-// @Accept application/vnd.docker.distribution.manifest.v2+json,application/vnd.oci.image.manifest.v1+json
+// @Accept application/vnd.docker.distribution.manifest.v2+json,application/vnd.oci.image.manifest.v1+json,application/vnd.docker.distribution.manifest.list.v2+json,application/vnd.oci.image.index.v1+json
 // @Param name path string true "Repository name (e.g., library/nginx, myorg/myapp)"
 // @Param reference path string true "Image reference - tag (e.g., latest, v1.0) or digest (sha256:...)"
 // @Param manifest body object true "Image manifest JSON"
 // @Router /v2/{name}/manifests/{reference} [put]
 // @Success 201 "Manifest uploaded successfully"
-// @Failure 400 {object} types.APIResponse "Bad request - repository name and reference required"
+// @Failure 400 {object} types.APIResponse "Bad request - invalid manifest, content not matching a digest reference, or one referring to manifests or blobs not pushed yet"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
+// @Failure 403 {object} types.APIResponse "Denied - tag is immutable and already exists, or the user may not publish to the repository"
+// @Failure 413 {object} types.APIResponse "Denied - the manifest would exceed the user's quota"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCIManifestPut(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -217,32 +372,89 @@ func handleOCIManifestPut(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
+		if !validateOCIRepositoryName(c, ociRegistry, name) {
+			return
+		}
+
+		manifest, err := io.ReadAll(c.Request.Body)
+		if requestTooLarge(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read manifest"})
+			return
+		}
+
 		contentType := c.GetHeader("Content-Type")
 		if contentType == "" {
-			contentType = "application/vnd.docker.distribution.manifest.v2+json"
+			contentType = oci.ManifestMediaType(manifest)
+		}
+
+		// Tags on registries requiring signatures may only point at signed manifests
+		if err := registryService.VerifyManifestSignature(c.Request.Context(), name, reference, manifest); err != nil {
+			if errors.Is(err, registry.ErrSignatureRequired) || errors.Is(err, registry.ErrSignatureInvalid) {
+				writeOCIError(c, http.StatusForbidden, "DENIED", err.Error())
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to verify manifest signature: %v", err)})
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), registryKey, "oci")
+		ctx = context.WithValue(ctx, userIDKey, user.ID)
+
+		// The checks Upload makes are run before anything is stored, so a
+		// manifest over quota or without permission is refused outright
+		if err := registryService.CheckPublish(ctx, "oci", name, reference, int64(len(manifest)), user.ID); err != nil {
+			writeOCIPublishError(c, err)
+			return
 		}
 
 		// Store manifest using enhanced method
-		digest, err := ociRegistry.PutManifest(c.Request.Context(), name, reference, c.Request.Body, contentType)
+		digest, err := ociRegistry.PutManifest(c.Request.Context(), name, reference, bytes.NewReader(manifest), contentType)
 		if err != nil {
+			if errors.Is(err, oci.ErrTagImmutable) {
+				writeOCIError(c, http.StatusForbidden, "DENIED", err.Error())
+				return
+			}
+			if errors.Is(err, oci.ErrManifestInvalid) {
+				writeOCIError(c, http.StatusBadRequest, "MANIFEST_INVALID", err.Error())
+				return
+			}
+			if errors.Is(err, oci.ErrManifestBlobUnknown) {
+				writeOCIError(c, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", err.Error())
+				return
+			}
+			if errors.Is(err, oci.ErrManifestDigestMismatch) {
+				writeOCIError(c, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to store manifest: %v", err)})
 			return
 		}
 
 		// Create artifact record in database
-		ctx := context.WithValue(c.Request.Context(), registryKey, "oci")
-		ctx = context.WithValue(ctx, userIDKey, user.ID)
-
 		_, err = registryService.Upload(ctx, "oci", name, reference, strings.NewReader(""), user.ID)
 		if err != nil {
-			log.Warn().Err(err).Str("repository", name).Str("reference", reference).Msg("Failed to create artifact record")
+			middleware.Logger(c).Warn().Err(err).Str("repository", name).Str("reference", reference).Msg("Failed to create artifact record")
+		}
+
+		// Charts pushed with helm push are also served from the Helm chart repository
+		if chart, err := registryService.PublishOCIHelmChart(ctx, name, manifest, user.ID); err != nil {
+			middleware.Logger(c).Warn().Err(err).Str("repository", name).Str("reference", reference).Msg("Failed to publish Helm chart to chart repository")
+		} else if chart != nil {
+			middleware.Logger(c).Info().Str("repository", name).Str("chart", chart.Name).Str("version", chart.Version).Msg("Published Helm chart to chart repository")
 		}
 
 		c.Header("Location", fmt.Sprintf("/v2/%s/manifests/%s", name, reference))
 		c.Header("Docker-Content-Digest", digest)
+		// Tells clients the referrers API indexed the manifest's subject
+		if subject := oci.ManifestSubject(manifest); subject != "" {
+			c.Header("OCI-Subject", subject)
+		}
 		c.Status(http.StatusCreated)
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("repository", name).
 			Str("reference", reference).
 			Str("digest", digest).
@@ -286,6 +498,10 @@ func handleOCIManifestDelete(registryService *registry.Service) gin.HandlerFunc
 			return
 		}
 
+		if !validateOCIRepositoryName(c, ociRegistry, name) {
+			return
+		}
+
 		// Check if manifest exists first
 		manifestExists, _, _, _, err := ociRegistry.ManifestExists(c.Request.Context(), name, reference)
 		if err != nil {
@@ -311,12 +527,12 @@ func handleOCIManifestDelete(registryService *registry.Service) gin.HandlerFunc
 
 		err = registryService.Delete(ctx, "oci", name, reference, user.ID)
 		if err != nil {
-			log.Warn().Err(err).Str("repository", name).Str("reference", reference).Msg("Failed to delete artifact record from database")
+			middleware.Logger(c).Warn().Err(err).Str("repository", name).Str("reference", reference).Msg("Failed to delete artifact record from database")
 		}
 
 		c.Status(http.StatusAccepted)
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("repository", name).
 			Str("reference", reference).
 			Str("user_id", user.ID.String()).
@@ -330,10 +546,12 @@ func handleOCIManifestDelete(registryService *registry.Service) gin.HandlerFunc
 // @Security BearerAuth
 // @Param name path string true "Repository name (e.g., library/nginx, myorg/myapp)"
 // @Param reference path string true "Image reference - tag (e.g., latest, v1.0) or digest (sha256:...)"
+// @Param Accept header string false "Manifest media types the client accepts"
 // @Router /v2/{name}/manifests/{reference} [head]
 // @Success 200 "Manifest exists"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 404 "Manifest not found"
+// @Failure 406 "The manifest's media type is not accepted"
 // @Failure 500 "Internal server error"
 func handleOCIManifestHead(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -353,6 +571,14 @@ func handleOCIManifestHead(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
+		if err := ociRegistry.ValidateRepositoryName(name); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		if !readableOCIRepository(c, registryService, name) {
+			return
+		}
+
 		// Check if manifest exists
 		exists, digest, size, mediaType, err := ociRegistry.ManifestExists(c.Request.Context(), name, reference)
 		if err != nil {
@@ -365,12 +591,34 @@ func handleOCIManifestHead(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
+		// Answer with the manifest a GET would serve for the Accept header
+		c.Header("Vary", "Accept")
+		if !ociManifestAccepts(c, mediaType) {
+			manifest, _, _, err := ociRegistry.GetManifest(c.Request.Context(), name, reference)
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+			manifestContent, err := io.ReadAll(manifest)
+			manifest.Close()
+			if err != nil {
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+
+			manifestContent, digest, mediaType, ok = negotiateOCIManifest(c, ociRegistry, name, manifestContent, digest)
+			if !ok {
+				return
+			}
+			size = int64(len(manifestContent))
+		}
+
 		c.Header("Content-Type", mediaType)
 		c.Header("Docker-Content-Digest", digest)
 		c.Header("Content-Length", fmt.Sprintf("%d", size))
 		c.Status(http.StatusOK)
 
-		log.Debug().
+		middleware.Logger(c).Debug().
 			Str("repository", name).
 			Str("reference", reference).
 			Str("digest", digest).
@@ -386,11 +634,14 @@ func handleOCIManifestHead(registryService *registry.Service) gin.HandlerFunc {
 // @Produce application/octet-stream
 // @Param name path string true "Repository name (e.g., library/nginx, myorg/myapp)"
 // @Param digest path string true "Blob digest (sha256:...)"
+// @Param Range header string false "Byte ranges to download (e.g., bytes=1024- or bytes=0-99,100-199); ranges that overlap or adjoin are served as one, others with the whole content"
 // @Router /v2/{name}/blobs/{digest} [get]
 // @Success 200 {file} file "Blob content"
+// @Success 206 {file} file "Requested range of the blob content"
 // @Failure 400 {object} types.APIResponse "Bad request - invalid digest format"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 404 {object} types.APIResponse "Blob not found"
+// @Failure 416 "Range not satisfiable"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCIBlobGet(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -415,10 +666,16 @@ func handleOCIBlobGet(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
+		if !readableOCIRepository(c, registryService, name) {
+			return
+		}
+
 		// Get blob from storage
-		reader, size, err := ociRegistry.GetBlob(c.Request.Context(), name, digest)
+		reader, size, rng, err := getOCIBlob(c, registryService, ociRegistry, name, digest)
 		if err != nil {
-			if strings.Contains(err.Error(), "not found") {
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, size)
+			} else if strings.Contains(err.Error(), "not found") {
 				c.JSON(http.StatusNotFound, gin.H{"error": "blob not found"})
 			} else {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve blob"})
@@ -427,17 +684,16 @@ func handleOCIBlobGet(registryService *registry.Service) gin.HandlerFunc {
 		}
 		defer reader.Close()
 
-		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Type", ociBlobMediaType(c, ociRegistry, name, digest))
 		c.Header("Docker-Content-Digest", digest)
-		c.Header("Content-Length", fmt.Sprintf("%d", size))
 
-		_, err = io.Copy(c.Writer, reader)
+		err = serveContent(c, reader, size, rng)
 		if err != nil {
-			log.Error().Err(err).Str("digest", digest).Msg("Failed to stream blob")
+			middleware.Logger(c).Error().Err(err).Str("digest", digest).Msg("Failed to stream blob")
 			return
 		}
 
-		log.Debug().
+		middleware.Logger(c).Debug().
 			Str("repository", name).
 			Str("digest", digest).
 			Int64("size", size).
@@ -445,6 +701,56 @@ func handleOCIBlobGet(registryService *registry.Service) gin.HandlerFunc {
 	}
 }
 
+// ociBlobMediaType returns the media type to serve a blob as, falling back
+// to oci.BlobMediaType if it cannot be looked up
+func ociBlobMediaType(c *gin.Context, ociRegistry *oci.Registry, name, digest string) string {
+	mediaType, err := ociRegistry.GetBlobMediaType(c.Request.Context(), name, digest)
+	if err != nil {
+		middleware.Logger(c).Warn().Err(err).Str("repository", name).Str("digest", digest).Msg("Failed to look up blob media type")
+		return oci.BlobMediaType
+	}
+	return mediaType
+}
+
+// getOCIBlob retrieves a blob and its size, only the range of it asked for
+// if the request has a Range header whose ranges can be served as one. It
+// returns the range retrieved, nil for the whole blob, or
+// errRangeNotSatisfiable if every range is past the end of the blob. Either
+// way the content is throttled to the client's download bandwidth limit.
+func getOCIBlob(c *gin.Context, registryService *registry.Service, ociRegistry *oci.Registry, name, digest string) (io.ReadCloser, int64, *byteRange, error) {
+	ctx := c.Request.Context()
+	if header := c.GetHeader("Range"); header != "" {
+		exists, size, err := ociRegistry.BlobExists(ctx, name, digest)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		if !exists {
+			return nil, 0, nil, fmt.Errorf("blob not found")
+		}
+
+		rng, err := parseByteRange(header, size)
+		if err != nil {
+			return nil, size, nil, err
+		}
+		if rng != nil {
+			reader, err := ociRegistry.GetBlobRange(ctx, name, digest, rng.offset, rng.length)
+			if errors.Is(err, storage.ErrInvalidRange) {
+				return nil, size, nil, errRangeNotSatisfiable
+			}
+			if err != nil {
+				return nil, size, nil, err
+			}
+			return registryService.ThrottleDownload(ctx, reader), size, rng, nil
+		}
+	}
+
+	reader, size, err := ociRegistry.GetBlob(ctx, name, digest)
+	if err != nil {
+		return nil, size, nil, err
+	}
+	return registryService.ThrottleDownload(ctx, reader), size, nil, nil
+}
+
 // @Summary Check Blob Existence
 // @Description Check if a blob exists in the registry (HEAD request)
 // @Tags OCI/Docker
@@ -480,6 +786,10 @@ func handleOCIBlobHead(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
+		if !readableOCIRepository(c, registryService, name) {
+			return
+		}
+
 		// Check if blob exists
 		exists, size, err := ociRegistry.BlobExists(c.Request.Context(), name, digest)
 		if err != nil {
@@ -492,12 +802,12 @@ func handleOCIBlobHead(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Type", ociBlobMediaType(c, ociRegistry, name, digest))
 		c.Header("Docker-Content-Digest", digest)
 		c.Header("Content-Length", fmt.Sprintf("%d", size))
 		c.Status(http.StatusOK)
 
-		log.Debug().
+		middleware.Logger(c).Debug().
 			Str("repository", name).
 			Str("digest", digest).
 			Int64("size", size).
@@ -536,7 +846,7 @@ func handleOCIBlobDelete(registryService *registry.Service) gin.HandlerFunc {
 			Registry: "oci",
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, err := registryService.ListAll(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list blobs"})
 			return
@@ -564,8 +874,15 @@ func handleOCIBlobDelete(registryService *registry.Service) gin.HandlerFunc {
 // @Security BearerAuth
 // @Param name path string true "Repository name (e.g., library/nginx, myorg/myapp)"
 // @Router /v2/{name}/blobs/uploads/ [post]
+// @Param mount query string false "Digest of a blob to mount from another repository"
+// @Param from query string false "Repository to mount the blob from"
+// @Param digest query string false "Digest of the blob in the request body, uploading it in a single request"
+// @Success 201 "Blob mounted from another repository, or uploaded in a single request"
+// @Failure 400 {object} map[string]interface{} "Blob does not match its digest (DIGEST_INVALID)"
 // @Success 202 "Upload session started"
+// @Failure 400 {object} map[string]interface{} "Invalid repository name (NAME_INVALID)"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
+// @Failure 413 {object} types.APIResponse "Denied - the blob would exceed the user's quota"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 // Blob upload handlers - enhanced implementations with session management
 func handleOCIBlobUploadStart(registryService *registry.Service) gin.HandlerFunc {
@@ -591,6 +908,25 @@ func handleOCIBlobUploadStart(registryService *registry.Service) gin.HandlerFunc
 			return
 		}
 
+		if !validateOCIRepositoryName(c, ociRegistry, name) {
+			return
+		}
+
+		// Mount a blob that already exists in another repository rather than
+		// receiving it again; if it cannot be mounted, the client uploads it
+		if digest, from := c.Query("mount"), c.Query("from"); digest != "" && from != "" {
+			if mountOCIBlob(c, registryService, ociRegistry, user, name, from, digest) {
+				return
+			}
+		}
+
+		// A digest means the whole blob is in this request, otherwise the
+		// client uploads it to the session started here
+		if digest := c.Query("digest"); digest != "" {
+			putOCIBlob(c, registryService, ociRegistry, user, name, digest)
+			return
+		}
+
 		// Start upload session
 		session, err := ociRegistry.StartBlobUpload(c.Request.Context(), name, user.ID.String())
 		if err != nil {
@@ -603,7 +939,7 @@ func handleOCIBlobUploadStart(registryService *registry.Service) gin.HandlerFunc
 		c.Header("Docker-Upload-UUID", session.ID)
 		c.Status(http.StatusAccepted)
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("session_id", session.ID).
 			Str("repository", name).
 			Str("user_id", user.ID.String()).
@@ -611,6 +947,173 @@ func handleOCIBlobUploadStart(registryService *registry.Service) gin.HandlerFunc
 	}
 }
 
+// putOCIBlob stores a blob uploaded monolithically, in the request that
+// would otherwise start an upload session
+func putOCIBlob(c *gin.Context, registryService *registry.Service, ociRegistry *oci.Registry, user *types.User, name, digest string) {
+	if !checkOCIBlobQuota(c, registryService, user, max(c.Request.ContentLength, 0)) {
+		return
+	}
+	size, storagePath, err := ociRegistry.PutBlob(c.Request.Context(), name, digest, c.Request.Body)
+	if errors.Is(err, oci.ErrDigestInvalid) {
+		writeOCIError(c, http.StatusBadRequest, "DIGEST_INVALID", err.Error())
+		return
+	}
+	if requestTooLarge(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to upload blob: %v", err)})
+		return
+	}
+	// A body of unknown length is only measured once stored. Left unrecorded,
+	// it is removed by garbage collection.
+	if c.Request.ContentLength < 0 && !checkOCIBlobQuota(c, registryService, user, size) {
+		return
+	}
+	recordOCIBlob(c.Request.Context(), registryService, user, name, digest, size, storagePath)
+
+	c.Header("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, digest))
+	c.Header("Docker-Content-Digest", digest)
+	c.Status(http.StatusCreated)
+
+	middleware.Logger(c).Info().
+		Str("repository", name).
+		Str("digest", digest).
+		Int64("size", size).
+		Str("user_id", user.ID.String()).
+		Msg("Completed monolithic blob upload")
+}
+
+// recordOCIBlob creates the artifact record of an uploaded blob, with the
+// visibility of its repository. Failing to record it does not fail the
+// upload, since the blob is already stored.
+func recordOCIBlob(ctx context.Context, registryService *registry.Service, user *types.User, name, digest string, size int64, storagePath string) {
+	public, err := registryService.ResolveVisibility(ctx, "oci", name)
+	if err != nil {
+		middleware.LoggerFromContext(ctx).Error().Err(err).Str("repository", name).Msg("Failed to resolve repository visibility")
+	}
+	artifact := &types.Artifact{
+		Name:        name,
+		Version:     digest, // For blobs, version is the digest
+		Registry:    "oci",
+		Size:        size,
+		SHA256:      strings.TrimPrefix(digest, "sha256:"),
+		StoragePath: storagePath,
+		PublishedBy: user.ID,
+		IsPublic:    public,
+		ContentType: "application/octet-stream",
+	}
+	if err := registryService.DB.WithContext(ctx).Create(artifact).Error; err != nil {
+		middleware.LoggerFromContext(ctx).Error().Err(err).Str("digest", digest).Msg("Failed to save blob artifact to database")
+	}
+}
+
+// checkOCIBlobQuota refuses, with 413 DENIED, a blob of size bytes that
+// would take the user over their quotas once recorded
+func checkOCIBlobQuota(c *gin.Context, registryService *registry.Service, user *types.User, size int64) bool {
+	err := registryService.Quotas.CheckUpload(c.Request.Context(), user.ID, "oci", size)
+	if errors.Is(err, registry.ErrQuotaExceeded) {
+		writeOCIError(c, http.StatusRequestEntityTooLarge, "DENIED", err.Error())
+		return false
+	}
+	if err != nil {
+		middleware.Logger(c).Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to check quota")
+		writeOCIError(c, http.StatusInternalServerError, "UNKNOWN", "failed to check quota")
+		return false
+	}
+	return true
+}
+
+// writeOCIPublishError writes the error response for a manifest that may not
+// be published: 413 DENIED over quota, 403 DENIED without permission or for
+// a tag an immutable registry published before, and 500 otherwise
+func writeOCIPublishError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, registry.ErrQuotaExceeded):
+		writeOCIError(c, http.StatusRequestEntityTooLarge, "DENIED", err.Error())
+	case errors.Is(err, registry.ErrPublishForbidden), errors.Is(err, auth.ErrAPIKeyScopeForbidden),
+		errors.Is(err, registry.ErrVersionPreviouslyPublished):
+		writeOCIError(c, http.StatusForbidden, "DENIED", err.Error())
+	default:
+		writeOCIError(c, http.StatusInternalServerError, "UNKNOWN", fmt.Sprintf("failed to publish manifest: %v", err))
+	}
+}
+
+// mountOCIBlob records a blob from another repository in the target
+// repository, sharing its storage, and reports whether the request was
+// answered: by the mount, or by 413 DENIED for a blob over the user's quota
+func mountOCIBlob(c *gin.Context, registryService *registry.Service, ociRegistry *oci.Registry, user *types.User, name, from, digest string) bool {
+	if !strings.HasPrefix(digest, "sha256:") || ociRegistry.ValidateRepositoryName(from) != nil {
+		return false
+	}
+
+	// Mounting reads the source repository, so a token must also grant pull on
+	// it and the user must be able to read it
+	if !hasOCIAccess(c, "repository", from, "pull") {
+		return false
+	}
+	ctx := c.Request.Context()
+	if readable, err := registryService.CanReadPackage(ctx, "oci", from); err != nil || !readable {
+		return false
+	}
+
+	exists, size, err := ociRegistry.BlobExists(ctx, from, digest)
+	if err != nil || !exists {
+		middleware.Logger(c).Debug().Err(err).Str("repository", name).Str("from", from).Str("digest", digest).Msg("Mount source blob not found, starting upload")
+		return false
+	}
+
+	storagePath, err := ociRegistry.BlobStoragePath(ctx, from, digest)
+	if err != nil {
+		return false
+	}
+
+	var existing int64
+	if err := registryService.DB.Model(&types.Artifact{}).
+		Where("registry = ? AND name = ? AND version = ?", "oci", name, digest).
+		Count(&existing).Error; err != nil {
+		middleware.Logger(c).Error().Err(err).Str("repository", name).Str("digest", digest).Msg("Failed to check for mounted blob")
+		return false
+	}
+	if existing == 0 {
+		if !checkOCIBlobQuota(c, registryService, user, size) {
+			return true
+		}
+		public, err := registryService.ResolveVisibility(ctx, "oci", name)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("repository", name).Msg("Failed to resolve repository visibility")
+			return false
+		}
+		artifact := &types.Artifact{
+			Name:        name,
+			Version:     digest,
+			Registry:    "oci",
+			Size:        size,
+			SHA256:      strings.TrimPrefix(digest, "sha256:"),
+			StoragePath: storagePath,
+			PublishedBy: user.ID,
+			IsPublic:    public,
+			ContentType: "application/octet-stream",
+		}
+		if err := registryService.DB.Create(artifact).Error; err != nil {
+			middleware.Logger(c).Error().Err(err).Str("repository", name).Str("digest", digest).Msg("Failed to save mounted blob artifact")
+			return false
+		}
+	}
+
+	c.Header("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, digest))
+	c.Header("Docker-Content-Digest", digest)
+	c.Status(http.StatusCreated)
+
+	middleware.Logger(c).Info().
+		Str("repository", name).
+		Str("from", from).
+		Str("digest", digest).
+		Str("user_id", user.ID.String()).
+		Msg("Mounted blob from another repository")
+	return true
+}
+
 // @Summary Upload Blob Chunk
 // @Description Upload a chunk of data to an existing blob upload session
 // @Tags OCI/Docker
@@ -618,22 +1121,25 @@ func handleOCIBlobUploadStart(registryService *registry.Service) gin.HandlerFunc
 // @Accept application/octet-stream
 // @Param name path string true "Repository name (e.g., library/nginx, myorg/myapp)"
 // @Param uuid path string true "Upload session UUID"
+// @Param Content-Range header string false "Inclusive byte range of the chunk, starting where the upload so far ends (e.g., 0-1023)"
 // @Param chunk body string true "Blob chunk data"
 // @Router /v2/{name}/blobs/uploads/{uuid} [patch]
 // @Success 202 "Chunk uploaded successfully"
+// @Failure 400 {object} types.APIResponse "Malformed Content-Range, or one not matching the chunk size"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 404 {object} types.APIResponse "Upload session not found"
+// @Failure 413 {object} types.APIResponse "Denied - the upload would exceed the user's quota"
+// @Failure 416 {object} types.APIResponse "Chunk leaves a gap or overlaps the upload so far"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCIBlobUploadChunk(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, exists := middleware.GetUserFromContext(c)
+		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			return
 		}
 
 		sessionID := c.Param("uuid")
-		contentRange := c.GetHeader("Content-Range")
 
 		// Get the OCI registry handler
 		handler, err := registryService.GetRegistry("oci")
@@ -648,25 +1154,79 @@ func handleOCIBlobUploadChunk(registryService *registry.Service) gin.HandlerFunc
 			return
 		}
 
+		session, ok := ociUploadSession(c, ociRegistry, user)
+		if !ok {
+			return
+		}
+		if !checkOCIBlobQuota(c, registryService, user, session.Size+max(c.Request.ContentLength, 0)) {
+			return
+		}
+
 		// Append chunk to session
-		session, err := ociRegistry.AppendBlobChunk(c.Request.Context(), sessionID, c.Request.Body, contentRange)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("upload session error: %v", err)})
+		session, ok = appendOCIBlobChunk(c, ociRegistry)
+		if !ok {
 			return
 		}
 
 		c.Header("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", session.Repository, sessionID))
-		c.Header("Range", fmt.Sprintf("0-%d", session.Size-1))
+		c.Header("Range", ociUploadRange(session.Size))
 		c.Header("Docker-Upload-UUID", sessionID)
 		c.Status(http.StatusAccepted)
 
-		log.Debug().
+		middleware.Logger(c).Debug().
 			Str("session_id", sessionID).
 			Int64("chunk_size", session.Size).
 			Msg("Appended chunk to blob upload")
 	}
 }
 
+// ociUploadSession returns the upload session a request is for. Sessions can
+// only be used by the user who started them, in the repository they were
+// started in; BLOB_UPLOAD_UNKNOWN is written for any other.
+func ociUploadSession(c *gin.Context, ociRegistry *oci.Registry, user *types.User) (*oci.UploadSession, bool) {
+	session, err := ociRegistry.GetBlobUploadStatus(c.Request.Context(), c.Param("uuid"))
+	if err != nil || session.UserID != user.ID.String() || session.Repository != extractRepositoryName(c) {
+		writeOCIError(c, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+		return nil, false
+	}
+	return session, true
+}
+
+// appendOCIBlobChunk appends the request body to its upload session. Chunks
+// must follow on from the upload so far: one that leaves a gap or overlaps it
+// is refused with 416 and the range uploaded so far.
+func appendOCIBlobChunk(c *gin.Context, ociRegistry *oci.Registry) (*oci.UploadSession, bool) {
+	sessionID := c.Param("uuid")
+	session, err := ociRegistry.AppendBlobChunk(c.Request.Context(), sessionID, c.Request.Body, c.GetHeader("Content-Range"))
+	switch {
+	case err == nil:
+		return session, true
+	case errors.Is(err, oci.ErrChunkOutOfOrder):
+		c.Header("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", session.Repository, sessionID))
+		c.Header("Range", ociUploadRange(session.Size))
+		c.Header("Docker-Upload-UUID", sessionID)
+		writeOCIError(c, http.StatusRequestedRangeNotSatisfiable, "BLOB_UPLOAD_INVALID", err.Error())
+	case errors.Is(err, oci.ErrContentRangeInvalid):
+		writeOCIError(c, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", err.Error())
+	case errors.Is(err, oci.ErrUploadUnknown):
+		writeOCIError(c, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "blob upload unknown to registry")
+	case requestTooLarge(c, err):
+		// already responded 413
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload session error: %v", err)})
+	}
+	return nil, false
+}
+
+// ociUploadRange returns the Range header reporting how much of a blob has
+// been uploaded
+func ociUploadRange(size int64) string {
+	if size == 0 {
+		return "0-0"
+	}
+	return fmt.Sprintf("0-%d", size-1)
+}
+
 // @Summary Complete Blob Upload
 // @Description Complete a blob upload session with digest verification
 // @Tags OCI/Docker
@@ -681,6 +1241,7 @@ func handleOCIBlobUploadChunk(registryService *registry.Service) gin.HandlerFunc
 // @Failure 400 {object} types.APIResponse "Bad request - digest required or invalid"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 404 {object} types.APIResponse "Upload session not found"
+// @Failure 413 {object} types.APIResponse "Denied - the blob would exceed the user's quota"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCIBlobUploadComplete(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -717,15 +1278,23 @@ func handleOCIBlobUploadComplete(registryService *registry.Service) gin.HandlerF
 			return
 		}
 
+		session, ok := ociUploadSession(c, ociRegistry, user)
+		if !ok {
+			return
+		}
+
 		// Handle any final chunk data in the request body
 		if c.Request.ContentLength > 0 {
-			_, err := ociRegistry.AppendBlobChunk(c.Request.Context(), sessionID, c.Request.Body, "")
-			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("failed to append final chunk: %v", err)})
+			if session, ok = appendOCIBlobChunk(c, ociRegistry); !ok {
 				return
 			}
 		}
 
+		// The blob is checked against the user's quotas before it is stored
+		if !checkOCIBlobQuota(c, registryService, user, session.Size) {
+			return
+		}
+
 		// Complete the upload with digest verification
 		session, storagePath, err := ociRegistry.CompleteBlobUpload(c.Request.Context(), sessionID, digest)
 		if err != nil {
@@ -733,30 +1302,13 @@ func handleOCIBlobUploadComplete(registryService *registry.Service) gin.HandlerF
 			return
 		}
 
-		// Create artifact record in database
-		artifact := &types.Artifact{
-			Name:        name,
-			Version:     digest, // For blobs, version is the digest
-			Registry:    "oci",
-			Size:        session.Size,
-			SHA256:      strings.TrimPrefix(digest, "sha256:"),
-			StoragePath: storagePath,
-			PublishedBy: user.ID,
-			IsPublic:    false,
-			ContentType: "application/octet-stream",
-		}
-
-		// Save to database
-		if err := registryService.DB.Create(artifact).Error; err != nil {
-			log.Error().Err(err).Str("digest", digest).Msg("Failed to save blob artifact to database")
-			// Don't return error as the blob is already stored successfully
-		}
+		recordOCIBlob(c.Request.Context(), registryService, user, name, digest, session.Size, storagePath)
 
 		c.Header("Location", fmt.Sprintf("/v2/%s/blobs/%s", name, digest))
 		c.Header("Docker-Content-Digest", digest)
 		c.Status(http.StatusCreated)
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("session_id", sessionID).
 			Str("repository", name).
 			Str("digest", digest).
@@ -775,10 +1327,11 @@ func handleOCIBlobUploadComplete(registryService *registry.Service) gin.HandlerF
 // @Router /v2/{name}/blobs/uploads/{uuid} [delete]
 // @Success 204 "Upload session cancelled"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
+// @Failure 404 {object} types.APIResponse "Upload session not found"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCIBlobUploadCancel(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, exists := middleware.GetUserFromContext(c)
+		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			return
@@ -799,16 +1352,20 @@ func handleOCIBlobUploadCancel(registryService *registry.Service) gin.HandlerFun
 			return
 		}
 
+		if _, ok := ociUploadSession(c, ociRegistry, user); !ok {
+			return
+		}
+
 		// Cancel the upload session
 		err = ociRegistry.CancelBlobUpload(c.Request.Context(), sessionID)
 		if err != nil {
-			log.Warn().Err(err).Str("session_id", sessionID).Msg("Failed to cancel upload session")
-			// Don't return error as the session might not exist
+			middleware.Logger(c).Warn().Err(err).Str("session_id", sessionID).Msg("Failed to cancel upload session")
+			// Don't return error as the session might have expired since
 		}
 
 		c.Status(http.StatusNoContent)
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("session_id", sessionID).
 			Msg("Cancelled blob upload session")
 	}
@@ -827,7 +1384,7 @@ func handleOCIBlobUploadCancel(registryService *registry.Service) gin.HandlerFun
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCIBlobUploadStatus(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		_, exists := middleware.GetUserFromContext(c)
+		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			return
@@ -849,53 +1406,157 @@ func handleOCIBlobUploadStatus(registryService *registry.Service) gin.HandlerFun
 		}
 
 		// Get upload session status
-		session, err := ociRegistry.GetBlobUploadStatus(sessionID)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "upload session not found"})
+		session, ok := ociUploadSession(c, ociRegistry, user)
+		if !ok {
 			return
 		}
 
-		c.Header("Range", fmt.Sprintf("0-%d", session.Size-1))
+		c.Header("Range", ociUploadRange(session.Size))
 		c.Header("Docker-Upload-UUID", sessionID)
 		c.Status(http.StatusNoContent)
 
-		log.Debug().
+		middleware.Logger(c).Debug().
 			Str("session_id", sessionID).
 			Int64("current_size", session.Size).
 			Msg("Retrieved blob upload status")
 	}
 }
 
+// @Summary List Referrers
+// @Description List the manifests whose subject is the given manifest, such as signatures, SBOMs and attestations
+// @Tags OCI/Docker
+// @Security BearerAuth
+// @Produce application/vnd.oci.image.index.v1+json
+// @Param name path string true "Repository name (e.g., library/nginx, myorg/myapp)"
+// @Param digest path string true "Digest of the subject manifest (sha256:...)"
+// @Param artifactType query string false "Only list referrers of this artifact type"
+// @Router /v2/{name}/referrers/{digest} [get]
+// @Success 200 {object} oci.ImageIndex "Image index of referrers, empty if there are none"
+// @Failure 400 {object} types.APIResponse "Invalid digest"
+// @Failure 401 {object} types.APIResponse "Unauthorized"
+// @Failure 404 {object} object{errors=[]object} "Repository not found or not readable by the caller"
+// @Failure 500 {object} types.APIResponse "Internal server error"
+func handleOCIReferrers(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := extractRepositoryName(c)
+		digest := c.Param("digest")
+
+		handler, err := registryService.GetRegistry("oci")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get registry handler"})
+			return
+		}
+
+		ociRegistry, ok := handler.(*oci.Registry)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid registry handler type"})
+			return
+		}
+
+		if !validateOCIRepositoryName(c, ociRegistry, name) || !readableOCIRepository(c, registryService, name) {
+			return
+		}
+		if !ociDigestRegex.MatchString(digest) {
+			writeOCIError(c, http.StatusBadRequest, "DIGEST_INVALID", "invalid digest: "+digest)
+			return
+		}
+
+		artifactType := c.Query("artifactType")
+		referrers, err := ociRegistry.ListReferrers(c.Request.Context(), name, digest, artifactType)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to list referrers: %v", err)})
+			return
+		}
+
+		body, err := json.Marshal(oci.NewImageIndex(referrers))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode referrers"})
+			return
+		}
+
+		if artifactType != "" {
+			c.Header("OCI-Filters-Applied", "artifactType")
+		}
+		c.Data(http.StatusOK, oci.ImageIndexMediaType, body)
+	}
+}
+
+// paginateOCIList sorts a tag or repository list and returns the page after
+// the "last" query parameter, of at most "n" entries if given. When entries
+// remain, a Link header to the next page of path is set. An invalid n is
+// reported to the client and false returned.
+func paginateOCIList(c *gin.Context, path string, entries []string) ([]string, bool) {
+	sort.Strings(entries)
+
+	last := c.Query("last")
+	if last != "" {
+		entries = entries[sort.Search(len(entries), func(i int) bool { return entries[i] > last }):]
+	}
+
+	value, limited := c.GetQuery("n")
+	if !limited {
+		return entries, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		writeOCIError(c, http.StatusBadRequest, "PAGINATION_NUMBER_INVALID", "n must be a non-negative integer")
+		return nil, false
+	}
+	if n == 0 {
+		return []string{}, true
+	}
+	if len(entries) > n {
+		entries = entries[:n]
+		next := url.Values{"n": {strconv.Itoa(n)}, "last": {entries[n-1]}}
+		c.Header("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, path, next.Encode()))
+	}
+	return entries, true
+}
+
 // @Summary List Repository Tags
-// @Description List all tags for a specific repository
+// @Description List the tags of a repository in lexical order, a page at a time if n is given. A Link header points to the next page.
 // @Tags OCI/Docker
 // @Security BearerAuth
 // @Produce json
 // @Param name path string true "Repository name (e.g., library/nginx, myorg/myapp)"
+// @Param n query int false "Maximum number of tags to return"
+// @Param last query string false "Return tags after this tag"
 // @Router /v2/{name}/tags/list [get]
 // @Success 200 {object} map[string]interface{} "List of tags for the repository"
+// @Failure 400 {object} map[string]interface{} "Invalid n"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
+// @Failure 404 {object} object{errors=[]object} "Repository not found or not readable by the caller"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCITagsList(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		name := c.Param("name")
 
-		ctx := context.WithValue(c.Request.Context(), registryKey, "oci")
+		handler, err := registryService.GetRegistry("oci")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get registry handler"})
+			return
+		}
+		ociRegistry, ok := handler.(*oci.Registry)
+		if !ok {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "invalid registry handler type"})
+			return
+		}
 
-		filter := &types.ArtifactFilter{
-			Name:     name,
-			Registry: "oci",
+		if !readableOCIRepository(c, registryService, name) {
+			return
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		// Tags are read from the stored manifests, so blobs and manifests
+		// pushed by digest are not listed
+		tags, err := ociRegistry.ListTags(c.Request.Context(), name)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list tags"})
 			return
 		}
 
-		tags := make([]string, 0, len(artifacts))
-		for _, artifact := range artifacts {
-			tags = append(tags, artifact.Version)
+		tags, ok = paginateOCIList(c, fmt.Sprintf("/v2/%s/tags/list", name), append([]string{}, tags...))
+		if !ok {
+			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -906,37 +1567,59 @@ func handleOCITagsList(registryService *registry.Service) gin.HandlerFunc {
 }
 
 // @Summary List Repositories
-// @Description List all repositories in the registry (catalog)
+// @Description List the repositories the caller can read in lexical order, a page of at most n, and at most 1000, repositories at a time. Public repositories are listed for everyone, private ones only for their publishers, owners and administrators. A Link header points to the next page.
 // @Tags OCI/Docker
 // @Security BearerAuth
 // @Produce json
+// @Param n query int false "Maximum number of repositories to return"
+// @Param last query string false "Return repositories after this repository"
+// @Param prefix query string false "Only return repositories whose names start with this prefix"
 // @Router /v2/_catalog [get]
 // @Success 200 {object} map[string]interface{} "List of repositories"
+// @Failure 400 {object} map[string]interface{} "Invalid n"
 // @Failure 401 {object} types.APIResponse "Unauthorized"
 // @Failure 500 {object} types.APIResponse "Internal server error"
 func handleOCICatalog(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := context.WithValue(c.Request.Context(), registryKey, "oci")
 
-		filter := &types.ArtifactFilter{
-			Registry: "oci",
+		// Without n the page is as large as the server allows, and the Link
+		// header tells the client there is more
+		n := registry.MaxListLimit
+		if value, limited := c.GetQuery("n"); limited {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				writeOCIError(c, http.StatusBadRequest, "PAGINATION_NUMBER_INVALID", "n must be a non-negative integer")
+				return
+			}
+			n = min(parsed, registry.MaxListLimit)
 		}
+		if n == 0 {
+			c.JSON(http.StatusOK, gin.H{"repositories": []string{}})
+			return
+		}
+
+		// Anonymous requests, where allowed, see only public repositories
+		user, _ := middleware.GetUserFromContext(c)
+		prefix := c.Query("prefix")
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		// One more than the page is fetched to tell whether another follows
+		repositories, err := registryService.ListReadableNames(ctx, "oci", prefix, c.Query("last"), n+1, user)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list repositories"})
 			return
 		}
-
-		// Extract unique repository names
-		repoSet := make(map[string]bool)
-		for _, artifact := range artifacts {
-			repoSet[artifact.Name] = true
+		if repositories == nil {
+			repositories = []string{}
 		}
 
-		repositories := make([]string, 0, len(repoSet))
-		for repo := range repoSet {
-			repositories = append(repositories, repo)
+		if len(repositories) > n {
+			repositories = repositories[:n]
+			next := url.Values{"n": {strconv.Itoa(n)}, "last": {repositories[n-1]}}
+			if prefix != "" {
+				next.Set("prefix", prefix)
+			}
+			c.Header("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, "/v2/_catalog", next.Encode()))
 		}
 
 		c.JSON(http.StatusOK, gin.H{
@@ -983,10 +1666,13 @@ func handleOCIRequest(registryService *registry.Service, authService *auth.Servi
 		// Handle catalog endpoint specifically
 		if path == "_catalog" {
 			if method == "GET" {
-				middleware.AuthMiddleware(authService)(c)
+				middleware.OCIAuthMiddleware(authService)(c)
 				if c.IsAborted() {
 					return
 				}
+				if !authorizeOCIAccess(c, "registry", "catalog", "*") {
+					return
+				}
 				handleOCICatalog(registryService)(c)
 				return
 			}
@@ -996,16 +1682,26 @@ func handleOCIRequest(registryService *registry.Service, authService *auth.Servi
 		if strings.HasSuffix(path, "/tags/list") {
 			// Repository tags list
 			if method == "GET" {
-				middleware.AuthMiddleware(authService)(c)
+				middleware.OCIAuthMiddleware(authService)(c)
 				if c.IsAborted() {
 					return
 				}
 				handleOCITagsListCatchAll(registryService)(c)
 				return
 			}
+		} else if strings.Contains(path, "/referrers/") {
+			// Referrers listing
+			if method == "GET" {
+				middleware.OCIAuthMiddleware(authService)(c)
+				if c.IsAborted() {
+					return
+				}
+				handleOCIReferrersCatchAll(registryService)(c)
+				return
+			}
 		} else if strings.Contains(path, "/manifests/") {
 			// Manifest operations - require authentication for all operations
-			middleware.AuthMiddleware(authService)(c)
+			middleware.OCIAuthMiddleware(authService)(c)
 			if c.IsAborted() {
 				return
 			}
@@ -1013,7 +1709,7 @@ func handleOCIRequest(registryService *registry.Service, authService *auth.Servi
 			return
 		} else if strings.Contains(path, "/blobs/uploads/") {
 			// Blob upload operations
-			middleware.AuthMiddleware(authService)(c)
+			middleware.OCIAuthMiddleware(authService)(c)
 			if c.IsAborted() {
 				return
 			}
@@ -1021,7 +1717,7 @@ func handleOCIRequest(registryService *registry.Service, authService *auth.Servi
 			return
 		} else if strings.Contains(path, "/blobs/") {
 			// Blob operations - require authentication for all operations
-			middleware.AuthMiddleware(authService)(c)
+			middleware.OCIAuthMiddleware(authService)(c)
 			if c.IsAborted() {
 				return
 			}
@@ -1053,6 +1749,9 @@ func handleOCITagsListCatchAll(registryService *registry.Service) gin.HandlerFun
 
 		// Extract repository name (remove "/tags/list" suffix)
 		name := strings.TrimSuffix(path, "/tags/list")
+		if !authorizeOCIAccess(c, "repository", name, "pull") {
+			return
+		}
 
 		// Set the name parameter for compatibility with existing handler
 		c.Params = append(c.Params, gin.Param{Key: "name", Value: name})
@@ -1061,6 +1760,29 @@ func handleOCITagsListCatchAll(registryService *registry.Service) gin.HandlerFun
 	}
 }
 
+func handleOCIReferrersCatchAll(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Param("path")
+		path = strings.TrimPrefix(path, "/")
+
+		// Extract repository name and digest from path like "repo/name/referrers/sha256:..."
+		name, digest, ok := extractRepositoryNameFromPath(path, "/referrers/")
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid referrers path"})
+			return
+		}
+		if !authorizeOCIAccess(c, "repository", name, "pull") {
+			return
+		}
+
+		// Set parameters for compatibility with existing handlers
+		c.Params = append(c.Params, gin.Param{Key: "name", Value: name})
+		c.Params = append(c.Params, gin.Param{Key: "digest", Value: digest})
+
+		handleOCIReferrers(registryService)(c)
+	}
+}
+
 func handleOCIManifestCatchAll(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.Param("path")
@@ -1078,6 +1800,9 @@ func handleOCIManifestCatchAll(registryService *registry.Service) gin.HandlerFun
 		c.Params = append(c.Params, gin.Param{Key: "reference", Value: reference})
 
 		method := c.Request.Method
+		if !authorizeOCIAccess(c, "repository", name, ociMethodAction(method)) {
+			return
+		}
 		switch method {
 		case "GET":
 			handleOCIManifestGet(registryService)(c)
@@ -1110,6 +1835,9 @@ func handleOCIBlobCatchAll(registryService *registry.Service) gin.HandlerFunc {
 		c.Params = append(c.Params, gin.Param{Key: "digest", Value: digest})
 
 		method := c.Request.Method
+		if !authorizeOCIAccess(c, "repository", name, ociMethodAction(method)) {
+			return
+		}
 		switch method {
 		case "GET":
 			handleOCIBlobGet(registryService)(c)
@@ -1135,6 +1863,9 @@ func handleOCIBlobUploadCatchAll(registryService *registry.Service) gin.HandlerF
 			if method == "POST" {
 				name := strings.TrimSuffix(path, "/blobs/uploads/")
 				c.Params = append(c.Params, gin.Param{Key: "name", Value: name})
+				if !authorizeOCIAccess(c, "repository", name, "push") {
+					return
+				}
 				handleOCIBlobUploadStart(registryService)(c)
 				return
 			}
@@ -1148,6 +1879,9 @@ func handleOCIBlobUploadCatchAll(registryService *registry.Service) gin.HandlerF
 
 			c.Params = append(c.Params, gin.Param{Key: "name", Value: name})
 			c.Params = append(c.Params, gin.Param{Key: "uuid", Value: uuid})
+			if !authorizeOCIAccess(c, "repository", name, "push") {
+				return
+			}
 
 			switch method {
 			case "PATCH":
@@ -1216,13 +1950,7 @@ func handleDockerAuth(authService *auth.Service) gin.HandlerFunc {
 					Username: username,
 					Password: password,
 				}
-				token, loginErr := authService.Login(ctx, loginReq)
-				if loginErr == nil {
-					// Login successful, validate the token to get user
-					user, err = authService.ValidateToken(ctx, token.Token)
-				} else {
-					err = loginErr
-				}
+				user, err = authService.Authenticate(ctx, loginReq)
 			}
 		}
 
@@ -1244,7 +1972,7 @@ func handleDockerAuth(authService *auth.Service) gin.HandlerFunc {
 		c.Header("Docker-Distribution-API-Version", "registry/2.0")
 
 		// Log successful authentication
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("username", username).
 			Str("user_id", user.ID.String()).
 			Msg("Docker authentication successful")
@@ -1259,13 +1987,13 @@ func handleDockerAuth(authService *auth.Service) gin.HandlerFunc {
 }
 
 // @Summary Docker Registry Token
-// @Description Obtain a Bearer token for Docker/OCI registry operations (OAuth2-like flow)
+// @Description Obtain a signed Bearer token granting the requested scopes for Docker/OCI registry operations (OAuth2-like flow)
 // @Tags OCI/Docker
 // @Accept application/json
 // @Produce json
 // @Security BasicAuth
 // @Param service query string false "Service name (typically registry hostname)"
-// @Param scope query string false "Access scope (e.g., repository:myrepo:pull,push)"
+// @Param scope query []string false "Access scope, repeatable (e.g., repository:myrepo:pull,push)" collectionFormat(multi)
 // @Router /v2/token [get]
 // @Router /v2/token [post]
 // @Success 200 {object} map[string]interface{} "Bearer token response"
@@ -1274,7 +2002,6 @@ func handleDockerToken(authService *auth.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Handle Docker token requests (OAuth2-like flow)
 		service := c.Query("service")
-		scope := c.Query("scope")
 
 		// Check for Basic Auth
 		username, password, hasAuth := c.Request.BasicAuth()
@@ -1297,23 +2024,19 @@ func handleDockerToken(authService *auth.Service) gin.HandlerFunc {
 
 		// Authenticate using API key
 		var user *types.User
-		var err error
+		var key *types.APIKey
+		err := fmt.Errorf("no credentials supplied")
 
 		if password != "" {
 			// Try password as API key first
-			user, _, err = authService.ValidateAPIKey(ctx, password)
+			user, key, err = authService.ValidateAPIKey(ctx, password)
 			if err != nil {
 				// If API key validation fails, try traditional login
 				loginReq := &types.LoginRequest{
 					Username: username,
 					Password: password,
 				}
-				token, loginErr := authService.Login(ctx, loginReq)
-				if loginErr == nil {
-					user, err = authService.ValidateToken(ctx, token.Token)
-				} else {
-					err = loginErr
-				}
+				user, err = authService.Authenticate(ctx, loginReq)
 			}
 		}
 
@@ -1331,23 +2054,89 @@ func handleDockerToken(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
-		// Generate a simple token response
-		// In a full implementation, this would be a proper JWT with the requested scope
+		// Issue a signed token limited to the requested scopes, and to those of
+		// a scoped API key, which the token carries on. Whether the user can
+		// read or push to each repository is checked by the handlers when the
+		// token is used.
+		var keyScopes []string
+		if key != nil {
+			keyScopes = key.Scopes
+		}
+		access := limitRegistryAccess(grantRegistryAccess(auth.ParseRegistryScopes(c.QueryArray("scope")...)), keyScopes)
+		token, expiresIn, err := authService.IssueRegistryToken(user, access, keyScopes)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to issue Docker token")
+			writeOCIError(c, http.StatusInternalServerError, "UNKNOWN", "failed to issue token")
+			return
+		}
+
+		granted := make([]string, 0, len(access))
+		for _, grant := range access {
+			granted = append(granted, grant.String())
+		}
+
 		c.Header("Docker-Distribution-API-Version", "registry/2.0")
 		c.JSON(http.StatusOK, gin.H{
-			"token":        password, // Use API key as token
-			"access_token": password,
-			"expires_in":   3600,
+			"token":        token,
+			"access_token": token,
+			"expires_in":   int(expiresIn.Seconds()),
 			"issued_at":    time.Now().Format(time.RFC3339),
-			"scope":        scope,
+			"scope":        strings.Join(granted, " "),
 		})
 
 		// Log successful authentication
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("username", username).
 			Str("service", service).
-			Str("scope", scope).
+			Strs("scope", granted).
 			Str("user_id", user.ID.String()).
 			Msg("Docker token issued successfully")
 	}
 }
+
+// grantRegistryAccess limits requested scopes to the actions the registry
+// understands: pull, push and delete on repositories, and the catalog
+func grantRegistryAccess(requested []auth.RegistryAccess) []auth.RegistryAccess {
+	granted := make([]auth.RegistryAccess, 0, len(requested))
+	for _, scope := range requested {
+		var actions []string
+		for _, action := range scope.Actions {
+			switch {
+			case scope.Type == "repository" && (action == "pull" || action == "push" || action == "delete" || action == "*"):
+				actions = append(actions, action)
+			case scope.Type == "registry" && scope.Name == "catalog" && action == "*":
+				actions = append(actions, action)
+			}
+		}
+		if len(actions) > 0 {
+			granted = append(granted, auth.RegistryAccess{Type: scope.Type, Name: scope.Name, Actions: actions})
+		}
+	}
+	return granted
+}
+
+// limitRegistryAccess drops the grants an API key's scopes do not permit:
+// repositories outside them, and the catalog unless the key may access every
+// OCI repository. Keys without scopes are not limited.
+func limitRegistryAccess(access []auth.RegistryAccess, keyScopes []string) []auth.RegistryAccess {
+	if len(keyScopes) == 0 {
+		return access
+	}
+	limited := make([]auth.RegistryAccess, 0, len(access))
+	for _, grant := range access {
+		switch grant.Type {
+		case "repository":
+			if auth.APIKeyScopesAllow(keyScopes, "oci", grant.Name) {
+				limited = append(limited, grant)
+			}
+		case "registry":
+			if slices.ContainsFunc(keyScopes, func(raw string) bool {
+				scope, err := auth.ParseAPIKeyScope(raw)
+				return err == nil && scope.Registry == "oci" && scope.Package == ""
+			}) {
+				limited = append(limited, grant)
+			}
+		}
+	}
+	return limited
+}
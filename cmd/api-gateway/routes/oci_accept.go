@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+)
+
+// ociManifestAccepts returns whether the Accept headers of a manifest request
+// accept a media type. Requests without an Accept header accept any.
+func ociManifestAccepts(c *gin.Context, mediaType string) bool {
+	ranges := 0
+	for _, header := range c.Request.Header.Values("Accept") {
+		for _, value := range strings.Split(header, ",") {
+			accepted, params, err := mime.ParseMediaType(value)
+			if err != nil {
+				continue
+			}
+			ranges++
+
+			if q, ok := params["q"]; ok {
+				if weight, err := strconv.ParseFloat(q, 64); err != nil || weight <= 0 {
+					continue
+				}
+			}
+			if accepted == "*/*" || accepted == mediaType ||
+				(strings.HasSuffix(accepted, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(accepted, "*"))) {
+				return true
+			}
+		}
+	}
+	return ranges == 0
+}
+
+// negotiateOCIManifest returns the manifest to serve for a manifest request,
+// along with its digest and media type. A manifest whose media type the
+// client accepts is served as it is. An image index the client does not
+// accept is replaced by the image it lists for oci.DefaultPlatform, or its
+// first image the client accepts, so clients that predate multi-platform
+// images can still pull. Otherwise it responds with 406 and returns false.
+func negotiateOCIManifest(c *gin.Context, ociRegistry *oci.Registry, name string, content []byte, digest string) ([]byte, string, string, bool) {
+	c.Header("Vary", "Accept")
+
+	mediaType := oci.ManifestMediaType(content)
+	if ociManifestAccepts(c, mediaType) {
+		return content, digest, mediaType, true
+	}
+
+	if oci.IsIndexMediaType(mediaType) {
+		index, err := oci.ParseImageIndex(content)
+		if err != nil {
+			writeOCIError(c, http.StatusInternalServerError, "UNKNOWN", "invalid image index")
+			return nil, "", "", false
+		}
+
+		if descriptor := index.SelectManifest(func(mediaType string) bool { return ociManifestAccepts(c, mediaType) }); descriptor != nil {
+			manifest, _, _, err := ociRegistry.GetManifest(c.Request.Context(), name, descriptor.Digest)
+			if err != nil {
+				if strings.Contains(err.Error(), "not found") {
+					writeOCIError(c, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+				} else {
+					writeOCIError(c, http.StatusInternalServerError, "UNKNOWN", "failed to retrieve manifest")
+				}
+				return nil, "", "", false
+			}
+			defer manifest.Close()
+
+			image, err := io.ReadAll(manifest)
+			if err != nil || !json.Valid(image) {
+				writeOCIError(c, http.StatusInternalServerError, "UNKNOWN", "failed to read manifest content")
+				return nil, "", "", false
+			}
+			return image, descriptor.Digest, oci.ManifestMediaType(image), true
+		}
+	}
+
+	writeOCIError(c, http.StatusNotAcceptable, "MANIFEST_UNKNOWN",
+		fmt.Sprintf("manifest is %s, which the Accept header does not accept", mediaType))
+	return nil, "", "", false
+}
@@ -1,14 +1,41 @@
 package routes
 
 import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/helm"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/throttle"
+	"github.com/lgulliver/lodestone/pkg/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 )
 
 // TestOCIRootRoutes verifies that OCI root routes can be registered without panicking
@@ -115,3 +142,1374 @@ func TestOCIBaseEndpointOnly(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "Lodestone OCI Registry")
 	assert.Equal(t, "registry/2.0", w.Header().Get("Docker-Distribution-API-Version"))
 }
+
+// TestOCIRepositoryNameValidation verifies that push and manifest paths reject
+// repository names that do not match the distribution spec grammar
+func TestOCIRepositoryNameValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService := registry.NewService(&common.Database{}, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &types.User{ID: uuid.New(), Username: "tester"})
+		c.Next()
+	})
+	router.POST("/v2/*path", handleOCIBlobUploadCatchAll(registryService))
+	router.PUT("/v2/*path", handleOCIManifestCatchAll(registryService))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{name: "Uppercase repository on upload", method: "POST", path: "/v2/MyOrg/app/blobs/uploads/"},
+		{name: "Invalid separator on upload", method: "POST", path: "/v2/myorg/app..name/blobs/uploads/"},
+		{name: "Uppercase repository on manifest push", method: "PUT", path: "/v2/myorg/App/manifests/latest"},
+		{name: "Leading separator on manifest push", method: "PUT", path: "/v2/myorg/-app/manifests/latest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+			w := httptest.NewRecorder()
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), "NAME_INVALID")
+		})
+	}
+}
+
+// TestOCIRepositoryNameValidationLenient verifies that lenient mode accepts
+// names outside the distribution spec grammar
+func TestOCIRepositoryNameValidationLenient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService := registry.NewService(&common.Database{}, nil)
+	registryService.Configure(config.RegistryConfig{OCIStrictNames: false})
+
+	handler, err := registryService.GetRegistry("oci")
+	require.NoError(t, err)
+	ociRegistry := handler.(*oci.Registry)
+
+	assert.NoError(t, ociRegistry.ValidateRepositoryName("MyOrg/App"))
+	assert.Error(t, ociRegistry.ValidateRepositoryName("myorg/../app"))
+
+	registryService.Configure(config.RegistryConfig{OCIStrictNames: true})
+	assert.Error(t, ociRegistry.ValidateRepositoryName("MyOrg/App"))
+	assert.NoError(t, ociRegistry.ValidateRepositoryName("myorg/app"))
+}
+
+// pushTestBlob pushes content as a blob of an OCI repository and returns its
+// digest, for manifests to refer to
+func pushTestBlob(t *testing.T, registryService *registry.Service, repository, content string) string {
+	t.Helper()
+	handler, err := registryService.GetRegistry("oci")
+	require.NoError(t, err)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	_, _, err = handler.(*oci.Registry).PutBlob(context.Background(), repository, digest, strings.NewReader(content))
+	require.NoError(t, err)
+	return digest
+}
+
+// TestOCIImmutableTags verifies that tags matching an immutable pattern cannot
+// be moved once pushed while other tags can
+func TestOCIImmutableTags(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	registryService.Configure(config.RegistryConfig{OCIStrictNames: true, OCIImmutableTags: []string{"myorg/*:v*"}})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.PUT("/v2/*path", handleOCIManifestCatchAll(registryService))
+
+	push := func(reference, manifest string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/v2/myorg/app/manifests/"+reference, strings.NewReader(manifest))
+		req.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	first := `{"schemaVersion":2,"config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "first") + `"}}`
+	second := `{"schemaVersion":2,"config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "second") + `"}}`
+
+	t.Run("release tag rejected on re-push", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, push("v1.2.3", first).Code)
+
+		w := push("v1.2.3", second)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "DENIED")
+
+		// Pushing the manifest the tag already points to does not move it
+		assert.Equal(t, http.StatusCreated, push("v1.2.3", first).Code)
+	})
+
+	t.Run("floating tag allowed to move", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, push("latest", first).Code)
+
+		w := push("latest", second)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.NotEqual(t, push("v1.2.3", first).Header().Get("Docker-Content-Digest"), w.Header().Get("Docker-Content-Digest"))
+	})
+}
+
+func TestOCISignatureRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	require.NoError(t, registryService.Settings.SetRequireSignature(context.Background(), "oci", true, user.ID))
+
+	trusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	untrusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&trusted.PublicKey)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+	registryService.Configure(config.RegistryConfig{OCIStrictNames: true, SignatureKeyringPath: keyPath})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.PUT("/v2/*path", handleOCIManifestCatchAll(registryService))
+
+	push := func(reference, manifest string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/v2/myorg/app/manifests/"+reference, strings.NewReader(manifest))
+		req.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// signatureManifest stores a cosign payload for the image signed by key
+	// and returns a signature artifact manifest referring to the image
+	image := `{"schemaVersion":2,"config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "image") + `"}}`
+	imageDigest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(image)))
+	signatureManifest := func(key *ecdsa.PrivateKey, subject bool) string {
+		payload := []byte(`{"critical":{"identity":{"docker-reference":"myorg/app"},"image":{"docker-manifest-digest":"` + imageDigest + `"},"type":"cosign container image signature"},"optional":null}`)
+		payloadDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(payload))
+		require.NoError(t, registryService.Storage.Store(context.Background(), "oci/myorg/app/blobs/"+payloadDigest, bytes.NewReader(payload), "application/octet-stream"))
+
+		hash := sha256.Sum256(payload)
+		signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+		require.NoError(t, err)
+
+		manifest := map[string]interface{}{
+			"schemaVersion": 2,
+			"layers": []map[string]interface{}{{
+				"digest":      payloadDigest,
+				"annotations": map[string]string{oci.CosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+			}},
+		}
+		if subject {
+			manifest["subject"] = map[string]string{"digest": imageDigest}
+		}
+		body, err := json.Marshal(manifest)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	// Images are pushed untagged, signed, then tagged
+	require.Equal(t, http.StatusCreated, push(imageDigest, image).Code)
+
+	w := push("v1.0.0", image)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "DENIED")
+
+	// A signature by an untrusted key under cosign's tag scheme is not enough
+	require.Equal(t, http.StatusCreated, push(strings.Replace(imageDigest, ":", "-", 1)+".sig", signatureManifest(untrusted, false)).Code)
+	assert.Equal(t, http.StatusForbidden, push("v1.0.0", image).Code)
+
+	// A trusted signature stored as a referrer allows the tag
+	referrer := signatureManifest(trusted, true)
+	require.Equal(t, http.StatusCreated, push(fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(referrer))), referrer).Code)
+	assert.Equal(t, http.StatusCreated, push("v1.0.0", image).Code)
+
+	// Other manifests stay unsigned
+	assert.Equal(t, http.StatusForbidden, push("v2.0.0", `{"schemaVersion":2,"config":{"digest":"`+pushTestBlob(t, registryService, "myorg/app", "other")+`"}}`).Code)
+}
+
+func TestOCIReferrers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.PUT("/v2/*path", handleOCIManifestCatchAll(registryService))
+	router.GET("/v2/*path", handleOCIReferrersCatchAll(registryService))
+
+	push := func(reference, manifest string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/v2/myorg/app/manifests/"+reference, strings.NewReader(manifest))
+		req.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	referrers := func(digest, query string) (*httptest.ResponseRecorder, oci.ImageIndex) {
+		req := httptest.NewRequest("GET", "/v2/myorg/app/referrers/"+digest+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var index oci.ImageIndex
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &index))
+		}
+		return w, index
+	}
+
+	w := push("v1", `{"schemaVersion":2,"config":{"digest":"`+pushTestBlob(t, registryService, "myorg/app", "config")+`"}}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	subject := w.Header().Get("Docker-Content-Digest")
+	assert.Empty(t, w.Header().Get("OCI-Subject"))
+
+	t.Run("no referrers is an empty index", func(t *testing.T) {
+		w, index := referrers(subject, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, oci.ImageIndexMediaType, w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), `"manifests":[]`)
+		assert.Equal(t, 2, index.SchemaVersion)
+	})
+
+	for _, artifactType := range []string{"application/spdx+json", "application/vnd.dev.cosign.artifact.sig.v1+json"} {
+		manifest := `{"schemaVersion":2,"artifactType":"` + artifactType + `","subject":{"digest":"` + subject + `"}}`
+		w := push(fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest))), manifest)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, subject, w.Header().Get("OCI-Subject"))
+	}
+
+	t.Run("all referrers are listed", func(t *testing.T) {
+		w, index := referrers(subject, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, index.Manifests, 2)
+		assert.Empty(t, w.Header().Get("OCI-Filters-Applied"))
+	})
+
+	t.Run("filtered by artifact type", func(t *testing.T) {
+		w, index := referrers(subject, "?artifactType=application/spdx%2Bjson")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "artifactType", w.Header().Get("OCI-Filters-Applied"))
+		require.Len(t, index.Manifests, 1)
+		assert.Equal(t, "application/spdx+json", index.Manifests[0].ArtifactType)
+	})
+
+	t.Run("invalid digest", func(t *testing.T) {
+		w, _ := referrers("latest", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "DIGEST_INVALID")
+	})
+}
+
+// TestOCIImageIndex verifies that a multi-platform image index is accepted
+// once its images are pushed and is what pulling by tag returns
+func TestOCIImageIndex(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.Any("/v2/*path", handleOCIManifestCatchAll(registryService))
+
+	do := func(method, reference, contentType, manifest string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v2/myorg/app/manifests/"+reference, strings.NewReader(manifest))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	images := map[string]string{
+		"amd64": `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "amd64 config") + `"}}`,
+		"arm64": `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "arm64 config") + `"}}`,
+	}
+	descriptors := []oci.Descriptor{}
+	for _, arch := range []string{"amd64", "arm64"} {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(images[arch])))
+		descriptors = append(descriptors, oci.Descriptor{
+			MediaType: oci.ImageManifestMediaType,
+			Digest:    digest,
+			Size:      int64(len(images[arch])),
+			Platform:  &oci.Platform{Architecture: arch, OS: "linux"},
+		})
+	}
+	index, err := json.Marshal(oci.NewImageIndex(descriptors))
+	require.NoError(t, err)
+
+	t.Run("missing images are unknown", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, do("PUT", descriptors[0].Digest, oci.ImageManifestMediaType, images["amd64"]).Code)
+
+		w := do("PUT", "v1", oci.ImageIndexMediaType, string(index))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "MANIFEST_BLOB_UNKNOWN")
+		assert.Equal(t, http.StatusNotFound, do("GET", "v1", "", "").Code)
+	})
+
+	require.Equal(t, http.StatusCreated, do("PUT", descriptors[1].Digest, oci.ImageManifestMediaType, images["arm64"]).Code)
+	w := do("PUT", "v1", oci.ImageIndexMediaType, string(index))
+	require.Equal(t, http.StatusCreated, w.Code)
+	indexDigest := w.Header().Get("Docker-Content-Digest")
+	assert.Equal(t, fmt.Sprintf("sha256:%x", sha256.Sum256(index)), indexDigest)
+
+	t.Run("pulled by tag as the index", func(t *testing.T) {
+		for _, method := range []string{"GET", "HEAD"} {
+			w := do(method, "v1", "", "")
+			require.Equal(t, http.StatusOK, w.Code, method)
+			assert.Equal(t, oci.ImageIndexMediaType, w.Header().Get("Content-Type"), method)
+			assert.Equal(t, indexDigest, w.Header().Get("Docker-Content-Digest"), method)
+		}
+
+		var pulled oci.ImageIndex
+		require.NoError(t, json.Unmarshal(do("GET", "v1", "", "").Body.Bytes(), &pulled))
+		require.Len(t, pulled.Manifests, 2)
+		assert.Equal(t, "arm64", pulled.Manifests[1].Platform.Architecture)
+	})
+
+	t.Run("platform images pulled by digest", func(t *testing.T) {
+		for _, descriptor := range descriptors {
+			w := do("GET", descriptor.Digest, "", "")
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, oci.ImageManifestMediaType, w.Header().Get("Content-Type"))
+			assert.Equal(t, descriptor.Digest, w.Header().Get("Docker-Content-Digest"))
+		}
+	})
+
+	t.Run("invalid index", func(t *testing.T) {
+		w := do("PUT", "v2", oci.ImageIndexMediaType, `{"manifests":`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "MANIFEST_INVALID")
+	})
+}
+
+// TestOCIManifestVerification verifies that a manifest is rejected when it
+// does not match the digest it is pushed by or refers to blobs not pushed yet
+func TestOCIManifestVerification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.Any("/v2/*path", handleOCIManifestCatchAll(registryService))
+
+	do := func(method, reference, manifest string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v2/myorg/app/manifests/"+reference, strings.NewReader(manifest))
+		req.Header.Set("Content-Type", oci.ImageManifestMediaType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	digestOf := func(content string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	}
+
+	config := pushTestBlob(t, registryService, "myorg/app", "config")
+	layer := pushTestBlob(t, registryService, "myorg/app", "layer")
+	image := fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q},"layers":[{"digest":%q}]}`, config, layer)
+
+	t.Run("digest mismatch", func(t *testing.T) {
+		other := digestOf(image + " ")
+		w := do("PUT", other, image)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "DIGEST_INVALID")
+		assert.Equal(t, http.StatusNotFound, do("GET", other, "").Code)
+
+		w = do("PUT", digestOf(image), image)
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, digestOf(image), w.Header().Get("Docker-Content-Digest"))
+	})
+
+	t.Run("missing blob", func(t *testing.T) {
+		missing := digestOf("never pushed")
+		w := do("PUT", "v1", fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q},"layers":[{"digest":%q},{"digest":%q}]}`, config, layer, missing))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "MANIFEST_BLOB_UNKNOWN")
+		assert.Contains(t, w.Body.String(), missing)
+		assert.Equal(t, http.StatusNotFound, do("GET", "v1", "").Code)
+
+		w = do("PUT", "v1", fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q}}`, missing))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "MANIFEST_BLOB_UNKNOWN")
+	})
+}
+
+// TestOCIManifestAcceptNegotiation verifies that manifests are served
+// according to the media types the client accepts
+func TestOCIManifestAcceptNegotiation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.Any("/v2/*path", handleOCIManifestCatchAll(registryService))
+
+	do := func(method, reference, contentType, manifest string, accept ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/v2/myorg/app/manifests/"+reference, strings.NewReader(manifest))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		for _, value := range accept {
+			req.Header.Add("Accept", value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	digestOf := func(content string) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	}
+
+	dockerImage := `{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "docker config") + `"}}`
+	require.Equal(t, http.StatusCreated, do("PUT", "docker", oci.DockerManifestMediaType, dockerImage).Code)
+
+	images := map[string]string{
+		"arm64": `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "arm64 config") + `"}}`,
+		"amd64": `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "amd64 config") + `"}}`,
+	}
+	descriptors := []oci.Descriptor{}
+	for _, arch := range []string{"arm64", "amd64"} {
+		require.Equal(t, http.StatusCreated, do("PUT", digestOf(images[arch]), oci.ImageManifestMediaType, images[arch]).Code)
+		descriptors = append(descriptors, oci.Descriptor{
+			MediaType: oci.ImageManifestMediaType,
+			Digest:    digestOf(images[arch]),
+			Size:      int64(len(images[arch])),
+			Platform:  &oci.Platform{Architecture: arch, OS: "linux"},
+		})
+	}
+	index, err := json.Marshal(oci.NewImageIndex(descriptors))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, do("PUT", "multi", oci.ImageIndexMediaType, string(index)).Code)
+
+	t.Run("client accepting only Docker v2 manifests", func(t *testing.T) {
+		for _, method := range []string{"GET", "HEAD"} {
+			w := do(method, "docker", "", "", oci.DockerManifestMediaType)
+			require.Equal(t, http.StatusOK, w.Code, method)
+			assert.Equal(t, oci.DockerManifestMediaType, w.Header().Get("Content-Type"), method)
+			assert.Equal(t, digestOf(dockerImage), w.Header().Get("Docker-Content-Digest"), method)
+
+			// The index only lists OCI images
+			assert.Equal(t, http.StatusNotAcceptable, do(method, "multi", "", "", oci.DockerManifestMediaType).Code, method)
+			assert.Equal(t, http.StatusNotAcceptable, do(method, digestOf(images["amd64"]), "", "", oci.DockerManifestMediaType).Code, method)
+		}
+		assert.Contains(t, do("GET", "multi", "", "", oci.DockerManifestMediaType).Body.String(), "MANIFEST_UNKNOWN")
+	})
+
+	t.Run("client accepting only OCI manifests", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotAcceptable, do("GET", "docker", "", "", oci.ImageManifestMediaType).Code)
+
+		// The index is replaced by its linux/amd64 image
+		for _, method := range []string{"GET", "HEAD"} {
+			w := do(method, "multi", "", "", oci.ImageManifestMediaType+", application/json;q=0.5")
+			require.Equal(t, http.StatusOK, w.Code, method)
+			assert.Equal(t, oci.ImageManifestMediaType, w.Header().Get("Content-Type"), method)
+			assert.Equal(t, digestOf(images["amd64"]), w.Header().Get("Docker-Content-Digest"), method)
+			assert.Equal(t, fmt.Sprint(len(images["amd64"])), w.Header().Get("Content-Length"), method)
+		}
+		assert.Equal(t, images["amd64"], do("GET", "multi", "", "", oci.ImageManifestMediaType).Body.String())
+	})
+
+	t.Run("client accepting indexes", func(t *testing.T) {
+		for _, accept := range [][]string{
+			nil,
+			{"*/*"},
+			{oci.DockerManifestMediaType, oci.ImageManifestMediaType + "," + oci.ImageIndexMediaType},
+		} {
+			w := do("GET", "multi", "", "", accept...)
+			require.Equal(t, http.StatusOK, w.Code, accept)
+			assert.Equal(t, oci.ImageIndexMediaType, w.Header().Get("Content-Type"), accept)
+			assert.Equal(t, string(index), w.Body.String(), accept)
+		}
+
+		// A media type with q=0 is not accepted
+		w := do("GET", "multi", "", "", oci.ImageIndexMediaType+";q=0", oci.ImageManifestMediaType)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, digestOf(images["amd64"]), w.Header().Get("Docker-Content-Digest"))
+	})
+}
+
+func TestOCIBlobMount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.POST("/v2/*path", handleOCIBlobUploadCatchAll(registryService))
+	router.GET("/v2/*path", handleOCIBlobCatchAll(registryService))
+
+	content := []byte("shared layer")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	require.NoError(t, registryService.Storage.Store(context.Background(), "oci/myorg/src/blobs/"+digest, bytes.NewReader(content), "application/octet-stream"))
+
+	t.Run("existing blob is mounted", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v2/myorg/dst/blobs/uploads/?mount="+digest+"&from=myorg/src", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "/v2/myorg/dst/blobs/"+digest, w.Header().Get("Location"))
+		assert.Equal(t, digest, w.Header().Get("Docker-Content-Digest"))
+
+		req = httptest.NewRequest("GET", "/v2/myorg/dst/blobs/"+digest, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.Bytes())
+	})
+
+	t.Run("missing source starts an upload", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v2/myorg/dst/blobs/uploads/?mount=sha256:"+strings.Repeat("0", 64)+"&from=myorg/src", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Docker-Upload-UUID"))
+	})
+}
+
+func TestOCIBlobThrottled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+	registryService.Configure(config.RegistryConfig{OCIStrictNames: true, DownloadRateAnonymous: 100 << 10})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(throttle.WithClient(c.Request.Context(), func() throttle.Client {
+			return throttle.Client{ID: "192.0.2.1"}
+		}))
+		c.Next()
+	})
+	router.GET("/v2/*path", handleOCIBlobCatchAll(registryService))
+
+	content := bytes.Repeat([]byte("x"), 50<<10)
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+	require.NoError(t, registryService.Storage.Store(context.Background(), "oci/myorg/app/blobs/"+digest, bytes.NewReader(content), "application/octet-stream"))
+
+	for name, rangeHeader := range map[string]string{"whole blob": "", "range": "bytes=0-"} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v2/myorg/app/blobs/"+digest, nil)
+			if rangeHeader != "" {
+				req.Header.Set("Range", rangeHeader)
+			}
+			w := httptest.NewRecorder()
+
+			start := time.Now()
+			router.ServeHTTP(w, req)
+			elapsed := time.Since(start)
+
+			// 50KiB at 100KiB/s, less the initial burst of a tenth of a second
+			require.Contains(t, []int{http.StatusOK, http.StatusPartialContent}, w.Code)
+			assert.Equal(t, content, w.Body.Bytes())
+			assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+		})
+	}
+}
+
+func TestOCIBlobUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	for _, method := range []string{"POST", "PATCH", "PUT"} {
+		router.Handle(method, "/v2/*path", handleOCIBlobUploadCatchAll(registryService))
+	}
+	router.GET("/v2/*path", handleOCIBlobCatchAll(registryService))
+
+	serve := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		return w
+	}
+	assertBlob := func(t *testing.T, digest string, content []byte) {
+		w := serve("GET", "/v2/myorg/app/blobs/"+digest, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.Bytes())
+
+		var artifact types.Artifact
+		require.NoError(t, registryService.DB.Where("registry = ? AND name = ? AND version = ?", "oci", "myorg/app", digest).First(&artifact).Error)
+		assert.Equal(t, int64(len(content)), artifact.Size)
+	}
+
+	t.Run("monolithic upload", func(t *testing.T) {
+		content := []byte("monolithic layer")
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+
+		w := serve("POST", "/v2/myorg/app/blobs/uploads/?digest="+digest, content)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, "/v2/myorg/app/blobs/"+digest, w.Header().Get("Location"))
+		assert.Equal(t, digest, w.Header().Get("Docker-Content-Digest"))
+		assertBlob(t, digest, content)
+	})
+
+	t.Run("monolithic upload with wrong digest", func(t *testing.T) {
+		digest := "sha256:" + strings.Repeat("0", 64)
+
+		w := serve("POST", "/v2/myorg/app/blobs/uploads/?digest="+digest, []byte("tampered layer"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "DIGEST_INVALID")
+		assert.Equal(t, http.StatusNotFound, serve("GET", "/v2/myorg/app/blobs/"+digest, nil).Code)
+	})
+
+	t.Run("session upload", func(t *testing.T) {
+		content := []byte("chunked layer")
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+
+		w := serve("POST", "/v2/myorg/app/blobs/uploads/", nil)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		location := w.Header().Get("Location")
+		require.NotEmpty(t, location)
+
+		w = serve("PATCH", location, content)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+		w = serve("PUT", location+"?digest="+digest, nil)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		assert.Equal(t, digest, w.Header().Get("Docker-Content-Digest"))
+		assertBlob(t, digest, content)
+	})
+}
+
+// TestOCIQuotaEnforced verifies that blobs and manifests over the user's
+// quota are refused before anything is stored or recorded
+func TestOCIQuotaEnforced(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	require.NoError(t, registryService.Quotas.SetQuota(ctx, &types.Quota{UserID: user.ID, RegistryName: "oci", MaxBytes: 20}, user.ID))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	for _, method := range []string{"POST", "PATCH", "PUT"} {
+		router.Handle(method, "/v2/*path", handleOCIBlobUploadCatchAll(registryService))
+	}
+	router.GET("/v2/*path", handleOCIBlobCatchAll(registryService))
+	manifests := gin.New()
+	manifests.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	manifests.PUT("/v2/*path", handleOCIManifestCatchAll(registryService))
+
+	serve := func(router *gin.Engine, method, path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		return w
+	}
+	assertDenied := func(t *testing.T, w *httptest.ResponseRecorder) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Contains(t, w.Body.String(), "DENIED")
+	}
+	recorded := func(name, digest string) bool {
+		var count int64
+		require.NoError(t, registryService.DB.Model(&types.Artifact{}).Where("registry = ? AND name = ? AND version = ?", "oci", name, digest).Count(&count).Error)
+		return count > 0
+	}
+
+	// The first blob fills most of the quota
+	first := []byte("sixteen byte blb")
+	firstDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(first))
+	require.Equal(t, http.StatusCreated, serve(router, "POST", "/v2/myorg/app/blobs/uploads/?digest="+firstDigest, first).Code)
+
+	content := []byte("eight by")
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+
+	t.Run("monolithic upload", func(t *testing.T) {
+		assertDenied(t, serve(router, "POST", "/v2/myorg/app/blobs/uploads/?digest="+digest, content))
+		assert.Equal(t, http.StatusNotFound, serve(router, "GET", "/v2/myorg/app/blobs/"+digest, nil).Code)
+		assert.False(t, recorded("myorg/app", digest))
+	})
+
+	t.Run("session upload", func(t *testing.T) {
+		w := serve(router, "POST", "/v2/myorg/app/blobs/uploads/", nil)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		location := w.Header().Get("Location")
+
+		assertDenied(t, serve(router, "PATCH", location, content))
+		assertDenied(t, serve(router, "PUT", location+"?digest="+digest, content))
+		assert.Equal(t, http.StatusNotFound, serve(router, "GET", "/v2/myorg/app/blobs/"+digest, nil).Code)
+		assert.False(t, recorded("myorg/app", digest))
+	})
+
+	t.Run("mount", func(t *testing.T) {
+		require.NoError(t, registryService.Storage.Store(ctx, "oci/myorg/src/blobs/"+digest, bytes.NewReader(content), "application/octet-stream"))
+
+		assertDenied(t, serve(router, "POST", "/v2/myorg/dst/blobs/uploads/?mount="+digest+"&from=myorg/src", nil))
+		assert.False(t, recorded("myorg/dst", digest))
+	})
+
+	t.Run("manifest", func(t *testing.T) {
+		manifest := `{"schemaVersion":2,"config":{"digest":"` + firstDigest + `"}}`
+		req := httptest.NewRequest("PUT", "/v2/myorg/app/manifests/v1", strings.NewReader(manifest))
+		req.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w := httptest.NewRecorder()
+		manifests.ServeHTTP(w, req)
+		assertDenied(t, w)
+
+		handler, err := registryService.GetRegistry("oci")
+		require.NoError(t, err)
+		exists, _, _, _, err := handler.(*oci.Registry).ManifestExists(ctx, "myorg/app", "v1")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+}
+
+func TestOCIBlobUploadChunks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(other).Error)
+
+	current := user
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", current)
+		c.Next()
+	})
+	for _, method := range []string{"POST", "PATCH", "PUT", "GET", "DELETE"} {
+		router.Handle(method, "/v2/*path", handleOCIBlobUploadCatchAll(registryService))
+	}
+
+	serve := func(method, path, contentRange string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if contentRange != "" {
+			req.Header.Set("Content-Range", contentRange)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	startUpload := func(t *testing.T) string {
+		w := serve("POST", "/v2/myorg/app/blobs/uploads/", "", nil)
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		return w.Header().Get("Location")
+	}
+
+	t.Run("contiguous chunks", func(t *testing.T) {
+		content := []byte("first chunk, second chunk")
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+		location := startUpload(t)
+
+		w := serve("PATCH", location, "0-11", content[:12])
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		assert.Equal(t, "0-11", w.Header().Get("Range"))
+
+		w = serve("PATCH", location, "12-24", content[12:])
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		assert.Equal(t, "0-24", w.Header().Get("Range"))
+
+		w = serve("PUT", location+"?digest="+digest, "", nil)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	})
+
+	t.Run("gap", func(t *testing.T) {
+		location := startUpload(t)
+		require.Equal(t, http.StatusAccepted, serve("PATCH", location, "0-4", []byte("hello")).Code)
+
+		w := serve("PATCH", location, "10-14", []byte("world"))
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+		assert.Equal(t, "0-4", w.Header().Get("Range"))
+		assert.Contains(t, w.Body.String(), "BLOB_UPLOAD_INVALID")
+
+		// The upload carries on from where it was
+		w = serve("PATCH", location, "5-9", []byte("world"))
+		require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+		assert.Equal(t, "0-9", w.Header().Get("Range"))
+	})
+
+	t.Run("overlap", func(t *testing.T) {
+		location := startUpload(t)
+		require.Equal(t, http.StatusAccepted, serve("PATCH", location, "0-4", []byte("hello")).Code)
+
+		w := serve("PATCH", location, "3-7", []byte("lowor"))
+		assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, w.Code)
+		assert.Equal(t, "0-4", w.Header().Get("Range"))
+
+		w = serve("GET", location, "", nil)
+		require.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "0-4", w.Header().Get("Range"))
+	})
+
+	t.Run("range not matching the chunk", func(t *testing.T) {
+		location := startUpload(t)
+
+		w := serve("PATCH", location, "0-9", []byte("hello"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = serve("PATCH", location, "bytes", []byte("hello"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("session of another user", func(t *testing.T) {
+		location := startUpload(t)
+
+		current = other
+		defer func() { current = user }()
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("hello")))
+		for _, method := range []string{"PATCH", "PUT", "GET", "DELETE"} {
+			w := serve(method, location+"?digest="+digest, "", []byte("hello"))
+			assert.Equal(t, http.StatusNotFound, w.Code, method)
+			assert.Contains(t, w.Body.String(), "BLOB_UPLOAD_UNKNOWN", method)
+		}
+	})
+
+	t.Run("session of another repository", func(t *testing.T) {
+		location := startUpload(t)
+
+		w := serve("PATCH", strings.Replace(location, "myorg/app", "myorg/other", 1), "", []byte("hello"))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestDockerTokenScopeEnforcement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	require.NoError(t, registryService.DB.AutoMigrate(&types.APIKey{}))
+	authService := auth.NewService(registryService.DB, nil, &config.AuthConfig{JWTSecret: "test-secret", BCryptCost: 4})
+
+	_, apiKey, err := authService.CreateAPIKey(context.Background(), user.ID, "docker", nil, nil)
+	require.NoError(t, err)
+
+	router := gin.New()
+	OCIRootRoutes(router, registryService, authService)
+
+	requestToken := func(scope string) string {
+		req := httptest.NewRequest("GET", "/v2/token?service=registry&scope="+scope, nil)
+		req.SetBasicAuth(user.Username, apiKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Token     string `json:"token"`
+			Scope     string `json:"scope"`
+			ExpiresIn int    `json:"expires_in"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotEqual(t, apiKey, response.Token, "token must not be the raw API key")
+		assert.Equal(t, scope, response.Scope)
+		assert.Equal(t, 3600, response.ExpiresIn)
+		return response.Token
+	}
+
+	manifest := `{"schemaVersion":2,"config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "config") + `"}}`
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		var body io.Reader
+		if method == "PUT" {
+			body = strings.NewReader(manifest)
+		}
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("pull token cannot push", func(t *testing.T) {
+		token := requestToken("repository:myorg/app:pull")
+
+		w := do("PUT", "/v2/myorg/app/manifests/v1", token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), `scope="repository:myorg/app:push"`)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+
+		w = do("POST", "/v2/myorg/app/blobs/uploads/", token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("push token can push and pull", func(t *testing.T) {
+		token := requestToken("repository:myorg/app:pull,push")
+
+		require.Equal(t, http.StatusCreated, do("PUT", "/v2/myorg/app/manifests/v1", token).Code)
+		assert.Equal(t, http.StatusOK, do("GET", "/v2/myorg/app/manifests/v1", token).Code)
+	})
+
+	t.Run("token is limited to its repository", func(t *testing.T) {
+		token := requestToken("repository:myorg/other:pull,push")
+
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/v2/myorg/app/manifests/v1", token).Code)
+		assert.Equal(t, http.StatusUnauthorized, do("PUT", "/v2/myorg/app/manifests/v2", token).Code)
+	})
+
+	t.Run("API keys are not limited by scope", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, do("GET", "/v2/myorg/app/manifests/v1", apiKey).Code)
+	})
+
+	t.Run("tokens for scoped API keys are limited to the key's scopes", func(t *testing.T) {
+		tokenFor := func(key, scope string) (string, string) {
+			req := httptest.NewRequest("GET", "/v2/token?service=registry&scope="+url.QueryEscape(scope), nil)
+			req.SetBasicAuth(user.Username, key)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code)
+
+			var response struct {
+				Token string `json:"token"`
+				Scope string `json:"scope"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			return response.Token, response.Scope
+		}
+
+		_, npmKey, err := authService.CreateAPIKey(context.Background(), user.ID, "npm", nil, []string{"npm:@myorg/*"})
+		require.NoError(t, err)
+		token, granted := tokenFor(npmKey, "repository:myorg/app:pull,push registry:catalog:*")
+		assert.Empty(t, granted)
+		assert.Equal(t, http.StatusForbidden, do("GET", "/v2/myorg/app/manifests/v1", token).Code)
+		assert.Equal(t, http.StatusForbidden, do("PUT", "/v2/myorg/app/manifests/v2", token).Code)
+
+		_, ociKey, err := authService.CreateAPIKey(context.Background(), user.ID, "oci", nil, []string{"oci:myorg/other"})
+		require.NoError(t, err)
+		token, granted = tokenFor(ociKey, "repository:myorg/app:pull repository:myorg/other:pull registry:catalog:*")
+		assert.Equal(t, "repository:myorg/other:pull", granted)
+		assert.Equal(t, http.StatusForbidden, do("GET", "/v2/myorg/app/manifests/v1", token).Code)
+		assert.Equal(t, http.StatusUnauthorized, do("GET", "/v2/_catalog", token).Code)
+	})
+}
+
+func TestOCITagsListPagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	handler, err := registryService.GetRegistry("oci")
+	require.NoError(t, err)
+	ociRegistry := handler.(*oci.Registry)
+
+	// Pushed out of order, and with a manifest pushed by digest that is not a tag
+	ctx := context.Background()
+	manifest := `{"schemaVersion":2,"config":{"digest":"` + pushTestBlob(t, registryService, "myorg/app", "config") + `"}}`
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+	for _, reference := range []string{"v3", "latest", "v1", "v2", digest} {
+		_, err := ociRegistry.PutManifest(ctx, "myorg/app", reference, strings.NewReader(manifest), "application/vnd.oci.image.manifest.v1+json")
+		require.NoError(t, err)
+	}
+	for _, name := range []string{"myorg/web", "myorg/app", "base", "myorg/app"} {
+		require.NoError(t, registryService.DB.Create(&types.Artifact{Name: name, Version: digest, Registry: "oci", PublishedBy: user.ID}).Error)
+	}
+
+	router := gin.New()
+	router.GET("/v2/*path", func(c *gin.Context) {
+		if c.Param("path") == "/_catalog" {
+			c.Set("user", user)
+			handleOCICatalog(registryService)(c)
+			return
+		}
+		c.Params = append(c.Params, gin.Param{Key: "name", Value: strings.TrimSuffix(strings.TrimPrefix(c.Param("path"), "/"), "/tags/list")})
+		handleOCITagsList(registryService)(c)
+	})
+	get := func(path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w, body
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		key     string
+		entries []interface{}
+		link    string
+	}{
+		{"all tags sorted", "/v2/myorg/app/tags/list", "tags", []interface{}{"latest", "v1", "v2", "v3"}, ""},
+		{"first page", "/v2/myorg/app/tags/list?n=2", "tags", []interface{}{"latest", "v1"}, `</v2/myorg/app/tags/list?last=v1&n=2>; rel="next"`},
+		{"next page", "/v2/myorg/app/tags/list?n=2&last=v1", "tags", []interface{}{"v2", "v3"}, ""},
+		{"last without n", "/v2/myorg/app/tags/list?last=v2", "tags", []interface{}{"v3"}, ""},
+		{"last between tags", "/v2/myorg/app/tags/list?n=1&last=u", "tags", []interface{}{"v1"}, `</v2/myorg/app/tags/list?last=v1&n=1>; rel="next"`},
+		{"past the end", "/v2/myorg/app/tags/list?n=2&last=v3", "tags", []interface{}{}, ""},
+		{"n of zero", "/v2/myorg/app/tags/list?n=0", "tags", []interface{}{}, ""},
+		{"unknown repository", "/v2/myorg/none/tags/list?n=2", "tags", []interface{}{}, ""},
+		{"catalog sorted", "/v2/_catalog", "repositories", []interface{}{"base", "myorg/app", "myorg/web"}, ""},
+		{"catalog first page", "/v2/_catalog?n=2", "repositories", []interface{}{"base", "myorg/app"}, `</v2/_catalog?last=myorg%2Fapp&n=2>; rel="next"`},
+		{"catalog next page", "/v2/_catalog?n=2&last=myorg%2Fapp", "repositories", []interface{}{"myorg/web"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, body := get(tt.path)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, tt.entries, body[tt.key])
+			assert.Equal(t, tt.link, w.Header().Get("Link"))
+		})
+	}
+
+	for _, path := range []string{"/v2/myorg/app/tags/list?n=-1", "/v2/_catalog?n=many"} {
+		w, body := get(path)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, fmt.Sprint(body["errors"]), "PAGINATION_NUMBER_INVALID")
+	}
+}
+
+// TestOCICatalogLargerThanPage verifies that a catalog with more repositories
+// than fit in a page is served a page at a time
+func TestOCICatalogLargerThanPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	artifacts := make([]*types.Artifact, 0, registry.MaxListLimit+2)
+	for i := 0; i < registry.MaxListLimit+2; i++ {
+		name := fmt.Sprintf("myorg/app-%04d", i)
+		artifacts = append(artifacts, &types.Artifact{Name: name, Version: "sha256:aaaa", Registry: "oci", StoragePath: name, PublishedBy: user.ID})
+	}
+	require.NoError(t, registryService.DB.CreateInBatches(artifacts, 200).Error)
+
+	router := gin.New()
+	router.GET("/v2/_catalog", func(c *gin.Context) {
+		c.Set("user", user)
+		handleOCICatalog(registryService)(c)
+	})
+	get := func(path string) (*httptest.ResponseRecorder, []string) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body struct {
+			Repositories []string `json:"repositories"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w, body.Repositories
+	}
+
+	// Without n, and with a larger n, pages are capped
+	for _, path := range []string{"/v2/_catalog", "/v2/_catalog?n=5000"} {
+		w, repositories := get(path)
+		require.Len(t, repositories, registry.MaxListLimit, path)
+		assert.Equal(t, "myorg/app-0000", repositories[0], path)
+		assert.Equal(t, fmt.Sprintf(`</v2/_catalog?last=myorg%%2Fapp-0999&n=%d>; rel="next"`, registry.MaxListLimit), w.Header().Get("Link"), path)
+	}
+
+	w, repositories := get("/v2/_catalog?last=myorg%2Fapp-0999&n=1000")
+	assert.Equal(t, []string{"myorg/app-1000", "myorg/app-1001"}, repositories)
+	assert.Empty(t, w.Header().Get("Link"))
+}
+
+// TestOCICatalogAccess verifies that the catalog lists only the repositories
+// the caller can read, optionally filtered by prefix
+func TestOCICatalogAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	db := registryService.DB
+	maintainer := &types.User{Username: "maintainer", Email: "maintainer@example.com", Password: "hashed", IsActive: true}
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	for _, user := range []*types.User{maintainer, other, admin} {
+		require.NoError(t, db.Create(user).Error)
+	}
+
+	for _, artifact := range []*types.Artifact{
+		{Name: "myorg/public", Version: "sha256:aaaa", Registry: "oci", PublishedBy: publisher.ID, IsPublic: true},
+		{Name: "myorg/private", Version: "sha256:bbbb", Registry: "oci", PublishedBy: publisher.ID},
+		{Name: "myorg/shared", Version: "sha256:cccc", Registry: "oci", PublishedBy: publisher.ID},
+		{Name: "other/public", Version: "sha256:dddd", Registry: "oci", PublishedBy: publisher.ID, IsPublic: true},
+		{Name: "myorg/npm-only", Version: "1.0.0", Registry: "npm", PublishedBy: other.ID, IsPublic: true},
+	} {
+		require.NoError(t, db.Create(artifact).Error)
+	}
+	require.NoError(t, db.Create(&types.PackageOwnership{
+		PackageKey: "oci:myorg/shared", UserID: maintainer.ID, Role: registry.RoleMaintainer, GrantedBy: publisher.ID, GrantedAt: time.Now(),
+	}).Error)
+
+	catalog := func(user *types.User, query string) []string {
+		router := gin.New()
+		router.GET("/v2/_catalog", func(c *gin.Context) {
+			if user != nil {
+				c.Set("user", user)
+			}
+			handleOCICatalog(registryService)(c)
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v2/_catalog"+query, nil))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body struct {
+			Repositories []string `json:"repositories"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body.Repositories
+	}
+
+	tests := []struct {
+		name  string
+		user  *types.User
+		query string
+		want  []string
+	}{
+		{"publisher sees their private repositories", publisher, "", []string{"myorg/private", "myorg/public", "myorg/shared", "other/public"}},
+		{"maintainer sees shared repository", maintainer, "", []string{"myorg/public", "myorg/shared", "other/public"}},
+		{"other user sees public only", other, "", []string{"myorg/public", "other/public"}},
+		{"anonymous sees public only", nil, "", []string{"myorg/public", "other/public"}},
+		{"admin sees everything", admin, "", []string{"myorg/private", "myorg/public", "myorg/shared", "other/public"}},
+		{"prefix", publisher, "?prefix=myorg/", []string{"myorg/private", "myorg/public", "myorg/shared"}},
+		{"prefix with page", other, "?prefix=myorg/&last=myorg/a", []string{"myorg/public"}},
+		{"prefix matches nothing", admin, "?prefix=none/", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, catalog(tt.user, tt.query))
+		})
+	}
+
+	t.Run("next page keeps prefix", func(t *testing.T) {
+		router := gin.New()
+		router.GET("/v2/_catalog", func(c *gin.Context) {
+			c.Set("user", admin)
+			handleOCICatalog(registryService)(c)
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v2/_catalog?n=1&prefix=myorg/", nil))
+		assert.Equal(t, `</v2/_catalog?last=myorg%2Fprivate&n=1&prefix=myorg%2F>; rel="next"`, w.Header().Get("Link"))
+	})
+}
+
+// TestOCIPrivateRepositoryPull verifies that a private repository hidden
+// from a user in the catalog cannot be pulled by them either, and is
+// reported as unknown rather than forbidden
+func TestOCIPrivateRepositoryPull(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(other).Error)
+
+	var current *types.User
+	router := gin.New()
+	router.Use(middleware.PackageReaderMiddleware(), func(c *gin.Context) {
+		if current != nil {
+			c.Set("user", current)
+		}
+		c.Next()
+	})
+	router.Any("/v2/*path", func(c *gin.Context) {
+		switch {
+		case strings.HasSuffix(c.Param("path"), "/tags/list"):
+			handleOCITagsListCatchAll(registryService)(c)
+		case strings.Contains(c.Param("path"), "/blobs/uploads/"):
+			handleOCIBlobUploadCatchAll(registryService)(c)
+		case strings.Contains(c.Param("path"), "/blobs/"):
+			handleOCIBlobCatchAll(registryService)(c)
+		default:
+			handleOCIManifestCatchAll(registryService)(c)
+		}
+	})
+	serve := func(user *types.User, method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+		current = user
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	configDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(config))
+	w := serve(publisher, "POST", "/v2/myorg/secret/blobs/uploads/?digest="+configDigest, "", config)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     oci.ImageManifestMediaType,
+		"config":        oci.Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: configDigest, Size: int64(len(config))},
+		"layers":        []oci.Descriptor{},
+	})
+	require.NoError(t, err)
+	w = serve(publisher, "PUT", "/v2/myorg/secret/manifests/v1", oci.ImageManifestMediaType, manifest)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	setPublic := func(public bool) {
+		require.NoError(t, registryService.DB.Model(&types.Artifact{}).
+			Where("registry = ? AND name = ?", "oci", "myorg/secret").
+			Update("is_public", public).Error)
+	}
+	setPublic(false)
+
+	pulls := []struct{ method, path string }{
+		{"GET", "/v2/myorg/secret/manifests/v1"},
+		{"HEAD", "/v2/myorg/secret/manifests/v1"},
+		{"GET", "/v2/myorg/secret/blobs/" + configDigest},
+		{"HEAD", "/v2/myorg/secret/blobs/" + configDigest},
+		{"GET", "/v2/myorg/secret/tags/list"},
+	}
+	for _, pull := range pulls {
+		t.Run(pull.method+" "+pull.path, func(t *testing.T) {
+			assert.Equal(t, http.StatusOK, serve(publisher, pull.method, pull.path, "", nil).Code)
+
+			for _, user := range []*types.User{other, nil} {
+				w := serve(user, pull.method, pull.path, "", nil)
+				assert.Equal(t, http.StatusNotFound, w.Code)
+				if pull.method == "GET" {
+					assert.Contains(t, w.Body.String(), "NAME_UNKNOWN")
+				}
+			}
+		})
+	}
+
+	t.Run("not revealed by a missing repository", func(t *testing.T) {
+		hidden := serve(other, "GET", "/v2/myorg/secret/tags/list", "", nil)
+		missing := serve(other, "GET", "/v2/myorg/missing/tags/list", "", nil)
+		assert.Equal(t, missing.Code, hidden.Code)
+		assert.JSONEq(t, strings.ReplaceAll(missing.Body.String(), "missing", "secret"), hidden.Body.String())
+	})
+
+	t.Run("readable once public", func(t *testing.T) {
+		setPublic(true)
+		assert.Equal(t, http.StatusOK, serve(other, "GET", "/v2/myorg/secret/manifests/v1", "", nil).Code)
+	})
+}
+
+// TestOCIHelmChart verifies that a chart pushed the way helm push does can be
+// pulled over OCI and from the classic chart repository
+func TestOCIHelmChart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.Any("/v2/*path", func(c *gin.Context) {
+		switch {
+		case strings.Contains(c.Param("path"), "/blobs/uploads/"):
+			handleOCIBlobUploadCatchAll(registryService)(c)
+		case strings.Contains(c.Param("path"), "/blobs/"):
+			handleOCIBlobCatchAll(registryService)(c)
+		default:
+			handleOCIManifestCatchAll(registryService)(c)
+		}
+	})
+	router.GET("/helm/index.yaml", handleHelmIndex(registryService))
+	router.GET("/helm/:chart/:version/:filename", handleHelmDownload(registryService))
+
+	serve := func(method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	pushBlob := func(content []byte) string {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+		w := serve("POST", "/v2/charts/mychart/blobs/uploads/?digest="+digest, "", content)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		return digest
+	}
+
+	chart := createHelmChart(t, "mychart", "apiVersion: v2\nname: mychart\nversion: 1.2.3\n")
+	chartConfig := []byte(`{"apiVersion":"v2","name":"mychart","version":"1.2.3"}`)
+	chartLayer := oci.Descriptor{MediaType: oci.HelmChartMediaType, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(chart)), Size: int64(len(chart))}
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     oci.ImageManifestMediaType,
+		"config":        oci.Descriptor{MediaType: oci.HelmConfigMediaType, Digest: fmt.Sprintf("sha256:%x", sha256.Sum256(chartConfig)), Size: int64(len(chartConfig))},
+		"layers":        []oci.Descriptor{chartLayer},
+	})
+	require.NoError(t, err)
+
+	t.Run("missing chart layer is unknown", func(t *testing.T) {
+		w := serve("PUT", "/v2/charts/mychart/manifests/1.2.3", oci.ImageManifestMediaType, manifest)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "MANIFEST_BLOB_UNKNOWN")
+	})
+
+	pushBlob(chartConfig)
+	pushBlob(chart)
+	w := serve("PUT", "/v2/charts/mychart/manifests/1.2.3", oci.ImageManifestMediaType, manifest)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	t.Run("pulled over OCI", func(t *testing.T) {
+		w := serve("GET", "/v2/charts/mychart/manifests/1.2.3", "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		layers, ok := oci.HelmChart(w.Body.Bytes())
+		require.True(t, ok)
+		assert.Equal(t, chartLayer.Digest, layers.Chart.Digest)
+
+		w = serve("GET", "/v2/charts/mychart/blobs/"+chartLayer.Digest, "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, chart, w.Body.Bytes())
+	})
+
+	t.Run("pulled from the chart repository", func(t *testing.T) {
+		w := serve("GET", "/helm/index.yaml", "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var index helm.IndexFile
+		require.NoError(t, yaml.Unmarshal(w.Body.Bytes(), &index))
+		require.Len(t, index.Entries["mychart"], 1)
+		assert.Equal(t, "1.2.3", index.Entries["mychart"][0].Version)
+
+		w = serve("GET", "/helm/mychart/1.2.3/mychart-1.2.3.tgz", "", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, chart, w.Body.Bytes())
+	})
+
+	t.Run("pushed again", func(t *testing.T) {
+		w := serve("PUT", "/v2/charts/mychart/manifests/1.2.3", oci.ImageManifestMediaType, manifest)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		var count int64
+		require.NoError(t, registryService.DB.Model(&types.Artifact{}).Where("registry = ? AND name = ?", "helm", "mychart").Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+	})
+}
+
+func TestOCIPublishRequest(t *testing.T) {
+	tests := []struct {
+		method  string
+		path    string
+		publish bool
+	}{
+		{http.MethodPut, "/v2/myorg/app/manifests/latest", true},
+		{http.MethodDelete, "/v2/myorg/app/manifests/sha256:abc", true},
+		{http.MethodDelete, "/v2/myorg/app/blobs/sha256:abc", true},
+		{http.MethodPost, "/v2/myorg/app/blobs/uploads/", false},
+		{http.MethodPatch, "/v2/myorg/app/blobs/uploads/123", false},
+		{http.MethodPut, "/v2/myorg/app/blobs/uploads/123", false},
+		{http.MethodDelete, "/v2/myorg/app/blobs/uploads/123", false},
+		{http.MethodPost, "/v2/token", false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(tt.method, tt.path, nil)
+		assert.Equal(t, tt.publish, OCIPublishRequest(c), "%s %s", tt.method, tt.path)
+	}
+}
@@ -2,10 +2,10 @@ package routes
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
@@ -17,6 +17,7 @@ import (
 // OPARoutes sets up Open Policy Agent bundle repository routes
 func OPARoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	opa := api.Group("/opa")
+	opa.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("opa")))
 
 	// OPA bundle API - requires authentication
 	opa.GET("/bundles/:name", middleware.AuthMiddleware(authService), handleOPABundleDownload(registryService))
@@ -57,26 +58,24 @@ func handleOPABundleDownload(registryService *registry.Service) gin.HandlerFunc
 			return
 		}
 
-		artifact := artifacts[0]
-		_, content, err := registryService.Download(ctx, "opa", bundleName, artifact.Version)
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "opa", bundleName, artifacts[0].Version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "bundle not found"})
 			return
 		}
 
-		c.Header("Content-Type", "application/gzip")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.tar.gz", bundleName))
 		c.Header("ETag", fmt.Sprintf(`"%s"`, artifact.SHA256))
 
-		if artifact.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
-		}
-
 		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream bundle"})
-			return
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("bundle", bundleName).Msg("Failed to stream bundle")
 		}
 	}
 }
@@ -93,94 +92,67 @@ func handleOPABundleVersionDownload(registryService *registry.Service) gin.Handl
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "opa")
 
-		artifact, content, err := registryService.Download(ctx, "opa", bundleName, version)
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "opa", bundleName, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "bundle version not found"})
 			return
 		}
 
-		c.Header("Content-Type", "application/gzip")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.tar.gz", bundleName, version))
 		c.Header("ETag", fmt.Sprintf(`"%s"`, artifact.SHA256))
 
-		if artifact.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
-		}
-
 		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream bundle"})
-			return
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("bundle", bundleName).Str("version", version).Msg("Failed to stream bundle")
 		}
 	}
 }
 
+// handleOPABundleList lists a page of bundles, most downloaded first, each
+// with its latest version; total counts every bundle
 func handleOPABundleList(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := context.WithValue(c.Request.Context(), "registry", "opa")
 
-		filter := &types.ArtifactFilter{
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		offset, _ := strconv.Atoi(c.Query("offset"))
+		page, total, err := registryService.SearchPackages(ctx, &registry.PackageSearch{
 			Registry: "opa",
-		}
-
-		artifacts, _, err := registryService.List(ctx, filter)
+			Limit:    limit,
+			Offset:   offset,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list bundles"})
 			return
 		}
 
-		// Group bundles by name and show latest version info
-		bundles := make(map[string]gin.H)
-		for _, artifact := range artifacts {
-			bundleInfo, exists := bundles[artifact.Name]
-			if !exists {
-				var description string
-				if artifact.Metadata != nil {
-					if desc, ok := artifact.Metadata["description"].(string); ok {
-						description = desc
-					}
-				}
-
-				bundles[artifact.Name] = gin.H{
-					"name":        artifact.Name,
-					"version":     artifact.Version,
-					"description": description,
-					"created_at":  artifact.CreatedAt,
-					"size":        artifact.Size,
-				}
-			} else {
-				// Compare timestamps to get the latest version
-				if existingTime, ok := bundleInfo["created_at"].(time.Time); ok {
-					if artifact.CreatedAt.After(existingTime) {
-						var description string
-						if artifact.Metadata != nil {
-							if desc, ok := artifact.Metadata["description"].(string); ok {
-								description = desc
-							}
-						}
-
-						bundles[artifact.Name] = gin.H{
-							"name":        artifact.Name,
-							"version":     artifact.Version,
-							"description": description,
-							"created_at":  artifact.CreatedAt,
-							"size":        artifact.Size,
-						}
-					}
-				}
+		bundleList := make([]gin.H, 0, len(page))
+		for _, versions := range page {
+			// Versions are loaded in publication order
+			artifact := versions[len(versions)-1]
+			var description string
+			if desc, ok := artifact.Metadata["description"].(string); ok {
+				description = desc
 			}
-		}
 
-		// Convert map to slice
-		bundleList := make([]gin.H, 0, len(bundles))
-		for _, bundle := range bundles {
-			bundleList = append(bundleList, bundle)
+			bundleList = append(bundleList, gin.H{
+				"name":        artifact.Name,
+				"version":     artifact.Version,
+				"description": description,
+				"created_at":  artifact.CreatedAt,
+				"size":        artifact.Size,
+			})
 		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"bundles": bundleList,
-			"total":   len(bundleList),
+			"total":   total,
 		})
 	}
 }
@@ -210,12 +182,12 @@ func handleOPABundleUpload(registryService *registry.Service) gin.HandlerFunc {
 		}
 
 		_, err := registryService.Upload(ctx, "opa", bundleName, version, c.Request.Body, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+		status, ok := uploadStatus(c, err, http.StatusCreated)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
+		c.JSON(status, gin.H{
 			"message": "bundle uploaded successfully",
 			"name":    bundleName,
 			"version": version,
@@ -243,12 +215,12 @@ func handleOPABundleVersionUpload(registryService *registry.Service) gin.Handler
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 
 		_, err := registryService.Upload(ctx, "opa", bundleName, version, c.Request.Body, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+		status, ok := uploadStatus(c, err, http.StatusCreated)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
+		c.JSON(status, gin.H{
 			"message": "bundle uploaded successfully",
 			"name":    bundleName,
 			"version": version,
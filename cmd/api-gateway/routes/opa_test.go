@@ -1,6 +1,12 @@
 package routes
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -8,6 +14,7 @@ import (
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOPARoutes_Setup(t *testing.T) {
@@ -36,3 +43,54 @@ func TestOPARoutes_Setup(t *testing.T) {
 	}
 	assert.True(t, found, "OPA routes should be registered")
 }
+
+// createOPABundle builds a gzipped OPA bundle tarball holding the given files
+func createOPABundle(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func TestOPABundleUpload_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.PUT("/opa/bundles/:name/:version", handleOPABundleVersionUpload(registryService))
+
+	upload := func(version string, files map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/opa/bundles/authz/"+version, bytes.NewReader(createOPABundle(t, files)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := upload("1.0.0", map[string]string{
+		"authz/policy.rego": "package authz\n\ndefault allow := false\n\nallow if input.user == \"alice\"\n",
+		".manifest":         `{"roots": ["authz"]}`,
+	})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// Broken policies are refused with the errors the compiler reported
+	w = upload("1.0.1", map[string]string{"authz/policy.rego": "package authz\n\nallow if {\n\tinput.user ==\n"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid OPA bundle")
+	assert.Contains(t, w.Body.String(), "authz/policy.rego:")
+
+	_, err := registryService.GetArtifact(context.Background(), "opa", "authz", "1.0.1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,265 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// createOrganizationRequest is the body of a request to create an organization
+type createOrganizationRequest struct {
+	Name          string `json:"name" binding:"required"`
+	DefaultPublic bool   `json:"default_public"`
+}
+
+// updateOrganizationRequest is the body of a request to change an organization
+type updateOrganizationRequest struct {
+	DefaultPublic *bool `json:"default_public" binding:"required"`
+}
+
+// setOrganizationMemberRequest is the body of a request to add a member to an
+// organization or change their role
+type setOrganizationMemberRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// OrganizationRoutes sets up the routes managing organizations and their members
+func OrganizationRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
+	orgs := api.Group("/orgs")
+	orgs.Use(middleware.AuthMiddleware(authService))
+
+	orgs.POST("", handleCreateOrganization(registryService))
+	orgs.GET("/:org", handleGetOrganization(registryService))
+	orgs.PATCH("/:org", handleUpdateOrganization(registryService))
+	orgs.GET("/:org/members", handleGetOrganizationMembers(registryService))
+	orgs.PUT("/:org/members/:username", handleSetOrganizationMember(registryService))
+	orgs.DELETE("/:org/members/:username", handleRemoveOrganizationMember(registryService))
+}
+
+// CreateOrganization godoc
+//
+//	@Summary		Create an organization
+//	@Description	Create an organization owning a namespace: an npm scope, the first path segment of OCI repositories and a Maven group ID with the groups nested in it. The creator becomes its owner. Only its owners and maintainers can publish new packages in the namespace, which take the organization's default visibility. Only admins can create an organization whose namespace already holds packages
+//	@Tags			Organizations
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		createOrganizationRequest	true	"Organization name and default visibility"
+//	@Success		201		{object}	types.APIResponse{data=types.Organization}	"Organization created"
+//	@Failure		400		{object}	types.APIResponse	"Invalid name"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		409		{object}	types.APIResponse	"Organization exists or namespace in use"
+//	@Failure		500		{object}	types.APIResponse	"Failed to create organization"
+//	@Security		BearerAuth
+//	@Router			/orgs [post]
+func handleCreateOrganization(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{Success: false, Error: "unauthorized"})
+			return
+		}
+
+		var request createOrganizationRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: "invalid request body: " + err.Error()})
+			return
+		}
+
+		org, err := registryService.CreateOrganization(c.Request.Context(), request.Name, request.DefaultPublic, user.ID)
+		if err != nil {
+			respondOrganizationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, types.APIResponse{Success: true, Data: org})
+	}
+}
+
+// GetOrganization godoc
+//
+//	@Summary		Get an organization
+//	@Tags			Organizations
+//	@Produce		json
+//	@Param			org	path		string	true	"Organization name"
+//	@Success		200	{object}	types.APIResponse{data=types.Organization}	"Organization"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		404	{object}	types.APIResponse	"Organization not found"
+//	@Failure		500	{object}	types.APIResponse	"Failed to get organization"
+//	@Security		BearerAuth
+//	@Router			/orgs/{org} [get]
+func handleGetOrganization(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		org, err := registryService.GetOrganization(c.Request.Context(), c.Param("org"))
+		if err != nil {
+			respondOrganizationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{Success: true, Data: org})
+	}
+}
+
+// UpdateOrganization godoc
+//
+//	@Summary		Change an organization's default visibility
+//	@Description	Change the visibility packages first published in the organization's namespace take. Packages already published keep theirs. Only owners of the organization and admins can change it
+//	@Tags			Organizations
+//	@Accept			json
+//	@Produce		json
+//	@Param			org		path		string						true	"Organization name"
+//	@Param			request	body		updateOrganizationRequest	true	"Default visibility"
+//	@Success		200		{object}	types.APIResponse{data=types.Organization}	"Organization changed"
+//	@Failure		400		{object}	types.APIResponse	"Invalid request body"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Not an owner of the organization"
+//	@Failure		404		{object}	types.APIResponse	"Organization not found"
+//	@Failure		500		{object}	types.APIResponse	"Failed to change organization"
+//	@Security		BearerAuth
+//	@Router			/orgs/{org} [patch]
+func handleUpdateOrganization(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{Success: false, Error: "unauthorized"})
+			return
+		}
+
+		var request updateOrganizationRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: "invalid request body: " + err.Error()})
+			return
+		}
+
+		org, err := registryService.SetOrganizationVisibility(c.Request.Context(), c.Param("org"), *request.DefaultPublic, user.ID)
+		if err != nil {
+			respondOrganizationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{Success: true, Data: org})
+	}
+}
+
+// GetOrganizationMembers godoc
+//
+//	@Summary		List organization members
+//	@Description	List the members of an organization and the role each holds on every package in its namespace
+//	@Tags			Organizations
+//	@Produce		json
+//	@Param			org	path		string	true	"Organization name"
+//	@Success		200	{object}	types.APIResponse{data=[]types.OrganizationMember}	"Organization members"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		404	{object}	types.APIResponse	"Organization not found"
+//	@Failure		500	{object}	types.APIResponse	"Failed to get organization members"
+//	@Security		BearerAuth
+//	@Router			/orgs/{org}/members [get]
+func handleGetOrganizationMembers(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		members, err := registryService.GetOrganizationMembers(c.Request.Context(), c.Param("org"))
+		if err != nil {
+			respondOrganizationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{Success: true, Data: members})
+	}
+}
+
+// SetOrganizationMember godoc
+//
+//	@Summary		Add an organization member
+//	@Description	Add a user to an organization as an owner, maintainer or contributor, or change the role of a member. Members hold their role on every package in the organization's namespace. Only owners of the organization and admins can manage its members
+//	@Tags			Organizations
+//	@Accept			json
+//	@Produce		json
+//	@Param			org			path		string							true	"Organization name"
+//	@Param			username	path		string							true	"Username"
+//	@Param			request		body		setOrganizationMemberRequest	true	"Role"
+//	@Success		200			{object}	types.APIResponse	"Member added"
+//	@Failure		400			{object}	types.APIResponse	"Invalid role"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Not an owner of the organization"
+//	@Failure		404			{object}	types.APIResponse	"Organization or user not found"
+//	@Failure		409			{object}	types.APIResponse	"The last owner cannot be demoted"
+//	@Failure		500			{object}	types.APIResponse	"Failed to add member"
+//	@Security		BearerAuth
+//	@Router			/orgs/{org}/members/{username} [put]
+func handleSetOrganizationMember(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{Success: false, Error: "unauthorized"})
+			return
+		}
+
+		var request setOrganizationMemberRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: "invalid request body: " + err.Error()})
+			return
+		}
+
+		if err := registryService.SetOrganizationMember(c.Request.Context(), c.Param("org"), c.Param("username"), request.Role, user.ID); err != nil {
+			respondOrganizationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{Success: true, Message: "organization member set"})
+	}
+}
+
+// RemoveOrganizationMember godoc
+//
+//	@Summary		Remove an organization member
+//	@Description	Remove a user from an organization. Owners of the organization and admins can remove any member, and members can leave. The last owner cannot be removed
+//	@Tags			Organizations
+//	@Produce		json
+//	@Param			org			path		string	true	"Organization name"
+//	@Param			username	path		string	true	"Username"
+//	@Success		200			{object}	types.APIResponse	"Member removed"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Not an owner of the organization"
+//	@Failure		404			{object}	types.APIResponse	"Organization, user or membership not found"
+//	@Failure		409			{object}	types.APIResponse	"The last owner cannot be removed"
+//	@Failure		500			{object}	types.APIResponse	"Failed to remove member"
+//	@Security		BearerAuth
+//	@Router			/orgs/{org}/members/{username} [delete]
+func handleRemoveOrganizationMember(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{Success: false, Error: "unauthorized"})
+			return
+		}
+
+		if err := registryService.RemoveOrganizationMember(c.Request.Context(), c.Param("org"), c.Param("username"), user.ID); err != nil {
+			respondOrganizationError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{Success: true, Message: "organization member removed"})
+	}
+}
+
+// respondOrganizationError responds to a failed organization request
+func respondOrganizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, registry.ErrInvalidOrganizationName), errors.Is(err, registry.ErrInvalidOwnerRole):
+		c.JSON(http.StatusBadRequest, types.APIResponse{Success: false, Error: err.Error()})
+	case errors.Is(err, registry.ErrOrganizationForbidden):
+		c.JSON(http.StatusForbidden, types.APIResponse{Success: false, Error: err.Error()})
+	case errors.Is(err, registry.ErrOrganizationNotFound), errors.Is(err, registry.ErrCollaboratorNotFound),
+		errors.Is(err, registry.ErrMemberNotFound):
+		c.JSON(http.StatusNotFound, types.APIResponse{Success: false, Error: err.Error()})
+	case errors.Is(err, registry.ErrOrganizationExists), errors.Is(err, registry.ErrNamespaceInUse),
+		errors.Is(err, registry.ErrLastOrganizationOwner):
+		c.JSON(http.StatusConflict, types.APIResponse{Success: false, Error: err.Error()})
+	default:
+		middleware.Logger(c).Error().Err(err).Str("organization", c.Param("org")).Msg("Failed to manage organization")
+		c.JSON(http.StatusInternalServerError, types.APIResponse{Success: false, Error: "failed to manage organization"})
+	}
+}
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -10,7 +11,6 @@ import (
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
 	"github.com/lgulliver/lodestone/pkg/types"
-	"github.com/rs/zerolog/log"
 )
 
 // PackageOwnershipRoutes sets up package ownership management routes
@@ -23,6 +23,14 @@ func PackageOwnershipRoutes(api *gin.RouterGroup, registryService *registry.Serv
 	ownership.POST("/:registry/:package/owners", handleAddPackageOwner(registryService))
 	ownership.DELETE("/:registry/:package/owners/:userId", handleRemovePackageOwner(registryService))
 
+	// Primary ownership transfers, which take effect once the recipient accepts
+	ownership.GET("/:registry/:package/transfer", handleGetOwnershipTransfer(registryService))
+	ownership.POST("/:registry/:package/transfer", handleProposeOwnershipTransfer(registryService))
+	ownership.DELETE("/:registry/:package/transfer", handleCancelOwnershipTransfer(registryService))
+	ownership.POST("/:registry/:package/transfer/accept", handleRespondToOwnershipTransfer(registryService, true))
+	ownership.POST("/:registry/:package/transfer/decline", handleRespondToOwnershipTransfer(registryService, false))
+	ownership.GET("/transfers", handleGetIncomingTransfers(registryService))
+
 	// User's packages
 	ownership.GET("/my-packages", handleGetUserPackages(registryService))
 }
@@ -33,6 +41,11 @@ type AddOwnerRequest struct {
 	Role   string    `json:"role" binding:"required"`
 }
 
+// TransferOwnershipRequest represents a request to transfer a package
+type TransferOwnershipRequest struct {
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+}
+
 // GetPackageOwners godoc
 //
 //	@Summary		Get package owners
@@ -57,7 +70,7 @@ func handleGetPackageOwners(registryService *registry.Service) gin.HandlerFunc {
 			requestID = uuid.New().String()
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("registry", registryType).
 			Str("package", packageName).
@@ -67,7 +80,7 @@ func handleGetPackageOwners(registryService *registry.Service) gin.HandlerFunc {
 		// Get user from context
 		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
-			log.Warn().
+			middleware.Logger(c).Warn().
 				Str("request_id", requestID).
 				Msg("User not found in context")
 			c.JSON(http.StatusUnauthorized, types.APIResponse{
@@ -81,7 +94,7 @@ func handleGetPackageOwners(registryService *registry.Service) gin.HandlerFunc {
 		// In production, you might want to restrict this
 		owners, err := registryService.GetPackageOwners(c.Request.Context(), registryType, packageName)
 		if err != nil {
-			log.Error().
+			middleware.Logger(c).Error().
 				Str("request_id", requestID).
 				Err(err).
 				Msg("Failed to get package owners")
@@ -92,7 +105,7 @@ func handleGetPackageOwners(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("user_id", user.ID.String()).
 			Int("owner_count", len(owners)).
@@ -116,7 +129,7 @@ func handleAddPackageOwner(registryService *registry.Service) gin.HandlerFunc {
 			requestID = uuid.New().String()
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("registry", registryType).
 			Str("package", packageName).
@@ -126,7 +139,7 @@ func handleAddPackageOwner(registryService *registry.Service) gin.HandlerFunc {
 		// Get user from context
 		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
-			log.Warn().
+			middleware.Logger(c).Warn().
 				Str("request_id", requestID).
 				Msg("User not found in context")
 			c.JSON(http.StatusUnauthorized, types.APIResponse{
@@ -139,7 +152,7 @@ func handleAddPackageOwner(registryService *registry.Service) gin.HandlerFunc {
 		// Parse request body
 		var req AddOwnerRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Warn().
+			middleware.Logger(c).Warn().
 				Str("request_id", requestID).
 				Err(err).
 				Msg("Invalid add owner request body")
@@ -162,18 +175,18 @@ func handleAddPackageOwner(registryService *registry.Service) gin.HandlerFunc {
 		// Add owner
 		err := registryService.AddPackageOwner(c.Request.Context(), registryType, packageName, user.ID, req.UserID, req.Role)
 		if err != nil {
-			log.Error().
+			middleware.Logger(c).Error().
 				Str("request_id", requestID).
 				Err(err).
 				Msg("Failed to add package owner")
-			c.JSON(http.StatusInternalServerError, types.APIResponse{
+			c.JSON(ownershipErrorStatus(err), types.APIResponse{
 				Success: false,
 				Error:   err.Error(),
 			})
 			return
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("granting_user_id", user.ID.String()).
 			Str("target_user_id", req.UserID.String()).
@@ -199,7 +212,7 @@ func handleRemovePackageOwner(registryService *registry.Service) gin.HandlerFunc
 			requestID = uuid.New().String()
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("registry", registryType).
 			Str("package", packageName).
@@ -210,7 +223,7 @@ func handleRemovePackageOwner(registryService *registry.Service) gin.HandlerFunc
 		// Get user from context
 		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
-			log.Warn().
+			middleware.Logger(c).Warn().
 				Str("request_id", requestID).
 				Msg("User not found in context")
 			c.JSON(http.StatusUnauthorized, types.APIResponse{
@@ -233,18 +246,18 @@ func handleRemovePackageOwner(registryService *registry.Service) gin.HandlerFunc
 		// Remove owner
 		err = registryService.RemovePackageOwner(c.Request.Context(), registryType, packageName, user.ID, targetUserID)
 		if err != nil {
-			log.Error().
+			middleware.Logger(c).Error().
 				Str("request_id", requestID).
 				Err(err).
 				Msg("Failed to remove package owner")
-			c.JSON(http.StatusInternalServerError, types.APIResponse{
+			c.JSON(ownershipErrorStatus(err), types.APIResponse{
 				Success: false,
 				Error:   err.Error(),
 			})
 			return
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("removing_user_id", user.ID.String()).
 			Str("target_user_id", targetUserID.String()).
@@ -265,7 +278,7 @@ func handleGetUserPackages(registryService *registry.Service) gin.HandlerFunc {
 			requestID = uuid.New().String()
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("endpoint", "GET /packages/my-packages").
 			Msg("Get user packages request")
@@ -273,7 +286,7 @@ func handleGetUserPackages(registryService *registry.Service) gin.HandlerFunc {
 		// Get user from context
 		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
-			log.Warn().
+			middleware.Logger(c).Warn().
 				Str("request_id", requestID).
 				Msg("User not found in context")
 			c.JSON(http.StatusUnauthorized, types.APIResponse{
@@ -300,7 +313,7 @@ func handleGetUserPackages(registryService *registry.Service) gin.HandlerFunc {
 		// Get user packages
 		packages, err := registryService.Ownership.GetUserPackages(c.Request.Context(), user.ID)
 		if err != nil {
-			log.Error().
+			middleware.Logger(c).Error().
 				Str("request_id", requestID).
 				Err(err).
 				Msg("Failed to get user packages")
@@ -332,7 +345,7 @@ func handleGetUserPackages(registryService *registry.Service) gin.HandlerFunc {
 			TotalPages: totalPages,
 		}
 
-		log.Info().
+		middleware.Logger(c).Info().
 			Str("request_id", requestID).
 			Str("user_id", user.ID.String()).
 			Int("package_count", len(packages)).
@@ -348,3 +361,235 @@ func handleGetUserPackages(registryService *registry.Service) gin.HandlerFunc {
 		})
 	}
 }
+
+// GetOwnershipTransfer godoc
+//
+//	@Summary		Get pending ownership transfer
+//	@Description	Retrieve the transfer of a package's primary ownership that is waiting for its recipient
+//	@Tags			Package Ownership
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget, maven)"
+//	@Param			package		path		string	true	"Package name"
+//	@Success		200			{object}	types.APIResponse{data=types.OwnershipTransfer}	"Pending transfer"
+//	@Failure		401			{object}	types.APIResponse								"Unauthorized"
+//	@Failure		404			{object}	types.APIResponse								"No pending transfer"
+//	@Failure		500			{object}	types.APIResponse								"Failed to get transfer"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/transfer [get]
+func handleGetOwnershipTransfer(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transfer, err := registryService.Ownership.GetPendingTransfer(c.Request.Context(), c.Param("registry"), c.Param("package"))
+		if err != nil {
+			respondOwnershipError(c, err, "failed to get ownership transfer")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    transfer,
+		})
+	}
+}
+
+// ProposeOwnershipTransfer godoc
+//
+//	@Summary		Propose ownership transfer
+//	@Description	Propose making another user the primary owner of a package. Ownership only changes once the recipient accepts; a new proposal replaces a pending one. Only the primary owner or an admin may transfer a package
+//	@Tags			Package Ownership
+//	@Accept			json
+//	@Produce		json
+//	@Param			registry	path		string						true	"Registry type (e.g., npm, nuget, maven)"
+//	@Param			package		path		string						true	"Package name"
+//	@Param			request		body		TransferOwnershipRequest	true	"Recipient"
+//	@Success		201			{object}	types.APIResponse{data=types.OwnershipTransfer}	"Transfer proposed"
+//	@Failure		400			{object}	types.APIResponse								"Invalid request or recipient"
+//	@Failure		401			{object}	types.APIResponse								"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse								"Not the primary owner or an admin"
+//	@Failure		500			{object}	types.APIResponse								"Failed to propose transfer"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/transfer [post]
+func handleProposeOwnershipTransfer(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{
+				Success: false,
+				Error:   "unauthorized",
+			})
+			return
+		}
+
+		var req TransferOwnershipRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "invalid request body: " + err.Error(),
+			})
+			return
+		}
+
+		transfer, err := registryService.ProposeOwnershipTransfer(c.Request.Context(), c.Param("registry"), c.Param("package"), req.UserID, user.ID)
+		if err != nil {
+			respondOwnershipError(c, err, "failed to propose ownership transfer")
+			return
+		}
+
+		c.JSON(http.StatusCreated, types.APIResponse{
+			Success: true,
+			Message: "ownership transfer proposed; it takes effect once the recipient accepts",
+			Data:    transfer,
+		})
+	}
+}
+
+// CancelOwnershipTransfer godoc
+//
+//	@Summary		Cancel ownership transfer
+//	@Description	Withdraw the pending transfer of a package. Only the primary owner or an admin may cancel it
+//	@Tags			Package Ownership
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget, maven)"
+//	@Param			package		path		string	true	"Package name"
+//	@Success		200			{object}	types.APIResponse{data=types.OwnershipTransfer}	"Transfer cancelled"
+//	@Failure		401			{object}	types.APIResponse								"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse								"Not the primary owner or an admin"
+//	@Failure		404			{object}	types.APIResponse								"No pending transfer"
+//	@Failure		500			{object}	types.APIResponse								"Failed to cancel transfer"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/transfer [delete]
+func handleCancelOwnershipTransfer(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{
+				Success: false,
+				Error:   "unauthorized",
+			})
+			return
+		}
+
+		transfer, err := registryService.CancelOwnershipTransfer(c.Request.Context(), c.Param("registry"), c.Param("package"), user.ID)
+		if err != nil {
+			respondOwnershipError(c, err, "failed to cancel ownership transfer")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "ownership transfer cancelled",
+			Data:    transfer,
+		})
+	}
+}
+
+// RespondToOwnershipTransfer godoc
+//
+//	@Summary		Accept or decline ownership transfer
+//	@Description	Accept the pending transfer of a package, becoming its primary owner, or decline it. Only the recipient may respond. The previous primary owner remains a co-owner
+//	@Tags			Package Ownership
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget, maven)"
+//	@Param			package		path		string	true	"Package name"
+//	@Success		200			{object}	types.APIResponse{data=types.OwnershipTransfer}	"Transfer accepted or declined"
+//	@Failure		401			{object}	types.APIResponse								"Unauthorized"
+//	@Failure		404			{object}	types.APIResponse								"No pending transfer to the user"
+//	@Failure		500			{object}	types.APIResponse								"Failed to respond to transfer"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/transfer/accept [post]
+//	@Router			/packages/{registry}/{package}/transfer/decline [post]
+func handleRespondToOwnershipTransfer(registryService *registry.Service, accept bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{
+				Success: false,
+				Error:   "unauthorized",
+			})
+			return
+		}
+
+		respond, message := registryService.DeclineOwnershipTransfer, "ownership transfer declined"
+		if accept {
+			respond, message = registryService.AcceptOwnershipTransfer, "ownership transfer accepted"
+		}
+
+		transfer, err := respond(c.Request.Context(), c.Param("registry"), c.Param("package"), user.ID)
+		if err != nil {
+			respondOwnershipError(c, err, "failed to respond to ownership transfer")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: message,
+			Data:    transfer,
+		})
+	}
+}
+
+// GetIncomingTransfers godoc
+//
+//	@Summary		List incoming ownership transfers
+//	@Description	List the pending transfers of packages to the current user
+//	@Tags			Package Ownership
+//	@Produce		json
+//	@Success		200	{object}	types.APIResponse{data=[]types.OwnershipTransfer}	"Pending transfers to the user"
+//	@Failure		401	{object}	types.APIResponse									"Unauthorized"
+//	@Failure		500	{object}	types.APIResponse									"Failed to list transfers"
+//	@Security		BearerAuth
+//	@Router			/packages/transfers [get]
+func handleGetIncomingTransfers(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, types.APIResponse{
+				Success: false,
+				Error:   "unauthorized",
+			})
+			return
+		}
+
+		transfers, err := registryService.Ownership.GetIncomingTransfers(c.Request.Context(), user.ID)
+		if err != nil {
+			respondOwnershipError(c, err, "failed to list ownership transfers")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    transfers,
+		})
+	}
+}
+
+// ownershipErrorStatus maps ownership errors to response statuses
+func ownershipErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, registry.ErrOwnershipForbidden), errors.Is(err, registry.ErrTransferForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, registry.ErrOwnerNotFound), errors.Is(err, registry.ErrTransferNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, registry.ErrLastOwner), errors.Is(err, registry.ErrPrimaryOwner):
+		return http.StatusConflict
+	case errors.Is(err, registry.ErrInvalidOwnerRole), errors.Is(err, registry.ErrInvalidTransfer):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondOwnershipError responds to a failed ownership request, hiding the
+// details of unexpected errors behind message
+func respondOwnershipError(c *gin.Context, err error, message string) {
+	status := ownershipErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		middleware.Logger(c).Error().Err(err).Str("registry", c.Param("registry")).Str("package", c.Param("package")).Msg(message)
+	} else {
+		message = err.Error()
+	}
+
+	c.JSON(status, types.APIResponse{
+		Success: false,
+		Error:   message,
+	})
+}
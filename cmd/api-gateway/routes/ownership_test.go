@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageOwnershipTransfer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, owner := setupRegistryTestService(t)
+	registryService.SetAuditLog(audit.NewService(registryService.DB.DB))
+	ctx := context.Background()
+	require.NoError(t, registryService.Ownership.EstablishInitialOwnership(ctx, "npm", "left-pad", owner.ID))
+
+	newUser := func(name string) *types.User {
+		user := &types.User{Username: name, Email: name + "@example.com", Password: "hashed", IsActive: true}
+		require.NoError(t, registryService.DB.Create(user).Error)
+		return user
+	}
+	coOwner := newUser("co-owner")
+	recipient := newUser("recipient")
+
+	// Requests are made as whichever user is current
+	current := owner
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", current)
+		c.Next()
+	})
+	packages := router.Group("/packages")
+	packages.GET("/:registry/:package/owners", handleGetPackageOwners(registryService))
+	packages.POST("/:registry/:package/owners", handleAddPackageOwner(registryService))
+	packages.DELETE("/:registry/:package/owners/:userId", handleRemovePackageOwner(registryService))
+	packages.GET("/:registry/:package/transfer", handleGetOwnershipTransfer(registryService))
+	packages.POST("/:registry/:package/transfer", handleProposeOwnershipTransfer(registryService))
+	packages.POST("/:registry/:package/transfer/accept", handleRespondToOwnershipTransfer(registryService, true))
+	packages.GET("/transfers", handleGetIncomingTransfers(registryService))
+
+	request := func(user *types.User, method, path string, body interface{}) *httptest.ResponseRecorder {
+		current = user
+		var data []byte
+		if body != nil {
+			var err error
+			data, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	owners := func() map[string]types.PackageOwnership {
+		w := request(owner, "GET", "/packages/npm/left-pad/owners", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []types.PackageOwnership `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		byUser := make(map[string]types.PackageOwnership)
+		for _, ownership := range response.Data {
+			byUser[ownership.UserID.String()] = ownership
+		}
+		return byUser
+	}
+
+	t.Run("add co-owner", func(t *testing.T) {
+		w := request(coOwner, "POST", "/packages/npm/left-pad/owners", gin.H{"user_id": recipient.ID, "role": "owner"})
+		assert.Equal(t, http.StatusForbidden, w.Code, "only owners can add owners")
+
+		w = request(owner, "POST", "/packages/npm/left-pad/owners", gin.H{"user_id": coOwner.ID, "role": "owner"})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		ownership := owners()
+		require.Contains(t, ownership, coOwner.ID.String())
+		assert.Equal(t, "owner", ownership[coOwner.ID.String()].Role)
+		assert.False(t, ownership[coOwner.ID.String()].IsPrimary)
+		assert.True(t, ownership[owner.ID.String()].IsPrimary)
+	})
+
+	t.Run("remove co-owner", func(t *testing.T) {
+		w := request(coOwner, "DELETE", "/packages/npm/left-pad/owners/"+owner.ID.String(), nil)
+		assert.Equal(t, http.StatusConflict, w.Code, "the primary owner cannot be removed")
+
+		w = request(owner, "DELETE", "/packages/npm/left-pad/owners/"+coOwner.ID.String(), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NotContains(t, owners(), coOwner.ID.String())
+
+		w = request(owner, "DELETE", "/packages/npm/left-pad/owners/"+coOwner.ID.String(), nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("propose and accept transfer", func(t *testing.T) {
+		w := request(recipient, "POST", "/packages/npm/left-pad/transfer", gin.H{"user_id": recipient.ID})
+		assert.Equal(t, http.StatusForbidden, w.Code, "only the primary owner can transfer")
+
+		w = request(owner, "POST", "/packages/npm/left-pad/transfer", gin.H{"user_id": recipient.ID})
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+		// The package is unchanged until the recipient accepts
+		assert.NotContains(t, owners(), recipient.ID.String())
+		w = request(recipient, "GET", "/packages/transfers", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"package_key":"npm:left-pad"`)
+
+		w = request(coOwner, "POST", "/packages/npm/left-pad/transfer/accept", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code, "only the recipient can accept")
+
+		w = request(recipient, "POST", "/packages/npm/left-pad/transfer/accept", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"status":"accepted"`)
+
+		ownership := owners()
+		assert.True(t, ownership[recipient.ID.String()].IsPrimary)
+		assert.Equal(t, "owner", ownership[recipient.ID.String()].Role)
+		assert.False(t, ownership[owner.ID.String()].IsPrimary)
+
+		w = request(owner, "GET", "/packages/npm/left-pad/transfer", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		var entries []types.AuditEntry
+		require.NoError(t, registryService.DB.Where("action LIKE ?", "ownership.transfer%").Order("created_at").Find(&entries).Error)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "ownership.transfer", entries[0].Action)
+		assert.Equal(t, "ownership.transfer.accept", entries[1].Action)
+	})
+}
+
+func TestPackageOwnershipRoutes_RegistrySettings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, _ := setupRegistryTestService(t)
+	require.NoError(t, registryService.DB.AutoMigrate(&types.APIKey{}, &types.RefreshToken{}))
+	authService := auth.NewService(registryService.DB, nil, &config.AuthConfig{JWTSecret: "test-secret", JWTExpiration: time.Hour, BCryptCost: 4})
+	ctx := context.Background()
+
+	owner, err := authService.Register(ctx, &types.RegisterRequest{Username: "owner", Email: "owner@example.com", Password: "owner-password"})
+	require.NoError(t, err)
+	token, err := authService.Login(ctx, &types.LoginRequest{Username: "owner", Password: "owner-password"})
+	require.NoError(t, err)
+	require.NoError(t, registryService.Ownership.EstablishInitialOwnership(ctx, "npm", "left-pad", owner.ID))
+
+	// Mounted behind registry validation as the API gateway mounts them
+	router := gin.New()
+	api := router.Group("/api/v1")
+	api.Use(middleware.RegistryValidationMiddleware(registryService.Settings))
+	PackageOwnershipRoutes(api, registryService, authService)
+
+	request := func(method, path string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/v1/packages"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token.Token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("GET", "/npm/left-pad/owners"))
+
+	// A read-only registry still lists owners but refuses changes
+	require.NoError(t, registryService.Settings.SetReadOnly(ctx, "npm", true, owner.ID))
+	assert.Equal(t, http.StatusOK, request("GET", "/npm/left-pad/owners"))
+	assert.Equal(t, http.StatusServiceUnavailable, request("POST", "/npm/left-pad/transfer"))
+	assert.Equal(t, http.StatusServiceUnavailable, request("DELETE", "/npm/left-pad/owners/"+owner.ID.String()))
+	require.NoError(t, registryService.Settings.SetReadOnly(ctx, "npm", false, owner.ID))
+
+	// A disabled registry refuses every request naming it
+	require.NoError(t, registryService.Settings.DisableRegistry(ctx, "npm", owner.ID))
+	assert.Equal(t, http.StatusServiceUnavailable, request("GET", "/npm/left-pad/owners"))
+
+	// Routes naming no registry are unaffected
+	assert.Equal(t, http.StatusOK, request("GET", "/my-packages"))
+}
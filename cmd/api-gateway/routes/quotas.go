@@ -0,0 +1,219 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// quotaRequest is the body of a quota update
+type quotaRequest struct {
+	RegistryName string `json:"registry_name"` // registry the quota applies to, all when empty
+	MaxBytes     int64  `json:"max_bytes"`     // 0 for unlimited
+	MaxArtifacts int64  `json:"max_artifacts"` // 0 for unlimited
+}
+
+// userQuotas is a user's quotas and their usage of them
+type userQuotas struct {
+	Quotas []types.Quota      `json:"quotas"`
+	Usage  []types.QuotaUsage `json:"usage"`
+}
+
+// parseQuotaUser reads the user ID path parameter, checking the user exists.
+// It writes the error response and returns false if it does not.
+func parseQuotaUser(c *gin.Context, registryService *registry.Service) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.APIResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+		})
+		return uuid.Nil, false
+	}
+
+	var count int64
+	if err := registryService.DB.WithContext(c.Request.Context()).Model(&types.User{}).Where("id = ?", userID).Count(&count).Error; err != nil {
+		middleware.Logger(c).Error().Err(err).Str("user_id", userID.String()).Msg("failed to look up user")
+		c.JSON(http.StatusInternalServerError, types.APIResponse{
+			Success: false,
+			Error:   "Failed to look up user",
+		})
+		return uuid.Nil, false
+	}
+	if count == 0 {
+		c.JSON(http.StatusNotFound, types.APIResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// GetUserQuotas godoc
+//
+//	@Summary		Get a user's quotas
+//	@Description	Retrieve the quotas set for a user and their usage of every quota that applies to them, including the default quota
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			user_id	path		string	true	"User ID"
+//	@Success		200		{object}	types.APIResponse{data=userQuotas}	"Quotas retrieved successfully"
+//	@Failure		400		{object}	types.APIResponse	"Invalid user ID"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404		{object}	types.APIResponse	"User not found"
+//	@Failure		500		{object}	types.APIResponse	"Failed to retrieve quotas"
+//	@Security		BearerAuth
+//	@Router			/admin/quotas/{user_id} [get]
+func getUserQuotas(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := parseQuotaUser(c, registryService)
+		if !ok {
+			return
+		}
+
+		quotas, err := registryService.Quotas.GetQuotas(c.Request.Context(), userID)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("user_id", userID.String()).Msg("failed to get quotas")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to retrieve quotas",
+			})
+			return
+		}
+
+		usage, err := registryService.Quotas.Usage(c.Request.Context(), userID)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("user_id", userID.String()).Msg("failed to get quota usage")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to retrieve quotas",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    userQuotas{Quotas: quotas, Usage: usage},
+		})
+	}
+}
+
+// SetUserQuota godoc
+//
+//	@Summary		Set a user's quota
+//	@Description	Create or replace a user's quota across all registries, or in the registry named in the body. Uploads that would exceed a quota are rejected with 413.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			user_id	path		string			true	"User ID"
+//	@Param			quota	body		quotaRequest	true	"Quota limits"
+//	@Success		200		{object}	types.APIResponse{data=types.Quota}	"Quota saved successfully"
+//	@Failure		400		{object}	types.APIResponse	"Invalid quota"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404		{object}	types.APIResponse	"User not found"
+//	@Security		BearerAuth
+//	@Router			/admin/quotas/{user_id} [put]
+func setUserQuota(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := parseQuotaUser(c, registryService)
+		if !ok {
+			return
+		}
+		user, _ := middleware.GetUserFromContext(c)
+
+		var request quotaRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		if request.RegistryName != "" {
+			if _, err := registryService.GetRegistry(request.RegistryName); err != nil {
+				c.JSON(http.StatusBadRequest, types.APIResponse{
+					Success: false,
+					Error:   "Unknown registry: " + request.RegistryName,
+				})
+				return
+			}
+		}
+
+		quota := &types.Quota{
+			UserID:       userID,
+			RegistryName: request.RegistryName,
+			MaxBytes:     request.MaxBytes,
+			MaxArtifacts: request.MaxArtifacts,
+		}
+		if err := registryService.Quotas.SetQuota(c.Request.Context(), quota, user.ID); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("user_id", userID.String()).Msg("failed to set quota")
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Quota saved successfully",
+			Data:    quota,
+		})
+	}
+}
+
+// DeleteUserQuota godoc
+//
+//	@Summary		Delete a user's quota
+//	@Description	Remove a user's quota across all registries, reverting to the default quota, or in the registry given by the query parameter
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			user_id		path		string	true	"User ID"
+//	@Param			registry	query		string	false	"Registry the quota applies to, all registries when omitted"
+//	@Success		200			{object}	types.APIResponse	"Quota deleted successfully"
+//	@Failure		400			{object}	types.APIResponse	"Invalid user ID"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404			{object}	types.APIResponse	"User or quota not found"
+//	@Failure		500			{object}	types.APIResponse	"Failed to delete quota"
+//	@Security		BearerAuth
+//	@Router			/admin/quotas/{user_id} [delete]
+func deleteUserQuota(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+		userID, ok := parseQuotaUser(c, registryService)
+		if !ok {
+			return
+		}
+
+		err := registryService.Quotas.DeleteQuota(c.Request.Context(), userID, c.Query("registry"), user.ID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			message := "Failed to delete quota"
+			if errors.Is(err, registry.ErrQuotaNotFound) {
+				status = http.StatusNotFound
+				message = "Quota not found"
+			} else {
+				middleware.Logger(c).Error().Err(err).Str("user_id", userID.String()).Msg("failed to delete quota")
+			}
+			c.JSON(status, types.APIResponse{
+				Success: false,
+				Error:   message,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Quota deleted successfully",
+		})
+	}
+}
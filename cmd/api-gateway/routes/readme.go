@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+)
+
+// PackageReadmeRoutes sets up the package documentation routes
+func PackageReadmeRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
+	packages := api.Group("/packages")
+	packages.Use(middleware.AuthMiddleware(authService))
+
+	packages.GET("/:registry/:package/readme", handleGetPackageReadme(registryService))
+}
+
+// GetPackageReadme godoc
+//
+//	@Summary		Get package README
+//	@Description	Serve the markdown README of a package, taken from the most recent version published with one
+//	@Tags			Packages
+//	@Produce		text/markdown
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget, helm, cargo)"
+//	@Param			package		path		string	true	"Package name"
+//	@Success		200			{string}	string					"Package README"
+//	@Header			200			{string}	X-Readme-Version		"Version the README was published with"
+//	@Failure		401			{object}	object{error=string}	"Unauthorized"
+//	@Failure		404			{object}	object{error=string}	"README not found"
+//	@Failure		500			{object}	object{error=string}	"Failed to retrieve README"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/readme [get]
+func handleGetPackageReadme(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryType := c.Param("registry")
+		name := c.Param("package")
+
+		metadata, err := registryService.GetReadme(c.Request.Context(), registryType, name)
+		if err != nil {
+			if errors.Is(err, registry.ErrReadmeNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "readme not found"})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to retrieve package README")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve readme"})
+			return
+		}
+
+		c.Header("X-Readme-Version", metadata.Version)
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(metadata.Readme))
+	}
+}
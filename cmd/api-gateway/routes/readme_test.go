@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetPackageReadme(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	publish := func(name, version string, files map[string]string) {
+		content := createNpmTarball(t, `{"name":"`+name+`","version":"`+version+`"}`, files)
+		_, err := registryService.Upload(ctx, "npm", name, version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+	publish("documented", "1.0.0", map[string]string{"README.md": "# documented 1.0"})
+	publish("documented", "2.0.0", map[string]string{"README.md": "# documented 2.0"})
+	// A fix to an older release does not replace the newer README
+	publish("documented", "1.0.1", map[string]string{"README.md": "# documented 1.0.1"})
+	publish("undocumented", "1.0.0", nil)
+
+	router := gin.New()
+	router.GET("/packages/:registry/:package/readme", handleGetPackageReadme(registryService))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/packages/npm/documented/readme")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "# documented 2.0", w.Body.String())
+	assert.Equal(t, "text/markdown; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "2.0.0", w.Header().Get("X-Readme-Version"))
+
+	assert.Equal(t, http.StatusNotFound, get("/packages/npm/undocumented/readme").Code)
+	assert.Equal(t, http.StatusNotFound, get("/packages/npm/missing/readme").Code)
+	assert.Equal(t, http.StatusNotFound, get("/packages/nuget/documented/readme").Code)
+}
+
+func TestHandleGetPackageReadme_RestrictedPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	content := createNpmTarball(t, `{"name":"restricted","version":"1.0.0"}`, map[string]string{"README.md": "# restricted"})
+	_, err := registryService.Upload(context.Background(), "npm", "restricted", "1.0.0", bytes.NewReader(content), publisher.ID)
+	require.NoError(t, err)
+
+	get := func(user *types.User) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/packages/:registry/:package/readme", handleGetPackageReadme(registryService))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/packages/npm/restricted/readme", nil))
+		return w
+	}
+
+	w := get(publisher)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "# restricted", w.Body.String())
+
+	// Users who cannot read the package cannot read its README either
+	w = get(outsider)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "# restricted")
+}
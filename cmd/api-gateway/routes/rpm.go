@@ -0,0 +1,320 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rpm"
+	"github.com/lgulliver/lodestone/pkg/signing"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// maxRPMPackageSize bounds the size of an uploaded .rpm read into memory
+const maxRPMPackageSize = 512 << 20
+
+// RPMRoutes sets up RPM/YUM repository routes. Clients use the repository
+// with a .repo file whose baseurl is <base>/api/v1/rpm
+func RPMRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
+	repo := api.Group("/rpm")
+	repo.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("rpm")))
+
+	// YUM repository layout - requires authentication (dnf sends username/password from the .repo file)
+	repo.GET("/repodata/:file", middleware.AuthMiddleware(authService), handleRPMRepodata(registryService))
+	repo.GET("/Packages/:package/:file", middleware.AuthMiddleware(authService), handleRPMPackage(registryService))
+	repo.GET("/key.asc", middleware.AuthMiddleware(authService), handleRPMKey(registryService))
+
+	// Package management (requires authentication)
+	repo.POST("/api/packages", middleware.AuthMiddleware(authService), handleRPMUpload(registryService))
+	repo.DELETE("/api/packages/:package/:version", middleware.AuthMiddleware(authService), handleRPMDelete(registryService))
+}
+
+// rpmRegistry returns the RPM handler registered with the service
+func rpmRegistry(registryService *registry.Service) (*rpm.Registry, error) {
+	handler, err := registryService.GetRegistry("rpm")
+	if err != nil {
+		return nil, err
+	}
+	rpmHandler, ok := handler.(*rpm.Registry)
+	if !ok {
+		return nil, fmt.Errorf("rpm registry handler unavailable")
+	}
+	return rpmHandler, nil
+}
+
+// buildRPMRepository generates repodata from all published packages
+func buildRPMRepository(ctx context.Context, registryService *registry.Service) (*rpm.Repository, error) {
+	artifacts, err := registryService.ListAll(ctx, &types.ArtifactFilter{Registry: "rpm"})
+	if err != nil {
+		return nil, err
+	}
+	return rpm.BuildRepository(artifacts), nil
+}
+
+// GetRPMRepodata godoc
+//
+//	@Summary		Get YUM repository metadata
+//	@Description	Serve repomd.xml, its repomd.xml.asc signature and the primary, filelists and other indexes it references
+//	@Tags			RPM
+//	@Produce		xml
+//	@Param			file	path		string	true	"File under repodata/, e.g. repomd.xml"
+//	@Success		200		{file}		file					"Repository metadata file"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		404		{object}	object{error=string}	"File not found"
+//	@Failure		500		{object}	object{error=string}	"Failed to generate repository metadata"
+//	@Security		BearerAuth
+//	@Router			/rpm/repodata/{file} [get]
+func handleRPMRepodata(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file := "repodata/" + c.Param("file")
+		ctx := context.WithValue(c.Request.Context(), "registry", "rpm")
+
+		repo, err := buildRPMRepository(ctx, registryService)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("Failed to generate RPM repository metadata")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate repository metadata"})
+			return
+		}
+
+		if file == rpm.RepomdPath+".asc" {
+			rpmHandler, err := rpmRegistry(registryService)
+			if err != nil || rpmHandler.SigningKey() == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "repository is not signed"})
+				return
+			}
+
+			signature, err := signing.DetachSign(repo.Repomd, rpmHandler.SigningKey())
+			if err != nil {
+				middleware.Logger(c).Error().Err(err).Msg("Failed to sign repomd.xml")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to sign repository metadata"})
+				return
+			}
+			c.Data(http.StatusOK, "application/pgp-signature", signature)
+			return
+		}
+
+		content, ok := repo.Files[file]
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "file not found"})
+			return
+		}
+
+		contentType := "application/xml"
+		if strings.HasSuffix(file, ".gz") {
+			contentType = "application/gzip"
+		}
+		c.Data(http.StatusOK, contentType, content)
+	}
+}
+
+// GetRPMPackage godoc
+//
+//	@Summary		Download RPM package
+//	@Description	Download an .rpm as referenced by the location of a primary.xml entry
+//	@Tags			RPM
+//	@Produce		application/x-rpm
+//	@Param			package	path		string	true	"Package name"
+//	@Param			file	path		string	true	"Package file name, e.g. hello-1.0-1.x86_64.rpm"
+//	@Param			Range	header		string	false	"Byte ranges to download (e.g., bytes=1024- or bytes=0-99,100-199); ranges that overlap or adjoin are served as one, others with the whole content"
+//	@Success		200		{file}		file					"RPM package"
+//	@Success		206		{file}		file					"Requested range of the RPM package"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		404		{object}	object{error=string}	"Package not found"
+//	@Failure		416		"Range not satisfiable"
+//	@Security		BearerAuth
+//	@Router			/rpm/Packages/{package}/{file} [get]
+func handleRPMPackage(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		packageName := c.Param("package")
+		requested := "Packages/" + packageName + "/" + c.Param("file")
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "rpm")
+
+		// File names drop the epoch and add the architecture, so match against
+		// each version's location
+		artifacts, err := registryService.ListAll(ctx, &types.ArtifactFilter{Registry: "rpm", Name: packageName})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to look up package"})
+			return
+		}
+
+		var version string
+		for _, artifact := range artifacts {
+			pkg, ok := rpm.PackageFromArtifact(artifact)
+			if ok && artifact.Name == packageName && rpm.LocationHref(pkg) == requested {
+				version = artifact.Version
+				break
+			}
+		}
+		if version == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "rpm", packageName, version)
+		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+		defer content.Close()
+
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("package", packageName).Str("version", version).Msg("Failed to stream RPM package")
+		}
+	}
+}
+
+// GetRPMKey godoc
+//
+//	@Summary		Get repository signing key
+//	@Description	Download the armored public key that signs repomd.xml, for the gpgkey option of a .repo file
+//	@Tags			RPM
+//	@Produce		plain
+//	@Success		200	{string}	string					"Armored OpenPGP public key"
+//	@Failure		401	{object}	object{error=string}	"Unauthorized"
+//	@Failure		404	{object}	object{error=string}	"Repository is not signed"
+//	@Security		BearerAuth
+//	@Router			/rpm/key.asc [get]
+func handleRPMKey(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rpmHandler, err := rpmRegistry(registryService)
+		if err != nil || rpmHandler.SigningKey() == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "repository is not signed"})
+			return
+		}
+
+		key, err := signing.PublicKey(rpmHandler.SigningKey())
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("Failed to export RPM signing key")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export signing key"})
+			return
+		}
+
+		c.Data(http.StatusOK, "application/pgp-keys", key)
+	}
+}
+
+// UploadRPMPackage godoc
+//
+//	@Summary		Upload RPM package
+//	@Description	Upload a binary .rpm; its name, version and architecture are read from the package header
+//	@Tags			RPM
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			package	formData	file	true	".rpm package file"
+//	@Success		201		{object}	object{message=string,package=string,version=string,location=string}	"Package uploaded"
+//	@Failure		400		{object}	object{error=string}												"Invalid package"
+//	@Failure		401		{object}	object{error=string}												"Unauthorized"
+//	@Failure		500		{object}	object{error=string}												"Upload failed"
+//	@Security		BearerAuth
+//	@Router			/rpm/api/packages [post]
+func handleRPMUpload(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		file, header, err := c.Request.FormFile("package")
+		if requestTooLarge(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "package file required"})
+			return
+		}
+		defer file.Close()
+
+		if !strings.HasSuffix(header.Filename, ".rpm") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "package file must be .rpm format"})
+			return
+		}
+
+		content, err := io.ReadAll(io.LimitReader(file, maxRPMPackageSize+1))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read package file"})
+			return
+		}
+		if len(content) > maxRPMPackageSize {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "package file too large"})
+			return
+		}
+
+		// The package header is authoritative for the package identity
+		pkg, err := rpm.ReadPackage(content)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid RPM package: %v", err)})
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "rpm")
+		ctx = context.WithValue(ctx, "user_id", user.ID)
+
+		_, err = registryService.Upload(ctx, "rpm", pkg.Name, pkg.EVR(), bytes.NewReader(content), user.ID)
+		status, ok := uploadStatus(c, err, http.StatusCreated)
+		if !ok {
+			return
+		}
+
+		c.JSON(status, gin.H{
+			"message":  "package uploaded successfully",
+			"package":  pkg.Name,
+			"version":  pkg.EVR(),
+			"location": rpm.LocationHref(pkg),
+		})
+	}
+}
+
+// DeleteRPMPackage godoc
+//
+//	@Summary		Delete RPM package
+//	@Description	Remove a package version from the repository
+//	@Tags			RPM
+//	@Produce		json
+//	@Param			package	path		string	true	"Package name"
+//	@Param			version	path		string	true	"Package version as [epoch:]version-release"
+//	@Success		200		{object}	object{message=string}	"Package deleted"
+//	@Failure		401		{object}	object{error=string}	"Unauthorized"
+//	@Failure		500		{object}	object{error=string}	"Failed to delete package"
+//	@Security		BearerAuth
+//	@Router			/rpm/api/packages/{package}/{version} [delete]
+func handleRPMDelete(registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := middleware.GetUserFromContext(c)
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		packageName := c.Param("package")
+		version := c.Param("version")
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "rpm")
+		ctx = context.WithValue(ctx, "user_id", user.ID)
+
+		if err := registryService.Delete(ctx, "rpm", packageName, version, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete package"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "package deleted successfully",
+		})
+	}
+}
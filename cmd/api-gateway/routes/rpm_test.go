@@ -0,0 +1,257 @@
+package routes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rpm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createRPM builds a minimal binary RPM for name-version-release.arch that
+// provides itself and requires the given capabilities
+func createRPM(t *testing.T, name, version, release, arch string, requires ...string) []byte {
+	t.Helper()
+
+	header := func(entries [][]interface{}) []byte {
+		var index, store bytes.Buffer
+		for _, entry := range entries {
+			dataType, count := int32(6), 1
+			if values, ok := entry[1].([]string); ok {
+				dataType, count = 8, len(values)
+			}
+			binary.Write(&index, binary.BigEndian, []int32{int32(entry[0].(int)), dataType, int32(store.Len()), int32(count)})
+			switch value := entry[1].(type) {
+			case string:
+				store.WriteString(value + "\x00")
+			case []string:
+				for _, s := range value {
+					store.WriteString(s + "\x00")
+				}
+			}
+		}
+		var buf bytes.Buffer
+		buf.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+		binary.Write(&buf, binary.BigEndian, []int32{int32(len(entries)), int32(store.Len())})
+		buf.Write(index.Bytes())
+		buf.Write(store.Bytes())
+		return buf.Bytes()
+	}
+
+	var pkg bytes.Buffer
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3})
+	pkg.Write(lead)
+	pkg.Write(header(nil))
+	for pkg.Len()%8 != 0 {
+		pkg.WriteByte(0)
+	}
+	mainHeader := [][]interface{}{
+		{1000, name}, {1001, version}, {1002, release}, {1004, []string{"Package " + name}},
+		{1022, arch}, {1047, []string{name}}, {1027, []string{"/usr/bin/" + name}},
+	}
+	if len(requires) > 0 {
+		mainHeader = append(mainHeader, []interface{}{1049, requires})
+	}
+	pkg.Write(header(mainHeader))
+	pkg.WriteString("payload")
+	return pkg.Bytes()
+}
+
+// setupRPMRepository uploads packages through the upload handler and returns
+// a router serving the repository with the given signing key
+func setupRPMRepository(t *testing.T, key *openpgp.Entity, packages ...[]byte) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	handler, err := registryService.GetRegistry("rpm")
+	require.NoError(t, err)
+	handler.(*rpm.Registry).SetSigningKey(key)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	repo := router.Group("/rpm")
+	repo.GET("/repodata/:file", handleRPMRepodata(registryService))
+	repo.GET("/Packages/:package/:file", handleRPMPackage(registryService))
+	repo.GET("/key.asc", handleRPMKey(registryService))
+	repo.POST("/api/packages", handleRPMUpload(registryService))
+
+	for _, content := range packages {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("package", "package.rpm")
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest("POST", "/rpm/api/packages", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	return router
+}
+
+// TestRPMRoutes_Setup verifies that RPM routes can be registered without panicking
+func TestRPMRoutes_Setup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+
+	assert.NotPanics(t, func() {
+		RPMRoutes(api, &registry.Service{}, &auth.Service{})
+	})
+}
+
+// TestRPMRepository_ResolveLikeDnf walks the repository the way a YUM client
+// does: verify repomd.xml, fetch the primary index it lists, resolve the
+// package and its dependencies and download them, checking every checksum
+func TestRPMRepository_ResolveLikeDnf(t *testing.T) {
+	key, err := openpgp.NewEntity("Lodestone", "test", "dev@example.com", nil)
+	require.NoError(t, err)
+
+	router := setupRPMRepository(t, key,
+		createRPM(t, "hello", "2.10", "3.el9", "x86_64", "hello-data"),
+		createRPM(t, "hello-data", "1.2", "1", "noarch"),
+		createRPM(t, "unrelated", "1.0", "1", "noarch"),
+	)
+
+	get := func(path string) []byte {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		require.Equal(t, http.StatusOK, w.Code, path)
+		return w.Body.Bytes()
+	}
+	sha256Hex := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+
+	// repomd.xml must carry a valid signature
+	repomd := get("/rpm/repodata/repomd.xml")
+	_, err = openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{key}, bytes.NewReader(repomd), bytes.NewReader(get("/rpm/repodata/repomd.xml.asc")), nil)
+	require.NoError(t, err)
+
+	var index struct {
+		Data []struct {
+			Type     string `xml:"type,attr"`
+			Checksum string `xml:"checksum"`
+			Location struct {
+				Href string `xml:"href,attr"`
+			} `xml:"location"`
+		} `xml:"data"`
+	}
+	require.NoError(t, xml.Unmarshal(repomd, &index))
+
+	var primaryHref, primaryChecksum string
+	for _, data := range index.Data {
+		if data.Type == "primary" {
+			primaryHref, primaryChecksum = data.Location.Href, data.Checksum
+		}
+	}
+	require.NotEmpty(t, primaryHref)
+
+	// The primary index must match the checksum listed in repomd.xml
+	compressed := get("/rpm/" + primaryHref)
+	assert.Equal(t, primaryChecksum, sha256Hex(compressed))
+	gzipReader, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	document, err := io.ReadAll(gzipReader)
+	require.NoError(t, err)
+
+	type capability struct {
+		Name string `xml:"name,attr"`
+	}
+	var primary struct {
+		Packages []struct {
+			Name     string `xml:"name"`
+			Checksum string `xml:"checksum"`
+			Location struct {
+				Href string `xml:"href,attr"`
+			} `xml:"location"`
+			Provides []capability `xml:"format>provides>entry"`
+			Requires []capability `xml:"format>requires>entry"`
+		} `xml:"package"`
+	}
+	require.NoError(t, xml.Unmarshal(document, &primary))
+	require.Len(t, primary.Packages, 3)
+
+	// Resolve hello and everything it requires through provides
+	providers := make(map[string]int)
+	for i, pkg := range primary.Packages {
+		for _, provide := range pkg.Provides {
+			providers[provide.Name] = i
+		}
+	}
+	resolved := map[int]bool{}
+	queue := []string{"hello"}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		i, ok := providers[name]
+		require.True(t, ok, "nothing provides %s", name)
+		if resolved[i] {
+			continue
+		}
+		resolved[i] = true
+		for _, dependency := range primary.Packages[i].Requires {
+			queue = append(queue, dependency.Name)
+		}
+	}
+	require.Len(t, resolved, 2)
+
+	// Each package must match the checksum in the index
+	for i := range resolved {
+		pkg := primary.Packages[i]
+		assert.Equal(t, pkg.Checksum, sha256Hex(get("/rpm/"+pkg.Location.Href)), pkg.Name)
+	}
+	assert.Equal(t, "Packages/hello/hello-2.10-3.el9.x86_64.rpm", primary.Packages[providers["hello"]].Location.Href)
+
+	assert.Contains(t, string(get("/rpm/key.asc")), "BEGIN PGP PUBLIC KEY BLOCK")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/rpm/repodata/unknown-primary.xml.gz", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/rpm/Packages/hello/hello-9.9-1.x86_64.rpm", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// TestRPMRepository_Unsigned verifies that without a key the signature and
+// key endpoints are absent, which dnf treats as an unsigned repository
+func TestRPMRepository_Unsigned(t *testing.T) {
+	router := setupRPMRepository(t, nil, createRPM(t, "hello", "1.0", "1", "noarch"))
+
+	for path, status := range map[string]int{
+		"/rpm/repodata/repomd.xml":     http.StatusOK,
+		"/rpm/repodata/repomd.xml.asc": http.StatusNotFound,
+		"/rpm/key.asc":                 http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, status, w.Code, path)
+	}
+}
@@ -1,32 +1,44 @@
 package routes
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
 	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rubygems"
 	"github.com/lgulliver/lodestone/pkg/types"
 )
 
+// maxDependencyGems bounds how many gems a dependency API request may name,
+// matching rubygems.org
+const maxDependencyGems = 200
+
 // RubyGemsRoutes sets up RubyGems repository routes
 func RubyGemsRoutes(api *gin.RouterGroup, registryService *registry.Service, authService *auth.Service) {
 	gems := api.Group("/gems")
+	gems.Use(middleware.MaxUploadSize(registryService.MaxUploadSize("rubygems")))
 
 	// RubyGems API - requires authentication
 	gems.GET("/api/v1/gems", middleware.AuthMiddleware(authService), handleGemsSearch(registryService))
 	gems.GET("/api/v1/gems/:name.json", middleware.AuthMiddleware(authService), handleGemInfo(registryService))
 	gems.GET("/api/v1/versions/:name.json", middleware.AuthMiddleware(authService), handleGemVersions(registryService))
+	gems.GET("/api/v1/dependencies", middleware.AuthMiddleware(authService), handleGemDependencies(registryService, false))
+	gems.GET("/api/v1/dependencies.json", middleware.AuthMiddleware(authService), handleGemDependencies(registryService, true))
 	gems.GET("/gems/:filename", middleware.AuthMiddleware(authService), handleGemDownload(registryService))
 
 	// Gem push (requires authentication)
 	gems.POST("/api/v1/gems", middleware.AuthMiddleware(authService), handleGemPush(registryService))
-	gems.DELETE("/api/v1/gems/yank", middleware.AuthMiddleware(authService), handleGemYank(registryService))
+	gems.DELETE("/api/v1/gems/yank", middleware.AuthMiddleware(authService), handleGemYank(registryService, true))
+	gems.PUT("/api/v1/gems/unyank", middleware.AuthMiddleware(authService), handleGemYank(registryService, false))
 
 	// Specs endpoints for bundler - requires authentication
 	gems.GET("/specs.4.8.gz", middleware.AuthMiddleware(authService), handleSpecs(registryService))
@@ -93,21 +105,27 @@ func handleGemInfo(registryService *registry.Service) gin.HandlerFunc {
 		filter := &types.ArtifactFilter{
 			Name:     gemName,
 			Registry: "rubygems",
-			Limit:    1, // Get latest version
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, err := registryService.ListAll(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gem info"})
 			return
 		}
 
-		if len(artifacts) == 0 {
+		// The name filter matches substrings, so keep only this gem's versions
+		versions := make([]*types.Artifact, 0, len(artifacts))
+		for _, artifact := range artifacts {
+			if strings.EqualFold(artifact.Name, gemName) {
+				versions = append(versions, artifact)
+			}
+		}
+		if len(versions) == 0 {
 			c.JSON(http.StatusNotFound, gin.H{"error": "gem not found"})
 			return
 		}
 
-		artifact := artifacts[0]
+		artifact := registry.LatestArtifact(versions)
 		var description, author string
 		if artifact.Metadata != nil {
 			if desc, ok := artifact.Metadata["description"].(string); ok {
@@ -145,7 +163,7 @@ func handleGemVersions(registryService *registry.Service) gin.HandlerFunc {
 			Registry: "rubygems",
 		}
 
-		artifacts, _, err := registryService.List(ctx, filter)
+		artifacts, err := registryService.ListAll(ctx, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gem versions"})
 			return
@@ -157,6 +175,7 @@ func handleGemVersions(registryService *registry.Service) gin.HandlerFunc {
 				"number":     artifact.Version,
 				"created_at": artifact.CreatedAt,
 				"prerelease": false, // TODO: implement prerelease detection
+				"yanked":     registry.IsYanked(artifact),
 			})
 		}
 
@@ -164,6 +183,73 @@ func handleGemVersions(registryService *registry.Service) gin.HandlerFunc {
 	}
 }
 
+// handleGemDependencies serves Bundler's dependency API: every version of each
+// requested gem with its platform and runtime dependencies, Marshal encoded or
+// as JSON. Gems that do not exist are left out.
+func handleGemDependencies(registryService *registry.Service, asJSON bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var names []string
+		seen := make(map[string]bool)
+		for _, name := range strings.Split(c.Query("gems"), ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || seen[strings.ToLower(name)] {
+				continue
+			}
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+
+		if len(names) > maxDependencyGems {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": fmt.Sprintf("too many gems requested, the limit is %d", maxDependencyGems),
+			})
+			return
+		}
+
+		ctx := context.WithValue(c.Request.Context(), "registry", "rubygems")
+
+		versions := make([]rubygems.VersionInfo, 0)
+		for _, name := range names {
+			filter := &types.ArtifactFilter{
+				Name:     name,
+				Registry: "rubygems",
+			}
+
+			artifacts, err := registryService.ListAll(ctx, filter)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get gem dependencies"})
+				return
+			}
+
+			// The name filter matches substrings, so keep only this gem's
+			// versions. Yanked versions are not offered for resolution.
+			for _, artifact := range artifacts {
+				if strings.EqualFold(artifact.Name, name) && !registry.IsYanked(artifact) {
+					versions = append(versions, rubygems.NewVersionInfo(artifact))
+				}
+			}
+		}
+
+		if asJSON {
+			c.JSON(http.StatusOK, versions)
+			return
+		}
+
+		// Bundler probes the endpoint without gems and expects an empty body
+		if len(names) == 0 {
+			c.Data(http.StatusOK, "application/octet-stream", nil)
+			return
+		}
+
+		body, err := rubygems.MarshalDependencies(versions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode gem dependencies"})
+			return
+		}
+		c.Data(http.StatusOK, "application/octet-stream", body)
+	}
+}
+
 func handleGemDownload(registryService *registry.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		filename := c.Param("filename")
@@ -191,24 +277,22 @@ func handleGemDownload(registryService *registry.Service) gin.HandlerFunc {
 
 		ctx := context.WithValue(c.Request.Context(), "registry", "rubygems")
 
-		artifact, content, err := registryService.Download(ctx, "rubygems", gemName, version)
+		artifact, content, rng, err := downloadArtifact(c, ctx, registryService, "rubygems", gemName, version)
 		if err != nil {
+			if downloadBlocked(c, err) {
+				return
+			}
+			if errors.Is(err, errRangeNotSatisfiable) {
+				rangeNotSatisfiable(c, artifact.Size)
+				return
+			}
 			c.JSON(http.StatusNotFound, gin.H{"error": "gem not found"})
 			return
 		}
 
-		c.Header("Content-Type", "application/octet-stream")
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-
-		if artifact.Size > 0 {
-			c.Header("Content-Length", fmt.Sprintf("%d", artifact.Size))
-		}
-
 		defer content.Close()
-		_, err = io.Copy(c.Writer, content)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stream gem"})
-			return
+		if err := serveArtifact(c, artifact, content, rng); err != nil {
+			middleware.Logger(c).Error().Err(err).Str("gem", gemName).Str("version", version).Msg("Failed to stream gem")
 		}
 	}
 }
@@ -222,6 +306,9 @@ func handleGemPush(registryService *registry.Service) gin.HandlerFunc {
 		}
 
 		file, header, err := c.Request.FormFile("gem")
+		if requestTooLarge(c, err) {
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "gem file required"})
 			return
@@ -231,27 +318,28 @@ func handleGemPush(registryService *registry.Service) gin.HandlerFunc {
 		ctx := context.WithValue(c.Request.Context(), "registry", "rubygems")
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 
-		// Parse RubyGem filename: gemname-version.gem
 		filename := header.Filename
 		if !strings.HasSuffix(filename, ".gem") {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "gem file must be .gem format"})
 			return
 		}
 
-		nameVersion := strings.TrimSuffix(filename, ".gem")
-		parts := strings.Split(nameVersion, "-")
-		if len(parts) < 2 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid gem filename format, expected: gemname-version.gem"})
+		content, err := io.ReadAll(file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read gem file"})
 			return
 		}
 
-		// Last part is version, everything else is gem name
-		version := parts[len(parts)-1]
-		gemName := strings.Join(parts[:len(parts)-1], "-")
-
-		_, err = registryService.Upload(ctx, "rubygems", gemName, version, file, user.ID)
+		// The name and version come from the gemspec, since the file names of
+		// platform-specific gems also carry the platform
+		spec, err := rubygems.ExtractSpec(content)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid gem: %v", err)})
+			return
+		}
+
+		_, err = registryService.Upload(ctx, "rubygems", spec.Name, spec.Version, bytes.NewReader(content), user.ID)
+		if _, ok := uploadStatus(c, err, http.StatusOK); !ok {
 			return
 		}
 
@@ -259,7 +347,9 @@ func handleGemPush(registryService *registry.Service) gin.HandlerFunc {
 	}
 }
 
-func handleGemYank(registryService *registry.Service) gin.HandlerFunc {
+// handleGemYank yanks a gem version, as gem yank does, or unyanks it. Yanked
+// versions stay downloadable.
+func handleGemYank(registryService *registry.Service, yanked bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		user, exists := middleware.GetUserFromContext(c)
 		if !exists {
@@ -267,8 +357,13 @@ func handleGemYank(registryService *registry.Service) gin.HandlerFunc {
 			return
 		}
 
-		gemName := c.Query("gem_name")
-		version := c.Query("version")
+		params, err := gemYankParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body"})
+			return
+		}
+		gemName := params.Get("gem_name")
+		version := params.Get("version")
 
 		if gemName == "" || version == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "gem_name and version required"})
@@ -278,14 +373,40 @@ func handleGemYank(registryService *registry.Service) gin.HandlerFunc {
 		ctx := context.WithValue(c.Request.Context(), "registry", "rubygems")
 		ctx = context.WithValue(ctx, "user_id", user.ID)
 
-		err := registryService.Delete(ctx, "rubygems", gemName, version, user.ID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to yank gem"})
+		if _, err := registryService.Yank(ctx, "rubygems", gemName, version, yanked, user.ID); err != nil {
+			yankErrorStatus(c, err)
 			return
 		}
 
-		c.String(http.StatusOK, "Successfully yanked gem")
+		if yanked {
+			c.String(http.StatusOK, "Successfully yanked gem")
+			return
+		}
+		c.String(http.StatusOK, "Successfully unyanked gem")
+	}
+}
+
+// gemYankParams returns the parameters of a yank request. gem yank sends them
+// as a form body, which Go only parses for POST, PUT and PATCH requests, and
+// other clients as query parameters.
+func gemYankParams(c *gin.Context) (url.Values, error) {
+	params := c.Request.URL.Query()
+	if c.ContentType() != "application/x-www-form-urlencoded" {
+		return params, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<16))
+	if err != nil {
+		return nil, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range form {
+		params[key] = values
 	}
+	return params, nil
 }
 
 // Specs endpoints - simplified implementations
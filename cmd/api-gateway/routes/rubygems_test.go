@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rubygems"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createGem builds a minimal .gem whose gemspec has the given platform and
+// runtime dependencies, given as name and requirement pairs
+func createGem(t *testing.T, name, version, platform string, dependencies ...string) []byte {
+	t.Helper()
+
+	var spec strings.Builder
+	fmt.Fprintf(&spec, "--- !ruby/object:Gem::Specification\nname: %s\nversion: !ruby/object:Gem::Version\n  version: '%s'\nplatform: %s\nsummary: Test gem\ndependencies:\n", name, version, platform)
+	for i := 0; i+1 < len(dependencies); i += 2 {
+		operator, requirement, _ := strings.Cut(dependencies[i+1], " ")
+		fmt.Fprintf(&spec, "- !ruby/object:Gem::Dependency\n  name: %s\n  requirement: !ruby/object:Gem::Requirement\n    requirements:\n    - - \"%s\"\n      - !ruby/object:Gem::Version\n        version: '%s'\n  type: :runtime\n",
+			dependencies[i], operator, requirement)
+	}
+
+	var metadata bytes.Buffer
+	gz := gzip.NewWriter(&metadata)
+	_, err := gz.Write([]byte(spec.String()))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "metadata.gz", Mode: 0644, Size: int64(metadata.Len())}))
+	_, err = tw.Write(metadata.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestGemDependencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.POST("/gems/api/v1/gems", handleGemPush(registryService))
+	router.GET("/gems/api/v1/dependencies", handleGemDependencies(registryService, false))
+	router.GET("/gems/api/v1/dependencies.json", handleGemDependencies(registryService, true))
+
+	// Platform-specific gems are pushed by their gemspec, not their file name
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("gem", "nokogiri-1.16.0-x86_64-linux.gem")
+	require.NoError(t, err)
+	_, err = part.Write(createGem(t, "nokogiri", "1.16.0", "x86_64-linux", "racc", "~> 1.4"))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	req := httptest.NewRequest("POST", "/gems/api/v1/gems", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	for _, version := range []string{"2.0.0", "2.1.0"} {
+		gem := createGem(t, "rack-test", version, "ruby", "rack", ">= 1.3")
+		_, err := registryService.Upload(ctx, "rubygems", "rack-test", version, bytes.NewReader(gem), user.ID)
+		require.NoError(t, err)
+	}
+	_, err = registryService.Upload(ctx, "rubygems", "rack", "3.0.0", bytes.NewReader(createGem(t, "rack", "3.0.0", "ruby")), user.ID)
+	require.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w = get("/gems/api/v1/dependencies?gems=nokogiri,missing,rack")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+
+	decoded, err := rubygems.Unmarshal(w.Body.Bytes())
+	require.NoError(t, err)
+	entries, ok := decoded.([]interface{})
+	require.True(t, ok)
+	require.Len(t, entries, 2, "missing gems are left out and rack-test does not match rack")
+
+	nokogiri := entries[0].(rubygems.Hash)
+	assert.Equal(t, "nokogiri", nokogiri.Get(rubygems.Symbol("name")))
+	assert.Equal(t, "1.16.0", nokogiri.Get(rubygems.Symbol("number")))
+	assert.Equal(t, "x86_64-linux", nokogiri.Get(rubygems.Symbol("platform")))
+	assert.Equal(t, []interface{}{[]interface{}{"racc", "~> 1.4"}}, nokogiri.Get(rubygems.Symbol("dependencies")))
+
+	rack := entries[1].(rubygems.Hash)
+	assert.Equal(t, "rack", rack.Get(rubygems.Symbol("name")))
+	assert.Equal(t, "ruby", rack.Get(rubygems.Symbol("platform")))
+	assert.Equal(t, []interface{}{}, rack.Get(rubygems.Symbol("dependencies")))
+
+	w = get("/gems/api/v1/dependencies.json?gems=rack-test")
+	require.Equal(t, http.StatusOK, w.Code)
+	var versions []rubygems.VersionInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &versions))
+	require.Len(t, versions, 2)
+	for _, version := range versions {
+		assert.Equal(t, [][]string{{"rack", ">= 1.3"}}, version.Dependencies)
+	}
+
+	// Bundler checks the endpoint is available by requesting no gems
+	w = get("/gems/api/v1/dependencies")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.Bytes())
+
+	names := make([]string, maxDependencyGems+1)
+	for i := range names {
+		names[i] = fmt.Sprintf("gem-%d", i)
+	}
+	w = get("/gems/api/v1/dependencies?gems=" + strings.Join(names, ","))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestGemYank(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	ctx := context.Background()
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		_, err := registryService.Upload(ctx, "rubygems", "rake", version, bytes.NewReader(createGem(t, "rake", version, "ruby")), user.ID)
+		require.NoError(t, err)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/gems/api/v1/gems/:name", handleGemInfo(registryService))
+	router.GET("/gems/api/v1/dependencies.json", handleGemDependencies(registryService, true))
+	router.GET("/gems/gems/:filename", handleGemDownload(registryService))
+	router.DELETE("/gems/api/v1/gems/yank", handleGemYank(registryService, true))
+	router.PUT("/gems/api/v1/gems/unyank", handleGemYank(registryService, false))
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	latest := func() string {
+		w := serve("GET", "/gems/api/v1/gems/rake", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var info map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &info))
+		return info["version"].(string)
+	}
+	assert.Equal(t, "1.1.0", latest())
+
+	// gem yank sends its parameters as a form body
+	w := serve("DELETE", "/gems/api/v1/gems/yank", "gem_name=rake&version=1.1.0")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "1.0.0", latest(), "yanked versions are not the latest")
+
+	w = serve("GET", "/gems/api/v1/dependencies.json?gems=rake", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var versions []rubygems.VersionInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &versions))
+	require.Len(t, versions, 1, "yanked versions are not offered for resolution")
+	assert.Equal(t, "1.0.0", versions[0].Number)
+
+	// Yanked versions stay downloadable by exact version
+	assert.Equal(t, http.StatusOK, serve("GET", "/gems/gems/rake-1.1.0.gem", "").Code)
+
+	w = serve("PUT", "/gems/api/v1/gems/unyank?gem_name=rake&version=1.1.0", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "1.1.0", latest())
+}
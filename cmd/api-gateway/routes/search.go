@@ -0,0 +1,122 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/metadata"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// SearchRoutes sets up the cross-registry search routes
+func SearchRoutes(api *gin.RouterGroup, metadataService *metadata.Service, registryService *registry.Service, authService *auth.Service) {
+	api.GET("/search", middleware.AuthMiddleware(authService), handleSearch(metadataService, registryService))
+}
+
+// Search godoc
+//
+//	@Summary		Search packages across all registries
+//	@Description	Search artifacts in every registry format that the caller can read, ranked by a blend of name relevance and popularity
+//	@Tags			Search
+//	@Produce		json
+//	@Param			q			query		string	false	"Search term"
+//	@Param			registry	query		string	false	"Comma-separated registry subset (e.g., npm,nuget)"
+//	@Param			tags		query		string	false	"Comma-separated tags"
+//	@Param			publisher	query		string	false	"Publisher username"
+//	@Param			label		query		string	false	"Comma-separated label selector that must all match (e.g., team=payments,env=prod)"
+//	@Param			sort_by		query		string	false	"Sort field: relevance, name, created_at, downloads, updated_at"
+//	@Param			sort_order	query		string	false	"Sort order: asc, desc"
+//	@Param			page		query		int		false	"Page number"
+//	@Param			per_page	query		int		false	"Results per page (max 100)"
+//	@Success		200			{object}	types.PaginatedResponse	"Search results"
+//	@Failure		400			{object}	types.APIResponse		"Invalid label selector"
+//	@Failure		401			{object}	types.APIResponse		"Unauthorized"
+//	@Failure		500			{object}	types.APIResponse		"Search failed"
+//	@Security		BearerAuth
+//	@Router			/search [get]
+func handleSearch(metadataService *metadata.Service, registryService *registry.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+		readable, err := registryService.ReadableScope(c.Request.Context(), user)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("Failed to get readable packages")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "search failed",
+			})
+			return
+		}
+
+		query := &metadata.SearchQuery{
+			Query:      c.Query("q"),
+			Registries: splitQueryList(c.QueryArray("registry")),
+			Tags:       splitQueryList(c.QueryArray("tags")),
+			Publisher:  c.Query("publisher"),
+			SortBy:     c.DefaultQuery("sort_by", "relevance"),
+			SortOrder:  "DESC",
+			Page:       1,
+			PerPage:    20,
+			Scope:      readable,
+		}
+
+		labels, err := registry.ParseLabelSelector(strings.Join(c.QueryArray("label"), ","))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		query.Labels = labels
+
+		if strings.EqualFold(c.Query("sort_order"), "asc") {
+			query.SortOrder = "ASC"
+		}
+		if pageStr := c.Query("page"); pageStr != "" {
+			if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+				query.Page = p
+			}
+		}
+		if perPageStr := c.Query("per_page"); perPageStr != "" {
+			if pp, err := strconv.Atoi(perPageStr); err == nil && pp > 0 && pp <= 100 {
+				query.PerPage = pp
+			}
+		}
+
+		results, err := metadataService.SearchArtifacts(c.Request.Context(), query)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("query", query.Query).Msg("Cross-registry search failed")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "search failed",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.PaginatedResponse{
+			APIResponse: types.APIResponse{
+				Success: true,
+				Data:    results.Artifacts,
+			},
+			Pagination: &results.Pagination,
+		})
+	}
+}
+
+// splitQueryList flattens repeated and comma-separated query values
+func splitQueryList(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,209 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/metadata"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchRoutes_Setup verifies that search routes can be registered without panicking
+func TestSearchRoutes_Setup(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	api := router.Group("/api/v1")
+
+	assert.NotPanics(t, func() {
+		SearchRoutes(api, &metadata.Service{}, &registry.Service{}, &auth.Service{})
+	})
+
+	found := false
+	for _, route := range router.Routes() {
+		if route.Method == "GET" && route.Path == "/api/v1/search" {
+			found = true
+		}
+	}
+	assert.True(t, found, "search route should be registered")
+}
+
+func TestHandleSearch_AcrossRegistries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	db := registryService.DB.DB
+	require.NoError(t, db.AutoMigrate(&metadata.ArtifactIndex{}))
+
+	for _, a := range []struct{ name, registry string }{
+		{"yaml", "npm"},
+		{"YamlDotNet", "nuget"},
+		{"serde-yaml", "cargo"},
+		{"left-pad", "npm"},
+	} {
+		require.NoError(t, db.Create(&types.Artifact{
+			Name:        a.name,
+			Version:     "1.0.0",
+			Registry:    a.registry,
+			PublishedBy: user.ID,
+		}).Error)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user", user) })
+	router.GET("/search", handleSearch(metadata.NewService(db, &config.Config{}), registryService))
+
+	search := func(url string) []types.Artifact {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data       []types.Artifact     `json:"data"`
+			Pagination types.PaginationInfo `json:"pagination"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	results := search("/search?q=yaml")
+	require.Len(t, results, 3)
+	assert.Equal(t, "yaml", results[0].Name)
+	registries := []string{}
+	for _, artifact := range results {
+		registries = append(registries, artifact.Registry)
+	}
+	assert.ElementsMatch(t, []string{"npm", "nuget", "cargo"}, registries)
+
+	results = search("/search?q=yaml&registry=nuget,cargo")
+	require.Len(t, results, 2)
+	for _, artifact := range results {
+		assert.Contains(t, []string{"nuget", "cargo"}, artifact.Registry)
+	}
+
+	results = search("/search?q=yaml&registry=cargo&registry=npm&per_page=1")
+	require.Len(t, results, 1)
+	assert.Equal(t, "yaml", results[0].Name)
+}
+
+func TestHandleSearch_LabelSelector(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	db := registryService.DB.DB
+	require.NoError(t, db.AutoMigrate(&metadata.ArtifactIndex{}))
+
+	for name, labels := range map[string]map[string]string{
+		"payments-api": {"team": "payments", "env": "prod"},
+		"payments-sdk": {"team": "payments", "env": "dev"},
+		"search-api":   {"team": "search", "env": "prod"},
+	} {
+		require.NoError(t, db.Create(&types.Artifact{
+			Name:        name,
+			Version:     "1.0.0",
+			Registry:    "npm",
+			PublishedBy: user.ID,
+			Labels:      labels,
+		}).Error)
+	}
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user", user) })
+	router.GET("/search", handleSearch(metadata.NewService(db, &config.Config{}), registryService))
+
+	search := func(url string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	names := func(url string) []string {
+		w := search(url)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data []types.Artifact `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		var names []string
+		for _, artifact := range response.Data {
+			names = append(names, artifact.Name)
+		}
+		return names
+	}
+
+	assert.ElementsMatch(t, []string{"payments-api", "payments-sdk"}, names("/search?label=team=payments"))
+	assert.Equal(t, []string{"payments-api"}, names("/search?label=team=payments,env=prod"))
+	assert.Equal(t, []string{"search-api"}, names("/search?q=api&label=team=search&label=env=prod"))
+
+	assert.Equal(t, http.StatusBadRequest, search("/search?label=team").Code)
+}
+
+func TestHandleSearch_Visibility(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	db := registryService.DB.DB
+	require.NoError(t, db.AutoMigrate(&metadata.ArtifactIndex{}))
+	ctx := context.Background()
+
+	reader := &types.User{Username: "reader", Email: "reader@example.com", Password: "hashed", IsActive: true}
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	for _, user := range []*types.User{reader, outsider, admin} {
+		require.NoError(t, db.Create(user).Error)
+	}
+
+	for _, artifact := range []*types.Artifact{
+		{Name: "yaml", Version: "1.0.0", Registry: "npm", PublishedBy: publisher.ID, IsPublic: true},
+		{Name: "yaml-internal", Version: "1.0.0", Registry: "npm", PublishedBy: publisher.ID},
+		{Name: "yaml-secret", Version: "1.0.0", Registry: "npm", PublishedBy: publisher.ID},
+	} {
+		require.NoError(t, db.Create(artifact).Error)
+	}
+	require.NoError(t, registryService.Ownership.EstablishInitialOwnership(ctx, "npm", "yaml-internal", publisher.ID))
+	require.NoError(t, registryService.GrantPackageAccess(ctx, "npm", "yaml-internal", reader.Username, registry.AccessReadOnly, publisher.ID))
+
+	metadataService := metadata.NewService(db, &config.Config{})
+	search := func(user *types.User) []string {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			if user != nil {
+				c.Set("user", user)
+			}
+		})
+		router.GET("/search", handleSearch(metadataService, registryService))
+
+		req := httptest.NewRequest("GET", "/search?q=yaml&sort_by=name&sort_order=asc", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data []types.Artifact `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		names := []string{}
+		for _, artifact := range response.Data {
+			names = append(names, artifact.Name)
+		}
+		return names
+	}
+
+	// Restricted packages are found only by those who can read them
+	assert.Equal(t, []string{"yaml", "yaml-internal", "yaml-secret"}, search(publisher))
+	assert.Equal(t, []string{"yaml", "yaml-internal"}, search(reader))
+	assert.Equal(t, []string{"yaml"}, search(outsider))
+	assert.Equal(t, []string{"yaml"}, search(nil))
+	assert.Equal(t, []string{"yaml", "yaml-internal", "yaml-secret"}, search(admin))
+}
@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/metadata"
+	"github.com/lgulliver/lodestone/internal/registry"
+)
+
+// PackageStatsRoutes sets up the package download statistics routes
+func PackageStatsRoutes(api *gin.RouterGroup, registryService *registry.Service, metadataService *metadata.Service, authService *auth.Service) {
+	packages := api.Group("/packages")
+	packages.Use(middleware.AuthMiddleware(authService))
+
+	packages.GET("/:registry/:package/stats", handleGetPackageStats(registryService, metadataService))
+}
+
+// GetPackageStats godoc
+//
+//	@Summary		Get package download statistics
+//	@Description	Daily downloads of each version of a package over a window of days ending today (UTC). Every version has a bucket for every day, zero when it was not downloaded
+//	@Tags			Packages
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget, helm, cargo)"
+//	@Param			package		path		string	true	"Package name"
+//	@Param			period		query		string	false	"Window as a number of days from 1d to 365d, or week, month, quarter or year (default 30d)"
+//	@Success		200			{object}	metadata.PackageDownloadSeries	"Daily downloads per version"
+//	@Failure		400			{object}	object{error=string}			"Invalid period"
+//	@Failure		401			{object}	object{error=string}			"Unauthorized"
+//	@Failure		404			{object}	object{error=string}			"Package not found"
+//	@Failure		500			{object}	object{error=string}			"Failed to retrieve statistics"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/stats [get]
+func handleGetPackageStats(registryService *registry.Service, metadataService *metadata.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		registryType := c.Param("registry")
+		name := c.Param("package")
+
+		days, err := metadata.ParseStatsPeriod(c.Query("period"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Packages the user cannot read have no statistics to show
+		readable, err := registryService.CanReadPackage(c.Request.Context(), registryType, name)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to check package read access")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve statistics"})
+			return
+		}
+		if !readable {
+			c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+			return
+		}
+
+		series, err := metadataService.GetPackageDownloadSeries(c.Request.Context(), registryType, name, days)
+		if err != nil {
+			if errors.Is(err, metadata.ErrPackageNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "package not found"})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Msg("Failed to retrieve package download statistics")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve statistics"})
+			return
+		}
+
+		c.JSON(http.StatusOK, series)
+	}
+}
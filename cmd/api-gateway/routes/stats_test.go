@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/metadata"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPackageStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&types.User{}, &types.Artifact{}))
+	// The event table uses Postgres defaults, so is created by hand
+	require.NoError(t, db.Exec("CREATE TABLE download_events (id INTEGER PRIMARY KEY, artifact_id TEXT, timestamp DATETIME)").Error)
+
+	user := &types.User{Username: "publisher", Email: "publisher@example.com", Password: "hashed"}
+	require.NoError(t, db.Create(user).Error)
+	artifact := &types.Artifact{Name: "left-pad", Version: "1.0.0", Registry: "npm", PublishedBy: user.ID}
+	require.NoError(t, db.Create(artifact).Error)
+	require.NoError(t, db.Exec("INSERT INTO download_events (artifact_id, timestamp) VALUES (?, ?)", artifact.ID.String(), time.Now().UTC()).Error)
+
+	router := gin.New()
+	router.GET("/packages/:registry/:package/stats", handleGetPackageStats(registry.NewService(&common.Database{DB: db}, nil), metadata.NewService(db, &config.Config{})))
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := get("/packages/npm/left-pad/stats?period=week")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var series metadata.PackageDownloadSeries
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &series))
+	assert.Equal(t, int64(1), series.Total)
+	require.Len(t, series.Versions, 1)
+	require.Len(t, series.Versions[0].Daily, 7)
+	assert.Equal(t, int64(1), series.Versions[0].Daily[6].Downloads)
+
+	w = get("/packages/npm/left-pad/stats")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &series))
+	assert.Len(t, series.Versions[0].Daily, metadata.DefaultStatsPeriodDays)
+
+	assert.Equal(t, http.StatusBadRequest, get("/packages/npm/left-pad/stats?period=forever").Code)
+	assert.Equal(t, http.StatusNotFound, get("/packages/npm/right-pad/stats").Code)
+}
+
+func TestPackageStats_RestrictedPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	require.NoError(t, registryService.DB.Exec("CREATE TABLE download_events (id INTEGER PRIMARY KEY, artifact_id TEXT, timestamp DATETIME)").Error)
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, registryService.DB.Create(outsider).Error)
+
+	tarball := createNpmTarball(t, `{"name":"restricted","version":"1.0.0"}`, nil)
+	_, err := registryService.Upload(context.Background(), "npm", "restricted", "1.0.0", bytes.NewReader(tarball), publisher.ID)
+	require.NoError(t, err)
+
+	metadataService := metadata.NewService(registryService.DB.DB, &config.Config{})
+	get := func(user *types.User) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/packages/:registry/:package/stats", handleGetPackageStats(registryService, metadataService))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/packages/npm/restricted/stats", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get(publisher).Code)
+
+	// Users who cannot read the package cannot see its downloads either
+	w := get(outsider)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "1.0.0")
+}
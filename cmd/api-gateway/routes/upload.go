@@ -0,0 +1,56 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/opa"
+	"github.com/lgulliver/lodestone/pkg/checksum"
+)
+
+// uploadStatus maps the result of registryService.Upload to the status of a
+// successful response: created, or 200 OK when an identical re-publish was
+// accepted idempotently. On failure it writes the error response, 409 if the
+// version already exists, 413 if the body was too large or 400 if it is not a
+// package of the registry's format, is an OPA bundle that does not compile or
+// does not match the checksum supplied with it, and returns false.
+func uploadStatus(c *gin.Context, err error, created int) (int, bool) {
+	switch {
+	case err == nil:
+		return created, true
+	case errors.Is(err, registry.ErrArtifactUnchanged):
+		return http.StatusOK, true
+	case errors.Is(err, registry.ErrArtifactExists), errors.Is(err, registry.ErrVersionPreviouslyPublished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrQuotaExceeded):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrSignatureRequired), errors.Is(err, registry.ErrUnexpectedContentFormat),
+		errors.Is(err, opa.ErrInvalidBundle), errors.Is(err, checksum.ErrMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, registry.ErrSignatureInvalid), errors.Is(err, auth.ErrAPIKeyScopeForbidden),
+		errors.Is(err, registry.ErrPublishForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case requestTooLarge(c, err):
+		// already responded 413
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("upload failed: %v", err)})
+	}
+	return 0, false
+}
+
+// requestTooLarge responds 413 if err is from reading a request body past the
+// limit set by middleware.MaxUploadSize
+func requestTooLarge(c *gin.Context, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return false
+	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error": fmt.Sprintf("request body exceeds the maximum upload size of %d bytes", maxBytesErr.Limit),
+	})
+	return true
+}
@@ -0,0 +1,308 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/pkg/checksum"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/signing"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUpload_IdempotentRepublish verifies that a retried publish with
+// identical content succeeds while differing content conflicts
+func TestUpload_IdempotentRepublish(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	publish := func(router *gin.Engine, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("package", "package.deb")
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest("POST", "/debian/api/packages", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	newRouter := func(idempotent bool) *gin.Engine {
+		registryService, user := setupRegistryTestService(t)
+		registryService.Configure(config.RegistryConfig{IdempotentPublish: idempotent})
+
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+			c.Next()
+		})
+		router.POST("/debian/api/packages", handleDebianUpload(registryService))
+		return router
+	}
+
+	original := createDeb(t, "Package: hello\nVersion: 1.0\nArchitecture: all\nDescription: greeting\n")
+	changed := createDeb(t, "Package: hello\nVersion: 1.0\nArchitecture: all\nDescription: a different greeting\n")
+
+	t.Run("identical content succeeds", func(t *testing.T) {
+		router := newRouter(true)
+		assert.Equal(t, http.StatusCreated, publish(router, original).Code)
+
+		w := publish(router, original)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"version":"1.0"`)
+	})
+
+	t.Run("differing content conflicts", func(t *testing.T) {
+		router := newRouter(true)
+		assert.Equal(t, http.StatusCreated, publish(router, original).Code)
+
+		w := publish(router, changed)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "already exists")
+	})
+
+	t.Run("disabled conflicts on identical content", func(t *testing.T) {
+		router := newRouter(false)
+		assert.Equal(t, http.StatusCreated, publish(router, original).Code)
+		assert.Equal(t, http.StatusConflict, publish(router, original).Code)
+	})
+}
+
+// TestUpload_SignatureRequired verifies that uploads to a registry requiring
+// signatures are accepted only with a signature by a trusted key, supplied as
+// a sibling file or header
+func TestUpload_SignatureRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := openpgp.NewEntity("Release", "", "release@example.com", nil)
+	require.NoError(t, err)
+	publicKey, err := signing.PublicKey(key)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "release.asc")
+	require.NoError(t, os.WriteFile(keyPath, publicKey, 0o600))
+
+	registryService, user := setupRegistryTestService(t)
+	registryService.Configure(config.RegistryConfig{SignatureKeyringPath: keyPath})
+	require.NoError(t, registryService.Settings.SetRequireSignature(context.Background(), "debian", true, user.ID))
+
+	router := gin.New()
+	router.Use(middleware.ArtifactSignatureMiddleware())
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.POST("/debian/api/packages", handleDebianUpload(registryService))
+
+	publish := func(content, signature []byte, header string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("package", "package.deb")
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+		if signature != nil {
+			part, err = writer.CreateFormFile(middleware.SignatureFormField, "package.deb.asc")
+			require.NoError(t, err)
+			_, err = part.Write(signature)
+			require.NoError(t, err)
+		}
+		require.NoError(t, writer.Close())
+
+		req := httptest.NewRequest("POST", "/debian/api/packages", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		if header != "" {
+			req.Header.Set(middleware.SignatureHeader, header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := createDeb(t, "Package: hello\nVersion: 1.0\nArchitecture: all\nDescription: greeting\n")
+	second := createDeb(t, "Package: hello\nVersion: 2.0\nArchitecture: all\nDescription: greeting\n")
+	signature, err := signing.DetachSign(first, key)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusBadRequest, publish(first, nil, "").Code)
+
+	w := publish(second, signature, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "signature verification failed")
+
+	assert.Equal(t, http.StatusCreated, publish(first, signature, "").Code)
+
+	signature, err = signing.DetachSign(second, key)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, publish(second, nil, base64.StdEncoding.EncodeToString(signature)).Code)
+
+	var count int64
+	require.NoError(t, registryService.DB.Model(&types.Artifact{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
+
+// TestUpload_MaxUploadSize verifies that uploads larger than their registry's
+// limit are rejected with 413, whether or not they declare their length,
+// while uploads within it are accepted
+func TestUpload_MaxUploadSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	registryService.Configure(config.RegistryConfig{
+		MaxUploadSize:  1 << 20,
+		MaxUploadSizes: map[string]int64{"debian": 4 << 10},
+	})
+	assert.Equal(t, int64(1<<20), registryService.MaxUploadSize("maven"))
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	debian := router.Group("/debian", middleware.MaxUploadSize(registryService.MaxUploadSize("debian")))
+	debian.POST("/api/packages", handleDebianUpload(registryService))
+	maven := router.Group("/maven", middleware.MaxUploadSize(registryService.MaxUploadSize("maven")))
+	maven.PUT("/*path", handleMavenUpload(registryService))
+
+	// send makes a request, hiding the body's length when chunked so the limit
+	// is only reached while reading it
+	send := func(method, path, contentType string, body []byte, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if chunked {
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			req.ContentLength = -1
+		}
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	debianForm := func(content []byte) ([]byte, string) {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("package", "package.deb")
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		return body.Bytes(), writer.FormDataContentType()
+	}
+
+	large, contentType := debianForm(bytes.Repeat([]byte("x"), 8<<10))
+	for _, chunked := range []bool{false, true} {
+		w := send("POST", "/debian/api/packages", contentType, large, chunked)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "chunked: %v", chunked)
+		assert.Contains(t, w.Body.String(), "maximum upload size")
+
+		w = send("PUT", "/maven/com/example/big/1.0/big-1.0.jar", "application/java-archive", bytes.Repeat([]byte("x"), 2<<20), chunked)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "chunked: %v", chunked)
+	}
+
+	small, contentType := debianForm(createDeb(t, "Package: hello\nVersion: 1.0\nArchitecture: all\nDescription: greeting\n"))
+	assert.Equal(t, http.StatusCreated, send("POST", "/debian/api/packages", contentType, small, true).Code)
+	assert.Equal(t, http.StatusCreated, send("PUT", "/maven/com/example/big/1.0/big-1.0.jar", "application/java-archive", bytes.Repeat([]byte("x"), 512<<10), false).Code)
+
+	var count int64
+	require.NoError(t, registryService.DB.Model(&types.Artifact{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+}
+
+// TestUpload_UnexpectedContentFormat verifies that strict content validation
+// rejects a package that is not in its registry's format with 400
+func TestUpload_UnexpectedContentFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	registryService.Configure(config.RegistryConfig{StrictContentValidation: true})
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.PUT("/opa/bundles/:name/versions/:version", handleOPABundleVersionUpload(registryService))
+
+	req := httptest.NewRequest("PUT", "/opa/bundles/policies/versions/1.0.0", bytes.NewReader([]byte("PK\x03\x04 a zip, not a bundle")))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "expected opa gzip content, got zip")
+
+	var count int64
+	require.NoError(t, registryService.DB.Model(&types.Artifact{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+// TestUpload_Checksum verifies that uploads are rejected with 400, and not
+// stored, when they do not match a Content-Digest or X-Checksum-Sha256
+// supplied with them, and are accepted when they match or none is supplied
+func TestUpload_Checksum(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+
+	router := gin.New()
+	router.Use(middleware.UploadChecksumMiddleware())
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.PUT("/opa/bundles/:name/versions/:version", handleOPABundleVersionUpload(registryService))
+
+	bundle := createOPABundle(t, map[string]string{"policies/policy.rego": "package policies\n\ndefault allow := false\n"})
+	sum := sha256.Sum256(bundle)
+	corrupted := sha256.Sum256([]byte("corrupted"))
+	contentDigest := func(sum [32]byte) string {
+		return checksum.Digest{Algorithm: "sha-256", Sum: sum[:]}.String()
+	}
+
+	tests := []struct {
+		name    string
+		version string
+		header  string
+		value   string
+		status  int
+	}{
+		{"no checksum", "1.0.0", "", "", http.StatusCreated},
+		{"matching Content-Digest", "1.0.1", middleware.ContentDigestHeader, contentDigest(sum), http.StatusCreated},
+		{"mismatched Content-Digest", "1.0.2", middleware.ContentDigestHeader, contentDigest(corrupted), http.StatusBadRequest},
+		{"invalid Content-Digest", "1.0.3", middleware.ContentDigestHeader, "sha-256=:invalid:", http.StatusBadRequest},
+		{"matching X-Checksum-Sha256", "1.0.4", middleware.ChecksumSHA256Header, hex.EncodeToString(sum[:]), http.StatusCreated},
+		{"mismatched X-Checksum-Sha256", "1.0.5", middleware.ChecksumSHA256Header, hex.EncodeToString(corrupted[:]), http.StatusBadRequest},
+		{"invalid X-Checksum-Sha256", "1.0.6", middleware.ChecksumSHA256Header, "abcd", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/opa/bundles/policies/versions/"+tt.version, bytes.NewReader(bundle))
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+
+			var count int64
+			require.NoError(t, registryService.DB.Model(&types.Artifact{}).Where("version = ?", tt.version).Count(&count).Error)
+			assert.Equal(t, tt.status == http.StatusCreated, count == 1)
+		})
+	}
+}
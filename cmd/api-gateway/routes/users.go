@@ -0,0 +1,354 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// createUserRequest is the body of an administrative account creation
+type createUserRequest struct {
+	types.RegisterRequest
+	IsAdmin bool `json:"is_admin"`
+}
+
+// userAdminRequest is the body of a promotion or demotion
+type userAdminRequest struct {
+	IsAdmin *bool `json:"is_admin" binding:"required"`
+}
+
+// resetPasswordRequest is the body of an administrative password reset
+type resetPasswordRequest struct {
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// parseUserID reads the user ID path parameter. It writes the error response
+// and returns false if it is not a valid ID.
+func parseUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.APIResponse{
+			Success: false,
+			Error:   "Invalid user ID",
+		})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// writeUserError writes the response for a failed administrative user action
+func writeUserError(c *gin.Context, err error, userID uuid.UUID, message string) {
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, types.APIResponse{
+			Success: false,
+			Error:   "User not found",
+		})
+	case errors.Is(err, auth.ErrSelfModification), auth.IsPasswordPolicyError(err):
+		c.JSON(http.StatusBadRequest, types.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	default:
+		middleware.Logger(c).Error().Err(err).Str("user_id", userID.String()).Msg("failed to update user")
+		c.JSON(http.StatusInternalServerError, types.APIResponse{
+			Success: false,
+			Error:   message,
+		})
+	}
+}
+
+// ListUsers godoc
+//
+//	@Summary		List users
+//	@Description	List user accounts ordered by username
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			page		query		int	false	"Page number"		default(1)
+//	@Param			per_page	query		int	false	"Items per page"	default(50)
+//	@Success		200			{object}	types.PaginatedResponse{data=[]types.User}	"Users retrieved successfully"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		500			{object}	types.APIResponse	"Failed to list users"
+//	@Security		BearerAuth
+//	@Router			/admin/users [get]
+func listUsers(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page := 1
+		perPage := 50
+		if pageStr := c.Query("page"); pageStr != "" {
+			if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
+				page = p
+			}
+		}
+		if perPageStr := c.Query("per_page"); perPageStr != "" {
+			if pp, err := strconv.Atoi(perPageStr); err == nil && pp > 0 && pp <= 100 {
+				perPage = pp
+			}
+		}
+
+		users, total, err := authService.ListUsers(c.Request.Context(), perPage, (page-1)*perPage)
+		if err != nil {
+			middleware.Logger(c).Error().Err(err).Msg("failed to list users")
+			c.JSON(http.StatusInternalServerError, types.APIResponse{
+				Success: false,
+				Error:   "Failed to list users",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, types.PaginatedResponse{
+			APIResponse: types.APIResponse{
+				Success: true,
+				Data:    users,
+			},
+			Pagination: &types.PaginationInfo{
+				Page:       page,
+				PerPage:    perPage,
+				Total:      total,
+				TotalPages: int((total + int64(perPage) - 1) / int64(perPage)),
+			},
+		})
+	}
+}
+
+// CreateUser godoc
+//
+//	@Summary		Create a user
+//	@Description	Create a user account, optionally with admin privileges. The password must satisfy the password policy.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			user	body		createUserRequest	true	"Account details"
+//	@Success		201		{object}	types.APIResponse{data=types.User}	"User created successfully"
+//	@Failure		400		{object}	types.APIResponse	"Invalid request body or password rejected by policy"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		409		{object}	types.APIResponse	"Username or email already taken"
+//	@Failure		500		{object}	types.APIResponse	"Failed to create user"
+//	@Security		BearerAuth
+//	@Router			/admin/users [post]
+func createUser(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		admin, _ := middleware.GetUserFromContext(c)
+
+		var request createUserRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		user, err := authService.CreateUser(c.Request.Context(), admin.ID, &request.RegisterRequest, request.IsAdmin)
+		switch {
+		case errors.Is(err, auth.ErrUserExists):
+			c.JSON(http.StatusConflict, types.APIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		case err != nil:
+			writeUserError(c, err, uuid.Nil, "Failed to create user")
+			return
+		}
+
+		c.JSON(http.StatusCreated, types.APIResponse{
+			Success: true,
+			Data:    user,
+			Message: "User created successfully",
+		})
+	}
+}
+
+// EnableUser godoc
+//
+//	@Summary		Enable a user
+//	@Description	Re-enable a disabled user account
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			user_id	path		string	true	"User ID"
+//	@Success		200		{object}	types.APIResponse{data=types.User}	"User enabled successfully"
+//	@Failure		400		{object}	types.APIResponse	"Invalid user ID"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404		{object}	types.APIResponse	"User not found"
+//	@Security		BearerAuth
+//	@Router			/admin/users/{user_id}/enable [put]
+func enableUser(authService *auth.Service) gin.HandlerFunc {
+	return setUserActive(authService, true, "User enabled successfully")
+}
+
+// DisableUser godoc
+//
+//	@Summary		Disable a user
+//	@Description	Disable a user account. Its refresh tokens are revoked, and its access tokens and API keys are refused from their next use.
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			user_id	path		string	true	"User ID"
+//	@Success		200		{object}	types.APIResponse{data=types.User}	"User disabled successfully"
+//	@Failure		400		{object}	types.APIResponse	"Invalid user ID or own account"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404		{object}	types.APIResponse	"User not found"
+//	@Security		BearerAuth
+//	@Router			/admin/users/{user_id}/disable [put]
+func disableUser(authService *auth.Service) gin.HandlerFunc {
+	return setUserActive(authService, false, "User disabled successfully")
+}
+
+// setUserActive enables or disables the user named in the path
+func setUserActive(authService *auth.Service, active bool, message string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := parseUserID(c)
+		if !ok {
+			return
+		}
+		admin, _ := middleware.GetUserFromContext(c)
+
+		user, err := authService.SetUserActive(c.Request.Context(), admin.ID, userID, active)
+		if err != nil {
+			writeUserError(c, err, userID, "Failed to update user")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    user,
+			Message: message,
+		})
+	}
+}
+
+// UpdateUserAdmin godoc
+//
+//	@Summary		Promote or demote a user
+//	@Description	Grant or remove a user's admin privileges. Administrators cannot demote themselves.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			user_id	path		string				true	"User ID"
+//	@Param			admin	body		userAdminRequest	true	"Admin privileges"
+//	@Success		200		{object}	types.APIResponse{data=types.User}	"User updated successfully"
+//	@Failure		400		{object}	types.APIResponse	"Invalid request or own account"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404		{object}	types.APIResponse	"User not found"
+//	@Security		BearerAuth
+//	@Router			/admin/users/{user_id}/admin [put]
+func updateUserAdmin(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := parseUserID(c)
+		if !ok {
+			return
+		}
+		admin, _ := middleware.GetUserFromContext(c)
+
+		var request userAdminRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		user, err := authService.SetUserAdmin(c.Request.Context(), admin.ID, userID, *request.IsAdmin)
+		if err != nil {
+			writeUserError(c, err, userID, "Failed to update user")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    user,
+			Message: "User updated successfully",
+		})
+	}
+}
+
+// ResetUserPassword godoc
+//
+//	@Summary		Reset a user's password
+//	@Description	Set a new password for a user and revoke their access and refresh tokens. The password must satisfy the password policy.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			user_id		path		string					true	"User ID"
+//	@Param			password	body		resetPasswordRequest	true	"New password"
+//	@Success		200			{object}	types.APIResponse	"Password reset successfully"
+//	@Failure		400			{object}	types.APIResponse	"Invalid request or password rejected by policy"
+//	@Failure		401			{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403			{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404			{object}	types.APIResponse	"User not found"
+//	@Security		BearerAuth
+//	@Router			/admin/users/{user_id}/password [post]
+func resetUserPassword(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := parseUserID(c)
+		if !ok {
+			return
+		}
+		admin, _ := middleware.GetUserFromContext(c)
+
+		var request resetPasswordRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Invalid request body",
+			})
+			return
+		}
+
+		if err := authService.ResetPassword(c.Request.Context(), admin.ID, userID, request.NewPassword); err != nil {
+			writeUserError(c, err, userID, "Failed to reset password")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Password reset successfully",
+		})
+	}
+}
+
+// RevokeUserTokens godoc
+//
+//	@Summary		Revoke a user's tokens
+//	@Description	Sign a user out everywhere: access tokens already issued are refused, refresh tokens are revoked and API keys are deactivated
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			user_id	path		string	true	"User ID"
+//	@Success		200		{object}	types.APIResponse	"Tokens revoked successfully"
+//	@Failure		400		{object}	types.APIResponse	"Invalid user ID"
+//	@Failure		401		{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403		{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404		{object}	types.APIResponse	"User not found"
+//	@Security		BearerAuth
+//	@Router			/admin/users/{user_id}/revoke-tokens [post]
+func revokeUserTokens(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := parseUserID(c)
+		if !ok {
+			return
+		}
+		admin, _ := middleware.GetUserFromContext(c)
+
+		if err := authService.RevokeUserTokens(c.Request.Context(), admin.ID, userID); err != nil {
+			writeUserError(c, err, userID, "Failed to revoke tokens")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Tokens revoked successfully",
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/scanning"
+)
+
+// VulnerabilityRoutes sets up the package vulnerability scan result routes
+func VulnerabilityRoutes(api *gin.RouterGroup, registryService *registry.Service, scanService *scanning.Service, authService *auth.Service) {
+	packages := api.Group("/packages")
+	packages.Use(middleware.AuthMiddleware(authService))
+
+	packages.GET("/:registry/:package/:version/vulnerabilities", handleGetVulnerabilities(registryService, scanService))
+}
+
+// GetVulnerabilities godoc
+//
+//	@Summary		Get package version vulnerabilities
+//	@Description	Findings of the latest vulnerability scan of a package version: its status, counts by severity and the vulnerabilities found. Versions are scanned in the background after they are published
+//	@Tags			Packages
+//	@Produce		json
+//	@Param			registry	path		string	true	"Registry type (e.g., npm, nuget, helm, cargo)"
+//	@Param			package		path		string	true	"Package name"
+//	@Param			version		path		string	true	"Package version"
+//	@Success		200			{object}	types.ScanResult		"Latest scan result"
+//	@Failure		401			{object}	object{error=string}	"Unauthorized"
+//	@Failure		403			{object}	object{error=string}	"API key not scoped to the package"
+//	@Failure		404			{object}	object{error=string}	"Package version not found or not scanned"
+//	@Failure		500			{object}	object{error=string}	"Failed to retrieve scan result"
+//	@Security		BearerAuth
+//	@Router			/packages/{registry}/{package}/{version}/vulnerabilities [get]
+func handleGetVulnerabilities(registryService *registry.Service, scanService *scanning.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		registryType := c.Param("registry")
+		name := c.Param("package")
+		version := c.Param("version")
+
+		// Versions the caller cannot read are not found, like missing ones
+		artifact, err := registryService.GetPublishedArtifact(ctx, registryType, name, version)
+		if err != nil {
+			if errors.Is(err, registry.ErrArtifactNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "package version not found"})
+				return
+			}
+			if errors.Is(err, auth.ErrAPIKeyScopeForbidden) {
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Str("version", version).Msg("Failed to find artifact")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve scan result"})
+			return
+		}
+
+		result, err := scanService.GetResult(ctx, artifact.ID)
+		if err != nil {
+			if errors.Is(err, scanning.ErrScanResultNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "package version has not been scanned"})
+				return
+			}
+			middleware.Logger(c).Error().Err(err).Str("registry", registryType).Str("name", name).Str("version", version).Msg("Failed to retrieve scan result")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve scan result"})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
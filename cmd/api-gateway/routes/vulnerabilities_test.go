@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/scanning"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// criticalScanner reports a critical vulnerability in every artifact
+type criticalScanner struct{}
+
+func (criticalScanner) Name() string {
+	return "stub"
+}
+
+func (criticalScanner) Scan(ctx context.Context, artifact *types.Artifact, content io.Reader) ([]types.Vulnerability, error) {
+	return []types.Vulnerability{{ID: "CVE-2021-44228", Severity: types.SeverityCritical, Package: "log4j-core", InstalledVersion: "2.14.1"}}, nil
+}
+
+func TestPackageVulnerabilities(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, user := setupRegistryTestService(t)
+	db := registryService.DB.DB
+	require.NoError(t, db.AutoMigrate(&types.ScanResult{}))
+
+	scanService := scanning.NewService(db, registryService.Storage, criticalScanner{})
+	require.NoError(t, scanService.SetPolicy(scanning.PolicyBlock))
+	registryService.SetDownloadPolicy(scanService)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	})
+	router.GET("/packages/:registry/:package/stats", func(c *gin.Context) {})
+	router.GET("/packages/:registry/:package/:version/vulnerabilities", handleGetVulnerabilities(registryService, scanService))
+	router.GET("/maven/*path", handleMavenDownload(registryService))
+	router.PUT("/maven/*path", handleMavenUpload(registryService))
+	request := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewReader(body)))
+		return w
+	}
+
+	jar := "/maven/com/example/my-app/1.0.0/my-app-1.0.0.jar"
+	require.Equal(t, http.StatusCreated, request("PUT", jar, []byte("jar content")).Code)
+	var artifact types.Artifact
+	require.NoError(t, db.Where("registry = ?", "maven").First(&artifact).Error)
+	path := "/packages/maven/" + artifact.Name + "/1.0.0/vulnerabilities"
+
+	assert.Equal(t, http.StatusNotFound, request("GET", path, nil).Code, "not scanned yet")
+	assert.Equal(t, http.StatusOK, request("GET", jar, nil).Code, "unscanned artifacts can be downloaded")
+
+	_, err := scanService.Scan(context.Background(), &artifact)
+	require.NoError(t, err)
+
+	w := request("GET", path, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result types.ScanResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, types.ScanStatusCompleted, result.Status)
+	assert.Equal(t, 1, result.Critical)
+	require.Len(t, result.Vulnerabilities, 1)
+	assert.Equal(t, "CVE-2021-44228", result.Vulnerabilities[0].ID)
+
+	assert.Equal(t, http.StatusForbidden, request("GET", jar, nil).Code, "critical findings block downloads")
+	assert.Equal(t, http.StatusNotFound, request("GET", "/packages/maven/"+artifact.Name+"/9.9.9/vulnerabilities", nil).Code)
+}
+
+func TestPackageVulnerabilities_RestrictedPackage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	registryService, publisher := setupRegistryTestService(t)
+	db := registryService.DB.DB
+	require.NoError(t, db.AutoMigrate(&types.ScanResult{}))
+	outsider := &types.User{Username: "outsider", Email: "outsider@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, db.Create(outsider).Error)
+
+	scanService := scanning.NewService(db, registryService.Storage, criticalScanner{})
+	artifact, err := registryService.Upload(context.Background(), "maven", "com.example:private-app", "1.0.0", bytes.NewReader([]byte("jar content")), publisher.ID)
+	require.NoError(t, err)
+	_, err = scanService.Scan(context.Background(), artifact)
+	require.NoError(t, err)
+
+	get := func(user *types.User) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user", user)
+		}, middleware.PackageReaderMiddleware())
+		router.GET("/packages/:registry/:package/:version/vulnerabilities", handleGetVulnerabilities(registryService, scanService))
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/packages/maven/"+artifact.Name+"/1.0.0/vulnerabilities", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, get(publisher).Code)
+
+	// Users who cannot read the version are told it does not exist
+	w := get(outsider)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.NotContains(t, w.Body.String(), "CVE-2021-44228")
+}
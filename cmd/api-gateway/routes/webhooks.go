@@ -0,0 +1,275 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/cmd/api-gateway/middleware"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/webhooks"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// webhookSubscriptionRequest is the body of a webhook subscription create or update
+type webhookSubscriptionRequest struct {
+	URL        string   `json:"url" binding:"required"`
+	Secret     string   `json:"secret"`     // required on create, kept when empty on update
+	Events     []string `json:"events"`     // event types to deliver, all when empty
+	Registries []string `json:"registries"` // registries to deliver events of, all when empty
+	Active     *bool    `json:"active"`     // defaults to true
+}
+
+// subscription converts the request to a webhook subscription
+func (r webhookSubscriptionRequest) subscription() *types.WebhookSubscription {
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+	return &types.WebhookSubscription{
+		URL:        r.URL,
+		Secret:     r.Secret,
+		Events:     r.Events,
+		Registries: r.Registries,
+		Active:     active,
+	}
+}
+
+// bindWebhookSubscription reads a subscription from the request body, checking
+// that its registry filter names known registries. It writes the error
+// response and returns nil if the body is invalid.
+func bindWebhookSubscription(c *gin.Context, registryService *registry.Service) *types.WebhookSubscription {
+	var request webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, types.APIResponse{
+			Success: false,
+			Error:   "Invalid request body",
+		})
+		return nil
+	}
+
+	for _, registryName := range request.Registries {
+		if _, err := registryService.GetRegistry(registryName); err != nil {
+			c.JSON(http.StatusBadRequest, types.APIResponse{
+				Success: false,
+				Error:   "Unknown registry: " + registryName,
+			})
+			return nil
+		}
+	}
+
+	return request.subscription()
+}
+
+// parseWebhookSubscriptionID reads the subscription ID path parameter. It
+// writes the error response and returns false if the ID is invalid.
+func parseWebhookSubscriptionID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, types.APIResponse{
+			Success: false,
+			Error:   "Invalid webhook subscription ID",
+		})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// writeWebhookError maps webhook service errors to API responses
+func writeWebhookError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, webhooks.ErrSubscriptionNotFound):
+		c.JSON(http.StatusNotFound, types.APIResponse{
+			Success: false,
+			Error:   "Webhook subscription not found",
+		})
+	case errors.Is(err, webhooks.ErrInvalidSubscription):
+		c.JSON(http.StatusBadRequest, types.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+	default:
+		middleware.Logger(c).Error().Err(err).Msg(message)
+		c.JSON(http.StatusInternalServerError, types.APIResponse{
+			Success: false,
+			Error:   message,
+		})
+	}
+}
+
+// GetWebhookSubscriptions godoc
+//
+//	@Summary		List webhook subscriptions
+//	@Description	Retrieve every webhook subscription. Secrets are never returned.
+//	@Tags			Admin
+//	@Produce		json
+//	@Success		200	{object}	types.APIResponse{data=[]types.WebhookSubscription}	"Webhook subscriptions retrieved successfully"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403	{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		500	{object}	types.APIResponse	"Failed to retrieve webhook subscriptions"
+//	@Security		BearerAuth
+//	@Router			/admin/webhooks [get]
+func getWebhookSubscriptions(webhookService *webhooks.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscriptions, err := webhookService.ListSubscriptions(c.Request.Context())
+		if err != nil {
+			writeWebhookError(c, err, "Failed to retrieve webhook subscriptions")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    subscriptions,
+		})
+	}
+}
+
+// GetWebhookSubscription godoc
+//
+//	@Summary		Get a webhook subscription
+//	@Description	Retrieve a webhook subscription by ID
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			id	path		string	true	"Subscription ID"
+//	@Success		200	{object}	types.APIResponse{data=types.WebhookSubscription}	"Webhook subscription retrieved successfully"
+//	@Failure		400	{object}	types.APIResponse	"Invalid webhook subscription ID"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403	{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404	{object}	types.APIResponse	"Webhook subscription not found"
+//	@Security		BearerAuth
+//	@Router			/admin/webhooks/{id} [get]
+func getWebhookSubscription(webhookService *webhooks.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := parseWebhookSubscriptionID(c)
+		if !ok {
+			return
+		}
+
+		subscription, err := webhookService.GetSubscription(c.Request.Context(), id)
+		if err != nil {
+			writeWebhookError(c, err, "Failed to retrieve webhook subscription")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Data:    subscription,
+		})
+	}
+}
+
+// CreateWebhookSubscription godoc
+//
+//	@Summary		Create a webhook subscription
+//	@Description	Subscribe an endpoint to package lifecycle events (package.published, package.deleted) and publish approval events (publish.pending-approval, publish.approved, publish.rejected). Each delivery is a JSON POST signed with the secret: the X-Lodestone-Signature header holds "sha256=" and the hex HMAC-SHA256 of the body.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			subscription	body		webhookSubscriptionRequest	true	"Webhook subscription"
+//	@Success		201				{object}	types.APIResponse{data=types.WebhookSubscription}	"Webhook subscription created successfully"
+//	@Failure		400				{object}	types.APIResponse	"Invalid webhook subscription"
+//	@Failure		401				{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403				{object}	types.APIResponse	"Admin privileges required"
+//	@Security		BearerAuth
+//	@Router			/admin/webhooks [post]
+func createWebhookSubscription(registryService *registry.Service, webhookService *webhooks.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		subscription := bindWebhookSubscription(c, registryService)
+		if subscription == nil {
+			return
+		}
+
+		if err := webhookService.CreateSubscription(c.Request.Context(), subscription, user.ID); err != nil {
+			writeWebhookError(c, err, "Failed to create webhook subscription")
+			return
+		}
+
+		c.JSON(http.StatusCreated, types.APIResponse{
+			Success: true,
+			Message: "Webhook subscription created successfully",
+			Data:    subscription,
+		})
+	}
+}
+
+// UpdateWebhookSubscription godoc
+//
+//	@Summary		Update a webhook subscription
+//	@Description	Replace a webhook subscription. The current secret is kept when none is given.
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id				path		string						true	"Subscription ID"
+//	@Param			subscription	body		webhookSubscriptionRequest	true	"Webhook subscription"
+//	@Success		200				{object}	types.APIResponse{data=types.WebhookSubscription}	"Webhook subscription updated successfully"
+//	@Failure		400				{object}	types.APIResponse	"Invalid webhook subscription"
+//	@Failure		401				{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403				{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404				{object}	types.APIResponse	"Webhook subscription not found"
+//	@Security		BearerAuth
+//	@Router			/admin/webhooks/{id} [put]
+func updateWebhookSubscription(registryService *registry.Service, webhookService *webhooks.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		id, ok := parseWebhookSubscriptionID(c)
+		if !ok {
+			return
+		}
+
+		subscription := bindWebhookSubscription(c, registryService)
+		if subscription == nil {
+			return
+		}
+		subscription.ID = id
+
+		if err := webhookService.UpdateSubscription(c.Request.Context(), subscription, user.ID); err != nil {
+			writeWebhookError(c, err, "Failed to update webhook subscription")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Webhook subscription updated successfully",
+			Data:    subscription,
+		})
+	}
+}
+
+// DeleteWebhookSubscription godoc
+//
+//	@Summary		Delete a webhook subscription
+//	@Description	Stop delivering events to a webhook subscription
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			id	path		string	true	"Subscription ID"
+//	@Success		200	{object}	types.APIResponse	"Webhook subscription deleted successfully"
+//	@Failure		400	{object}	types.APIResponse	"Invalid webhook subscription ID"
+//	@Failure		401	{object}	types.APIResponse	"Unauthorized"
+//	@Failure		403	{object}	types.APIResponse	"Admin privileges required"
+//	@Failure		404	{object}	types.APIResponse	"Webhook subscription not found"
+//	@Security		BearerAuth
+//	@Router			/admin/webhooks/{id} [delete]
+func deleteWebhookSubscription(webhookService *webhooks.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := middleware.GetUserFromContext(c)
+
+		id, ok := parseWebhookSubscriptionID(c)
+		if !ok {
+			return
+		}
+
+		if err := webhookService.DeleteSubscription(c.Request.Context(), id, user.ID); err != nil {
+			writeWebhookError(c, err, "Failed to delete webhook subscription")
+			return
+		}
+
+		c.JSON(http.StatusOK, types.APIResponse{
+			Success: true,
+			Message: "Webhook subscription deleted successfully",
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// drainProgressInterval is how often the requests still in flight are logged
+// while the server drains
+const drainProgressInterval = time.Second
+
+// serve serves HTTP requests on listener until ctx is cancelled. It then stops
+// accepting connections and waits up to drainTimeout for in-flight requests
+// to finish, logging how many are left as it goes, before closing any
+// connections still open. It returns an error if the server fails or
+// requests were cut off.
+func serve(ctx context.Context, server *http.Server, listener net.Listener, drainTimeout time.Duration) error {
+	var inFlight atomic.Int64
+	handler := server.Handler
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		handler.ServeHTTP(w, r)
+	})
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("server stopped: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Info().
+		Int64("in_flight", inFlight.Load()).
+		Dur("timeout", drainTimeout).
+		Msg("Shutting down, draining in-flight requests")
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- server.Shutdown(drainCtx)
+	}()
+
+	ticker := time.NewTicker(drainProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-drained:
+			if err != nil {
+				remaining := inFlight.Load()
+				server.Close()
+				if errors.Is(err, context.DeadlineExceeded) {
+					return fmt.Errorf("gave up waiting for %d in-flight requests after %s", remaining, drainTimeout)
+				}
+				return fmt.Errorf("failed to shut down server: %w", err)
+			}
+			log.Info().Msg("Drained in-flight requests")
+			return nil
+		case <-ticker.C:
+			log.Info().Int64("in_flight", inFlight.Load()).Msg("Waiting for in-flight requests")
+		}
+	}
+}
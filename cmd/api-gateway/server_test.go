@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServe runs serve on a free port with handler, returning the server's
+// URL and a channel receiving serve's result
+func startServe(t *testing.T, ctx context.Context, handler http.Handler, drainTimeout time.Duration) (string, <-chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- serve(ctx, &http.Server{Handler: handler}, listener, drainTimeout)
+	}()
+	return "http://" + listener.Addr().String(), result
+}
+
+func TestServe_DrainsInFlightRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	url, result := startServe(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("uploaded"))
+	}), 5*time.Second)
+
+	type response struct {
+		status int
+		body   string
+		err    error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			responses <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- response{status: resp.StatusCode, body: string(body), err: err}
+	}()
+
+	// Shut down while the request is being handled
+	<-started
+	cancel()
+
+	got := <-responses
+	require.NoError(t, got.err)
+	assert.Equal(t, http.StatusOK, got.status)
+	assert.Equal(t, "uploaded", got.body)
+
+	select {
+	case err := <-result:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+
+	// New connections are refused once the server has shut down
+	_, err := http.Get(url + "/slow")
+	assert.Error(t, err)
+}
+
+func TestServe_DrainTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	url, result := startServe(t, ctx, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}), 100*time.Millisecond)
+
+	requestErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url + "/stuck")
+		if err == nil {
+			resp.Body.Close()
+		}
+		requestErr <- err
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case err := <-result:
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "1 in-flight requests")
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not give up draining")
+	}
+
+	// The request still in flight is cut off
+	assert.Error(t, <-requestErr)
+}
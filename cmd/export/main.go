@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	var (
+		output       = flag.String("output", "", "File to write the backup archive to, or - for stdout")
+		registryType = flag.String("registry", "", "Only export artifacts of this registry type")
+	)
+	flag.Parse()
+
+	if *output == "" {
+		fmt.Printf("Usage: %s -output <file> [-registry <type>]\n", os.Args[0])
+		fmt.Println("  -output    File to write the backup archive to, or - for stdout")
+		fmt.Println("  -registry  Only export artifacts of this registry type")
+		os.Exit(1)
+	}
+
+	// Load configuration
+	cfg := config.LoadFromEnv()
+	cfg.Logging.SetupLogging()
+
+	database, err := common.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to database")
+	}
+	defer database.Close()
+
+	storageBackend, err := storage.NewStorageFactory(&cfg.Storage).CreateStorage()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize storage")
+	}
+	registryService := registry.NewService(database, storageBackend)
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", *output).Msg("Failed to create backup archive")
+		}
+		defer file.Close()
+		w = file
+	}
+
+	exported, err := registryService.Export(context.Background(), w, *registryType)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to export artifacts")
+	}
+	log.Info().Int("artifacts", exported).Str("output", *output).Msg("Export completed successfully")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	var (
+		input    = flag.String("input", "", "Backup archive to import, or - for stdin")
+		username = flag.String("user", "", "User publishing artifacts whose original publisher does not exist")
+	)
+	flag.Parse()
+
+	if *input == "" {
+		fmt.Printf("Usage: %s -input <file> [-user <username>]\n", os.Args[0])
+		fmt.Println("  -input  Backup archive to import, or - for stdin")
+		fmt.Println("  -user   User publishing artifacts whose original publisher does not exist")
+		os.Exit(1)
+	}
+
+	// Load configuration
+	cfg := config.LoadFromEnv()
+	cfg.Logging.SetupLogging()
+
+	database, err := common.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to database")
+	}
+	defer database.Close()
+
+	storageBackend, err := storage.NewStorageFactory(&cfg.Storage).CreateStorage()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize storage")
+	}
+	registryService := registry.NewService(database, storageBackend)
+	registryService.Configure(cfg.Registry)
+	pathLayout, err := registry.NewPathLayout(cfg.Storage.PathLayout)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid storage path layout")
+	}
+	registryService.SetPathLayout(pathLayout)
+	registryService.SetAuditLog(audit.NewService(database.DB))
+
+	fallbackPublisher := uuid.Nil
+	if *username != "" {
+		var user types.User
+		if err := database.Where("username = ?", *username).First(&user).Error; err != nil {
+			log.Fatal().Err(err).Str("username", *username).Msg("Failed to find fallback publisher")
+		}
+		fallbackPublisher = user.ID
+	}
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", *input).Msg("Failed to open backup archive")
+		}
+		defer file.Close()
+		r = file
+	}
+
+	result, err := registryService.Import(context.Background(), r, fallbackPublisher)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to import artifacts")
+	}
+	log.Info().
+		Int("imported", result.Imported).
+		Int("skipped", result.Skipped).
+		Int("failed", result.Failed).
+		Msg("Import completed successfully")
+}
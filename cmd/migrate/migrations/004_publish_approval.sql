@@ -0,0 +1,12 @@
+-- +migrate Up
+-- Publish approval workflow: artifacts can be held for review before release
+
+ALTER TABLE artifacts ADD COLUMN status VARCHAR(50) NOT NULL DEFAULT 'published'; -- "published", "pending-approval"
+CREATE INDEX idx_artifacts_status ON artifacts(status);
+
+ALTER TABLE registry_settings ADD COLUMN require_approval BOOLEAN NOT NULL DEFAULT false;
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_artifacts_status;
+ALTER TABLE artifacts DROP COLUMN IF EXISTS status;
+ALTER TABLE registry_settings DROP COLUMN IF EXISTS require_approval;
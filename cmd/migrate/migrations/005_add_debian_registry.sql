@@ -0,0 +1,9 @@
+-- +migrate Up
+-- Register the Debian APT repository format
+
+INSERT INTO registry_settings (registry_name, enabled, description) VALUES
+    ('debian', true, 'Debian APT package repository')
+ON CONFLICT (registry_name) DO NOTHING;
+
+-- +migrate Down
+DELETE FROM registry_settings WHERE registry_name = 'debian';
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- Register the RPM/YUM repository format
+
+INSERT INTO registry_settings (registry_name, enabled, description) VALUES
+    ('rpm', true, 'RPM/YUM package repository')
+ON CONFLICT (registry_name) DO NOTHING;
+
+-- +migrate Down
+DELETE FROM registry_settings WHERE registry_name = 'rpm';
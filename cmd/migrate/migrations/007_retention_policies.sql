@@ -0,0 +1,21 @@
+-- +migrate Up
+-- Retention policies: per-registry rules for automatically removing old versions
+
+CREATE TABLE retention_policies (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    registry_name VARCHAR(50) NOT NULL UNIQUE,
+    enabled BOOLEAN NOT NULL DEFAULT false,
+    keep_last_versions INTEGER NOT NULL DEFAULT 0, -- 0 keeps every version
+    prerelease_max_age_days INTEGER NOT NULL DEFAULT 0, -- 0 keeps prereleases regardless of age
+    keep_latest BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_by UUID REFERENCES users(id)
+);
+
+CREATE TRIGGER update_retention_policies_updated_at BEFORE UPDATE ON retention_policies
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS update_retention_policies_updated_at ON retention_policies;
+DROP TABLE IF EXISTS retention_policies;
@@ -0,0 +1,21 @@
+-- +migrate Up
+-- Webhook subscriptions: endpoints notified when packages are published or deleted
+
+CREATE TABLE webhook_subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL,
+    events JSONB, -- event types delivered, all when empty
+    registries JSONB, -- registries whose events are delivered, all when empty
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TRIGGER update_webhook_subscriptions_updated_at BEFORE UPDATE ON webhook_subscriptions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS update_webhook_subscriptions_updated_at ON webhook_subscriptions;
+DROP TABLE IF EXISTS webhook_subscriptions;
@@ -0,0 +1,7 @@
+-- +migrate Up
+-- Registries can require uploads to carry a signature from a trusted key
+
+ALTER TABLE registry_settings ADD COLUMN require_signature BOOLEAN NOT NULL DEFAULT false;
+
+-- +migrate Down
+ALTER TABLE registry_settings DROP COLUMN IF EXISTS require_signature;
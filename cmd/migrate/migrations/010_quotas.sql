@@ -0,0 +1,22 @@
+-- +migrate Up
+-- Publish quotas: per-user limits on artifact storage, overall or per registry
+
+CREATE TABLE quotas (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    registry_name VARCHAR(50) NOT NULL DEFAULT '', -- empty for a limit across all registries
+    max_bytes BIGINT NOT NULL DEFAULT 0, -- 0 for unlimited
+    max_artifacts BIGINT NOT NULL DEFAULT 0, -- 0 for unlimited
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_by UUID REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX idx_quotas_user_registry ON quotas(user_id, registry_name);
+
+CREATE TRIGGER update_quotas_updated_at BEFORE UPDATE ON quotas
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS update_quotas_updated_at ON quotas;
+DROP TABLE IF EXISTS quotas;
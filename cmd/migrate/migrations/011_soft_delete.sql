@@ -0,0 +1,12 @@
+-- +migrate Up
+-- Deleted artifacts are kept, hidden, until they are restored or purged
+
+ALTER TABLE artifacts ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE artifacts ADD COLUMN deleted_by UUID REFERENCES users(id);
+
+CREATE INDEX idx_artifacts_deleted_at ON artifacts(deleted_at);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_artifacts_deleted_at;
+ALTER TABLE artifacts DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE artifacts DROP COLUMN IF EXISTS deleted_at;
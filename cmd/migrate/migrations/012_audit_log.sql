@@ -0,0 +1,32 @@
+-- +migrate Up
+-- Audit trail of the writes made by users. Entries cannot be changed or
+-- removed once written.
+
+CREATE TABLE audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    actor_id UUID, -- not a foreign key, so entries outlive the users they name; null for writes without an authenticated user
+    action VARCHAR(100) NOT NULL,
+    target TEXT NOT NULL,
+    details JSONB,
+    source_ip VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_actor_id ON audit_log(actor_id);
+CREATE INDEX idx_audit_log_action ON audit_log(action);
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at DESC);
+
+CREATE OR REPLACE FUNCTION prevent_audit_log_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit log entries cannot be changed';
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER prevent_audit_log_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION prevent_audit_log_change();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS prevent_audit_log_update ON audit_log;
+DROP FUNCTION IF EXISTS prevent_audit_log_change();
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,17 @@
+-- +migrate Up
+-- Documentation of each package, taken from the most recent version published
+-- with it
+
+CREATE TABLE package_metadata (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    registry VARCHAR(50) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    readme TEXT,
+    version VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT idx_package_metadata_package UNIQUE (registry, name)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS package_metadata;
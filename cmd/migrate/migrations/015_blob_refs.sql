@@ -0,0 +1,14 @@
+-- +migrate Up
+-- Reference counts of artifact content stored once per SHA256 and shared by
+-- every artifact with identical content
+
+CREATE TABLE blob_refs (
+    sha256 VARCHAR(64) PRIMARY KEY,
+    size BIGINT NOT NULL DEFAULT 0,
+    ref_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS blob_refs;
@@ -0,0 +1,12 @@
+-- +migrate Up
+-- Artifacts are looked up by their normalized name: lower case, except for Go
+-- module paths, which are case sensitive
+
+ALTER TABLE artifacts ADD COLUMN normalized_name VARCHAR(255);
+UPDATE artifacts SET normalized_name = CASE WHEN registry = 'go' THEN name ELSE LOWER(name) END;
+
+CREATE INDEX idx_artifacts_normalized_name ON artifacts(normalized_name);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_artifacts_normalized_name;
+ALTER TABLE artifacts DROP COLUMN IF EXISTS normalized_name;
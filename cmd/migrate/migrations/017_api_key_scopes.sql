@@ -0,0 +1,8 @@
+-- +migrate Up
+-- API keys can be limited to registries and package name globs, such as
+-- "npm:@myorg/*". Keys without scopes are unrestricted.
+
+ALTER TABLE api_keys ADD COLUMN scopes JSONB;
+
+-- +migrate Down
+ALTER TABLE api_keys DROP COLUMN IF EXISTS scopes;
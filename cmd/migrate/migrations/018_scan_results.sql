@@ -0,0 +1,26 @@
+-- +migrate Up
+-- Findings of the latest vulnerability scan of each published artifact
+
+CREATE TABLE scan_results (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    artifact_id UUID NOT NULL UNIQUE REFERENCES artifacts(id) ON DELETE CASCADE,
+    scanner VARCHAR(50) NOT NULL,
+    status VARCHAR(20) NOT NULL, -- pending, completed or failed
+    critical INTEGER NOT NULL DEFAULT 0,
+    high INTEGER NOT NULL DEFAULT 0,
+    medium INTEGER NOT NULL DEFAULT 0,
+    low INTEGER NOT NULL DEFAULT 0,
+    unknown INTEGER NOT NULL DEFAULT 0,
+    vulnerabilities JSONB,
+    error TEXT,
+    scanned_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TRIGGER update_scan_results_updated_at BEFORE UPDATE ON scan_results
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS update_scan_results_updated_at ON scan_results;
+DROP TABLE IF EXISTS scan_results;
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- Dist-tags of each package, such as "beta", mapping tag names to versions.
+-- latest is only stored when set explicitly; otherwise it follows the newest
+-- stable version.
+
+ALTER TABLE package_metadata ADD COLUMN dist_tags JSONB;
+
+-- +migrate Down
+ALTER TABLE package_metadata DROP COLUMN IF EXISTS dist_tags;
@@ -0,0 +1,44 @@
+-- +migrate Up
+-- Primary package owners, who alone may transfer a package, and the transfers
+-- proposed to other users. A transfer takes effect once its recipient accepts.
+
+ALTER TABLE package_ownerships ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The earliest owner of each existing package becomes its primary owner
+UPDATE package_ownerships SET is_primary = TRUE
+WHERE id IN (
+    SELECT DISTINCT ON (package_key) id
+    FROM package_ownerships
+    WHERE role = 'owner'
+    ORDER BY package_key, granted_at, created_at
+);
+
+CREATE UNIQUE INDEX idx_package_ownerships_primary ON package_ownerships(package_key) WHERE is_primary;
+
+CREATE TABLE ownership_transfers (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    package_key VARCHAR(255) NOT NULL,
+    from_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    initiated_by UUID NOT NULL REFERENCES users(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- "pending", "accepted", "declined", "cancelled"
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    responded_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_ownership_transfers_package_key ON ownership_transfers(package_key);
+CREATE INDEX idx_ownership_transfers_to_user_id ON ownership_transfers(to_user_id);
+CREATE INDEX idx_ownership_transfers_status ON ownership_transfers(status);
+
+-- At most one transfer of a package is pending at a time
+CREATE UNIQUE INDEX idx_ownership_transfers_pending ON ownership_transfers(package_key) WHERE status = 'pending';
+
+CREATE TRIGGER update_ownership_transfers_updated_at BEFORE UPDATE ON ownership_transfers
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS update_ownership_transfers_updated_at ON ownership_transfers;
+DROP TABLE IF EXISTS ownership_transfers;
+DROP INDEX IF EXISTS idx_package_ownerships_primary;
+ALTER TABLE package_ownerships DROP COLUMN IF EXISTS is_primary;
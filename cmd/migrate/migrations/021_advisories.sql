@@ -0,0 +1,28 @@
+-- +migrate Up
+-- Security advisories recorded by admins for ranges of package versions,
+-- reported to clients auditing their dependencies
+
+CREATE TABLE advisories (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    registry VARCHAR(50) NOT NULL,
+    package_name VARCHAR(255) NOT NULL,
+    vulnerable_versions VARCHAR(255) NOT NULL, -- semver range
+    title TEXT NOT NULL,
+    severity VARCHAR(20) NOT NULL, -- info, low, moderate, high or critical
+    url TEXT,
+    cwe JSONB,
+    cvss_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    cvss_vector VARCHAR(255),
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_advisories_package ON advisories(registry, package_name);
+
+CREATE TRIGGER update_advisories_updated_at BEFORE UPDATE ON advisories
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS update_advisories_updated_at ON advisories;
+DROP TABLE IF EXISTS advisories;
@@ -0,0 +1,37 @@
+-- +migrate Up
+-- Immutable registries never accept a version again once it was published,
+-- even after it is deleted. Published versions are recorded in an
+-- append-only ledger whose entries are chained by hash.
+
+ALTER TABLE registry_settings ADD COLUMN immutable BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE published_versions (
+    sequence BIGSERIAL PRIMARY KEY,
+    registry VARCHAR(50) NOT NULL,
+    normalized_name VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    version VARCHAR(255) NOT NULL,
+    sha256 VARCHAR(64) NOT NULL,
+    published_by UUID NOT NULL,
+    published_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    previous_hash VARCHAR(64) UNIQUE, -- hash of the entry before, empty for the first
+    hash VARCHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX idx_published_versions_version ON published_versions(registry, normalized_name, version);
+
+CREATE OR REPLACE FUNCTION prevent_published_versions_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'published versions cannot be changed';
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER prevent_published_versions_update BEFORE UPDATE OR DELETE ON published_versions
+    FOR EACH ROW EXECUTE FUNCTION prevent_published_versions_change();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS prevent_published_versions_update ON published_versions;
+DROP FUNCTION IF EXISTS prevent_published_versions_change();
+DROP TABLE IF EXISTS published_versions;
+ALTER TABLE registry_settings DROP COLUMN IF EXISTS immutable;
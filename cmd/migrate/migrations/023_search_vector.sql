@@ -0,0 +1,18 @@
+-- +migrate Up
+-- Full-text search over the name, keywords, tags and description of artifacts,
+-- weighted in that order for ranking. Names are also indexed with their
+-- punctuation removed, so the parts of names such as Logging.Extensions or
+-- @scope/http-client are found on their own.
+
+ALTER TABLE artifacts ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', name || ' ' || regexp_replace(name, '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+    setweight(to_tsvector('english', coalesce(metadata->'keywords', '[]'::jsonb)), 'B') ||
+    setweight(to_tsvector('english', coalesce(metadata->'tags', '[]'::jsonb)), 'B') ||
+    setweight(to_tsvector('english', coalesce(metadata->>'description', '')), 'C')
+) STORED;
+
+CREATE INDEX idx_artifacts_search_vector ON artifacts USING gin(search_vector);
+
+-- +migrate Down
+DROP INDEX IF EXISTS idx_artifacts_search_vector;
+ALTER TABLE artifacts DROP COLUMN IF EXISTS search_vector;
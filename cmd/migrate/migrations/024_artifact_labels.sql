@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Organizational labels of artifacts, such as team=payments, set by package
+-- owners and used to filter listings and searches.
+
+ALTER TABLE artifacts ADD COLUMN labels JSONB;
+
+-- +migrate Down
+ALTER TABLE artifacts DROP COLUMN IF EXISTS labels;
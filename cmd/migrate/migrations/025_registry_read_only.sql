@@ -0,0 +1,17 @@
+-- +migrate Up
+-- Read-only registries keep serving packages but refuse publishes, deletes
+-- and other changes. The OCI registry's setting is renamed to the name its
+-- routes and handler are registered under.
+
+ALTER TABLE registry_settings ADD COLUMN read_only BOOLEAN NOT NULL DEFAULT false;
+
+UPDATE registry_settings SET registry_name = 'oci'
+WHERE registry_name = 'docker'
+  AND NOT EXISTS (SELECT 1 FROM registry_settings WHERE registry_name = 'oci');
+
+-- +migrate Down
+UPDATE registry_settings SET registry_name = 'docker'
+WHERE registry_name = 'oci'
+  AND NOT EXISTS (SELECT 1 FROM registry_settings WHERE registry_name = 'docker');
+
+ALTER TABLE registry_settings DROP COLUMN IF EXISTS read_only;
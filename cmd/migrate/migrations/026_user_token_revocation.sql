@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Access tokens issued before tokens_revoked_at are refused, so an
+-- administrator can sign a user out everywhere at once.
+
+ALTER TABLE users ADD COLUMN tokens_revoked_at TIMESTAMP WITH TIME ZONE;
+
+-- +migrate Down
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_revoked_at;
@@ -0,0 +1,36 @@
+-- +migrate Up
+-- Organizations owning the packages in a namespace, such as an npm scope, and
+-- their members, who hold their role on every package in the namespace.
+
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL UNIQUE,
+    default_public BOOLEAN NOT NULL DEFAULT FALSE,
+    created_by UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE organization_members (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL, -- "owner", "maintainer", "contributor"
+    granted_by UUID NOT NULL REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_organization_members_user ON organization_members(organization_id, user_id);
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+
+CREATE TRIGGER update_organizations_updated_at BEFORE UPDATE ON organizations
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_organization_members_updated_at BEFORE UPDATE ON organization_members
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- +migrate Down
+DROP TRIGGER IF EXISTS update_organization_members_updated_at ON organization_members;
+DROP TRIGGER IF EXISTS update_organizations_updated_at ON organizations;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
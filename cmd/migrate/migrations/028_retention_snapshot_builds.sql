@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Maven snapshot retention: CI can deploy hundreds of timestamped builds of a
+-- -SNAPSHOT version, so a policy can keep only the newest of them.
+
+ALTER TABLE retention_policies ADD COLUMN keep_snapshot_builds INTEGER NOT NULL DEFAULT 0; -- 0 keeps every build
+
+-- +migrate Down
+ALTER TABLE retention_policies DROP COLUMN IF EXISTS keep_snapshot_builds;
@@ -0,0 +1,40 @@
+-- +migrate Up
+-- Package keys hold the normalized name of their package, the name artifacts
+-- are looked up by, so a role granted under any casing of a name applies to
+-- the package: lower case, except for Go module paths, which are case
+-- sensitive. Registry names are lower case already.
+
+-- A user holding roles under several casings of a name keeps the highest
+DELETE FROM package_ownerships
+WHERE id NOT IN (
+    SELECT DISTINCT ON (CASE WHEN package_key LIKE 'go:%' THEN package_key ELSE LOWER(package_key) END, user_id) id
+    FROM package_ownerships
+    ORDER BY CASE WHEN package_key LIKE 'go:%' THEN package_key ELSE LOWER(package_key) END, user_id,
+        CASE role WHEN 'owner' THEN 0 WHEN 'maintainer' THEN 1 ELSE 2 END, is_primary DESC, granted_at, created_at
+);
+
+-- The earliest primary owner under any casing stays the primary owner
+UPDATE package_ownerships SET is_primary = FALSE
+WHERE is_primary AND id NOT IN (
+    SELECT DISTINCT ON (CASE WHEN package_key LIKE 'go:%' THEN package_key ELSE LOWER(package_key) END) id
+    FROM package_ownerships
+    WHERE is_primary
+    ORDER BY CASE WHEN package_key LIKE 'go:%' THEN package_key ELSE LOWER(package_key) END, granted_at, created_at
+);
+
+UPDATE package_ownerships SET package_key = LOWER(package_key) WHERE package_key NOT LIKE 'go:%';
+
+-- The latest pending transfer under any casing stays pending
+UPDATE ownership_transfers SET status = 'cancelled', responded_at = NOW()
+WHERE status = 'pending' AND id NOT IN (
+    SELECT DISTINCT ON (CASE WHEN package_key LIKE 'go:%' THEN package_key ELSE LOWER(package_key) END) id
+    FROM ownership_transfers
+    WHERE status = 'pending'
+    ORDER BY CASE WHEN package_key LIKE 'go:%' THEN package_key ELSE LOWER(package_key) END, created_at DESC
+);
+
+UPDATE ownership_transfers SET package_key = LOWER(package_key) WHERE package_key NOT LIKE 'go:%';
+
+-- +migrate Down
+-- The casing keys were granted under is not kept, so keys stay normalized
+SELECT 1;
@@ -0,0 +1,42 @@
+-- +migrate Up
+-- Blob references are counted by storage path rather than SHA256: content
+-- stored under more than one path layout is stored once per layout, and each
+-- copy is removed with the last artifact stored in it. Counts are rebuilt
+-- from the artifacts stored in each blob, deleted ones included since they
+-- keep their content until purged.
+
+DROP TABLE blob_refs;
+
+CREATE TABLE blob_refs (
+    storage_path VARCHAR(512) PRIMARY KEY,
+    sha256 VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL DEFAULT 0,
+    ref_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_blob_refs_sha256 ON blob_refs(sha256);
+
+INSERT INTO blob_refs (storage_path, sha256, size, ref_count)
+SELECT storage_path, MIN(sha256), MAX(size), COUNT(*)
+FROM artifacts
+WHERE storage_path LIKE 'blobs/sha256/%'
+GROUP BY storage_path;
+
+-- +migrate Down
+DROP TABLE blob_refs;
+
+CREATE TABLE blob_refs (
+    sha256 VARCHAR(64) PRIMARY KEY,
+    size BIGINT NOT NULL DEFAULT 0,
+    ref_count BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+INSERT INTO blob_refs (sha256, size, ref_count)
+SELECT sha256, MAX(size), COUNT(*)
+FROM artifacts
+WHERE storage_path LIKE 'blobs/sha256/%'
+GROUP BY sha256;
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- API keys issued by a client's login, such as npm login, record the client
+-- so a later login from it can replace them without touching keys the user
+-- created by hand. Keys created before this are treated as created by hand.
+
+ALTER TABLE api_keys ADD COLUMN login_client VARCHAR(50) NOT NULL DEFAULT '';
+
+-- +migrate Down
+ALTER TABLE api_keys DROP COLUMN IF EXISTS login_client;
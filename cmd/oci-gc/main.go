@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	var (
+		dryRun         = flag.Bool("dry-run", false, "Report what would be removed without removing it")
+		deleteUntagged = flag.Bool("delete-untagged", false, "Also remove manifests no tag refers to, directly or through an index")
+		gracePeriod    = flag.Duration("grace-period", oci.DefaultGCGracePeriod, "Keep blobs uploaded or mounted more recently than this")
+	)
+	flag.Parse()
+
+	// Load configuration
+	cfg := config.LoadFromEnv()
+	cfg.Logging.SetupLogging()
+
+	database, err := common.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to database")
+	}
+	defer database.Close()
+
+	storageBackend, err := storage.NewStorageFactory(&cfg.Storage).CreateStorage()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize storage")
+	}
+	registryService := registry.NewService(database, storageBackend)
+
+	// Pushes to a running API gateway are only protected by the grace period
+	result, err := registryService.CollectOCIGarbage(context.Background(), oci.GCOptions{
+		GracePeriod:    *gracePeriod,
+		DeleteUntagged: *deleteUntagged,
+		DryRun:         *dryRun,
+	}, uuid.Nil)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to garbage collect OCI blobs")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatal().Err(err).Msg("Failed to write garbage collection result")
+	}
+}
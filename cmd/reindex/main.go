@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/metadata"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	var (
+		registryType = flag.String("registry", "", "Only reindex this registry type (default all)")
+		batchSize    = flag.Int("batch-size", metadata.DefaultReindexBatchSize, "Artifacts to index per batch")
+	)
+	flag.Parse()
+
+	if *registryType != "" && !utils.IsValidRegistryType(*registryType) {
+		log.Fatal().Str("registry", *registryType).Msg("Unknown registry type")
+	}
+
+	// Load configuration
+	cfg := config.LoadFromEnv()
+	cfg.Logging.SetupLogging()
+
+	database, err := common.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to database")
+	}
+	defer database.Close()
+
+	// Entries are rebuilt in place, so a running API gateway keeps serving
+	// searches meanwhile
+	metadataService := metadata.NewService(database.DB, cfg)
+	result, err := metadataService.Reindex(context.Background(), metadata.ReindexOptions{
+		Registry:  *registryType,
+		BatchSize: *batchSize,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to rebuild search index")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatal().Err(err).Msg("Failed to write reindex result")
+	}
+}
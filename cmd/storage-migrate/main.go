@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"os"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/rs/zerolog/log"
+)
+
+func main() {
+	// Load configuration
+	cfg := config.LoadFromEnv()
+	cfg.Logging.SetupLogging()
+
+	var (
+		layoutName = flag.String("layout", cfg.Storage.PathLayout, "Layout to move artifact content to: flat or sharded (default STORAGE_PATH_LAYOUT)")
+		batchSize  = flag.Int("batch-size", registry.DefaultLayoutMigrationBatchSize, "Artifacts to load per batch")
+		dryRun     = flag.Bool("dry-run", false, "Report what would be moved without moving it")
+	)
+	flag.Parse()
+
+	layout, err := registry.NewPathLayout(*layoutName)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Invalid storage path layout")
+	}
+
+	database, err := common.NewDatabase(&cfg.Database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to connect to database")
+	}
+	defer database.Close()
+
+	storageBackend, err := storage.NewStorageFactory(&cfg.Storage).CreateStorage()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize storage")
+	}
+	registryService := registry.NewService(database, storageBackend)
+
+	// A running API gateway should already store new content in the target
+	// layout, or content it stores meanwhile is left behind until the next run
+	result, err := registryService.MigrateStorageLayout(context.Background(), registry.LayoutMigrationOptions{
+		Layout:    layout,
+		BatchSize: *batchSize,
+		DryRun:    *dryRun,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to migrate storage layout")
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Fatal().Err(err).Msg("Failed to write migration result")
+	}
+}
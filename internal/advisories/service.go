@@ -0,0 +1,186 @@
+// Package advisories records security advisories for package versions and
+// matches them against the versions clients audit
+package advisories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAdvisoryNotFound is returned when no advisory has the requested ID
+	ErrAdvisoryNotFound = errors.New("advisory not found")
+
+	// ErrInvalidAdvisory is returned when an advisory's package, range or
+	// severity is invalid
+	ErrInvalidAdvisory = errors.New("invalid advisory")
+)
+
+// Severities lists the severities an advisory can have, least severe first
+var Severities = []string{
+	types.AdvisorySeverityInfo,
+	types.AdvisorySeverityLow,
+	types.AdvisorySeverityModerate,
+	types.AdvisorySeverityHigh,
+	types.AdvisorySeverityCritical,
+}
+
+// Service stores advisories and matches them against package versions
+type Service struct {
+	db       *gorm.DB
+	auditLog *audit.Service
+}
+
+// NewService creates an advisory service storing advisories in db
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// SetAuditLog sets the audit trail advisory changes are recorded to
+func (s *Service) SetAuditLog(auditLog *audit.Service) {
+	s.auditLog = auditLog
+}
+
+// ListAdvisories returns the advisories of a registry, or of one of its
+// packages, oldest first. Empty filters match every advisory.
+func (s *Service) ListAdvisories(ctx context.Context, registryType, packageName string) ([]types.Advisory, error) {
+	query := s.db.WithContext(ctx).Order("created_at")
+	if registryType != "" {
+		query = query.Where("registry = ?", registryType)
+	}
+	if packageName != "" {
+		query = query.Where("package_name = ?", packageName)
+	}
+
+	var advisories []types.Advisory
+	if err := query.Find(&advisories).Error; err != nil {
+		return nil, fmt.Errorf("failed to list advisories: %w", err)
+	}
+	return advisories, nil
+}
+
+// GetAdvisory returns an advisory by ID
+func (s *Service) GetAdvisory(ctx context.Context, id uuid.UUID) (*types.Advisory, error) {
+	var advisory types.Advisory
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&advisory).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAdvisoryNotFound
+		}
+		return nil, fmt.Errorf("failed to get advisory: %w", err)
+	}
+	return &advisory, nil
+}
+
+// CreateAdvisory validates and stores a new advisory
+func (s *Service) CreateAdvisory(ctx context.Context, advisory *types.Advisory, createdBy uuid.UUID) error {
+	if err := validateAdvisory(advisory); err != nil {
+		return err
+	}
+	advisory.CreatedBy = &createdBy
+
+	if err := s.db.WithContext(ctx).Create(advisory).Error; err != nil {
+		return fmt.Errorf("failed to create advisory: %w", err)
+	}
+	s.auditLog.Record(ctx, createdBy, audit.ActionAdvisoryCreate, advisory.ID.String(), map[string]interface{}{
+		"registry":            advisory.Registry,
+		"package":             advisory.PackageName,
+		"vulnerable_versions": advisory.VulnerableVersions,
+		"severity":            advisory.Severity,
+	})
+	return nil
+}
+
+// DeleteAdvisory removes an advisory
+func (s *Service) DeleteAdvisory(ctx context.Context, id uuid.UUID, deletedBy uuid.UUID) error {
+	result := s.db.WithContext(ctx).Where("id = ?", id).Delete(&types.Advisory{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete advisory: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAdvisoryNotFound
+	}
+	s.auditLog.Record(ctx, deletedBy, audit.ActionAdvisoryDelete, id.String(), nil)
+	return nil
+}
+
+// Match returns, for each package of a registry, the advisories whose range
+// includes any of the given versions. Every package asked about is in the
+// result, with no advisories if none match.
+func (s *Service) Match(ctx context.Context, registryType string, versions map[string][]string) (map[string][]types.Advisory, error) {
+	matches := make(map[string][]types.Advisory, len(versions))
+	names := make([]string, 0, len(versions))
+	for name := range versions {
+		matches[name] = []types.Advisory{}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return matches, nil
+	}
+
+	var advisories []types.Advisory
+	if err := s.db.WithContext(ctx).
+		Where("registry = ? AND package_name IN ?", registryType, names).
+		Order("created_at").Find(&advisories).Error; err != nil {
+		return nil, fmt.Errorf("failed to match advisories: %w", err)
+	}
+
+	for _, advisory := range advisories {
+		if affectsAny(versions[advisory.PackageName], advisory.VulnerableVersions) {
+			matches[advisory.PackageName] = append(matches[advisory.PackageName], advisory)
+		}
+	}
+	return matches, nil
+}
+
+// affectsAny reports whether any of the versions is in a vulnerable range.
+// Prereleases of vulnerable releases are vulnerable too, whether or not the
+// range names prereleases, so they are checked as the release they precede.
+func affectsAny(versions []string, vulnerableVersions string) bool {
+	constraints, err := semver.NewConstraint(vulnerableVersions)
+	if err != nil {
+		return false
+	}
+	for _, v := range versions {
+		version, err := semver.NewVersion(v)
+		if err != nil {
+			continue
+		}
+		release, err := version.SetPrerelease("")
+		if err != nil {
+			continue
+		}
+		if constraints.Check(version) || constraints.Check(&release) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateAdvisory checks that an advisory names a package and a semver
+// range of its versions
+func validateAdvisory(advisory *types.Advisory) error {
+	if advisory.Registry == "" || advisory.PackageName == "" {
+		return fmt.Errorf("%w: registry and package_name are required", ErrInvalidAdvisory)
+	}
+	if advisory.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidAdvisory)
+	}
+	if _, err := semver.NewConstraint(advisory.VulnerableVersions); err != nil {
+		return fmt.Errorf("%w: vulnerable_versions is not a semver range: %v", ErrInvalidAdvisory, err)
+	}
+	if !slices.Contains(Severities, advisory.Severity) {
+		return fmt.Errorf("%w: unknown severity %q", ErrInvalidAdvisory, advisory.Severity)
+	}
+	if advisory.CVSSScore < 0 || advisory.CVSSScore > 10 {
+		return fmt.Errorf("%w: cvss_score must be between 0 and 10", ErrInvalidAdvisory)
+	}
+	return nil
+}
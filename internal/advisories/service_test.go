@@ -0,0 +1,96 @@
+package advisories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestService(t *testing.T) *Service {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&types.Advisory{}))
+	return NewService(db)
+}
+
+func TestCreateAdvisory_Validation(t *testing.T) {
+	service := setupTestService(t)
+	ctx := context.Background()
+
+	valid := func() *types.Advisory {
+		return &types.Advisory{Registry: "npm", PackageName: "minimist", VulnerableVersions: "<1.2.6", Title: "Prototype Pollution", Severity: types.AdvisorySeverityCritical}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*types.Advisory)
+	}{
+		{"missing package", func(a *types.Advisory) { a.PackageName = "" }},
+		{"missing title", func(a *types.Advisory) { a.Title = "" }},
+		{"invalid range", func(a *types.Advisory) { a.VulnerableVersions = "not a range" }},
+		{"unknown severity", func(a *types.Advisory) { a.Severity = "HIGH" }},
+		{"cvss out of range", func(a *types.Advisory) { a.CVSSScore = 11 }},
+	}
+	for _, tt := range tests {
+		advisory := valid()
+		tt.modify(advisory)
+		assert.ErrorIs(t, service.CreateAdvisory(ctx, advisory, uuid.New()), ErrInvalidAdvisory, tt.name)
+	}
+
+	advisory := valid()
+	require.NoError(t, service.CreateAdvisory(ctx, advisory, uuid.New()))
+	stored, err := service.GetAdvisory(ctx, advisory.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "<1.2.6", stored.VulnerableVersions)
+
+	require.NoError(t, service.DeleteAdvisory(ctx, advisory.ID, uuid.New()))
+	_, err = service.GetAdvisory(ctx, advisory.ID)
+	assert.ErrorIs(t, err, ErrAdvisoryNotFound)
+	assert.ErrorIs(t, service.DeleteAdvisory(ctx, advisory.ID, uuid.New()), ErrAdvisoryNotFound)
+}
+
+func TestMatch(t *testing.T) {
+	service := setupTestService(t)
+	ctx := context.Background()
+
+	for _, advisory := range []*types.Advisory{
+		{Registry: "npm", PackageName: "minimist", VulnerableVersions: "<0.2.4 || >=1.0.0 <1.2.6", Title: "Prototype Pollution", Severity: types.AdvisorySeverityCritical},
+		{Registry: "npm", PackageName: "minimist", VulnerableVersions: "<0.0.9", Title: "Older issue", Severity: types.AdvisorySeverityLow},
+		{Registry: "cargo", PackageName: "minimist", VulnerableVersions: "*", Title: "Another registry", Severity: types.AdvisorySeverityHigh},
+	} {
+		require.NoError(t, service.CreateAdvisory(ctx, advisory, uuid.New()))
+	}
+
+	titles := func(advisories []types.Advisory) []string {
+		titles := []string{}
+		for _, advisory := range advisories {
+			titles = append(titles, advisory.Title)
+		}
+		return titles
+	}
+
+	matches, err := service.Match(ctx, "npm", map[string][]string{
+		"minimist": {"1.2.5"},
+		"express":  {"4.18.2"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Prototype Pollution"}, titles(matches["minimist"]))
+	assert.Equal(t, []types.Advisory{}, matches["express"])
+
+	// Prereleases of vulnerable releases are vulnerable too
+	matches, err = service.Match(ctx, "npm", map[string][]string{"minimist": {"1.2.5-rc.1", "0.0.8"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Prototype Pollution", "Older issue"}, titles(matches["minimist"]))
+
+	matches, err = service.Match(ctx, "npm", map[string][]string{"minimist": {"1.2.6", "0.2.4"}})
+	require.NoError(t, err)
+	assert.Empty(t, matches["minimist"])
+}
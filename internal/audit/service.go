@@ -0,0 +1,169 @@
+// Package audit records the writes made by users to an append-only audit
+// trail
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Audited actions
+const (
+	ActionPackagePublish       = "package.publish"
+	ActionPackageDelete        = "package.delete"
+	ActionPackageRestore       = "package.restore"
+	ActionPackageApprove       = "package.approve"
+	ActionPackageReject        = "package.reject"
+	ActionPackageDeprecate     = "package.deprecate"
+	ActionPackageYank          = "package.yank"
+	ActionPackageUnyank        = "package.unyank"
+	ActionPackageUnlist        = "package.unlist"
+	ActionPackageRelist        = "package.relist"
+	ActionPackageTag           = "package.tag"
+	ActionPackageUntag         = "package.untag"
+	ActionPackageLabel         = "package.label"
+	ActionPackageVisibility    = "package.visibility"
+	ActionOwnerAdd             = "ownership.add"
+	ActionOwnerRemove          = "ownership.remove"
+	ActionOwnerTransfer        = "ownership.transfer"
+	ActionOwnerTransferAccept  = "ownership.transfer.accept"
+	ActionOwnerTransferDecline = "ownership.transfer.decline"
+	ActionOwnerTransferCancel  = "ownership.transfer.cancel"
+	ActionOrgCreate            = "org.create"
+	ActionOrgUpdate            = "org.update"
+	ActionOrgMemberSet         = "org.member.set"
+	ActionOrgMemberRemove      = "org.member.remove"
+	ActionUserRegister         = "user.register"
+	ActionUserPasswordChange   = "user.password_change"
+	ActionUserCreate           = "user.create"
+	ActionUserEnable           = "user.enable"
+	ActionUserDisable          = "user.disable"
+	ActionUserPromote          = "user.promote"
+	ActionUserDemote           = "user.demote"
+	ActionUserPasswordReset    = "user.password_reset"
+	ActionUserTokensRevoke     = "user.tokens_revoke"
+	ActionAPIKeyCreate         = "apikey.create"
+	ActionAPIKeyRevoke         = "apikey.revoke"
+	ActionRegistryUpdate       = "registry.update"
+	ActionQuotaSet             = "quota.set"
+	ActionQuotaDelete          = "quota.delete"
+	ActionRetentionSet         = "retention.set"
+	ActionOCIGarbageCollect    = "oci.gc"
+	ActionStorageReconcile     = "storage.reconcile"
+	ActionWebhookCreate        = "webhook.create"
+	ActionWebhookUpdate        = "webhook.update"
+	ActionWebhookDelete        = "webhook.delete"
+	ActionAdvisoryCreate       = "advisory.create"
+	ActionAdvisoryDelete       = "advisory.delete"
+)
+
+// Filter selects audit entries; zero fields match every entry
+type Filter struct {
+	ActorID *uuid.UUID
+	Action  string
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+	Offset  int
+}
+
+// Service writes and queries the audit trail. A nil service records nothing,
+// so callers need not check whether auditing is enabled.
+type Service struct {
+	db *gorm.DB
+}
+
+// NewService creates an audit service storing entries in db
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// Record adds an entry to the audit trail for a write by actor, taking the
+// source IP from ctx. Recording is best effort: failures are logged and never
+// fail the write being audited.
+func (s *Service) Record(ctx context.Context, actor uuid.UUID, action, target string, details map[string]interface{}) {
+	if s == nil {
+		return
+	}
+
+	entry := &types.AuditEntry{
+		Action:   action,
+		Target:   target,
+		Details:  details,
+		SourceIP: SourceIP(ctx),
+	}
+	if actor != uuid.Nil {
+		entry.ActorID = &actor
+	}
+
+	// The entry is written even if the request was cancelled after the write
+	if err := s.db.WithContext(context.WithoutCancel(ctx)).Create(entry).Error; err != nil {
+		log.Error().Err(err).
+			Str("action", action).
+			Str("target", target).
+			Str("actor_id", actor.String()).
+			Msg("Failed to record audit entry")
+	}
+}
+
+// Query returns the audit entries matching the filter, newest first, and the
+// total number of matching entries
+func (s *Service) Query(ctx context.Context, filter Filter) ([]types.AuditEntry, int64, error) {
+	query := s.db.WithContext(ctx).Model(&types.AuditEntry{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit entries: %w", err)
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	var entries []types.AuditEntry
+	if err := query.Order("created_at DESC").Find(&entries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to query audit entries: %w", err)
+	}
+	return entries, total, nil
+}
+
+// PackageTarget names a package version as the target of an entry
+func PackageTarget(registry, name, version string) string {
+	return fmt.Sprintf("%s:%s@%s", registry, name, version)
+}
+
+// sourceIPKey is the context key of the IP address a request came from
+type sourceIPKey struct{}
+
+// WithSourceIP returns a context carrying the IP address of the client making
+// a request, which entries recorded with it are attributed to
+func WithSourceIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, sourceIPKey{}, ip)
+}
+
+// SourceIP returns the client IP address carried by ctx, or an empty string
+func SourceIP(ctx context.Context) string {
+	ip, _ := ctx.Value(sourceIPKey{}).(string)
+	return ip
+}
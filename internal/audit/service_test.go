@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestService(t *testing.T) (*Service, *gorm.DB) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&types.AuditEntry{}))
+	return NewService(db), db
+}
+
+func TestRecord(t *testing.T) {
+	service, db := setupTestService(t)
+	actor := uuid.New()
+	ctx := WithSourceIP(context.Background(), "192.0.2.1")
+
+	service.Record(ctx, actor, ActionPackagePublish, PackageTarget("npm", "left-pad", "1.0.0"), map[string]interface{}{"size": 7})
+
+	var entries []types.AuditEntry
+	require.NoError(t, db.Find(&entries).Error)
+	require.Len(t, entries, 1)
+	assert.NotEqual(t, uuid.Nil, entries[0].ID)
+	assert.Equal(t, actor, *entries[0].ActorID)
+	assert.Equal(t, ActionPackagePublish, entries[0].Action)
+	assert.Equal(t, "npm:left-pad@1.0.0", entries[0].Target)
+	assert.Equal(t, float64(7), entries[0].Details["size"])
+	assert.Equal(t, "192.0.2.1", entries[0].SourceIP)
+	assert.False(t, entries[0].CreatedAt.IsZero())
+
+	// Writes made by the system itself have no actor
+	service.Record(context.Background(), uuid.Nil, ActionPackageDelete, "npm:left-pad@1.0.0", nil)
+	var system types.AuditEntry
+	require.NoError(t, db.Where("action = ?", ActionPackageDelete).First(&system).Error)
+	assert.Nil(t, system.ActorID)
+	assert.Empty(t, system.SourceIP)
+}
+
+func TestRecord_BestEffort(t *testing.T) {
+	// A nil service records nothing
+	var disabled *Service
+	disabled.Record(context.Background(), uuid.New(), ActionAPIKeyCreate, "key", nil)
+
+	// Failing to record is logged, not returned or panicked on
+	service, db := setupTestService(t)
+	require.NoError(t, db.Migrator().DropTable(&types.AuditEntry{}))
+	service.Record(context.Background(), uuid.New(), ActionAPIKeyCreate, "key", nil)
+
+	// Cancelled requests are still recorded
+	service, db = setupTestService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	service.Record(ctx, uuid.New(), ActionAPIKeyRevoke, "key", nil)
+	var count int64
+	require.NoError(t, db.Model(&types.AuditEntry{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestQuery(t *testing.T) {
+	service, db := setupTestService(t)
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	start := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	for i, entry := range []types.AuditEntry{
+		{ActorID: &alice, Action: ActionPackagePublish, Target: "npm:a@1.0.0"},
+		{ActorID: &alice, Action: ActionPackageDelete, Target: "npm:a@1.0.0"},
+		{ActorID: &bob, Action: ActionPackagePublish, Target: "npm:b@1.0.0"},
+		{ActorID: &bob, Action: ActionAPIKeyCreate, Target: "key"},
+	} {
+		entry.CreatedAt = start.Add(time.Duration(i) * time.Hour)
+		require.NoError(t, db.Create(&entry).Error)
+	}
+
+	entries, total, err := service.Query(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	require.Len(t, entries, 4)
+	assert.Equal(t, ActionAPIKeyCreate, entries[0].Action, "newest first")
+
+	entries, total, err = service.Query(ctx, Filter{ActorID: &alice})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	for _, entry := range entries {
+		assert.Equal(t, alice, *entry.ActorID)
+	}
+
+	entries, total, err = service.Query(ctx, Filter{Action: ActionPackagePublish, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total, "the total ignores the page")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "npm:b@1.0.0", entries[0].Target)
+
+	entries, _, err = service.Query(ctx, Filter{Action: ActionPackagePublish, Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "npm:a@1.0.0", entries[0].Target)
+
+	// Since is inclusive and until exclusive
+	_, total, err = service.Query(ctx, Filter{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// ErrAPIKeyScopeForbidden is returned when a scoped API key is used outside
+// the registries and packages it is limited to
+var ErrAPIKeyScopeForbidden = errors.New("API key is not scoped for this package")
+
+// ErrInvalidAPIKeyScope is returned when an API key scope cannot be parsed
+var ErrInvalidAPIKeyScope = errors.New("invalid API key scope")
+
+// APIKeyScope limits an API key to a registry and, optionally, to the
+// packages in it whose names match a glob
+type APIKeyScope struct {
+	Registry string
+	Package  string
+}
+
+// ParseAPIKeyScope parses a scope of the form "registry" or
+// "registry:package-glob", such as "npm:@myorg/*"
+func ParseAPIKeyScope(scope string) (APIKeyScope, error) {
+	registryType, pattern, _ := strings.Cut(scope, ":")
+	registryType = strings.ToLower(registryType)
+	if !utils.IsValidRegistryType(registryType) {
+		return APIKeyScope{}, fmt.Errorf("%w %q: unknown registry %q", ErrInvalidAPIKeyScope, scope, registryType)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return APIKeyScope{}, fmt.Errorf("%w %q: %v", ErrInvalidAPIKeyScope, scope, err)
+	}
+	return APIKeyScope{Registry: registryType, Package: pattern}, nil
+}
+
+// Allows reports whether the scope permits access to the named package in a
+// registry. An empty name checks the registry alone, for requests that do
+// not name a package. Names are matched case-insensitively, except for Go
+// module paths.
+func (s APIKeyScope) Allows(registryType, name string) bool {
+	if s.Registry != registryType {
+		return false
+	}
+	if s.Package == "" || name == "" {
+		return true
+	}
+	matched, _ := path.Match(utils.NormalizePackageName(s.Package, registryType), utils.NormalizePackageName(name, registryType))
+	return matched
+}
+
+// APIKeyScopesAllow reports whether an API key with the given scopes may
+// access the named package. Keys without scopes are unrestricted.
+func APIKeyScopesAllow(scopes []string, registryType, name string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, raw := range scopes {
+		scope, err := ParseAPIKeyScope(raw)
+		if err == nil && scope.Allows(registryType, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyScopesKey is the context key of the scopes of the API key that
+// authenticated a request
+type apiKeyScopesKey struct{}
+
+// WithAPIKeyScopes returns a context carrying the scopes of the API key that
+// authenticated the request, for services to enforce
+func WithAPIKeyScopes(ctx context.Context, scopes []string) context.Context {
+	if len(scopes) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, apiKeyScopesKey{}, scopes)
+}
+
+// CheckAPIKeyScope returns ErrAPIKeyScopeForbidden if the request was
+// authenticated by an API key whose scopes do not include the named package
+func CheckAPIKeyScope(ctx context.Context, registryType, name string) error {
+	scopes, _ := ctx.Value(apiKeyScopesKey{}).([]string)
+	if !APIKeyScopesAllow(scopes, registryType, name) {
+		return fmt.Errorf("%w: %s:%s", ErrAPIKeyScopeForbidden, registryType, name)
+	}
+	return nil
+}
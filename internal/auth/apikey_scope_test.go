@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAPIKeyScope(t *testing.T) {
+	scope, err := ParseAPIKeyScope("npm:@myorg/*")
+	require.NoError(t, err)
+	assert.Equal(t, APIKeyScope{Registry: "npm", Package: "@myorg/*"}, scope)
+
+	scope, err = ParseAPIKeyScope("NuGet")
+	require.NoError(t, err)
+	assert.Equal(t, APIKeyScope{Registry: "nuget"}, scope)
+
+	_, err = ParseAPIKeyScope("pypi:requests")
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyScope)
+	_, err = ParseAPIKeyScope("npm:[")
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyScope)
+}
+
+func TestAPIKeyScopesAllow(t *testing.T) {
+	scopes := []string{"npm:@myorg/*", "oci:myorg/*", "nuget"}
+
+	assert.True(t, APIKeyScopesAllow(scopes, "npm", "@myorg/pkg"))
+	assert.True(t, APIKeyScopesAllow(scopes, "npm", "@MyOrg/Pkg"))
+	assert.False(t, APIKeyScopesAllow(scopes, "npm", "@other/pkg"))
+	assert.False(t, APIKeyScopesAllow(scopes, "npm", "@myorg/pkg/extra"))
+	assert.True(t, APIKeyScopesAllow(scopes, "oci", "myorg/app"))
+	assert.True(t, APIKeyScopesAllow(scopes, "nuget", "Anything"))
+	assert.False(t, APIKeyScopesAllow(scopes, "maven", "com.example:lib"))
+
+	// Requests that name no package are checked against the registry alone
+	assert.True(t, APIKeyScopesAllow(scopes, "npm", ""))
+	assert.False(t, APIKeyScopesAllow(scopes, "cargo", ""))
+
+	// Go module paths are case sensitive
+	assert.False(t, APIKeyScopesAllow([]string{"go:github.com/MyOrg/*"}, "go", "github.com/myorg/lib"))
+
+	// Unscoped keys are unrestricted
+	assert.True(t, APIKeyScopesAllow(nil, "maven", "com.example:lib"))
+}
+
+func TestCheckAPIKeyScope(t *testing.T) {
+	ctx := context.Background()
+	assert.NoError(t, CheckAPIKeyScope(ctx, "npm", "left-pad"))
+
+	scoped := WithAPIKeyScopes(ctx, []string{"npm:@myorg/*"})
+	assert.NoError(t, CheckAPIKeyScope(scoped, "npm", "@myorg/pkg"))
+	assert.ErrorIs(t, CheckAPIKeyScope(scoped, "npm", "left-pad"), ErrAPIKeyScopeForbidden)
+}
+
+func TestCreateAPIKey_Scopes(t *testing.T) {
+	service, _ := setupTestService(t)
+	ctx := context.Background()
+
+	user, err := service.Register(ctx, &types.RegisterRequest{
+		Username: "ci",
+		Email:    "ci@example.com",
+		Password: "testpassword123",
+	})
+	require.NoError(t, err)
+
+	_, _, err = service.CreateAPIKey(ctx, user.ID, "invalid", nil, []string{"npm:@myorg/*", "pypi"})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyScope)
+
+	_, keyValue, err := service.CreateAPIKey(ctx, user.ID, "publish", []string{"write"}, []string{"npm:@myorg/*"})
+	require.NoError(t, err)
+
+	_, apiKey, err := service.ValidateAPIKey(ctx, keyValue)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"npm:@myorg/*"}, apiKey.Scopes)
+}
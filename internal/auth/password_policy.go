@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Password policy violations, each wrapped with a description of the rule
+var (
+	ErrPasswordTooShort      = errors.New("password is too short")
+	ErrPasswordMissingUpper  = errors.New("password must contain an uppercase letter")
+	ErrPasswordMissingLower  = errors.New("password must contain a lowercase letter")
+	ErrPasswordMissingDigit  = errors.New("password must contain a digit")
+	ErrPasswordMissingSymbol = errors.New("password must contain a symbol")
+	ErrPasswordBreached      = errors.New("password has appeared in a known data breach")
+)
+
+// ErrInvalidCurrentPassword is returned when a password change does not
+// supply the user's current password
+var ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+
+// defaultPasswordMinLength applies when no minimum is configured
+const defaultPasswordMinLength = 8
+
+// BreachChecker reports whether a password is known to have been breached
+type BreachChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// HIBPChecker checks passwords against the Have I Been Pwned range API.
+// Only the first five hex characters of the password's SHA-1 hash leave the
+// server; the matching suffixes are compared locally.
+type HIBPChecker struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// defaultHIBPBaseURL is the Pwned Passwords range endpoint
+const defaultHIBPBaseURL = "https://api.pwnedpasswords.com/range/"
+
+// NewHIBPChecker creates a checker for the public Pwned Passwords API
+func NewHIBPChecker() *HIBPChecker {
+	return &HIBPChecker{
+		BaseURL: defaultHIBPBaseURL,
+		Client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// IsBreached fetches the hash suffixes sharing the password's prefix and
+// reports whether the password's suffix is among them
+func (c *HIBPChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+prefix, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create breach check request: %w", err)
+	}
+	// Padding stops the response size from revealing how many suffixes matched
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("breach check request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("breach check returned status %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		candidate, count, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.EqualFold(candidate, suffix) {
+			continue
+		}
+		// Padding entries carry a count of zero
+		return count != "0", nil
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read breach check response: %w", err)
+	}
+	return false, nil
+}
+
+// SetBreachChecker sets the checker passwords are screened against when the
+// breach check is enabled, replacing the Have I Been Pwned default
+func (s *Service) SetBreachChecker(checker BreachChecker) {
+	s.breachChecker = checker
+}
+
+// ValidatePassword checks a password against the configured policy,
+// returning the first rule it breaks
+func (s *Service) ValidatePassword(ctx context.Context, password string) error {
+	minLength := s.config.PasswordMinLength
+	if minLength <= 0 {
+		minLength = defaultPasswordMinLength
+	}
+	if len([]rune(password)) < minLength {
+		return fmt.Errorf("%w: must be at least %d characters", ErrPasswordTooShort, minLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsLetter(r):
+			hasSymbol = true
+		}
+	}
+	switch {
+	case s.config.PasswordRequireUpper && !hasUpper:
+		return ErrPasswordMissingUpper
+	case s.config.PasswordRequireLower && !hasLower:
+		return ErrPasswordMissingLower
+	case s.config.PasswordRequireDigit && !hasDigit:
+		return ErrPasswordMissingDigit
+	case s.config.PasswordRequireSymbol && !hasSymbol:
+		return ErrPasswordMissingSymbol
+	}
+
+	if s.config.PasswordBreachCheck && s.breachChecker != nil {
+		breached, err := s.breachChecker.IsBreached(ctx, password)
+		if err != nil {
+			// An unreachable breach service should not block sign-ups
+			log.Warn().Err(err).Msg("Password breach check failed; accepting password")
+			return nil
+		}
+		if breached {
+			return ErrPasswordBreached
+		}
+	}
+	return nil
+}
+
+// IsPasswordPolicyError reports whether err is a password policy violation
+func IsPasswordPolicyError(err error) bool {
+	for _, policyErr := range []error{
+		ErrPasswordTooShort, ErrPasswordMissingUpper, ErrPasswordMissingLower,
+		ErrPasswordMissingDigit, ErrPasswordMissingSymbol, ErrPasswordBreached,
+	} {
+		if errors.Is(err, policyErr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubBreachChecker struct {
+	breached map[string]bool
+	err      error
+}
+
+func (c *stubBreachChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	return c.breached[password], c.err
+}
+
+func TestValidatePassword_Rules(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(s *Service)
+		password  string
+		wantErr   error
+	}{
+		{"default minimum length", func(s *Service) {}, "short", ErrPasswordTooShort},
+		{"configured minimum length", func(s *Service) { s.config.PasswordMinLength = 12 }, "elevenchars", ErrPasswordTooShort},
+		{"minimum counts characters not bytes", func(s *Service) { s.config.PasswordMinLength = 4 }, "ééé", ErrPasswordTooShort},
+		{"missing uppercase", func(s *Service) { s.config.PasswordRequireUpper = true }, "lowercase1!", ErrPasswordMissingUpper},
+		{"missing lowercase", func(s *Service) { s.config.PasswordRequireLower = true }, "UPPERCASE1!", ErrPasswordMissingLower},
+		{"missing digit", func(s *Service) { s.config.PasswordRequireDigit = true }, "NoDigitsHere!", ErrPasswordMissingDigit},
+		{"missing symbol", func(s *Service) { s.config.PasswordRequireSymbol = true }, "NoSymbols123", ErrPasswordMissingSymbol},
+		{"all classes present", func(s *Service) {
+			s.config.PasswordRequireUpper = true
+			s.config.PasswordRequireLower = true
+			s.config.PasswordRequireDigit = true
+			s.config.PasswordRequireSymbol = true
+		}, "Str0ng-enough", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := setupTestService(t)
+			tt.configure(service)
+
+			err := service.ValidatePassword(context.Background(), tt.password)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.True(t, IsPasswordPolicyError(err))
+		})
+	}
+}
+
+func TestValidatePassword_BreachCheck(t *testing.T) {
+	service, _ := setupTestService(t)
+	service.SetBreachChecker(&stubBreachChecker{breached: map[string]bool{"password123": true}})
+
+	// Disabled checks never consult the checker
+	assert.NoError(t, service.ValidatePassword(context.Background(), "password123"))
+
+	service.config.PasswordBreachCheck = true
+	assert.ErrorIs(t, service.ValidatePassword(context.Background(), "password123"), ErrPasswordBreached)
+	assert.NoError(t, service.ValidatePassword(context.Background(), "unlisted-passphrase"))
+
+	// An unavailable checker lets the password through
+	service.SetBreachChecker(&stubBreachChecker{err: errors.New("unreachable")})
+	assert.NoError(t, service.ValidatePassword(context.Background(), "password123"))
+}
+
+func TestRegister_RejectsPolicyViolations(t *testing.T) {
+	service, db := setupTestService(t)
+	service.config.PasswordRequireDigit = true
+	service.config.PasswordBreachCheck = true
+	service.SetBreachChecker(&stubBreachChecker{breached: map[string]bool{"password123": true}})
+
+	_, err := service.Register(context.Background(), &types.RegisterRequest{
+		Username: "nodigit", Email: "nodigit@example.com", Password: "nodigitshere",
+	})
+	assert.ErrorIs(t, err, ErrPasswordMissingDigit)
+
+	_, err = service.Register(context.Background(), &types.RegisterRequest{
+		Username: "breached", Email: "breached@example.com", Password: "password123",
+	})
+	assert.ErrorIs(t, err, ErrPasswordBreached)
+
+	var count int64
+	require.NoError(t, db.Model(&types.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	// Policy violations are reported before whether the user already exists
+	_, err = service.Register(context.Background(), &types.RegisterRequest{
+		Username: "existing", Email: "existing@example.com", Password: "existing-pass1",
+	})
+	require.NoError(t, err)
+	_, err = service.Register(context.Background(), &types.RegisterRequest{
+		Username: "existing", Email: "existing@example.com", Password: "nodigitshere",
+	})
+	assert.ErrorIs(t, err, ErrPasswordMissingDigit)
+}
+
+func TestChangePassword(t *testing.T) {
+	service, _ := setupTestService(t)
+	ctx := context.Background()
+
+	user, err := service.Register(ctx, &types.RegisterRequest{
+		Username: "changer", Email: "changer@example.com", Password: "original-pass",
+	})
+	require.NoError(t, err)
+	token, err := service.Login(ctx, &types.LoginRequest{Username: "changer", Password: "original-pass"})
+	require.NoError(t, err)
+	earlier := issuedBefore(t, service, user.ID)
+
+	assert.ErrorIs(t, service.ChangePassword(ctx, user.ID, "wrong-pass", "replacement-pass"), ErrInvalidCurrentPassword)
+	assert.ErrorIs(t, service.ChangePassword(ctx, user.ID, "original-pass", "short"), ErrPasswordTooShort)
+
+	require.NoError(t, service.ChangePassword(ctx, user.ID, "original-pass", "replacement-pass"))
+
+	// Sessions signed in with the old password are signed out
+	_, err = service.ValidateToken(ctx, earlier)
+	assert.Error(t, err)
+	_, err = service.Refresh(ctx, token.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	_, err = service.Login(ctx, &types.LoginRequest{Username: "changer", Password: "original-pass"})
+	assert.Error(t, err)
+	_, err = service.Login(ctx, &types.LoginRequest{Username: "changer", Password: "replacement-pass"})
+	assert.NoError(t, err)
+}
+
+func TestHIBPChecker_SendsOnlyHashPrefix(t *testing.T) {
+	sum := sha1.Sum([]byte("password123"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	var requestedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.Path
+		assert.Equal(t, "true", r.Header.Get("Add-Padding"))
+		fmt.Fprintf(w, "0000000000000000000000000000000000A:0\r\n%s:2254650\r\n", hash[5:])
+	}))
+	defer server.Close()
+
+	checker := NewHIBPChecker()
+	checker.BaseURL = server.URL + "/range/"
+
+	breached, err := checker.IsBreached(context.Background(), "password123")
+	require.NoError(t, err)
+	assert.True(t, breached)
+	assert.Equal(t, "/range/"+hash[:5], requestedPath)
+
+	breached, err = checker.IsBreached(context.Background(), "not-in-the-response")
+	require.NoError(t, err)
+	assert.False(t, breached)
+}
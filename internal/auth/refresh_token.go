@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidRefreshToken is returned for refresh tokens that are unknown,
+// expired or revoked
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// defaultRefreshTokenExpiration applies when none is configured
+const defaultRefreshTokenExpiration = 30 * 24 * time.Hour
+
+// createRefreshToken issues a refresh token for a user, returning the token
+// and when it expires. Only the token's hash is stored.
+func (s *Service) createRefreshToken(ctx context.Context, userID uuid.UUID) (string, time.Time, error) {
+	expiration := s.config.RefreshTokenExpiration
+	if expiration <= 0 {
+		expiration = defaultRefreshTokenExpiration
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+
+	record := &types.RefreshToken{
+		UserID:    userID,
+		TokenHash: utils.ComputeSHA256([]byte(token)),
+		ExpiresAt: time.Now().Add(expiration),
+	}
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return token, record.ExpiresAt, nil
+}
+
+// Refresh issues a new access token for the user a refresh token belongs to,
+// provided the token has not expired or been revoked and the user is still
+// active. The refresh token stays valid for further renewals.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (*types.AuthToken, error) {
+	token, err := s.refresh(ctx, refreshToken)
+	s.metrics.ObserveAuthAttempt("refresh_token", err)
+	return token, err
+}
+
+func (s *Service) refresh(ctx context.Context, refreshToken string) (*types.AuthToken, error) {
+	var record types.RefreshToken
+	if err := s.db.WithContext(ctx).
+		Where("token_hash = ?", utils.ComputeSHA256([]byte(refreshToken))).
+		First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	now := time.Now()
+	if record.RevokedAt != nil {
+		log.Warn().Str("user_id", record.UserID.String()).Msg("Refresh failed: token revoked")
+		return nil, ErrInvalidRefreshToken
+	}
+	if !now.Before(record.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var user types.User
+	if err := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", record.UserID, true).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	authToken, err := s.issueAccessToken(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Model(&record).Update("last_used_at", now).Error; err != nil {
+		log.Warn().Err(err).Msg("Failed to update refresh token usage")
+	}
+	return authToken, nil
+}
+
+// Logout revokes a refresh token, so it can no longer renew access tokens.
+// Access tokens already issued remain valid until they expire.
+func (s *Service) Logout(ctx context.Context, refreshToken string) error {
+	result := s.db.WithContext(ctx).Model(&types.RefreshToken{}).
+		Where("token_hash = ? AND revoked_at IS NULL", utils.ComputeSHA256([]byte(refreshToken))).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loginTestUser registers a user and logs them in
+func loginTestUser(t *testing.T, service *Service) *types.AuthToken {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := service.Register(ctx, &types.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "testpassword123",
+	})
+	require.NoError(t, err)
+
+	authToken, err := service.Login(ctx, &types.LoginRequest{Username: "testuser", Password: "testpassword123"})
+	require.NoError(t, err)
+	return authToken
+}
+
+func TestLogin_IssuesRefreshToken(t *testing.T) {
+	service, db := setupTestService(t)
+	service.config.RefreshTokenExpiration = 24 * time.Hour
+
+	authToken := loginTestUser(t, service)
+	require.NotEmpty(t, authToken.RefreshToken)
+	require.NotNil(t, authToken.RefreshExpiresAt)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), *authToken.RefreshExpiresAt, time.Minute)
+	assert.True(t, authToken.RefreshExpiresAt.After(authToken.ExpiresAt), "refresh tokens outlive access tokens")
+
+	// Only the hash of the token is stored
+	var stored types.RefreshToken
+	require.NoError(t, db.First(&stored).Error)
+	assert.Equal(t, authToken.UserID, stored.UserID)
+	assert.Equal(t, utils.ComputeSHA256([]byte(authToken.RefreshToken)), stored.TokenHash)
+}
+
+func TestRefresh_IssuesAccessToken(t *testing.T) {
+	service, db := setupTestService(t)
+	ctx := context.Background()
+	authToken := loginTestUser(t, service)
+
+	refreshed, err := service.Refresh(ctx, authToken.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, authToken.UserID, refreshed.UserID)
+	assert.Empty(t, refreshed.RefreshToken, "the refresh token is not reissued")
+	assert.True(t, refreshed.ExpiresAt.After(time.Now()))
+
+	user, err := service.ValidateToken(ctx, refreshed.Token)
+	require.NoError(t, err)
+	assert.Equal(t, authToken.UserID, user.ID)
+
+	var stored types.RefreshToken
+	require.NoError(t, db.First(&stored).Error)
+	assert.NotNil(t, stored.LastUsedAt)
+
+	// The refresh token can be used again until it expires or is revoked
+	_, err = service.Refresh(ctx, authToken.RefreshToken)
+	require.NoError(t, err)
+
+	_, err = service.Refresh(ctx, "not-a-refresh-token")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefresh_RejectsRevokedToken(t *testing.T) {
+	service, _ := setupTestService(t)
+	ctx := context.Background()
+	authToken := loginTestUser(t, service)
+
+	require.NoError(t, service.Logout(ctx, authToken.RefreshToken))
+
+	_, err := service.Refresh(ctx, authToken.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Revoking twice, or revoking an unknown token, fails
+	assert.ErrorIs(t, service.Logout(ctx, authToken.RefreshToken), ErrInvalidRefreshToken)
+	assert.ErrorIs(t, service.Logout(ctx, "not-a-refresh-token"), ErrInvalidRefreshToken)
+
+	// Other sessions of the user are unaffected
+	other, err := service.Login(ctx, &types.LoginRequest{Username: "testuser", Password: "testpassword123"})
+	require.NoError(t, err)
+	_, err = service.Refresh(ctx, other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRefresh_RejectsExpiredToken(t *testing.T) {
+	service, db := setupTestService(t)
+	ctx := context.Background()
+	authToken := loginTestUser(t, service)
+
+	require.NoError(t, db.Model(&types.RefreshToken{}).
+		Where("user_id = ?", authToken.UserID).
+		Update("expires_at", time.Now().Add(-time.Second)).Error)
+
+	_, err := service.Refresh(ctx, authToken.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefresh_RejectsInactiveUser(t *testing.T) {
+	service, db := setupTestService(t)
+	ctx := context.Background()
+	authToken := loginTestUser(t, service)
+
+	require.NoError(t, db.Model(&types.User{}).Where("id = ?", authToken.UserID).Update("is_active", false).Error)
+
+	_, err := service.Refresh(ctx, authToken.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestAuthenticate_IssuesNoTokens(t *testing.T) {
+	service, db := setupTestService(t)
+	ctx := context.Background()
+	authToken := loginTestUser(t, service)
+
+	user, err := service.Authenticate(ctx, &types.LoginRequest{Username: "testuser", Password: "testpassword123"})
+	require.NoError(t, err)
+	assert.Equal(t, authToken.UserID, user.ID)
+	assert.Empty(t, user.Password)
+
+	_, err = service.Authenticate(ctx, &types.LoginRequest{Username: "testuser", Password: "wrong"})
+	assert.Error(t, err)
+
+	var count int64
+	require.NoError(t, db.Model(&types.RefreshToken{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count, "only the login issued a refresh token")
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// RegistryTokenAudience is the audience of registry bearer tokens, and the
+// service name clients are told to request them for
+const RegistryTokenAudience = "registry"
+
+// defaultRegistryTokenExpiration applies when none is configured
+const defaultRegistryTokenExpiration = time.Hour
+
+// RegistryAccess is one grant carried by a registry bearer token, in the
+// shape of the Docker token specification's access claim
+type RegistryAccess struct {
+	Type    string   `json:"type"` // "repository" or "registry"
+	Name    string   `json:"name"`
+	Actions []string `json:"actions"`
+}
+
+// Allows reports whether the grant permits action on the named resource
+func (a RegistryAccess) Allows(resourceType, name, action string) bool {
+	if a.Type != resourceType || a.Name != name {
+		return false
+	}
+	return slices.Contains(a.Actions, action) || slices.Contains(a.Actions, "*")
+}
+
+// String formats the grant as a scope, such as "repository:myorg/app:pull,push"
+func (a RegistryAccess) String() string {
+	return fmt.Sprintf("%s:%s:%s", a.Type, a.Name, strings.Join(a.Actions, ","))
+}
+
+// ParseRegistryScopes parses space separated scopes of the form
+// "type:name:action,action". Malformed scopes are skipped.
+func ParseRegistryScopes(scopes ...string) []RegistryAccess {
+	var access []RegistryAccess
+	for _, scope := range scopes {
+		for _, field := range strings.Fields(scope) {
+			// Names never contain a colon, but split on the outer colons regardless
+			first, last := strings.Index(field, ":"), strings.LastIndex(field, ":")
+			if first <= 0 || last == first || last == len(field)-1 {
+				continue
+			}
+			access = append(access, RegistryAccess{
+				Type:    field[:first],
+				Name:    field[first+1 : last],
+				Actions: strings.Split(field[last+1:], ","),
+			})
+		}
+	}
+	return access
+}
+
+// registryTokenClaims are the claims of a registry bearer token. The user is
+// the subject rather than a user_id claim, so a registry token can never
+// pass as an unrestricted API token in ValidateToken.
+type registryTokenClaims struct {
+	Access []RegistryAccess `json:"access"`
+	Scopes []string         `json:"scopes,omitempty"` // of the API key the token was issued for
+	jwt.RegisteredClaims
+}
+
+// IssueRegistryToken signs a bearer token granting user the given access,
+// returning the token and how long it is valid for. A token issued for a
+// scoped API key carries the key's scopes, so requests made with it are held
+// to them as requests made with the key are.
+func (s *Service) IssueRegistryToken(user *types.User, access []RegistryAccess, scopes []string) (string, time.Duration, error) {
+	expiration := s.config.RegistryTokenExpiration
+	if expiration <= 0 {
+		expiration = defaultRegistryTokenExpiration
+	}
+
+	if access == nil {
+		access = []RegistryAccess{}
+	}
+
+	now := time.Now()
+	claims := registryTokenClaims{
+		Access: access,
+		Scopes: scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.String(),
+			Audience:  jwt.ClaimStrings{RegistryTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.config.JWTSecret))
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to sign registry token: %w", err)
+	}
+	return token, expiration, nil
+}
+
+// ValidateRegistryToken verifies a registry bearer token and returns its
+// user, the access it grants and the scopes of the API key it was issued for,
+// if any
+func (s *Service) ValidateRegistryToken(ctx context.Context, tokenString string) (*types.User, []RegistryAccess, []string, error) {
+	user, access, scopes, err := s.validateRegistryToken(ctx, tokenString)
+	s.metrics.ObserveAuthAttempt("registry_token", err)
+	return user, access, scopes, err
+}
+
+func (s *Service) validateRegistryToken(ctx context.Context, tokenString string) (*types.User, []RegistryAccess, []string, error) {
+	var claims registryTokenClaims
+	if _, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.config.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(RegistryTokenAudience)); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid registry token: %w", err)
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid registry token subject")
+	}
+
+	var user types.User
+	if err := s.db.WithContext(ctx).Where("id = ? AND is_active = ?", userID, true).First(&user).Error; err != nil {
+		return nil, nil, nil, fmt.Errorf("user not found")
+	}
+	if claims.IssuedAt != nil && tokenRevoked(&user, claims.IssuedAt.Time) {
+		return nil, nil, nil, fmt.Errorf("invalid registry token: token has been revoked")
+	}
+
+	user.Password = "" // Remove password from response
+	return &user, claims.Access, claims.Scopes, nil
+}
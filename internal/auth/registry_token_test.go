@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRegistryScopes(t *testing.T) {
+	access := ParseRegistryScopes("repository:myorg/app:pull,push registry:catalog:*", "malformed", "repository:other:pull")
+
+	assert.Equal(t, []RegistryAccess{
+		{Type: "repository", Name: "myorg/app", Actions: []string{"pull", "push"}},
+		{Type: "registry", Name: "catalog", Actions: []string{"*"}},
+		{Type: "repository", Name: "other", Actions: []string{"pull"}},
+	}, access)
+}
+
+func TestRegistryAccess_Allows(t *testing.T) {
+	pull := RegistryAccess{Type: "repository", Name: "myorg/app", Actions: []string{"pull"}}
+	assert.True(t, pull.Allows("repository", "myorg/app", "pull"))
+	assert.False(t, pull.Allows("repository", "myorg/app", "push"))
+	assert.False(t, pull.Allows("repository", "myorg/other", "pull"))
+
+	all := RegistryAccess{Type: "repository", Name: "myorg/app", Actions: []string{"*"}}
+	assert.True(t, all.Allows("repository", "myorg/app", "delete"))
+	assert.Equal(t, "repository:myorg/app:*", all.String())
+}
+
+func TestRegistryToken_RoundTrip(t *testing.T) {
+	service, db := setupTestService(t)
+	service.config.RegistryTokenExpiration = 5 * time.Minute
+	ctx := context.Background()
+
+	user := &types.User{Username: "docker", Email: "docker@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	access := []RegistryAccess{{Type: "repository", Name: "myorg/app", Actions: []string{"pull"}}}
+	token, expiresIn, err := service.IssueRegistryToken(user, access, []string{"oci:myorg/*"})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, expiresIn)
+
+	validated, grants, scopes, err := service.ValidateRegistryToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, validated.ID)
+	assert.Empty(t, validated.Password)
+	assert.Equal(t, access, grants)
+	assert.Equal(t, []string{"oci:myorg/*"}, scopes)
+
+	// A scoped token must not pass as an unrestricted token
+	_, err = service.ValidateToken(ctx, token)
+	assert.Error(t, err)
+}
+
+func TestValidateRegistryToken_RejectsOtherTokens(t *testing.T) {
+	service, db := setupTestService(t)
+	ctx := context.Background()
+
+	user := &types.User{Username: "docker", Email: "docker@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	t.Run("login token", func(t *testing.T) {
+		token, err := utils.GenerateJWT(user.ID, service.config.JWTSecret, time.Hour)
+		require.NoError(t, err)
+
+		_, _, _, err = service.ValidateRegistryToken(ctx, token)
+		assert.Error(t, err)
+	})
+
+	t.Run("different secret", func(t *testing.T) {
+		other, _ := setupTestService(t)
+		other.config.JWTSecret = "another-secret"
+		token, _, err := other.IssueRegistryToken(user, nil, nil)
+		require.NoError(t, err)
+
+		_, _, _, err = service.ValidateRegistryToken(ctx, token)
+		assert.Error(t, err)
+	})
+
+	t.Run("inactive user", func(t *testing.T) {
+		token, _, err := service.IssueRegistryToken(user, nil, nil)
+		require.NoError(t, err)
+		require.NoError(t, db.Model(user).Update("is_active", false).Error)
+
+		_, _, _, err = service.ValidateRegistryToken(ctx, token)
+		assert.Error(t, err)
+	})
+}
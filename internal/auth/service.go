@@ -6,9 +6,11 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/pkg/auth"
 	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/metrics"
 	"github.com/lgulliver/lodestone/pkg/types"
 	"github.com/lgulliver/lodestone/pkg/utils"
 	"github.com/rs/zerolog/log"
@@ -17,29 +19,56 @@ import (
 
 // Service handles authentication operations
 type Service struct {
-	db     *common.Database
-	cache  *common.Cache
-	config *config.AuthConfig
+	db       *common.Database
+	cache    *common.Cache
+	config   *config.AuthConfig
+	metrics  *metrics.Collector
+	auditLog *audit.Service
+
+	breachChecker BreachChecker
 }
 
 // NewService creates a new authentication service
 func NewService(db *common.Database, cache *common.Cache, config *config.AuthConfig) *Service {
-	return &Service{
+	service := &Service{
 		db:     db,
 		cache:  cache,
 		config: config,
 	}
+	if config.PasswordBreachCheck {
+		service.breachChecker = NewHIBPChecker()
+	}
+	return service
+}
+
+// SetMetrics sets the collector that records authentication attempts; nil
+// disables recording
+func (s *Service) SetMetrics(collector *metrics.Collector) {
+	s.metrics = collector
+}
+
+// SetAuditLog sets the audit trail registrations and API key changes are
+// recorded to; nil disables recording
+func (s *Service) SetAuditLog(auditLog *audit.Service) {
+	s.auditLog = auditLog
 }
 
 // Register creates a new user account
 func (s *Service) Register(ctx context.Context, req *types.RegisterRequest) (*types.User, error) {
 	log.Info().Str("username", req.Username).Str("email", req.Email).Msg("Attempting user registration")
 
+	// Validate the password first, so rejections do not reveal whether the
+	// user already exists
+	if err := s.ValidatePassword(ctx, req.Password); err != nil {
+		log.Warn().Str("username", req.Username).Err(err).Msg("Registration failed: password rejected by policy")
+		return nil, err
+	}
+
 	// Check if user already exists
 	var existingUser types.User
 	if err := s.db.Where("username = ? OR email = ?", req.Username, req.Email).First(&existingUser).Error; err == nil {
 		log.Warn().Str("username", req.Username).Str("email", req.Email).Msg("Registration failed: user already exists")
-		return nil, fmt.Errorf("user with username or email already exists")
+		return nil, ErrUserExists
 	}
 
 	// Hash password
@@ -64,14 +93,55 @@ func (s *Service) Register(ctx context.Context, req *types.RegisterRequest) (*ty
 	}
 
 	log.Info().Str("username", user.Username).Str("user_id", user.ID.String()).Msg("User registration successful")
+	s.auditLog.Record(ctx, user.ID, audit.ActionUserRegister, user.Username, nil)
 
 	// Remove password from response
 	user.Password = ""
 	return user, nil
 }
 
-// Login authenticates a user and returns a JWT token
+// Login authenticates a user and returns a short-lived JWT access token and
+// a refresh token that renews it
 func (s *Service) Login(ctx context.Context, req *types.LoginRequest) (*types.AuthToken, error) {
+	token, err := s.login(ctx, req)
+	s.metrics.ObserveAuthAttempt("password", err)
+	return token, err
+}
+
+func (s *Service) login(ctx context.Context, req *types.LoginRequest) (*types.AuthToken, error) {
+	user, err := s.authenticate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	authToken, err := s.issueAccessToken(ctx, user.ID)
+	if err != nil {
+		log.Error().Err(err).Str("username", req.Username).Msg("Failed to generate JWT token")
+		return nil, err
+	}
+
+	refreshToken, refreshExpiresAt, err := s.createRefreshToken(ctx, user.ID)
+	if err != nil {
+		log.Error().Err(err).Str("username", req.Username).Msg("Failed to create refresh token")
+		return nil, err
+	}
+	authToken.RefreshToken = refreshToken
+	authToken.RefreshExpiresAt = &refreshExpiresAt
+
+	log.Info().Str("username", req.Username).Str("user_id", user.ID.String()).Msg("Login successful")
+	return authToken, nil
+}
+
+// Authenticate checks a user's credentials and returns the user, without
+// issuing any tokens. It suits clients that send credentials with every
+// request, such as Docker's basic authentication.
+func (s *Service) Authenticate(ctx context.Context, req *types.LoginRequest) (*types.User, error) {
+	user, err := s.authenticate(ctx, req)
+	s.metrics.ObserveAuthAttempt("password", err)
+	return user, err
+}
+
+func (s *Service) authenticate(ctx context.Context, req *types.LoginRequest) (*types.User, error) {
 	log.Info().Str("username", req.Username).Msg("Login attempt")
 
 	// Find user
@@ -97,24 +167,63 @@ func (s *Service) Login(ctx context.Context, req *types.LoginRequest) (*types.Au
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
-	// Generate JWT token
-	token, err := utils.GenerateJWT(user.ID, s.config.JWTSecret, s.config.JWTExpiration)
+	user.Password = "" // Remove password from response
+	return &user, nil
+}
+
+// ChangePassword replaces a user's password after verifying their current
+// one and revokes their tokens, so every session signs in again with the new
+// password. The new password must satisfy the password policy.
+func (s *Service) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) error {
+	var user types.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !utils.CheckPassword(currentPassword, user.Password) {
+		log.Warn().Str("user_id", userID.String()).Msg("Password change failed: invalid current password")
+		return ErrInvalidCurrentPassword
+	}
+
+	if err := s.ValidatePassword(ctx, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword, s.config.BCryptCost)
 	if err != nil {
-		log.Error().Err(err).Str("username", req.Username).Msg("Failed to generate JWT token")
-		return nil, fmt.Errorf("failed to generate token: %w", err)
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Model(&user).Update("password", hashedPassword).Error; err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := s.revokeTokens(ctx, userID); err != nil {
+		return err
 	}
 
-	log.Info().Str("username", req.Username).Str("user_id", user.ID.String()).Msg("Login successful")
+	log.Info().Str("user_id", userID.String()).Msg("Password changed")
+	s.auditLog.Record(ctx, userID, audit.ActionUserPasswordChange, user.Username, nil)
+	return nil
+}
+
+// issueAccessToken generates a JWT access token for a user
+func (s *Service) issueAccessToken(ctx context.Context, userID uuid.UUID) (*types.AuthToken, error) {
+	token, err := utils.GenerateJWT(userID, s.config.JWTSecret, s.config.JWTExpiration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
 
 	authToken := &types.AuthToken{
 		Token:     token,
 		ExpiresAt: time.Now().Add(s.config.JWTExpiration),
-		UserID:    user.ID,
+		UserID:    userID,
 	}
 
 	// Cache the token if cache is available
 	if s.cache != nil {
-		cacheKey := fmt.Sprintf("token:%s", user.ID.String())
+		cacheKey := fmt.Sprintf("token:%s", userID.String())
 		if err := s.cache.Set(ctx, cacheKey, authToken, s.config.JWTExpiration); err != nil {
 			// Log error but don't fail the login
 			log.Warn().Err(err).Msg("Failed to cache token")
@@ -126,8 +235,14 @@ func (s *Service) Login(ctx context.Context, req *types.LoginRequest) (*types.Au
 
 // ValidateToken validates a JWT token and returns the user
 func (s *Service) ValidateToken(ctx context.Context, tokenString string) (*types.User, error) {
+	user, err := s.validateToken(ctx, tokenString)
+	s.metrics.ObserveAuthAttempt("jwt", err)
+	return user, err
+}
+
+func (s *Service) validateToken(ctx context.Context, tokenString string) (*types.User, error) {
 	// Validate JWT
-	userID, err := utils.ValidateJWT(tokenString, s.config.JWTSecret)
+	userID, issuedAt, err := utils.ParseJWT(tokenString, s.config.JWTSecret)
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
@@ -137,6 +252,9 @@ func (s *Service) ValidateToken(ctx context.Context, tokenString string) (*types
 		cacheKey := fmt.Sprintf("user:%s", userID.String())
 		var user types.User
 		if err := s.cache.Get(ctx, cacheKey, &user); err == nil {
+			if tokenRevoked(&user, issuedAt) {
+				return nil, fmt.Errorf("invalid token: token has been revoked")
+			}
 			return &user, nil
 		}
 	}
@@ -149,6 +267,9 @@ func (s *Service) ValidateToken(ctx context.Context, tokenString string) (*types
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
+	if tokenRevoked(&user, issuedAt) {
+		return nil, fmt.Errorf("invalid token: token has been revoked")
+	}
 
 	// Cache user for future requests if cache is available
 	if s.cache != nil {
@@ -163,32 +284,104 @@ func (s *Service) ValidateToken(ctx context.Context, tokenString string) (*types
 }
 
 // CreateAPIKey creates a new API key for a user
-func (s *Service) CreateAPIKey(ctx context.Context, userID uuid.UUID, name string, permissions []string) (*types.APIKey, string, error) {
-	// Generate API key
+func (s *Service) CreateAPIKey(ctx context.Context, userID uuid.UUID, name string, permissions, scopes []string) (*types.APIKey, string, error) {
+	apiKey, keyValue, err := newAPIKey(userID, name, permissions, scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.db.Create(apiKey).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	// Load user relationship
+	if err := s.db.Preload("User").First(apiKey, apiKey.ID).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to load API key: %w", err)
+	}
+	s.auditLog.Record(ctx, userID, audit.ActionAPIKeyCreate, apiKey.ID.String(), map[string]interface{}{
+		"name":        name,
+		"permissions": permissions,
+		"scopes":      scopes,
+	})
+
+	return apiKey, keyValue, nil
+}
+
+// newAPIKey generates an active API key for a user, returning the record to
+// store, which holds only the key's hash, and the key itself
+func newAPIKey(userID uuid.UUID, name string, permissions, scopes []string) (*types.APIKey, string, error) {
+	for _, scope := range scopes {
+		if _, err := ParseAPIKeyScope(scope); err != nil {
+			return nil, "", err
+		}
+	}
+
 	keyValue, err := auth.GenerateAPIKey()
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
 	}
 
-	// Hash the key for storage
-	keyHash := auth.HashAPIKey(keyValue)
-
-	// Create API key record
-	apiKey := &types.APIKey{
+	return &types.APIKey{
 		UserID:      userID,
 		Name:        name,
-		KeyHash:     keyHash,
+		KeyHash:     auth.HashAPIKey(keyValue),
 		Permissions: permissions,
+		Scopes:      scopes,
 		IsActive:    true,
+	}, keyValue, nil
+}
+
+// IssueLoginKey creates an API key for a user logging in with a client, such
+// as npm login, marked as issued to the client and expiring after lifetime.
+// previousKey is the key the client presented while logging in, if any; when
+// it is an active key an earlier login issued to the same client for the same
+// user, it is revoked along with creating the new key, so a client that logs in
+// again holds one live key. Keys created by hand and keys held by other
+// clients are left alone.
+func (s *Service) IssueLoginKey(ctx context.Context, userID uuid.UUID, client, name string, scopes []string, lifetime time.Duration, previousKey string) (*types.APIKey, string, error) {
+	apiKey, keyValue, err := newAPIKey(userID, name, nil, scopes)
+	if err != nil {
+		return nil, "", err
 	}
+	expiresAt := time.Now().Add(lifetime)
+	apiKey.ExpiresAt = &expiresAt
+	apiKey.LoginClient = client
+
+	var replaced []uuid.UUID
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(apiKey).Error; err != nil {
+			return fmt.Errorf("failed to create API key: %w", err)
+		}
+		if previousKey == "" {
+			return nil
+		}
 
-	if err := s.db.Create(apiKey).Error; err != nil {
-		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+		if err := tx.Model(&types.APIKey{}).
+			Where("user_id = ? AND login_client = ? AND key_hash = ? AND is_active = ?", userID, client, auth.HashAPIKey(previousKey), true).
+			Pluck("id", &replaced).Error; err != nil {
+			return fmt.Errorf("failed to find replaced API key: %w", err)
+		}
+		if len(replaced) == 0 {
+			return nil
+		}
+		if err := tx.Model(&types.APIKey{}).Where("id IN ?", replaced).Update("is_active", false).Error; err != nil {
+			return fmt.Errorf("failed to revoke replaced API key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
 
-	// Load user relationship
-	if err := s.db.Preload("User").First(apiKey, apiKey.ID).Error; err != nil {
-		return nil, "", fmt.Errorf("failed to load API key: %w", err)
+	s.auditLog.Record(ctx, userID, audit.ActionAPIKeyCreate, apiKey.ID.String(), map[string]interface{}{
+		"name":         name,
+		"scopes":       scopes,
+		"login_client": client,
+	})
+	for _, keyID := range replaced {
+		s.auditLog.Record(ctx, userID, audit.ActionAPIKeyRevoke, keyID.String(), map[string]interface{}{
+			"replaced_by": apiKey.ID.String(),
+		})
 	}
 
 	return apiKey, keyValue, nil
@@ -196,6 +389,12 @@ func (s *Service) CreateAPIKey(ctx context.Context, userID uuid.UUID, name strin
 
 // ValidateAPIKey validates an API key and returns the associated user
 func (s *Service) ValidateAPIKey(ctx context.Context, keyValue string) (*types.User, *types.APIKey, error) {
+	user, apiKey, err := s.validateAPIKey(ctx, keyValue)
+	s.metrics.ObserveAuthAttempt("api_key", err)
+	return user, apiKey, err
+}
+
+func (s *Service) validateAPIKey(ctx context.Context, keyValue string) (*types.User, *types.APIKey, error) {
 	// Log the API key format being validated for monitoring
 	keyFormat := auth.GetAPIKeyFormat(keyValue)
 	log.Debug().
@@ -232,10 +431,12 @@ func (s *Service) ValidateAPIKey(ctx context.Context, keyValue string) (*types.U
 		Str("key_name", apiKey.Name).
 		Msg("API key validation successful")
 
-	// Update last used timestamp
+	// Update last used timestamp alone, so a key revoked meanwhile stays revoked
 	now := time.Now()
 	apiKey.LastUsedAt = &now
-	s.db.Save(&apiKey)
+	if err := s.db.WithContext(ctx).Model(&apiKey).UpdateColumn("last_used_at", now).Error; err != nil {
+		log.Warn().Err(err).Str("key_id", apiKey.ID.String()).Msg("Failed to record API key use")
+	}
 
 	apiKey.User.Password = "" // Remove password from response
 	return &apiKey.User, &apiKey, nil
@@ -246,7 +447,7 @@ func (s *Service) GetUserByID(ctx context.Context, userID uuid.UUID) (*types.Use
 	var user types.User
 	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
@@ -285,6 +486,7 @@ func (s *Service) RevokeAPIKey(ctx context.Context, keyID uuid.UUID, userID uuid
 	if result.RowsAffected == 0 {
 		return fmt.Errorf("API key not found")
 	}
+	s.auditLog.Record(ctx, userID, audit.ActionAPIKeyRevoke, keyID.String(), nil)
 
 	return nil
 }
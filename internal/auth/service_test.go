@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/pkg/config"
 	"github.com/lgulliver/lodestone/pkg/types"
@@ -21,7 +22,7 @@ func setupTestDB(t *testing.T) *common.Database {
 	require.NoError(t, err)
 
 	// Auto migrate tables
-	err = db.AutoMigrate(&types.User{}, &types.APIKey{})
+	err = db.AutoMigrate(&types.User{}, &types.APIKey{}, &types.RefreshToken{}, &types.AuditEntry{})
 	require.NoError(t, err)
 
 	return &common.Database{DB: db}
@@ -297,7 +298,7 @@ func TestCreateAPIKey_Success(t *testing.T) {
 
 	// Create API key
 	permissions := []string{"read", "write"}
-	apiKey, keyValue, err := service.CreateAPIKey(ctx, user.ID, "test-key", permissions)
+	apiKey, keyValue, err := service.CreateAPIKey(ctx, user.ID, "test-key", permissions, nil)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, apiKey)
@@ -324,7 +325,7 @@ func TestValidateAPIKey_Success(t *testing.T) {
 
 	// Create API key
 	permissions := []string{"read", "write"}
-	apiKey, keyValue, err := service.CreateAPIKey(ctx, user.ID, "test-key", permissions)
+	apiKey, keyValue, err := service.CreateAPIKey(ctx, user.ID, "test-key", permissions, nil)
 	require.NoError(t, err)
 
 	// Validate API key
@@ -367,7 +368,7 @@ func TestValidateAPIKey_InactiveUser(t *testing.T) {
 	require.NoError(t, db.Create(user).Error)
 
 	permissions := []string{"read"}
-	_, keyValue, err := service.CreateAPIKey(ctx, user.ID, "test-key", permissions)
+	_, keyValue, err := service.CreateAPIKey(ctx, user.ID, "test-key", permissions, nil)
 	require.NoError(t, err)
 
 	// Deactivate user
@@ -382,6 +383,41 @@ func TestValidateAPIKey_InactiveUser(t *testing.T) {
 	assert.Contains(t, err.Error(), "user account is disabled")
 }
 
+func TestValidateAPIKey_RevokedDuringValidation(t *testing.T) {
+	service, db := setupTestService(t)
+	ctx := context.Background()
+
+	user := &types.User{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "hashedpassword",
+		IsActive: true,
+	}
+	require.NoError(t, db.Create(user).Error)
+	apiKey, keyValue, err := service.CreateAPIKey(ctx, user.ID, "test-key", nil, nil)
+	require.NoError(t, err)
+
+	// The key is revoked right after validation has read it
+	var revoked bool
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:revoke_api_key", func(tx *gorm.DB) {
+		if tx.Statement.Table == "api_keys" && !revoked {
+			revoked = true
+			require.NoError(t, tx.Session(&gorm.Session{NewDB: true}).Exec("UPDATE api_keys SET is_active = ? WHERE id = ?", false, apiKey.ID).Error)
+		}
+	}))
+	_, _, err = service.ValidateAPIKey(ctx, keyValue)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	// Recording the key's use does not bring it back
+	var stored types.APIKey
+	require.NoError(t, db.First(&stored, "id = ?", apiKey.ID).Error)
+	assert.False(t, stored.IsActive)
+	assert.NotNil(t, stored.LastUsedAt)
+	_, _, err = service.ValidateAPIKey(ctx, keyValue)
+	assert.Error(t, err)
+}
+
 func TestGetUserByID_Success(t *testing.T) {
 	service, _ := setupTestService(t)
 	ctx := context.Background()
@@ -433,9 +469,9 @@ func TestListAPIKeys_Success(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create multiple API keys
-	_, _, err = service.CreateAPIKey(ctx, user.ID, "key1", []string{"read"})
+	_, _, err = service.CreateAPIKey(ctx, user.ID, "key1", []string{"read"}, nil)
 	require.NoError(t, err)
-	_, _, err = service.CreateAPIKey(ctx, user.ID, "key2", []string{"write"})
+	_, _, err = service.CreateAPIKey(ctx, user.ID, "key2", []string{"write"}, nil)
 	require.NoError(t, err)
 
 	// List API keys
@@ -485,7 +521,7 @@ func TestRevokeAPIKey_Success(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create API key
-	apiKey, _, err := service.CreateAPIKey(ctx, user.ID, "test-key", []string{"read"})
+	apiKey, _, err := service.CreateAPIKey(ctx, user.ID, "test-key", []string{"read"}, nil)
 	require.NoError(t, err)
 
 	// Revoke API key
@@ -542,7 +578,7 @@ func TestRevokeAPIKey_WrongUser(t *testing.T) {
 	require.NoError(t, err)
 
 	// Create API key for user1
-	apiKey, _, err := service.CreateAPIKey(ctx, user1.ID, "test-key", []string{"read"})
+	apiKey, _, err := service.CreateAPIKey(ctx, user1.ID, "test-key", []string{"read"}, nil)
 	require.NoError(t, err)
 
 	// Try to revoke user1's API key as user2
@@ -551,3 +587,38 @@ func TestRevokeAPIKey_WrongUser(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "API key not found")
 }
+
+func TestAuditLog_RecordsAccountChanges(t *testing.T) {
+	service, db := setupTestService(t)
+	auditLog := audit.NewService(db.DB)
+	service.SetAuditLog(auditLog)
+	ctx := audit.WithSourceIP(context.Background(), "192.0.2.10")
+
+	user, err := service.Register(ctx, &types.RegisterRequest{
+		Username: "testuser",
+		Email:    "test@example.com",
+		Password: "testpassword123",
+	})
+	require.NoError(t, err)
+
+	apiKey, _, err := service.CreateAPIKey(ctx, user.ID, "ci", []string{"read"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, service.RevokeAPIKey(ctx, apiKey.ID, user.ID))
+
+	// A failed revoke is not audited
+	require.Error(t, service.RevokeAPIKey(ctx, uuid.New(), user.ID))
+
+	entries, total, err := auditLog.Query(ctx, audit.Filter{ActorID: &user.ID})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), total)
+
+	byAction := make(map[string]types.AuditEntry)
+	for _, entry := range entries {
+		byAction[entry.Action] = entry
+		assert.Equal(t, "192.0.2.10", entry.SourceIP)
+	}
+	assert.Equal(t, "testuser", byAction[audit.ActionUserRegister].Target)
+	assert.Equal(t, apiKey.ID.String(), byAction[audit.ActionAPIKeyCreate].Target)
+	assert.Equal(t, "ci", byAction[audit.ActionAPIKeyCreate].Details["name"])
+	assert.Equal(t, apiKey.ID.String(), byAction[audit.ActionAPIKeyRevoke].Target)
+}
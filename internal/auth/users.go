@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrUserNotFound is returned when an administrative action names an unknown user
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUserExists is returned when a username or email is already taken
+var ErrUserExists = errors.New("user with username or email already exists")
+
+// ErrSelfModification is returned when administrators try to disable or
+// demote themselves, which could leave no one able to administer the server
+var ErrSelfModification = errors.New("administrators cannot disable or demote themselves")
+
+// ListUsers returns a page of users ordered by username, and the total
+// number of users
+func (s *Service) ListUsers(ctx context.Context, limit, offset int) ([]types.User, int64, error) {
+	query := s.db.WithContext(ctx).Model(&types.User{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	var users []types.User
+	if err := query.Order("username").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	for i := range users {
+		users[i].Password = "" // Remove password from response
+	}
+	return users, total, nil
+}
+
+// CreateUser creates an account on behalf of an administrator. Unlike
+// Register it can create administrators.
+func (s *Service) CreateUser(ctx context.Context, actor uuid.UUID, req *types.RegisterRequest, isAdmin bool) (*types.User, error) {
+	user, err := s.Register(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if isAdmin {
+		if err := s.db.WithContext(ctx).Model(&types.User{}).Where("id = ?", user.ID).Update("is_admin", true).Error; err != nil {
+			return nil, fmt.Errorf("failed to promote user: %w", err)
+		}
+		user.IsAdmin = true
+	}
+
+	s.auditLog.Record(ctx, actor, audit.ActionUserCreate, user.Username, map[string]interface{}{
+		"user_id":  user.ID,
+		"is_admin": isAdmin,
+	})
+	return user, nil
+}
+
+// SetUserActive enables or disables a user's account. Disabling it also
+// revokes the user's refresh tokens; their access tokens and API keys are
+// refused from their next use, since validation checks the account is active.
+func (s *Service) SetUserActive(ctx context.Context, actor, userID uuid.UUID, active bool) (*types.User, error) {
+	if !active && actor == userID {
+		return nil, ErrSelfModification
+	}
+
+	user, err := s.updateUser(ctx, userID, "is_active", active)
+	if err != nil {
+		return nil, err
+	}
+	if !active {
+		if err := s.revokeRefreshTokens(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	action := audit.ActionUserEnable
+	if !active {
+		action = audit.ActionUserDisable
+	}
+	log.Info().Str("user_id", userID.String()).Bool("active", active).Msg("User account status changed")
+	s.auditLog.Record(ctx, actor, action, user.Username, map[string]interface{}{"user_id": userID})
+	return user, nil
+}
+
+// SetUserAdmin grants or removes a user's administrator privileges
+func (s *Service) SetUserAdmin(ctx context.Context, actor, userID uuid.UUID, admin bool) (*types.User, error) {
+	if !admin && actor == userID {
+		return nil, ErrSelfModification
+	}
+
+	user, err := s.updateUser(ctx, userID, "is_admin", admin)
+	if err != nil {
+		return nil, err
+	}
+
+	action := audit.ActionUserPromote
+	if !admin {
+		action = audit.ActionUserDemote
+	}
+	log.Info().Str("user_id", userID.String()).Bool("admin", admin).Msg("User admin privileges changed")
+	s.auditLog.Record(ctx, actor, action, user.Username, map[string]interface{}{"user_id": userID})
+	return user, nil
+}
+
+// ResetPassword sets a new password for a user without their current one and
+// revokes their tokens. The new password must satisfy the password policy.
+func (s *Service) ResetPassword(ctx context.Context, actor, userID uuid.UUID, newPassword string) error {
+	if err := s.ValidatePassword(ctx, newPassword); err != nil {
+		return err
+	}
+	hashedPassword, err := utils.HashPassword(newPassword, s.config.BCryptCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user, err := s.updateUser(ctx, userID, "password", hashedPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.revokeTokens(ctx, userID); err != nil {
+		return err
+	}
+
+	log.Info().Str("user_id", userID.String()).Msg("User password reset")
+	s.auditLog.Record(ctx, actor, audit.ActionUserPasswordReset, user.Username, map[string]interface{}{"user_id": userID})
+	return nil
+}
+
+// RevokeUserTokens signs a user out everywhere: access tokens already issued
+// are refused, refresh tokens are revoked and API keys are deactivated
+func (s *Service) RevokeUserTokens(ctx context.Context, actor, userID uuid.UUID) error {
+	user, err := s.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.revokeTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Model(&types.APIKey{}).
+		Where("user_id = ? AND is_active = ?", userID, true).
+		Update("is_active", false).Error; err != nil {
+		return fmt.Errorf("failed to revoke API keys: %w", err)
+	}
+
+	log.Info().Str("user_id", userID.String()).Msg("User tokens revoked")
+	s.auditLog.Record(ctx, actor, audit.ActionUserTokensRevoke, user.Username, map[string]interface{}{"user_id": userID})
+	return nil
+}
+
+// updateUser sets a column of a user and returns the updated user, dropping
+// any cached copy so the change applies from the next request
+func (s *Service) updateUser(ctx context.Context, userID uuid.UUID, column string, value interface{}) (*types.User, error) {
+	result := s.db.WithContext(ctx).Model(&types.User{}).Where("id = ?", userID).Update(column, value)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrUserNotFound
+	}
+	s.forgetUser(ctx, userID)
+
+	return s.GetUserByID(ctx, userID)
+}
+
+// revokeTokens refuses the access tokens issued to a user so far and
+// revokes their refresh tokens
+func (s *Service) revokeTokens(ctx context.Context, userID uuid.UUID) error {
+	if err := s.db.WithContext(ctx).Model(&types.User{}).Where("id = ?", userID).
+		Update("tokens_revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	s.forgetUser(ctx, userID)
+	return s.revokeRefreshTokens(ctx, userID)
+}
+
+// revokeRefreshTokens revokes every outstanding refresh token of a user
+func (s *Service) revokeRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	if err := s.db.WithContext(ctx).Model(&types.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// forgetUser drops the copy of a user cached by token validation
+func (s *Service) forgetUser(ctx context.Context, userID uuid.UUID) {
+	if s.cache == nil {
+		return
+	}
+	if err := s.cache.Delete(ctx, fmt.Sprintf("user:%s", userID.String())); err != nil {
+		log.Warn().Err(err).Str("user_id", userID.String()).Msg("Failed to drop cached user")
+	}
+}
+
+// tokenRevoked reports whether a token issued at issuedAt predates the
+// revocation of the user's tokens. Token times have second precision, so
+// tokens issued in the second of the revocation remain valid.
+func tokenRevoked(user *types.User, issuedAt time.Time) bool {
+	return user.TokensRevokedAt != nil && issuedAt.Before(user.TokensRevokedAt.Truncate(time.Second))
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registerTestUser registers a user with the password "original-pass"
+func registerTestUser(t *testing.T, service *Service, username string) *types.User {
+	t.Helper()
+	user, err := service.Register(context.Background(), &types.RegisterRequest{
+		Username: username, Email: username + "@example.com", Password: "original-pass",
+	})
+	require.NoError(t, err)
+	return user
+}
+
+// issuedBefore signs an access token for a user issued a minute ago, before
+// any revocation in the test
+func issuedBefore(t *testing.T, service *Service, userID uuid.UUID) string {
+	t.Helper()
+	issuedAt := time.Now().Add(-time.Minute)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID.String(),
+		"iat":     issuedAt.Unix(),
+		"exp":     issuedAt.Add(time.Hour).Unix(),
+	}).SignedString([]byte(service.config.JWTSecret))
+	require.NoError(t, err)
+	return token
+}
+
+func TestListUsers(t *testing.T) {
+	service, _ := setupTestService(t)
+	for _, name := range []string{"carol", "alice", "bob"} {
+		registerTestUser(t, service, name)
+	}
+
+	users, total, err := service.ListUsers(context.Background(), 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	require.Len(t, users, 2)
+	assert.Equal(t, "alice", users[0].Username)
+	assert.Equal(t, "bob", users[1].Username)
+	assert.Empty(t, users[0].Password)
+
+	users, _, err = service.ListUsers(context.Background(), 2, 2)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	assert.Equal(t, "carol", users[0].Username)
+}
+
+func TestSetUserAdmin(t *testing.T) {
+	service, db := setupTestService(t)
+	ctx := context.Background()
+	admin := registerTestUser(t, service, "admin")
+	user := registerTestUser(t, service, "promoted")
+	auditLog := audit.NewService(db.DB)
+	service.SetAuditLog(auditLog)
+
+	updated, err := service.SetUserAdmin(ctx, admin.ID, user.ID, true)
+	require.NoError(t, err)
+	assert.True(t, updated.IsAdmin)
+
+	stored, err := service.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.IsAdmin)
+
+	updated, err = service.SetUserAdmin(ctx, admin.ID, user.ID, false)
+	require.NoError(t, err)
+	assert.False(t, updated.IsAdmin)
+
+	_, err = service.SetUserAdmin(ctx, admin.ID, admin.ID, false)
+	assert.ErrorIs(t, err, ErrSelfModification)
+	_, err = service.SetUserAdmin(ctx, admin.ID, uuid.New(), true)
+	assert.ErrorIs(t, err, ErrUserNotFound)
+
+	entries, _, err := auditLog.Query(ctx, audit.Filter{ActorID: &admin.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, audit.ActionUserDemote, entries[0].Action)
+	assert.Equal(t, audit.ActionUserPromote, entries[1].Action)
+	assert.Equal(t, "promoted", entries[1].Target)
+}
+
+func TestSetUserActive_DisabledUserLosesAccess(t *testing.T) {
+	service, _ := setupTestService(t)
+	ctx := context.Background()
+	admin := registerTestUser(t, service, "admin")
+	user := registerTestUser(t, service, "disabled")
+
+	token, err := service.Login(ctx, &types.LoginRequest{Username: "disabled", Password: "original-pass"})
+	require.NoError(t, err)
+	_, apiKey, err := service.CreateAPIKey(ctx, user.ID, "ci", nil, nil)
+	require.NoError(t, err)
+
+	updated, err := service.SetUserActive(ctx, admin.ID, user.ID, false)
+	require.NoError(t, err)
+	assert.False(t, updated.IsActive)
+
+	_, err = service.Login(ctx, &types.LoginRequest{Username: "disabled", Password: "original-pass"})
+	assert.Error(t, err)
+	_, err = service.ValidateToken(ctx, token.Token)
+	assert.Error(t, err)
+	_, err = service.Refresh(ctx, token.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, _, err = service.ValidateAPIKey(ctx, apiKey)
+	assert.Error(t, err)
+
+	_, err = service.SetUserActive(ctx, admin.ID, user.ID, true)
+	require.NoError(t, err)
+	_, err = service.Login(ctx, &types.LoginRequest{Username: "disabled", Password: "original-pass"})
+	assert.NoError(t, err)
+
+	_, err = service.SetUserActive(ctx, admin.ID, admin.ID, false)
+	assert.ErrorIs(t, err, ErrSelfModification)
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	service, _ := setupTestService(t)
+	ctx := context.Background()
+	admin := registerTestUser(t, service, "admin")
+	user := registerTestUser(t, service, "revoked")
+
+	token, err := service.Login(ctx, &types.LoginRequest{Username: "revoked", Password: "original-pass"})
+	require.NoError(t, err)
+	_, apiKey, err := service.CreateAPIKey(ctx, user.ID, "ci", nil, nil)
+	require.NoError(t, err)
+	earlier := issuedBefore(t, service, user.ID)
+
+	require.NoError(t, service.RevokeUserTokens(ctx, admin.ID, user.ID))
+
+	_, err = service.ValidateToken(ctx, earlier)
+	assert.Error(t, err)
+	_, err = service.Refresh(ctx, token.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, _, err = service.ValidateAPIKey(ctx, apiKey)
+	assert.Error(t, err)
+
+	// The account itself still works
+	token, err = service.Login(ctx, &types.LoginRequest{Username: "revoked", Password: "original-pass"})
+	require.NoError(t, err)
+	_, err = service.ValidateToken(ctx, token.Token)
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, service.RevokeUserTokens(ctx, admin.ID, uuid.New()), ErrUserNotFound)
+}
+
+func TestResetPassword(t *testing.T) {
+	service, _ := setupTestService(t)
+	ctx := context.Background()
+	admin := registerTestUser(t, service, "admin")
+	user := registerTestUser(t, service, "forgetful")
+	earlier := issuedBefore(t, service, user.ID)
+
+	assert.ErrorIs(t, service.ResetPassword(ctx, admin.ID, user.ID, "short"), ErrPasswordTooShort)
+	require.NoError(t, service.ResetPassword(ctx, admin.ID, user.ID, "replacement-pass"))
+
+	_, err := service.ValidateToken(ctx, earlier)
+	assert.Error(t, err)
+	_, err = service.Login(ctx, &types.LoginRequest{Username: "forgetful", Password: "original-pass"})
+	assert.Error(t, err)
+	_, err = service.Login(ctx, &types.LoginRequest{Username: "forgetful", Password: "replacement-pass"})
+	assert.NoError(t, err)
+}
+
+func TestCreateUser(t *testing.T) {
+	service, _ := setupTestService(t)
+	ctx := context.Background()
+	admin := registerTestUser(t, service, "admin")
+
+	user, err := service.CreateUser(ctx, admin.ID, &types.RegisterRequest{
+		Username: "operator", Email: "operator@example.com", Password: "operator-pass",
+	}, true)
+	require.NoError(t, err)
+	assert.True(t, user.IsAdmin)
+
+	_, err = service.CreateUser(ctx, admin.ID, &types.RegisterRequest{
+		Username: "operator", Email: "other@example.com", Password: "operator-pass",
+	}, false)
+	assert.ErrorIs(t, err, ErrUserExists)
+}
@@ -3,6 +3,7 @@ package common
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,6 +11,9 @@ import (
 	"github.com/lgulliver/lodestone/pkg/config"
 )
 
+// ErrCacheMiss is returned by Get for keys that do not exist
+var ErrCacheMiss = errors.New("key not found")
+
 // Cache wraps Redis client for caching operations
 type Cache struct {
 	client *redis.Client
@@ -49,7 +53,7 @@ func (c *Cache) Get(ctx context.Context, key string, dest interface{}) error {
 	data, err := c.client.Get(ctx, key).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return fmt.Errorf("key not found: %s", key)
+			return fmt.Errorf("%w: %s", ErrCacheMiss, key)
 		}
 		return fmt.Errorf("failed to get value: %w", err)
 	}
@@ -76,11 +80,63 @@ func (c *Cache) SetString(ctx context.Context, key, value string, expiration tim
 	return c.client.Set(ctx, key, value, expiration).Err()
 }
 
+// SetNX stores a string value only if the key does not exist, reporting
+// whether it was stored
+func (c *Cache) SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, value, expiration).Result()
+}
+
+// compareAndDeleteScript deletes a key only if it holds the given value
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// CompareAndDelete removes a string value only if the key still holds it,
+// reporting whether it was removed. Locks are released this way, so a lock
+// that expired and was taken by another holder is left alone.
+func (c *Cache) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	deleted, err := compareAndDeleteScript.Run(ctx, c.client, []string{key}, value).Int()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
 // GetString retrieves a string value
 func (c *Cache) GetString(ctx context.Context, key string) (string, error) {
 	return c.client.Get(ctx, key).Result()
 }
 
+// Increment atomically adds one to a counter and returns the new count. The
+// counter expires after the given duration without increments.
+func (c *Cache) Increment(ctx context.Context, key string, expiration time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	if _, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.Expire(ctx, key, expiration)
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// GetInt retrieves a counter, returning 0 if it does not exist
+func (c *Cache) GetInt(ctx context.Context, key string) (int64, error) {
+	value, err := c.client.Get(ctx, key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return value, err
+}
+
+// Ping checks that Redis is reachable
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
 // Close closes the Redis connection
 func (c *Cache) Close() error {
 	return c.client.Close()
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/lgulliver/lodestone/pkg/config"
@@ -36,3 +37,12 @@ func (db *Database) Close() error {
 	}
 	return sqlDB.Close()
 }
+
+// Ping checks that the database is reachable
+func (db *Database) Ping(ctx context.Context) error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
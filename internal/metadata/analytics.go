@@ -545,7 +545,7 @@ func (s *Service) getFrameworkTargets(ctx context.Context) map[string]int64 {
 			FROM (
 				SELECT jsonb_array_elements_text(metadata->'targetFrameworks') as target
 				FROM artifacts
-				WHERE registry = 'nuget' AND metadata ? 'targetFrameworks'
+				WHERE registry = 'nuget' AND deleted_at IS NULL AND metadata ? 'targetFrameworks'
 			) t
 			GROUP BY target
 			ORDER BY count DESC
@@ -0,0 +1,128 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// ErrPackageNotFound is returned when no versions of a package exist
+var ErrPackageNotFound = errors.New("package not found")
+
+// ErrInvalidStatsPeriod is returned when a statistics period cannot be parsed
+var ErrInvalidStatsPeriod = errors.New("invalid period")
+
+// DefaultStatsPeriodDays is the window of download series when none is given
+const DefaultStatsPeriodDays = 30
+
+// MaxStatsPeriodDays bounds the window of download series
+const MaxStatsPeriodDays = 365
+
+// statsPeriodAliases are the named periods accepted besides a number of days
+var statsPeriodAliases = map[string]int{
+	"week":    7,
+	"month":   30,
+	"quarter": 90,
+	"year":    365,
+}
+
+// ParseStatsPeriod parses a statistics window, either a number of days such
+// as "7d" or a named period such as "month", into a number of days. An empty
+// period is the default window.
+func ParseStatsPeriod(period string) (int, error) {
+	if period == "" {
+		return DefaultStatsPeriodDays, nil
+	}
+	if days, ok := statsPeriodAliases[strings.ToLower(period)]; ok {
+		return days, nil
+	}
+	days, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(period), "d"))
+	if err != nil || days < 1 || days > MaxStatsPeriodDays {
+		return 0, fmt.Errorf("%w %q: use a number of days from 1d to %dd, or week, month, quarter or year", ErrInvalidStatsPeriod, period, MaxStatsPeriodDays)
+	}
+	return days, nil
+}
+
+// GetPackageDownloadSeries returns the downloads of each version of a package
+// per day, over the given number of days up to and including today (UTC).
+// Every version has a bucket for every day, zero when it was not downloaded.
+func (s *Service) GetPackageDownloadSeries(ctx context.Context, registry, name string, days int) (*PackageDownloadSeries, error) {
+	if days < 1 || days > MaxStatsPeriodDays {
+		return nil, fmt.Errorf("%w: %d days", ErrInvalidStatsPeriod, days)
+	}
+
+	var artifacts []types.Artifact
+	if err := s.db.WithContext(ctx).
+		Select("id, name, version").
+		Where("registry = ? AND normalized_name = ?", registry, utils.NormalizePackageName(name, registry)).
+		Order("created_at ASC").
+		Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get package versions: %w", err)
+	}
+	if len(artifacts) == 0 {
+		return nil, fmt.Errorf("%w: %s/%s", ErrPackageNotFound, registry, name)
+	}
+
+	now := time.Now().UTC()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, 0, -(days - 1))
+
+	series := &PackageDownloadSeries{
+		Registry: registry,
+		Name:     artifacts[0].Name,
+		Start:    start,
+		End:      end,
+		Versions: make([]VersionDownloads, len(artifacts)),
+	}
+	versionIndex := make(map[uuid.UUID]int, len(artifacts))
+	artifactIDs := make([]uuid.UUID, len(artifacts))
+	for i, artifact := range artifacts {
+		daily := make([]DailyDownloads, days)
+		for day := range daily {
+			daily[day].Date = start.AddDate(0, 0, day)
+		}
+		series.Versions[i] = VersionDownloads{Version: artifact.Version, Daily: daily}
+		versionIndex[artifact.ID] = i
+		artifactIDs[i] = artifact.ID
+	}
+
+	// Bucket in Go rather than SQL, as day truncation differs between databases
+	rows, err := s.db.WithContext(ctx).
+		Model(&DownloadEvent{}).
+		Select("artifact_id, timestamp").
+		Where("artifact_id IN ? AND timestamp >= ?", artifactIDs, start).
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get download events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var artifactID uuid.UUID
+		var timestamp time.Time
+		if err := rows.Scan(&artifactID, &timestamp); err != nil {
+			return nil, fmt.Errorf("failed to read download event: %w", err)
+		}
+		day := int(timestamp.UTC().Sub(start).Hours() / 24)
+		if day < 0 || day >= days {
+			continue
+		}
+		version := &series.Versions[versionIndex[artifactID]]
+		version.Daily[day].Downloads++
+		version.Total++
+		series.Total++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read download events: %w", err)
+	}
+
+	return series, nil
+}
@@ -0,0 +1,94 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// DefaultReindexBatchSize is how many artifacts are indexed per batch when
+// no batch size is given
+const DefaultReindexBatchSize = 500
+
+// ReindexOptions scopes a search index rebuild
+type ReindexOptions struct {
+	Registry  string // only reindex this registry; empty is every registry
+	BatchSize int    // artifacts loaded per batch; zero is DefaultReindexBatchSize
+}
+
+// ReindexResult summarizes a search index rebuild
+type ReindexResult struct {
+	Registry string `json:"registry,omitempty"`
+	Indexed  int    `json:"indexed"` // artifacts whose entries were rebuilt
+	Removed  int64  `json:"removed"` // stale entries removed
+}
+
+// Reindex rebuilds the search index entries of every published artifact,
+// optionally in one registry, and removes entries left behind by artifacts
+// that were deleted or are no longer published. Entries are upserted one
+// artifact at a time rather than cleared up front, so searches keep working
+// while it runs and running it again is harmless.
+func (s *Service) Reindex(ctx context.Context, opts ReindexOptions) (*ReindexResult, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultReindexBatchSize
+	}
+
+	logger := log.With().Str("registry", opts.Registry).Logger()
+	started := time.Now()
+	result := &ReindexResult{Registry: opts.Registry}
+
+	query := s.db.WithContext(ctx).Model(&types.Artifact{}).
+		Where("status = ?", types.ArtifactStatusPublished)
+	if opts.Registry != "" {
+		query = query.Where("registry = ?", opts.Registry)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count artifacts: %w", err)
+	}
+	logger.Info().Int64("artifacts", total).Msg("Reindexing search index")
+
+	var artifacts []types.Artifact
+	err := query.FindInBatches(&artifacts, batchSize, func(tx *gorm.DB, batch int) error {
+		for i := range artifacts {
+			if err := s.IndexArtifact(ctx, &artifacts[i]); err != nil {
+				return err
+			}
+		}
+		result.Indexed += len(artifacts)
+		logger.Info().Int("batch", batch).Int("indexed", result.Indexed).Int64("artifacts", total).Msg("Reindexed batch")
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to reindex artifacts: %w", err)
+	}
+
+	// Soft-deleted artifacts still have rows, so entries are kept only for
+	// artifacts the query above would have indexed
+	published := s.db.Model(&types.Artifact{}).Select("id").
+		Where("status = ?", types.ArtifactStatusPublished)
+	stale := s.db.WithContext(ctx).Where("artifact_id NOT IN (?)", published)
+	if opts.Registry != "" {
+		stale = stale.Where("registry = ?", opts.Registry)
+	}
+	removed := stale.Delete(&ArtifactIndex{})
+	if removed.Error != nil {
+		return nil, fmt.Errorf("failed to remove stale index entries: %w", removed.Error)
+	}
+	result.Removed = removed.RowsAffected
+
+	logger.Info().
+		Int("indexed", result.Indexed).
+		Int64("removed", result.Removed).
+		Dur("duration", time.Since(started)).
+		Msg("Reindexed search index")
+
+	return result, nil
+}
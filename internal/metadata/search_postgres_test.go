@@ -0,0 +1,106 @@
+package metadata
+
+import (
+	"context"
+	"database/sql"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// setupPostgresTestDB migrates the empty Postgres database named by
+// TEST_DATABASE_URL, rolling the migrations back when the test ends. Tests
+// using it are skipped without one.
+func setupPostgresTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	migrations := os.DirFS("../../cmd/migrate/migrations")
+	files, err := fs.Glob(migrations, "*.sql")
+	require.NoError(t, err)
+	sort.Strings(files)
+
+	conn, err := sql.Open("postgres", dsn)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	var down []string
+	t.Cleanup(func() {
+		for i := len(down) - 1; i >= 0; i-- {
+			_, err := conn.Exec(down[i])
+			assert.NoError(t, err)
+		}
+	})
+	for _, file := range files {
+		content, err := fs.ReadFile(migrations, file)
+		require.NoError(t, err)
+		upSQL, downSQL, _ := strings.Cut(string(content), "-- +migrate Down")
+		_, err = conn.Exec(upSQL)
+		require.NoError(t, err, file)
+		down = append(down, downSQL)
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	return db
+}
+
+func TestSearchArtifacts_FullTextRanking(t *testing.T) {
+	db := setupPostgresTestDB(t)
+	service := NewService(db, &config.Config{})
+	require.True(t, service.fullTextSearch())
+	ctx := context.Background()
+
+	user := createTestUser(t, db)
+	for name, metadata := range map[string]map[string]interface{}{
+		"Logging.Extensions": {"description": "Extensions for structured output"},
+		"zap":                {"keywords": []string{"logging", "fast"}},
+		"tracer":             {"description": "Distributed tracing, with logging of spans"},
+		"yaml":               {"description": "YAML parser"},
+	} {
+		artifact := &types.Artifact{
+			Name:        name,
+			Version:     "1.0.0",
+			Registry:    "npm",
+			PublishedBy: user.ID,
+			Metadata:    metadata,
+			Status:      types.ArtifactStatusPublished,
+		}
+		require.NoError(t, db.Create(artifact).Error)
+	}
+
+	search := func(term string) []string {
+		results, err := service.SearchArtifacts(ctx, &SearchQuery{Query: term, SortBy: "relevance", Page: 1, PerPage: 10})
+		require.NoError(t, err)
+		var names []string
+		for _, artifact := range results.Artifacts {
+			names = append(names, artifact.Name)
+		}
+		return names
+	}
+
+	// Name matches rank above keywords, and keywords above descriptions
+	assert.Equal(t, []string{"Logging.Extensions", "zap", "tracer"}, search("logging"))
+
+	// Words are matched as prefixes and stemmed
+	assert.Equal(t, []string{"Logging.Extensions", "zap", "tracer"}, search("log"))
+	assert.Equal(t, []string{"tracer"}, search("traces"))
+
+	// Every word must match
+	assert.Equal(t, []string{"zap"}, search("fast logging"))
+	assert.Empty(t, search("fast yaml"))
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/lgulliver/lodestone/pkg/config"
 	"github.com/lgulliver/lodestone/pkg/types"
@@ -33,15 +35,28 @@ func (s *Service) SearchArtifacts(ctx context.Context, query *SearchQuery) (*Sea
 	var total int64
 
 	// Build the base query
-	db := s.db.WithContext(ctx).Model(&types.Artifact{})
+	db := s.db.WithContext(ctx).Model(&types.Artifact{}).
+		Where("artifacts.status = ?", types.ArtifactStatusPublished)
+
+	// On Postgres, match the full-text search vector of name, keywords, tags
+	// and description, treating each word of the query as a prefix
+	tsquery := ""
+	if s.fullTextSearch() {
+		tsquery = prefixTSQuery(query.Query)
+	}
 
 	// Apply filters
-	if query.Query != "" {
-		// Search in name, description, and metadata
+	if tsquery != "" {
+		db = db.Where("artifacts.search_vector @@ to_tsquery('english', ?)", tsquery)
+	} else if query.Query != "" {
+		// Search in name, description, and metadata, and in the searchable
+		// text of the search index, which also covers keywords
 		searchTerm := "%" + strings.ToLower(query.Query) + "%"
+		indexed := s.db.Model(&ArtifactIndex{}).Select("artifact_id").
+			Where("LOWER(searchable_text) LIKE ?", searchTerm)
 		db = db.Where(
-			"LOWER(name) LIKE ? OR LOWER(metadata->>'description') LIKE ? OR LOWER(metadata->>'tags') LIKE ?",
-			searchTerm, searchTerm, searchTerm,
+			"LOWER(name) LIKE ? OR LOWER(metadata->>'description') LIKE ? OR LOWER(metadata->>'tags') LIKE ? OR artifacts.id IN (?)",
+			searchTerm, searchTerm, searchTerm, indexed,
 		)
 	}
 
@@ -49,6 +64,10 @@ func (s *Service) SearchArtifacts(ctx context.Context, query *SearchQuery) (*Sea
 		db = db.Where("registry = ?", query.Registry)
 	}
 
+	if len(query.Registries) > 0 {
+		db = db.Where("registry IN ?", query.Registries)
+	}
+
 	if query.Publisher != "" {
 		db = db.Joins("JOIN users ON artifacts.published_by = users.id").
 			Where("users.username = ?", query.Publisher)
@@ -60,10 +79,18 @@ func (s *Service) SearchArtifacts(ctx context.Context, query *SearchQuery) (*Sea
 		}
 	}
 
+	for key, value := range query.Labels {
+		db = db.Where("artifacts.labels->>? = ?", key, value)
+	}
+
 	if query.IsPublic != nil {
 		db = db.Where("is_public = ?", *query.IsPublic)
 	}
 
+	if query.Scope != nil {
+		db = db.Scopes(query.Scope)
+	}
+
 	// Count total results
 	if err := db.Count(&total).Error; err != nil {
 		return nil, fmt.Errorf("failed to count search results: %w", err)
@@ -79,6 +106,12 @@ func (s *Service) SearchArtifacts(ctx context.Context, query *SearchQuery) (*Sea
 		db = db.Order("artifacts.downloads " + query.SortOrder)
 	case "updated_at":
 		db = db.Order("artifacts.updated_at " + query.SortOrder)
+	case "relevance":
+		if tsquery != "" {
+			db = db.Clauses(rankOrder(query.Query, tsquery))
+		} else {
+			db = db.Clauses(relevanceOrder(query.Query))
+		}
 	default:
 		db = db.Order("artifacts.created_at DESC")
 	}
@@ -106,6 +139,57 @@ func (s *Service) SearchArtifacts(ctx context.Context, query *SearchQuery) (*Sea
 	}, nil
 }
 
+// popularityScore is a saturating bonus of up to 20 from an artifact's downloads
+const popularityScore = "(artifacts.downloads * 20.0 / (artifacts.downloads + 100.0))"
+
+// fullTextSearch reports whether the database has the full-text search
+// vector; other databases, such as SQLite in tests, fall back to LIKE
+func (s *Service) fullTextSearch() bool {
+	return s.db.Dialector.Name() == "postgres"
+}
+
+// prefixTSQuery builds a tsquery matching artifacts with every word of the
+// search term, each as a prefix, or "" if the term has no words
+func prefixTSQuery(term string) string {
+	words := strings.FieldsFunc(strings.ToLower(term), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// rankOrder builds an ordering that blends ts_rank, which weighs matches in
+// names above keywords and tags, and those above descriptions, with a bonus
+// for an exact name match and the popularity bonus
+func rankOrder(term, tsquery string) clause.OrderBy {
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL: "(CASE WHEN LOWER(artifacts.name) = ? THEN 100 ELSE 0 END + " +
+			"ts_rank(artifacts.search_vector, to_tsquery('english', ?)) * 100 + " +
+			popularityScore + ") DESC, artifacts.created_at DESC",
+		Vars: []interface{}{strings.ToLower(term), tsquery},
+	}}
+}
+
+// relevanceOrder builds an ordering that blends how closely an artifact's name
+// matches the search term with a saturating popularity bonus from downloads,
+// so an exact name match outranks a popular package that only mentions the term
+func relevanceOrder(term string) clause.OrderBy {
+	if term == "" {
+		return clause.OrderBy{Expression: clause.Expr{SQL: popularityScore + " DESC, artifacts.created_at DESC"}}
+	}
+
+	term = strings.ToLower(term)
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL: "(CASE WHEN LOWER(artifacts.name) = ? THEN 100 " +
+			"WHEN LOWER(artifacts.name) LIKE ? THEN 50 " +
+			"WHEN LOWER(artifacts.name) LIKE ? THEN 25 " +
+			"ELSE 0 END + " + popularityScore + ") DESC, artifacts.created_at DESC",
+		Vars: []interface{}{term, term + "%", "%" + term + "%"},
+	}}
+}
+
 // GetArtifactMetadata retrieves detailed metadata for an artifact
 func (s *Service) GetArtifactMetadata(ctx context.Context, artifactID uuid.UUID) (*ArtifactMetadata, error) {
 	var artifact types.Artifact
@@ -253,7 +337,7 @@ func (s *Service) GetPopularArtifacts(ctx context.Context, registry string, limi
 		db = db.Where("registry = ?", registry)
 	}
 
-	if err := db.Where("is_public = ?", true).
+	if err := db.Where("is_public = ? AND status = ?", true, types.ArtifactStatusPublished).
 		Order("downloads DESC").
 		Limit(limit).
 		Find(&artifacts).Error; err != nil {
@@ -272,7 +356,7 @@ func (s *Service) GetRecentlyUpdated(ctx context.Context, registry string, limit
 		db = db.Where("registry = ?", registry)
 	}
 
-	if err := db.Where("is_public = ?", true).
+	if err := db.Where("is_public = ? AND status = ?", true, types.ArtifactStatusPublished).
 		Order("updated_at DESC").
 		Limit(limit).
 		Find(&artifacts).Error; err != nil {
@@ -42,12 +42,16 @@ type TestDownloadEvent struct {
 	Timestamp  time.Time `gorm:"index"`
 }
 
+func (TestDownloadEvent) TableName() string {
+	return "download_events"
+}
+
 func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
 
 	// Auto migrate tables - note: using simplified types for SQLite compatibility
-	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.PackageOwnership{}, &TestArtifactIndex{}, &TestDownloadEvent{})
+	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{}, &ArtifactIndex{}, &TestArtifactIndex{}, &TestDownloadEvent{})
 	require.NoError(t, err)
 
 	return db
@@ -366,6 +370,65 @@ func TestRemoveFromIndex_Success(t *testing.T) {
 	assert.Equal(t, gorm.ErrRecordNotFound, err)
 }
 
+func TestReindex(t *testing.T) {
+	service, db := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	leftPad := createTestArtifact(t, db, "left-pad", "npm", user, map[string]interface{}{
+		"keywords": []interface{}{"padding", "strings"},
+	})
+	createTestArtifact(t, db, "Humanizer", "nuget", user, map[string]interface{}{
+		"tags": "strings,formatting",
+	})
+	removed := createTestArtifact(t, db, "right-pad", "npm", user, map[string]interface{}{
+		"keywords": []interface{}{"padding"},
+	})
+	require.NoError(t, service.IndexArtifact(ctx, removed))
+	require.NoError(t, db.Delete(removed).Error)
+
+	search := func(term string) []string {
+		results, err := service.SearchArtifacts(ctx, &SearchQuery{Query: term, Page: 1, PerPage: 10})
+		require.NoError(t, err)
+		var names []string
+		for _, artifact := range results.Artifacts {
+			names = append(names, artifact.Name)
+		}
+		return names
+	}
+
+	// Keywords are only searchable through the index
+	assert.Empty(t, search("padding"))
+
+	result, err := service.Reindex(ctx, ReindexOptions{Registry: "npm", BatchSize: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Indexed)
+	assert.Equal(t, int64(1), result.Removed, "the deleted artifact's entry is removed")
+	assert.Equal(t, []string{"left-pad"}, search("padding"))
+	assert.Equal(t, []string{"Humanizer"}, search("formatting"), "matched by its tags, not the index")
+
+	var index ArtifactIndex
+	require.NoError(t, db.Where("artifact_id = ?", leftPad.ID).First(&index).Error)
+	assert.Equal(t, []string{"padding", "strings"}, index.Keywords)
+
+	// Reindexing everything again leaves one entry per artifact
+	result, err = service.Reindex(ctx, ReindexOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Indexed)
+	assert.Zero(t, result.Removed)
+	var entries int64
+	require.NoError(t, db.Model(&ArtifactIndex{}).Count(&entries).Error)
+	assert.Equal(t, int64(2), entries)
+	assert.ElementsMatch(t, []string{"left-pad", "Humanizer"}, search("strings"))
+
+	// A cleared index is rebuilt
+	require.NoError(t, db.Where("1 = 1").Delete(&ArtifactIndex{}).Error)
+	assert.Empty(t, search("padding"))
+	_, err = service.Reindex(ctx, ReindexOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"left-pad"}, search("padding"))
+}
+
 func TestGetDownloadStats_Success(t *testing.T) {
 	service, db := setupTestService(t)
 	user := createTestUser(t, db)
@@ -442,3 +505,184 @@ func TestGetRecentlyUpdated_Success(t *testing.T) {
 	assert.Equal(t, "recent-package", artifacts[0].Name)
 	assert.Equal(t, "old-package", artifacts[1].Name)
 }
+
+func TestSearchArtifacts_AcrossRegistries(t *testing.T) {
+	service, db := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	createTestArtifact(t, db, "logging", "npm", user, map[string]interface{}{})
+	createTestArtifact(t, db, "Logging.Extensions", "nuget", user, map[string]interface{}{})
+	createTestArtifact(t, db, "structured-logging", "cargo", user, map[string]interface{}{})
+	createTestArtifact(t, db, "unrelated", "npm", user, map[string]interface{}{})
+
+	query := &SearchQuery{
+		Query:   "logging",
+		SortBy:  "relevance",
+		Page:    1,
+		PerPage: 10,
+	}
+
+	results, err := service.SearchArtifacts(ctx, query)
+
+	assert.NoError(t, err)
+	require.Len(t, results.Artifacts, 3)
+	assert.Equal(t, "logging", results.Artifacts[0].Name)
+	assert.Equal(t, "npm", results.Artifacts[0].Registry)
+	assert.Equal(t, "Logging.Extensions", results.Artifacts[1].Name)
+	assert.Equal(t, "nuget", results.Artifacts[1].Registry)
+	assert.Equal(t, "structured-logging", results.Artifacts[2].Name)
+	assert.Equal(t, "cargo", results.Artifacts[2].Registry)
+}
+
+func TestSearchArtifacts_RelevanceBlendsPopularity(t *testing.T) {
+	service, db := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	quiet := createTestArtifact(t, db, "http-client", "npm", user, map[string]interface{}{})
+	popular := createTestArtifact(t, db, "http-server", "nuget", user, map[string]interface{}{})
+	db.Model(quiet).Update("downloads", 5)
+	db.Model(popular).Update("downloads", 5000)
+
+	query := &SearchQuery{
+		Query:   "http",
+		SortBy:  "relevance",
+		Page:    1,
+		PerPage: 10,
+	}
+
+	results, err := service.SearchArtifacts(ctx, query)
+
+	assert.NoError(t, err)
+	require.Len(t, results.Artifacts, 2)
+	assert.Equal(t, "http-server", results.Artifacts[0].Name)
+	assert.Equal(t, "http-client", results.Artifacts[1].Name)
+}
+
+func TestSearchArtifacts_FilterByRegistrySubset(t *testing.T) {
+	service, db := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	createTestArtifact(t, db, "json-npm", "npm", user, map[string]interface{}{})
+	createTestArtifact(t, db, "json-nuget", "nuget", user, map[string]interface{}{})
+	createTestArtifact(t, db, "json-cargo", "cargo", user, map[string]interface{}{})
+
+	query := &SearchQuery{
+		Query:      "json",
+		Registries: []string{"npm", "cargo"},
+		SortBy:     "name",
+		SortOrder:  "ASC",
+		Page:       1,
+		PerPage:    10,
+	}
+
+	results, err := service.SearchArtifacts(ctx, query)
+
+	assert.NoError(t, err)
+	require.Len(t, results.Artifacts, 2)
+	assert.Equal(t, "json-cargo", results.Artifacts[0].Name)
+	assert.Equal(t, "json-npm", results.Artifacts[1].Name)
+	assert.Equal(t, int64(2), results.Pagination.Total)
+}
+
+func TestSearchArtifacts_LikeFallback(t *testing.T) {
+	service, db := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	// SQLite has no search vector, so substrings of words still match
+	require.False(t, service.fullTextSearch())
+	createTestArtifact(t, db, "http-client", "npm", user, map[string]interface{}{})
+	createTestArtifact(t, db, "websocket", "npm", user, map[string]interface{}{"description": "Streams over HTTP upgrades"})
+	createTestArtifact(t, db, "yaml", "npm", user, map[string]interface{}{})
+
+	query := &SearchQuery{
+		Query:   "ttp",
+		SortBy:  "relevance",
+		Page:    1,
+		PerPage: 10,
+	}
+
+	results, err := service.SearchArtifacts(ctx, query)
+
+	require.NoError(t, err)
+	require.Len(t, results.Artifacts, 2)
+	assert.Equal(t, "http-client", results.Artifacts[0].Name)
+	assert.Equal(t, "websocket", results.Artifacts[1].Name)
+}
+
+func TestPrefixTSQuery(t *testing.T) {
+	assert.Equal(t, "http:* & client:*", prefixTSQuery("HTTP client"))
+	assert.Equal(t, "scope:* & left:* & pad:*", prefixTSQuery("@scope/left-pad"))
+	assert.Equal(t, "it:* & s:* & fine:*", prefixTSQuery("it's fine! | !"))
+	assert.Equal(t, "", prefixTSQuery("&|!()"))
+}
+
+func TestGetPackageDownloadSeries(t *testing.T) {
+	service, db := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	first := createTestArtifact(t, db, "Left-Pad", "npm", user, map[string]interface{}{})
+	second := &types.Artifact{Name: "Left-Pad", Version: "1.1.0", Registry: "npm", PublishedBy: user.ID, CreatedAt: time.Now().Add(time.Hour)}
+	require.NoError(t, db.Create(second).Error)
+	other := createTestArtifact(t, db, "right-pad", "npm", user, map[string]interface{}{})
+
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	download := func(artifact *types.Artifact, at time.Time) {
+		require.NoError(t, db.Create(&TestDownloadEvent{ArtifactID: artifact.ID.String(), Timestamp: at}).Error)
+	}
+	download(first, today.AddDate(0, 0, -2).Add(time.Hour))
+	download(first, today.AddDate(0, 0, -2).Add(23*time.Hour))
+	download(first, today.Add(time.Minute))
+	download(second, today.Add(2*time.Minute))
+	download(first, today.AddDate(0, 0, -10)) // outside the window
+	download(other, today.Add(time.Minute))
+
+	series, err := service.GetPackageDownloadSeries(ctx, "npm", "left-pad", 7)
+	require.NoError(t, err)
+	assert.Equal(t, "Left-Pad", series.Name)
+	assert.Equal(t, today.AddDate(0, 0, -6), series.Start)
+	assert.Equal(t, today, series.End)
+	assert.Equal(t, int64(4), series.Total)
+
+	daily := func(version VersionDownloads) []int64 {
+		counts := make([]int64, len(version.Daily))
+		for i, day := range version.Daily {
+			assert.Equal(t, series.Start.AddDate(0, 0, i), day.Date)
+			counts[i] = day.Downloads
+		}
+		return counts
+	}
+	require.Len(t, series.Versions, 2)
+	assert.Equal(t, "1.0.0", series.Versions[0].Version)
+	assert.Equal(t, int64(3), series.Versions[0].Total)
+	assert.Equal(t, []int64{0, 0, 0, 0, 2, 0, 1}, daily(series.Versions[0]))
+	assert.Equal(t, "1.1.0", series.Versions[1].Version)
+	assert.Equal(t, []int64{0, 0, 0, 0, 0, 0, 1}, daily(series.Versions[1]))
+
+	// Days without downloads are zero buckets
+	series, err = service.GetPackageDownloadSeries(ctx, "npm", "right-pad", 30)
+	require.NoError(t, err)
+	require.Len(t, series.Versions[0].Daily, 30)
+	assert.Equal(t, int64(1), series.Versions[0].Daily[29].Downloads)
+	assert.Equal(t, int64(0), series.Versions[0].Daily[0].Downloads)
+
+	_, err = service.GetPackageDownloadSeries(ctx, "npm", "missing", 7)
+	assert.ErrorIs(t, err, ErrPackageNotFound)
+}
+
+func TestParseStatsPeriod(t *testing.T) {
+	for period, expected := range map[string]int{"": DefaultStatsPeriodDays, "7d": 7, "90": 90, "Month": 30, "year": 365} {
+		days, err := ParseStatsPeriod(period)
+		require.NoError(t, err, period)
+		assert.Equal(t, expected, days, period)
+	}
+	for _, period := range []string{"0d", "366d", "fortnight", "-1d"} {
+		_, err := ParseStatsPeriod(period)
+		assert.ErrorIs(t, err, ErrInvalidStatsPeriod, period)
+	}
+}
@@ -5,19 +5,23 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"gorm.io/gorm"
 )
 
 // SearchQuery represents a search request
 type SearchQuery struct {
-	Query     string   `json:"query"`                    // Search term
-	Registry  string   `json:"registry"`                 // Filter by registry type
-	Publisher string   `json:"publisher"`                // Filter by publisher username
-	Tags      []string `json:"tags"`                     // Filter by tags
-	IsPublic  *bool    `json:"is_public"`               // Filter by visibility
-	SortBy    string   `json:"sort_by"`                 // Sort field: name, created_at, downloads, updated_at
-	SortOrder string   `json:"sort_order"`              // Sort order: asc, desc
-	Page      int      `json:"page"`                    // Page number (1-based)
-	PerPage   int      `json:"per_page"`                // Items per page
+	Query      string            `json:"query"`      // Search term
+	Registry   string            `json:"registry"`   // Filter by registry type
+	Registries []string          `json:"registries"` // Filter by a subset of registry types
+	Publisher  string            `json:"publisher"`  // Filter by publisher username
+	Tags       []string          `json:"tags"`       // Filter by tags
+	Labels     map[string]string `json:"labels"`     // Filter by labels, which must all match
+	IsPublic   *bool             `json:"is_public"`  // Filter by visibility
+	Scope      func(*gorm.DB) *gorm.DB `json:"-"`   // Further limits the artifacts searched, such as to those the caller can read
+	SortBy     string            `json:"sort_by"`    // Sort field: name, created_at, downloads, updated_at, relevance
+	SortOrder  string            `json:"sort_order"` // Sort order: asc, desc
+	Page       int               `json:"page"`       // Page number (1-based)
+	PerPage    int               `json:"per_page"`   // Items per page
 }
 
 // SearchResults represents search response
@@ -52,6 +56,25 @@ type DailyDownloads struct {
 	Downloads int64     `json:"downloads"`
 }
 
+// PackageDownloadSeries is the daily downloads of each version of a package
+// over a window of days
+type PackageDownloadSeries struct {
+	Registry string             `json:"registry"`
+	Name     string             `json:"name"`
+	Start    time.Time          `json:"start"`
+	End      time.Time          `json:"end"`
+	Total    int64              `json:"total"`
+	Versions []VersionDownloads `json:"versions"`
+}
+
+// VersionDownloads is the daily downloads of a package version, with a
+// bucket for every day of the window
+type VersionDownloads struct {
+	Version string           `json:"version"`
+	Total   int64            `json:"total"`
+	Daily   []DailyDownloads `json:"daily"`
+}
+
 // Dependency represents a package dependency
 type Dependency struct {
 	Name         string `json:"name"`
@@ -88,15 +111,15 @@ type QualityMetrics struct {
 
 // ArtifactIndex represents a search index entry
 type ArtifactIndex struct {
-	ID             uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ID             uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
 	ArtifactID     uuid.UUID `json:"artifact_id" gorm:"type:uuid;uniqueIndex;not null"`
 	Name           string    `json:"name" gorm:"index;not null"`
 	Registry       string    `json:"registry" gorm:"index;not null"`
 	SearchableText string    `json:"searchable_text" gorm:"type:text"`
-	Tags           []string  `json:"tags" gorm:"type:jsonb"`
+	Tags           []string  `json:"tags" gorm:"type:jsonb;serializer:json"`
 	Description    string    `json:"description" gorm:"type:text"`
 	Author         string    `json:"author" gorm:"index"`
-	Keywords       []string  `json:"keywords" gorm:"type:jsonb"`
+	Keywords       []string  `json:"keywords" gorm:"type:jsonb;serializer:json"`
 	UpdatedAt      time.Time `json:"updated_at"`
 	CreatedAt      time.Time `json:"created_at"`
 }
@@ -106,6 +129,14 @@ func (ArtifactIndex) TableName() string {
 	return "artifact_indices"
 }
 
+// BeforeCreate generates a UUID for the index entry ID
+func (i *ArtifactIndex) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
 // DownloadEvent represents a download event for analytics
 type DownloadEvent struct {
 	ID         uuid.UUID `json:"id" gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
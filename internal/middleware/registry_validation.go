@@ -78,6 +78,8 @@ func extractRegistryType(c *gin.Context) string {
 		"/v1/rubygems": "rubygems",
 		"/v1/opa":      "opa",
 		"/v1/go":       "go",
+		"/v1/debian":   "debian",
+		"/v1/rpm":      "rpm",
 		"/v2/":         "docker", // Docker registry v2 API
 	}
 
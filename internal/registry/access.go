@@ -0,0 +1,181 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// Access sources explaining why a user holds access to a package
+const (
+	AccessSourceAdmin        = "admin"
+	AccessSourceApprover     = "approver"
+	AccessSourceOrganization = "organization"
+)
+
+// UserAccess is the effective access one user holds on a package
+type UserAccess struct {
+	UserID       uuid.UUID `json:"user_id"`
+	Username     string    `json:"username"`
+	Active       bool      `json:"active"`
+	Sources      []string  `json:"sources"` // admin, owner, maintainer, contributor, organization, approver
+	Download     bool      `json:"download"`
+	Publish      bool      `json:"publish"`
+	Delete       bool      `json:"delete"`
+	ManageOwners bool      `json:"manage_owners"`
+	Approve      bool      `json:"approve"`
+}
+
+// ArtifactAccess describes who can download or publish a package. Users lists
+// everyone holding access beyond what any authenticated user has.
+type ArtifactAccess struct {
+	Registry     string `json:"registry"`
+	Name         string `json:"name"`
+	Organization string `json:"organization,omitempty"` // owner of the package's namespace
+
+	// Public reflects the visibility recorded on the package's versions. Any
+	// authenticated user downloads public packages; restricted ones only
+	// their publishers, the users holding a role on them, members of the
+	// owning organization and administrators. Downloads always require
+	// authentication, so anonymous clients have no access either way.
+	Public                  bool `json:"public"`
+	AnonymousDownload       bool `json:"anonymous_download"`
+	AuthenticatedDownload   bool `json:"authenticated_download"`
+	AuthenticatedPublish    bool `json:"authenticated_publish"` // no owners or organization yet, so the first publisher claims it
+	RequireApproval         bool `json:"require_approval"`
+	PendingApprovalVersions int  `json:"pending_approval_versions"`
+
+	Users []*UserAccess `json:"users"`
+}
+
+// GetArtifactAccess computes the effective access to a package from
+// administrator status, package ownership, membership of the organization
+// owning its namespace and registry approver permissions, mirroring the
+// checks made by OwnershipService and CanUserApprove.
+func (s *Service) GetArtifactAccess(ctx context.Context, registryType, name string) (*ArtifactAccess, error) {
+	var artifacts []types.Artifact
+	if err := s.DB.WithContext(ctx).
+		Where("registry = ? AND name = ?", registryType, name).
+		Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get package versions: %w", err)
+	}
+
+	var ownerships []types.PackageOwnership
+	if err := s.DB.WithContext(ctx).Preload("User").
+		Where("package_key = ?", generatePackageKey(registryType, name)).
+		Find(&ownerships).Error; err != nil {
+		return nil, fmt.Errorf("failed to get package owners: %w", err)
+	}
+
+	if len(artifacts) == 0 && len(ownerships) == 0 {
+		return nil, ErrPackageNotFound
+	}
+
+	org, err := s.Organizations.ForPackage(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+
+	access := &ArtifactAccess{
+		Registry:             registryType,
+		Name:                 name,
+		AuthenticatedPublish: len(ownerships) == 0 && org == nil,
+	}
+	for _, artifact := range artifacts {
+		if artifact.IsPublic {
+			access.Public = true
+		}
+		if artifact.Status == types.ArtifactStatusPendingApproval {
+			access.PendingApprovalVersions++
+		}
+	}
+	access.AuthenticatedDownload = access.Public
+
+	var setting types.RegistrySetting
+	if err := s.DB.WithContext(ctx).Where("registry_name = ?", registryType).Find(&setting).Error; err != nil {
+		return nil, fmt.Errorf("failed to get registry setting: %w", err)
+	}
+	access.RequireApproval = setting.RequireApproval
+
+	users := make(map[uuid.UUID]*UserAccess)
+	entry := func(user types.User) *UserAccess {
+		if existing, ok := users[user.ID]; ok {
+			return existing
+		}
+		created := &UserAccess{UserID: user.ID, Username: user.Username, Active: user.IsActive}
+		users[user.ID] = created
+		return created
+	}
+
+	var admins []types.User
+	if err := s.DB.WithContext(ctx).Where("is_admin = ?", true).Find(&admins).Error; err != nil {
+		return nil, fmt.Errorf("failed to get administrators: %w", err)
+	}
+	for _, admin := range admins {
+		user := entry(admin)
+		user.Sources = append(user.Sources, AccessSourceAdmin)
+		user.Download, user.Publish, user.Delete, user.ManageOwners, user.Approve = true, true, true, true, true
+	}
+
+	for _, ownership := range ownerships {
+		user := entry(ownership.User)
+		user.Sources = append(user.Sources, ownership.Role)
+		user.Download = true
+		switch ownership.Role {
+		case RoleOwner:
+			user.Publish, user.Delete, user.ManageOwners = true, true, true
+		case RoleMaintainer:
+			user.Publish = true
+		}
+	}
+
+	if org != nil {
+		access.Organization = org.Name
+		members, err := s.Organizations.Members(ctx, org.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			user := entry(member.User)
+			user.Sources = append(user.Sources, AccessSourceOrganization)
+			user.Download = true
+			switch member.Role {
+			case RoleOwner:
+				user.Publish, user.Delete, user.ManageOwners = true, true, true
+			case RoleMaintainer:
+				user.Publish = true
+			}
+		}
+	}
+
+	var approvers []types.Permission
+	if err := s.DB.WithContext(ctx).Preload("User").
+		Where("resource = ? AND action = ?", "registry:"+registryType, PermissionActionApprove).
+		Find(&approvers).Error; err != nil {
+		return nil, fmt.Errorf("failed to get approvers: %w", err)
+	}
+	for _, permission := range approvers {
+		user := entry(permission.User)
+		user.Sources = append(user.Sources, AccessSourceApprover)
+		user.Approve = true
+	}
+
+	access.Users = make([]*UserAccess, 0, len(users))
+	for _, user := range users {
+		// Inactive users cannot authenticate, so they hold no effective access
+		if user.Active {
+			user.Download = user.Download || access.Public
+		} else {
+			user.Download, user.Publish, user.Delete, user.ManageOwners, user.Approve = false, false, false, false, false
+		}
+		access.Users = append(access.Users, user)
+	}
+	sort.Slice(access.Users, func(i, j int) bool {
+		return access.Users[i].Username < access.Users[j].Username
+	})
+
+	return access, nil
+}
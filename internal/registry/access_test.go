@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createAccessTestUser creates an active user with the given username
+func createAccessTestUser(t *testing.T, db *common.Database, username string, isAdmin bool) *types.User {
+	user := &types.User{
+		Username: username,
+		Email:    username + "@example.com",
+		Password: "hashedpassword",
+		IsActive: true,
+		IsAdmin:  isAdmin,
+	}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+// accessFor returns the access entry for a username, if listed
+func accessFor(access *ArtifactAccess, username string) *UserAccess {
+	for _, user := range access.Users {
+		if user.Username == username {
+			return user
+		}
+	}
+	return nil
+}
+
+func TestGetArtifactAccess(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	ctx := context.Background()
+
+	admin := createAccessTestUser(t, db, "admin", true)
+	owner := createAccessTestUser(t, db, "owner", false)
+	maintainer := createAccessTestUser(t, db, "maintainer", false)
+	contributor := createAccessTestUser(t, db, "contributor", false)
+	approver := createAccessTestUser(t, db, "approver", false)
+	departed := createAccessTestUser(t, db, "departed", false)
+	createAccessTestUser(t, db, "bystander", false)
+	require.NoError(t, db.Model(departed).Update("is_active", false).Error)
+
+	require.NoError(t, db.Create(&types.Artifact{
+		Name: "widget", Version: "1.0.0", Registry: "npm", StoragePath: "npm/widget/1.0.0",
+		PublishedBy: owner.ID, IsPublic: true, Status: types.ArtifactStatusPublished,
+	}).Error)
+	require.NoError(t, db.Create(&types.Artifact{
+		Name: "widget", Version: "1.1.0", Registry: "npm", StoragePath: "npm/widget/1.1.0",
+		PublishedBy: maintainer.ID, Status: types.ArtifactStatusPendingApproval,
+	}).Error)
+	require.NoError(t, db.Model(&types.RegistrySetting{}).Where("registry_name = ?", "npm").Update("require_approval", true).Error)
+
+	for user, role := range map[*types.User]string{owner: RoleOwner, maintainer: RoleMaintainer, contributor: RoleContributor, departed: RoleOwner} {
+		require.NoError(t, db.Create(&types.PackageOwnership{
+			PackageKey: "npm:widget", UserID: user.ID, Role: role, GrantedBy: owner.ID, GrantedAt: time.Now(),
+		}).Error)
+	}
+	require.NoError(t, db.Create(&types.Permission{
+		UserID: approver.ID, Resource: "registry:npm", Action: PermissionActionApprove, GrantedBy: admin.ID,
+	}).Error)
+	// Approvers of other registries and owners of other packages are not listed
+	require.NoError(t, db.Create(&types.Permission{
+		UserID: contributor.ID, Resource: "registry:nuget", Action: PermissionActionApprove, GrantedBy: admin.ID,
+	}).Error)
+	require.NoError(t, db.Create(&types.PackageOwnership{
+		PackageKey: "npm:other", UserID: approver.ID, Role: RoleOwner, GrantedBy: approver.ID, GrantedAt: time.Now(),
+	}).Error)
+
+	access, err := service.GetArtifactAccess(ctx, "npm", "widget")
+	require.NoError(t, err)
+
+	assert.True(t, access.Public)
+	assert.False(t, access.AnonymousDownload)
+	assert.True(t, access.AuthenticatedDownload)
+	assert.False(t, access.AuthenticatedPublish)
+	assert.True(t, access.RequireApproval)
+	assert.Equal(t, 1, access.PendingApprovalVersions)
+
+	usernames := make([]string, 0, len(access.Users))
+	for _, user := range access.Users {
+		usernames = append(usernames, user.Username)
+	}
+	assert.Equal(t, []string{"admin", "approver", "contributor", "departed", "maintainer", "owner"}, usernames)
+
+	tests := []struct {
+		username                                      string
+		sources                                       []string
+		download, publish, delete, manage, canApprove bool
+	}{
+		{"admin", []string{AccessSourceAdmin}, true, true, true, true, true},
+		{"owner", []string{RoleOwner}, true, true, true, true, false},
+		{"maintainer", []string{RoleMaintainer}, true, true, false, false, false},
+		{"contributor", []string{RoleContributor}, true, false, false, false, false},
+		{"approver", []string{AccessSourceApprover}, true, false, false, false, true},
+		{"departed", []string{RoleOwner}, false, false, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			user := accessFor(access, tt.username)
+			require.NotNil(t, user)
+			assert.Equal(t, tt.sources, user.Sources)
+			assert.Equal(t, tt.download, user.Download, "download")
+			assert.Equal(t, tt.publish, user.Publish, "publish")
+			assert.Equal(t, tt.delete, user.Delete, "delete")
+			assert.Equal(t, tt.manage, user.ManageOwners, "manage owners")
+			assert.Equal(t, tt.canApprove, user.Approve, "approve")
+		})
+	}
+
+	// The report agrees with the checks enforced on publish and delete
+	for _, user := range []*types.User{owner, maintainer, contributor, approver} {
+		canPublish, err := service.Ownership.CanUserPublish(ctx, "npm", "widget", user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, canPublish, accessFor(access, user.Username).Publish, user.Username)
+
+		canDelete, err := service.Ownership.CanUserDelete(ctx, "npm", "widget", user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, canDelete, accessFor(access, user.Username).Delete, user.Username)
+	}
+}
+
+func TestGetArtifactAccess_Unowned(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	publisher := createAccessTestUser(t, db, "publisher", false)
+
+	require.NoError(t, db.Create(&types.Artifact{
+		Name: "orphan", Version: "1.0.0", Registry: "npm", StoragePath: "npm/orphan/1.0.0",
+		PublishedBy: publisher.ID, Status: types.ArtifactStatusPublished,
+	}).Error)
+
+	access, err := service.GetArtifactAccess(context.Background(), "npm", "orphan")
+	require.NoError(t, err)
+
+	// Without owners any authenticated user may publish and claim the package
+	assert.False(t, access.Public)
+	assert.True(t, access.AuthenticatedPublish)
+	assert.False(t, access.RequireApproval)
+	assert.Empty(t, access.Users)
+}
+
+func TestGetArtifactAccess_NotFound(t *testing.T) {
+	service, _, _ := setupTestService(t)
+
+	_, err := service.GetArtifactAccess(context.Background(), "npm", "missing")
+	assert.ErrorIs(t, err, ErrPackageNotFound)
+}
@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// PermissionActionApprove is the permission action that lets a user approve
+// publishes for a registry (resource "registry:<type>")
+const PermissionActionApprove = "approve"
+
+// Approval event types sent to the ApprovalNotifier
+const (
+	ApprovalEventSubmitted = "publish.pending-approval"
+	ApprovalEventApproved  = "publish.approved"
+	ApprovalEventRejected  = "publish.rejected"
+)
+
+var (
+	// ErrApprovalNotFound is returned when no pending artifact matches the request
+	ErrApprovalNotFound = errors.New("pending artifact not found")
+
+	// ErrApprovalForbidden is returned when the user does not hold the approver role
+	ErrApprovalForbidden = errors.New("user is not an approver for this registry")
+
+	// ErrSelfApproval is returned when the publisher tries to approve or reject their own upload
+	ErrSelfApproval = errors.New("publishers cannot review their own uploads")
+
+	// ErrApprovalRegistryUnavailable is returned when the artifact's registry is disabled or read-only
+	ErrApprovalRegistryUnavailable = errors.New("registry is disabled or read-only")
+)
+
+// ApprovalEvent describes a change in the approval state of an artifact
+type ApprovalEvent struct {
+	Type     string          `json:"type"`
+	Artifact *types.Artifact `json:"artifact"`
+	Actor    uuid.UUID       `json:"actor"`
+	Reason   string          `json:"reason,omitempty"`
+}
+
+// ApprovalNotifier is notified when artifacts enter or leave the approval queue
+type ApprovalNotifier interface {
+	NotifyApproval(ctx context.Context, event ApprovalEvent)
+}
+
+// logApprovalNotifier records approval events in the service log
+type logApprovalNotifier struct{}
+
+// NotifyApproval logs the approval event
+func (logApprovalNotifier) NotifyApproval(ctx context.Context, event ApprovalEvent) {
+	log.Info().
+		Str("event", event.Type).
+		Str("registry", event.Artifact.Registry).
+		Str("name", event.Artifact.Name).
+		Str("version", event.Artifact.Version).
+		Str("actor", event.Actor.String()).
+		Str("reason", event.Reason).
+		Msg("Publish approval event")
+}
+
+// SetApprovalNotifier replaces the notifier used for approval events
+func (s *Service) SetApprovalNotifier(notifier ApprovalNotifier) {
+	if notifier == nil {
+		notifier = logApprovalNotifier{}
+	}
+	s.approvalNotifier = notifier
+}
+
+// notifyApproval sends an approval event to the configured notifier
+func (s *Service) notifyApproval(ctx context.Context, eventType string, artifact *types.Artifact, actor uuid.UUID, reason string) {
+	notifier := s.approvalNotifier
+	if notifier == nil {
+		notifier = logApprovalNotifier{}
+	}
+	notifier.NotifyApproval(ctx, ApprovalEvent{
+		Type:     eventType,
+		Artifact: artifact,
+		Actor:    actor,
+		Reason:   reason,
+	})
+}
+
+// CanUserApprove checks if a user may approve publishes to a registry. Admins
+// and users granted the approve permission on the registry are approvers.
+func (s *Service) CanUserApprove(ctx context.Context, registryType string, userID uuid.UUID) (bool, error) {
+	var user types.User
+	if err := s.DB.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user.IsAdmin {
+		return true, nil
+	}
+
+	var count int64
+	if err := s.DB.WithContext(ctx).Model(&types.Permission{}).
+		Where("user_id = ? AND resource = ? AND action = ?", userID, "registry:"+registryType, PermissionActionApprove).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check approver permission: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// ListPendingApprovals returns artifacts awaiting approval, optionally limited to one registry
+func (s *Service) ListPendingApprovals(ctx context.Context, registryType string) ([]*types.Artifact, error) {
+	query := s.DB.WithContext(ctx).Where("status = ?", types.ArtifactStatusPendingApproval)
+	if registryType != "" {
+		query = query.Where("registry = ?", registryType)
+	}
+
+	var artifacts []*types.Artifact
+	if err := query.Preload("Publisher").Order("created_at").Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list pending artifacts: %w", err)
+	}
+
+	return artifacts, nil
+}
+
+// ApproveArtifact publishes a pending artifact so it becomes downloadable
+func (s *Service) ApproveArtifact(ctx context.Context, artifactID, approverID uuid.UUID) (*types.Artifact, error) {
+	artifact, err := s.getPendingArtifactForReview(ctx, artifactID, approverID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.recordPublishedVersion(ctx, artifact); err != nil {
+		return nil, err
+	}
+	if err := s.DB.WithContext(ctx).Model(artifact).
+		Update("status", types.ArtifactStatusPublished).Error; err != nil {
+		return nil, fmt.Errorf("failed to approve artifact: %w", err)
+	}
+	artifact.Status = types.ArtifactStatusPublished
+
+	log.Info().
+		Str("registry", artifact.Registry).
+		Str("name", artifact.Name).
+		Str("version", artifact.Version).
+		Str("approved_by", approverID.String()).
+		Msg("artifact approved")
+
+	s.indexArtifact(artifact)
+	s.storeReadmeFromStorage(ctx, artifact)
+	s.notifyApproval(ctx, ApprovalEventApproved, artifact, approverID, "")
+	s.notifyEvent(ctx, EventPackagePublished, artifact, approverID)
+	s.auditLog.Record(ctx, approverID, audit.ActionPackageApprove, audit.PackageTarget(artifact.Registry, artifact.Name, artifact.Version), nil)
+	return artifact, nil
+}
+
+// RejectArtifact removes a pending artifact from storage and the database
+func (s *Service) RejectArtifact(ctx context.Context, artifactID, approverID uuid.UUID, reason string) error {
+	artifact, err := s.getPendingArtifactForReview(ctx, artifactID, approverID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.removeArtifact(ctx, artifact); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("registry", artifact.Registry).
+		Str("name", artifact.Name).
+		Str("version", artifact.Version).
+		Str("rejected_by", approverID.String()).
+		Str("reason", reason).
+		Msg("artifact rejected")
+
+	s.notifyApproval(ctx, ApprovalEventRejected, artifact, approverID, reason)
+	s.auditLog.Record(ctx, approverID, audit.ActionPackageReject, audit.PackageTarget(artifact.Registry, artifact.Name, artifact.Version), map[string]interface{}{
+		"reason": reason,
+	})
+	return nil
+}
+
+// getPendingArtifactForReview loads a pending artifact and checks that the
+// reviewer is an approver other than the publisher
+func (s *Service) getPendingArtifactForReview(ctx context.Context, artifactID, reviewerID uuid.UUID) (*types.Artifact, error) {
+	var artifact types.Artifact
+	if err := s.DB.WithContext(ctx).
+		Where("id = ? AND status = ?", artifactID, types.ArtifactStatusPendingApproval).
+		First(&artifact).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrApprovalNotFound
+		}
+		return nil, fmt.Errorf("failed to get artifact: %w", err)
+	}
+
+	// Reviews publish or remove packages, so are refused while the registry
+	// is disabled or read-only
+	enabled, err := s.Settings.IsRegistryEnabled(ctx, artifact.Registry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check registry status: %w", err)
+	}
+	readOnly := false
+	if enabled {
+		if readOnly, err = s.Settings.IsReadOnly(ctx, artifact.Registry); err != nil {
+			return nil, fmt.Errorf("failed to check registry read-only mode: %w", err)
+		}
+	}
+	if !enabled || readOnly {
+		return nil, fmt.Errorf("%w: %s", ErrApprovalRegistryUnavailable, artifact.Registry)
+	}
+
+	canApprove, err := s.CanUserApprove(ctx, artifact.Registry, reviewerID)
+	if err != nil {
+		return nil, err
+	}
+	if !canApprove {
+		return nil, ErrApprovalForbidden
+	}
+
+	if artifact.PublishedBy == reviewerID {
+		return nil, ErrSelfApproval
+	}
+
+	return &artifact, nil
+}
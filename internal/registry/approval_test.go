@@ -0,0 +1,160 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingNotifier captures approval events for assertions
+type recordingNotifier struct {
+	events []ApprovalEvent
+}
+
+func (n *recordingNotifier) NotifyApproval(ctx context.Context, event ApprovalEvent) {
+	n.events = append(n.events, event)
+}
+
+// setupApprovalTest creates a service whose "test" registry requires approval,
+// along with a publisher and an approver holding the approve permission
+func setupApprovalTest(t *testing.T) (*Service, *common.Database, *MockBlobStorage, *recordingNotifier, *types.User, *types.User) {
+	service, db, mockStorage := setupTestService(t)
+	ctx := context.Background()
+
+	require.NoError(t, db.Model(&types.RegistrySetting{}).
+		Where("registry_name = ?", "test").
+		Update("require_approval", true).Error)
+
+	publisher := createTestUser(t, db)
+	approver := &types.User{Username: "approver", Email: "approver@example.com", Password: "hashedpassword", IsActive: true}
+	require.NoError(t, db.Create(approver).Error)
+	require.NoError(t, db.Create(&types.Permission{
+		UserID:    approver.ID,
+		Resource:  "registry:test",
+		Action:    PermissionActionApprove,
+		GrantedBy: approver.ID,
+	}).Error)
+
+	notifier := &recordingNotifier{}
+	service.SetApprovalNotifier(notifier)
+
+	mockHandler := &MockHandler{}
+	service.handlers["test"] = mockHandler
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), mock.Anything).Return(nil)
+	mockHandler.On("GetMetadata", mock.Anything).Return(map[string]interface{}{}, nil)
+	mockHandler.On("GenerateStoragePath", "test-package", "1.0.0").Return("test/test-package/1.0.0/artifact")
+	mockHandler.On("Upload", ctx, mock.AnythingOfType("*types.Artifact"), mock.Anything).Return(nil)
+
+	return service, db, mockStorage, notifier, publisher, approver
+}
+
+func TestApproval_PendingArtifactIsInvisible(t *testing.T) {
+	service, _, _, notifier, publisher, _ := setupApprovalTest(t)
+	ctx := context.Background()
+
+	artifact, err := service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader([]byte("content")), publisher.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ArtifactStatusPendingApproval, artifact.Status)
+
+	// Not downloadable
+	_, _, err = service.Download(ctx, "test", "test-package", "1.0.0")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "artifact not found")
+
+	// Not listed
+	artifacts, total, err := service.List(ctx, &types.ArtifactFilter{Registry: "test"})
+	require.NoError(t, err)
+	assert.Empty(t, artifacts)
+	assert.Equal(t, int64(0), total)
+
+	// Queued for review
+	pending, err := service.ListPendingApprovals(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, artifact.ID, pending[0].ID)
+
+	require.Len(t, notifier.events, 1)
+	assert.Equal(t, ApprovalEventSubmitted, notifier.events[0].Type)
+}
+
+func TestApproval_ApproveMakesAvailable(t *testing.T) {
+	service, _, mockStorage, notifier, publisher, approver := setupApprovalTest(t)
+	ctx := context.Background()
+
+	artifact, err := service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader([]byte("content")), publisher.ID)
+	require.NoError(t, err)
+
+	// Publishers cannot approve their own uploads, even as owners
+	_, err = service.ApproveArtifact(ctx, artifact.ID, publisher.ID)
+	assert.ErrorIs(t, err, ErrApprovalForbidden)
+
+	approved, err := service.ApproveArtifact(ctx, artifact.ID, approver.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ArtifactStatusPublished, approved.Status)
+
+	mockStorage.On("Retrieve", ctx, artifact.StoragePath).Return(io.NopCloser(strings.NewReader("content")), nil)
+	downloaded, content, err := service.Download(ctx, "test", "test-package", "1.0.0")
+	require.NoError(t, err)
+	defer content.Close()
+	assert.Equal(t, artifact.ID, downloaded.ID)
+
+	artifacts, total, err := service.List(ctx, &types.ArtifactFilter{Registry: "test"})
+	require.NoError(t, err)
+	assert.Len(t, artifacts, 1)
+	assert.Equal(t, int64(1), total)
+
+	// Already approved artifacts are no longer pending
+	_, err = service.ApproveArtifact(ctx, artifact.ID, approver.ID)
+	assert.ErrorIs(t, err, ErrApprovalNotFound)
+
+	require.Len(t, notifier.events, 2)
+	assert.Equal(t, ApprovalEventApproved, notifier.events[1].Type)
+	assert.Equal(t, approver.ID, notifier.events[1].Actor)
+}
+
+func TestApproval_RejectRemovesArtifact(t *testing.T) {
+	service, db, mockStorage, notifier, publisher, approver := setupApprovalTest(t)
+	ctx := context.Background()
+
+	artifact, err := service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader([]byte("content")), publisher.ID)
+	require.NoError(t, err)
+
+	mockStorage.On("Delete", ctx, artifact.StoragePath).Return(nil)
+	require.NoError(t, service.RejectArtifact(ctx, artifact.ID, approver.ID, "licence not cleared"))
+
+	var count int64
+	require.NoError(t, db.Model(&types.Artifact{}).Where("id = ?", artifact.ID).Count(&count).Error)
+	assert.Equal(t, int64(0), count)
+
+	pending, err := service.ListPendingApprovals(ctx, "test")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	require.Len(t, notifier.events, 2)
+	assert.Equal(t, ApprovalEventRejected, notifier.events[1].Type)
+	assert.Equal(t, "licence not cleared", notifier.events[1].Reason)
+
+	mockStorage.AssertExpectations(t)
+}
+
+func TestApproval_SelfApprovalRejectedForAdmins(t *testing.T) {
+	service, db, _, _, _, _ := setupApprovalTest(t)
+	ctx := context.Background()
+
+	admin := &types.User{Username: "admin", Email: "admin@example.com", Password: "hashedpassword", IsActive: true, IsAdmin: true}
+	require.NoError(t, db.Create(admin).Error)
+
+	artifact, err := service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader([]byte("content")), admin.ID)
+	require.NoError(t, err)
+
+	_, err = service.ApproveArtifact(ctx, artifact.ID, admin.ID)
+	assert.ErrorIs(t, err, ErrSelfApproval)
+}
@@ -0,0 +1,68 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog_RecordsWrites(t *testing.T) {
+	service, user, _ := setupSoftDeleteTest(t)
+	auditLog := audit.NewService(service.DB.DB)
+	service.SetAuditLog(auditLog)
+	ctx := audit.WithSourceIP(context.Background(), "198.51.100.7")
+	mockHandler := service.handlers["test"].(*MockHandler)
+	mockHandler.On("GenerateStoragePath", "left-pad", "2.0.0").Return("test/left-pad/2.0.0/artifact")
+	mockHandler.On("Upload", mock.Anything, mock.AnythingOfType("*types.Artifact"), mock.Anything).
+		Run(func(args mock.Arguments) {
+			artifact := args.Get(1).(*types.Artifact)
+			require.NoError(t, service.Storage.Store(ctx, artifact.StoragePath, bytes.NewReader(args.Get(2).([]byte)), "application/octet-stream"))
+		}).
+		Return(nil)
+
+	other := &types.User{Username: "other", Email: "other@example.com", Password: "hashedpassword", IsActive: true}
+	require.NoError(t, service.DB.Create(other).Error)
+
+	_, err := service.Upload(ctx, "test", "left-pad", "2.0.0", bytes.NewReader([]byte("content v2")), user.ID)
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "2.0.0", user.ID))
+	_, err = service.Restore(ctx, "test", "left-pad", "2.0.0", user.ID)
+	require.NoError(t, err)
+	require.NoError(t, service.AddPackageOwner(ctx, "test", "left-pad", user.ID, other.ID, RoleOwner))
+	require.NoError(t, service.RemovePackageOwner(ctx, "test", "left-pad", user.ID, other.ID))
+	require.NoError(t, service.Settings.SetRequireApproval(ctx, "test", true, user.ID))
+
+	// Writes that are refused are not audited
+	require.Error(t, service.Delete(ctx, "test", "left-pad", "1.0.0", other.ID))
+
+	entries, total, err := auditLog.Query(ctx, audit.Filter{})
+	require.NoError(t, err)
+	require.Equal(t, int64(6), total)
+
+	actions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+		assert.Equal(t, "198.51.100.7", entry.SourceIP)
+	}
+	assert.ElementsMatch(t, []string{
+		audit.ActionPackagePublish,
+		audit.ActionPackageDelete,
+		audit.ActionPackageRestore,
+		audit.ActionOwnerAdd,
+		audit.ActionOwnerRemove,
+		audit.ActionRegistryUpdate,
+	}, actions)
+
+	published, _, err := auditLog.Query(ctx, audit.Filter{ActorID: &user.ID, Action: audit.ActionPackagePublish})
+	require.NoError(t, err)
+	require.Len(t, published, 1)
+	assert.Equal(t, audit.PackageTarget("test", "left-pad", "2.0.0"), published[0].Target)
+	assert.Equal(t, user.ID, *published[0].ActorID)
+	assert.NotEmpty(t, published[0].Details["sha256"])
+}
@@ -0,0 +1,279 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Backup archives are tarballs holding, for each artifact, its record as a
+// JSON sidecar followed by its content, and after the artifacts of each
+// package, the package's owners
+const (
+	backupArtifactDir = "artifacts/"
+	backupOwnersDir   = "owners/"
+	backupSidecarExt  = ".json"
+	backupContentExt  = ".blob"
+)
+
+// BackupOwners is the owners entry of a package in a backup archive
+type BackupOwners struct {
+	Registry string                   `json:"registry"`
+	Name     string                   `json:"name"`
+	Owners   []types.PackageOwnership `json:"owners"`
+}
+
+// ImportResult counts what happened to the artifacts in a backup archive
+type ImportResult struct {
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Failed   int `json:"failed"`
+}
+
+// Export writes the published artifacts of a registry type, or of every
+// registry if it is empty, to a backup archive and returns how many were
+// exported. OCI repositories are stored as manifests and blobs rather than
+// artifact content and are not exported.
+func (s *Service) Export(ctx context.Context, w io.Writer, registryType string) (int, error) {
+	query := s.DB.WithContext(ctx).Preload("Publisher").
+		Where("status = ? AND registry <> ?", types.ArtifactStatusPublished, "oci")
+	if registryType != "" {
+		query = query.Where("registry = ?", registryType)
+	}
+
+	var artifacts []types.Artifact
+	if err := query.Order("registry, name, created_at").Find(&artifacts).Error; err != nil {
+		return 0, fmt.Errorf("failed to list artifacts: %w", err)
+	}
+
+	tw := tar.NewWriter(w)
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		entry := fmt.Sprintf("%06d", i+1)
+
+		sidecar, err := json.Marshal(artifact)
+		if err != nil {
+			return i, fmt.Errorf("failed to encode artifact %s:%s: %w", artifact.Name, artifact.Version, err)
+		}
+		if err := writeBackupEntry(tw, backupArtifactDir+entry+backupSidecarExt, artifact.UpdatedAt, bytes.NewReader(sidecar), int64(len(sidecar))); err != nil {
+			return i, err
+		}
+		if err := s.exportContent(ctx, tw, backupArtifactDir+entry+backupContentExt, artifact); err != nil {
+			return i, err
+		}
+
+		// Owners follow the last version of each package
+		last := i == len(artifacts)-1 ||
+			artifacts[i+1].Registry != artifact.Registry || artifacts[i+1].Name != artifact.Name
+		if last {
+			if err := s.exportOwners(ctx, tw, backupOwnersDir+entry+backupSidecarExt, artifact); err != nil {
+				return i + 1, err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return len(artifacts), fmt.Errorf("failed to finish backup archive: %w", err)
+	}
+
+	log.Info().Str("registry_type", registryType).Int("artifacts", len(artifacts)).Msg("Exported artifacts")
+	return len(artifacts), nil
+}
+
+// exportContent streams the stored content of an artifact into the archive
+func (s *Service) exportContent(ctx context.Context, tw *tar.Writer, name string, artifact *types.Artifact) error {
+	size, err := s.Storage.GetSize(ctx, artifact.StoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to get content size of %s:%s: %w", artifact.Name, artifact.Version, err)
+	}
+	reader, err := s.Storage.Retrieve(ctx, artifact.StoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve content of %s:%s: %w", artifact.Name, artifact.Version, err)
+	}
+	defer reader.Close()
+	return writeBackupEntry(tw, name, artifact.UpdatedAt, reader, size)
+}
+
+// exportOwners writes the owners entry of an artifact's package
+func (s *Service) exportOwners(ctx context.Context, tw *tar.Writer, name string, artifact *types.Artifact) error {
+	var owners []types.PackageOwnership
+	if err := s.DB.WithContext(ctx).Preload("User").
+		Where("package_key = ?", generatePackageKey(artifact.Registry, artifact.Name)).
+		Order("granted_at").Find(&owners).Error; err != nil {
+		return fmt.Errorf("failed to get owners of %s: %w", artifact.Name, err)
+	}
+
+	data, err := json.Marshal(BackupOwners{Registry: artifact.Registry, Name: artifact.Name, Owners: owners})
+	if err != nil {
+		return fmt.Errorf("failed to encode owners of %s: %w", artifact.Name, err)
+	}
+	return writeBackupEntry(tw, name, time.Now(), bytes.NewReader(data), int64(len(data)))
+}
+
+// writeBackupEntry adds a file to a backup archive
+func writeBackupEntry(tw *tar.Writer, name string, modified time.Time, content io.Reader, size int64) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modified,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Import publishes the artifacts of a backup archive. Each artifact is
+// published by its original publisher if a user with the same username
+// exists, and by fallbackPublisher otherwise; artifacts with neither are not
+// imported. Versions that already exist are skipped, and package owners that
+// exist are given back their roles.
+func (s *Service) Import(ctx context.Context, r io.Reader, fallbackPublisher uuid.UUID) (*ImportResult, error) {
+	result := &ImportResult{}
+	tr := tar.NewReader(r)
+
+	var pending *types.Artifact
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("invalid backup archive: %w", err)
+		}
+
+		switch {
+		case strings.HasPrefix(header.Name, backupArtifactDir) && path.Ext(header.Name) == backupSidecarExt:
+			pending = &types.Artifact{}
+			if err := json.NewDecoder(tr).Decode(pending); err != nil {
+				return result, fmt.Errorf("invalid artifact record %s: %w", header.Name, err)
+			}
+
+		case strings.HasPrefix(header.Name, backupArtifactDir) && path.Ext(header.Name) == backupContentExt:
+			if pending == nil {
+				return result, fmt.Errorf("invalid backup archive: %s has no artifact record", header.Name)
+			}
+			s.importArtifact(ctx, pending, tr, fallbackPublisher, result)
+			pending = nil
+
+		case strings.HasPrefix(header.Name, backupOwnersDir):
+			var owners BackupOwners
+			if err := json.NewDecoder(tr).Decode(&owners); err != nil {
+				return result, fmt.Errorf("invalid owners record %s: %w", header.Name, err)
+			}
+			s.importOwners(ctx, &owners)
+		}
+	}
+
+	log.Info().
+		Int("imported", result.Imported).
+		Int("skipped", result.Skipped).
+		Int("failed", result.Failed).
+		Msg("Imported artifacts")
+	return result, nil
+}
+
+// importArtifact publishes an artifact from a backup archive and restores the
+// parts of its record that publishing does not carry over
+func (s *Service) importArtifact(ctx context.Context, record *types.Artifact, content io.Reader, fallbackPublisher uuid.UUID, result *ImportResult) {
+	logger := log.With().
+		Str("registry_type", record.Registry).
+		Str("name", record.Name).
+		Str("version", record.Version).
+		Logger()
+
+	publisher := fallbackPublisher
+	if user, err := s.findBackupUser(ctx, &record.Publisher); err == nil {
+		publisher = user.ID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.Error().Err(err).Msg("Failed to look up publisher, artifact not imported")
+		result.Failed++
+		return
+	}
+	if publisher == uuid.Nil {
+		logger.Warn().Str("publisher", record.Publisher.Username).Msg("Publisher does not exist, artifact not imported")
+		result.Failed++
+		return
+	}
+
+	artifact, err := s.Upload(ctx, record.Registry, record.Name, record.Version, content, publisher)
+	if errors.Is(err, ErrArtifactExists) || errors.Is(err, ErrArtifactUnchanged) {
+		logger.Debug().Msg("Artifact already exists, skipped")
+		result.Skipped++
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to import artifact")
+		result.Failed++
+		return
+	}
+
+	if err := s.DB.WithContext(ctx).Model(artifact).Updates(map[string]interface{}{
+		"is_public":  record.IsPublic,
+		"downloads":  record.Downloads,
+		"created_at": record.CreatedAt,
+	}).Error; err != nil {
+		logger.Warn().Err(err).Msg("Failed to restore artifact record")
+	}
+	result.Imported++
+}
+
+// importOwners gives the owners of a package that exist their roles back,
+// granted by an owner the package has now
+func (s *Service) importOwners(ctx context.Context, backup *BackupOwners) {
+	current, err := s.Ownership.GetPackageOwners(ctx, backup.Registry, backup.Name)
+	if err != nil {
+		log.Error().Err(err).Str("name", backup.Name).Msg("Failed to get package owners, ownership not restored")
+		return
+	}
+	granter := uuid.Nil
+	for _, owner := range current {
+		if owner.Role == RoleOwner {
+			granter = owner.UserID
+			break
+		}
+	}
+	if granter == uuid.Nil {
+		return
+	}
+
+	for _, owner := range backup.Owners {
+		user, err := s.findBackupUser(ctx, &owner.User)
+		if err != nil {
+			log.Debug().Err(err).Str("name", backup.Name).Str("owner", owner.User.Username).Msg("Package owner not restored")
+			continue
+		}
+		if err := s.Ownership.AddOwner(ctx, backup.Registry, backup.Name, user.ID, granter, owner.Role); err != nil {
+			log.Warn().Err(err).Str("name", backup.Name).Str("owner", owner.User.Username).Msg("Failed to restore package owner")
+		}
+	}
+}
+
+// findBackupUser finds the user a backup record refers to by username, since
+// user IDs differ between instances
+func (s *Service) findBackupUser(ctx context.Context, backup *types.User) (*types.User, error) {
+	if backup.Username == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var user types.User
+	if err := s.DB.WithContext(ctx).Where("username = ?", backup.Username).First(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// setupBackupService returns a service with a fresh database and storage whose
+// "test" and "other" registries store whatever is uploaded to them
+func setupBackupService(t *testing.T) *Service {
+	t.Helper()
+
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: "other", Enabled: true}).Error)
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	service := NewService(db, localStorage)
+
+	for _, registryType := range []string{"test", "other"} {
+		mockHandler := &MockHandler{}
+		mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), mock.Anything).Return(nil).Maybe()
+		mockHandler.On("GetMetadata", mock.Anything).Return(map[string]interface{}{}, nil).Maybe()
+		mockHandler.On("GenerateStoragePath", mock.Anything, mock.Anything).Return("").Maybe()
+		mockHandler.On("Upload", mock.Anything, mock.AnythingOfType("*types.Artifact"), mock.Anything).
+			Run(func(args mock.Arguments) {
+				artifact := args.Get(1).(*types.Artifact)
+				require.NoError(t, localStorage.Store(context.Background(), artifact.StoragePath, bytes.NewReader(args.Get(2).([]byte)), "application/octet-stream"))
+			}).
+			Return(nil).Maybe()
+		service.handlers[registryType] = mockHandler
+	}
+	return service
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	source := setupBackupService(t)
+	publisher := createTestUser(t, source.DB)
+	maintainer := &types.User{Username: "maintainer", Email: "maintainer@example.com", Password: "hashedpassword", IsActive: true}
+	require.NoError(t, source.DB.Create(maintainer).Error)
+
+	for _, upload := range []struct{ registry, name, version, content string }{
+		{"test", "left-pad", "1.0.0", "left-pad 1.0.0"},
+		{"test", "left-pad", "1.1.0", "left-pad 1.1.0"},
+		{"test", "right-pad", "2.0.0", "right-pad 2.0.0"},
+		{"other", "elsewhere", "1.0.0", "elsewhere 1.0.0"},
+	} {
+		_, err := source.Upload(ctx, upload.registry, upload.name, upload.version, bytes.NewReader([]byte(upload.content)), publisher.ID)
+		require.NoError(t, err)
+	}
+	require.NoError(t, source.AddPackageOwner(ctx, "test", "left-pad", publisher.ID, maintainer.ID, RoleMaintainer))
+	created := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, source.DB.Model(&types.Artifact{}).Where("name = ? AND version = ?", "left-pad", "1.0.0").
+		Updates(map[string]interface{}{"is_public": true, "downloads": 42, "created_at": created}).Error)
+
+	var archive bytes.Buffer
+	exported, err := source.Export(ctx, &archive, "test")
+	require.NoError(t, err)
+	assert.Equal(t, 3, exported, "only the requested registry is exported")
+
+	// The target instance has the maintainer but not the original publisher
+	target := setupBackupService(t)
+	importer := &types.User{Username: "importer", Email: "importer@example.com", Password: "hashedpassword", IsActive: true}
+	require.NoError(t, target.DB.Create(importer).Error)
+	targetMaintainer := &types.User{Username: "maintainer", Email: "maintainer@example.com", Password: "hashedpassword", IsActive: true}
+	require.NoError(t, target.DB.Create(targetMaintainer).Error)
+
+	result, err := target.Import(ctx, bytes.NewReader(archive.Bytes()), importer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Imported: 3}, *result)
+
+	artifact, reader, err := target.Download(ctx, "test", "left-pad", "1.0.0")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "left-pad 1.0.0", string(content))
+	assert.Equal(t, importer.ID, artifact.PublishedBy, "missing publishers are replaced by the importer")
+	assert.True(t, artifact.IsPublic)
+	assert.Equal(t, int64(42), artifact.Downloads)
+	assert.True(t, created.Equal(artifact.CreatedAt))
+
+	_, err = target.GetArtifact(ctx, "other", "elsewhere", "1.0.0")
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+
+	canPublish, err := target.Ownership.CanUserPublish(ctx, "test", "left-pad", targetMaintainer.ID)
+	require.NoError(t, err)
+	assert.True(t, canPublish, "existing owners get their roles back")
+	canPublish, err = target.Ownership.CanUserPublish(ctx, "test", "right-pad", targetMaintainer.ID)
+	require.NoError(t, err)
+	assert.False(t, canPublish)
+
+	t.Run("duplicates are skipped", func(t *testing.T) {
+		result, err := target.Import(ctx, bytes.NewReader(archive.Bytes()), importer.ID)
+		require.NoError(t, err)
+		assert.Equal(t, ImportResult{Skipped: 3}, *result)
+	})
+
+	t.Run("artifacts without a publisher are not imported", func(t *testing.T) {
+		result, err := setupBackupService(t).Import(ctx, bytes.NewReader(archive.Bytes()), uuid.Nil)
+		require.NoError(t, err)
+		assert.Equal(t, ImportResult{Failed: 3}, *result)
+	})
+
+	t.Run("original publishers are kept", func(t *testing.T) {
+		fresh := setupBackupService(t)
+		user := createTestUser(t, fresh.DB)
+		_, err := fresh.Import(ctx, bytes.NewReader(archive.Bytes()), uuid.Nil)
+		require.NoError(t, err)
+
+		artifact, err := fresh.GetArtifact(ctx, "test", "right-pad", "2.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, artifact.PublishedBy)
+	})
+}
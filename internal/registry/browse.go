@@ -0,0 +1,303 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// ListRegistries returns every supported registry format with its settings
+// and the number of packages published to it that the request can read
+func (s *Service) ListRegistries(ctx context.Context) ([]*types.BrowseRegistry, error) {
+	settings, err := s.Settings.GetRegistrySettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]types.RegistrySetting, len(settings))
+	for _, setting := range settings {
+		byName[setting.RegistryName] = setting
+	}
+
+	query, err := s.readableByRequest(ctx, s.DB.WithContext(ctx).Model(&types.Artifact{}))
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		Registry string
+		Count    int64
+	}
+	if err := query.
+		Select("registry, COUNT(DISTINCT name) AS count").
+		Where("status = ?", types.ArtifactStatusPublished).
+		Group("registry").
+		Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count packages: %w", err)
+	}
+	packageCounts := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		packageCounts[count.Registry] = count.Count
+	}
+
+	registries := make([]*types.BrowseRegistry, 0, len(s.handlers))
+	for name := range s.handlers {
+		// Registries without a setting are treated as disabled, as on upload
+		setting := byName[name]
+		registries = append(registries, &types.BrowseRegistry{
+			Name:         name,
+			Description:  setting.Description,
+			Enabled:      setting.Enabled,
+			PackageCount: packageCounts[name],
+		})
+	}
+	sort.Slice(registries, func(i, j int) bool {
+		return registries[i].Name < registries[j].Name
+	})
+
+	return registries, nil
+}
+
+// ListPackages returns one page of the packages published to a registry
+// that the request can read, ordered by name and optionally filtered to names
+// containing query
+func (s *Service) ListPackages(ctx context.Context, registryType, query string, page, perPage int) ([]*types.BrowsePackage, int64, error) {
+	if _, err := s.GetRegistry(registryType); err != nil {
+		return nil, 0, err
+	}
+
+	base := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+		Where("registry = ? AND status = ?", registryType, types.ArtifactStatusPublished)
+	if query != "" {
+		base = base.Where("LOWER(name) LIKE LOWER(?)", "%"+query+"%")
+	}
+	base, err := s.readableByRequest(ctx, base)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := base.Session(&gorm.Session{}).Distinct("name").Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count packages: %w", err)
+	}
+
+	var names []string
+	if err := base.Session(&gorm.Session{}).
+		Distinct("name").
+		Order("name").
+		Limit(perPage).
+		Offset((page-1)*perPage).
+		Pluck("name", &names).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list packages: %w", err)
+	}
+	if len(names) == 0 {
+		return []*types.BrowsePackage{}, total, nil
+	}
+
+	versions, err := s.readableByRequest(ctx, s.DB.WithContext(ctx).
+		Where("registry = ? AND status = ? AND name IN ?", registryType, types.ArtifactStatusPublished, names))
+	if err != nil {
+		return nil, 0, err
+	}
+	var artifacts []*types.Artifact
+	if err := versions.Find(&artifacts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get package versions: %w", err)
+	}
+	versionsByName := make(map[string][]*types.Artifact, len(names))
+	for _, artifact := range artifacts {
+		versionsByName[artifact.Name] = append(versionsByName[artifact.Name], artifact)
+	}
+
+	packages := make([]*types.BrowsePackage, 0, len(names))
+	for _, name := range names {
+		versions := versionsByName[name]
+		latest := LatestArtifact(versions)
+		pkg := &types.BrowsePackage{
+			Registry:      registryType,
+			Name:          name,
+			Description:   artifactDescription(latest),
+			LatestVersion: latest.Version,
+			VersionCount:  len(versions),
+		}
+		for _, version := range versions {
+			pkg.Downloads += version.Downloads
+			if version.UpdatedAt.After(pkg.UpdatedAt) {
+				pkg.UpdatedAt = version.UpdatedAt
+			}
+		}
+		packages = append(packages, pkg)
+	}
+
+	return packages, total, nil
+}
+
+// GetPackageSummary describes a package across the published versions the
+// request can read. Packages it cannot read are not found.
+func (s *Service) GetPackageSummary(ctx context.Context, registryType, name string) (*types.BrowsePackageSummary, error) {
+	readable, err := s.CanReadPackage(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+	if !readable {
+		return nil, ErrPackageNotFound
+	}
+
+	query, err := s.readableByRequest(ctx, s.DB.WithContext(ctx).
+		Where("registry = ? AND name = ? AND status = ?", registryType, name, types.ArtifactStatusPublished))
+	if err != nil {
+		return nil, err
+	}
+	var artifacts []*types.Artifact
+	if err := query.Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get package versions: %w", err)
+	}
+	if len(artifacts) == 0 {
+		return nil, ErrPackageNotFound
+	}
+
+	var ownerships []types.PackageOwnership
+	if err := s.DB.WithContext(ctx).Preload("User").
+		Where("package_key = ?", generatePackageKey(registryType, name)).
+		Order("granted_at").
+		Find(&ownerships).Error; err != nil {
+		return nil, fmt.Errorf("failed to get package owners: %w", err)
+	}
+
+	latest := LatestArtifact(artifacts)
+	summary := &types.BrowsePackageSummary{
+		Registry:      registryType,
+		Name:          name,
+		Description:   artifactDescription(latest),
+		LatestVersion: latest.Version,
+		Versions:      make([]types.BrowseVersion, 0, len(artifacts)),
+		Owners:        make([]types.BrowseOwner, 0, len(ownerships)),
+	}
+
+	for _, artifact := range sortArtifactsLatestFirst(artifacts) {
+		summary.Downloads += artifact.Downloads
+		if summary.CreatedAt.IsZero() || artifact.CreatedAt.Before(summary.CreatedAt) {
+			summary.CreatedAt = artifact.CreatedAt
+		}
+		if artifact.UpdatedAt.After(summary.UpdatedAt) {
+			summary.UpdatedAt = artifact.UpdatedAt
+		}
+		summary.Versions = append(summary.Versions, types.BrowseVersion{
+			Version:     artifact.Version,
+			Downloads:   artifact.Downloads,
+			Size:        artifact.Size,
+			PublishedAt: artifact.CreatedAt,
+			Yanked:      IsYanked(artifact),
+		})
+	}
+
+	for _, ownership := range ownerships {
+		summary.Owners = append(summary.Owners, types.BrowseOwner{Username: ownership.User.Username, Role: ownership.Role})
+	}
+
+	return summary, nil
+}
+
+// GetVersionDetail describes a single published package version the request
+// can read. Versions it cannot read are not found.
+func (s *Service) GetVersionDetail(ctx context.Context, registryType, name, version string) (*types.BrowseVersionDetail, error) {
+	readable, err := s.CanReadPackage(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+	if !readable {
+		return nil, fmt.Errorf("%w: %s:%s", ErrPackageNotFound, name, version)
+	}
+
+	query, err := s.readableByRequest(ctx, s.DB.WithContext(ctx).Preload("Publisher").
+		Where("registry = ? AND name = ? AND version = ? AND status = ?", registryType, name, version, types.ArtifactStatusPublished))
+	if err != nil {
+		return nil, err
+	}
+	var artifact types.Artifact
+	if err := query.First(&artifact).Error; err != nil {
+		return nil, fmt.Errorf("%w: %s:%s", ErrPackageNotFound, name, version)
+	}
+
+	detail := &types.BrowseVersionDetail{
+		Registry:    artifact.Registry,
+		Name:        artifact.Name,
+		Version:     artifact.Version,
+		Description: artifactDescription(&artifact),
+		Downloads:   artifact.Downloads,
+		Publisher:   artifact.Publisher.Username,
+		PublishedAt: artifact.CreatedAt,
+		UpdatedAt:   artifact.UpdatedAt,
+		Files: []types.BrowseFile{{
+			Name:        s.artifactFileName(&artifact),
+			Size:        artifact.Size,
+			SHA256:      artifact.SHA256,
+			ContentType: artifact.ContentType,
+		}},
+		Dependencies: []types.BrowseDependency{},
+		Metadata:     artifact.Metadata,
+	}
+	for _, dependency := range artifactDependencies(&artifact) {
+		detail.Dependencies = append(detail.Dependencies, types.BrowseDependency{Name: dependency.Name, Constraint: dependency.Version})
+	}
+
+	return detail, nil
+}
+
+// artifactDescription returns the description recorded in artifact metadata
+func artifactDescription(artifact *types.Artifact) string {
+	description, _ := artifact.Metadata["description"].(string)
+	return description
+}
+
+// sortArtifactsLatestFirst orders versions of a package by version, latest
+// first, with versions that are not semver after them by publish date
+func sortArtifactsLatestFirst(artifacts []*types.Artifact) []*types.Artifact {
+	sorted := append([]*types.Artifact(nil), artifacts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.After(sorted[j].CreatedAt)
+	})
+
+	versions := make([]string, 0, len(sorted))
+	byVersion := make(map[string]*types.Artifact, len(sorted))
+	for _, artifact := range sorted {
+		versions = append(versions, artifact.Version)
+		byVersion[artifact.Version] = artifact
+	}
+
+	// An empty constraint keeps versions that are not semver at the end
+	ordered, err := utils.FilterVersions(versions, "", true)
+	if err != nil {
+		return sorted
+	}
+	result := make([]*types.Artifact, 0, len(ordered))
+	for _, version := range ordered {
+		result = append(result, byVersion[version])
+	}
+	return result
+}
+
+// LatestArtifact returns the latest release of a package, or its latest
+// prerelease if it has no releases. Yanked versions are passed over unless
+// every version is yanked.
+func LatestArtifact(artifacts []*types.Artifact) *types.Artifact {
+	sorted := sortArtifactsLatestFirst(artifacts)
+	var prerelease *types.Artifact
+	for _, artifact := range sorted {
+		if IsYanked(artifact) {
+			continue
+		}
+		if !utils.IsPrerelease(artifact.Version) {
+			return artifact
+		}
+		if prerelease == nil {
+			prerelease = artifact
+		}
+	}
+	if prerelease != nil {
+		return prerelease
+	}
+	return sorted[0]
+}
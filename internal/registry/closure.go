@@ -0,0 +1,419 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lgulliver/lodestone/internal/auth"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// ErrClosureTooLarge is returned when a dependency closure exceeds its size limit
+var ErrClosureTooLarge = errors.New("dependency closure exceeds size limit")
+
+// ClosureLimits bounds the resolution of a dependency closure
+type ClosureLimits struct {
+	MaxDepth int   // dependencies deeper than this are reported as unresolved
+	MaxSize  int64 // total bytes of all artifacts in the closure
+}
+
+// DefaultClosureLimits are applied when no narrower limits are requested
+var DefaultClosureLimits = ClosureLimits{
+	MaxDepth: 10,
+	MaxSize:  2 << 30,
+}
+
+// ClosureArtifact is one artifact of a dependency closure
+type ClosureArtifact struct {
+	Registry     string   `json:"registry"`
+	Name         string   `json:"name"`
+	Version      string   `json:"version"`
+	SHA256       string   `json:"sha256"`
+	Size         int64    `json:"size"`
+	Path         string   `json:"path"`  // location within the closure archive
+	Depth        int      `json:"depth"` // shortest dependency path from the root
+	Dependencies []string `json:"dependencies,omitempty"`
+
+	Artifact *types.Artifact `json:"-"`
+}
+
+// UnresolvedDependency is a dependency that could not be included in a closure
+type UnresolvedDependency struct {
+	Name       string `json:"name"`
+	Constraint string `json:"constraint"`
+	RequiredBy string `json:"required_by"`
+	Reason     string `json:"reason"`
+}
+
+// Closure is a package together with its transitive dependencies
+type Closure struct {
+	Root       string                 `json:"root"`
+	Artifacts  []*ClosureArtifact     `json:"artifacts"` // in breadth-first order, root first
+	Unresolved []UnresolvedDependency `json:"unresolved"`
+	Cycles     [][]string             `json:"cycles"`
+	TotalSize  int64                  `json:"total_size"`
+}
+
+// closureKey identifies an artifact within a closure
+func closureKey(name, version string) string {
+	return strings.ToLower(name) + "@" + version
+}
+
+// ResolveClosure resolves the transitive dependencies of a package from the
+// dependency metadata recorded at publish, choosing for each dependency the
+// newest published version in the same registry that satisfies its
+// constraint. Dependencies not published here, or beyond the depth limit,
+// are reported as unresolved rather than failing the closure. Cycles are
+// followed once and reported.
+//
+// Each artifact is checked as Download checks it: dependencies the reader
+// cannot read are treated as unpublished, and those outside the API key's
+// scope or refused by the download policy are reported as unresolved.
+func (s *Service) ResolveClosure(ctx context.Context, registryType, name, version string, limits ClosureLimits) (*Closure, error) {
+	if err := auth.CheckAPIKeyScope(ctx, registryType, name); err != nil {
+		return nil, err
+	}
+	root, err := s.publishedArtifact(ctx, registryType, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if user, ok := readerFromContext(ctx); ok {
+		readable, err := s.canRead(ctx, root, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check read access: %w", err)
+		}
+		if !readable {
+			return nil, fmt.Errorf("%w: %s:%s", ErrPackageNotFound, name, version)
+		}
+	}
+	if s.downloadPolicy != nil {
+		if err := s.downloadPolicy.CheckDownload(ctx, root); err != nil {
+			return nil, err
+		}
+	}
+
+	rootEntry := s.newClosureArtifact(root, 0)
+	closure := &Closure{
+		Root:       closureKey(root.Name, root.Version),
+		Artifacts:  []*ClosureArtifact{rootEntry},
+		Unresolved: []UnresolvedDependency{},
+		Cycles:     [][]string{},
+		TotalSize:  root.Size,
+	}
+	entries := map[string]*ClosureArtifact{closure.Root: rootEntry}
+
+	// Versions published per dependency name, looked up once
+	published := make(map[string][]*types.Artifact)
+
+	for queue := []*ClosureArtifact{rootEntry}; len(queue) > 0; queue = queue[1:] {
+		current := queue[0]
+		currentKey := closureKey(current.Name, current.Version)
+
+		for _, dependency := range artifactDependencies(current.Artifact) {
+			unresolved := UnresolvedDependency{Name: dependency.Name, Constraint: dependency.Version, RequiredBy: currentKey}
+
+			if current.Depth >= limits.MaxDepth {
+				unresolved.Reason = "depth limit reached"
+				closure.Unresolved = append(closure.Unresolved, unresolved)
+				continue
+			}
+
+			if err := auth.CheckAPIKeyScope(ctx, registryType, dependency.Name); err != nil {
+				unresolved.Reason = "outside the API key's package scope"
+				closure.Unresolved = append(closure.Unresolved, unresolved)
+				continue
+			}
+
+			lookup := strings.ToLower(dependency.Name)
+			candidates, ok := published[lookup]
+			if !ok {
+				candidates, err = s.closureCandidates(ctx, registryType, dependency.Name)
+				if err != nil {
+					return nil, err
+				}
+				published[lookup] = candidates
+			}
+
+			resolved, reason := resolveDependency(registryType, dependency.Version, candidates)
+			if resolved == nil {
+				unresolved.Reason = reason
+				closure.Unresolved = append(closure.Unresolved, unresolved)
+				continue
+			}
+			if s.downloadPolicy != nil {
+				if err := s.downloadPolicy.CheckDownload(ctx, resolved); err != nil {
+					unresolved.Reason = err.Error()
+					closure.Unresolved = append(closure.Unresolved, unresolved)
+					continue
+				}
+			}
+
+			key := closureKey(resolved.Name, resolved.Version)
+			current.Dependencies = append(current.Dependencies, key)
+			if _, seen := entries[key]; seen {
+				continue
+			}
+
+			closure.TotalSize += resolved.Size
+			if limits.MaxSize > 0 && closure.TotalSize > limits.MaxSize {
+				return nil, fmt.Errorf("%w of %d bytes", ErrClosureTooLarge, limits.MaxSize)
+			}
+
+			entry := s.newClosureArtifact(resolved, current.Depth+1)
+			entries[key] = entry
+			closure.Artifacts = append(closure.Artifacts, entry)
+			queue = append(queue, entry)
+		}
+	}
+
+	closure.Cycles = findCycles(closure.Artifacts, entries)
+	return closure, nil
+}
+
+// closureCandidates returns the published versions of a dependency that the
+// reader, if any, can read
+func (s *Service) closureCandidates(ctx context.Context, registryType, name string) ([]*types.Artifact, error) {
+	query := s.DB.WithContext(ctx).
+		Where("LOWER(name) = LOWER(?) AND registry = ? AND status = ?", name, registryType, types.ArtifactStatusPublished)
+	if user, ok := readerFromContext(ctx); ok {
+		var err error
+		if query, err = s.whereReadable(ctx, query, user); err != nil {
+			return nil, err
+		}
+	}
+
+	var candidates []*types.Artifact
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", name, err)
+	}
+	return candidates, nil
+}
+
+// OpenClosureArtifact retrieves the content of an artifact of a resolved
+// closure. Access was checked when the closure was resolved, and the
+// archive counts as neither a download of each artifact nor several
+// downloads to throttle, so the content is read straight from storage.
+func (s *Service) OpenClosureArtifact(ctx context.Context, entry *ClosureArtifact) (io.ReadCloser, error) {
+	content, err := s.Storage.Retrieve(ctx, entry.Artifact.StoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve %s: %w", closureKey(entry.Name, entry.Version), err)
+	}
+	return content, nil
+}
+
+// publishedArtifact returns a published artifact by exact version
+func (s *Service) publishedArtifact(ctx context.Context, registryType, name, version string) (*types.Artifact, error) {
+	var artifact types.Artifact
+	if err := s.DB.WithContext(ctx).
+		Where("LOWER(name) = LOWER(?) AND version = ? AND registry = ? AND status = ?", name, version, registryType, types.ArtifactStatusPublished).
+		First(&artifact).Error; err != nil {
+		return nil, fmt.Errorf("%w: %s:%s", ErrPackageNotFound, name, version)
+	}
+	return &artifact, nil
+}
+
+func (s *Service) newClosureArtifact(artifact *types.Artifact, depth int) *ClosureArtifact {
+	return &ClosureArtifact{
+		Registry: artifact.Registry,
+		Name:     artifact.Name,
+		Version:  artifact.Version,
+		SHA256:   artifact.SHA256,
+		Size:     artifact.Size,
+		Path:     path.Join(artifact.Registry, artifact.Name, artifact.Version, s.artifactFileName(artifact)),
+		Depth:    depth,
+		Artifact: artifact,
+	}
+}
+
+// dependencyRef is a dependency declared in artifact metadata
+type dependencyRef struct {
+	Name    string
+	Version string // version constraint in the registry's own syntax
+}
+
+// artifactDependencies reads the dependencies recorded in artifact metadata:
+// a name to constraint map (npm), a list of {id|name, version} entries
+// (NuGet), or such lists grouped per target framework
+func artifactDependencies(artifact *types.Artifact) []dependencyRef {
+	var refs []dependencyRef
+	seen := make(map[string]bool)
+	add := func(name, constraint string) {
+		if name == "" || seen[strings.ToLower(name)] {
+			return
+		}
+		seen[strings.ToLower(name)] = true
+		refs = append(refs, dependencyRef{Name: name, Version: constraint})
+	}
+
+	addList := func(list interface{}) {
+		switch deps := list.(type) {
+		case map[string]interface{}:
+			names := make([]string, 0, len(deps))
+			for name := range deps {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				constraint, _ := deps[name].(string)
+				add(name, constraint)
+			}
+		case []interface{}:
+			for _, dep := range deps {
+				entry, ok := dep.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				name, _ := entry["name"].(string)
+				if name == "" {
+					name, _ = entry["id"].(string)
+				}
+				constraint, _ := entry["version"].(string)
+				add(name, constraint)
+			}
+		}
+	}
+
+	addList(artifact.Metadata["dependencies"])
+	if groups, ok := artifact.Metadata["dependencyGroups"].([]interface{}); ok {
+		for _, group := range groups {
+			if groupMap, ok := group.(map[string]interface{}); ok {
+				addList(groupMap["dependencies"])
+			}
+		}
+	}
+
+	return refs
+}
+
+// resolveDependency picks the newest candidate satisfying the constraint, or
+// explains why none does. Yanked versions are only picked when the
+// constraint names them exactly.
+func resolveDependency(registryType, constraint string, candidates []*types.Artifact) (*types.Artifact, string) {
+	if len(candidates) == 0 {
+		return nil, "not published in this registry"
+	}
+
+	byVersion := make(map[string]*types.Artifact, len(candidates))
+	versions := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		byVersion[candidate.Version] = candidate
+		if !IsYanked(candidate) {
+			versions = append(versions, candidate.Version)
+		}
+	}
+
+	constraint = strings.TrimSpace(constraint)
+	if exact, ok := byVersion[constraint]; ok {
+		return exact, ""
+	}
+
+	switch {
+	case constraint == "" || constraint == "*" || constraint == "latest":
+		constraint = ""
+	case registryType == "nuget":
+		constraint = nugetRangeConstraint(constraint)
+	}
+
+	matches, err := utils.FilterVersions(versions, constraint, false)
+	if err != nil {
+		return nil, fmt.Sprintf("unsupported version constraint: %v", err)
+	}
+	if len(matches) == 0 && (constraint == "" || strings.Contains(constraint, "-")) {
+		// Fall back to prereleases when only prereleases are published or
+		// the range names one
+		matches, _ = utils.FilterVersions(versions, constraint, true)
+	}
+	if len(matches) == 0 {
+		return nil, "no published version satisfies the constraint"
+	}
+
+	return byVersion[matches[0]], ""
+}
+
+// nugetRangeConstraint converts NuGet version range notation to a semver
+// constraint: "1.0" means at least 1.0, "[1.0]" exactly 1.0, and
+// "[1.0,2.0)" an interval with inclusive [ ] and exclusive ( ) bounds
+func nugetRangeConstraint(versionRange string) string {
+	if !strings.HasPrefix(versionRange, "[") && !strings.HasPrefix(versionRange, "(") {
+		return ">=" + versionRange
+	}
+	if len(versionRange) < 2 {
+		return versionRange
+	}
+
+	open, close := versionRange[0], versionRange[len(versionRange)-1]
+	bounds := strings.Split(versionRange[1:len(versionRange)-1], ",")
+	if len(bounds) == 1 {
+		return "=" + strings.TrimSpace(bounds[0])
+	}
+
+	var constraints []string
+	if lower := strings.TrimSpace(bounds[0]); lower != "" {
+		if open == '(' {
+			constraints = append(constraints, ">"+lower)
+		} else {
+			constraints = append(constraints, ">="+lower)
+		}
+	}
+	if upper := strings.TrimSpace(bounds[1]); upper != "" {
+		if close == ')' {
+			constraints = append(constraints, "<"+upper)
+		} else {
+			constraints = append(constraints, "<="+upper)
+		}
+	}
+	return strings.Join(constraints, ", ")
+}
+
+// findCycles reports each dependency cycle in the resolved graph once, as the
+// path from the first artifact of the cycle back to itself
+func findCycles(artifacts []*ClosureArtifact, entries map[string]*ClosureArtifact) [][]string {
+	const (
+		unvisited = iota
+		onStack
+		done
+	)
+
+	cycles := [][]string{}
+	state := make(map[string]int)
+	var stack []string
+
+	var visit func(key string)
+	visit = func(key string) {
+		state[key] = onStack
+		stack = append(stack, key)
+
+		for _, dependency := range entries[key].Dependencies {
+			switch state[dependency] {
+			case unvisited:
+				visit(dependency)
+			case onStack:
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dependency {
+						cycle := append(append([]string{}, stack[i:]...), dependency)
+						cycles = append(cycles, cycle)
+						break
+					}
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[key] = done
+	}
+
+	for _, artifact := range artifacts {
+		key := closureKey(artifact.Name, artifact.Version)
+		if state[key] == unvisited {
+			visit(key)
+		}
+	}
+
+	return cycles
+}
@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createClosureTestArtifact records a published artifact with the given metadata
+func createClosureTestArtifact(t *testing.T, db *common.Database, registryType, name, version string, size int64, metadata types.JSONMap) {
+	require.NoError(t, db.Create(&types.Artifact{
+		Name: name, Version: version, Registry: registryType, Size: size,
+		StoragePath: registryType + "/" + name + "/" + version + "/" + name + "-" + version + ".tgz",
+		PublishedBy: uuid.New(), Status: types.ArtifactStatusPublished, Metadata: metadata,
+	}).Error)
+}
+
+func closureKeys(closure *Closure) []string {
+	keys := make([]string, 0, len(closure.Artifacts))
+	for _, artifact := range closure.Artifacts {
+		keys = append(keys, closureKey(artifact.Name, artifact.Version))
+	}
+	return keys
+}
+
+func TestResolveClosure(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	ctx := context.Background()
+
+	createClosureTestArtifact(t, db, "npm", "app", "1.0.0", 10, types.JSONMap{
+		"dependencies": map[string]interface{}{"lib": "^1.0.0", "util": "~2.1.0", "ghost": "^1.0.0"},
+	})
+	createClosureTestArtifact(t, db, "npm", "lib", "1.0.0", 20, nil)
+	createClosureTestArtifact(t, db, "npm", "lib", "1.4.0", 20, types.JSONMap{
+		"dependencies": map[string]interface{}{"util": "^2.0.0", "deep": "*"},
+	})
+	createClosureTestArtifact(t, db, "npm", "lib", "2.0.0", 20, nil)
+	createClosureTestArtifact(t, db, "npm", "util", "2.1.3", 30, types.JSONMap{
+		"dependencies": map[string]interface{}{"app": "1.0.0"},
+	})
+	createClosureTestArtifact(t, db, "npm", "util", "2.2.0", 30, nil)
+	createClosureTestArtifact(t, db, "npm", "deep", "1.0.0", 40, nil)
+	createClosureTestArtifact(t, db, "npm", "deep", "1.1.0-rc.1", 40, nil)
+
+	closure, err := service.ResolveClosure(ctx, "npm", "app", "1.0.0", DefaultClosureLimits)
+	require.NoError(t, err)
+
+	assert.Equal(t, "app@1.0.0", closure.Root)
+	// Each constraint resolves independently, so lib's looser range on util
+	// brings in a second version
+	assert.Equal(t, []string{"app@1.0.0", "lib@1.4.0", "util@2.1.3", "deep@1.0.0", "util@2.2.0"}, closureKeys(closure))
+	assert.Equal(t, int64(130), closure.TotalSize)
+	assert.Equal(t, "npm/deep/1.0.0/deep-1.0.0.tgz", closure.Artifacts[3].Path)
+	assert.Equal(t, 2, closure.Artifacts[3].Depth)
+
+	require.Len(t, closure.Unresolved, 1)
+	assert.Equal(t, "ghost", closure.Unresolved[0].Name)
+	assert.Equal(t, "app@1.0.0", closure.Unresolved[0].RequiredBy)
+
+	// util depends back on app
+	assert.Equal(t, [][]string{{"app@1.0.0", "util@2.1.3", "app@1.0.0"}}, closure.Cycles)
+}
+
+func TestResolveClosure_Limits(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	ctx := context.Background()
+
+	createClosureTestArtifact(t, db, "npm", "a", "1.0.0", 100, types.JSONMap{"dependencies": map[string]interface{}{"b": "1.0.0"}})
+	createClosureTestArtifact(t, db, "npm", "b", "1.0.0", 100, types.JSONMap{"dependencies": map[string]interface{}{"c": "1.0.0"}})
+	createClosureTestArtifact(t, db, "npm", "c", "1.0.0", 100, nil)
+
+	closure, err := service.ResolveClosure(ctx, "npm", "a", "1.0.0", ClosureLimits{MaxDepth: 1, MaxSize: 1000})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a@1.0.0", "b@1.0.0"}, closureKeys(closure))
+	require.Len(t, closure.Unresolved, 1)
+	assert.Equal(t, "c", closure.Unresolved[0].Name)
+	assert.Equal(t, "depth limit reached", closure.Unresolved[0].Reason)
+
+	_, err = service.ResolveClosure(ctx, "npm", "a", "1.0.0", ClosureLimits{MaxDepth: 10, MaxSize: 250})
+	assert.ErrorIs(t, err, ErrClosureTooLarge)
+
+	_, err = service.ResolveClosure(ctx, "npm", "a", "9.9.9", DefaultClosureLimits)
+	assert.ErrorIs(t, err, ErrPackageNotFound)
+}
+
+func TestResolveClosure_NuGetRanges(t *testing.T) {
+	service, db, _ := setupTestService(t)
+
+	createClosureTestArtifact(t, db, "nuget", "App", "1.0.0", 1, types.JSONMap{
+		"dependencyGroups": []interface{}{
+			map[string]interface{}{
+				"targetFramework": "net8.0",
+				"dependencies": []interface{}{
+					map[string]interface{}{"id": "Newtonsoft.Json", "version": "[12.0,13.0)"},
+					map[string]interface{}{"id": "Serilog", "version": "2.0"},
+				},
+			},
+		},
+	})
+	createClosureTestArtifact(t, db, "nuget", "Newtonsoft.Json", "12.0.3", 1, nil)
+	createClosureTestArtifact(t, db, "nuget", "Newtonsoft.Json", "13.0.1", 1, nil)
+	createClosureTestArtifact(t, db, "nuget", "Serilog", "3.1.0", 1, nil)
+
+	closure, err := service.ResolveClosure(context.Background(), "nuget", "app", "1.0.0", DefaultClosureLimits)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app@1.0.0", "newtonsoft.json@12.0.3", "serilog@3.1.0"}, closureKeys(closure))
+	assert.Empty(t, closure.Unresolved)
+}
+
+func TestNugetRangeConstraint(t *testing.T) {
+	tests := []struct {
+		versionRange string
+		want         string
+	}{
+		{"1.0", ">=1.0"},
+		{"[1.0]", "=1.0"},
+		{"[1.0,2.0)", ">=1.0, <2.0"},
+		{"(1.0,2.0]", ">1.0, <=2.0"},
+		{"(,2.0)", "<2.0"},
+		{"[1.0,)", ">=1.0"},
+	}
+
+	for _, tt := range tests {
+		if got := nugetRangeConstraint(tt.versionRange); got != tt.want {
+			t.Errorf("nugetRangeConstraint(%q) = %q, want %q", tt.versionRange, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// ErrUnexpectedContentFormat is returned for uploads whose magic bytes do not
+// match the registry's package format
+var ErrUnexpectedContentFormat = errors.New("content does not match the registry's package format")
+
+// registryContentFormats are the container formats each registry's packages
+// come in. Registries that accept loose files, such as Maven POMs and OCI
+// manifests, are not listed and accept any content.
+var registryContentFormats = map[string]utils.ContentFormat{
+	"npm":      utils.FormatGzip, // .tgz
+	"nuget":    utils.FormatZip,  // .nupkg and .snupkg
+	"go":       utils.FormatZip,  // module zip
+	"helm":     utils.FormatGzip, // .tgz chart
+	"cargo":    utils.FormatGzip, // .crate
+	"opa":      utils.FormatGzip, // .tar.gz bundle
+	"rubygems": utils.FormatTar,  // .gem
+	"debian":   utils.FormatAr,   // .deb
+	"rpm":      utils.FormatRPM,  // .rpm
+}
+
+// checkContentFormat rejects content that is not in the container format of
+// the registry's packages, so obviously wrong files fail with a clear error
+// before any registry-specific parsing
+func checkContentFormat(registryType string, content []byte) error {
+	expected, ok := registryContentFormats[registryType]
+	if !ok {
+		return nil
+	}
+
+	detected := utils.DetectContentFormat(content)
+	if detected == expected {
+		return nil
+	}
+	if detected == utils.FormatUnknown {
+		return fmt.Errorf("%w: expected %s %s content", ErrUnexpectedContentFormat, registryType, expected)
+	}
+	return fmt.Errorf("%w: expected %s %s content, got %s", ErrUnexpectedContentFormat, registryType, expected, detected)
+}
@@ -0,0 +1,185 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// blobStoragePrefix is where artifact content is stored once per SHA256,
+// however many artifacts have it
+const blobStoragePrefix = "blobs/sha256/"
+
+// contentAddress returns the storage path of the blob with a SHA256 in the
+// flat layout
+func contentAddress(sha256 string) string {
+	return blobStoragePrefix + sha256
+}
+
+// isContentAddressed reports whether a storage path is a deduplicated blob
+// rather than a path of the artifact's own. Artifacts stored before
+// deduplication, and OCI content, keep their own paths.
+func isContentAddressed(storagePath string) bool {
+	return strings.HasPrefix(storagePath, blobStoragePrefix)
+}
+
+// storagePath returns where the content of a new artifact is stored: its
+// content address in the service's layout, except for OCI artifacts which
+// the OCI routes store by repository
+func (s *Service) storagePath(handler Handler, artifact *types.Artifact) string {
+	if artifact.Registry == "oci" {
+		return handler.GenerateStoragePath(artifact.Name, artifact.Version)
+	}
+	return s.layout.BlobPath(artifact.SHA256)
+}
+
+// storeContent stores a new artifact's content with its handler, claiming
+// it as claimContent does
+func (s *Service) storeContent(ctx context.Context, handler Handler, artifact *types.Artifact, content []byte) error {
+	return s.claimContent(ctx, artifact, func() error {
+		return handler.Upload(ctx, artifact, content)
+	})
+}
+
+// storeSpooled moves a new artifact's content, which receiveContent streamed
+// into storage, to the artifact's storage path, claiming it as claimContent
+// does
+func (s *Service) storeSpooled(ctx context.Context, handler StreamingHandler, artifact *types.Artifact, content *receivedContent) error {
+	return s.claimContent(ctx, artifact, func() error {
+		artifact.ContentType = handler.ContentType(artifact)
+		if err := storage.Move(ctx, s.Storage, content.spoolPath, artifact.StoragePath, artifact.ContentType); err != nil {
+			return err
+		}
+		content.spoolPath = ""
+		return nil
+	})
+}
+
+// claimContent stores a new artifact's content with store. Content kept once
+// for all identical artifacts is claimed first, counting the new artifact's
+// reference before the blob is written, so removing another artifact with
+// the same content meanwhile cannot delete the blob from under it. The claim
+// is released if storing fails.
+func (s *Service) claimContent(ctx context.Context, artifact *types.Artifact, store func() error) error {
+	if isContentAddressed(artifact.StoragePath) {
+		if err := s.DB.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "storage_path"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("blob_refs.ref_count + 1")}),
+		}).Create(blobRef(artifact, 1)).Error; err != nil {
+			return fmt.Errorf("failed to claim blob: %w", err)
+		}
+	}
+
+	if err := store(); err != nil {
+		s.releaseContent(ctx, artifact)
+		return err
+	}
+	return nil
+}
+
+// createArtifact saves a new artifact whose content storeContent stored. If
+// saving fails, the artifact's claim on its content is released.
+func (s *Service) createArtifact(ctx context.Context, artifact *types.Artifact) error {
+	if err := s.DB.WithContext(ctx).Create(artifact).Error; err != nil {
+		s.releaseContent(ctx, artifact)
+		return err
+	}
+	return nil
+}
+
+// releaseContent drops the content of a new artifact that could not be
+// stored or saved, keeping content another artifact still refers to
+func (s *Service) releaseContent(ctx context.Context, artifact *types.Artifact) {
+	if !isContentAddressed(artifact.StoragePath) {
+		s.Storage.Delete(ctx, artifact.StoragePath)
+		return
+	}
+	if err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.releaseBlob(ctx, tx, artifact)
+	}); err != nil {
+		log.Warn().Err(err).Str("storage_path", artifact.StoragePath).Msg("Failed to release blob claim")
+	}
+}
+
+// removeArtifact permanently deletes an artifact and its content, keeping
+// content another artifact still refers to
+func (s *Service) removeArtifact(ctx context.Context, artifact *types.Artifact) error {
+	if !isContentAddressed(artifact.StoragePath) {
+		// Mounted OCI blobs share storage with the repository they came from
+		shared, err := s.isStorageShared(ctx, artifact)
+		if err != nil {
+			return err
+		}
+		if !shared {
+			if err := s.Storage.Delete(ctx, artifact.StoragePath); err != nil {
+				return fmt.Errorf("failed to delete artifact from storage: %w", err)
+			}
+		}
+		if err := s.DB.WithContext(ctx).Unscoped().Delete(artifact).Error; err != nil {
+			return fmt.Errorf("failed to delete artifact from database: %w", err)
+		}
+		return nil
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(artifact).Error; err != nil {
+			return fmt.Errorf("failed to delete artifact from database: %w", err)
+		}
+		return s.releaseBlob(ctx, tx, artifact)
+	})
+}
+
+// releaseBlob drops a reference to an artifact's blob within tx, deleting
+// the blob along with its last reference. The reference row stays locked
+// until tx ends, so an identical upload claiming the blob meanwhile waits
+// until the blob is gone before storing it again, and one that claimed it
+// first keeps it.
+func (s *Service) releaseBlob(ctx context.Context, tx *gorm.DB, artifact *types.Artifact) error {
+	// Content stored before it was counted has no reference, so one is
+	// created to hold the lock
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "storage_path"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("blob_refs.ref_count - 1")}),
+	}).Create(blobRef(artifact, 0)).Error; err != nil {
+		return fmt.Errorf("failed to release blob reference: %w", err)
+	}
+
+	result := tx.Where("storage_path = ? AND ref_count <= 0", artifact.StoragePath).Delete(&types.BlobRef{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove blob reference: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	// Content left behind is found by storage reconciliation
+	if err := s.Storage.Delete(ctx, artifact.StoragePath); err != nil {
+		log.Warn().Err(err).Str("storage_path", artifact.StoragePath).Msg("Failed to delete unreferenced blob")
+	}
+	return nil
+}
+
+// blobRef returns the reference to the blob an artifact's content is stored
+// in, counting count artifacts. Blobs are counted by storage path, so content
+// stored under more than one layout is counted once per copy.
+func blobRef(artifact *types.Artifact, count int64) *types.BlobRef {
+	return &types.BlobRef{StoragePath: artifact.StoragePath, SHA256: artifact.SHA256, Size: artifact.Size, RefCount: count}
+}
+
+// artifactFileName returns the name an artifact's content is downloaded as
+func (s *Service) artifactFileName(artifact *types.Artifact) string {
+	if !isContentAddressed(artifact.StoragePath) {
+		return path.Base(artifact.StoragePath)
+	}
+	if handler, ok := s.handlers[artifact.Registry]; ok {
+		return path.Base(handler.GenerateStoragePath(artifact.Name, artifact.Version))
+	}
+	return fmt.Sprintf("%s-%s", path.Base(artifact.Name), artifact.Version)
+}
@@ -0,0 +1,170 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blobRefCount returns the reference count of the blob stored at a path, or
+// -1 if it has none
+func blobRefCount(t *testing.T, service *Service, storagePath string) int64 {
+	t.Helper()
+	var ref types.BlobRef
+	if err := service.DB.Where("storage_path = ?", storagePath).First(&ref).Error; err != nil {
+		return -1
+	}
+	return ref.RefCount
+}
+
+func TestDedup_IdenticalUploadsShareBlob(t *testing.T) {
+	ctx := context.Background()
+	service := setupBackupService(t)
+	user := createTestUser(t, service.DB)
+
+	first, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+	second, err := service.Upload(ctx, "other", "left-pad-fork", "1.0.0", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+	distinct, err := service.Upload(ctx, "test", "left-pad", "2.0.0", bytes.NewReader([]byte("other content")), user.ID)
+	require.NoError(t, err)
+
+	assert.Equal(t, first.StoragePath, second.StoragePath)
+	assert.Equal(t, contentAddress(first.SHA256), first.StoragePath)
+	assert.NotEqual(t, first.StoragePath, distinct.StoragePath)
+	blobs, err := service.Storage.List(ctx, blobStoragePrefix)
+	require.NoError(t, err)
+	assert.Len(t, blobs, 2)
+	assert.Equal(t, int64(2), blobRefCount(t, service, first.StoragePath))
+
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "1.0.0", user.ID))
+	assert.Equal(t, int64(1), blobRefCount(t, service, first.StoragePath))
+	_, reader, err := service.Download(ctx, "other", "left-pad-fork", "1.0.0")
+	require.NoError(t, err, "the blob is kept while another artifact refers to it")
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "shared content", string(content))
+
+	require.NoError(t, service.Delete(ctx, "other", "left-pad-fork", "1.0.0", user.ID))
+	assert.Equal(t, int64(-1), blobRefCount(t, service, first.StoragePath))
+	exists, err := service.Storage.Exists(ctx, first.StoragePath)
+	require.NoError(t, err)
+	assert.False(t, exists, "the blob is removed with the last artifact referring to it")
+
+	exists, err = service.Storage.Exists(ctx, distinct.StoragePath)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestDedup_LayoutsCountedSeparately(t *testing.T) {
+	ctx := context.Background()
+	service := setupBackupService(t)
+	user := createTestUser(t, service.DB)
+
+	flat, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+
+	// Identical content stored after switching layouts is a second copy,
+	// counted on its own
+	service.SetPathLayout(ShardedLayout{})
+	sharded, err := service.Upload(ctx, "other", "left-pad-fork", "1.0.0", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+	require.NotEqual(t, flat.StoragePath, sharded.StoragePath)
+	assert.Equal(t, int64(1), blobRefCount(t, service, flat.StoragePath))
+	assert.Equal(t, int64(1), blobRefCount(t, service, sharded.StoragePath))
+
+	// Each copy is removed with the last artifact stored in it
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "1.0.0", user.ID))
+	exists, err := service.Storage.Exists(ctx, flat.StoragePath)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = service.Storage.Exists(ctx, sharded.StoragePath)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, service.Delete(ctx, "other", "left-pad-fork", "1.0.0", user.ID))
+	blobs, err := service.Storage.List(ctx, blobStoragePrefix)
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+}
+
+func TestDedup_SoftDeletedArtifactsKeepBlob(t *testing.T) {
+	ctx := context.Background()
+	service := setupBackupService(t)
+	service.Configure(config.RegistryConfig{DeleteGracePeriod: time.Hour})
+	user := createTestUser(t, service.DB)
+
+	first, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+	_, err = service.Upload(ctx, "test", "left-pad", "1.0.1", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+
+	// Deleted artifacts can be restored until they are purged, so they keep
+	// their reference
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "1.0.0", user.ID))
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "1.0.1", user.ID))
+	assert.Equal(t, int64(2), blobRefCount(t, service, first.StoragePath))
+
+	restored, err := service.Restore(ctx, "test", "left-pad", "1.0.0", user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, first.StoragePath, restored.StoragePath)
+
+	require.NoError(t, service.DB.Unscoped().Model(&types.Artifact{}).Where("deleted_at IS NOT NULL").
+		Update("deleted_at", time.Now().Add(-2*time.Hour)).Error)
+	purged, err := service.PurgeDeleted(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Equal(t, int64(1), blobRefCount(t, service, first.StoragePath))
+
+	_, reader, err := service.Download(ctx, "test", "left-pad", "1.0.0")
+	require.NoError(t, err)
+	reader.Close()
+}
+
+func TestDedup_RemovalKeepsBlobClaimedByUpload(t *testing.T) {
+	ctx := context.Background()
+	service := setupBackupService(t)
+	user := createTestUser(t, service.DB)
+
+	first, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+
+	// An identical upload has stored its content but not yet saved its
+	// artifact when the first artifact is removed
+	second := &types.Artifact{
+		Name: "left-pad-fork", Version: "1.0.0", Registry: "other", Status: types.ArtifactStatusPublished,
+		SHA256: first.SHA256, Size: first.Size, StoragePath: first.StoragePath, PublishedBy: user.ID,
+	}
+	require.NoError(t, service.storeContent(ctx, service.handlers["other"], second, []byte("shared content")))
+	require.NoError(t, service.removeArtifact(ctx, first))
+
+	exists, err := service.Storage.Exists(ctx, first.StoragePath)
+	require.NoError(t, err)
+	assert.True(t, exists, "the blob claimed by the upload is kept")
+	assert.Equal(t, int64(1), blobRefCount(t, service, first.StoragePath))
+
+	require.NoError(t, service.createArtifact(ctx, second))
+	_, reader, err := service.Download(ctx, "other", "left-pad-fork", "1.0.0")
+	require.NoError(t, err)
+	reader.Close()
+
+	// A claim whose artifact fails to be saved is released with the blob
+	duplicate := *second
+	require.NoError(t, service.storeContent(ctx, service.handlers["other"], &duplicate, []byte("shared content")))
+	assert.Equal(t, int64(2), blobRefCount(t, service, first.StoragePath))
+	assert.Error(t, service.createArtifact(ctx, &duplicate))
+	assert.Equal(t, int64(1), blobRefCount(t, service, first.StoragePath))
+
+	require.NoError(t, service.removeArtifact(ctx, second))
+	exists, err = service.Storage.Exists(ctx, first.StoragePath)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
@@ -0,0 +1,84 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// ErrDeprecationForbidden is returned when a user who cannot publish a
+// package tries to deprecate its versions
+var ErrDeprecationForbidden = errors.New("insufficient permissions to deprecate package")
+
+// deprecatedMetadataKey is the artifact metadata field holding the
+// deprecation message of a version
+const deprecatedMetadataKey = "deprecated"
+
+// Deprecate sets the deprecation messages of versions of a package, given by
+// version. An empty message clears a version's deprecation. Deprecated
+// versions stay downloadable. It returns how many versions were changed.
+func (s *Service) Deprecate(ctx context.Context, registryType, name string, messages map[string]string, userID uuid.UUID) (int, error) {
+	canPublish, err := s.Ownership.CanUserPublish(ctx, registryType, name, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check deprecate permissions: %w", err)
+	}
+	if !canPublish {
+		return 0, ErrDeprecationForbidden
+	}
+
+	var changed []*types.Artifact
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for version, message := range messages {
+			var artifact types.Artifact
+			if err := tx.Where("LOWER(name) = LOWER(?) AND version = ? AND registry = ?", name, version, registryType).
+				First(&artifact).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+				}
+				return fmt.Errorf("failed to get artifact: %w", err)
+			}
+
+			current, _ := artifact.Metadata[deprecatedMetadataKey].(string)
+			if current == message {
+				continue
+			}
+			if artifact.Metadata == nil {
+				artifact.Metadata = make(types.JSONMap)
+			}
+			if message == "" {
+				delete(artifact.Metadata, deprecatedMetadataKey)
+			} else {
+				artifact.Metadata[deprecatedMetadataKey] = message
+			}
+			if err := tx.Model(&artifact).Update("metadata", artifact.Metadata).Error; err != nil {
+				return fmt.Errorf("failed to update artifact metadata: %w", err)
+			}
+			changed = append(changed, &artifact)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, artifact := range changed {
+		s.auditLog.Record(ctx, userID, audit.ActionPackageDeprecate, audit.PackageTarget(registryType, artifact.Name, artifact.Version), map[string]interface{}{
+			"message": messages[artifact.Version],
+		})
+	}
+	if len(changed) > 0 {
+		log.Info().
+			Str("registry", registryType).
+			Str("name", name).
+			Int("versions", len(changed)).
+			Str("user_id", userID.String()).
+			Msg("Package deprecation updated")
+	}
+	return len(changed), nil
+}
@@ -0,0 +1,271 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// DistTagLatest is the dist-tag installs resolve to when no version is given
+const DistTagLatest = "latest"
+
+var (
+	// ErrDistTagForbidden is returned when a user who cannot publish a package
+	// tries to change its dist-tags
+	ErrDistTagForbidden = errors.New("insufficient permissions to change dist-tags")
+
+	// ErrDistTagNotFound is returned when removing a dist-tag a package does not have
+	ErrDistTagNotFound = errors.New("dist-tag not found")
+
+	// ErrInvalidDistTag is returned for a dist-tag name that cannot be used,
+	// such as one that is also a version range
+	ErrInvalidDistTag = errors.New("invalid dist-tag")
+)
+
+// GetDistTags returns the dist-tags of a package. Tags pointing at versions
+// that no longer exist are left out, and latest is the newest stable version
+// unless it was set explicitly. Packages the request cannot read are not
+// found.
+func (s *Service) GetDistTags(ctx context.Context, registryType, name string) (map[string]string, error) {
+	readable, err := s.CanReadPackage(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+	if !readable {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, name)
+	}
+
+	versions, err := s.publishedVersions(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := s.storedDistTags(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+	return resolveDistTags(stored, versions), nil
+}
+
+// SetDistTag points a dist-tag of a package at one of its versions and
+// returns the package's dist-tags. Only users who can publish the package may
+// change its tags.
+func (s *Service) SetDistTag(ctx context.Context, registryType, name, tag, version string, userID uuid.UUID) (map[string]string, error) {
+	if err := validateDistTag(tag); err != nil {
+		return nil, err
+	}
+	if err := s.checkDistTagPermission(ctx, registryType, name, userID); err != nil {
+		return nil, err
+	}
+
+	versions, err := s.publishedVersions(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(versions, version) {
+		return nil, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+	}
+
+	stored, err := s.updateDistTags(ctx, registryType, name, func(tags map[string]string) error {
+		tags[tag] = version
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionPackageTag, audit.PackageTarget(registryType, name, version), map[string]interface{}{
+		"tag": tag,
+	})
+	log.Info().
+		Str("registry", registryType).
+		Str("name", name).
+		Str("tag", tag).
+		Str("version", version).
+		Str("user_id", userID.String()).
+		Msg("Package dist-tag set")
+	return resolveDistTags(stored, versions), nil
+}
+
+// RemoveDistTag removes a dist-tag of a package and returns the package's
+// remaining dist-tags. The latest tag cannot be removed.
+func (s *Service) RemoveDistTag(ctx context.Context, registryType, name, tag string, userID uuid.UUID) (map[string]string, error) {
+	if tag == DistTagLatest {
+		return nil, fmt.Errorf("%w: %s cannot be removed", ErrInvalidDistTag, DistTagLatest)
+	}
+	if err := s.checkDistTagPermission(ctx, registryType, name, userID); err != nil {
+		return nil, err
+	}
+
+	versions, err := s.publishedVersions(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed string
+	stored, err := s.updateDistTags(ctx, registryType, name, func(tags map[string]string) error {
+		version, ok := tags[tag]
+		if !ok || !slices.Contains(versions, version) {
+			return fmt.Errorf("%w: %s", ErrDistTagNotFound, tag)
+		}
+		removed = version
+		delete(tags, tag)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionPackageUntag, audit.PackageTarget(registryType, name, removed), map[string]interface{}{
+		"tag": tag,
+	})
+	log.Info().
+		Str("registry", registryType).
+		Str("name", name).
+		Str("tag", tag).
+		Str("user_id", userID.String()).
+		Msg("Package dist-tag removed")
+	return resolveDistTags(stored, versions), nil
+}
+
+// TagPublishedVersion records the dist-tags a version was published with.
+// The latest tag is not stored, so it keeps following the newest stable
+// version; publishing a version newer than an explicitly set latest releases
+// it to do so again. Failures are logged rather than failing the publish.
+func (s *Service) TagPublishedVersion(ctx context.Context, registryType, name, version string, tags map[string]string) {
+	_, err := s.updateDistTags(ctx, registryType, name, func(stored map[string]string) error {
+		for tag, tagged := range tags {
+			if tagged != version || validateDistTag(tag) != nil {
+				continue
+			}
+			if tag != DistTagLatest {
+				stored[tag] = version
+			} else if pinned, ok := stored[DistTagLatest]; ok && utils.CompareVersions(version, pinned) > 0 {
+				delete(stored, DistTagLatest)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("name", name).Str("version", version).Msg("Failed to store package dist-tags")
+	}
+}
+
+// checkDistTagPermission checks that a user may change a package's dist-tags
+func (s *Service) checkDistTagPermission(ctx context.Context, registryType, name string, userID uuid.UUID) error {
+	canPublish, err := s.Ownership.CanUserPublish(ctx, registryType, name, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check dist-tag permissions: %w", err)
+	}
+	if !canPublish {
+		return ErrDistTagForbidden
+	}
+	return nil
+}
+
+// publishedVersions returns the published versions of a package
+func (s *Service) publishedVersions(ctx context.Context, registryType, name string) ([]string, error) {
+	var versions []string
+	if err := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+		Where("normalized_name = ? AND registry = ? AND status = ?",
+			utils.NormalizePackageName(name, registryType), registryType, types.ArtifactStatusPublished).
+		Pluck("version", &versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get package versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrArtifactNotFound, name)
+	}
+	return versions, nil
+}
+
+// storedDistTags returns the dist-tags stored for a package, without latest
+// when it follows the newest version
+func (s *Service) storedDistTags(ctx context.Context, registryType, name string) (map[string]string, error) {
+	var metadata types.PackageMetadata
+	err := s.DB.WithContext(ctx).
+		Where("registry = ? AND LOWER(name) = LOWER(?)", registryType, name).
+		First(&metadata).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get package metadata: %w", err)
+	}
+	return metadata.DistTags, nil
+}
+
+// updateDistTags applies update to the stored dist-tags of a package and
+// returns them
+func (s *Service) updateDistTags(ctx context.Context, registryType, name string, update func(tags map[string]string) error) (map[string]string, error) {
+	var metadata types.PackageMetadata
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("registry = ? AND LOWER(name) = LOWER(?)", registryType, name).First(&metadata).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			metadata = types.PackageMetadata{Registry: registryType, Name: name}
+		case err != nil:
+			return fmt.Errorf("failed to get package metadata: %w", err)
+		}
+		if metadata.DistTags == nil {
+			metadata.DistTags = make(map[string]string)
+		}
+
+		if err := update(metadata.DistTags); err != nil {
+			return err
+		}
+		if err := tx.Save(&metadata).Error; err != nil {
+			return fmt.Errorf("failed to store package dist-tags: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metadata.DistTags, nil
+}
+
+// resolveDistTags returns the stored tags that point at one of versions, with
+// latest set to the newest stable version, or the newest prerelease when
+// there are no stable versions, unless it was stored
+func resolveDistTags(stored map[string]string, versions []string) map[string]string {
+	tags := make(map[string]string, len(stored)+1)
+	for tag, version := range stored {
+		if slices.Contains(versions, version) {
+			tags[tag] = version
+		}
+	}
+	if _, ok := tags[DistTagLatest]; ok || len(versions) == 0 {
+		return tags
+	}
+
+	stable := make([]string, 0, len(versions))
+	for _, version := range versions {
+		if !utils.IsPrerelease(version) {
+			stable = append(stable, version)
+		}
+	}
+	if len(stable) > 0 {
+		tags[DistTagLatest] = utils.GetLatestVersion(stable)
+	} else {
+		tags[DistTagLatest] = utils.GetLatestVersion(versions)
+	}
+	return tags
+}
+
+// validateDistTag checks that a tag can be told apart from a version, as npm
+// resolves a name@spec to a tag only when the spec is not a version range
+func validateDistTag(tag string) error {
+	if tag == "" || strings.TrimSpace(tag) != tag || strings.Contains(tag, "/") {
+		return fmt.Errorf("%w %q", ErrInvalidDistTag, tag)
+	}
+	if _, err := semver.NewConstraint(tag); err == nil {
+		return fmt.Errorf("%w %q: tags cannot be version ranges", ErrInvalidDistTag, tag)
+	}
+	return nil
+}
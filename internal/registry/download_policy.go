@@ -0,0 +1,23 @@
+package registry
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// ErrDownloadBlocked is returned when a download policy refuses an artifact
+var ErrDownloadBlocked = errors.New("download blocked by policy")
+
+// DownloadPolicy decides whether a published artifact may be downloaded.
+// CheckDownload returns an error wrapping ErrDownloadBlocked to refuse it.
+type DownloadPolicy interface {
+	CheckDownload(ctx context.Context, artifact *types.Artifact) error
+}
+
+// SetDownloadPolicy sets the policy artifacts are checked against before
+// their content is served; nil allows every download
+func (s *Service) SetDownloadPolicy(policy DownloadPolicy) {
+	s.downloadPolicy = policy
+}
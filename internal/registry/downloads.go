@@ -0,0 +1,348 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/metadata"
+	"github.com/lgulliver/lodestone/pkg/throttle"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// downloadEventBatchSize is how many download events are inserted per
+// statement when a batch is flushed
+const downloadEventBatchSize = 500
+
+// maxPendingDownloadEvents bounds the download events held while flushes
+// fail, so an unavailable database does not exhaust memory. Events past it
+// are dropped; their downloads are still counted.
+const maxPendingDownloadEvents = 100000
+
+// downloadBatch accumulates download counts and events between flushes
+type downloadBatch struct {
+	mu      sync.Mutex
+	counts  map[uuid.UUID]int64
+	events  []metadata.DownloadEvent
+	dropped int // events dropped since the last flush
+
+	// maxEvents overrides maxPendingDownloadEvents when positive
+	maxEvents int
+
+	// queued is set while a flush brought forward by the flush size is
+	// waiting to run, so that downloads past the size start only one
+	queued atomic.Bool
+
+	// flushing serializes flushes
+	flushing sync.Mutex
+}
+
+// limit returns how many events the batch holds at most
+func (b *downloadBatch) limit() int {
+	if b.maxEvents > 0 {
+		return b.maxEvents
+	}
+	return maxPendingDownloadEvents
+}
+
+// add queues a download and returns how many events are pending. Once the
+// batch holds its limit of events the download is only counted.
+func (b *downloadBatch) add(event metadata.DownloadEvent) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.counts == nil {
+		b.counts = make(map[uuid.UUID]int64)
+	}
+	b.counts[event.ArtifactID]++
+	if len(b.events) < b.limit() {
+		b.events = append(b.events, event)
+	} else {
+		b.dropped++
+	}
+	return len(b.events)
+}
+
+// take empties the batch, returning what was pending and how many events
+// were dropped since the last take
+func (b *downloadBatch) take() (map[uuid.UUID]int64, []metadata.DownloadEvent, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	counts, events, dropped := b.counts, b.events, b.dropped
+	b.counts, b.events, b.dropped = nil, nil, 0
+	b.queued.Store(false)
+	return counts, events, dropped
+}
+
+// requeue puts back counts and events that failed to be written, so the next
+// flush writes them. Counts are always kept; the oldest events are dropped
+// past the batch's limit, returning how many were.
+func (b *downloadBatch) requeue(counts map[uuid.UUID]int64, events []metadata.DownloadEvent) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.counts == nil {
+		b.counts = make(map[uuid.UUID]int64)
+	}
+	for id, n := range counts {
+		b.counts[id] += n
+	}
+	b.events = append(events, b.events...)
+	dropped := max(len(b.events)-b.limit(), 0)
+	b.events = b.events[dropped:]
+	return dropped
+}
+
+// recordDownload counts a download of an artifact and records its event.
+// Without a flush interval both are written immediately; otherwise they wait
+// for the next flush, which is brought forward once the flush size is reached.
+func (s *Service) recordDownload(ctx context.Context, artifact *types.Artifact) {
+	event := metadata.DownloadEvent{
+		ID:         uuid.New(),
+		ArtifactID: artifact.ID,
+		IPAddress:  audit.SourceIP(ctx),
+		Registry:   artifact.Registry,
+		Name:       artifact.Name,
+		Version:    artifact.Version,
+		Timestamp:  time.Now(),
+	}
+	if client, ok := throttle.ClientFromContext(ctx); ok && client.Authenticated {
+		if userID, err := uuid.Parse(client.ID); err == nil {
+			event.UserID = &userID
+		}
+	}
+
+	if s.config.DownloadFlushInterval <= 0 {
+		counts := map[uuid.UUID]int64{artifact.ID: 1}
+		if _, _, err := s.writeDownloads(context.WithoutCancel(ctx), counts, []metadata.DownloadEvent{event}); err != nil {
+			log.Error().Err(err).Str("artifact_id", artifact.ID.String()).Msg("Failed to record download")
+		}
+		return
+	}
+
+	pending := s.downloads.add(event)
+	if s.config.DownloadFlushSize > 0 && pending >= s.config.DownloadFlushSize && s.downloads.queued.CompareAndSwap(false, true) {
+		go func() {
+			if err := s.FlushDownloads(context.Background()); err != nil {
+				log.Error().Err(err).Msg("Failed to flush downloads")
+			}
+		}()
+	}
+}
+
+// FlushDownloads writes the download counts and events waiting for the next
+// flush. Whatever fails to be written is kept for the following flush, except
+// events past the limit held, which are dropped with a warning.
+func (s *Service) FlushDownloads(ctx context.Context) error {
+	s.downloads.flushing.Lock()
+	defer s.downloads.flushing.Unlock()
+
+	counts, events, dropped := s.downloads.take()
+	if len(counts) == 0 && len(events) == 0 {
+		return nil
+	}
+
+	failedCounts, failedEvents, err := s.writeDownloads(ctx, counts, events)
+	if err != nil {
+		dropped += s.downloads.requeue(failedCounts, failedEvents)
+	}
+	if dropped > 0 {
+		log.Warn().Int("dropped", dropped).Int("limit", s.downloads.limit()).Msg("Dropped download events past the limit held while flushes failed; their downloads are still counted")
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Debug().Int("artifacts", len(counts)).Int("events", len(events)).Msg("Flushed downloads")
+	return nil
+}
+
+// writeDownloads adds download counts to their artifacts and inserts download
+// events, returning the counts and events that failed to be written. Events
+// of artifacts purged since their download, and any others the database
+// refuses as violating a constraint, are dropped rather than returned, as
+// they could never be written.
+func (s *Service) writeDownloads(ctx context.Context, counts map[uuid.UUID]int64, events []metadata.DownloadEvent) (map[uuid.UUID]int64, []metadata.DownloadEvent, error) {
+	var (
+		errs         []error
+		failedCounts = make(map[uuid.UUID]int64)
+		failedEvents []metadata.DownloadEvent
+	)
+
+	// A download does not modify the artifact, so updated_at is not touched
+	for id, n := range counts {
+		if err := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+			Where("id = ?", id).
+			UpdateColumn("downloads", gorm.Expr("downloads + ?", n)).Error; err != nil {
+			errs = append(errs, fmt.Errorf("failed to update download count: %w", err))
+			failedCounts[id] = n
+		}
+	}
+
+	events, err := s.existingArtifactEvents(ctx, events)
+	if err != nil {
+		return failedCounts, events, errors.Join(append(errs, err)...)
+	}
+
+	// ip_address is an inet column, so events without one leave it NULL
+	var withIP, withoutIP []metadata.DownloadEvent
+	for _, event := range events {
+		if event.IPAddress != "" {
+			withIP = append(withIP, event)
+		} else {
+			withoutIP = append(withoutIP, event)
+		}
+	}
+	if len(withIP) > 0 {
+		failed, err := s.insertDownloadEvents(s.DB.WithContext(ctx), withIP)
+		if err != nil {
+			errs = append(errs, err)
+			failedEvents = append(failedEvents, failed...)
+		}
+	}
+	if len(withoutIP) > 0 {
+		failed, err := s.insertDownloadEvents(s.DB.WithContext(ctx).Omit("ip_address"), withoutIP)
+		if err != nil {
+			errs = append(errs, err)
+			failedEvents = append(failedEvents, failed...)
+		}
+	}
+
+	return failedCounts, failedEvents, errors.Join(errs...)
+}
+
+// existingArtifactEvents returns the events whose artifact still exists,
+// soft-deleted or not. An artifact purged between a download and the flush
+// writing it would otherwise fail the whole batch on the events' foreign key.
+func (s *Service) existingArtifactEvents(ctx context.Context, events []metadata.DownloadEvent) ([]metadata.DownloadEvent, error) {
+	if len(events) == 0 {
+		return events, nil
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var ids []uuid.UUID
+	for _, event := range events {
+		if !seen[event.ArtifactID] {
+			seen[event.ArtifactID] = true
+			ids = append(ids, event.ArtifactID)
+		}
+	}
+
+	var existing []uuid.UUID
+	if err := s.DB.WithContext(ctx).Unscoped().Model(&types.Artifact{}).
+		Where("id IN ?", ids).
+		Pluck("id", &existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up downloaded artifacts: %w", err)
+	}
+	exists := make(map[uuid.UUID]bool, len(existing))
+	for _, id := range existing {
+		exists[id] = true
+	}
+
+	kept := events[:0:0]
+	for _, event := range events {
+		if exists[event.ArtifactID] {
+			kept = append(kept, event)
+		}
+	}
+	if dropped := len(events) - len(kept); dropped > 0 {
+		log.Warn().Int("dropped", dropped).Msg("Dropped download events of artifacts deleted before they were flushed")
+	}
+	return kept, nil
+}
+
+// insertDownloadEvents inserts events in batches, returning those that
+// failed to be written. A batch refused for violating a constraint is
+// inserted again one event at a time, so that only the events at fault are
+// dropped instead of failing every later flush.
+func (s *Service) insertDownloadEvents(db *gorm.DB, events []metadata.DownloadEvent) ([]metadata.DownloadEvent, error) {
+	// db is used for several statements
+	db = db.Session(&gorm.Session{})
+
+	err := db.CreateInBatches(events, downloadEventBatchSize).Error
+	if err == nil {
+		return nil, nil
+	}
+	if !isConstraintViolation(err) {
+		return events, fmt.Errorf("failed to record download events: %w", err)
+	}
+
+	var (
+		errs    []error
+		failed  []metadata.DownloadEvent
+		dropped int
+	)
+	for _, event := range events {
+		// A failed batch may have inserted some events before the one at fault
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&event).Error; err != nil {
+			if isConstraintViolation(err) {
+				dropped++
+				continue
+			}
+			errs = append(errs, fmt.Errorf("failed to record download events: %w", err))
+			failed = append(failed, event)
+		}
+	}
+	if dropped > 0 {
+		log.Warn().Err(err).Int("dropped", dropped).Msg("Dropped download events refused by the database")
+	}
+	return failed, errors.Join(errs...)
+}
+
+// isConstraintViolation reports whether the database refused a statement for
+// violating an integrity constraint, which retrying it cannot fix
+func isConstraintViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "23")
+}
+
+// DownloadFlushWorker flushes batched downloads periodically in the background
+type DownloadFlushWorker struct {
+	service  *Service
+	interval time.Duration
+}
+
+// NewDownloadFlushWorker creates a worker that flushes the service's batched
+// downloads every interval
+func NewDownloadFlushWorker(service *Service, interval time.Duration) *DownloadFlushWorker {
+	return &DownloadFlushWorker{service: service, interval: interval}
+}
+
+// Start flushes batched downloads every interval until ctx is done. It
+// returns immediately; a non-positive interval disables the worker, as
+// downloads are then written as they happen. Downloads batched after ctx is
+// done are written by a final FlushDownloads.
+func (w *DownloadFlushWorker) Start(ctx context.Context) {
+	if w.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.service.FlushDownloads(ctx); err != nil {
+					log.Error().Err(err).Msg("Failed to flush downloads")
+				}
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", w.interval).Msg("Download flush worker started")
+}
@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupDownloadTest returns a service batching downloads as configured and a
+// published artifact to download
+func setupDownloadTest(t *testing.T, cfg config.RegistryConfig) (*Service, *types.Artifact) {
+	t.Helper()
+
+	db := setupTestDB(t)
+	// Downloads run concurrently, and each extra connection would open its
+	// own empty in-memory database
+	sqlDB, err := db.DB.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	service := NewService(db, localStorage)
+	service.Configure(cfg)
+
+	user := createTestUser(t, db)
+	artifact := &types.Artifact{
+		Name:        "left-pad",
+		Version:     "1.0.0",
+		Registry:    "npm",
+		StoragePath: "npm/left-pad/1.0.0/artifact",
+		PublishedBy: user.ID,
+		Status:      types.ArtifactStatusPublished,
+	}
+	require.NoError(t, db.Create(artifact).Error)
+	require.NoError(t, localStorage.Store(context.Background(), artifact.StoragePath, strings.NewReader("content"), "application/octet-stream"))
+	return service, artifact
+}
+
+// downloadCount returns the stored download count of an artifact
+func downloadCount(t *testing.T, service *Service, artifact *types.Artifact) int64 {
+	t.Helper()
+
+	var stored types.Artifact
+	require.NoError(t, service.DB.First(&stored, "id = ?", artifact.ID).Error)
+	return stored.Downloads
+}
+
+func TestDownload_BatchedUntilFlush(t *testing.T) {
+	service, artifact := setupDownloadTest(t, config.RegistryConfig{DownloadFlushInterval: time.Hour})
+	ctx := audit.WithSourceIP(context.Background(), "192.0.2.1")
+
+	const downloads = 200
+	var wg sync.WaitGroup
+	for range downloads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, content, err := service.Download(ctx, "npm", "left-pad", "1.0.0")
+			if assert.NoError(t, err) {
+				io.Copy(io.Discard, content)
+				content.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Nothing is written until the batch is flushed
+	assert.Zero(t, downloadCount(t, service, artifact))
+
+	require.NoError(t, service.FlushDownloads(ctx))
+	assert.Equal(t, int64(downloads), downloadCount(t, service, artifact))
+
+	var events []testDownloadEvent
+	require.NoError(t, service.DB.Find(&events).Error)
+	require.Len(t, events, downloads)
+	assert.Equal(t, artifact.ID.String(), events[0].ArtifactID)
+	assert.Equal(t, "192.0.2.1", events[0].IPAddress)
+
+	// A flush with nothing pending writes nothing more
+	require.NoError(t, service.FlushDownloads(ctx))
+	assert.Equal(t, int64(downloads), downloadCount(t, service, artifact))
+}
+
+func TestDownload_FlushedAtSize(t *testing.T) {
+	service, artifact := setupDownloadTest(t, config.RegistryConfig{DownloadFlushInterval: time.Hour, DownloadFlushSize: 10})
+	ctx := context.Background()
+
+	for range 10 {
+		_, content, err := service.Download(ctx, "npm", "left-pad", "1.0.0")
+		require.NoError(t, err)
+		content.Close()
+	}
+
+	assert.Eventually(t, func() bool {
+		return downloadCount(t, service, artifact) == 10
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestDownload_FailedFlushRetried(t *testing.T) {
+	service, artifact := setupDownloadTest(t, config.RegistryConfig{DownloadFlushInterval: time.Hour})
+	ctx := context.Background()
+
+	_, content, err := service.Download(ctx, "npm", "left-pad", "1.0.0")
+	require.NoError(t, err)
+	content.Close()
+
+	// Events that cannot be written are kept, without counting twice
+	require.NoError(t, service.DB.Migrator().DropTable(&testDownloadEvent{}))
+	assert.Error(t, service.FlushDownloads(ctx))
+	assert.Equal(t, int64(1), downloadCount(t, service, artifact))
+
+	require.NoError(t, service.DB.AutoMigrate(&testDownloadEvent{}))
+	require.NoError(t, service.FlushDownloads(ctx))
+	assert.Equal(t, int64(1), downloadCount(t, service, artifact))
+
+	var events int64
+	require.NoError(t, service.DB.Model(&testDownloadEvent{}).Count(&events).Error)
+	assert.Equal(t, int64(1), events)
+}
+
+func TestDownload_FailedFlushesDropEventsPastLimit(t *testing.T) {
+	service, artifact := setupDownloadTest(t, config.RegistryConfig{DownloadFlushInterval: time.Hour})
+	service.downloads.maxEvents = 3
+	ctx := context.Background()
+
+	download := func() {
+		_, content, err := service.Download(ctx, "npm", "left-pad", "1.0.0")
+		require.NoError(t, err)
+		content.Close()
+	}
+	for range 2 {
+		download()
+	}
+
+	// Events that keep failing to be written are held only up to the limit,
+	// while every download is still counted
+	require.NoError(t, service.DB.Migrator().DropTable(&testDownloadEvent{}))
+	assert.Error(t, service.FlushDownloads(ctx))
+	for range 3 {
+		download()
+	}
+	assert.Error(t, service.FlushDownloads(ctx))
+	assert.Len(t, service.downloads.events, 3)
+
+	require.NoError(t, service.DB.AutoMigrate(&testDownloadEvent{}))
+	require.NoError(t, service.FlushDownloads(ctx))
+	assert.Equal(t, int64(5), downloadCount(t, service, artifact))
+
+	var events int64
+	require.NoError(t, service.DB.Model(&testDownloadEvent{}).Count(&events).Error)
+	assert.Equal(t, int64(3), events)
+}
+
+func TestDownload_ArtifactDeletedBeforeFlush(t *testing.T) {
+	service, artifact := setupDownloadTest(t, config.RegistryConfig{DownloadFlushInterval: time.Hour})
+	ctx := context.Background()
+
+	deleted := &types.Artifact{
+		Name:        "right-pad",
+		Version:     "1.0.0",
+		Registry:    "npm",
+		StoragePath: "npm/right-pad/1.0.0/artifact",
+		PublishedBy: artifact.PublishedBy,
+		Status:      types.ArtifactStatusPublished,
+	}
+	require.NoError(t, service.DB.Create(deleted).Error)
+	require.NoError(t, service.Storage.Store(ctx, deleted.StoragePath, strings.NewReader("content"), "application/octet-stream"))
+
+	for _, name := range []string{"left-pad", "right-pad"} {
+		_, content, err := service.Download(ctx, "npm", name, "1.0.0")
+		require.NoError(t, err)
+		content.Close()
+	}
+
+	// An artifact purged before the flush does not fail it, and its event is
+	// dropped rather than held for every later flush
+	require.NoError(t, service.DB.Unscoped().Delete(deleted).Error)
+	require.NoError(t, service.FlushDownloads(ctx))
+	assert.Empty(t, service.downloads.events)
+	assert.Equal(t, int64(1), downloadCount(t, service, artifact))
+
+	var events []testDownloadEvent
+	require.NoError(t, service.DB.Find(&events).Error)
+	require.Len(t, events, 1)
+	assert.Equal(t, artifact.ID.String(), events[0].ArtifactID)
+}
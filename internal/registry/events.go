@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// Package lifecycle event types sent to the EventNotifier
+const (
+	EventPackagePublished = "package.published"
+	EventPackageDeleted   = "package.deleted"
+)
+
+// PackageEvent describes a change to the published versions of a package
+type PackageEvent struct {
+	Type     string          `json:"type"`
+	Artifact *types.Artifact `json:"artifact"`
+	Actor    uuid.UUID       `json:"actor"`
+}
+
+// EventNotifier is notified when package versions are published or deleted.
+// Implementations must not block, since they are called on the request path.
+type EventNotifier interface {
+	NotifyEvent(ctx context.Context, event PackageEvent)
+}
+
+// EventNotifiers sends each event to every notifier in the list, so several
+// notifiers can be set at once
+type EventNotifiers []EventNotifier
+
+// NotifyEvent sends event to every notifier in order
+func (n EventNotifiers) NotifyEvent(ctx context.Context, event PackageEvent) {
+	for _, notifier := range n {
+		notifier.NotifyEvent(ctx, event)
+	}
+}
+
+// SetEventNotifier sets the notifier used for package lifecycle events; nil
+// disables notifications
+func (s *Service) SetEventNotifier(notifier EventNotifier) {
+	s.eventNotifier = notifier
+}
+
+// notifyEvent sends a package lifecycle event to the configured notifier
+func (s *Service) notifyEvent(ctx context.Context, eventType string, artifact *types.Artifact, actor uuid.UUID) {
+	if s.eventNotifier == nil {
+		return
+	}
+	s.eventNotifier.NotifyEvent(ctx, PackageEvent{
+		Type:     eventType,
+		Artifact: artifact,
+		Actor:    actor,
+	})
+}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"github.com/lgulliver/lodestone/internal/registry/registries/cargo"
+	"github.com/lgulliver/lodestone/internal/registry/registries/debian"
 	goregistry "github.com/lgulliver/lodestone/internal/registry/registries/go"
 	"github.com/lgulliver/lodestone/internal/registry/registries/helm"
 	"github.com/lgulliver/lodestone/internal/registry/registries/maven"
@@ -9,6 +10,7 @@ import (
 	"github.com/lgulliver/lodestone/internal/registry/registries/nuget"
 	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
 	"github.com/lgulliver/lodestone/internal/registry/registries/opa"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rpm"
 	"github.com/lgulliver/lodestone/internal/registry/registries/rubygems"
 )
 
@@ -45,6 +47,10 @@ func (f *Factory) GetRegistryHandler(format string) Handler {
 		return rubygems.New(f.service.Storage, f.service.DB)
 	case "opa":
 		return opa.New(f.service.Storage, f.service.DB)
+	case "debian":
+		return debian.New(f.service.Storage, f.service.DB)
+	case "rpm":
+		return rpm.New(f.service.Storage, f.service.DB)
 	default:
 		// Return a generic handler or null handler as fallback
 		return nil
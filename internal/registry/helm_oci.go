@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/registry/registries/helm"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// PublishOCIHelmChart publishes a Helm chart pushed to an OCI repository with
+// helm push to the classic chart repository too, so index.yaml lists it and
+// helm repo clients can install it. The chart is published under the name and
+// version in its Chart.yaml, with its provenance file if it was pushed with
+// one. It returns nil without error when the manifest is not a Helm chart,
+// and the published chart when the same chart was published before.
+func (s *Service) PublishOCIHelmChart(ctx context.Context, repository string, manifest []byte, publishedBy uuid.UUID) (*types.Artifact, error) {
+	layers, ok := oci.HelmChart(manifest)
+	if !ok {
+		return nil, nil
+	}
+
+	ociRegistry, ok := s.handlers["oci"].(*oci.Registry)
+	if !ok {
+		return nil, ErrOCIRegistryUnavailable
+	}
+	helmHandler, ok := s.handlers["helm"].(*helm.Registry)
+	if !ok {
+		return nil, fmt.Errorf("helm registry handler unavailable")
+	}
+
+	content, err := readOCIBlob(ctx, ociRegistry, repository, layers.Chart.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chart layer: %w", err)
+	}
+	chart, err := helm.ParseChart(content)
+	if err != nil {
+		return nil, err
+	}
+
+	artifact, err := s.Upload(ctx, "helm", chart.Name, chart.Version, bytes.NewReader(content), publishedBy)
+	if err != nil && !errors.Is(err, ErrArtifactUnchanged) {
+		return nil, err
+	}
+
+	if layers.Provenance != nil {
+		provenance, err := readOCIBlob(ctx, ociRegistry, repository, layers.Provenance.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read provenance layer: %w", err)
+		}
+		if err := helmHandler.StoreProvenance(ctx, artifact.Name, artifact.Version, provenance); err != nil {
+			return nil, err
+		}
+	}
+
+	return artifact, nil
+}
+
+// readOCIBlob returns the content of a blob of an OCI repository
+func readOCIBlob(ctx context.Context, ociRegistry *oci.Registry, repository, digest string) ([]byte, error) {
+	reader, _, err := ociRegistry.GetBlob(ctx, repository, digest)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
@@ -0,0 +1,163 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrVersionPreviouslyPublished is returned when publishing a version to an
+	// immutable registry that was published before, even if it has since been
+	// deleted
+	ErrVersionPreviouslyPublished = errors.New("version was previously published and cannot be published again")
+
+	// ErrLedgerTampered is returned when an entry of the published version
+	// ledger does not match its hash or the entry before it
+	ErrLedgerTampered = errors.New("published version ledger has been tampered with")
+)
+
+// ledgerAppendAttempts is how many times appending to the published version
+// ledger is tried. Concurrent appends chain from the same entry, and all but
+// one fail on the unique previous hash.
+const ledgerAppendAttempts = 3
+
+// checkPublishedVersion rejects publishing a version to an immutable registry
+// that its ledger records as published before. Admins may re-publish one.
+func (s *Service) checkPublishedVersion(ctx context.Context, artifact *types.Artifact, publishedBy uuid.UUID) error {
+	immutable, err := s.Settings.IsImmutable(ctx, artifact.Registry)
+	if err != nil || !immutable {
+		return err
+	}
+
+	var count int64
+	if err := s.DB.WithContext(ctx).Model(&types.PublishedVersion{}).
+		Where("registry = ? AND normalized_name = ? AND version = ?",
+			artifact.Registry, utils.NormalizePackageName(artifact.Name, artifact.Registry), artifact.Version).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check published versions: %w", err)
+	}
+	if count == 0 {
+		return nil
+	}
+
+	var user types.User
+	if err := s.DB.WithContext(ctx).Where("id = ?", publishedBy).First(&user).Error; err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.IsAdmin {
+		return fmt.Errorf("%w: %s:%s", ErrVersionPreviouslyPublished, artifact.Name, artifact.Version)
+	}
+
+	log.Warn().
+		Str("registry", artifact.Registry).
+		Str("name", artifact.Name).
+		Str("version", artifact.Version).
+		Str("published_by", publishedBy.String()).
+		Msg("Admin re-publishing a previously published version of an immutable registry")
+	return nil
+}
+
+// recordPublishedVersion appends a published artifact to the ledger, if its
+// registry is immutable
+func (s *Service) recordPublishedVersion(ctx context.Context, artifact *types.Artifact) error {
+	immutable, err := s.Settings.IsImmutable(ctx, artifact.Registry)
+	if err != nil || !immutable {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var previousHash string
+			var last types.PublishedVersion
+			err := tx.Order("sequence DESC").First(&last).Error
+			switch {
+			case err == nil:
+				previousHash = last.Hash
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				return err
+			}
+
+			entry := &types.PublishedVersion{
+				Registry:       artifact.Registry,
+				NormalizedName: utils.NormalizePackageName(artifact.Name, artifact.Registry),
+				Name:           artifact.Name,
+				Version:        artifact.Version,
+				SHA256:         artifact.SHA256,
+				PublishedBy:    artifact.PublishedBy,
+				PublishedAt:    time.Now().UTC().Truncate(time.Microsecond),
+				PreviousHash:   previousHash,
+			}
+			entry.Hash = publishedVersionHash(entry)
+			return tx.Create(entry).Error
+		})
+		if err == nil || attempt == ledgerAppendAttempts {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record published version: %w", err)
+	}
+	return nil
+}
+
+// VerifyPublishedVersions checks that every entry of the published version
+// ledger matches its hash and chains from the entry before it, returning how
+// many entries were checked
+func (s *Service) VerifyPublishedVersions(ctx context.Context) (int, error) {
+	var (
+		checked      int
+		previousHash string
+		tampered     error
+		batch        []types.PublishedVersion
+	)
+	err := s.DB.WithContext(ctx).Order("sequence").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			entry := &batch[i]
+			if entry.PreviousHash != previousHash || entry.Hash != publishedVersionHash(entry) {
+				tampered = fmt.Errorf("%w: entry %d", ErrLedgerTampered, entry.Sequence)
+				return tampered
+			}
+			previousHash = entry.Hash
+			checked++
+		}
+		return nil
+	}).Error
+	if tampered != nil {
+		return checked, tampered
+	}
+	if err != nil {
+		return checked, fmt.Errorf("failed to read published versions: %w", err)
+	}
+	return checked, nil
+}
+
+// publishedVersionHash returns the hash of a ledger entry, covering the hash
+// of the entry before it
+func publishedVersionHash(entry *types.PublishedVersion) string {
+	hasher := sha256.New()
+	for _, field := range []string{
+		entry.PreviousHash,
+		entry.Registry,
+		entry.NormalizedName,
+		entry.Name,
+		entry.Version,
+		entry.SHA256,
+		entry.PublishedBy.String(),
+		strconv.FormatInt(entry.PublishedAt.UnixMicro(), 10),
+	} {
+		hasher.Write([]byte(field))
+		hasher.Write([]byte{0})
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,162 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// setupImmutableTest returns a service whose test registry stores uploads,
+// optionally immutable, and a publisher
+func setupImmutableTest(t *testing.T, immutable bool) (*Service, *types.User) {
+	t.Helper()
+
+	db := setupTestDB(t)
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	service := NewService(db, localStorage)
+	mockHandler := &MockHandler{}
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), mock.Anything).Return(nil).Maybe()
+	mockHandler.On("GetMetadata", mock.Anything).Return(map[string]interface{}{}, nil).Maybe()
+	mockHandler.On("Upload", mock.Anything, mock.AnythingOfType("*types.Artifact"), mock.Anything).
+		Run(func(args mock.Arguments) {
+			artifact := args.Get(1).(*types.Artifact)
+			require.NoError(t, localStorage.Store(context.Background(), artifact.StoragePath, bytes.NewReader(args.Get(2).([]byte)), "application/octet-stream"))
+		}).Return(nil).Maybe()
+	service.handlers["test"] = mockHandler
+	service.Configure(config.RegistryConfig{DeleteGracePeriod: time.Hour})
+
+	user := createTestUserWithAdmin(t, db, false)
+	require.NoError(t, service.Settings.SetImmutable(context.Background(), "test", immutable, user.ID))
+	return service, user
+}
+
+// publishAndPurge publishes a version, deletes it and purges it so that
+// nothing but the ledger remembers it
+func publishAndPurge(t *testing.T, service *Service, user *types.User) {
+	t.Helper()
+	ctx := context.Background()
+
+	_, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("original")), user.ID)
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "1.0.0", user.ID))
+	require.NoError(t, service.DB.Unscoped().Model(&types.Artifact{}).
+		Where("registry = ? AND name = ?", "test", "left-pad").
+		Update("deleted_at", time.Now().Add(-2*time.Hour)).Error)
+	purged, err := service.PurgeDeleted(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+}
+
+func TestImmutable_RepublishRejected(t *testing.T) {
+	service, user := setupImmutableTest(t, true)
+	ctx := context.Background()
+
+	publishAndPurge(t, service, user)
+
+	_, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("replacement")), user.ID)
+	assert.ErrorIs(t, err, ErrVersionPreviouslyPublished)
+
+	// Other versions can still be published
+	_, err = service.Upload(ctx, "test", "left-pad", "1.0.1", bytes.NewReader([]byte("replacement")), user.ID)
+	assert.NoError(t, err)
+}
+
+func TestImmutable_RepublishAllowedWhenNotImmutable(t *testing.T) {
+	service, user := setupImmutableTest(t, false)
+	ctx := context.Background()
+
+	publishAndPurge(t, service, user)
+
+	_, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("replacement")), user.ID)
+	assert.NoError(t, err)
+
+	// Nothing is recorded for registries that are not immutable
+	var count int64
+	require.NoError(t, service.DB.Model(&types.PublishedVersion{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+func TestImmutable_AdminOverride(t *testing.T) {
+	service, user := setupImmutableTest(t, true)
+	ctx := context.Background()
+
+	publishAndPurge(t, service, user)
+
+	admin := createTestUserWithAdmin(t, service.DB, true)
+	artifact, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("replacement")), admin.ID)
+	require.NoError(t, err)
+	assert.Equal(t, admin.ID, artifact.PublishedBy)
+
+	// The override is recorded in the ledger too
+	var entries []types.PublishedVersion
+	require.NoError(t, service.DB.Order("sequence").Find(&entries).Error)
+	require.Len(t, entries, 2)
+	assert.Equal(t, user.ID, entries[0].PublishedBy)
+	assert.Equal(t, admin.ID, entries[1].PublishedBy)
+}
+
+func TestImmutable_PendingApprovalRecordedOnApproval(t *testing.T) {
+	service, user := setupImmutableTest(t, true)
+	ctx := context.Background()
+	require.NoError(t, service.Settings.SetRequireApproval(ctx, "test", true, user.ID))
+	approver := createTestUserWithAdmin(t, service.DB, true)
+
+	// Rejected uploads were never published, so can be submitted again
+	artifact, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("first")), user.ID)
+	require.NoError(t, err)
+	require.NoError(t, service.RejectArtifact(ctx, artifact.ID, approver.ID, "not yet"))
+
+	artifact, err = service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("second")), user.ID)
+	require.NoError(t, err)
+	_, err = service.ApproveArtifact(ctx, artifact.ID, approver.ID)
+	require.NoError(t, err)
+
+	var entry types.PublishedVersion
+	require.NoError(t, service.DB.First(&entry).Error)
+	assert.Equal(t, artifact.SHA256, entry.SHA256)
+}
+
+func TestVerifyPublishedVersions(t *testing.T) {
+	service, user := setupImmutableTest(t, true)
+	ctx := context.Background()
+
+	for _, version := range []string{"1.0.0", "1.1.0", "2.0.0"} {
+		_, err := service.Upload(ctx, "test", "left-pad", version, bytes.NewReader([]byte(version)), user.ID)
+		require.NoError(t, err)
+	}
+
+	checked, err := service.VerifyPublishedVersions(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, checked)
+
+	// Removing an entry breaks the chain
+	require.NoError(t, service.DB.Where("version = ?", "1.1.0").Delete(&types.PublishedVersion{}).Error)
+	checked, err = service.VerifyPublishedVersions(ctx)
+	assert.ErrorIs(t, err, ErrLedgerTampered)
+	assert.Equal(t, 1, checked)
+}
+
+func TestVerifyPublishedVersions_ChangedEntry(t *testing.T) {
+	service, user := setupImmutableTest(t, true)
+	ctx := context.Background()
+
+	_, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("original")), user.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, service.DB.Model(&types.PublishedVersion{}).
+		Where("version = ?", "1.0.0").
+		Update("version", "0.9.0").Error)
+
+	_, err = service.VerifyPublishedVersions(ctx)
+	assert.ErrorIs(t, err, ErrLedgerTampered)
+}
@@ -32,3 +32,35 @@ type Handler interface {
 	// GenerateStoragePath creates the storage path for an artifact
 	GenerateStoragePath(name, version string) string
 }
+
+// IconExtractor is implemented by handlers whose packages can embed an icon
+type IconExtractor interface {
+	// ExtractIcon returns the embedded icon and its file name, or nil data if the package has none
+	ExtractIcon(content []byte) ([]byte, string, error)
+}
+
+// StreamingHandler is implemented by handlers that check and describe an
+// artifact from the start of its content alone. Uploads to them are streamed
+// into storage rather than held in memory: Validate and GetMetadata are given
+// only the first bytes of the content, and Upload is not called.
+type StreamingHandler interface {
+	// ContentType returns the content type the artifact is stored as
+	ContentType(artifact *types.Artifact) string
+}
+
+// ReadmeExtractor is implemented by handlers whose packages can carry a README
+type ReadmeExtractor interface {
+	// ExtractReadme returns the package's README as markdown, or an empty string if it has none
+	ExtractReadme(content []byte) (string, error)
+}
+
+// IndexMaintainer is implemented by handlers that keep an index of their
+// published artifacts, which the service updates as artifacts are published
+// and removed
+type IndexMaintainer interface {
+	// AddToIndex adds a published artifact to the index
+	AddToIndex(artifact *types.Artifact)
+
+	// RemoveFromIndex removes an artifact from the index
+	RemoveFromIndex(artifact *types.Artifact)
+}
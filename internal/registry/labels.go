@@ -0,0 +1,166 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrLabelForbidden is returned when a user who does not own a package
+	// tries to change its labels
+	ErrLabelForbidden = errors.New("only package owners can change labels")
+
+	// ErrInvalidLabel is returned for a label key or value that cannot be
+	// used, or a label selector that cannot be parsed
+	ErrInvalidLabel = errors.New("invalid label")
+)
+
+// MaxLabelValueLength caps the length of a label value
+const MaxLabelValueLength = 256
+
+// labelKeyPattern is what a label key may look like, such as "team" or
+// "example.com/cost-center"
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+
+// ValidateLabel checks that a label can be stored and selected on
+func ValidateLabel(key, value string) error {
+	if !labelKeyPattern.MatchString(key) {
+		return fmt.Errorf("%w key %q: must be 1-63 letters, digits, '.', '_', '-' or '/', starting and ending with a letter or digit", ErrInvalidLabel, key)
+	}
+	if len(value) > MaxLabelValueLength || strings.ContainsFunc(value, func(r rune) bool { return r < ' ' || r == 0x7f }) {
+		return fmt.Errorf("%w value for %q: must be at most %d characters without control characters", ErrInvalidLabel, key, MaxLabelValueLength)
+	}
+	return nil
+}
+
+// ParseLabelSelector parses a selector of comma-separated key=value pairs,
+// such as "team=payments,env=prod", that artifacts must all carry
+func ParseLabelSelector(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, requirement := range strings.Split(selector, ",") {
+		if requirement = strings.TrimSpace(requirement); requirement == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(requirement, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w selector %q: expected key=value", ErrInvalidLabel, requirement)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if err := ValidateLabel(key, value); err != nil {
+			return nil, err
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// whereLabels narrows a query of artifacts to those carrying every label
+func whereLabels(query *gorm.DB, labels map[string]string) *gorm.DB {
+	for key, value := range labels {
+		query = query.Where("artifacts.labels->>? = ?", key, value)
+	}
+	return query
+}
+
+// SetLabels adds labels to a version of a package, or to every version when
+// version is empty, replacing the values of labels it already has, and
+// returns how many versions were labelled. Only owners of the package can
+// change its labels.
+func (s *Service) SetLabels(ctx context.Context, registryType, name, version string, labels map[string]string, userID uuid.UUID) (int, error) {
+	if len(labels) == 0 {
+		return 0, fmt.Errorf("%w: no labels given", ErrInvalidLabel)
+	}
+	for key, value := range labels {
+		if err := ValidateLabel(key, value); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.updateLabels(ctx, registryType, name, version, userID, func(current map[string]string) {
+		for key, value := range labels {
+			current[key] = value
+		}
+	}, map[string]interface{}{"labels": labels})
+}
+
+// RemoveLabel removes a label from a version of a package, or from every
+// version when version is empty, and returns how many versions carried it.
+// Only owners of the package can change its labels.
+func (s *Service) RemoveLabel(ctx context.Context, registryType, name, version, key string, userID uuid.UUID) (int, error) {
+	changed := 0
+	_, err := s.updateLabels(ctx, registryType, name, version, userID, func(current map[string]string) {
+		if _, ok := current[key]; ok {
+			delete(current, key)
+			changed++
+		}
+	}, map[string]interface{}{"removed": key})
+	return changed, err
+}
+
+// updateLabels applies update to the labels of the matching versions of a
+// package, recording the change in the audit log with details
+func (s *Service) updateLabels(ctx context.Context, registryType, name, version string, userID uuid.UUID, update func(map[string]string), details map[string]interface{}) (int, error) {
+	query := s.DB.WithContext(ctx).
+		Where("normalized_name = ? AND registry = ?", utils.NormalizePackageName(name, registryType), registryType)
+	if version != "" {
+		query = query.Where("version = ?", version)
+	}
+	var artifacts []types.Artifact
+	if err := query.Find(&artifacts).Error; err != nil {
+		return 0, fmt.Errorf("failed to get artifacts: %w", err)
+	}
+	if len(artifacts) == 0 {
+		if version != "" {
+			return 0, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+		}
+		return 0, fmt.Errorf("%w: %s", ErrArtifactNotFound, name)
+	}
+
+	canLabel, err := s.Ownership.CanUserDelete(ctx, registryType, artifacts[0].Name, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check label permissions: %w", err)
+	}
+	if !canLabel {
+		return 0, ErrLabelForbidden
+	}
+
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range artifacts {
+			artifact := &artifacts[i]
+			if artifact.Labels == nil {
+				artifact.Labels = make(map[string]string)
+			}
+			update(artifact.Labels)
+			if err := tx.Model(artifact).Select("labels").Updates(artifact).Error; err != nil {
+				return fmt.Errorf("failed to update artifact labels: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		s.auditLog.Record(ctx, userID, audit.ActionPackageLabel, audit.PackageTarget(registryType, artifact.Name, artifact.Version), details)
+	}
+	log.Info().
+		Str("registry", registryType).
+		Str("name", artifacts[0].Name).
+		Str("version", version).
+		Int("versions", len(artifacts)).
+		Str("user_id", userID.String()).
+		Msg("Package labels updated")
+	return len(artifacts), nil
+}
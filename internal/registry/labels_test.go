@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLabels(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	ctx := context.Background()
+	owner := createTestUser(t, db)
+	require.NoError(t, service.Ownership.EstablishInitialOwnership(ctx, "npm", "payments-client", owner.ID))
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		require.NoError(t, db.Create(&types.Artifact{
+			Name: "payments-client", Version: version, Registry: "npm", StoragePath: "npm/payments-client/" + version, PublishedBy: owner.ID,
+		}).Error)
+	}
+
+	labelsOf := func(version string) map[string]string {
+		var artifact types.Artifact
+		require.NoError(t, db.Where("name = ? AND version = ?", "payments-client", version).First(&artifact).Error)
+		return artifact.Labels
+	}
+
+	// Without a version, every version is labelled
+	versions, err := service.SetLabels(ctx, "npm", "payments-client", "", map[string]string{"team": "payments"}, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, versions)
+
+	// With one, only that version, keeping the labels it has
+	_, err = service.SetLabels(ctx, "npm", "payments-client", "2.0.0", map[string]string{"env": "prod"}, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments"}, labelsOf("1.0.0"))
+	assert.Equal(t, map[string]string{"team": "payments", "env": "prod"}, labelsOf("2.0.0"))
+
+	versions, err = service.RemoveLabel(ctx, "npm", "payments-client", "", "env", owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, versions)
+	assert.Equal(t, map[string]string{"team": "payments"}, labelsOf("2.0.0"))
+
+	t.Run("only owners", func(t *testing.T) {
+		other := createTestUserWithAdmin(t, db, false)
+		_, err := service.SetLabels(ctx, "npm", "payments-client", "", map[string]string{"team": "other"}, other.ID)
+		assert.ErrorIs(t, err, ErrLabelForbidden)
+		_, err = service.RemoveLabel(ctx, "npm", "payments-client", "", "team", other.ID)
+		assert.ErrorIs(t, err, ErrLabelForbidden)
+
+		admin := createTestUserWithAdmin(t, db, true)
+		_, err = service.SetLabels(ctx, "npm", "payments-client", "1.0.0", map[string]string{"reviewed": "true"}, admin.ID)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid labels", func(t *testing.T) {
+		for _, labels := range []map[string]string{
+			{},
+			{"": "x"},
+			{"-team": "x"},
+			{"team name": "x"},
+			{"team": "line\nbreak"},
+		} {
+			_, err := service.SetLabels(ctx, "npm", "payments-client", "", labels, owner.ID)
+			assert.ErrorIs(t, err, ErrInvalidLabel, labels)
+		}
+	})
+
+	t.Run("missing package", func(t *testing.T) {
+		_, err := service.SetLabels(ctx, "npm", "payments-client", "3.0.0", map[string]string{"team": "payments"}, owner.ID)
+		assert.ErrorIs(t, err, ErrArtifactNotFound)
+	})
+}
+
+func TestList_LabelSelector(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	ctx := context.Background()
+	user := createTestUser(t, db)
+
+	for name, labels := range map[string]map[string]string{
+		"payments-api":    {"team": "payments", "env": "prod"},
+		"payments-sdk":    {"team": "payments", "env": "dev"},
+		"search-api":      {"team": "search", "env": "prod"},
+		"unlabelled-tool": nil,
+	} {
+		require.NoError(t, db.Create(&types.Artifact{
+			Name: name, Version: "1.0.0", Registry: "npm", StoragePath: "npm/" + name, PublishedBy: user.ID,
+			Status: types.ArtifactStatusPublished, Labels: labels,
+		}).Error)
+	}
+
+	list := func(selector string) []string {
+		labels, err := ParseLabelSelector(selector)
+		require.NoError(t, err)
+		artifacts, _, err := service.List(ctx, &types.ArtifactFilter{Registry: "npm", Labels: labels})
+		require.NoError(t, err)
+		var names []string
+		for _, artifact := range artifacts {
+			names = append(names, artifact.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"payments-api", "payments-sdk"}, list("team=payments"))
+	assert.Equal(t, []string{"payments-api"}, list("team=payments, env=prod"))
+	assert.Empty(t, list("team=billing"))
+	assert.Len(t, list(""), 4)
+
+	_, err := ParseLabelSelector("team")
+	assert.ErrorIs(t, err, ErrInvalidLabel)
+}
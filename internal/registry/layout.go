@@ -0,0 +1,234 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Storage path layouts that can be configured
+const (
+	LayoutFlat    = "flat"
+	LayoutSharded = "sharded"
+)
+
+// DefaultLayoutMigrationBatchSize is how many artifacts are loaded per batch
+// when migrating to another layout without a batch size
+const DefaultLayoutMigrationBatchSize = 500
+
+// PathLayout decides where artifact content is stored. Content is stored
+// once per SHA256 and layout under blobStoragePrefix; artifacts keep
+// the path they were stored at, so switching layouts only affects content
+// stored afterwards until MigrateStorageLayout moves the rest.
+type PathLayout interface {
+	// Name returns the name the layout is configured by
+	Name() string
+
+	// BlobPath returns the storage path of content with a SHA256
+	BlobPath(sha256 string) string
+}
+
+// FlatLayout stores all content in a single directory, e.g.
+// blobs/sha256/2cf24dba...
+type FlatLayout struct{}
+
+// Name returns LayoutFlat
+func (FlatLayout) Name() string { return LayoutFlat }
+
+// BlobPath returns the content address of a SHA256
+func (FlatLayout) BlobPath(sha256 string) string {
+	return contentAddress(sha256)
+}
+
+// ShardedLayout stores content in directories named after the first two
+// pairs of hex digits of its SHA256, e.g. blobs/sha256/2c/f2/2cf24dba...,
+// so no directory holds more than a small share of the registry's content
+type ShardedLayout struct{}
+
+// Name returns LayoutSharded
+func (ShardedLayout) Name() string { return LayoutSharded }
+
+// BlobPath returns the sharded content address of a SHA256
+func (ShardedLayout) BlobPath(sha256 string) string {
+	if len(sha256) < 4 {
+		return contentAddress(sha256)
+	}
+	return fmt.Sprintf("%s%s/%s/%s", blobStoragePrefix, sha256[:2], sha256[2:4], sha256)
+}
+
+// NewPathLayout returns the layout with a name. An empty name is the flat
+// layout content has always been stored in.
+func NewPathLayout(name string) (PathLayout, error) {
+	switch name {
+	case "", LayoutFlat:
+		return FlatLayout{}, nil
+	case LayoutSharded:
+		return ShardedLayout{}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage path layout %q, expected %s or %s", name, LayoutFlat, LayoutSharded)
+	}
+}
+
+// SetPathLayout sets the layout content stored from now on is stored in
+func (s *Service) SetPathLayout(layout PathLayout) {
+	s.layout = layout
+}
+
+// LayoutMigrationOptions scopes a storage layout migration
+type LayoutMigrationOptions struct {
+	Layout    PathLayout // layout to move content to
+	BatchSize int        // artifacts loaded per batch; zero is DefaultLayoutMigrationBatchSize
+	DryRun    bool       // report what would be moved without moving it
+}
+
+// LayoutMigrationResult summarizes a storage layout migration
+type LayoutMigrationResult struct {
+	Layout    string `json:"layout"`
+	DryRun    bool   `json:"dry_run"`
+	Artifacts int64  `json:"artifacts"` // artifacts whose storage path was rewritten
+	Blobs     int    `json:"blobs"`     // stored files moved
+	Skipped   int    `json:"skipped"`   // artifacts whose content could not be moved
+}
+
+// MigrateStorageLayout moves the content of every artifact, deleted ones
+// included, to where a layout stores it and rewrites their storage paths.
+// Artifacts stored at a path of their own before content was deduplicated
+// are moved to their content address too. OCI content, which is stored by
+// repository the way registry clients address it, and quarantined content
+// are left where they are. Content is copied and verified against its
+// SHA256 before artifacts are pointed at it and the old copy removed, so
+// downloads keep working while it runs and running it again is harmless.
+func (s *Service) MigrateStorageLayout(ctx context.Context, opts LayoutMigrationOptions) (*LayoutMigrationResult, error) {
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultLayoutMigrationBatchSize
+	}
+
+	logger := log.With().Str("layout", opts.Layout.Name()).Bool("dry_run", opts.DryRun).Logger()
+	started := time.Now()
+	result := &LayoutMigrationResult{Layout: opts.Layout.Name(), DryRun: opts.DryRun}
+
+	query := s.DB.WithContext(ctx).Unscoped().Model(&types.Artifact{}).
+		Where("registry <> ? AND sha256 <> '' AND storage_path NOT LIKE ?", "oci", quarantinePrefix+"%")
+
+	// Artifacts sharing content are moved together, the first time one of
+	// them is seen. Content at different paths can have the same target.
+	moved := make(map[string]bool)
+	placed := make(map[string]bool)
+
+	var artifacts []types.Artifact
+	err := query.FindInBatches(&artifacts, batchSize, func(tx *gorm.DB, batch int) error {
+		for _, artifact := range artifacts {
+			target := opts.Layout.BlobPath(artifact.SHA256)
+			if artifact.StoragePath == target || moved[artifact.StoragePath] {
+				continue
+			}
+			moved[artifact.StoragePath] = true
+
+			count, copied, err := s.migrateStoragePath(ctx, artifact.StoragePath, target, &artifact, opts.DryRun)
+			if err != nil {
+				logger.Warn().Err(err).
+					Str("registry", artifact.Registry).
+					Str("name", artifact.Name).
+					Str("version", artifact.Version).
+					Str("storage_path", artifact.StoragePath).
+					Msg("Failed to move artifact content, left where it is")
+				result.Skipped++
+				continue
+			}
+			result.Artifacts += count
+			if copied && !placed[target] {
+				result.Blobs++
+			}
+			placed[target] = true
+		}
+		logger.Info().Int("batch", batch).Int64("artifacts", result.Artifacts).Int("blobs", result.Blobs).Msg("Migrated batch")
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to migrate storage layout: %w", err)
+	}
+
+	logger.Info().
+		Int64("artifacts", result.Artifacts).
+		Int("blobs", result.Blobs).
+		Int("skipped", result.Skipped).
+		Dur("duration", time.Since(started)).
+		Msg("Migrated storage layout")
+
+	return result, nil
+}
+
+// migrateStoragePath moves the content at from, which artifact is stored at,
+// to target and points every artifact stored at from to it. It returns how
+// many artifacts were pointed at target and whether content was copied; the
+// content is not copied when target already holds it.
+func (s *Service) migrateStoragePath(ctx context.Context, from, target string, artifact *types.Artifact, dryRun bool) (int64, bool, error) {
+	sharing := s.DB.WithContext(ctx).Unscoped().Model(&types.Artifact{}).
+		Where("storage_path = ? AND registry <> ?", from, "oci")
+
+	exists, err := s.Storage.Exists(ctx, target)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to check %s: %w", target, err)
+	}
+
+	if dryRun {
+		var count int64
+		if err := sharing.Count(&count).Error; err != nil {
+			return 0, false, fmt.Errorf("failed to count artifacts: %w", err)
+		}
+		return count, !exists, nil
+	}
+
+	if !exists {
+		reader, err := s.Storage.Retrieve(ctx, from)
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to read %s: %w", from, err)
+		}
+		_, _, err = storage.StoreVerified(ctx, s.Storage, target, reader, artifact.ContentType, artifact.SHA256)
+		reader.Close()
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to copy %s to %s: %w", from, target, err)
+		}
+	}
+
+	var count int64
+	if err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updated := tx.Unscoped().Model(&types.Artifact{}).
+			Where("storage_path = ? AND registry <> ?", from, "oci").
+			UpdateColumn("storage_path", target)
+		if updated.Error != nil {
+			return fmt.Errorf("failed to rewrite storage paths: %w", updated.Error)
+		}
+		count = updated.RowsAffected
+
+		if count == 0 {
+			return nil
+		}
+
+		// The references to the content move with it, counted like content
+		// deduplicated at upload, which target may already hold
+		if err := tx.Where("storage_path = ?", from).Delete(&types.BlobRef{}).Error; err != nil {
+			return fmt.Errorf("failed to remove blob reference: %w", err)
+		}
+		moved := *artifact
+		moved.StoragePath = target
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "storage_path"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"ref_count": gorm.Expr("blob_refs.ref_count + ?", count)}),
+		}).Create(blobRef(&moved, count)).Error
+	}); err != nil {
+		return 0, false, err
+	}
+
+	if err := s.Storage.Delete(ctx, from); err != nil {
+		log.Warn().Err(err).Str("path", from).Msg("Failed to remove moved content")
+	}
+	return count, !exists, nil
+}
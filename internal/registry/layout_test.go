@@ -0,0 +1,144 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathLayouts(t *testing.T) {
+	sum := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"", "blobs/sha256/" + sum},
+		{LayoutFlat, "blobs/sha256/" + sum},
+		{LayoutSharded, "blobs/sha256/2c/f2/" + sum},
+	}
+	for _, tt := range tests {
+		layout, err := NewPathLayout(tt.name)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.expected, layout.BlobPath(sum), tt.name)
+		assert.True(t, isContentAddressed(layout.BlobPath(sum)), tt.name)
+	}
+
+	_, err := NewPathLayout("nested")
+	assert.Error(t, err)
+}
+
+func TestUpload_ShardedLayout(t *testing.T) {
+	ctx := context.Background()
+	service := setupBackupService(t)
+	service.SetPathLayout(ShardedLayout{})
+	user := createTestUser(t, service.DB)
+
+	artifact, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("sharded content")), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, ShardedLayout{}.BlobPath(artifact.SHA256), artifact.StoragePath)
+
+	_, reader, err := service.Download(ctx, "test", "left-pad", "1.0.0")
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "sharded content", string(content))
+}
+
+func TestMigrateStorageLayout(t *testing.T) {
+	ctx := context.Background()
+	service := setupBackupService(t)
+	user := createTestUser(t, service.DB)
+
+	// Two artifacts sharing a blob, one of their own and one stored at a path
+	// of its own before content was deduplicated
+	first, err := service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+	second, err := service.Upload(ctx, "other", "left-pad-fork", "1.0.0", bytes.NewReader([]byte("shared content")), user.ID)
+	require.NoError(t, err)
+	distinct, err := service.Upload(ctx, "test", "left-pad", "2.0.0", bytes.NewReader([]byte("other content")), user.ID)
+	require.NoError(t, err)
+
+	legacyContent := []byte("legacy content")
+	sum := sha256.Sum256(legacyContent)
+	legacy := &types.Artifact{
+		ID:          uuid.New(),
+		Name:        "legacy",
+		Version:     "1.0.0",
+		Registry:    "test",
+		StoragePath: "test/legacy/1.0.0.bin",
+		SHA256:      hex.EncodeToString(sum[:]),
+		Size:        int64(len(legacyContent)),
+		PublishedBy: user.ID,
+		Status:      types.ArtifactStatusPublished,
+	}
+	require.NoError(t, service.Storage.Store(ctx, legacy.StoragePath, bytes.NewReader(legacyContent), "application/octet-stream"))
+	require.NoError(t, service.DB.Create(legacy).Error)
+	require.NoError(t, service.Ownership.EstablishInitialOwnership(ctx, "test", "legacy", user.ID))
+
+	storagePath := func(artifact *types.Artifact) string {
+		var stored types.Artifact
+		require.NoError(t, service.DB.Unscoped().First(&stored, "id = ?", artifact.ID).Error)
+		return stored.StoragePath
+	}
+	exists := func(path string) bool {
+		exists, err := service.Storage.Exists(ctx, path)
+		require.NoError(t, err)
+		return exists
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		result, err := service.MigrateStorageLayout(ctx, LayoutMigrationOptions{Layout: ShardedLayout{}, BatchSize: 2, DryRun: true})
+		require.NoError(t, err)
+		assert.Equal(t, &LayoutMigrationResult{Layout: LayoutSharded, DryRun: true, Artifacts: 4, Blobs: 3}, result)
+
+		for _, artifact := range []*types.Artifact{first, second, distinct, legacy} {
+			assert.Equal(t, artifact.StoragePath, storagePath(artifact))
+			assert.True(t, exists(artifact.StoragePath))
+			assert.False(t, exists(ShardedLayout{}.BlobPath(artifact.SHA256)))
+		}
+	})
+
+	t.Run("migration", func(t *testing.T) {
+		result, err := service.MigrateStorageLayout(ctx, LayoutMigrationOptions{Layout: ShardedLayout{}, BatchSize: 2})
+		require.NoError(t, err)
+		assert.Equal(t, &LayoutMigrationResult{Layout: LayoutSharded, Artifacts: 4, Blobs: 3}, result)
+
+		for _, artifact := range []*types.Artifact{first, second, distinct, legacy} {
+			target := ShardedLayout{}.BlobPath(artifact.SHA256)
+			assert.Equal(t, target, storagePath(artifact))
+			assert.True(t, exists(target))
+			assert.False(t, exists(artifact.StoragePath))
+		}
+		assert.Equal(t, int64(2), blobRefCount(t, service, ShardedLayout{}.BlobPath(first.SHA256)))
+		assert.Equal(t, int64(-1), blobRefCount(t, service, first.StoragePath), "references move with the content")
+		assert.Equal(t, int64(1), blobRefCount(t, service, ShardedLayout{}.BlobPath(legacy.SHA256)), "legacy content is counted once content addressed")
+
+		_, reader, err := service.Download(ctx, "test", "legacy", "1.0.0")
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err)
+		assert.Equal(t, legacyContent, content)
+	})
+
+	t.Run("running again is harmless", func(t *testing.T) {
+		result, err := service.MigrateStorageLayout(ctx, LayoutMigrationOptions{Layout: ShardedLayout{}})
+		require.NoError(t, err)
+		assert.Equal(t, &LayoutMigrationResult{Layout: LayoutSharded}, result)
+	})
+
+	t.Run("deleting after migration", func(t *testing.T) {
+		require.NoError(t, service.Delete(ctx, "test", "legacy", "1.0.0", user.ID))
+		assert.False(t, exists(ShardedLayout{}.BlobPath(legacy.SHA256)))
+	})
+}
@@ -0,0 +1,38 @@
+package registry
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+)
+
+// ErrOCIRegistryUnavailable is returned when the OCI registry is not enabled
+var ErrOCIRegistryUnavailable = errors.New("OCI registry is not available")
+
+// CollectOCIGarbage removes OCI blobs, and optionally untagged manifests, that
+// no manifest refers to. Runs other than dry runs are audited.
+func (s *Service) CollectOCIGarbage(ctx context.Context, opts oci.GCOptions, userID uuid.UUID) (*oci.GCResult, error) {
+	ociRegistry, ok := s.handlers["oci"].(*oci.Registry)
+	if !ok {
+		return nil, ErrOCIRegistryUnavailable
+	}
+
+	result, err := ociRegistry.GarbageCollect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.DryRun {
+		s.auditLog.Record(ctx, userID, audit.ActionOCIGarbageCollect, "oci", map[string]interface{}{
+			"grace_period":      opts.GracePeriod.String(),
+			"delete_untagged":   opts.DeleteUntagged,
+			"deleted_manifests": len(result.DeletedManifests),
+			"deleted_blobs":     len(result.DeletedBlobs),
+			"freed_bytes":       result.FreedBytes,
+		})
+	}
+	return result, nil
+}
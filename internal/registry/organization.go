@@ -0,0 +1,479 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrOrganizationNotFound is returned for organizations that do not exist
+	ErrOrganizationNotFound = errors.New("organization not found")
+
+	// ErrOrganizationExists is returned when creating an organization whose
+	// name is taken
+	ErrOrganizationExists = errors.New("organization already exists")
+
+	// ErrInvalidOrganizationName is returned for names that cannot be used
+	// as a namespace
+	ErrInvalidOrganizationName = errors.New("invalid organization name: must be lowercase letters, digits, '.', '_' or '-', starting with a letter or digit")
+
+	// ErrOrganizationForbidden is returned when a user who does not own an
+	// organization tries to manage it
+	ErrOrganizationForbidden = errors.New("only organization owners can manage the organization")
+
+	// ErrNamespaceInUse is returned when creating an organization whose
+	// namespace already holds packages, which only admins may claim
+	ErrNamespaceInUse = errors.New("packages have already been published in the organization's namespace")
+
+	// ErrMemberNotFound is returned when removing a user who is not a member
+	ErrMemberNotFound = errors.New("user is not a member of the organization")
+
+	// ErrLastOrganizationOwner is returned when removing or demoting the only
+	// owner of an organization
+	ErrLastOrganizationOwner = errors.New("cannot remove or demote the last owner of an organization")
+)
+
+// organizationNamePattern matches names usable as an npm scope, the first
+// segment of an OCI repository and a Maven group ID alike
+var organizationNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,99}$`)
+
+// namespacedRegistries are the registries whose package names have a
+// namespace an organization can own
+var namespacedRegistries = []string{"npm", "oci", "maven"}
+
+// packageNamespaces returns the namespaces a package name falls in, most
+// specific first: the scope of an npm package, the first path segment of an
+// OCI repository, and the group ID of a Maven artifact followed by each group
+// it is nested in. Packages of other registries have no namespace.
+func packageNamespaces(registryType, name string) []string {
+	name = strings.ToLower(name)
+	switch registryType {
+	case "npm":
+		if scope, _, ok := strings.Cut(name, "/"); ok && strings.HasPrefix(scope, "@") {
+			return []string{strings.TrimPrefix(scope, "@")}
+		}
+	case "oci":
+		if namespace, _, ok := strings.Cut(name, "/"); ok {
+			return []string{namespace}
+		}
+	case "maven":
+		groupID, _, ok := strings.Cut(name, ":")
+		if !ok {
+			return nil
+		}
+		var namespaces []string
+		for {
+			namespaces = append(namespaces, groupID)
+			i := strings.LastIndex(groupID, ".")
+			if i < 0 {
+				return namespaces
+			}
+			groupID = groupID[:i]
+		}
+	}
+	return nil
+}
+
+// namespacePrefixes returns the prefixes of the normalized names of the
+// packages of a registry in a namespace
+func namespacePrefixes(registryType, namespace string) []string {
+	switch registryType {
+	case "npm":
+		return []string{"@" + namespace + "/"}
+	case "oci":
+		return []string{namespace + "/"}
+	case "maven":
+		return []string{namespace + ":", namespace + "."}
+	}
+	return nil
+}
+
+// generateOrganizationKey creates the audit target of an organization
+func generateOrganizationKey(name string) string {
+	return "org:" + name
+}
+
+// OrganizationService handles organizations and their membership
+type OrganizationService struct {
+	db *gorm.DB
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(db *gorm.DB) *OrganizationService {
+	return &OrganizationService{db: db}
+}
+
+// Get returns the organization with a name
+func (os *OrganizationService) Get(ctx context.Context, name string) (*types.Organization, error) {
+	var org types.Organization
+	if err := os.db.WithContext(ctx).Where("name = ?", strings.ToLower(name)).First(&org).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrOrganizationNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return &org, nil
+}
+
+// ForPackage returns the organization owning the namespace a package is in,
+// or nil if no organization owns it
+func (os *OrganizationService) ForPackage(ctx context.Context, registry, packageName string) (*types.Organization, error) {
+	namespaces := packageNamespaces(registry, packageName)
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	var orgs []types.Organization
+	if err := os.db.WithContext(ctx).Where("name IN ?", namespaces).Find(&orgs).Error; err != nil {
+		return nil, fmt.Errorf("failed to get package organization: %w", err)
+	}
+	for _, namespace := range namespaces {
+		for i := range orgs {
+			if orgs[i].Name == namespace {
+				return &orgs[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// MemberRole returns a user's role in an organization, or "" if they are
+// not a member
+func (os *OrganizationService) MemberRole(ctx context.Context, orgID, userID uuid.UUID) (string, error) {
+	var member types.OrganizationMember
+	if err := os.db.WithContext(ctx).Where("organization_id = ? AND user_id = ?", orgID, userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get organization membership: %w", err)
+	}
+	return member.Role, nil
+}
+
+// PackageRole returns the organization owning the namespace a package is in,
+// if any, and the role the user holds in it, or "" if they hold none
+func (os *OrganizationService) PackageRole(ctx context.Context, registry, packageName string, userID uuid.UUID) (*types.Organization, string, error) {
+	org, err := os.ForPackage(ctx, registry, packageName)
+	if err != nil || org == nil {
+		return nil, "", err
+	}
+	role, err := os.MemberRole(ctx, org.ID, userID)
+	if err != nil {
+		return nil, "", err
+	}
+	return org, role, nil
+}
+
+// Members returns the members of an organization
+func (os *OrganizationService) Members(ctx context.Context, orgID uuid.UUID) ([]types.OrganizationMember, error) {
+	var members []types.OrganizationMember
+	if err := os.db.WithContext(ctx).Preload("User").
+		Where("organization_id = ?", orgID).
+		Order("created_at").
+		Find(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to get organization members: %w", err)
+	}
+	return members, nil
+}
+
+// UserOrganizations returns the names of the organizations a user is a
+// member of
+func (os *OrganizationService) UserOrganizations(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	var names []string
+	if err := os.db.WithContext(ctx).Model(&types.Organization{}).
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", userID).
+		Pluck("organizations.name", &names).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user organizations: %w", err)
+	}
+	return names, nil
+}
+
+// canManage checks if a user can change an organization and its members.
+// Only its owners and admins may.
+func (os *OrganizationService) canManage(ctx context.Context, org *types.Organization, userID uuid.UUID) (bool, error) {
+	var user types.User
+	if err := os.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.IsAdmin {
+		return true, nil
+	}
+
+	role, err := os.MemberRole(ctx, org.ID, userID)
+	if err != nil {
+		return false, err
+	}
+	return role == RoleOwner, nil
+}
+
+// namespaceInUse reports whether any package, deleted or not, has been
+// published in a namespace
+func (os *OrganizationService) namespaceInUse(ctx context.Context, namespace string) (bool, error) {
+	for _, registry := range namespacedRegistries {
+		for _, prefix := range namespacePrefixes(registry, namespace) {
+			var count int64
+			if err := os.db.WithContext(ctx).Unscoped().Model(&types.Artifact{}).
+				Where("registry = ? AND SUBSTR(normalized_name, 1, ?) = ?", registry, len(prefix), prefix).
+				Count(&count).Error; err != nil {
+				return false, fmt.Errorf("failed to check namespace: %w", err)
+			}
+			if count > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// CreateOrganization creates an organization owning a namespace, with its
+// creator as its owner. Packages first published in the namespace take the
+// organization's default visibility, and only its owners and maintainers may
+// publish them. Only admins may create an organization whose namespace
+// already holds packages.
+func (s *Service) CreateOrganization(ctx context.Context, name string, defaultPublic bool, userID uuid.UUID) (*types.Organization, error) {
+	if !organizationNamePattern.MatchString(name) {
+		return nil, ErrInvalidOrganizationName
+	}
+
+	var user types.User
+	if err := s.DB.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if _, err := s.Organizations.Get(ctx, name); err == nil {
+		return nil, fmt.Errorf("%w: %s", ErrOrganizationExists, name)
+	} else if !errors.Is(err, ErrOrganizationNotFound) {
+		return nil, err
+	}
+
+	if !user.IsAdmin {
+		inUse, err := s.Organizations.namespaceInUse(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if inUse {
+			return nil, fmt.Errorf("%w: %s", ErrNamespaceInUse, name)
+		}
+	}
+
+	org := &types.Organization{Name: name, DefaultPublic: defaultPublic, CreatedBy: userID}
+	if err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return fmt.Errorf("failed to create organization: %w", err)
+		}
+		return tx.Create(&types.OrganizationMember{
+			OrganizationID: org.ID,
+			UserID:         userID,
+			Role:           RoleOwner,
+			GrantedBy:      userID,
+		}).Error
+	}); err != nil {
+		return nil, err
+	}
+
+	log.Info().Str("organization", name).Str("user_id", userID.String()).Msg("Organization created")
+	s.auditLog.Record(ctx, userID, audit.ActionOrgCreate, generateOrganizationKey(name), map[string]interface{}{
+		"default_public": defaultPublic,
+	})
+	return org, nil
+}
+
+// GetOrganization returns the organization with a name
+func (s *Service) GetOrganization(ctx context.Context, name string) (*types.Organization, error) {
+	return s.Organizations.Get(ctx, name)
+}
+
+// SetOrganizationVisibility changes the visibility packages first published
+// in an organization's namespace take. Packages already published keep
+// theirs. Only owners of the organization and admins may change it.
+func (s *Service) SetOrganizationVisibility(ctx context.Context, name string, defaultPublic bool, userID uuid.UUID) (*types.Organization, error) {
+	org, err := s.Organizations.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	canManage, err := s.Organizations.canManage(ctx, org, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check organization permissions: %w", err)
+	}
+	if !canManage {
+		return nil, ErrOrganizationForbidden
+	}
+
+	if err := s.DB.WithContext(ctx).Model(org).Update("default_public", defaultPublic).Error; err != nil {
+		return nil, fmt.Errorf("failed to update organization: %w", err)
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionOrgUpdate, generateOrganizationKey(org.Name), map[string]interface{}{
+		"default_public": defaultPublic,
+	})
+	return org, nil
+}
+
+// GetOrganizationMembers returns the members of an organization
+func (s *Service) GetOrganizationMembers(ctx context.Context, name string) ([]types.OrganizationMember, error) {
+	org, err := s.Organizations.Get(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return s.Organizations.Members(ctx, org.ID)
+}
+
+// SetOrganizationMember adds a user to an organization, or changes the role
+// of a member. Members hold their role on every package in the
+// organization's namespace. Only owners of the organization and admins may
+// manage its members.
+func (s *Service) SetOrganizationMember(ctx context.Context, name, username, role string, userID uuid.UUID) error {
+	if role != RoleOwner && role != RoleMaintainer && role != RoleContributor {
+		return ErrInvalidOwnerRole
+	}
+	org, err := s.Organizations.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	canManage, err := s.Organizations.canManage(ctx, org, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check organization permissions: %w", err)
+	}
+	if !canManage {
+		return ErrOrganizationForbidden
+	}
+	target, err := s.collaborator(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var member types.OrganizationMember
+		err := tx.Where("organization_id = ? AND user_id = ?", org.ID, target.ID).First(&member).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return tx.Create(&types.OrganizationMember{
+				OrganizationID: org.ID,
+				UserID:         target.ID,
+				Role:           role,
+				GrantedBy:      userID,
+			}).Error
+		case err != nil:
+			return fmt.Errorf("failed to get organization membership: %w", err)
+		}
+
+		if member.Role == RoleOwner && role != RoleOwner {
+			if err := checkOtherOrganizationOwner(tx, org.ID, target.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&member).Updates(map[string]interface{}{"role": role, "granted_by": userID}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionOrgMemberSet, generateOrganizationKey(org.Name), map[string]interface{}{
+		"user_id": target.ID.String(),
+		"role":    role,
+	})
+	return nil
+}
+
+// RemoveOrganizationMember removes a user from an organization. Owners of
+// the organization and admins may remove any member, and members may leave.
+// The last owner cannot be removed.
+func (s *Service) RemoveOrganizationMember(ctx context.Context, name, username string, userID uuid.UUID) error {
+	org, err := s.Organizations.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+	target, err := s.collaborator(ctx, username)
+	if err != nil {
+		return err
+	}
+	if target.ID != userID {
+		canManage, err := s.Organizations.canManage(ctx, org, userID)
+		if err != nil {
+			return fmt.Errorf("failed to check organization permissions: %w", err)
+		}
+		if !canManage {
+			return ErrOrganizationForbidden
+		}
+	}
+
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var member types.OrganizationMember
+		if err := tx.Where("organization_id = ? AND user_id = ?", org.ID, target.ID).First(&member).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %s", ErrMemberNotFound, username)
+			}
+			return fmt.Errorf("failed to get organization membership: %w", err)
+		}
+		if member.Role == RoleOwner {
+			if err := checkOtherOrganizationOwner(tx, org.ID, target.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&member).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionOrgMemberRemove, generateOrganizationKey(org.Name), map[string]interface{}{
+		"user_id": target.ID.String(),
+	})
+	return nil
+}
+
+// checkOtherOrganizationOwner returns ErrLastOrganizationOwner unless an
+// organization has an owner other than the given user
+func checkOtherOrganizationOwner(tx *gorm.DB, orgID, userID uuid.UUID) error {
+	var owners int64
+	if err := tx.Model(&types.OrganizationMember{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", orgID, RoleOwner, userID).
+		Count(&owners).Error; err != nil {
+		return fmt.Errorf("failed to count organization owners: %w", err)
+	}
+	if owners == 0 {
+		return ErrLastOrganizationOwner
+	}
+	return nil
+}
+
+// ResolveVisibility returns whether a new version of a package is public.
+// Versions of an existing package follow its visibility. The first version
+// of a package takes the default visibility of the organization owning its
+// namespace, or the configured default visibility otherwise.
+func (s *Service) ResolveVisibility(ctx context.Context, registryType, name string) (bool, error) {
+	var versions []bool
+	if err := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+		Where("normalized_name = ? AND registry = ?", utils.NormalizePackageName(name, registryType), registryType).
+		Pluck("is_public", &versions).Error; err != nil {
+		return false, fmt.Errorf("failed to get package visibility: %w", err)
+	}
+	if len(versions) > 0 {
+		for _, public := range versions {
+			if public {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	org, err := s.Organizations.ForPackage(ctx, registryType, name)
+	if err != nil {
+		return false, err
+	}
+	if org != nil {
+		return org.DefaultPublic, nil
+	}
+	return s.config.DefaultPublic, nil
+}
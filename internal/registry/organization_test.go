@@ -0,0 +1,243 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageNamespaces(t *testing.T) {
+	tests := []struct {
+		registry string
+		name     string
+		expected []string
+	}{
+		{"npm", "@Acme/widgets", []string{"acme"}},
+		{"npm", "widgets", nil},
+		{"oci", "acme/tools/app", []string{"acme"}},
+		{"oci", "app", nil},
+		{"maven", "com.acme.tools:cli", []string{"com.acme.tools", "com.acme", "com"}},
+		{"maven", "cli", nil},
+		{"nuget", "Acme.Widgets", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.registry+"/"+tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, packageNamespaces(tt.registry, tt.name))
+		})
+	}
+}
+
+// setupOrganizationTest returns a service uploading npm packages through a
+// mock handler, and an organization owned by the returned user
+func setupOrganizationTest(t *testing.T) (*Service, *types.User, *types.Organization) {
+	t.Helper()
+
+	service, db, _ := setupTestService(t)
+	mockHandler := &MockHandler{}
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), mock.Anything).Return(nil).Maybe()
+	mockHandler.On("GetMetadata", mock.Anything).Return(map[string]interface{}{}, nil).Maybe()
+	mockHandler.On("Upload", mock.Anything, mock.AnythingOfType("*types.Artifact"), mock.Anything).Return(nil).Maybe()
+	service.handlers["npm"] = mockHandler
+
+	owner := createTestUserWithAdmin(t, db, false)
+	org, err := service.CreateOrganization(context.Background(), "acme", true, owner.ID)
+	require.NoError(t, err)
+	return service, owner, org
+}
+
+func TestOrganization_ScopedPublish(t *testing.T) {
+	service, owner, _ := setupOrganizationTest(t)
+	ctx := context.Background()
+	maintainer := createTestUserWithAdmin(t, service.DB, false)
+	contributor := createTestUserWithAdmin(t, service.DB, false)
+	outsider := createTestUserWithAdmin(t, service.DB, false)
+	require.NoError(t, service.SetOrganizationMember(ctx, "acme", maintainer.Username, RoleMaintainer, owner.ID))
+	require.NoError(t, service.SetOrganizationMember(ctx, "acme", contributor.Username, RoleContributor, owner.ID))
+
+	upload := func(name, version string, user *types.User) (*types.Artifact, error) {
+		return service.Upload(ctx, "npm", name, version, bytes.NewReader([]byte(name+version)), user.ID)
+	}
+
+	// Only the organization's owners and maintainers can claim its namespace
+	_, err := upload("@acme/widgets", "1.0.0", outsider)
+	assert.ErrorIs(t, err, ErrPublishForbidden)
+	_, err = upload("@acme/widgets", "1.0.0", contributor)
+	assert.ErrorIs(t, err, ErrPublishForbidden)
+
+	artifact, err := upload("@acme/widgets", "1.0.0", maintainer)
+	require.NoError(t, err)
+	assert.True(t, artifact.IsPublic, "the package takes the organization's default visibility")
+
+	// Every maintainer publishes the packages in the namespace, whoever
+	// published them first
+	artifact, err = upload("@acme/widgets", "1.1.0", owner)
+	require.NoError(t, err)
+	assert.True(t, artifact.IsPublic)
+
+	// Outside the namespace, anyone publishes with the default visibility
+	artifact, err = upload("widgets", "1.0.0", outsider)
+	require.NoError(t, err)
+	assert.False(t, artifact.IsPublic)
+	_, err = upload("@other/widgets", "1.0.0", outsider)
+	require.NoError(t, err)
+
+	service.Configure(config.RegistryConfig{DefaultPublic: true})
+	artifact, err = upload("gadgets", "1.0.0", outsider)
+	require.NoError(t, err)
+	assert.True(t, artifact.IsPublic)
+
+	// Changing the organization's default only affects new packages
+	_, err = service.SetOrganizationVisibility(ctx, "acme", false, maintainer.ID)
+	assert.ErrorIs(t, err, ErrOrganizationForbidden)
+	_, err = service.SetOrganizationVisibility(ctx, "acme", false, owner.ID)
+	require.NoError(t, err)
+	artifact, err = upload("@acme/gizmos", "1.0.0", maintainer)
+	require.NoError(t, err)
+	assert.False(t, artifact.IsPublic)
+	artifact, err = upload("@acme/widgets", "1.2.0", maintainer)
+	require.NoError(t, err)
+	assert.True(t, artifact.IsPublic)
+}
+
+func TestOrganization_MemberAccess(t *testing.T) {
+	service, owner, _ := setupOrganizationTest(t)
+	ctx := context.Background()
+	maintainer := createTestUserWithAdmin(t, service.DB, false)
+	outsider := createTestUserWithAdmin(t, service.DB, false)
+	require.NoError(t, service.SetOrganizationMember(ctx, "acme", maintainer.Username, RoleMaintainer, owner.ID))
+
+	_, err := service.Upload(ctx, "npm", "@acme/widgets", "1.0.0", bytes.NewReader([]byte("widgets")), maintainer.ID)
+	require.NoError(t, err)
+	_, err = service.SetOrganizationVisibility(ctx, "acme", false, owner.ID)
+	require.NoError(t, err)
+	_, err = service.Upload(ctx, "npm", "@acme/private", "1.0.0", bytes.NewReader([]byte("private")), maintainer.ID)
+	require.NoError(t, err)
+
+	// Organization owners hold the owner role on every package in the
+	// namespace; maintainers publish but do not delete
+	for _, check := range []struct {
+		user                        *types.User
+		publish, delete, manageRole bool
+	}{
+		{owner, true, true, true},
+		{maintainer, true, true, true}, // the package's first publisher owns it
+		{outsider, false, false, false},
+	} {
+		canPublish, err := service.Ownership.CanUserPublish(ctx, "npm", "@acme/widgets", check.user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, check.publish, canPublish, check.user.Username)
+		canDelete, err := service.Ownership.CanUserDelete(ctx, "npm", "@acme/widgets", check.user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, check.delete, canDelete, check.user.Username)
+		canManage, err := service.Ownership.CanUserManageOwnership(ctx, "npm", "@acme/widgets", check.user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, check.manageRole, canManage, check.user.Username)
+	}
+
+	// A maintainer who joins later can publish but not delete
+	late := createTestUserWithAdmin(t, service.DB, false)
+	require.NoError(t, service.SetOrganizationMember(ctx, "acme", late.Username, RoleMaintainer, owner.ID))
+	canPublish, err := service.Ownership.CanUserPublish(ctx, "npm", "@acme/widgets", late.ID)
+	require.NoError(t, err)
+	assert.True(t, canPublish)
+	canDelete, err := service.Ownership.CanUserDelete(ctx, "npm", "@acme/widgets", late.ID)
+	require.NoError(t, err)
+	assert.False(t, canDelete)
+
+	// Members read the organization's private packages
+	names, err := service.ListReadableNames(ctx, "npm", "", "", 100, late)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@acme/private", "@acme/widgets"}, names)
+	names, err = service.ListReadableNames(ctx, "npm", "", "", 100, outsider)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@acme/widgets"}, names)
+
+	access, err := service.GetArtifactAccess(ctx, "npm", "@acme/widgets")
+	require.NoError(t, err)
+	assert.Equal(t, "acme", access.Organization)
+	assert.False(t, access.AuthenticatedPublish)
+	for _, user := range access.Users {
+		if user.UserID == late.ID {
+			assert.Equal(t, []string{AccessSourceOrganization}, user.Sources)
+			assert.True(t, user.Publish)
+			assert.False(t, user.Delete)
+		}
+	}
+
+	// Removing a member removes their access
+	require.NoError(t, service.RemoveOrganizationMember(ctx, "acme", late.Username, owner.ID))
+	canPublish, err = service.Ownership.CanUserPublish(ctx, "npm", "@acme/widgets", late.ID)
+	require.NoError(t, err)
+	assert.False(t, canPublish)
+}
+
+func TestOrganization_Management(t *testing.T) {
+	service, owner, org := setupOrganizationTest(t)
+	ctx := context.Background()
+	auditLog := audit.NewService(service.DB.DB)
+	service.SetAuditLog(auditLog)
+	member := createTestUserWithAdmin(t, service.DB, false)
+	admin := createTestUserWithAdmin(t, service.DB, true)
+
+	assert.Equal(t, "acme", org.Name)
+	assert.True(t, org.DefaultPublic)
+
+	_, err := service.CreateOrganization(ctx, "acme", false, member.ID)
+	assert.ErrorIs(t, err, ErrOrganizationExists)
+	_, err = service.CreateOrganization(ctx, "Not Valid", false, member.ID)
+	assert.ErrorIs(t, err, ErrInvalidOrganizationName)
+	_, err = service.GetOrganization(ctx, "missing")
+	assert.ErrorIs(t, err, ErrOrganizationNotFound)
+
+	// Namespaces already holding packages can only be claimed by admins
+	_, err = service.Upload(ctx, "npm", "@taken/widgets", "1.0.0", bytes.NewReader([]byte("widgets")), member.ID)
+	require.NoError(t, err)
+	_, err = service.CreateOrganization(ctx, "taken", false, member.ID)
+	assert.ErrorIs(t, err, ErrNamespaceInUse)
+	_, err = service.CreateOrganization(ctx, "taken", false, admin.ID)
+	require.NoError(t, err)
+
+	// Only owners manage members, and the last owner stays
+	assert.ErrorIs(t, service.SetOrganizationMember(ctx, "acme", member.Username, RoleOwner, member.ID), ErrOrganizationForbidden)
+	assert.ErrorIs(t, service.SetOrganizationMember(ctx, "acme", member.Username, "admin", owner.ID), ErrInvalidOwnerRole)
+	assert.ErrorIs(t, service.SetOrganizationMember(ctx, "acme", "nobody", RoleMaintainer, owner.ID), ErrCollaboratorNotFound)
+	assert.ErrorIs(t, service.SetOrganizationMember(ctx, "acme", owner.Username, RoleMaintainer, owner.ID), ErrLastOrganizationOwner)
+	assert.ErrorIs(t, service.RemoveOrganizationMember(ctx, "acme", owner.Username, owner.ID), ErrLastOrganizationOwner)
+	assert.ErrorIs(t, service.RemoveOrganizationMember(ctx, "acme", member.Username, owner.ID), ErrMemberNotFound)
+
+	require.NoError(t, service.SetOrganizationMember(ctx, "acme", member.Username, RoleContributor, owner.ID))
+	require.NoError(t, service.SetOrganizationMember(ctx, "acme", member.Username, RoleOwner, owner.ID))
+	require.NoError(t, service.SetOrganizationMember(ctx, "acme", owner.Username, RoleMaintainer, member.ID))
+
+	members, err := service.GetOrganizationMembers(ctx, "acme")
+	require.NoError(t, err)
+	roles := make(map[string]string)
+	for _, m := range members {
+		roles[m.User.Username] = m.Role
+	}
+	assert.Equal(t, map[string]string{owner.Username: RoleMaintainer, member.Username: RoleOwner}, roles)
+
+	// Members can leave
+	require.NoError(t, service.RemoveOrganizationMember(ctx, "acme", owner.Username, owner.ID))
+
+	for action, expected := range map[string]int64{
+		audit.ActionOrgCreate:       1,
+		audit.ActionOrgMemberSet:    3,
+		audit.ActionOrgMemberRemove: 1,
+	} {
+		entries, total, err := auditLog.Query(ctx, audit.Filter{Action: action})
+		require.NoError(t, err)
+		assert.Equal(t, expected, total, action)
+		for _, entry := range entries {
+			assert.Contains(t, []string{"org:acme", "org:taken"}, entry.Target, action)
+		}
+	}
+}
@@ -2,11 +2,14 @@ package registry
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
 )
@@ -15,22 +18,45 @@ import (
 const (
 	RoleOwner       = "owner"       // Full control: publish, delete, manage owners
 	RoleMaintainer  = "maintainer"  // Publish and update packages
-	RoleContributor = "contributor" // Read-only access (for future use)
+	RoleContributor = "contributor" // Read-only access to restricted packages
 )
 
-// OwnershipService handles package ownership operations
+var (
+	// ErrOwnershipForbidden is returned when a user may not manage a package's owners
+	ErrOwnershipForbidden = errors.New("insufficient permissions to manage package ownership")
+
+	// ErrInvalidOwnerRole is returned for roles other than owner, maintainer and contributor
+	ErrInvalidOwnerRole = errors.New("invalid role: must be owner, maintainer, or contributor")
+
+	// ErrOwnerNotFound is returned when removing a user who has no role on the package
+	ErrOwnerNotFound = errors.New("user is not an owner of the package")
+
+	// ErrLastOwner is returned when removing the only owner of a package
+	ErrLastOwner = errors.New("cannot remove the last owner of a package")
+
+	// ErrPrimaryOwner is returned when removing or demoting the primary owner,
+	// which requires transferring the package first
+	ErrPrimaryOwner = errors.New("the primary owner cannot be removed or demoted; transfer the package first")
+)
+
+// OwnershipService handles package ownership operations. Members of the
+// organization owning a package's namespace hold their organization role on
+// the package as well.
 type OwnershipService struct {
-	db *gorm.DB
+	db   *gorm.DB
+	orgs *OrganizationService
 }
 
 // NewOwnershipService creates a new ownership service
 func NewOwnershipService(db *gorm.DB) *OwnershipService {
-	return &OwnershipService{db: db}
+	return &OwnershipService{db: db, orgs: NewOrganizationService(db)}
 }
 
-// generatePackageKey creates a unique key for a package across registries
+// generatePackageKey creates a unique key for a package across registries.
+// The key holds the package's normalized name, the name artifacts are looked
+// up by, so every casing of a name keys the same package.
 func generatePackageKey(registry, packageName string) string {
-	return fmt.Sprintf("%s:%s", registry, packageName)
+	return fmt.Sprintf("%s:%s", registry, utils.NormalizePackageName(packageName, registry))
 }
 
 // CanUserPublish checks if a user can publish a new version of a package
@@ -47,6 +73,15 @@ func (os *OwnershipService) CanUserPublish(ctx context.Context, registry, packag
 		return true, nil
 	}
 
+	// Owners and maintainers of the package's organization can publish it
+	org, orgRole, err := os.orgs.PackageRole(ctx, registry, packageName, userID)
+	if err != nil {
+		return false, err
+	}
+	if orgRole == RoleOwner || orgRole == RoleMaintainer {
+		return true, nil
+	}
+
 	// Check if package has any owners
 	var ownershipCount int64
 	if err := os.db.WithContext(ctx).Model(&types.PackageOwnership{}).
@@ -57,8 +92,9 @@ func (os *OwnershipService) CanUserPublish(ctx context.Context, registry, packag
 
 	// If no owners exist, check if user published the first version
 	if ownershipCount == 0 {
-		// For new packages, anyone can publish initially and becomes the owner
-		return true, nil
+		// For new packages, anyone can publish initially and becomes the
+		// owner, except in a namespace an organization owns
+		return org == nil, nil
 	}
 
 	// Check if user has publish permissions (owner or maintainer)
@@ -88,6 +124,15 @@ func (os *OwnershipService) CanUserDelete(ctx context.Context, registry, package
 		return true, nil
 	}
 
+	// Owners of the package's organization can delete it
+	_, orgRole, err := os.orgs.PackageRole(ctx, registry, packageName, userID)
+	if err != nil {
+		return false, err
+	}
+	if orgRole == RoleOwner {
+		return true, nil
+	}
+
 	// Only owners can delete packages
 	var ownership types.PackageOwnership
 	if err := os.db.WithContext(ctx).Where("package_key = ? AND user_id = ? AND role = ?",
@@ -115,6 +160,15 @@ func (os *OwnershipService) CanUserManageOwnership(ctx context.Context, registry
 		return true, nil
 	}
 
+	// Owners of the package's organization can manage its owners
+	_, orgRole, err := os.orgs.PackageRole(ctx, registry, packageName, userID)
+	if err != nil {
+		return false, err
+	}
+	if orgRole == RoleOwner {
+		return true, nil
+	}
+
 	// Only owners can manage ownership
 	var ownership types.PackageOwnership
 	if err := os.db.WithContext(ctx).Where("package_key = ? AND user_id = ? AND role = ?",
@@ -128,11 +182,55 @@ func (os *OwnershipService) CanUserManageOwnership(ctx context.Context, registry
 	return true, nil
 }
 
+// CanUserRead checks if a user can read a restricted package: administrators,
+// users holding any role on it, read-only contributors included, and members
+// of the organization owning its namespace
+func (os *OwnershipService) CanUserRead(ctx context.Context, registry, packageName string, userID uuid.UUID) (bool, error) {
+	return os.hasRole(ctx, registry, packageName, userID,
+		[]string{RoleOwner, RoleMaintainer, RoleContributor}, []string{RoleOwner, RoleMaintainer, RoleContributor})
+}
+
+// CanUserMaintain checks if a user is an administrator, or an owner or
+// maintainer of a package or of the organization owning its namespace. Unlike
+// CanUserPublish it is false for packages nobody owns yet.
+func (os *OwnershipService) CanUserMaintain(ctx context.Context, registry, packageName string, userID uuid.UUID) (bool, error) {
+	return os.hasRole(ctx, registry, packageName, userID,
+		[]string{RoleOwner, RoleMaintainer}, []string{RoleOwner, RoleMaintainer})
+}
+
+// hasRole checks if a user is an administrator, holds one of packageRoles on
+// a package or one of orgRoles in the organization owning its namespace
+func (os *OwnershipService) hasRole(ctx context.Context, registry, packageName string, userID uuid.UUID, packageRoles, orgRoles []string) (bool, error) {
+	var user types.User
+	if err := os.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.IsAdmin {
+		return true, nil
+	}
+
+	_, orgRole, err := os.orgs.PackageRole(ctx, registry, packageName, userID)
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(orgRoles, orgRole) {
+		return true, nil
+	}
+
+	var count int64
+	if err := os.db.WithContext(ctx).Model(&types.PackageOwnership{}).
+		Where("package_key = ? AND user_id = ? AND role IN ?", generatePackageKey(registry, packageName), userID, packageRoles).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check ownership: %w", err)
+	}
+	return count > 0, nil
+}
+
 // AddOwner adds a new owner/maintainer to a package
 func (os *OwnershipService) AddOwner(ctx context.Context, registry, packageName string, targetUserID, grantedByUserID uuid.UUID, role string) error {
 	// Validate role
 	if role != RoleOwner && role != RoleMaintainer && role != RoleContributor {
-		return fmt.Errorf("invalid role: %s", role)
+		return fmt.Errorf("%w: %s", ErrInvalidOwnerRole, role)
 	}
 
 	// Check if granting user has permission
@@ -142,7 +240,7 @@ func (os *OwnershipService) AddOwner(ctx context.Context, registry, packageName
 	}
 
 	if !canManage {
-		return fmt.Errorf("insufficient permissions to manage package ownership")
+		return ErrOwnershipForbidden
 	}
 
 	packageKey := generatePackageKey(registry, packageName)
@@ -151,6 +249,10 @@ func (os *OwnershipService) AddOwner(ctx context.Context, registry, packageName
 	var existingOwnership types.PackageOwnership
 	if err := os.db.WithContext(ctx).Where("package_key = ? AND user_id = ?",
 		packageKey, targetUserID).First(&existingOwnership).Error; err == nil {
+		if existingOwnership.IsPrimary && role != RoleOwner {
+			return ErrPrimaryOwner
+		}
+
 		// Update existing role
 		existingOwnership.Role = role
 		existingOwnership.GrantedBy = grantedByUserID
@@ -158,12 +260,24 @@ func (os *OwnershipService) AddOwner(ctx context.Context, registry, packageName
 		return os.db.WithContext(ctx).Save(&existingOwnership).Error
 	}
 
+	// The first owner of a package, such as one an admin adds to a package
+	// nobody owned, becomes its primary owner
+	primary := false
+	if role == RoleOwner {
+		current, err := os.GetPrimaryOwner(ctx, registry, packageName)
+		if err != nil {
+			return err
+		}
+		primary = current == nil
+	}
+
 	// Create new ownership
 	ownership := &types.PackageOwnership{
 		ID:         uuid.New(),
 		PackageKey: packageKey,
 		UserID:     targetUserID,
 		Role:       role,
+		IsPrimary:  primary,
 		GrantedBy:  grantedByUserID,
 		GrantedAt:  time.Now(),
 	}
@@ -193,19 +307,34 @@ func (os *OwnershipService) RemoveOwner(ctx context.Context, registry, packageNa
 	}
 
 	if !canManage {
-		return fmt.Errorf("insufficient permissions to manage package ownership")
+		return ErrOwnershipForbidden
 	}
 
-	// Prevent removing the last owner
-	var ownerCount int64
-	if err := os.db.WithContext(ctx).Model(&types.PackageOwnership{}).
-		Where("package_key = ? AND role = ?", packageKey, RoleOwner).
-		Count(&ownerCount).Error; err != nil {
-		return fmt.Errorf("failed to count owners: %w", err)
+	var target types.PackageOwnership
+	if err := os.db.WithContext(ctx).Where("package_key = ? AND user_id = ?",
+		packageKey, targetUserID).First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrOwnerNotFound
+		}
+		return fmt.Errorf("failed to get ownership: %w", err)
 	}
 
-	if ownerCount <= 1 {
-		return fmt.Errorf("cannot remove the last owner of a package")
+	if target.Role == RoleOwner {
+		// Prevent removing the last owner
+		var ownerCount int64
+		if err := os.db.WithContext(ctx).Model(&types.PackageOwnership{}).
+			Where("package_key = ? AND role = ?", packageKey, RoleOwner).
+			Count(&ownerCount).Error; err != nil {
+			return fmt.Errorf("failed to count owners: %w", err)
+		}
+
+		if ownerCount <= 1 {
+			return ErrLastOwner
+		}
+	}
+
+	if target.IsPrimary {
+		return ErrPrimaryOwner
 	}
 
 	// Remove ownership
@@ -258,6 +387,7 @@ func (os *OwnershipService) EstablishInitialOwnership(ctx context.Context, regis
 		PackageKey: packageKey,
 		UserID:     userID,
 		Role:       RoleOwner,
+		IsPrimary:  true,
 		GrantedBy:  userID, // Self-granted for initial ownership
 		GrantedAt:  time.Now(),
 	}
@@ -274,6 +404,20 @@ func (os *OwnershipService) EstablishInitialOwnership(ctx context.Context, regis
 	return nil
 }
 
+// GetPrimaryOwner returns the primary owner of a package, or nil if it has none
+func (os *OwnershipService) GetPrimaryOwner(ctx context.Context, registry, packageName string) (*types.PackageOwnership, error) {
+	var ownership types.PackageOwnership
+	if err := os.db.WithContext(ctx).Where("package_key = ? AND is_primary = ?",
+		generatePackageKey(registry, packageName), true).First(&ownership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get primary owner: %w", err)
+	}
+
+	return &ownership, nil
+}
+
 // GetUserPackages returns all packages a user has access to
 func (os *OwnershipService) GetUserPackages(ctx context.Context, userID uuid.UUID) ([]types.PackageOwnership, error) {
 	var ownerships []types.PackageOwnership
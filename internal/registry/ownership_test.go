@@ -19,7 +19,7 @@ func setupTestOwnershipService(t *testing.T) (*OwnershipService, *common.Databas
 	require.NoError(t, err)
 
 	// Run auto migrations
-	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.PackageOwnership{})
+	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{}, &types.OwnershipTransfer{})
 	require.NoError(t, err)
 
 	commonDB := &common.Database{DB: db}
@@ -189,15 +189,43 @@ func TestAddOwnerAndRemoveOwner(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, owners, 2)
 
-	// Try to remove the first owner
+	// Co-owners cannot remove or demote the primary owner
 	err = service.RemoveOwner(ctx, "npm", "test-package", owner.ID, newOwner.ID)
+	assert.ErrorIs(t, err, ErrPrimaryOwner)
+	err = service.AddOwner(ctx, "npm", "test-package", owner.ID, newOwner.ID, RoleMaintainer)
+	assert.ErrorIs(t, err, ErrPrimaryOwner)
+
+	// Remove the co-owner
+	err = service.RemoveOwner(ctx, "npm", "test-package", newOwner.ID, owner.ID)
 	assert.NoError(t, err)
 
 	// Verify only one owner remains
 	owners, err = service.GetPackageOwners(ctx, "npm", "test-package")
 	assert.NoError(t, err)
 	assert.Len(t, owners, 1)
-	assert.Equal(t, newOwner.ID, owners[0].UserID)
+	assert.Equal(t, owner.ID, owners[0].UserID)
+	assert.True(t, owners[0].IsPrimary)
+
+	// Removing someone who has no role fails
+	err = service.RemoveOwner(ctx, "npm", "test-package", newOwner.ID, owner.ID)
+	assert.ErrorIs(t, err, ErrOwnerNotFound)
+}
+
+func TestRemoveMaintainer(t *testing.T) {
+	service, db := setupTestOwnershipService(t)
+	owner := createTestUserWithAdmin(t, db, false)
+	maintainer := createTestUserWithAdmin(t, db, false)
+	ctx := context.Background()
+
+	require.NoError(t, service.EstablishInitialOwnership(ctx, "npm", "test-package", owner.ID))
+	require.NoError(t, service.AddOwner(ctx, "npm", "test-package", maintainer.ID, owner.ID, RoleMaintainer))
+
+	// Maintainers can be removed from a package with a single owner
+	require.NoError(t, service.RemoveOwner(ctx, "npm", "test-package", maintainer.ID, owner.ID))
+
+	canPublish, err := service.CanUserPublish(ctx, "npm", "test-package", maintainer.ID)
+	require.NoError(t, err)
+	assert.False(t, canPublish)
 }
 
 func TestRemoveLastOwner(t *testing.T) {
@@ -220,6 +248,105 @@ func TestRemoveLastOwner(t *testing.T) {
 	assert.Len(t, owners, 1)
 }
 
+func TestOwnershipTransfer(t *testing.T) {
+	service, db := setupTestOwnershipService(t)
+	owner := createTestUserWithAdmin(t, db, false)
+	coOwner := createTestUserWithAdmin(t, db, false)
+	recipient := createTestUserWithAdmin(t, db, false)
+	adminUser := createTestUserWithAdmin(t, db, true)
+	ctx := context.Background()
+
+	require.NoError(t, service.EstablishInitialOwnership(ctx, "npm", "test-package", owner.ID))
+	require.NoError(t, service.AddOwner(ctx, "npm", "test-package", coOwner.ID, owner.ID, RoleOwner))
+
+	// Only the primary owner or an admin may propose a transfer
+	_, err := service.ProposeTransfer(ctx, "npm", "test-package", recipient.ID, coOwner.ID)
+	assert.ErrorIs(t, err, ErrTransferForbidden)
+	_, err = service.ProposeTransfer(ctx, "npm", "test-package", owner.ID, owner.ID)
+	assert.ErrorIs(t, err, ErrInvalidTransfer)
+
+	// A declined transfer leaves the ownership unchanged
+	_, err = service.ProposeTransfer(ctx, "npm", "test-package", coOwner.ID, adminUser.ID)
+	require.NoError(t, err)
+	_, err = service.DeclineTransfer(ctx, "npm", "test-package", coOwner.ID)
+	require.NoError(t, err)
+	primary, err := service.GetPrimaryOwner(ctx, "npm", "test-package")
+	require.NoError(t, err)
+	assert.Equal(t, owner.ID, primary.UserID)
+
+	transfer, err := service.ProposeTransfer(ctx, "npm", "test-package", recipient.ID, owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.TransferStatusPending, transfer.Status)
+	assert.Equal(t, owner.ID, transfer.FromUserID)
+
+	// Nothing changes until the recipient accepts
+	canPublish, err := service.CanUserPublish(ctx, "npm", "test-package", recipient.ID)
+	require.NoError(t, err)
+	assert.False(t, canPublish)
+
+	incoming, err := service.GetIncomingTransfers(ctx, recipient.ID)
+	require.NoError(t, err)
+	require.Len(t, incoming, 1)
+	assert.Equal(t, transfer.ID, incoming[0].ID)
+
+	// Only the recipient can accept
+	_, err = service.AcceptTransfer(ctx, "npm", "test-package", coOwner.ID)
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+
+	accepted, err := service.AcceptTransfer(ctx, "npm", "test-package", recipient.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.TransferStatusAccepted, accepted.Status)
+	assert.NotNil(t, accepted.RespondedAt)
+
+	primary, err = service.GetPrimaryOwner(ctx, "npm", "test-package")
+	require.NoError(t, err)
+	assert.Equal(t, recipient.ID, primary.UserID)
+	assert.Equal(t, RoleOwner, primary.Role)
+
+	// The previous primary owner stays a co-owner and can no longer transfer
+	owners, err := service.GetPackageOwners(ctx, "npm", "test-package")
+	require.NoError(t, err)
+	assert.Len(t, owners, 3)
+	canTransfer, err := service.CanUserTransfer(ctx, "npm", "test-package", owner.ID)
+	require.NoError(t, err)
+	assert.False(t, canTransfer)
+	require.NoError(t, service.RemoveOwner(ctx, "npm", "test-package", owner.ID, recipient.ID))
+
+	// The transfer can only be accepted once
+	_, err = service.AcceptTransfer(ctx, "npm", "test-package", recipient.ID)
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+}
+
+func TestOwnershipTransfer_ReplaceAndCancel(t *testing.T) {
+	service, db := setupTestOwnershipService(t)
+	owner := createTestUserWithAdmin(t, db, false)
+	first := createTestUserWithAdmin(t, db, false)
+	second := createTestUserWithAdmin(t, db, false)
+	ctx := context.Background()
+
+	require.NoError(t, service.EstablishInitialOwnership(ctx, "npm", "test-package", owner.ID))
+
+	_, err := service.ProposeTransfer(ctx, "npm", "test-package", first.ID, owner.ID)
+	require.NoError(t, err)
+
+	// A new proposal replaces the pending one
+	_, err = service.ProposeTransfer(ctx, "npm", "test-package", second.ID, owner.ID)
+	require.NoError(t, err)
+	_, err = service.AcceptTransfer(ctx, "npm", "test-package", first.ID)
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+
+	_, err = service.CancelTransfer(ctx, "npm", "test-package", second.ID)
+	assert.ErrorIs(t, err, ErrTransferForbidden)
+	cancelled, err := service.CancelTransfer(ctx, "npm", "test-package", owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.TransferStatusCancelled, cancelled.Status)
+
+	_, err = service.AcceptTransfer(ctx, "npm", "test-package", second.ID)
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+	_, err = service.GetPendingTransfer(ctx, "npm", "test-package")
+	assert.ErrorIs(t, err, ErrTransferNotFound)
+}
+
 func TestGetUserPackages(t *testing.T) {
 	service, db := setupTestOwnershipService(t)
 	user := createTestUserWithAdmin(t, db, false)
@@ -254,7 +381,8 @@ func TestGeneratePackageKey(t *testing.T) {
 		expected string
 	}{
 		{"npm", "lodestone", "npm:lodestone"},
-		{"nuget", "Lodestone.Core", "nuget:Lodestone.Core"},
+		{"nuget", "Lodestone.Core", "nuget:lodestone.core"},
+		{"go", "github.com/Lodestone/Client", "go:github.com/Lodestone/Client"},
 		{"maven", "org.lodestone:server", "maven:org.lodestone:server"},
 		{"cargo", "lodestone-client", "cargo:lodestone-client"},
 	}
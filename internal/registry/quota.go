@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrQuotaExceeded is returned when an upload would take a user over quota
+	ErrQuotaExceeded = errors.New("quota exceeded")
+
+	// ErrQuotaNotFound is returned when a user has no quota for the registry
+	ErrQuotaNotFound = errors.New("quota not found")
+)
+
+// QuotaService limits the storage used by the artifacts each user publishes.
+// A user's quota across all registries defaults to the configured default
+// quota, and quotas for single registries apply in addition to it.
+type QuotaService struct {
+	db       *gorm.DB
+	auditLog *audit.Service
+
+	defaultMaxBytes     int64
+	defaultMaxArtifacts int64
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(db *gorm.DB) *QuotaService {
+	return &QuotaService{db: db}
+}
+
+// SetDefaults sets the limits across all registries of users without a quota
+// of their own; 0 leaves a limit unlimited
+func (s *QuotaService) SetDefaults(maxBytes, maxArtifacts int64) {
+	s.defaultMaxBytes = maxBytes
+	s.defaultMaxArtifacts = maxArtifacts
+}
+
+// GetQuotas returns the quotas set for a user
+func (s *QuotaService) GetQuotas(ctx context.Context, userID uuid.UUID) ([]types.Quota, error) {
+	var quotas []types.Quota
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("registry_name").
+		Find(&quotas).Error; err != nil {
+		return nil, fmt.Errorf("failed to get quotas: %w", err)
+	}
+	return quotas, nil
+}
+
+// SetQuota creates or replaces a user's quota for the quota's registry, or
+// across all registries if it names none
+func (s *QuotaService) SetQuota(ctx context.Context, quota *types.Quota, updatedBy uuid.UUID) error {
+	if quota.MaxBytes < 0 || quota.MaxArtifacts < 0 {
+		return fmt.Errorf("quota limits must not be negative")
+	}
+
+	var existing types.Quota
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND registry_name = ?", quota.UserID, quota.RegistryName).
+		First(&existing).Error
+	switch {
+	case err == nil:
+		quota.ID = existing.ID
+		quota.CreatedAt = existing.CreatedAt
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("failed to get quota: %w", err)
+	}
+	quota.UpdatedBy = &updatedBy
+
+	if err := s.db.WithContext(ctx).Save(quota).Error; err != nil {
+		return fmt.Errorf("failed to save quota: %w", err)
+	}
+
+	log.Info().
+		Str("user_id", quota.UserID.String()).
+		Str("registry", quota.RegistryName).
+		Int64("max_bytes", quota.MaxBytes).
+		Int64("max_artifacts", quota.MaxArtifacts).
+		Str("updated_by", updatedBy.String()).
+		Msg("quota updated")
+
+	s.auditLog.Record(ctx, updatedBy, audit.ActionQuotaSet, quota.UserID.String(), map[string]interface{}{
+		"registry":      quota.RegistryName,
+		"max_bytes":     quota.MaxBytes,
+		"max_artifacts": quota.MaxArtifacts,
+	})
+	return nil
+}
+
+// DeleteQuota removes a user's quota for a registry, or across all registries
+// if registryName is empty, reverting to the default quota
+func (s *QuotaService) DeleteQuota(ctx context.Context, userID uuid.UUID, registryName string, deletedBy uuid.UUID) error {
+	result := s.db.WithContext(ctx).
+		Where("user_id = ? AND registry_name = ?", userID, registryName).
+		Delete(&types.Quota{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete quota: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrQuotaNotFound
+	}
+
+	s.auditLog.Record(ctx, deletedBy, audit.ActionQuotaDelete, userID.String(), map[string]interface{}{
+		"registry": registryName,
+	})
+	return nil
+}
+
+// Usage reports a user's usage of each quota that applies to them: the
+// quota across all registries, followed by any for single registries
+func (s *QuotaService) Usage(ctx context.Context, userID uuid.UUID) ([]types.QuotaUsage, error) {
+	quotas, err := s.GetQuotas(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := []types.Quota{s.overallQuota(userID, quotas)}
+	for _, quota := range quotas {
+		if quota.RegistryName != "" {
+			limits = append(limits, quota)
+		}
+	}
+
+	usage := make([]types.QuotaUsage, 0, len(limits))
+	for _, limit := range limits {
+		bytes, artifacts, err := s.used(ctx, userID, limit.RegistryName)
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, types.QuotaUsage{
+			RegistryName: limit.RegistryName,
+			Bytes:        bytes,
+			Artifacts:    artifacts,
+			MaxBytes:     limit.MaxBytes,
+			MaxArtifacts: limit.MaxArtifacts,
+		})
+	}
+	return usage, nil
+}
+
+// CheckUpload returns ErrQuotaExceeded if publishing an artifact of the given
+// size to a registry would take the user over any quota that applies
+func (s *QuotaService) CheckUpload(ctx context.Context, userID uuid.UUID, registryName string, size int64) error {
+	quotas, err := s.GetQuotas(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	limits := []types.Quota{s.overallQuota(userID, quotas)}
+	for _, quota := range quotas {
+		if quota.RegistryName == registryName {
+			limits = append(limits, quota)
+		}
+	}
+
+	for _, limit := range limits {
+		if limit.MaxBytes == 0 && limit.MaxArtifacts == 0 {
+			continue
+		}
+
+		bytes, artifacts, err := s.used(ctx, userID, limit.RegistryName)
+		if err != nil {
+			return err
+		}
+
+		scope := "all registries"
+		if limit.RegistryName != "" {
+			scope = limit.RegistryName
+		}
+		if limit.MaxBytes > 0 && bytes+size > limit.MaxBytes {
+			return fmt.Errorf("%w: %d of %d bytes used in %s, upload is %d bytes", ErrQuotaExceeded, bytes, limit.MaxBytes, scope, size)
+		}
+		if limit.MaxArtifacts > 0 && artifacts+1 > limit.MaxArtifacts {
+			return fmt.Errorf("%w: %d of %d artifacts used in %s", ErrQuotaExceeded, artifacts, limit.MaxArtifacts, scope)
+		}
+	}
+	return nil
+}
+
+// overallQuota returns the user's quota across all registries, or the
+// default quota if they have none
+func (s *QuotaService) overallQuota(userID uuid.UUID, quotas []types.Quota) types.Quota {
+	for _, quota := range quotas {
+		if quota.RegistryName == "" {
+			return quota
+		}
+	}
+	return types.Quota{UserID: userID, MaxBytes: s.defaultMaxBytes, MaxArtifacts: s.defaultMaxArtifacts}
+}
+
+// used sums the size and number of artifacts a user has published to a
+// registry, or to all registries if registryName is empty
+func (s *QuotaService) used(ctx context.Context, userID uuid.UUID, registryName string) (int64, int64, error) {
+	query := s.db.WithContext(ctx).Model(&types.Artifact{}).Where("published_by = ?", userID)
+	if registryName != "" {
+		query = query.Where("registry = ?", registryName)
+	}
+
+	var usage struct {
+		Bytes     int64
+		Artifacts int64
+	}
+	if err := query.Select("COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS artifacts").Scan(&usage).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to compute quota usage: %w", err)
+	}
+	return usage.Bytes, usage.Artifacts, nil
+}
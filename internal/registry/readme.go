@@ -0,0 +1,106 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// ErrReadmeNotFound is returned when a package has no README
+var ErrReadmeNotFound = errors.New("readme not found")
+
+// GetReadme returns the markdown README of a package, taken from the most
+// recent version published with one. Packages the request cannot read have
+// no README.
+func (s *Service) GetReadme(ctx context.Context, registryType, name string) (*types.PackageMetadata, error) {
+	readable, err := s.CanReadPackage(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+	if !readable {
+		return nil, fmt.Errorf("%w: %s", ErrReadmeNotFound, name)
+	}
+
+	var metadata types.PackageMetadata
+	if err := s.DB.WithContext(ctx).
+		Where("registry = ? AND LOWER(name) = LOWER(?)", registryType, name).
+		First(&metadata).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrReadmeNotFound, name)
+		}
+		return nil, fmt.Errorf("failed to get package metadata: %w", err)
+	}
+	if metadata.Readme == "" {
+		return nil, fmt.Errorf("%w: %s", ErrReadmeNotFound, name)
+	}
+	return &metadata, nil
+}
+
+// storeReadme extracts the README of a published artifact and keeps it as the
+// package's README, unless a later version already provided one. README
+// problems are logged rather than failing the publish.
+func (s *Service) storeReadme(ctx context.Context, artifact *types.Artifact, content []byte) {
+	extractor, ok := s.handlers[artifact.Registry].(ReadmeExtractor)
+	if !ok || artifact.Status != types.ArtifactStatusPublished {
+		return
+	}
+
+	readme, err := extractor.ExtractReadme(content)
+	if err != nil {
+		log.Warn().Err(err).Str("name", artifact.Name).Str("version", artifact.Version).Msg("Failed to extract package README")
+		return
+	}
+	if strings.TrimSpace(readme) == "" {
+		return
+	}
+
+	var metadata types.PackageMetadata
+	err = s.DB.WithContext(ctx).
+		Where("registry = ? AND LOWER(name) = LOWER(?)", artifact.Registry, artifact.Name).
+		First(&metadata).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		metadata = types.PackageMetadata{Registry: artifact.Registry, Name: artifact.Name}
+	case err != nil:
+		log.Warn().Err(err).Str("name", artifact.Name).Msg("Failed to get package metadata")
+		return
+	case metadata.Version != "" && utils.CompareVersions(artifact.Version, metadata.Version) == -1:
+		// Publishing a fix to an older release keeps the newer README
+		return
+	}
+
+	metadata.Readme = readme
+	metadata.Version = artifact.Version
+	if err := s.DB.WithContext(ctx).Save(&metadata).Error; err != nil {
+		log.Warn().Err(err).Str("name", artifact.Name).Str("version", artifact.Version).Msg("Failed to store package README")
+	}
+}
+
+// storeReadmeFromStorage stores the README of a published artifact whose
+// content is only in storage, such as one published on approval
+func (s *Service) storeReadmeFromStorage(ctx context.Context, artifact *types.Artifact) {
+	if _, ok := s.handlers[artifact.Registry].(ReadmeExtractor); !ok {
+		return
+	}
+
+	reader, err := s.Storage.Retrieve(ctx, artifact.StoragePath)
+	if err != nil {
+		log.Warn().Err(err).Str("name", artifact.Name).Str("version", artifact.Version).Msg("Failed to read artifact for README")
+		return
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		log.Warn().Err(err).Str("name", artifact.Name).Str("version", artifact.Version).Msg("Failed to read artifact for README")
+		return
+	}
+	s.storeReadme(ctx, artifact, content)
+}
@@ -0,0 +1,276 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// reconcileBatchSize is how many artifacts are loaded at a time while
+// reconciling storage
+const reconcileBatchSize = 500
+
+// reconcileSkippedPrefixes hold stored content no artifact refers to by its
+// storage path: OCI repositories, which OCI garbage collection keeps tidy,
+// package icons, OCI upload sessions under temp/, and uploads being spooled
+// into storage by receiveContent, which may take longer than the minimum age
+var reconcileSkippedPrefixes = []string{"oci/", "icons/", "temp/", uploadSpoolPrefix}
+
+// reconcileSkippedSuffixes mark stored content kept beside an artifact
+// rather than referred to by it, such as Helm chart provenance files
+var reconcileSkippedSuffixes = []string{".prov"}
+
+// ReconcileOptions controls a storage reconciliation run
+type ReconcileOptions struct {
+	DryRun bool // report orphaned content without removing it
+}
+
+// MissingContent is an artifact whose content is not in storage
+type MissingContent struct {
+	ID          uuid.UUID `json:"id"`
+	Registry    string    `json:"registry"`
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	StoragePath string    `json:"storage_path"`
+	Deleted     bool      `json:"deleted"` // the artifact is deleted but can still be restored
+}
+
+// ReconcileResult reports what a storage reconciliation run found, and what
+// it removed
+type ReconcileResult struct {
+	DryRun           bool             `json:"dry_run"`
+	BlobsScanned     int              `json:"blobs_scanned"`
+	ArtifactsScanned int              `json:"artifacts_scanned"`
+	OrphanedBlobs    []string         `json:"orphaned_blobs"` // stored content no artifact refers to
+	MissingBlobs     []MissingContent `json:"missing_blobs"`  // artifacts whose content is not stored
+	DeletedBlobs     []string         `json:"deleted_blobs"`
+	FreedBytes       int64            `json:"freed_bytes"`
+}
+
+// ReconcileStorage cross-checks stored content against the storage paths of
+// artifacts, deleted ones included. Content no artifact refers to is
+// reported and, unless this is a dry run, removed. Artifacts whose content
+// is missing are only reported: their records are kept so the content can be
+// restored from a backup. Content stored more recently than the configured
+// minimum age is left alone, as its upload may not have created its artifact
+// yet. OCI content is left to OCI garbage collection. Runs other than dry
+// runs are audited.
+func (s *Service) ReconcileStorage(ctx context.Context, opts ReconcileOptions, userID uuid.UUID) (*ReconcileResult, error) {
+	logger := log.With().Bool("dry_run", opts.DryRun).Logger()
+	started := time.Now()
+	result := &ReconcileResult{
+		DryRun:        opts.DryRun,
+		OrphanedBlobs: []string{},
+		MissingBlobs:  []MissingContent{},
+		DeletedBlobs:  []string{},
+	}
+
+	// Storage is listed before artifacts are loaded, so content stored by an
+	// upload finishing meanwhile is found referred to
+	paths, err := s.Storage.List(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storage: %w", err)
+	}
+	var scanned []string
+	stored := make(map[string]bool, len(paths))
+	for _, storagePath := range paths {
+		storagePath = path.Clean(strings.ReplaceAll(storagePath, "\\", "/"))
+		if isReconcileSkipped(storagePath) || stored[storagePath] {
+			continue
+		}
+		scanned = append(scanned, storagePath)
+		stored[storagePath] = true
+	}
+	result.BlobsScanned = len(scanned)
+
+	referenced := make(map[string]bool)
+	var artifacts []types.Artifact
+	err = s.DB.WithContext(ctx).Unscoped().
+		Select("id", "registry", "name", "version", "storage_path", "deleted_at").
+		Where("registry <> ?", "oci").
+		FindInBatches(&artifacts, reconcileBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, artifact := range artifacts {
+				result.ArtifactsScanned++
+				referenced[artifact.StoragePath] = true
+				if stored[artifact.StoragePath] || isReconcileSkipped(artifact.StoragePath) {
+					continue
+				}
+
+				// Content stored after storage was listed is not missing
+				exists, err := s.Storage.Exists(ctx, artifact.StoragePath)
+				if err != nil {
+					return fmt.Errorf("failed to check %s: %w", artifact.StoragePath, err)
+				}
+				if exists {
+					continue
+				}
+				result.MissingBlobs = append(result.MissingBlobs, MissingContent{
+					ID:          artifact.ID,
+					Registry:    artifact.Registry,
+					Name:        artifact.Name,
+					Version:     artifact.Version,
+					StoragePath: artifact.StoragePath,
+					Deleted:     artifact.DeletedAt.Valid,
+				})
+				logger.Warn().
+					Str("registry", artifact.Registry).
+					Str("name", artifact.Name).
+					Str("version", artifact.Version).
+					Str("storage_path", artifact.StoragePath).
+					Msg("Artifact content is missing from storage")
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile artifacts: %w", err)
+	}
+
+	for _, storagePath := range scanned {
+		if referenced[storagePath] {
+			continue
+		}
+		if minAge := s.config.ReconcileMinAge; minAge > 0 {
+			modTime, err := s.Storage.GetModTime(ctx, storagePath)
+			if err != nil {
+				logger.Warn().Err(err).Str("storage_path", storagePath).Msg("Failed to check age of unreferenced content")
+				continue
+			}
+			if time.Since(modTime) < minAge {
+				continue
+			}
+		}
+		result.OrphanedBlobs = append(result.OrphanedBlobs, storagePath)
+		if opts.DryRun {
+			continue
+		}
+
+		size, err := s.removeOrphanedBlob(ctx, storagePath)
+		if err != nil {
+			logger.Warn().Err(err).Str("storage_path", storagePath).Msg("Failed to remove orphaned content")
+			continue
+		}
+		if size < 0 {
+			continue
+		}
+		result.DeletedBlobs = append(result.DeletedBlobs, storagePath)
+		result.FreedBytes += size
+	}
+
+	logger.Info().
+		Int("blobs_scanned", result.BlobsScanned).
+		Int("artifacts_scanned", result.ArtifactsScanned).
+		Int("orphaned_blobs", len(result.OrphanedBlobs)).
+		Int("missing_blobs", len(result.MissingBlobs)).
+		Int("deleted_blobs", len(result.DeletedBlobs)).
+		Dur("duration", time.Since(started)).
+		Msg("Reconciled storage")
+
+	if !opts.DryRun {
+		s.auditLog.Record(ctx, userID, audit.ActionStorageReconcile, "storage", map[string]interface{}{
+			"orphaned_blobs": len(result.OrphanedBlobs),
+			"missing_blobs":  len(result.MissingBlobs),
+			"deleted_blobs":  len(result.DeletedBlobs),
+			"freed_bytes":    result.FreedBytes,
+		})
+	}
+	return result, nil
+}
+
+// removeOrphanedBlob removes content no artifact referred to when artifacts
+// were loaded and returns its size. An artifact published with the content
+// since is checked for first, in which case -1 is returned and the content
+// is kept.
+func (s *Service) removeOrphanedBlob(ctx context.Context, storagePath string) (int64, error) {
+	var count int64
+	if err := s.DB.WithContext(ctx).Unscoped().Model(&types.Artifact{}).
+		Where("storage_path = ?", storagePath).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to check artifacts: %w", err)
+	}
+	if count > 0 {
+		return -1, nil
+	}
+
+	size, err := s.Storage.GetSize(ctx, storagePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size: %w", err)
+	}
+	if err := s.Storage.Delete(ctx, storagePath); err != nil {
+		return 0, fmt.Errorf("failed to delete: %w", err)
+	}
+
+	// A reference left behind would keep the content from being removed once
+	// it is stored again and its artifacts are deleted
+	if isContentAddressed(storagePath) {
+		if err := s.DB.WithContext(ctx).Where("storage_path = ?", storagePath).
+			Delete(&types.BlobRef{}).Error; err != nil {
+			log.Warn().Err(err).Str("storage_path", storagePath).Msg("Failed to remove reference to orphaned content")
+		}
+	}
+	return size, nil
+}
+
+// isReconcileSkipped reports whether stored content is left out of
+// reconciliation
+func isReconcileSkipped(storagePath string) bool {
+	for _, prefix := range reconcileSkippedPrefixes {
+		if strings.HasPrefix(storagePath, prefix) {
+			return true
+		}
+	}
+	for _, suffix := range reconcileSkippedSuffixes {
+		if strings.HasSuffix(storagePath, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReconcileWorker reconciles storage periodically in the background
+type ReconcileWorker struct {
+	service  *Service
+	interval time.Duration
+	dryRun   bool
+}
+
+// NewReconcileWorker creates a worker that reconciles the service's storage
+// every interval. Unless deleteOrphans is set, orphaned content is only
+// reported.
+func NewReconcileWorker(service *Service, interval time.Duration, deleteOrphans bool) *ReconcileWorker {
+	return &ReconcileWorker{service: service, interval: interval, dryRun: !deleteOrphans}
+}
+
+// Start reconciles storage every interval until ctx is done. It returns
+// immediately; a non-positive interval disables the worker.
+func (w *ReconcileWorker) Start(ctx context.Context) {
+	if w.interval <= 0 {
+		log.Info().Msg("Storage reconciliation worker disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := w.service.ReconcileStorage(ctx, ReconcileOptions{DryRun: w.dryRun}, uuid.Nil); err != nil {
+					log.Error().Err(err).Msg("Storage reconciliation run failed")
+				}
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", w.interval).Bool("dry_run", w.dryRun).Msg("Storage reconciliation worker started")
+}
@@ -0,0 +1,120 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileStorage(t *testing.T) {
+	service, user, artifact := setupSoftDeleteTest(t)
+	auditLog := audit.NewService(service.DB.DB)
+	service.SetAuditLog(auditLog)
+	ctx := context.Background()
+
+	store := func(path string) {
+		t.Helper()
+		require.NoError(t, service.Storage.Store(ctx, path, strings.NewReader("orphan"), "application/octet-stream"))
+	}
+
+	// Content no artifact refers to, with a reference left behind
+	const orphanSHA = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	orphanBlob := contentAddress(orphanSHA)
+	store(orphanBlob)
+	require.NoError(t, service.DB.Create(&types.BlobRef{StoragePath: orphanBlob, SHA256: orphanSHA, Size: 6, RefCount: 1}).Error)
+
+	// An artifact whose content is gone
+	missing := &types.Artifact{
+		Name:        "right-pad",
+		Version:     "1.0.0",
+		Registry:    "test",
+		StoragePath: contentAddress("60303ae22b998861bce3b28f33eec1be758a213c86c93c076dbe9f558c11c752"),
+		PublishedBy: user.ID,
+	}
+	require.NoError(t, service.DB.Create(missing).Error)
+
+	// Content kept beside artifacts, OCI content and uploads in progress are
+	// left out
+	store("icons/test/left-pad/1.0.0/icon.png")
+	store("helm/charts/mychart-1.0.0.tgz.prov")
+	store("oci/myorg/app/blobs/sha256/" + orphanSHA)
+	store("temp/upload-sessions/" + orphanSHA)
+	store(uploadSpoolPrefix + orphanSHA)
+
+	// A deleted artifact still refers to its quarantined content
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "1.0.0", user.ID))
+
+	// Content stored within the minimum age may belong to an upload in
+	// progress, and is not orphaned yet
+	service.config.ReconcileMinAge = time.Hour
+	result, err := service.ReconcileStorage(ctx, ReconcileOptions{DryRun: true}, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, result.OrphanedBlobs)
+	service.config.ReconcileMinAge = 0
+
+	result, err = service.ReconcileStorage(ctx, ReconcileOptions{DryRun: true}, user.ID)
+	require.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, 2, result.BlobsScanned)
+	assert.Equal(t, 2, result.ArtifactsScanned)
+	assert.Equal(t, []string{orphanBlob}, result.OrphanedBlobs)
+	require.Len(t, result.MissingBlobs, 1)
+	assert.Equal(t, missing.ID, result.MissingBlobs[0].ID)
+	assert.Equal(t, missing.StoragePath, result.MissingBlobs[0].StoragePath)
+	assert.False(t, result.MissingBlobs[0].Deleted)
+	assert.Empty(t, result.DeletedBlobs)
+
+	// Dry runs remove nothing and are not audited
+	exists, err := service.Storage.Exists(ctx, orphanBlob)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	_, total, err := auditLog.Query(ctx, audit.Filter{Action: audit.ActionStorageReconcile})
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	result, err = service.ReconcileStorage(ctx, ReconcileOptions{}, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{orphanBlob}, result.OrphanedBlobs)
+	assert.Equal(t, []string{orphanBlob}, result.DeletedBlobs)
+	assert.Equal(t, int64(6), result.FreedBytes)
+	assert.Len(t, result.MissingBlobs, 1)
+
+	exists, err = service.Storage.Exists(ctx, orphanBlob)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Equal(t, int64(-1), blobRefCount(t, service, orphanBlob))
+
+	// The artifact whose content is missing is kept, as is everything else
+	var count int64
+	require.NoError(t, service.DB.Unscoped().Model(&types.Artifact{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+	for _, path := range []string{
+		quarantinePrefix + artifact.StoragePath,
+		"icons/test/left-pad/1.0.0/icon.png",
+		"helm/charts/mychart-1.0.0.tgz.prov",
+		"oci/myorg/app/blobs/sha256/" + orphanSHA,
+		"temp/upload-sessions/" + orphanSHA,
+		uploadSpoolPrefix + orphanSHA,
+	} {
+		exists, err := service.Storage.Exists(ctx, path)
+		require.NoError(t, err)
+		assert.True(t, exists, path)
+	}
+
+	entries, total, err := auditLog.Query(ctx, audit.Filter{Action: audit.ActionStorageReconcile})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), total)
+	assert.Equal(t, user.ID, *entries[0].ActorID)
+
+	// Nothing is left to remove
+	result, err = service.ReconcileStorage(ctx, ReconcileOptions{}, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, result.OrphanedBlobs)
+	assert.Empty(t, result.DeletedBlobs)
+}
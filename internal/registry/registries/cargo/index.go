@@ -0,0 +1,107 @@
+package cargo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// ErrCrateNotFound is returned for the index file of a crate with no
+// published versions
+var ErrCrateNotFound = errors.New("crate not found")
+
+// IndexPath returns the path of a crate's file in the sparse index. Crates
+// are bucketed by name the way the crates.io index is: names of one and two
+// characters under 1/ and 2/, three characters under 3/ and their first
+// character, and longer names under their first two and next two characters.
+func IndexPath(name string) string {
+	name = strings.ToLower(name)
+	switch len(name) {
+	case 0:
+		return ""
+	case 1:
+		return "1/" + name
+	case 2:
+		return "2/" + name
+	case 3:
+		return "3/" + name[:1] + "/" + name
+	default:
+		return name[:2] + "/" + name[2:4] + "/" + name
+	}
+}
+
+// NewIndexEntry builds the index entry of a published crate version from the
+// Cargo.toml metadata recorded at upload. The checksum is the SHA256 of the
+// .crate file.
+func NewIndexEntry(artifact *types.Artifact) *CargoIndexEntry {
+	entry := &CargoIndexEntry{
+		Name:     artifact.Name,
+		Vers:     artifact.Version,
+		Deps:     []CargoIndexDep{},
+		Cksum:    artifact.SHA256,
+		Features: map[string][]string{},
+	}
+
+	decodeMetadata(artifact.Metadata["deps"], &entry.Deps)
+	decodeMetadata(artifact.Metadata["features"], &entry.Features)
+	decodeMetadata(artifact.Metadata["features2"], &entry.Features2)
+	entry.Links, _ = artifact.Metadata["links"].(string)
+	entry.RustVersion, _ = artifact.Metadata["rust_version"].(string)
+	entry.Yanked, _ = artifact.Metadata["yanked"].(bool)
+
+	// Entries with features2 must declare the index format version that
+	// introduced it so older Cargo versions skip them
+	if len(entry.Features2) > 0 {
+		entry.V = 2
+	}
+	return entry
+}
+
+// decodeMetadata converts metadata recorded at upload, which is read back
+// from the database as generic values, to its typed form. Values missing or
+// of the wrong shape leave the target as it is.
+func decodeMetadata(raw interface{}, target interface{}) {
+	if raw == nil {
+		return
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, target)
+}
+
+// IndexFile returns a crate's file in the sparse index: one JSON entry per
+// published version, oldest first, each on its own line
+func (r *Registry) IndexFile(ctx context.Context, name string) ([]byte, error) {
+	if r.db == nil {
+		return nil, fmt.Errorf("index unavailable without a database")
+	}
+
+	var artifacts []*types.Artifact
+	if err := r.db.WithContext(ctx).
+		Where("registry = ? AND LOWER(name) = LOWER(?) AND status = ?", "cargo", name, types.ArtifactStatusPublished).
+		Order("created_at").
+		Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to load crate versions: %w", err)
+	}
+	if len(artifacts) == 0 {
+		return nil, ErrCrateNotFound
+	}
+
+	var buf bytes.Buffer
+	for _, artifact := range artifacts {
+		line, err := json.Marshal(NewIndexEntry(artifact))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode index entry: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,191 @@
+package cargo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// createCrate packages a crate holding the given files, the way cargo
+// package does
+func createCrate(t *testing.T, name, version string, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for path, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name + "-" + version + "/" + path, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// tokioCargoToml is a Cargo.toml normalized by cargo package
+const tokioCargoToml = `[package]
+edition = "2021"
+rust-version = "1.70"
+name = "tokio"
+version = "1.38.0"
+authors = ["Tokio Contributors <team@tokio.rs>"]
+description = "An event-driven, non-blocking I/O platform"
+license = "MIT"
+links = "tokio"
+
+[dependencies.bytes]
+version = "1.0.0"
+optional = true
+
+[dependencies.pin-project-lite]
+version = "0.2.11"
+
+[dependencies.macros]
+version = "~2.3.0"
+optional = true
+package = "tokio-macros"
+default-features = false
+features = ["full"]
+
+[dependencies.internal]
+version = "0.1"
+registry-index = "sparse+https://lodestone.example.com/api/v1/cargo/index/"
+
+[dev-dependencies.futures]
+version = "0.3.0"
+
+[target."cfg(unix)".dependencies.libc]
+version = "0.2.149"
+
+[features]
+default = []
+io-util = ["bytes"]
+full = ["io-util", "macros"]
+macros = ["dep:macros"]
+net = ["libc?/std"]
+`
+
+func TestGetMetadata_Crate(t *testing.T) {
+	registry := New(nil, nil)
+
+	content := createCrate(t, "tokio", "1.38.0", map[string]string{
+		"Cargo.toml":      tokioCargoToml,
+		"Cargo.toml.orig": "[package]\nname = \"tokio\"\nversion.workspace = true\n",
+		"src/lib.rs":      "",
+	})
+	metadata, err := registry.GetMetadata(content)
+	require.NoError(t, err)
+	assert.Equal(t, "An event-driven, non-blocking I/O platform", metadata["description"])
+	assert.Equal(t, "1.70", metadata["rust_version"])
+
+	entry := NewIndexEntry(&types.Artifact{Name: "tokio", Version: "1.38.0", SHA256: "abc123", Metadata: metadata})
+	assert.Equal(t, "tokio", entry.Links)
+	assert.Equal(t, "1.70", entry.RustVersion)
+	assert.Equal(t, map[string][]string{"default": {}, "io-util": {"bytes"}, "full": {"io-util", "macros"}}, entry.Features)
+	assert.Equal(t, map[string][]string{"macros": {"dep:macros"}, "net": {"libc?/std"}}, entry.Features2)
+	assert.Equal(t, 2, entry.V, "features2 needs index format version 2")
+
+	deps := make(map[string]CargoIndexDep)
+	for _, dep := range entry.Deps {
+		deps[dep.Name] = dep
+	}
+	require.Len(t, deps, 6)
+	assert.Equal(t, CargoIndexDep{Name: "bytes", Req: "1.0.0", Features: []string{}, Optional: true, DefaultFeatures: true, Kind: "normal", Registry: CratesIOIndex}, deps["bytes"])
+	assert.Equal(t, CargoIndexDep{Name: "tokio-macros", Req: "~2.3.0", Features: []string{"full"}, Optional: true, Kind: "normal", Registry: CratesIOIndex, ExplicitNameInToml: "macros"}, deps["tokio-macros"])
+	assert.Equal(t, "sparse+https://lodestone.example.com/api/v1/cargo/index/", deps["internal"].Registry)
+	assert.Equal(t, "dev", deps["futures"].Kind)
+	assert.Equal(t, "cfg(unix)", deps["libc"].Target)
+
+	// Content that is not a packaged crate has no Cargo.toml metadata
+	metadata, err = registry.GetMetadata([]byte("crate"))
+	require.NoError(t, err)
+	assert.NotContains(t, metadata, "deps")
+	entry = NewIndexEntry(&types.Artifact{Name: "tokio", Version: "1.0.0", Metadata: metadata})
+	assert.NotNil(t, entry.Deps)
+	assert.NotNil(t, entry.Features)
+}
+
+func TestIndexPath(t *testing.T) {
+	tests := map[string]string{
+		"a":     "1/a",
+		"xz":    "2/xz",
+		"syn":   "3/s/syn",
+		"Serde": "se/rd/serde",
+		"tokio": "to/ki/tokio",
+		"cargo": "ca/rg/cargo",
+	}
+	for name, expected := range tests {
+		assert.Equal(t, expected, IndexPath(name), name)
+	}
+}
+
+func TestIndexFile(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&types.User{}, &types.Artifact{}))
+	registry := New(nil, &common.Database{DB: db})
+	ctx := context.Background()
+
+	publish := func(version, status string, created time.Time) {
+		content := createCrate(t, "tokio", version, map[string]string{
+			"Cargo.toml": strings.Replace(tokioCargoToml, "1.38.0", version, 1),
+		})
+		metadata, err := registry.GetMetadata(content)
+		require.NoError(t, err)
+		require.NoError(t, db.Create(&types.Artifact{
+			Name:      "tokio",
+			Version:   version,
+			Registry:  "cargo",
+			SHA256:    utils.ComputeSHA256(content),
+			Metadata:  metadata,
+			Status:    status,
+			CreatedAt: created,
+		}).Error)
+	}
+	now := time.Now()
+	publish("1.38.0", types.ArtifactStatusPublished, now.Add(-time.Hour))
+	publish("1.37.0", types.ArtifactStatusPublished, now.Add(-2*time.Hour))
+	publish("1.39.0", types.ArtifactStatusPendingApproval, now)
+
+	_, err = registry.IndexFile(ctx, "missing")
+	assert.ErrorIs(t, err, ErrCrateNotFound)
+
+	data, err := registry.IndexFile(ctx, "TOKIO")
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2, "one line per published version")
+
+	// Cargo requires these fields on every entry and dependency
+	var versions []string
+	for _, line := range lines {
+		var raw map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &raw))
+		for _, key := range []string{"name", "vers", "deps", "cksum", "features", "yanked"} {
+			assert.NotNil(t, raw[key], key)
+		}
+		for _, dep := range raw["deps"].([]interface{}) {
+			for _, key := range []string{"name", "req", "features", "optional", "default_features", "kind"} {
+				assert.NotNil(t, dep.(map[string]interface{})[key], key)
+			}
+		}
+		assert.Len(t, raw["cksum"], 64)
+		assert.Equal(t, false, raw["yanked"])
+		versions = append(versions, raw["vers"].(string))
+	}
+	assert.Equal(t, []string{"1.37.0", "1.38.0"}, versions, "oldest version first")
+}
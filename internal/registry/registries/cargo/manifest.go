@@ -0,0 +1,171 @@
+package cargo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/pelletier/go-toml/v2"
+)
+
+// CratesIOIndex is the index URL naming crates.io as the registry of a
+// dependency in another registry's index
+const CratesIOIndex = "https://github.com/rust-lang/crates.io-index"
+
+// errNoCargoToml is returned for a crate without a Cargo.toml
+var errNoCargoToml = errors.New("Cargo.toml not found in crate")
+
+// ParseCrate reads the Cargo.toml of a .crate file. Cargo packages a crate as
+// a gzipped tarball with its files under a name-version directory, and
+// normalizes the Cargo.toml it includes, keeping the original beside it as
+// Cargo.toml.orig.
+func ParseCrate(content []byte) (*CargoManifest, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid crate archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := utils.NewTarReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, errNoCargoToml
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid crate archive: %w", err)
+		}
+
+		dir, file, ok := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		if !ok || dir == "" || file != "Cargo.toml" {
+			continue
+		}
+
+		data, err := tr.ReadEntry()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Cargo.toml: %w", err)
+		}
+		var manifest CargoManifest
+		if err := toml.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid Cargo.toml: %w", err)
+		}
+		return &manifest, nil
+	}
+}
+
+// IndexDeps returns the dependencies of a manifest as the index lists them,
+// sorted by name
+func (m *CargoManifest) IndexDeps() []CargoIndexDep {
+	deps := []CargoIndexDep{}
+	add := func(table interface{}, kind, target string) {
+		specs, _ := table.(map[string]interface{})
+		for name, spec := range specs {
+			deps = append(deps, indexDep(name, spec, kind, target))
+		}
+	}
+
+	add(m.Dependencies, "normal", "")
+	add(m.DevDependencies, "dev", "")
+	add(m.BuildDependencies, "build", "")
+	for target, tables := range m.Target {
+		platform, _ := tables.(map[string]interface{})
+		add(platform["dependencies"], "normal", target)
+		add(platform["dev-dependencies"], "dev", target)
+		add(platform["build-dependencies"], "build", target)
+	}
+
+	sort.SliceStable(deps, func(i, j int) bool {
+		if deps[i].Name != deps[j].Name {
+			return deps[i].Name < deps[j].Name
+		}
+		if deps[i].Kind != deps[j].Kind {
+			return deps[i].Kind < deps[j].Kind
+		}
+		return deps[i].Target < deps[j].Target
+	})
+	return deps
+}
+
+// indexDep converts a dependency of a Cargo.toml, either a version
+// requirement or a table, to an index entry. A dependency renamed with
+// package is listed under the crate it names. Dependencies without a
+// registry come from crates.io.
+func indexDep(name string, spec interface{}, kind, target string) CargoIndexDep {
+	dep := CargoIndexDep{
+		Name:            name,
+		Req:             "*",
+		Features:        []string{},
+		DefaultFeatures: true,
+		Target:          target,
+		Kind:            kind,
+		Registry:        CratesIOIndex,
+	}
+
+	switch spec := spec.(type) {
+	case string:
+		dep.Req = spec
+	case map[string]interface{}:
+		if req, ok := spec["version"].(string); ok {
+			dep.Req = req
+		}
+		if features, ok := spec["features"].([]interface{}); ok {
+			for _, feature := range features {
+				if feature, ok := feature.(string); ok {
+					dep.Features = append(dep.Features, feature)
+				}
+			}
+		}
+		dep.Optional, _ = spec["optional"].(bool)
+		if defaults, ok := spec["default-features"].(bool); ok {
+			dep.DefaultFeatures = defaults
+		} else if defaults, ok := spec["default_features"].(bool); ok {
+			dep.DefaultFeatures = defaults
+		}
+		if registry, ok := spec["registry-index"].(string); ok {
+			dep.Registry = registry
+		}
+		if pkg, ok := spec["package"].(string); ok && pkg != name {
+			dep.Name = pkg
+			dep.ExplicitNameInToml = name
+		}
+	}
+	return dep
+}
+
+// IndexFeatures returns the features of a manifest split the way the index
+// lists them: features using the dep: and weak dependency syntax older
+// Cargo versions cannot parse are listed separately, in features2
+func (m *CargoManifest) IndexFeatures() (map[string][]string, map[string][]string) {
+	features := make(map[string][]string)
+	var features2 map[string][]string
+	for name, values := range m.Features {
+		if values == nil {
+			values = []string{}
+		}
+		if usesNewFeatureSyntax(values) {
+			if features2 == nil {
+				features2 = make(map[string][]string)
+			}
+			features2[name] = values
+			continue
+		}
+		features[name] = values
+	}
+	return features, features2
+}
+
+// usesNewFeatureSyntax reports whether feature values enable optional
+// dependencies with dep: or enable dependency features weakly with ?/
+func usesNewFeatureSyntax(values []string) bool {
+	for _, value := range values {
+		if strings.HasPrefix(value, "dep:") || strings.Contains(value, "?/") {
+			return true
+		}
+	}
+	return false
+}
@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"regexp"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/internal/storage"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 )
 
 // Registry implements the Rust/Cargo package registry
@@ -66,18 +68,67 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 		return fmt.Errorf("invalid crate name format")
 	}
 
+	// Cargo requires strict SemVer 2.0: three numeric components, no v prefix
+	if _, err := semver.StrictNewVersion(artifact.Version); err != nil {
+		return fmt.Errorf("invalid crate version format: %w", err)
+	}
+
 	// TODO: Validate .crate file structure and Cargo.toml
 	return nil
 }
 
-// GetMetadata extracts metadata from Cargo package
+// GetMetadata extracts metadata from the crate's Cargo.toml, including the
+// dependencies and features its index entry lists
 func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
-	// TODO: Extract metadata from Cargo.toml
-	return map[string]interface{}{
-		"format":       "cargo",
-		"type":         "crate",
-		"rust_version": "1.70.0", // Should be extracted
-	}, nil
+	metadata := map[string]interface{}{
+		"format": "cargo",
+		"type":   "crate",
+	}
+
+	manifest, err := ParseCrate(content)
+	if err != nil {
+		// Content that is not a packaged crate has no Cargo.toml metadata
+		return metadata, nil
+	}
+
+	pkg := manifest.Package
+	for key, value := range map[string]string{
+		"description":   pkg.Description,
+		"license":       pkg.License,
+		"repository":    pkg.Repository,
+		"homepage":      pkg.Homepage,
+		"documentation": pkg.Documentation,
+		"edition":       pkg.Edition,
+		"rust_version":  pkg.RustVersion,
+		"links":         pkg.Links,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	if len(pkg.Authors) > 0 {
+		metadata["authors"] = pkg.Authors
+	}
+	if len(pkg.Keywords) > 0 {
+		metadata["keywords"] = pkg.Keywords
+	}
+	if len(pkg.Categories) > 0 {
+		metadata["categories"] = pkg.Categories
+	}
+
+	metadata["deps"] = manifest.IndexDeps()
+	features, features2 := manifest.IndexFeatures()
+	metadata["features"] = features
+	if len(features2) > 0 {
+		metadata["features2"] = features2
+	}
+	return metadata, nil
+}
+
+// ExtractReadme returns the README at the root of the crate, which cargo
+// package includes when the crate has one
+func (r *Registry) ExtractReadme(content []byte) (string, error) {
+	return utils.ExtractTarballReadme(content)
 }
 
 // GenerateStoragePath creates the storage path for Cargo packages
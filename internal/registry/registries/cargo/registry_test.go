@@ -0,0 +1,31 @@
+package cargo
+
+import (
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate_Versions(t *testing.T) {
+	registry := New(nil, nil)
+
+	valid := []string{"1.0.0", "0.4.38", "1.0.0-alpha.1", "0.12.0+wasi-0.2.0", "2.0.0-rc.3+build.1"}
+	for _, version := range valid {
+		t.Run(version, func(t *testing.T) {
+			artifact := &types.Artifact{Name: "serde", Version: version}
+			assert.NoError(t, registry.Validate(artifact, []byte("crate")))
+		})
+	}
+
+	invalid := []string{"", "1.0", "v1.0.0", "01.0.0", "1.0.0-beta..1", "1.0.0.0"}
+	for _, version := range invalid {
+		t.Run("invalid "+version, func(t *testing.T) {
+			artifact := &types.Artifact{Name: "serde", Version: version}
+			err := registry.Validate(artifact, []byte("crate"))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "invalid crate version format")
+			}
+		})
+	}
+}
@@ -3,18 +3,20 @@ package cargo
 // CargoManifest represents Cargo.toml structure
 type CargoManifest struct {
 	Package struct {
-		Name          string   `toml:"name"`
-		Version       string   `toml:"version"`
-		Authors       []string `toml:"authors"`
-		Description   string   `toml:"description"`
-		Keywords      []string `toml:"keywords"`
-		Categories    []string `toml:"categories"`
-		License       string   `toml:"license"`
-		Repository    string   `toml:"repository"`
-		Homepage      string   `toml:"homepage"`
-		Documentation string   `toml:"documentation"`
-		ReadmeFile    string   `toml:"readme"`
-		Edition       string   `toml:"edition"`
+		Name          string      `toml:"name"`
+		Version       string      `toml:"version"`
+		Authors       []string    `toml:"authors"`
+		Description   string      `toml:"description"`
+		Keywords      []string    `toml:"keywords"`
+		Categories    []string    `toml:"categories"`
+		License       string      `toml:"license"`
+		Repository    string      `toml:"repository"`
+		Homepage      string      `toml:"homepage"`
+		Documentation string      `toml:"documentation"`
+		ReadmeFile    interface{} `toml:"readme"` // a path, or false for none
+		Edition       string      `toml:"edition"`
+		RustVersion   string      `toml:"rust-version"`
+		Links         string      `toml:"links"`
 	} `toml:"package"`
 	Dependencies      map[string]interface{} `toml:"dependencies,omitempty"`
 	DevDependencies   map[string]interface{} `toml:"dev-dependencies,omitempty"`
@@ -61,13 +63,16 @@ type CargoDependency struct {
 
 // CargoIndexEntry represents an entry in the Cargo registry index
 type CargoIndexEntry struct {
-	Name     string              `json:"name"`
-	Vers     string              `json:"vers"`
-	Deps     []CargoIndexDep     `json:"deps"`
-	Cksum    string              `json:"cksum"`
-	Features map[string][]string `json:"features"`
-	Yanked   bool                `json:"yanked"`
-	Links    string              `json:"links,omitempty"`
+	Name        string              `json:"name"`
+	Vers        string              `json:"vers"`
+	Deps        []CargoIndexDep     `json:"deps"`
+	Cksum       string              `json:"cksum"`
+	Features    map[string][]string `json:"features"`
+	Features2   map[string][]string `json:"features2,omitempty"`
+	Yanked      bool                `json:"yanked"`
+	Links       string              `json:"links,omitempty"`
+	V           int                 `json:"v,omitempty"`
+	RustVersion string              `json:"rust_version,omitempty"`
 }
 
 // CargoIndexDep represents a dependency in the Cargo index
@@ -85,8 +90,9 @@ type CargoIndexDep struct {
 
 // CargoRegistryConfig represents the config.json for a Cargo registry
 type CargoRegistryConfig struct {
-	DL  string `json:"dl"`
-	API string `json:"api"`
+	DL           string `json:"dl"`
+	API          string `json:"api"`
+	AuthRequired bool   `json:"auth-required,omitempty"`
 }
 
 // CargoPublishRequest represents a publish request to Cargo registry
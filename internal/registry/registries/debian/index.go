@@ -0,0 +1,242 @@
+package debian
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// defaultArchitectures are advertised when no architecture-specific packages
+// have been uploaded, so clients do not reject the repository
+var defaultArchitectures = []string{"amd64"}
+
+// leadingFields is the conventional order of fields in a Packages stanza.
+// Remaining control fields follow in alphabetical order, then the file fields,
+// and the multi-line Description comes last.
+var leadingFields = []string{
+	"Package", "Version", "Architecture", "Maintainer", "Installed-Size",
+	"Pre-Depends", "Depends", "Recommends", "Suggests", "Conflicts",
+	"Breaks", "Replaces", "Provides", "Section", "Priority", "Homepage",
+}
+
+// Repository is the generated metadata for the distribution
+type Repository struct {
+	Architectures []string
+	Files         map[string][]byte // keyed by path relative to dists/<distribution>
+	Release       []byte
+}
+
+// NewPackageEntry builds an index entry from a stored artifact. It returns
+// false if the artifact carries no Debian control metadata.
+func NewPackageEntry(artifact *types.Artifact) (*PackageEntry, bool) {
+	control := stringMap(artifact.Metadata["control"])
+	if len(control) == 0 {
+		return nil, false
+	}
+
+	md5Sum, _ := artifact.Metadata["md5"].(string)
+	sha1Sum, _ := artifact.Metadata["sha1"].(string)
+	version, _ := SplitArtifactVersion(artifact.Version)
+
+	return &PackageEntry{
+		Control:  control,
+		Filename: PoolFilename(artifact.Name, version, control["Architecture"]),
+		Size:     artifact.Size,
+		MD5:      md5Sum,
+		SHA1:     sha1Sum,
+		SHA256:   artifact.SHA256,
+	}, true
+}
+
+// BuildRepository generates the Packages indexes and Release file for the
+// given artifacts. The Release date is taken from the newest artifact so
+// repeated requests produce identical, cacheable output.
+func BuildRepository(artifacts []*types.Artifact) *Repository {
+	entries := make([]*PackageEntry, 0, len(artifacts))
+	date := time.Unix(0, 0).UTC()
+	for _, artifact := range artifacts {
+		entry, ok := NewPackageEntry(artifact)
+		if !ok {
+			continue
+		}
+		entries = append(entries, entry)
+		if artifact.UpdatedAt.After(date) {
+			date = artifact.UpdatedAt.UTC()
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Control["Package"] != entries[j].Control["Package"] {
+			return entries[i].Control["Package"] < entries[j].Control["Package"]
+		}
+		if entries[i].Control["Version"] != entries[j].Control["Version"] {
+			return entries[i].Control["Version"] < entries[j].Control["Version"]
+		}
+		return entries[i].Control["Architecture"] < entries[j].Control["Architecture"]
+	})
+
+	repo := &Repository{
+		Architectures: architectures(entries),
+		Files:         make(map[string][]byte),
+	}
+
+	for _, arch := range append(append([]string{}, repo.Architectures...), "all") {
+		var selected []*PackageEntry
+		for _, entry := range entries {
+			entryArch := entry.Control["Architecture"]
+			if entryArch == arch || entryArch == "all" {
+				selected = append(selected, entry)
+			}
+		}
+
+		packages := BuildPackages(selected)
+		dir := fmt.Sprintf("%s/binary-%s/", Component, arch)
+		repo.Files[dir+"Packages"] = packages
+		repo.Files[dir+"Packages.gz"] = gzipBytes(packages)
+	}
+
+	repo.Release = buildRelease(repo.Files, repo.Architectures, date)
+	repo.Files["Release"] = repo.Release
+	return repo
+}
+
+// BuildPackages renders a Packages index containing the given entries
+func BuildPackages(entries []*PackageEntry) []byte {
+	var buf bytes.Buffer
+	for i, entry := range entries {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		writeStanza(&buf, entry)
+	}
+	return buf.Bytes()
+}
+
+// writeStanza writes a single package paragraph
+func writeStanza(buf *bytes.Buffer, entry *PackageEntry) {
+	written := map[string]bool{"Description": true, "Filename": true, "Size": true, "MD5sum": true, "SHA1": true, "SHA256": true}
+
+	for _, name := range leadingFields {
+		if value, ok := entry.Control[name]; ok {
+			fmt.Fprintf(buf, "%s: %s\n", name, value)
+		}
+		written[name] = true
+	}
+
+	var remaining []string
+	for name := range entry.Control {
+		if !written[name] {
+			remaining = append(remaining, name)
+		}
+	}
+	sort.Strings(remaining)
+	for _, name := range remaining {
+		fmt.Fprintf(buf, "%s: %s\n", name, entry.Control[name])
+	}
+
+	fmt.Fprintf(buf, "Filename: %s\n", entry.Filename)
+	fmt.Fprintf(buf, "Size: %d\n", entry.Size)
+	if entry.MD5 != "" {
+		fmt.Fprintf(buf, "MD5sum: %s\n", entry.MD5)
+	}
+	if entry.SHA1 != "" {
+		fmt.Fprintf(buf, "SHA1: %s\n", entry.SHA1)
+	}
+	fmt.Fprintf(buf, "SHA256: %s\n", entry.SHA256)
+	if description, ok := entry.Control["Description"]; ok {
+		fmt.Fprintf(buf, "Description: %s\n", description)
+	}
+}
+
+// buildRelease renders the Release file listing checksums of every index
+func buildRelease(files map[string][]byte, archs []string, date time.Time) []byte {
+	paths := make([]string, 0, len(files))
+	for filePath := range files {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Origin: Lodestone\n")
+	fmt.Fprintf(&buf, "Label: Lodestone\n")
+	fmt.Fprintf(&buf, "Suite: %s\n", Distribution)
+	fmt.Fprintf(&buf, "Codename: %s\n", Distribution)
+	fmt.Fprintf(&buf, "Date: %s\n", date.Format(time.RFC1123))
+	fmt.Fprintf(&buf, "Architectures: %s all\n", strings.Join(archs, " "))
+	fmt.Fprintf(&buf, "Components: %s\n", Component)
+	fmt.Fprintf(&buf, "Description: Lodestone APT repository\n")
+
+	for _, algorithm := range []struct {
+		field string
+		hash  func() hash.Hash
+	}{
+		{"MD5Sum", md5.New},
+		{"SHA1", sha1.New},
+		{"SHA256", sha256.New},
+	} {
+		fmt.Fprintf(&buf, "%s:\n", algorithm.field)
+		for _, filePath := range paths {
+			h := algorithm.hash()
+			h.Write(files[filePath])
+			fmt.Fprintf(&buf, " %s %d %s\n", hex.EncodeToString(h.Sum(nil)), len(files[filePath]), filePath)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// architectures returns the sorted architecture-specific names in use
+func architectures(entries []*PackageEntry) []string {
+	seen := make(map[string]bool)
+	var archs []string
+	for _, entry := range entries {
+		arch := entry.Control["Architecture"]
+		if arch == "" || arch == "all" || seen[arch] {
+			continue
+		}
+		seen[arch] = true
+		archs = append(archs, arch)
+	}
+	if len(archs) == 0 {
+		return append([]string{}, defaultArchitectures...)
+	}
+	sort.Strings(archs)
+	return archs
+}
+
+// stringMap converts control metadata, which is a map[string]string when
+// freshly extracted and a map[string]interface{} after a database round trip
+func stringMap(value interface{}) map[string]string {
+	switch v := value.(type) {
+	case map[string]string:
+		return v
+	case map[string]interface{}:
+		result := make(map[string]string, len(v))
+		for key, item := range v {
+			if s, ok := item.(string); ok {
+				result[key] = s
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// gzipBytes compresses data without a timestamp so output is reproducible
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
@@ -0,0 +1,323 @@
+package debian
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+const (
+	arMagic        = "!<arch>\n"
+	arHeaderSize   = 60
+	maxControlSize = 1 << 20
+)
+
+var (
+	// packageNameRegex follows Debian policy 5.6.1
+	packageNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+
+	// versionRegex follows Debian policy 5.6.12: [epoch:]upstream[-revision]
+	versionRegex = regexp.MustCompile(`^([0-9]+:)?[0-9][A-Za-z0-9.+~:-]*$`)
+
+	// architectureRegex matches architecture names such as amd64, arm64 or all
+	architectureRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// Registry implements the Debian APT repository format
+type Registry struct {
+	storage    storage.BlobStorage
+	db         *common.Database
+	signingKey *openpgp.Entity
+}
+
+// New creates a new Debian registry handler
+func New(storage storage.BlobStorage, db *common.Database) *Registry {
+	return &Registry{
+		storage: storage,
+		db:      db,
+	}
+}
+
+// SetSigningKey sets the OpenPGP key used to sign Release files. With no key
+// the repository is served unsigned and clients must mark it trusted.
+func (r *Registry) SetSigningKey(key *openpgp.Entity) {
+	r.signingKey = key
+}
+
+// SigningKey returns the key used to sign Release files, if any
+func (r *Registry) SigningKey() *openpgp.Entity {
+	return r.signingKey
+}
+
+// Upload stores a Debian package
+func (r *Registry) Upload(ctx context.Context, artifact *types.Artifact, content []byte) error {
+	reader := bytes.NewReader(content)
+	if err := r.storage.Store(ctx, artifact.StoragePath, reader, "application/vnd.debian.binary-package"); err != nil {
+		return fmt.Errorf("failed to store Debian package: %w", err)
+	}
+
+	artifact.ContentType = "application/vnd.debian.binary-package"
+	return nil
+}
+
+// Download retrieves a Debian package
+func (r *Registry) Download(name, version string) (*types.Artifact, []byte, error) {
+	return nil, nil, fmt.Errorf("use service.Download instead")
+}
+
+// List returns Debian packages matching the filter
+func (r *Registry) List(filter *types.ArtifactFilter) ([]*types.Artifact, error) {
+	return nil, fmt.Errorf("use service.List instead")
+}
+
+// Delete removes a Debian package
+func (r *Registry) Delete(name, version string) error {
+	return fmt.Errorf("use service.Delete instead")
+}
+
+// Validate checks if the artifact is a valid Debian binary package whose
+// control file matches the requested name, and the version and architecture
+// joined in its artifact version
+func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
+	if len(content) == 0 {
+		return fmt.Errorf("empty package content")
+	}
+
+	if !packageNameRegex.MatchString(artifact.Name) {
+		return fmt.Errorf("invalid Debian package name format")
+	}
+
+	version, architecture := SplitArtifactVersion(artifact.Version)
+	if !versionRegex.MatchString(version) {
+		return fmt.Errorf("invalid Debian version format")
+	}
+	if !architectureRegex.MatchString(architecture) {
+		return fmt.Errorf("artifact version must end with the package architecture")
+	}
+
+	control, err := ExtractControl(content)
+	if err != nil {
+		return err
+	}
+
+	if control.Get("Package") != artifact.Name {
+		return fmt.Errorf("package name mismatch: %s vs %s", control.Get("Package"), artifact.Name)
+	}
+
+	if control.Get("Version") != version {
+		return fmt.Errorf("package version mismatch: %s vs %s", control.Get("Version"), version)
+	}
+
+	if !architectureRegex.MatchString(control.Get("Architecture")) {
+		return fmt.Errorf("invalid or missing Architecture field")
+	}
+
+	if control.Get("Architecture") != architecture {
+		return fmt.Errorf("package architecture mismatch: %s vs %s", control.Get("Architecture"), architecture)
+	}
+
+	return nil
+}
+
+// GetMetadata extracts the control fields and the checksums needed by the
+// Packages index from a Debian package
+func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
+	control, err := ExtractControl(content)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]string, len(control.Fields))
+	for _, field := range control.Fields {
+		fields[field.Name] = field.Value
+	}
+
+	md5Sum := md5.Sum(content)
+	sha1Sum := sha1.Sum(content)
+
+	metadata := map[string]interface{}{
+		"format":       "debian",
+		"type":         "deb",
+		"control":      fields,
+		"architecture": control.Get("Architecture"),
+		"md5":          hex.EncodeToString(md5Sum[:]),
+		"sha1":         hex.EncodeToString(sha1Sum[:]),
+	}
+
+	if description := control.Get("Description"); description != "" {
+		// The first line of the description is the synopsis
+		metadata["description"] = strings.SplitN(description, "\n", 2)[0]
+	}
+	if maintainer := control.Get("Maintainer"); maintainer != "" {
+		metadata["maintainer"] = maintainer
+	}
+	if homepage := control.Get("Homepage"); homepage != "" {
+		metadata["homepage"] = homepage
+	}
+
+	return metadata, nil
+}
+
+// GenerateStoragePath creates the storage path for Debian packages. The
+// artifact version carries the architecture, so builds for each architecture
+// are stored apart.
+func (r *Registry) GenerateStoragePath(name, version string) string {
+	return fmt.Sprintf("debian/pool/%s/%s/%s/%s_%s.deb", Component, poolPrefix(name), name, name, strings.ReplaceAll(version, ":", "%3a"))
+}
+
+// PoolFilename returns the repository path at which apt fetches a package,
+// e.g. pool/main/h/hello/hello_1.0-1_amd64.deb
+func PoolFilename(name, version, architecture string) string {
+	// Epochs are not part of file names
+	if idx := strings.Index(version, ":"); idx != -1 {
+		version = version[idx+1:]
+	}
+	return path.Join("pool", Component, poolPrefix(name), name, fmt.Sprintf("%s_%s_%s.deb", name, version, architecture))
+}
+
+// poolPrefix returns the pool directory for a package: its first letter, or
+// the first four letters for lib* packages
+func poolPrefix(name string) string {
+	if strings.HasPrefix(name, "lib") && len(name) > 3 {
+		return name[:4]
+	}
+	return name[:1]
+}
+
+// ExtractControl reads the control file from a .deb, which is an ar archive
+// holding debian-binary, control.tar.* and data.tar.*
+func ExtractControl(content []byte) (*ControlFile, error) {
+	if !bytes.HasPrefix(content, []byte(arMagic)) {
+		return nil, fmt.Errorf("not a Debian package: missing ar header")
+	}
+
+	offset := len(arMagic)
+	for offset+arHeaderSize <= len(content) {
+		header := content[offset : offset+arHeaderSize]
+		name := strings.TrimSuffix(strings.TrimSpace(string(header[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid ar member size for %q", name)
+		}
+
+		start := offset + arHeaderSize
+		end := start + int(size)
+		if end > len(content) {
+			return nil, fmt.Errorf("truncated ar member %q", name)
+		}
+
+		if strings.HasPrefix(name, "control.tar") {
+			return readControlTar(name, content[start:end])
+		}
+
+		// Members are aligned to even offsets
+		offset = end + int(size%2)
+	}
+
+	return nil, fmt.Errorf("control archive not found in Debian package")
+}
+
+// readControlTar extracts the control file from the control member
+func readControlTar(name string, member []byte) (*ControlFile, error) {
+	var reader io.Reader = bytes.NewReader(member)
+	switch name {
+	case "control.tar":
+	case "control.tar.gz":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress control archive: %w", err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	default:
+		return nil, fmt.Errorf("unsupported control archive compression: %s", name)
+	}
+
+	tarReader := utils.NewTarReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read control archive: %w", err)
+		}
+
+		if path.Clean(header.Name) != "control" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(tarReader, maxControlSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read control file: %w", err)
+		}
+		if len(data) > maxControlSize {
+			return nil, fmt.Errorf("control file too large")
+		}
+
+		return ParseControl(data)
+	}
+
+	return nil, fmt.Errorf("control file not found in control archive")
+}
+
+// ParseControl parses a single deb822 paragraph
+func ParseControl(data []byte) (*ControlFile, error) {
+	control := &ControlFile{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxControlSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(control.Fields) > 0 {
+				break
+			}
+			continue
+		}
+
+		// Continuation of the previous field
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(control.Fields) == 0 {
+				return nil, fmt.Errorf("continuation line without a field")
+			}
+			last := &control.Fields[len(control.Fields)-1]
+			last.Value += "\n" + line
+			continue
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found || name == "" {
+			return nil, fmt.Errorf("malformed control line: %q", line)
+		}
+		control.Fields = append(control.Fields, ControlField{
+			Name:  name,
+			Value: strings.TrimSpace(value),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse control file: %w", err)
+	}
+
+	if control.Get("Package") == "" || control.Get("Version") == "" {
+		return nil, fmt.Errorf("control file must contain Package and Version fields")
+	}
+
+	return control, nil
+}
@@ -0,0 +1,207 @@
+package debian
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestDeb builds a minimal .deb with the given control file
+func createTestDeb(t *testing.T, control string) []byte {
+	t.Helper()
+
+	tarGz := func(files map[string]string) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for name, data := range files {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Unix(0, 0)}))
+			_, err := tw.Write([]byte(data))
+			require.NoError(t, err)
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gw.Close())
+		return buf.Bytes()
+	}
+
+	var deb bytes.Buffer
+	deb.WriteString(arMagic)
+	for _, member := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", tarGz(map[string]string{"./control": control})},
+		{"data.tar.gz", tarGz(map[string]string{"./usr/share/doc/test/README": "test\n"})},
+	} {
+		fmt.Fprintf(&deb, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", member.name, 0, 0, 0, "100644", len(member.data))
+		deb.Write(member.data)
+		if len(member.data)%2 == 1 {
+			deb.WriteString("\n")
+		}
+	}
+	return deb.Bytes()
+}
+
+const testControl = `Package: hello
+Version: 1:2.10-3
+Architecture: amd64
+Maintainer: Lodestone <dev@example.com>
+Installed-Size: 12
+Depends: libc6 (>= 2.34)
+Section: devel
+Priority: optional
+Description: example package
+ A longer description
+ .
+ spanning paragraphs.
+`
+
+func TestParseControl_MultilineDescription(t *testing.T) {
+	control, err := ParseControl([]byte(testControl))
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", control.Get("Package"))
+	assert.Equal(t, "1:2.10-3", control.Get("version"))
+	assert.Equal(t, "example package\n A longer description\n .\n spanning paragraphs.", control.Get("Description"))
+}
+
+func TestParseControl_MissingFields(t *testing.T) {
+	_, err := ParseControl([]byte("Package: hello\n"))
+	assert.Error(t, err)
+
+	_, err = ParseControl([]byte(" continuation first\n"))
+	assert.Error(t, err)
+}
+
+func TestExtractControl(t *testing.T) {
+	control, err := ExtractControl(createTestDeb(t, testControl))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", control.Get("Package"))
+	assert.Equal(t, "amd64", control.Get("Architecture"))
+
+	_, err = ExtractControl([]byte("not a deb"))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	registry := New(nil, nil)
+	content := createTestDeb(t, testControl)
+
+	assert.NoError(t, registry.Validate(&types.Artifact{Name: "hello", Version: "1:2.10-3_amd64"}, content))
+
+	err := registry.Validate(&types.Artifact{Name: "hello", Version: "2.11_amd64"}, content)
+	assert.ErrorContains(t, err, "version mismatch")
+
+	err = registry.Validate(&types.Artifact{Name: "hello", Version: "1:2.10-3_arm64"}, content)
+	assert.ErrorContains(t, err, "architecture mismatch")
+
+	err = registry.Validate(&types.Artifact{Name: "hello", Version: "1:2.10-3"}, content)
+	assert.ErrorContains(t, err, "must end with the package architecture")
+
+	err = registry.Validate(&types.Artifact{Name: "Hello", Version: "1:2.10-3_amd64"}, content)
+	assert.ErrorContains(t, err, "invalid Debian package name")
+
+	err = registry.Validate(&types.Artifact{Name: "hello", Version: "1:2.10-3_amd64"}, nil)
+	assert.Error(t, err)
+}
+
+func TestArtifactVersion(t *testing.T) {
+	registry := New(nil, nil)
+
+	artifactVersion := ArtifactVersion("1:2.10-3", "amd64")
+	assert.Equal(t, "1:2.10-3_amd64", artifactVersion)
+	version, architecture := SplitArtifactVersion(artifactVersion)
+	assert.Equal(t, "1:2.10-3", version)
+	assert.Equal(t, "amd64", architecture)
+
+	// Each architecture of a version is stored apart
+	assert.NotEqual(t,
+		registry.GenerateStoragePath("hello", ArtifactVersion("1:2.10-3", "amd64")),
+		registry.GenerateStoragePath("hello", ArtifactVersion("1:2.10-3", "arm64")))
+}
+
+func TestGetMetadata(t *testing.T) {
+	registry := New(nil, nil)
+
+	metadata, err := registry.GetMetadata(createTestDeb(t, testControl))
+	require.NoError(t, err)
+
+	assert.Equal(t, "debian", metadata["format"])
+	assert.Equal(t, "amd64", metadata["architecture"])
+	assert.Equal(t, "example package", metadata["description"])
+	assert.Len(t, metadata["md5"], 32)
+	assert.Len(t, metadata["sha1"], 40)
+
+	control, ok := metadata["control"].(map[string]string)
+	require.True(t, ok)
+	assert.Equal(t, "libc6 (>= 2.34)", control["Depends"])
+}
+
+func TestPoolFilename(t *testing.T) {
+	assert.Equal(t, "pool/main/h/hello/hello_2.10-3_amd64.deb", PoolFilename("hello", "1:2.10-3", "amd64"))
+	assert.Equal(t, "pool/main/libf/libfoo/libfoo_1.0_all.deb", PoolFilename("libfoo", "1.0", "all"))
+}
+
+func TestBuildRepository(t *testing.T) {
+	registry := New(nil, nil)
+
+	newArtifact := func(control string) *types.Artifact {
+		content := createTestDeb(t, control)
+		metadata, err := registry.GetMetadata(content)
+		require.NoError(t, err)
+		parsed, err := ParseControl([]byte(control))
+		require.NoError(t, err)
+		sum := sha256.Sum256(content)
+		return &types.Artifact{
+			Name:     parsed.Get("Package"),
+			Version:  ArtifactVersion(parsed.Get("Version"), parsed.Get("Architecture")),
+			Registry: "debian",
+			Size:     int64(len(content)),
+			SHA256:   hex.EncodeToString(sum[:]),
+			Metadata: metadata,
+		}
+	}
+
+	hello := newArtifact(testControl)
+	docs := newArtifact("Package: hello-doc\nVersion: 1.0\nArchitecture: all\nDescription: docs\n")
+	arm := newArtifact("Package: hello\nVersion: 1:2.10-3\nArchitecture: arm64\nDescription: example package\n")
+
+	repo := BuildRepository([]*types.Artifact{hello, docs})
+	assert.Equal(t, []string{"amd64"}, repo.Architectures)
+
+	packages := string(repo.Files["main/binary-amd64/Packages"])
+	assert.Contains(t, packages, "Package: hello\nVersion: 1:2.10-3\nArchitecture: amd64\n")
+	assert.Contains(t, packages, "Filename: pool/main/h/hello/hello_2.10-3_amd64.deb\n")
+	assert.Contains(t, packages, "SHA256: "+hello.SHA256+"\n")
+	assert.Contains(t, packages, "Description: example package\n A longer description\n .\n spanning paragraphs.\n")
+	// Architecture-independent packages appear in every architecture's index
+	assert.Contains(t, packages, "Package: hello-doc\n")
+	assert.NotContains(t, string(repo.Files["main/binary-all/Packages"]), "Package: hello\n")
+
+	// The Release file lists the checksum of every index
+	release := string(repo.Release)
+	assert.Contains(t, release, "Suite: stable\n")
+	assert.Contains(t, release, "Architectures: amd64 all\n")
+	gzSum := sha256.Sum256(repo.Files["main/binary-amd64/Packages.gz"])
+	assert.Contains(t, release, fmt.Sprintf(" %s %d main/binary-amd64/Packages.gz\n",
+		hex.EncodeToString(gzSum[:]), len(repo.Files["main/binary-amd64/Packages.gz"])))
+
+	// Output is reproducible
+	assert.Equal(t, repo.Release, BuildRepository([]*types.Artifact{docs, hello}).Release)
+
+	// Each architecture gets its own index
+	repo = BuildRepository([]*types.Artifact{hello, arm})
+	assert.Equal(t, []string{"amd64", "arm64"}, repo.Architectures)
+	assert.Contains(t, string(repo.Files["main/binary-arm64/Packages"]), "Architecture: arm64\n")
+	assert.NotContains(t, string(repo.Files["main/binary-arm64/Packages"]), "Architecture: amd64\n")
+}
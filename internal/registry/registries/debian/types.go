@@ -0,0 +1,65 @@
+package debian
+
+import "strings"
+
+// Repository layout constants. Lodestone publishes a single suite with a single
+// component, which is what `deb <url> stable main` expects.
+const (
+	Distribution = "stable"
+	Component    = "main"
+)
+
+// ArtifactVersion returns the version a package is stored under: its Debian
+// version and architecture joined as in pool file names, e.g. 1:2.10-3_amd64,
+// so that each architecture built from a version is a separate artifact.
+// Neither part may contain an underscore, so they are always told apart.
+func ArtifactVersion(version, architecture string) string {
+	return version + "_" + architecture
+}
+
+// SplitArtifactVersion returns the Debian version and architecture of a
+// stored package. Packages stored before the architecture was part of the
+// artifact version have none.
+func SplitArtifactVersion(artifactVersion string) (version, architecture string) {
+	version, architecture, _ = strings.Cut(artifactVersion, "_")
+	return version, architecture
+}
+
+// ControlFile holds the fields of a Debian binary package control file in the
+// order they appeared
+type ControlFile struct {
+	Fields []ControlField
+}
+
+// ControlField is a single field of a control file. Multi-line values keep
+// their continuation lines, each starting with a space.
+type ControlField struct {
+	Name  string
+	Value string
+}
+
+// Get returns the value of a field, matching the name case-insensitively
+func (c *ControlFile) Get(name string) string {
+	for _, field := range c.Fields {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// PackageEntry is a package as it appears in a Packages index
+type PackageEntry struct {
+	Control  map[string]string // control fields as extracted at upload
+	Filename string            // path relative to the repository root
+	Size     int64
+	MD5      string
+	SHA1     string
+	SHA256   string
+}
+
+// IndexFile is a generated index file referenced by the Release file
+type IndexFile struct {
+	Path    string // path relative to dists/<distribution>
+	Content []byte
+}
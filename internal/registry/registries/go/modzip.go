@@ -0,0 +1,106 @@
+package goregistry
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/sumdb/dirhash"
+)
+
+// maxGoModSize is the largest go.mod the go command accepts in a module zip
+const maxGoModSize = 16 << 20
+
+// CheckModuleZip checks that a zip has the layout the go command requires of
+// a module version: every file under module@version/ with a valid file path,
+// no two files differing only in case, and a go.mod, if any, declaring the
+// module's own path
+func CheckModuleZip(modulePath, version string, content []byte) error {
+	reader, err := utils.NewZipReader(content)
+	if err != nil {
+		return fmt.Errorf("invalid module zip: %w", err)
+	}
+
+	prefix := modulePath + "@" + version + "/"
+	seen := make(map[string]string, len(reader.File))
+	for _, file := range reader.File {
+		name, ok := strings.CutPrefix(file.Name, prefix)
+		if !ok {
+			return fmt.Errorf("invalid module zip: %s is not in %s", file.Name, prefix)
+		}
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if err := module.CheckFilePath(name); err != nil {
+			return fmt.Errorf("invalid module zip: %w", err)
+		}
+		folded := strings.ToLower(name)
+		if other, ok := seen[folded]; ok {
+			return fmt.Errorf("invalid module zip: %s and %s differ only in case", other, name)
+		}
+		seen[folded] = name
+
+		if name == "go.mod" {
+			if err := checkGoMod(modulePath, file); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkGoMod checks the go.mod at the root of a module zip declares the
+// module path the zip was published under
+func checkGoMod(modulePath string, file *zip.File) error {
+	if file.UncompressedSize64 > maxGoModSize {
+		return fmt.Errorf("invalid module zip: go.mod is larger than %d bytes", maxGoModSize)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open go.mod: %w", err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxGoModSize))
+	if err != nil {
+		return fmt.Errorf("failed to read go.mod: %w", err)
+	}
+
+	if declared := modfile.ModulePath(data); declared != modulePath {
+		return fmt.Errorf("invalid module zip: go.mod declares module %q, not %q", declared, modulePath)
+	}
+	return nil
+}
+
+// HashZip returns the h1: hash of a module zip, as recorded for the module
+// version in go.sum
+func HashZip(content []byte) (string, error) {
+	reader, err := utils.NewZipReader(content)
+	if err != nil {
+		return "", fmt.Errorf("invalid module zip: %w", err)
+	}
+
+	// Like the go command, hash every entry by its full name in the zip
+	files := make([]string, 0, len(reader.File))
+	entries := make(map[string]*zip.File, len(reader.File))
+	for _, file := range reader.File {
+		files = append(files, file.Name)
+		entries[file.Name] = file
+	}
+	return dirhash.Hash1(files, func(name string) (io.ReadCloser, error) {
+		return entries[name].Open()
+	})
+}
+
+// HashGoMod returns the h1: hash of a go.mod file, as recorded for the
+// module version's /go.mod line in go.sum
+func HashGoMod(modFile []byte) (string, error) {
+	return dirhash.Hash1([]string{"go.mod"}, func(string) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(modFile)), nil
+	})
+}
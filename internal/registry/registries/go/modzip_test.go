@@ -0,0 +1,145 @@
+package goregistry
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createModuleZip builds a zip of the named files, in name order
+func createModuleZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(files[name]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// quoteV100 holds the files of rsc.io/quote v1.0.0
+var quoteV100 = map[string]string{
+	"rsc.io/quote@v1.0.0/LICENSE": `Copyright (c) 2009 The Go Authors. All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+   * Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+   * Redistributions in binary form must reproduce the above
+copyright notice, this list of conditions and the following disclaimer
+in the documentation and/or other materials provided with the
+distribution.
+   * Neither the name of Google Inc. nor the names of its
+contributors may be used to endorse or promote products derived from
+this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+"AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+`,
+	"rsc.io/quote@v1.0.0/README.md": "This package collects pithy sayings.\n\nIt's part of a demonstration of\n[package versioning in Go](https://research.swtch.com/vgo1).\n",
+	"rsc.io/quote@v1.0.0/go.mod":    "module \"rsc.io/quote\"\n",
+	"rsc.io/quote@v1.0.0/quote.go": `// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package quote collects pithy sayings.
+package quote // import "rsc.io/quote"
+
+// Hello returns a greeting.
+func Hello() string {
+	return "Hello, world."
+}
+`,
+	"rsc.io/quote@v1.0.0/quote_test.go": `// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quote
+
+import "testing"
+
+func TestHello(t *testing.T) {
+	hello := "Hello, world."
+	if out := Hello(); out != hello {
+		t.Errorf("Hello() = %q, want %q", out, hello)
+	}
+}
+`,
+}
+
+func TestHashZip_MatchesGoSum(t *testing.T) {
+	// The hashes go mod download records in go.sum for rsc.io/quote v1.0.0
+	content := createModuleZip(t, quoteV100)
+
+	zipHash, err := HashZip(content)
+	require.NoError(t, err)
+	assert.Equal(t, "h1:haUSojyo3j2M9g7CEUFG8Na09dtn7QKxvPGaPVQdGwM=", zipHash)
+
+	modFile, err := ModFile("rsc.io/quote", "v1.0.0", content)
+	require.NoError(t, err)
+	goModHash, err := HashGoMod(modFile)
+	require.NoError(t, err)
+	assert.Equal(t, "h1:v83Ri/njykPcgJltBc/gEkJTmjTsNgtO1Y7vyIK1CQA=", goModHash)
+
+	_, err = HashZip([]byte("not a zip"))
+	assert.Error(t, err)
+}
+
+func TestUpload_RecordsHashes(t *testing.T) {
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	registry := New(localStorage, nil)
+	artifact := &types.Artifact{Name: "rsc.io/quote", Version: "v1.0.0", StoragePath: "go/rsc.io/quote/@v/v1.0.0.zip"}
+
+	require.NoError(t, registry.Upload(context.Background(), artifact, createModuleZip(t, quoteV100)))
+	assert.Equal(t, "h1:haUSojyo3j2M9g7CEUFG8Na09dtn7QKxvPGaPVQdGwM=", artifact.Metadata["h1"])
+	assert.Equal(t, "h1:v83Ri/njykPcgJltBc/gEkJTmjTsNgtO1Y7vyIK1CQA=", artifact.Metadata["go_mod_h1"])
+}
+
+func TestCheckModuleZip(t *testing.T) {
+	assert.NoError(t, CheckModuleZip("rsc.io/quote", "v1.0.0", createModuleZip(t, quoteV100)))
+
+	invalid := map[string]map[string]string{
+		"outside the module prefix": {"rsc.io/quote@v1.0.0/go.mod": "module rsc.io/quote\n", "other/file.go": "package other\n"},
+		"wrong version prefix":      {"rsc.io/quote@v1.1.0/quote.go": "package quote\n"},
+		"invalid file path":         {"rsc.io/quote@v1.0.0/bad:name.go": "package quote\n"},
+		"case-folded duplicates":    {"rsc.io/quote@v1.0.0/Quote.go": "package quote\n", "rsc.io/quote@v1.0.0/quote.go": "package quote\n"},
+		"mismatched go.mod":         {"rsc.io/quote@v1.0.0/go.mod": "module rsc.io/other\n"},
+	}
+	for name, files := range invalid {
+		t.Run(name, func(t *testing.T) {
+			assert.Error(t, CheckModuleZip("rsc.io/quote", "v1.0.0", createModuleZip(t, files)))
+		})
+	}
+
+	assert.Error(t, CheckModuleZip("rsc.io/quote", "v1.0.0", []byte("not a zip")))
+}
@@ -0,0 +1,135 @@
+package goregistry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// IsPseudoVersion reports whether a version is a pseudo-version, naming an
+// untagged commit rather than a release
+func IsPseudoVersion(version string) bool {
+	v, err := semver.NewVersion(version)
+	return err == nil && pseudoVersionRegex.MatchString(v.Prerelease())
+}
+
+// VersionTime returns the time of a version as the proxy reports it: the
+// commit time encoded in a pseudo-version, or else the time it was published
+func VersionTime(version string, published time.Time) time.Time {
+	if v, err := semver.NewVersion(version); err == nil {
+		if match := pseudoVersionRegex.FindStringSubmatch(v.Prerelease()); match != nil {
+			if t, err := time.Parse("20060102150405", match[2]); err == nil {
+				return t
+			}
+		}
+	}
+	return published.UTC().Truncate(time.Second)
+}
+
+// NewModInfo returns the .info document of a version
+func NewModInfo(version string, published time.Time) *GoModInfo {
+	return &GoModInfo{Version: version, Time: VersionTime(version, published)}
+}
+
+// ListVersions returns the versions the proxy lists for a module in
+// ascending semver order. Pseudo-versions are left out, as the go command
+// expects.
+func ListVersions(versions []string) []string {
+	tagged := make([]string, 0, len(versions))
+	for _, version := range versions {
+		if !IsPseudoVersion(version) {
+			tagged = append(tagged, version)
+		}
+	}
+	return utils.SortVersionsAscending(tagged)
+}
+
+// LatestVersion returns the version @latest resolves to, the way the go
+// command picks one: the highest release, else the highest prerelease, else
+// the highest pseudo-version
+func LatestVersion(versions []string) string {
+	var releases, prereleases, pseudoVersions []string
+	for _, version := range versions {
+		switch {
+		case IsPseudoVersion(version):
+			pseudoVersions = append(pseudoVersions, version)
+		case utils.IsPrerelease(version):
+			prereleases = append(prereleases, version)
+		default:
+			releases = append(releases, version)
+		}
+	}
+
+	for _, candidates := range [][]string{releases, prereleases, pseudoVersions} {
+		if len(candidates) > 0 {
+			return utils.GetLatestVersion(candidates)
+		}
+	}
+	return ""
+}
+
+// ModFile returns the go.mod file of a module version from its module zip.
+// Modules without one get the go.mod the go command would synthesize.
+func ModFile(module, version string, content []byte) ([]byte, error) {
+	reader, err := utils.NewZipReader(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid module zip: %w", err)
+	}
+
+	// Files in a module zip are under module@version/; a go.mod further down
+	// belongs to a nested module
+	name := module + "@" + version + "/go.mod"
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+		return utils.ReadZipFile(file)
+	}
+
+	return []byte(fmt.Sprintf("module %s\n", module)), nil
+}
+
+// EscapeModulePath encodes a module path for a proxy URL or file path, which
+// may be case insensitive, writing each upper-case letter as ! followed by its
+// lower-case form
+func EscapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// UnescapeModulePath decodes a module path escaped for a proxy URL, in which
+// each upper-case letter is written as ! followed by its lower-case form
+func UnescapeModulePath(escaped string) (string, error) {
+	var b strings.Builder
+	bang := false
+	for _, r := range escaped {
+		switch {
+		case bang:
+			if r < 'a' || r > 'z' {
+				return "", fmt.Errorf("invalid escaped module path %q", escaped)
+			}
+			b.WriteRune(r - 'a' + 'A')
+			bang = false
+		case r == '!':
+			bang = true
+		case r >= 'A' && r <= 'Z':
+			return "", fmt.Errorf("invalid escaped module path %q", escaped)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if bang {
+		return "", fmt.Errorf("invalid escaped module path %q", escaped)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,109 @@
+package goregistry
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListVersions(t *testing.T) {
+	versions := []string{"v1.10.0", "v0.0.0-20191109021931-daa7c04131f5", "v1.2.0", "v1.2.0-rc.1", "v1.9.0"}
+	assert.Equal(t, []string{"v1.2.0-rc.1", "v1.2.0", "v1.9.0", "v1.10.0"}, ListVersions(versions))
+	assert.Empty(t, ListVersions(nil))
+}
+
+func TestLatestVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		expected string
+	}{
+		{
+			name:     "highest release",
+			versions: []string{"v1.9.0", "v1.10.0", "v2.0.0-rc.1", "v1.10.1-0.20200101000000-abcdefabcdef"},
+			expected: "v1.10.0",
+		},
+		{
+			name:     "prerelease without releases",
+			versions: []string{"v0.1.0-alpha", "v0.1.0-beta", "v0.0.0-20200101000000-abcdefabcdef"},
+			expected: "v0.1.0-beta",
+		},
+		{
+			name:     "pseudo-versions ordered by commit time",
+			versions: []string{"v0.0.0-20191109021931-daa7c04131f5", "v0.0.0-20200101000000-abcdefabcdef", "v0.0.0-20190101000000-123456789abc"},
+			expected: "v0.0.0-20200101000000-abcdefabcdef",
+		},
+		{
+			name:     "incompatible major versions",
+			versions: []string{"v2.0.0+incompatible", "v1.5.0"},
+			expected: "v2.0.0+incompatible",
+		},
+		{name: "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, LatestVersion(tt.versions))
+		})
+	}
+}
+
+func TestVersionTime(t *testing.T) {
+	published := time.Date(2024, 5, 1, 12, 30, 45, 123456789, time.FixedZone("CEST", 2*60*60))
+
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 30, 45, 0, time.UTC), VersionTime("v1.0.0", published))
+	assert.Equal(t, time.Date(2019, 11, 9, 2, 19, 31, 0, time.UTC), VersionTime("v1.2.4-0.20191109021931-daa7c04131f5", published))
+	assert.True(t, IsPseudoVersion("v1.2.3-pre.0.20191109021931-daa7c04131f5"))
+	assert.False(t, IsPseudoVersion("v1.2.3-pre"))
+}
+
+func TestModFile(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"example.com/mod@v1.0.0/go.mod":        "module example.com/mod\n\ngo 1.22\n",
+		"example.com/mod@v1.0.0/nested/go.mod": "module example.com/mod/nested\n",
+	} {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	modFile, err := ModFile("example.com/mod", "v1.0.0", buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "module example.com/mod\n\ngo 1.22\n", string(modFile))
+
+	// A zip for another version has no go.mod at the expected path
+	modFile, err = ModFile("example.com/mod", "v1.1.0", buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "module example.com/mod\n", string(modFile))
+
+	_, err = ModFile("example.com/mod", "v1.0.0", []byte("not a zip"))
+	assert.Error(t, err)
+}
+
+func TestEscapeModulePath(t *testing.T) {
+	assert.Equal(t, "github.com/!azure/azure-sdk-for-go", EscapeModulePath("github.com/Azure/azure-sdk-for-go"))
+	assert.Equal(t, "!git!hub.com/!user/!repo", EscapeModulePath("GitHub.com/User/Repo"))
+
+	module, err := UnescapeModulePath(EscapeModulePath("GitHub.com/User/Repo"))
+	require.NoError(t, err)
+	assert.Equal(t, "GitHub.com/User/Repo", module)
+}
+
+func TestUnescapeModulePath(t *testing.T) {
+	module, err := UnescapeModulePath("github.com/!azure/azure-sdk-for-go")
+	require.NoError(t, err)
+	assert.Equal(t, "github.com/Azure/azure-sdk-for-go", module)
+
+	for _, invalid := range []string{"github.com/Azure/sdk", "github.com/!1", "github.com/trailing!"} {
+		_, err := UnescapeModulePath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -5,7 +5,10 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/internal/storage"
 	"github.com/lgulliver/lodestone/pkg/types"
@@ -25,8 +28,22 @@ func New(storage storage.BlobStorage, db *common.Database) *Registry {
 	}
 }
 
-// Upload stores a Go module
+// Upload stores a Go module, recording the h1: hashes go.sum will hold for
+// its zip and go.mod
 func (r *Registry) Upload(ctx context.Context, artifact *types.Artifact, content []byte) error {
+	zipHash, err := HashZip(content)
+	if err != nil {
+		return fmt.Errorf("failed to hash Go module: %w", err)
+	}
+	modFile, err := ModFile(artifact.Name, artifact.Version, content)
+	if err != nil {
+		return err
+	}
+	goModHash, err := HashGoMod(modFile)
+	if err != nil {
+		return fmt.Errorf("failed to hash go.mod: %w", err)
+	}
+
 	// Store the content
 	reader := bytes.NewReader(content)
 	if err := r.storage.Store(ctx, artifact.StoragePath, reader, "application/zip"); err != nil {
@@ -34,6 +51,11 @@ func (r *Registry) Upload(ctx context.Context, artifact *types.Artifact, content
 	}
 
 	artifact.ContentType = "application/zip"
+	if artifact.Metadata == nil {
+		artifact.Metadata = make(types.JSONMap)
+	}
+	artifact.Metadata["h1"] = zipHash
+	artifact.Metadata["go_mod_h1"] = goModHash
 	return nil
 }
 
@@ -58,19 +80,64 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 		return fmt.Errorf("empty module content")
 	}
 
-	// Validate module path format
-	modulePathRegex := regexp.MustCompile(`^[a-z0-9.\-_~]+(/[a-z0-9.\-_~]+)*$`)
+	// Validate module path format. Module paths are case sensitive.
+	modulePathRegex := regexp.MustCompile(`^[A-Za-z0-9.\-_~]+(/[A-Za-z0-9.\-_~]+)*$`)
 	if !modulePathRegex.MatchString(artifact.Name) {
 		return fmt.Errorf("invalid Go module path format")
 	}
 
-	// Validate semantic version
-	semverRegex := regexp.MustCompile(`^v\d+\.\d+\.\d+(-[a-zA-Z0-9\-\.]+)?(\+[a-zA-Z0-9\-\.]+)?$`)
-	if !semverRegex.MatchString(artifact.Version) {
-		return fmt.Errorf("invalid semantic version format")
+	if err := validateVersion(artifact.Version); err != nil {
+		return err
+	}
+
+	return CheckModuleZip(artifact.Name, artifact.Version, content)
+}
+
+// pseudoVersionRegex matches the timestamp and revision suffix of a
+// pseudo-version, e.g. v0.0.0-20191109021931-daa7c04131f5
+var pseudoVersionRegex = regexp.MustCompile(`(^|\.)(\d{14})-([0-9a-f]+)$`)
+
+// validateVersion checks a version against the Go module rules: canonical
+// semver with a v prefix, build metadata only as +incompatible on major
+// versions 2 and above, and well-formed pseudo-versions
+func validateVersion(version string) error {
+	if !strings.HasPrefix(version, "v") {
+		return fmt.Errorf("invalid Go module version format: %q must start with v", version)
+	}
+
+	v, err := semver.StrictNewVersion(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return fmt.Errorf("invalid Go module version format: %q is not canonical semver", version)
+	}
+
+	switch v.Metadata() {
+	case "":
+	case "incompatible":
+		if v.Major() < 2 {
+			return fmt.Errorf("invalid Go module version format: +incompatible requires major version 2 or above")
+		}
+	default:
+		return fmt.Errorf("invalid Go module version format: build metadata other than +incompatible is not allowed")
+	}
+
+	if match := pseudoVersionRegex.FindStringSubmatch(v.Prerelease()); match != nil {
+		// Pseudo-versions take the forms vX.0.0-yyyymmddhhmmss-rev,
+		// vX.Y.Z-pre.0.yyyymmddhhmmss-rev and vX.Y.Z-0.yyyymmddhhmmss-rev
+		base := strings.TrimSuffix(v.Prerelease(), match[2]+"-"+match[3])
+		if base == "" && (v.Minor() != 0 || v.Patch() != 0) {
+			return fmt.Errorf("invalid Go pseudo-version: %q without a base version must be vX.0.0", version)
+		}
+		if base != "" && base != "0." && !strings.HasSuffix(base, ".0.") {
+			return fmt.Errorf("invalid Go pseudo-version: %q", version)
+		}
+		if _, err := time.Parse("20060102150405", match[2]); err != nil {
+			return fmt.Errorf("invalid Go pseudo-version timestamp: %q", version)
+		}
+		if len(match[3]) != 12 {
+			return fmt.Errorf("invalid Go pseudo-version revision: %q must end with a 12 character commit hash", version)
+		}
 	}
 
-	// TODO: Validate go.mod file exists in the ZIP
 	return nil
 }
 
@@ -86,6 +153,7 @@ func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
 
 // GenerateStoragePath creates the storage path for Go modules
 func (r *Registry) GenerateStoragePath(name, version string) string {
-	// Go modules follow: module/@v/version.zip
-	return fmt.Sprintf("go/%s/@v/%s.zip", name, version)
+	// Go modules follow: module/@v/version.zip, with the module path escaped
+	// as in the module cache so paths differing only in case do not collide
+	return fmt.Sprintf("go/%s/@v/%s.zip", EscapeModulePath(name), version)
 }
@@ -0,0 +1,53 @@
+package goregistry
+
+import (
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate_Versions(t *testing.T) {
+	registry := New(nil, nil)
+
+	valid := []string{
+		"v1.0.0",
+		"v0.0.1",
+		"v1.2.3-beta.1",
+		"v2.0.0+incompatible",
+		"v17.0.0-rc.1+incompatible",
+		// Pseudo-versions without a base, on a release and on a prerelease
+		"v0.0.0-20191109021931-daa7c04131f5",
+		"v1.2.4-0.20191109021931-daa7c04131f5",
+		"v1.2.3-pre.0.20191109021931-daa7c04131f5",
+	}
+	for _, version := range valid {
+		t.Run(version, func(t *testing.T) {
+			artifact := &types.Artifact{Name: "github.com/example/module", Version: version}
+			content := createModuleZip(t, map[string]string{
+				"github.com/example/module@" + version + "/go.mod": "module github.com/example/module\n",
+			})
+			assert.NoError(t, registry.Validate(artifact, content))
+		})
+	}
+
+	invalid := []string{
+		"",
+		"1.0.0",         // missing v prefix
+		"v1.0",          // not canonical
+		"v01.0.0",       // leading zero
+		"v1.0.0+build1", // build metadata
+		"v1.0.0+incompatible",
+		"v1.2.3-20191109021931-daa7c04131f5",     // pseudo-version without base must be vX.0.0
+		"v0.0.0-20191309021931-daa7c04131f5",     // month 13
+		"v0.0.0-20191109021931-daa7c04131",       // short revision
+		"v1.2.3-pre.20191109021931-daa7c04131f5", // missing .0 before the timestamp
+		"latest",
+	}
+	for _, version := range invalid {
+		t.Run("invalid "+version, func(t *testing.T) {
+			artifact := &types.Artifact{Name: "github.com/example/module", Version: version}
+			assert.Error(t, registry.Validate(artifact, []byte("zip")))
+		})
+	}
+}
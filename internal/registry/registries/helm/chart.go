@@ -0,0 +1,130 @@
+package helm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// Maintainer describes a maintainer of a chart
+type Maintainer struct {
+	Name  string `json:"name,omitempty" yaml:"name,omitempty"`
+	Email string `json:"email,omitempty" yaml:"email,omitempty"`
+	URL   string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// Dependency describes a chart that a chart depends on
+type Dependency struct {
+	Name         string        `json:"name" yaml:"name"`
+	Version      string        `json:"version,omitempty" yaml:"version,omitempty"`
+	Repository   string        `json:"repository" yaml:"repository"`
+	Condition    string        `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Tags         []string      `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Enabled      bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	ImportValues []interface{} `json:"import-values,omitempty" yaml:"import-values,omitempty"`
+	Alias        string        `json:"alias,omitempty" yaml:"alias,omitempty"`
+}
+
+// Metadata is the content of a chart's Chart.yaml, with the field names Helm
+// uses in both Chart.yaml and index.yaml
+type Metadata struct {
+	Name         string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Home         string            `json:"home,omitempty" yaml:"home,omitempty"`
+	Sources      []string          `json:"sources,omitempty" yaml:"sources,omitempty"`
+	Version      string            `json:"version,omitempty" yaml:"version,omitempty"`
+	Description  string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Keywords     []string          `json:"keywords,omitempty" yaml:"keywords,omitempty"`
+	Maintainers  []*Maintainer     `json:"maintainers,omitempty" yaml:"maintainers,omitempty"`
+	Icon         string            `json:"icon,omitempty" yaml:"icon,omitempty"`
+	APIVersion   string            `json:"apiVersion,omitempty" yaml:"apiVersion,omitempty"`
+	Condition    string            `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Tags         string            `json:"tags,omitempty" yaml:"tags,omitempty"`
+	AppVersion   string            `json:"appVersion,omitempty" yaml:"appVersion,omitempty"`
+	Deprecated   bool              `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	KubeVersion  string            `json:"kubeVersion,omitempty" yaml:"kubeVersion,omitempty"`
+	Dependencies []*Dependency     `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	Type         string            `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+// errNoChartYAML is returned for a chart archive without a Chart.yaml
+var errNoChartYAML = errors.New("Chart.yaml not found in chart archive")
+
+// ParseChart reads the Chart.yaml of a packaged chart. Helm packages a chart
+// as a gzipped tarball with the chart's files in a single top-level directory.
+func ParseChart(content []byte) (*Metadata, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := utils.NewTarReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, errNoChartYAML
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid chart archive: %w", err)
+		}
+
+		// Chart.yaml files further down belong to subcharts
+		dir, file, ok := strings.Cut(strings.TrimPrefix(header.Name, "./"), "/")
+		if !ok || dir == "" || file != "Chart.yaml" {
+			continue
+		}
+
+		data, err := tr.ReadEntry()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Chart.yaml: %w", err)
+		}
+		var metadata Metadata
+		if err := yaml.Unmarshal(data, &metadata); err != nil {
+			return nil, fmt.Errorf("invalid Chart.yaml: %w", err)
+		}
+		return &metadata, nil
+	}
+}
+
+// chartMetadata returns the Chart.yaml metadata recorded for an artifact at
+// upload, or nil if it has none
+func chartMetadata(artifact *types.Artifact) *Metadata {
+	raw, ok := artifact.Metadata["chart"]
+	if !ok {
+		return nil
+	}
+
+	// Metadata read back from the database is a generic map
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil
+	}
+	return &metadata
+}
+
+// metadataMap converts chart metadata to the generic form stored with an
+// artifact
+func metadataMap(metadata *Metadata) (map[string]interface{}, error) {
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
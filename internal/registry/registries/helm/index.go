@@ -0,0 +1,207 @@
+package helm
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ChartVersion is an entry of the repository index: the metadata of a chart
+// version and where to download it
+type ChartVersion struct {
+	Metadata `yaml:",inline"`
+	URLs     []string  `yaml:"urls"`
+	Created  time.Time `yaml:"created,omitempty"`
+	Removed  bool      `yaml:"removed,omitempty"`
+	Digest   string    `yaml:"digest,omitempty"`
+}
+
+// IndexFile is a chart repository's index.yaml
+type IndexFile struct {
+	APIVersion string                     `yaml:"apiVersion"`
+	Entries    map[string][]*ChartVersion `yaml:"entries"`
+	Generated  time.Time                  `yaml:"generated"`
+}
+
+// NewChartVersion builds the index entry of a published chart. Download URLs
+// are relative, which Helm resolves against the repository URL.
+func NewChartVersion(artifact *types.Artifact) *ChartVersion {
+	entry := &ChartVersion{
+		URLs:    []string{fmt.Sprintf("%s/%s/%s-%s.tgz", artifact.Name, artifact.Version, artifact.Name, artifact.Version)},
+		Created: artifact.CreatedAt.UTC(),
+		Digest:  artifact.SHA256,
+	}
+	if metadata := chartMetadata(artifact); metadata != nil {
+		entry.Metadata = *metadata
+	}
+
+	// The stored name and version are the ones the chart is downloaded by.
+	// Helm treats charts without an apiVersion as v1 charts.
+	entry.Name = artifact.Name
+	entry.Version = artifact.Version
+	if entry.APIVersion == "" {
+		entry.APIVersion = "v1"
+	}
+	return entry
+}
+
+// Index is the repository index of published charts. It is loaded from the
+// database when first requested and then kept up to date as charts are
+// published and removed, so requests are served without scanning every chart.
+type Index struct {
+	db *common.Database
+
+	mu        sync.Mutex
+	entries   map[string][]*ChartVersion // nil until loaded
+	data      []byte                     // encoded index, nil until regenerated
+	etag      string
+	generated time.Time
+}
+
+// NewIndex creates an index of the published charts in the database
+func NewIndex(db *common.Database) *Index {
+	return &Index{db: db}
+}
+
+// Get returns the encoded index.yaml and an entity tag identifying it. When
+// readable is not nil, the index lists only the chart versions it reports
+// true for, and its entity tag identifies that document, so copies cached by
+// one reader are never served to another.
+func (i *Index) Get(ctx context.Context, readable func(name, version string) bool) ([]byte, string, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.entries == nil {
+		if err := i.load(ctx); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if i.data == nil {
+		i.generated = time.Now().UTC()
+		data, etag, err := i.encode(i.entries)
+		if err != nil {
+			return nil, "", err
+		}
+		i.data, i.etag = data, etag
+	}
+	if readable == nil {
+		return i.data, i.etag, nil
+	}
+
+	entries := make(map[string][]*ChartVersion, len(i.entries))
+	for name, versions := range i.entries {
+		for _, entry := range versions {
+			if readable(name, entry.Version) {
+				entries[name] = append(entries[name], entry)
+			}
+		}
+	}
+	return i.encode(entries)
+}
+
+// encode encodes an index listing the given entries, generated when the
+// index last changed so unchanged indexes encode the same
+func (i *Index) encode(entries map[string][]*ChartVersion) ([]byte, string, error) {
+	index := IndexFile{
+		APIVersion: "v1",
+		Entries:    entries,
+		Generated:  i.generated,
+	}
+	data, err := yaml.Marshal(&index)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode index: %w", err)
+	}
+	return data, fmt.Sprintf(`"%x"`, sha256.Sum256(data)), nil
+}
+
+// Add adds a published chart to the index, replacing any entry for the same
+// version
+func (i *Index) Add(artifact *types.Artifact) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// An index not loaded yet will find the chart in the database
+	if i.entries == nil {
+		return
+	}
+	i.remove(artifact.Name, artifact.Version)
+	i.entries[artifact.Name] = append(i.entries[artifact.Name], NewChartVersion(artifact))
+	sortChartVersions(i.entries[artifact.Name])
+	i.data = nil
+}
+
+// Remove removes a chart version from the index
+func (i *Index) Remove(artifact *types.Artifact) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.entries == nil {
+		return
+	}
+	i.remove(artifact.Name, artifact.Version)
+	i.data = nil
+}
+
+// load builds the index from the published charts in the database
+func (i *Index) load(ctx context.Context) error {
+	if i.db == nil {
+		return fmt.Errorf("index unavailable without a database")
+	}
+
+	var artifacts []*types.Artifact
+	if err := i.db.WithContext(ctx).
+		Where("registry = ? AND status = ?", "helm", types.ArtifactStatusPublished).
+		Find(&artifacts).Error; err != nil {
+		return fmt.Errorf("failed to load charts: %w", err)
+	}
+
+	entries := make(map[string][]*ChartVersion)
+	for _, artifact := range artifacts {
+		entries[artifact.Name] = append(entries[artifact.Name], NewChartVersion(artifact))
+	}
+	for _, versions := range entries {
+		sortChartVersions(versions)
+	}
+	i.entries = entries
+	i.data = nil
+	return nil
+}
+
+// remove removes a chart version from the loaded entries, and the chart once
+// it has no versions left
+func (i *Index) remove(name, version string) {
+	versions := i.entries[name]
+	for j, entry := range versions {
+		if entry.Version == version {
+			versions = append(versions[:j], versions[j+1:]...)
+			break
+		}
+	}
+	if len(versions) == 0 {
+		delete(i.entries, name)
+		return
+	}
+	i.entries[name] = versions
+}
+
+// sortChartVersions orders the versions of a chart newest first, as Helm
+// writes them
+func sortChartVersions(versions []*ChartVersion) {
+	sort.SliceStable(versions, func(a, b int) bool {
+		va, errA := semver.NewVersion(versions[a].Version)
+		vb, errB := semver.NewVersion(versions[b].Version)
+		if errA != nil || errB != nil {
+			return versions[a].Version > versions[b].Version
+		}
+		return va.GreaterThan(vb)
+	})
+}
@@ -0,0 +1,177 @@
+package helm
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// createChart packages a chart directory holding the given files, the way
+// helm package does
+func createChart(t *testing.T, name string, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for path, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name + "/" + path, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+const nginxChartYAML = `apiVersion: v2
+name: nginx
+version: 1.2.0
+appVersion: "1.25.3"
+description: An NGINX web server
+keywords: [web, proxy]
+home: https://nginx.org
+maintainers:
+  - name: Jane Doe
+    email: jane@example.com
+dependencies:
+  - name: common
+    version: 2.x.x
+    repository: https://charts.example.com
+annotations:
+  category: Infrastructure
+`
+
+func TestGetMetadata_Chart(t *testing.T) {
+	registry := New(nil, nil)
+
+	content := createChart(t, "nginx", map[string]string{
+		"Chart.yaml":                nginxChartYAML,
+		"charts/common/Chart.yaml":  "apiVersion: v2\nname: common\nversion: 2.0.0\n",
+		"templates/deployment.yaml": "kind: Deployment\n",
+	})
+	metadata, err := registry.GetMetadata(content)
+	require.NoError(t, err)
+	assert.Equal(t, "An NGINX web server", metadata["description"])
+
+	chart := chartMetadata(&types.Artifact{Metadata: metadata})
+	require.NotNil(t, chart)
+	assert.Equal(t, "nginx", chart.Name)
+	assert.Equal(t, "1.25.3", chart.AppVersion)
+	assert.Equal(t, []string{"web", "proxy"}, chart.Keywords)
+	require.Len(t, chart.Maintainers, 1)
+	assert.Equal(t, "jane@example.com", chart.Maintainers[0].Email)
+	require.Len(t, chart.Dependencies, 1)
+	assert.Equal(t, "https://charts.example.com", chart.Dependencies[0].Repository)
+
+	// Content that is not a packaged chart has no chart metadata
+	metadata, err = registry.GetMetadata([]byte("name: nginx"))
+	require.NoError(t, err)
+	assert.NotContains(t, metadata, "chart")
+}
+
+func TestIndex_RoundTrip(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&types.User{}, &types.Artifact{}))
+	registry := New(nil, &common.Database{DB: db})
+	ctx := context.Background()
+
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	publish := func(version, chartYAML string) *types.Artifact {
+		content := createChart(t, "nginx", map[string]string{"Chart.yaml": chartYAML})
+		metadata, err := registry.GetMetadata(content)
+		require.NoError(t, err)
+		artifact := &types.Artifact{
+			Name:      "nginx",
+			Version:   version,
+			Registry:  "helm",
+			SHA256:    utils.ComputeSHA256(content),
+			Metadata:  metadata,
+			Status:    types.ArtifactStatusPublished,
+			CreatedAt: created,
+		}
+		require.NoError(t, db.Create(artifact).Error)
+		return artifact
+	}
+
+	publish("1.2.0", nginxChartYAML)
+	_, etag, err := registry.Index(ctx, nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, etag)
+
+	// Versions published after the index is loaded are added to it
+	next := publish("1.10.0-rc.1", "name: nginx\nversion: 1.10.0-rc.1\n")
+	registry.AddToIndex(next)
+	data, newEtag, err := registry.Index(ctx, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, etag, newEtag)
+
+	// Unchanged indexes are served as they are
+	again, sameEtag, err := registry.Index(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, newEtag, sameEtag)
+	assert.Equal(t, data, again)
+
+	// Helm reads the index with these field names
+	var raw map[string]interface{}
+	require.NoError(t, yaml.Unmarshal(data, &raw))
+	assert.Equal(t, "v1", raw["apiVersion"])
+	assert.Contains(t, raw, "generated")
+	entries := raw["entries"].(map[string]interface{})["nginx"].([]interface{})
+	require.Len(t, entries, 2)
+	full := entries[1].(map[string]interface{})
+	for _, key := range []string{"apiVersion", "appVersion", "name", "version", "description", "created", "digest", "urls", "maintainers", "dependencies", "keywords", "home", "annotations"} {
+		assert.Contains(t, full, key)
+	}
+
+	var index IndexFile
+	require.NoError(t, yaml.Unmarshal(data, &index))
+	versions := index.Entries["nginx"]
+	require.Len(t, versions, 2)
+	assert.Equal(t, "1.10.0-rc.1", versions[0].Version, "newest version first")
+	assert.Equal(t, "v1", versions[0].APIVersion, "charts without an apiVersion are v1 charts")
+	assert.Equal(t, "1.2.0", versions[1].Version)
+	assert.Equal(t, "v2", versions[1].APIVersion)
+	assert.Equal(t, "1.25.3", versions[1].AppVersion)
+	assert.Equal(t, []string{"nginx/1.2.0/nginx-1.2.0.tgz"}, versions[1].URLs)
+	assert.True(t, created.Equal(versions[1].Created))
+	assert.Len(t, versions[1].Digest, 64)
+
+	// Re-encoding what was read gives the same document
+	reencoded, err := yaml.Marshal(&index)
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(reencoded))
+
+	// Readers see only the versions they can read, under their own entity tag
+	filtered, filteredEtag, err := registry.Index(ctx, func(name, version string) bool { return version == "1.2.0" })
+	require.NoError(t, err)
+	assert.NotEqual(t, newEtag, filteredEtag)
+	index = IndexFile{}
+	require.NoError(t, yaml.Unmarshal(filtered, &index))
+	require.Len(t, index.Entries["nginx"], 1)
+	assert.Equal(t, "1.2.0", index.Entries["nginx"][0].Version)
+	_, none, err := registry.Index(ctx, func(name, version string) bool { return false })
+	require.NoError(t, err)
+	assert.NotEqual(t, filteredEtag, none)
+
+	registry.RemoveFromIndex(next)
+	data, _, err = registry.Index(ctx, nil)
+	require.NoError(t, err)
+	index = IndexFile{}
+	require.NoError(t, yaml.Unmarshal(data, &index))
+	require.Len(t, index.Entries["nginx"], 1)
+	assert.Equal(t, "1.2.0", index.Entries["nginx"][0].Version)
+}
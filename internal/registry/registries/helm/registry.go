@@ -4,17 +4,21 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"regexp"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/internal/storage"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 )
 
 // Registry implements the Helm chart repository
 type Registry struct {
 	storage storage.BlobStorage
 	db      *common.Database
+	index   *Index
 }
 
 // New creates a new Helm registry handler
@@ -22,6 +26,7 @@ func New(storage storage.BlobStorage, db *common.Database) *Registry {
 	return &Registry{
 		storage: storage,
 		db:      db,
+		index:   NewIndex(db),
 	}
 }
 
@@ -64,17 +69,44 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 		return fmt.Errorf("invalid Helm chart name format")
 	}
 
+	// Helm parses chart versions leniently as SemVer 2, accepting a v prefix
+	// and missing minor or patch components
+	if _, err := semver.NewVersion(artifact.Version); err != nil {
+		return fmt.Errorf("invalid Helm chart version format: %w", err)
+	}
+
 	// TODO: Validate chart structure (Chart.yaml, templates/, etc.)
 	return nil
 }
 
-// GetMetadata extracts metadata from Helm chart
+// GetMetadata extracts metadata from Helm chart, including its Chart.yaml for
+// the repository index
 func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
-	// TODO: Extract metadata from Chart.yaml
-	return map[string]interface{}{
+	metadata := map[string]interface{}{
 		"format": "helm",
 		"type":   "chart",
-	}, nil
+	}
+
+	// Content that is not a packaged chart is indexed by name and version only
+	chart, err := ParseChart(content)
+	if err != nil {
+		return metadata, nil
+	}
+	chartMap, err := metadataMap(chart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chart metadata: %w", err)
+	}
+	metadata["chart"] = chartMap
+	if chart.Description != "" {
+		metadata["description"] = chart.Description
+	}
+	return metadata, nil
+}
+
+// ExtractReadme returns the README.md at the root of the chart. READMEs of
+// subcharts, under charts/, are not the chart's own.
+func (r *Registry) ExtractReadme(content []byte) (string, error) {
+	return utils.ExtractTarballReadme(content)
 }
 
 // GenerateStoragePath creates the storage path for Helm charts
@@ -82,3 +114,39 @@ func (r *Registry) GenerateStoragePath(name, version string) string {
 	// Helm charts follow: charts/name-version.tgz
 	return fmt.Sprintf("helm/charts/%s-%s.tgz", name, version)
 }
+
+// provenancePath returns the storage path of a chart's provenance file, which
+// is kept next to the chart
+func (r *Registry) provenancePath(name, version string) string {
+	return r.GenerateStoragePath(name, version) + ".prov"
+}
+
+// StoreProvenance stores the provenance file of a chart
+func (r *Registry) StoreProvenance(ctx context.Context, name, version string, content []byte) error {
+	if err := r.storage.Store(ctx, r.provenancePath(name, version), bytes.NewReader(content), "application/pgp-signature"); err != nil {
+		return fmt.Errorf("failed to store provenance file: %w", err)
+	}
+	return nil
+}
+
+// GetProvenance returns the provenance file of a chart, failing if the chart
+// was uploaded without one
+func (r *Registry) GetProvenance(ctx context.Context, name, version string) (io.ReadCloser, error) {
+	return r.storage.Retrieve(ctx, r.provenancePath(name, version))
+}
+
+// Index returns the repository's index.yaml and an entity tag identifying it,
+// listing only the chart versions readable reports true for unless it is nil
+func (r *Registry) Index(ctx context.Context, readable func(name, version string) bool) ([]byte, string, error) {
+	return r.index.Get(ctx, readable)
+}
+
+// AddToIndex adds a published chart to the repository index
+func (r *Registry) AddToIndex(artifact *types.Artifact) {
+	r.index.Add(artifact)
+}
+
+// RemoveFromIndex removes a chart version from the repository index
+func (r *Registry) RemoveFromIndex(artifact *types.Artifact) {
+	r.index.Remove(artifact)
+}
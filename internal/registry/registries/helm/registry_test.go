@@ -0,0 +1,56 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate_Versions(t *testing.T) {
+	registry := New(nil, nil)
+
+	// Helm accepts a v prefix and missing minor/patch components
+	valid := []string{"1.0.0", "v1.0.0", "0.1", "2", "15.2.3-rc.1", "4.5.0+up4.5.0"}
+	for _, version := range valid {
+		t.Run(version, func(t *testing.T) {
+			artifact := &types.Artifact{Name: "nginx", Version: version}
+			assert.NoError(t, registry.Validate(artifact, []byte("chart")))
+		})
+	}
+
+	invalid := []string{"", "latest", "1.0.0.0", "1.0.0-", "1.0.0-beta..1"}
+	for _, version := range invalid {
+		t.Run("invalid "+version, func(t *testing.T) {
+			artifact := &types.Artifact{Name: "nginx", Version: version}
+			err := registry.Validate(artifact, []byte("chart"))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "invalid Helm chart version format")
+			}
+		})
+	}
+}
+
+func TestExtractReadme(t *testing.T) {
+	registry := New(nil, nil)
+
+	content := createChart(t, "nginx", map[string]string{
+		"Chart.yaml":               nginxChartYAML,
+		"README.md":                "# NGINX\n\nInstall with `helm install`.\n",
+		"charts/common/Chart.yaml": "apiVersion: v2\nname: common\nversion: 2.0.0\n",
+		"charts/common/README.md":  "# Common subchart",
+	})
+	readme, err := registry.ExtractReadme(content)
+	require.NoError(t, err)
+	assert.Equal(t, "# NGINX\n\nInstall with `helm install`.\n", readme)
+
+	// Charts without a README have none
+	content = createChart(t, "nginx", map[string]string{"Chart.yaml": nginxChartYAML})
+	readme, err = registry.ExtractReadme(content)
+	require.NoError(t, err)
+	assert.Empty(t, readme)
+
+	_, err = registry.ExtractReadme([]byte("not a chart"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,274 @@
+package maven
+
+import (
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// MetadataFilename is the name Maven clients request repository metadata by
+const MetadataFilename = "maven-metadata.xml"
+
+// ChecksumAlgorithms are the checksums Maven clients request alongside a
+// file, by the extension added to the file's name
+var ChecksumAlgorithms = []string{"md5", "sha1", "sha256", "sha512"}
+
+// ChecksumFile splits the name of a checksum file into the name of the file
+// it is the checksum of and the checksum algorithm, e.g. app-1.0.jar.sha1
+// into app-1.0.jar and sha1. It returns false for other files.
+func ChecksumFile(filename string) (string, string, bool) {
+	for _, algorithm := range ChecksumAlgorithms {
+		if base, ok := strings.CutSuffix(filename, "."+algorithm); ok && base != "" {
+			return base, algorithm, true
+		}
+	}
+	return filename, "", false
+}
+
+// LastUpdatedFormat is the yyyyMMddHHmmss layout of lastUpdated and updated
+// elements, always in UTC
+const LastUpdatedFormat = "20060102150405"
+
+// SnapshotTimestampFormat is the yyyyMMdd.HHmmss layout of the timestamp in
+// snapshot build versions, always in UTC
+const SnapshotTimestampFormat = "20060102.150405"
+
+// snapshotSuffix marks a version still under development
+const snapshotSuffix = "-SNAPSHOT"
+
+// timestampedSnapshot matches a deployed snapshot version such as
+// 1.0-20240101.120000-1, capturing the base version, timestamp and build number
+var timestampedSnapshot = regexp.MustCompile(`^(.+)-(\d{8}\.\d{6})-(\d+)$`)
+
+// snapshotBuild matches the timestamp and build number at the start of the
+// rest of a snapshot build's file name
+var snapshotBuild = regexp.MustCompile(`^\d{8}\.\d{6}-\d+`)
+
+// Metadata is a maven-metadata.xml document, either for an artifact, listing
+// its versions, or for a single snapshot version, listing its builds
+type Metadata struct {
+	XMLName      xml.Name   `xml:"metadata"`
+	ModelVersion string     `xml:"modelVersion,attr,omitempty"`
+	GroupID      string     `xml:"groupId"`
+	ArtifactID   string     `xml:"artifactId"`
+	Version      string     `xml:"version,omitempty"`
+	Versioning   Versioning `xml:"versioning"`
+}
+
+// Versioning holds the version information of a metadata document
+type Versioning struct {
+	Latest           string            `xml:"latest,omitempty"`
+	Release          string            `xml:"release,omitempty"`
+	Snapshot         *Snapshot         `xml:"snapshot,omitempty"`
+	Versions         []string          `xml:"versions>version,omitempty"`
+	LastUpdated      string            `xml:"lastUpdated"`
+	SnapshotVersions []SnapshotVersion `xml:"snapshotVersions>snapshotVersion,omitempty"`
+}
+
+// Snapshot identifies the newest build of a snapshot version
+type Snapshot struct {
+	Timestamp   string `xml:"timestamp,omitempty"`
+	BuildNumber int    `xml:"buildNumber,omitempty"`
+}
+
+// SnapshotVersion maps a file of a snapshot version to the build it resolves to
+type SnapshotVersion struct {
+	Extension string `xml:"extension"`
+	Value     string `xml:"value"`
+	Updated   string `xml:"updated"`
+}
+
+// IsSnapshot reports whether version is a snapshot, either by its
+// -SNAPSHOT suffix or as a timestamped snapshot build
+func IsSnapshot(version string) bool {
+	return strings.HasSuffix(version, snapshotSuffix) || timestampedSnapshot.MatchString(version)
+}
+
+// IsSnapshotBuild reports whether version is a timestamped snapshot build,
+// such as 1.0-20240101.120000-1, rather than a -SNAPSHOT version
+func IsSnapshotBuild(version string) bool {
+	return timestampedSnapshot.MatchString(version)
+}
+
+// SnapshotBaseVersion returns the -SNAPSHOT version a snapshot build belongs
+// to, so 1.0-20240101.120000-1 becomes 1.0-SNAPSHOT. Other versions are
+// returned unchanged.
+func SnapshotBaseVersion(version string) string {
+	if match := timestampedSnapshot.FindStringSubmatch(version); match != nil {
+		return match[1] + snapshotSuffix
+	}
+	return version
+}
+
+// ResolveSnapshotFile returns the version a file in a version directory
+// refers to. Clients resolve 1.0-SNAPSHOT through its metadata and request
+// 1.0-SNAPSHOT/app-1.0-20240101.120000-1.jar, naming the build in the file;
+// for any other file the directory's version is returned.
+func ResolveSnapshotFile(artifactID, version, filename string) string {
+	base, ok := strings.CutSuffix(version, snapshotSuffix)
+	if !ok {
+		return version
+	}
+	rest, ok := strings.CutPrefix(filename, artifactID+"-"+base+"-")
+	if !ok {
+		return version
+	}
+	if build := snapshotBuild.FindString(rest); build != "" {
+		return base + "-" + build
+	}
+	return version
+}
+
+// BuildMetadata generates the artifact level metadata listing every version
+// of groupID:artifactID, oldest first. Snapshot builds are listed once under
+// their -SNAPSHOT version; latest is the newest version of any kind and
+// release the newest that is not a snapshot.
+func BuildMetadata(groupID, artifactID string, artifacts []*types.Artifact) *Metadata {
+	var versions []string
+	seen := make(map[string]bool)
+	var lastUpdated time.Time
+	for _, artifact := range artifacts {
+		version := SnapshotBaseVersion(artifact.Version)
+		if !seen[version] {
+			seen[version] = true
+			versions = append(versions, version)
+		}
+		if artifact.UpdatedAt.After(lastUpdated) {
+			lastUpdated = artifact.UpdatedAt
+		}
+	}
+
+	// Latest first, with versions that are not semver after the rest
+	sorted, _ := utils.FilterVersions(versions, "", true)
+
+	metadata := &Metadata{
+		GroupID:    groupID,
+		ArtifactID: artifactID,
+		Versioning: Versioning{
+			LastUpdated: formatLastUpdated(lastUpdated),
+		},
+	}
+	if len(sorted) > 0 {
+		metadata.Versioning.Latest = sorted[0]
+	}
+	for _, version := range sorted {
+		if !IsSnapshot(version) {
+			metadata.Versioning.Release = version
+			break
+		}
+	}
+	for i := len(sorted) - 1; i >= 0; i-- {
+		metadata.Versioning.Versions = append(metadata.Versioning.Versions, sorted[i])
+	}
+	return metadata
+}
+
+// SnapshotBuildNumber returns the build number of a timestamped snapshot
+// build, or 0 for a build deployed without a timestamp
+func SnapshotBuildNumber(version string) int {
+	if match := timestampedSnapshot.FindStringSubmatch(version); match != nil {
+		build, _ := strconv.Atoi(match[3])
+		return build
+	}
+	return 0
+}
+
+// NewestSnapshotBuild returns the newest build of a -SNAPSHOT version among
+// the artifacts of groupID:artifactID, the one a plain
+// artifactId-1.0-SNAPSHOT.jar resolves to, or nil if it has none. Builds
+// deployed without a timestamp are only used when there are no others.
+func NewestSnapshotBuild(version string, artifacts []*types.Artifact) *types.Artifact {
+	var newest *types.Artifact
+	newestBuild := -1
+	for _, artifact := range artifacts {
+		if SnapshotBaseVersion(artifact.Version) != version {
+			continue
+		}
+		build := SnapshotBuildNumber(artifact.Version)
+		if build > newestBuild || (build == newestBuild && artifact.UpdatedAt.After(newest.UpdatedAt)) {
+			newest, newestBuild = artifact, build
+		}
+	}
+	return newest
+}
+
+// NextSnapshotVersion returns the timestamped build a file deployed as a
+// plain -SNAPSHOT version is stored as, such as 1.0-20240101.120000-3 for
+// 1.0-SNAPSHOT when its newest build is number 2. Other versions are
+// returned unchanged.
+func NextSnapshotVersion(version string, artifacts []*types.Artifact, now time.Time) string {
+	base, ok := strings.CutSuffix(version, snapshotSuffix)
+	if !ok {
+		return version
+	}
+	build := 1
+	if newest := NewestSnapshotBuild(version, artifacts); newest != nil {
+		build = SnapshotBuildNumber(newest.Version) + 1
+	}
+	return fmt.Sprintf("%s-%s-%d", base, now.UTC().Format(SnapshotTimestampFormat), build)
+}
+
+// BuildSnapshotMetadata generates the metadata of one -SNAPSHOT version from
+// the artifacts of groupID:artifactID, resolving it to its newest timestamped
+// build. It returns nil when the version has no builds.
+func BuildSnapshotMetadata(groupID, artifactID, version string, artifacts []*types.Artifact) *Metadata {
+	newest := NewestSnapshotBuild(version, artifacts)
+	if newest == nil {
+		return nil
+	}
+
+	metadata := &Metadata{
+		ModelVersion: "1.1.0",
+		GroupID:      groupID,
+		ArtifactID:   artifactID,
+		Version:      version,
+	}
+
+	var lastUpdated time.Time
+	for _, artifact := range artifacts {
+		if SnapshotBaseVersion(artifact.Version) == version && artifact.UpdatedAt.After(lastUpdated) {
+			lastUpdated = artifact.UpdatedAt
+		}
+	}
+
+	if match := timestampedSnapshot.FindStringSubmatch(newest.Version); match != nil {
+		metadata.Versioning.Snapshot = &Snapshot{Timestamp: match[2], BuildNumber: SnapshotBuildNumber(newest.Version)}
+	}
+	metadata.Versioning.LastUpdated = formatLastUpdated(lastUpdated)
+	metadata.Versioning.SnapshotVersions = []SnapshotVersion{{
+		Extension: fileExtension(newest),
+		Value:     newest.Version,
+		Updated:   formatLastUpdated(newest.UpdatedAt),
+	}}
+	return metadata
+}
+
+// Marshal renders the metadata as an XML document
+func (m *Metadata) Marshal() ([]byte, error) {
+	body, err := xml.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+// fileExtension is the extension of the file stored for an artifact
+func fileExtension(artifact *types.Artifact) string {
+	if artifact.ContentType == "application/xml" {
+		return "pom"
+	}
+	return "jar"
+}
+
+func formatLastUpdated(t time.Time) string {
+	if t.IsZero() {
+		t = time.Now()
+	}
+	return t.UTC().Format(LastUpdatedFormat)
+}
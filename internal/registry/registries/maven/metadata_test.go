@@ -0,0 +1,142 @@
+package maven
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+func metadataArtifact(version string, updated time.Time) *types.Artifact {
+	return &types.Artifact{Name: "com.example:app", Version: version, Registry: "maven", UpdatedAt: updated}
+}
+
+func TestBuildMetadata_RoundTrip(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)
+	artifacts := []*types.Artifact{
+		metadataArtifact("1.10.0", base.Add(2*time.Hour)),
+		metadataArtifact("1.2.0", base),
+		metadataArtifact("2.0-20240301.150000-1", base.Add(3*time.Hour)),
+		metadataArtifact("2.0-20240301.160000-2", base.Add(4*time.Hour)),
+		metadataArtifact("1.9.0", base.Add(time.Hour)),
+	}
+
+	body, err := BuildMetadata("com.example", "app", artifacts).Marshal()
+	require.NoError(t, err)
+	assert.Contains(t, string(body), xml.Header)
+
+	var parsed Metadata
+	require.NoError(t, xml.Unmarshal(body, &parsed))
+
+	assert.Equal(t, "com.example", parsed.GroupID)
+	assert.Equal(t, "app", parsed.ArtifactID)
+	assert.Equal(t, []string{"1.2.0", "1.9.0", "1.10.0", "2.0-SNAPSHOT"}, parsed.Versioning.Versions)
+	assert.Equal(t, "2.0-SNAPSHOT", parsed.Versioning.Latest)
+	assert.Equal(t, "1.10.0", parsed.Versioning.Release)
+	assert.Equal(t, "20240301163045", parsed.Versioning.LastUpdated)
+	assert.Nil(t, parsed.Versioning.Snapshot)
+}
+
+func TestBuildSnapshotMetadata_RoundTrip(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	artifacts := []*types.Artifact{
+		metadataArtifact("1.0.0", base),
+		metadataArtifact("2.0-20240301.150000-1", base.Add(time.Hour)),
+		metadataArtifact("2.0-20240301.160000-2", base.Add(2*time.Hour)),
+		metadataArtifact("2.1-20240301.170000-3", base.Add(3*time.Hour)),
+	}
+
+	metadata := BuildSnapshotMetadata("com.example", "app", "2.0-SNAPSHOT", artifacts)
+	require.NotNil(t, metadata)
+	body, err := metadata.Marshal()
+	require.NoError(t, err)
+
+	var parsed Metadata
+	require.NoError(t, xml.Unmarshal(body, &parsed))
+
+	assert.Equal(t, "1.1.0", parsed.ModelVersion)
+	assert.Equal(t, "2.0-SNAPSHOT", parsed.Version)
+	require.NotNil(t, parsed.Versioning.Snapshot)
+	assert.Equal(t, "20240301.160000", parsed.Versioning.Snapshot.Timestamp)
+	assert.Equal(t, 2, parsed.Versioning.Snapshot.BuildNumber)
+	assert.Equal(t, "20240301140000", parsed.Versioning.LastUpdated)
+	assert.Equal(t, []SnapshotVersion{{Extension: "jar", Value: "2.0-20240301.160000-2", Updated: "20240301140000"}}, parsed.Versioning.SnapshotVersions)
+	assert.Empty(t, parsed.Versioning.Versions)
+
+	assert.Nil(t, BuildSnapshotMetadata("com.example", "app", "3.0-SNAPSHOT", artifacts))
+}
+
+func TestBuildSnapshotMetadata_WithoutTimestamp(t *testing.T) {
+	artifacts := []*types.Artifact{metadataArtifact("1.0-SNAPSHOT", time.Now())}
+
+	metadata := BuildSnapshotMetadata("com.example", "app", "1.0-SNAPSHOT", artifacts)
+	require.NotNil(t, metadata)
+	assert.Nil(t, metadata.Versioning.Snapshot, "builds deployed without a timestamp resolve to the plain snapshot file")
+	assert.Equal(t, "1.0-SNAPSHOT", metadata.Versioning.SnapshotVersions[0].Value)
+}
+
+func TestResolveSnapshotFile(t *testing.T) {
+	tests := []struct {
+		version  string
+		filename string
+		want     string
+	}{
+		{"1.0-SNAPSHOT", "app-1.0-20240301.160000-2.jar", "1.0-20240301.160000-2"},
+		{"1.0-SNAPSHOT", "app-1.0-20240301.160000-2-sources.jar", "1.0-20240301.160000-2"},
+		{"1.0-SNAPSHOT", "app-1.0-SNAPSHOT.jar", "1.0-SNAPSHOT"},
+		{"1.0-SNAPSHOT", "other-1.0-20240301.160000-2.jar", "1.0-SNAPSHOT"},
+		{"1.0.0", "app-1.0.0.jar", "1.0.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			assert.Equal(t, tt.want, ResolveSnapshotFile("app", tt.version, tt.filename))
+		})
+	}
+}
+
+func TestChecksumFile(t *testing.T) {
+	tests := []struct {
+		filename  string
+		base      string
+		algorithm string
+		ok        bool
+	}{
+		{"app-1.0.jar.sha1", "app-1.0.jar", "sha1", true},
+		{"app-1.0.pom.md5", "app-1.0.pom", "md5", true},
+		{"app-1.0.jar.sha256", "app-1.0.jar", "sha256", true},
+		{"maven-metadata.xml.sha512", "maven-metadata.xml", "sha512", true},
+		{"app-1.0.jar", "app-1.0.jar", "", false},
+		{"app-1.0.jar.asc", "app-1.0.jar.asc", "", false},
+		{".sha1", ".sha1", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			base, algorithm, ok := ChecksumFile(tt.filename)
+			assert.Equal(t, tt.base, base)
+			assert.Equal(t, tt.algorithm, algorithm)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestNextSnapshotVersion(t *testing.T) {
+	now := time.Date(2024, 3, 2, 9, 30, 15, 0, time.FixedZone("CET", 3600))
+	artifacts := []*types.Artifact{
+		metadataArtifact("1.0.0", now),
+		metadataArtifact("2.0-20240301.150000-1", now),
+		metadataArtifact("2.0-20240301.160000-2", now),
+	}
+
+	assert.Equal(t, "2.0-20240302.083015-3", NextSnapshotVersion("2.0-SNAPSHOT", artifacts, now))
+	assert.Equal(t, "3.0-20240302.083015-1", NextSnapshotVersion("3.0-SNAPSHOT", artifacts, now))
+	assert.Equal(t, "1.0.0", NextSnapshotVersion("1.0.0", artifacts, now))
+
+	assert.Equal(t, "2.0-20240301.160000-2", NewestSnapshotBuild("2.0-SNAPSHOT", artifacts).Version)
+	assert.Nil(t, NewestSnapshotBuild("3.0-SNAPSHOT", artifacts))
+}
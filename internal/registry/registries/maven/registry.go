@@ -28,15 +28,7 @@ func New(storage storage.BlobStorage, db *common.Database) *Registry {
 
 // Upload stores a Maven artifact
 func (r *Registry) Upload(ctx context.Context, artifact *types.Artifact, content []byte) error {
-	// Determine content type based on file extension
-	contentType := "application/java-archive"
-	if strings.HasSuffix(artifact.Name, ".pom") {
-		contentType = "application/xml"
-	} else if strings.HasSuffix(artifact.Name, ".war") {
-		contentType = "application/java-archive"
-	} else if strings.HasSuffix(artifact.Name, ".aar") {
-		contentType = "application/java-archive"
-	}
+	contentType := r.ContentType(artifact)
 
 	// Store the content
 	reader := bytes.NewReader(content)
@@ -48,6 +40,17 @@ func (r *Registry) Upload(ctx context.Context, artifact *types.Artifact, content
 	return nil
 }
 
+// ContentType returns the content type a Maven artifact is stored as. Maven
+// artifacts are checked by their coordinates alone, so uploads are streamed
+// into storage rather than held in memory.
+func (r *Registry) ContentType(artifact *types.Artifact) string {
+	// Determine content type based on file extension
+	if strings.HasSuffix(artifact.Name, ".pom") {
+		return "application/xml"
+	}
+	return "application/java-archive"
+}
+
 // Download retrieves a Maven artifact
 func (r *Registry) Download(name, version string) (*types.Artifact, []byte, error) {
 	return nil, nil, fmt.Errorf("use service.Download instead")
@@ -94,12 +97,19 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 		return fmt.Errorf("invalid Maven version format: version cannot be empty")
 	}
 
-	// Maven version validation - allow alphanumeric, dots, hyphens, and common qualifiers
-	versionRegex := regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*[a-zA-Z0-9]$|^[a-zA-Z0-9]$`)
+	// Maven version validation - allow alphanumeric, dots, hyphens, underscores
+	// and plus signs, covering qualifiers (1.0.0.Final, 2.0.0-M1) and
+	// timestamped snapshots (1.0-20240101.120000-1)
+	versionRegex := regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._+-]*[a-zA-Z0-9]$|^[a-zA-Z0-9]$`)
 	if !versionRegex.MatchString(artifact.Version) {
 		return fmt.Errorf("invalid Maven version format")
 	}
 
+	// LATEST and RELEASE are meta-versions resolved by Maven, not publishable versions
+	if strings.EqualFold(artifact.Version, "LATEST") || strings.EqualFold(artifact.Version, "RELEASE") {
+		return fmt.Errorf("invalid Maven version format: %s is a reserved meta-version", artifact.Version)
+	}
+
 	// TODO: Validate JAR/WAR/AAR structure if applicable
 	return nil
 }
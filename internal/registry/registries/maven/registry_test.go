@@ -5,6 +5,7 @@ import (
 	"context"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -40,6 +41,13 @@ func (m *MockStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser,
 	return nil, io.EOF
 }
 
+func (m *MockStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	if data, exists := m.data[path]; exists && offset < int64(len(data)) {
+		return io.NopCloser(io.NewSectionReader(bytes.NewReader(data), offset, length)), nil
+	}
+	return nil, io.EOF
+}
+
 func (m *MockStorage) Delete(ctx context.Context, path string) error {
 	delete(m.data, path)
 	return nil
@@ -57,6 +65,13 @@ func (m *MockStorage) GetSize(ctx context.Context, path string) (int64, error) {
 	return 0, io.EOF
 }
 
+func (m *MockStorage) GetModTime(ctx context.Context, path string) (time.Time, error) {
+	if _, exists := m.data[path]; exists {
+		return time.Time{}, nil
+	}
+	return time.Time{}, io.EOF
+}
+
 func (m *MockStorage) List(ctx context.Context, prefix string) ([]string, error) {
 	var files []string
 	for path := range m.data {
@@ -241,6 +256,11 @@ func TestValidate_InvalidVersions(t *testing.T) {
 		{"empty version", ""},
 		{"spaces", "1.0.0 "},
 		{"invalid chars", "1.0.0@"},
+		{"unresolved property", "${project.version}"},
+		{"path separator", "1.0/../2.0"},
+		{"colon", "1.0:2"},
+		{"latest meta-version", "LATEST"},
+		{"release meta-version", "RELEASE"},
 	}
 
 	for _, tt := range tests {
@@ -273,6 +293,12 @@ func TestValidate_ValidVersions(t *testing.T) {
 		"1.2.3-alpha-123",
 		"20220101",
 		"1.0.0.Final",
+		"2.0.0-M1",
+		"5.3.31",
+		"1.0-20240101.120000-1",
+		"1.6.0_31",
+		"1.0.0+build.1",
+		"33.0.0-jre",
 	}
 
 	for _, version := range validVersions {
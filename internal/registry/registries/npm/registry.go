@@ -1,27 +1,48 @@
 package npm
 
 import (
-	"archive/tar"
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"path"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/internal/storage"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 	"github.com/rs/zerolog/log"
 )
 
+// ShasumMetadataKey is the artifact metadata field holding the SHA1 checksum
+// of a tarball, which npm clients verify downloads against
+const ShasumMetadataKey = "shasum"
+
+// IntegrityMetadataKey is the artifact metadata field holding the SSRI
+// integrity string of a tarball, which newer npm clients verify downloads
+// against in preference to the shasum
+const IntegrityMetadataKey = "integrity"
+
+// Integrity returns the SSRI integrity string of a tarball from its SHA-512
+// digest, such as sha512-<base64 digest>
+func Integrity(sha512Sum []byte) string {
+	return "sha512-" + base64.StdEncoding.EncodeToString(sha512Sum)
+}
+
 // Registry implements the npm package registry
 type Registry struct {
-	storage storage.BlobStorage
-	db      *common.Database
+	storage       storage.BlobStorage
+	db            *common.Database
+	verifyTarball bool
 }
 
 // Types are now defined in types.go to avoid duplication
@@ -34,6 +55,13 @@ func New(storage storage.BlobStorage, db *common.Database) *Registry {
 	}
 }
 
+// SetTarballVerification enables or disables reading every entry of uploaded
+// tarballs to detect truncation and corruption before they are accepted.
+// Without it only the entries up to package.json are read.
+func (r *Registry) SetTarballVerification(enabled bool) {
+	r.verifyTarball = enabled
+}
+
 // Upload stores an npm package
 func (r *Registry) Upload(ctx context.Context, artifact *types.Artifact, content []byte) error {
 	log.Info().
@@ -99,8 +127,19 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 		return fmt.Errorf("invalid npm package name format")
 	}
 
+	// npm publishes only strict SemVer 2.0 versions
+	if _, err := semver.StrictNewVersion(artifact.Version); err != nil {
+		return fmt.Errorf("invalid npm version format: %w", err)
+	}
+
+	if r.verifyTarball {
+		if err := verifyTarball(content); err != nil {
+			return err
+		}
+	}
+
 	// Extract and validate package.json from the tarball
-	packageJSON, err := extractPackageJSONFromTarball(content)
+	packageJSON, err := ExtractPackageManifest(content)
 	if err != nil {
 		return fmt.Errorf("failed to extract package.json: %w", err)
 	}
@@ -119,13 +158,16 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 
 // GetMetadata extracts metadata from npm package
 func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
+	sha512Sum := sha512.Sum512(content)
 	metadata := map[string]interface{}{
-		"format": "npm",
-		"type":   "package",
+		"format":             "npm",
+		"type":               "package",
+		ShasumMetadataKey:    utils.ComputeSHA1(content),
+		IntegrityMetadataKey: Integrity(sha512Sum[:]),
 	}
 
 	// Extract package.json from the tarball
-	packageJSON, err := extractPackageJSONFromTarball(content)
+	packageJSON, err := ExtractPackageManifest(content)
 	if err != nil {
 		// If we can't extract package.json, return basic metadata
 		return metadata, nil
@@ -179,6 +221,13 @@ func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
 		metadata["repository"] = packageJSON.Repository
 	}
 
+	// Compare declared dependencies with what is actually bundled
+	if audit, err := auditDependencies(content, packageJSON); err != nil {
+		log.Debug().Err(err).Str("package", packageJSON.Name).Msg("Could not audit bundled dependencies")
+	} else {
+		metadata["dependencyAudit"] = audit
+	}
+
 	// Handle dist-tags
 	if len(packageJSON.DistTags) > 0 {
 		metadata["dist-tags"] = packageJSON.DistTags
@@ -225,8 +274,9 @@ func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
 	return metadata, nil
 }
 
-// extractPackageJSONFromTarball extracts and parses package.json from an npm tarball
-func extractPackageJSONFromTarball(tarballData []byte) (*PackageManifest, error) {
+// ExtractPackageManifest extracts and parses the root package.json of an npm
+// tarball
+func ExtractPackageManifest(tarballData []byte) (*PackageManifest, error) {
 	// Create a gzip reader
 	gzipReader, err := gzip.NewReader(bytes.NewReader(tarballData))
 	if err != nil {
@@ -235,7 +285,7 @@ func extractPackageJSONFromTarball(tarballData []byte) (*PackageManifest, error)
 	defer gzipReader.Close()
 
 	// Create a tar reader
-	tarReader := tar.NewReader(gzipReader)
+	tarReader := utils.NewTarReader(gzipReader)
 
 	// Look for package.json in the tarball
 	for {
@@ -247,10 +297,11 @@ func extractPackageJSONFromTarball(tarballData []byte) (*PackageManifest, error)
 			return nil, fmt.Errorf("failed to read tar header: %w", err)
 		}
 
-		// Look for package.json file (could be in package/ directory)
-		if strings.HasSuffix(header.Name, "package.json") {
+		// Look for the root package.json (usually package/package.json), ignoring
+		// manifests of dependencies bundled under node_modules
+		if path.Base(header.Name) == "package.json" && strings.Count(strings.Trim(header.Name, "/"), "/") <= 1 {
 			// Read the package.json content
-			packageJSONBytes, err := io.ReadAll(tarReader)
+			packageJSONBytes, err := tarReader.ReadEntry()
 			if err != nil {
 				return nil, fmt.Errorf("failed to read package.json: %w", err)
 			}
@@ -268,6 +319,240 @@ func extractPackageJSONFromTarball(tarballData []byte) (*PackageManifest, error)
 	return nil, fmt.Errorf("package.json not found in tarball")
 }
 
+// verifyTarball reads the whole gzip-compressed tarball, so truncation, gzip
+// CRC mismatches and malformed tar entries anywhere in it are detected
+func verifyTarball(tarballData []byte) error {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(tarballData))
+	if err != nil {
+		return fmt.Errorf("corrupt package tarball: %w", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := utils.NewTarReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("corrupt package tarball: %w", err)
+		}
+		if _, err := io.Copy(io.Discard, tarReader); err != nil {
+			return fmt.Errorf("corrupt package tarball: entry %s: %w", header.Name, err)
+		}
+	}
+
+	// The gzip checksum is only verified once the stream is read to its end,
+	// past the tar end-of-archive padding
+	if _, err := io.Copy(io.Discard, gzipReader); err != nil {
+		return fmt.Errorf("corrupt package tarball: %w", err)
+	}
+
+	return nil
+}
+
+// ExtractIcon returns a conventional icon file (e.g. icon.png or logo.jpg) from
+// the root of the package tarball, if present
+func (r *Registry) ExtractIcon(content []byte) ([]byte, string, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := utils.NewTarReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		// npm tarballs nest package contents under a single top-level directory
+		parts := strings.SplitN(header.Name, "/", 2)
+		if len(parts) != 2 || !utils.IsConventionIconFile(parts[1]) {
+			continue
+		}
+
+		if header.Size > utils.MaxIconSize {
+			return nil, "", fmt.Errorf("icon %s exceeds maximum size of %d bytes", header.Name, utils.MaxIconSize)
+		}
+
+		data, err := tarReader.ReadEntry()
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read icon file: %w", err)
+		}
+		return data, parts[1], nil
+	}
+
+	return nil, "", nil
+}
+
+// missingReadme is the placeholder older npm clients put in the readme field
+// of packages without a README
+const missingReadme = "ERROR: No README data found!"
+
+// ExtractReadme returns the README given in package.json, falling back to a
+// README file at the root of the package tarball
+func (r *Registry) ExtractReadme(content []byte) (string, error) {
+	if manifest, err := ExtractPackageManifest(content); err == nil &&
+		manifest.Readme != "" && manifest.Readme != missingReadme {
+		return manifest.Readme, nil
+	}
+	return utils.ExtractTarballReadme(content)
+}
+
+// auditDependencies compares the dependencies declared in package.json with the
+// packages bundled at the top level of the tarball's node_modules directory
+func auditDependencies(tarballData []byte, manifest *PackageManifest) (*DependencyAudit, error) {
+	bundledVersions, err := findBundledPackages(tarballData)
+	if err != nil {
+		return nil, err
+	}
+
+	declaredRanges := make(map[string]string)
+	for _, deps := range []map[string]string{manifest.PeerDependencies, manifest.OptionalDependencies, manifest.Dependencies} {
+		for name, versionRange := range deps {
+			declaredRanges[name] = versionRange
+		}
+	}
+
+	audit := &DependencyAudit{
+		Status:            "consistent",
+		Declared:          sortedKeys(declaredRanges),
+		DeclaredBundled:   declaredBundledDependencies(manifest),
+		Bundled:           sortedKeys(bundledVersions),
+		MissingBundled:    []string{},
+		UndeclaredBundled: []string{},
+		VersionMismatches: []DependencyMismatch{},
+	}
+
+	for _, name := range audit.DeclaredBundled {
+		if _, ok := bundledVersions[name]; !ok {
+			audit.MissingBundled = append(audit.MissingBundled, name)
+		}
+	}
+
+	for _, name := range audit.Bundled {
+		declared, ok := declaredRanges[name]
+		if !ok {
+			audit.UndeclaredBundled = append(audit.UndeclaredBundled, name)
+			continue
+		}
+
+		// Ranges that are not semver (git URLs, file: paths, tags) cannot be checked
+		constraint, err := semver.NewConstraint(declared)
+		if err != nil {
+			continue
+		}
+		version, err := semver.NewVersion(bundledVersions[name])
+		if err != nil {
+			continue
+		}
+		if !constraint.Check(version) {
+			audit.VersionMismatches = append(audit.VersionMismatches, DependencyMismatch{
+				Name:     name,
+				Declared: declared,
+				Bundled:  bundledVersions[name],
+			})
+		}
+	}
+
+	if len(audit.MissingBundled) > 0 || len(audit.UndeclaredBundled) > 0 || len(audit.VersionMismatches) > 0 {
+		audit.Status = "drift"
+	}
+
+	return audit, nil
+}
+
+// findBundledPackages returns the name and version of each package bundled
+// directly under the tarball's node_modules directory
+func findBundledPackages(tarballData []byte) (map[string]string, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(tarballData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	bundled := make(map[string]string)
+	tarReader := utils.NewTarReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		// Expect <root>/node_modules/<name>/package.json or <root>/node_modules/@scope/<name>/package.json
+		parts := strings.Split(header.Name, "/")
+		if len(parts) < 4 || parts[1] != "node_modules" || parts[len(parts)-1] != "package.json" {
+			continue
+		}
+		name := parts[2]
+		if strings.HasPrefix(name, "@") {
+			if len(parts) != 5 {
+				continue
+			}
+			name = name + "/" + parts[3]
+		} else if len(parts) != 4 {
+			continue
+		}
+
+		var bundledManifest struct {
+			Version string `json:"version"`
+		}
+		data, err := tarReader.ReadEntry()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundled package.json: %w", err)
+		}
+		if err := json.Unmarshal(data, &bundledManifest); err != nil {
+			log.Debug().Err(err).Str("path", header.Name).Msg("Ignoring unparseable bundled package.json")
+		}
+		bundled[name] = bundledManifest.Version
+	}
+
+	return bundled, nil
+}
+
+// declaredBundledDependencies resolves bundledDependencies (or its
+// bundleDependencies alias), where true means every runtime dependency
+func declaredBundledDependencies(manifest *PackageManifest) []string {
+	value := manifest.BundledDependencies
+	if value == nil {
+		value = manifest.BundleDependencies
+	}
+
+	names := []string{}
+	switch v := value.(type) {
+	case bool:
+		if v {
+			names = sortedKeys(manifest.Dependencies)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if name, ok := item.(string); ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	return names
+}
+
+// sortedKeys returns the keys of a string map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // GenerateStoragePath creates the storage path for npm packages
 func (r *Registry) GenerateStoragePath(name, version string) string {
 	// If this is a scoped package, handle the path differently
@@ -7,11 +7,13 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"math/rand"
 	"testing"
 	"time"
 
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -34,6 +36,11 @@ func (m *MockBlobStorage) Retrieve(ctx context.Context, path string) (io.ReadClo
 	return args.Get(0).(io.ReadCloser), args.Error(1)
 }
 
+func (m *MockBlobStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	args := m.Called(ctx, path, offset, length)
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
 func (m *MockBlobStorage) Delete(ctx context.Context, path string) error {
 	args := m.Called(ctx, path)
 	return args.Error(0)
@@ -49,6 +56,11 @@ func (m *MockBlobStorage) GetSize(ctx context.Context, path string) (int64, erro
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *MockBlobStorage) GetModTime(ctx context.Context, path string) (time.Time, error) {
+	args := m.Called(ctx, path)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
 func (m *MockBlobStorage) List(ctx context.Context, prefix string) ([]string, error) {
 	args := m.Called(ctx, prefix)
 	return args.Get(0).([]string), args.Error(1)
@@ -59,7 +71,7 @@ func setupTestDB(t *testing.T) *common.Database {
 	require.NoError(t, err)
 
 	// Auto migrate tables
-	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.PackageOwnership{})
+	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{})
 	require.NoError(t, err)
 
 	return &common.Database{DB: db}
@@ -118,6 +130,48 @@ func createTestPackageTarball(packageData map[string]interface{}) ([]byte, error
 	return buf.Bytes(), nil
 }
 
+// createTestPackageTarballWithFiles creates an npm package tarball containing
+// package.json plus additional files keyed by their path under package/
+func createTestPackageTarballWithFiles(packageData map[string]interface{}, files map[string][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	packageJSON, err := json.Marshal(packageData)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string][]byte{"package/package.json": packageJSON}
+	for name, data := range files {
+		entries["package/"+name] = data
+	}
+
+	for name, data := range entries {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
 func TestNew(t *testing.T) {
 	mockStorage := &MockBlobStorage{}
 	db := setupTestDB(t)
@@ -266,6 +320,28 @@ func TestValidate_InvalidPackageName(t *testing.T) {
 	}
 }
 
+func TestValidate_Versions(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+
+	valid := []string{"1.0.0", "0.0.1", "4.17.21", "1.0.0-beta.1", "18.3.0-canary-a870b2d54-20240314", "1.0.0+sha.5114f85"}
+	for _, version := range valid {
+		t.Run(version, func(t *testing.T) {
+			content, err := createTestPackageTarball(map[string]interface{}{"name": "test-package", "version": version})
+			require.NoError(t, err)
+			assert.NoError(t, registry.Validate(&types.Artifact{Name: "test-package", Version: version}, content))
+		})
+	}
+
+	invalid := []string{"", "1.0", "v1.0.0", "01.0.0", "1.0.0-01", "1.0.0-beta..1", "latest", "1.0.0.0"}
+	for _, version := range invalid {
+		t.Run("invalid "+version, func(t *testing.T) {
+			err := registry.Validate(&types.Artifact{Name: "test-package", Version: version}, []byte("content"))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "invalid npm version format")
+		})
+	}
+}
+
 func TestValidate_NameMismatch(t *testing.T) {
 	registry, _, _ := setupTestRegistry(t)
 
@@ -310,6 +386,70 @@ func TestValidate_VersionMismatch(t *testing.T) {
 	assert.Contains(t, err.Error(), "package version mismatch")
 }
 
+// createTarballWithLargeFile creates an npm tarball whose package.json is
+// followed by a large incompressible file, so truncating the archive only
+// damages entries after package.json
+func createTarballWithLargeFile(t *testing.T) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+
+	payload := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(payload)
+
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{"package/package.json", []byte(`{"name":"test-package","version":"1.0.0"}`)},
+		{"package/dist/bundle.bin", payload},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.data))}))
+		_, err := tw.Write(entry.data)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestValidate_TarballVerification(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+	registry.SetTarballVerification(true)
+
+	artifact := &types.Artifact{Name: "test-package", Version: "1.0.0"}
+	content := createTarballWithLargeFile(t)
+
+	t.Run("valid tarball accepted", func(t *testing.T) {
+		assert.NoError(t, registry.Validate(artifact, content))
+	})
+
+	t.Run("truncated tarball rejected", func(t *testing.T) {
+		err := registry.Validate(artifact, content[:len(content)/2])
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "corrupt package tarball")
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("checksum mismatch rejected", func(t *testing.T) {
+		corrupted := bytes.Clone(content)
+		// The gzip trailer ends with the CRC-32 and size of the uncompressed data
+		corrupted[len(corrupted)-8] ^= 0xff
+
+		err := registry.Validate(artifact, corrupted)
+		require.Error(t, err)
+		assert.ErrorIs(t, err, gzip.ErrChecksum)
+	})
+
+	t.Run("unverified truncation goes unnoticed", func(t *testing.T) {
+		registry.SetTarballVerification(false)
+		defer registry.SetTarballVerification(true)
+
+		assert.NoError(t, registry.Validate(artifact, content[:len(content)/2]))
+	})
+}
+
 func TestGetMetadata_Success(t *testing.T) {
 	registry, _, _ := setupTestRegistry(t)
 
@@ -446,3 +586,119 @@ func TestDelete_Deprecated(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "use service.Delete instead")
 }
+
+func TestGetMetadata_DependencyAuditConsistent(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+
+	packageData := map[string]interface{}{
+		"name":                "bundler",
+		"version":             "1.0.0",
+		"dependencies":        map[string]string{"lodash": "^4.17.0"},
+		"bundledDependencies": []string{"lodash"},
+	}
+
+	content, err := createTestPackageTarballWithFiles(packageData, map[string][]byte{
+		"node_modules/lodash/package.json": []byte(`{"name":"lodash","version":"4.17.21"}`),
+	})
+	require.NoError(t, err)
+
+	metadata, err := registry.GetMetadata(content)
+	require.NoError(t, err)
+
+	audit, ok := metadata["dependencyAudit"].(*DependencyAudit)
+	require.True(t, ok)
+	assert.Equal(t, "consistent", audit.Status)
+	assert.Equal(t, []string{"lodash"}, audit.Bundled)
+	assert.Empty(t, audit.MissingBundled)
+	assert.Empty(t, audit.UndeclaredBundled)
+	assert.Empty(t, audit.VersionMismatches)
+}
+
+func TestGetMetadata_DependencyAuditDrift(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+
+	packageData := map[string]interface{}{
+		"name":    "drifting",
+		"version": "1.0.0",
+		"dependencies": map[string]string{
+			"lodash":     "^4.17.0",
+			"left-pad":   "^1.3.0",
+			"@scope/bar": "~2.0.0",
+		},
+		"bundleDependencies": true,
+	}
+
+	content, err := createTestPackageTarballWithFiles(packageData, map[string][]byte{
+		// Bundled version outside the declared range
+		"node_modules/lodash/package.json": []byte(`{"name":"lodash","version":"3.10.1"}`),
+		// Bundled but never declared
+		"node_modules/chalk/package.json": []byte(`{"name":"chalk","version":"5.0.0"}`),
+		// Scoped package within range
+		"node_modules/@scope/bar/package.json": []byte(`{"name":"@scope/bar","version":"2.0.4"}`),
+		// Nested dependencies are not top-level bundles
+		"node_modules/chalk/node_modules/ansi/package.json": []byte(`{"name":"ansi","version":"1.0.0"}`),
+	})
+	require.NoError(t, err)
+
+	metadata, err := registry.GetMetadata(content)
+	require.NoError(t, err)
+
+	audit, ok := metadata["dependencyAudit"].(*DependencyAudit)
+	require.True(t, ok)
+	assert.Equal(t, "drift", audit.Status)
+	assert.Equal(t, []string{"@scope/bar", "left-pad", "lodash"}, audit.DeclaredBundled)
+	assert.Equal(t, []string{"@scope/bar", "chalk", "lodash"}, audit.Bundled)
+	assert.Equal(t, []string{"left-pad"}, audit.MissingBundled)
+	assert.Equal(t, []string{"chalk"}, audit.UndeclaredBundled)
+	assert.Equal(t, []DependencyMismatch{{Name: "lodash", Declared: "^4.17.0", Bundled: "3.10.1"}}, audit.VersionMismatches)
+}
+
+func TestExtractReadme(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+	packageData := map[string]interface{}{"name": "documented", "version": "1.0.0"}
+
+	// The README file at the package root is used, preferring markdown
+	content, err := createTestPackageTarballWithFiles(packageData, map[string][]byte{
+		"README.txt":                    []byte("plain text"),
+		"README.md":                     []byte("# documented\n"),
+		"docs/README.md":                []byte("# docs"),
+		"node_modules/dep/README.md":    []byte("# bundled dependency"),
+		"node_modules/dep/package.json": []byte(`{"name":"dep","version":"1.0.0"}`),
+	})
+	require.NoError(t, err)
+	readme, err := registry.ExtractReadme(content)
+	require.NoError(t, err)
+	assert.Equal(t, "# documented\n", readme)
+
+	// A README given in package.json takes precedence
+	packageData["readme"] = "# from package.json"
+	content, err = createTestPackageTarballWithFiles(packageData, map[string][]byte{"README.md": []byte("# from file")})
+	require.NoError(t, err)
+	readme, err = registry.ExtractReadme(content)
+	require.NoError(t, err)
+	assert.Equal(t, "# from package.json", readme)
+
+	// Packages without a README have none, even with npm's placeholder
+	packageData["readme"] = "ERROR: No README data found!"
+	content, err = createTestPackageTarballWithFiles(packageData, nil)
+	require.NoError(t, err)
+	readme, err = registry.ExtractReadme(content)
+	require.NoError(t, err)
+	assert.Empty(t, readme)
+}
+
+func TestValidate_CompressionBomb(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+
+	// A package.json padded with 64 MiB of spaces gzips to a few dozen kilobytes
+	packageJSON := append([]byte(`{"name":"test-package","version":"1.0.0"}`), bytes.Repeat([]byte(" "), 64<<20)...)
+	content, err := createTestPackageTarballWithFiles(nil, map[string][]byte{"package.json": packageJSON})
+	require.NoError(t, err)
+	require.Less(t, len(content), 1<<20)
+
+	for _, verify := range []bool{false, true} {
+		registry.SetTarballVerification(verify)
+		err := registry.Validate(&types.Artifact{Name: "test-package", Version: "1.0.0"}, content)
+		assert.ErrorIs(t, err, utils.ErrArchiveTooLarge, "verification %v", verify)
+	}
+}
@@ -21,6 +21,11 @@ type PackageManifest struct {
 	Engines          map[string]string      `json:"engines,omitempty"`          // Engine compatibility
 	PeerDependencies map[string]string      `json:"peerDependencies,omitempty"` // Peer dependencies
 	Deprecated       string                 `json:"deprecated,omitempty"`       // Deprecation message
+	Readme           string                 `json:"readme,omitempty"`           // README content, included by some publishing tools
+
+	OptionalDependencies map[string]string `json:"optionalDependencies,omitempty"` // Optional dependencies
+	BundledDependencies  interface{}       `json:"bundledDependencies,omitempty"`  // Array of names or true for all dependencies
+	BundleDependencies   interface{}       `json:"bundleDependencies,omitempty"`   // Alias of bundledDependencies
 }
 
 // NPMRegistryResponse represents the npm registry API response format
@@ -111,3 +116,22 @@ type NPMSearchResponse struct {
 	Total   int               `json:"total"`
 	Time    string            `json:"time"`
 }
+
+// DependencyAudit compares the dependencies declared in package.json with the
+// packages actually bundled in the tarball's node_modules directory
+type DependencyAudit struct {
+	Status            string               `json:"status"`            // consistent or drift
+	Declared          []string             `json:"declared"`          // names declared as runtime dependencies
+	DeclaredBundled   []string             `json:"declaredBundled"`   // names listed in bundledDependencies
+	Bundled           []string             `json:"bundled"`           // names found in node_modules
+	MissingBundled    []string             `json:"missingBundled"`    // declared as bundled but absent from node_modules
+	UndeclaredBundled []string             `json:"undeclaredBundled"` // present in node_modules but not declared
+	VersionMismatches []DependencyMismatch `json:"versionMismatches"` // bundled versions outside the declared range
+}
+
+// DependencyMismatch describes a bundled dependency whose version does not satisfy its declared range
+type DependencyMismatch struct {
+	Name     string `json:"name"`
+	Declared string `json:"declared"`
+	Bundled  string `json:"bundled"`
+}
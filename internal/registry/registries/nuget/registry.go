@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
@@ -14,6 +15,7 @@ import (
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/internal/storage"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 	"github.com/rs/zerolog/log"
 )
 
@@ -97,11 +99,11 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 		return fmt.Errorf("invalid NuGet package ID format")
 	}
 
-	// Validate NuGet package version (SemVer 2.0)
-	// This is a simplified validation
-	semverRegex := regexp.MustCompile(`^\d+\.\d+\.\d+(-[a-zA-Z0-9\-\.]+)?(\+[a-zA-Z0-9\-\.]+)?$`)
-	if !semverRegex.MatchString(artifact.Version) {
-		return fmt.Errorf("invalid semantic version format")
+	// Validate NuGet package version: SemVer 2.0 plus the legacy two and
+	// four part numeric versions NuGet still accepts (1.0, 1.0.0.0)
+	versionRegex := regexp.MustCompile(`^\d+(\.\d+){1,3}(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+	if !versionRegex.MatchString(artifact.Version) {
+		return fmt.Errorf("invalid NuGet version format")
 	}
 
 	// Check if this is a symbol package based on metadata
@@ -118,6 +120,9 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 	// Try to validate .nupkg zip structure and extract .nuspec, but don't fail on basic validation errors
 	// This allows for testing with fake content while still validating real packages
 	nuspec, err := extractNuspecFromNupkg(content)
+	if errors.Is(err, utils.ErrArchiveTooLarge) {
+		return fmt.Errorf("invalid NuGet package: %w", err)
+	}
 	if err != nil {
 		// If we can't extract .nuspec, it might be test data or corrupted package
 		// Log the warning but don't fail validation for package ID and version checks
@@ -356,11 +361,8 @@ func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
 
 // extractNuspecFromNupkg extracts and parses the .nuspec file from a .nupkg package
 func extractNuspecFromNupkg(nupkgData []byte) (*NuSpec, error) {
-	// Create a bytes reader for the zip content
-	reader := bytes.NewReader(nupkgData)
-
 	// Open the zip archive
-	zipReader, err := zip.NewReader(reader, int64(len(nupkgData)))
+	zipReader, err := utils.NewZipReader(nupkgData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open zip archive: %w", err)
 	}
@@ -369,14 +371,8 @@ func extractNuspecFromNupkg(nupkgData []byte) (*NuSpec, error) {
 	for _, file := range zipReader.File {
 		if strings.HasSuffix(file.Name, ".nuspec") {
 			// Open the .nuspec file
-			rc, err := file.Open()
-			if err != nil {
-				return nil, fmt.Errorf("failed to open .nuspec file: %w", err)
-			}
-			defer rc.Close()
-
 			// Read the .nuspec content
-			nuspecBytes, err := io.ReadAll(rc)
+			nuspecBytes, err := utils.ReadZipFile(file)
 			if err != nil {
 				return nil, fmt.Errorf("failed to read .nuspec content: %w", err)
 			}
@@ -394,6 +390,109 @@ func extractNuspecFromNupkg(nupkgData []byte) (*NuSpec, error) {
 	return nil, fmt.Errorf(".nuspec file not found in package")
 }
 
+// ExtractIcon returns the embedded icon referenced by the .nuspec <icon> element,
+// falling back to a conventional icon file at the package root
+func (r *Registry) ExtractIcon(content []byte) ([]byte, string, error) {
+	zipReader, err := utils.NewZipReader(content)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open zip archive: %w", err)
+	}
+
+	iconPath := ""
+	if nuspec, err := extractNuspecFromNupkg(content); err == nil && nuspec.Metadata.Icon != "" {
+		// The icon path is relative to the package root and may use Windows separators
+		iconPath = strings.TrimPrefix(strings.ReplaceAll(nuspec.Metadata.Icon, "\\", "/"), "/")
+	}
+
+	var conventionFile *zip.File
+	for _, file := range zipReader.File {
+		if iconPath != "" && strings.EqualFold(file.Name, iconPath) {
+			return readIconFile(file)
+		}
+		if conventionFile == nil && utils.IsConventionIconFile(file.Name) {
+			conventionFile = file
+		}
+	}
+
+	if conventionFile != nil {
+		return readIconFile(conventionFile)
+	}
+
+	return nil, "", nil
+}
+
+// readIconFile reads an icon entry from a .nupkg, rejecting oversized icons
+func readIconFile(file *zip.File) ([]byte, string, error) {
+	if file.UncompressedSize64 > utils.MaxIconSize {
+		return nil, "", fmt.Errorf("icon %s exceeds maximum size of %d bytes", file.Name, utils.MaxIconSize)
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open icon file: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, utils.MaxIconSize+1))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read icon file: %w", err)
+	}
+	if len(data) > utils.MaxIconSize {
+		return nil, "", fmt.Errorf("icon %s exceeds maximum size of %d bytes", file.Name, utils.MaxIconSize)
+	}
+
+	return data, file.Name, nil
+}
+
+// ExtractReadme returns the markdown file referenced by the .nuspec <readme>
+// element, falling back to the package description
+func (r *Registry) ExtractReadme(content []byte) (string, error) {
+	nuspec, err := extractNuspecFromNupkg(content)
+	if err != nil {
+		return "", err
+	}
+
+	if nuspec.Metadata.Readme != "" {
+		zipReader, err := utils.NewZipReader(content)
+		if err != nil {
+			return "", fmt.Errorf("failed to open zip archive: %w", err)
+		}
+
+		// The readme path is relative to the package root and may use Windows separators
+		readmePath := strings.TrimPrefix(strings.ReplaceAll(nuspec.Metadata.Readme, "\\", "/"), "/")
+		for _, file := range zipReader.File {
+			if strings.EqualFold(file.Name, readmePath) {
+				return readReadmeFile(file)
+			}
+		}
+	}
+
+	return nuspec.Metadata.Description, nil
+}
+
+// readReadmeFile reads a README entry from a .nupkg, rejecting oversized ones
+func readReadmeFile(file *zip.File) (string, error) {
+	if file.UncompressedSize64 > utils.MaxReadmeSize {
+		return "", fmt.Errorf("readme %s exceeds maximum size of %d bytes", file.Name, utils.MaxReadmeSize)
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open readme file: %w", err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, utils.MaxReadmeSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read readme file: %w", err)
+	}
+	if len(data) > utils.MaxReadmeSize {
+		return "", fmt.Errorf("readme %s exceeds maximum size of %d bytes", file.Name, utils.MaxReadmeSize)
+	}
+
+	return string(data), nil
+}
+
 // GenerateStoragePath creates the storage path for NuGet packages and symbol packages
 func (r *Registry) GenerateStoragePath(name, version string) string {
 	// Regular NuGet packages follow: nuget/name/version/name.version.nupkg
@@ -430,11 +529,8 @@ func (r *Registry) IsSymbolPackage(artifact *types.Artifact) bool {
 
 // validateSymbolPackage validates that a symbol package contains valid debugging symbols
 func (r *Registry) validateSymbolPackage(content []byte, packageName, version string) error {
-	// Create a bytes reader for the zip content
-	reader := bytes.NewReader(content)
-
 	// Open the zip archive
-	zipReader, err := zip.NewReader(reader, int64(len(content)))
+	zipReader, err := utils.NewZipReader(content)
 	if err != nil {
 		return fmt.Errorf("failed to open symbol package zip archive: %w", err)
 	}
@@ -500,11 +596,8 @@ func (r *Registry) GetSymbolMetadata(content []byte) (map[string]interface{}, er
 		"contentType": "application/vnd.nuget.symbolpackage",
 	}
 
-	// Create a bytes reader for the zip content
-	reader := bytes.NewReader(content)
-
 	// Open the zip archive
-	zipReader, err := zip.NewReader(reader, int64(len(content)))
+	zipReader, err := utils.NewZipReader(content)
 	if err != nil {
 		log.Warn().Err(err).Msg("Failed to open symbol package for metadata extraction")
 		return metadata, nil
@@ -546,11 +639,8 @@ func (r *Registry) GetSymbolMetadata(content []byte) (map[string]interface{}, er
 
 // isSymbolPackageContent checks if the content appears to be a symbol package
 func (r *Registry) isSymbolPackageContent(content []byte) bool {
-	// Create a bytes reader for the zip content
-	reader := bytes.NewReader(content)
-
 	// Open the zip archive
-	zipReader, err := zip.NewReader(reader, int64(len(content)))
+	zipReader, err := utils.NewZipReader(content)
 	if err != nil {
 		return false
 	}
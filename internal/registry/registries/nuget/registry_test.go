@@ -8,11 +8,13 @@ import (
 	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 )
 
 // MockStorage implements storage.BlobStorage for testing
@@ -43,6 +45,13 @@ func (m *MockStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser,
 	return nil, io.EOF
 }
 
+func (m *MockStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	if data, exists := m.data[path]; exists && offset < int64(len(data)) {
+		return io.NopCloser(io.NewSectionReader(bytes.NewReader(data), offset, length)), nil
+	}
+	return nil, io.EOF
+}
+
 func (m *MockStorage) Delete(ctx context.Context, path string) error {
 	delete(m.data, path)
 	return nil
@@ -60,6 +69,13 @@ func (m *MockStorage) GetSize(ctx context.Context, path string) (int64, error) {
 	return 0, io.EOF
 }
 
+func (m *MockStorage) GetModTime(ctx context.Context, path string) (time.Time, error) {
+	if _, exists := m.data[path]; exists {
+		return time.Time{}, nil
+	}
+	return time.Time{}, io.EOF
+}
+
 func (m *MockStorage) List(ctx context.Context, prefix string) ([]string, error) {
 	var files []string
 	for path := range m.data {
@@ -210,13 +226,16 @@ func TestValidate_InvalidVersions(t *testing.T) {
 	}{
 		{"empty version", ""},
 		{"single number", "1"},
-		{"two numbers", "1.0"},
 		{"non-numeric", "abc"},
 		{"missing patch", "1.0."},
 		{"negative numbers", "-1.0.0"},
 		{"leading v", "v1.0.0"},
 		{"spaces", "1.0.0 "},
-		{"too many dots", "1.0.0.0"},
+		{"too many parts", "1.0.0.0.0"},
+		{"empty prerelease", "1.0.0-"},
+		{"empty prerelease identifier", "1.0.0-beta..1"},
+		{"empty metadata", "1.0.0+"},
+		{"invalid prerelease characters", "1.0.0-beta_1"},
 	}
 
 	for _, tt := range tests {
@@ -231,7 +250,7 @@ func TestValidate_InvalidVersions(t *testing.T) {
 			err := registry.Validate(artifact, content)
 
 			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "invalid semantic version format")
+			assert.Contains(t, err.Error(), "invalid NuGet version format")
 		})
 	}
 }
@@ -250,6 +269,15 @@ func TestValidate_ValidVersions(t *testing.T) {
 		"1.0.0+build.123",
 		"1.0.0-alpha+build.123",
 		"2.0.0-rc.1+build.456",
+		// Legacy versions NuGet still accepts and normalizes
+		"1.0",
+		"4.5.0.0",
+		"1.2.3.4-beta",
+		// Real-world versions
+		"13.0.3",
+		"8.0.0-preview.7.23375.6",
+		"6.0.0-rtm.21522.10",
+		"2.2.0-beta1",
 	}
 
 	for _, version := range validVersions {
@@ -598,6 +626,47 @@ func TestGetMetadataWithSymbolPackage(t *testing.T) {
 	assert.NotEqual(t, "SymbolsPackage", metadata["packageType"])
 }
 
+func TestExtractIcon_EmbeddedIcon(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+
+	iconData := []byte("\x89PNG\r\n\x1a\nmock icon")
+	content := createMockNuGetPackageWithFiles(t, "TestPackage", "1.0.0", `<icon>images\icon.png</icon>`, map[string][]byte{
+		"images/icon.png": iconData,
+		"logo.png":        []byte("convention logo"),
+	})
+
+	data, filename, err := registry.ExtractIcon(content)
+
+	assert.NoError(t, err)
+	assert.Equal(t, iconData, data)
+	assert.Equal(t, "images/icon.png", filename)
+}
+
+func TestExtractIcon_ConventionFile(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+
+	content := createMockNuGetPackageWithFiles(t, "TestPackage", "1.0.0", "", map[string][]byte{
+		"logo.svg": []byte("<svg></svg>"),
+		"logo.png": []byte("\x89PNG\r\n\x1a\nconvention logo"),
+	})
+
+	data, filename, err := registry.ExtractIcon(content)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\nconvention logo"), data)
+	assert.Equal(t, "logo.png", filename)
+}
+
+func TestExtractIcon_NoIcon(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+
+	data, filename, err := registry.ExtractIcon(createMockNuGetPackage(t, "TestPackage", "1.0.0"))
+
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	assert.Empty(t, filename)
+}
+
 // Helper functions for testing
 
 func createMockSymbolPackage(t *testing.T, files []string) []byte {
@@ -656,3 +725,53 @@ func createMockNuGetPackage(t *testing.T, name, version string) []byte {
 
 	return buf.Bytes()
 }
+
+func createMockNuGetPackageWithFiles(t *testing.T, name, version, extraMetadata string, files map[string][]byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	nuspecContent := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd">
+  <metadata>
+    <id>%s</id>
+    <version>%s</version>
+    <authors>Test Author</authors>
+    <description>Test package description</description>
+    %s
+  </metadata>
+</package>`, name, version, extraMetadata)
+
+	nuspecFile, err := w.Create(name + ".nuspec")
+	assert.NoError(t, err)
+	nuspecFile.Write([]byte(nuspecContent))
+
+	for filename, data := range files {
+		file, err := w.Create(filename)
+		assert.NoError(t, err)
+		file.Write(data)
+	}
+
+	err = w.Close()
+	assert.NoError(t, err)
+
+	return buf.Bytes()
+}
+
+func TestValidate_CompressionBomb(t *testing.T) {
+	registry, _, _ := setupTestRegistry(t)
+
+	// A .nuspec padded with 64 MiB of spaces deflates to a few dozen kilobytes
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	nuspecFile, err := w.Create("TestPackage.nuspec")
+	assert.NoError(t, err)
+	_, err = nuspecFile.Write(append([]byte(`<?xml version="1.0" encoding="utf-8"?>`), bytes.Repeat([]byte(" "), 64<<20)...))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Less(t, buf.Len(), 1<<20)
+
+	err = registry.Validate(&types.Artifact{Name: "TestPackage", Version: "1.0.0"}, buf.Bytes())
+	assert.ErrorIs(t, err, utils.ErrArchiveTooLarge)
+}
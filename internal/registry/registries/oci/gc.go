@@ -0,0 +1,368 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultGCGracePeriod is how long a blob is kept after it was uploaded or
+// mounted, whether or not a manifest refers to it yet
+const DefaultGCGracePeriod = time.Hour
+
+// GCOptions controls a garbage collection run
+type GCOptions struct {
+	// GracePeriod keeps blobs uploaded or mounted more recently than this, so
+	// the blobs of a push survive until the manifest referring to them is
+	// pushed. Pushes to other API gateway instances are only protected by
+	// the grace period.
+	GracePeriod time.Duration `json:"grace_period"`
+
+	// DeleteUntagged also removes manifests that no tag refers to, directly,
+	// as a child of an image index, or as the subject of a referrer, such as
+	// the images of a multi-platform index whose tag was deleted
+	DeleteUntagged bool `json:"delete_untagged"`
+
+	// DryRun reports what would be removed without removing anything
+	DryRun bool `json:"dry_run"`
+}
+
+// GCResult reports what a garbage collection run removed, or would remove
+// in a dry run
+type GCResult struct {
+	DryRun           bool     `json:"dry_run"`
+	ManifestsScanned int      `json:"manifests_scanned"`
+	BlobsScanned     int      `json:"blobs_scanned"`
+	DeletedManifests []string `json:"deleted_manifests"` // repository@digest
+	DeletedBlobs     []string `json:"deleted_blobs"`     // repository@digest
+	FreedBytes       int64    `json:"freed_bytes"`
+}
+
+// gcManifest is the part of a manifest naming the blobs and manifests it
+// refers to
+type gcManifest struct {
+	Config *struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Layers []struct {
+		Digest string `json:"digest"`
+	} `json:"layers"`
+	Blobs []struct {
+		Digest string `json:"digest"`
+	} `json:"blobs"`
+	Manifests []struct {
+		Digest string `json:"digest"`
+	} `json:"manifests"`
+	Subject *struct {
+		Digest string `json:"digest"`
+	} `json:"subject"`
+}
+
+// gcRepository is a repository's stored manifests, by digest, and its tags
+type gcRepository struct {
+	manifests map[string]*gcManifest
+	tagged    map[string]bool
+	blobs     []string
+}
+
+// GarbageCollect removes blobs that no manifest refers to, and, if
+// DeleteUntagged is set, manifests that no tag refers to. It marks every blob
+// reachable from the manifests kept, including the images of image indexes
+// and blobs mounted from other repositories, then sweeps the rest. Pushes to
+// this registry wait for the run to finish.
+func (r *Registry) GarbageCollect(ctx context.Context, opts GCOptions) (*GCResult, error) {
+	r.gcMu.Lock()
+	defer r.gcMu.Unlock()
+
+	start := time.Now()
+	r.forgetPushedBlobs(start.Add(-max(opts.GracePeriod, DefaultGCGracePeriod)))
+	repositories, err := r.loadGCRepositories(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &GCResult{DryRun: opts.DryRun, DeletedManifests: []string{}, DeletedBlobs: []string{}}
+	reachable := make(map[string]map[string]bool, len(repositories))
+	for name, repository := range repositories {
+		result.ManifestsScanned += len(repository.manifests)
+		result.BlobsScanned += len(repository.blobs)
+		reachable[name] = markManifests(repository, opts.DeleteUntagged)
+	}
+
+	// Mark the blobs of every manifest kept, where they are stored
+	marked := make(map[string]bool)
+	for name, repository := range repositories {
+		for digest := range reachable[name] {
+			for _, blob := range repository.manifests[digest].blobDigests() {
+				storagePath, err := r.BlobStoragePath(ctx, name, blob)
+				if err != nil {
+					return nil, fmt.Errorf("failed to locate blob %s@%s: %w", name, blob, err)
+				}
+				marked[storagePath] = true
+			}
+		}
+	}
+
+	for name, repository := range repositories {
+		for digest := range repository.manifests {
+			if reachable[name][digest] {
+				continue
+			}
+			result.DeletedManifests = append(result.DeletedManifests, name+"@"+digest)
+			if !opts.DryRun {
+				if err := r.deleteUntaggedManifest(ctx, name, digest, repository.manifests[digest]); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, digest := range repository.blobs {
+			storagePath := fmt.Sprintf("oci/%s/blobs/%s", name, digest)
+			if marked[storagePath] {
+				continue
+			}
+			recent, err := r.blobRecordedSince(ctx, storagePath, start.Add(-opts.GracePeriod))
+			if err != nil {
+				return nil, err
+			}
+			if recent {
+				continue
+			}
+
+			size, _ := r.storage.GetSize(ctx, storagePath)
+			result.DeletedBlobs = append(result.DeletedBlobs, name+"@"+digest)
+			result.FreedBytes += size
+			if !opts.DryRun {
+				if err := r.deleteOrphanedBlob(ctx, storagePath); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	log.Info().
+		Bool("dry_run", opts.DryRun).
+		Int("manifests_scanned", result.ManifestsScanned).
+		Int("blobs_scanned", result.BlobsScanned).
+		Int("deleted_manifests", len(result.DeletedManifests)).
+		Int("deleted_blobs", len(result.DeletedBlobs)).
+		Int64("freed_bytes", result.FreedBytes).
+		Dur("duration", time.Since(start)).
+		Msg("OCI garbage collection completed")
+	return result, nil
+}
+
+// loadGCRepositories reads every repository's manifests and lists its blobs
+func (r *Registry) loadGCRepositories(ctx context.Context) (map[string]*gcRepository, error) {
+	paths, err := r.storage.List(ctx, "oci/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list registry storage: %w", err)
+	}
+
+	repositories := make(map[string]*gcRepository)
+	repository := func(name string) *gcRepository {
+		if repositories[name] == nil {
+			repositories[name] = &gcRepository{manifests: make(map[string]*gcManifest), tagged: make(map[string]bool)}
+		}
+		return repositories[name]
+	}
+
+	for _, storagePath := range paths {
+		// Repository names may contain "/", but references and digests never do
+		if name, digest, ok := splitRepositoryPath(storagePath, "/blobs/"); ok {
+			repository(name).blobs = append(repository(name).blobs, digest)
+			continue
+		}
+		name, reference, ok := splitRepositoryPath(storagePath, "/manifests/")
+		if !ok {
+			continue
+		}
+
+		content, err := r.readStoredManifest(ctx, storagePath)
+		if err != nil {
+			return nil, err
+		}
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+		var manifest gcManifest
+		if err := json.Unmarshal(content, &manifest); err != nil {
+			// Keep what cannot be parsed, rather than guess what it refers to
+			log.Warn().Err(err).Str("path", storagePath).Msg("Skipping unparseable manifest in garbage collection")
+			manifest = gcManifest{}
+		}
+		repository(name).manifests[digest] = &manifest
+		if !strings.HasPrefix(reference, "sha256:") {
+			repository(name).tagged[digest] = true
+		}
+	}
+	return repositories, nil
+}
+
+// splitRepositoryPath splits a storage path of the form
+// oci/<repository><separator><leaf> into the repository and leaf
+func splitRepositoryPath(storagePath, separator string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(storagePath, "oci/")
+	if !ok {
+		return "", "", false
+	}
+	i := strings.LastIndex(rest, separator)
+	if i <= 0 {
+		return "", "", false
+	}
+	leaf := rest[i+len(separator):]
+	if leaf == "" || strings.Contains(leaf, "/") {
+		return "", "", false
+	}
+	return rest[:i], leaf, true
+}
+
+// readStoredManifest returns the content of the manifest at a storage path
+func (r *Registry) readStoredManifest(ctx context.Context, storagePath string) ([]byte, error) {
+	reader, err := r.storage.Retrieve(ctx, storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", storagePath, err)
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// markManifests returns the digests of a repository's manifests to keep:
+// every manifest, or, when untagged manifests are deleted, the tagged ones,
+// the images of the indexes kept and the referrers of the manifests kept
+func markManifests(repository *gcRepository, deleteUntagged bool) map[string]bool {
+	reachable := make(map[string]bool, len(repository.manifests))
+	if !deleteUntagged {
+		for digest := range repository.manifests {
+			reachable[digest] = true
+		}
+		return reachable
+	}
+
+	var queue []string
+	mark := func(digest string) {
+		if _, stored := repository.manifests[digest]; stored && !reachable[digest] {
+			reachable[digest] = true
+			queue = append(queue, digest)
+		}
+	}
+	for digest := range repository.tagged {
+		mark(digest)
+	}
+	for len(queue) > 0 {
+		for len(queue) > 0 {
+			digest := queue[0]
+			queue = queue[1:]
+			for _, child := range repository.manifests[digest].Manifests {
+				mark(child.Digest)
+			}
+		}
+		// Referrers are kept with their subject, and may themselves be indexes
+		for digest, manifest := range repository.manifests {
+			if manifest.Subject != nil && reachable[manifest.Subject.Digest] {
+				mark(digest)
+			}
+		}
+	}
+	return reachable
+}
+
+// blobDigests returns the digests of the blobs a manifest refers to
+func (m *gcManifest) blobDigests() []string {
+	var digests []string
+	if m.Config != nil && m.Config.Digest != "" {
+		digests = append(digests, m.Config.Digest)
+	}
+	for _, layer := range m.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	for _, blob := range m.Blobs {
+		digests = append(digests, blob.Digest)
+	}
+	return digests
+}
+
+// recordPushedBlob notes that a blob was just written to storage
+func (r *Registry) recordPushedBlob(storagePath string) {
+	r.pushedMu.Lock()
+	defer r.pushedMu.Unlock()
+	if r.pushedBlobs == nil {
+		r.pushedBlobs = make(map[string]time.Time)
+	}
+	r.pushedBlobs[storagePath] = time.Now()
+}
+
+// forgetPushedBlobs drops the push times of blobs pushed before the given
+// time, which the records of the blobs cover
+func (r *Registry) forgetPushedBlobs(before time.Time) {
+	r.pushedMu.Lock()
+	defer r.pushedMu.Unlock()
+	for storagePath, pushedAt := range r.pushedBlobs {
+		if pushedAt.Before(before) {
+			delete(r.pushedBlobs, storagePath)
+		}
+	}
+}
+
+// blobRecordedSince reports whether a blob was pushed to this process, or
+// uploaded to or mounted in any repository, since the given time
+func (r *Registry) blobRecordedSince(ctx context.Context, storagePath string, since time.Time) (bool, error) {
+	r.pushedMu.Lock()
+	pushedAt, pushed := r.pushedBlobs[storagePath]
+	r.pushedMu.Unlock()
+	if pushed && pushedAt.After(since) {
+		return true, nil
+	}
+
+	if r.db == nil || r.db.DB == nil {
+		return false, nil
+	}
+	var count int64
+	if err := r.db.WithContext(ctx).
+		Model(&types.Artifact{}).
+		Where("registry = ? AND storage_path = ? AND created_at > ?", "oci", storagePath, since).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check blob age: %w", err)
+	}
+	return count > 0, nil
+}
+
+// deleteUntaggedManifest removes a manifest stored only by digest, with its
+// entry in the referrers index of its subject
+func (r *Registry) deleteUntaggedManifest(ctx context.Context, repository, digest string, manifest *gcManifest) error {
+	if err := r.storage.Delete(ctx, fmt.Sprintf("oci/%s/manifests/%s", repository, digest)); err != nil {
+		return fmt.Errorf("failed to delete manifest %s@%s: %w", repository, digest, err)
+	}
+	if manifest.Subject != nil && manifest.Subject.Digest != "" {
+		r.storage.Delete(ctx, referrerPath(repository, manifest.Subject.Digest, digest))
+	}
+	if r.db != nil && r.db.DB != nil {
+		if err := r.db.WithContext(ctx).
+			Where("registry = ? AND name = ? AND version = ?", "oci", repository, digest).
+			Delete(&types.Artifact{}).Error; err != nil {
+			return fmt.Errorf("failed to delete manifest record %s@%s: %w", repository, digest, err)
+		}
+	}
+	return nil
+}
+
+// deleteOrphanedBlob removes a blob from storage along with the records of
+// every repository it was uploaded to or mounted in
+func (r *Registry) deleteOrphanedBlob(ctx context.Context, storagePath string) error {
+	if err := r.storage.Delete(ctx, storagePath); err != nil {
+		return fmt.Errorf("failed to delete blob %s: %w", storagePath, err)
+	}
+	if r.db != nil && r.db.DB != nil {
+		if err := r.db.WithContext(ctx).
+			Where("registry = ? AND storage_path = ?", "oci", storagePath).
+			Delete(&types.Artifact{}).Error; err != nil {
+			return fmt.Errorf("failed to delete blob records %s: %w", storagePath, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGarbageCollect(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t)
+	const repository = "myorg/app"
+
+	pushBlob := func(content string) string {
+		digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+		_, _, err := r.PutBlob(ctx, repository, digest, strings.NewReader(content))
+		require.NoError(t, err)
+		return digest
+	}
+	pushImage := func(reference, config string, layers ...string) string {
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"digest":%q},"layers":[`, testManifestType, config)
+		for i, layer := range layers {
+			if i > 0 {
+				manifest += ","
+			}
+			manifest += fmt.Sprintf(`{"digest":%q}`, layer)
+		}
+		manifest += "]}"
+		if reference == "" {
+			reference = fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+		}
+		digest, err := r.PutManifest(ctx, repository, reference, strings.NewReader(manifest), testManifestType)
+		require.NoError(t, err)
+		return digest
+	}
+	blobExists := func(digest string) bool {
+		exists, _, err := r.BlobExists(ctx, repository, digest)
+		require.NoError(t, err)
+		return exists
+	}
+
+	shared := pushBlob("shared base layer")
+	keptConfig, keptLayer := pushBlob("kept config"), pushBlob("kept layer")
+	orphanConfig, orphanLayer := pushBlob("orphan config"), pushBlob("orphan layer")
+	pushImage("kept", keptConfig, shared, keptLayer)
+	pushImage("orphan", orphanConfig, shared, orphanLayer)
+
+	amd64Config, amd64Layer := pushBlob("amd64 config"), pushBlob("amd64 layer")
+	arm64Config := pushBlob("arm64 config")
+	amd64 := pushImage("", amd64Config, amd64Layer)
+	arm64 := pushImage("", arm64Config, shared)
+	_, err := r.PutManifest(ctx, repository, "multi", strings.NewReader(twoArchIndex(t, ImageIndexMediaType, amd64, arm64, 100)), ImageIndexMediaType)
+	require.NoError(t, err)
+
+	t.Run("keeps blobs pushed within the grace period", func(t *testing.T) {
+		require.NoError(t, r.DeleteManifest(ctx, repository, "orphan"))
+
+		result, err := r.GarbageCollect(ctx, GCOptions{GracePeriod: time.Hour})
+		require.NoError(t, err)
+		assert.Empty(t, result.DeletedBlobs)
+		assert.True(t, blobExists(orphanLayer))
+	})
+
+	t.Run("dry run removes nothing", func(t *testing.T) {
+		result, err := r.GarbageCollect(ctx, GCOptions{DryRun: true})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{repository + "@" + orphanConfig, repository + "@" + orphanLayer}, result.DeletedBlobs)
+		assert.Positive(t, result.FreedBytes)
+		assert.True(t, blobExists(orphanConfig))
+		assert.True(t, blobExists(orphanLayer))
+	})
+
+	t.Run("removes only orphaned blobs", func(t *testing.T) {
+		result, err := r.GarbageCollect(ctx, GCOptions{})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{repository + "@" + orphanConfig, repository + "@" + orphanLayer}, result.DeletedBlobs)
+		assert.Empty(t, result.DeletedManifests)
+		assert.Equal(t, int64(len("orphan config")+len("orphan layer")), result.FreedBytes)
+
+		assert.False(t, blobExists(orphanConfig))
+		assert.False(t, blobExists(orphanLayer))
+		for _, digest := range []string{shared, keptConfig, keptLayer, amd64Config, amd64Layer, arm64Config} {
+			assert.True(t, blobExists(digest), digest)
+		}
+	})
+
+	t.Run("keeps the images of a tagged index when deleting untagged manifests", func(t *testing.T) {
+		result, err := r.GarbageCollect(ctx, GCOptions{DeleteUntagged: true})
+		require.NoError(t, err)
+		assert.Empty(t, result.DeletedManifests)
+		assert.Empty(t, result.DeletedBlobs)
+	})
+
+	t.Run("removes the images of a deleted index when deleting untagged manifests", func(t *testing.T) {
+		require.NoError(t, r.DeleteManifest(ctx, repository, "multi"))
+
+		// Without DeleteUntagged the images are kept, as they can still be
+		// pulled by digest
+		result, err := r.GarbageCollect(ctx, GCOptions{})
+		require.NoError(t, err)
+		assert.Empty(t, result.DeletedBlobs)
+
+		result, err = r.GarbageCollect(ctx, GCOptions{DeleteUntagged: true})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{repository + "@" + amd64, repository + "@" + arm64}, result.DeletedManifests)
+		assert.ElementsMatch(t, []string{repository + "@" + amd64Config, repository + "@" + amd64Layer, repository + "@" + arm64Config}, result.DeletedBlobs)
+
+		exists, _, _, _, err := r.ManifestExists(ctx, repository, amd64)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		for _, digest := range []string{shared, keptConfig, keptLayer} {
+			assert.True(t, blobExists(digest), digest)
+		}
+	})
+}
+
+func TestSplitRepositoryPath(t *testing.T) {
+	name, leaf, ok := splitRepositoryPath("oci/myorg/team/app/blobs/sha256:abc", "/blobs/")
+	assert.True(t, ok)
+	assert.Equal(t, "myorg/team/app", name)
+	assert.Equal(t, "sha256:abc", leaf)
+
+	_, _, ok = splitRepositoryPath("oci/myorg/app/referrers/sha256:abc/sha256:def", "/manifests/")
+	assert.False(t, ok)
+	_, _, ok = splitRepositoryPath("temp/uploads/myorg/app/blobs/x", "/blobs/")
+	assert.False(t, ok)
+}
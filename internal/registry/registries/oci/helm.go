@@ -0,0 +1,69 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Media types of Helm charts pushed as OCI artifacts with helm push
+const (
+	HelmConfigMediaType     = "application/vnd.cncf.helm.config.v1+json"
+	HelmChartMediaType      = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	HelmProvenanceMediaType = "application/vnd.cncf.helm.chart.provenance.v1.prov"
+)
+
+// HelmChartLayers are the layers of a Helm chart manifest
+type HelmChartLayers struct {
+	Chart      Descriptor  // the packaged chart
+	Provenance *Descriptor // the chart's provenance file, if pushed with one
+}
+
+// HelmChart returns the layers of a manifest holding a Helm chart, which is
+// recognized by its config media type. It returns false for other manifests
+// and for chart manifests without a chart layer.
+func HelmChart(manifest []byte) (*HelmChartLayers, bool) {
+	var parsed struct {
+		Config struct {
+			MediaType string `json:"mediaType"`
+		} `json:"config"`
+		Layers []Descriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(manifest, &parsed); err != nil || parsed.Config.MediaType != HelmConfigMediaType {
+		return nil, false
+	}
+
+	var layers HelmChartLayers
+	found := false
+	for i, layer := range parsed.Layers {
+		switch layer.MediaType {
+		case HelmChartMediaType:
+			layers.Chart = layer
+			found = true
+		case HelmProvenanceMediaType:
+			layers.Provenance = &parsed.Layers[i]
+		}
+	}
+	if !found || !digestGrammarRegex.MatchString(layers.Chart.Digest) {
+		return nil, false
+	}
+	return &layers, true
+}
+
+// verifyHelmChart checks that a manifest with a Helm chart config has a
+// chart layer, since charts pushed with helm push are served from it to helm
+// repo clients too. Other manifests are not checked.
+func verifyHelmChart(manifest []byte) error {
+	var parsed struct {
+		Config struct {
+			MediaType string `json:"mediaType"`
+		} `json:"config"`
+	}
+	if err := json.Unmarshal(manifest, &parsed); err != nil || parsed.Config.MediaType != HelmConfigMediaType {
+		return nil
+	}
+
+	if _, ok := HelmChart(manifest); !ok {
+		return fmt.Errorf("%w: helm chart manifest has no %s layer", ErrManifestInvalid, HelmChartMediaType)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package oci
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelmChart(t *testing.T) {
+	chartDigest := "sha256:" + strings.Repeat("a", 64)
+	provDigest := "sha256:" + strings.Repeat("b", 64)
+
+	layers, ok := HelmChart([]byte(`{"schemaVersion":2,"config":{"mediaType":"` + HelmConfigMediaType + `"},"layers":[` +
+		`{"mediaType":"` + HelmChartMediaType + `","digest":"` + chartDigest + `"},` +
+		`{"mediaType":"` + HelmProvenanceMediaType + `","digest":"` + provDigest + `"}]}`))
+	require.True(t, ok)
+	assert.Equal(t, chartDigest, layers.Chart.Digest)
+	require.NotNil(t, layers.Provenance)
+	assert.Equal(t, provDigest, layers.Provenance.Digest)
+
+	for name, manifest := range map[string]string{
+		"image":            `{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json"},"layers":[{"mediaType":"` + HelmChartMediaType + `","digest":"` + chartDigest + `"}]}`,
+		"no chart layer":   `{"schemaVersion":2,"config":{"mediaType":"` + HelmConfigMediaType + `"},"layers":[]}`,
+		"invalid digest":   `{"schemaVersion":2,"config":{"mediaType":"` + HelmConfigMediaType + `"},"layers":[{"mediaType":"` + HelmChartMediaType + `","digest":"chart.tgz"}]}`,
+		"invalid manifest": `{"config":`,
+	} {
+		_, ok := HelmChart([]byte(manifest))
+		assert.False(t, ok, name)
+	}
+}
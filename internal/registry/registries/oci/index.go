@@ -0,0 +1,153 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Manifest media types other than the image index
+const (
+	DockerManifestMediaType     = "application/vnd.docker.distribution.manifest.v2+json"
+	DockerManifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+	ImageManifestMediaType      = "application/vnd.oci.image.manifest.v1+json"
+)
+
+// digestGrammarRegex matches the OCI digest grammar, algorithm:encoded
+var digestGrammarRegex = regexp.MustCompile(`^[a-z0-9]+(?:[+._-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+
+// ErrManifestInvalid is returned when a pushed manifest cannot be parsed
+var ErrManifestInvalid = errors.New("invalid manifest")
+
+// ErrManifestBlobUnknown is returned when an image index refers to a manifest,
+// or an image manifest to a config or layer, that has not been pushed to the
+// repository
+var ErrManifestBlobUnknown = errors.New("manifest unknown to repository")
+
+// ErrManifestDigestMismatch is returned when a manifest is pushed by digest
+// and its content has a different digest
+var ErrManifestDigestMismatch = errors.New("manifest digest does not match reference")
+
+// Platform describes the platform an image in an image index runs on
+type Platform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+}
+
+// IsIndexMediaType reports whether a media type is that of a manifest
+// referring to other manifests: an OCI image index or a Docker manifest list
+func IsIndexMediaType(mediaType string) bool {
+	return mediaType == ImageIndexMediaType || mediaType == DockerManifestListMediaType
+}
+
+// ManifestMediaType returns the media type a manifest declares. Manifests
+// without a mediaType field are OCI image indexes if they list manifests and
+// Docker image manifests otherwise.
+func ManifestMediaType(manifest []byte) string {
+	var parsed struct {
+		MediaType string          `json:"mediaType"`
+		Manifests json.RawMessage `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifest, &parsed); err != nil {
+		return DockerManifestMediaType
+	}
+	if parsed.MediaType != "" {
+		return parsed.MediaType
+	}
+	if parsed.Manifests != nil {
+		return ImageIndexMediaType
+	}
+	return DockerManifestMediaType
+}
+
+// ParseImageIndex reads an image index or manifest list
+func ParseImageIndex(manifest []byte) (*ImageIndex, error) {
+	var index ImageIndex
+	if err := json.Unmarshal(manifest, &index); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrManifestInvalid, err)
+	}
+	for _, descriptor := range index.Manifests {
+		if !digestGrammarRegex.MatchString(descriptor.Digest) {
+			return nil, fmt.Errorf("%w: manifest digest %q is invalid", ErrManifestInvalid, descriptor.Digest)
+		}
+	}
+	return &index, nil
+}
+
+// verifyIndexManifests checks that every manifest an image index refers to
+// has been pushed to the repository. Clients push the images of an index
+// before the index itself.
+func (r *Registry) verifyIndexManifests(ctx context.Context, repository string, index *ImageIndex) error {
+	for _, descriptor := range index.Manifests {
+		exists, _, _, _, err := r.ManifestExists(ctx, repository, descriptor.Digest)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrManifestBlobUnknown, descriptor.Digest)
+		}
+	}
+	return nil
+}
+
+// verifyManifestBlobs checks that the config and layers an image manifest
+// refers to have been pushed to the repository. Layers with URLs are foreign
+// and are fetched from elsewhere, so they need not be.
+func (r *Registry) verifyManifestBlobs(ctx context.Context, repository string, manifest []byte) error {
+	var parsed blobManifest
+	if err := json.Unmarshal(manifest, &parsed); err != nil {
+		return fmt.Errorf("%w: %v", ErrManifestInvalid, err)
+	}
+
+	descriptors := parsed.Layers
+	if parsed.Config != nil {
+		descriptors = append([]Descriptor{*parsed.Config}, descriptors...)
+	}
+	for _, descriptor := range descriptors {
+		if len(descriptor.URLs) > 0 {
+			continue
+		}
+		if !digestGrammarRegex.MatchString(descriptor.Digest) {
+			return fmt.Errorf("%w: blob digest %q is invalid", ErrManifestInvalid, descriptor.Digest)
+		}
+		exists, _, err := r.BlobExists(ctx, repository, descriptor.Digest)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrManifestBlobUnknown, descriptor.Digest)
+		}
+	}
+	return nil
+}
+
+// DefaultPlatform is the platform whose image is served in place of an image
+// index to clients that do not accept indexes
+var DefaultPlatform = Platform{Architecture: "amd64", OS: "linux"}
+
+// SelectManifest returns the manifest of the index for clients that only
+// accept some manifest media types: the image for DefaultPlatform if its
+// media type is accepted, otherwise the first accepted manifest. It returns
+// nil when the index lists no accepted manifest.
+func (index *ImageIndex) SelectManifest(accepts func(mediaType string) bool) *Descriptor {
+	var selected *Descriptor
+	for i := range index.Manifests {
+		descriptor := &index.Manifests[i]
+		if !accepts(descriptor.MediaType) {
+			continue
+		}
+		platform := descriptor.Platform
+		if platform != nil && platform.OS == DefaultPlatform.OS && platform.Architecture == DefaultPlatform.Architecture {
+			return descriptor
+		}
+		if selected == nil {
+			selected = descriptor
+		}
+	}
+	return selected
+}
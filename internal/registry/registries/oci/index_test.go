@@ -0,0 +1,187 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// twoArchIndex returns an image index of an image for amd64 and arm64
+func twoArchIndex(t *testing.T, mediaType, amd64, arm64 string, size int64) string {
+	t.Helper()
+	index := ImageIndex{
+		SchemaVersion: 2,
+		MediaType:     mediaType,
+		Manifests: []Descriptor{
+			{MediaType: testManifestType, Digest: amd64, Size: size, Platform: &Platform{Architecture: "amd64", OS: "linux"}},
+			{MediaType: testManifestType, Digest: arm64, Size: size, Platform: &Platform{Architecture: "arm64", OS: "linux", Variant: "v8"}},
+		},
+	}
+	data, err := json.Marshal(index)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestPutManifest_ImageIndex(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t)
+
+	amd64Manifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + pushTestBlob(t, r, "myorg/app", "amd64 config") + `"}}`
+	arm64Manifest := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"digest":"` + pushTestBlob(t, r, "myorg/app", "arm64 config") + `"}}`
+	pushImage := func(manifest string) string {
+		digest, err := r.PutManifest(ctx, "myorg/app", fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest))), strings.NewReader(manifest), testManifestType)
+		require.NoError(t, err)
+		return digest
+	}
+
+	// Images are pushed by digest, then the index referring to them by tag
+	amd64 := pushImage(amd64Manifest)
+	arm64Digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(arm64Manifest)))
+	index := twoArchIndex(t, ImageIndexMediaType, amd64, arm64Digest, int64(len(amd64Manifest)))
+
+	t.Run("rejected until every image is pushed", func(t *testing.T) {
+		_, err := r.PutManifest(ctx, "myorg/app", "v1", strings.NewReader(index), ImageIndexMediaType)
+		assert.ErrorIs(t, err, ErrManifestBlobUnknown)
+		assert.Contains(t, err.Error(), arm64Digest)
+
+		exists, _, _, _, err := r.ManifestExists(ctx, "myorg/app", "v1")
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	arm64 := pushImage(arm64Manifest)
+	require.Equal(t, arm64Digest, arm64)
+	index = twoArchIndex(t, ImageIndexMediaType, amd64, arm64, int64(len(amd64Manifest)))
+
+	digest, err := r.PutManifest(ctx, "myorg/app", "v1", strings.NewReader(index), ImageIndexMediaType)
+	require.NoError(t, err)
+
+	t.Run("pulled by tag and digest as the index", func(t *testing.T) {
+		for _, reference := range []string{"v1", digest} {
+			exists, existingDigest, size, mediaType, err := r.ManifestExists(ctx, "myorg/app", reference)
+			require.NoError(t, err)
+			assert.True(t, exists)
+			assert.Equal(t, digest, existingDigest)
+			assert.Equal(t, int64(len(index)), size)
+			assert.Equal(t, ImageIndexMediaType, mediaType)
+
+			reader, gotDigest, _, err := r.GetManifest(ctx, "myorg/app", reference)
+			require.NoError(t, err)
+			content, err := io.ReadAll(reader)
+			reader.Close()
+			require.NoError(t, err)
+			assert.Equal(t, digest, gotDigest)
+			assert.Equal(t, index, string(content))
+		}
+	})
+
+	t.Run("images stay addressable by digest", func(t *testing.T) {
+		parsed, err := ParseImageIndex([]byte(index))
+		require.NoError(t, err)
+		require.Len(t, parsed.Manifests, 2)
+		assert.Equal(t, "arm64", parsed.Manifests[1].Platform.Architecture)
+
+		_, _, _, mediaType, err := r.ManifestExists(ctx, "myorg/app", parsed.Manifests[1].Digest)
+		require.NoError(t, err)
+		assert.Equal(t, testManifestType, mediaType)
+	})
+
+	t.Run("docker manifest list", func(t *testing.T) {
+		list := twoArchIndex(t, DockerManifestListMediaType, amd64, arm64, int64(len(amd64Manifest)))
+		_, err := r.PutManifest(ctx, "myorg/app", "v1-docker", strings.NewReader(list), DockerManifestListMediaType)
+		require.NoError(t, err)
+
+		_, _, _, mediaType, err := r.ManifestExists(ctx, "myorg/app", "v1-docker")
+		require.NoError(t, err)
+		assert.Equal(t, DockerManifestListMediaType, mediaType)
+	})
+
+	t.Run("invalid indexes", func(t *testing.T) {
+		_, err := r.PutManifest(ctx, "myorg/app", "bad", strings.NewReader(`{"manifests":`), ImageIndexMediaType)
+		assert.ErrorIs(t, err, ErrManifestInvalid)
+
+		_, err = r.PutManifest(ctx, "myorg/app", "bad", strings.NewReader(`{"manifests":[{"digest":"../../v1"}]}`), ImageIndexMediaType)
+		assert.ErrorIs(t, err, ErrManifestInvalid)
+	})
+}
+
+func TestPutManifest_Verified(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t)
+
+	config := pushTestBlob(t, r, "myorg/app", "config")
+	layer := pushTestBlob(t, r, "myorg/app", "layer")
+	missing := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("never pushed")))
+	image := func(layers ...string) string {
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"digest":%q},"layers":[`, testManifestType, config)
+		for i, layer := range layers {
+			if i > 0 {
+				manifest += ","
+			}
+			manifest += fmt.Sprintf(`{"digest":%q}`, layer)
+		}
+		return manifest + "]}"
+	}
+
+	t.Run("pushed by its own digest", func(t *testing.T) {
+		manifest := image(layer)
+		reference := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(manifest)))
+		digest, err := r.PutManifest(ctx, "myorg/app", reference, strings.NewReader(manifest), testManifestType)
+		require.NoError(t, err)
+		assert.Equal(t, reference, digest)
+	})
+
+	t.Run("rejected by another digest", func(t *testing.T) {
+		reference := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(image())))
+		_, err := r.PutManifest(ctx, "myorg/app", reference, strings.NewReader(image(layer)), testManifestType)
+		assert.ErrorIs(t, err, ErrManifestDigestMismatch)
+
+		exists, _, _, _, err := r.ManifestExists(ctx, "myorg/app", reference)
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("rejected until every blob is pushed", func(t *testing.T) {
+		_, err := r.PutManifest(ctx, "myorg/app", "v1", strings.NewReader(image(layer, missing)), testManifestType)
+		assert.ErrorIs(t, err, ErrManifestBlobUnknown)
+		assert.Contains(t, err.Error(), missing)
+
+		_, err = r.PutManifest(ctx, "other/app", "v1", strings.NewReader(image(layer)), testManifestType)
+		assert.ErrorIs(t, err, ErrManifestBlobUnknown, "blobs of other repositories are not referable")
+	})
+
+	t.Run("foreign layers need not be pushed", func(t *testing.T) {
+		manifest := fmt.Sprintf(`{"schemaVersion":2,"config":{"digest":%q},"layers":[{"digest":%q,"urls":["https://example.com/layer"]}]}`, config, missing)
+		_, err := r.PutManifest(ctx, "myorg/app", "foreign", strings.NewReader(manifest), testManifestType)
+		require.NoError(t, err)
+	})
+}
+
+func TestManifestMediaType(t *testing.T) {
+	assert.Equal(t, ImageManifestMediaType, ManifestMediaType([]byte(`{"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)))
+	assert.Equal(t, ImageIndexMediaType, ManifestMediaType([]byte(`{"schemaVersion":2,"manifests":[]}`)))
+	assert.Equal(t, DockerManifestMediaType, ManifestMediaType([]byte(`{"schemaVersion":2,"config":{}}`)))
+	assert.Equal(t, DockerManifestMediaType, ManifestMediaType([]byte(`not json`)))
+}
+
+func TestImageIndexSelectManifest(t *testing.T) {
+	index := ImageIndex{Manifests: []Descriptor{
+		{MediaType: DockerManifestMediaType, Digest: "sha256:arm64", Platform: &Platform{Architecture: "arm64", OS: "linux"}},
+		{MediaType: ImageManifestMediaType, Digest: "sha256:arm64-oci", Platform: &Platform{Architecture: "arm64", OS: "linux"}},
+		{MediaType: ImageManifestMediaType, Digest: "sha256:amd64", Platform: &Platform{Architecture: "amd64", OS: "linux"}},
+	}}
+	only := func(mediaType string) func(string) bool {
+		return func(accepted string) bool { return accepted == mediaType }
+	}
+
+	assert.Equal(t, "sha256:amd64", index.SelectManifest(only(ImageManifestMediaType)).Digest, "the default platform is preferred")
+	assert.Equal(t, "sha256:arm64", index.SelectManifest(only(DockerManifestMediaType)).Digest)
+	assert.Nil(t, index.SelectManifest(only(ImageIndexMediaType)))
+}
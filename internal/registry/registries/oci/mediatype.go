@@ -0,0 +1,71 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"gorm.io/gorm"
+)
+
+// BlobMediaType is what blobs are served as until a manifest says what they are
+const BlobMediaType = "application/octet-stream"
+
+// blobManifest is the part of an image manifest describing the blobs it references
+type blobManifest struct {
+	Config *Descriptor  `json:"config"`
+	Layers []Descriptor `json:"layers"`
+}
+
+// recordBlobMediaTypes records the media types an image manifest gives its
+// config and layers on the artifact records of those blobs, since blobs are
+// uploaded without one. Manifests that are not image manifests reference no
+// blobs and are ignored.
+func (r *Registry) recordBlobMediaTypes(ctx context.Context, repository string, manifest []byte) error {
+	if r.db == nil || r.db.DB == nil {
+		return nil
+	}
+
+	var parsed blobManifest
+	if err := json.Unmarshal(manifest, &parsed); err != nil {
+		return nil
+	}
+	descriptors := parsed.Layers
+	if parsed.Config != nil {
+		descriptors = append(descriptors, *parsed.Config)
+	}
+
+	for _, descriptor := range descriptors {
+		if descriptor.MediaType == "" || descriptor.Digest == "" {
+			continue
+		}
+		if err := r.db.WithContext(ctx).Model(&types.Artifact{}).
+			Where("registry = ? AND name = ? AND version = ?", "oci", repository, descriptor.Digest).
+			Update("content_type", descriptor.MediaType).Error; err != nil {
+			return fmt.Errorf("failed to record media type of %s: %w", descriptor.Digest, err)
+		}
+	}
+	return nil
+}
+
+// GetBlobMediaType returns the media type a repository's blob was given by a
+// manifest referencing it, or BlobMediaType if none has
+func (r *Registry) GetBlobMediaType(ctx context.Context, repository, digest string) (string, error) {
+	if r.db == nil || r.db.DB == nil {
+		return BlobMediaType, nil
+	}
+
+	var artifact types.Artifact
+	err := r.db.WithContext(ctx).Select("content_type").
+		Where("registry = ? AND name = ? AND version = ?", "oci", repository, digest).
+		First(&artifact).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && artifact.ContentType == "") {
+		return BlobMediaType, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get blob media type: %w", err)
+	}
+	return artifact.ContentType, nil
+}
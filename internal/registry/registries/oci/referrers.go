@@ -0,0 +1,142 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ImageIndexMediaType is the media type of the image index the referrers API
+// responds with
+const ImageIndexMediaType = "application/vnd.oci.image.index.v1+json"
+
+// Descriptor describes a manifest in an image index, and the platform it is
+// for in the index of a multi-platform image
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	URLs         []string          `json:"urls,omitempty"`
+}
+
+// ImageIndex is an OCI image index, as returned by the referrers API and
+// pushed for multi-platform images
+type ImageIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// NewImageIndex returns an image index listing the descriptors, which is
+// never nil so it encodes as an empty list
+func NewImageIndex(manifests []Descriptor) *ImageIndex {
+	if manifests == nil {
+		manifests = []Descriptor{}
+	}
+	return &ImageIndex{SchemaVersion: 2, MediaType: ImageIndexMediaType, Manifests: manifests}
+}
+
+// referrerManifest is the part of a manifest needed to index it as a referrer
+type referrerManifest struct {
+	MediaType    string `json:"mediaType"`
+	ArtifactType string `json:"artifactType"`
+	Config       struct {
+		MediaType string `json:"mediaType"`
+	} `json:"config"`
+	Subject *struct {
+		Digest string `json:"digest"`
+	} `json:"subject"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// ManifestSubject returns the digest of the manifest a manifest refers to
+// through its subject field, or "" if it has none
+func ManifestSubject(manifest []byte) string {
+	var parsed referrerManifest
+	if err := json.Unmarshal(manifest, &parsed); err != nil || parsed.Subject == nil {
+		return ""
+	}
+	return parsed.Subject.Digest
+}
+
+// referrerPath is where the descriptor of a manifest referring to subject is
+// indexed
+func referrerPath(repository, subject, digest string) string {
+	return fmt.Sprintf("oci/%s/referrers/%s/%s", repository, subject, digest)
+}
+
+// indexReferrer records a manifest with a subject in the referrers index of
+// its subject, so it can be listed without reading every manifest
+func (r *Registry) indexReferrer(ctx context.Context, repository, digest string, manifest []byte, contentType string) error {
+	var parsed referrerManifest
+	if err := json.Unmarshal(manifest, &parsed); err != nil || parsed.Subject == nil || parsed.Subject.Digest == "" {
+		return nil
+	}
+
+	descriptor := Descriptor{
+		MediaType:    parsed.MediaType,
+		Digest:       digest,
+		Size:         int64(len(manifest)),
+		ArtifactType: parsed.ArtifactType,
+		Annotations:  parsed.Annotations,
+	}
+	if descriptor.MediaType == "" {
+		descriptor.MediaType = contentType
+	}
+	// Image manifests without an artifactType are typed by their config
+	if descriptor.ArtifactType == "" {
+		descriptor.ArtifactType = parsed.Config.MediaType
+	}
+
+	data, err := json.Marshal(descriptor)
+	if err != nil {
+		return err
+	}
+	return r.storage.Store(ctx, referrerPath(repository, parsed.Subject.Digest, digest), strings.NewReader(string(data)), "application/json")
+}
+
+// ListReferrers returns the descriptors of the manifests whose subject is the
+// manifest with the given digest, ordered by digest. If artifactType is not
+// empty only referrers of that type are returned.
+func (r *Registry) ListReferrers(ctx context.Context, repository, digest, artifactType string) ([]Descriptor, error) {
+	paths, err := r.storage.List(ctx, fmt.Sprintf("oci/%s/referrers/%s/", repository, digest))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list referrers: %w", err)
+	}
+	sort.Strings(paths)
+
+	descriptors := []Descriptor{}
+	for _, referrer := range paths {
+		// The index entry outlives a manifest only if its deletion was interrupted
+		manifestPath := fmt.Sprintf("oci/%s/manifests/%s", repository, path.Base(referrer))
+		if exists, err := r.storage.Exists(ctx, manifestPath); err != nil || !exists {
+			continue
+		}
+
+		reader, err := r.storage.Retrieve(ctx, referrer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read referrer: %w", err)
+		}
+		var descriptor Descriptor
+		err = json.NewDecoder(reader).Decode(&descriptor)
+		reader.Close()
+		if err != nil {
+			log.Warn().Err(err).Str("path", referrer).Msg("Skipping unreadable referrer index entry")
+			continue
+		}
+
+		if artifactType != "" && descriptor.ArtifactType != artifactType {
+			continue
+		}
+		descriptors = append(descriptors, descriptor)
+	}
+	return descriptors, nil
+}
@@ -0,0 +1,103 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testManifestType = "application/vnd.oci.image.manifest.v1+json"
+
+func newTestRegistry(t *testing.T) *Registry {
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	return New(localStorage, nil)
+}
+
+// pushTestBlob pushes content as a blob of the repository and returns its digest
+func pushTestBlob(t *testing.T, r *Registry, repository, content string) string {
+	t.Helper()
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(content)))
+	_, _, err := r.PutBlob(context.Background(), repository, digest, strings.NewReader(content))
+	require.NoError(t, err)
+	return digest
+}
+
+func TestReferrersIndex(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t)
+
+	config := pushTestBlob(t, r, "myorg/app", "{}")
+	subject, err := r.PutManifest(ctx, "myorg/app", "v1", strings.NewReader(`{"schemaVersion":2,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"`+config+`"}}`), testManifestType)
+	require.NoError(t, err)
+
+	sbom := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/spdx+json",` +
+		`"subject":{"digest":"` + subject + `"},"annotations":{"org.opencontainers.image.created":"2024-01-01T00:00:00Z"}}`
+	sbomDigest, err := r.PutManifest(ctx, "myorg/app", "sbom", strings.NewReader(sbom), testManifestType)
+	require.NoError(t, err)
+
+	// Without an artifactType, the config media type is the artifact type
+	signature := `{"schemaVersion":2,"config":{"mediaType":"application/vnd.dev.cosign.artifact.sig.v1+json","digest":"` + config + `"},"subject":{"digest":"` + subject + `"}}`
+	signatureDigest, err := r.PutManifest(ctx, "myorg/app", "signature", strings.NewReader(signature), testManifestType)
+	require.NoError(t, err)
+
+	referrers, err := r.ListReferrers(ctx, "myorg/app", subject, "")
+	require.NoError(t, err)
+	require.Len(t, referrers, 2)
+
+	byDigest := map[string]Descriptor{}
+	for _, referrer := range referrers {
+		byDigest[referrer.Digest] = referrer
+	}
+	assert.Equal(t, Descriptor{
+		MediaType:    testManifestType,
+		Digest:       sbomDigest,
+		Size:         int64(len(sbom)),
+		ArtifactType: "application/spdx+json",
+		Annotations:  map[string]string{"org.opencontainers.image.created": "2024-01-01T00:00:00Z"},
+	}, byDigest[sbomDigest])
+	assert.Equal(t, "application/vnd.dev.cosign.artifact.sig.v1+json", byDigest[signatureDigest].ArtifactType)
+
+	t.Run("filtered by artifact type", func(t *testing.T) {
+		referrers, err := r.ListReferrers(ctx, "myorg/app", subject, "application/spdx+json")
+		require.NoError(t, err)
+		require.Len(t, referrers, 1)
+		assert.Equal(t, sbomDigest, referrers[0].Digest)
+
+		referrers, err = r.ListReferrers(ctx, "myorg/app", subject, "application/unknown")
+		require.NoError(t, err)
+		assert.Empty(t, referrers)
+	})
+
+	t.Run("other repositories and manifests have none", func(t *testing.T) {
+		referrers, err := r.ListReferrers(ctx, "myorg/other", subject, "")
+		require.NoError(t, err)
+		assert.NotNil(t, referrers)
+		assert.Empty(t, referrers)
+
+		referrers, err = r.ListReferrers(ctx, "myorg/app", sbomDigest, "")
+		require.NoError(t, err)
+		assert.Empty(t, referrers)
+	})
+
+	t.Run("deleted referrers are removed", func(t *testing.T) {
+		require.NoError(t, r.DeleteManifest(ctx, "myorg/app", "sbom"))
+
+		referrers, err := r.ListReferrers(ctx, "myorg/app", subject, "")
+		require.NoError(t, err)
+		require.Len(t, referrers, 1)
+		assert.Equal(t, signatureDigest, referrers[0].Digest)
+	})
+}
+
+func TestManifestSubject(t *testing.T) {
+	assert.Equal(t, "sha256:abc", ManifestSubject([]byte(`{"subject":{"digest":"sha256:abc"}}`)))
+	assert.Empty(t, ManifestSubject([]byte(`{"schemaVersion":2}`)))
+	assert.Empty(t, ManifestSubject([]byte(`not json`)))
+}
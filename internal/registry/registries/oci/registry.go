@@ -6,22 +6,65 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"path"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/lgulliver/lodestone/internal/common"
 	"github.com/lgulliver/lodestone/internal/storage"
 	"github.com/lgulliver/lodestone/pkg/types"
 	"github.com/rs/zerolog/log"
 )
 
+// MaxRepositoryNameLength is the maximum length of a repository name
+// permitted by the distribution spec
+const MaxRepositoryNameLength = 255
+
+// repositoryNameRegex matches the distribution spec repository name grammar:
+// lowercase path components separated by "/", where each component may
+// contain ".", "_", "__" or runs of "-" between alphanumeric characters
+var repositoryNameRegex = regexp.MustCompile(`^[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:\.|_|__|-+)[a-z0-9]+)*)*$`)
+
+// ErrNameInvalid is returned when a repository name does not conform to the
+// distribution spec grammar
+var ErrNameInvalid = errors.New("invalid repository name")
+
+// ErrTagImmutable is returned when a push would move an existing immutable tag
+var ErrTagImmutable = errors.New("tag is immutable")
+
+// ErrDigestInvalid is returned when an uploaded blob does not match the
+// digest it was uploaded with
+var ErrDigestInvalid = errors.New("digest did not match content")
+
+// immutableTagPattern restricts tags matching the tag glob in repositories
+// matching the repository glob, or in every repository if it is empty, from
+// being moved once pushed
+type immutableTagPattern struct {
+	repository string
+	tag        string
+}
+
 // Registry implements the OCI/Docker container registry
 type Registry struct {
 	storage        storage.BlobStorage
 	db             *common.Database
 	sessionManager *SessionManager
+	strictNames    bool
+	immutableTags  []immutableTagPattern
+
+	// gcMu keeps pushes from interleaving with garbage collection, which
+	// holds it exclusively. It only covers this process.
+	gcMu sync.RWMutex
+	// pushedBlobs records when blobs were last written by this process, so
+	// garbage collection keeps them before their records are created
+	pushedMu    sync.Mutex
+	pushedBlobs map[string]time.Time
 }
 
 // New creates a new OCI registry handler
@@ -30,7 +73,109 @@ func New(storage storage.BlobStorage, db *common.Database) *Registry {
 		storage:        storage,
 		db:             db,
 		sessionManager: NewSessionManager(storage),
+		strictNames:    true,
+	}
+}
+
+// SetStrictNameValidation enables or disables enforcement of the distribution
+// spec repository name grammar. Lenient mode only rejects empty names and
+// path traversal.
+func (r *Registry) SetStrictNameValidation(strict bool) {
+	r.strictNames = strict
+}
+
+// SetUploadSessionStore sets where upload sessions are kept. Instances behind
+// a load balancer must share a store, such as one created with
+// NewCacheSessionStore; sessions are kept in memory by default.
+func (r *Registry) SetUploadSessionStore(store SessionStore) {
+	r.sessionManager.store = store
+}
+
+// SetUploadSessionTTL sets how long an upload session may go without a chunk
+// before it expires and its content is removed. Non-positive values keep the
+// default of 24 hours.
+func (r *Registry) SetUploadSessionTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultUploadSessionTTL
 	}
+	r.sessionManager.ttl = ttl
+}
+
+// SetImmutableTags sets the tags that cannot be moved once pushed. Each
+// pattern is "repository:tag" using path.Match globs, e.g. "myorg/*:v*"; a
+// pattern without a repository part applies to every repository. Tags not
+// matching any pattern remain mutable.
+func (r *Registry) SetImmutableTags(patterns []string) error {
+	parsed := make([]immutableTagPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		rule := immutableTagPattern{tag: pattern}
+		if repository, tag, ok := strings.Cut(pattern, ":"); ok {
+			rule = immutableTagPattern{repository: repository, tag: tag}
+		}
+		if rule.tag == "" {
+			return fmt.Errorf("invalid immutable tag pattern %q: tag is empty", pattern)
+		}
+		if _, err := path.Match(rule.repository, ""); err != nil {
+			return fmt.Errorf("invalid immutable tag pattern %q: %w", pattern, err)
+		}
+		if _, err := path.Match(rule.tag, ""); err != nil {
+			return fmt.Errorf("invalid immutable tag pattern %q: %w", pattern, err)
+		}
+		parsed = append(parsed, rule)
+	}
+	r.immutableTags = parsed
+	return nil
+}
+
+// IsTagImmutable reports whether a tag in a repository matches an immutable
+// tag pattern. Digest references are content addressed and never tags.
+func (r *Registry) IsTagImmutable(repository, reference string) bool {
+	if strings.HasPrefix(reference, "sha256:") {
+		return false
+	}
+	for _, rule := range r.immutableTags {
+		repositoryMatch := rule.repository == ""
+		if !repositoryMatch {
+			repositoryMatch, _ = path.Match(rule.repository, repository)
+		}
+		tagMatch, _ := path.Match(rule.tag, reference)
+		if repositoryMatch && tagMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRepositoryName checks a repository name according to the
+// registry's configured name validation mode
+func (r *Registry) ValidateRepositoryName(name string) error {
+	if !r.strictNames {
+		if name == "" {
+			return fmt.Errorf("%w: name is empty", ErrNameInvalid)
+		}
+		for _, component := range strings.Split(name, "/") {
+			if component == ".." {
+				return fmt.Errorf("%w: path traversal is not allowed", ErrNameInvalid)
+			}
+		}
+		return nil
+	}
+	return ValidateRepositoryName(name)
+}
+
+// ValidateRepositoryName checks that a repository name conforms to the
+// distribution spec grammar
+func ValidateRepositoryName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name is empty", ErrNameInvalid)
+	}
+	if len(name) > MaxRepositoryNameLength {
+		return fmt.Errorf("%w: name exceeds %d characters", ErrNameInvalid, MaxRepositoryNameLength)
+	}
+	if !repositoryNameRegex.MatchString(name) {
+		return fmt.Errorf("%w: %q does not match the repository name grammar", ErrNameInvalid, name)
+	}
+	return nil
 }
 
 // Upload stores an OCI artifact
@@ -67,9 +212,8 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 	}
 
 	// Validate image name format
-	imageNameRegex := regexp.MustCompile(`^[a-z0-9]+(?:(?:\.|_|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:\.|_|-+)[a-z0-9]+)*)*$`)
-	if !imageNameRegex.MatchString(artifact.Name) {
-		return fmt.Errorf("invalid OCI image name format")
+	if err := r.ValidateRepositoryName(artifact.Name); err != nil {
+		return err
 	}
 
 	// For tag validation
@@ -114,6 +258,39 @@ func (r *Registry) GenerateStoragePath(name, version string) string {
 	return fmt.Sprintf("oci/%s/manifests/%s", name, version)
 }
 
+// PutBlob stores a blob uploaded in a single request, verifying it against
+// its sha256 digest as it is streamed into storage, and returns its size and
+// storage path
+func (r *Registry) PutBlob(ctx context.Context, repository, digest string, content io.Reader) (int64, string, error) {
+	r.gcMu.RLock()
+	defer r.gcMu.RUnlock()
+
+	encoded, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok || len(encoded) != sha256.Size*2 {
+		return 0, "", fmt.Errorf("%w: unsupported digest %q", ErrDigestInvalid, digest)
+	}
+
+	// The blob is staged until it is verified, so content that does not match
+	// its digest never replaces the blob stored under that digest
+	stagingPath := fmt.Sprintf("temp/uploads/%s/%s", repository, uuid.New())
+	size, _, err := storage.StoreVerified(ctx, r.storage, stagingPath, content, "application/octet-stream", encoded)
+	if errors.Is(err, storage.ErrDigestMismatch) {
+		return 0, "", fmt.Errorf("%w: %v", ErrDigestInvalid, err)
+	}
+	if err != nil {
+		r.storage.Delete(ctx, stagingPath)
+		return 0, "", fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	storagePath := fmt.Sprintf("oci/%s/blobs/%s", repository, digest)
+	if err := storage.Move(ctx, r.storage, stagingPath, storagePath, "application/octet-stream"); err != nil {
+		r.storage.Delete(ctx, stagingPath)
+		return 0, "", fmt.Errorf("failed to store blob: %w", err)
+	}
+	r.recordPushedBlob(storagePath)
+	return size, storagePath, nil
+}
+
 // StartBlobUpload starts a new blob upload session
 func (r *Registry) StartBlobUpload(ctx context.Context, repository, userID string) (*UploadSession, error) {
 	return r.sessionManager.StartUpload(ctx, repository, userID)
@@ -126,7 +303,14 @@ func (r *Registry) AppendBlobChunk(ctx context.Context, sessionID string, data i
 
 // CompleteBlobUpload completes a blob upload with digest verification
 func (r *Registry) CompleteBlobUpload(ctx context.Context, sessionID, expectedDigest string) (*UploadSession, string, error) {
-	return r.sessionManager.CompleteUpload(ctx, sessionID, expectedDigest)
+	r.gcMu.RLock()
+	defer r.gcMu.RUnlock()
+
+	session, storagePath, err := r.sessionManager.CompleteUpload(ctx, sessionID, expectedDigest)
+	if err == nil {
+		r.recordPushedBlob(storagePath)
+	}
+	return session, storagePath, err
 }
 
 // CancelBlobUpload cancels an active upload session
@@ -135,13 +319,35 @@ func (r *Registry) CancelBlobUpload(ctx context.Context, sessionID string) error
 }
 
 // GetBlobUploadStatus returns the status of an upload session
-func (r *Registry) GetBlobUploadStatus(sessionID string) (*UploadSession, error) {
-	return r.sessionManager.GetUploadStatus(sessionID)
+func (r *Registry) GetBlobUploadStatus(ctx context.Context, sessionID string) (*UploadSession, error) {
+	return r.sessionManager.GetUploadStatus(ctx, sessionID)
+}
+
+// BlobStoragePath returns where a repository's blob is stored: under the
+// repository itself, or, for a blob mounted from another repository, wherever
+// the artifact record says the shared blob lives
+func (r *Registry) BlobStoragePath(ctx context.Context, repository, digest string) (string, error) {
+	path := fmt.Sprintf("oci/%s/blobs/%s", repository, digest)
+	exists, err := r.storage.Exists(ctx, path)
+	if err != nil || exists || r.db == nil || r.db.DB == nil {
+		return path, err
+	}
+
+	var artifact types.Artifact
+	if err := r.db.WithContext(ctx).
+		Where("registry = ? AND name = ? AND version = ?", "oci", repository, digest).
+		First(&artifact).Error; err == nil && artifact.StoragePath != "" {
+		return artifact.StoragePath, nil
+	}
+	return path, nil
 }
 
 // BlobExists checks if a blob exists in the registry
 func (r *Registry) BlobExists(ctx context.Context, repository, digest string) (bool, int64, error) {
-	path := fmt.Sprintf("oci/%s/blobs/%s", repository, digest)
+	path, err := r.BlobStoragePath(ctx, repository, digest)
+	if err != nil {
+		return false, 0, err
+	}
 	exists, err := r.storage.Exists(ctx, path)
 	if err != nil || !exists {
 		return false, 0, err
@@ -153,7 +359,10 @@ func (r *Registry) BlobExists(ctx context.Context, repository, digest string) (b
 
 // GetBlob retrieves a blob from storage
 func (r *Registry) GetBlob(ctx context.Context, repository, digest string) (io.ReadCloser, int64, error) {
-	path := fmt.Sprintf("oci/%s/blobs/%s", repository, digest)
+	path, err := r.BlobStoragePath(ctx, repository, digest)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to check blob existence: %w", err)
+	}
 
 	// Check if blob exists
 	exists, err := r.storage.Exists(ctx, path)
@@ -179,6 +388,21 @@ func (r *Registry) GetBlob(ctx context.Context, repository, digest string) (io.R
 	return reader, size, nil
 }
 
+// GetBlobRange retrieves length bytes of a blob from storage, starting at
+// offset
+func (r *Registry) GetBlobRange(ctx context.Context, repository, digest string, offset, length int64) (io.ReadCloser, error) {
+	path, err := r.BlobStoragePath(ctx, repository, digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check blob existence: %w", err)
+	}
+
+	reader, err := r.storage.RetrieveRange(ctx, path, offset, length)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve blob: %w", err)
+	}
+	return reader, nil
+}
+
 // DeleteBlob removes a blob from storage
 func (r *Registry) DeleteBlob(ctx context.Context, repository, digest string) error {
 	path := fmt.Sprintf("oci/%s/blobs/%s", repository, digest)
@@ -219,16 +443,7 @@ func (r *Registry) ManifestExists(ctx context.Context, repository, reference str
 	// Calculate digest
 	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifestContent))
 
-	// Parse manifest to get media type
-	var manifestObj map[string]interface{}
-	mediaType := "application/vnd.docker.distribution.manifest.v2+json" // default
-	if err := json.Unmarshal(manifestContent, &manifestObj); err == nil {
-		if mt, ok := manifestObj["mediaType"].(string); ok {
-			mediaType = mt
-		}
-	}
-
-	return true, digest, size, mediaType, nil
+	return true, digest, size, ManifestMediaType(manifestContent), nil
 }
 
 // GetManifest retrieves a manifest from storage
@@ -253,8 +468,21 @@ func (r *Registry) GetManifest(ctx context.Context, repository, reference string
 	return reader, digest, size, nil
 }
 
+// readManifest returns the content of a stored manifest
+func (r *Registry) readManifest(ctx context.Context, repository, reference string) ([]byte, error) {
+	reader, _, _, err := r.GetManifest(ctx, repository, reference)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
 // PutManifest stores a manifest
 func (r *Registry) PutManifest(ctx context.Context, repository, reference string, content io.Reader, contentType string) (string, error) {
+	r.gcMu.RLock()
+	defer r.gcMu.RUnlock()
+
 	// Read all content to calculate digest
 	data, err := io.ReadAll(content)
 	if err != nil {
@@ -262,19 +490,53 @@ func (r *Registry) PutManifest(ctx context.Context, repository, reference string
 	}
 
 	// Validate that it's a valid JSON manifest
-	if contentType == "application/vnd.docker.distribution.manifest.v2+json" ||
-		contentType == "application/vnd.oci.image.manifest.v1+json" {
+	if contentType == DockerManifestMediaType || contentType == ImageManifestMediaType {
 		var manifest map[string]interface{}
 		if err := json.Unmarshal(data, &manifest); err != nil {
-			return "", fmt.Errorf("invalid manifest JSON: %w", err)
+			return "", fmt.Errorf("%w: %v", ErrManifestInvalid, err)
 		}
 	}
 
-	// Calculate digest
 	hasher := sha256.New()
 	hasher.Write(data)
 	digest := "sha256:" + hex.EncodeToString(hasher.Sum(nil))
 
+	// Tags cannot contain a colon, so a reference with one is a digest, which
+	// the content must have
+	if strings.Contains(reference, ":") && reference != digest {
+		return "", fmt.Errorf("%w: content has digest %s, pushed as %s", ErrManifestDigestMismatch, digest, reference)
+	}
+
+	// Everything a manifest refers to must be pushed before it: the images
+	// of a multi-platform index, and the config and layers of an image
+	if IsIndexMediaType(contentType) || IsIndexMediaType(ManifestMediaType(data)) {
+		index, err := ParseImageIndex(data)
+		if err != nil {
+			return "", err
+		}
+		if err := r.verifyIndexManifests(ctx, repository, index); err != nil {
+			return "", err
+		}
+	} else if err := r.verifyManifestBlobs(ctx, repository, data); err != nil {
+		return "", err
+	}
+
+	if err := verifyHelmChart(data); err != nil {
+		return "", err
+	}
+
+	// An immutable tag may be pushed again only with the manifest it already
+	// points to
+	if r.IsTagImmutable(repository, reference) {
+		exists, existingDigest, _, _, err := r.ManifestExists(ctx, repository, reference)
+		if err != nil {
+			return "", err
+		}
+		if exists && existingDigest != digest {
+			return "", fmt.Errorf("%w: %s:%s already exists", ErrTagImmutable, repository, reference)
+		}
+	}
+
 	// Store manifest
 	path := fmt.Sprintf("oci/%s/manifests/%s", repository, reference)
 	err = r.storage.Store(ctx, path, bytes.NewReader(data), contentType)
@@ -290,6 +552,17 @@ func (r *Registry) PutManifest(ctx context.Context, repository, reference string
 		log.Warn().Err(err).Str("path", digestPath).Msg("Failed to store manifest by digest")
 	}
 
+	// Index manifests with a subject so the referrers API can list them
+	if err := r.indexReferrer(ctx, repository, digest, data, contentType); err != nil {
+		return "", fmt.Errorf("failed to index referrer: %w", err)
+	}
+
+	// Blobs are uploaded untyped, so they take the media types the manifest
+	// gives them
+	if err := r.recordBlobMediaTypes(ctx, repository, data); err != nil {
+		log.Warn().Err(err).Str("repository", repository).Str("digest", digest).Msg("Failed to record blob media types")
+	}
+
 	log.Info().
 		Str("repository", repository).
 		Str("reference", reference).
@@ -303,11 +576,17 @@ func (r *Registry) PutManifest(ctx context.Context, repository, reference string
 
 // DeleteManifest removes a manifest from storage
 func (r *Registry) DeleteManifest(ctx context.Context, repository, reference string) error {
-	// Get digest before deletion for cleanup
+	// Get digest and subject before deletion for cleanup
 	_, digest, _, _, err := r.ManifestExists(ctx, repository, reference)
 	if err != nil {
 		return err
 	}
+	subject := ""
+	if digest != "" {
+		if manifest, err := r.readManifest(ctx, repository, reference); err == nil {
+			subject = ManifestSubject(manifest)
+		}
+	}
 
 	// Delete manifest by reference
 	path := fmt.Sprintf("oci/%s/manifests/%s", repository, reference)
@@ -321,6 +600,9 @@ func (r *Registry) DeleteManifest(ctx context.Context, repository, reference str
 		digestPath := fmt.Sprintf("oci/%s/manifests/%s", repository, digest)
 		r.storage.Delete(ctx, digestPath)
 	}
+	if subject != "" {
+		r.storage.Delete(ctx, referrerPath(repository, subject, digest))
+	}
 
 	return nil
 }
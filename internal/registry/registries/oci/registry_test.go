@@ -0,0 +1,102 @@
+package oci
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRepositoryName_Valid(t *testing.T) {
+	names := []string{
+		"nginx",
+		"library/nginx",
+		"myorg/my-app",
+		"myorg/my--app",
+		"my.org/app_name",
+		"a/b/c/d",
+		"app__name",
+		"app2/v1.0",
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, ValidateRepositoryName(name))
+		})
+	}
+}
+
+func TestValidateRepositoryName_Invalid(t *testing.T) {
+	names := []string{
+		"",
+		"Nginx",
+		"myorg/MyApp",
+		"-app",
+		"app-",
+		"app..name",
+		"app___name",
+		"app._name",
+		"myorg//app",
+		"/app",
+		"app/",
+		"my app",
+		"myorg/app:latest",
+		strings.Repeat("a", MaxRepositoryNameLength+1),
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			err := ValidateRepositoryName(name)
+			assert.Error(t, err)
+			assert.ErrorIs(t, err, ErrNameInvalid)
+		})
+	}
+}
+
+func TestRegistryValidateRepositoryName_Lenient(t *testing.T) {
+	r := &Registry{strictNames: true}
+	assert.Error(t, r.ValidateRepositoryName("MyOrg/MyApp"))
+
+	r.SetStrictNameValidation(false)
+	assert.NoError(t, r.ValidateRepositoryName("MyOrg/MyApp"))
+	assert.Error(t, r.ValidateRepositoryName(""))
+	assert.Error(t, r.ValidateRepositoryName("myorg/../secret"))
+}
+
+func TestRegistryIsTagImmutable(t *testing.T) {
+	r := &Registry{}
+	require.NoError(t, r.SetImmutableTags([]string{"myorg/*:v*", "stable", "library/nginx:1.[0-9]*"}))
+
+	tests := []struct {
+		repository string
+		reference  string
+		want       bool
+	}{
+		{"myorg/app", "v1.2.3", true},
+		{"myorg/app", "latest", false},
+		{"myorg/team/app", "v1.2.3", false},
+		{"other/app", "v1.2.3", false},
+		{"other/app", "stable", true},
+		{"library/nginx", "1.25", true},
+		{"library/nginx", "mainline", false},
+		{"myorg/app", "sha256:0123abcd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repository+":"+tt.reference, func(t *testing.T) {
+			assert.Equal(t, tt.want, r.IsTagImmutable(tt.repository, tt.reference))
+		})
+	}
+}
+
+func TestRegistrySetImmutableTags_Invalid(t *testing.T) {
+	r := &Registry{}
+	require.NoError(t, r.SetImmutableTags([]string{"v*"}))
+
+	assert.Error(t, r.SetImmutableTags([]string{"myorg/app:"}))
+	assert.Error(t, r.SetImmutableTags([]string{"myorg/[app:v*"}))
+
+	// A rejected list leaves the previous patterns in place
+	assert.True(t, r.IsTagImmutable("myorg/app", "v1"))
+}
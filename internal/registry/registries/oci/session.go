@@ -1,12 +1,15 @@
 package oci
 
 import (
-	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"path"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,11 +17,33 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// NewSessionManager creates a new session manager
+var (
+	// ErrUploadUnknown is returned for upload sessions that do not exist
+	ErrUploadUnknown = errors.New("upload session not found")
+
+	// ErrChunkOutOfOrder is returned when a chunk's Content-Range does not
+	// start where the upload so far ends, leaving a gap or overlapping it
+	ErrChunkOutOfOrder = errors.New("chunk does not start at the end of the upload")
+
+	// ErrContentRangeInvalid is returned when a chunk's Content-Range is
+	// malformed or does not match the size of the chunk
+	ErrContentRangeInvalid = errors.New("invalid Content-Range")
+)
+
+// DefaultUploadSessionTTL is how long an upload session may go without a
+// chunk before it is abandoned
+const DefaultUploadSessionTTL = 24 * time.Hour
+
+// sessionTempPrefix is where the content of upload sessions is kept until
+// they complete
+const sessionTempPrefix = "temp/upload-sessions/"
+
+// NewSessionManager creates a new session manager keeping sessions in memory
 func NewSessionManager(storage storage.BlobStorage) *SessionManager {
 	sm := &SessionManager{
-		sessions: make(map[string]*UploadSession),
-		storage:  storage,
+		store:   NewMemorySessionStore(),
+		storage: storage,
+		ttl:     DefaultUploadSessionTTL,
 	}
 
 	// Start cleanup routine
@@ -29,11 +54,8 @@ func NewSessionManager(storage storage.BlobStorage) *SessionManager {
 
 // StartUpload creates a new upload session
 func (sm *SessionManager) StartUpload(ctx context.Context, repository, userID string) (*UploadSession, error) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-
 	sessionID := uuid.New().String()
-	tempPath := fmt.Sprintf("temp/uploads/%s/%s", repository, sessionID)
+	tempPath := fmt.Sprintf("%s%s/%s", sessionTempPrefix, repository, sessionID)
 
 	session := &UploadSession{
 		ID:         sessionID,
@@ -45,7 +67,9 @@ func (sm *SessionManager) StartUpload(ctx context.Context, repository, userID st
 		TempPath:   tempPath,
 	}
 
-	sm.sessions[sessionID] = session
+	if err := sm.store.Save(ctx, session, sm.ttl); err != nil {
+		return nil, err
+	}
 
 	log.Info().
 		Str("session_id", sessionID).
@@ -56,106 +80,189 @@ func (sm *SessionManager) StartUpload(ctx context.Context, repository, userID st
 	return session, nil
 }
 
-// GetSession retrieves an upload session
-func (sm *SessionManager) GetSession(sessionID string) (*UploadSession, bool) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-
-	session, exists := sm.sessions[sessionID]
-	if !exists {
-		return nil, false
-	}
-
-	// Update last access time
-	session.mu.Lock()
-	session.LastUpdate = time.Now()
-	session.mu.Unlock()
-
-	return session, true
-}
-
-// AppendChunk appends data to an upload session
+// AppendChunk appends data to an upload session. A chunk with a
+// Content-Range must start where the upload so far ends and be as long as the
+// range; the session is returned with the error if it is not, so its current
+// size can be reported. Chunks of one session are appended one at a time,
+// whichever instance they arrive at.
+//
+// Each chunk is streamed into storage as a part of its own rather than
+// appended to the content uploaded so far, so neither is held in memory and
+// the session is only locked once the chunk has arrived.
 func (sm *SessionManager) AppendChunk(ctx context.Context, sessionID string, data io.Reader, contentRange string) (*UploadSession, error) {
-	session, exists := sm.GetSession(sessionID)
-	if !exists {
-		return nil, fmt.Errorf("upload session not found")
-	}
-
-	session.mu.Lock()
-	defer session.mu.Unlock()
-
-	// For simplicity, we'll read all data and store it
-	// In a production system, you'd handle chunked uploads more efficiently
-	content, err := io.ReadAll(data)
+	session, err := sm.store.Get(ctx, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read chunk data: %w", err)
+		return nil, err
 	}
 
-	// If this is the first chunk, create the temp file
-	if session.Size == 0 {
-		err = sm.storage.Store(ctx, session.TempPath, bytes.NewReader(content), "application/octet-stream")
+	var start, rangeSize int64
+	if contentRange != "" {
+		var end int64
+		start, end, err = parseContentRange(contentRange)
 		if err != nil {
-			return nil, fmt.Errorf("failed to store initial chunk: %w", err)
+			return session, err
 		}
-	} else {
-		// For subsequent chunks, we'd need to append to the existing file
-		// This is a simplified implementation - in production, you'd use a more sophisticated approach
-		existing, err := sm.storage.Retrieve(ctx, session.TempPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to retrieve existing data: %w", err)
+		if start != session.Size {
+			return session, fmt.Errorf("%w: chunk starts at %d but %d bytes have been uploaded", ErrChunkOutOfOrder, start, session.Size)
 		}
+		rangeSize = end - start + 1
+	}
 
-		existingData, err := io.ReadAll(existing)
-		existing.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read existing data: %w", err)
-		}
+	partPath := session.TempPath + "." + uuid.New().String()
+	chunk := &countingReader{reader: data}
+	if err := sm.storage.Store(ctx, partPath, chunk, "application/octet-stream"); err != nil {
+		return nil, fmt.Errorf("failed to store chunk: %w", err)
+	}
+	if contentRange != "" && chunk.n != rangeSize {
+		sm.removeParts(ctx, partPath)
+		return session, fmt.Errorf("%w: range %s is %d bytes but the chunk is %d", ErrContentRangeInvalid, contentRange, rangeSize, chunk.n)
+	}
 
-		// Combine existing and new data
-		combined := append(existingData, content...)
-		err = sm.storage.Store(ctx, session.TempPath, bytes.NewReader(combined), "application/octet-stream")
-		if err != nil {
-			return nil, fmt.Errorf("failed to store combined data: %w", err)
-		}
+	unlock, err := sm.store.Lock(ctx, sessionID)
+	if err != nil {
+		sm.removeParts(ctx, partPath)
+		return nil, err
 	}
+	defer unlock()
 
-	session.Size += int64(len(content))
+	// Another chunk may have been appended while this one was read
+	session, err = sm.store.Get(ctx, sessionID)
+	if err != nil {
+		sm.removeParts(ctx, partPath)
+		return nil, err
+	}
+	if contentRange != "" && start != session.Size {
+		sm.removeParts(ctx, partPath)
+		return session, fmt.Errorf("%w: chunk starts at %d but %d bytes have been uploaded", ErrChunkOutOfOrder, start, session.Size)
+	}
+
+	session.Parts = append(session.Parts, partPath)
+	session.Size += chunk.n
 	session.LastUpdate = time.Now()
+	if err := sm.store.Save(ctx, session, sm.ttl); err != nil {
+		sm.removeParts(ctx, partPath)
+		return nil, err
+	}
 
 	log.Debug().
 		Str("session_id", sessionID).
-		Int64("chunk_size", int64(len(content))).
+		Int64("chunk_size", chunk.n).
 		Int64("total_size", session.Size).
 		Msg("Appended chunk to upload session")
 
 	return session, nil
 }
 
-// CompleteUpload finalizes an upload session with digest verification
-func (sm *SessionManager) CompleteUpload(ctx context.Context, sessionID, expectedDigest string) (*UploadSession, string, error) {
-	session, exists := sm.GetSession(sessionID)
-	if !exists {
-		return nil, "", fmt.Errorf("upload session not found")
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// partsReader reads the parts of an upload session one after another,
+// opening each only once the previous one has been read
+type partsReader struct {
+	ctx     context.Context
+	storage storage.BlobStorage
+	parts   []string
+	current io.ReadCloser
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			part, err := r.storage.Retrieve(r.ctx, r.parts[0])
+			if err != nil {
+				return 0, fmt.Errorf("failed to retrieve upload part: %w", err)
+			}
+			r.current, r.parts = part, r.parts[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.current == nil {
+		return nil
 	}
+	return r.current.Close()
+}
 
-	session.mu.Lock()
-	defer session.mu.Unlock()
+// readParts returns a reader over the content uploaded to a session so far
+func (sm *SessionManager) readParts(ctx context.Context, session *UploadSession) io.ReadCloser {
+	return &partsReader{ctx: ctx, storage: sm.storage, parts: session.Parts}
+}
 
-	// Retrieve the uploaded data for digest verification
-	reader, err := sm.storage.Retrieve(ctx, session.TempPath)
+// removeParts deletes stored upload parts, logging rather than returning
+// failures since expired content is cleaned up regardless
+func (sm *SessionManager) removeParts(ctx context.Context, parts ...string) {
+	for _, part := range parts {
+		if err := sm.storage.Delete(context.WithoutCancel(ctx), part); err != nil {
+			log.Warn().Err(err).Str("path", part).Msg("Failed to remove upload part")
+		}
+	}
+}
+
+// parseContentRange parses the Content-Range of a chunk, an inclusive range
+// of bytes such as 0-1023
+func parseContentRange(contentRange string) (int64, int64, error) {
+	startText, endText, ok := strings.Cut(contentRange, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %s", ErrContentRangeInvalid, contentRange)
+	}
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("%w: %s", ErrContentRangeInvalid, contentRange)
+	}
+	end, err := strconv.ParseInt(endText, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("%w: %s", ErrContentRangeInvalid, contentRange)
+	}
+	return start, end, nil
+}
+
+// CompleteUpload finalizes an upload session with digest verification. The
+// session ends once its blob is stored.
+func (sm *SessionManager) CompleteUpload(ctx context.Context, sessionID, expectedDigest string) (*UploadSession, string, error) {
+	unlock, err := sm.store.Lock(ctx, sessionID)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to retrieve uploaded data: %w", err)
+		return nil, "", err
 	}
-	defer reader.Close()
+	defer unlock()
 
-	// Calculate SHA256 digest
+	session, err := sm.store.Get(ctx, sessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Calculate the SHA256 digest of the uploaded data, streaming it rather
+	// than reading it into memory
+	reader := sm.readParts(ctx, session)
 	hasher := sha256.New()
-	data, err := io.ReadAll(reader)
+	_, err = io.Copy(hasher, reader)
+	reader.Close()
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to read uploaded data: %w", err)
 	}
-
-	hasher.Write(data)
 	actualDigest := "sha256:" + hex.EncodeToString(hasher.Sum(nil))
 
 	// Verify digest if provided
@@ -169,14 +276,18 @@ func (sm *SessionManager) CompleteUpload(ctx context.Context, sessionID, expecte
 	// Generate final storage path
 	finalPath := fmt.Sprintf("oci/%s/blobs/%s", session.Repository, actualDigest)
 
-	// Move from temp location to final location
-	err = sm.storage.Store(ctx, finalPath, bytes.NewReader(data), "application/octet-stream")
+	// Join the parts at the final location
+	reader = sm.readParts(ctx, session)
+	err = sm.storage.Store(ctx, finalPath, reader, "application/octet-stream")
+	reader.Close()
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to store blob at final location: %w", err)
 	}
+	sm.removeParts(ctx, session.Parts...)
 
-	// Clean up temp file
-	sm.storage.Delete(ctx, session.TempPath)
+	if err := sm.store.Delete(ctx, sessionID); err != nil {
+		log.Warn().Err(err).Str("session_id", sessionID).Msg("Failed to remove completed upload session")
+	}
 
 	log.Info().
 		Str("session_id", sessionID).
@@ -190,19 +301,24 @@ func (sm *SessionManager) CompleteUpload(ctx context.Context, sessionID, expecte
 
 // CancelUpload cancels an upload session
 func (sm *SessionManager) CancelUpload(ctx context.Context, sessionID string) error {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	unlock, err := sm.store.Lock(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	session, exists := sm.sessions[sessionID]
-	if !exists {
-		return fmt.Errorf("upload session not found")
+	session, err := sm.store.Get(ctx, sessionID)
+	if err != nil {
+		return err
 	}
 
-	// Clean up temp file
-	sm.storage.Delete(ctx, session.TempPath)
+	// Clean up the uploaded parts
+	sm.removeParts(ctx, session.Parts...)
 
 	// Remove session
-	delete(sm.sessions, sessionID)
+	if err := sm.store.Delete(ctx, sessionID); err != nil {
+		return err
+	}
 
 	log.Info().
 		Str("session_id", sessionID).
@@ -213,13 +329,8 @@ func (sm *SessionManager) CancelUpload(ctx context.Context, sessionID string) er
 }
 
 // GetUploadStatus returns the current status of an upload session
-func (sm *SessionManager) GetUploadStatus(sessionID string) (*UploadSession, error) {
-	session, exists := sm.GetSession(sessionID)
-	if !exists {
-		return nil, fmt.Errorf("upload session not found")
-	}
-
-	return session, nil
+func (sm *SessionManager) GetUploadStatus(ctx context.Context, sessionID string) (*UploadSession, error) {
+	return sm.store.Get(ctx, sessionID)
 }
 
 // cleanupRoutine periodically cleans up expired sessions
@@ -228,41 +339,43 @@ func (sm *SessionManager) cleanupRoutine() {
 	defer ticker.Stop()
 
 	for range ticker.C {
-		sm.cleanupExpiredSessions()
+		sm.cleanupExpiredSessions(context.Background())
 	}
 }
 
-// cleanupExpiredSessions removes sessions that have been inactive for too long
-func (sm *SessionManager) cleanupExpiredSessions() {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-
-	expiry := time.Now().Add(-24 * time.Hour) // Sessions expire after 24 hours
-	var expiredSessions []string
-
-	for sessionID, session := range sm.sessions {
-		session.mu.RLock()
-		lastUpdate := session.LastUpdate
-		tempPath := session.TempPath
-		session.mu.RUnlock()
+// cleanupExpiredSessions removes the content of sessions that expired after
+// going too long without a chunk. The session store expires the sessions
+// themselves, so content is removed once its session is gone, whichever
+// instance it was uploaded to.
+func (sm *SessionManager) cleanupExpiredSessions(ctx context.Context) {
+	paths, err := sm.storage.List(ctx, sessionTempPrefix)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list upload session content")
+		return
+	}
 
-		if lastUpdate.Before(expiry) {
-			expiredSessions = append(expiredSessions, sessionID)
-			// Clean up temp file
-			sm.storage.Delete(context.Background(), tempPath)
+	removed := 0
+	for _, tempPath := range paths {
+		// Parts are named after their session, followed by a part ID
+		sessionID, _, _ := strings.Cut(path.Base(tempPath), ".")
+		if _, err := sm.store.Get(ctx, sessionID); !errors.Is(err, ErrUploadUnknown) {
+			continue
 		}
-	}
 
-	for _, sessionID := range expiredSessions {
-		delete(sm.sessions, sessionID)
+		if err := sm.storage.Delete(ctx, tempPath); err != nil {
+			log.Warn().Err(err).Str("path", tempPath).Msg("Failed to remove expired upload session content")
+			continue
+		}
+		removed++
 		log.Info().
 			Str("session_id", sessionID).
-			Msg("Cleaned up expired upload session")
+			Str("path", tempPath).
+			Msg("Cleaned up expired upload session content")
 	}
 
-	if len(expiredSessions) > 0 {
+	if removed > 0 {
 		log.Info().
-			Int("count", len(expiredSessions)).
-			Msg("Cleaned up expired upload sessions")
+			Int("count", removed).
+			Msg("Cleaned up expired upload session parts")
 	}
 }
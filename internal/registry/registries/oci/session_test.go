@@ -0,0 +1,341 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockSessionCache is an in-memory stand-in for Redis shared by several
+// registries, each playing a gateway instance
+type mockSessionCache struct {
+	mu      sync.Mutex
+	values  map[string]mockCacheValue
+	now     time.Time
+	lastTTL time.Duration
+}
+
+type mockCacheValue struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+func newMockSessionCache() *mockSessionCache {
+	return &mockSessionCache{values: make(map[string]mockCacheValue), now: time.Now()}
+}
+
+func (m *mockSessionCache) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = mockCacheValue{data: data, expiresAt: m.now.Add(expiration)}
+	m.lastTTL = expiration
+	return nil
+}
+
+func (m *mockSessionCache) Get(ctx context.Context, key string, dest interface{}) error {
+	m.mu.Lock()
+	value, ok := m.live(key)
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", common.ErrCacheMiss, key)
+	}
+	return json.Unmarshal(value.data, dest)
+}
+
+func (m *mockSessionCache) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+func (m *mockSessionCache) SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.live(key); ok {
+		return false, nil
+	}
+	m.values[key] = mockCacheValue{data: []byte(value), expiresAt: m.now.Add(expiration)}
+	return true, nil
+}
+
+func (m *mockSessionCache) CompareAndDelete(ctx context.Context, key, value string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored, ok := m.live(key); !ok || string(stored.data) != value {
+		return false, nil
+	}
+	delete(m.values, key)
+	return true, nil
+}
+
+// live returns a value that has not expired; the caller holds m.mu
+func (m *mockSessionCache) live(key string) (mockCacheValue, bool) {
+	value, ok := m.values[key]
+	if !ok || !m.now.Before(value.expiresAt) {
+		return mockCacheValue{}, false
+	}
+	return value, true
+}
+
+func (m *mockSessionCache) advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = m.now.Add(d)
+}
+
+// newTestNodes returns registries sharing storage and an upload session
+// cache, as gateway instances behind a load balancer do
+func newTestNodes(t *testing.T, cache SessionCache) (*Registry, *Registry, storage.BlobStorage) {
+	t.Helper()
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	nodeA, nodeB := New(localStorage, nil), New(localStorage, nil)
+	nodeA.SetUploadSessionStore(NewCacheSessionStore(cache))
+	nodeB.SetUploadSessionStore(NewCacheSessionStore(cache))
+	return nodeA, nodeB, localStorage
+}
+
+func TestUploadSession_ChunksAcrossNodes(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockSessionCache()
+	nodeA, nodeB, blobStorage := newTestNodes(t, cache)
+
+	session, err := nodeA.StartBlobUpload(ctx, "myorg/app", "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultUploadSessionTTL, cache.lastTTL)
+
+	session, err = nodeB.AppendBlobChunk(ctx, session.ID, strings.NewReader("hello "), "0-5")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), session.Size)
+
+	session, err = nodeA.AppendBlobChunk(ctx, session.ID, strings.NewReader("shared "), "6-12")
+	require.NoError(t, err)
+	assert.Equal(t, int64(13), session.Size)
+
+	// A chunk replayed on another node is refused with the size so far
+	replayed, err := nodeB.AppendBlobChunk(ctx, session.ID, strings.NewReader("hello "), "0-5")
+	assert.ErrorIs(t, err, ErrChunkOutOfOrder)
+	require.NotNil(t, replayed)
+	assert.Equal(t, int64(13), replayed.Size)
+
+	_, err = nodeB.AppendBlobChunk(ctx, session.ID, strings.NewReader("world"), "")
+	require.NoError(t, err)
+
+	status, err := nodeA.GetBlobUploadStatus(ctx, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(18), status.Size)
+	assert.Equal(t, "myorg/app", status.Repository)
+	assert.Equal(t, "user-1", status.UserID)
+
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("hello shared world")))
+	completed, storagePath, err := nodeA.CompleteBlobUpload(ctx, session.ID, digest)
+	require.NoError(t, err)
+	assert.Equal(t, digest, completed.Digest)
+
+	reader, err := blobStorage.Retrieve(ctx, storagePath)
+	require.NoError(t, err)
+	content, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "hello shared world", string(content))
+
+	// The session ends on every node once it completes
+	_, err = nodeB.GetBlobUploadStatus(ctx, session.ID)
+	assert.ErrorIs(t, err, ErrUploadUnknown)
+	_, err = nodeB.AppendBlobChunk(ctx, session.ID, strings.NewReader("more"), "")
+	assert.ErrorIs(t, err, ErrUploadUnknown)
+}
+
+func TestUploadSession_ConcurrentChunks(t *testing.T) {
+	ctx := context.Background()
+	nodeA, nodeB, _ := newTestNodes(t, newMockSessionCache())
+
+	session, err := nodeA.StartBlobUpload(ctx, "myorg/app", "user-1")
+	require.NoError(t, err)
+
+	// The same chunk sent to both nodes at once is appended only once
+	const attempts = 8
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := range attempts {
+		node := nodeA
+		if i%2 == 1 {
+			node = nodeB
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := node.AppendBlobChunk(ctx, session.ID, strings.NewReader("chunk"), "0-4")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	succeeded := 0
+	for err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrChunkOutOfOrder)
+	}
+	assert.Equal(t, 1, succeeded)
+
+	status, err := nodeB.GetBlobUploadStatus(ctx, session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), status.Size)
+}
+
+func TestUploadSession_Cancel(t *testing.T) {
+	ctx := context.Background()
+	nodeA, nodeB, blobStorage := newTestNodes(t, newMockSessionCache())
+
+	session, err := nodeA.StartBlobUpload(ctx, "myorg/app", "user-1")
+	require.NoError(t, err)
+	_, err = nodeA.AppendBlobChunk(ctx, session.ID, strings.NewReader("partial"), "")
+	require.NoError(t, err)
+
+	require.NoError(t, nodeB.CancelBlobUpload(ctx, session.ID))
+	parts, err := blobStorage.List(ctx, sessionTempPrefix)
+	require.NoError(t, err)
+	assert.Empty(t, parts)
+
+	_, err = nodeA.GetBlobUploadStatus(ctx, session.ID)
+	assert.ErrorIs(t, err, ErrUploadUnknown)
+	assert.ErrorIs(t, nodeA.CancelBlobUpload(ctx, session.ID), ErrUploadUnknown)
+}
+
+func TestUploadSession_Expiry(t *testing.T) {
+	ctx := context.Background()
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	cache := newMockSessionCache()
+	memory := NewMemorySessionStore().(*memorySessionStore)
+	memory.now = func() time.Time {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		return cache.now
+	}
+
+	for name, store := range map[string]SessionStore{
+		"cache":  NewCacheSessionStore(cache),
+		"memory": memory,
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := New(localStorage, nil)
+			r.SetUploadSessionStore(store)
+			r.SetUploadSessionTTL(time.Hour)
+
+			abandoned, err := r.StartBlobUpload(ctx, "myorg/app", "user-1")
+			require.NoError(t, err)
+			abandoned, err = r.AppendBlobChunk(ctx, abandoned.ID, strings.NewReader("abandoned"), "")
+			require.NoError(t, err)
+
+			cache.advance(30 * time.Minute)
+			active, err := r.StartBlobUpload(ctx, "myorg/app", "user-1")
+			require.NoError(t, err)
+			active, err = r.AppendBlobChunk(ctx, active.ID, strings.NewReader("active"), "")
+			require.NoError(t, err)
+
+			// Each chunk extends a session's lifetime
+			cache.advance(45 * time.Minute)
+			_, err = r.GetBlobUploadStatus(ctx, abandoned.ID)
+			assert.ErrorIs(t, err, ErrUploadUnknown)
+			_, err = r.GetBlobUploadStatus(ctx, active.ID)
+			require.NoError(t, err)
+
+			// Only the content of expired sessions is removed
+			r.sessionManager.cleanupExpiredSessions(ctx)
+			exists, err := localStorage.Exists(ctx, abandoned.Parts[0])
+			require.NoError(t, err)
+			assert.False(t, exists)
+			exists, err = localStorage.Exists(ctx, active.Parts[0])
+			require.NoError(t, err)
+			assert.True(t, exists)
+
+			require.NoError(t, r.CancelBlobUpload(ctx, active.ID))
+		})
+	}
+}
+
+func TestCacheSessionStore_LockReleasesOnlyItsOwn(t *testing.T) {
+	ctx := context.Background()
+	cache := newMockSessionCache()
+	store := NewCacheSessionStore(cache)
+
+	unlockStale, err := store.Lock(ctx, "session-1")
+	require.NoError(t, err)
+
+	// The first holder stalls past the lock timeout and another takes over
+	cache.advance(sessionLockTimeout)
+	unlock, err := store.Lock(ctx, "session-1")
+	require.NoError(t, err)
+
+	// Releasing the stale lock leaves the current holder's in place
+	unlockStale()
+	acquired, err := cache.SetNX(ctx, sessionLockPrefix+"session-1", "other", sessionLockTimeout)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	unlock()
+	acquired, err = cache.SetNX(ctx, sessionLockPrefix+"session-1", "other", sessionLockTimeout)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+}
+
+func TestUploadSession_ChunksStoredAsParts(t *testing.T) {
+	ctx := context.Background()
+	nodeA, nodeB, blobStorage := newTestNodes(t, newMockSessionCache())
+
+	session, err := nodeA.StartBlobUpload(ctx, "myorg/app", "user-1")
+	require.NoError(t, err)
+	session, err = nodeA.AppendBlobChunk(ctx, session.ID, strings.NewReader("first "), "0-5")
+	require.NoError(t, err)
+
+	// A chunk shorter than its range is not kept
+	_, err = nodeB.AppendBlobChunk(ctx, session.ID, strings.NewReader("short"), "6-11")
+	assert.ErrorIs(t, err, ErrContentRangeInvalid)
+	parts, err := blobStorage.List(ctx, sessionTempPrefix)
+	require.NoError(t, err)
+	assert.Equal(t, session.Parts, parts)
+
+	session, err = nodeB.AppendBlobChunk(ctx, session.ID, strings.NewReader("second"), "6-11")
+	require.NoError(t, err)
+	assert.Len(t, session.Parts, 2)
+
+	content := "first second"
+	sum := sha256.Sum256([]byte(content))
+	_, finalPath, err := nodeA.CompleteBlobUpload(ctx, session.ID, fmt.Sprintf("sha256:%x", sum))
+	require.NoError(t, err)
+
+	reader, err := blobStorage.Retrieve(ctx, finalPath)
+	require.NoError(t, err)
+	defer reader.Close()
+	stored, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(stored))
+
+	// The parts are removed once joined
+	parts, err = blobStorage.List(ctx, sessionTempPrefix)
+	require.NoError(t, err)
+	assert.Empty(t, parts)
+}
@@ -0,0 +1,214 @@
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// sessionKeyPrefix prefixes the cache keys of upload sessions
+	sessionKeyPrefix = "oci:upload:"
+
+	// sessionLockPrefix prefixes the cache keys locking upload sessions
+	sessionLockPrefix = "oci:upload-lock:"
+
+	// sessionLockTimeout bounds how long a session stays locked, should the
+	// instance holding the lock fail before releasing it
+	sessionLockTimeout = 5 * time.Minute
+
+	// sessionLockRetry is how often a locked session is retried
+	sessionLockRetry = 20 * time.Millisecond
+)
+
+// SessionStore holds the state of upload sessions. Gateway instances behind a
+// load balancer must share one, since the chunks of an upload can arrive at
+// any of them.
+type SessionStore interface {
+	// Get returns a session, or ErrUploadUnknown if it does not exist or has
+	// expired
+	Get(ctx context.Context, sessionID string) (*UploadSession, error)
+
+	// Save stores a session, which expires if it is not saved again within ttl
+	Save(ctx context.Context, session *UploadSession, ttl time.Duration) error
+
+	// Delete removes a session
+	Delete(ctx context.Context, sessionID string) error
+
+	// Lock waits until no other request, on any instance, holds the session,
+	// and returns a function releasing it
+	Lock(ctx context.Context, sessionID string) (func(), error)
+}
+
+// memorySessionStore keeps upload sessions in memory, for single instance
+// deployments
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]memorySession
+	locks    map[string]*sync.Mutex
+	now      func() time.Time
+}
+
+// memorySession is an upload session held in memory and when it expires
+type memorySession struct {
+	session   UploadSession
+	expiresAt time.Time
+}
+
+// NewMemorySessionStore creates a session store that keeps sessions in memory
+func NewMemorySessionStore() SessionStore {
+	return &memorySessionStore{
+		sessions: make(map[string]memorySession),
+		locks:    make(map[string]*sync.Mutex),
+		now:      time.Now,
+	}
+}
+
+func (s *memorySessionStore) Get(ctx context.Context, sessionID string) (*UploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, exists := s.sessions[sessionID]
+	if !exists || !s.now().Before(stored.expiresAt) {
+		return nil, ErrUploadUnknown
+	}
+	session := stored.session
+	return &session, nil
+}
+
+func (s *memorySessionStore) Save(ctx context.Context, session *UploadSession, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Expired sessions are dropped as others are saved, since nothing else
+	// removes sessions that were abandoned
+	now := s.now()
+	for id, stored := range s.sessions {
+		if !now.Before(stored.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+
+	s.sessions[session.ID] = memorySession{session: *session, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *memorySessionStore) Delete(ctx context.Context, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+	delete(s.locks, sessionID)
+	return nil
+}
+
+func (s *memorySessionStore) Lock(ctx context.Context, sessionID string) (func(), error) {
+	s.mu.Lock()
+	lock, exists := s.locks[sessionID]
+	if !exists {
+		lock = &sync.Mutex{}
+		s.locks[sessionID] = lock
+	}
+	s.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock, nil
+}
+
+// SessionCache is the shared cache upload sessions are kept in. It is
+// implemented by common.Cache.
+type SessionCache interface {
+	// Set stores a value as JSON, expiring after expiration
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+
+	// Get unmarshals a value into dest, returning an error wrapping
+	// common.ErrCacheMiss if it does not exist
+	Get(ctx context.Context, key string, dest interface{}) error
+
+	// Delete removes a value
+	Delete(ctx context.Context, key string) error
+
+	// SetNX stores a value only if the key does not exist, reporting whether
+	// it was stored
+	SetNX(ctx context.Context, key, value string, expiration time.Duration) (bool, error)
+
+	// CompareAndDelete removes a value set by SetNX only if the key still
+	// holds it, reporting whether it was removed
+	CompareAndDelete(ctx context.Context, key, value string) (bool, error)
+}
+
+// cacheSessionStore keeps upload sessions in a cache shared by every gateway
+// instance, keyed by session ID
+type cacheSessionStore struct {
+	cache SessionCache
+}
+
+// NewCacheSessionStore creates a session store that keeps sessions in a
+// shared cache such as Redis, so uploads can be spread across instances
+func NewCacheSessionStore(cache SessionCache) SessionStore {
+	return &cacheSessionStore{cache: cache}
+}
+
+func (s *cacheSessionStore) Get(ctx context.Context, sessionID string) (*UploadSession, error) {
+	var session UploadSession
+	if err := s.cache.Get(ctx, sessionKeyPrefix+sessionID, &session); err != nil {
+		if errors.Is(err, common.ErrCacheMiss) {
+			return nil, ErrUploadUnknown
+		}
+		return nil, fmt.Errorf("failed to get upload session: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *cacheSessionStore) Save(ctx context.Context, session *UploadSession, ttl time.Duration) error {
+	if err := s.cache.Set(ctx, sessionKeyPrefix+session.ID, session, ttl); err != nil {
+		return fmt.Errorf("failed to save upload session: %w", err)
+	}
+	return nil
+}
+
+func (s *cacheSessionStore) Delete(ctx context.Context, sessionID string) error {
+	if err := s.cache.Delete(ctx, sessionKeyPrefix+sessionID); err != nil {
+		return fmt.Errorf("failed to delete upload session: %w", err)
+	}
+	return nil
+}
+
+func (s *cacheSessionStore) Lock(ctx context.Context, sessionID string) (func(), error) {
+	// Each holder marks the lock with its own token, so that releasing a lock
+	// that timed out does not release another holder's
+	token := uuid.New().String()
+	key := sessionLockPrefix + sessionID
+	for {
+		acquired, err := s.cache.SetNX(ctx, key, token, sessionLockTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock upload session: %w", err)
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(sessionLockRetry):
+		}
+	}
+
+	return func() {
+		// The request may have been cancelled, which must not leave the
+		// session locked
+		released, err := s.cache.CompareAndDelete(context.WithoutCancel(ctx), key, token)
+		if err != nil {
+			log.Warn().Err(err).Str("session_id", sessionID).Msg("Failed to unlock upload session")
+		} else if !released {
+			log.Warn().Str("session_id", sessionID).Msg("Upload session lock timed out before it was released")
+		}
+	}, nil
+}
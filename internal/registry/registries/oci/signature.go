@@ -0,0 +1,115 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/signing"
+)
+
+// CosignSignatureAnnotation is the layer annotation holding the base64
+// signature of a cosign signature payload
+const CosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+// ErrSignatureNotFound is returned when no signature artifact made by a
+// trusted key refers to a manifest
+var ErrSignatureNotFound = errors.New("no trusted signature found for manifest")
+
+// signatureManifest is the part of a signature artifact's manifest holding
+// its signatures
+type signatureManifest struct {
+	Layers []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// cosignPayload is the simple signing payload cosign signs, naming the
+// manifest digest the signature is for
+type cosignPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+	} `json:"critical"`
+}
+
+// IsSignatureTag reports whether a tag follows cosign's scheme for naming the
+// signature, attestation and SBOM artifacts of a manifest, sha256-<hex>.sig
+func IsSignatureTag(reference string) bool {
+	for _, suffix := range []string{".sig", ".att", ".sbom"} {
+		if strings.HasPrefix(reference, "sha256-") && strings.HasSuffix(reference, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyCosignSignature looks for a cosign signature of the manifest with the
+// given digest made by a key in the keyring. Signature artifacts are found by
+// cosign's tag scheme or, for clients supporting referrers, by manifests
+// whose subject is the signed manifest.
+func (r *Registry) VerifyCosignSignature(ctx context.Context, repository, digest string, keyring *signing.Keyring) (*signing.Verification, error) {
+	candidates := []string{strings.Replace(digest, ":", "-", 1) + ".sig"}
+
+	referrers, err := r.ListReferrers(ctx, repository, digest, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, referrer := range referrers {
+		candidates = append(candidates, referrer.Digest)
+	}
+
+	for _, reference := range candidates {
+		data, err := r.readManifest(ctx, repository, reference)
+		if err != nil {
+			continue
+		}
+		var manifest signatureManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			continue
+		}
+		if verification := r.verifySignatureLayers(ctx, repository, digest, &manifest, keyring); verification != nil {
+			return verification, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w %s", ErrSignatureNotFound, digest)
+}
+
+// verifySignatureLayers checks each signed layer of a signature artifact,
+// returning the first verification of a payload for the digest made by a
+// trusted key
+func (r *Registry) verifySignatureLayers(ctx context.Context, repository, digest string, manifest *signatureManifest, keyring *signing.Keyring) *signing.Verification {
+	for _, layer := range manifest.Layers {
+		signature, ok := layer.Annotations[CosignSignatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		reader, _, err := r.GetBlob(ctx, repository, layer.Digest)
+		if err != nil {
+			continue
+		}
+		payload, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			continue
+		}
+
+		// A valid signature for another manifest must not be accepted
+		var parsed cosignPayload
+		if err := json.Unmarshal(payload, &parsed); err != nil || parsed.Critical.Image.DockerManifestDigest != digest {
+			continue
+		}
+
+		if verification, err := signing.Verify(payload, []byte(signature), keyring); err == nil {
+			return verification
+		}
+	}
+	return nil
+}
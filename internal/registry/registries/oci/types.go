@@ -1,28 +1,30 @@
 package oci
 
 import (
-	"sync"
 	"time"
 
 	"github.com/lgulliver/lodestone/internal/storage"
 )
 
-// UploadSession represents an active blob upload session
+// UploadSession represents an active blob upload session. Sessions are kept
+// in a SessionStore, so every gateway instance sees the same state.
 type UploadSession struct {
-	ID         string
-	Repository string
-	UserID     string
-	StartedAt  time.Time
-	LastUpdate time.Time
-	Size       int64
-	Digest     string
-	TempPath   string
-	mu         sync.RWMutex
+	ID         string    `json:"id"`
+	Repository string    `json:"repository"`
+	UserID     string    `json:"user_id"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUpdate time.Time `json:"last_update"`
+	Size       int64     `json:"size"`
+	Digest     string    `json:"digest,omitempty"`
+	TempPath   string    `json:"temp_path"`
+	// Parts are where the chunks uploaded so far are stored, in order. Each
+	// is stored beside TempPath until the upload completes.
+	Parts []string `json:"parts,omitempty"`
 }
 
 // SessionManager manages blob upload sessions
 type SessionManager struct {
-	sessions map[string]*UploadSession
-	storage  storage.BlobStorage
-	mu       sync.RWMutex
+	store   SessionStore
+	storage storage.BlobStorage
+	ttl     time.Duration
 }
@@ -0,0 +1,39 @@
+package opa
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/open-policy-agent/opa/v1/ast"
+	"github.com/open-policy-agent/opa/v1/bundle"
+)
+
+// ErrInvalidBundle is returned for bundles that cannot be read, whose
+// manifest roots do not cover their contents, or whose policies do not
+// compile
+var ErrInvalidBundle = errors.New("invalid OPA bundle")
+
+// validateBundle reads a gzipped bundle the way OPA loads it and compiles its
+// rego modules together. Reading checks that the roots declared in a .manifest
+// do not overlap and cover every policy and data file. Bundle signatures are
+// not verified, since the registry holds no keys to verify them with.
+func validateBundle(content []byte) error {
+	b, err := bundle.NewReader(bytes.NewReader(content)).
+		WithSkipBundleVerification(true).
+		Read()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	modules := make(map[string]*ast.Module, len(b.Modules))
+	for _, module := range b.Modules {
+		modules[module.Path] = module.Parsed
+	}
+
+	compiler := ast.NewCompiler()
+	if compiler.Compile(modules); compiler.Failed() {
+		return fmt.Errorf("%w: %v", ErrInvalidBundle, compiler.Errors)
+	}
+	return nil
+}
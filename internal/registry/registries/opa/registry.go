@@ -12,18 +12,27 @@ import (
 
 // Registry implements the Open Policy Agent bundle registry
 type Registry struct {
-	storage storage.BlobStorage
-	db      *common.Database
+	storage         storage.BlobStorage
+	db              *common.Database
+	validateBundles bool
 }
 
 // New creates a new OPA registry handler
 func New(storage storage.BlobStorage, db *common.Database) *Registry {
 	return &Registry{
-		storage: storage,
-		db:      db,
+		storage:         storage,
+		db:              db,
+		validateBundles: true,
 	}
 }
 
+// SetBundleValidation enables or disables reading uploaded bundles and
+// compiling their policies before they are accepted. Teams pushing bundles
+// the registry should treat as opaque can disable it.
+func (r *Registry) SetBundleValidation(enabled bool) {
+	r.validateBundles = enabled
+}
+
 // Upload stores an OPA bundle
 func (r *Registry) Upload(ctx context.Context, artifact *types.Artifact, content []byte) error {
 	// Store the content
@@ -51,14 +60,17 @@ func (r *Registry) Delete(name, version string) error {
 	return fmt.Errorf("use service.Delete instead")
 }
 
-// Validate checks if the artifact is a valid OPA bundle
+// Validate checks if the artifact is a valid OPA bundle: its manifest roots
+// cover its contents and its policies compile
 func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 	if len(content) == 0 {
 		return fmt.Errorf("empty bundle content")
 	}
 
-	// TODO: Validate bundle structure (should contain .rego files and optional manifest)
-	return nil
+	if !r.validateBundles {
+		return nil
+	}
+	return validateBundle(content)
 }
 
 // GetMetadata extracts metadata from OPA bundle
@@ -0,0 +1,127 @@
+package opa
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createBundle builds a gzipped bundle tarball holding the given files
+func createBundle(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+const validPolicy = `package authz
+
+default allow := false
+
+allow if {
+	input.user == data.authz.admins[_]
+}
+`
+
+func TestValidate_ValidBundle(t *testing.T) {
+	r := New(nil, nil)
+	artifact := &types.Artifact{Name: "authz", Version: "1.0.0"}
+
+	tests := map[string]map[string]string{
+		"policy": {"authz/policy.rego": validPolicy},
+		"policy with data and manifest": {
+			"authz/policy.rego": validPolicy,
+			"authz/data.json":   `{"admins": ["alice"]}`,
+			".manifest":         `{"revision": "1", "roots": ["authz"]}`,
+		},
+		"rego v0 declared in manifest": {
+			"authz/policy.rego": "package authz\n\nallow { input.user == \"alice\" }\n",
+			".manifest":         `{"roots": ["authz"], "rego_version": 0}`,
+		},
+	}
+
+	for name, files := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, r.Validate(artifact, createBundle(t, files)))
+		})
+	}
+}
+
+func TestValidate_InvalidBundle(t *testing.T) {
+	r := New(nil, nil)
+	artifact := &types.Artifact{Name: "authz", Version: "1.0.0"}
+
+	tests := []struct {
+		name     string
+		content  []byte
+		expected string
+	}{
+		{
+			name:     "syntax error",
+			content:  createBundle(t, map[string]string{"authz/policy.rego": "package authz\n\nallow if {\n\tinput.user ==\n"}),
+			expected: "authz/policy.rego:",
+		},
+		{
+			name:     "compile error",
+			content:  createBundle(t, map[string]string{"authz/policy.rego": "package authz\n\nallow if {\n\tinput.user == user\n}\n"}),
+			expected: "var user is unsafe",
+		},
+		{
+			name:     "rego v0 without manifest",
+			content:  createBundle(t, map[string]string{"authz/policy.rego": "package authz\n\nallow { input.user == \"alice\" }\n"}),
+			expected: "`if` keyword is required",
+		},
+		{
+			name: "policy outside manifest roots",
+			content: createBundle(t, map[string]string{
+				"authz/policy.rego": validPolicy,
+				".manifest":         `{"roots": ["billing"]}`,
+			}),
+			expected: "do not permit",
+		},
+		{
+			name: "overlapping manifest roots",
+			content: createBundle(t, map[string]string{
+				"authz/policy.rego": validPolicy,
+				".manifest":         `{"roots": ["authz", "authz/admin"]}`,
+			}),
+			expected: "overlapped roots",
+		},
+		{
+			name:     "not a bundle",
+			content:  []byte("package authz"),
+			expected: "invalid OPA bundle",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.Validate(artifact, tt.content)
+			assert.ErrorIs(t, err, ErrInvalidBundle)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestValidate_BundleValidationDisabled(t *testing.T) {
+	r := New(nil, nil)
+	r.SetBundleValidation(false)
+	artifact := &types.Artifact{Name: "authz", Version: "1.0.0"}
+
+	assert.NoError(t, r.Validate(artifact, []byte("opaque bundle")))
+	assert.Error(t, r.Validate(artifact, nil))
+}
@@ -0,0 +1,338 @@
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	leadSize        = 96
+	headerIntroSize = 16
+	indexEntrySize  = 16
+
+	// maxIndexEntries and maxStoreSize bound the header of an untrusted package
+	maxIndexEntries = 1 << 16
+	maxStoreSize    = 64 << 20
+)
+
+var (
+	leadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// header is a parsed RPM header structure: an index of tagged entries
+// pointing into a data store
+type header struct {
+	entries map[int32]indexEntry
+	store   []byte
+}
+
+type indexEntry struct {
+	dataType int32
+	offset   int32
+	count    int32
+}
+
+// readHeader parses the header starting at offset and returns it with the
+// offset of the first byte after it
+func readHeader(content []byte, offset int) (*header, int, error) {
+	if offset+headerIntroSize > len(content) {
+		return nil, 0, fmt.Errorf("truncated RPM header")
+	}
+	if !bytes.Equal(content[offset:offset+4], headerMagic) {
+		return nil, 0, fmt.Errorf("invalid RPM header magic")
+	}
+
+	count := binary.BigEndian.Uint32(content[offset+8:])
+	storeSize := binary.BigEndian.Uint32(content[offset+12:])
+	if count > maxIndexEntries || storeSize > maxStoreSize {
+		return nil, 0, fmt.Errorf("RPM header too large")
+	}
+
+	indexStart := offset + headerIntroSize
+	storeStart := indexStart + int(count)*indexEntrySize
+	end := storeStart + int(storeSize)
+	if end > len(content) {
+		return nil, 0, fmt.Errorf("truncated RPM header")
+	}
+
+	h := &header{
+		entries: make(map[int32]indexEntry, count),
+		store:   content[storeStart:end],
+	}
+	for i := 0; i < int(count); i++ {
+		entry := content[indexStart+i*indexEntrySize:]
+		h.entries[int32(binary.BigEndian.Uint32(entry))] = indexEntry{
+			dataType: int32(binary.BigEndian.Uint32(entry[4:])),
+			offset:   int32(binary.BigEndian.Uint32(entry[8:])),
+			count:    int32(binary.BigEndian.Uint32(entry[12:])),
+		}
+	}
+
+	return h, end, nil
+}
+
+// stringArray returns the values of a string, string array or i18n string tag
+func (h *header) stringArray(tag int32) []string {
+	entry, ok := h.entries[tag]
+	if !ok || entry.offset < 0 || int(entry.offset) > len(h.store) {
+		return nil
+	}
+
+	count := int(entry.count)
+	switch entry.dataType {
+	case typeString:
+		count = 1
+	case typeStringArray, typeI18NString:
+	default:
+		return nil
+	}
+
+	var values []string
+	data := h.store[entry.offset:]
+	for i := 0; i < count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end == -1 {
+			break
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+	return values
+}
+
+// stringValue returns the first value of a string tag
+func (h *header) stringValue(tag int32) string {
+	values := h.stringArray(tag)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// intArray returns the values of an integer tag
+func (h *header) intArray(tag int32) []int64 {
+	entry, ok := h.entries[tag]
+	if !ok || entry.offset < 0 || entry.count < 0 {
+		return nil
+	}
+
+	var width int
+	switch entry.dataType {
+	case typeInt16:
+		width = 2
+	case typeInt32:
+		width = 4
+	case typeInt64:
+		width = 8
+	default:
+		return nil
+	}
+
+	start := int(entry.offset)
+	if start+int(entry.count)*width > len(h.store) {
+		return nil
+	}
+
+	values := make([]int64, entry.count)
+	for i := range values {
+		data := h.store[start+i*width:]
+		switch width {
+		case 2:
+			values[i] = int64(binary.BigEndian.Uint16(data))
+		case 4:
+			values[i] = int64(binary.BigEndian.Uint32(data))
+		case 8:
+			values[i] = int64(binary.BigEndian.Uint64(data))
+		}
+	}
+	return values
+}
+
+// intValue returns the first value of an integer tag, or false if it is absent
+func (h *header) intValue(tag int32) (int64, bool) {
+	values := h.intArray(tag)
+	if len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
+
+// ReadPackage parses the lead, signature and main headers of an RPM file and
+// returns the package metadata
+func ReadPackage(content []byte) (*Package, error) {
+	if len(content) < leadSize || !bytes.Equal(content[:4], leadMagic) {
+		return nil, fmt.Errorf("not an RPM package: missing lead")
+	}
+	if binary.BigEndian.Uint16(content[6:]) != 0 {
+		return nil, fmt.Errorf("source RPMs are not supported")
+	}
+
+	_, signatureEnd, err := readHeader(content, leadSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature header: %w", err)
+	}
+
+	// The main header is aligned to an eight byte boundary
+	headerStart := (signatureEnd + 7) &^ 7
+	h, headerEnd, err := readHeader(content, headerStart)
+	if err != nil {
+		return nil, fmt.Errorf("invalid main header: %w", err)
+	}
+
+	pkg := &Package{
+		Name:        h.stringValue(tagName),
+		Epoch:       "0",
+		Version:     h.stringValue(tagVersion),
+		Release:     h.stringValue(tagRelease),
+		Arch:        h.stringValue(tagArch),
+		Summary:     h.stringValue(tagSummary),
+		Description: h.stringValue(tagDescription),
+		URL:         h.stringValue(tagURL),
+		License:     h.stringValue(tagLicense),
+		Vendor:      h.stringValue(tagVendor),
+		Group:       h.stringValue(tagGroup),
+		Packager:    h.stringValue(tagPackager),
+		BuildHost:   h.stringValue(tagBuildHost),
+		SourceRPM:   h.stringValue(tagSourceRPM),
+		HeaderStart: int64(headerStart),
+		HeaderEnd:   int64(headerEnd),
+	}
+	if pkg.Name == "" || pkg.Version == "" || pkg.Release == "" {
+		return nil, fmt.Errorf("RPM header must contain name, version and release")
+	}
+
+	if epoch, ok := h.intValue(tagEpoch); ok {
+		pkg.Epoch = fmt.Sprintf("%d", epoch)
+	}
+	pkg.BuildTime, _ = h.intValue(tagBuildTime)
+	if size, ok := h.intValue(tagLongSize); ok {
+		pkg.InstalledSize = size
+	} else {
+		pkg.InstalledSize, _ = h.intValue(tagSize)
+	}
+	pkg.ArchiveSize, _ = h.intValue(tagArchiveSize)
+
+	pkg.Provides = h.dependencies(tagProvideName, tagProvideFlags, tagProvideVer)
+	pkg.Requires = h.dependencies(tagRequireName, tagRequireFlags, tagRequireVer)
+	pkg.Conflicts = h.dependencies(tagConflictName, tagConflictFlags, tagConflictVer)
+	pkg.Obsoletes = h.dependencies(tagObsoleteName, tagObsoleteFlags, tagObsoleteVer)
+	pkg.Files = h.files()
+	pkg.Changelogs = h.changelogs()
+
+	return pkg, nil
+}
+
+// dependencies reads a dependency list from its name, flags and version tags
+func (h *header) dependencies(nameTag, flagsTag, versionTag int32) []Dependency {
+	names := h.stringArray(nameTag)
+	flags := h.intArray(flagsTag)
+	versions := h.stringArray(versionTag)
+
+	seen := make(map[Dependency]bool)
+	var deps []Dependency
+	for i, name := range names {
+		// rpmlib() capabilities are provided by rpm itself
+		if strings.HasPrefix(name, "rpmlib(") {
+			continue
+		}
+
+		dep := Dependency{Name: name}
+		var flag int64
+		if i < len(flags) {
+			flag = flags[i]
+		}
+		if i < len(versions) && versions[i] != "" {
+			dep.Flags = senseName(flag)
+			dep.Epoch, dep.Version, dep.Release = splitEVR(versions[i])
+		}
+		dep.Pre = flag&(sensePrereq|senseScriptPre|senseScriptPost) != 0
+
+		if seen[dep] {
+			continue
+		}
+		seen[dep] = true
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// files reads the file list, from the compressed basename/dirname form or
+// the legacy full path form
+func (h *header) files() []File {
+	paths := h.stringArray(tagOldFilenames)
+	if baseNames := h.stringArray(tagBaseNames); len(baseNames) > 0 {
+		dirNames := h.stringArray(tagDirNames)
+		dirIndexes := h.intArray(tagDirIndexes)
+		paths = make([]string, 0, len(baseNames))
+		for i, baseName := range baseNames {
+			if i >= len(dirIndexes) || dirIndexes[i] < 0 || int(dirIndexes[i]) >= len(dirNames) {
+				continue
+			}
+			paths = append(paths, dirNames[dirIndexes[i]]+baseName)
+		}
+	}
+
+	modes := h.intArray(tagFileModes)
+	flags := h.intArray(tagFileFlags)
+	files := make([]File, 0, len(paths))
+	for i, filePath := range paths {
+		file := File{Path: filePath}
+		if i < len(flags) && flags[i]&fileFlagGhost != 0 {
+			file.Type = "ghost"
+		} else if i < len(modes) && modes[i]&0170000 == 0040000 {
+			file.Type = "dir"
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// changelogs reads the changelog entries
+func (h *header) changelogs() []Changelog {
+	times := h.intArray(tagChangelogTime)
+	names := h.stringArray(tagChangelogName)
+	texts := h.stringArray(tagChangelogText)
+
+	var changelogs []Changelog
+	for i := 0; i < len(times) && i < len(names) && i < len(texts); i++ {
+		changelogs = append(changelogs, Changelog{
+			Author: names[i],
+			Date:   times[i],
+			Text:   texts[i],
+		})
+	}
+	return changelogs
+}
+
+// senseName converts dependency sense flags to the repodata notation
+func senseName(flags int64) string {
+	switch flags & (senseLess | senseGreater | senseEqual) {
+	case senseLess:
+		return "LT"
+	case senseGreater:
+		return "GT"
+	case senseEqual:
+		return "EQ"
+	case senseLess | senseEqual:
+		return "LE"
+	case senseGreater | senseEqual:
+		return "GE"
+	}
+	return ""
+}
+
+// splitEVR splits [epoch:]version[-release]
+func splitEVR(evr string) (epoch, version, release string) {
+	epoch = "0"
+	if idx := strings.IndexByte(evr, ':'); idx != -1 {
+		epoch, evr = evr[:idx], evr[idx+1:]
+	}
+	version = evr
+	if idx := strings.LastIndexByte(evr, '-'); idx != -1 {
+		version, release = evr[:idx], evr[idx+1:]
+	}
+	return epoch, version, release
+}
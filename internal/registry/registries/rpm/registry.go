@@ -0,0 +1,178 @@
+package rpm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+var (
+	// packageNameRegex matches the characters rpm accepts in package names
+	packageNameRegex = regexp.MustCompile(`^[A-Za-z0-9_+][A-Za-z0-9._+-]*$`)
+
+	// versionRegex matches [epoch:]version-release
+	versionRegex = regexp.MustCompile(`^([0-9]+:)?[A-Za-z0-9._+~^]+-[A-Za-z0-9._+~^]+$`)
+
+	// archRegex matches architecture names such as x86_64, aarch64 or noarch
+	archRegex = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// Registry implements the RPM/YUM repository format
+type Registry struct {
+	storage    storage.BlobStorage
+	db         *common.Database
+	signingKey *openpgp.Entity
+}
+
+// New creates a new RPM registry handler
+func New(storage storage.BlobStorage, db *common.Database) *Registry {
+	return &Registry{
+		storage: storage,
+		db:      db,
+	}
+}
+
+// SetSigningKey sets the OpenPGP key used to sign repomd.xml. With no key the
+// repository is served unsigned and clients must disable repo_gpgcheck.
+func (r *Registry) SetSigningKey(key *openpgp.Entity) {
+	r.signingKey = key
+}
+
+// SigningKey returns the key used to sign repomd.xml, if any
+func (r *Registry) SigningKey() *openpgp.Entity {
+	return r.signingKey
+}
+
+// Upload stores an RPM package
+func (r *Registry) Upload(ctx context.Context, artifact *types.Artifact, content []byte) error {
+	reader := bytes.NewReader(content)
+	if err := r.storage.Store(ctx, artifact.StoragePath, reader, "application/x-rpm"); err != nil {
+		return fmt.Errorf("failed to store RPM package: %w", err)
+	}
+
+	artifact.ContentType = "application/x-rpm"
+	return nil
+}
+
+// Download retrieves an RPM package
+func (r *Registry) Download(name, version string) (*types.Artifact, []byte, error) {
+	return nil, nil, fmt.Errorf("use service.Download instead")
+}
+
+// List returns RPM packages matching the filter
+func (r *Registry) List(filter *types.ArtifactFilter) ([]*types.Artifact, error) {
+	return nil, fmt.Errorf("use service.List instead")
+}
+
+// Delete removes an RPM package
+func (r *Registry) Delete(name, version string) error {
+	return fmt.Errorf("use service.Delete instead")
+}
+
+// Validate checks if the artifact is a valid binary RPM whose header matches
+// the requested name and version
+func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
+	if len(content) == 0 {
+		return fmt.Errorf("empty package content")
+	}
+
+	if !packageNameRegex.MatchString(artifact.Name) {
+		return fmt.Errorf("invalid RPM package name format")
+	}
+
+	if !versionRegex.MatchString(artifact.Version) {
+		return fmt.Errorf("invalid RPM version format, expected [epoch:]version-release")
+	}
+
+	pkg, err := ReadPackage(content)
+	if err != nil {
+		return err
+	}
+
+	if pkg.Name != artifact.Name {
+		return fmt.Errorf("package name mismatch: %s vs %s", pkg.Name, artifact.Name)
+	}
+
+	if pkg.EVR() != artifact.Version {
+		return fmt.Errorf("package version mismatch: %s vs %s", pkg.EVR(), artifact.Version)
+	}
+
+	if !archRegex.MatchString(pkg.Arch) {
+		return fmt.Errorf("invalid or missing architecture in RPM header")
+	}
+
+	return nil
+}
+
+// GetMetadata extracts the header fields the repodata indexes need from an
+// RPM package
+func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
+	pkg, err := ReadPackage(content)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := map[string]interface{}{
+		"format":       "rpm",
+		"type":         "rpm",
+		"package":      pkg,
+		"architecture": pkg.Arch,
+	}
+
+	if pkg.Summary != "" {
+		metadata["description"] = pkg.Summary
+	}
+	if pkg.License != "" {
+		metadata["license"] = pkg.License
+	}
+	if pkg.URL != "" {
+		metadata["homepage"] = pkg.URL
+	}
+
+	return metadata, nil
+}
+
+// GenerateStoragePath creates the storage path for RPM packages
+func (r *Registry) GenerateStoragePath(name, version string) string {
+	return fmt.Sprintf("rpm/Packages/%s/%s-%s.rpm", name, name, strings.ReplaceAll(version, ":", "%3a"))
+}
+
+// LocationHref returns the repository path at which dnf fetches a package,
+// e.g. Packages/hello/hello-1.0-1.x86_64.rpm
+func LocationHref(pkg *Package) string {
+	return path.Join("Packages", pkg.Name, fmt.Sprintf("%s-%s-%s.%s.rpm", pkg.Name, pkg.Version, pkg.Release, pkg.Arch))
+}
+
+// PackageFromArtifact returns the header metadata stored with an artifact. It
+// returns false if the artifact carries no RPM metadata.
+func PackageFromArtifact(artifact *types.Artifact) (*Package, bool) {
+	value, ok := artifact.Metadata["package"]
+	if !ok {
+		return nil, false
+	}
+
+	// The metadata is a *Package when freshly extracted and a generic map
+	// after a database round trip
+	if pkg, ok := value.(*Package); ok {
+		return pkg, true
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	var pkg Package
+	if err := json.Unmarshal(data, &pkg); err != nil || pkg.Name == "" {
+		return nil, false
+	}
+	return &pkg, true
+}
@@ -0,0 +1,301 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTag is a header entry for createTestRPM. Values are a string, []string,
+// []int32 or []uint16.
+type testTag struct {
+	tag      int32
+	dataType int32
+	value    interface{}
+}
+
+// encodeTestHeader builds an RPM header structure from the given entries
+func encodeTestHeader(tags []testTag) []byte {
+	var index, store bytes.Buffer
+	for _, tag := range tags {
+		var count int
+		switch v := tag.value.(type) {
+		case string:
+			count = 1
+		case []string:
+			count = len(v)
+		case []int32:
+			count = len(v)
+			for store.Len()%4 != 0 {
+				store.WriteByte(0)
+			}
+		case []uint16:
+			count = len(v)
+			for store.Len()%2 != 0 {
+				store.WriteByte(0)
+			}
+		}
+
+		binary.Write(&index, binary.BigEndian, []int32{tag.tag, tag.dataType, int32(store.Len()), int32(count)})
+
+		switch v := tag.value.(type) {
+		case string:
+			store.WriteString(v + "\x00")
+		case []string:
+			for _, s := range v {
+				store.WriteString(s + "\x00")
+			}
+		case []int32, []uint16:
+			binary.Write(&store, binary.BigEndian, v)
+		}
+	}
+
+	var header bytes.Buffer
+	header.Write(headerMagic)
+	header.Write(make([]byte, 4))
+	binary.Write(&header, binary.BigEndian, []int32{int32(len(tags)), int32(store.Len())})
+	header.Write(index.Bytes())
+	header.Write(store.Bytes())
+	return header.Bytes()
+}
+
+// createTestRPM builds a minimal binary RPM with the given main header entries
+func createTestRPM(t *testing.T, tags []testTag) []byte {
+	t.Helper()
+
+	var rpm bytes.Buffer
+	lead := make([]byte, leadSize)
+	copy(lead, leadMagic)
+	lead[4] = 3
+	copy(lead[10:], "test")
+	lead[79] = 5
+	rpm.Write(lead)
+
+	rpm.Write(encodeTestHeader([]testTag{{tag: 1000, dataType: typeInt32, value: []int32{0}}}))
+	for rpm.Len()%8 != 0 {
+		rpm.WriteByte(0)
+	}
+	rpm.Write(encodeTestHeader(tags))
+
+	var payload bytes.Buffer
+	gw := gzip.NewWriter(&payload)
+	gw.Write([]byte("payload"))
+	require.NoError(t, gw.Close())
+	rpm.Write(payload.Bytes())
+	return rpm.Bytes()
+}
+
+// testPackageTags describes a package in the shape rpmbuild produces
+func testPackageTags(name, version, release, arch string) []testTag {
+	return []testTag{
+		{tagName, typeString, name},
+		{tagVersion, typeString, version},
+		{tagRelease, typeString, release},
+		{tagSummary, typeI18NString, []string{"Greeting program"}},
+		{tagDescription, typeI18NString, []string{"Prints a friendly greeting."}},
+		{tagBuildTime, typeInt32, []int32{1700000000}},
+		{tagSize, typeInt32, []int32{2048}},
+		{tagLicense, typeString, "MIT"},
+		{tagURL, typeString, "https://example.com/hello"},
+		{tagArch, typeString, arch},
+		{tagFileModes, typeInt16, []uint16{0100755, 040755, 0100644}},
+		{tagFileFlags, typeInt32, []int32{0, 0, fileFlagGhost}},
+		{tagSourceRPM, typeString, name + "-" + version + "-" + release + ".src.rpm"},
+		{tagProvideName, typeStringArray, []string{name, name + "(x86-64)"}},
+		{tagRequireFlags, typeInt32, []int32{senseGreater | senseEqual, senseLess | senseEqual | 1<<24, senseScriptPre}},
+		{tagRequireName, typeStringArray, []string{"hello-data", "rpmlib(CompressedFileNames)", "/bin/sh"}},
+		{tagRequireVer, typeStringArray, []string{"1.0", "3.0.4-1", ""}},
+		{tagChangelogTime, typeInt32, []int32{1699900000}},
+		{tagChangelogName, typeStringArray, []string{"Dev <dev@example.com> - 1.0-1"}},
+		{tagChangelogText, typeStringArray, []string{"- Initial package"}},
+		{tagProvideFlags, typeInt32, []int32{senseEqual, senseEqual}},
+		{tagProvideVer, typeStringArray, []string{version + "-" + release, version + "-" + release}},
+		{tagDirIndexes, typeInt32, []int32{0, 1, 2}},
+		{tagBaseNames, typeStringArray, []string{name, name, "state"}},
+		{tagDirNames, typeStringArray, []string{"/usr/bin/", "/usr/share/doc/", "/var/lib/" + name + "/"}},
+	}
+}
+
+func TestReadPackage(t *testing.T) {
+	content := createTestRPM(t, testPackageTags("hello", "1.0", "1", "x86_64"))
+
+	pkg, err := ReadPackage(content)
+	require.NoError(t, err)
+
+	assert.Equal(t, "hello", pkg.Name)
+	assert.Equal(t, "0", pkg.Epoch)
+	assert.Equal(t, "1.0-1", pkg.EVR())
+	assert.Equal(t, "x86_64", pkg.Arch)
+	assert.Equal(t, "Greeting program", pkg.Summary)
+	assert.Equal(t, "MIT", pkg.License)
+	assert.Equal(t, int64(1700000000), pkg.BuildTime)
+	assert.Equal(t, int64(2048), pkg.InstalledSize)
+
+	// The main header starts after the lead and the padded signature header
+	assert.Equal(t, int64(0), pkg.HeaderStart%8)
+	assert.True(t, pkg.HeaderEnd > pkg.HeaderStart)
+	assert.True(t, pkg.HeaderEnd < int64(len(content)))
+
+	// rpmlib() requirements are dropped and flags become repodata notation
+	assert.Equal(t, []Dependency{
+		{Name: "hello-data", Flags: "GE", Epoch: "0", Version: "1.0"},
+		{Name: "/bin/sh", Pre: true},
+	}, pkg.Requires)
+	assert.Equal(t, Dependency{Name: "hello", Flags: "EQ", Epoch: "0", Version: "1.0", Release: "1"}, pkg.Provides[0])
+
+	assert.Equal(t, []File{
+		{Path: "/usr/bin/hello"},
+		{Path: "/usr/share/doc/hello", Type: "dir"},
+		{Path: "/var/lib/hello/state", Type: "ghost"},
+	}, pkg.Files)
+
+	require.Len(t, pkg.Changelogs, 1)
+	assert.Equal(t, "- Initial package", pkg.Changelogs[0].Text)
+}
+
+func TestReadPackage_Invalid(t *testing.T) {
+	_, err := ReadPackage([]byte("not an rpm"))
+	assert.ErrorContains(t, err, "not an RPM package")
+
+	content := createTestRPM(t, testPackageTags("hello", "1.0", "1", "x86_64"))
+	_, err = ReadPackage(content[:leadSize+20])
+	assert.Error(t, err)
+
+	source := append([]byte{}, content...)
+	source[7] = 1
+	_, err = ReadPackage(source)
+	assert.ErrorContains(t, err, "source RPMs are not supported")
+
+	_, err = ReadPackage(createTestRPM(t, []testTag{{tagName, typeString, "hello"}}))
+	assert.ErrorContains(t, err, "must contain name, version and release")
+}
+
+func TestValidate(t *testing.T) {
+	registry := New(nil, nil)
+	content := createTestRPM(t, testPackageTags("hello", "1.0", "1", "x86_64"))
+
+	assert.NoError(t, registry.Validate(&types.Artifact{Name: "hello", Version: "1.0-1"}, content))
+
+	err := registry.Validate(&types.Artifact{Name: "hello", Version: "1.0-2"}, content)
+	assert.ErrorContains(t, err, "version mismatch")
+
+	err = registry.Validate(&types.Artifact{Name: "hello", Version: "1.0"}, content)
+	assert.ErrorContains(t, err, "invalid RPM version format")
+
+	err = registry.Validate(&types.Artifact{Name: "hello world", Version: "1.0-1"}, content)
+	assert.ErrorContains(t, err, "invalid RPM package name")
+
+	// The epoch is part of the version
+	withEpoch := createTestRPM(t, append(testPackageTags("hello", "1.0", "1", "x86_64"), testTag{tagEpoch, typeInt32, []int32{2}}))
+	assert.NoError(t, registry.Validate(&types.Artifact{Name: "hello", Version: "2:1.0-1"}, withEpoch))
+}
+
+func TestGetMetadata_RoundTrip(t *testing.T) {
+	registry := New(nil, nil)
+
+	metadata, err := registry.GetMetadata(createTestRPM(t, testPackageTags("hello", "1.0", "1", "x86_64")))
+	require.NoError(t, err)
+	assert.Equal(t, "rpm", metadata["format"])
+	assert.Equal(t, "x86_64", metadata["architecture"])
+	assert.Equal(t, "Greeting program", metadata["description"])
+
+	fresh, ok := PackageFromArtifact(&types.Artifact{Metadata: metadata})
+	require.True(t, ok)
+
+	// Metadata read back from the database is a generic map
+	data, err := json.Marshal(metadata)
+	require.NoError(t, err)
+	var stored types.JSONMap
+	require.NoError(t, json.Unmarshal(data, &stored))
+
+	loaded, ok := PackageFromArtifact(&types.Artifact{Metadata: stored})
+	require.True(t, ok)
+	assert.Equal(t, fresh, loaded)
+
+	_, ok = PackageFromArtifact(&types.Artifact{Metadata: types.JSONMap{"format": "npm"}})
+	assert.False(t, ok)
+}
+
+func TestLocationHref(t *testing.T) {
+	pkg := &Package{Name: "hello", Epoch: "1", Version: "1.0", Release: "1.el9", Arch: "noarch"}
+	assert.Equal(t, "Packages/hello/hello-1.0-1.el9.noarch.rpm", LocationHref(pkg))
+	assert.Equal(t, "1:1.0-1.el9", pkg.EVR())
+}
+
+func TestBuildRepository(t *testing.T) {
+	registry := New(nil, nil)
+
+	newArtifact := func(tags []testTag) *types.Artifact {
+		content := createTestRPM(t, tags)
+		metadata, err := registry.GetMetadata(content)
+		require.NoError(t, err)
+		pkg, _ := ReadPackage(content)
+		return &types.Artifact{
+			Name:      pkg.Name,
+			Version:   pkg.EVR(),
+			Registry:  "rpm",
+			Size:      int64(len(content)),
+			SHA256:    sha256Hex(content),
+			Metadata:  metadata,
+			CreatedAt: time.Unix(1700000100, 0),
+			UpdatedAt: time.Unix(1700000200, 0),
+		}
+	}
+
+	hello := newArtifact(testPackageTags("hello", "1.0", "1", "x86_64"))
+	data := newArtifact(testPackageTags("hello-data", "1.2", "1", "noarch"))
+
+	repo := BuildRepository([]*types.Artifact{hello, data})
+
+	var index repomd
+	require.NoError(t, xml.Unmarshal(repo.Files[RepomdPath], &index))
+	assert.Equal(t, int64(1700000200), index.Revision)
+	require.Len(t, index.Data, 3)
+
+	documents := make(map[string][]byte)
+	for _, entry := range index.Data {
+		compressed, ok := repo.Files[entry.Location.Href]
+		require.True(t, ok, entry.Location.Href)
+		assert.Equal(t, entry.Checksum.Value, sha256Hex(compressed))
+		assert.Equal(t, entry.Size, len(compressed))
+
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		require.NoError(t, err)
+		document, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, entry.OpenChecksum.Value, sha256Hex(document))
+		documents[entry.Type] = document
+	}
+
+	primary := string(documents["primary"])
+	assert.Contains(t, primary, `<metadata xmlns="http://linux.duke.edu/metadata/common" xmlns:rpm="http://linux.duke.edu/metadata/rpm" packages="2">`)
+	assert.Contains(t, primary, `<location href="Packages/hello/hello-1.0-1.x86_64.rpm"></location>`)
+	assert.Contains(t, primary, `<checksum type="sha256" pkgid="YES">`+hello.SHA256+`</checksum>`)
+	assert.Contains(t, primary, `<rpm:entry name="hello-data" flags="GE" epoch="0" ver="1.0"></rpm:entry>`)
+	assert.Contains(t, primary, `<rpm:entry name="/bin/sh" pre="1"></rpm:entry>`)
+	assert.NotContains(t, primary, "rpmlib(")
+	// Only dependency-relevant files appear in primary
+	assert.Contains(t, primary, "<file>/usr/bin/hello</file>")
+	assert.NotContains(t, primary, "/usr/share/doc/hello")
+	assert.Less(t, strings.Index(primary, "<name>hello</name>"), strings.Index(primary, "<name>hello-data</name>"))
+
+	filelists := string(documents["filelists"])
+	assert.Contains(t, filelists, `<package pkgid="`+hello.SHA256+`" name="hello" arch="x86_64">`)
+	assert.Contains(t, filelists, `<file type="dir">/usr/share/doc/hello</file>`)
+	assert.Contains(t, filelists, `<file type="ghost">/var/lib/hello/state</file>`)
+
+	assert.Contains(t, string(documents["other"]), `<changelog author="Dev &lt;dev@example.com&gt; - 1.0-1" date="1699900000">- Initial package</changelog>`)
+
+	// Output is reproducible
+	assert.Equal(t, repo.Repomd, BuildRepository([]*types.Artifact{data, hello}).Repomd)
+}
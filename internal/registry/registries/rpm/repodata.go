@@ -0,0 +1,408 @@
+package rpm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// XML namespaces of the repodata documents
+const (
+	namespaceCommon    = "http://linux.duke.edu/metadata/common"
+	namespaceRPM       = "http://linux.duke.edu/metadata/rpm"
+	namespaceRepo      = "http://linux.duke.edu/metadata/repo"
+	namespaceFilelists = "http://linux.duke.edu/metadata/filelists"
+	namespaceOther     = "http://linux.duke.edu/metadata/other"
+)
+
+// RepomdPath is the repository index clients fetch first
+const RepomdPath = "repodata/repomd.xml"
+
+// Repository is the generated repodata for the published packages
+type Repository struct {
+	Files  map[string][]byte // keyed by path relative to the repository root
+	Repomd []byte
+}
+
+// entry is a package ready to be written to the indexes
+type entry struct {
+	pkg      *Package
+	checksum string
+	size     int64
+	fileTime int64
+}
+
+// BuildRepository generates repomd.xml and the primary, filelists and other
+// indexes it references. Timestamps are taken from the newest artifact so
+// repeated requests produce identical, cacheable output.
+func BuildRepository(artifacts []*types.Artifact) *Repository {
+	entries := make([]entry, 0, len(artifacts))
+	var revision int64
+	for _, artifact := range artifacts {
+		pkg, ok := PackageFromArtifact(artifact)
+		if !ok {
+			continue
+		}
+		entries = append(entries, entry{
+			pkg:      pkg,
+			checksum: artifact.SHA256,
+			size:     artifact.Size,
+			fileTime: artifact.CreatedAt.Unix(),
+		})
+		if updated := artifact.UpdatedAt.Unix(); updated > revision {
+			revision = updated
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].pkg, entries[j].pkg
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.EVR() != b.EVR() {
+			return a.EVR() < b.EVR()
+		}
+		return a.Arch < b.Arch
+	})
+
+	repo := &Repository{Files: make(map[string][]byte)}
+	index := repomd{
+		Xmlns:    namespaceRepo,
+		XmlnsRPM: namespaceRPM,
+		Revision: revision,
+	}
+
+	for _, document := range []struct {
+		name    string
+		content []byte
+	}{
+		{"primary", marshalXML(buildPrimary(entries))},
+		{"filelists", marshalXML(buildFilelists(entries))},
+		{"other", marshalXML(buildOther(entries))},
+	} {
+		compressed := gzipBytes(document.content)
+		checksum := sha256Hex(compressed)
+		location := fmt.Sprintf("repodata/%s-%s.xml.gz", checksum, document.name)
+		repo.Files[location] = compressed
+
+		index.Data = append(index.Data, repomdData{
+			Type:         document.name,
+			Checksum:     xmlChecksum{Type: "sha256", Value: checksum},
+			OpenChecksum: xmlChecksum{Type: "sha256", Value: sha256Hex(document.content)},
+			Location:     xmlLocation{Href: location},
+			Timestamp:    revision,
+			Size:         len(compressed),
+			OpenSize:     len(document.content),
+		})
+	}
+
+	repo.Repomd = marshalXML(index)
+	repo.Files[RepomdPath] = repo.Repomd
+	return repo
+}
+
+// buildPrimary renders primary.xml, which carries everything needed for
+// dependency resolution
+func buildPrimary(entries []entry) primaryMetadata {
+	metadata := primaryMetadata{
+		Xmlns:    namespaceCommon,
+		XmlnsRPM: namespaceRPM,
+		Count:    len(entries),
+	}
+
+	for _, e := range entries {
+		pkg := e.pkg
+		primary := primaryPackage{
+			Type:        "rpm",
+			Name:        pkg.Name,
+			Arch:        pkg.Arch,
+			Version:     newXMLVersion(pkg),
+			Checksum:    xmlChecksum{Type: "sha256", PkgID: "YES", Value: e.checksum},
+			Summary:     pkg.Summary,
+			Description: pkg.Description,
+			Packager:    pkg.Packager,
+			URL:         pkg.URL,
+			Time:        xmlTime{File: e.fileTime, Build: pkg.BuildTime},
+			Size:        xmlSize{Package: e.size, Installed: pkg.InstalledSize, Archive: pkg.ArchiveSize},
+			Location:    xmlLocation{Href: LocationHref(pkg)},
+			Format: primaryFormat{
+				License:     pkg.License,
+				Vendor:      pkg.Vendor,
+				Group:       pkg.Group,
+				BuildHost:   pkg.BuildHost,
+				SourceRPM:   pkg.SourceRPM,
+				HeaderRange: xmlHeaderRange{Start: pkg.HeaderStart, End: pkg.HeaderEnd},
+				Provides:    newXMLEntries(pkg.Provides),
+				Requires:    newXMLEntries(pkg.Requires),
+				Conflicts:   newXMLEntries(pkg.Conflicts),
+				Obsoletes:   newXMLEntries(pkg.Obsoletes),
+			},
+		}
+
+		// Like createrepo, primary lists only the files most often used as
+		// dependencies; the full list is in filelists
+		for _, file := range pkg.Files {
+			if isPrimaryFile(file.Path) {
+				primary.Format.Files = append(primary.Format.Files, xmlFile(file))
+			}
+		}
+
+		metadata.Packages = append(metadata.Packages, primary)
+	}
+
+	return metadata
+}
+
+// buildFilelists renders filelists.xml with every file of every package
+func buildFilelists(entries []entry) filelistsMetadata {
+	metadata := filelistsMetadata{
+		Xmlns: namespaceFilelists,
+		Count: len(entries),
+	}
+
+	for _, e := range entries {
+		filelist := filelistsPackage{
+			PkgID:   e.checksum,
+			Name:    e.pkg.Name,
+			Arch:    e.pkg.Arch,
+			Version: newXMLVersion(e.pkg),
+		}
+		for _, file := range e.pkg.Files {
+			filelist.Files = append(filelist.Files, xmlFile(file))
+		}
+		metadata.Packages = append(metadata.Packages, filelist)
+	}
+
+	return metadata
+}
+
+// buildOther renders other.xml with package changelogs
+func buildOther(entries []entry) otherMetadata {
+	metadata := otherMetadata{
+		Xmlns: namespaceOther,
+		Count: len(entries),
+	}
+
+	for _, e := range entries {
+		other := otherPackage{
+			PkgID:   e.checksum,
+			Name:    e.pkg.Name,
+			Arch:    e.pkg.Arch,
+			Version: newXMLVersion(e.pkg),
+		}
+		for _, changelog := range e.pkg.Changelogs {
+			other.Changelogs = append(other.Changelogs, xmlChangelog(changelog))
+		}
+		metadata.Packages = append(metadata.Packages, other)
+	}
+
+	return metadata
+}
+
+// isPrimaryFile reports whether a file belongs in primary.xml
+func isPrimaryFile(filePath string) bool {
+	return strings.HasPrefix(filePath, "/etc/") || strings.Contains(filePath, "bin/") || filePath == "/usr/lib/sendmail"
+}
+
+func newXMLVersion(pkg *Package) xmlVersion {
+	return xmlVersion{Epoch: pkg.Epoch, Ver: pkg.Version, Rel: pkg.Release}
+}
+
+func newXMLEntries(deps []Dependency) *xmlEntries {
+	if len(deps) == 0 {
+		return nil
+	}
+	entries := &xmlEntries{}
+	for _, dep := range deps {
+		e := xmlEntry{
+			Name:  dep.Name,
+			Flags: dep.Flags,
+			Epoch: dep.Epoch,
+			Ver:   dep.Version,
+			Rel:   dep.Release,
+		}
+		if dep.Pre {
+			e.Pre = "1"
+		}
+		entries.Entries = append(entries.Entries, e)
+	}
+	return entries
+}
+
+// marshalXML renders a document with the XML declaration
+func marshalXML(document interface{}) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	// The documents are built from plain structs and cannot fail to encode
+	_ = encoder.Encode(document)
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// gzipBytes compresses data without a timestamp so output is reproducible
+func gzipBytes(data []byte) []byte {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// repodata XML documents. Element names carry the rpm: prefix literally,
+// bound by the xmlns:rpm attribute on the root element.
+
+type repomd struct {
+	XMLName  xml.Name     `xml:"repomd"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	XmlnsRPM string       `xml:"xmlns:rpm,attr"`
+	Revision int64        `xml:"revision"`
+	Data     []repomdData `xml:"data"`
+}
+
+type repomdData struct {
+	Type         string      `xml:"type,attr"`
+	Checksum     xmlChecksum `xml:"checksum"`
+	OpenChecksum xmlChecksum `xml:"open-checksum"`
+	Location     xmlLocation `xml:"location"`
+	Timestamp    int64       `xml:"timestamp"`
+	Size         int         `xml:"size"`
+	OpenSize     int         `xml:"open-size"`
+}
+
+type primaryMetadata struct {
+	XMLName  xml.Name         `xml:"metadata"`
+	Xmlns    string           `xml:"xmlns,attr"`
+	XmlnsRPM string           `xml:"xmlns:rpm,attr"`
+	Count    int              `xml:"packages,attr"`
+	Packages []primaryPackage `xml:"package"`
+}
+
+type primaryPackage struct {
+	Type        string        `xml:"type,attr"`
+	Name        string        `xml:"name"`
+	Arch        string        `xml:"arch"`
+	Version     xmlVersion    `xml:"version"`
+	Checksum    xmlChecksum   `xml:"checksum"`
+	Summary     string        `xml:"summary"`
+	Description string        `xml:"description"`
+	Packager    string        `xml:"packager"`
+	URL         string        `xml:"url"`
+	Time        xmlTime       `xml:"time"`
+	Size        xmlSize       `xml:"size"`
+	Location    xmlLocation   `xml:"location"`
+	Format      primaryFormat `xml:"format"`
+}
+
+type primaryFormat struct {
+	License     string         `xml:"rpm:license"`
+	Vendor      string         `xml:"rpm:vendor"`
+	Group       string         `xml:"rpm:group"`
+	BuildHost   string         `xml:"rpm:buildhost"`
+	SourceRPM   string         `xml:"rpm:sourcerpm"`
+	HeaderRange xmlHeaderRange `xml:"rpm:header-range"`
+	Provides    *xmlEntries    `xml:"rpm:provides,omitempty"`
+	Requires    *xmlEntries    `xml:"rpm:requires,omitempty"`
+	Conflicts   *xmlEntries    `xml:"rpm:conflicts,omitempty"`
+	Obsoletes   *xmlEntries    `xml:"rpm:obsoletes,omitempty"`
+	Files       []xmlFile      `xml:"file"`
+}
+
+type filelistsMetadata struct {
+	XMLName  xml.Name           `xml:"filelists"`
+	Xmlns    string             `xml:"xmlns,attr"`
+	Count    int                `xml:"packages,attr"`
+	Packages []filelistsPackage `xml:"package"`
+}
+
+type filelistsPackage struct {
+	PkgID   string     `xml:"pkgid,attr"`
+	Name    string     `xml:"name,attr"`
+	Arch    string     `xml:"arch,attr"`
+	Version xmlVersion `xml:"version"`
+	Files   []xmlFile  `xml:"file"`
+}
+
+type otherMetadata struct {
+	XMLName  xml.Name       `xml:"otherdata"`
+	Xmlns    string         `xml:"xmlns,attr"`
+	Count    int            `xml:"packages,attr"`
+	Packages []otherPackage `xml:"package"`
+}
+
+type otherPackage struct {
+	PkgID      string         `xml:"pkgid,attr"`
+	Name       string         `xml:"name,attr"`
+	Arch       string         `xml:"arch,attr"`
+	Version    xmlVersion     `xml:"version"`
+	Changelogs []xmlChangelog `xml:"changelog"`
+}
+
+type xmlVersion struct {
+	Epoch string `xml:"epoch,attr"`
+	Ver   string `xml:"ver,attr"`
+	Rel   string `xml:"rel,attr"`
+}
+
+type xmlChecksum struct {
+	Type  string `xml:"type,attr"`
+	PkgID string `xml:"pkgid,attr,omitempty"`
+	Value string `xml:",chardata"`
+}
+
+type xmlLocation struct {
+	Href string `xml:"href,attr"`
+}
+
+type xmlTime struct {
+	File  int64 `xml:"file,attr"`
+	Build int64 `xml:"build,attr"`
+}
+
+type xmlSize struct {
+	Package   int64 `xml:"package,attr"`
+	Installed int64 `xml:"installed,attr"`
+	Archive   int64 `xml:"archive,attr"`
+}
+
+type xmlHeaderRange struct {
+	Start int64 `xml:"start,attr"`
+	End   int64 `xml:"end,attr"`
+}
+
+type xmlEntries struct {
+	Entries []xmlEntry `xml:"rpm:entry"`
+}
+
+type xmlEntry struct {
+	Name  string `xml:"name,attr"`
+	Flags string `xml:"flags,attr,omitempty"`
+	Epoch string `xml:"epoch,attr,omitempty"`
+	Ver   string `xml:"ver,attr,omitempty"`
+	Rel   string `xml:"rel,attr,omitempty"`
+	Pre   string `xml:"pre,attr,omitempty"`
+}
+
+type xmlFile struct {
+	Path string `xml:",chardata"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type xmlChangelog struct {
+	Author string `xml:"author,attr"`
+	Date   int64  `xml:"date,attr"`
+	Text   string `xml:",chardata"`
+}
@@ -0,0 +1,129 @@
+package rpm
+
+// Header tags read from the main header of an RPM package
+const (
+	tagName          = 1000
+	tagVersion       = 1001
+	tagRelease       = 1002
+	tagEpoch         = 1003
+	tagSummary       = 1004
+	tagDescription   = 1005
+	tagBuildTime     = 1006
+	tagBuildHost     = 1007
+	tagSize          = 1009
+	tagVendor        = 1011
+	tagLicense       = 1014
+	tagPackager      = 1015
+	tagGroup         = 1016
+	tagURL           = 1020
+	tagArch          = 1022
+	tagOldFilenames  = 1027
+	tagFileModes     = 1030
+	tagFileFlags     = 1037
+	tagSourceRPM     = 1044
+	tagArchiveSize   = 1046
+	tagProvideName   = 1047
+	tagRequireFlags  = 1048
+	tagRequireName   = 1049
+	tagRequireVer    = 1050
+	tagConflictFlags = 1053
+	tagConflictName  = 1054
+	tagConflictVer   = 1055
+	tagChangelogTime = 1080
+	tagChangelogName = 1081
+	tagChangelogText = 1082
+	tagObsoleteName  = 1090
+	tagProvideFlags  = 1112
+	tagProvideVer    = 1113
+	tagObsoleteFlags = 1114
+	tagObsoleteVer   = 1115
+	tagDirIndexes    = 1116
+	tagBaseNames     = 1117
+	tagDirNames      = 1118
+	tagLongSize      = 5009
+)
+
+// Header data types
+const (
+	typeInt16       = 3
+	typeInt32       = 4
+	typeInt64       = 5
+	typeString      = 6
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+// Dependency sense flags
+const (
+	senseLess       = 1 << 1
+	senseGreater    = 1 << 2
+	senseEqual      = 1 << 3
+	sensePrereq     = 1 << 6
+	senseScriptPre  = 1 << 9
+	senseScriptPost = 1 << 10
+)
+
+// fileFlagGhost marks files that are owned but not shipped by the package
+const fileFlagGhost = 1 << 6
+
+// Package holds the metadata extracted from an RPM header that the repodata
+// indexes need. It is stored with the artifact at upload.
+type Package struct {
+	Name          string       `json:"name"`
+	Epoch         string       `json:"epoch"`
+	Version       string       `json:"version"`
+	Release       string       `json:"release"`
+	Arch          string       `json:"arch"`
+	Summary       string       `json:"summary,omitempty"`
+	Description   string       `json:"description,omitempty"`
+	URL           string       `json:"url,omitempty"`
+	License       string       `json:"license,omitempty"`
+	Vendor        string       `json:"vendor,omitempty"`
+	Group         string       `json:"group,omitempty"`
+	Packager      string       `json:"packager,omitempty"`
+	BuildHost     string       `json:"buildhost,omitempty"`
+	SourceRPM     string       `json:"sourcerpm,omitempty"`
+	BuildTime     int64        `json:"buildtime"`
+	InstalledSize int64        `json:"installed_size"`
+	ArchiveSize   int64        `json:"archive_size"`
+	HeaderStart   int64        `json:"header_start"`
+	HeaderEnd     int64        `json:"header_end"`
+	Provides      []Dependency `json:"provides,omitempty"`
+	Requires      []Dependency `json:"requires,omitempty"`
+	Conflicts     []Dependency `json:"conflicts,omitempty"`
+	Obsoletes     []Dependency `json:"obsoletes,omitempty"`
+	Files         []File       `json:"files,omitempty"`
+	Changelogs    []Changelog  `json:"changelogs,omitempty"`
+}
+
+// EVR returns the version as stored for the artifact: [epoch:]version-release
+func (p *Package) EVR() string {
+	evr := p.Version + "-" + p.Release
+	if p.Epoch != "" && p.Epoch != "0" {
+		evr = p.Epoch + ":" + evr
+	}
+	return evr
+}
+
+// Dependency is a provides, requires, conflicts or obsoletes entry
+type Dependency struct {
+	Name    string `json:"name"`
+	Flags   string `json:"flags,omitempty"` // EQ, LT, LE, GT or GE
+	Epoch   string `json:"epoch,omitempty"`
+	Version string `json:"version,omitempty"`
+	Release string `json:"release,omitempty"`
+	Pre     bool   `json:"pre,omitempty"`
+}
+
+// File is a path owned by the package
+type File struct {
+	Path string `json:"path"`
+	Type string `json:"type,omitempty"` // empty for regular files, "dir" or "ghost"
+}
+
+// Changelog is a single changelog entry
+type Changelog struct {
+	Author string `json:"author"`
+	Date   int64  `json:"date"`
+	Text   string `json:"text"`
+}
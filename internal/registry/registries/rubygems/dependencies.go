@@ -0,0 +1,57 @@
+package rubygems
+
+import (
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// NewVersionInfo describes a stored gem version for the dependency API from
+// the metadata extracted at upload
+func NewVersionInfo(artifact *types.Artifact) VersionInfo {
+	info := VersionInfo{
+		Name:         artifact.Name,
+		Number:       artifact.Version,
+		Platform:     DefaultPlatform,
+		Dependencies: [][]string{},
+	}
+	if platform, ok := artifact.Metadata["platform"].(string); ok && platform != "" {
+		info.Platform = platform
+	}
+
+	dependencies, _ := artifact.Metadata["dependencies"].([]interface{})
+	for _, dependency := range dependencies {
+		entry, ok := dependency.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := entry["name"].(string)
+		requirement, _ := entry["requirement"].(string)
+		if name == "" {
+			continue
+		}
+		if requirement == "" {
+			requirement = ">= 0"
+		}
+		info.Dependencies = append(info.Dependencies, []string{name, requirement})
+	}
+	return info
+}
+
+// MarshalDependencies encodes versions in the format of Bundler's dependency
+// API: a Marshal array of hashes with :name, :number, :platform and
+// :dependencies keys
+func MarshalDependencies(versions []VersionInfo) ([]byte, error) {
+	entries := make([]interface{}, 0, len(versions))
+	for _, version := range versions {
+		dependencies := make([]interface{}, 0, len(version.Dependencies))
+		for _, dependency := range version.Dependencies {
+			dependencies = append(dependencies, dependency)
+		}
+		entries = append(entries, Hash{
+			{Key: Symbol("name"), Value: version.Name},
+			{Key: Symbol("number"), Value: version.Number},
+			{Key: Symbol("platform"), Value: version.Platform},
+			{Key: Symbol("dependencies"), Value: dependencies},
+		})
+	}
+	return Marshal(entries)
+}
@@ -0,0 +1,360 @@
+package rubygems
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Ruby Marshal format version 4.8, the only one Ruby has written since 1.8
+const (
+	marshalMajor = 4
+	marshalMinor = 8
+)
+
+// Fixnums are the integers Marshal writes without a bignum, 31 bits wide
+const (
+	maxFixnum = 1<<30 - 1
+	minFixnum = -(1 << 30)
+)
+
+// Symbol is a Ruby symbol such as :name
+type Symbol string
+
+// Hash is a Ruby hash, keeping its entries in insertion order
+type Hash []HashEntry
+
+// HashEntry is a key and value of a Hash
+type HashEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Get returns the value stored under key, or nil if there is none
+func (h Hash) Get(key interface{}) interface{} {
+	for _, entry := range h {
+		if entry.Key == key {
+			return entry.Value
+		}
+	}
+	return nil
+}
+
+// Marshal encodes a value in the Ruby Marshal format. Supported values are
+// nil, bool, int, string (encoded as UTF-8), Symbol, []string,
+// []interface{} and Hash.
+func Marshal(v interface{}) ([]byte, error) {
+	e := &marshalEncoder{symbols: make(map[Symbol]int)}
+	e.buf.Write([]byte{marshalMajor, marshalMinor})
+	if err := e.encode(v); err != nil {
+		return nil, err
+	}
+	return e.buf.Bytes(), nil
+}
+
+type marshalEncoder struct {
+	buf     bytes.Buffer
+	symbols map[Symbol]int
+}
+
+func (e *marshalEncoder) encode(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		e.buf.WriteByte('0')
+	case bool:
+		if v {
+			e.buf.WriteByte('T')
+		} else {
+			e.buf.WriteByte('F')
+		}
+	case int:
+		if v < minFixnum || v > maxFixnum {
+			return fmt.Errorf("integer %d out of fixnum range", v)
+		}
+		e.buf.WriteByte('i')
+		e.writeLong(v)
+	case string:
+		// Strings carry their encoding as an instance variable, E true for UTF-8
+		e.buf.WriteString(`I"`)
+		e.writeBytes([]byte(v))
+		e.writeLong(1)
+		e.writeSymbol("E")
+		e.buf.WriteByte('T')
+	case Symbol:
+		e.writeSymbol(v)
+	case []string:
+		e.buf.WriteByte('[')
+		e.writeLong(len(v))
+		for _, item := range v {
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		e.buf.WriteByte('[')
+		e.writeLong(len(v))
+		for _, item := range v {
+			if err := e.encode(item); err != nil {
+				return err
+			}
+		}
+	case Hash:
+		e.buf.WriteByte('{')
+		e.writeLong(len(v))
+		for _, entry := range v {
+			if err := e.encode(entry.Key); err != nil {
+				return err
+			}
+			if err := e.encode(entry.Value); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot marshal %T", v)
+	}
+	return nil
+}
+
+// writeSymbol writes a symbol, or a link to it if it was written before
+func (e *marshalEncoder) writeSymbol(symbol Symbol) {
+	if index, ok := e.symbols[symbol]; ok {
+		e.buf.WriteByte(';')
+		e.writeLong(index)
+		return
+	}
+	e.symbols[symbol] = len(e.symbols)
+	e.buf.WriteByte(':')
+	e.writeBytes([]byte(symbol))
+}
+
+func (e *marshalEncoder) writeBytes(data []byte) {
+	e.writeLong(len(data))
+	e.buf.Write(data)
+}
+
+// writeLong writes an integer in Marshal's variable length encoding: small
+// values in a single offset byte, others as a signed byte count followed by
+// the little-endian bytes
+func (e *marshalEncoder) writeLong(n int) {
+	switch {
+	case n == 0:
+		e.buf.WriteByte(0)
+	case n > 0 && n < 123:
+		e.buf.WriteByte(byte(n + 5))
+	case n < 0 && n > -124:
+		e.buf.WriteByte(byte(n - 5))
+	default:
+		var data []byte
+		for count := 1; count <= 4; count++ {
+			data = append(data, byte(n))
+			n >>= 8
+			if n == 0 {
+				e.buf.WriteByte(byte(count))
+				break
+			}
+			if n == -1 {
+				e.buf.WriteByte(byte(-count))
+				break
+			}
+		}
+		e.buf.Write(data)
+	}
+}
+
+// Unmarshal decodes a value in the Ruby Marshal format into the types
+// Marshal accepts, with arrays decoded as []interface{}. Objects, floats and
+// other Ruby types are not supported.
+func Unmarshal(data []byte) (interface{}, error) {
+	if len(data) < 2 || data[0] != marshalMajor || data[1] != marshalMinor {
+		return nil, fmt.Errorf("unsupported marshal format version")
+	}
+	d := &marshalDecoder{data: data, offset: 2}
+	v, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.offset != len(d.data) {
+		return nil, fmt.Errorf("trailing data after marshaled value")
+	}
+	return v, nil
+}
+
+type marshalDecoder struct {
+	data    []byte
+	offset  int
+	symbols []Symbol
+	objects []interface{}
+}
+
+func (d *marshalDecoder) decode() (interface{}, error) {
+	kind, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case '0':
+		return nil, nil
+	case 'T':
+		return true, nil
+	case 'F':
+		return false, nil
+	case 'i':
+		return d.readLong()
+	case ':', ';':
+		return d.readSymbol(kind)
+	case '"':
+		data, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		d.objects = append(d.objects, string(data))
+		return string(data), nil
+	case 'I':
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		// Instance variables such as the string encoding are read and dropped
+		count, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count*2; i++ {
+			if _, err := d.decode(); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	case '[':
+		count, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 || count > len(d.data)-d.offset {
+			return nil, fmt.Errorf("invalid array length %d", count)
+		}
+		index := len(d.objects)
+		d.objects = append(d.objects, nil)
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = d.decode(); err != nil {
+				return nil, err
+			}
+		}
+		d.objects[index] = items
+		return items, nil
+	case '{':
+		count, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if count < 0 || count > len(d.data)-d.offset {
+			return nil, fmt.Errorf("invalid hash length %d", count)
+		}
+		index := len(d.objects)
+		d.objects = append(d.objects, nil)
+		hash := make(Hash, count)
+		for i := range hash {
+			if hash[i].Key, err = d.decode(); err != nil {
+				return nil, err
+			}
+			if hash[i].Value, err = d.decode(); err != nil {
+				return nil, err
+			}
+		}
+		d.objects[index] = hash
+		return hash, nil
+	case '@':
+		index, err := d.readLong()
+		if err != nil {
+			return nil, err
+		}
+		if index < 0 || index >= len(d.objects) {
+			return nil, fmt.Errorf("invalid object link %d", index)
+		}
+		return d.objects[index], nil
+	default:
+		return nil, fmt.Errorf("unsupported marshal type %q", kind)
+	}
+}
+
+func (d *marshalDecoder) readSymbol(kind byte) (Symbol, error) {
+	if kind == ';' {
+		index, err := d.readLong()
+		if err != nil {
+			return "", err
+		}
+		if index < 0 || index >= len(d.symbols) {
+			return "", fmt.Errorf("invalid symbol link %d", index)
+		}
+		return d.symbols[index], nil
+	}
+
+	data, err := d.readBytes()
+	if err != nil {
+		return "", err
+	}
+	symbol := Symbol(data)
+	d.symbols = append(d.symbols, symbol)
+	return symbol, nil
+}
+
+func (d *marshalDecoder) readByte() (byte, error) {
+	if d.offset >= len(d.data) {
+		return 0, fmt.Errorf("unexpected end of marshal data")
+	}
+	b := d.data[d.offset]
+	d.offset++
+	return b, nil
+}
+
+func (d *marshalDecoder) readBytes() ([]byte, error) {
+	length, err := d.readLong()
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 || length > len(d.data)-d.offset {
+		return nil, fmt.Errorf("invalid byte sequence length %d", length)
+	}
+	data := d.data[d.offset : d.offset+length]
+	d.offset += length
+	return data, nil
+}
+
+// readLong reads an integer written by writeLong
+func (d *marshalDecoder) readLong() (int, error) {
+	b, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	c := int(int8(b))
+	switch {
+	case c == 0:
+		return 0, nil
+	case c > 4:
+		return c - 5, nil
+	case c < -4:
+		return c + 5, nil
+	case c > 0:
+		n := 0
+		for i := 0; i < c; i++ {
+			b, err := d.readByte()
+			if err != nil {
+				return 0, err
+			}
+			n |= int(b) << (8 * i)
+		}
+		return n, nil
+	default:
+		n := -1
+		for i := 0; i < -c; i++ {
+			b, err := d.readByte()
+			if err != nil {
+				return 0, err
+			}
+			n &^= 0xff << (8 * i)
+			n |= int(b) << (8 * i)
+		}
+		return n, nil
+	}
+}
@@ -0,0 +1,88 @@
+package rubygems
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshal_MatchesRuby(t *testing.T) {
+	// Marshal.dump([{name: "a", number: 1}, :name])
+	want := "\x04\x08[\x07{\x07:\x09nameI\"\x06a\x06:\x06ET:\x0bnumberi\x06;\x00"
+
+	got, err := Marshal([]interface{}{
+		Hash{{Key: Symbol("name"), Value: "a"}, {Key: Symbol("number"), Value: 1}},
+		Symbol("name"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, want, string(got))
+}
+
+func TestMarshal_Longs(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "\x00"},
+		{1, "\x06"},
+		{122, "\x7f"},
+		{123, "\x01\x7b"},
+		{256, "\x02\x00\x01"},
+		{-1, "\xfa"},
+		{-123, "\x80"},
+		{-124, "\xff\x84"},
+		{-257, "\xfe\xff\xfe"},
+	}
+
+	for _, tt := range tests {
+		got, err := Marshal(tt.n)
+		require.NoError(t, err)
+		assert.Equal(t, "\x04\x08i"+tt.want, string(got), "%d", tt.n)
+	}
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	value := []interface{}{
+		nil, true, false, 0, 122, 123, -124, 65536, maxFixnum, minFixnum,
+		"", "héllo", Symbol("name"), Symbol("name"),
+		Hash{
+			{Key: Symbol("dependencies"), Value: []interface{}{[]interface{}{"rack", ">= 2.0, < 4"}}},
+			{Key: "string key", Value: Hash{}},
+		},
+	}
+
+	data, err := Marshal(value)
+	require.NoError(t, err)
+	decoded, err := Unmarshal(data)
+	require.NoError(t, err)
+	assert.Equal(t, value, decoded)
+
+	_, err = Marshal(maxFixnum + 1)
+	assert.Error(t, err)
+	_, err = Marshal(1.5)
+	assert.Error(t, err)
+}
+
+func TestUnmarshal_ObjectLinks(t *testing.T) {
+	// a = "x"; Marshal.dump([a, a])
+	decoded, err := Unmarshal([]byte("\x04\x08[\x07I\"\x06x\x06:\x06ET@\x06"))
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"x", "x"}, decoded)
+}
+
+func TestUnmarshal_Invalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"\x04\x07[\x00",
+		"\x04\x08[\x07",
+		"\x04\x08;\x00",
+		"\x04\x08@\x00",
+		"\x04\x08I\"\x7f",
+		"\x04\x08f\x081.5",
+		"\x04\x080\x00",
+	} {
+		_, err := Unmarshal([]byte(data))
+		assert.Error(t, err, "%q", data)
+	}
+}
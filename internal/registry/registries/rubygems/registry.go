@@ -12,6 +12,10 @@ import (
 	"github.com/lgulliver/lodestone/pkg/types"
 )
 
+// versionRegex follows Gem::Version: numeric first segment, then dot-separated
+// alphanumeric segments, where any letter marks a prerelease (e.g. 1.0.0.pre1)
+var versionRegex = regexp.MustCompile(`^[0-9]+(\.[0-9a-zA-Z]+)*(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
 // Registry implements the RubyGems registry
 type Registry struct {
 	storage storage.BlobStorage
@@ -59,30 +63,81 @@ func (r *Registry) Validate(artifact *types.Artifact, content []byte) error {
 		return fmt.Errorf("empty gem content")
 	}
 
-	// Check file extension
-	if !strings.HasSuffix(strings.ToLower(artifact.Name), ".gem") {
-		return fmt.Errorf("invalid gem file extension")
-	}
-
-	// Validate gem name format
+	// Validate gem name format, allowing for a .gem file extension
 	gemNameRegex := regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]*$`)
 	baseName := strings.TrimSuffix(artifact.Name, ".gem")
 	if !gemNameRegex.MatchString(baseName) {
 		return fmt.Errorf("invalid gem name format")
 	}
 
+	if !versionRegex.MatchString(artifact.Version) {
+		return fmt.Errorf("invalid gem version format")
+	}
+
 	// TODO: Validate gem file structure
 	return nil
 }
 
-// GetMetadata extracts metadata from RubyGem
+// GetMetadata extracts the gemspec fields needed to serve and resolve a gem
 func (r *Registry) GetMetadata(content []byte) (map[string]interface{}, error) {
-	// TODO: Extract metadata from gemspec
-	return map[string]interface{}{
-		"format":       "rubygems",
-		"type":         "gem",
-		"ruby_version": "3.0.0", // Should be extracted
-	}, nil
+	spec, err := ExtractSpec(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dependencies are stored the way they read back from the database
+	dependencies := make([]interface{}, 0, len(spec.Dependencies))
+	developmentDependencies := make([]interface{}, 0)
+	for _, dependency := range spec.Dependencies {
+		entry := map[string]interface{}{
+			"name":        dependency.Name,
+			"requirement": dependency.Requirement,
+		}
+		if dependency.Type == DependencyDevelopment {
+			developmentDependencies = append(developmentDependencies, entry)
+		} else {
+			dependencies = append(dependencies, entry)
+		}
+	}
+
+	authors := make([]interface{}, 0, len(spec.Authors))
+	for _, author := range spec.Authors {
+		authors = append(authors, author)
+	}
+
+	metadata := map[string]interface{}{
+		"format":                   "rubygems",
+		"type":                     "gem",
+		"platform":                 spec.Platform,
+		"prerelease":               IsPrerelease(spec.Version),
+		"authors":                  authors,
+		"author":                   strings.Join(spec.Authors, ", "),
+		"dependencies":             dependencies,
+		"development_dependencies": developmentDependencies,
+	}
+	if spec.Summary != "" {
+		metadata["summary"] = spec.Summary
+	}
+	// Gems without a description are described by their summary
+	if spec.Description != "" {
+		metadata["description"] = spec.Description
+	} else if spec.Summary != "" {
+		metadata["description"] = spec.Summary
+	}
+	if spec.Homepage != "" {
+		metadata["homepage"] = spec.Homepage
+	}
+	if len(spec.Licenses) > 0 {
+		metadata["licenses"] = strings.Join(spec.Licenses, ", ")
+	}
+	if spec.RequiredRubyVersion != "" {
+		metadata["required_ruby_version"] = spec.RequiredRubyVersion
+	}
+	if spec.RequiredRubygemsVersion != "" {
+		metadata["required_rubygems_version"] = spec.RequiredRubygemsVersion
+	}
+
+	return metadata, nil
 }
 
 // GenerateStoragePath creates the storage path for RubyGems
@@ -0,0 +1,31 @@
+package rubygems
+
+import (
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate_Versions(t *testing.T) {
+	registry := New(nil, nil)
+
+	valid := []string{"1.0.0", "7.1.3.2", "2.0.0.pre1", "1.0.0.rc.2", "3.0.0.beta", "1.0.0-alpha", "20240101", "0.9"}
+	for _, version := range valid {
+		t.Run(version, func(t *testing.T) {
+			artifact := &types.Artifact{Name: "rails.gem", Version: version}
+			assert.NoError(t, registry.Validate(artifact, []byte("gem")))
+		})
+	}
+
+	invalid := []string{"", "v1.0.0", "1.0.", ".1.0", "1..0", "1.0.0 ", "beta"}
+	for _, version := range invalid {
+		t.Run("invalid "+version, func(t *testing.T) {
+			artifact := &types.Artifact{Name: "rails.gem", Version: version}
+			err := registry.Validate(artifact, []byte("gem"))
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "invalid gem version format")
+			}
+		})
+	}
+}
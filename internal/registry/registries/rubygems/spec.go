@@ -0,0 +1,161 @@
+package rubygems
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// maxSpecSize bounds the decompressed size of a gem's metadata
+const maxSpecSize = 1 << 20
+
+// gemspec mirrors the YAML serialisation of a Gem::Specification. Ruby
+// object tags such as !ruby/object:Gem::Version are ignored.
+type gemspec struct {
+	Name                    string          `yaml:"name"`
+	Version                 gemVersion      `yaml:"version"`
+	Platform                string          `yaml:"platform"`
+	Summary                 string          `yaml:"summary"`
+	Description             string          `yaml:"description"`
+	Authors                 []string        `yaml:"authors"`
+	Homepage                string          `yaml:"homepage"`
+	Licenses                []string        `yaml:"licenses"`
+	RequiredRubyVersion     *gemRequirement `yaml:"required_ruby_version"`
+	RequiredRubygemsVersion *gemRequirement `yaml:"required_rubygems_version"`
+	Dependencies            []gemDependency `yaml:"dependencies"`
+}
+
+type gemVersion struct {
+	Version string `yaml:"version"`
+}
+
+// gemRequirement holds constraints as [operator, version] pairs
+type gemRequirement struct {
+	Requirements [][]yaml.Node `yaml:"requirements"`
+}
+
+type gemDependency struct {
+	Name        string         `yaml:"name"`
+	Requirement gemRequirement `yaml:"requirement"`
+	Type        string         `yaml:"type"`
+}
+
+// String renders the constraints the way Gem::Requirement#to_s does, e.g. "~> 1.2, >= 1.2.3"
+func (r *gemRequirement) String() (string, error) {
+	constraints := make([]string, 0, len(r.Requirements))
+	for _, pair := range r.Requirements {
+		if len(pair) != 2 {
+			return "", fmt.Errorf("invalid requirement: expected operator and version")
+		}
+		var operator string
+		var version gemVersion
+		if err := pair[0].Decode(&operator); err != nil {
+			return "", fmt.Errorf("invalid requirement operator: %w", err)
+		}
+		if err := pair[1].Decode(&version); err != nil {
+			return "", fmt.Errorf("invalid requirement version: %w", err)
+		}
+		constraints = append(constraints, operator+" "+version.Version)
+	}
+	if len(constraints) == 0 {
+		return ">= 0", nil
+	}
+	return strings.Join(constraints, ", "), nil
+}
+
+// ExtractSpec reads the specification from a .gem, which is a tar archive
+// holding metadata.gz, data.tar.gz and checksums.yaml.gz
+func ExtractSpec(content []byte) (*Specification, error) {
+	tarReader := utils.NewTarReader(bytes.NewReader(content))
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a gem: %w", err)
+		}
+		if header.Name != "metadata.gz" {
+			continue
+		}
+
+		gzipReader, err := gzip.NewReader(tarReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gem metadata: %w", err)
+		}
+		defer gzipReader.Close()
+
+		data, err := io.ReadAll(io.LimitReader(gzipReader, maxSpecSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gem metadata: %w", err)
+		}
+		if len(data) > maxSpecSize {
+			return nil, fmt.Errorf("gem metadata too large")
+		}
+
+		return ParseSpec(data)
+	}
+
+	return nil, fmt.Errorf("metadata.gz not found in gem")
+}
+
+// ParseSpec parses a YAML serialised gemspec
+func ParseSpec(data []byte) (*Specification, error) {
+	var raw gemspec
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid gemspec: %w", err)
+	}
+	if raw.Name == "" || raw.Version.Version == "" {
+		return nil, fmt.Errorf("invalid gemspec: name and version are required")
+	}
+
+	spec := &Specification{
+		Name:        raw.Name,
+		Version:     raw.Version.Version,
+		Platform:    raw.Platform,
+		Summary:     raw.Summary,
+		Description: raw.Description,
+		Authors:     raw.Authors,
+		Homepage:    raw.Homepage,
+		Licenses:    raw.Licenses,
+	}
+	if spec.Platform == "" {
+		spec.Platform = DefaultPlatform
+	}
+
+	var err error
+	if raw.RequiredRubyVersion != nil {
+		if spec.RequiredRubyVersion, err = raw.RequiredRubyVersion.String(); err != nil {
+			return nil, err
+		}
+	}
+	if raw.RequiredRubygemsVersion != nil {
+		if spec.RequiredRubygemsVersion, err = raw.RequiredRubygemsVersion.String(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, dependency := range raw.Dependencies {
+		requirement, err := dependency.Requirement.String()
+		if err != nil {
+			return nil, fmt.Errorf("dependency %s: %w", dependency.Name, err)
+		}
+		// Types are serialised as Ruby symbols, e.g. :runtime
+		dependencyType := strings.TrimPrefix(dependency.Type, ":")
+		if dependencyType == "" {
+			dependencyType = DependencyRuntime
+		}
+		spec.Dependencies = append(spec.Dependencies, Dependency{
+			Name:        dependency.Name,
+			Requirement: requirement,
+			Type:        dependencyType,
+		})
+	}
+
+	return spec, nil
+}
@@ -0,0 +1,122 @@
+package rubygems
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGemspec = `--- !ruby/object:Gem::Specification
+name: nokogiri
+version: !ruby/object:Gem::Version
+  version: '1.16'
+platform: x86_64-linux
+authors:
+- Mike Dalessio
+- Aaron Patterson
+summary: HTML, XML, SAX, and Reader parser
+description:
+homepage: https://nokogiri.org
+licenses:
+- MIT
+required_ruby_version: !ruby/object:Gem::Requirement
+  requirements:
+  - - ">="
+    - !ruby/object:Gem::Version
+      version: '3.0'
+  - - "<"
+    - !ruby/object:Gem::Version
+      version: 3.4.dev
+dependencies:
+- !ruby/object:Gem::Dependency
+  name: racc
+  requirement: !ruby/object:Gem::Requirement
+    requirements:
+    - - "~>"
+      - !ruby/object:Gem::Version
+        version: '1.4'
+  type: :runtime
+  prerelease: false
+- !ruby/object:Gem::Dependency
+  name: rake
+  requirement: !ruby/object:Gem::Requirement
+    requirements:
+    - - ">="
+      - !ruby/object:Gem::Version
+        version: '0'
+  type: :development
+  prerelease: false
+`
+
+// createGem builds a .gem holding the given gemspec YAML
+func createGem(t *testing.T, gemspec string) []byte {
+	t.Helper()
+
+	var metadata bytes.Buffer
+	gz := gzip.NewWriter(&metadata)
+	_, err := gz.Write([]byte(gemspec))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range map[string][]byte{"metadata.gz": metadata.Bytes(), "data.tar.gz": {}} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestExtractSpec(t *testing.T) {
+	spec, err := ExtractSpec(createGem(t, testGemspec))
+	require.NoError(t, err)
+
+	assert.Equal(t, "nokogiri", spec.Name)
+	assert.Equal(t, "1.16", spec.Version, "quoted versions stay strings")
+	assert.Equal(t, "x86_64-linux", spec.Platform)
+	assert.Equal(t, "nokogiri-1.16-x86_64-linux", spec.FullName())
+	assert.Equal(t, []string{"Mike Dalessio", "Aaron Patterson"}, spec.Authors)
+	assert.Equal(t, ">= 3.0, < 3.4.dev", spec.RequiredRubyVersion)
+	assert.Empty(t, spec.RequiredRubygemsVersion)
+	assert.Equal(t, []Dependency{
+		{Name: "racc", Requirement: "~> 1.4", Type: DependencyRuntime},
+		{Name: "rake", Requirement: ">= 0", Type: DependencyDevelopment},
+	}, spec.Dependencies)
+}
+
+func TestExtractSpec_Invalid(t *testing.T) {
+	_, err := ExtractSpec([]byte("not a gem"))
+	assert.Error(t, err)
+
+	_, err = ExtractSpec(createGem(t, "--- !ruby/object:Gem::Specification\nname: incomplete\n"))
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.Close())
+	_, err = ExtractSpec(buf.Bytes())
+	assert.ErrorContains(t, err, "metadata.gz not found")
+}
+
+func TestGetMetadata(t *testing.T) {
+	metadata, err := New(nil, nil).GetMetadata(createGem(t, testGemspec))
+	require.NoError(t, err)
+
+	assert.Equal(t, "x86_64-linux", metadata["platform"])
+	assert.Equal(t, "Mike Dalessio, Aaron Patterson", metadata["author"])
+	assert.Equal(t, "HTML, XML, SAX, and Reader parser", metadata["description"], "the summary describes gems without a description")
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "racc", "requirement": "~> 1.4"}}, metadata["dependencies"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"name": "rake", "requirement": ">= 0"}}, metadata["development_dependencies"])
+}
+
+func TestIsPrerelease(t *testing.T) {
+	assert.False(t, IsPrerelease("7.1.3"))
+	assert.True(t, IsPrerelease("7.1.0.rc1"))
+	assert.True(t, IsPrerelease("2.0.0.pre"))
+}
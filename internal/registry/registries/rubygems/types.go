@@ -0,0 +1,59 @@
+package rubygems
+
+import "strings"
+
+// DefaultPlatform is the platform of gems that are not platform specific
+const DefaultPlatform = "ruby"
+
+// Dependency types as recorded in a gemspec
+const (
+	DependencyRuntime     = "runtime"
+	DependencyDevelopment = "development"
+)
+
+// Specification holds the fields of a gemspec needed to serve and resolve a gem
+type Specification struct {
+	Name                    string
+	Version                 string
+	Platform                string
+	Summary                 string
+	Description             string
+	Authors                 []string
+	Homepage                string
+	Licenses                []string
+	RequiredRubyVersion     string
+	RequiredRubygemsVersion string
+	Dependencies            []Dependency
+}
+
+// Dependency is a gem another gem depends on
+type Dependency struct {
+	Name        string
+	Requirement string // comma-separated constraints, e.g. ">= 2.0, < 4"
+	Type        string // DependencyRuntime or DependencyDevelopment
+}
+
+// FullName is the name, version and, for platform-specific gems, platform
+// that RubyGems names the .gem file after
+func (s *Specification) FullName() string {
+	if s.Platform == "" || s.Platform == DefaultPlatform {
+		return s.Name + "-" + s.Version
+	}
+	return s.Name + "-" + s.Version + "-" + s.Platform
+}
+
+// IsPrerelease reports whether a gem version is a prerelease, which
+// Gem::Version marks by any letter in the version
+func IsPrerelease(version string) bool {
+	return strings.IndexFunc(version, func(r rune) bool {
+		return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+	}) != -1
+}
+
+// VersionInfo is one version of a gem as returned by the dependency API
+type VersionInfo struct {
+	Name         string     `json:"name"`
+	Number       string     `json:"number"`
+	Platform     string     `json:"platform"`
+	Dependencies [][]string `json:"dependencies"` // runtime dependencies as [name, requirement] pairs
+}
@@ -1,39 +1,107 @@
 package registry
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/registry/registries/debian"
+	"github.com/lgulliver/lodestone/internal/registry/registries/npm"
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/internal/registry/registries/opa"
+	"github.com/lgulliver/lodestone/internal/registry/registries/rpm"
 	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/checksum"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/metrics"
+	"github.com/lgulliver/lodestone/pkg/signing"
+	"github.com/lgulliver/lodestone/pkg/throttle"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/upstream"
 	"github.com/lgulliver/lodestone/pkg/utils"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrIconNotFound is returned when a package has no icon and no default icon is configured
+	ErrIconNotFound = errors.New("icon not found")
+
+	// ErrPublishForbidden is returned when a user may not publish a package
+	ErrPublishForbidden = errors.New("insufficient permissions to publish to package")
+
+	// ErrArtifactExists is returned when publishing a version that already exists
+	ErrArtifactExists = errors.New("artifact already exists")
+
+	// ErrArtifactUnchanged is returned together with the existing artifact when
+	// idempotent publishing is enabled and a version is re-published with
+	// byte-identical content. Callers should treat it as success.
+	ErrArtifactUnchanged = errors.New("artifact already exists with identical content")
+
+	// ErrArtifactNotFound is returned when a published version does not exist
+	ErrArtifactNotFound = errors.New("artifact not found")
+
+	// ErrPackageNotFound is returned when a package has neither versions nor owners
+	ErrPackageNotFound = errors.New("package not found")
+)
+
+const (
+	// DefaultListLimit is the page size of List when the filter sets no limit
+	DefaultListLimit = 100
+
+	// MaxListLimit caps the page size of List
+	MaxListLimit = 1000
 )
 
 // Service handles registry operations
 type Service struct {
-	DB        *common.Database
-	Storage   storage.BlobStorage
-	Ownership *OwnershipService
-	Settings  *RegistrySettingsService
-	factory   *Factory
-	handlers  map[string]Handler
+	DB            *common.Database
+	Storage       storage.BlobStorage
+	Ownership     *OwnershipService
+	Organizations *OrganizationService
+	Settings      *RegistrySettingsService
+	Quotas        *QuotaService
+	factory       *Factory
+	handlers      map[string]Handler
+	layout        PathLayout
+	config        config.RegistryConfig
+
+	approvalNotifier ApprovalNotifier
+	auditLog         *audit.Service
+	downloadLimiter  *throttle.Limiter
+	downloads        downloadBatch
+	downloadPolicy   DownloadPolicy
+	eventNotifier    EventNotifier
+	metrics          *metrics.Collector
+	signatureKeyring *signing.Keyring
+	upstreams        map[string]*upstream.Proxy
 }
 
 // NewService creates a new registry service
 func NewService(db *common.Database, storage storage.BlobStorage) *Service {
 	service := &Service{
-		DB:        db,
-		Storage:   storage,
-		Ownership: NewOwnershipService(db.DB),
-		Settings:  NewRegistrySettingsService(db.DB),
-		handlers:  make(map[string]Handler),
+		DB:            db,
+		Storage:       storage,
+		Ownership:     NewOwnershipService(db.DB),
+		Organizations: NewOrganizationService(db.DB),
+		Settings:      NewRegistrySettingsService(db.DB),
+		Quotas:        NewQuotaService(db.DB),
+		handlers:      make(map[string]Handler),
+		layout:        FlatLayout{},
+
+		approvalNotifier: logApprovalNotifier{},
 	}
 
 	// Create registry factory
@@ -44,6 +112,106 @@ func NewService(db *common.Database, storage storage.BlobStorage) *Service {
 	return service
 }
 
+// Configure applies registry behaviour settings to the service and its handlers
+func (s *Service) Configure(cfg config.RegistryConfig) {
+	s.config = cfg
+	s.downloadLimiter = throttle.NewLimiter(int64(cfg.DownloadRateAnonymous), int64(cfg.DownloadRateAuthenticated))
+	s.Quotas.SetDefaults(cfg.DefaultQuotaBytes, cfg.DefaultQuotaArtifacts)
+
+	if ociRegistry, ok := s.handlers["oci"].(*oci.Registry); ok {
+		ociRegistry.SetStrictNameValidation(cfg.OCIStrictNames)
+		ociRegistry.SetUploadSessionTTL(cfg.OCIUploadSessionTTL)
+		if err := ociRegistry.SetImmutableTags(cfg.OCIImmutableTags); err != nil {
+			log.Error().Err(err).Msg("Invalid OCI immutable tag patterns, not applied")
+		}
+	}
+
+	if npmRegistry, ok := s.handlers["npm"].(*npm.Registry); ok {
+		npmRegistry.SetTarballVerification(cfg.NPMVerifyTarballs)
+	}
+
+	if opaRegistry, ok := s.handlers["opa"].(*opa.Registry); ok {
+		opaRegistry.SetBundleValidation(cfg.OPAValidateBundles)
+	}
+
+	s.upstreams = make(map[string]*upstream.Proxy)
+	for registryType, url := range cfg.UpstreamURLs {
+		if _, exists := s.handlers[registryType]; !exists {
+			log.Error().Str("registry_type", registryType).Msg("Upstream configured for unsupported registry type, not applied")
+			continue
+		}
+		s.upstreams[registryType] = upstream.NewProxy(url, cfg.UpstreamCacheTTL)
+	}
+
+	if debianRegistry, ok := s.handlers["debian"].(*debian.Registry); ok && cfg.DebianSigningKeyPath != "" {
+		key, err := signing.LoadKey(cfg.DebianSigningKeyPath, cfg.DebianSigningKeyPassphrase)
+		if err != nil {
+			log.Error().Err(err).Str("path", cfg.DebianSigningKeyPath).Msg("Failed to load Debian signing key, serving unsigned repository")
+		} else {
+			debianRegistry.SetSigningKey(key)
+		}
+	}
+
+	if rpmRegistry, ok := s.handlers["rpm"].(*rpm.Registry); ok && cfg.RPMSigningKeyPath != "" {
+		key, err := signing.LoadKey(cfg.RPMSigningKeyPath, cfg.RPMSigningKeyPassphrase)
+		if err != nil {
+			log.Error().Err(err).Str("path", cfg.RPMSigningKeyPath).Msg("Failed to load RPM signing key, serving unsigned repository")
+		} else {
+			rpmRegistry.SetSigningKey(key)
+		}
+	}
+
+	s.signatureKeyring = nil
+	if cfg.SignatureKeyringPath != "" {
+		keyring, err := signing.LoadKeyring(cfg.SignatureKeyringPath)
+		if err != nil {
+			log.Error().Err(err).Str("path", cfg.SignatureKeyringPath).Msg("Failed to load signature keyring, uploads requiring signatures will be rejected")
+		} else {
+			s.signatureKeyring = keyring
+		}
+	}
+}
+
+// MaxUploadSize returns the largest request body, in bytes, uploads to a
+// registry may have, 0 for unlimited
+func (s *Service) MaxUploadSize(registryType string) int64 {
+	return s.config.UploadLimit(registryType)
+}
+
+// SetMetrics sets the collector that records registry operations; nil
+// disables recording
+func (s *Service) SetMetrics(collector *metrics.Collector) {
+	s.metrics = collector
+}
+
+// SetAuditLog sets the audit trail that writes through the service, its
+// settings and its quotas are recorded to; nil disables recording
+func (s *Service) SetAuditLog(auditLog *audit.Service) {
+	s.auditLog = auditLog
+	s.Settings.auditLog = auditLog
+	s.Quotas.auditLog = auditLog
+}
+
+// SetUploadSessionCache sets the shared cache OCI upload sessions are kept
+// in, so the chunks of an upload can arrive at any gateway instance; nil
+// keeps them in memory
+func (s *Service) SetUploadSessionCache(cache oci.SessionCache) {
+	ociRegistry, ok := s.handlers["oci"].(*oci.Registry)
+	if !ok {
+		return
+	}
+	if cache == nil {
+		ociRegistry.SetUploadSessionStore(oci.NewMemorySessionStore())
+		return
+	}
+	ociRegistry.SetUploadSessionStore(oci.NewCacheSessionStore(cache))
+}
+
+// AuditLog returns the audit trail writes are recorded to, or nil if none is set
+func (s *Service) AuditLog() *audit.Service {
+	return s.auditLog
+}
+
 // registerHandlers registers all supported registry types
 func (s *Service) registerHandlers() {
 	// Register handlers for all supported registries
@@ -57,6 +225,8 @@ func (s *Service) registerHandlers() {
 		"opa",
 		"cargo",
 		"rubygems",
+		"debian",
+		"rpm",
 	}
 
 	for _, format := range formats {
@@ -66,6 +236,20 @@ func (s *Service) registerHandlers() {
 
 // Upload handles artifact upload
 func (s *Service) Upload(ctx context.Context, registryType, name, version string, content io.Reader, publishedBy uuid.UUID) (*types.Artifact, error) {
+	start := time.Now()
+	artifact, err := s.upload(ctx, registryType, name, version, content, publishedBy)
+
+	// Identical re-publishes are reported as successful uploads
+	if err == nil || errors.Is(err, ErrArtifactUnchanged) {
+		s.metrics.ObserveRegistryOperation("upload", registryType, nil, start)
+		s.metrics.ObserveArtifactSize("upload", registryType, artifact.Size)
+	} else {
+		s.metrics.ObserveRegistryOperation("upload", registryType, err, start)
+	}
+	return artifact, err
+}
+
+func (s *Service) upload(ctx context.Context, registryType, name, version string, content io.Reader, publishedBy uuid.UUID) (*types.Artifact, error) {
 	log.Info().
 		Str("registry_type", registryType).
 		Str("name", name).
@@ -73,6 +257,18 @@ func (s *Service) Upload(ctx context.Context, registryType, name, version string
 		Str("published_by", publishedBy.String()).
 		Msg("Starting artifact upload")
 
+	// Get registry handler
+	handler, exists := s.handlers[registryType]
+	if !exists {
+		log.Error().Str("registry_type", registryType).Msg("Unsupported registry type")
+		return nil, fmt.Errorf("unsupported registry type: %s", registryType)
+	}
+
+	// Scoped API keys can only publish the packages they are scoped for
+	if err := auth.CheckAPIKeyScope(ctx, registryType, name); err != nil {
+		return nil, err
+	}
+
 	// Check if registry is enabled
 	enabled, err := s.Settings.IsRegistryEnabled(ctx, registryType)
 	if err != nil {
@@ -84,35 +280,69 @@ func (s *Service) Upload(ctx context.Context, registryType, name, version string
 		return nil, fmt.Errorf("registry %s is currently disabled", registryType)
 	}
 
-	// Get registry handler
-	handler, exists := s.handlers[registryType]
-	if !exists {
-		log.Error().Str("registry_type", registryType).Msg("Unsupported registry type")
-		return nil, fmt.Errorf("unsupported registry type: %s", registryType)
+	// Check if publishes to this registry must be approved before release
+	requireApproval, err := s.Settings.RequiresApproval(ctx, registryType)
+	if err != nil {
+		log.Error().Err(err).Str("registry_type", registryType).Msg("Failed to check approval requirement")
+		return nil, fmt.Errorf("failed to check approval requirement: %w", err)
 	}
 
-	// Read content into memory for processing
-	contentBytes, err := io.ReadAll(content)
+	// Read the content, hashing it in the same pass. Content the handler
+	// needs only the start of is streamed into storage rather than held in
+	// memory, and removed again unless the upload is accepted.
+	received, err := s.receiveContent(ctx, handler, content)
 	if err != nil {
 		log.Error().Err(err).Str("name", name).Msg("Failed to read artifact content")
 		return nil, fmt.Errorf("failed to read content: %w", err)
 	}
+	defer s.discard(ctx, received)
+	contentBytes := received.data
 
 	log.Debug().
 		Str("name", name).
-		Int("content_size", len(contentBytes)).
+		Int64("content_size", received.size).
+		Bool("streamed", received.spoolPath != "").
 		Msg("Artifact content read successfully")
 
+	// Reject content corrupted in transit before it is inspected or stored
+	if err := checksum.Verify(ctx, received.sha256); err != nil {
+		log.Warn().Err(err).Str("registry_type", registryType).Str("name", name).Str("version", version).Msg("Upload rejected - checksum mismatch")
+		return nil, err
+	}
+
+	// Reject content that is obviously not a package of this registry before
+	// any signature check or parsing
+	if s.config.StrictContentValidation {
+		if err := checkContentFormat(registryType, contentBytes); err != nil {
+			log.Warn().Err(err).Str("registry_type", registryType).Str("name", name).Str("version", version).Msg("Upload rejected - unexpected content format")
+			return nil, err
+		}
+	}
+
+	// Reject unsigned or untrusted uploads before anything is stored. OCI
+	// manifests are checked by VerifyManifestSignature before they are stored.
+	var verification *signing.Verification
+	if registryType != "oci" {
+		verification, err = s.verifyUploadSignature(ctx, registryType, received)
+		if err != nil {
+			log.Warn().Err(err).Str("registry_type", registryType).Str("name", name).Str("version", version).Msg("Upload rejected - signature not verified")
+			return nil, err
+		}
+	}
+
 	// Create artifact object
 	artifact := &types.Artifact{
 		ID:          uuid.New(), // Generate new UUID
 		Name:        utils.SanitizePackageName(name, registryType),
 		Version:     version,
 		Registry:    registryType,
-		Size:        int64(len(contentBytes)),
-		SHA256:      utils.ComputeSHA256(contentBytes),
+		Size:        received.size,
+		SHA256:      hex.EncodeToString(received.sha256),
 		PublishedBy: publishedBy,
-		IsPublic:    false, // Default to private
+		Status:      types.ArtifactStatusPublished,
+	}
+	if requireApproval {
+		artifact.Status = types.ArtifactStatusPendingApproval
 	}
 
 	// Validate with registry-specific handler
@@ -126,62 +356,384 @@ func (s *Service) Upload(ctx context.Context, registryType, name, version string
 		return nil, fmt.Errorf("failed to extract metadata: %w", err)
 	}
 	artifact.Metadata = metadata
+	if verification != nil {
+		if artifact.Metadata == nil {
+			artifact.Metadata = make(map[string]interface{})
+		}
+		artifact.Metadata["signature"] = map[string]interface{}{
+			"type":   verification.Type,
+			"key_id": verification.KeyID,
+		}
+	}
+
+	// Check if this is a new package (no versions published locally).
+	// Versions cached from the upstream have no owner, so they do not count.
+	localCount, cachedCount, err := s.packageOrigins(ctx, registryType, artifact.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkUpstreamName(ctx, registryType, artifact.Name, localCount, cachedCount, publishedBy); err != nil {
+		return nil, err
+	}
+
+	// Check package ownership permissions, including those of the
+	// organization owning the package's namespace
+	canPublish, err := s.Ownership.CanUserPublish(ctx, registryType, artifact.Name, publishedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check ownership permissions: %w", err)
+	}
 
-	// Check if this is a new package (no existing versions)
-	var existingCount int64
-	if err := s.DB.Model(&types.Artifact{}).Where("LOWER(name) = LOWER(?) AND registry = ?",
-		artifact.Name, artifact.Registry).Count(&existingCount).Error; err != nil {
-		return nil, fmt.Errorf("failed to check existing packages: %w", err)
+	if !canPublish {
+		return nil, fmt.Errorf("%w %s", ErrPublishForbidden, artifact.Name)
 	}
 
 	// If package doesn't exist, establish initial ownership
-	if existingCount == 0 {
+	if localCount == 0 {
 		if err := s.Ownership.EstablishInitialOwnership(ctx, registryType, artifact.Name, publishedBy); err != nil {
 			return nil, fmt.Errorf("failed to establish package ownership: %w", err)
 		}
 	}
 
-	// Check package ownership permissions
-	canPublish, err := s.Ownership.CanUserPublish(ctx, registryType, artifact.Name, publishedBy)
+	artifact.IsPublic, err = s.ResolveVisibility(ctx, registryType, artifact.Name)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check ownership permissions: %w", err)
+		return nil, err
 	}
 
-	if !canPublish {
-		return nil, fmt.Errorf("insufficient permissions to publish to package %s", artifact.Name)
+	// Check if artifact already exists. A deleted version keeps its name and
+	// version until it is purged, so that it can still be restored.
+	var existingArtifact types.Artifact
+	if err := s.DB.Unscoped().Where("normalized_name = ? AND version = ? AND registry = ?",
+		utils.NormalizePackageName(artifact.Name, artifact.Registry), artifact.Version, artifact.Registry).First(&existingArtifact).Error; err == nil {
+		if existingArtifact.DeletedAt.Valid {
+			return nil, fmt.Errorf("%w: %s:%s was deleted and can be restored until it is purged", ErrArtifactExists, name, version)
+		}
+		// Retried publishes of identical content succeed when idempotent publishing is enabled
+		if s.config.IdempotentPublish && existingArtifact.SHA256 == artifact.SHA256 {
+			log.Info().
+				Str("registry_type", registryType).
+				Str("name", name).
+				Str("version", version).
+				Msg("Re-publish with identical content treated as success")
+			return &existingArtifact, ErrArtifactUnchanged
+		}
+		return nil, fmt.Errorf("%w: %s:%s", ErrArtifactExists, name, version)
 	}
 
-	// Check if artifact already exists
-	var existingArtifact types.Artifact
-	if err := s.DB.Where("LOWER(name) = LOWER(?) AND version = ? AND registry = ?",
-		artifact.Name, artifact.Version, artifact.Registry).First(&existingArtifact).Error; err == nil {
-		return nil, fmt.Errorf("artifact %s:%s already exists", name, version)
+	// Immutable registries never accept a version again once it was published
+	if err := s.checkPublishedVersion(ctx, artifact, publishedBy); err != nil {
+		log.Warn().Err(err).Str("registry_type", registryType).Str("name", name).Str("version", version).Msg("Upload rejected - version previously published")
+		return nil, err
 	}
 
-	// Generate storage path
-	artifact.StoragePath = handler.GenerateStoragePath(name, version)
+	// Check the upload fits within the publisher's quotas
+	if err := s.Quotas.CheckUpload(ctx, publishedBy, registryType, artifact.Size); err != nil {
+		log.Warn().Err(err).Str("registry_type", registryType).Str("name", name).Str("version", version).Msg("Upload rejected - quota exceeded")
+		return nil, err
+	}
 
-	// Store the artifact
-	if err := handler.Upload(ctx, artifact, contentBytes); err != nil {
-		return nil, fmt.Errorf("failed to upload artifact: %w", err)
+	// Store the artifact, once for all artifacts with identical content
+	artifact.StoragePath = s.storagePath(handler, artifact)
+	if streaming, ok := handler.(StreamingHandler); ok {
+		if err := s.storeSpooled(ctx, streaming, artifact, received); err != nil {
+			return nil, fmt.Errorf("failed to upload artifact: %w", err)
+		}
+	} else {
+		if err := s.storeContent(ctx, handler, artifact, contentBytes); err != nil {
+			return nil, fmt.Errorf("failed to upload artifact: %w", err)
+		}
+		// Store any icon embedded in the package
+		s.storeIcon(ctx, handler, artifact, contentBytes)
 	}
 
 	// Save to database
-	if err := s.DB.Create(artifact).Error; err != nil {
-		// Try to clean up stored file on database error
-		s.Storage.Delete(ctx, artifact.StoragePath)
+	if err := s.createArtifact(ctx, artifact); err != nil {
+		s.removeIcon(ctx, artifact)
 		return nil, fmt.Errorf("failed to save artifact metadata: %w", err)
 	}
+	if artifact.Status == types.ArtifactStatusPublished {
+		if err := s.recordPublishedVersion(ctx, artifact); err != nil {
+			s.removeArtifact(ctx, artifact)
+			s.removeIcon(ctx, artifact)
+			return nil, err
+		}
+	}
+
+	if artifact.Status == types.ArtifactStatusPendingApproval {
+		s.notifyApproval(ctx, ApprovalEventSubmitted, artifact, publishedBy, "")
+	} else {
+		s.indexArtifact(artifact)
+		if _, ok := handler.(StreamingHandler); ok {
+			s.storeReadmeFromStorage(ctx, artifact)
+		} else {
+			s.storeReadme(ctx, artifact, contentBytes)
+		}
+		s.notifyEvent(ctx, EventPackagePublished, artifact, publishedBy)
+	}
+	s.auditLog.Record(ctx, publishedBy, audit.ActionPackagePublish, audit.PackageTarget(registryType, artifact.Name, artifact.Version), map[string]interface{}{
+		"size":   artifact.Size,
+		"sha256": artifact.SHA256,
+		"status": artifact.Status,
+	})
 
 	return artifact, nil
 }
 
+// CheckPublish makes the checks Upload makes before storing anything, for
+// content stored outside Upload such as OCI manifests: the
+// API key scope, that the registry is enabled, the publisher's permission to
+// publish the package, that an immutable registry never published the
+// version before, and that size more bytes fit within their quotas. A version
+// that already exists is neither checked against the ledger nor counted
+// against the quotas again. It returns the error Upload would.
+func (s *Service) CheckPublish(ctx context.Context, registryType, name, version string, size int64, publishedBy uuid.UUID) error {
+	if err := auth.CheckAPIKeyScope(ctx, registryType, name); err != nil {
+		return err
+	}
+
+	enabled, err := s.Settings.IsRegistryEnabled(ctx, registryType)
+	if err != nil {
+		return fmt.Errorf("failed to check registry status: %w", err)
+	}
+	if !enabled {
+		return fmt.Errorf("registry %s is currently disabled", registryType)
+	}
+
+	name = utils.SanitizePackageName(name, registryType)
+	canPublish, err := s.Ownership.CanUserPublish(ctx, registryType, name, publishedBy)
+	if err != nil {
+		return fmt.Errorf("failed to check ownership permissions: %w", err)
+	}
+	if !canPublish {
+		return fmt.Errorf("%w %s", ErrPublishForbidden, name)
+	}
+	local, cached, err := s.packageOrigins(ctx, registryType, name)
+	if err != nil {
+		return err
+	}
+	if err := s.checkUpstreamName(ctx, registryType, name, local, cached, publishedBy); err != nil {
+		return err
+	}
+
+	if _, err := s.GetArtifact(ctx, registryType, name, version); err == nil {
+		return nil
+	} else if !errors.Is(err, ErrArtifactNotFound) {
+		return err
+	}
+	if err := s.checkPublishedVersion(ctx, &types.Artifact{Name: name, Version: version, Registry: registryType}, publishedBy); err != nil {
+		return err
+	}
+	return s.Quotas.CheckUpload(ctx, publishedBy, registryType, size)
+}
+
+// indexArtifact adds a published artifact to its handler's index, if the
+// handler keeps one
+func (s *Service) indexArtifact(artifact *types.Artifact) {
+	if maintainer, ok := s.handlers[artifact.Registry].(IndexMaintainer); ok && artifact.Status == types.ArtifactStatusPublished {
+		maintainer.AddToIndex(artifact)
+	}
+}
+
+// unindexArtifact removes an artifact from its handler's index, if the
+// handler keeps one
+func (s *Service) unindexArtifact(artifact *types.Artifact) {
+	if maintainer, ok := s.handlers[artifact.Registry].(IndexMaintainer); ok {
+		maintainer.RemoveFromIndex(artifact)
+	}
+}
+
+// storeIcon extracts an embedded icon from the package, stores it alongside the
+// artifact and records its location in the artifact metadata. Icon problems are
+// logged rather than failing the upload.
+func (s *Service) storeIcon(ctx context.Context, handler Handler, artifact *types.Artifact, content []byte) {
+	extractor, ok := handler.(IconExtractor)
+	if !ok {
+		return
+	}
+
+	data, filename, err := extractor.ExtractIcon(content)
+	if err != nil {
+		log.Warn().Err(err).Str("name", artifact.Name).Str("version", artifact.Version).Msg("Failed to extract package icon")
+		return
+	}
+	if data == nil {
+		return
+	}
+
+	contentType := utils.IconContentType(data)
+	if contentType == "" {
+		log.Warn().Str("name", artifact.Name).Str("icon", filename).Msg("Ignoring package icon with unsupported content type")
+		return
+	}
+
+	iconPath := filepath.Join("icons", artifact.Registry, artifact.Name, artifact.Version, "icon"+strings.ToLower(filepath.Ext(filename)))
+	if err := s.Storage.Store(ctx, iconPath, bytes.NewReader(data), contentType); err != nil {
+		log.Warn().Err(err).Str("name", artifact.Name).Str("icon_path", iconPath).Msg("Failed to store package icon")
+		return
+	}
+
+	if artifact.Metadata == nil {
+		artifact.Metadata = make(types.JSONMap)
+	}
+	artifact.Metadata["icon"] = map[string]interface{}{
+		"path":        iconPath,
+		"contentType": contentType,
+	}
+}
+
+// removeIcon deletes the icon stored for an artifact whose upload failed
+// after storeIcon ran, so it is not left behind without an artifact
+func (s *Service) removeIcon(ctx context.Context, artifact *types.Artifact) {
+	icon, ok := artifact.Metadata["icon"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	iconPath, _ := icon["path"].(string)
+	if iconPath == "" {
+		return
+	}
+	if err := s.Storage.Delete(ctx, iconPath); err != nil {
+		log.Warn().Err(err).Str("icon_path", iconPath).Msg("Failed to delete package icon")
+	}
+}
+
+// GetIcon returns the icon of the most recent version of a package that has
+// one, falling back to the configured default icon. Restricted packages are
+// treated as having no icon for requests by users who cannot read them, as
+// they are for downloads.
+func (s *Service) GetIcon(ctx context.Context, registryType, name string) (io.ReadCloser, string, error) {
+	if err := auth.CheckAPIKeyScope(ctx, registryType, name); err != nil {
+		return nil, "", err
+	}
+
+	query := s.DB.WithContext(ctx).
+		Where("normalized_name = ? AND registry = ? AND status = ?", utils.NormalizePackageName(name, registryType), registryType, types.ArtifactStatusPublished)
+	if user, ok := readerFromContext(ctx); ok {
+		var err error
+		if query, err = s.whereReadable(ctx, query, user); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var artifacts []types.Artifact
+	if err := query.Order("created_at DESC").Find(&artifacts).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to find package: %w", err)
+	}
+
+	for _, artifact := range artifacts {
+		icon, ok := artifact.Metadata["icon"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		iconPath, _ := icon["path"].(string)
+		contentType, _ := icon["contentType"].(string)
+		if iconPath == "" {
+			continue
+		}
+
+		reader, err := s.Storage.Retrieve(ctx, iconPath)
+		if err != nil {
+			log.Warn().Err(err).Str("icon_path", iconPath).Msg("Failed to retrieve package icon")
+			continue
+		}
+		return reader, contentType, nil
+	}
+
+	if s.config.DefaultIconPath == "" {
+		return nil, "", ErrIconNotFound
+	}
+
+	data, err := os.ReadFile(s.config.DefaultIconPath)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read default icon: %w", err)
+	}
+
+	contentType := utils.IconContentType(data)
+	if contentType == "" {
+		return nil, "", fmt.Errorf("default icon %s is not a supported image", s.config.DefaultIconPath)
+	}
+	return io.NopCloser(bytes.NewReader(data)), contentType, nil
+}
+
+// GetArtifact returns the stored record for a specific artifact version
+// without retrieving its content or counting a download
+func (s *Service) GetArtifact(ctx context.Context, registryType, name, version string) (*types.Artifact, error) {
+	var artifact types.Artifact
+	if err := s.DB.WithContext(ctx).
+		Where("normalized_name = ? AND version = ? AND registry = ?", utils.NormalizePackageName(name, registryType), version, registryType).
+		First(&artifact).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrArtifactNotFound
+		}
+		return nil, fmt.Errorf("failed to find artifact: %w", err)
+	}
+	return &artifact, nil
+}
+
+// GetPublishedArtifact returns the record of a published artifact version
+// the request may read, as Download finds it, without retrieving its content
+// or counting a download. Versions that are unpublished, awaiting approval or
+// hidden from the reader are not found.
+func (s *Service) GetPublishedArtifact(ctx context.Context, registryType, name, version string) (*types.Artifact, error) {
+	if err := auth.CheckAPIKeyScope(ctx, registryType, name); err != nil {
+		return nil, err
+	}
+
+	var artifact types.Artifact
+	if err := s.DB.WithContext(ctx).
+		Where("normalized_name = ? AND version = ? AND registry = ? AND status = ?",
+			utils.NormalizePackageName(name, registryType), version, registryType, types.ArtifactStatusPublished).
+		First(&artifact).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+		}
+		return nil, fmt.Errorf("failed to find artifact: %w", err)
+	}
+	if user, ok := readerFromContext(ctx); ok {
+		readable, err := s.canRead(ctx, &artifact, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check read access: %w", err)
+		}
+		if !readable {
+			return nil, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+		}
+	}
+	return &artifact, nil
+}
+
 // Download handles artifact download
 func (s *Service) Download(ctx context.Context, registryType, name, version string) (*types.Artifact, io.ReadCloser, error) {
+	start := time.Now()
+	artifact, content, err := s.download(ctx, registryType, name, version, 0, -1)
+	s.metrics.ObserveRegistryOperation("download", registryType, err, start)
+	if err == nil {
+		s.metrics.ObserveArtifactSize("download", registryType, artifact.Size)
+	}
+	return artifact, content, err
+}
+
+// DownloadRange handles a partial artifact download, returning up to length
+// bytes of the artifact's content starting at offset. Only downloads from the
+// start of the content are counted, so resuming a download counts it once.
+func (s *Service) DownloadRange(ctx context.Context, registryType, name, version string, offset, length int64) (*types.Artifact, io.ReadCloser, error) {
+	start := time.Now()
+	artifact, content, err := s.download(ctx, registryType, name, version, offset, length)
+	s.metrics.ObserveRegistryOperation("download", registryType, err, start)
+	if err == nil {
+		s.metrics.ObserveArtifactSize("download", registryType, length)
+	}
+	return artifact, content, err
+}
+
+// download retrieves an artifact's content from offset, all of it if length
+// is negative
+func (s *Service) download(ctx context.Context, registryType, name, version string, offset, length int64) (*types.Artifact, io.ReadCloser, error) {
 	// Check if registry type is supported
 	if _, exists := s.handlers[registryType]; !exists {
 		return nil, nil, fmt.Errorf("unsupported registry type: %s", registryType)
 	}
+	if err := auth.CheckAPIKeyScope(ctx, registryType, name); err != nil {
+		return nil, nil, err
+	}
 
 	// Check if registry is enabled
 	enabled, err := s.Settings.IsRegistryEnabled(ctx, registryType)
@@ -194,13 +746,28 @@ func (s *Service) Download(ctx context.Context, registryType, name, version stri
 
 	// Get artifact metadata from database
 	var artifact types.Artifact
-	if err := s.DB.Where("LOWER(name) = LOWER(?) AND version = ? AND registry = ?",
-		name, version, registryType).First(&artifact).Error; err != nil {
+	if err := s.DB.Where("normalized_name = ? AND version = ? AND registry = ? AND status = ?",
+		utils.NormalizePackageName(name, registryType), version, registryType, types.ArtifactStatusPublished).First(&artifact).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return nil, nil, fmt.Errorf("artifact not found: %s:%s", name, version)
+			return nil, nil, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
 		}
 		return nil, nil, fmt.Errorf("failed to get artifact: %w", err)
 	}
+	// Restricted packages are hidden from requests by users who cannot read them
+	if user, ok := readerFromContext(ctx); ok {
+		readable, err := s.canRead(ctx, &artifact, user)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check read access: %w", err)
+		}
+		if !readable {
+			return nil, nil, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+		}
+	}
+	if s.downloadPolicy != nil {
+		if err := s.downloadPolicy.CheckDownload(ctx, &artifact); err != nil {
+			return nil, nil, err
+		}
+	}
 
 	// Log artifact details
 	log.Info().
@@ -211,7 +778,12 @@ func (s *Service) Download(ctx context.Context, registryType, name, version stri
 		Msg("found artifact in database")
 
 	// Get content from storage
-	content, err := s.Storage.Retrieve(ctx, artifact.StoragePath)
+	var content io.ReadCloser
+	if length < 0 {
+		content, err = s.Storage.Retrieve(ctx, artifact.StoragePath)
+	} else {
+		content, err = s.Storage.RetrieveRange(ctx, artifact.StoragePath, offset, length)
+	}
 	if err != nil {
 		log.Error().Err(err).
 			Str("storage_path", artifact.StoragePath).
@@ -219,23 +791,57 @@ func (s *Service) Download(ctx context.Context, registryType, name, version stri
 		return nil, nil, fmt.Errorf("failed to retrieve artifact: %w", err)
 	}
 
-	// Increment download counter
-	s.DB.Model(&artifact).Where("id = ?", artifact.ID).Update("downloads", gorm.Expr("downloads + ?", 1))
+	// Count the download once, not for every range of a resumed one
+	if offset == 0 {
+		s.recordDownload(ctx, &artifact)
+	}
+
+	// Apply the downloading client's bandwidth limit, if any
+	return &artifact, s.downloadLimiter.Wrap(ctx, content), nil
+}
 
-	return &artifact, content, nil
+// ThrottleDownload applies the downloading client's bandwidth limit, as
+// Download does, to content served to a client outside it, such as OCI blobs
+func (s *Service) ThrottleDownload(ctx context.Context, content io.ReadCloser) io.ReadCloser {
+	return s.downloadLimiter.Wrap(ctx, content)
 }
 
-// List returns artifacts matching the filter
+// List returns a page of the artifacts matching the filter, ordered by name
+// and publication, and the total number matching. The page holds
+// filter.Limit artifacts, DefaultListLimit if unset and at most MaxListLimit,
+// after skipping filter.Offset. Callers needing every match use ListAll.
 func (s *Service) List(ctx context.Context, filter *types.ArtifactFilter) ([]*types.Artifact, int64, error) {
-	query := s.DB.Model(&types.Artifact{})
+	start := time.Now()
+	artifacts, total, err := s.list(ctx, filter)
+	s.metrics.ObserveRegistryOperation("list", filter.Registry, err, start)
+	return artifacts, total, err
+}
+
+func (s *Service) list(ctx context.Context, filter *types.ArtifactFilter) ([]*types.Artifact, int64, error) {
+	query := s.DB.WithContext(ctx).Model(&types.Artifact{}).Where("status = ?", types.ArtifactStatusPublished)
 
 	// Apply filters
-	if filter.Name != "" {
+	if filter.Name != "" && filter.ExactName {
+		query = query.Where("normalized_name = ?", utils.NormalizePackageName(filter.Name, filter.Registry))
+	} else if filter.Name != "" {
 		query = query.Where("LOWER(name) LIKE LOWER(?)", "%"+filter.Name+"%")
 	}
 	if filter.Registry != "" {
 		query = query.Where("registry = ?", filter.Registry)
 	}
+	for _, term := range filter.Terms {
+		term = "%" + strings.ToLower(term) + "%"
+		query = query.Where("(LOWER(name) LIKE ? OR LOWER(CAST(metadata AS TEXT)) LIKE ?)", term, term)
+	}
+	query = whereLabels(query, filter.Labels)
+
+	// Requests list only the packages their user can read
+	if user, ok := readerFromContext(ctx); ok {
+		var err error
+		if query, err = s.whereReadable(ctx, query, user); err != nil {
+			return nil, 0, err
+		}
+	}
 
 	// Get total count
 	var total int64
@@ -243,10 +849,15 @@ func (s *Service) List(ctx context.Context, filter *types.ArtifactFilter) ([]*ty
 		return nil, 0, fmt.Errorf("failed to count artifacts: %w", err)
 	}
 
-	// Apply pagination
-	if filter.Limit > 0 {
-		query = query.Limit(filter.Limit)
+	// Apply pagination over a stable order
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
 	}
+	query = query.Order("name, created_at, id").Limit(limit)
 	if filter.Offset > 0 {
 		query = query.Offset(filter.Offset)
 	}
@@ -260,14 +871,193 @@ func (s *Service) List(ctx context.Context, filter *types.ArtifactFilter) ([]*ty
 	return artifacts, total, nil
 }
 
+// ListAll returns every artifact matching the filter, loaded MaxListLimit at
+// a time, for callers that need them all, such as the versions of a package
+// or a repository index. The filter's limit and offset are ignored.
+func (s *Service) ListAll(ctx context.Context, filter *types.ArtifactFilter) ([]*types.Artifact, error) {
+	page := *filter
+	page.Limit = MaxListLimit
+	page.Offset = 0
+
+	var artifacts []*types.Artifact
+	for {
+		batch, total, err := s.List(ctx, &page)
+		if err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, batch...)
+		page.Offset += len(batch)
+		if len(batch) < page.Limit || int64(page.Offset) >= total {
+			return artifacts, nil
+		}
+	}
+}
+
+// PackageSearch selects a page of the packages of a registry by the
+// published versions matching it
+type PackageSearch struct {
+	Registry string
+
+	// Where holds further conditions each matching version meets
+	Where []clause.Expr
+
+	// Score is the relevance of a matching version. Packages are ordered by
+	// the highest score of their matching versions, then by their total
+	// downloads and then by name. Unset, every version scores 0.
+	Score clause.Expr
+
+	Limit  int // packages per page; DefaultListLimit if unset and at most MaxListLimit
+	Offset int // packages to skip
+}
+
+// SearchPackages returns the matching versions of one page of the packages
+// the search selects, in page order, and the total number of packages it
+// selects. Only the versions of the page's packages are loaded, so a search
+// costs the same however many packages a registry holds.
+func (s *Service) SearchPackages(ctx context.Context, search *PackageSearch) ([][]*types.Artifact, int64, error) {
+	matching := func() (*gorm.DB, error) {
+		query := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+			Where("artifacts.registry = ? AND artifacts.status = ?", search.Registry, types.ArtifactStatusPublished)
+		for _, condition := range search.Where {
+			query = query.Where(condition)
+		}
+
+		// Requests search only the packages their user can read
+		if user, ok := readerFromContext(ctx); ok {
+			return s.whereReadable(ctx, query, user)
+		}
+		return query, nil
+	}
+	scored := func() (*gorm.DB, error) {
+		query, err := matching()
+		if err != nil {
+			return nil, err
+		}
+		score := search.Score
+		if score.SQL == "" {
+			score = gorm.Expr("0")
+		}
+		return query.Select("artifacts.normalized_name, artifacts.downloads, ? AS score", score), nil
+	}
+
+	query, err := scored()
+	if err != nil {
+		return nil, 0, err
+	}
+	var total int64
+	if err := s.DB.WithContext(ctx).Table("(?) AS matches", query).
+		Distinct("normalized_name").
+		Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count packages: %w", err)
+	}
+
+	limit := search.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	if query, err = scored(); err != nil {
+		return nil, 0, err
+	}
+	var names []string
+	if err := s.DB.WithContext(ctx).Table("(?) AS matches", query).
+		Group("normalized_name").
+		Order("MAX(score) DESC, SUM(downloads) DESC, normalized_name").
+		Limit(limit).
+		Offset(max(search.Offset, 0)).
+		Pluck("normalized_name", &names).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list packages: %w", err)
+	}
+	if len(names) == 0 {
+		return nil, total, nil
+	}
+
+	if query, err = matching(); err != nil {
+		return nil, 0, err
+	}
+	var artifacts []*types.Artifact
+	if err := query.Where("artifacts.normalized_name IN ?", names).
+		Order("artifacts.created_at, artifacts.id").
+		Find(&artifacts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to get package versions: %w", err)
+	}
+
+	byName := make(map[string][]*types.Artifact, len(names))
+	for _, artifact := range artifacts {
+		byName[artifact.NormalizedName] = append(byName[artifact.NormalizedName], artifact)
+	}
+	packages := make([][]*types.Artifact, 0, len(names))
+	for _, name := range names {
+		if versions := byName[name]; len(versions) > 0 {
+			packages = append(packages, versions)
+		}
+	}
+	return packages, total, nil
+}
+
+// ListNames returns the distinct names of the published packages of a
+// registry that sort after the given name, in order, at most limit of them
+func (s *Service) ListNames(ctx context.Context, registryType, after string, limit int) ([]string, error) {
+	query := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+		Where("registry = ? AND status = ?", registryType, types.ArtifactStatusPublished)
+	return s.pluckNames(query, after, limit)
+}
+
+// ListReadableNames is ListNames limited to the packages user can read and
+// whose names start with prefix. Public packages are readable by anyone,
+// private ones by the users who published them, hold a role on them or are
+// members of the organization owning their namespace, and every package by
+// administrators. A nil user reads only public packages.
+func (s *Service) ListReadableNames(ctx context.Context, registryType, prefix, after string, limit int, user *types.User) ([]string, error) {
+	query := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+		Where("registry = ? AND status = ?", registryType, types.ArtifactStatusPublished)
+	if prefix != "" {
+		// Compared as a substring so LIKE wildcards in names need no escaping
+		query = query.Where("SUBSTR(name, 1, ?) = ?", len(prefix), prefix)
+	}
+
+	query, err := s.whereReadable(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+	return s.pluckNames(query, after, limit)
+}
+
+// pluckNames returns the distinct names matched by an artifact query that
+// sort after the given name, in order, at most limit of them
+func (s *Service) pluckNames(query *gorm.DB, after string, limit int) ([]string, error) {
+	if after != "" {
+		query = query.Where("name > ?", after)
+	}
+
+	var names []string
+	if err := query.Distinct("name").Order("name").Limit(limit).Pluck("name", &names).Error; err != nil {
+		return nil, fmt.Errorf("failed to list package names: %w", err)
+	}
+	return names, nil
+}
+
 // Delete removes an artifact
 func (s *Service) Delete(ctx context.Context, registryType, name, version string, userID uuid.UUID) error {
+	start := time.Now()
+	err := s.delete(ctx, registryType, name, version, userID)
+	s.metrics.ObserveRegistryOperation("delete", registryType, err, start)
+	return err
+}
+
+func (s *Service) delete(ctx context.Context, registryType, name, version string, userID uuid.UUID) error {
+	if err := auth.CheckAPIKeyScope(ctx, registryType, name); err != nil {
+		return err
+	}
+
 	// Get artifact
 	var artifact types.Artifact
-	if err := s.DB.Where("LOWER(name) = LOWER(?) AND version = ? AND registry = ?",
-		name, version, registryType).First(&artifact).Error; err != nil {
+	if err := s.DB.Where("normalized_name = ? AND version = ? AND registry = ?",
+		utils.NormalizePackageName(name, registryType), version, registryType).First(&artifact).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			return fmt.Errorf("artifact not found: %s:%s", name, version)
+			return fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
 		}
 		return fmt.Errorf("failed to get artifact: %w", err)
 	}
@@ -282,16 +1072,29 @@ func (s *Service) Delete(ctx context.Context, registryType, name, version string
 		return fmt.Errorf("insufficient permissions to delete artifact")
 	}
 
-	// Delete from storage
-	if err := s.Storage.Delete(ctx, artifact.StoragePath); err != nil {
-		return fmt.Errorf("failed to delete artifact from storage: %w", err)
+	// With a grace period, deleted artifacts are kept for an admin to restore.
+	// OCI artifacts are always deleted immediately, since the OCI routes have
+	// already removed the manifest and its tags from storage.
+	if s.config.DeleteGracePeriod > 0 && registryType != "oci" {
+		if err := s.softDelete(ctx, &artifact, userID); err != nil {
+			return err
+		}
+		s.unindexArtifact(&artifact)
+		s.notifyEvent(ctx, EventPackageDeleted, &artifact, userID)
+		s.auditLog.Record(ctx, userID, audit.ActionPackageDelete, audit.PackageTarget(registryType, artifact.Name, artifact.Version), map[string]interface{}{
+			"restorable": true,
+		})
+		return nil
 	}
 
-	// Delete from database
-	if err := s.DB.Delete(&artifact).Error; err != nil {
-		return fmt.Errorf("failed to delete artifact from database: %w", err)
+	// Content shared with other artifacts is kept until the last is deleted
+	if err := s.removeArtifact(ctx, &artifact); err != nil {
+		return err
 	}
 
+	s.unindexArtifact(&artifact)
+	s.notifyEvent(ctx, EventPackageDeleted, &artifact, userID)
+	s.auditLog.Record(ctx, userID, audit.ActionPackageDelete, audit.PackageTarget(registryType, artifact.Name, artifact.Version), nil)
 	return nil
 }
 
@@ -326,10 +1129,18 @@ func (s *Service) AddPackageOwner(ctx context.Context, registryType, packageName
 	}
 
 	if !canManage {
-		return fmt.Errorf("insufficient permissions to manage package ownership")
+		return ErrOwnershipForbidden
+	}
+
+	if err := s.Ownership.AddOwner(ctx, registryType, packageName, targetUserID, ownerUserID, role); err != nil {
+		return err
 	}
 
-	return s.Ownership.AddOwner(ctx, registryType, packageName, targetUserID, ownerUserID, role)
+	s.auditLog.Record(ctx, ownerUserID, audit.ActionOwnerAdd, generatePackageKey(registryType, packageName), map[string]interface{}{
+		"user_id": targetUserID.String(),
+		"role":    role,
+	})
+	return nil
 }
 
 // RemovePackageOwner removes an owner from a package
@@ -341,8 +1152,15 @@ func (s *Service) RemovePackageOwner(ctx context.Context, registryType, packageN
 	}
 
 	if !canManage {
-		return fmt.Errorf("insufficient permissions to manage package ownership")
+		return ErrOwnershipForbidden
+	}
+
+	if err := s.Ownership.RemoveOwner(ctx, registryType, packageName, targetUserID, ownerUserID); err != nil {
+		return err
 	}
 
-	return s.Ownership.RemoveOwner(ctx, registryType, packageName, targetUserID, ownerUserID)
+	s.auditLog.Record(ctx, ownerUserID, audit.ActionOwnerRemove, generatePackageKey(registryType, packageName), map[string]interface{}{
+		"user_id": targetUserID.String(),
+	})
+	return nil
 }
@@ -3,19 +3,60 @@ package registry
 import (
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/auth"
 	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/pkg/checksum"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/metrics"
+	"github.com/lgulliver/lodestone/pkg/signing"
+	"github.com/lgulliver/lodestone/pkg/throttle"
 	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// testDownloadEvent mirrors metadata.DownloadEvent for SQLite, which cannot
+// create its generated UUID default
+type testDownloadEvent struct {
+	ID         string `gorm:"primaryKey"`
+	ArtifactID string `gorm:"index;not null"`
+	UserID     *string
+	IPAddress  string
+	UserAgent  string
+	Registry   string
+	Name       string
+	Version    string
+	Timestamp  time.Time
+}
+
+func (testDownloadEvent) TableName() string {
+	return "download_events"
+}
+
 // MockBlobStorage implements storage.BlobStorage for testing
 type MockBlobStorage struct {
 	mock.Mock
@@ -31,6 +72,11 @@ func (m *MockBlobStorage) Retrieve(ctx context.Context, path string) (io.ReadClo
 	return args.Get(0).(io.ReadCloser), args.Error(1)
 }
 
+func (m *MockBlobStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	args := m.Called(ctx, path, offset, length)
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
 func (m *MockBlobStorage) Delete(ctx context.Context, path string) error {
 	args := m.Called(ctx, path)
 	return args.Error(0)
@@ -46,6 +92,11 @@ func (m *MockBlobStorage) GetSize(ctx context.Context, path string) (int64, erro
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *MockBlobStorage) GetModTime(ctx context.Context, path string) (time.Time, error) {
+	args := m.Called(ctx, path)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
 func (m *MockBlobStorage) List(ctx context.Context, prefix string) ([]string, error) {
 	args := m.Called(ctx, prefix)
 	return args.Get(0).([]string), args.Error(1)
@@ -96,9 +147,14 @@ func setupTestDB(t *testing.T) *common.Database {
 	require.NoError(t, err)
 
 	// Auto migrate tables
-	err = db.AutoMigrate(&types.User{}, &types.APIKey{}, &types.Artifact{}, &types.PackageOwnership{})
+	err = db.AutoMigrate(&types.User{}, &types.APIKey{}, &types.Artifact{}, &types.BlobRef{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{}, &types.RegistrySetting{}, &types.Quota{}, &types.Permission{}, &types.AuditEntry{}, &types.PackageMetadata{}, &types.PublishedVersion{}, &testDownloadEvent{})
 	require.NoError(t, err)
 
+	// Enable the registries exercised by the tests
+	for _, name := range []string{"test", "npm", "nuget", "maven", "go", "helm", "oci", "opa", "cargo", "rubygems", "debian", "rpm"} {
+		require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: name, Enabled: true}).Error)
+	}
+
 	return &common.Database{DB: db}
 }
 
@@ -135,7 +191,7 @@ func TestNewService(t *testing.T) {
 	assert.NotEmpty(t, service.handlers)
 
 	// Check that all expected registry types are registered
-	expectedTypes := []string{"nuget", "npm", "maven", "go", "helm", "oci", "opa", "cargo", "rubygems"}
+	expectedTypes := []string{"nuget", "npm", "maven", "go", "helm", "oci", "opa", "cargo", "rubygems", "debian", "rpm"}
 	for _, registryType := range expectedTypes {
 		_, exists := service.handlers[registryType]
 		assert.True(t, exists, "Registry type %s should be registered", registryType)
@@ -157,7 +213,6 @@ func TestUpload_Success(t *testing.T) {
 	// Set up mock expectations
 	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), content).Return(nil)
 	mockHandler.On("GetMetadata", content).Return(map[string]interface{}{"test": "metadata"}, nil)
-	mockHandler.On("GenerateStoragePath", "test-package", "1.0.0").Return("test/test-package/1.0.0/artifact")
 	mockHandler.On("Upload", ctx, mock.AnythingOfType("*types.Artifact"), content).Return(nil)
 
 	// Upload artifact
@@ -171,7 +226,7 @@ func TestUpload_Success(t *testing.T) {
 	assert.Equal(t, int64(len(content)), artifact.Size)
 	assert.Equal(t, user.ID, artifact.PublishedBy)
 	assert.NotEmpty(t, artifact.SHA256)
-	assert.Equal(t, "test/test-package/1.0.0/artifact", artifact.StoragePath)
+	assert.Equal(t, "blobs/sha256/"+artifact.SHA256, artifact.StoragePath)
 
 	// Verify artifact was saved to database
 	var savedArtifact types.Artifact
@@ -196,6 +251,19 @@ func TestUpload_UnsupportedRegistry(t *testing.T) {
 	assert.Contains(t, err.Error(), "unsupported registry type")
 }
 
+func TestUpload_APIKeyScope(t *testing.T) {
+	service, _, _ := setupTestService(t)
+	user := createTestUser(t, service.DB)
+
+	// A key scoped to another registry cannot publish here, whatever the route
+	ctx := auth.WithAPIKeyScopes(context.Background(), []string{"npm:@myorg/*"})
+	artifact, err := service.Upload(ctx, "nuget", "Test.Package", "1.0.0", bytes.NewReader([]byte("test content")), user.ID)
+
+	assert.ErrorIs(t, err, auth.ErrAPIKeyScopeForbidden)
+	assert.Nil(t, artifact)
+	assert.ErrorIs(t, service.Delete(ctx, "nuget", "Test.Package", "1.0.0", user.ID), auth.ErrAPIKeyScopeForbidden)
+}
+
 func TestUpload_ValidationFailed(t *testing.T) {
 	service, db, _ := setupTestService(t)
 	user := createTestUser(t, db)
@@ -255,6 +323,292 @@ func TestUpload_DuplicateArtifact(t *testing.T) {
 	mockHandler.AssertExpectations(t)
 }
 
+func TestUpload_IdempotentRepublish(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	service.Configure(config.RegistryConfig{IdempotentPublish: true})
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	content := []byte("test content")
+	existingArtifact := &types.Artifact{
+		Name:        "test-package",
+		Version:     "1.0.0",
+		Registry:    "test",
+		SHA256:      utils.ComputeSHA256(content),
+		PublishedBy: user.ID,
+	}
+	require.NoError(t, db.Create(existingArtifact).Error)
+
+	mockHandler := &MockHandler{}
+	service.handlers["test"] = mockHandler
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), mock.Anything).Return(nil)
+	mockHandler.On("GetMetadata", mock.Anything).Return(map[string]interface{}{}, nil)
+
+	// Identical content succeeds and returns the existing artifact without storing anything
+	artifact, err := service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader(content), user.ID)
+	assert.ErrorIs(t, err, ErrArtifactUnchanged)
+	require.NotNil(t, artifact)
+	assert.Equal(t, existingArtifact.ID, artifact.ID)
+
+	// Differing content still conflicts
+	artifact, err = service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader([]byte("other content")), user.ID)
+	assert.ErrorIs(t, err, ErrArtifactExists)
+	assert.Nil(t, artifact)
+
+	// With idempotent publishing disabled identical content conflicts too
+	service.Configure(config.RegistryConfig{})
+	artifact, err = service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader(content), user.ID)
+	assert.ErrorIs(t, err, ErrArtifactExists)
+	assert.Nil(t, artifact)
+
+	var count int64
+	require.NoError(t, db.Model(&types.Artifact{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestUpload_RecordsMetrics(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	collector := metrics.NewCollector()
+	service.SetMetrics(collector)
+
+	mockHandler := &MockHandler{}
+	service.handlers["test"] = mockHandler
+
+	content := []byte("test artifact content")
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), content).Return(nil)
+	mockHandler.On("GetMetadata", content).Return(map[string]interface{}{}, nil)
+	mockHandler.On("GenerateStoragePath", "test-package", "1.0.0").Return("test/test-package/1.0.0/artifact")
+	mockHandler.On("Upload", ctx, mock.AnythingOfType("*types.Artifact"), content).Return(nil)
+
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		collector.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+	uploads := `lodestone_registry_operations_total{operation="upload",registry="test",status="success"}`
+	assert.NotContains(t, scrape(), uploads)
+
+	_, err := service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader(content), user.ID)
+	require.NoError(t, err)
+
+	body := scrape()
+	assert.Contains(t, body, uploads+" 1\n")
+	assert.Contains(t, body, `lodestone_artifact_size_bytes_count{operation="upload",registry="test"} 1`)
+	assert.Contains(t, body, `lodestone_registry_operation_duration_seconds_count{operation="upload",registry="test"} 1`)
+
+	// A rejected duplicate is counted as a failed upload
+	_, err = service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader(content), user.ID)
+	require.Error(t, err)
+	assert.Contains(t, scrape(), `lodestone_registry_operations_total{operation="upload",registry="test",status="error"} 1`)
+}
+
+func TestUpload_SignatureRequired(t *testing.T) {
+	service, db, mockStorage := setupTestService(t)
+	user := createTestUser(t, db)
+	require.NoError(t, service.Settings.SetRequireSignature(context.Background(), "test", true, user.ID))
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+	service.Configure(config.RegistryConfig{SignatureKeyringPath: keyPath})
+
+	content := []byte("test artifact content")
+	digest := sha256.Sum256(content)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+
+	// Rejected uploads never reach the handler, so nothing is stored
+	mockHandler := &MockHandler{}
+	service.handlers["test"] = mockHandler
+
+	_, err = service.Upload(context.Background(), "test", "test-package", "1.0.0", bytes.NewReader(content), user.ID)
+	assert.ErrorIs(t, err, ErrSignatureRequired)
+
+	tampered := signing.WithSignature(context.Background(), signature)
+	_, err = service.Upload(tampered, "test", "test-package", "1.0.0", bytes.NewReader([]byte("other content")), user.ID)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+
+	mockHandler.AssertNotCalled(t, "Upload", mock.Anything, mock.Anything, mock.Anything)
+	mockStorage.AssertNotCalled(t, "Store", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	ctx := signing.WithSignature(context.Background(), signature)
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), content).Return(nil)
+	mockHandler.On("GetMetadata", content).Return(map[string]interface{}{}, nil)
+	mockHandler.On("Upload", ctx, mock.AnythingOfType("*types.Artifact"), content).Return(nil)
+
+	artifact, err := service.Upload(ctx, "test", "test-package", "1.0.0", bytes.NewReader(content), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, signing.SignatureTypeCosign, artifact.Metadata["signature"].(map[string]interface{})["type"])
+	mockHandler.AssertExpectations(t)
+}
+
+func TestUpload_UnexpectedContentFormat(t *testing.T) {
+	service, db, mockStorage := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+	service.Configure(config.RegistryConfig{StrictContentValidation: true})
+
+	zipContent := []byte("PK\x03\x04 not a tarball")
+	gzipContent := []byte("\x1f\x8b not a nupkg")
+	mockHandler := &MockHandler{}
+	service.handlers["npm"] = mockHandler
+	service.handlers["nuget"] = mockHandler
+
+	// Mismatched content never reaches the handler
+	_, err := service.Upload(ctx, "npm", "test-package", "1.0.0", bytes.NewReader(zipContent), user.ID)
+	assert.ErrorIs(t, err, ErrUnexpectedContentFormat)
+	assert.Contains(t, err.Error(), "expected npm gzip content, got zip")
+
+	_, err = service.Upload(ctx, "nuget", "Test.Package", "1.0.0", bytes.NewReader(gzipContent), user.ID)
+	assert.ErrorIs(t, err, ErrUnexpectedContentFormat)
+
+	_, err = service.Upload(ctx, "npm", "test-package", "1.0.0", bytes.NewReader([]byte("plain text")), user.ID)
+	assert.ErrorIs(t, err, ErrUnexpectedContentFormat)
+
+	mockHandler.AssertNotCalled(t, "Validate", mock.Anything, mock.Anything)
+	mockStorage.AssertNotCalled(t, "Store", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	// Relaxed validation leaves the content to the handler
+	service.Configure(config.RegistryConfig{})
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), zipContent).Return(nil)
+	mockHandler.On("GetMetadata", zipContent).Return(map[string]interface{}{}, nil)
+	mockHandler.On("Upload", ctx, mock.AnythingOfType("*types.Artifact"), zipContent).Return(nil)
+
+	_, err = service.Upload(ctx, "npm", "test-package", "1.0.0", bytes.NewReader(zipContent), user.ID)
+	require.NoError(t, err)
+	mockHandler.AssertExpectations(t)
+}
+
+// patternReader endlessly repeats a byte pattern without allocating
+type patternReader struct {
+	offset int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	const pattern = "lodestone streaming upload "
+	for i := range p {
+		p[i] = pattern[r.offset%len(pattern)]
+		r.offset++
+	}
+	return len(p), nil
+}
+
+func TestUpload_StreamsLargeContent(t *testing.T) {
+	ctx := context.Background()
+	service := setupBackupService(t)
+	user := createTestUser(t, service.DB)
+
+	const size = 64 << 20
+	hasher := sha256.New()
+	_, err := io.Copy(hasher, io.LimitReader(&patternReader{}, size))
+	require.NoError(t, err)
+	digest := hasher.Sum(nil)
+
+	// Content that does not match the digest supplied with it is rejected
+	// and not left in storage
+	_, err = service.Upload(checksum.WithExpectedSHA256(ctx, make([]byte, sha256.Size)), "maven", "com.example:large", "1.0.0",
+		io.LimitReader(&patternReader{}, size), user.ID)
+	assert.ErrorIs(t, err, checksum.ErrMismatch)
+	spooled, err := service.Storage.List(ctx, uploadSpoolPrefix)
+	require.NoError(t, err)
+	assert.Empty(t, spooled)
+
+	// Hashing and storing the content in one pass takes memory independent
+	// of its size
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	artifact, err := service.Upload(checksum.WithExpectedSHA256(ctx, digest), "maven", "com.example:large", "1.0.0",
+		io.LimitReader(&patternReader{}, size), user.ID)
+	runtime.ReadMemStats(&after)
+	require.NoError(t, err)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(size/8), "upload allocated memory proportional to its size")
+
+	assert.Equal(t, int64(size), artifact.Size)
+	assert.Equal(t, hex.EncodeToString(digest), artifact.SHA256)
+	assert.Equal(t, "application/java-archive", artifact.ContentType)
+	spooled, err = service.Storage.List(ctx, uploadSpoolPrefix)
+	require.NoError(t, err)
+	assert.Empty(t, spooled)
+
+	stored, err := service.Storage.Retrieve(ctx, artifact.StoragePath)
+	require.NoError(t, err)
+	defer stored.Close()
+	hasher.Reset()
+	n, err := io.Copy(hasher, stored)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), n)
+	assert.Equal(t, digest, hasher.Sum(nil))
+}
+
+func TestUpload_QuotaEnforced(t *testing.T) {
+	service, db, mockStorage := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	content := []byte("0123456789")
+	mockHandler := &MockHandler{}
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), content).Return(nil)
+	mockHandler.On("GetMetadata", content).Return(map[string]interface{}{}, nil)
+	mockHandler.On("GenerateStoragePath", "test-package", mock.AnythingOfType("string")).Return("test/test-package/artifact")
+	mockHandler.On("Upload", ctx, mock.AnythingOfType("*types.Artifact"), content).Return(nil)
+	service.handlers["test"] = mockHandler
+
+	// Two uploads fill the quota exactly
+	require.NoError(t, service.Quotas.SetQuota(ctx, &types.Quota{UserID: user.ID, MaxBytes: 20}, user.ID))
+	for _, version := range []string{"1.0.0", "1.0.1"} {
+		_, err := service.Upload(ctx, "test", "test-package", version, bytes.NewReader(content), user.ID)
+		require.NoError(t, err)
+	}
+
+	_, err := service.Upload(ctx, "test", "test-package", "1.0.2", bytes.NewReader(content), user.ID)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	mockHandler.AssertNumberOfCalls(t, "Upload", 2)
+
+	// Content stored outside Upload is checked the same way, except for a
+	// version that already counts against the quota
+	assert.ErrorIs(t, service.CheckPublish(ctx, "test", "test-package", "1.0.2", int64(len(content)), user.ID), ErrQuotaExceeded)
+	assert.NoError(t, service.CheckPublish(ctx, "test", "test-package", "1.0.1", int64(len(content)), user.ID))
+
+	usage, err := service.Quotas.Usage(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.Equal(t, types.QuotaUsage{Bytes: 20, Artifacts: 2, MaxBytes: 20}, usage[0])
+
+	// Deleting an artifact frees its share of the quota
+	mockStorage.On("Delete", ctx, "test/test-package/artifact").Return(nil)
+	require.NoError(t, service.Delete(ctx, "test", "test-package", "1.0.0", user.ID))
+
+	_, err = service.Upload(ctx, "test", "test-package", "1.0.2", bytes.NewReader(content), user.ID)
+	require.NoError(t, err)
+
+	t.Run("registry quota", func(t *testing.T) {
+		require.NoError(t, service.Quotas.SetQuota(ctx, &types.Quota{UserID: user.ID, MaxBytes: 100}, user.ID))
+		require.NoError(t, service.Quotas.SetQuota(ctx, &types.Quota{UserID: user.ID, RegistryName: "test", MaxArtifacts: 2}, user.ID))
+
+		_, err := service.Upload(ctx, "test", "test-package", "1.0.3", bytes.NewReader(content), user.ID)
+		assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+		require.NoError(t, service.Quotas.DeleteQuota(ctx, user.ID, "test", user.ID))
+		assert.ErrorIs(t, service.Quotas.DeleteQuota(ctx, user.ID, "test", user.ID), ErrQuotaNotFound)
+	})
+
+	t.Run("default quota", func(t *testing.T) {
+		require.NoError(t, service.Quotas.DeleteQuota(ctx, user.ID, "", user.ID))
+		service.Configure(config.RegistryConfig{DefaultQuotaArtifacts: 2})
+
+		_, err := service.Upload(ctx, "test", "test-package", "1.0.3", bytes.NewReader(content), user.ID)
+		assert.ErrorIs(t, err, ErrQuotaExceeded)
+	})
+}
+
 func TestDownload_Success(t *testing.T) {
 	service, db, mockStorage := setupTestService(t)
 	user := createTestUser(t, db)
@@ -292,6 +646,39 @@ func TestDownload_Success(t *testing.T) {
 	mockStorage.AssertExpectations(t)
 }
 
+func TestDownload_Throttled(t *testing.T) {
+	service, db, mockStorage := setupTestService(t)
+	service.Configure(config.RegistryConfig{DownloadRateAnonymous: 100 << 10})
+	user := createTestUser(t, db)
+
+	artifact := &types.Artifact{
+		Name:        "test-package",
+		Version:     "1.0.0",
+		Registry:    "npm",
+		StoragePath: "npm/test-package/1.0.0/artifact",
+		PublishedBy: user.ID,
+	}
+	require.NoError(t, db.Create(artifact).Error)
+
+	data := bytes.Repeat([]byte("x"), 50<<10)
+	mockStorage.On("Retrieve", mock.Anything, artifact.StoragePath).Return(io.NopCloser(bytes.NewReader(data)), nil)
+
+	ctx := throttle.WithClient(context.Background(), func() throttle.Client {
+		return throttle.Client{ID: "192.0.2.1"}
+	})
+
+	start := time.Now()
+	_, content, err := service.Download(ctx, "npm", "test-package", "1.0.0")
+	require.NoError(t, err)
+	downloaded, err := io.ReadAll(content)
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+
+	// 50KiB at 100KiB/s, less the initial burst of a tenth of a second
+	assert.Equal(t, data, downloaded)
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+}
+
 func TestDownload_UnsupportedRegistry(t *testing.T) {
 	service, _, _ := setupTestService(t)
 	ctx := context.Background()
@@ -381,6 +768,123 @@ func TestList_Success(t *testing.T) {
 	assert.Equal(t, int64(3), total) // Total should still be 3
 }
 
+func TestList_PageLimits(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	// More versions than the largest page, of three more packages than the
+	// default page holds
+	artifacts := make([]*types.Artifact, 0, MaxListLimit+5)
+	for i := 0; i < MaxListLimit+5; i++ {
+		name := fmt.Sprintf("package-%03d", i%(DefaultListLimit+3))
+		artifacts = append(artifacts, &types.Artifact{
+			Name:        name,
+			Version:     fmt.Sprintf("1.0.%d", i),
+			Registry:    "oci",
+			StoragePath: name,
+			PublishedBy: user.ID,
+			Metadata:    types.JSONMap{"description": fmt.Sprintf("build-%d", i)},
+		})
+	}
+	require.NoError(t, db.CreateInBatches(artifacts, 100).Error)
+
+	result, total, err := service.List(ctx, &types.ArtifactFilter{Registry: "oci"})
+	require.NoError(t, err)
+	assert.Len(t, result, DefaultListLimit)
+	assert.Equal(t, int64(MaxListLimit+5), total)
+
+	result, total, err = service.List(ctx, &types.ArtifactFilter{Registry: "oci", Limit: 5 * MaxListLimit})
+	require.NoError(t, err)
+	assert.Len(t, result, MaxListLimit, "the page size is capped")
+	assert.Equal(t, int64(MaxListLimit+5), total)
+
+	// Pages do not overlap
+	last, _, err := service.List(ctx, &types.ArtifactFilter{Registry: "oci", Limit: MaxListLimit, Offset: MaxListLimit})
+	require.NoError(t, err)
+	require.Len(t, last, 5)
+	seen := make(map[uuid.UUID]bool)
+	for _, artifact := range append(result, last...) {
+		seen[artifact.ID] = true
+	}
+	assert.Len(t, seen, MaxListLimit+5)
+
+	all, err := service.ListAll(ctx, &types.ArtifactFilter{Registry: "oci", Limit: 1, Offset: 10})
+	require.NoError(t, err)
+	assert.Len(t, all, MaxListLimit+5, "ListAll ignores the page")
+
+	matched, err := service.ListAll(ctx, &types.ArtifactFilter{Registry: "oci", Terms: []string{"BUILD-10", "build-100"}})
+	require.NoError(t, err)
+	assert.Len(t, matched, 6, "builds 100 and 1000 to 1004")
+
+	names, err := service.ListNames(ctx, "oci", "", DefaultListLimit)
+	require.NoError(t, err)
+	assert.Len(t, names, DefaultListLimit)
+	assert.Equal(t, "package-000", names[0])
+	names, err = service.ListNames(ctx, "oci", names[len(names)-1], DefaultListLimit)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"package-100", "package-101", "package-102"}, names)
+}
+
+func TestSearchPackages(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	versions := []struct {
+		name, version string
+		downloads     int64
+	}{
+		{"Alpha", "1.0.0", 5},
+		{"alpha", "1.1.0", 5},
+		{"beta", "1.0.0", 30},
+		{"gamma", "1.0.0", 20},
+		{"gamma", "2.0.0", 0},
+	}
+	for _, v := range versions {
+		require.NoError(t, db.Create(&types.Artifact{
+			Name:        v.name,
+			Version:     v.version,
+			Registry:    "nuget",
+			StoragePath: v.name + "/" + v.version,
+			PublishedBy: user.ID,
+			Downloads:   v.downloads,
+			IsPublic:    true,
+		}).Error)
+	}
+
+	names := func(packages [][]*types.Artifact) []string {
+		result := make([]string, 0, len(packages))
+		for _, versions := range packages {
+			result = append(result, fmt.Sprintf("%s:%d", versions[0].NormalizedName, len(versions)))
+		}
+		return result
+	}
+
+	// Without a score packages are ordered by downloads, with the versions
+	// of names differing only in case together
+	packages, total, err := service.SearchPackages(ctx, &PackageSearch{Registry: "nuget"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []string{"beta:1", "gamma:2", "alpha:2"}, names(packages))
+
+	// Only the page's packages are returned
+	packages, total, err = service.SearchPackages(ctx, &PackageSearch{Registry: "nuget", Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []string{"gamma:2"}, names(packages))
+
+	// Conditions select versions, and a score outranks downloads
+	packages, total, err = service.SearchPackages(ctx, &PackageSearch{
+		Registry: "nuget",
+		Where:    []clause.Expr{gorm.Expr("artifacts.version <> ?", "2.0.0")},
+		Score:    gorm.Expr("CASE WHEN artifacts.normalized_name = ? THEN 1 ELSE 0 END", "alpha"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	assert.Equal(t, []string{"alpha:2", "beta:1", "gamma:1"}, names(packages))
+}
+
 func TestDelete_Success(t *testing.T) {
 	service, db, mockStorage := setupTestService(t)
 	user := createTestUser(t, db)
@@ -417,6 +921,32 @@ func TestDelete_Success(t *testing.T) {
 	mockStorage.AssertExpectations(t)
 }
 
+func TestDelete_SharedStorageKept(t *testing.T) {
+	service, db, mockStorage := setupTestService(t)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	// A blob mounted into a second repository shares the source's storage
+	digest := "sha256:" + strings.Repeat("a", 64)
+	storagePath := "oci/myorg/src/blobs/" + digest
+	for _, name := range []string{"myorg/src", "myorg/dst"} {
+		require.NoError(t, db.Create(&types.Artifact{
+			Name:        name,
+			Version:     digest,
+			Registry:    "oci",
+			StoragePath: storagePath,
+			PublishedBy: user.ID,
+		}).Error)
+	}
+	require.NoError(t, service.Ownership.EstablishInitialOwnership(ctx, "oci", "myorg/dst", user.ID))
+
+	err := service.Delete(ctx, "oci", "myorg/dst", digest, user.ID)
+	require.NoError(t, err)
+
+	// Storage is untouched while the source repository still refers to it
+	mockStorage.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+}
+
 func TestDelete_ArtifactNotFound(t *testing.T) {
 	service, _, _ := setupTestService(t)
 	user := createTestUser(t, service.DB)
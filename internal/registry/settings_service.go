@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
 	"github.com/lgulliver/lodestone/pkg/types"
 	"github.com/rs/zerolog/log"
 	"gorm.io/gorm"
@@ -12,7 +13,8 @@ import (
 
 // RegistrySettingsService handles runtime configuration of registry formats
 type RegistrySettingsService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	auditLog *audit.Service
 }
 
 // NewRegistrySettingsService creates a new registry settings service
@@ -40,6 +42,198 @@ func (s *RegistrySettingsService) IsRegistryEnabled(ctx context.Context, registr
 	return setting.Enabled, nil
 }
 
+// RequiresApproval checks if publishes to a registry format must be approved
+// before they become available
+func (s *RegistrySettingsService) RequiresApproval(ctx context.Context, registryName string) (bool, error) {
+	var setting types.RegistrySetting
+	err := s.db.WithContext(ctx).
+		Where("registry_name = ?", registryName).
+		First(&setting).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check approval requirement: %w", err)
+	}
+
+	return setting.RequireApproval, nil
+}
+
+// SetRequireApproval turns the publish approval workflow on or off for a registry format
+func (s *RegistrySettingsService) SetRequireApproval(ctx context.Context, registryName string, required bool, updatedBy uuid.UUID) error {
+	result := s.db.WithContext(ctx).
+		Model(&types.RegistrySetting{}).
+		Where("registry_name = ?", registryName).
+		Updates(map[string]interface{}{
+			"require_approval": required,
+			"updated_by":       updatedBy,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update approval requirement for %s: %w", registryName, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("registry %s not found", registryName)
+	}
+
+	log.Info().
+		Str("registry", registryName).
+		Bool("require_approval", required).
+		Str("updated_by", updatedBy.String()).
+		Msg("registry approval requirement updated")
+
+	s.auditLog.Record(ctx, updatedBy, audit.ActionRegistryUpdate, registryName, map[string]interface{}{
+		"require_approval": required,
+	})
+	return nil
+}
+
+// RequiresSignature checks if uploads to a registry format must carry a
+// signature from a trusted key
+func (s *RegistrySettingsService) RequiresSignature(ctx context.Context, registryName string) (bool, error) {
+	var setting types.RegistrySetting
+	err := s.db.WithContext(ctx).
+		Where("registry_name = ?", registryName).
+		First(&setting).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check signature requirement: %w", err)
+	}
+
+	return setting.RequireSignature, nil
+}
+
+// SetRequireSignature turns upload signature verification on or off for a registry format
+func (s *RegistrySettingsService) SetRequireSignature(ctx context.Context, registryName string, required bool, updatedBy uuid.UUID) error {
+	result := s.db.WithContext(ctx).
+		Model(&types.RegistrySetting{}).
+		Where("registry_name = ?", registryName).
+		Updates(map[string]interface{}{
+			"require_signature": required,
+			"updated_by":        updatedBy,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update signature requirement for %s: %w", registryName, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("registry %s not found", registryName)
+	}
+
+	log.Info().
+		Str("registry", registryName).
+		Bool("require_signature", required).
+		Str("updated_by", updatedBy.String()).
+		Msg("registry signature requirement updated")
+
+	s.auditLog.Record(ctx, updatedBy, audit.ActionRegistryUpdate, registryName, map[string]interface{}{
+		"require_signature": required,
+	})
+	return nil
+}
+
+// IsImmutable checks if versions published to a registry format can never be
+// published again, even after they are deleted
+func (s *RegistrySettingsService) IsImmutable(ctx context.Context, registryName string) (bool, error) {
+	var setting types.RegistrySetting
+	err := s.db.WithContext(ctx).
+		Where("registry_name = ?", registryName).
+		First(&setting).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check immutability: %w", err)
+	}
+
+	return setting.Immutable, nil
+}
+
+// SetImmutable turns publish-once enforcement on or off for a registry format
+func (s *RegistrySettingsService) SetImmutable(ctx context.Context, registryName string, immutable bool, updatedBy uuid.UUID) error {
+	result := s.db.WithContext(ctx).
+		Model(&types.RegistrySetting{}).
+		Where("registry_name = ?", registryName).
+		Updates(map[string]interface{}{
+			"immutable":  immutable,
+			"updated_by": updatedBy,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update immutability for %s: %w", registryName, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("registry %s not found", registryName)
+	}
+
+	log.Info().
+		Str("registry", registryName).
+		Bool("immutable", immutable).
+		Str("updated_by", updatedBy.String()).
+		Msg("registry immutability updated")
+
+	s.auditLog.Record(ctx, updatedBy, audit.ActionRegistryUpdate, registryName, map[string]interface{}{
+		"immutable": immutable,
+	})
+	return nil
+}
+
+// IsReadOnly checks if a registry format serves packages but refuses changes
+// to them
+func (s *RegistrySettingsService) IsReadOnly(ctx context.Context, registryName string) (bool, error) {
+	var setting types.RegistrySetting
+	err := s.db.WithContext(ctx).
+		Where("registry_name = ?", registryName).
+		First(&setting).Error
+
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check read-only mode: %w", err)
+	}
+
+	return setting.ReadOnly, nil
+}
+
+// SetReadOnly turns read-only mode on or off for a registry format
+func (s *RegistrySettingsService) SetReadOnly(ctx context.Context, registryName string, readOnly bool, updatedBy uuid.UUID) error {
+	result := s.db.WithContext(ctx).
+		Model(&types.RegistrySetting{}).
+		Where("registry_name = ?", registryName).
+		Updates(map[string]interface{}{
+			"read_only":  readOnly,
+			"updated_by": updatedBy,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update read-only mode for %s: %w", registryName, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("registry %s not found", registryName)
+	}
+
+	log.Info().
+		Str("registry", registryName).
+		Bool("read_only", readOnly).
+		Str("updated_by", updatedBy.String()).
+		Msg("registry read-only mode updated")
+
+	s.auditLog.Record(ctx, updatedBy, audit.ActionRegistryUpdate, registryName, map[string]interface{}{
+		"read_only": readOnly,
+	})
+	return nil
+}
+
 // EnableRegistry enables a registry format
 func (s *RegistrySettingsService) EnableRegistry(ctx context.Context, registryName string, updatedBy uuid.UUID) error {
 	result := s.db.WithContext(ctx).
@@ -63,6 +257,9 @@ func (s *RegistrySettingsService) EnableRegistry(ctx context.Context, registryNa
 		Str("updated_by", updatedBy.String()).
 		Msg("registry enabled")
 
+	s.auditLog.Record(ctx, updatedBy, audit.ActionRegistryUpdate, registryName, map[string]interface{}{
+		"enabled": true,
+	})
 	return nil
 }
 
@@ -89,6 +286,9 @@ func (s *RegistrySettingsService) DisableRegistry(ctx context.Context, registryN
 		Str("updated_by", updatedBy.String()).
 		Msg("registry disabled")
 
+	s.auditLog.Record(ctx, updatedBy, audit.ActionRegistryUpdate, registryName, map[string]interface{}{
+		"enabled": false,
+	})
 	return nil
 }
 
@@ -149,5 +349,8 @@ func (s *RegistrySettingsService) UpdateRegistryDescription(ctx context.Context,
 		Str("updated_by", updatedBy.String()).
 		Msg("registry description updated")
 
+	s.auditLog.Record(ctx, updatedBy, audit.ActionRegistryUpdate, registryName, map[string]interface{}{
+		"description": description,
+	})
 	return nil
 }
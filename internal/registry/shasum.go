@@ -0,0 +1,140 @@
+package registry
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/lgulliver/lodestone/internal/registry/registries/npm"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+// ArtifactNPMChecksums returns the checksums npm package documents list for
+// an artifact: the SHA1 shasum older clients verify downloads against, and
+// the SSRI integrity string newer ones prefer. The npm handler records both
+// in the metadata at publish time; for artifacts published before then they
+// are computed on first use and recorded, so each tarball is read at most
+// once.
+func (s *Service) ArtifactNPMChecksums(ctx context.Context, artifact *types.Artifact) (string, string, error) {
+	shasum, _ := artifact.Metadata[npm.ShasumMetadataKey].(string)
+	integrity, _ := artifact.Metadata[npm.IntegrityMetadataKey].(string)
+	if shasum != "" && integrity != "" {
+		return shasum, integrity, nil
+	}
+
+	content, err := s.Storage.Retrieve(ctx, artifact.StoragePath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to retrieve artifact: %w", err)
+	}
+	defer content.Close()
+
+	sha1Hash, sha512Hash := sha1.New(), sha512.New()
+	if _, err := io.Copy(io.MultiWriter(sha1Hash, sha512Hash), content); err != nil {
+		return "", "", fmt.Errorf("failed to read artifact content: %w", err)
+	}
+	shasum = hex.EncodeToString(sha1Hash.Sum(nil))
+	integrity = npm.Integrity(sha512Hash.Sum(nil))
+
+	if artifact.Metadata == nil {
+		artifact.Metadata = make(types.JSONMap)
+	}
+	artifact.Metadata[npm.ShasumMetadataKey] = shasum
+	artifact.Metadata[npm.IntegrityMetadataKey] = integrity
+
+	// The checksums are derived from content that never changes, so recording
+	// them does not modify the artifact or its updated_at
+	if err := s.DB.WithContext(ctx).Model(artifact).UpdateColumn("metadata", artifact.Metadata).Error; err != nil {
+		log.Warn().Err(err).
+			Str("name", artifact.Name).
+			Str("version", artifact.Version).
+			Msg("Failed to record npm artifact checksums")
+	}
+
+	return shasum, integrity, nil
+}
+
+// Checksum algorithms ArtifactChecksum computes, named as they are in
+// checksum file extensions and artifact metadata
+const (
+	ChecksumMD5    = "md5"
+	ChecksumSHA1   = "sha1"
+	ChecksumSHA256 = "sha256"
+	ChecksumSHA512 = "sha512"
+)
+
+// ErrUnsupportedChecksum is returned for a checksum algorithm
+// ArtifactChecksum does not compute
+var ErrUnsupportedChecksum = errors.New("unsupported checksum algorithm")
+
+// recordedChecksums are the checksums ArtifactChecksum records in artifact
+// metadata, keyed by algorithm
+var recordedChecksums = map[string]func() hash.Hash{
+	ChecksumMD5:    md5.New,
+	ChecksumSHA1:   sha1.New,
+	ChecksumSHA512: sha512.New,
+}
+
+// ArtifactChecksum returns the hex-encoded checksum of an artifact's content
+// with an algorithm, as repository formats such as Maven serve alongside it.
+// The SHA256 is recorded at upload. The others are recorded in the metadata
+// under the algorithm's name; for artifacts without them all are computed
+// together on first use and recorded, so each artifact is read at most once.
+func (s *Service) ArtifactChecksum(ctx context.Context, artifact *types.Artifact, algorithm string) (string, error) {
+	if algorithm == ChecksumSHA256 && artifact.SHA256 != "" {
+		return artifact.SHA256, nil
+	}
+	if _, ok := recordedChecksums[algorithm]; !ok && algorithm != ChecksumSHA256 {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedChecksum, algorithm)
+	}
+	if sum, ok := artifact.Metadata[algorithm].(string); ok && sum != "" {
+		return sum, nil
+	}
+
+	content, err := s.Storage.Retrieve(ctx, artifact.StoragePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve artifact: %w", err)
+	}
+	defer content.Close()
+
+	hashes := make(map[string]hash.Hash, len(recordedChecksums)+1)
+	writers := make([]io.Writer, 0, len(recordedChecksums)+1)
+	for name, newHash := range recordedChecksums {
+		hashes[name] = newHash()
+		writers = append(writers, hashes[name])
+	}
+	if algorithm == ChecksumSHA256 {
+		hashes[ChecksumSHA256] = sha256.New()
+		writers = append(writers, hashes[ChecksumSHA256])
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), content); err != nil {
+		return "", fmt.Errorf("failed to read artifact content: %w", err)
+	}
+
+	if artifact.Metadata == nil {
+		artifact.Metadata = make(types.JSONMap)
+	}
+	for name, h := range hashes {
+		if name != ChecksumSHA256 {
+			artifact.Metadata[name] = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+
+	// Like the npm SHA1, the checksums are derived from content that never
+	// changes, so recording them does not modify the artifact
+	if err := s.DB.WithContext(ctx).Model(artifact).UpdateColumn("metadata", artifact.Metadata).Error; err != nil {
+		log.Warn().Err(err).
+			Str("name", artifact.Name).
+			Str("version", artifact.Version).
+			Msg("Failed to record artifact checksums")
+	}
+
+	return hex.EncodeToString(hashes[algorithm].Sum(nil)), nil
+}
@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lgulliver/lodestone/internal/registry/registries/oci"
+	"github.com/lgulliver/lodestone/pkg/signing"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrSignatureRequired is returned when an upload to a registry requiring
+	// signatures carries none
+	ErrSignatureRequired = errors.New("a signature from a trusted key is required")
+
+	// ErrSignatureInvalid is returned when an upload's signature was not made
+	// over its content by a trusted key
+	ErrSignatureInvalid = errors.New("signature verification failed")
+)
+
+// verifyUploadSignature checks the detached signature supplied with an upload,
+// returning nil if the registry does not require one
+func (s *Service) verifyUploadSignature(ctx context.Context, registryType string, content *receivedContent) (*signing.Verification, error) {
+	required, err := s.Settings.RequiresSignature(ctx, registryType)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check signature requirement: %w", err)
+	}
+	if !required {
+		return nil, nil
+	}
+
+	signature := signing.SignatureFromContext(ctx)
+	if len(signature) == 0 {
+		return nil, ErrSignatureRequired
+	}
+
+	// Signatures are made over the whole content, which is read back if it
+	// was streamed into storage
+	data, err := s.readAll(ctx, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content to verify: %w", err)
+	}
+	verification, err := signing.Verify(data, signature, s.signatureKeyring)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	return verification, nil
+}
+
+// VerifyManifestSignature checks that a manifest about to be tagged in an OCI
+// registry requiring signatures has a cosign signature by a trusted key,
+// stored under cosign's tag scheme or as a referrer. Manifests pushed by
+// digest and the signature artifacts themselves are not checked, so images
+// can be pushed untagged, signed, and then tagged.
+func (s *Service) VerifyManifestSignature(ctx context.Context, repository, reference string, manifest []byte) error {
+	if strings.HasPrefix(reference, "sha256:") || oci.IsSignatureTag(reference) {
+		return nil
+	}
+
+	required, err := s.Settings.RequiresSignature(ctx, "oci")
+	if err != nil {
+		return fmt.Errorf("failed to check signature requirement: %w", err)
+	}
+	if !required {
+		return nil
+	}
+
+	ociRegistry, ok := s.handlers["oci"].(*oci.Registry)
+	if !ok {
+		return fmt.Errorf("oci registry not available")
+	}
+
+	if s.signatureKeyring.Empty() {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, signing.ErrNoTrustedKeys)
+	}
+
+	sum := sha256.Sum256(manifest)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	verification, err := ociRegistry.VerifyCosignSignature(ctx, repository, digest, s.signatureKeyring)
+	if err != nil {
+		if errors.Is(err, oci.ErrSignatureNotFound) {
+			return fmt.Errorf("%w: %v", ErrSignatureRequired, err)
+		}
+		return err
+	}
+
+	log.Info().
+		Str("repository", repository).
+		Str("reference", reference).
+		Str("digest", digest).
+		Str("key_id", verification.KeyID).
+		Msg("Manifest signature verified")
+	return nil
+}
@@ -0,0 +1,214 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// quarantinePrefix is prepended to the storage path of a deleted artifact,
+// moving its content out of the way of the registry's own paths until it is
+// restored or purged
+const quarantinePrefix = "quarantine/"
+
+// softDelete marks an artifact deleted and moves its content to quarantine,
+// unless another artifact shares it. Deduplicated content stays where it is,
+// still referenced by the deleted artifact until it is purged.
+func (s *Service) softDelete(ctx context.Context, artifact *types.Artifact, userID uuid.UUID) error {
+	shared := isContentAddressed(artifact.StoragePath)
+	if !shared {
+		var err error
+		if shared, err = s.isStorageShared(ctx, artifact); err != nil {
+			return err
+		}
+	}
+
+	if !shared {
+		quarantined := quarantinePrefix + artifact.StoragePath
+		if err := s.moveStorage(ctx, artifact.StoragePath, quarantined, artifact.ContentType); err != nil {
+			return fmt.Errorf("failed to quarantine artifact: %w", err)
+		}
+		artifact.StoragePath = quarantined
+	}
+
+	now := time.Now()
+	if err := s.DB.WithContext(ctx).Unscoped().Model(artifact).Updates(map[string]interface{}{
+		"storage_path": artifact.StoragePath,
+		"deleted_at":   now,
+		"deleted_by":   userID,
+	}).Error; err != nil {
+		return fmt.Errorf("failed to delete artifact from database: %w", err)
+	}
+	artifact.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	artifact.DeletedBy = &userID
+
+	log.Info().
+		Str("registry", artifact.Registry).
+		Str("name", artifact.Name).
+		Str("version", artifact.Version).
+		Str("deleted_by", userID.String()).
+		Msg("artifact deleted, restorable until purged")
+	return nil
+}
+
+// Restore brings back a deleted artifact that has not been purged yet. The
+// user must be allowed to delete the artifact.
+func (s *Service) Restore(ctx context.Context, registryType, name, version string, userID uuid.UUID) (*types.Artifact, error) {
+	var artifact types.Artifact
+	if err := s.DB.WithContext(ctx).Unscoped().
+		Where("LOWER(name) = LOWER(?) AND version = ? AND registry = ? AND deleted_at IS NOT NULL",
+			name, version, registryType).
+		First(&artifact).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+		}
+		return nil, fmt.Errorf("failed to get artifact: %w", err)
+	}
+
+	canRestore, err := s.Ownership.CanUserDelete(ctx, registryType, artifact.Name, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check restore permissions: %w", err)
+	}
+	if !canRestore {
+		return nil, fmt.Errorf("insufficient permissions to restore artifact")
+	}
+
+	if restored, ok := strings.CutPrefix(artifact.StoragePath, quarantinePrefix); ok {
+		if err := s.moveStorage(ctx, artifact.StoragePath, restored, artifact.ContentType); err != nil {
+			return nil, fmt.Errorf("failed to restore artifact content: %w", err)
+		}
+		artifact.StoragePath = restored
+	}
+
+	if err := s.DB.WithContext(ctx).Unscoped().Model(&artifact).Updates(map[string]interface{}{
+		"storage_path": artifact.StoragePath,
+		"deleted_at":   nil,
+		"deleted_by":   nil,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to restore artifact: %w", err)
+	}
+	artifact.DeletedAt = gorm.DeletedAt{}
+	artifact.DeletedBy = nil
+	s.indexArtifact(&artifact)
+	s.auditLog.Record(ctx, userID, audit.ActionPackageRestore, audit.PackageTarget(registryType, artifact.Name, artifact.Version), nil)
+
+	log.Info().
+		Str("registry", artifact.Registry).
+		Str("name", artifact.Name).
+		Str("version", artifact.Version).
+		Str("restored_by", userID.String()).
+		Msg("artifact restored")
+	return &artifact, nil
+}
+
+// ListDeleted returns the deleted artifacts that can still be restored, most
+// recently deleted first. An empty registry type lists all registries.
+func (s *Service) ListDeleted(ctx context.Context, registryType string) ([]types.Artifact, error) {
+	query := s.DB.WithContext(ctx).Unscoped().Where("deleted_at IS NOT NULL")
+	if registryType != "" {
+		query = query.Where("registry = ?", registryType)
+	}
+
+	var artifacts []types.Artifact
+	if err := query.Order("deleted_at DESC").Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list deleted artifacts: %w", err)
+	}
+	return artifacts, nil
+}
+
+// PurgeDeleted permanently removes the artifacts deleted longer ago than the
+// grace period and returns how many were removed. Artifacts whose content
+// cannot be removed are kept for the next purge.
+func (s *Service) PurgeDeleted(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-s.config.DeleteGracePeriod)
+
+	var artifacts []types.Artifact
+	if err := s.DB.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at <= ?", cutoff).
+		Find(&artifacts).Error; err != nil {
+		return 0, fmt.Errorf("failed to find deleted artifacts: %w", err)
+	}
+
+	purged := 0
+	for i := range artifacts {
+		artifact := &artifacts[i]
+		if err := s.removeArtifact(ctx, artifact); err != nil {
+			log.Error().Err(err).
+				Str("registry", artifact.Registry).
+				Str("name", artifact.Name).
+				Str("version", artifact.Version).
+				Msg("Failed to purge artifact")
+			continue
+		}
+		purged++
+	}
+
+	if purged > 0 {
+		log.Info().Int("purged", purged).Msg("Purged deleted artifacts")
+	}
+	return purged, nil
+}
+
+// isStorageShared reports whether another artifact, deleted or not, refers
+// to the same content as an artifact
+func (s *Service) isStorageShared(ctx context.Context, artifact *types.Artifact) (bool, error) {
+	var sharing int64
+	if err := s.DB.WithContext(ctx).Unscoped().Model(&types.Artifact{}).
+		Where("storage_path = ? AND id <> ?", artifact.StoragePath, artifact.ID).
+		Count(&sharing).Error; err != nil {
+		return false, fmt.Errorf("failed to check shared storage: %w", err)
+	}
+	return sharing > 0, nil
+}
+
+// moveStorage moves content from one storage path to another
+func (s *Service) moveStorage(ctx context.Context, from, to, contentType string) error {
+	return storage.Move(ctx, s.Storage, from, to, contentType)
+}
+
+// PurgeWorker purges deleted artifacts periodically in the background
+type PurgeWorker struct {
+	service  *Service
+	interval time.Duration
+}
+
+// NewPurgeWorker creates a worker that purges the service's deleted artifacts
+// every interval
+func NewPurgeWorker(service *Service, interval time.Duration) *PurgeWorker {
+	return &PurgeWorker{service: service, interval: interval}
+}
+
+// Start purges deleted artifacts every interval until ctx is done. It
+// returns immediately; a non-positive interval disables the worker.
+func (w *PurgeWorker) Start(ctx context.Context) {
+	if w.interval <= 0 {
+		log.Info().Msg("Purge worker disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := w.service.PurgeDeleted(ctx); err != nil {
+					log.Error().Err(err).Msg("Purge run failed")
+				}
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", w.interval).Msg("Purge worker started")
+}
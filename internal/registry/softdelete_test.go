@@ -0,0 +1,131 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// setupSoftDeleteTest returns a service with a grace period for deleted
+// artifacts and a published artifact owned by the returned user
+func setupSoftDeleteTest(t *testing.T) (*Service, *types.User, *types.Artifact) {
+	t.Helper()
+
+	db := setupTestDB(t)
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	service := NewService(db, localStorage)
+	mockHandler := &MockHandler{}
+	mockHandler.On("Validate", mock.AnythingOfType("*types.Artifact"), mock.Anything).Return(nil).Maybe()
+	mockHandler.On("GetMetadata", mock.Anything).Return(map[string]interface{}{}, nil).Maybe()
+	service.handlers["test"] = mockHandler
+	service.Configure(config.RegistryConfig{DeleteGracePeriod: time.Hour})
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	artifact := &types.Artifact{
+		Name:        "left-pad",
+		Version:     "1.0.0",
+		Registry:    "test",
+		Size:        7,
+		StoragePath: "test/left-pad/1.0.0/artifact",
+		PublishedBy: user.ID,
+	}
+	require.NoError(t, localStorage.Store(ctx, artifact.StoragePath, bytes.NewReader([]byte("content")), "application/octet-stream"))
+	require.NoError(t, db.Create(artifact).Error)
+	require.NoError(t, service.Ownership.EstablishInitialOwnership(ctx, "test", "left-pad", user.ID))
+
+	return service, user, artifact
+}
+
+func TestSoftDelete_Restore(t *testing.T) {
+	service, user, artifact := setupSoftDeleteTest(t)
+	ctx := context.Background()
+
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "1.0.0", user.ID))
+
+	// Deleted artifacts can be neither downloaded nor listed
+	_, _, err := service.Download(ctx, "test", "left-pad", "1.0.0")
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+	listed, total, err := service.List(ctx, &types.ArtifactFilter{Registry: "test"})
+	require.NoError(t, err)
+	assert.Empty(t, listed)
+	assert.Zero(t, total)
+
+	// The content is quarantined rather than removed
+	exists, err := service.Storage.Exists(ctx, artifact.StoragePath)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = service.Storage.Exists(ctx, quarantinePrefix+artifact.StoragePath)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	deleted, err := service.ListDeleted(ctx, "test")
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+	assert.Equal(t, artifact.ID, deleted[0].ID)
+	assert.Equal(t, &user.ID, deleted[0].DeletedBy)
+
+	// The version cannot be published again while it can be restored
+	_, err = service.Upload(ctx, "test", "left-pad", "1.0.0", bytes.NewReader([]byte("other")), user.ID)
+	assert.ErrorIs(t, err, ErrArtifactExists)
+
+	restored, err := service.Restore(ctx, "test", "left-pad", "1.0.0", user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, artifact.StoragePath, restored.StoragePath)
+	assert.Nil(t, restored.DeletedBy)
+
+	_, content, err := service.Download(ctx, "test", "left-pad", "1.0.0")
+	require.NoError(t, err)
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(data))
+
+	deleted, err = service.ListDeleted(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	_, err = service.Restore(ctx, "test", "left-pad", "1.0.0", user.ID)
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+}
+
+func TestSoftDelete_Purge(t *testing.T) {
+	service, user, artifact := setupSoftDeleteTest(t)
+	ctx := context.Background()
+
+	require.NoError(t, service.Delete(ctx, "test", "left-pad", "1.0.0", user.ID))
+
+	// Nothing is purged within the grace period
+	purged, err := service.PurgeDeleted(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, purged)
+
+	require.NoError(t, service.DB.Unscoped().Model(&types.Artifact{}).
+		Where("id = ?", artifact.ID).
+		Update("deleted_at", time.Now().Add(-2*time.Hour)).Error)
+
+	purged, err = service.PurgeDeleted(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	var count int64
+	require.NoError(t, service.DB.Unscoped().Model(&types.Artifact{}).Where("id = ?", artifact.ID).Count(&count).Error)
+	assert.Zero(t, count)
+	exists, err := service.Storage.Exists(ctx, quarantinePrefix+artifact.StoragePath)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = service.Restore(ctx, "test", "left-pad", "1.0.0", user.ID)
+	assert.ErrorIs(t, err, ErrArtifactNotFound)
+}
@@ -0,0 +1,110 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// uploadSpoolPrefix is where content streamed into storage by receiveContent
+// is kept until the upload is accepted. Uploads that fail remove it, and
+// storage reconciliation leaves it alone, as an upload may still be in
+// progress however long ago it started.
+const uploadSpoolPrefix = "uploads/"
+
+// uploadHeadSize is how much of the start of streamed content is kept for
+// StreamingHandler checks, enough for every format checkContentFormat
+// detects
+const uploadHeadSize = 512
+
+// receivedContent is the content of an artifact being uploaded, read once
+// and hashed as it was read
+type receivedContent struct {
+	// data is the whole content, or only its first uploadHeadSize bytes when
+	// it was streamed into storage
+	data []byte
+
+	// spoolPath is where streamed content is stored until storeSpooled moves
+	// it, empty when data holds all of the content
+	spoolPath string
+
+	size   int64
+	sha256 []byte
+}
+
+// receiveContent reads the content of an upload, computing its SHA256 in the
+// same pass. Content for handlers implementing StreamingHandler is streamed
+// into storage as it is read rather than held in memory, and must be
+// discarded once the upload is done.
+func (s *Service) receiveContent(ctx context.Context, handler Handler, content io.Reader) (*receivedContent, error) {
+	if _, ok := handler.(StreamingHandler); !ok {
+		hasher := sha256.New()
+		data, err := io.ReadAll(io.TeeReader(content, hasher))
+		if err != nil {
+			return nil, err
+		}
+		return &receivedContent{data: data, size: int64(len(data)), sha256: hasher.Sum(nil)}, nil
+	}
+
+	spoolPath := uploadSpoolPrefix + uuid.NewString()
+	head := &headWriter{limit: uploadHeadSize}
+	size, digest, err := storage.StoreVerified(ctx, s.Storage, spoolPath, io.TeeReader(content, head), "application/octet-stream", "")
+	if err != nil {
+		s.Storage.Delete(ctx, spoolPath)
+		return nil, err
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		s.Storage.Delete(ctx, spoolPath)
+		return nil, fmt.Errorf("invalid content digest: %w", err)
+	}
+	return &receivedContent{data: head.data, spoolPath: spoolPath, size: size, sha256: sum}, nil
+}
+
+// readAll returns the whole content, reading content streamed into storage
+// back into memory
+func (s *Service) readAll(ctx context.Context, content *receivedContent) ([]byte, error) {
+	if content.spoolPath == "" {
+		return content.data, nil
+	}
+	reader, err := s.Storage.Retrieve(ctx, content.spoolPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// discard removes content streamed into storage that storeSpooled did not
+// move to an artifact's storage path
+func (s *Service) discard(ctx context.Context, content *receivedContent) {
+	if content.spoolPath == "" {
+		return
+	}
+	if err := s.Storage.Delete(ctx, content.spoolPath); err != nil {
+		log.Warn().Err(err).Str("path", content.spoolPath).Msg("Failed to remove streamed upload")
+	}
+	content.spoolPath = ""
+}
+
+// headWriter keeps the first limit bytes written to it
+type headWriter struct {
+	data  []byte
+	limit int
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if remaining := w.limit - len(w.data); remaining > 0 {
+		if len(p) < remaining {
+			remaining = len(p)
+		}
+		w.data = append(w.data, p[:remaining]...)
+	}
+	return len(p), nil
+}
@@ -0,0 +1,330 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTransferForbidden is returned when a user other than the primary
+	// owner or an admin proposes or cancels a transfer
+	ErrTransferForbidden = errors.New("only the primary owner or an admin can transfer a package")
+
+	// ErrTransferNotFound is returned when a package has no pending transfer
+	// addressed to the user
+	ErrTransferNotFound = errors.New("no pending ownership transfer found")
+
+	// ErrInvalidTransfer is returned when a transfer cannot be proposed
+	ErrInvalidTransfer = errors.New("invalid ownership transfer")
+)
+
+// CanUserTransfer checks if a user may transfer a package to another user.
+// Only its primary owner and admins may.
+func (os *OwnershipService) CanUserTransfer(ctx context.Context, registry, packageName string, userID uuid.UUID) (bool, error) {
+	var user types.User
+	if err := os.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user.IsAdmin {
+		return true, nil
+	}
+
+	primary, err := os.GetPrimaryOwner(ctx, registry, packageName)
+	if err != nil {
+		return false, err
+	}
+
+	return primary != nil && primary.UserID == userID, nil
+}
+
+// ProposeTransfer proposes making another user the primary owner of a
+// package. Nothing changes until they accept; a proposal replaces any that
+// is still pending.
+func (os *OwnershipService) ProposeTransfer(ctx context.Context, registry, packageName string, toUserID, initiatedBy uuid.UUID) (*types.OwnershipTransfer, error) {
+	canTransfer, err := os.CanUserTransfer(ctx, registry, packageName, initiatedBy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
+	}
+
+	if !canTransfer {
+		return nil, ErrTransferForbidden
+	}
+
+	primary, err := os.GetPrimaryOwner(ctx, registry, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if primary == nil {
+		return nil, fmt.Errorf("%w: package has no primary owner", ErrInvalidTransfer)
+	}
+
+	if primary.UserID == toUserID {
+		return nil, fmt.Errorf("%w: user is already the primary owner", ErrInvalidTransfer)
+	}
+
+	var recipient types.User
+	if err := os.db.WithContext(ctx).Where("id = ? AND is_active = ?", toUserID, true).First(&recipient).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: recipient not found", ErrInvalidTransfer)
+		}
+		return nil, fmt.Errorf("failed to get recipient: %w", err)
+	}
+
+	packageKey := generatePackageKey(registry, packageName)
+	transfer := &types.OwnershipTransfer{
+		PackageKey:  packageKey,
+		FromUserID:  primary.UserID,
+		ToUserID:    toUserID,
+		InitiatedBy: initiatedBy,
+		Status:      types.TransferStatusPending,
+	}
+
+	err = os.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := cancelPendingTransfers(tx, packageKey); err != nil {
+			return err
+		}
+		return tx.Create(transfer).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to propose transfer: %w", err)
+	}
+
+	log.Info().
+		Str("package_key", packageKey).
+		Str("from_user_id", primary.UserID.String()).
+		Str("to_user_id", toUserID.String()).
+		Str("initiated_by", initiatedBy.String()).
+		Msg("Package ownership transfer proposed")
+
+	return transfer, nil
+}
+
+// GetPendingTransfer returns the pending transfer of a package
+func (os *OwnershipService) GetPendingTransfer(ctx context.Context, registry, packageName string) (*types.OwnershipTransfer, error) {
+	var transfer types.OwnershipTransfer
+	if err := os.db.WithContext(ctx).Where("package_key = ? AND status = ?",
+		generatePackageKey(registry, packageName), types.TransferStatusPending).First(&transfer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTransferNotFound
+		}
+		return nil, fmt.Errorf("failed to get pending transfer: %w", err)
+	}
+
+	return &transfer, nil
+}
+
+// GetIncomingTransfers returns the pending transfers addressed to a user
+func (os *OwnershipService) GetIncomingTransfers(ctx context.Context, userID uuid.UUID) ([]types.OwnershipTransfer, error) {
+	var transfers []types.OwnershipTransfer
+	if err := os.db.WithContext(ctx).Where("to_user_id = ? AND status = ?", userID, types.TransferStatusPending).
+		Order("created_at").Find(&transfers).Error; err != nil {
+		return nil, fmt.Errorf("failed to get incoming transfers: %w", err)
+	}
+
+	return transfers, nil
+}
+
+// CancelTransfer withdraws the pending transfer of a package
+func (os *OwnershipService) CancelTransfer(ctx context.Context, registry, packageName string, userID uuid.UUID) (*types.OwnershipTransfer, error) {
+	canTransfer, err := os.CanUserTransfer(ctx, registry, packageName, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
+	}
+
+	if !canTransfer {
+		return nil, ErrTransferForbidden
+	}
+
+	transfer, err := os.GetPendingTransfer(ctx, registry, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := respondToTransfer(os.db.WithContext(ctx), transfer, types.TransferStatusCancelled); err != nil {
+		return nil, fmt.Errorf("failed to cancel transfer: %w", err)
+	}
+
+	return transfer, nil
+}
+
+// AcceptTransfer makes the recipient of a package's pending transfer its
+// primary owner. The previous primary owner remains an owner, so they can
+// hand over maintenance gradually or remove themselves afterwards.
+func (os *OwnershipService) AcceptTransfer(ctx context.Context, registry, packageName string, userID uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, err := os.getTransferForRecipient(ctx, registry, packageName, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&types.PackageOwnership{}).
+			Where("package_key = ? AND is_primary = ?", transfer.PackageKey, true).
+			Update("is_primary", false).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		var ownership types.PackageOwnership
+		err := tx.Where("package_key = ? AND user_id = ?", transfer.PackageKey, userID).First(&ownership).Error
+		switch {
+		case err == nil:
+			ownership.Role = RoleOwner
+			ownership.IsPrimary = true
+			ownership.GrantedBy = transfer.InitiatedBy
+			ownership.GrantedAt = now
+			if err := tx.Save(&ownership).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(&types.PackageOwnership{
+				PackageKey: transfer.PackageKey,
+				UserID:     userID,
+				Role:       RoleOwner,
+				IsPrimary:  true,
+				GrantedBy:  transfer.InitiatedBy,
+				GrantedAt:  now,
+			}).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return respondToTransfer(tx, transfer, types.TransferStatusAccepted)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept transfer: %w", err)
+	}
+
+	log.Info().
+		Str("package_key", transfer.PackageKey).
+		Str("from_user_id", transfer.FromUserID.String()).
+		Str("to_user_id", userID.String()).
+		Msg("Package ownership transferred")
+
+	return transfer, nil
+}
+
+// DeclineTransfer refuses the pending transfer of a package, leaving its
+// ownership unchanged
+func (os *OwnershipService) DeclineTransfer(ctx context.Context, registry, packageName string, userID uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, err := os.getTransferForRecipient(ctx, registry, packageName, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := respondToTransfer(os.db.WithContext(ctx), transfer, types.TransferStatusDeclined); err != nil {
+		return nil, fmt.Errorf("failed to decline transfer: %w", err)
+	}
+
+	return transfer, nil
+}
+
+// getTransferForRecipient returns the pending transfer of a package if it is
+// addressed to the user
+func (os *OwnershipService) getTransferForRecipient(ctx context.Context, registry, packageName string, userID uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, err := os.GetPendingTransfer(ctx, registry, packageName)
+	if err != nil {
+		return nil, err
+	}
+
+	if transfer.ToUserID != userID {
+		return nil, ErrTransferNotFound
+	}
+
+	return transfer, nil
+}
+
+// respondToTransfer moves a pending transfer to its final status. It fails if
+// the transfer is no longer pending, so concurrent responses cannot both apply.
+func respondToTransfer(tx *gorm.DB, transfer *types.OwnershipTransfer, status string) error {
+	now := time.Now()
+	result := tx.Model(&types.OwnershipTransfer{}).
+		Where("id = ? AND status = ?", transfer.ID, types.TransferStatusPending).
+		Updates(map[string]interface{}{"status": status, "responded_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTransferNotFound
+	}
+
+	transfer.Status = status
+	transfer.RespondedAt = &now
+	return nil
+}
+
+// cancelPendingTransfers cancels the pending transfer of a package, if any
+func cancelPendingTransfers(tx *gorm.DB, packageKey string) error {
+	return tx.Model(&types.OwnershipTransfer{}).
+		Where("package_key = ? AND status = ?", packageKey, types.TransferStatusPending).
+		Updates(map[string]interface{}{"status": types.TransferStatusCancelled, "responded_at": time.Now()}).Error
+}
+
+// ProposeOwnershipTransfer proposes transferring a package to another user
+func (s *Service) ProposeOwnershipTransfer(ctx context.Context, registryType, packageName string, toUserID, userID uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, err := s.Ownership.ProposeTransfer(ctx, registryType, packageName, toUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionOwnerTransfer, transfer.PackageKey, map[string]interface{}{
+		"transfer_id":  transfer.ID.String(),
+		"from_user_id": transfer.FromUserID.String(),
+		"to_user_id":   transfer.ToUserID.String(),
+	})
+	return transfer, nil
+}
+
+// AcceptOwnershipTransfer accepts the pending transfer of a package
+func (s *Service) AcceptOwnershipTransfer(ctx context.Context, registryType, packageName string, userID uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, err := s.Ownership.AcceptTransfer(ctx, registryType, packageName, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionOwnerTransferAccept, transfer.PackageKey, map[string]interface{}{
+		"transfer_id":  transfer.ID.String(),
+		"from_user_id": transfer.FromUserID.String(),
+	})
+	return transfer, nil
+}
+
+// DeclineOwnershipTransfer declines the pending transfer of a package
+func (s *Service) DeclineOwnershipTransfer(ctx context.Context, registryType, packageName string, userID uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, err := s.Ownership.DeclineTransfer(ctx, registryType, packageName, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionOwnerTransferDecline, transfer.PackageKey, map[string]interface{}{
+		"transfer_id":  transfer.ID.String(),
+		"from_user_id": transfer.FromUserID.String(),
+	})
+	return transfer, nil
+}
+
+// CancelOwnershipTransfer withdraws the pending transfer of a package
+func (s *Service) CancelOwnershipTransfer(ctx context.Context, registryType, packageName string, userID uuid.UUID) (*types.OwnershipTransfer, error) {
+	transfer, err := s.Ownership.CancelTransfer(ctx, registryType, packageName, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionOwnerTransferCancel, transfer.PackageKey, map[string]interface{}{
+		"transfer_id": transfer.ID.String(),
+		"to_user_id":  transfer.ToUserID.String(),
+	})
+	return transfer, nil
+}
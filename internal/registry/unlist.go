@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// ErrUnlistForbidden is returned when a user who does not own a package tries
+// to unlist or relist one of its versions
+var ErrUnlistForbidden = errors.New("only package owners can unlist versions")
+
+// listedMetadataKey is the artifact metadata field recording whether a
+// version is listed
+const listedMetadataKey = "listed"
+
+// IsListed reports whether a version is listed. Versions are listed unless
+// they have been unlisted.
+func IsListed(artifact *types.Artifact) bool {
+	listed, ok := artifact.Metadata[listedMetadataKey].(bool)
+	return !ok || listed
+}
+
+// SetListed lists or unlists a version of a package. Unlisted versions are
+// hidden from search and version listings but stay downloadable by exact
+// version, so restores that pinned them keep working. Only owners of the
+// package can unlist its versions.
+func (s *Service) SetListed(ctx context.Context, registryType, name, version string, listed bool, userID uuid.UUID) (*types.Artifact, error) {
+	var artifact types.Artifact
+	if err := s.DB.WithContext(ctx).
+		Where("normalized_name = ? AND version = ? AND registry = ?", utils.NormalizePackageName(name, registryType), version, registryType).
+		First(&artifact).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+		}
+		return nil, fmt.Errorf("failed to get artifact: %w", err)
+	}
+
+	canUnlist, err := s.Ownership.CanUserDelete(ctx, registryType, artifact.Name, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check unlist permissions: %w", err)
+	}
+	if !canUnlist {
+		return nil, ErrUnlistForbidden
+	}
+
+	if IsListed(&artifact) == listed {
+		return &artifact, nil
+	}
+	if artifact.Metadata == nil {
+		artifact.Metadata = make(types.JSONMap)
+	}
+	artifact.Metadata[listedMetadataKey] = listed
+	if err := s.DB.WithContext(ctx).Model(&artifact).Update("metadata", artifact.Metadata).Error; err != nil {
+		return nil, fmt.Errorf("failed to update artifact metadata: %w", err)
+	}
+
+	action := audit.ActionPackageUnlist
+	if listed {
+		action = audit.ActionPackageRelist
+	}
+	s.auditLog.Record(ctx, userID, action, audit.PackageTarget(registryType, artifact.Name, artifact.Version), nil)
+
+	log.Info().
+		Str("registry", registryType).
+		Str("name", artifact.Name).
+		Str("version", artifact.Version).
+		Bool("listed", listed).
+		Str("user_id", userID.String()).
+		Msg("Package version listing updated")
+	return &artifact, nil
+}
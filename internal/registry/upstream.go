@@ -0,0 +1,218 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/upstream"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// UpstreamMetadataKey is the artifact metadata key recording the upstream
+// registry an artifact was cached from
+const UpstreamMetadataKey = "upstream"
+
+// UpstreamPublisherID is the system user artifacts cached from an upstream
+// registry are recorded as published by, rather than whoever happened to
+// request them first. The user is created inactive and without a usable
+// password, so nobody can sign in as it.
+var UpstreamPublisherID = uuid.MustParse("00000000-0000-0000-0000-00000000feed")
+
+// upstreamPublisherUsername is the username of the UpstreamPublisherID user
+const upstreamPublisherUsername = "lodestone-upstream"
+
+// ErrPublishedLocally is returned when caching a version from the upstream
+// under the name of a package published locally, which would let the
+// upstream's package of that name pass as a version of the local one
+var ErrPublishedLocally = errors.New("package is published locally")
+
+// Upstream returns the proxy for the registry's configured upstream, or nil
+// when packages missing from the registry are not fetched from anywhere
+func (s *Service) Upstream(registryType string) *upstream.Proxy {
+	return s.upstreams[registryType]
+}
+
+// CachesUpstreamSnapshots reports whether Maven snapshot builds fetched from
+// the upstream are cached. Snapshots change, so by default they are only
+// passed through.
+func (s *Service) CachesUpstreamSnapshots() bool {
+	return s.config.UpstreamCacheSnapshots
+}
+
+// IsUpstreamCached reports whether an artifact was cached from an upstream
+// registry rather than published locally
+func IsUpstreamCached(artifact *types.Artifact) bool {
+	_, cached := artifact.Metadata[UpstreamMetadataKey]
+	return cached
+}
+
+// IsPublishedLocally reports whether any version of a package, whoever can
+// read it and whatever its status, was published locally rather than cached
+// from the upstream. The upstream must not serve such a package's missing
+// versions, since its package of the same name is not the local one.
+func (s *Service) IsPublishedLocally(ctx context.Context, registryType, name string) (bool, error) {
+	var versions []types.Artifact
+	if err := s.DB.WithContext(ctx).Select("metadata").
+		Where("normalized_name = ? AND registry = ?", utils.NormalizePackageName(name, registryType), registryType).
+		Find(&versions).Error; err != nil {
+		return false, fmt.Errorf("failed to get package versions: %w", err)
+	}
+	for i := range versions {
+		if !IsUpstreamCached(&versions[i]) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// packageOrigins returns how many versions of a package, deleted ones
+// included, were published locally and how many were cached from the
+// upstream
+func (s *Service) packageOrigins(ctx context.Context, registryType, name string) (local, cached int, err error) {
+	var versions []types.Artifact
+	if err := s.DB.WithContext(ctx).Unscoped().Select("metadata").
+		Where("normalized_name = ? AND registry = ?", utils.NormalizePackageName(name, registryType), registryType).
+		Find(&versions).Error; err != nil {
+		return 0, 0, fmt.Errorf("failed to check existing packages: %w", err)
+	}
+	for i := range versions {
+		if IsUpstreamCached(&versions[i]) {
+			cached++
+		} else {
+			local++
+		}
+	}
+	return local, cached, nil
+}
+
+// checkUpstreamName returns ErrPublishForbidden when a user who is not an
+// administrator publishes the first local version of a package cached from
+// the upstream. Cached packages have no owner, and the first local version
+// would cut the upstream package off and serve the publisher's in its place.
+func (s *Service) checkUpstreamName(ctx context.Context, registryType, name string, local, cached int, publishedBy uuid.UUID) error {
+	if local > 0 || cached == 0 {
+		return nil
+	}
+	var publisher types.User
+	if err := s.DB.WithContext(ctx).Select("is_admin").Where("id = ?", publishedBy).First(&publisher).Error; err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !publisher.IsAdmin {
+		return fmt.Errorf("%w %s: the package is cached from the upstream", ErrPublishForbidden, name)
+	}
+	return nil
+}
+
+// CacheUpstream stores a version fetched from the registry's upstream so it
+// is served locally from then on. Unlike Upload it neither establishes
+// package ownership nor waits for approval, since the package was published
+// elsewhere; the UpstreamPublisherID system user is recorded as the
+// publisher, and the cached version is public whatever the configured default
+// visibility. A version that already exists is returned unchanged, and
+// ErrPublishedLocally for a package published locally.
+func (s *Service) CacheUpstream(ctx context.Context, registryType, name, version string, content []byte) (*types.Artifact, error) {
+	proxy := s.Upstream(registryType)
+	if proxy == nil {
+		return nil, fmt.Errorf("registry %s has no upstream", registryType)
+	}
+	handler, exists := s.handlers[registryType]
+	if !exists {
+		return nil, fmt.Errorf("unsupported registry type: %s", registryType)
+	}
+
+	if existing, err := s.GetArtifact(ctx, registryType, name, version); err == nil {
+		// Versions cached before cached copies were public are made public
+		// on their next request rather than fetched upstream every time
+		if IsUpstreamCached(existing) && !existing.IsPublic {
+			if err := s.DB.WithContext(ctx).Model(existing).Update("is_public", true).Error; err != nil {
+				return nil, fmt.Errorf("failed to update artifact visibility: %w", err)
+			}
+		}
+		return existing, nil
+	}
+	local, err := s.IsPublishedLocally(ctx, registryType, name)
+	if err != nil {
+		return nil, err
+	}
+	if local {
+		return nil, fmt.Errorf("%w: %s", ErrPublishedLocally, name)
+	}
+	if err := s.ensureUpstreamPublisher(ctx); err != nil {
+		return nil, err
+	}
+
+	artifact := &types.Artifact{
+		ID:          uuid.New(),
+		Name:        utils.SanitizePackageName(name, registryType),
+		Version:     version,
+		Registry:    registryType,
+		Size:        int64(len(content)),
+		SHA256:      utils.ComputeSHA256(content),
+		PublishedBy: UpstreamPublisherID,
+		Status:      types.ArtifactStatusPublished,
+		// Cached copies are public, as they are upstream. Under the default
+		// visibility nobody could read them, since nobody publishes as
+		// UpstreamPublisherID, and every request would go upstream again.
+		IsPublic: true,
+	}
+
+	if err := handler.Validate(artifact, content); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	metadata, err := handler.GetMetadata(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract metadata: %w", err)
+	}
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	metadata[UpstreamMetadataKey] = proxy.URL()
+	artifact.Metadata = metadata
+
+	artifact.StoragePath = s.storagePath(handler, artifact)
+	if err := s.storeContent(ctx, handler, artifact, content); err != nil {
+		return nil, fmt.Errorf("failed to upload artifact: %w", err)
+	}
+
+	if err := s.createArtifact(ctx, artifact); err != nil {
+		return nil, fmt.Errorf("failed to save artifact metadata: %w", err)
+	}
+	s.indexArtifact(artifact)
+	s.storeReadme(ctx, artifact, content)
+
+	log.Info().
+		Str("registry_type", registryType).
+		Str("name", artifact.Name).
+		Str("version", version).
+		Str("upstream", proxy.URL()).
+		Msg("Cached artifact from upstream")
+	return artifact, nil
+}
+
+// ensureUpstreamPublisher creates the UpstreamPublisherID system user the
+// first time an artifact is cached
+func (s *Service) ensureUpstreamPublisher(ctx context.Context) error {
+	publisher := types.User{
+		ID:       UpstreamPublisherID,
+		Username: upstreamPublisherUsername,
+		Email:    upstreamPublisherUsername + "@localhost",
+		// Not a bcrypt hash, so no password matches it
+		Password: "!",
+	}
+	if err := s.DB.WithContext(ctx).Where("id = ?", UpstreamPublisherID).
+		Attrs(publisher).FirstOrCreate(&publisher).Error; err != nil {
+		return fmt.Errorf("failed to create upstream publisher: %w", err)
+	}
+	// The column defaults to active, so the user is deactivated explicitly
+	if publisher.IsActive {
+		if err := s.DB.WithContext(ctx).Model(&publisher).Update("is_active", false).Error; err != nil {
+			return fmt.Errorf("failed to deactivate upstream publisher: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+	"gorm.io/gorm"
+)
+
+// Access levels collaborators hold on a package, as npm access names them
+const (
+	AccessReadOnly  = "read-only"
+	AccessReadWrite = "read-write"
+)
+
+var (
+	// ErrVisibilityForbidden is returned when a user who does not own a
+	// package tries to change its visibility
+	ErrVisibilityForbidden = errors.New("only package owners can change visibility")
+
+	// ErrInvalidAccessLevel is returned for access levels other than
+	// read-only and read-write
+	ErrInvalidAccessLevel = errors.New("invalid access level: must be read-only or read-write")
+
+	// ErrCollaboratorNotFound is returned when granting access to a user who
+	// does not exist
+	ErrCollaboratorNotFound = errors.New("user not found")
+
+	// ErrAccessForbidden is returned when a user who is not an owner or
+	// maintainer of a package asks who has access to it
+	ErrAccessForbidden = errors.New("only package owners and maintainers can view package access")
+)
+
+// readerKey is the context key of the resolver for the user a request reads
+// packages as
+type readerKey struct{}
+
+// WithReader returns a context carrying a resolver for the user a request
+// reads packages as, returning nil for anonymous requests. Downloads and
+// listings made with such a context only see the packages that user can
+// read; those made without one, such as by background jobs, are not limited.
+// The resolver is called when the package is read, after authentication has
+// run, so it can be installed before the user is known.
+func WithReader(ctx context.Context, resolve func() *types.User) context.Context {
+	return context.WithValue(ctx, readerKey{}, resolve)
+}
+
+// readerFromContext returns the user a request reads packages as, and
+// whether the context carries a reader at all
+func readerFromContext(ctx context.Context) (*types.User, bool) {
+	resolve, ok := ctx.Value(readerKey{}).(func() *types.User)
+	if !ok {
+		return nil, false
+	}
+	return resolve(), true
+}
+
+// canRead reports whether user can read an artifact. Public packages are
+// readable by anyone, restricted ones by the users who published them, hold
+// a role on them or are members of the organization owning their namespace,
+// and every package by administrators. A nil user reads only public packages.
+func (s *Service) canRead(ctx context.Context, artifact *types.Artifact, user *types.User) (bool, error) {
+	switch {
+	case artifact.IsPublic:
+		return true, nil
+	case user == nil:
+		return false, nil
+	case user.IsAdmin, artifact.PublishedBy == user.ID:
+		return true, nil
+	}
+	return s.Ownership.CanUserRead(ctx, artifact.Registry, artifact.Name, user.ID)
+}
+
+// whereReadable limits an artifact query to the packages user can read, as
+// canRead decides
+func (s *Service) whereReadable(ctx context.Context, query *gorm.DB, user *types.User) (*gorm.DB, error) {
+	scope, err := s.ReadableScope(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return query.Scopes(scope), nil
+}
+
+// readableByRequest limits an artifact query to the packages the request may
+// read, as whereReadable does. Requests without a reader, such as by
+// background jobs, are not limited.
+func (s *Service) readableByRequest(ctx context.Context, query *gorm.DB) (*gorm.DB, error) {
+	user, ok := readerFromContext(ctx)
+	if !ok {
+		return query, nil
+	}
+	return s.whereReadable(ctx, query, user)
+}
+
+// ReadableScope returns a query scope limiting artifacts to the packages user
+// can read, as canRead decides, for artifact queries made outside the
+// registry service such as searches
+func (s *Service) ReadableScope(ctx context.Context, user *types.User) (func(*gorm.DB) *gorm.DB, error) {
+	switch {
+	case user == nil:
+		return func(query *gorm.DB) *gorm.DB {
+			return query.Where("artifacts.is_public = ?", true)
+		}, nil
+	case user.IsAdmin:
+		return func(query *gorm.DB) *gorm.DB { return query }, nil
+	}
+
+	var owned []string
+	if err := s.DB.WithContext(ctx).Model(&types.PackageOwnership{}).
+		Where("user_id = ?", user.ID).
+		Pluck("package_key", &owned).Error; err != nil {
+		return nil, fmt.Errorf("failed to get owned packages: %w", err)
+	}
+
+	orgs, err := s.Organizations.UserOrganizations(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	readable := s.DB.Where("artifacts.is_public = ? OR artifacts.published_by = ?", true, user.ID)
+	if len(owned) > 0 {
+		// Package keys are the registry and normalized name joined by a colon
+		readable = readable.Or("artifacts.registry || ':' || artifacts.normalized_name IN ?", owned)
+	}
+	for _, org := range orgs {
+		for registryType := range s.handlers {
+			for _, namespace := range namespacePrefixes(registryType, org) {
+				readable = readable.Or("artifacts.registry = ? AND SUBSTR(artifacts.normalized_name, 1, ?) = ?", registryType, len(namespace), namespace)
+			}
+		}
+	}
+	return func(query *gorm.DB) *gorm.DB { return query.Where(readable) }, nil
+}
+
+// CanReadPackage reports whether a request may read a package, which it can
+// when the package has a published version the user it reads as can read,
+// as canRead decides. Requests without a reader, such as by background jobs,
+// may read every package.
+func (s *Service) CanReadPackage(ctx context.Context, registryType, name string) (bool, error) {
+	user, ok := readerFromContext(ctx)
+	if !ok {
+		return true, nil
+	}
+
+	query := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+		Where("normalized_name = ? AND registry = ? AND status = ?",
+			utils.NormalizePackageName(name, registryType), registryType, types.ArtifactStatusPublished)
+	query, err := s.whereReadable(ctx, query, user)
+	if err != nil {
+		return false, err
+	}
+
+	var readable int64
+	if err := query.Limit(1).Count(&readable).Error; err != nil {
+		return false, fmt.Errorf("failed to check read access: %w", err)
+	}
+	return readable > 0, nil
+}
+
+// ReadableVersions returns a filter reporting whether a request may read a
+// published version of a registry's packages, as canRead decides, for
+// listings built outside the database such as cached indexes. It returns nil
+// when the request may read every package.
+func (s *Service) ReadableVersions(ctx context.Context, registryType string) (func(name, version string) bool, error) {
+	user, ok := readerFromContext(ctx)
+	if !ok || (user != nil && user.IsAdmin) {
+		return nil, nil
+	}
+
+	query := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+		Where("registry = ? AND status = ?", registryType, types.ArtifactStatusPublished)
+	query, err := s.whereReadable(ctx, query, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []struct{ Name, Version string }
+	if err := query.Select("artifacts.name, artifacts.version").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get readable versions: %w", err)
+	}
+
+	readable := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		readable[version.Name+"@"+version.Version] = true
+	}
+	return func(name, version string) bool { return readable[name+"@"+version] }, nil
+}
+
+// accessLevelRoles are the ownership roles granting each access level
+var accessLevelRoles = map[string]string{
+	AccessReadOnly:  RoleContributor,
+	AccessReadWrite: RoleMaintainer,
+}
+
+// GetPackageVisibility reports whether a package is public. Only owners and
+// maintainers of the package and administrators may ask.
+func (s *Service) GetPackageVisibility(ctx context.Context, registryType, name string, userID uuid.UUID) (bool, error) {
+	if err := s.checkCanViewAccess(ctx, registryType, name, userID); err != nil {
+		return false, err
+	}
+
+	var versions []types.Artifact
+	if err := s.DB.WithContext(ctx).Select("is_public").
+		Where("normalized_name = ? AND registry = ?", utils.NormalizePackageName(name, registryType), registryType).
+		Find(&versions).Error; err != nil {
+		return false, fmt.Errorf("failed to get package versions: %w", err)
+	}
+	if len(versions) == 0 {
+		return false, fmt.Errorf("%w: %s", ErrPackageNotFound, name)
+	}
+
+	for _, version := range versions {
+		if version.IsPublic {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SetPackageVisibility makes every version of a package public or
+// restricted. Versions published later follow the package's visibility, as
+// ResolveVisibility returns it. Only owners of the package and administrators
+// may change it.
+func (s *Service) SetPackageVisibility(ctx context.Context, registryType, name string, public bool, userID uuid.UUID) error {
+	canManage, err := s.Ownership.CanUserManageOwnership(ctx, registryType, name, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check visibility permissions: %w", err)
+	}
+	if !canManage {
+		return ErrVisibilityForbidden
+	}
+
+	result := s.DB.WithContext(ctx).Model(&types.Artifact{}).
+		Where("normalized_name = ? AND registry = ?", utils.NormalizePackageName(name, registryType), registryType).
+		Update("is_public", public)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update package visibility: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrPackageNotFound, name)
+	}
+
+	s.auditLog.Record(ctx, userID, audit.ActionPackageVisibility, generatePackageKey(registryType, name), map[string]interface{}{
+		"public": public,
+	})
+	return nil
+}
+
+// GetCollaborators returns the access level of every user holding a role on
+// a package, keyed by username. Owners and maintainers can publish, so they
+// hold read-write access; contributors hold read-only access. Only owners and
+// maintainers of the package and administrators may ask.
+func (s *Service) GetCollaborators(ctx context.Context, registryType, name string, userID uuid.UUID) (map[string]string, error) {
+	if err := s.checkCanViewAccess(ctx, registryType, name, userID); err != nil {
+		return nil, err
+	}
+
+	var ownerships []types.PackageOwnership
+	if err := s.DB.WithContext(ctx).Preload("User").
+		Where("package_key = ?", generatePackageKey(registryType, name)).
+		Find(&ownerships).Error; err != nil {
+		return nil, fmt.Errorf("failed to get package collaborators: %w", err)
+	}
+	if len(ownerships) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrPackageNotFound, name)
+	}
+
+	collaborators := make(map[string]string, len(ownerships))
+	for _, ownership := range ownerships {
+		level := AccessReadWrite
+		if ownership.Role == RoleContributor {
+			level = AccessReadOnly
+		}
+		collaborators[ownership.User.Username] = level
+	}
+	return collaborators, nil
+}
+
+// checkCanViewAccess returns ErrAccessForbidden unless the user may see who
+// has access to a package and whether it is public
+func (s *Service) checkCanViewAccess(ctx context.Context, registryType, name string, userID uuid.UUID) error {
+	canMaintain, err := s.Ownership.CanUserMaintain(ctx, registryType, name, userID)
+	if err != nil {
+		return fmt.Errorf("failed to check access permissions: %w", err)
+	}
+	if !canMaintain {
+		return ErrAccessForbidden
+	}
+	return nil
+}
+
+// GrantPackageAccess gives a user read-only or read-write access to a
+// package, as a contributor or maintainer. Owners keep their role. Only
+// owners of the package and administrators may grant access.
+func (s *Service) GrantPackageAccess(ctx context.Context, registryType, name, username, level string, userID uuid.UUID) error {
+	role, ok := accessLevelRoles[level]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidAccessLevel, level)
+	}
+	target, err := s.collaborator(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	var existing types.PackageOwnership
+	err = s.DB.WithContext(ctx).Where("package_key = ? AND user_id = ? AND role = ?",
+		generatePackageKey(registryType, name), target.ID, RoleOwner).First(&existing).Error
+	switch {
+	case err == nil:
+		// Owners already have read-write access, and are not demoted by a grant
+		canManage, err := s.Ownership.CanUserManageOwnership(ctx, registryType, name, userID)
+		if err != nil {
+			return fmt.Errorf("failed to check management permissions: %w", err)
+		}
+		if !canManage {
+			return ErrOwnershipForbidden
+		}
+		return nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return fmt.Errorf("failed to get ownership: %w", err)
+	}
+
+	return s.AddPackageOwner(ctx, registryType, name, userID, target.ID, role)
+}
+
+// RevokePackageAccess removes a user's access to a package. Only owners of
+// the package and administrators may revoke access.
+func (s *Service) RevokePackageAccess(ctx context.Context, registryType, name, username string, userID uuid.UUID) error {
+	target, err := s.collaborator(ctx, username)
+	if err != nil {
+		return err
+	}
+	return s.RemovePackageOwner(ctx, registryType, name, userID, target.ID)
+}
+
+// collaborator returns the user access is granted to or revoked from
+func (s *Service) collaborator(ctx context.Context, username string) (*types.User, error) {
+	var user types.User
+	if err := s.DB.WithContext(ctx).Where("username = ?", username).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrCollaboratorNotFound, username)
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return &user, nil
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPackageVisibility(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	ctx := context.Background()
+	owner := createTestUser(t, db)
+	auditLog := audit.NewService(db.DB)
+	service.SetAuditLog(auditLog)
+	require.NoError(t, service.Ownership.EstablishInitialOwnership(ctx, "npm", "payments-client", owner.ID))
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		require.NoError(t, db.Create(&types.Artifact{
+			Name: "payments-client", Version: version, Registry: "npm", StoragePath: "npm/payments-client/" + version, PublishedBy: owner.ID,
+		}).Error)
+	}
+
+	public, err := service.GetPackageVisibility(ctx, "npm", "payments-client", owner.ID)
+	require.NoError(t, err)
+	assert.False(t, public)
+
+	require.NoError(t, service.SetPackageVisibility(ctx, "npm", "payments-client", true, owner.ID))
+	var restricted int64
+	require.NoError(t, db.Model(&types.Artifact{}).Where("name = ? AND is_public = ?", "payments-client", false).Count(&restricted).Error)
+	assert.Zero(t, restricted, "every version is public")
+
+	isPublic, err := service.ResolveVisibility(ctx, "npm", "payments-client")
+	require.NoError(t, err)
+	assert.True(t, isPublic, "new versions follow the package")
+
+	other := createTestUserWithAdmin(t, db, false)
+	assert.ErrorIs(t, service.SetPackageVisibility(ctx, "npm", "payments-client", false, other.ID), ErrVisibilityForbidden)
+	_, err = service.GetPackageVisibility(ctx, "npm", "payments-client", other.ID)
+	assert.ErrorIs(t, err, ErrAccessForbidden)
+
+	admin := createTestUserWithAdmin(t, db, true)
+	require.NoError(t, service.SetPackageVisibility(ctx, "npm", "payments-client", false, admin.ID))
+	assert.ErrorIs(t, service.SetPackageVisibility(ctx, "npm", "missing", true, admin.ID), ErrPackageNotFound)
+
+	entries, _, err := auditLog.Query(ctx, audit.Filter{Action: audit.ActionPackageVisibility})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "npm:payments-client", entries[0].Target)
+}
+
+func TestGrantPackageAccess(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	ctx := context.Background()
+	owner := createTestUser(t, db)
+	collaborator := createTestUserWithAdmin(t, db, false)
+	require.NoError(t, service.Ownership.EstablishInitialOwnership(ctx, "npm", "payments-client", owner.ID))
+
+	require.NoError(t, service.GrantPackageAccess(ctx, "npm", "payments-client", collaborator.Username, AccessReadOnly, owner.ID))
+	canPublish, err := service.Ownership.CanUserPublish(ctx, "npm", "payments-client", collaborator.ID)
+	require.NoError(t, err)
+	assert.False(t, canPublish)
+
+	require.NoError(t, service.GrantPackageAccess(ctx, "npm", "payments-client", collaborator.Username, AccessReadWrite, owner.ID))
+	canPublish, err = service.Ownership.CanUserPublish(ctx, "npm", "payments-client", collaborator.ID)
+	require.NoError(t, err)
+	assert.True(t, canPublish)
+
+	collaborators, err := service.GetCollaborators(ctx, "npm", "payments-client", collaborator.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{owner.Username: AccessReadWrite, collaborator.Username: AccessReadWrite}, collaborators)
+
+	// Collaborators cannot grant access themselves
+	assert.ErrorIs(t, service.GrantPackageAccess(ctx, "npm", "payments-client", owner.Username, AccessReadOnly, collaborator.ID), ErrOwnershipForbidden)
+	assert.ErrorIs(t, service.GrantPackageAccess(ctx, "npm", "payments-client", collaborator.Username, "admin", owner.ID), ErrInvalidAccessLevel)
+	assert.ErrorIs(t, service.GrantPackageAccess(ctx, "npm", "payments-client", "nobody", AccessReadOnly, owner.ID), ErrCollaboratorNotFound)
+
+	require.NoError(t, service.RevokePackageAccess(ctx, "npm", "payments-client", collaborator.Username, owner.ID))
+	collaborators, err = service.GetCollaborators(ctx, "npm", "payments-client", owner.ID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{owner.Username: AccessReadWrite}, collaborators)
+
+	// Only owners and maintainers see who has access
+	_, err = service.GetCollaborators(ctx, "npm", "payments-client", collaborator.ID)
+	assert.ErrorIs(t, err, ErrAccessForbidden)
+}
+
+func TestRestrictedPackageReads(t *testing.T) {
+	service, db, mockStorage := setupTestService(t)
+	ctx := context.Background()
+	owner := createTestUserWithAdmin(t, db, false)
+	reader := createTestUserWithAdmin(t, db, false)
+	member := createTestUserWithAdmin(t, db, false)
+	outsider := createTestUserWithAdmin(t, db, false)
+	admin := createTestUserWithAdmin(t, db, true)
+
+	_, err := service.CreateOrganization(ctx, "acme", false, owner.ID)
+	require.NoError(t, err)
+	require.NoError(t, service.SetOrganizationMember(ctx, "acme", member.Username, RoleContributor, owner.ID))
+	for _, artifact := range []*types.Artifact{
+		{Name: "payments-client", Version: "1.0.0", Registry: "npm", StoragePath: "npm/payments-client/1.0.0", PublishedBy: owner.ID, Status: types.ArtifactStatusPublished},
+		{Name: "@acme/billing", Version: "1.0.0", Registry: "npm", StoragePath: "npm/@acme/billing/1.0.0", PublishedBy: owner.ID, Status: types.ArtifactStatusPublished},
+		{Name: "left-pad", Version: "1.0.0", Registry: "npm", StoragePath: "npm/left-pad/1.0.0", PublishedBy: owner.ID, Status: types.ArtifactStatusPublished, IsPublic: true},
+	} {
+		require.NoError(t, db.Create(artifact).Error)
+	}
+	require.NoError(t, service.Ownership.EstablishInitialOwnership(ctx, "npm", "payments-client", owner.ID))
+	require.NoError(t, service.GrantPackageAccess(ctx, "npm", "payments-client", reader.Username, AccessReadOnly, owner.ID))
+	mockStorage.On("Retrieve", mock.Anything, mock.Anything).Return(io.NopCloser(strings.NewReader("content")), nil)
+
+	as := func(user *types.User) context.Context {
+		return WithReader(ctx, func() *types.User { return user })
+	}
+	readable := func(user *types.User) []string {
+		artifacts, _, err := service.List(as(user), &types.ArtifactFilter{Registry: "npm"})
+		require.NoError(t, err)
+		names := make([]string, 0, len(artifacts))
+		for _, artifact := range artifacts {
+			names = append(names, artifact.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"@acme/billing", "left-pad", "payments-client"}, readable(owner))
+	assert.Equal(t, []string{"left-pad", "payments-client"}, readable(reader))
+	assert.Equal(t, []string{"@acme/billing", "left-pad"}, readable(member))
+	assert.Equal(t, []string{"left-pad"}, readable(outsider))
+	assert.Equal(t, []string{"left-pad"}, readable(nil))
+	assert.Equal(t, []string{"@acme/billing", "left-pad", "payments-client"}, readable(admin))
+
+	for _, user := range []*types.User{owner, reader, admin} {
+		_, content, err := service.Download(as(user), "npm", "payments-client", "1.0.0")
+		require.NoError(t, err, user.Username)
+		content.Close()
+	}
+	_, content, err := service.Download(as(member), "npm", "@acme/billing", "1.0.0")
+	require.NoError(t, err)
+	content.Close()
+
+	// Restricted packages are hidden from everyone else
+	for _, user := range []*types.User{member, outsider, nil} {
+		_, _, err := service.Download(as(user), "npm", "payments-client", "1.0.0")
+		assert.ErrorIs(t, err, ErrArtifactNotFound)
+	}
+	_, content, err = service.Download(as(outsider), "npm", "left-pad", "1.0.0")
+	require.NoError(t, err)
+	content.Close()
+
+	// Requests without a reader, such as background jobs, are not limited
+	_, content, err = service.Download(ctx, "npm", "payments-client", "1.0.0")
+	require.NoError(t, err)
+	content.Close()
+
+	// Access granted under another casing of the name is the same access
+	require.NoError(t, db.Create(&types.Artifact{Name: "Ledger", Version: "1.0.0", Registry: "nuget", StoragePath: "nuget/ledger/1.0.0", PublishedBy: owner.ID, Status: types.ArtifactStatusPublished}).Error)
+	require.NoError(t, service.Ownership.EstablishInitialOwnership(ctx, "nuget", "Ledger", owner.ID))
+	require.NoError(t, service.GrantPackageAccess(ctx, "nuget", "LEDGER", reader.Username, AccessReadOnly, owner.ID))
+	artifacts, _, err := service.List(as(reader), &types.ArtifactFilter{Registry: "nuget"})
+	require.NoError(t, err)
+	require.Len(t, artifacts, 1)
+	assert.Equal(t, "Ledger", artifacts[0].Name)
+	readableLedger, err := service.CanReadPackage(as(reader), "nuget", "ledger")
+	require.NoError(t, err)
+	assert.True(t, readableLedger)
+
+	access, err := service.GetArtifactAccess(ctx, "npm", "payments-client")
+	require.NoError(t, err)
+	assert.False(t, access.AuthenticatedDownload)
+	assert.True(t, accessFor(access, reader.Username).Download)
+}
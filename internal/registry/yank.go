@@ -0,0 +1,80 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// ErrYankForbidden is returned when a user who does not own a package tries
+// to yank or unyank one of its versions
+var ErrYankForbidden = errors.New("only package owners can yank versions")
+
+// yankedMetadataKey is the artifact metadata field marking a version yanked
+const yankedMetadataKey = "yanked"
+
+// IsYanked reports whether a version has been yanked
+func IsYanked(artifact *types.Artifact) bool {
+	yanked, _ := artifact.Metadata[yankedMetadataKey].(bool)
+	return yanked
+}
+
+// Yank marks a version of a package yanked, or no longer yanked. Yanked
+// versions are not resolved as the latest version or as a dependency but stay
+// downloadable by exact version, so builds that locked them keep working.
+// Only owners of the package can yank its versions.
+func (s *Service) Yank(ctx context.Context, registryType, name, version string, yanked bool, userID uuid.UUID) (*types.Artifact, error) {
+	var artifact types.Artifact
+	if err := s.DB.WithContext(ctx).
+		Where("LOWER(name) = LOWER(?) AND version = ? AND registry = ?", name, version, registryType).
+		First(&artifact).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s:%s", ErrArtifactNotFound, name, version)
+		}
+		return nil, fmt.Errorf("failed to get artifact: %w", err)
+	}
+
+	canYank, err := s.Ownership.CanUserDelete(ctx, registryType, artifact.Name, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check yank permissions: %w", err)
+	}
+	if !canYank {
+		return nil, ErrYankForbidden
+	}
+
+	if IsYanked(&artifact) == yanked {
+		return &artifact, nil
+	}
+	if artifact.Metadata == nil {
+		artifact.Metadata = make(types.JSONMap)
+	}
+	if yanked {
+		artifact.Metadata[yankedMetadataKey] = true
+	} else {
+		delete(artifact.Metadata, yankedMetadataKey)
+	}
+	if err := s.DB.WithContext(ctx).Model(&artifact).Update("metadata", artifact.Metadata).Error; err != nil {
+		return nil, fmt.Errorf("failed to update artifact metadata: %w", err)
+	}
+
+	action := audit.ActionPackageYank
+	if !yanked {
+		action = audit.ActionPackageUnyank
+	}
+	s.auditLog.Record(ctx, userID, action, audit.PackageTarget(registryType, artifact.Name, artifact.Version), nil)
+
+	log.Info().
+		Str("registry", registryType).
+		Str("name", artifact.Name).
+		Str("version", artifact.Version).
+		Bool("yanked", yanked).
+		Str("user_id", userID.String()).
+		Msg("Package version yank updated")
+	return &artifact, nil
+}
@@ -0,0 +1,227 @@
+// Package retention removes old package versions according to per-registry
+// retention policies
+package retention
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lgulliver/lodestone/internal/registry/registries/maven"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/lgulliver/lodestone/pkg/utils"
+)
+
+// Candidate is an artifact a policy would remove, and why
+type Candidate struct {
+	Registry string `json:"registry"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Size     int64  `json:"size"`
+	Reason   string `json:"reason"`
+}
+
+// Evaluate returns the artifacts that policy removes from the given set, as
+// of now. Versions are grouped into packages by name; only published
+// versions are considered, and content-addressed OCI blobs are never
+// removed since manifests refer to them.
+func Evaluate(policy *types.RetentionPolicy, artifacts []*types.Artifact, now time.Time) []Candidate {
+	packages := make(map[string][]*types.Artifact)
+	var names []string
+	for _, artifact := range artifacts {
+		if artifact.Status != "" && artifact.Status != types.ArtifactStatusPublished {
+			continue
+		}
+		if strings.HasPrefix(artifact.Version, "sha256:") {
+			continue
+		}
+		key := strings.ToLower(artifact.Name)
+		if _, seen := packages[key]; !seen {
+			names = append(names, key)
+		}
+		packages[key] = append(packages[key], artifact)
+	}
+	sort.Strings(names)
+
+	var candidates []Candidate
+	for _, name := range names {
+		candidates = append(candidates, evaluatePackage(policy, packages[name], now)...)
+	}
+	return candidates
+}
+
+// evaluatePackage applies a policy to the versions of a single package. When
+// the policy limits Maven snapshot builds, timestamped builds are only
+// subject to that limit, so CI builds do not push releases out of the
+// newest versions kept.
+func evaluatePackage(policy *types.RetentionPolicy, versions []*types.Artifact, now time.Time) []Candidate {
+	var builds []*types.Artifact
+	if policy.KeepSnapshotBuilds > 0 {
+		versions, builds = splitSnapshotBuilds(versions)
+	}
+	ordered := orderLatestFirst(versions)
+
+	var latest *types.Artifact
+	if policy.KeepLatest {
+		latest = taggedLatest(ordered)
+	}
+
+	var prereleaseCutoff time.Time
+	if policy.PrereleaseMaxAgeDays > 0 {
+		prereleaseCutoff = now.AddDate(0, 0, -policy.PrereleaseMaxAgeDays)
+	}
+
+	var candidates []Candidate
+	for i, artifact := range ordered {
+		if artifact == latest {
+			continue
+		}
+
+		var reason string
+		switch {
+		case !prereleaseCutoff.IsZero() && utils.IsPrerelease(artifact.Version) && artifact.CreatedAt.Before(prereleaseCutoff):
+			reason = fmt.Sprintf("prerelease older than %d days", policy.PrereleaseMaxAgeDays)
+		case policy.KeepLastVersions > 0 && i >= policy.KeepLastVersions:
+			reason = fmt.Sprintf("not among the newest %d versions", policy.KeepLastVersions)
+		default:
+			continue
+		}
+
+		candidates = append(candidates, Candidate{
+			Registry: artifact.Registry,
+			Name:     artifact.Name,
+			Version:  artifact.Version,
+			Size:     artifact.Size,
+			Reason:   reason,
+		})
+	}
+	return append(candidates, evaluateSnapshotBuilds(policy, builds)...)
+}
+
+// splitSnapshotBuilds separates the timestamped Maven snapshot builds of a
+// package from its other versions
+func splitSnapshotBuilds(versions []*types.Artifact) ([]*types.Artifact, []*types.Artifact) {
+	var others, builds []*types.Artifact
+	for _, artifact := range versions {
+		if artifact.Registry == "maven" && maven.IsSnapshotBuild(artifact.Version) {
+			builds = append(builds, artifact)
+		} else {
+			others = append(others, artifact)
+		}
+	}
+	return others, builds
+}
+
+// evaluateSnapshotBuilds keeps the newest builds of each -SNAPSHOT version,
+// by build number, so the -SNAPSHOT version still resolves to its newest
+// build. Checksums are computed from stored builds, so they go with them.
+func evaluateSnapshotBuilds(policy *types.RetentionPolicy, builds []*types.Artifact) []Candidate {
+	bySnapshot := make(map[string][]*types.Artifact)
+	var snapshots []string
+	for _, artifact := range builds {
+		snapshot := maven.SnapshotBaseVersion(artifact.Version)
+		if _, seen := bySnapshot[snapshot]; !seen {
+			snapshots = append(snapshots, snapshot)
+		}
+		bySnapshot[snapshot] = append(bySnapshot[snapshot], artifact)
+	}
+	sort.Strings(snapshots)
+
+	var candidates []Candidate
+	for _, snapshot := range snapshots {
+		ordered := bySnapshot[snapshot]
+		sort.SliceStable(ordered, func(i, j int) bool {
+			bi, bj := maven.SnapshotBuildNumber(ordered[i].Version), maven.SnapshotBuildNumber(ordered[j].Version)
+			if bi != bj {
+				return bi > bj
+			}
+			return ordered[i].CreatedAt.After(ordered[j].CreatedAt)
+		})
+		for _, artifact := range ordered[min(policy.KeepSnapshotBuilds, len(ordered)):] {
+			candidates = append(candidates, Candidate{
+				Registry: artifact.Registry,
+				Name:     artifact.Name,
+				Version:  artifact.Version,
+				Size:     artifact.Size,
+				Reason:   fmt.Sprintf("not among the newest %d builds of %s", policy.KeepSnapshotBuilds, snapshot),
+			})
+		}
+	}
+	return candidates
+}
+
+// orderLatestFirst orders the versions of a package by version, latest
+// first, with versions that are not semver after them by publish date
+func orderLatestFirst(versions []*types.Artifact) []*types.Artifact {
+	byDate := append([]*types.Artifact(nil), versions...)
+	sort.SliceStable(byDate, func(i, j int) bool {
+		return byDate[i].CreatedAt.After(byDate[j].CreatedAt)
+	})
+
+	strs := make([]string, 0, len(byDate))
+	byVersion := make(map[string]*types.Artifact, len(byDate))
+	for _, artifact := range byDate {
+		strs = append(strs, artifact.Version)
+		byVersion[artifact.Version] = artifact
+	}
+
+	// An empty constraint keeps versions that are not semver at the end
+	sorted, err := utils.FilterVersions(strs, "", true)
+	if err != nil {
+		return byDate
+	}
+	ordered := make([]*types.Artifact, 0, len(sorted))
+	for _, version := range sorted {
+		ordered = append(ordered, byVersion[version])
+	}
+	return ordered
+}
+
+// taggedLatest returns the version a package's "latest" tag points to: a
+// version named latest, the target of the npm dist-tag recorded by the most
+// recent publish, or otherwise the newest release
+func taggedLatest(ordered []*types.Artifact) *types.Artifact {
+	var newest *types.Artifact
+	for _, artifact := range ordered {
+		if artifact.Version == "latest" {
+			return artifact
+		}
+		if newest == nil || artifact.CreatedAt.After(newest.CreatedAt) {
+			newest = artifact
+		}
+	}
+
+	if newest != nil {
+		if target := distTagLatest(newest); target != "" {
+			for _, artifact := range ordered {
+				if artifact.Version == target {
+					return artifact
+				}
+			}
+		}
+	}
+
+	for _, artifact := range ordered {
+		if !utils.IsPrerelease(artifact.Version) {
+			return artifact
+		}
+	}
+	if len(ordered) > 0 {
+		return ordered[0]
+	}
+	return nil
+}
+
+// distTagLatest reads the "latest" dist-tag from artifact metadata, which
+// holds a map[string]string before storage and a map[string]interface{} after
+func distTagLatest(artifact *types.Artifact) string {
+	switch tags := artifact.Metadata["dist-tags"].(type) {
+	case map[string]string:
+		return tags["latest"]
+	case map[string]interface{}:
+		latest, _ := tags["latest"].(string)
+		return latest
+	}
+	return ""
+}
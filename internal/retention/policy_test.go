@@ -0,0 +1,156 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func artifact(name, version string, age time.Duration) *types.Artifact {
+	return &types.Artifact{
+		Name:      name,
+		Version:   version,
+		Registry:  "npm",
+		Status:    types.ArtifactStatusPublished,
+		CreatedAt: now.Add(-age),
+	}
+}
+
+func versions(candidates []Candidate) []string {
+	result := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		result = append(result, candidate.Name+"@"+candidate.Version)
+	}
+	return result
+}
+
+func TestEvaluate_KeepLastVersions(t *testing.T) {
+	day := 24 * time.Hour
+	artifacts := []*types.Artifact{
+		artifact("left-pad", "1.0.0", 40*day),
+		artifact("left-pad", "1.2.0", 20*day),
+		artifact("left-pad", "1.1.0", 30*day),
+		artifact("left-pad", "1.10.0", 10*day),
+		artifact("right-pad", "0.1.0", 5*day),
+	}
+
+	policy := &types.RetentionPolicy{KeepLastVersions: 2, KeepLatest: true}
+	candidates := Evaluate(policy, artifacts, now)
+
+	// Versions are ordered by semver, not by name or publish date
+	assert.Equal(t, []string{"left-pad@1.1.0", "left-pad@1.0.0"}, versions(candidates))
+	assert.Equal(t, "not among the newest 2 versions", candidates[0].Reason)
+}
+
+func TestEvaluate_PrereleaseMaxAge(t *testing.T) {
+	day := 24 * time.Hour
+	artifacts := []*types.Artifact{
+		artifact("app", "1.0.0", 100*day),
+		artifact("app", "2.0.0-beta.1", 60*day),
+		artifact("app", "2.0.0-beta.2", 10*day),
+		artifact("app", "1.0.1-rc.1", 90*day),
+	}
+
+	policy := &types.RetentionPolicy{PrereleaseMaxAgeDays: 30, KeepLatest: true}
+	candidates := Evaluate(policy, artifacts, now)
+
+	assert.Equal(t, []string{"app@2.0.0-beta.1", "app@1.0.1-rc.1"}, versions(candidates))
+	assert.Equal(t, "prerelease older than 30 days", candidates[0].Reason)
+}
+
+func TestEvaluate_KeepLatest(t *testing.T) {
+	day := 24 * time.Hour
+
+	t.Run("newest release survives keep-last", func(t *testing.T) {
+		artifacts := []*types.Artifact{
+			artifact("app", "1.0.0", 30*day),
+			artifact("app", "2.0.0-rc.1", 2*day),
+			artifact("app", "2.0.0-rc.2", 1*day),
+		}
+
+		policy := &types.RetentionPolicy{KeepLastVersions: 1, KeepLatest: true}
+		assert.Equal(t, []string{"app@2.0.0-rc.1"}, versions(Evaluate(policy, artifacts, now)))
+
+		policy.KeepLatest = false
+		assert.Equal(t, []string{"app@2.0.0-rc.1", "app@1.0.0"}, versions(Evaluate(policy, artifacts, now)))
+	})
+
+	t.Run("npm dist-tag is followed", func(t *testing.T) {
+		maintenance := artifact("app", "1.5.0", 1*day)
+		maintenance.Metadata = types.JSONMap{"dist-tags": map[string]interface{}{"latest": "1.5.0"}}
+		artifacts := []*types.Artifact{
+			artifact("app", "2.0.0", 5*day),
+			artifact("app", "2.1.0", 3*day),
+			maintenance,
+		}
+
+		policy := &types.RetentionPolicy{KeepLastVersions: 1, KeepLatest: true}
+		assert.Equal(t, []string{"app@2.0.0"}, versions(Evaluate(policy, artifacts, now)))
+	})
+
+	t.Run("version named latest is kept", func(t *testing.T) {
+		artifacts := []*types.Artifact{
+			artifact("image", "latest", 9*day),
+			artifact("image", "v2", 1*day),
+			artifact("image", "v1", 5*day),
+		}
+
+		policy := &types.RetentionPolicy{KeepLastVersions: 1, KeepLatest: true}
+		assert.Equal(t, []string{"image@v1"}, versions(Evaluate(policy, artifacts, now)))
+	})
+}
+
+func TestEvaluate_KeepSnapshotBuilds(t *testing.T) {
+	maven := func(version string, age time.Duration) *types.Artifact {
+		a := artifact("com.example:app", version, age)
+		a.Registry = "maven"
+		return a
+	}
+	artifacts := []*types.Artifact{
+		maven("1.0", 50*time.Hour),
+		maven("1.1", 40*time.Hour),
+		maven("2.0-20240301.150000-1", 30*time.Hour),
+		maven("2.0-20240302.090000-2", 20*time.Hour),
+		maven("2.0-20240303.090000-10", 10*time.Hour), // ordered by build number, not as a string
+		maven("2.0-20240302.120000-3", 15*time.Hour),
+		maven("3.0-20240304.090000-1", 5*time.Hour),
+	}
+
+	policy := &types.RetentionPolicy{KeepLastVersions: 1, KeepSnapshotBuilds: 2}
+	candidates := Evaluate(policy, artifacts, now)
+
+	// Builds do not count as versions, so the newest release is kept
+	assert.Equal(t, []string{
+		"com.example:app@1.0",
+		"com.example:app@2.0-20240302.090000-2",
+		"com.example:app@2.0-20240301.150000-1",
+	}, versions(candidates))
+	assert.Equal(t, "not among the newest 2 builds of 2.0-SNAPSHOT", candidates[1].Reason)
+
+	// Without a snapshot limit, builds count as versions as before
+	policy.KeepSnapshotBuilds = 0
+	assert.Len(t, Evaluate(policy, artifacts, now), 6)
+}
+
+func TestEvaluate_SkipsUnpublishedAndBlobs(t *testing.T) {
+	pending := artifact("app", "0.9.0", time.Hour)
+	pending.Status = types.ArtifactStatusPendingApproval
+	artifacts := []*types.Artifact{
+		artifact("app", "1.0.0", 3*time.Hour),
+		artifact("app", "1.1.0", 2*time.Hour),
+		artifact("app", "sha256:abc", time.Hour),
+		pending,
+	}
+
+	policy := &types.RetentionPolicy{KeepLastVersions: 1}
+	assert.Equal(t, []string{"app@1.0.0"}, versions(Evaluate(policy, artifacts, now)))
+}
+
+func TestEvaluate_NoLimits(t *testing.T) {
+	artifacts := []*types.Artifact{artifact("app", "1.0.0", time.Hour), artifact("app", "1.1.0-rc.1", 1000*time.Hour)}
+	assert.Empty(t, Evaluate(&types.RetentionPolicy{}, artifacts, now))
+}
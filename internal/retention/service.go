@@ -0,0 +1,179 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// ErrPolicyNotFound is returned when a registry has no retention policy
+var ErrPolicyNotFound = errors.New("retention policy not found")
+
+// ArtifactDeleter removes an artifact on behalf of a user, checking that the
+// user may delete it. It is implemented by registry.Service.
+type ArtifactDeleter interface {
+	Delete(ctx context.Context, registryType, name, version string, userID uuid.UUID) error
+}
+
+// Service stores retention policies and applies them
+type Service struct {
+	db       *gorm.DB
+	deleter  ArtifactDeleter
+	auditLog *audit.Service
+	now      func() time.Time
+}
+
+// NewService creates a retention service that removes artifacts through deleter
+func NewService(db *gorm.DB, deleter ArtifactDeleter) *Service {
+	return &Service{
+		db:      db,
+		deleter: deleter,
+		now:     time.Now,
+	}
+}
+
+// SetAuditLog sets the audit trail policy changes are recorded to
+func (s *Service) SetAuditLog(auditLog *audit.Service) {
+	s.auditLog = auditLog
+}
+
+// GetPolicies returns the retention policies of every registry that has one
+func (s *Service) GetPolicies(ctx context.Context) ([]types.RetentionPolicy, error) {
+	var policies []types.RetentionPolicy
+	if err := s.db.WithContext(ctx).Order("registry_name").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to get retention policies: %w", err)
+	}
+	return policies, nil
+}
+
+// GetPolicy returns the retention policy of a registry
+func (s *Service) GetPolicy(ctx context.Context, registryName string) (*types.RetentionPolicy, error) {
+	var policy types.RetentionPolicy
+	if err := s.db.WithContext(ctx).Where("registry_name = ?", registryName).First(&policy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPolicyNotFound
+		}
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// SetPolicy creates or replaces the retention policy of a registry. The user
+// setting it becomes the actor whose permissions the policy is applied with.
+func (s *Service) SetPolicy(ctx context.Context, policy *types.RetentionPolicy, updatedBy uuid.UUID) error {
+	if policy.KeepLastVersions < 0 || policy.PrereleaseMaxAgeDays < 0 || policy.KeepSnapshotBuilds < 0 {
+		return fmt.Errorf("retention limits cannot be negative")
+	}
+
+	existing, err := s.GetPolicy(ctx, policy.RegistryName)
+	switch {
+	case err == nil:
+		policy.ID = existing.ID
+		policy.CreatedAt = existing.CreatedAt
+	case !errors.Is(err, ErrPolicyNotFound):
+		return err
+	}
+	policy.UpdatedBy = &updatedBy
+
+	if err := s.db.WithContext(ctx).Save(policy).Error; err != nil {
+		return fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	s.auditLog.Record(ctx, updatedBy, audit.ActionRetentionSet, policy.RegistryName, map[string]interface{}{
+		"enabled":                 policy.Enabled,
+		"keep_last_versions":      policy.KeepLastVersions,
+		"prerelease_max_age_days": policy.PrereleaseMaxAgeDays,
+		"keep_latest":             policy.KeepLatest,
+		"keep_snapshot_builds":    policy.KeepSnapshotBuilds,
+	})
+
+	log.Info().
+		Str("registry", policy.RegistryName).
+		Bool("enabled", policy.Enabled).
+		Int("keep_last_versions", policy.KeepLastVersions).
+		Int("prerelease_max_age_days", policy.PrereleaseMaxAgeDays).
+		Bool("keep_latest", policy.KeepLatest).
+		Int("keep_snapshot_builds", policy.KeepSnapshotBuilds).
+		Str("updated_by", updatedBy.String()).
+		Msg("Retention policy updated")
+	return nil
+}
+
+// DryRun returns the artifacts policy would remove from its registry now,
+// without removing anything. The policy need not be saved or enabled.
+func (s *Service) DryRun(ctx context.Context, policy *types.RetentionPolicy) ([]Candidate, error) {
+	var artifacts []*types.Artifact
+	if err := s.db.WithContext(ctx).
+		Where("registry = ? AND status = ?", policy.RegistryName, types.ArtifactStatusPublished).
+		Find(&artifacts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get artifacts: %w", err)
+	}
+
+	candidates := Evaluate(policy, artifacts, s.now())
+	if candidates == nil {
+		candidates = []Candidate{}
+	}
+	return candidates, nil
+}
+
+// Apply removes the artifacts the registry's saved policy selects, acting as
+// the user who last set the policy so package ownership is enforced. It
+// returns how many artifacts were removed; artifacts that fail to delete are
+// logged and skipped.
+func (s *Service) Apply(ctx context.Context, policy *types.RetentionPolicy) (int, error) {
+	if policy.UpdatedBy == nil {
+		return 0, fmt.Errorf("retention policy for %s has no user to apply it as", policy.RegistryName)
+	}
+
+	candidates, err := s.DryRun(ctx, policy)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, candidate := range candidates {
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+		if err := s.deleter.Delete(ctx, candidate.Registry, candidate.Name, candidate.Version, *policy.UpdatedBy); err != nil {
+			log.Warn().Err(err).
+				Str("registry", candidate.Registry).
+				Str("name", candidate.Name).
+				Str("version", candidate.Version).
+				Msg("Failed to remove artifact under retention policy")
+			continue
+		}
+		removed++
+		log.Info().
+			Str("registry", candidate.Registry).
+			Str("name", candidate.Name).
+			Str("version", candidate.Version).
+			Str("reason", candidate.Reason).
+			Msg("Removed artifact under retention policy")
+	}
+	return removed, nil
+}
+
+// ApplyAll applies every enabled retention policy
+func (s *Service) ApplyAll(ctx context.Context) error {
+	var policies []types.RetentionPolicy
+	if err := s.db.WithContext(ctx).Where("enabled = ?", true).Find(&policies).Error; err != nil {
+		return fmt.Errorf("failed to get retention policies: %w", err)
+	}
+
+	for i := range policies {
+		removed, err := s.Apply(ctx, &policies[i])
+		if err != nil {
+			log.Error().Err(err).Str("registry", policies[i].RegistryName).Msg("Failed to apply retention policy")
+			continue
+		}
+		log.Info().Str("registry", policies[i].RegistryName).Int("removed", removed).Msg("Applied retention policy")
+	}
+	return nil
+}
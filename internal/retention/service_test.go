@@ -0,0 +1,131 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeDeleter records deletions and refuses those in denied
+type fakeDeleter struct {
+	deleted []string
+	denied  map[string]bool
+	userIDs []uuid.UUID
+}
+
+func (d *fakeDeleter) Delete(ctx context.Context, registryType, name, version string, userID uuid.UUID) error {
+	key := name + "@" + version
+	if d.denied[key] {
+		return errors.New("insufficient permissions to delete artifact")
+	}
+	d.deleted = append(d.deleted, key)
+	d.userIDs = append(d.userIDs, userID)
+	return nil
+}
+
+func setupTestService(t *testing.T) (*Service, *gorm.DB, *fakeDeleter) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.BlobRef{}, &types.RetentionPolicy{}, &types.AuditEntry{}))
+
+	deleter := &fakeDeleter{denied: map[string]bool{}}
+	service := NewService(db, deleter)
+	service.now = func() time.Time { return now }
+	return service, db, deleter
+}
+
+func createArtifacts(t *testing.T, db *gorm.DB, registry, name string, versions ...string) {
+	t.Helper()
+	for i, version := range versions {
+		require.NoError(t, db.Create(&types.Artifact{
+			Name:        name,
+			Version:     version,
+			Registry:    registry,
+			StoragePath: registry + "/" + name + "/" + version,
+			PublishedBy: uuid.New(),
+			Status:      types.ArtifactStatusPublished,
+			CreatedAt:   now.Add(time.Duration(i-len(versions)) * time.Hour),
+		}).Error)
+	}
+}
+
+func TestSetPolicy_CreatesAndReplaces(t *testing.T) {
+	service, db, _ := setupTestService(t)
+	auditLog := audit.NewService(db)
+	service.SetAuditLog(auditLog)
+	ctx := context.Background()
+	admin := uuid.New()
+
+	require.NoError(t, service.SetPolicy(ctx, &types.RetentionPolicy{RegistryName: "npm", KeepLastVersions: 5, KeepLatest: true}, admin))
+	require.NoError(t, service.SetPolicy(ctx, &types.RetentionPolicy{RegistryName: "npm", KeepLastVersions: 3, KeepLatest: false}, admin))
+
+	policies, err := service.GetPolicies(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 1)
+	assert.Equal(t, 3, policies[0].KeepLastVersions)
+	assert.False(t, policies[0].KeepLatest)
+	assert.Equal(t, admin, *policies[0].UpdatedBy)
+
+	_, audited, err := auditLog.Query(ctx, audit.Filter{ActorID: &admin, Action: audit.ActionRetentionSet})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), audited)
+
+	_, err = service.GetPolicy(ctx, "maven")
+	assert.ErrorIs(t, err, ErrPolicyNotFound)
+
+	err = service.SetPolicy(ctx, &types.RetentionPolicy{RegistryName: "npm", KeepLastVersions: -1}, admin)
+	assert.Error(t, err)
+}
+
+func TestDryRun_RemovesNothing(t *testing.T) {
+	service, db, deleter := setupTestService(t)
+	createArtifacts(t, db, "npm", "app", "1.0.0", "1.1.0", "1.2.0")
+	createArtifacts(t, db, "maven", "app", "1.0.0", "1.1.0", "1.2.0")
+
+	candidates, err := service.DryRun(context.Background(), &types.RetentionPolicy{RegistryName: "npm", KeepLastVersions: 1})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"app@1.1.0", "app@1.0.0"}, versions(candidates))
+	assert.Empty(t, deleter.deleted)
+
+	var count int64
+	require.NoError(t, db.Model(&types.Artifact{}).Count(&count).Error)
+	assert.Equal(t, int64(6), count)
+}
+
+func TestApplyAll_DeletesAsPolicyOwner(t *testing.T) {
+	service, db, deleter := setupTestService(t)
+	ctx := context.Background()
+	admin := uuid.New()
+
+	createArtifacts(t, db, "npm", "app", "1.0.0", "1.1.0", "1.2.0", "1.3.0")
+	createArtifacts(t, db, "nuget", "lib", "1.0.0", "2.0.0")
+	require.NoError(t, service.SetPolicy(ctx, &types.RetentionPolicy{RegistryName: "npm", Enabled: true, KeepLastVersions: 2}, admin))
+	require.NoError(t, service.SetPolicy(ctx, &types.RetentionPolicy{RegistryName: "nuget", Enabled: false, KeepLastVersions: 1}, admin))
+
+	// Deletions the actor is not permitted are skipped
+	deleter.denied["app@1.0.0"] = true
+
+	require.NoError(t, service.ApplyAll(ctx))
+
+	assert.Equal(t, []string{"app@1.1.0"}, deleter.deleted)
+	assert.Equal(t, []uuid.UUID{admin}, deleter.userIDs)
+}
+
+func TestApply_RequiresActor(t *testing.T) {
+	service, _, _ := setupTestService(t)
+
+	_, err := service.Apply(context.Background(), &types.RetentionPolicy{RegistryName: "npm", Enabled: true})
+	assert.Error(t, err)
+}
@@ -0,0 +1,46 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Worker applies retention policies periodically in the background
+type Worker struct {
+	service  *Service
+	interval time.Duration
+}
+
+// NewWorker creates a worker that applies the service's policies every interval
+func NewWorker(service *Service, interval time.Duration) *Worker {
+	return &Worker{service: service, interval: interval}
+}
+
+// Start applies policies every interval until ctx is done. It returns
+// immediately; a non-positive interval disables the worker.
+func (w *Worker) Start(ctx context.Context) {
+	if w.interval <= 0 {
+		log.Info().Msg("Retention worker disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := w.service.ApplyAll(ctx); err != nil {
+					log.Error().Err(err).Msg("Retention run failed")
+				}
+			}
+		}
+	}()
+
+	log.Info().Dur("interval", w.interval).Msg("Retention worker started")
+}
@@ -0,0 +1,223 @@
+// Package scanning submits published artifacts to an external vulnerability
+// scanner and stores its findings
+package scanning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// PolicyBlock refuses downloads of artifacts whose latest scan found critical
+// vulnerabilities
+const PolicyBlock = "block"
+
+// DefaultTimeout bounds a single scan when no timeout is set
+const DefaultTimeout = 5 * time.Minute
+
+var (
+	// ErrScanResultNotFound is returned when an artifact has not been scanned
+	ErrScanResultNotFound = errors.New("scan result not found")
+
+	// ErrInvalidPolicy is returned for a scan policy other than "" or "block"
+	ErrInvalidPolicy = errors.New("invalid scan policy")
+)
+
+// Scanner finds the vulnerabilities in an artifact's content
+type Scanner interface {
+	// Name identifies the scanner in stored results
+	Name() string
+
+	// Scan returns the vulnerabilities found in content
+	Scan(ctx context.Context, artifact *types.Artifact, content io.Reader) ([]types.Vulnerability, error)
+}
+
+// Service scans artifacts as they are published and stores the results. It
+// is a registry.EventNotifier, and a registry.DownloadPolicy enforcing the
+// scan policy.
+type Service struct {
+	db      *gorm.DB
+	storage storage.BlobStorage
+	scanner Scanner
+	block   bool
+	timeout time.Duration
+	wg      sync.WaitGroup
+}
+
+// NewService creates a scanning service reading artifacts from storage and
+// storing results in db. A nil scanner disables scanning, leaving only the
+// stored results.
+func NewService(db *gorm.DB, storage storage.BlobStorage, scanner Scanner) *Service {
+	return &Service{
+		db:      db,
+		storage: storage,
+		scanner: scanner,
+		timeout: DefaultTimeout,
+	}
+}
+
+// SetPolicy sets what happens to artifacts with critical findings: "block"
+// refuses their downloads, and an empty policy only reports them
+func (s *Service) SetPolicy(policy string) error {
+	switch policy {
+	case "":
+		s.block = false
+	case PolicyBlock:
+		s.block = true
+	default:
+		return fmt.Errorf("%w %q: use %q or leave it empty", ErrInvalidPolicy, policy, PolicyBlock)
+	}
+	return nil
+}
+
+// SetTimeout sets how long a single scan may take
+func (s *Service) SetTimeout(timeout time.Duration) {
+	if timeout > 0 {
+		s.timeout = timeout
+	}
+}
+
+// NotifyEvent scans newly published artifacts. Scans run in the background,
+// so publishing is never delayed by the scanner.
+func (s *Service) NotifyEvent(ctx context.Context, event registry.PackageEvent) {
+	if s.scanner == nil || event.Type != registry.EventPackagePublished {
+		return
+	}
+	artifact := *event.Artifact
+	ctx = context.WithoutCancel(ctx)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		if _, err := s.Scan(ctx, &artifact); err != nil {
+			log.Error().Err(err).
+				Str("registry", artifact.Registry).
+				Str("name", artifact.Name).
+				Str("version", artifact.Version).
+				Msg("Failed to scan artifact for vulnerabilities")
+		}
+	}()
+}
+
+// Wait blocks until every pending scan has finished
+func (s *Service) Wait() {
+	s.wg.Wait()
+}
+
+// Scan submits an artifact's stored content to the scanner and records the
+// findings, replacing any earlier result. A failed scan is recorded too.
+func (s *Service) Scan(ctx context.Context, artifact *types.Artifact) (*types.ScanResult, error) {
+	if s.scanner == nil {
+		return nil, errors.New("no vulnerability scanner is configured")
+	}
+
+	// Mark the artifact as being scanned, keeping the previous findings until
+	// the new ones replace them
+	result := types.ScanResult{ArtifactID: artifact.ID}
+	if err := s.db.WithContext(ctx).Where("artifact_id = ?", artifact.ID).
+		Attrs(types.ScanResult{Scanner: s.scanner.Name()}).
+		Assign(types.ScanResult{Status: types.ScanStatusPending}).
+		FirstOrCreate(&result).Error; err != nil {
+		return nil, fmt.Errorf("failed to create scan result: %w", err)
+	}
+
+	vulnerabilities, err := s.scan(ctx, artifact)
+	now := time.Now().UTC()
+	result.Scanner = s.scanner.Name()
+	result.ScannedAt = &now
+	if err != nil {
+		result.Status = types.ScanStatusFailed
+		result.Error = err.Error()
+	} else {
+		result.Status = types.ScanStatusCompleted
+		result.Error = ""
+		result.Vulnerabilities = vulnerabilities
+		countSeverities(&result)
+	}
+
+	if saveErr := s.db.WithContext(ctx).Save(&result).Error; saveErr != nil {
+		return nil, fmt.Errorf("failed to save scan result: %w", saveErr)
+	}
+	return &result, err
+}
+
+// scan reads an artifact from storage and passes it to the scanner
+func (s *Service) scan(ctx context.Context, artifact *types.Artifact) ([]types.Vulnerability, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	content, err := s.storage.Retrieve(ctx, artifact.StoragePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve artifact: %w", err)
+	}
+	defer content.Close()
+
+	vulnerabilities, err := s.scanner.Scan(ctx, artifact, content)
+	if err != nil {
+		return nil, fmt.Errorf("%s scan failed: %w", s.scanner.Name(), err)
+	}
+	return vulnerabilities, nil
+}
+
+// countSeverities sets a result's severity counts from its vulnerabilities
+func countSeverities(result *types.ScanResult) {
+	result.Critical, result.High, result.Medium, result.Low, result.Unknown = 0, 0, 0, 0, 0
+	for _, vulnerability := range result.Vulnerabilities {
+		switch vulnerability.Severity {
+		case types.SeverityCritical:
+			result.Critical++
+		case types.SeverityHigh:
+			result.High++
+		case types.SeverityMedium:
+			result.Medium++
+		case types.SeverityLow:
+			result.Low++
+		default:
+			result.Unknown++
+		}
+	}
+}
+
+// GetResult returns the latest scan result of an artifact
+func (s *Service) GetResult(ctx context.Context, artifactID uuid.UUID) (*types.ScanResult, error) {
+	var result types.ScanResult
+	if err := s.db.WithContext(ctx).Where("artifact_id = ?", artifactID).First(&result).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrScanResultNotFound
+		}
+		return nil, fmt.Errorf("failed to get scan result: %w", err)
+	}
+	return &result, nil
+}
+
+// CheckDownload refuses artifacts with critical findings under the block
+// policy. Artifacts that are unscanned, still being scanned or failed to scan
+// are allowed, so an unavailable scanner never stops downloads.
+func (s *Service) CheckDownload(ctx context.Context, artifact *types.Artifact) error {
+	if !s.block {
+		return nil
+	}
+	result, err := s.GetResult(ctx, artifact.ID)
+	if err != nil {
+		if errors.Is(err, ErrScanResultNotFound) {
+			return nil
+		}
+		return err
+	}
+	if result.Status == types.ScanStatusCompleted && result.Critical > 0 {
+		return fmt.Errorf("%w: %s:%s has %d critical vulnerabilities", registry.ErrDownloadBlocked,
+			artifact.Name, artifact.Version, result.Critical)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package scanning
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// stubScanner reports fixed findings, or fails, and records what it scanned
+type stubScanner struct {
+	vulnerabilities []types.Vulnerability
+	err             error
+
+	mu      sync.Mutex
+	scanned []string
+}
+
+func (s *stubScanner) Name() string {
+	return "stub"
+}
+
+func (s *stubScanner) Scan(ctx context.Context, artifact *types.Artifact, content io.Reader) ([]types.Vulnerability, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scanned = append(s.scanned, string(data))
+	return s.vulnerabilities, s.err
+}
+
+// setupTestServices returns a registry service that notifies a scanning
+// service using scanner, and a user to publish with
+func setupTestServices(t *testing.T, scanner Scanner) (*registry.Service, *Service, *types.User) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// Scans write from another goroutine, so share the single in-memory database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.BlobRef{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{},
+		&types.RegistrySetting{}, &types.Permission{}, &types.Quota{}, &types.AuditEntry{}, &types.ScanResult{}))
+	require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: "maven", Enabled: true}).Error)
+	user := &types.User{Username: "publisher", Email: "publisher@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	registryService := registry.NewService(&common.Database{DB: db}, localStorage)
+
+	scanService := NewService(db, localStorage, scanner)
+	registryService.SetEventNotifier(scanService)
+	registryService.SetDownloadPolicy(scanService)
+	return registryService, scanService, user
+}
+
+func TestScanOnPublish(t *testing.T) {
+	scanner := &stubScanner{vulnerabilities: []types.Vulnerability{
+		{ID: "CVE-2021-44228", Severity: types.SeverityCritical, Package: "log4j-core", InstalledVersion: "2.14.1", FixedVersion: "2.15.0"},
+		{ID: "CVE-2021-45046", Severity: types.SeverityCritical, Package: "log4j-core", InstalledVersion: "2.14.1"},
+		{ID: "CVE-2020-9488", Severity: types.SeverityLow, Package: "log4j-core", InstalledVersion: "2.14.1"},
+		{ID: "GHSA-xxxx", Severity: "", Package: "commons-text"},
+	}}
+	registryService, scanService, user := setupTestServices(t, scanner)
+	ctx := context.Background()
+
+	artifact, err := registryService.Upload(ctx, "maven", "com.example:app", "1.0.0", bytes.NewReader([]byte("jar content")), user.ID)
+	require.NoError(t, err)
+	scanService.Wait()
+
+	assert.Equal(t, []string{"jar content"}, scanner.scanned, "the stored content is scanned")
+	result, err := scanService.GetResult(ctx, artifact.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "stub", result.Scanner)
+	assert.Equal(t, types.ScanStatusCompleted, result.Status)
+	assert.Equal(t, 2, result.Critical)
+	assert.Equal(t, 0, result.High)
+	assert.Equal(t, 1, result.Low)
+	assert.Equal(t, 1, result.Unknown)
+	assert.Len(t, result.Vulnerabilities, 4)
+	assert.NotNil(t, result.ScannedAt)
+
+	// Without the block policy findings are only reported
+	_, content, err := registryService.Download(ctx, "maven", "com.example:app", "1.0.0")
+	require.NoError(t, err)
+	content.Close()
+
+	require.NoError(t, scanService.SetPolicy(PolicyBlock))
+	_, _, err = registryService.Download(ctx, "maven", "com.example:app", "1.0.0")
+	assert.ErrorIs(t, err, registry.ErrDownloadBlocked)
+
+	// A rescan replaces the findings
+	scanner.vulnerabilities = nil
+	result, err = scanService.Scan(ctx, artifact)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Critical)
+	assert.Empty(t, result.Vulnerabilities)
+	var count int64
+	require.NoError(t, scanService.db.Model(&types.ScanResult{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	_, content, err = registryService.Download(ctx, "maven", "com.example:app", "1.0.0")
+	require.NoError(t, err)
+	content.Close()
+}
+
+func TestScanFailure(t *testing.T) {
+	scanner := &stubScanner{err: errors.New("scanner unavailable")}
+	registryService, scanService, user := setupTestServices(t, scanner)
+	require.NoError(t, scanService.SetPolicy(PolicyBlock))
+	ctx := context.Background()
+
+	artifact, err := registryService.Upload(ctx, "maven", "com.example:app", "1.0.0", bytes.NewReader([]byte("jar content")), user.ID)
+	require.NoError(t, err)
+	scanService.Wait()
+
+	result, err := scanService.GetResult(ctx, artifact.ID)
+	require.NoError(t, err)
+	assert.Equal(t, types.ScanStatusFailed, result.Status)
+	assert.Contains(t, result.Error, "scanner unavailable")
+
+	// Failed scans do not block downloads
+	_, content, err := registryService.Download(ctx, "maven", "com.example:app", "1.0.0")
+	require.NoError(t, err)
+	content.Close()
+}
+
+func TestScanningDisabled(t *testing.T) {
+	registryService, scanService, user := setupTestServices(t, nil)
+	ctx := context.Background()
+
+	artifact, err := registryService.Upload(ctx, "maven", "com.example:app", "1.0.0", bytes.NewReader([]byte("jar content")), user.ID)
+	require.NoError(t, err)
+	scanService.Wait()
+
+	_, err = scanService.GetResult(ctx, artifact.ID)
+	assert.ErrorIs(t, err, ErrScanResultNotFound)
+}
+
+func TestSetPolicy(t *testing.T) {
+	service := NewService(nil, nil, nil)
+	assert.NoError(t, service.SetPolicy(""))
+	assert.NoError(t, service.SetPolicy(PolicyBlock))
+	assert.ErrorIs(t, service.SetPolicy("warn"), ErrInvalidPolicy)
+}
+
+func TestTrivyScanner(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "jar content" || r.Header.Get(PackageHeader) != "com.example:app" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"SchemaVersion": 2, "Results": [
+			{"Target": "app.jar", "Vulnerabilities": [
+				{"VulnerabilityID": "CVE-2021-44228", "PkgName": "log4j-core", "InstalledVersion": "2.14.1", "FixedVersion": "2.15.0", "Severity": "CRITICAL", "Title": "Remote code injection in Log4j"},
+				{"VulnerabilityID": "CVE-2022-0001", "PkgName": "other", "InstalledVersion": "1.0", "Severity": "negligible"}
+			]},
+			{"Target": "empty.jar"}
+		]}`))
+	}))
+	defer server.Close()
+
+	artifact := &types.Artifact{Registry: "maven", Name: "com.example:app", Version: "1.0.0"}
+	vulnerabilities, err := NewTrivyScanner(server.URL).Scan(context.Background(), artifact, bytes.NewReader([]byte("jar content")))
+	require.NoError(t, err)
+	assert.Equal(t, []types.Vulnerability{
+		{ID: "CVE-2021-44228", Severity: types.SeverityCritical, Package: "log4j-core", InstalledVersion: "2.14.1", FixedVersion: "2.15.0", Title: "Remote code injection in Log4j"},
+		{ID: "CVE-2022-0001", Severity: types.SeverityUnknown, Package: "other", InstalledVersion: "1.0"},
+	}, vulnerabilities)
+
+	_, err = NewTrivyScanner(server.URL).Scan(context.Background(), artifact, bytes.NewReader([]byte("other")))
+	assert.ErrorContains(t, err, "status 400")
+}
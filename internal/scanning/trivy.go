@@ -0,0 +1,105 @@
+package scanning
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/lgulliver/lodestone/pkg/types"
+)
+
+// Headers identifying the artifact posted to a Trivy endpoint
+const (
+	RegistryHeader = "X-Lodestone-Registry"
+	PackageHeader  = "X-Lodestone-Package"
+	VersionHeader  = "X-Lodestone-Version"
+)
+
+// TrivyScanner posts artifacts to an HTTP endpoint that scans them with
+// Trivy, such as a wrapper running "trivy fs --format json" on the uploaded
+// file, and reads the findings from the JSON report in the response
+type TrivyScanner struct {
+	url    string
+	client *http.Client
+}
+
+// NewTrivyScanner creates a scanner posting artifacts to url
+func NewTrivyScanner(url string) *TrivyScanner {
+	return &TrivyScanner{url: url, client: &http.Client{}}
+}
+
+// trivyReport is the part of Trivy's JSON report the findings are read from
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// Name identifies Trivy in stored results
+func (t *TrivyScanner) Name() string {
+	return "trivy"
+}
+
+// Scan posts content to the Trivy endpoint and returns the vulnerabilities in
+// its report
+func (t *TrivyScanner) Scan(ctx context.Context, artifact *types.Artifact, content io.Reader) ([]types.Vulnerability, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scan request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(RegistryHeader, artifact.Registry)
+	req.Header.Set(PackageHeader, artifact.Name)
+	req.Header.Set(VersionHeader, artifact.Version)
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scanner responded with status %d", resp.StatusCode)
+	}
+
+	var report trivyReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return nil, fmt.Errorf("failed to decode Trivy report: %w", err)
+	}
+
+	var vulnerabilities []types.Vulnerability
+	for _, result := range report.Results {
+		for _, found := range result.Vulnerabilities {
+			vulnerabilities = append(vulnerabilities, types.Vulnerability{
+				ID:               found.VulnerabilityID,
+				Severity:         normalizeSeverity(found.Severity),
+				Package:          found.PkgName,
+				InstalledVersion: found.InstalledVersion,
+				FixedVersion:     found.FixedVersion,
+				Title:            found.Title,
+			})
+		}
+	}
+	return vulnerabilities, nil
+}
+
+// normalizeSeverity maps a reported severity onto the known severities
+func normalizeSeverity(severity string) string {
+	switch severity = strings.ToUpper(severity); severity {
+	case types.SeverityCritical, types.SeverityHigh, types.SeverityMedium, types.SeverityLow:
+		return severity
+	default:
+		return types.SeverityUnknown
+	}
+}
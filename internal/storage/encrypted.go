@@ -0,0 +1,399 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// EncryptionKeySize is the size of the master key content is encrypted with
+const EncryptionKeySize = 32
+
+// ErrDecryptionFailed is returned when reading encrypted content that was
+// modified, truncated or encrypted with another key
+var ErrDecryptionFailed = errors.New("encrypted content failed authentication")
+
+// Encrypted objects start with a header of a magic string, the salt the
+// object's data key is derived with and the nonce prefix of its segments. The
+// content follows, sealed with AES-256-GCM in segments of
+// encryptedSegmentSize bytes. Each segment's nonce is the prefix followed by
+// the segment's index, and the last segment is marked in its additional data,
+// so segments cannot be reordered, dropped or truncated undetected.
+const (
+	encryptionMagic           = "LSE1"
+	encryptionSaltSize        = 16
+	encryptionNoncePrefixSize = 8 // the remaining 4 bytes of the nonce count segments
+	encryptionHeaderSize      = len(encryptionMagic) + encryptionSaltSize + encryptionNoncePrefixSize
+	encryptionOverhead        = 16 // GCM tag sealed with each segment
+
+	encryptedSegmentSize       = 64 << 10
+	sealedEncryptedSegmentSize = encryptedSegmentSize + encryptionOverhead
+)
+
+// encryptionKeyInfo binds derived data keys to their use
+const encryptionKeyInfo = "lodestone storage encryption"
+
+// EncryptedStorage encrypts content at rest in the storage it wraps. Each
+// object is encrypted with its own data key, derived from the master key and
+// a random salt stored with the object. Content is encrypted and decrypted as
+// it is streamed, and ranges decrypt only the segments they cover.
+type EncryptedStorage struct {
+	storage   BlobStorage
+	masterKey []byte
+}
+
+// NewEncryptedStorage wraps storage so content is encrypted with masterKey,
+// which must be EncryptionKeySize bytes. Content stored before encryption
+// was enabled cannot be read through it.
+func NewEncryptedStorage(storage BlobStorage, masterKey []byte) (*EncryptedStorage, error) {
+	if len(masterKey) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(masterKey))
+	}
+	return &EncryptedStorage{storage: storage, masterKey: bytes.Clone(masterKey)}, nil
+}
+
+// Store encrypts content and saves it at the given path
+func (s *EncryptedStorage) Store(ctx context.Context, path string, content io.Reader, contentType string) error {
+	header := make([]byte, encryptionHeaderSize)
+	copy(header, encryptionMagic)
+	if _, err := rand.Read(header[len(encryptionMagic):]); err != nil {
+		return fmt.Errorf("failed to generate encryption salt: %w", err)
+	}
+
+	aead, noncePrefix, err := s.openHeader(header)
+	if err != nil {
+		return err
+	}
+	encrypted := &encryptingReader{source: content, aead: aead, noncePrefix: noncePrefix, out: header}
+	return s.storage.Store(ctx, path, encrypted, contentType)
+}
+
+// Retrieve gets the decrypted content at the given path. Reading content that
+// fails authentication returns ErrDecryptionFailed.
+func (s *EncryptedStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	content, err := s.storage.Retrieve(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, encryptionHeaderSize)
+	if _, err := io.ReadFull(content, header); err != nil {
+		content.Close()
+		return nil, fmt.Errorf("%w: missing encryption header", ErrDecryptionFailed)
+	}
+	aead, noncePrefix, err := s.openHeader(header)
+	if err != nil {
+		content.Close()
+		return nil, err
+	}
+
+	return &decryptingReader{
+		source: bufio.NewReaderSize(content, sealedEncryptedSegmentSize), closer: content,
+		aead: aead, noncePrefix: noncePrefix, lastIndex: -1, remaining: -1,
+	}, nil
+}
+
+// RetrieveRange gets up to length bytes of the decrypted content at the given
+// path, starting at offset, reading only the segments the range covers
+func (s *EncryptedStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	size, err := s.GetSize(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < 0 || offset >= size {
+		return nil, fmt.Errorf("%w: offset %d of %d bytes", ErrInvalidRange, offset, size)
+	}
+	end := min(offset+length, size)
+	if end == offset {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	headerReader, err := s.storage.RetrieveRange(ctx, path, 0, int64(encryptionHeaderSize))
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, encryptionHeaderSize)
+	_, err = io.ReadFull(headerReader, header)
+	headerReader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing encryption header", ErrDecryptionFailed)
+	}
+	aead, noncePrefix, err := s.openHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	first, last := offset/encryptedSegmentSize, (end-1)/encryptedSegmentSize
+	content, err := s.storage.RetrieveRange(ctx, path,
+		int64(encryptionHeaderSize)+first*sealedEncryptedSegmentSize, (last-first+1)*sealedEncryptedSegmentSize)
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := &decryptingReader{
+		source: bufio.NewReaderSize(content, sealedEncryptedSegmentSize), closer: content,
+		aead: aead, noncePrefix: noncePrefix, index: uint32(first),
+		lastIndex: segmentCount(size) - 1, remaining: last - first + 1,
+	}
+	if _, err := io.CopyN(io.Discard, decrypted, offset-first*encryptedSegmentSize); err != nil {
+		decrypted.Close()
+		return nil, err
+	}
+	return &encryptedSection{Reader: io.LimitReader(decrypted, end-offset), Closer: decrypted}, nil
+}
+
+// Delete removes content at the given path
+func (s *EncryptedStorage) Delete(ctx context.Context, path string) error {
+	return s.storage.Delete(ctx, path)
+}
+
+// Exists checks if content exists at the given path
+func (s *EncryptedStorage) Exists(ctx context.Context, path string) (bool, error) {
+	return s.storage.Exists(ctx, path)
+}
+
+// GetSize returns the size of the decrypted content at the given path
+func (s *EncryptedStorage) GetSize(ctx context.Context, path string) (int64, error) {
+	size, err := s.storage.GetSize(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	return plaintextSize(size)
+}
+
+// GetModTime returns when content at the given path was last modified
+func (s *EncryptedStorage) GetModTime(ctx context.Context, path string) (time.Time, error) {
+	return s.storage.GetModTime(ctx, path)
+}
+
+// List returns paths matching the prefix
+func (s *EncryptedStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	return s.storage.List(ctx, prefix)
+}
+
+// openHeader derives the data key of an object from its header, returning
+// the cipher its segments are sealed with and their nonce prefix
+func (s *EncryptedStorage) openHeader(header []byte) (cipher.AEAD, []byte, error) {
+	if !bytes.HasPrefix(header, []byte(encryptionMagic)) {
+		return nil, nil, fmt.Errorf("%w: missing encryption header", ErrDecryptionFailed)
+	}
+	salt := header[len(encryptionMagic) : len(encryptionMagic)+encryptionSaltSize]
+	noncePrefix := header[len(encryptionMagic)+encryptionSaltSize:]
+
+	key, err := hkdf.Key(sha256.New, s.masterKey, salt, encryptionKeyInfo, EncryptionKeySize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive data key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, noncePrefix, nil
+}
+
+// plaintextSize returns the size of the content an encrypted object of a
+// given size decrypts to
+func plaintextSize(size int64) (int64, error) {
+	sealed := size - int64(encryptionHeaderSize)
+	if sealed < encryptionOverhead {
+		return 0, fmt.Errorf("%w: content too short", ErrDecryptionFailed)
+	}
+
+	full, partial := sealed/sealedEncryptedSegmentSize, sealed%sealedEncryptedSegmentSize
+	switch {
+	case partial == 0:
+		return full * encryptedSegmentSize, nil
+	case partial < encryptionOverhead:
+		return 0, fmt.Errorf("%w: content truncated", ErrDecryptionFailed)
+	default:
+		return full*encryptedSegmentSize + partial - encryptionOverhead, nil
+	}
+}
+
+// segmentCount returns the number of segments content of a given size is
+// sealed in. Empty content is sealed as one empty segment.
+func segmentCount(size int64) int64 {
+	return max(1, (size+encryptedSegmentSize-1)/encryptedSegmentSize)
+}
+
+// segmentNonce returns the nonce of the segment at index
+func segmentNonce(noncePrefix []byte, index uint32) []byte {
+	nonce := make([]byte, encryptionNoncePrefixSize+4)
+	copy(nonce, noncePrefix)
+	binary.BigEndian.PutUint32(nonce[encryptionNoncePrefixSize:], index)
+	return nonce
+}
+
+// segmentAdditionalData marks whether a segment is the last of its object
+func segmentAdditionalData(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// encryptingReader reads the encrypted form of its source: the header
+// followed by its sealed segments
+type encryptingReader struct {
+	source      io.Reader
+	aead        cipher.AEAD
+	noncePrefix []byte
+	index       uint32
+
+	out     []byte // sealed bytes not yet read
+	next    []byte // plaintext of the next segment, read ahead to tell whether it is the last
+	nextEOF bool   // the source ended with the next segment
+	started bool
+	done    bool
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealSegment(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// sealSegment seals the next segment of the source into out
+func (r *encryptingReader) sealSegment() error {
+	if !r.started {
+		var err error
+		if r.next, r.nextEOF, err = r.readSegment(); err != nil {
+			return err
+		}
+		r.started = true
+	}
+
+	segment, last := r.next, r.nextEOF
+	if !last {
+		next, eof, err := r.readSegment()
+		if err != nil {
+			return err
+		}
+		if len(next) == 0 {
+			last = true
+		} else {
+			r.next, r.nextEOF = next, eof
+		}
+	}
+
+	r.out = r.aead.Seal(nil, segmentNonce(r.noncePrefix, r.index), segment, segmentAdditionalData(last))
+	r.index++
+	r.done = last
+	return nil
+}
+
+// readSegment reads up to a segment of plaintext, reporting whether the
+// source ended
+func (r *encryptingReader) readSegment() ([]byte, bool, error) {
+	segment := make([]byte, encryptedSegmentSize)
+	n, err := io.ReadFull(r.source, segment)
+	switch err {
+	case nil:
+		return segment, false, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return segment[:n], true, nil
+	default:
+		return nil, false, err
+	}
+}
+
+// decryptingReader reads the plaintext of sealed segments. The last segment
+// of an object is found at lastIndex or, when that is -1, by reaching the end
+// of the source. remaining limits how many segments are read, -1 for all.
+type decryptingReader struct {
+	source      *bufio.Reader
+	closer      io.Closer
+	aead        cipher.AEAD
+	noncePrefix []byte
+	index       uint32
+	lastIndex   int64
+	remaining   int64
+
+	out  []byte
+	err  error
+	done bool
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.openSegment()
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// openSegment authenticates and decrypts the next segment into out
+func (r *decryptingReader) openSegment() error {
+	sealed := make([]byte, sealedEncryptedSegmentSize)
+	n, err := io.ReadFull(r.source, sealed)
+	short := err == io.ErrUnexpectedEOF
+	switch {
+	case err == io.EOF:
+		return fmt.Errorf("%w: content truncated", ErrDecryptionFailed)
+	case err != nil && !short:
+		return err
+	}
+
+	var last bool
+	if r.lastIndex >= 0 {
+		last = int64(r.index) == r.lastIndex
+	} else if short {
+		last = true
+	} else if _, err := r.source.Peek(1); err == io.EOF {
+		last = true
+	} else if err != nil {
+		return err
+	}
+
+	plaintext, err := r.aead.Open(nil, segmentNonce(r.noncePrefix, r.index), sealed[:n], segmentAdditionalData(last))
+	if err != nil {
+		return fmt.Errorf("%w: segment %d", ErrDecryptionFailed, r.index)
+	}
+
+	r.out = plaintext
+	r.index++
+	if r.remaining > 0 {
+		r.remaining--
+	}
+	r.done = last || r.remaining == 0
+	return nil
+}
+
+func (r *decryptingReader) Close() error {
+	return r.closer.Close()
+}
+
+// encryptedSection is part of decrypted content, closing the content with it
+type encryptedSection struct {
+	io.Reader
+	io.Closer
+}
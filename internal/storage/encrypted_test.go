@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupEncryptedStorage returns encrypted storage over local storage, and the
+// local storage so tests can inspect what was written
+func setupEncryptedStorage(t *testing.T) (*EncryptedStorage, *LocalStorage) {
+	t.Helper()
+	local := setupTestStorage(t)
+	key := make([]byte, EncryptionKeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	encrypted, err := NewEncryptedStorage(local, key)
+	require.NoError(t, err)
+	return encrypted, local
+}
+
+func randomContent(t *testing.T, size int) []byte {
+	t.Helper()
+	content := make([]byte, size)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	return content
+}
+
+func TestEncryptedStorage_RoundTrip(t *testing.T) {
+	encrypted, local := setupEncryptedStorage(t)
+	ctx := context.Background()
+
+	sizes := []int{0, 1, encryptedSegmentSize - 1, encryptedSegmentSize, encryptedSegmentSize + 1, 3*encryptedSegmentSize + 5}
+	for _, size := range sizes {
+		content := randomContent(t, size)
+		path := filepath.Join("blobs", strings.Repeat("x", 1+size%7))
+
+		require.NoError(t, encrypted.Store(ctx, path, bytes.NewReader(content), "application/octet-stream"), size)
+
+		reader, err := encrypted.Retrieve(ctx, path)
+		require.NoError(t, err, size)
+		retrieved, err := io.ReadAll(reader)
+		reader.Close()
+		require.NoError(t, err, size)
+		assert.Equal(t, content, retrieved, size)
+
+		plaintextSize, err := encrypted.GetSize(ctx, path)
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), plaintextSize, "GetSize reports the plaintext size")
+
+		storedSize, err := local.GetSize(ctx, path)
+		require.NoError(t, err)
+		assert.Greater(t, storedSize, int64(size))
+	}
+}
+
+func TestEncryptedStorage_ContentEncryptedOnDisk(t *testing.T) {
+	encrypted, local := setupEncryptedStorage(t)
+	ctx := context.Background()
+	content := []byte(strings.Repeat("plaintext content ", 100))
+
+	require.NoError(t, encrypted.Store(ctx, "first", bytes.NewReader(content), "text/plain"))
+	require.NoError(t, encrypted.Store(ctx, "second", bytes.NewReader(content), "text/plain"))
+
+	first, err := os.ReadFile(filepath.Join(local.basePath, "first"))
+	require.NoError(t, err)
+	second, err := os.ReadFile(filepath.Join(local.basePath, "second"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(first), "plaintext content")
+	assert.NotEqual(t, first, second, "each object has its own data key and nonces")
+}
+
+func TestEncryptedStorage_RetrieveRange(t *testing.T) {
+	encrypted, _ := setupEncryptedStorage(t)
+	ctx := context.Background()
+	content := randomContent(t, 3*encryptedSegmentSize+100)
+	require.NoError(t, encrypted.Store(ctx, "blob", bytes.NewReader(content), "application/octet-stream"))
+
+	tests := []struct {
+		name           string
+		offset, length int64
+	}{
+		{"start", 0, 10},
+		{"within a segment", 100, 1000},
+		{"across segments", encryptedSegmentSize - 10, 20},
+		{"whole segment", encryptedSegmentSize, encryptedSegmentSize},
+		{"last segment", 3 * encryptedSegmentSize, 100},
+		{"past the end", 3*encryptedSegmentSize + 50, 1000},
+		{"everything", 0, int64(len(content))},
+		{"empty", 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := encrypted.RetrieveRange(ctx, "blob", tt.offset, tt.length)
+			require.NoError(t, err)
+			defer reader.Close()
+			retrieved, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			end := min(tt.offset+tt.length, int64(len(content)))
+			assert.Equal(t, content[tt.offset:end], retrieved)
+		})
+	}
+
+	_, err := encrypted.RetrieveRange(ctx, "blob", int64(len(content)), 1)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestEncryptedStorage_TamperDetection(t *testing.T) {
+	ctx := context.Background()
+	content := randomContent(t, 2*encryptedSegmentSize+100)
+
+	readAll := func(encrypted *EncryptedStorage, path string) error {
+		reader, err := encrypted.Retrieve(ctx, path)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.ReadAll(reader)
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(stored []byte) []byte
+	}{
+		{"flipped content byte", func(stored []byte) []byte {
+			stored[encryptionHeaderSize+encryptedSegmentSize+7] ^= 1
+			return stored
+		}},
+		{"flipped salt", func(stored []byte) []byte {
+			stored[len(encryptionMagic)] ^= 1
+			return stored
+		}},
+		{"truncated last segment", func(stored []byte) []byte {
+			return stored[:len(stored)-10]
+		}},
+		{"dropped last segment", func(stored []byte) []byte {
+			return stored[:encryptionHeaderSize+2*sealedEncryptedSegmentSize]
+		}},
+		{"swapped segments", func(stored []byte) []byte {
+			first := bytes.Clone(stored[encryptionHeaderSize : encryptionHeaderSize+sealedEncryptedSegmentSize])
+			copy(stored[encryptionHeaderSize:], stored[encryptionHeaderSize+sealedEncryptedSegmentSize:encryptionHeaderSize+2*sealedEncryptedSegmentSize])
+			copy(stored[encryptionHeaderSize+sealedEncryptedSegmentSize:], first)
+			return stored
+		}},
+		{"appended content", func(stored []byte) []byte {
+			return append(stored, []byte("extra")...)
+		}},
+		{"not encrypted", func([]byte) []byte {
+			return []byte("plaintext stored before encryption was enabled")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, local := setupEncryptedStorage(t)
+			require.NoError(t, encrypted.Store(ctx, "blob", bytes.NewReader(content), "application/octet-stream"))
+
+			path := filepath.Join(local.basePath, "blob")
+			stored, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, tt.tamper(stored), 0o644))
+
+			assert.ErrorIs(t, readAll(encrypted, "blob"), ErrDecryptionFailed)
+		})
+	}
+
+	t.Run("wrong key", func(t *testing.T) {
+		encrypted, local := setupEncryptedStorage(t)
+		require.NoError(t, encrypted.Store(ctx, "blob", bytes.NewReader(content), "application/octet-stream"))
+
+		other, err := NewEncryptedStorage(local, randomContent(t, EncryptionKeySize))
+		require.NoError(t, err)
+		assert.ErrorIs(t, readAll(other, "blob"), ErrDecryptionFailed)
+	})
+
+	t.Run("tampered range", func(t *testing.T) {
+		encrypted, local := setupEncryptedStorage(t)
+		require.NoError(t, encrypted.Store(ctx, "blob", bytes.NewReader(content), "application/octet-stream"))
+
+		path := filepath.Join(local.basePath, "blob")
+		stored, err := os.ReadFile(path)
+		require.NoError(t, err)
+		stored[encryptionHeaderSize+sealedEncryptedSegmentSize+3] ^= 1
+		require.NoError(t, os.WriteFile(path, stored, 0o644))
+
+		// The range is rejected when its segment is first decrypted
+		reader, err := encrypted.RetrieveRange(ctx, "blob", encryptedSegmentSize+1, 10)
+		if err == nil {
+			defer reader.Close()
+			_, err = io.ReadAll(reader)
+		}
+		assert.ErrorIs(t, err, ErrDecryptionFailed)
+	})
+}
+
+func TestNewEncryptedStorage_KeySize(t *testing.T) {
+	_, err := NewEncryptedStorage(setupTestStorage(t), []byte("too short"))
+	assert.Error(t, err)
+}
+
+func TestStorageFactory_Encryption(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(randomContent(t, EncryptionKeySize))
+	storage, err := NewStorageFactory(&config.StorageConfig{Type: "local", LocalPath: t.TempDir(), EncryptionKey: key}).CreateStorage()
+	require.NoError(t, err)
+	assert.IsType(t, &EncryptedStorage{}, storage)
+
+	for _, invalid := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		_, err := NewStorageFactory(&config.StorageConfig{Type: "local", LocalPath: t.TempDir(), EncryptionKey: invalid}).CreateStorage()
+		assert.Error(t, err, invalid)
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"encoding/base64"
 	"fmt"
 
 	"github.com/lgulliver/lodestone/pkg/config"
@@ -16,14 +17,32 @@ func NewStorageFactory(config *config.StorageConfig) *StorageFactory {
 	return &StorageFactory{config: config}
 }
 
-// CreateStorage creates a storage instance based on the configured type
+// CreateStorage creates a storage instance based on the configured type,
+// encrypting content at rest when an encryption key is configured
 func (sf *StorageFactory) CreateStorage() (BlobStorage, error) {
+	backend, err := sf.createBackend()
+	if err != nil || sf.config.EncryptionKey == "" {
+		return backend, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(sf.config.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage encryption key: expected base64")
+	}
+	encrypted, err := NewEncryptedStorage(backend, key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage encryption key: %w", err)
+	}
+	return encrypted, nil
+}
+
+// createBackend creates the storage backend of the configured type
+func (sf *StorageFactory) createBackend() (BlobStorage, error) {
 	switch sf.config.Type {
 	case "local":
 		return NewLocalStorage(sf.config.LocalPath)
 	case "s3":
-		// TODO: Implement S3 storage
-		return nil, fmt.Errorf("S3 storage not yet implemented")
+		return NewS3Storage(sf.config)
 	case "gcs":
 		// TODO: Implement GCS storage
 		return nil, fmt.Errorf("GCS storage not yet implemented")
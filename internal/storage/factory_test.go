@@ -65,7 +65,7 @@ func TestStorageFactory_UnsupportedType(t *testing.T) {
 }
 
 func TestStorageFactory_CloudStorageNotImplemented(t *testing.T) {
-	cloudTypes := []string{"s3", "gcs", "azure"}
+	cloudTypes := []string{"gcs", "azure"}
 
 	for _, cloudType := range cloudTypes {
 		t.Run(cloudType, func(t *testing.T) {
@@ -82,3 +82,30 @@ func TestStorageFactory_CloudStorageNotImplemented(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageFactory_CreateS3Storage(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	storage, err := NewStorageFactory(&config.StorageConfig{
+		Type:      "s3",
+		Bucket:    "artifacts",
+		Region:    "eu-west-1",
+		Endpoint:  "http://localhost:9000",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}).CreateStorage()
+	require.NoError(t, err)
+	assert.IsType(t, &S3Storage{}, storage)
+
+	_, err = NewStorageFactory(&config.StorageConfig{Type: "s3", AccessKey: "access", SecretKey: "secret"}).CreateStorage()
+	assert.ErrorContains(t, err, "requires a bucket")
+
+	_, err = NewStorageFactory(&config.StorageConfig{Type: "s3", Bucket: "artifacts", AccessKey: "access"}).CreateStorage()
+	assert.ErrorContains(t, err, "requires both an access key and a secret key")
+
+	// Without configured keys, the SDK's credential chain is used
+	storage, err = NewStorageFactory(&config.StorageConfig{Type: "s3", Bucket: "artifacts"}).CreateStorage()
+	require.NoError(t, err)
+	assert.IsType(t, &S3Storage{}, storage)
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/lgulliver/lodestone/pkg/metrics"
+)
+
+// InstrumentedStorage records the latency and outcome of every operation on
+// the storage it wraps
+type InstrumentedStorage struct {
+	storage   BlobStorage
+	collector *metrics.Collector
+}
+
+// NewInstrumentedStorage wraps storage so its operations are recorded by
+// collector. With a nil collector the storage is returned unwrapped.
+func NewInstrumentedStorage(storage BlobStorage, collector *metrics.Collector) BlobStorage {
+	if collector == nil {
+		return storage
+	}
+	return &InstrumentedStorage{storage: storage, collector: collector}
+}
+
+// Store saves content at the given path
+func (s *InstrumentedStorage) Store(ctx context.Context, path string, content io.Reader, contentType string) error {
+	start := time.Now()
+	err := s.storage.Store(ctx, path, content, contentType)
+	s.collector.ObserveStorageOperation("store", err, start)
+	return err
+}
+
+// Retrieve gets content from the given path. Only opening the content is
+// timed, not reading it.
+func (s *InstrumentedStorage) Retrieve(ctx context.Context, path string) (io.ReadCloser, error) {
+	start := time.Now()
+	content, err := s.storage.Retrieve(ctx, path)
+	s.collector.ObserveStorageOperation("retrieve", err, start)
+	return content, err
+}
+
+// RetrieveRange gets part of the content at the given path. Only opening the
+// content is timed, not reading it.
+func (s *InstrumentedStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	start := time.Now()
+	content, err := s.storage.RetrieveRange(ctx, path, offset, length)
+	s.collector.ObserveStorageOperation("retrieve_range", err, start)
+	return content, err
+}
+
+// Delete removes content at the given path
+func (s *InstrumentedStorage) Delete(ctx context.Context, path string) error {
+	start := time.Now()
+	err := s.storage.Delete(ctx, path)
+	s.collector.ObserveStorageOperation("delete", err, start)
+	return err
+}
+
+// Exists checks if content exists at the given path
+func (s *InstrumentedStorage) Exists(ctx context.Context, path string) (bool, error) {
+	start := time.Now()
+	exists, err := s.storage.Exists(ctx, path)
+	s.collector.ObserveStorageOperation("exists", err, start)
+	return exists, err
+}
+
+// GetSize returns the size of content at the given path
+func (s *InstrumentedStorage) GetSize(ctx context.Context, path string) (int64, error) {
+	start := time.Now()
+	size, err := s.storage.GetSize(ctx, path)
+	s.collector.ObserveStorageOperation("get_size", err, start)
+	return size, err
+}
+
+// GetModTime returns when content at the given path was last modified
+func (s *InstrumentedStorage) GetModTime(ctx context.Context, path string) (time.Time, error) {
+	start := time.Now()
+	modTime, err := s.storage.GetModTime(ctx, path)
+	s.collector.ObserveStorageOperation("get_mod_time", err, start)
+	return modTime, err
+}
+
+// List returns paths matching the prefix
+func (s *InstrumentedStorage) List(ctx context.Context, prefix string) ([]string, error) {
+	start := time.Now()
+	paths, err := s.storage.List(ctx, prefix)
+	s.collector.ObserveStorageOperation("list", err, start)
+	return paths, err
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lgulliver/lodestone/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedStorage_RecordsOperations(t *testing.T) {
+	local, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	collector := metrics.NewCollector()
+	storage := NewInstrumentedStorage(local, collector)
+	ctx := context.Background()
+
+	require.NoError(t, storage.Store(ctx, "a/b.txt", strings.NewReader("content"), "text/plain"))
+	_, err = storage.Retrieve(ctx, "missing.txt")
+	require.Error(t, err)
+
+	w := httptest.NewRecorder()
+	collector.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	assert.Contains(t, body, `lodestone_storage_operation_duration_seconds_count{operation="store",status="success"} 1`)
+	assert.Contains(t, body, `lodestone_storage_operation_duration_seconds_count{operation="retrieve",status="error"} 1`)
+}
+
+func TestNewInstrumentedStorage_NilCollector(t *testing.T) {
+	local, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+
+	assert.Same(t, local, NewInstrumentedStorage(local, nil))
+}
@@ -2,9 +2,15 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"time"
 )
 
+// ErrInvalidRange is returned by RetrieveRange when the range does not start
+// within the content
+var ErrInvalidRange = errors.New("invalid range")
+
 // BlobStorage defines the interface for artifact storage
 type BlobStorage interface {
 	// Store saves content at the given path
@@ -13,6 +19,10 @@ type BlobStorage interface {
 	// Retrieve gets content from the given path
 	Retrieve(ctx context.Context, path string) (io.ReadCloser, error)
 	
+	// RetrieveRange gets up to length bytes of the content at the given path,
+	// starting at offset
+	RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error)
+	
 	// Delete removes content at the given path
 	Delete(ctx context.Context, path string) error
 	
@@ -22,6 +32,9 @@ type BlobStorage interface {
 	// GetSize returns the size of content at the given path
 	GetSize(ctx context.Context, path string) (int64, error)
 	
+	// GetModTime returns when content at the given path was last modified
+	GetModTime(ctx context.Context, path string) (time.Time, error)
+	
 	// List returns paths matching the prefix
 	List(ctx context.Context, prefix string) ([]string, error)
 }
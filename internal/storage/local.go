@@ -14,6 +14,10 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// localStagingDir is where content is written under the base path until it
+// is moved into place
+const localStagingDir = ".staging"
+
 // LocalStorage implements BlobStorage for local filesystem with production-ready features
 type LocalStorage struct {
 	basePath string
@@ -45,9 +49,6 @@ func (ls *LocalStorage) Store(ctx context.Context, path string, content io.Reade
 	default:
 	}
 
-	ls.mutex.Lock()
-	defer ls.mutex.Unlock()
-
 	fullPath := filepath.Join(ls.basePath, path)
 
 	// Ensure the directory exists
@@ -57,13 +58,20 @@ func (ls *LocalStorage) Store(ctx context.Context, path string, content io.Reade
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Create temporary file for atomic write
-	tempPath := fullPath + ".tmp." + fmt.Sprintf("%d", time.Now().UnixNano())
-	tempFile, err := os.Create(tempPath)
+	// Create temporary file for atomic write. Content is written to it
+	// without holding the lock, so a slow writer does not hold up every other
+	// operation, and only moving it into place is locked.
+	stagingDir := filepath.Join(ls.basePath, localStagingDir)
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		log.Error().Err(err).Str("path", path).Str("dir", stagingDir).Msg("failed to create directory")
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tempFile, err := os.CreateTemp(stagingDir, "store-*")
 	if err != nil {
-		log.Error().Err(err).Str("path", path).Str("temp_path", tempPath).Msg("failed to create temporary file")
+		log.Error().Err(err).Str("path", path).Msg("failed to create temporary file")
 		return fmt.Errorf("failed to create temporary file: %w", err)
 	}
+	tempPath := tempFile.Name()
 
 	// Ensure cleanup of temp file on failure
 	defer func() {
@@ -93,7 +101,10 @@ func (ls *LocalStorage) Store(ctx context.Context, path string, content io.Reade
 	tempFile.Close()
 
 	// Atomic move from temp to final location
-	if err := os.Rename(tempPath, fullPath); err != nil {
+	ls.mutex.Lock()
+	err = os.Rename(tempPath, fullPath)
+	ls.mutex.Unlock()
+	if err != nil {
 		log.Error().Err(err).Str("path", path).Str("temp_path", tempPath).Msg("failed to move temporary file to final location")
 		return fmt.Errorf("failed to move file to final location: %w", err)
 	}
@@ -155,6 +166,40 @@ func (ls *LocalStorage) Retrieve(ctx context.Context, path string) (io.ReadClose
 	return file, nil
 }
 
+// fileSection reads part of a file, closing the file when done
+type fileSection struct {
+	*io.SectionReader
+	file *os.File
+}
+
+// Close closes the underlying file
+func (s *fileSection) Close() error {
+	return s.file.Close()
+}
+
+// RetrieveRange gets part of a file from the local filesystem, reading it
+// with ReadAt so the rest of the file is never read
+func (ls *LocalStorage) RetrieveRange(ctx context.Context, path string, offset, length int64) (io.ReadCloser, error) {
+	reader, err := ls.Retrieve(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	file := reader.(*os.File)
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		log.Error().Err(err).Str("path", path).Msg("failed to get file info")
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if offset < 0 || length < 0 || offset >= info.Size() {
+		file.Close()
+		return nil, fmt.Errorf("%w: offset %d of %d bytes", ErrInvalidRange, offset, info.Size())
+	}
+
+	return &fileSection{SectionReader: io.NewSectionReader(file, offset, length), file: file}, nil
+}
+
 // Delete removes content from the local filesystem with concurrent access safety
 func (ls *LocalStorage) Delete(ctx context.Context, path string) error {
 	startTime := time.Now()
@@ -252,6 +297,28 @@ func (ls *LocalStorage) GetSize(ctx context.Context, path string) (int64, error)
 	return size, nil
 }
 
+// GetModTime returns when content in the local filesystem was last modified
+func (ls *LocalStorage) GetModTime(ctx context.Context, path string) (time.Time, error) {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+
+	select {
+	case <-ctx.Done():
+		return time.Time{}, ctx.Err()
+	default:
+	}
+
+	info, err := os.Stat(filepath.Join(ls.basePath, path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, fmt.Errorf("file not found: %s", path)
+		}
+		log.Error().Err(err).Str("path", path).Msg("failed to get file info")
+		return time.Time{}, fmt.Errorf("failed to get file info: %w", err)
+	}
+	return info.ModTime(), nil
+}
+
 // List returns paths matching the prefix in the local filesystem with concurrent access safety
 func (ls *LocalStorage) List(ctx context.Context, prefix string) ([]string, error) {
 	startTime := time.Now()
@@ -285,6 +352,11 @@ func (ls *LocalStorage) List(ctx context.Context, prefix string) ([]string, erro
 			return err
 		}
 
+		// Content still being written is not listed
+		if info.IsDir() && path == filepath.Join(ls.basePath, localStagingDir) {
+			return filepath.SkipDir
+		}
+
 		if !info.IsDir() {
 			relPath, err := filepath.Rel(ls.basePath, path)
 			if err != nil {
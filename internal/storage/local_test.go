@@ -207,6 +207,43 @@ func TestLocalStorage_Retrieve(t *testing.T) {
 	}
 }
 
+func TestLocalStorage_RetrieveRange(t *testing.T) {
+	storage := setupTestStorage(t)
+	ctx := context.Background()
+
+	err := storage.Store(ctx, "range_test.txt", strings.NewReader("0123456789"), "text/plain")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		offset   int64
+		length   int64
+		expected string
+	}{
+		{name: "start", offset: 0, length: 4, expected: "0123"},
+		{name: "middle", offset: 3, length: 2, expected: "34"},
+		{name: "truncated at end", offset: 8, length: 10, expected: "89"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := storage.RetrieveRange(ctx, "range_test.txt", tt.offset, tt.length)
+			require.NoError(t, err)
+			defer reader.Close()
+
+			content, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(content))
+		})
+	}
+
+	_, err = storage.RetrieveRange(ctx, "range_test.txt", 10, 1)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+
+	_, err = storage.RetrieveRange(ctx, "non_existent.txt", 0, 1)
+	assert.ErrorContains(t, err, "file not found")
+}
+
 func TestLocalStorage_Delete(t *testing.T) {
 	storage := setupTestStorage(t)
 	ctx := context.Background()
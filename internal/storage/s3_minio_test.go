@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupMinIOStorage returns S3 storage on the MinIO server at
+// TEST_S3_ENDPOINT, such as the one in deploy/compose/docker-compose.dev.yml,
+// storing content under a prefix of its own in a test bucket. Content larger
+// than the minimum part size is uploaded in parts.
+func setupMinIOStorage(t *testing.T) (*S3Storage, *s3.Client, string) {
+	t.Helper()
+
+	endpoint := os.Getenv("TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_S3_ENDPOINT not set")
+	}
+	accessKey, secretKey := os.Getenv("TEST_S3_ACCESS_KEY"), os.Getenv("TEST_S3_SECRET_KEY")
+	if accessKey == "" && secretKey == "" {
+		accessKey, secretKey = "minioadmin", "minioadmin"
+	}
+
+	cfg := &config.StorageConfig{
+		Type:      "s3",
+		Bucket:    "lodestone-test",
+		Endpoint:  endpoint,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	}
+	s, err := NewS3Storage(cfg)
+	require.NoError(t, err)
+	client := s.client.(*s3.Client)
+
+	ctx := context.Background()
+	_, err = client.CreateBucket(ctx, &s3.CreateBucketInput{Bucket: aws.String(cfg.Bucket)})
+	var owned *s3types.BucketAlreadyOwnedByYou
+	if err != nil && !errors.As(err, &owned) {
+		require.NoError(t, err)
+	}
+
+	return newS3Storage(client, cfg.Bucket, manager.MinUploadPartSize), client, "test/" + uuid.NewString() + "/"
+}
+
+// pendingUploads returns the IDs of multipart uploads under prefix that were
+// neither completed nor aborted
+func pendingUploads(t *testing.T, client *s3.Client, bucket, prefix string) []string {
+	t.Helper()
+
+	output, err := client.ListMultipartUploads(context.Background(), &s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	require.NoError(t, err)
+	var ids []string
+	for _, upload := range output.Uploads {
+		ids = append(ids, aws.ToString(upload.UploadId))
+	}
+	return ids
+}
+
+func TestS3Storage_MinIOLargeMultipartUpload(t *testing.T) {
+	s, client, prefix := setupMinIOStorage(t)
+	ctx := context.Background()
+	path := prefix + "large.bin"
+	t.Cleanup(func() { s.Delete(context.Background(), path) })
+
+	// Three and a half parts, streamed rather than seekable
+	content := make([]byte, 7*manager.MinUploadPartSize/2)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+	require.NoError(t, s.Store(ctx, path, io.MultiReader(bytes.NewReader(content)), "application/octet-stream"))
+
+	size, err := s.GetSize(ctx, path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), size)
+
+	reader, err := s.Retrieve(ctx, path)
+	require.NoError(t, err)
+	stored, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(content, stored), "stored content matches")
+
+	assert.Empty(t, pendingUploads(t, client, s.bucket, prefix))
+
+	// Content within one part is verified the same way
+	small := prefix + "small.bin"
+	t.Cleanup(func() { s.Delete(context.Background(), small) })
+	require.NoError(t, s.Store(ctx, small, bytes.NewReader(content[:1024]), "application/octet-stream"))
+}
+
+func TestS3Storage_MinIOResumedUpload(t *testing.T) {
+	s, client, prefix := setupMinIOStorage(t)
+	ctx := context.Background()
+	path := prefix + "resumed.bin"
+	t.Cleanup(func() { s.Delete(context.Background(), path) })
+
+	content := make([]byte, 3*manager.MinUploadPartSize)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	// The content fails after two parts have been read
+	failing := io.MultiReader(
+		bytes.NewReader(content[:2*manager.MinUploadPartSize+1]),
+		iotest.ErrReader(errors.New("client disconnected")),
+	)
+	err = s.Store(ctx, path, failing, "application/octet-stream")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "client disconnected")
+
+	exists, err := s.Exists(ctx, path)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	pending := pendingUploads(t, client, s.bucket, prefix)
+	require.Len(t, pending, 1, "the failed upload is kept to be resumed")
+	parts, err := s.uploadedParts(ctx, path, pending[0])
+	require.NoError(t, err)
+	assert.Len(t, parts, 2)
+
+	// The retry resumes the upload
+	require.NoError(t, s.Store(ctx, path, bytes.NewReader(content), "application/octet-stream"))
+	reader, err := s.Retrieve(ctx, path)
+	require.NoError(t, err)
+	stored, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(content, stored), "stored content matches")
+	assert.Empty(t, pendingUploads(t, client, s.bucket, prefix))
+}
+
+func TestS3Storage_MinIOAbortedUploadCleanup(t *testing.T) {
+	s, client, prefix := setupMinIOStorage(t)
+	ctx := context.Background()
+	path := prefix + "aborted.bin"
+	t.Cleanup(func() { s.Delete(context.Background(), path) })
+
+	content := io.MultiReader(
+		io.LimitReader(rand.Reader, 2*manager.MinUploadPartSize+1),
+		iotest.ErrReader(errors.New("client disconnected")),
+	)
+	require.Error(t, s.Store(ctx, path, content, "application/octet-stream"))
+	require.Len(t, pendingUploads(t, client, s.bucket, prefix), 1)
+
+	// Once outside the resume window, the upload is aborted rather than
+	// resumed by the next store of the path
+	s.resumeWindow = 0
+	replacement := io.LimitReader(rand.Reader, 2*manager.MinUploadPartSize)
+	require.NoError(t, s.Store(ctx, path, replacement, "application/octet-stream"))
+	assert.Empty(t, pendingUploads(t, client, s.bucket, prefix), "the stale upload was aborted")
+}
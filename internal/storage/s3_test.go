@@ -0,0 +1,721 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3Client is an in-memory s3API
+type fakeS3Client struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	modTimes map[string]time.Time
+	uploads  map[string]map[int32][]byte
+	keys     map[string]string // key of each upload by upload ID
+	pageSize int
+
+	puts        int
+	partUploads int
+	aborted     []string
+	failPart    int32 // part number whose upload fails, 0 for none
+	corrupt     bool  // store content other than what was uploaded
+	noChecksums bool  // report ETags but no checksums, as some S3-compatible services do
+	nextID      int
+
+	// onUploadPart, if set, is called as each part upload starts
+	onUploadPart func(uploadID string, partNumber int32)
+}
+
+func newFakeS3Client() *fakeS3Client {
+	return &fakeS3Client{
+		objects:  map[string][]byte{},
+		modTimes: map[string]time.Time{},
+		uploads:  map[string]map[int32][]byte{},
+		keys:     map[string]string{},
+		pageSize: 1000,
+	}
+}
+
+// s3ResponseError is an error response with the given status, as returned
+// by the SDK
+func s3ResponseError(status int) error {
+	return &awshttp.ResponseError{ResponseError: &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+		Err:      fmt.Errorf("status %d", status),
+	}}
+}
+
+// store keeps an object, corrupting it first if asked to
+func (f *fakeS3Client) store(key string, data []byte) []byte {
+	if f.corrupt && len(data) > 0 {
+		data[0] ^= 0xff
+	}
+	f.objects[key] = data
+	f.modTimes[key] = time.Now()
+	return data
+}
+
+// etag returns the quoted MD5 S3 reports as the ETag of content stored in
+// one request or as one part
+func etag(data []byte) *string {
+	sum := md5.Sum(data)
+	return aws.String(`"` + hex.EncodeToString(sum[:]) + `"`)
+}
+
+// checksum returns the base64-encoded SHA256 S3 reports for content
+func (f *fakeS3Client) checksum(data []byte) *string {
+	if f.noChecksums {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return aws.String(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func (f *fakeS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.puts++
+	body = f.store(*params.Key, body)
+	return &s3.PutObjectOutput{
+		ETag:           etag(body),
+		ChecksumSHA256: f.checksum(body),
+	}, nil
+}
+
+func (f *fakeS3Client) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextID++
+	uploadID := fmt.Sprintf("upload-%d", f.nextID)
+	f.uploads[uploadID] = map[int32][]byte{}
+	f.keys[uploadID] = *params.Key
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(uploadID)}, nil
+}
+
+func (f *fakeS3Client) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if f.onUploadPart != nil {
+		f.onUploadPart(*params.UploadId, aws.ToInt32(params.PartNumber))
+	}
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	partNumber := aws.ToInt32(params.PartNumber)
+	if partNumber == f.failPart {
+		return nil, errors.New("connection reset")
+	}
+	f.partUploads++
+	f.uploads[*params.UploadId][partNumber] = body
+	return &s3.UploadPartOutput{
+		ETag:           etag(body),
+		ChecksumSHA256: f.checksum(body),
+	}, nil
+}
+
+func (f *fakeS3Client) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var assembled, checksums, etags []byte
+	parts := params.MultipartUpload.Parts
+	for i, part := range parts {
+		partNumber := aws.ToInt32(part.PartNumber)
+		data, ok := f.uploads[*params.UploadId][partNumber]
+		if partNumber != int32(i+1) || !ok || aws.ToString(part.ETag) != *etag(data) {
+			return nil, fmt.Errorf("invalid part %d", partNumber)
+		}
+		assembled = append(assembled, data...)
+	}
+
+	// Checksums and ETags of multipart uploads are digests of the digests of
+	// their parts
+	assembled = f.store(*params.Key, assembled)
+	for offset := 0; offset < len(assembled); offset += len(f.uploads[*params.UploadId][1]) {
+		part := assembled[offset:min(offset+len(f.uploads[*params.UploadId][1]), len(assembled))]
+		checksum := sha256.Sum256(part)
+		checksums = append(checksums, checksum[:]...)
+		etag := md5.Sum(part)
+		etags = append(etags, etag[:]...)
+	}
+	delete(f.uploads, *params.UploadId)
+
+	output := &s3.CompleteMultipartUploadOutput{}
+	etag := md5.Sum(etags)
+	output.ETag = aws.String(fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(etag[:]), len(parts)))
+	if checksum := f.checksum(checksums); checksum != nil {
+		output.ChecksumSHA256 = aws.String(fmt.Sprintf("%s-%d", *checksum, len(parts)))
+	}
+	return output, nil
+}
+
+func (f *fakeS3Client) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aborted = append(f.aborted, *params.UploadId)
+	delete(f.uploads, *params.UploadId)
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3Client) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts, ok := f.uploads[*params.UploadId]
+	if !ok || f.keys[*params.UploadId] != *params.Key {
+		return nil, s3ResponseError(http.StatusNotFound)
+	}
+	output := &s3.ListPartsOutput{Key: params.Key, UploadId: params.UploadId}
+	for partNumber, data := range parts {
+		output.Parts = append(output.Parts, s3types.Part{
+			PartNumber:     aws.Int32(partNumber),
+			Size:           aws.Int64(int64(len(data))),
+			ETag:           etag(data),
+			ChecksumSHA256: f.checksum(data),
+		})
+	}
+	return output, nil
+}
+
+func (f *fakeS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[*params.Key]
+	if !ok {
+		return nil, s3ResponseError(http.StatusNotFound)
+	}
+	if params.Range != nil {
+		var start, end int
+		if _, err := fmt.Sscanf(*params.Range, "bytes=%d-%d", &start, &end); err != nil {
+			return nil, err
+		}
+		if start >= len(data) {
+			return nil, s3ResponseError(http.StatusRequestedRangeNotSatisfiable)
+		}
+		data = data[start:min(end+1, len(data))]
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[*params.Key]
+	if !ok {
+		return nil, s3ResponseError(http.StatusNotFound)
+	}
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(data))),
+		LastModified:  aws.Time(f.modTimes[*params.Key]),
+	}, nil
+}
+
+func (f *fakeS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (f *fakeS3Client) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) && key > aws.ToString(params.ContinuationToken) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(len(keys) > f.pageSize)}
+	if len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		output.NextContinuationToken = aws.String(keys[f.pageSize-1])
+	}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, s3types.Object{Key: aws.String(key)})
+	}
+	return output, nil
+}
+
+func TestS3Storage_StoreAndRetrieve(t *testing.T) {
+	client := newFakeS3Client()
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	require.NoError(t, s.Store(ctx, "/npm/small.tgz", strings.NewReader("tiny"), "application/gzip"))
+	assert.Equal(t, 1, client.puts, "content within one part is uploaded in a single request")
+
+	exists, err := s.Exists(ctx, "npm/small.tgz")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	size, err := s.GetSize(ctx, "npm/small.tgz")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), size)
+
+	modTime, err := s.GetModTime(ctx, "npm/small.tgz")
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), modTime, time.Minute)
+
+	reader, err := s.Retrieve(ctx, "npm/small.tgz")
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, "tiny", string(data))
+}
+
+func TestS3Storage_StoreBuffers(t *testing.T) {
+	client := newFakeS3Client()
+	s := newS3Storage(client, "artifacts", defaultS3PartSize)
+	ctx := context.Background()
+
+	// Small content is stored without taking a part buffer
+	allocated := func(store func()) uint64 {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		store()
+		runtime.ReadMemStats(&after)
+		return after.TotalAlloc - before.TotalAlloc
+	}
+	small := allocated(func() {
+		require.NoError(t, s.Store(ctx, "npm/small.tgz", strings.NewReader("tiny"), "application/gzip"))
+	})
+	assert.Less(t, small, uint64(defaultS3PartSize/4))
+
+	// Content past the small read size is read into a part buffer and still
+	// stored in a single request when it fits in one part
+	content := bytes.Repeat([]byte("x"), s3SmallReadSize+1)
+	require.NoError(t, s.Store(ctx, "npm/medium.tgz", bytes.NewReader(content), "application/gzip"))
+	assert.Equal(t, content, client.objects["npm/medium.tgz"])
+	assert.Equal(t, 2, client.puts)
+}
+
+func TestS3Storage_RetrieveRange(t *testing.T) {
+	s := newS3Storage(newFakeS3Client(), "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	require.NoError(t, s.Store(ctx, "npm/pkg.tgz", strings.NewReader("0123456789"), "application/gzip"))
+
+	reader, err := s.RetrieveRange(ctx, "npm/pkg.tgz", 3, 4)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, "3456", string(data))
+
+	_, err = s.RetrieveRange(ctx, "npm/pkg.tgz", 10, 1)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+
+	_, err = s.RetrieveRange(ctx, "npm/missing", 0, 1)
+	assert.ErrorContains(t, err, "file not found")
+}
+
+func TestS3Storage_StoreMultipart(t *testing.T) {
+	client := newFakeS3Client()
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("0123456789"), 1<<20)
+	require.NoError(t, s.Store(ctx, "oci/blob", bytes.NewBuffer(content), "application/octet-stream"))
+	assert.Equal(t, 0, client.puts)
+	assert.Equal(t, content, client.objects["oci/blob"])
+	assert.Empty(t, client.uploads)
+
+	// Content that fills exactly one part still completes
+	exact := bytes.Repeat([]byte("x"), int(manager.MinUploadPartSize))
+	require.NoError(t, s.Store(ctx, "oci/exact", bytes.NewBuffer(exact), "application/octet-stream"))
+	assert.Equal(t, exact, client.objects["oci/exact"])
+}
+
+func TestS3Storage_StoreMultipartResumes(t *testing.T) {
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("0123456789"), 3*int(manager.MinUploadPartSize)/10)
+
+	// Without checksums, parts are matched by their ETags instead
+	for _, noChecksums := range []bool{false, true} {
+		client := newFakeS3Client()
+		client.noChecksums = noChecksums
+		client.failPart = 2
+		s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+
+		err := s.Store(ctx, "oci/blob", bytes.NewReader(content), "application/octet-stream")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "connection reset")
+		assert.Empty(t, client.aborted, "the failed upload is kept to be resumed")
+		assert.Len(t, client.uploads, 1)
+		assert.NotContains(t, client.objects, "oci/blob")
+
+		// Retrying uploads only the parts not already uploaded
+		client.failPart = 0
+		client.partUploads = 0
+		require.NoError(t, s.Store(ctx, "oci/blob", bytes.NewReader(content), "application/octet-stream"))
+		assert.Equal(t, 2, client.partUploads)
+		assert.Equal(t, content, client.objects["oci/blob"])
+		assert.Empty(t, client.uploads)
+		assert.Empty(t, client.aborted)
+	}
+}
+
+func TestS3Storage_StoreMultipartResumesAfterReadFailure(t *testing.T) {
+	client := newFakeS3Client()
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("0123456789"), 3*int(manager.MinUploadPartSize)/10)
+	failing := io.MultiReader(bytes.NewReader(content[:2*manager.MinUploadPartSize]), iotest.ErrReader(errors.New("client disconnected")))
+	err := s.Store(ctx, "oci/blob", failing, "application/octet-stream")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "client disconnected")
+
+	client.partUploads = 0
+	require.NoError(t, s.Store(ctx, "oci/blob", bytes.NewReader(content), "application/octet-stream"))
+	assert.Equal(t, 1, client.partUploads, "only the part never read is uploaded")
+	assert.Equal(t, content, client.objects["oci/blob"])
+	assert.Empty(t, client.uploads)
+}
+
+func TestS3Storage_StoreMultipartResumesChangedContent(t *testing.T) {
+	client := newFakeS3Client()
+	client.failPart = 3
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("x"), 3*int(manager.MinUploadPartSize))
+	require.Error(t, s.Store(ctx, "oci/blob", bytes.NewReader(content), "application/octet-stream"))
+
+	// Parts uploaded with other content are uploaded again
+	changed := bytes.Clone(content)
+	changed[0] = 'y'
+	client.failPart = 0
+	client.partUploads = 0
+	require.NoError(t, s.Store(ctx, "oci/blob", bytes.NewReader(changed), "application/octet-stream"))
+	assert.Equal(t, 2, client.partUploads, "the changed first part and the missing last part are uploaded")
+	assert.Equal(t, changed, client.objects["oci/blob"])
+}
+
+func TestS3Storage_StoreMultipartStartsOverWithoutUpload(t *testing.T) {
+	client := newFakeS3Client()
+	client.failPart = 2
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("x"), 3*int(manager.MinUploadPartSize))
+	require.Error(t, s.Store(ctx, "oci/blob", bytes.NewReader(content), "application/octet-stream"))
+
+	// An upload aborted outside the gateway, such as by a lifecycle rule,
+	// is replaced by a new one
+	client.mu.Lock()
+	clear(client.uploads)
+	client.mu.Unlock()
+	client.failPart = 0
+	client.partUploads = 0
+	require.NoError(t, s.Store(ctx, "oci/blob", bytes.NewReader(content), "application/octet-stream"))
+	assert.Equal(t, 3, client.partUploads)
+	assert.Equal(t, content, client.objects["oci/blob"])
+}
+
+func TestS3Storage_StoreAbortsStaleUploads(t *testing.T) {
+	client := newFakeS3Client()
+	client.failPart = 2
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("x"), 3*int(manager.MinUploadPartSize))
+	require.Error(t, s.Store(ctx, "oci/blob", bytes.NewReader(content), "application/octet-stream"))
+	require.Error(t, s.Store(ctx, "oci/blob2", bytes.NewReader(content), "application/octet-stream"))
+	require.Len(t, client.uploads, 2)
+
+	// A retry that fails again keeps the upload it resumed
+	require.Error(t, s.Store(ctx, "oci/blob2", bytes.NewReader(content), "application/octet-stream"))
+	assert.Empty(t, client.aborted)
+	assert.Len(t, client.uploads, 2)
+
+	// Uploads older than the resume window are aborted rather than resumed,
+	// whatever their path
+	s.resumeWindow = 0
+	client.failPart = 0
+	client.partUploads = 0
+	require.NoError(t, s.Store(ctx, "oci/blob", bytes.NewReader(content), "application/octet-stream"))
+	assert.ElementsMatch(t, []string{"upload-1", "upload-2"}, client.aborted)
+	assert.Equal(t, 3, client.partUploads)
+	assert.Equal(t, content, client.objects["oci/blob"])
+	assert.Empty(t, client.uploads)
+}
+
+func TestS3Storage_StoreMultipartConcurrently(t *testing.T) {
+	client := newFakeS3Client()
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	first := bytes.Repeat([]byte("a"), 3*int(manager.MinUploadPartSize))
+	second := bytes.Repeat([]byte("b"), 3*int(manager.MinUploadPartSize))
+
+	// The first store stalls in its second part until the second store of
+	// the same path has completed
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	client.onUploadPart = func(uploadID string, partNumber int32) {
+		if uploadID == "upload-1" && partNumber == 2 {
+			once.Do(func() {
+				close(started)
+				<-release
+			})
+		}
+	}
+
+	firstErr := make(chan error, 1)
+	go func() {
+		firstErr <- s.Store(ctx, "oci/blob", bytes.NewReader(first), "application/octet-stream")
+	}()
+	<-started
+	require.NoError(t, s.Store(ctx, "oci/blob", bytes.NewReader(second), "application/octet-stream"))
+	assert.Equal(t, second, client.objects["oci/blob"])
+
+	// Each store completes the parts it uploaded itself
+	close(release)
+	require.NoError(t, <-firstErr)
+	assert.Equal(t, first, client.objects["oci/blob"])
+	assert.Empty(t, client.aborted)
+	assert.Empty(t, client.uploads)
+}
+
+func TestS3Storage_StoreMultipartResumedOnce(t *testing.T) {
+	client := newFakeS3Client()
+	client.failPart = 3
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	first := bytes.Repeat([]byte("a"), 3*int(manager.MinUploadPartSize))
+	second := bytes.Repeat([]byte("b"), 3*int(manager.MinUploadPartSize))
+	require.Error(t, s.Store(ctx, "oci/blob", bytes.NewReader(first), "application/octet-stream"))
+	client.failPart = 0
+
+	// The store resuming the failed upload stalls in its last part until a
+	// second store of the same path has completed
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	var secondUploads []string
+	client.onUploadPart = func(uploadID string, partNumber int32) {
+		if uploadID == "upload-1" && partNumber == 3 {
+			once.Do(func() {
+				close(started)
+				<-release
+			})
+			return
+		}
+		secondUploads = append(secondUploads, uploadID)
+	}
+
+	firstErr := make(chan error, 1)
+	go func() {
+		firstErr <- s.Store(ctx, "oci/blob", bytes.NewReader(first), "application/octet-stream")
+	}()
+	<-started
+
+	// The second store does not take over the upload being resumed
+	require.NoError(t, s.Store(ctx, "oci/blob", bytes.NewReader(second), "application/octet-stream"))
+	assert.Equal(t, []string{"upload-2", "upload-2", "upload-2"}, secondUploads)
+	assert.Equal(t, second, client.objects["oci/blob"])
+
+	close(release)
+	require.NoError(t, <-firstErr)
+	assert.Equal(t, first, client.objects["oci/blob"])
+	assert.Empty(t, client.aborted)
+	assert.Empty(t, client.uploads)
+}
+
+func TestS3Storage_StoreVerifiesContent(t *testing.T) {
+	ctx := context.Background()
+	large := bytes.Repeat([]byte("0123456789"), 1<<20)
+
+	for _, tt := range []struct {
+		name    string
+		content []byte
+	}{
+		{"single request", []byte("tiny")},
+		{"multipart", large},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without checksums, the ETag is checked instead
+			for _, noChecksums := range []bool{false, true} {
+				client := newFakeS3Client()
+				client.noChecksums = noChecksums
+				s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+				require.NoError(t, s.Store(ctx, "npm/pkg.tgz", bytes.NewReader(tt.content), "application/gzip"))
+
+				// Content stored other than uploaded is removed
+				client.corrupt = true
+				err := s.Store(ctx, "npm/pkg.tgz", bytes.NewReader(tt.content), "application/gzip")
+				assert.ErrorIs(t, err, ErrDigestMismatch)
+				assert.NotContains(t, client.objects, "npm/pkg.tgz")
+			}
+		})
+	}
+}
+
+func TestS3Storage_NotFound(t *testing.T) {
+	s := newS3Storage(newFakeS3Client(), "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	exists, err := s.Exists(ctx, "missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = s.Retrieve(ctx, "missing")
+	assert.ErrorContains(t, err, "file not found")
+
+	_, err = s.GetSize(ctx, "missing")
+	assert.ErrorContains(t, err, "file not found")
+
+	_, err = s.GetModTime(ctx, "missing")
+	assert.ErrorContains(t, err, "file not found")
+
+	assert.NoError(t, s.Delete(ctx, "missing"))
+}
+
+func TestS3Storage_DeleteAndList(t *testing.T) {
+	client := newFakeS3Client()
+	client.pageSize = 2
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	for _, path := range []string{"npm/a", "npm/b", "npm/c", "npm/d", "nuget/e"} {
+		require.NoError(t, s.Store(ctx, path, strings.NewReader(path), "text/plain"))
+	}
+
+	// Pages of two are followed to the end
+	paths, err := s.List(ctx, "npm/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"npm/a", "npm/b", "npm/c", "npm/d"}, paths)
+
+	require.NoError(t, s.Delete(ctx, "npm/b"))
+	paths, err = s.List(ctx, "npm/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"npm/a", "npm/c", "npm/d"}, paths)
+}
+
+func TestS3Storage_AgainstServer(t *testing.T) {
+	var mu sync.Mutex
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+		mu.Unlock()
+
+		assert.Contains(t, r.Header.Get("Authorization"), "Credential=access/")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+			if r.URL.Query().Get("continuation-token") == "" {
+				fmt.Fprint(w, `<ListBucketResult><Contents><Key>npm/a</Key></Contents><IsTruncated>true</IsTruncated><NextContinuationToken>page2</NextContinuationToken></ListBucketResult>`)
+			} else {
+				fmt.Fprint(w, `<ListBucketResult><Contents><Key>npm/b</Key></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`)
+			}
+		case r.Method == http.MethodPut:
+			// The checksum is sent with the content, and reported back once stored
+			io.Copy(io.Discard, r.Body)
+			assert.Equal(t, "SHA256", r.Header.Get("X-Amz-Sdk-Checksum-Algorithm"))
+			w.Header().Set("ETag", `"etag"`)
+			w.Header().Set("X-Amz-Checksum-Sha256", r.Header.Get("X-Amz-Checksum-Sha256"))
+		case r.Method == http.MethodHead && strings.HasSuffix(r.URL.Path, "/missing"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodHead:
+			w.Header().Set("Content-Length", "10")
+			w.Header().Set("Last-Modified", "Wed, 14 Oct 2026 08:00:00 GMT")
+		case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/missing"):
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`)
+		case r.Method == http.MethodGet && r.Header.Get("Range") == "bytes=10-10":
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			fmt.Fprint(w, `<Error><Code>InvalidRange</Code><Message>The requested range is not satisfiable</Message></Error>`)
+		case r.Method == http.MethodGet:
+			assert.Equal(t, "bytes=2-5", r.Header.Get("Range"))
+			w.Header().Set("Content-Length", strconv.Itoa(4))
+			w.WriteHeader(http.StatusPartialContent)
+			fmt.Fprint(w, "2345")
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		UsePathStyle: true,
+		Credentials:  credentials.NewStaticCredentialsProvider("access", "secret", ""),
+	})
+	s := newS3Storage(client, "artifacts", manager.MinUploadPartSize)
+	ctx := context.Background()
+
+	paths, err := s.List(ctx, "npm/")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"npm/a", "npm/b"}, paths)
+
+	require.NoError(t, s.Store(ctx, "npm/@scope/pkg 1.tgz", strings.NewReader("0123456789"), "application/gzip"))
+
+	exists, err := s.Exists(ctx, "npm/missing")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	size, err := s.GetSize(ctx, "npm/pkg.tgz")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), size)
+
+	modTime, err := s.GetModTime(ctx, "npm/pkg.tgz")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 14, 8, 0, 0, 0, time.UTC), modTime.UTC())
+
+	_, err = s.Retrieve(ctx, "npm/missing")
+	assert.ErrorContains(t, err, "file not found")
+
+	reader, err := s.RetrieveRange(ctx, "npm/pkg.tgz", 2, 4)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, "2345", string(data))
+
+	_, err = s.RetrieveRange(ctx, "npm/pkg.tgz", 10, 1)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+
+	require.NoError(t, s.Delete(ctx, "npm/pkg.tgz"))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Contains(t, requests, "PUT /artifacts/npm/%40scope/pkg%201.tgz")
+	assert.Contains(t, requests, "DELETE /artifacts/npm/pkg.tgz")
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrDigestMismatch is returned by StoreVerified when content does not match
+// the digest it was expected to have
+var ErrDigestMismatch = errors.New("content does not match its digest")
+
+// StoreVerified streams content into storage at path, computing its SHA256
+// as it is written so the content is never buffered whole. If expectedSHA256
+// is set and the content does not match it, the stored content is removed
+// and ErrDigestMismatch returned. It returns the size and hex-encoded SHA256
+// of the content.
+func StoreVerified(ctx context.Context, blobStorage BlobStorage, path string, content io.Reader, contentType, expectedSHA256 string) (int64, string, error) {
+	hasher := sha256.New()
+	counter := &countingWriter{}
+	tee := io.TeeReader(content, io.MultiWriter(hasher, counter))
+	if err := blobStorage.Store(ctx, path, tee, contentType); err != nil {
+		return 0, "", err
+	}
+
+	actual := hex.EncodeToString(hasher.Sum(nil))
+	if expectedSHA256 != "" && !strings.EqualFold(actual, expectedSHA256) {
+		if err := blobStorage.Delete(ctx, path); err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("Failed to remove content that did not match its digest")
+		}
+		return 0, "", fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, expectedSHA256, actual)
+	}
+	return counter.n, actual, nil
+}
+
+// Move moves content from one path of a storage backend to another,
+// streaming it rather than reading it into memory
+func Move(ctx context.Context, blobStorage BlobStorage, from, to, contentType string) error {
+	reader, err := blobStorage.Retrieve(ctx, from)
+	if err != nil {
+		return err
+	}
+	err = blobStorage.Store(ctx, to, reader, contentType)
+	reader.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := blobStorage.Delete(ctx, from); err != nil {
+		log.Warn().Err(err).Str("path", from).Msg("Failed to remove moved content")
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// patternReader produces size bytes of a repeating pattern without holding
+// them in memory
+type patternReader struct {
+	remaining int64
+	offset    int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	for i := range p {
+		p[i] = byte((r.offset + i) % 251)
+	}
+	r.offset = (r.offset + len(p)) % 251
+	r.remaining -= int64(len(p))
+	return len(p), nil
+}
+
+func TestStoreVerified_StreamsLargeContent(t *testing.T) {
+	blobStorage, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	const size = 64 << 20
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, &patternReader{remaining: size})
+	require.NoError(t, err)
+	expected := hex.EncodeToString(hasher.Sum(nil))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	written, digest, err := StoreVerified(ctx, blobStorage, "large/blob", &patternReader{remaining: size}, "application/octet-stream", expected)
+	runtime.ReadMemStats(&after)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(size), written)
+	assert.Equal(t, expected, digest)
+	// Streaming allocates a small buffer at a time, not the whole content
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(size/8))
+
+	stored, err := blobStorage.GetSize(ctx, "large/blob")
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), stored)
+}
+
+func TestStoreVerified_DigestMismatch(t *testing.T) {
+	blobStorage, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, _, err = StoreVerified(ctx, blobStorage, "blob", strings.NewReader("tampered"), "text/plain", strings.Repeat("0", 64))
+	assert.ErrorIs(t, err, ErrDigestMismatch)
+
+	exists, err := blobStorage.Exists(ctx, "blob")
+	require.NoError(t, err)
+	assert.False(t, exists, "content that does not match its digest is removed")
+
+	// Without an expected digest any content is stored
+	written, digest, err := StoreVerified(ctx, blobStorage, "blob", strings.NewReader("content"), "text/plain", "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), written)
+	sum := sha256.Sum256([]byte("content"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), digest)
+}
+
+func TestMove(t *testing.T) {
+	blobStorage, err := NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, blobStorage.Store(ctx, "from", strings.NewReader("content"), "text/plain"))
+	require.NoError(t, Move(ctx, blobStorage, "from", "to", "text/plain"))
+
+	exists, err := blobStorage.Exists(ctx, "from")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	reader, err := blobStorage.Retrieve(ctx, "to")
+	require.NoError(t, err)
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(content))
+}
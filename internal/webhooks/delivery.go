@@ -0,0 +1,160 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+)
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Lodestone-Event"
+	DeliveryHeader  = "X-Lodestone-Delivery"
+	SignatureHeader = "X-Lodestone-Signature"
+)
+
+// Delivery defaults: an endpoint is retried for about 30 seconds in total
+// before the delivery is abandoned
+const (
+	defaultMaxAttempts = 5
+	defaultRetryDelay  = 2 * time.Second
+	defaultTimeout     = 10 * time.Second
+)
+
+// Payload is the JSON body delivered to subscribers
+type Payload struct {
+	ID        uuid.UUID      `json:"id"`
+	Event     string         `json:"event"`
+	Timestamp time.Time      `json:"timestamp"`
+	Actor     uuid.UUID      `json:"actor"`
+	Package   PayloadPackage `json:"package"`
+	Reason    string         `json:"reason,omitempty"` // given when a publish is rejected
+}
+
+// PayloadPackage identifies the package version an event is about
+type PayloadPackage struct {
+	Registry string `json:"registry"`
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+// newPayload describes an event of eventType about artifact as it happened at now
+func newPayload(eventType string, artifact *types.Artifact, actor uuid.UUID, now time.Time) Payload {
+	return Payload{
+		ID:        uuid.New(),
+		Event:     eventType,
+		Timestamp: now.UTC(),
+		Actor:     actor,
+		Package: PayloadPackage{
+			Registry: artifact.Registry,
+			Name:     artifact.Name,
+			Version:  artifact.Version,
+			Size:     artifact.Size,
+			SHA256:   artifact.SHA256,
+		},
+	}
+}
+
+// Sign returns the signature header value of body for a secret: the hex
+// HMAC-SHA256 of the body prefixed by "sha256="
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliverer posts payloads to subscribers, retrying failures with
+// exponential backoff
+type deliverer struct {
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration // delay before the first retry, doubled for each one after
+	wg          sync.WaitGroup
+}
+
+func newDeliverer() *deliverer {
+	return &deliverer{
+		client:      &http.Client{Timeout: defaultTimeout},
+		maxAttempts: defaultMaxAttempts,
+		retryDelay:  defaultRetryDelay,
+	}
+}
+
+// deliver posts a payload to a subscription until it is accepted, rejected,
+// or the attempts run out
+func (d *deliverer) deliver(ctx context.Context, subscription *types.WebhookSubscription, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Str("event", payload.Event).Msg("Failed to encode webhook payload")
+		return
+	}
+	delivery := uuid.New().String()
+
+	delay := d.retryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(ctx, subscription, payload.Event, delivery, body)
+		if err == nil {
+			return
+		}
+
+		logEvent := log.Warn().Err(err).
+			Str("subscription", subscription.ID.String()).
+			Str("delivery", delivery).
+			Str("event", payload.Event).
+			Int("attempt", attempt)
+		if !retry || attempt >= d.maxAttempts {
+			logEvent.Msg("Webhook delivery failed, giving up")
+			return
+		}
+		logEvent.Dur("retry_in", delay).Msg("Webhook delivery failed, retrying")
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+		delay *= 2
+	}
+}
+
+// post makes a single delivery attempt, reporting whether a failure may
+// succeed if retried
+func (d *deliverer) post(ctx context.Context, subscription *types.WebhookSubscription, event, delivery string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Lodestone-Webhooks")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, delivery)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,225 @@
+// Package webhooks notifies subscribed HTTP endpoints of package lifecycle
+// and publish approval events
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrSubscriptionNotFound is returned when no webhook subscription has the requested ID
+	ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+	// ErrInvalidSubscription is returned when a subscription's URL, secret or events are invalid
+	ErrInvalidSubscription = errors.New("invalid webhook subscription")
+)
+
+// Events lists the event types subscriptions can receive
+var Events = []string{
+	registry.EventPackagePublished,
+	registry.EventPackageDeleted,
+	registry.ApprovalEventSubmitted,
+	registry.ApprovalEventApproved,
+	registry.ApprovalEventRejected,
+}
+
+// Service stores webhook subscriptions and delivers events to them
+type Service struct {
+	db        *gorm.DB
+	deliverer *deliverer
+	auditLog  *audit.Service
+}
+
+// NewService creates a webhook service storing subscriptions in db
+func NewService(db *gorm.DB) *Service {
+	return &Service{
+		db:        db,
+		deliverer: newDeliverer(),
+	}
+}
+
+// SetAuditLog sets the audit trail subscription changes are recorded to
+func (s *Service) SetAuditLog(auditLog *audit.Service) {
+	s.auditLog = auditLog
+}
+
+// ListSubscriptions returns every webhook subscription, oldest first
+func (s *Service) ListSubscriptions(ctx context.Context) ([]types.WebhookSubscription, error) {
+	var subscriptions []types.WebhookSubscription
+	if err := s.db.WithContext(ctx).Order("created_at").Find(&subscriptions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+	return subscriptions, nil
+}
+
+// GetSubscription returns a webhook subscription by ID
+func (s *Service) GetSubscription(ctx context.Context, id uuid.UUID) (*types.WebhookSubscription, error) {
+	var subscription types.WebhookSubscription
+	if err := s.db.WithContext(ctx).Where("id = ?", id).First(&subscription).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+	return &subscription, nil
+}
+
+// CreateSubscription validates and stores a new webhook subscription
+func (s *Service) CreateSubscription(ctx context.Context, subscription *types.WebhookSubscription, createdBy uuid.UUID) error {
+	if err := validateSubscription(subscription); err != nil {
+		return err
+	}
+	subscription.CreatedBy = &createdBy
+
+	if err := s.db.WithContext(ctx).Create(subscription).Error; err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	s.auditLog.Record(ctx, createdBy, audit.ActionWebhookCreate, subscription.ID.String(), subscriptionDetails(subscription))
+	return nil
+}
+
+// UpdateSubscription replaces an existing webhook subscription. An empty
+// secret keeps the current one.
+func (s *Service) UpdateSubscription(ctx context.Context, subscription *types.WebhookSubscription, updatedBy uuid.UUID) error {
+	existing, err := s.GetSubscription(ctx, subscription.ID)
+	if err != nil {
+		return err
+	}
+	if subscription.Secret == "" {
+		subscription.Secret = existing.Secret
+	}
+	if err := validateSubscription(subscription); err != nil {
+		return err
+	}
+	subscription.CreatedBy = existing.CreatedBy
+	subscription.CreatedAt = existing.CreatedAt
+
+	if err := s.db.WithContext(ctx).Save(subscription).Error; err != nil {
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+	s.auditLog.Record(ctx, updatedBy, audit.ActionWebhookUpdate, subscription.ID.String(), subscriptionDetails(subscription))
+	return nil
+}
+
+// DeleteSubscription removes a webhook subscription
+func (s *Service) DeleteSubscription(ctx context.Context, id uuid.UUID, deletedBy uuid.UUID) error {
+	result := s.db.WithContext(ctx).Where("id = ?", id).Delete(&types.WebhookSubscription{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSubscriptionNotFound
+	}
+	s.auditLog.Record(ctx, deletedBy, audit.ActionWebhookDelete, id.String(), nil)
+	return nil
+}
+
+// subscriptionDetails describes a subscription in the audit trail, leaving
+// out its secret
+func subscriptionDetails(subscription *types.WebhookSubscription) map[string]interface{} {
+	return map[string]interface{}{
+		"url":        subscription.URL,
+		"events":     subscription.Events,
+		"registries": subscription.Registries,
+		"active":     subscription.Active,
+	}
+}
+
+// NotifyEvent delivers a package event to every active subscription that
+// matches it. Subscriptions are looked up and delivered to in the
+// background, so the caller is never delayed by slow or failing endpoints.
+func (s *Service) NotifyEvent(ctx context.Context, event registry.PackageEvent) {
+	s.notify(ctx, newPayload(event.Type, event.Artifact, event.Actor, time.Now()))
+}
+
+// NotifyApproval delivers a publish approval event to every active
+// subscription that matches it, in the background like NotifyEvent, so
+// approvers can be told when uploads await review
+func (s *Service) NotifyApproval(ctx context.Context, event registry.ApprovalEvent) {
+	payload := newPayload(event.Type, event.Artifact, event.Actor, time.Now())
+	payload.Reason = event.Reason
+	s.notify(ctx, payload)
+}
+
+// notify delivers payload to the matching subscriptions in the background
+func (s *Service) notify(ctx context.Context, payload Payload) {
+	ctx = context.WithoutCancel(ctx)
+
+	s.deliverer.wg.Add(1)
+	go func() {
+		defer s.deliverer.wg.Done()
+
+		subscriptions, err := s.matchingSubscriptions(ctx, payload.Event, payload.Package.Registry)
+		if err != nil {
+			log.Error().Err(err).Str("event", payload.Event).Msg("Failed to load webhook subscriptions")
+			return
+		}
+		for i := range subscriptions {
+			s.deliverer.deliver(ctx, &subscriptions[i], payload)
+		}
+	}()
+}
+
+// Wait blocks until every pending delivery has succeeded or given up
+func (s *Service) Wait() {
+	s.deliverer.wg.Wait()
+}
+
+// matchingSubscriptions returns the active subscriptions that receive events
+// of eventType for a registry
+func (s *Service) matchingSubscriptions(ctx context.Context, eventType, registryType string) ([]types.WebhookSubscription, error) {
+	var active []types.WebhookSubscription
+	if err := s.db.WithContext(ctx).Where("active = ?", true).Find(&active).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+
+	// Filters are stored as JSON, so they are applied here rather than in the query
+	var matching []types.WebhookSubscription
+	for _, subscription := range active {
+		if subscriptionMatches(&subscription, eventType, registryType) {
+			matching = append(matching, subscription)
+		}
+	}
+	return matching, nil
+}
+
+// subscriptionMatches reports whether a subscription receives events of
+// eventType for a registry. Empty filters match everything.
+func subscriptionMatches(subscription *types.WebhookSubscription, eventType, registryType string) bool {
+	if len(subscription.Events) > 0 && !slices.Contains(subscription.Events, eventType) {
+		return false
+	}
+	if len(subscription.Registries) > 0 && !slices.Contains(subscription.Registries, registryType) {
+		return false
+	}
+	return true
+}
+
+// validateSubscription checks that a subscription can be delivered to
+func validateSubscription(subscription *types.WebhookSubscription) error {
+	target, err := url.Parse(subscription.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidSubscription)
+	}
+	if subscription.Secret == "" {
+		return fmt.Errorf("%w: secret is required", ErrInvalidSubscription)
+	}
+	for _, event := range subscription.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("%w: unknown event %q", ErrInvalidSubscription, event)
+		}
+	}
+	return nil
+}
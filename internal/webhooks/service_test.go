@@ -0,0 +1,309 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/internal/audit"
+	"github.com/lgulliver/lodestone/internal/common"
+	"github.com/lgulliver/lodestone/internal/registry"
+	"github.com/lgulliver/lodestone/internal/storage"
+	"github.com/lgulliver/lodestone/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// receivedDelivery is a request captured by a test receiver
+type receivedDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver records the deliveries made to it
+type receiver struct {
+	mu         sync.Mutex
+	deliveries []receivedDelivery
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deliveries = append(r.deliveries, receivedDelivery{header: req.Header.Clone(), body: body})
+}
+
+func (r *receiver) received() []receivedDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedDelivery(nil), r.deliveries...)
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// Deliveries query from another goroutine, so share the single in-memory database
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	require.NoError(t, db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.BlobRef{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{},
+		&types.RegistrySetting{}, &types.Permission{}, &types.WebhookSubscription{}, &types.Quota{}, &types.AuditEntry{}))
+	return db
+}
+
+func setupTestService(t *testing.T) *Service {
+	t.Helper()
+
+	service := NewService(setupTestDB(t))
+	service.deliverer.retryDelay = time.Millisecond
+	return service
+}
+
+func createSubscription(t *testing.T, service *Service, subscription *types.WebhookSubscription) {
+	t.Helper()
+	subscription.Active = true
+	require.NoError(t, service.CreateSubscription(context.Background(), subscription, uuid.New()))
+}
+
+func packageEvent(eventType, registryType string) registry.PackageEvent {
+	return registry.PackageEvent{
+		Type:     eventType,
+		Artifact: &types.Artifact{Name: "left-pad", Version: "1.0.0", Registry: registryType},
+		Actor:    uuid.New(),
+	}
+}
+
+func TestNotifyEvent_DeliversAfterUpload(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: "maven", Enabled: true}).Error)
+	user := &types.User{Username: "publisher", Email: "publisher@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, db.Create(user).Error)
+
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	registryService := registry.NewService(&common.Database{DB: db}, localStorage)
+
+	webhookService := NewService(db)
+	registryService.SetEventNotifier(webhookService)
+
+	target := &receiver{}
+	server := httptest.NewServer(target)
+	defer server.Close()
+	createSubscription(t, webhookService, &types.WebhookSubscription{URL: server.URL, Secret: "s3cret"})
+
+	artifact, err := registryService.Upload(context.Background(), "maven", "com.example:app", "1.0.0",
+		bytes.NewReader([]byte("jar content")), user.ID)
+	require.NoError(t, err)
+	webhookService.Wait()
+
+	deliveries := target.received()
+	require.Len(t, deliveries, 1)
+	delivery := deliveries[0]
+	assert.Equal(t, registry.EventPackagePublished, delivery.header.Get(EventHeader))
+	assert.NotEmpty(t, delivery.header.Get(DeliveryHeader))
+	assert.Equal(t, Sign("s3cret", delivery.body), delivery.header.Get(SignatureHeader))
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(delivery.body, &payload))
+	assert.Equal(t, registry.EventPackagePublished, payload.Event)
+	assert.Equal(t, user.ID, payload.Actor)
+	assert.Equal(t, PayloadPackage{
+		Registry: "maven",
+		Name:     "com.example:app",
+		Version:  "1.0.0",
+		Size:     artifact.Size,
+		SHA256:   artifact.SHA256,
+	}, payload.Package)
+
+	require.NoError(t, registryService.Delete(context.Background(), "maven", "com.example:app", "1.0.0", user.ID))
+	webhookService.Wait()
+
+	deliveries = target.received()
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, registry.EventPackageDeleted, deliveries[1].header.Get(EventHeader))
+}
+
+func TestNotifyApproval_DeliversReviewEvents(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: "maven", Enabled: true, RequireApproval: true}).Error)
+	publisher := &types.User{Username: "publisher", Email: "publisher@example.com", Password: "hashed", IsActive: true}
+	require.NoError(t, db.Create(publisher).Error)
+	approver := &types.User{Username: "approver", Email: "approver@example.com", Password: "hashed", IsActive: true, IsAdmin: true}
+	require.NoError(t, db.Create(approver).Error)
+
+	localStorage, err := storage.NewLocalStorage(t.TempDir())
+	require.NoError(t, err)
+	registryService := registry.NewService(&common.Database{DB: db}, localStorage)
+
+	webhookService := NewService(db)
+	registryService.SetApprovalNotifier(webhookService)
+
+	target := &receiver{}
+	server := httptest.NewServer(target)
+	defer server.Close()
+	createSubscription(t, webhookService, &types.WebhookSubscription{URL: server.URL, Secret: "s3cret",
+		Events: []string{registry.ApprovalEventSubmitted, registry.ApprovalEventRejected}})
+
+	artifact, err := registryService.Upload(context.Background(), "maven", "com.example:app", "1.0.0",
+		bytes.NewReader([]byte("jar content")), publisher.ID)
+	require.NoError(t, err)
+	webhookService.Wait()
+	require.NoError(t, registryService.RejectArtifact(context.Background(), artifact.ID, approver.ID, "licence not cleared"))
+	webhookService.Wait()
+
+	deliveries := target.received()
+	require.Len(t, deliveries, 2)
+
+	var submitted, rejected Payload
+	require.NoError(t, json.Unmarshal(deliveries[0].body, &submitted))
+	assert.Equal(t, registry.ApprovalEventSubmitted, submitted.Event)
+	assert.Equal(t, publisher.ID, submitted.Actor)
+	assert.Equal(t, "com.example:app", submitted.Package.Name)
+	assert.Empty(t, submitted.Reason)
+
+	require.NoError(t, json.Unmarshal(deliveries[1].body, &rejected))
+	assert.Equal(t, registry.ApprovalEventRejected, rejected.Event)
+	assert.Equal(t, approver.ID, rejected.Actor)
+	assert.Equal(t, "licence not cleared", rejected.Reason)
+	assert.Equal(t, Sign("s3cret", deliveries[1].body), deliveries[1].header.Get(SignatureHeader))
+}
+
+func TestNotifyEvent_Filters(t *testing.T) {
+	service := setupTestService(t)
+
+	target := &receiver{}
+	server := httptest.NewServer(target)
+	defer server.Close()
+
+	createSubscription(t, service, &types.WebhookSubscription{URL: server.URL + "/npm", Secret: "s", Registries: []string{"npm"}})
+	createSubscription(t, service, &types.WebhookSubscription{URL: server.URL + "/deleted", Secret: "s", Events: []string{registry.EventPackageDeleted}})
+	inactive := &types.WebhookSubscription{URL: server.URL + "/inactive", Secret: "s"}
+	createSubscription(t, service, inactive)
+	inactive.Active = false
+	require.NoError(t, service.UpdateSubscription(context.Background(), inactive, uuid.New()))
+
+	service.NotifyEvent(context.Background(), packageEvent(registry.EventPackagePublished, "npm"))
+	service.NotifyEvent(context.Background(), packageEvent(registry.EventPackageDeleted, "nuget"))
+	service.Wait()
+
+	var delivered []string
+	for _, delivery := range target.received() {
+		var payload Payload
+		require.NoError(t, json.Unmarshal(delivery.body, &payload))
+		delivered = append(delivered, payload.Event+" "+payload.Package.Registry)
+	}
+	assert.ElementsMatch(t, []string{"package.published npm", "package.deleted nuget"}, delivered)
+}
+
+func TestNotifyEvent_RetriesWithBackoff(t *testing.T) {
+	service := setupTestService(t)
+
+	var attempts atomic.Int32
+	var deliveryIDs sync.Map
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deliveryIDs.Store(r.Header.Get(DeliveryHeader), true)
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	createSubscription(t, service, &types.WebhookSubscription{URL: server.URL, Secret: "s"})
+
+	service.NotifyEvent(context.Background(), packageEvent(registry.EventPackagePublished, "npm"))
+	service.Wait()
+	assert.Equal(t, int32(3), attempts.Load(), "server errors are retried until accepted")
+
+	ids := 0
+	deliveryIDs.Range(func(key, value any) bool { ids++; return true })
+	assert.Equal(t, 1, ids, "retries reuse the delivery ID")
+}
+
+func TestNotifyEvent_GivesUp(t *testing.T) {
+	service := setupTestService(t)
+	service.deliverer.maxAttempts = 3
+
+	var failing, rejected atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/rejected" {
+			rejected.Add(1)
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		failing.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	createSubscription(t, service, &types.WebhookSubscription{URL: server.URL + "/failing", Secret: "s"})
+	createSubscription(t, service, &types.WebhookSubscription{URL: server.URL + "/rejected", Secret: "s"})
+
+	service.NotifyEvent(context.Background(), packageEvent(registry.EventPackagePublished, "npm"))
+	service.Wait()
+	assert.Equal(t, int32(3), failing.Load())
+	assert.Equal(t, int32(1), rejected.Load(), "client errors are not retried")
+}
+
+func TestSubscriptionCRUD(t *testing.T) {
+	service := setupTestService(t)
+	auditLog := audit.NewService(service.db)
+	service.SetAuditLog(auditLog)
+	ctx := context.Background()
+	admin := uuid.New()
+
+	for _, invalid := range []*types.WebhookSubscription{
+		{URL: "ftp://example.com/hook", Secret: "s"},
+		{URL: "/relative", Secret: "s"},
+		{URL: "https://example.com/hook"},
+		{URL: "https://example.com/hook", Secret: "s", Events: []string{"package.renamed"}},
+	} {
+		assert.ErrorIs(t, service.CreateSubscription(ctx, invalid, uuid.New()), ErrInvalidSubscription, invalid.URL)
+	}
+
+	subscription := &types.WebhookSubscription{URL: "https://example.com/hook", Secret: "s", Active: true, Registries: []string{"npm"}}
+	require.NoError(t, service.CreateSubscription(ctx, subscription, admin))
+
+	// Updating without a secret keeps the current one
+	update := &types.WebhookSubscription{ID: subscription.ID, URL: "https://example.com/other", Active: true}
+	require.NoError(t, service.UpdateSubscription(ctx, update, admin))
+	stored, err := service.GetSubscription(ctx, subscription.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/other", stored.URL)
+	assert.Equal(t, "s", stored.Secret)
+	assert.Empty(t, stored.Registries)
+	assert.Equal(t, subscription.CreatedBy, stored.CreatedBy)
+
+	subscriptions, err := service.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	assert.Len(t, subscriptions, 1)
+
+	require.NoError(t, service.DeleteSubscription(ctx, subscription.ID, admin))
+	assert.ErrorIs(t, service.DeleteSubscription(ctx, subscription.ID, admin), ErrSubscriptionNotFound)
+	_, err = service.GetSubscription(ctx, subscription.ID)
+	assert.ErrorIs(t, err, ErrSubscriptionNotFound)
+	assert.ErrorIs(t, service.UpdateSubscription(ctx, update, admin), ErrSubscriptionNotFound)
+
+	// Each successful change is audited, failed ones are not
+	entries, total, err := auditLog.Query(ctx, audit.Filter{ActorID: &admin})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	actions := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		assert.Equal(t, subscription.ID.String(), entry.Target)
+		actions = append(actions, entry.Action)
+	}
+	assert.ElementsMatch(t, []string{audit.ActionWebhookCreate, audit.ActionWebhookUpdate, audit.ActionWebhookDelete}, actions)
+	assert.NotContains(t, entries[0].Details, "secret")
+}
@@ -0,0 +1,140 @@
+// Package checksum verifies the checksums clients send with uploads, either a
+// Content-Digest of the request body (RFC 9530) or the X-Checksum-Sha256 of
+// the artifact, so corrupted uploads are rejected instead of stored
+package checksum
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// ErrMismatch is returned when content does not match the checksum the client
+// supplied with it
+var ErrMismatch = errors.New("checksum mismatch")
+
+// Digest is a checksum of content with a named algorithm
+type Digest struct {
+	Algorithm string // as named in Content-Digest, such as "sha-256"
+	Sum       []byte
+}
+
+// String formats the digest as a Content-Digest field member
+func (d Digest) String() string {
+	return d.Algorithm + "=:" + base64.StdEncoding.EncodeToString(d.Sum) + ":"
+}
+
+// contentDigestAlgorithms are the Content-Digest algorithms that are verified,
+// strongest first
+var contentDigestAlgorithms = []struct {
+	name string
+	new  func() hash.Hash
+}{
+	{"sha-512", sha512.New},
+	{"sha-256", sha256.New},
+}
+
+// ParseContentDigest parses a Content-Digest header, such as
+// "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", returning the
+// digest with the strongest supported algorithm. ok is false when the header
+// only names algorithms that are not supported, which are ignored as RFC 9530
+// allows.
+func ParseContentDigest(header string) (digest Digest, ok bool, err error) {
+	members := make(map[string]string)
+	for _, member := range strings.Split(header, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(member), "=")
+		if !found {
+			return Digest{}, false, fmt.Errorf("invalid Content-Digest member %q", member)
+		}
+		members[strings.ToLower(strings.TrimSpace(name))] = strings.TrimSpace(value)
+	}
+
+	for _, algorithm := range contentDigestAlgorithms {
+		value, listed := members[algorithm.name]
+		if !listed {
+			continue
+		}
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return Digest{}, false, fmt.Errorf("invalid Content-Digest %s value: expected :base64:", algorithm.name)
+		}
+		sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil || len(sum) != algorithm.new().Size() {
+			return Digest{}, false, fmt.Errorf("invalid Content-Digest %s value", algorithm.name)
+		}
+		return Digest{Algorithm: algorithm.name, Sum: sum}, true, nil
+	}
+	return Digest{}, false, nil
+}
+
+// ParseSHA256 parses a hex-encoded SHA256 checksum, as sent in an
+// X-Checksum-Sha256 header
+func ParseSHA256(value string) ([]byte, error) {
+	sum, err := hex.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(sum) != sha256.Size {
+		return nil, errors.New("expected a hex-encoded SHA256 checksum")
+	}
+	return sum, nil
+}
+
+// NewVerifyingReader returns a reader of r that fails with ErrMismatch in
+// place of io.EOF if what was read does not match digest, so content is
+// rejected by whatever reads it to the end before it is used
+func NewVerifyingReader(r io.ReadCloser, digest Digest) io.ReadCloser {
+	verifier := &verifyingReader{ReadCloser: r, expected: digest}
+	for _, algorithm := range contentDigestAlgorithms {
+		if algorithm.name == digest.Algorithm {
+			verifier.hash = algorithm.new()
+		}
+	}
+	return verifier
+}
+
+type verifyingReader struct {
+	io.ReadCloser
+	hash     hash.Hash
+	expected Digest
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if sum := r.hash.Sum(nil); !bytes.Equal(sum, r.expected.Sum) {
+			return n, fmt.Errorf("%w: request body does not match Content-Digest %s", ErrMismatch, r.expected.Algorithm)
+		}
+	}
+	return n, err
+}
+
+// Verify checks that the SHA256 of content, already computed by the caller,
+// matches the checksum supplied with it in ctx, if any
+func Verify(ctx context.Context, sha256Sum []byte) error {
+	expected := ExpectedSHA256FromContext(ctx)
+	if expected == nil || bytes.Equal(expected, sha256Sum) {
+		return nil
+	}
+	return fmt.Errorf("%w: expected SHA256 %x, got %x", ErrMismatch, expected, sha256Sum)
+}
+
+type expectedSHA256Key struct{}
+
+// WithExpectedSHA256 returns a context carrying the SHA256 the client
+// supplied for the artifact it uploads
+func WithExpectedSHA256(ctx context.Context, sum []byte) context.Context {
+	return context.WithValue(ctx, expectedSHA256Key{}, sum)
+}
+
+// ExpectedSHA256FromContext returns the SHA256 supplied with an upload, or
+// nil if there is none
+func ExpectedSHA256FromContext(ctx context.Context) []byte {
+	sum, _ := ctx.Value(expectedSHA256Key{}).([]byte)
+	return sum
+}
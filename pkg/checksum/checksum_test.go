@@ -0,0 +1,88 @@
+package checksum
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseContentDigest(t *testing.T) {
+	sha256Sum := sha256.Sum256([]byte("content"))
+	sha512Sum := sha512.Sum512([]byte("content"))
+	sha256Value := ":" + base64.StdEncoding.EncodeToString(sha256Sum[:]) + ":"
+	sha512Value := ":" + base64.StdEncoding.EncodeToString(sha512Sum[:]) + ":"
+
+	tests := []struct {
+		name    string
+		header  string
+		want    Digest
+		ok      bool
+		wantErr bool
+	}{
+		{"sha-256", "sha-256=" + sha256Value, Digest{"sha-256", sha256Sum[:]}, true, false},
+		{"strongest preferred", "sha-256=" + sha256Value + ", sha-512=" + sha512Value, Digest{"sha-512", sha512Sum[:]}, true, false},
+		{"algorithm case-insensitive", "SHA-256=" + sha256Value, Digest{"sha-256", sha256Sum[:]}, true, false},
+		{"unsupported ignored", "md5=:1B2M2Y8AsgTpgAmY7PhCfg==:", Digest{}, false, false},
+		{"unsupported alongside supported", "md5=:1B2M2Y8AsgTpgAmY7PhCfg==:, sha-256=" + sha256Value, Digest{"sha-256", sha256Sum[:]}, true, false},
+		{"not a byte sequence", "sha-256=" + strings.Trim(sha256Value, ":"), Digest{}, false, true},
+		{"not base64", "sha-256=:not base64:", Digest{}, false, true},
+		{"wrong length", "sha-256=:" + base64.StdEncoding.EncodeToString([]byte("short")) + ":", Digest{}, false, true},
+		{"malformed member", "sha-256", Digest{}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest, ok, err := ParseContentDigest(tt.header)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, digest)
+		})
+	}
+}
+
+func TestParseSHA256(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+
+	parsed, err := ParseSHA256(" ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73 ")
+	require.NoError(t, err)
+	assert.Equal(t, sum[:], parsed)
+
+	for _, value := range []string{"not hex", "abcd", ""} {
+		_, err := ParseSHA256(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+	digest := Digest{Algorithm: "sha-256", Sum: sum[:]}
+
+	read, err := io.ReadAll(NewVerifyingReader(io.NopCloser(strings.NewReader("content")), digest))
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(read))
+
+	_, err = io.ReadAll(NewVerifyingReader(io.NopCloser(strings.NewReader("corrupted")), digest))
+	assert.ErrorIs(t, err, ErrMismatch)
+}
+
+func TestVerify(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+	other := sha256.Sum256([]byte("other"))
+
+	assert.NoError(t, Verify(context.Background(), sum[:]), "no checksum supplied")
+
+	ctx := WithExpectedSHA256(context.Background(), sum[:])
+	assert.NoError(t, Verify(ctx, sum[:]))
+	assert.ErrorIs(t, Verify(ctx, other[:]), ErrMismatch)
+}
@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -12,21 +14,28 @@ import (
 
 // Config holds the configuration for all services
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
-	Redis    RedisConfig    `yaml:"redis"`
-	Storage  StorageConfig  `yaml:"storage"`
-	Auth     AuthConfig     `yaml:"auth"`
-	Logging  LoggingConfig  `yaml:"logging"`
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Redis     RedisConfig     `yaml:"redis"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Registry  RegistryConfig  `yaml:"registry"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Scanning  ScanningConfig  `yaml:"scanning"`
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Host         string        `yaml:"host"`
-	Port         int           `yaml:"port"`
-	ReadTimeout  time.Duration `yaml:"read_timeout"`
-	WriteTimeout time.Duration `yaml:"write_timeout"`
-	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // how long in-flight requests may take to finish on shutdown
+	TrustedProxies  []string      `yaml:"trusted_proxies"`  // addresses or CIDR ranges of reverse proxies whose X-Forwarded-* headers are honored
 }
 
 // DatabaseConfig holds database connection settings
@@ -57,13 +66,134 @@ type StorageConfig struct {
 	SecretKey string            `yaml:"secret_key"`
 	LocalPath string            `yaml:"local_path"`
 	Options   map[string]string `yaml:"options"`
+
+	PathLayout string `yaml:"path_layout"` // where artifact content is stored: flat, or sharded by SHA256 prefix
+
+	EncryptionKey string `yaml:"encryption_key"` // base64-encoded 32-byte master key content is encrypted at rest with; empty stores plaintext
 }
 
 // AuthConfig holds authentication settings
 type AuthConfig struct {
 	JWTSecret     string        `yaml:"jwt_secret"`
-	JWTExpiration time.Duration `yaml:"jwt_expiration"`
+	JWTExpiration time.Duration `yaml:"jwt_expiration"` // lifetime of access tokens, renewed with refresh tokens
 	BCryptCost    int           `yaml:"bcrypt_cost"`
+
+	RefreshTokenExpiration time.Duration `yaml:"refresh_token_expiration"` // lifetime of refresh tokens issued at login
+
+	RegistryTokenExpiration time.Duration `yaml:"registry_token_expiration"` // lifetime of scoped bearer tokens issued to Docker clients
+
+	PasswordMinLength     int  `yaml:"password_min_length"`     // shortest password accepted at registration and password change
+	PasswordRequireUpper  bool `yaml:"password_require_upper"`  // passwords must contain an uppercase letter
+	PasswordRequireLower  bool `yaml:"password_require_lower"`  // passwords must contain a lowercase letter
+	PasswordRequireDigit  bool `yaml:"password_require_digit"`  // passwords must contain a digit
+	PasswordRequireSymbol bool `yaml:"password_require_symbol"` // passwords must contain a character that is not a letter or digit
+	PasswordBreachCheck   bool `yaml:"password_breach_check"`   // reject passwords found in the Have I Been Pwned corpus; only a hash prefix is sent
+}
+
+// RegistryConfig holds package registry behaviour settings
+type RegistryConfig struct {
+	OCIStrictNames  bool   `yaml:"oci_strict_names"`  // enforce the distribution spec repository name grammar
+	DefaultIconPath string `yaml:"default_icon_path"` // icon served for packages without an embedded icon
+
+	OCIImmutableTags    []string      `yaml:"oci_immutable_tags"`     // "repository:tag" glob patterns of OCI tags that cannot be moved once pushed
+	OCIUploadSessionTTL time.Duration `yaml:"oci_upload_session_ttl"` // how long an OCI upload session may go without a chunk before it is abandoned
+
+	IdempotentPublish bool `yaml:"idempotent_publish"` // re-publishing an existing version with identical content succeeds instead of conflicting
+
+	NPMVerifyTarballs bool `yaml:"npm_verify_tarballs"` // read whole npm tarballs at upload to reject truncated or corrupt archives
+
+	OPAValidateBundles bool `yaml:"opa_validate_bundles"` // compile the policies of uploaded OPA bundles and check their manifest roots
+
+	StrictContentValidation bool `yaml:"strict_content_validation"` // reject uploads whose magic bytes do not match the registry's package format
+
+	DownloadRateAnonymous     int `yaml:"download_rate_anonymous"`     // download bytes/sec per anonymous client IP, 0 for unlimited
+	DownloadRateAuthenticated int `yaml:"download_rate_authenticated"` // download bytes/sec per authenticated user, 0 for unlimited
+
+	DebianSigningKeyPath       string `yaml:"debian_signing_key_path"`       // armored OpenPGP private key for signing APT Release files
+	DebianSigningKeyPassphrase string `yaml:"debian_signing_key_passphrase"` // passphrase for the Debian signing key, if encrypted
+
+	RPMSigningKeyPath       string `yaml:"rpm_signing_key_path"`       // armored OpenPGP private key for signing repomd.xml
+	RPMSigningKeyPassphrase string `yaml:"rpm_signing_key_passphrase"` // passphrase for the RPM signing key, if encrypted
+
+	DefaultQuotaBytes     int64 `yaml:"default_quota_bytes"`     // total artifact size each user may publish without a quota of their own, 0 for unlimited
+	DefaultQuotaArtifacts int64 `yaml:"default_quota_artifacts"` // artifacts each user may publish without a quota of their own, 0 for unlimited
+
+	SignatureKeyringPath string `yaml:"signature_keyring_path"` // public keys, in a file or directory, that uploads to registries requiring signatures are verified against
+
+	RetentionInterval time.Duration `yaml:"retention_interval"` // how often enabled retention policies are applied, 0 to never apply them
+
+	DeleteGracePeriod time.Duration `yaml:"delete_grace_period"` // how long deleted artifacts can be restored before they are purged, 0 to delete immediately
+
+	DefaultPublic bool `yaml:"default_public"` // whether packages outside organization namespaces are public when first published
+
+	ReconcileInterval      time.Duration `yaml:"reconcile_interval"`       // how often storage is cross-checked against artifacts, 0 to never check it
+	ReconcileDeleteOrphans bool          `yaml:"reconcile_delete_orphans"` // whether scheduled checks remove stored content no artifact refers to, rather than only report it
+	ReconcileMinAge        time.Duration `yaml:"reconcile_min_age"`        // how long content must have been stored before it can be found orphaned
+
+	DownloadFlushInterval time.Duration `yaml:"download_flush_interval"` // how often batched download counts and events are written, 0 to write each download immediately
+	DownloadFlushSize     int           `yaml:"download_flush_size"`     // batched downloads that trigger a write before the interval elapses, 0 for no limit
+
+	UpstreamURLs           map[string]string `yaml:"upstream_urls"`            // registry name to the public registry its missing packages are fetched from
+	UpstreamCacheTTL       time.Duration     `yaml:"upstream_cache_ttl"`       // how long upstream package metadata is reused before being fetched again
+	UpstreamCacheSnapshots bool              `yaml:"upstream_cache_snapshots"` // cache Maven snapshot builds fetched from the upstream, which are otherwise only passed through
+
+	MaxUploadSize  int64            `yaml:"max_upload_size"`  // largest request body, in bytes, accepted by registries without a limit of their own, 0 for unlimited
+	MaxUploadSizes map[string]int64 `yaml:"max_upload_sizes"` // registry name to the largest request body, in bytes, its uploads may have
+}
+
+// DefaultMaxUploadSizes are the upload limits of registries whose packages are
+// typically much smaller or larger than the global limit. OCI requests carry
+// single image layers, which can be several gigabytes.
+var DefaultMaxUploadSizes = map[string]int64{
+	"npm":    64 << 20,
+	"cargo":  16 << 20,
+	"helm":   32 << 20,
+	"nuget":  256 << 20,
+	"go":     512 << 20,
+	"debian": 512 << 20,
+	"rpm":    512 << 20,
+	"oci":    10 << 30,
+}
+
+// UploadLimit returns the largest request body a registry accepts, 0 for
+// unlimited
+func (r *RegistryConfig) UploadLimit(registry string) int64 {
+	if limit, ok := r.MaxUploadSizes[registry]; ok {
+		return limit
+	}
+	return r.MaxUploadSize
+}
+
+// MetricsConfig holds Prometheus metrics settings
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"` // where the metrics endpoint is served
+}
+
+// RateLimitConfig holds per-client request limits, counted in Redis
+type RateLimitConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Window           time.Duration `yaml:"window"`            // sliding window the limits apply to
+	Requests         int           `yaml:"requests"`          // API requests per window, 0 for unlimited
+	PublishRequests  int           `yaml:"publish_requests"`  // package publishes and deletes per window, 0 for unlimited
+	DownloadRequests int           `yaml:"download_requests"` // package metadata and downloads per window, 0 for unlimited
+}
+
+// CORSConfig holds the cross-origin requests browsers may make
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins"`   // origins such as "https://ui.example.com", "https://*.example.com" for any subdomain, or "*" for any origin
+	AllowedMethods   []string      `yaml:"allowed_methods"`   // methods advertised to preflights, empty for every method a route serves
+	AllowedHeaders   []string      `yaml:"allowed_headers"`   // request headers preflights may ask for, or "*" for any header
+	AllowCredentials bool          `yaml:"allow_credentials"` // let browsers send cookies and authorization headers, never with the "*" origin
+	MaxAge           time.Duration `yaml:"max_age"`           // how long browsers may cache preflight responses
+}
+
+// ScanningConfig holds the external vulnerability scanner published artifacts
+// are submitted to
+type ScanningConfig struct {
+	ScannerURL string        `yaml:"scanner_url"` // endpoint artifacts are posted to, answering with a Trivy JSON report; empty to disable scanning
+	Timeout    time.Duration `yaml:"timeout"`     // how long a single scan may take
+	Policy     string        `yaml:"policy"`      // "block" to refuse downloads of artifacts with critical findings, empty to only report them
 }
 
 // LoggingConfig holds logging configuration
@@ -76,11 +206,13 @@ type LoggingConfig struct {
 func LoadFromEnv() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host:         getEnv("SERVER_HOST", "0.0.0.0"),
-			Port:         getEnvInt("SERVER_PORT", 8080),
-			ReadTimeout:  getEnvDuration("SERVER_READ_TIMEOUT", 30*time.Second),
-			WriteTimeout: getEnvDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
-			IdleTimeout:  getEnvDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+			Host:            getEnv("SERVER_HOST", "0.0.0.0"),
+			Port:            getEnvInt("SERVER_PORT", 8080),
+			ReadTimeout:     getEnvDuration("SERVER_READ_TIMEOUT", 30*time.Second),
+			WriteTimeout:    getEnvDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+			IdleTimeout:     getEnvDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+			ShutdownTimeout: getEnvDuration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+			TrustedProxies:  getEnvList("TRUSTED_PROXIES"),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -104,16 +236,103 @@ func LoadFromEnv() *Config {
 			AccessKey: getEnv("STORAGE_ACCESS_KEY", ""),
 			SecretKey: getEnv("STORAGE_SECRET_KEY", ""),
 			LocalPath: getEnv("STORAGE_LOCAL_PATH", "./artifacts"),
+
+			PathLayout: getEnv("STORAGE_PATH_LAYOUT", "flat"),
+
+			EncryptionKey: getEnv("STORAGE_ENCRYPTION_KEY", ""),
 		},
 		Auth: AuthConfig{
 			JWTSecret:     getEnv("JWT_SECRET", "your-secret-key"),
-			JWTExpiration: getEnvDuration("JWT_EXPIRATION", 24*time.Hour),
+			JWTExpiration: getEnvDuration("JWT_EXPIRATION", time.Hour),
 			BCryptCost:    getEnvInt("BCRYPT_COST", 12),
+
+			RefreshTokenExpiration: getEnvDuration("REFRESH_TOKEN_EXPIRATION", 30*24*time.Hour),
+
+			RegistryTokenExpiration: getEnvDuration("REGISTRY_TOKEN_EXPIRATION", time.Hour),
+
+			PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+			PasswordRequireUpper:  getEnvBool("PASSWORD_REQUIRE_UPPER", false),
+			PasswordRequireLower:  getEnvBool("PASSWORD_REQUIRE_LOWER", false),
+			PasswordRequireDigit:  getEnvBool("PASSWORD_REQUIRE_DIGIT", false),
+			PasswordRequireSymbol: getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+			PasswordBreachCheck:   getEnvBool("PASSWORD_BREACH_CHECK", false),
 		},
 		Logging: LoggingConfig{
 			Level:  getEnv("LOG_LEVEL", "info"),
 			Format: getEnv("LOG_FORMAT", "json"),
 		},
+		Registry: RegistryConfig{
+			OCIStrictNames:  getEnvBool("OCI_STRICT_NAMES", true),
+			DefaultIconPath: getEnv("DEFAULT_ICON_PATH", ""),
+
+			OCIImmutableTags:    getEnvList("OCI_IMMUTABLE_TAGS"),
+			OCIUploadSessionTTL: getEnvDuration("OCI_UPLOAD_SESSION_TTL", 24*time.Hour),
+
+			IdempotentPublish: getEnvBool("IDEMPOTENT_PUBLISH", false),
+
+			NPMVerifyTarballs: getEnvBool("NPM_VERIFY_TARBALLS", true),
+
+			OPAValidateBundles: getEnvBool("OPA_VALIDATE_BUNDLES", true),
+
+			StrictContentValidation: getEnvBool("STRICT_CONTENT_VALIDATION", true),
+
+			DownloadRateAnonymous:     getEnvInt("DOWNLOAD_RATE_ANONYMOUS", 0),
+			DownloadRateAuthenticated: getEnvInt("DOWNLOAD_RATE_AUTHENTICATED", 0),
+
+			DebianSigningKeyPath:       getEnv("DEBIAN_SIGNING_KEY_PATH", ""),
+			DebianSigningKeyPassphrase: getEnv("DEBIAN_SIGNING_KEY_PASSPHRASE", ""),
+
+			RPMSigningKeyPath:       getEnv("RPM_SIGNING_KEY_PATH", ""),
+			RPMSigningKeyPassphrase: getEnv("RPM_SIGNING_KEY_PASSPHRASE", ""),
+
+			DefaultQuotaBytes:     int64(getEnvInt("DEFAULT_QUOTA_BYTES", 0)),
+			DefaultQuotaArtifacts: int64(getEnvInt("DEFAULT_QUOTA_ARTIFACTS", 0)),
+
+			SignatureKeyringPath: getEnv("SIGNATURE_KEYRING_PATH", ""),
+
+			RetentionInterval: getEnvDuration("RETENTION_INTERVAL", 24*time.Hour),
+
+			DeleteGracePeriod: getEnvDuration("DELETE_GRACE_PERIOD", 7*24*time.Hour),
+
+			DefaultPublic: strings.EqualFold(getEnv("DEFAULT_VISIBILITY", "private"), "public"),
+
+			ReconcileInterval:      getEnvDuration("STORAGE_RECONCILE_INTERVAL", 24*time.Hour),
+			ReconcileDeleteOrphans: getEnvBool("STORAGE_RECONCILE_DELETE_ORPHANS", false),
+			ReconcileMinAge:        getEnvDuration("STORAGE_RECONCILE_MIN_AGE", time.Hour),
+
+			DownloadFlushInterval: getEnvDuration("DOWNLOAD_FLUSH_INTERVAL", 10*time.Second),
+			DownloadFlushSize:     getEnvInt("DOWNLOAD_FLUSH_SIZE", 1000),
+
+			UpstreamURLs:           getEnvMap("UPSTREAM_URLS"),
+			UpstreamCacheTTL:       getEnvDuration("UPSTREAM_CACHE_TTL", 5*time.Minute),
+			UpstreamCacheSnapshots: getEnvBool("UPSTREAM_CACHE_SNAPSHOTS", false),
+
+			MaxUploadSize:  getEnvSize("MAX_UPLOAD_SIZE", 100<<20),
+			MaxUploadSizes: getEnvSizeMap("MAX_UPLOAD_SIZES", DefaultMaxUploadSizes),
+		},
+		Metrics: MetricsConfig{
+			Enabled: getEnvBool("METRICS_ENABLED", true),
+			Path:    getEnv("METRICS_PATH", "/metrics"),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:          getEnvBool("RATE_LIMIT_ENABLED", false),
+			Window:           getEnvDuration("RATE_LIMIT_WINDOW", time.Minute),
+			Requests:         getEnvInt("RATE_LIMIT_REQUESTS", 6000),
+			PublishRequests:  getEnvInt("RATE_LIMIT_PUBLISH_REQUESTS", 60),
+			DownloadRequests: getEnvInt("RATE_LIMIT_DOWNLOAD_REQUESTS", 3000),
+		},
+		CORS: CORSConfig{
+			AllowedOrigins:   getEnvListDefault("CORS_ORIGINS", []string{"*"}),
+			AllowedMethods:   getEnvList("CORS_METHODS"),
+			AllowedHeaders:   getEnvListDefault("CORS_HEADERS", []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-NuGet-ApiKey"}),
+			AllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+			MaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+		},
+		Scanning: ScanningConfig{
+			ScannerURL: getEnv("SCANNER_URL", ""),
+			Timeout:    getEnvDuration("SCANNER_TIMEOUT", 5*time.Minute),
+			Policy:     getEnv("SCAN_POLICY", ""),
+		},
 	}
 }
 
@@ -168,6 +387,101 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvListDefault parses a comma separated list, or returns the default if
+// the variable is unset or empty
+func getEnvListDefault(key string, defaultValue []string) []string {
+	if values := getEnvList(key); len(values) > 0 {
+		return values
+	}
+	return defaultValue
+}
+
+// getEnvMap parses a comma separated list of key=value pairs
+func getEnvMap(key string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range getEnvList(key) {
+		name, value, ok := strings.Cut(pair, "=")
+		if name, value = strings.TrimSpace(name), strings.TrimSpace(value); ok && name != "" && value != "" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// sizeUnits are the multipliers of the units sizes may be given in
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"TB", 1 << 40},
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a size in bytes, either a plain number or a number with a
+// unit such as "100MB". Units are powers of 1024.
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, multiplier = strings.TrimSpace(number), unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size < 0 || size > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return size * multiplier, nil
+}
+
+// getEnvSize parses a size such as "100MB"
+func getEnvSize(key string, defaultValue int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if size, err := ParseSize(value); err == nil {
+			return size
+		}
+	}
+	return defaultValue
+}
+
+// getEnvSizeMap parses a comma separated list of key=size pairs over a copy
+// of the defaults
+func getEnvSizeMap(key string, defaultValue map[string]int64) map[string]int64 {
+	sizes := make(map[string]int64, len(defaultValue))
+	for name, size := range defaultValue {
+		sizes[name] = size
+	}
+	for name, value := range getEnvMap(key) {
+		if size, err := ParseSize(value); err == nil {
+			sizes[name] = size
+		}
+	}
+	return sizes
+}
+
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
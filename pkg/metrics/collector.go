@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// Status label values recorded for operations
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
+
+// latencyBuckets spans quick metadata lookups to slow uploads, in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// sizeBuckets spans small manifests to multi-gigabyte images, in bytes
+var sizeBuckets = ExponentialBuckets(1<<10, 4, 11)
+
+// Collector holds the metrics recorded by Lodestone services. A nil
+// Collector records nothing, so services work unchanged with metrics disabled.
+type Collector struct {
+	registry *Registry
+
+	registryOperations        *CounterVec
+	registryOperationDuration *HistogramVec
+	artifactSize              *HistogramVec
+	storageOperationDuration  *HistogramVec
+	authAttempts              *CounterVec
+}
+
+// NewCollector creates a collector with all Lodestone metrics registered
+func NewCollector() *Collector {
+	registry := NewRegistry()
+	return &Collector{
+		registry: registry,
+
+		registryOperations: registry.NewCounterVec(
+			"lodestone_registry_operations_total",
+			"Registry operations by operation, registry type and status.",
+			"operation", "registry", "status"),
+		registryOperationDuration: registry.NewHistogramVec(
+			"lodestone_registry_operation_duration_seconds",
+			"Latency of registry operations in seconds.",
+			latencyBuckets, "operation", "registry"),
+		artifactSize: registry.NewHistogramVec(
+			"lodestone_artifact_size_bytes",
+			"Size of uploaded and downloaded artifacts in bytes.",
+			sizeBuckets, "operation", "registry"),
+		storageOperationDuration: registry.NewHistogramVec(
+			"lodestone_storage_operation_duration_seconds",
+			"Latency of blob storage operations in seconds.",
+			latencyBuckets, "operation", "status"),
+		authAttempts: registry.NewCounterVec(
+			"lodestone_auth_attempts_total",
+			"Authentication attempts by method and result.",
+			"method", "result"),
+	}
+}
+
+// Handler serves the collected metrics for Prometheus to scrape
+func (c *Collector) Handler() http.Handler {
+	if c == nil {
+		return http.NotFoundHandler()
+	}
+	return c.registry.Handler()
+}
+
+// ObserveRegistryOperation records the outcome and latency of a registry
+// operation that started at start
+func (c *Collector) ObserveRegistryOperation(operation, registryType string, err error, start time.Time) {
+	if c == nil {
+		return
+	}
+	c.registryOperations.Inc(operation, registryType, Status(err))
+	c.registryOperationDuration.Observe(time.Since(start).Seconds(), operation, registryType)
+}
+
+// ObserveArtifactSize records the size of an artifact that was transferred
+func (c *Collector) ObserveArtifactSize(operation, registryType string, size int64) {
+	if c == nil {
+		return
+	}
+	c.artifactSize.Observe(float64(size), operation, registryType)
+}
+
+// ObserveStorageOperation records the outcome and latency of a blob storage
+// operation that started at start
+func (c *Collector) ObserveStorageOperation(operation string, err error, start time.Time) {
+	if c == nil {
+		return
+	}
+	c.storageOperationDuration.Observe(time.Since(start).Seconds(), operation, Status(err))
+}
+
+// ObserveAuthAttempt records whether an authentication attempt succeeded
+func (c *Collector) ObserveAuthAttempt(method string, err error) {
+	if c == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	c.authAttempts.Inc(method, result)
+}
+
+// Status returns the status label for an operation that returned err
+func Status(err error) string {
+	if err != nil {
+		return StatusError
+	}
+	return StatusSuccess
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("requests_total", "Requests served.", "method")
+	sizes := registry.NewHistogramVec("size_bytes", "Response sizes.", []float64{10, 100}, "method")
+
+	requests.Inc("GET")
+	requests.Inc("GET")
+	requests.Inc(`P"O\ST`)
+	sizes.Observe(5, "GET")
+	sizes.Observe(50, "GET")
+	sizes.Observe(500, "GET")
+
+	var out strings.Builder
+	require.NoError(t, registry.WriteText(&out))
+
+	assert.Equal(t, `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET"} 2
+requests_total{method="P\"O\\ST"} 1
+# HELP size_bytes Response sizes.
+# TYPE size_bytes histogram
+size_bytes_bucket{method="GET",le="10"} 1
+size_bytes_bucket{method="GET",le="100"} 2
+size_bytes_bucket{method="GET",le="+Inf"} 3
+size_bytes_sum{method="GET"} 555
+size_bytes_count{method="GET"} 3
+`, out.String())
+}
+
+func TestHistogram_BoundIsInclusive(t *testing.T) {
+	registry := NewRegistry()
+	histogram := registry.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 2})
+	histogram.Observe(1)
+
+	var out strings.Builder
+	require.NoError(t, registry.WriteText(&out))
+	assert.Contains(t, out.String(), `latency_seconds_bucket{le="1"} 1`)
+}
+
+func TestCollector_Handler(t *testing.T) {
+	collector := NewCollector()
+	collector.ObserveRegistryOperation("download", "npm", nil, time.Now())
+	collector.ObserveRegistryOperation("download", "npm", errors.New("not found"), time.Now())
+	collector.ObserveAuthAttempt("jwt", errors.New("invalid token"))
+
+	w := httptest.NewRecorder()
+	collector.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	body := w.Body.String()
+	assert.Contains(t, body, `lodestone_registry_operations_total{operation="download",registry="npm",status="success"} 1`)
+	assert.Contains(t, body, `lodestone_registry_operations_total{operation="download",registry="npm",status="error"} 1`)
+	assert.Contains(t, body, `lodestone_auth_attempts_total{method="jwt",result="failure"} 1`)
+}
+
+func TestCollector_NilRecordsNothing(t *testing.T) {
+	var collector *Collector
+	assert.NotPanics(t, func() {
+		collector.ObserveRegistryOperation("upload", "npm", nil, time.Now())
+		collector.ObserveArtifactSize("upload", "npm", 1)
+		collector.ObserveStorageOperation("store", nil, time.Now())
+		collector.ObserveAuthAttempt("jwt", nil)
+	})
+
+	w := httptest.NewRecorder()
+	collector.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
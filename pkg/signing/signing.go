@@ -0,0 +1,92 @@
+// Package signing signs repository metadata with OpenPGP keys, as expected by
+// package managers such as apt and dnf, and verifies the detached signatures
+// artifacts are published with
+package signing
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+// LoadKey reads an armored OpenPGP private key, decrypting it with the
+// passphrase if it is protected
+func LoadKey(keyPath, passphrase string) (*openpgp.Entity, error) {
+	file, err := os.Open(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open signing key: %w", err)
+	}
+	defer file.Close()
+
+	keyring, err := openpgp.ReadArmoredKeyRing(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("failed to decrypt signing key: %w", err)
+			}
+		}
+		for _, subkey := range entity.Subkeys {
+			if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+				if err := subkey.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+					return nil, fmt.Errorf("failed to decrypt signing subkey: %w", err)
+				}
+			}
+		}
+		return entity, nil
+	}
+
+	return nil, fmt.Errorf("no private key found in %s", keyPath)
+}
+
+// ClearSign returns the data clearsigned with the key, as used for InRelease files
+func ClearSign(data []byte, key *openpgp.Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := clearsign.Encode(&buf, key.PrivateKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start clearsign: %w", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to sign data: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to sign data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DetachSign returns an armored detached signature of the data, as used for
+// Release.gpg and repomd.xml.asc files
+func DetachSign(data []byte, key *openpgp.Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, key, bytes.NewReader(data), nil); err != nil {
+		return nil, fmt.Errorf("failed to sign data: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// PublicKey returns the armored public key clients import to trust signed metadata
+func PublicKey(key *openpgp.Entity) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to armor public key: %w", err)
+	}
+	if err := key.Serialize(writer); err != nil {
+		return nil, fmt.Errorf("failed to serialize public key: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to serialize public key: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,64 @@
+package signing
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSign(t *testing.T) {
+	key, err := openpgp.NewEntity("Lodestone", "test", "dev@example.com", nil)
+	require.NoError(t, err)
+	keyring := openpgp.EntityList{key}
+
+	data := []byte("Origin: Lodestone\nSuite: stable\n")
+
+	clearsigned, err := ClearSign(data, key)
+	require.NoError(t, err)
+	block, _ := clearsign.Decode(clearsigned)
+	require.NotNil(t, block)
+	assert.Equal(t, strings.TrimSuffix(string(data), "\n"), strings.TrimSuffix(string(block.Plaintext), "\n"))
+	_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body, nil)
+	assert.NoError(t, err)
+
+	detached, err := DetachSign(data, key)
+	require.NoError(t, err)
+	_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(detached), nil)
+	assert.NoError(t, err)
+
+	publicKey, err := PublicKey(key)
+	require.NoError(t, err)
+	assert.Contains(t, string(publicKey), "BEGIN PGP PUBLIC KEY BLOCK")
+}
+
+func TestLoadKey(t *testing.T) {
+	key, err := openpgp.NewEntity("Lodestone", "test", "dev@example.com", nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writer, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, key.SerializePrivate(writer, nil))
+	require.NoError(t, writer.Close())
+
+	keyPath := filepath.Join(t.TempDir(), "key.asc")
+	require.NoError(t, os.WriteFile(keyPath, buf.Bytes(), 0600))
+
+	loaded, err := LoadKey(keyPath, "")
+	require.NoError(t, err)
+	assert.Equal(t, key.PrimaryKey.Fingerprint, loaded.PrimaryKey.Fingerprint)
+
+	publicKey, err := PublicKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyPath, publicKey, 0600))
+	_, err = LoadKey(keyPath, "")
+	assert.ErrorContains(t, err, "no private key")
+}
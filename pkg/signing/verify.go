@@ -0,0 +1,238 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+// Signature types reported by Verify
+const (
+	SignatureTypePGP    = "pgp"
+	SignatureTypeCosign = "cosign"
+)
+
+var (
+	// ErrNoTrustedKeys is returned when verifying against an empty keyring
+	ErrNoTrustedKeys = errors.New("no trusted signing keys configured")
+
+	// ErrSignatureInvalid is returned when a signature was not made over the
+	// content by any trusted key
+	ErrSignatureInvalid = errors.New("signature does not verify against any trusted key")
+)
+
+// Keyring holds the public keys artifacts may be signed with: OpenPGP keys
+// for detached GPG signatures, and PEM-encoded ECDSA, Ed25519 or RSA keys for
+// cosign-style signatures
+type Keyring struct {
+	PGP  openpgp.EntityList
+	Keys []crypto.PublicKey
+}
+
+// Verification identifies the key a signature was made with
+type Verification struct {
+	Type  string `json:"type"`
+	KeyID string `json:"key_id"` // PGP fingerprint, or SHA-256 of the public key's DER encoding
+}
+
+// LoadKeyring reads the trusted public keys in a file, or in every file of a
+// directory
+func LoadKeyring(keyPath string) (*Keyring, error) {
+	info, err := os.Stat(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	paths := []string{keyPath}
+	if info.IsDir() {
+		entries, err := os.ReadDir(keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyring: %w", err)
+		}
+		paths = paths[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				paths = append(paths, filepath.Join(keyPath, entry.Name()))
+			}
+		}
+	}
+
+	keyring := &Keyring{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", path, err)
+		}
+		if err := keyring.Add(data); err != nil {
+			return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+		}
+	}
+	return keyring, nil
+}
+
+// Add parses public keys and adds them to the keyring. The data may hold an
+// armored or binary OpenPGP key ring, or PEM "PUBLIC KEY" blocks.
+func (k *Keyring) Add(data []byte) error {
+	if bytes.Contains(data, []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")) {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		k.PGP = append(k.PGP, entities...)
+		return nil
+	}
+
+	if bytes.Contains(data, []byte("-----BEGIN ")) {
+		found := false
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "PUBLIC KEY" {
+				continue
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return err
+			}
+			k.Keys = append(k.Keys, key)
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("no PEM public key found")
+		}
+		return nil
+	}
+
+	entities, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	k.PGP = append(k.PGP, entities...)
+	return nil
+}
+
+// Empty reports whether the keyring holds no keys
+func (k *Keyring) Empty() bool {
+	return k == nil || (len(k.PGP) == 0 && len(k.Keys) == 0)
+}
+
+// Verify checks a detached signature over content against the keyring. The
+// signature may be an armored or binary OpenPGP signature, as written by
+// gpg --detach-sign, or a raw or base64-encoded signature as written by
+// cosign sign-blob.
+func Verify(content, signature []byte, keyring *Keyring) (*Verification, error) {
+	if keyring.Empty() {
+		return nil, ErrNoTrustedKeys
+	}
+
+	trimmed := bytes.TrimSpace(signature)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("%w: signature is empty", ErrSignatureInvalid)
+	}
+
+	if bytes.HasPrefix(trimmed, []byte("-----BEGIN PGP SIGNATURE-----")) {
+		if len(keyring.PGP) > 0 {
+			signer, err := openpgp.CheckArmoredDetachedSignature(keyring.PGP, bytes.NewReader(content), bytes.NewReader(trimmed), nil)
+			if err == nil {
+				return pgpVerification(signer), nil
+			}
+		}
+		return nil, ErrSignatureInvalid
+	}
+
+	raw := signature
+	if decoded, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil {
+		raw = decoded
+	}
+
+	// OpenPGP packets always have the high bit of their first byte set
+	if len(keyring.PGP) > 0 && raw[0]&0x80 != 0 {
+		signer, err := openpgp.CheckDetachedSignature(keyring.PGP, bytes.NewReader(content), bytes.NewReader(raw), nil)
+		if err == nil {
+			return pgpVerification(signer), nil
+		}
+	}
+
+	for _, key := range keyring.Keys {
+		if verifyWithKey(key, content, raw) {
+			return &Verification{Type: SignatureTypeCosign, KeyID: keyID(key)}, nil
+		}
+	}
+	return nil, ErrSignatureInvalid
+}
+
+// verifyWithKey checks a signature made the way cosign signs with each key type
+func verifyWithKey(key crypto.PublicKey, content, signature []byte) bool {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P384():
+			digest := sha512.Sum384(content)
+			return ecdsa.VerifyASN1(key, digest[:], signature)
+		case elliptic.P521():
+			digest := sha512.Sum512(content)
+			return ecdsa.VerifyASN1(key, digest[:], signature)
+		default:
+			digest := sha256.Sum256(content)
+			return ecdsa.VerifyASN1(key, digest[:], signature)
+		}
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, content, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(content)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	return false
+}
+
+func pgpVerification(signer *openpgp.Entity) *Verification {
+	return &Verification{
+		Type:  SignatureTypePGP,
+		KeyID: strings.ToUpper(hex.EncodeToString(signer.PrimaryKey.Fingerprint[:])),
+	}
+}
+
+// keyID identifies a public key by the SHA-256 of its DER encoding
+func keyID(key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type signatureKey struct{}
+
+// WithSignature returns a context carrying the detached signature supplied
+// with an upload
+func WithSignature(ctx context.Context, signature []byte) context.Context {
+	return context.WithValue(ctx, signatureKey{}, signature)
+}
+
+// SignatureFromContext returns the detached signature supplied with an
+// upload, or nil if there is none
+func SignatureFromContext(ctx context.Context) []byte {
+	signature, _ := ctx.Value(signatureKey{}).([]byte)
+	return signature
+}
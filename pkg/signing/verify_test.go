@@ -0,0 +1,141 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pemPublicKey(t *testing.T, key crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestVerify_PGP(t *testing.T) {
+	key, err := openpgp.NewEntity("Lodestone", "test", "dev@example.com", nil)
+	require.NoError(t, err)
+	publicKey, err := PublicKey(key)
+	require.NoError(t, err)
+
+	keyring := &Keyring{}
+	require.NoError(t, keyring.Add(publicKey))
+
+	content := []byte("package contents")
+
+	armored, err := DetachSign(content, key)
+	require.NoError(t, err)
+	verification, err := Verify(content, armored, keyring)
+	require.NoError(t, err)
+	assert.Equal(t, SignatureTypePGP, verification.Type)
+	assert.Len(t, verification.KeyID, 40)
+
+	var binary bytes.Buffer
+	require.NoError(t, openpgp.DetachSign(&binary, key, bytes.NewReader(content), nil))
+	_, err = Verify(content, binary.Bytes(), keyring)
+	assert.NoError(t, err)
+
+	// Signatures headed for an HTTP header arrive base64-encoded
+	_, err = Verify(content, []byte(base64.StdEncoding.EncodeToString(binary.Bytes())), keyring)
+	assert.NoError(t, err)
+
+	_, err = Verify([]byte("tampered contents"), armored, keyring)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+}
+
+func TestVerify_Cosign(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ed25519Public, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	keyring := &Keyring{}
+	require.NoError(t, keyring.Add(append(pemPublicKey(t, &ecdsaKey.PublicKey), pemPublicKey(t, ed25519Public)...)))
+	assert.Len(t, keyring.Keys, 2)
+
+	content := []byte(`{"critical":{"image":{"docker-manifest-digest":"sha256:abc"}}}`)
+
+	digest := sha256.Sum256(content)
+	ecdsaSignature, err := ecdsa.SignASN1(rand.Reader, ecdsaKey, digest[:])
+	require.NoError(t, err)
+	verification, err := Verify(content, []byte(base64.StdEncoding.EncodeToString(ecdsaSignature)), keyring)
+	require.NoError(t, err)
+	assert.Equal(t, SignatureTypeCosign, verification.Type)
+	assert.Contains(t, verification.KeyID, "sha256:")
+
+	ed25519Signature := ed25519.Sign(ed25519Key, content)
+	_, err = Verify(content, ed25519Signature, keyring)
+	assert.NoError(t, err)
+
+	_, err = Verify([]byte("other payload"), ecdsaSignature, keyring)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+}
+
+func TestVerify_UntrustedKey(t *testing.T) {
+	trusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	untrusted, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	content := []byte("package contents")
+	digest := sha256.Sum256(content)
+	signature, err := ecdsa.SignASN1(rand.Reader, untrusted, digest[:])
+	require.NoError(t, err)
+
+	keyring := &Keyring{}
+	require.NoError(t, keyring.Add(pemPublicKey(t, &trusted.PublicKey)))
+	_, err = Verify(content, signature, keyring)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+
+	_, err = Verify(content, signature, &Keyring{})
+	assert.ErrorIs(t, err, ErrNoTrustedKeys)
+	_, err = Verify(content, nil, keyring)
+	assert.ErrorIs(t, err, ErrSignatureInvalid)
+}
+
+func TestLoadKeyring(t *testing.T) {
+	pgpKey, err := openpgp.NewEntity("Lodestone", "test", "dev@example.com", nil)
+	require.NoError(t, err)
+	pgpPublic, err := PublicKey(pgpKey)
+	require.NoError(t, err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "release.asc"), pgpPublic, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cosign.pub"), pemPublicKey(t, &ecdsaKey.PublicKey), 0o600))
+
+	keyring, err := LoadKeyring(dir)
+	require.NoError(t, err)
+	assert.Len(t, keyring.PGP, 1)
+	assert.Len(t, keyring.Keys, 1)
+
+	keyring, err = LoadKeyring(filepath.Join(dir, "cosign.pub"))
+	require.NoError(t, err)
+	assert.Len(t, keyring.Keys, 1)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.pub"), []byte("not a key"), 0o600))
+	_, err = LoadKeyring(dir)
+	assert.Error(t, err)
+}
+
+func TestSignatureContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, SignatureFromContext(ctx))
+	assert.Equal(t, []byte("sig"), SignatureFromContext(WithSignature(ctx, []byte("sig"))))
+}
@@ -0,0 +1,224 @@
+// Package throttle limits download throughput per client with token buckets
+package throttle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// maxChunk bounds a single read so throttled streams are paced smoothly
+	maxChunk = 32 << 10
+
+	// idleTimeout is how long an unused client bucket is kept
+	idleTimeout = 5 * time.Minute
+)
+
+// Bucket is a token bucket refilled at a fixed number of bytes per second.
+// A bucket is shared by all downloads of one client, so concurrent downloads
+// split the client's bandwidth rather than multiplying it.
+type Bucket struct {
+	mu       sync.Mutex
+	rate     float64 // bytes per second
+	burst    float64
+	tokens   float64
+	last     time.Time
+	lastUsed time.Time
+}
+
+// NewBucket creates a full bucket allowing bytesPerSecond of sustained
+// throughput with a burst of a tenth of a second
+func NewBucket(bytesPerSecond int64) *Bucket {
+	burst := float64(bytesPerSecond) / 10
+	if burst < 1 {
+		burst = 1
+	}
+	now := time.Now()
+	return &Bucket{
+		rate:     float64(bytesPerSecond),
+		burst:    burst,
+		tokens:   burst,
+		last:     now,
+		lastUsed: now,
+	}
+}
+
+// WaitN takes n tokens from the bucket, blocking until they are available or
+// the context is done. Tokens are reserved before waiting so concurrent
+// callers queue fairly.
+func (b *Bucket) WaitN(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.lastUsed = now
+	b.tokens -= float64(n)
+
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// idle reports whether the bucket has not been used since the given time
+func (b *Bucket) idle(since time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastUsed.Before(since)
+}
+
+// Client identifies who a download is for
+type Client struct {
+	ID            string // user ID for authenticated clients, IP address otherwise
+	Authenticated bool
+}
+
+type clientKey struct{}
+
+// WithClient returns a context carrying a resolver for the downloading client.
+// The resolver is called when the download starts, after authentication has
+// run, so it can be installed before the client is known.
+func WithClient(ctx context.Context, resolve func() Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, resolve)
+}
+
+// ClientFromContext returns the downloading client, if the context carries one
+func ClientFromContext(ctx context.Context) (Client, bool) {
+	resolve, ok := ctx.Value(clientKey{}).(func() Client)
+	if !ok {
+		return Client{}, false
+	}
+	return resolve(), true
+}
+
+// Limiter hands out a bucket per client, with distinct limits for anonymous
+// and authenticated clients. A limit of zero means unlimited.
+type Limiter struct {
+	anonymous     int64
+	authenticated int64
+
+	mu        sync.Mutex
+	buckets   map[string]*Bucket
+	lastSweep time.Time
+}
+
+// NewLimiter creates a limiter with the given bytes per second limits
+func NewLimiter(anonymous, authenticated int64) *Limiter {
+	return &Limiter{
+		anonymous:     anonymous,
+		authenticated: authenticated,
+		buckets:       make(map[string]*Bucket),
+		lastSweep:     time.Now(),
+	}
+}
+
+// Bucket returns the client's bucket, or nil if its downloads are unlimited
+func (l *Limiter) Bucket(client Client) *Bucket {
+	limit, key := l.anonymous, "anonymous:"+client.ID
+	if client.Authenticated {
+		limit, key = l.authenticated, "authenticated:"+client.ID
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) > idleTimeout {
+		for k, bucket := range l.buckets {
+			if bucket.idle(now.Add(-idleTimeout)) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewBucket(limit)
+		l.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// Wrap throttles content for the client carried by the context. Content is
+// returned unchanged when the limiter is nil, the context has no client, or
+// the client is unlimited.
+func (l *Limiter) Wrap(ctx context.Context, content io.ReadCloser) io.ReadCloser {
+	if l == nil {
+		return content
+	}
+	client, ok := ClientFromContext(ctx)
+	if !ok {
+		return content
+	}
+	bucket := l.Bucket(client)
+	if bucket == nil {
+		return content
+	}
+	return NewReader(ctx, content, bucket)
+}
+
+// Reader is a rate-limited io.ReadCloser. It passes Seek through to the
+// underlying reader when supported, so it composes with http.ServeContent and
+// Range requests: only the bytes actually read are throttled.
+type Reader struct {
+	ctx    context.Context
+	reader io.ReadCloser
+	bucket *Bucket
+}
+
+// NewReader wraps reader so that reads draw from the bucket
+func NewReader(ctx context.Context, reader io.ReadCloser, bucket *Bucket) *Reader {
+	return &Reader{ctx: ctx, reader: reader, bucket: bucket}
+}
+
+// Read reads at most one chunk and waits until the bucket covers it
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) > maxChunk {
+		p = p[:maxChunk]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.bucket.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Seek seeks the underlying reader if it supports seeking
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.reader.(io.Seeker)
+	if !ok {
+		return 0, errors.New("throttle: underlying reader does not support seeking")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// Close closes the underlying reader
+func (r *Reader) Close() error {
+	return r.reader.Close()
+}
@@ -0,0 +1,140 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const kib = 1 << 10
+
+// readAll reads a throttled stream and returns how long it took
+func readAll(t *testing.T, reader io.Reader) ([]byte, time.Duration) {
+	t.Helper()
+	start := time.Now()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return data, time.Since(start)
+}
+
+func TestReader_ThrottlesToRate(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 50*kib)
+	reader := NewReader(context.Background(), io.NopCloser(bytes.NewReader(data)), NewBucket(100*kib))
+
+	read, elapsed := readAll(t, reader)
+
+	// 50KiB at 100KiB/s, less the initial burst of a tenth of a second
+	assert.Equal(t, data, read)
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestReader_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	reader := NewReader(ctx, io.NopCloser(bytes.NewReader(make([]byte, 10*kib))), NewBucket(kib))
+	_, err := io.ReadAll(reader)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestReader_RangeRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "artifact")
+	require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("x"), 200*kib), 0644))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, err := os.Open(path)
+		require.NoError(t, err)
+		reader := NewReader(r.Context(), file, NewBucket(20*kib))
+		defer reader.Close()
+		http.ServeContent(w, r, "artifact", time.Time{}, reader)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=1024-11263")
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	elapsed := time.Since(start)
+
+	// Only the requested 10KiB are throttled, not the whole 200KiB file
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Len(t, body, 10*kib)
+	assert.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	assert.Less(t, elapsed, 3*time.Second)
+}
+
+func TestLimiter_Limits(t *testing.T) {
+	limiter := NewLimiter(10*kib, 0)
+
+	assert.NotNil(t, limiter.Bucket(Client{ID: "192.0.2.1"}))
+	assert.Same(t, limiter.Bucket(Client{ID: "192.0.2.1"}), limiter.Bucket(Client{ID: "192.0.2.1"}))
+	assert.NotSame(t, limiter.Bucket(Client{ID: "192.0.2.1"}), limiter.Bucket(Client{ID: "192.0.2.2"}))
+
+	// Authenticated clients are unlimited here
+	assert.Nil(t, limiter.Bucket(Client{ID: "user", Authenticated: true}))
+
+	content := io.NopCloser(bytes.NewReader(nil))
+	assert.Equal(t, content, limiter.Wrap(context.Background(), content))
+
+	ctx := WithClient(context.Background(), func() Client { return Client{ID: "user", Authenticated: true} })
+	assert.Equal(t, content, limiter.Wrap(ctx, content))
+
+	ctx = WithClient(context.Background(), func() Client { return Client{ID: "192.0.2.1"} })
+	assert.IsType(t, &Reader{}, limiter.Wrap(ctx, content))
+
+	var nilLimiter *Limiter
+	assert.Equal(t, content, nilLimiter.Wrap(ctx, content))
+}
+
+func TestLimiter_ClientsDoNotBlockEachOther(t *testing.T) {
+	limiter := NewLimiter(100*kib, 100*kib)
+	data := bytes.Repeat([]byte("x"), 30*kib)
+
+	download := func(client Client) time.Duration {
+		ctx := WithClient(context.Background(), func() Client { return client })
+		_, elapsed := readAll(t, limiter.Wrap(ctx, io.NopCloser(bytes.NewReader(data))))
+		return elapsed
+	}
+
+	// Two clients in parallel each get their own bandwidth
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, client := range []Client{{ID: "192.0.2.1"}, {ID: "user", Authenticated: true}} {
+		wg.Add(1)
+		go func(client Client) {
+			defer wg.Done()
+			assert.GreaterOrEqual(t, download(client), 200*time.Millisecond)
+		}(client)
+	}
+	wg.Wait()
+	assert.Less(t, time.Since(start), 450*time.Millisecond)
+
+	// Two downloads by the same client share its bandwidth
+	start = time.Now()
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			download(Client{ID: "192.0.2.3"})
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), 500*time.Millisecond)
+}
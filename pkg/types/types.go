@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lgulliver/lodestone/pkg/utils"
 	"gorm.io/gorm"
 )
 
@@ -51,6 +52,10 @@ type User struct {
 	IsAdmin   bool      `json:"is_admin" gorm:"default:false"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// TokensRevokedAt is when the user's tokens were last revoked; access
+	// tokens issued before it are refused
+	TokensRevokedAt *time.Time `json:"tokens_revoked_at,omitempty"`
 }
 
 // BeforeCreate generates a UUID for the user ID
@@ -68,6 +73,8 @@ type APIKey struct {
 	Name        string     `json:"name" gorm:"not null"`
 	KeyHash     string     `json:"-" gorm:"not null"`
 	Permissions []string   `json:"permissions" gorm:"serializer:json"`
+	Scopes      []string   `json:"scopes,omitempty" gorm:"serializer:json"`           // registry or registry:package-glob; empty is unrestricted
+	LoginClient string     `json:"login_client,omitempty" gorm:"not null;default:''"` // client whose login issued the key, such as npm; empty for keys created by hand
 	ExpiresAt   *time.Time `json:"expires_at"`
 	LastUsedAt  *time.Time `json:"last_used_at"`
 	IsActive    bool       `json:"is_active" gorm:"default:true"`
@@ -84,12 +91,37 @@ func (a *APIKey) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// RefreshToken is a long-lived token issued at login that obtains new access
+// tokens until it expires or is revoked. Only its hash is stored.
+type RefreshToken struct {
+	ID         uuid.UUID  `json:"id" gorm:"primaryKey"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"not null;index"`
+	TokenHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BeforeCreate generates a UUID for the refresh token ID
+func (r *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
 // Artifact represents a stored artifact
 type Artifact struct {
-	ID          uuid.UUID `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" gorm:"not null"`
-	Version     string    `json:"version" gorm:"not null"`
-	Registry    string    `json:"registry" gorm:"not null"` // nuget, npm, maven, etc.
+	ID       uuid.UUID `json:"id" gorm:"primaryKey"`
+	Name     string    `json:"name" gorm:"not null"`
+	Version  string    `json:"version" gorm:"not null"`
+	Registry string    `json:"registry" gorm:"not null"` // nuget, npm, maven, etc.
+
+	// NormalizedName is the key the name is looked up by, see
+	// utils.NormalizePackageName
+	NormalizedName string `json:"-" gorm:"index"`
+
 	ContentType string    `json:"content_type"`
 	Size        int64     `json:"size"`
 	SHA256      string    `json:"sha256" gorm:"index"`
@@ -98,16 +130,33 @@ type Artifact struct {
 	Downloads   int64     `json:"downloads" gorm:"default:0"`
 	PublishedBy uuid.UUID `json:"published_by"`
 	IsPublic    bool      `json:"is_public" gorm:"default:false"`
+	Status      string    `json:"status" gorm:"not null;default:published;index"` // published, pending-approval
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 	Publisher   User      `json:"publisher" gorm:"foreignKey:PublishedBy"`
+
+	// Labels are organizational key/value pairs set by package owners, such
+	// as team=payments, that listings and searches can be filtered by
+	Labels map[string]string `json:"labels,omitempty" gorm:"serializer:json"`
+
+	// Soft-deleted artifacts are hidden from downloads and listings until they
+	// are restored or purged
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	DeletedBy *uuid.UUID     `json:"deleted_by,omitempty"`
 }
 
-// BeforeCreate generates a UUID for the artifact ID
+// Artifact status constants
+const (
+	ArtifactStatusPublished       = "published"        // Downloadable and listed
+	ArtifactStatusPendingApproval = "pending-approval" // Stored but hidden until approved
+)
+
+// BeforeCreate generates a UUID for the artifact ID and normalizes its name
 func (a *Artifact) BeforeCreate(tx *gorm.DB) error {
 	if a.ID == uuid.Nil {
 		a.ID = uuid.New()
 	}
+	a.NormalizedName = utils.NormalizePackageName(a.Name, a.Registry)
 	return nil
 }
 
@@ -137,6 +186,7 @@ type PackageOwnership struct {
 	PackageKey string    `json:"package_key" gorm:"not null;index"`
 	UserID     uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
 	Role       string    `json:"role" gorm:"not null"`
+	IsPrimary  bool      `json:"is_primary" gorm:"not null;default:false"` // the owner who may transfer the package
 	GrantedBy  uuid.UUID `json:"granted_by" gorm:"type:uuid;not null"`
 	GrantedAt  time.Time `json:"granted_at" gorm:"not null"`
 	CreatedAt  time.Time `json:"created_at"`
@@ -155,15 +205,91 @@ func (p *PackageOwnership) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Ownership transfer statuses
+const (
+	TransferStatusPending   = "pending"   // Waiting for the recipient to accept or decline
+	TransferStatusAccepted  = "accepted"  // The recipient became the primary owner
+	TransferStatusDeclined  = "declined"  // The recipient refused the package
+	TransferStatusCancelled = "cancelled" // Withdrawn, or replaced by a later proposal
+)
+
+// OwnershipTransfer is a proposal to make another user the primary owner of
+// a package, which takes effect once they accept it
+type OwnershipTransfer struct {
+	ID          uuid.UUID  `json:"id" gorm:"primaryKey"`
+	PackageKey  string     `json:"package_key" gorm:"not null;index"`
+	FromUserID  uuid.UUID  `json:"from_user_id" gorm:"type:uuid;not null"`
+	ToUserID    uuid.UUID  `json:"to_user_id" gorm:"type:uuid;not null;index"`
+	InitiatedBy uuid.UUID  `json:"initiated_by" gorm:"type:uuid;not null"`
+	Status      string     `json:"status" gorm:"not null;default:pending;index"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+// BeforeCreate generates a UUID for the ownership transfer ID
+func (o *OwnershipTransfer) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// Organization owns the packages in a namespace, such as an npm scope, and
+// gives its members access to all of them
+type Organization struct {
+	ID            uuid.UUID `json:"id" gorm:"primaryKey"`
+	Name          string    `json:"name" gorm:"uniqueIndex;not null"`
+	DefaultPublic bool      `json:"default_public" gorm:"not null;default:false"` // visibility of packages first published in the namespace
+	CreatedBy     uuid.UUID `json:"created_by" gorm:"type:uuid;not null"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// BeforeCreate generates a UUID for the organization ID
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// OrganizationMember is a user's role in an organization, which they hold on
+// every package in its namespace
+type OrganizationMember struct {
+	ID             uuid.UUID `json:"id" gorm:"primaryKey"`
+	OrganizationID uuid.UUID `json:"organization_id" gorm:"type:uuid;not null;uniqueIndex:idx_organization_members_user"`
+	UserID         uuid.UUID `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_organization_members_user;index"`
+	Role           string    `json:"role" gorm:"not null"` // owner, maintainer or contributor, as on packages
+	GrantedBy      uuid.UUID `json:"granted_by" gorm:"type:uuid;not null"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// Relationships
+	User User `json:"user" gorm:"foreignKey:UserID"`
+}
+
+// BeforeCreate generates a UUID for the organization member ID
+func (m *OrganizationMember) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
 // RegistrySetting represents runtime configuration for package format registries
 type RegistrySetting struct {
-	ID           uuid.UUID  `json:"id" gorm:"primaryKey"`
-	RegistryName string     `json:"registry_name" gorm:"uniqueIndex;not null"`
-	Enabled      bool       `json:"enabled" gorm:"not null;default:true"`
-	Description  string     `json:"description"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
-	UpdatedBy    *uuid.UUID `json:"updated_by" gorm:"type:uuid"`
+	ID               uuid.UUID  `json:"id" gorm:"primaryKey"`
+	RegistryName     string     `json:"registry_name" gorm:"uniqueIndex;not null"`
+	Enabled          bool       `json:"enabled" gorm:"not null;default:true"`
+	RequireApproval  bool       `json:"require_approval" gorm:"not null;default:false"`
+	RequireSignature bool       `json:"require_signature" gorm:"not null;default:false"`
+	Immutable        bool       `json:"immutable" gorm:"not null;default:false"`
+	ReadOnly         bool       `json:"read_only" gorm:"not null;default:false"`
+	Description      string     `json:"description"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	UpdatedBy        *uuid.UUID `json:"updated_by" gorm:"type:uuid"`
 
 	// Relationships
 	UpdatedByUser *User `json:"updated_by_user" gorm:"foreignKey:UpdatedBy"`
@@ -177,6 +303,255 @@ func (r *RegistrySetting) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// RetentionPolicy describes which versions of a registry's packages are
+// removed automatically to bound storage growth
+type RetentionPolicy struct {
+	ID                   uuid.UUID  `json:"id" gorm:"primaryKey"`
+	RegistryName         string     `json:"registry_name" gorm:"uniqueIndex;not null"`
+	Enabled              bool       `json:"enabled" gorm:"not null;default:false"`
+	KeepLastVersions     int        `json:"keep_last_versions" gorm:"not null;default:0"`      // newest versions kept per package, 0 for all
+	PrereleaseMaxAgeDays int        `json:"prerelease_max_age_days" gorm:"not null;default:0"` // prereleases older than this are removed, 0 to keep them
+	KeepLatest           bool       `json:"keep_latest" gorm:"not null"`                       // never remove the version tagged latest
+	KeepSnapshotBuilds   int        `json:"keep_snapshot_builds" gorm:"not null;default:0"`    // newest timestamped builds kept per Maven -SNAPSHOT version, 0 for all
+	CreatedAt            time.Time  `json:"created_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+	UpdatedBy            *uuid.UUID `json:"updated_by" gorm:"type:uuid"`
+}
+
+// BeforeCreate generates a UUID for the retention policy ID
+func (r *RetentionPolicy) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// Quota limits the storage used by the artifacts a user publishes, across all
+// registries or in a single one
+type Quota struct {
+	ID           uuid.UUID  `json:"id" gorm:"primaryKey"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;uniqueIndex:idx_quotas_user_registry"`
+	RegistryName string     `json:"registry_name" gorm:"not null;default:'';uniqueIndex:idx_quotas_user_registry"` // empty for a limit across all registries
+	MaxBytes     int64      `json:"max_bytes" gorm:"not null;default:0"`                                           // total artifact size allowed, 0 for unlimited
+	MaxArtifacts int64      `json:"max_artifacts" gorm:"not null;default:0"`                                       // artifacts allowed, 0 for unlimited
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	UpdatedBy    *uuid.UUID `json:"updated_by" gorm:"type:uuid"`
+}
+
+// BeforeCreate generates a UUID for the quota ID
+func (q *Quota) BeforeCreate(tx *gorm.DB) error {
+	if q.ID == uuid.Nil {
+		q.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName sets the table name for Quota, which gorm would otherwise take
+// to be plural already
+func (Quota) TableName() string {
+	return "quotas"
+}
+
+// QuotaUsage reports how much of a quota a user has used
+type QuotaUsage struct {
+	RegistryName string `json:"registry_name"` // empty for usage across all registries
+	Bytes        int64  `json:"bytes"`
+	Artifacts    int64  `json:"artifacts"`
+	MaxBytes     int64  `json:"max_bytes"`
+	MaxArtifacts int64  `json:"max_artifacts"`
+}
+
+// AuditEntry records a write made by a user, for the audit trail. Entries are
+// never changed once written.
+type AuditEntry struct {
+	ID        uuid.UUID  `json:"id" gorm:"primaryKey"`
+	ActorID   *uuid.UUID `json:"actor_id" gorm:"type:uuid;index"` // nil for writes without an authenticated user
+	Action    string     `json:"action" gorm:"not null;index"`    // e.g. package.publish, apikey.revoke
+	Target    string     `json:"target" gorm:"not null"`          // what was written, e.g. npm:left-pad@1.0.0
+	Details   JSONMap    `json:"details,omitempty" gorm:"serializer:json"`
+	SourceIP  string     `json:"source_ip"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+}
+
+// BeforeCreate generates a UUID for the audit entry ID
+func (e *AuditEntry) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName sets the table name for AuditEntry
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// PackageMetadata holds the package-wide details of a package: its
+// documentation, taken from the most recent version that was published with
+// it, and its dist-tags
+type PackageMetadata struct {
+	ID        uuid.UUID         `json:"id" gorm:"primaryKey"`
+	Registry  string            `json:"registry" gorm:"not null;uniqueIndex:idx_package_metadata_package"`
+	Name      string            `json:"name" gorm:"not null;uniqueIndex:idx_package_metadata_package"`
+	Readme    string            `json:"readme" gorm:"type:text"`  // markdown
+	Version   string            `json:"version"`                  // version the README was extracted from
+	DistTags  map[string]string `json:"-" gorm:"serializer:json"` // tag to version; latest only when set explicitly
+	CreatedAt time.Time         `json:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// BeforeCreate generates a UUID for the package metadata ID
+func (m *PackageMetadata) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName sets the table name for PackageMetadata
+func (PackageMetadata) TableName() string {
+	return "package_metadata"
+}
+
+// BlobRef counts the artifacts whose content is the blob stored once at a
+// storage path, so the blob is removed only when the last of them is. Blobs
+// are counted by path rather than SHA256 since content stored under
+// different path layouts is stored once per layout.
+type BlobRef struct {
+	StoragePath string    `json:"storage_path" gorm:"primaryKey"`
+	SHA256      string    `json:"sha256" gorm:"not null;index"`
+	Size        int64     `json:"size"`
+	RefCount    int64     `json:"ref_count" gorm:"not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookSubscription is an endpoint notified of package lifecycle events
+type WebhookSubscription struct {
+	ID         uuid.UUID  `json:"id" gorm:"primaryKey"`
+	URL        string     `json:"url" gorm:"not null"`
+	Secret     string     `json:"-" gorm:"not null"`                 // HMAC-SHA256 key deliveries are signed with
+	Events     []string   `json:"events" gorm:"serializer:json"`     // event types delivered, all when empty
+	Registries []string   `json:"registries" gorm:"serializer:json"` // registries whose events are delivered, all when empty
+	Active     bool       `json:"active" gorm:"not null;default:true"`
+	CreatedBy  *uuid.UUID `json:"created_by" gorm:"type:uuid"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate generates a UUID for the webhook subscription ID
+func (w *WebhookSubscription) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// Advisory severities, as npm audit reports them
+const (
+	AdvisorySeverityInfo     = "info"
+	AdvisorySeverityLow      = "low"
+	AdvisorySeverityModerate = "moderate"
+	AdvisorySeverityHigh     = "high"
+	AdvisorySeverityCritical = "critical"
+)
+
+// Advisory is a security advisory recorded for the versions of a package in
+// a range, reported to clients auditing their dependencies
+type Advisory struct {
+	ID                 uuid.UUID  `json:"id" gorm:"primaryKey"`
+	Registry           string     `json:"registry" gorm:"not null;index:idx_advisories_package"`
+	PackageName        string     `json:"package_name" gorm:"not null;index:idx_advisories_package"`
+	VulnerableVersions string     `json:"vulnerable_versions" gorm:"not null"` // semver range, e.g. ">=1.0.0 <1.2.3"
+	Title              string     `json:"title" gorm:"not null"`
+	Severity           string     `json:"severity" gorm:"not null"` // info, low, moderate, high or critical
+	URL                string     `json:"url"`
+	CWE                []string   `json:"cwe" gorm:"serializer:json"`
+	CVSSScore          float64    `json:"cvss_score"`
+	CVSSVector         string     `json:"cvss_vector"`
+	CreatedBy          *uuid.UUID `json:"created_by" gorm:"type:uuid"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+// BeforeCreate generates a UUID for the advisory ID
+func (a *Advisory) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// PublishedVersion is an entry in the append-only ledger of versions
+// published to immutable registries. Each entry's hash covers the entry and
+// the hash of the entry before it, so changing or removing an entry breaks
+// the chain.
+type PublishedVersion struct {
+	Sequence       uint64    `json:"sequence" gorm:"primaryKey;autoIncrement"`
+	Registry       string    `json:"registry" gorm:"not null;index:idx_published_versions_version"`
+	NormalizedName string    `json:"normalized_name" gorm:"not null;index:idx_published_versions_version"`
+	Name           string    `json:"name" gorm:"not null"`
+	Version        string    `json:"version" gorm:"not null;index:idx_published_versions_version"`
+	SHA256         string    `json:"sha256" gorm:"not null"`
+	PublishedBy    uuid.UUID `json:"published_by" gorm:"type:uuid;not null"`
+	PublishedAt    time.Time `json:"published_at" gorm:"not null"`
+	PreviousHash   string    `json:"previous_hash" gorm:"uniqueIndex"`
+	Hash           string    `json:"hash" gorm:"not null;uniqueIndex"`
+}
+
+// Scan statuses of a ScanResult
+const (
+	ScanStatusPending   = "pending"
+	ScanStatusCompleted = "completed"
+	ScanStatusFailed    = "failed"
+)
+
+// Vulnerability severities reported by scanners
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+)
+
+// ScanResult holds the findings of the latest vulnerability scan of an artifact
+type ScanResult struct {
+	ID              uuid.UUID       `json:"id" gorm:"primaryKey"`
+	ArtifactID      uuid.UUID       `json:"artifact_id" gorm:"type:uuid;not null;uniqueIndex"`
+	Scanner         string          `json:"scanner" gorm:"not null"`
+	Status          string          `json:"status" gorm:"not null"` // pending, completed or failed
+	Critical        int             `json:"critical"`
+	High            int             `json:"high"`
+	Medium          int             `json:"medium"`
+	Low             int             `json:"low"`
+	Unknown         int             `json:"unknown"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities" gorm:"serializer:json"`
+	Error           string          `json:"error,omitempty"` // why the scan failed
+	ScannedAt       *time.Time      `json:"scanned_at"`
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
+}
+
+// BeforeCreate generates a UUID for the scan result ID
+func (r *ScanResult) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// Vulnerability is a single finding of a vulnerability scan
+type Vulnerability struct {
+	ID               string `json:"id"` // e.g. CVE-2021-44228
+	Severity         string `json:"severity"`
+	Package          string `json:"package"`
+	InstalledVersion string `json:"installed_version"`
+	FixedVersion     string `json:"fixed_version,omitempty"`
+	Title            string `json:"title,omitempty"`
+}
+
 // Registry interface for different artifact types
 type Registry interface {
 	// Upload stores an artifact
@@ -200,11 +575,18 @@ type Registry interface {
 
 // ArtifactFilter for searching artifacts
 type ArtifactFilter struct {
-	Name     string   `json:"name"`
-	Registry string   `json:"registry"`
-	Tags     []string `json:"tags"`
-	Limit    int      `json:"limit"`
-	Offset   int      `json:"offset"`
+	Name     string `json:"name"`
+	Registry string `json:"registry"`
+	// ExactName matches only the package named Name, normalized, rather than
+	// every package whose name contains it
+	ExactName bool     `json:"exact_name"`
+	Tags      []string `json:"tags"`
+	// Terms must each appear in the name or metadata, ignoring case
+	Terms []string `json:"terms"`
+	// Labels must each be carried by the artifact with the same value
+	Labels map[string]string `json:"labels"`
+	Limit  int               `json:"limit"`  // page size; the registry service applies a default and a cap
+	Offset int               `json:"offset"` // artifacts to skip
 }
 
 // RegistryType represents supported registry types
@@ -220,13 +602,23 @@ const (
 	RegistryGo       RegistryType = "go"
 	RegistryHelm     RegistryType = "helm"
 	RegistryRubyGems RegistryType = "rubygems"
+	RegistryDebian   RegistryType = "debian"
+	RegistryRPM      RegistryType = "rpm"
 )
 
-// AuthToken represents a JWT token
+// AuthToken represents a JWT access token, and the refresh token issued with
+// it at login
 type AuthToken struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	UserID    uuid.UUID `json:"user_id"`
+	Token            string     `json:"token"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	UserID           uuid.UUID  `json:"user_id"`
+	RefreshToken     string     `json:"refresh_token,omitempty"`
+	RefreshExpiresAt *time.Time `json:"refresh_expires_at,omitempty"`
+}
+
+// RefreshRequest represents a request to renew or revoke a refresh token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 // LoginRequest represents a login request
@@ -239,7 +631,13 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=8"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ChangePasswordRequest represents a request to change the caller's password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
 }
 
 // APIResponse represents a standard API response
@@ -263,3 +661,79 @@ type PaginationInfo struct {
 	Total      int64 `json:"total"`
 	TotalPages int   `json:"total_pages"`
 }
+
+// BrowseRegistry summarises a registry format for package browsing
+type BrowseRegistry struct {
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Enabled      bool   `json:"enabled"`
+	PackageCount int64  `json:"package_count"`
+}
+
+// BrowsePackage is a package entry in a registry's package listing
+type BrowsePackage struct {
+	Registry      string    `json:"registry"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	LatestVersion string    `json:"latest_version"`
+	VersionCount  int       `json:"version_count"`
+	Downloads     int64     `json:"downloads"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// BrowseOwner is a user holding a role on a package
+type BrowseOwner struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// BrowseVersion is one published version in a package summary
+type BrowseVersion struct {
+	Version     string    `json:"version"`
+	Downloads   int64     `json:"downloads"`
+	Size        int64     `json:"size"`
+	PublishedAt time.Time `json:"published_at"`
+	Yanked      bool      `json:"yanked,omitempty"`
+}
+
+// BrowsePackageSummary describes a package across all of its published versions
+type BrowsePackageSummary struct {
+	Registry      string          `json:"registry"`
+	Name          string          `json:"name"`
+	Description   string          `json:"description"`
+	LatestVersion string          `json:"latest_version"`
+	Downloads     int64           `json:"downloads"`
+	Versions      []BrowseVersion `json:"versions"` // latest first
+	Owners        []BrowseOwner   `json:"owners"`
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+}
+
+// BrowseFile is a file stored for a package version
+type BrowseFile struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	ContentType string `json:"content_type"`
+}
+
+// BrowseDependency is a dependency declared by a package version
+type BrowseDependency struct {
+	Name       string `json:"name"`
+	Constraint string `json:"constraint"`
+}
+
+// BrowseVersionDetail describes a single published package version
+type BrowseVersionDetail struct {
+	Registry     string             `json:"registry"`
+	Name         string             `json:"name"`
+	Version      string             `json:"version"`
+	Description  string             `json:"description"`
+	Downloads    int64              `json:"downloads"`
+	Publisher    string             `json:"publisher"`
+	PublishedAt  time.Time          `json:"published_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
+	Files        []BrowseFile       `json:"files"`
+	Dependencies []BrowseDependency `json:"dependencies"`
+	Metadata     JSONMap            `json:"metadata"`
+}
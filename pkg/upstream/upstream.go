@@ -0,0 +1,152 @@
+// Package upstream fetches packages missing from a local registry from the
+// public registry it mirrors
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// requestTimeout bounds metadata requests; tarball downloads are bounded
+	// only by the caller's context since they may be large
+	requestTimeout = 30 * time.Second
+
+	// maxMetadataSize bounds how much package metadata is read and cached
+	maxMetadataSize = 32 << 20
+)
+
+// StatusError is returned when the upstream answers with a non-200 status
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("upstream returned status %d", e.StatusCode)
+}
+
+// IsNotFound reports whether err is a client error from the upstream, such
+// as 404, meaning the package does not exist there either
+func IsNotFound(err error) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
+}
+
+// Proxy fetches from one upstream registry, keeping successful metadata
+// responses for a TTL. Client errors are never cached so packages published
+// upstream later are picked up immediately.
+type Proxy struct {
+	baseURL string
+	ttl     time.Duration
+	client  *http.Client
+	now     func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	body    []byte
+	expires time.Time
+}
+
+// NewProxy creates a proxy for the registry at baseURL, caching metadata for
+// ttl. A non-positive ttl disables metadata caching.
+func NewProxy(baseURL string, ttl time.Duration) *Proxy {
+	return &Proxy{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		ttl:     ttl,
+		client:  &http.Client{},
+		now:     time.Now,
+		cache:   make(map[string]cachedResponse),
+	}
+}
+
+// URL returns the base URL of the upstream registry
+func (p *Proxy) URL() string {
+	return p.baseURL
+}
+
+// FetchMetadata returns the document at path, from the cache when a
+// successful response younger than the TTL is held
+func (p *Proxy) FetchMetadata(ctx context.Context, path string) ([]byte, error) {
+	if body, ok := p.cached(path); ok {
+		return body, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	resp, err := p.get(ctx, path, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upstream response: %w", err)
+	}
+	if len(body) > maxMetadataSize {
+		return nil, fmt.Errorf("upstream response exceeds %d bytes", maxMetadataSize)
+	}
+
+	if p.ttl > 0 {
+		p.mu.Lock()
+		p.cache[path] = cachedResponse{body: body, expires: p.now().Add(p.ttl)}
+		p.mu.Unlock()
+	}
+	return body, nil
+}
+
+// Open starts downloading the file at path, returning its content and size,
+// or -1 when the upstream does not report one. The caller must close the
+// content.
+func (p *Proxy) Open(ctx context.Context, path string) (io.ReadCloser, int64, error) {
+	resp, err := p.get(ctx, path, "*/*")
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (p *Proxy) cached(path string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.cache[path]
+	if !ok {
+		return nil, false
+	}
+	if !p.now().Before(entry.expires) {
+		delete(p.cache, path)
+		return nil, false
+	}
+	return entry.body, true
+}
+
+// get requests path from the upstream, returning the response only if it is
+// a 200
+func (p *Proxy) get(ctx context.Context, path, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+path, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream request: %w", err)
+	}
+	req.Header.Set("Accept", accept)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("upstream request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return resp, nil
+}
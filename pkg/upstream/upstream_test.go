@@ -0,0 +1,92 @@
+package upstream
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy_FetchMetadataCachesForTTL(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(`{"name":"left-pad"}`))
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	proxy := NewProxy(server.URL+"/", time.Minute)
+	proxy.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		body, err := proxy.FetchMetadata(context.Background(), "/left-pad")
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"name":"left-pad"}`, string(body))
+	}
+	assert.Equal(t, int32(1), requests.Load())
+
+	now = now.Add(time.Minute)
+	_, err := proxy.FetchMetadata(context.Background(), "/left-pad")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load(), "expired entries are fetched again")
+}
+
+func TestProxy_ClientErrorsNotCached(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name":"fresh"}`))
+	}))
+	defer server.Close()
+
+	proxy := NewProxy(server.URL, time.Hour)
+
+	_, err := proxy.FetchMetadata(context.Background(), "/fresh")
+	require.Error(t, err)
+	assert.True(t, IsNotFound(err))
+
+	body, err := proxy.FetchMetadata(context.Background(), "/fresh")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"fresh"}`, string(body))
+}
+
+func TestProxy_Open(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pkg/-/pkg-1.0.0.tgz":
+			w.Write([]byte("tarball"))
+		case "/broken/-/broken-1.0.0.tgz":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	proxy := NewProxy(server.URL, time.Hour)
+
+	content, size, err := proxy.Open(context.Background(), "/pkg/-/pkg-1.0.0.tgz")
+	require.NoError(t, err)
+	defer content.Close()
+	data, err := io.ReadAll(content)
+	require.NoError(t, err)
+	assert.Equal(t, "tarball", string(data))
+	assert.Equal(t, int64(len("tarball")), size)
+
+	_, _, err = proxy.Open(context.Background(), "/missing/-/missing-1.0.0.tgz")
+	assert.True(t, IsNotFound(err))
+
+	_, _, err = proxy.Open(context.Background(), "/broken/-/broken-1.0.0.tgz")
+	require.Error(t, err)
+	assert.False(t, IsNotFound(err), "server errors are not treated as missing packages")
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrArchiveTooLarge is returned when a package archive expands beyond the
+// archive limits
+var ErrArchiveTooLarge = errors.New("archive exceeds extraction limits")
+
+// ArchiveLimits bound what is read from a package archive, so that a small
+// compressed upload cannot expand to exhaust memory
+type ArchiveLimits struct {
+	MaxEntrySize int64 // bytes read from any one entry
+	MaxTotalSize int64 // bytes decompressed from the whole archive
+	MaxEntries   int   // entries in the archive
+}
+
+// DefaultArchiveLimits apply to every package archive Lodestone inspects
+var DefaultArchiveLimits = ArchiveLimits{
+	MaxEntrySize: 32 << 20,
+	MaxTotalSize: 1 << 30,
+	MaxEntries:   100000,
+}
+
+// TarReader reads a tar stream within DefaultArchiveLimits, failing with
+// ErrArchiveTooLarge once the stream holds too many entries or expands too far
+type TarReader struct {
+	*tar.Reader
+	limits  ArchiveLimits
+	entries int
+}
+
+// NewTarReader returns a tar reader over r, typically a gzip reader, that
+// enforces DefaultArchiveLimits
+func NewTarReader(r io.Reader) *TarReader {
+	limits := DefaultArchiveLimits
+	return &TarReader{
+		Reader: tar.NewReader(&limitedReader{r: r, limit: limits.MaxTotalSize, remaining: limits.MaxTotalSize}),
+		limits: limits,
+	}
+}
+
+// Next advances to the next entry, failing once the archive holds more than
+// the maximum number of entries
+func (t *TarReader) Next() (*tar.Header, error) {
+	header, err := t.Reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	t.entries++
+	if t.entries > t.limits.MaxEntries {
+		return nil, fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, t.limits.MaxEntries)
+	}
+	return header, nil
+}
+
+// ReadEntry reads the current entry, failing if it is larger than the
+// maximum entry size
+func (t *TarReader) ReadEntry() ([]byte, error) {
+	return readLimited(t.Reader, t.limits.MaxEntrySize)
+}
+
+// limitedReader fails with ErrArchiveTooLarge rather than reporting EOF once
+// its limit is used up
+type limitedReader struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		return 0, fmt.Errorf("%w: expands to more than %d bytes", ErrArchiveTooLarge, l.limit)
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// NewZipReader opens a zip archive held in memory, refusing archives with
+// more entries than DefaultArchiveLimits allow or whose entries declare more
+// content in total. The zip reader itself refuses entries longer than they
+// declare.
+func NewZipReader(content []byte) (*zip.Reader, error) {
+	reader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	limits := DefaultArchiveLimits
+	if len(reader.File) > limits.MaxEntries {
+		return nil, fmt.Errorf("%w: more than %d entries", ErrArchiveTooLarge, limits.MaxEntries)
+	}
+	var total uint64
+	for _, file := range reader.File {
+		total += file.UncompressedSize64
+		if total > uint64(limits.MaxTotalSize) {
+			return nil, fmt.Errorf("%w: expands to more than %d bytes", ErrArchiveTooLarge, limits.MaxTotalSize)
+		}
+	}
+	return reader, nil
+}
+
+// ReadZipFile reads an entry of a zip archive, failing if it is larger than
+// the maximum entry size
+func ReadZipFile(file *zip.File) ([]byte, error) {
+	if file.UncompressedSize64 > uint64(DefaultArchiveLimits.MaxEntrySize) {
+		return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrArchiveTooLarge, file.Name, DefaultArchiveLimits.MaxEntrySize)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return readLimited(rc, DefaultArchiveLimits.MaxEntrySize)
+}
+
+// readLimited reads all of r, failing with ErrArchiveTooLarge if it holds
+// more than max bytes
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%w: entry is larger than %d bytes", ErrArchiveTooLarge, max)
+	}
+	return data, nil
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// withArchiveLimits lowers DefaultArchiveLimits for the duration of a test
+func withArchiveLimits(t *testing.T, limits ArchiveLimits) {
+	t.Helper()
+	previous := DefaultArchiveLimits
+	DefaultArchiveLimits = limits
+	t.Cleanup(func() { DefaultArchiveLimits = previous })
+}
+
+func createTarball(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func createZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// readTarball reads every entry of a gzipped tarball through a TarReader
+func readTarball(content []byte) error {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	tarReader := NewTarReader(gzipReader)
+	for {
+		_, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tarReader.ReadEntry(); err != nil {
+			return err
+		}
+	}
+}
+
+func TestTarReader_Limits(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  ArchiveLimits
+		files   map[string][]byte
+		wantErr bool
+	}{
+		{
+			name:   "within limits",
+			limits: ArchiveLimits{MaxEntrySize: 1024, MaxTotalSize: 1 << 20, MaxEntries: 3},
+			files:  map[string][]byte{"package/a": make([]byte, 1024), "package/b": make([]byte, 1024)},
+		},
+		{
+			name:    "entry too large",
+			limits:  ArchiveLimits{MaxEntrySize: 1024, MaxTotalSize: 1 << 20, MaxEntries: 3},
+			files:   map[string][]byte{"package/a": make([]byte, 1025)},
+			wantErr: true,
+		},
+		{
+			name:    "too many entries",
+			limits:  ArchiveLimits{MaxEntrySize: 1024, MaxTotalSize: 1 << 20, MaxEntries: 3},
+			files:   map[string][]byte{"package/a": nil, "package/b": nil, "package/c": nil, "package/d": nil},
+			wantErr: true,
+		},
+		{
+			name:    "archive expands too far",
+			limits:  ArchiveLimits{MaxEntrySize: 64 << 10, MaxTotalSize: 96 << 10, MaxEntries: 3},
+			files:   map[string][]byte{"package/a": make([]byte, 64<<10), "package/b": make([]byte, 64<<10)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withArchiveLimits(t, tt.limits)
+
+			err := readTarball(createTarball(t, tt.files))
+			if tt.wantErr && !errors.Is(err, ErrArchiveTooLarge) {
+				t.Errorf("readTarball() error = %v, want ErrArchiveTooLarge", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("readTarball() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestTarReader_CompressionBomb(t *testing.T) {
+	// 64 MiB of zeros compresses to a few dozen kilobytes
+	content := createTarball(t, map[string][]byte{"package/package.json": make([]byte, 64<<20)})
+	if len(content) > 1<<20 {
+		t.Fatalf("compressed archive is %d bytes", len(content))
+	}
+
+	if err := readTarball(content); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("readTarball() error = %v, want ErrArchiveTooLarge", err)
+	}
+}
+
+func TestNewZipReader_Limits(t *testing.T) {
+	withArchiveLimits(t, ArchiveLimits{MaxEntrySize: 1024, MaxTotalSize: 2048, MaxEntries: 3})
+
+	if _, err := NewZipReader(createZip(t, map[string][]byte{"a": make([]byte, 1024), "b": make([]byte, 1024)})); err != nil {
+		t.Errorf("NewZipReader() error = %v", err)
+	}
+
+	files := make(map[string][]byte)
+	for i := 0; i < 4; i++ {
+		files[fmt.Sprintf("file%d", i)] = nil
+	}
+	if _, err := NewZipReader(createZip(t, files)); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("NewZipReader() with too many entries error = %v, want ErrArchiveTooLarge", err)
+	}
+
+	content := createZip(t, map[string][]byte{"a": make([]byte, 1024), "b": make([]byte, 1024), "c": make([]byte, 1)})
+	if _, err := NewZipReader(content); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("NewZipReader() expanding too far error = %v, want ErrArchiveTooLarge", err)
+	}
+}
+
+func TestReadZipFile_CompressionBomb(t *testing.T) {
+	// 64 MiB of zeros deflates to a few dozen kilobytes
+	content := createZip(t, map[string][]byte{"bomb.nuspec": make([]byte, 64<<20)})
+	if len(content) > 1<<20 {
+		t.Fatalf("compressed archive is %d bytes", len(content))
+	}
+
+	reader, err := NewZipReader(content)
+	if err != nil {
+		t.Fatalf("NewZipReader() error = %v", err)
+	}
+	if _, err := ReadZipFile(reader.File[0]); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("ReadZipFile() error = %v, want ErrArchiveTooLarge", err)
+	}
+}
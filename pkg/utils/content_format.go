@@ -0,0 +1,48 @@
+package utils
+
+import "bytes"
+
+// ContentFormat is the container format of package content, as identified by
+// its leading magic bytes
+type ContentFormat string
+
+// Content formats of package archives
+const (
+	FormatUnknown ContentFormat = ""
+	FormatGzip    ContentFormat = "gzip"
+	FormatZip     ContentFormat = "zip"
+	FormatTar     ContentFormat = "tar"
+	FormatAr      ContentFormat = "ar"
+	FormatRPM     ContentFormat = "rpm"
+)
+
+var (
+	gzipMagic     = []byte{0x1f, 0x8b}
+	zipMagic      = []byte("PK\x03\x04")
+	emptyZipMagic = []byte("PK\x05\x06")
+	arMagic       = []byte("!<arch>\n")
+	rpmMagic      = []byte{0xed, 0xab, 0xee, 0xdb}
+	tarMagic      = []byte("ustar")
+)
+
+// tarMagicOffset is where the ustar magic sits in a tar header
+const tarMagicOffset = 257
+
+// DetectContentFormat identifies the container format of content from its
+// magic bytes, returning FormatUnknown if it is none of the known formats
+func DetectContentFormat(content []byte) ContentFormat {
+	switch {
+	case bytes.HasPrefix(content, gzipMagic):
+		return FormatGzip
+	case bytes.HasPrefix(content, zipMagic), bytes.HasPrefix(content, emptyZipMagic):
+		return FormatZip
+	case bytes.HasPrefix(content, arMagic):
+		return FormatAr
+	case bytes.HasPrefix(content, rpmMagic):
+		return FormatRPM
+	case len(content) >= tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(content[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		return FormatTar
+	}
+	return FormatUnknown
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestDetectContentFormat(t *testing.T) {
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte("content"))
+	gw.Close()
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, _ := zw.Create("file.txt")
+	w.Write([]byte("content"))
+	zw.Close()
+
+	var emptyZip bytes.Buffer
+	zip.NewWriter(&emptyZip).Close()
+
+	var tarred bytes.Buffer
+	tw := tar.NewWriter(&tarred)
+	tw.WriteHeader(&tar.Header{Name: "file.txt", Mode: 0o644, Size: 7})
+	tw.Write([]byte("content"))
+	tw.Close()
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    ContentFormat
+	}{
+		{"gzip", gzipped.Bytes(), FormatGzip},
+		{"zip", zipped.Bytes(), FormatZip},
+		{"empty zip", emptyZip.Bytes(), FormatZip},
+		{"tar", tarred.Bytes(), FormatTar},
+		{"ar", []byte("!<arch>\ndebian-binary   "), FormatAr},
+		{"rpm", []byte{0xed, 0xab, 0xee, 0xdb, 0x03, 0x00}, FormatRPM},
+		{"plain text", []byte("not an archive"), FormatUnknown},
+		{"empty", nil, FormatUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectContentFormat(tt.content); got != tt.want {
+				t.Errorf("DetectContentFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
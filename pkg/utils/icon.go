@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MaxIconSize is the largest icon that will be extracted from a package (1 MB, matching nuget.org)
+const MaxIconSize = 1 << 20
+
+// conventionIconNames are the file names recognised as a package icon when found at the package root
+var conventionIconNames = []string{
+	"icon.png", "icon.jpg", "icon.jpeg",
+	"logo.png", "logo.jpg", "logo.jpeg",
+}
+
+// supportedIconTypes are the image content types that may be served as
+// icons. SVG is not among them, as it can carry scripts that would run on
+// the registry's origin.
+var supportedIconTypes = map[string]bool{
+	"image/png":    true,
+	"image/jpeg":   true,
+	"image/gif":    true,
+	"image/webp":   true,
+	"image/x-icon": true,
+}
+
+// IsConventionIconFile reports whether a path relative to the package root is a conventional icon file
+func IsConventionIconFile(filePath string) bool {
+	if strings.Contains(filePath, "/") {
+		return false
+	}
+	name := strings.ToLower(filePath)
+	for _, candidate := range conventionIconNames {
+		if name == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// IconContentType returns the image content type of an icon, sniffed from its
+// content rather than trusting its file name, or an empty string if the icon
+// is not a supported image
+func IconContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if idx := strings.Index(contentType, ";"); idx != -1 {
+		contentType = strings.TrimSpace(contentType[:idx])
+	}
+	if !supportedIconTypes[contentType] {
+		return ""
+	}
+	return contentType
+}
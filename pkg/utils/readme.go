@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MaxReadmeSize is the largest README that will be extracted from a package
+const MaxReadmeSize = 1 << 20
+
+// conventionReadmeNames are the file names recognised as a package README when
+// found at the package root, most preferred first
+var conventionReadmeNames = []string{"readme.md", "readme.markdown", "readme", "readme.txt"}
+
+// readmePreference ranks a path relative to the package root as a README,
+// returning -1 for files that are not one
+func readmePreference(filePath string) int {
+	if strings.Contains(filePath, "/") {
+		return -1
+	}
+	name := strings.ToLower(filePath)
+	for i, candidate := range conventionReadmeNames {
+		if name == candidate {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsConventionReadmeFile reports whether a path relative to the package root is a conventional README file
+func IsConventionReadmeFile(filePath string) bool {
+	return readmePreference(filePath) >= 0
+}
+
+// ExtractTarballReadme returns the conventional README at the root of a
+// gzipped tarball whose contents are nested under a single top-level
+// directory, as npm, Helm and Cargo package them. It returns an empty string
+// if the package has no README.
+func ExtractTarballReadme(content []byte) (string, error) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return "", fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	defer gzipReader.Close()
+
+	readme, best := "", len(conventionReadmeNames)
+	tarReader := NewTarReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read tar header: %w", err)
+		}
+
+		parts := strings.SplitN(strings.TrimPrefix(header.Name, "./"), "/", 2)
+		if len(parts) != 2 || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		preference := readmePreference(parts[1])
+		if preference < 0 || preference >= best {
+			continue
+		}
+
+		if header.Size > MaxReadmeSize {
+			return "", fmt.Errorf("README %s exceeds maximum size of %d bytes", header.Name, MaxReadmeSize)
+		}
+		data, err := tarReader.ReadEntry()
+		if err != nil {
+			return "", fmt.Errorf("failed to read README: %w", err)
+		}
+		readme, best = string(data), preference
+	}
+
+	return readme, nil
+}
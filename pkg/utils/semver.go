@@ -1,12 +1,23 @@
 package utils
 
 import (
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/rs/zerolog/log"
 )
 
+// rangeComparatorPattern matches the comparators of a semver range: an
+// optional operator followed by a version, which may be partial or use
+// wildcards, and its prerelease
+var rangeComparatorPattern = regexp.MustCompile(`(!=|>=|=>|<=|=<|~>|[=<>~^])?\s*v?((?:\d+|[xX*])(?:\.(?:\d+|[xX*])){0,2})(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?`)
+
+// hyphenRangePattern matches a hyphen range such as "1.2 - 1.4"
+var hyphenRangePattern = regexp.MustCompile(`(\S+)\s+-\s+(\S+)`)
+
 // SortVersions sorts the given version strings in semantic versioning order (latest version first)
 func SortVersions(versions []string) []string {
 	// Parse versions to semver.Version objects
@@ -27,10 +38,10 @@ func SortVersions(versions []string) []string {
 		return semverVersions[i].GreaterThan(semverVersions[j])
 	})
 
-	// Convert back to string
+	// Convert back to the versions as given, keeping any v prefix
 	result := make([]string, len(semverVersions))
 	for i, v := range semverVersions {
-		result[i] = v.String()
+		result[i] = v.Original()
 	}
 
 	return result
@@ -56,10 +67,10 @@ func SortVersionsAscending(versions []string) []string {
 		return semverVersions[i].LessThan(semverVersions[j])
 	})
 
-	// Convert back to string
+	// Convert back to the versions as given, keeping any v prefix
 	result := make([]string, len(semverVersions))
 	for i, v := range semverVersions {
-		result[i] = v.String()
+		result[i] = v.Original()
 	}
 
 	return result
@@ -148,3 +159,132 @@ func CompareVersions(v1, v2 string) int {
 	}
 	return 1
 }
+
+// FilterVersions returns the versions satisfying the semver range, latest first.
+// An empty range matches every version, keeping versions that are not valid
+// semver after the rest in their original order; otherwise such versions never
+// match. Prereleases are only returned when includePrerelease is set, in which
+// case, as in node-semver, a prerelease matches a range only if it satisfies
+// it and the range opts in to prereleases of its release by naming one, so
+// 1.2.0-rc.2 satisfies ">=1.2.0-rc.1 <2" but neither 1.2.0-rc.1 nor
+// 1.5.0-rc.1 satisfies ">=1.2.0".
+func FilterVersions(versions []string, constraint string, includePrerelease bool) ([]string, error) {
+	var constraints *semver.Constraints
+	if constraint != "" {
+		var err error
+		constraints, err = semver.NewConstraint(constraint)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	type parsedVersion struct {
+		original string
+		version  *semver.Version
+	}
+	matched := make([]parsedVersion, 0, len(versions))
+	var unparsed []string
+
+	for _, v := range versions {
+		sv, err := semver.NewVersion(v)
+		if err != nil {
+			if constraints == nil {
+				unparsed = append(unparsed, v)
+			}
+			continue
+		}
+
+		if sv.Prerelease() != "" && !includePrerelease {
+			continue
+		}
+
+		if constraints != nil {
+			if sv.Prerelease() == "" && !constraints.Check(sv) {
+				continue
+			}
+			if sv.Prerelease() != "" && !prereleaseSatisfies(sv, constraint) {
+				continue
+			}
+		}
+
+		matched = append(matched, parsedVersion{original: v, version: sv})
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		return matched[i].version.GreaterThan(matched[j].version)
+	})
+
+	result := make([]string, 0, len(matched)+len(unparsed))
+	for _, v := range matched {
+		result = append(result, v.original)
+	}
+	return append(result, unparsed...), nil
+}
+
+// prereleaseSatisfies reports whether a prerelease satisfies a range, which
+// it does if one of the range's sets of comparators, separated by "||",
+// includes a prerelease of the same release and the prerelease satisfies
+// every comparator of the set
+func prereleaseSatisfies(version *semver.Version, constraint string) bool {
+	release, err := version.SetPrerelease("")
+	if err != nil {
+		return false
+	}
+
+	for _, set := range strings.Split(constraint, "||") {
+		set = hyphenRangePattern.ReplaceAllString(set, ">=$1 <=$2")
+		comparators := rangeComparatorPattern.FindAllStringSubmatch(set, -1)
+		optedIn, satisfied := false, len(comparators) > 0
+		for _, comparator := range comparators {
+			operator, bound, prerelease := comparator[1], comparator[2], comparator[3]
+			if prerelease == "" {
+				satisfied = satisfied && releaseComparatorSatisfied(comparator[0], operator, bound, &release)
+				continue
+			}
+
+			if named, err := semver.NewVersion(bound + "-" + prerelease); err == nil &&
+				named.Major() == version.Major() && named.Minor() == version.Minor() && named.Patch() == version.Patch() {
+				optedIn = true
+			}
+			single, err := semver.NewConstraint(comparator[0])
+			satisfied = satisfied && err == nil && single.Check(version)
+		}
+		if optedIn && satisfied {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseComparatorSatisfied reports whether a prerelease of release
+// satisfies a comparator naming no prerelease. The prerelease orders just
+// below its release, so it compares as its release does except against a
+// bound at the release itself, which it is below.
+func releaseComparatorSatisfied(comparator, operator, bound string, release *semver.Version) bool {
+	parts := strings.Split(bound, ".")
+	padded := make([]uint64, 3)
+	full := len(parts) == 3
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			// Wildcards match from the start of the release they are in
+			full = false
+			continue
+		}
+		padded[i] = n
+	}
+
+	if padded[0] == release.Major() && padded[1] == release.Minor() && padded[2] == release.Patch() {
+		switch operator {
+		case "<=", "=<", "!=":
+			return true
+		case "<":
+			// Partial bounds such as "<2" exclude the prereleases of 2.0.0
+			return full
+		}
+		return false
+	}
+
+	single, err := semver.NewConstraint(comparator)
+	return err == nil && single.Check(release)
+}
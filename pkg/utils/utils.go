@@ -44,6 +44,12 @@ func GenerateJWT(userID uuid.UUID, secret string, expiration time.Duration) (str
 
 // ValidateJWT validates and parses a JWT token
 func ValidateJWT(tokenString, secret string) (uuid.UUID, error) {
+	userID, _, err := ParseJWT(tokenString, secret)
+	return userID, err
+}
+
+// ParseJWT validates a JWT token and returns its user and when it was issued
+func ParseJWT(tokenString, secret string) (uuid.UUID, time.Time, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -52,24 +58,28 @@ func ValidateJWT(tokenString, secret string) (uuid.UUID, error) {
 	})
 
 	if err != nil {
-		return uuid.Nil, err
+		return uuid.Nil, time.Time{}, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		userIDStr, ok := claims["user_id"].(string)
 		if !ok {
-			return uuid.Nil, fmt.Errorf("invalid user_id claim")
+			return uuid.Nil, time.Time{}, fmt.Errorf("invalid user_id claim")
 		}
 
 		userID, err := uuid.Parse(userIDStr)
 		if err != nil {
-			return uuid.Nil, fmt.Errorf("invalid user_id format")
+			return uuid.Nil, time.Time{}, fmt.Errorf("invalid user_id format")
 		}
 
-		return userID, nil
+		var issuedAt time.Time
+		if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+			issuedAt = iat.Time
+		}
+		return userID, issuedAt, nil
 	}
 
-	return uuid.Nil, fmt.Errorf("invalid token")
+	return uuid.Nil, time.Time{}, fmt.Errorf("invalid token")
 }
 
 // ComputeSHA256 computes the SHA256 hash of data
@@ -107,10 +117,13 @@ func ComputeSHA1FromReader(reader io.Reader) (string, error) {
 // - npm: lowercase (case insensitive)
 // - nuget: preserve case (case sensitive)
 // - maven: preserve case (case sensitive)
+// - go: unchanged (module paths are case sensitive and may contain _)
 // - other: lowercase by default
 func SanitizePackageName(name, registryType string) string {
 	// Handle case sensitivity based on registry type
 	switch registryType {
+	case "go":
+		return name
 	case "nuget", "maven":
 		// Case-sensitive registries: preserve original case
 		name = strings.ReplaceAll(name, " ", "-")
@@ -124,6 +137,16 @@ func SanitizePackageName(name, registryType string) string {
 	return name
 }
 
+// NormalizePackageName returns the key a package name is looked up by, so
+// that names differing only in incidental case match. Go module paths are
+// case sensitive and are their own key.
+func NormalizePackageName(name, registryType string) string {
+	if registryType == "go" {
+		return name
+	}
+	return strings.ToLower(name)
+}
+
 // ValidateVersion checks if a version string is valid (basic semver)
 func ValidateVersion(version string) bool {
 	// Basic validation - should be enhanced for specific registry requirements
@@ -139,7 +162,7 @@ func ValidateVersion(version string) bool {
 func IsValidRegistryType(registryType string) bool {
 	validTypes := []string{
 		"nuget", "oci", "opa", "maven", "npm",
-		"cargo", "go", "helm", "rubygems",
+		"cargo", "go", "helm", "rubygems", "debian", "rpm",
 	}
 
 	for _, valid := range validTypes {
@@ -134,6 +134,12 @@ func TestSanitizePackageName(t *testing.T) {
 			registryType: "maven",
 			want:         "com.example.MyArtifact",
 		},
+		{
+			name:         "go preserve module path",
+			input:        "GitHub.com/User/my_module",
+			registryType: "go",
+			want:         "GitHub.com/User/my_module",
+		},
 		{
 			name:         "default registry lowercase",
 			input:        "MyPackage",
@@ -151,6 +157,27 @@ func TestSanitizePackageName(t *testing.T) {
 	}
 }
 
+func TestNormalizePackageName(t *testing.T) {
+	tests := []struct {
+		input        string
+		registryType string
+		want         string
+	}{
+		{"Lodash", "npm", "lodash"},
+		{"@Scope/Pkg", "npm", "@scope/pkg"},
+		{"Lodestone.TestLibrary", "nuget", "lodestone.testlibrary"},
+		{"GitHub.com/User/Repo", "go", "GitHub.com/User/Repo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.registryType+" "+tt.input, func(t *testing.T) {
+			if got := NormalizePackageName(tt.input, tt.registryType); got != tt.want {
+				t.Errorf("NormalizePackageName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestValidateVersion(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -266,3 +293,140 @@ func TestFormatBytes(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterVersions(t *testing.T) {
+	versions := []string{"1.0.0", "1.2.0-rc.1", "1.2.0", "1.2.1", "1.5.0-beta.1", "1.9.9", "2.0.0-rc.1", "2.0.0", "2.1.0", "latest"}
+
+	tests := []struct {
+		name              string
+		constraint        string
+		includePrerelease bool
+		want              []string
+	}{
+		{
+			name:       "inclusive lower, exclusive upper",
+			constraint: ">=1.2 <2",
+			want:       []string{"1.9.9", "1.2.1", "1.2.0"},
+		},
+		{
+			name:       "exclusive lower, inclusive upper",
+			constraint: ">1.2.0 <=2.0.0",
+			want:       []string{"2.0.0", "1.9.9", "1.2.1"},
+		},
+		{
+			name:              "prereleases not named by the range",
+			constraint:        ">=1.2 <2",
+			includePrerelease: true,
+			want:              []string{"1.9.9", "1.2.1", "1.2.0"},
+		},
+		{
+			name:              "prerelease of inclusive lower bound",
+			constraint:        ">=1.2.0",
+			includePrerelease: true,
+			want:              []string{"2.1.0", "2.0.0", "1.9.9", "1.2.1", "1.2.0"},
+		},
+		{
+			name:              "prerelease of inclusive upper bound",
+			constraint:        ">=1.2 <=2.0.0",
+			includePrerelease: true,
+			want:              []string{"2.0.0", "1.9.9", "1.2.1", "1.2.0"},
+		},
+		{
+			name:              "prereleases of the release the range names",
+			constraint:        ">=1.2.0-rc.0 <2",
+			includePrerelease: true,
+			want:              []string{"1.9.9", "1.2.1", "1.2.0", "1.2.0-rc.1"},
+		},
+		{
+			name:       "named prereleases need includePrerelease",
+			constraint: ">=1.2.0-rc.0 <2",
+			want:       []string{"1.9.9", "1.2.1", "1.2.0"},
+		},
+		{
+			name:              "prereleases below a release",
+			constraint:        ">=2.0.0-rc.0 <2.0.0",
+			includePrerelease: true,
+			want:              []string{"2.0.0-rc.1"},
+		},
+		{
+			name:              "prereleases in one of several ranges",
+			constraint:        "<1.1 || ^1.5.0-beta.0",
+			includePrerelease: true,
+			want:              []string{"1.9.9", "1.5.0-beta.1", "1.0.0"},
+		},
+		{
+			name:       "caret range",
+			constraint: "^2",
+			want:       []string{"2.1.0", "2.0.0"},
+		},
+		{
+			name:       "no range keeps every release",
+			constraint: "",
+			want:       []string{"2.1.0", "2.0.0", "1.9.9", "1.2.1", "1.2.0", "1.0.0", "latest"},
+		},
+		{
+			name:              "no range with prereleases",
+			constraint:        "",
+			includePrerelease: true,
+			want:              []string{"2.1.0", "2.0.0", "2.0.0-rc.1", "1.9.9", "1.5.0-beta.1", "1.2.1", "1.2.0", "1.2.0-rc.1", "1.0.0", "latest"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FilterVersions(versions, tt.constraint, tt.includePrerelease)
+			if err != nil {
+				t.Fatalf("FilterVersions() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("FilterVersions() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("FilterVersions() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	if _, err := FilterVersions(versions, ">=not-a-version", false); err == nil {
+		t.Error("FilterVersions() expected error for invalid range")
+	}
+}
+
+func TestIconContentType(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "png",
+			data: "\x89PNG\r\n\x1a\nicon",
+			want: "image/png",
+		},
+		{
+			name: "gif",
+			data: "GIF89a icon",
+			want: "image/gif",
+		},
+		{
+			name: "svg",
+			data: `<svg xmlns="http://www.w3.org/2000/svg"></svg>`,
+			want: "",
+		},
+		{
+			name: "html",
+			data: "<html><script>alert(1)</script></html>",
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IconContentType([]byte(tt.data)); got != tt.want {
+				t.Errorf("IconContentType() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Package version holds the build metadata of the running binary. The
+// variables are set at build time with -ldflags, for example
+//
+//	go build -ldflags "-X github.com/lgulliver/lodestone/pkg/version.Version=v1.2.0" ./cmd/api-gateway
+//
+// and are "dev" in builds that do not set them.
+package version
+
+import "runtime"
+
+// Build metadata injected with -ldflags -X
+var (
+	Version   = "dev"
+	Commit    = "dev"
+	BuildTime = "dev"
+)
+
+// Info is the build metadata of the running binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build metadata of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+}
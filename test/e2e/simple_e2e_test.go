@@ -136,11 +136,16 @@ func setupSimpleTestEnvironment(t *testing.T, testDir string) (*registry.Service
 	sqlDB.SetMaxIdleConns(1)
 
 	// Use GORM AutoMigrate instead of raw SQL
-	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.PackageOwnership{})
+	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.BlobRef{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{}, &types.RegistrySetting{}, &types.Quota{})
 	if err != nil {
 		t.Fatal("Failed to migrate database:", err)
 	}
 
+	// Enable the npm registry used by the workflow
+	if err := db.Create(&types.RegistrySetting{RegistryName: "npm", Enabled: true}).Error; err != nil {
+		t.Fatal("Failed to enable npm registry:", err)
+	}
+
 	// Create test user
 	testUser := &types.User{
 		ID:       uuid.New(),
@@ -3,6 +3,7 @@ package storage_test
 
 import (
 	"archive/tar"
+	"archive/zip"
 	"bytes"
 	"compress/gzip"
 	"context"
@@ -89,6 +90,25 @@ func createTestNpmPackage(packageData map[string]interface{}) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// createTestGoModuleZip creates a module zip holding only a go.mod
+func createTestGoModuleZip(module, version string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	f, err := w.Create(module + "@" + version + "/go.mod")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write([]byte("module " + module + "\n\ngo 1.21\n")); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func TestStorageEndToEndIntegration(t *testing.T) {
 	t.Log("=== Enhanced Storage End-to-End Integration Test ===")
 
@@ -148,11 +168,18 @@ func setupTestServiceE2E(t *testing.T, testDir string) (*registry.Service, uuid.
 	sqlDB.SetMaxIdleConns(1)
 
 	// Use GORM AutoMigrate instead of raw SQL
-	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.PackageOwnership{})
+	err = db.AutoMigrate(&types.User{}, &types.Artifact{}, &types.BlobRef{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{}, &types.RegistrySetting{}, &types.Quota{})
 	if err != nil {
 		t.Fatal("Failed to migrate database:", err)
 	}
 
+	// Enable the registries exercised by the test
+	for _, name := range []string{"npm", "nuget", "maven", "go", "helm", "oci", "opa", "cargo", "rubygems"} {
+		if err := db.Create(&types.RegistrySetting{RegistryName: name, Enabled: true}).Error; err != nil {
+			t.Fatal("Failed to enable registry:", err)
+		}
+	}
+
 	// Create test user
 	testUser := &types.User{
 		ID:       uuid.New(),
@@ -373,6 +400,9 @@ func testMultipleRegistriesE2E(t *testing.T, service *registry.Service, userID u
 	npmTarballData, err := createTestNpmPackage(npmPackageData)
 	assert.NoError(t, err, "Creating npm test package should not fail")
 
+	goModuleZip, err := createTestGoModuleZip("github.com/example/test-module", "v1.2.3")
+	assert.NoError(t, err, "Creating Go test module should not fail")
+
 	registryTests := []struct {
 		registry    string
 		packageName string
@@ -382,7 +412,7 @@ func testMultipleRegistriesE2E(t *testing.T, service *registry.Service, userID u
 		{"npm", "npm-test-package", "1.0.0", npmTarballData},
 		{"nuget", "NuGet.Test.Package", "2.0.0", `<package><metadata><id>NuGet.Test.Package</id><version>2.0.0</version></metadata></package>`},
 		{"maven", "com.example:test-artifact", "1.5.0", `<project><groupId>com.example</groupId><artifactId>test-artifact</artifactId><version>1.5.0</version></project>`},
-		{"go", "github.com/example/test-module", "v1.2.3", `module github.com/example/test-module\n\ngo 1.21`},
+		{"go", "github.com/example/test-module", "v1.2.3", goModuleZip},
 		{"helm", "test-chart", "0.1.0", `name: test-chart\nversion: 0.1.0\ndescription: Test Helm chart`},
 	}
 
@@ -430,22 +460,22 @@ func testMultipleRegistriesE2E(t *testing.T, service *registry.Service, userID u
 			t.Fatalf("Failed to read content from %s registry: %v", test.registry, err)
 		}
 
-		// Special case for npm which uses byte slices
-		if test.registry == "npm" {
-			// Compare sizes for npm (byte slice comparison)
-			npmContent, ok := test.content.([]byte)
+		// Special case for npm and Go, which use byte slices
+		if test.registry == "npm" || test.registry == "go" {
+			// Compare sizes for byte slice content
+			byteContent, ok := test.content.([]byte)
 			if !ok {
-				t.Fatal("Expected []byte content for npm")
+				t.Fatalf("Expected []byte content for %s", test.registry)
 			}
-			if len(downloadedContent) != len(npmContent) {
+			if len(downloadedContent) != len(byteContent) {
 				t.Fatalf("Content size mismatch for %s registry: expected %d, got %d",
-					test.registry, len(npmContent), len(downloadedContent))
+					test.registry, len(byteContent), len(downloadedContent))
 			}
 		} else {
 			// For other registries, compare strings
 			stringContent, ok := test.content.(string)
 			if !ok {
-				t.Fatal("Expected string content for non-npm registry")
+				t.Fatalf("Expected string content for %s registry", test.registry)
 			}
 			if string(downloadedContent) != stringContent {
 				t.Fatalf("Content mismatch for %s registry", test.registry)
@@ -81,9 +81,14 @@ func TestStorageIntegrationWithRegistry(t *testing.T) {
 	require.NoError(t, err)
 
 	// Run auto migrations
-	err = db.AutoMigrate(&types.User{}, &types.APIKey{}, &types.Artifact{}, &types.PackageOwnership{})
+	err = db.AutoMigrate(&types.User{}, &types.APIKey{}, &types.Artifact{}, &types.BlobRef{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{}, &types.RegistrySetting{}, &types.Quota{})
 	require.NoError(t, err)
 
+	// Enable the registries exercised by the test
+	for _, name := range []string{"npm", "nuget", "maven", "go", "helm", "oci", "opa", "cargo", "rubygems"} {
+		require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: name, Enabled: true}).Error)
+	}
+
 	commonDB := &common.Database{DB: db}
 
 	// Setup test storage
@@ -249,8 +254,8 @@ func TestStorageIntegrationWithRegistry(t *testing.T) {
 			uploadedPaths = append(uploadedPaths, artifact.StoragePath)
 		}
 
-		// List files with npm prefix
-		files, err := storageInstance.List(ctx, "npm")
+		// List the deduplicated blobs artifact content is stored as
+		files, err := storageInstance.List(ctx, "blobs")
 		require.NoError(t, err)
 
 		// Verify all uploaded files are in the list
@@ -266,9 +271,14 @@ func TestStorageFactoryIntegrationWithRegistry(t *testing.T) {
 	require.NoError(t, err)
 
 	// Run auto migrations
-	err = db.AutoMigrate(&types.User{}, &types.APIKey{}, &types.Artifact{}, &types.PackageOwnership{})
+	err = db.AutoMigrate(&types.User{}, &types.APIKey{}, &types.Artifact{}, &types.BlobRef{}, &types.PackageOwnership{}, &types.Organization{}, &types.OrganizationMember{}, &types.RegistrySetting{}, &types.Quota{})
 	require.NoError(t, err)
 
+	// Enable the registries exercised by the test
+	for _, name := range []string{"npm", "nuget", "maven", "go", "helm", "oci", "opa", "cargo", "rubygems"} {
+		require.NoError(t, db.Create(&types.RegistrySetting{RegistryName: name, Enabled: true}).Error)
+	}
+
 	commonDB := &common.Database{DB: db}
 
 	// Setup storage through factory